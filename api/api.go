@@ -17,15 +17,18 @@ package api
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/tylerb/graceful"
 
 	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/api/v2"
 	"github.com/coreos/clair/config"
 	"github.com/coreos/clair/utils"
 	"github.com/coreos/pkg/capnslog"
@@ -35,6 +38,93 @@ const timeoutResponse = `{"Error":{"Message":"Clair failed to respond within the
 
 var log = capnslog.NewPackageLogger("github.com/coreos/clair", "api")
 
+const (
+	// streamSuffix ends the paths of the routes streaming their responses, e.g. the NDJSON export
+	// of the vulnerabilities of a namespace.
+	streamSuffix = ".ndjson"
+
+	// bundleSuffix ends the paths of the routes serving vulnerability bundles, which can take
+	// minutes to write and download.
+	bundleSuffix = ".ndjson.gz"
+)
+
+// timeoutHandler bounds the duration of the requests, except for the streams and the bundles:
+// http.TimeoutHandler buffers the whole response, which would defeat them.
+func timeoutHandler(handler http.Handler, timeout time.Duration) http.Handler {
+	bounded := http.TimeoutHandler(handler, timeout, timeoutResponse)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, streamSuffix) || strings.HasSuffix(r.URL.Path, bundleSuffix) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		bounded.ServeHTTP(w, r)
+	})
+}
+
+// idleTimeoutHandler bounds the time that the body of a request may go without being read, and its
+// response without being written, e.g. when a slow client trickles a layer upload. The deadlines
+// are extended after every read and write, hence the streams aren't affected, and they don't
+// apply while the handler works, e.g. while a layer is analyzed.
+func idleTimeoutHandler(handler http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The deadlines of the previous request of the connection still apply.
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+
+		r.Body = &idleReader{ReadCloser: r.Body, rc: rc, timeout: timeout}
+		handler.ServeHTTP(&idleWriter{ResponseWriter: w, rc: rc, timeout: timeout}, r)
+
+		// The server may still discard the rest of the body and write the buffered response once
+		// the handler returns.
+		rc.SetReadDeadline(time.Now().Add(timeout))
+		rc.SetWriteDeadline(time.Now().Add(timeout))
+	})
+}
+
+// idleReader extends the read deadline of a connection before every read of a request body.
+type idleReader struct {
+	io.ReadCloser
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	r.rc.SetReadDeadline(time.Now().Add(r.timeout))
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		// The server then reads in the background to detect when the client goes away, which
+		// would cancel the request once the deadline passes.
+		r.rc.SetReadDeadline(time.Time{})
+	}
+	return n, err
+}
+
+// idleWriter extends the write deadline of a connection before every write of a response.
+type idleWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (w *idleWriter) Write(p []byte) (int, error) {
+	w.rc.SetWriteDeadline(time.Now().Add(w.timeout))
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *idleWriter) Flush() {
+	w.rc.SetWriteDeadline(time.Now().Add(w.timeout))
+	w.rc.Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying http.ResponseWriter.
+func (w *idleWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func Run(config *config.APIConfig, ctx *context.RouteContext, st *utils.Stopper) {
 	defer st.End()
 
@@ -52,16 +142,16 @@ func Run(config *config.APIConfig, ctx *context.RouteContext, st *utils.Stopper)
 	if tlsConfig != nil {
 		log.Info("main API configured with client certificate authentication")
 	}
+	if config.ReadOnly {
+		log.Warning("main API is in read-only mode, write requests will be rejected")
+	}
 
 	srv := &graceful.Server{
 		Timeout:          0,    // Already handled by our TimeOut middleware
 		NoSignalHandling: true, // We want to use our own Stopper
-		Server: &http.Server{
-			Addr:      ":" + strconv.Itoa(config.Port),
-			TLSConfig: tlsConfig,
-			Handler:   http.TimeoutHandler(newAPIHandler(ctx), config.Timeout, timeoutResponse),
-		},
+		Server:           newServer(config.Port, config, timeoutHandler(newAPIHandler(ctx), config.Timeout)),
 	}
+	srv.TLSConfig = tlsConfig
 
 	listenAndServeWithStopper(srv, st, config.CertFile, config.KeyFile)
 
@@ -81,10 +171,7 @@ func RunHealth(config *config.APIConfig, ctx *context.RouteContext, st *utils.St
 	srv := &graceful.Server{
 		Timeout:          10 * time.Second, // Interrupt health checks when stopping
 		NoSignalHandling: true,             // We want to use our own Stopper
-		Server: &http.Server{
-			Addr:    ":" + strconv.Itoa(config.HealthPort),
-			Handler: http.TimeoutHandler(newHealthHandler(ctx), config.Timeout, timeoutResponse),
-		},
+		Server:           newServer(config.HealthPort, config, http.TimeoutHandler(newHealthHandler(ctx), config.Timeout, timeoutResponse)),
 	}
 
 	listenAndServeWithStopper(srv, st, "", "")
@@ -92,6 +179,56 @@ func RunHealth(config *config.APIConfig, ctx *context.RouteContext, st *utils.St
 	log.Info("health API stopped")
 }
 
+// RunGRPC serves the gRPC API, over TLS if the main API has certificates and over cleartext HTTP/2
+// otherwise.
+func RunGRPC(config *config.APIConfig, ctx *context.RouteContext, st *utils.Stopper) {
+	defer st.End()
+
+	// Do not run the gRPC API service if there is no config or port.
+	if config == nil || config.GRPCPort == 0 {
+		log.Infof("gRPC API service is disabled.")
+		return
+	}
+	log.Infof("starting gRPC API on port %d.", config.GRPCPort)
+
+	tlsConfig, err := tlsClientConfig(config.CAFile)
+	if err != nil {
+		log.Fatalf("could not initialize client cert authentication: %s\n", err)
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	// gRPC requires HTTP/2, which TLS clients have to negotiate.
+	tlsConfig.NextProtos = []string{"h2"}
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	srv := &graceful.Server{
+		Timeout:          0,    // The streaming calls have no deadline
+		NoSignalHandling: true, // We want to use our own Stopper
+		Server:           newServer(config.GRPCPort, config, v2.NewGRPCHandler(ctx)),
+	}
+	srv.TLSConfig = tlsConfig
+	srv.Protocols = protocols
+
+	listenAndServeWithStopper(srv, st, config.CertFile, config.KeyFile)
+
+	log.Info("gRPC API stopped")
+}
+
+// newServer creates the HTTP server of an API on the given port, which closes the connections of
+// the clients too slow to send their request headers, or idle for too long.
+func newServer(port int, config *config.APIConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(port),
+		Handler:           idleTimeoutHandler(handler, config.IdleTimeout),
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+}
+
 // listenAndServeWithStopper wraps graceful.Server's
 // ListenAndServe/ListenAndServeTLS and adds the ability to interrupt them with
 // the provided utils.Stopper
@@ -0,0 +1,125 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+)
+
+func TestTimeoutHandler(t *testing.T) {
+	handler := timeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "done")
+	}), 10*time.Millisecond)
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := serve("/v1/layers/layer")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, timeoutResponse, w.Body.String())
+
+	// The streams and the bundles aren't bounded.
+	for _, path := range []string{"/v2/namespaces/debian:8/vulnerabilities.ndjson", "/v2/feed/vulnerabilities.ndjson.gz"} {
+		w = serve(path)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, "done", w.Body.String(), path)
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	bodyErr := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			// The handler works for longer than the idle timeout, e.g. analyzing a layer.
+			time.Sleep(3 * timeout)
+		case "/body":
+			_, err := ioutil.ReadAll(r.Body)
+			bodyErr <- err
+		}
+		io.WriteString(w, "done")
+	})
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Config = newServer(0, &config.APIConfig{ReadHeaderTimeout: timeout, IdleTimeout: timeout}, handler)
+	server.Start()
+	defer server.Close()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	// closed returns how long the server took to close the connection.
+	closed := func(conn net.Conn) time.Duration {
+		start := time.Now()
+		io.Copy(ioutil.Discard, conn)
+		return time.Since(start)
+	}
+
+	// A client too slow to send its headers is disconnected.
+	conn := dial()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: clair\r\n")
+	assert.True(t, closed(conn) < 10*timeout)
+	conn.Close()
+
+	// A client trickling its request body is disconnected once it stops sending it.
+	conn = dial()
+	io.WriteString(conn, "POST /body HTTP/1.1\r\nHost: clair\r\nContent-Length: 10\r\n\r\n1")
+	select {
+	case err := <-bodyErr:
+		assert.NotNil(t, err)
+	case <-time.After(10 * timeout):
+		t.Error("the read of the body didn't time out")
+	}
+	conn.Close()
+
+	// A handler working for longer than the idle timeout isn't interrupted, and the connection is
+	// kept alive between requests until it's idle for too long.
+	conn = dial()
+	reader := bufio.NewReader(conn)
+	for _, path := range []string{"/slow", "/"} {
+		io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: clair\r\n\r\n")
+		resp, err := http.ReadResponse(reader, nil)
+		if assert.Nil(t, err, path) {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+			assert.Equal(t, "done", strings.TrimSpace(string(body)), path)
+		}
+	}
+	assert.True(t, closed(conn) < 10*timeout)
+	conn.Close()
+}
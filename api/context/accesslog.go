@@ -0,0 +1,215 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/coreos/clair/config"
+)
+
+// sensitiveHeaders are left out of the headers logged with the slow requests.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// AccessLog logs the requests to the API as JSON lines, sampled by route, except for the slow and
+// failing requests that are always logged.
+type AccessLog struct {
+	mu       sync.Mutex
+	w        io.Writer
+	cfg      config.AccessLogConfig
+	requests map[string]int
+}
+
+// NewAccessLog returns an AccessLog appending to the configured file, or writing to the standard
+// output if there is none.
+func NewAccessLog(cfg *config.AccessLogConfig) (*AccessLog, error) {
+	if cfg.Path == "" {
+		return newAccessLog(os.Stdout, cfg), nil
+	}
+
+	f, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return newAccessLog(f, cfg), nil
+}
+
+func newAccessLog(w io.Writer, cfg *config.AccessLogConfig) *AccessLog {
+	return &AccessLog{w: w, cfg: *cfg, requests: make(map[string]int)}
+}
+
+// accessLogEntry is a line of the access log.
+type accessLogEntry struct {
+	Time                  time.Time
+	RemoteAddr            string
+	Method                string
+	URI                   string
+	Route                 string
+	Template              string
+	Status                int
+	DurationMilliseconds  float64
+	DatastoreMilliseconds float64
+	DatastoreCalls        int
+	Slow                  bool                     `json:",omitempty"`
+	Datastore             map[string]datastoreTime `json:",omitempty"`
+	Headers               http.Header              `json:",omitempty"`
+}
+
+// log writes the entry of a request if it is sampled, slow or failed with a server error.
+func (l *AccessLog) log(r *http.Request, p httprouter.Params, route string, status int, start time.Time, datastore *datastoreTimes) {
+	duration := time.Since(start)
+	slow := l.cfg.SlowThreshold > 0 && duration > l.cfg.SlowThreshold
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.sampled(route) && !slow && status < http.StatusInternalServerError {
+		return
+	}
+
+	entry := accessLogEntry{
+		Time:                 start.UTC(),
+		RemoteAddr:           r.RemoteAddr,
+		Method:               r.Method,
+		URI:                  r.RequestURI,
+		Route:                route,
+		Template:             routeTemplate(r.URL.Path, p),
+		Status:               status,
+		DurationMilliseconds: milliseconds(duration),
+	}
+	if datastore != nil {
+		times, total, calls := datastore.breakdown()
+		entry.DatastoreMilliseconds = milliseconds(total)
+		entry.DatastoreCalls = calls
+		if slow {
+			entry.Datastore = times
+		}
+	}
+	if slow {
+		entry.Slow = true
+		entry.Headers = make(http.Header, len(r.Header))
+		for name, values := range r.Header {
+			entry.Headers[name] = values
+		}
+		for _, name := range sensitiveHeaders {
+			entry.Headers.Del(name)
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Warningf("could not encode the access log entry of %s: %s", r.RequestURI, err)
+		return
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		log.Warningf("could not write the access log: %s", err)
+	}
+}
+
+// sampled counts a request to the given route and returns whether it is one in every configured
+// number of requests. It must be called with the lock held.
+func (l *AccessLog) sampled(route string) bool {
+	sample, ok := l.cfg.RouteSamples[route]
+	if !ok {
+		sample = l.cfg.Sample
+	}
+	if sample <= 1 {
+		return true
+	}
+
+	n := l.requests[route]
+	l.requests[route] = (n + 1) % sample
+	return n == 0
+}
+
+// routeTemplate returns the template of the route that matched the given path, e.g.
+// "/v2/layers/:layerName", by substituting its parameters.
+func routeTemplate(path string, p httprouter.Params) string {
+	segments := strings.Split(path, "/")
+	next := 0
+	for _, param := range p {
+		// A catch-all parameter holds the rest of the path.
+		if strings.HasPrefix(param.Value, "/") {
+			template := strings.Join(segments, "/")
+			if strings.HasSuffix(template, param.Value) {
+				return strings.TrimSuffix(template, param.Value) + "/*" + param.Key
+			}
+			continue
+		}
+		for i := next; i < len(segments); i++ {
+			if segments[i] == param.Value {
+				segments[i] = ":" + param.Key
+				next = i + 1
+				break
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// datastoreTime is the time spent in a method of the datastore during a request.
+type datastoreTime struct {
+	Calls        int
+	Milliseconds float64
+}
+
+// datastoreTimes records the time spent in every method of the datastore during a request.
+type datastoreTimes struct {
+	mu    sync.Mutex
+	calls map[string]int
+	times map[string]time.Duration
+}
+
+func (t *datastoreTimes) ObserveCall(method string, duration time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.calls == nil {
+		t.calls = make(map[string]int)
+		t.times = make(map[string]time.Duration)
+	}
+	t.calls[method]++
+	t.times[method] += duration
+}
+
+func (t *datastoreTimes) ObserveLock(name string, renew, locked bool) {}
+
+// breakdown returns the time spent in every method, and the total time and number of calls.
+func (t *datastoreTimes) breakdown() (map[string]datastoreTime, time.Duration, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var total time.Duration
+	var calls int
+	times := make(map[string]datastoreTime, len(t.calls))
+	for method, n := range t.calls {
+		times[method] = datastoreTime{Calls: n, Milliseconds: milliseconds(t.times[method])}
+		total += t.times[method]
+		calls += n
+	}
+	return times, total, calls
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
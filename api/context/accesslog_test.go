@@ -0,0 +1,127 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	delay := time.Duration(0)
+	status := http.StatusOK
+	ctx := &RouteContext{
+		Store: &database.MockDatastore{
+			FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+				time.Sleep(delay)
+				return database.Layer{Name: name}, nil
+			},
+		},
+		AccessLog: newAccessLog(&buf, &config.AccessLogConfig{
+			Sample:        2,
+			RouteSamples:  map[string]int{"v2/getNamespaces": 1},
+			SlowThreshold: 50 * time.Millisecond,
+		}),
+	}
+
+	router := httprouter.New()
+	router.GET("/v2/layers/:layerName", HTTPHandler(func(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *RouteContext) (string, int) {
+		ctx.Store.FindLayer(p.ByName("layerName"), false, false)
+		w.WriteHeader(status)
+		return "v2/getLayer", status
+	}, ctx))
+	router.GET("/v2/namespaces", HTTPHandler(func(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *RouteContext) (string, int) {
+		return "v2/getNamespaces", http.StatusOK
+	}, ctx))
+
+	entries := func() (entries []accessLogEntry) {
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var entry accessLogEntry
+			assert.Nil(t, json.Unmarshal([]byte(line), &entry))
+			entries = append(entries, entry)
+		}
+		buf.Reset()
+		return
+	}
+	get := func(path string) {
+		r, _ := http.NewRequest("GET", path, nil)
+		r.RequestURI = path
+		r.Header.Set("Authorization", "Bearer s3cr3t")
+		r.Header.Set("User-Agent", "test")
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// One in two requests to a route is logged, unless the route overrides it.
+	for i := 0; i < 4; i++ {
+		get("/v2/layers/layer")
+		get("/v2/namespaces")
+	}
+	logged := entries()
+	if assert.Len(t, logged, 6) {
+		assert.Equal(t, "v2/getLayer", logged[0].Route)
+		assert.Equal(t, "/v2/layers/:layerName", logged[0].Template)
+		assert.Equal(t, "/v2/layers/layer", logged[0].URI)
+		assert.Equal(t, http.StatusOK, logged[0].Status)
+		assert.Equal(t, 1, logged[0].DatastoreCalls)
+		assert.False(t, logged[0].Slow)
+		assert.Nil(t, logged[0].Datastore)
+		assert.Nil(t, logged[0].Headers)
+	}
+
+	// The failing requests are always logged.
+	status = http.StatusInternalServerError
+	get("/v2/layers/layer")
+	get("/v2/layers/layer")
+	assert.Len(t, entries(), 2)
+
+	// The slow requests are always logged, with the time spent in the datastore and the headers.
+	status = http.StatusOK
+	delay = 60 * time.Millisecond
+	get("/v2/layers/layer")
+	get("/v2/layers/layer")
+	logged = entries()
+	if assert.Len(t, logged, 2) {
+		assert.True(t, logged[0].Slow)
+		assert.True(t, logged[0].DatastoreMilliseconds >= 60)
+		assert.Equal(t, 1, logged[0].Datastore["FindLayer"].Calls)
+		assert.Equal(t, "test", logged[0].Headers.Get("User-Agent"))
+		assert.Empty(t, logged[0].Headers.Get("Authorization"))
+	}
+}
+
+func TestRouteTemplate(t *testing.T) {
+	assert.Equal(t, "/v2/layers/:layerName", routeTemplate("/v2/layers/sha256", httprouter.Params{{Key: "layerName", Value: "sha256"}}))
+	assert.Equal(t, "/v1/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", routeTemplate("/v1/namespaces/debian/vulnerabilities/debian", httprouter.Params{
+		{Key: "namespaceName", Value: "debian"},
+		{Key: "vulnerabilityName", Value: "debian"},
+	}))
+	assert.Equal(t, "/v2/images/*image", routeTemplate("/v2/images/quay.io/coreos/clair", httprouter.Params{{Key: "image", Value: "/quay.io/coreos/clair"}}))
+	assert.Equal(t, "/v2/namespaces", routeTemplate("/v2/namespaces", nil))
+}
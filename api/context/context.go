@@ -15,6 +15,7 @@
 package context
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -25,7 +26,9 @@ import (
 
 	"github.com/coreos/clair/config"
 	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/tracing"
 	"github.com/coreos/clair/utils"
+	"github.com/coreos/clair/worker"
 )
 
 var (
@@ -47,18 +50,58 @@ type Handler func(http.ResponseWriter, *http.Request, httprouter.Params, *RouteC
 func HTTPHandler(handler Handler, ctx *RouteContext) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		start := time.Now()
-		route, status := handler(w, r, p, ctx)
+
+		// The requests are traced as children of the span of their caller, if it propagated one.
+		template := routeTemplate(r.URL.Path, p)
+		tctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), r.Method+" "+template, tracing.KindServer)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", template)
+
+		// The requests are handled with a copy of the context whose datastore records the time
+		// spent in each of its methods, for the access log, traces them, and makes its queries
+		// with the context of the request, so that they are canceled once it is.
+		rctx := ctx
+		var datastore *datastoreTimes
+		if ctx.Store != nil {
+			c := *ctx
+			if ctx.AccessLog != nil {
+				datastore = &datastoreTimes{}
+				c.Store = database.Observe(c.Store, datastore)
+			}
+			c.Store = tracing.Datastore(tctx, c.Store)
+			rctx = &c
+		}
+
+		route, status := handler(w, r.WithContext(tctx), p, rctx)
 		statusStr := strconv.Itoa(status)
 		if status == 0 {
 			statusStr = "???"
 		}
 		utils.PrometheusObserveTimeMilliseconds(promResponseDurationMilliseconds.WithLabelValues(route, statusStr), start)
 
+		span.SetAttribute("clair.route", route)
+		span.SetAttribute("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.End(errors.New(http.StatusText(status)))
+		} else {
+			span.End(nil)
+		}
+
 		log.Infof("%s \"%s %s\" %s (%s)", r.RemoteAddr, r.Method, r.RequestURI, statusStr, time.Since(start))
+		if ctx.AccessLog != nil {
+			ctx.AccessLog.log(r, p, route, status, start, datastore)
+		}
 	}
 }
 
 type RouteContext struct {
 	Store  database.Datastore
 	Config *config.APIConfig
+
+	// Queue bounds the number of layers indexed concurrently; layers are indexed immediately if
+	// it is nil.
+	Queue *worker.Queue
+
+	// AccessLog, if set, logs the requests as JSON lines.
+	AccessLog *AccessLog
 }
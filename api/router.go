@@ -15,25 +15,84 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	netcontext "golang.org/x/net/context"
 
 	"github.com/coreos/clair/api/context"
 	"github.com/coreos/clair/api/v1"
+	"github.com/coreos/clair/api/v2"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/health"
+	"github.com/coreos/clair/version"
 )
 
+// healthTimeout bounds the time spent checking the health of every service.
+const healthTimeout = 5 * time.Second
+
+var promAPIVersionRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "clair_api_version_requests_total",
+	Help: "Number of requests received by each version of the API.",
+}, []string{"version", "deprecated"})
+
+func init() {
+	prometheus.MustRegister(promAPIVersionRequestsTotal)
+}
+
+type serviceHealth struct {
+	Status              database.HealthState `json:"Status"`
+	Reason              string               `json:"Reason,omitempty"`
+	LatencyMilliseconds float64              `json:"LatencyMilliseconds"`
+	Version             string               `json:"Version,omitempty"`
+	Message             string               `json:"Message,omitempty"`
+}
+
+type healthReport struct {
+	Status   database.HealthState     `json:"Status"`
+	Reason   string                   `json:"Reason,omitempty"`
+	Services map[string]serviceHealth `json:"Services"`
+}
+
+func healthReportFromReport(report health.Report) healthReport {
+	r := healthReport{Status: report.State, Reason: report.Reason, Services: make(map[string]serviceHealth)}
+	for name, status := range report.Services {
+		r.Services[name] = serviceHealth{
+			Status:              status.State,
+			Reason:              status.Reason,
+			LatencyMilliseconds: float64(status.Latency.Nanoseconds()) / float64(time.Millisecond),
+			Version:             status.Version,
+			Message:             status.Message,
+		}
+	}
+	return r
+}
+
+// apiVersion is a version of the API, served by its own sub-router.
+type apiVersion struct {
+	router *httprouter.Router
+
+	// successor is the version superseding this one if it is deprecated, or is empty otherwise.
+	// Responses of deprecated versions carry a Deprecation header and a link to their successor.
+	successor string
+}
+
 // router is an HTTP router that forwards requests to the appropriate sub-router
 // depending on the API version specified in the request URI.
-type router map[string]*httprouter.Router
+type router map[string]apiVersion
 
 // Let's hope we never have more than 99 API versions.
 const apiVersionLength = len("v99")
 
 func newAPIHandler(ctx *context.RouteContext) http.Handler {
 	router := make(router)
-	router["/v1"] = v1.NewRouter(ctx)
+	router["/v1"] = apiVersion{router: v1.NewRouter(ctx), successor: "/v2"}
+	router["/v2"] = apiVersion{router: v2.NewRouter(ctx)}
 	return router
 }
 
@@ -44,33 +103,100 @@ func (rtr router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		version = urlStr[:apiVersionLength]
 	}
 
-	if router, _ := rtr[version]; router != nil {
+	if apiVersion, ok := rtr[version]; ok {
+		deprecated := apiVersion.successor != ""
+		promAPIVersionRequestsTotal.WithLabelValues(strings.TrimPrefix(version, "/"), fmt.Sprint(deprecated)).Inc()
+
+		if deprecated {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", apiVersion.successor))
+		}
+
 		// Remove the version number from the request path to let the router do its
 		// job but do not update the RequestURI
 		r.URL.Path = strings.Replace(r.URL.Path, version, "", 1)
-		router.ServeHTTP(w, r)
+		apiVersion.router.ServeHTTP(w, r)
 		return
 	}
 
-	log.Infof("%s %d %s %s", http.StatusNotFound, r.Method, r.RequestURI, r.RemoteAddr)
+	log.Infof("%d %s %s %s", http.StatusNotFound, r.Method, r.RequestURI, r.RemoteAddr)
 	http.NotFound(w, r)
 }
 
 func newHealthHandler(ctx *context.RouteContext) http.Handler {
 	router := httprouter.New()
 	router.GET("/health", context.HTTPHandler(getHealth, ctx))
+	router.GET("/healthz", context.HTTPHandler(getLiveness, ctx))
+	router.GET("/readyz", context.HTTPHandler(getReadiness, ctx))
+	router.GET("/version", context.HTTPHandler(getVersion, ctx))
+	router.GET("/metrics", context.HTTPHandler(getMetrics, ctx))
 	return router
 }
 
+// getHealth reports the health of every service, and fails when any of them is unhealthy.
 func getHealth(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
-	header := w.Header()
-	header.Set("Server", "clair")
+	report := checkHealth(r.Context(), false)
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusInternalServerError
+	}
+	return "health", writeHealthReport(w, report, status)
+}
+
+// getLiveness reports the health of the services of Clair itself, leaving out the ones it depends
+// on, such as the datastore, so that orchestrators only restart Clair when that can help.
+func getLiveness(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	report := checkHealth(r.Context(), true)
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	return "healthz", writeHealthReport(w, report, status)
+}
+
+// getReadiness reports the health of every service, and whether Clair can serve requests.
+func getReadiness(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	report := checkHealth(r.Context(), false)
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	return "readyz", writeHealthReport(w, report, status)
+}
+
+func checkHealth(ctx netcontext.Context, liveness bool) health.Report {
+	healthCtx, cancel := netcontext.WithTimeout(ctx, healthTimeout)
+	defer cancel()
 
-	status := http.StatusInternalServerError
-	if ctx.Store.Ping() {
-		status = http.StatusOK
+	report := health.Check(healthCtx, liveness)
+	if !report.Ready() {
+		log.Warningf("unhealthy: %s", report.Reason)
 	}
+	return report
+}
+
+func writeHealthReport(w http.ResponseWriter, report health.Report, status int) int {
+	header := w.Header()
+	header.Set("Server", "clair")
+	header.Set("Content-Type", "application/json;charset=utf-8")
 
 	w.WriteHeader(status)
-	return "health", status
+	json.NewEncoder(w).Encode(healthReportFromReport(report))
+	return status
+}
+
+func getVersion(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	header := w.Header()
+	header.Set("Server", "clair")
+	header.Set("Content-Type", "application/json;charset=utf-8")
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(version.Get())
+	return "version", http.StatusOK
+}
+
+// getMetrics serves the Prometheus metrics, which the v1 API also serves on /v1/metrics.
+func getMetrics(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	prometheus.Handler().ServeHTTP(w, r)
+	return "metrics", 0
 }
@@ -0,0 +1,136 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	apicontext "github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/health"
+)
+
+func TestHealth(t *testing.T) {
+	var dbStatus database.HealthStatus
+	var dbErr error
+	health.Register("database", health.CheckDatastore(&database.MockDatastore{
+		FctHealth: func(ctx context.Context) (database.HealthStatus, error) {
+			return dbStatus, dbErr
+		},
+	}), true)
+	defer health.Unregister("database")
+	health.Register("updater", func(ctx context.Context) health.Status {
+		return health.Status{State: database.Healthy}
+	}, false)
+	defer health.Unregister("updater")
+
+	handler := newHealthHandler(&apicontext.RouteContext{})
+	get := func(path string) (int, healthReport) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, "application/json;charset=utf-8", w.Header().Get("Content-Type"))
+
+		var report healthReport
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+
+	dbStatus = database.HealthStatus{State: database.Healthy, Version: "9.6", Latency: 1500 * time.Microsecond}
+	for _, path := range []string{"/health", "/readyz"} {
+		status, report := get(path)
+		assert.Equal(t, http.StatusOK, status, path)
+		assert.Equal(t, database.Healthy, report.Status, path)
+		assert.Empty(t, report.Reason, path)
+		if assert.Contains(t, report.Services, "database", path) {
+			assert.Equal(t, serviceHealth{Status: database.Healthy, LatencyMilliseconds: 1.5, Version: "9.6"}, report.Services["database"], path)
+		}
+	}
+
+	// A degraded datastore doesn't make Clair unready.
+	dbStatus = database.HealthStatus{State: database.Degraded, Message: "slow"}
+	status, report := get("/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, database.Degraded, report.Status)
+	assert.Equal(t, "database/"+health.ReasonDegraded, report.Reason)
+
+	// An unreachable datastore makes Clair unready but not dead, as restarting it wouldn't help.
+	dbStatus, dbErr = database.HealthStatus{}, errors.New("connection refused")
+	status, report = get("/health")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, "database/"+health.ReasonUnreachable, report.Reason)
+	assert.Equal(t, "connection refused", report.Services["database"].Message)
+
+	status, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, database.Unhealthy, report.Status)
+
+	status, report = get("/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, database.Healthy, report.Status)
+	assert.NotContains(t, report.Services, "database")
+	assert.Contains(t, report.Services, "updater")
+}
+
+func TestAPIVersions(t *testing.T) {
+	requests := func(version, deprecated string) float64 {
+		var metric dto.Metric
+		assert.Nil(t, promAPIVersionRequestsTotal.WithLabelValues(version, deprecated).Write(&metric))
+		return metric.GetCounter().GetValue()
+	}
+
+	handler := newAPIHandler(&apicontext.RouteContext{
+		Store: &database.MockDatastore{
+			FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+				return database.Layer{Name: name}, nil
+			},
+		},
+		Config: &config.APIConfig{},
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	// The deprecated v1 API links to its successor.
+	v1Requests := requests("v1", "true")
+	w := get("/v1/layers/layer")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, `</v2>; rel="successor-version"`, w.Header().Get("Link"))
+	assert.Equal(t, v1Requests+1, requests("v1", "true"))
+
+	v2Requests := requests("v2", "false")
+	w = get("/v2/layers/layer")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Empty(t, w.Header().Get("Link"))
+	assert.Equal(t, v2Requests+1, requests("v2", "false"))
+
+	// Unknown versions are neither served nor counted.
+	assert.Equal(t, http.StatusNotFound, get("/v3/layers/layer").Code)
+	assert.Equal(t, v1Requests+1, requests("v1", "true"))
+	assert.Equal(t, v2Requests+1, requests("v2", "false"))
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package token implements the opaque tokens that the API versions use to paginate.
+//
+// A token is a JSON value encrypted and signed with the pagination key, and expires after an hour.
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fernet/fernet-go"
+)
+
+// ttl is the duration after which a token expires.
+const ttl = time.Hour
+
+// ErrInvalid is returned when a token can't be decrypted, or is expired.
+var ErrInvalid = errors.New("invalid or expired pagination token")
+
+// Unmarshal decrypts the given token and decodes its value into v.
+func Unmarshal(token string, key string, v interface{}) error {
+	k, _ := fernet.DecodeKey(key)
+	msg := fernet.VerifyAndDecrypt([]byte(token), ttl, []*fernet.Key{k})
+	if msg == nil {
+		return ErrInvalid
+	}
+
+	return json.NewDecoder(bytes.NewBuffer(msg)).Decode(&v)
+}
+
+// Marshal encodes v and encrypts it into a token.
+func Marshal(v interface{}, key string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	k, _ := fernet.DecodeKey(key)
+	return fernet.EncryptAndSign(buf.Bytes(), k)
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"testing"
+
+	"github.com/fernet/fernet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	var key fernet.Key
+	assert.Nil(t, key.Generate())
+
+	tok, err := Marshal(42, key.Encode())
+	if assert.Nil(t, err) {
+		var v int
+		assert.Nil(t, Unmarshal(string(tok), key.Encode(), &v))
+		assert.Equal(t, 42, v)
+	}
+
+	var otherKey fernet.Key
+	assert.Nil(t, otherKey.Generate())
+	var v int
+	assert.Equal(t, ErrInvalid, Unmarshal(string(tok), otherKey.Encode(), &v))
+}
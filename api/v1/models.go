@@ -15,15 +15,12 @@
 package v1
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"time"
 
 	"github.com/coreos/pkg/capnslog"
-	"github.com/fernet/fernet-go"
 
+	"github.com/coreos/clair/api/token"
 	"github.com/coreos/clair/database"
 	"github.com/coreos/clair/ext/versionfmt"
 	"github.com/coreos/clair/utils/types"
@@ -39,17 +36,20 @@ type Layer struct {
 	Name             string            `json:"Name,omitempty"`
 	NamespaceName    string            `json:"NamespaceName,omitempty"`
 	Path             string            `json:"Path,omitempty"`
+	Digest           string            `json:"Digest,omitempty"`
 	Headers          map[string]string `json:"Headers,omitempty"`
 	ParentName       string            `json:"ParentName,omitempty"`
 	Format           string            `json:"Format,omitempty"`
 	IndexedByVersion int               `json:"IndexedByVersion,omitempty"`
 	Features         []Feature         `json:"Features,omitempty"`
+	Stats            *LayerStats       `json:"Stats,omitempty"`
 }
 
 func LayerFromDatabaseModel(dbLayer database.Layer, withFeatures, withVulnerabilities bool) Layer {
 	layer := Layer{
 		Name:             dbLayer.Name,
 		IndexedByVersion: dbLayer.EngineVersion,
+		Stats:            layerStatsFromDatabaseModel(dbLayer.Stats),
 	}
 
 	if dbLayer.Parent != nil {
@@ -78,6 +78,8 @@ func LayerFromDatabaseModel(dbLayer database.Layer, withFeatures, withVulnerabil
 					Link:          dbVuln.Link,
 					Severity:      string(dbVuln.Severity),
 					Metadata:      dbVuln.Metadata,
+					Sources:       vulnerabilitySourcesFromDatabaseModel(dbVuln.Sources),
+					CVSS:          vulnerabilityCVSSFromDatabaseModel(dbVuln.CVSS),
 				}
 
 				if dbVuln.FixedBy != versionfmt.MaxVersion {
@@ -92,6 +94,39 @@ func LayerFromDatabaseModel(dbLayer database.Layer, withFeatures, withVulnerabil
 	return layer
 }
 
+// LayerStats is what the analysis of a layer processed, and how long it took, in seconds.
+type LayerStats struct {
+	BytesRead        int64              `json:"BytesRead"`
+	FilesInspected   int                `json:"FilesInspected"`
+	FilesMatched     int                `json:"FilesMatched"`
+	BytesMatched     int64              `json:"BytesMatched"`
+	Seconds          float64            `json:"Seconds"`
+	DetectorsSeconds map[string]float64 `json:"DetectorsSeconds,omitempty"`
+}
+
+// layerStatsFromDatabaseModel returns the statistics of the analysis of a layer, or nil if they
+// weren't recorded, e.g. for the layers analyzed before they were.
+func layerStatsFromDatabaseModel(dbStats database.LayerStats) *LayerStats {
+	if dbStats.Duration == 0 {
+		return nil
+	}
+
+	stats := &LayerStats{
+		BytesRead:      dbStats.BytesRead,
+		FilesInspected: dbStats.FilesInspected,
+		FilesMatched:   dbStats.FilesMatched,
+		BytesMatched:   dbStats.BytesMatched,
+		Seconds:        dbStats.Duration.Seconds(),
+	}
+	if len(dbStats.Detectors) > 0 {
+		stats.DetectorsSeconds = make(map[string]float64, len(dbStats.Detectors))
+		for name, duration := range dbStats.Detectors {
+			stats.DetectorsSeconds[name] = duration.Seconds()
+		}
+	}
+	return stats
+}
+
 type Namespace struct {
 	Name          string `json:"Name,omitempty"`
 	VersionFormat string `json:"VersionFormat,omitempty"`
@@ -104,10 +139,70 @@ type Vulnerability struct {
 	Link          string                 `json:"Link,omitempty"`
 	Severity      string                 `json:"Severity,omitempty"`
 	Metadata      map[string]interface{} `json:"Metadata,omitempty"`
+	Sources       []VulnerabilitySource  `json:"Sources,omitempty"`
+	CVSS          *VulnerabilityCVSS     `json:"CVSS,omitempty"`
 	FixedBy       string                 `json:"FixedBy,omitempty"`
 	FixedIn       []Feature              `json:"FixedIn,omitempty"`
 }
 
+type VulnerabilitySource struct {
+	Name    string `json:"Name,omitempty"`
+	URL     string `json:"URL,omitempty"`
+	License string `json:"License,omitempty"`
+}
+
+func vulnerabilitySourcesFromDatabaseModel(dbSources database.VulnerabilitySources) []VulnerabilitySource {
+	var sources []VulnerabilitySource
+	for _, dbSource := range dbSources {
+		sources = append(sources, VulnerabilitySource{
+			Name:    dbSource.Name,
+			URL:     dbSource.URL,
+			License: dbSource.License,
+		})
+	}
+	return sources
+}
+
+// VulnerabilityCVSS holds the CVSS v2 and v3 vectors and base scores of a Vulnerability.
+type VulnerabilityCVSS struct {
+	V2 *CVSS `json:"V2,omitempty"`
+	V3 *CVSS `json:"V3,omitempty"`
+}
+
+type CVSS struct {
+	Vector string  `json:"Vector,omitempty"`
+	Score  float64 `json:"Score"`
+}
+
+func vulnerabilityCVSSFromDatabaseModel(dbCVSS database.VulnerabilityCVSS) *VulnerabilityCVSS {
+	if dbCVSS.V2 == nil && dbCVSS.V3 == nil {
+		return nil
+	}
+
+	var cvss VulnerabilityCVSS
+	if dbCVSS.V2 != nil {
+		cvss.V2 = &CVSS{Vector: dbCVSS.V2.Vector, Score: dbCVSS.V2.Score}
+	}
+	if dbCVSS.V3 != nil {
+		cvss.V3 = &CVSS{Vector: dbCVSS.V3.Vector, Score: dbCVSS.V3.Score}
+	}
+	return &cvss
+}
+
+func (cvss *VulnerabilityCVSS) databaseModel() database.VulnerabilityCVSS {
+	var dbCVSS database.VulnerabilityCVSS
+	if cvss == nil {
+		return dbCVSS
+	}
+	if cvss.V2 != nil {
+		dbCVSS.V2 = &types.CVSS{Vector: cvss.V2.Vector, Score: cvss.V2.Score}
+	}
+	if cvss.V3 != nil {
+		dbCVSS.V3 = &types.CVSS{Vector: cvss.V3.Vector, Score: cvss.V3.Score}
+	}
+	return dbCVSS
+}
+
 func (v Vulnerability) DatabaseModel() (database.Vulnerability, error) {
 	severity := types.Priority(v.Severity)
 	if !severity.IsValid() {
@@ -124,6 +219,15 @@ func (v Vulnerability) DatabaseModel() (database.Vulnerability, error) {
 		dbFeatures = append(dbFeatures, dbFeature)
 	}
 
+	var dbSources database.VulnerabilitySources
+	for _, source := range v.Sources {
+		dbSources = append(dbSources, database.VulnerabilitySource{
+			Name:    source.Name,
+			URL:     source.URL,
+			License: source.License,
+		})
+	}
+
 	return database.Vulnerability{
 		Name:        v.Name,
 		Namespace:   database.Namespace{Name: v.NamespaceName},
@@ -131,6 +235,8 @@ func (v Vulnerability) DatabaseModel() (database.Vulnerability, error) {
 		Link:        v.Link,
 		Severity:    severity,
 		Metadata:    v.Metadata,
+		Sources:     dbSources,
+		CVSS:        v.CVSS.databaseModel(),
 		FixedIn:     dbFeatures,
 	}, nil
 }
@@ -143,6 +249,8 @@ func VulnerabilityFromDatabaseModel(dbVuln database.Vulnerability, withFixedIn b
 		Link:          dbVuln.Link,
 		Severity:      string(dbVuln.Severity),
 		Metadata:      dbVuln.Metadata,
+		Sources:       vulnerabilitySourcesFromDatabaseModel(dbVuln.Sources),
+		CVSS:          vulnerabilityCVSSFromDatabaseModel(dbVuln.CVSS),
 	}
 
 	if withFixedIn {
@@ -209,11 +317,32 @@ type Notification struct {
 	Created  string                   `json:"Created,omitempty"`
 	Notified string                   `json:"Notified,omitempty"`
 	Deleted  string                   `json:"Deleted,omitempty"`
+	Reason   string                   `json:"Reason,omitempty"`
 	Limit    int                      `json:"Limit,omitempty"`
 	Page     string                   `json:"Page,omitempty"`
 	NextPage string                   `json:"NextPage,omitempty"`
 	Old      *VulnerabilityWithLayers `json:"Old,omitempty"`
 	New      *VulnerabilityWithLayers `json:"New,omitempty"`
+	Changes  *VulnerabilityChanges    `json:"Changes,omitempty"`
+}
+
+// VulnerabilityChanges is the difference between the Old and New vulnerabilities of a
+// Notification.
+type VulnerabilityChanges struct {
+	ChangedFields  []string  `json:"ChangedFields,omitempty"`
+	AddedFixedIn   []Feature `json:"AddedFixedIn,omitempty"`
+	RemovedFixedIn []Feature `json:"RemovedFixedIn,omitempty"`
+}
+
+func VulnerabilityChangesFromDatabaseModel(dbDiff database.VulnerabilityDiff) VulnerabilityChanges {
+	changes := VulnerabilityChanges{ChangedFields: dbDiff.ChangedFields}
+	for _, dbFeatureVersion := range dbDiff.AddedFixedIn {
+		changes.AddedFixedIn = append(changes.AddedFixedIn, FeatureFromDatabaseModel(dbFeatureVersion))
+	}
+	for _, dbFeatureVersion := range dbDiff.RemovedFixedIn {
+		changes.RemovedFixedIn = append(changes.RemovedFixedIn, FeatureFromDatabaseModel(dbFeatureVersion))
+	}
+	return changes
 }
 
 func NotificationFromDatabaseModel(dbNotification database.VulnerabilityNotification, limit int, pageToken string, nextPage database.VulnerabilityNotificationPageNumber, key string) Notification {
@@ -231,7 +360,7 @@ func NotificationFromDatabaseModel(dbNotification database.VulnerabilityNotifica
 
 	var nextPageStr string
 	if nextPage != database.NoVulnerabilityNotificationPage {
-		nextPageBytes, _ := tokenMarshal(nextPage, key)
+		nextPageBytes, _ := token.Marshal(nextPage, key)
 		nextPageStr = string(nextPageBytes)
 	}
 
@@ -246,18 +375,62 @@ func NotificationFromDatabaseModel(dbNotification database.VulnerabilityNotifica
 		deleted = fmt.Sprintf("%d", dbNotification.Deleted.Unix())
 	}
 
-	// TODO(jzelinskie): implement "changed" key
+	changes := VulnerabilityChangesFromDatabaseModel(database.DiffVulnerabilities(dbNotification.OldVulnerability, dbNotification.NewVulnerability))
+
 	fmt.Println(dbNotification.Deleted.IsZero())
 	return Notification{
 		Name:     dbNotification.Name,
 		Created:  created,
 		Notified: notified,
 		Deleted:  deleted,
+		Reason:   string(dbNotification.Reason),
 		Limit:    limit,
 		Page:     pageToken,
 		NextPage: nextPageStr,
 		Old:      oldVuln,
 		New:      newVuln,
+		Changes:  &changes,
+	}
+}
+
+type NotificationDelivery struct {
+	Notifier  string                        `json:"Notifier,omitempty"`
+	Key       string                        `json:"Key,omitempty"`
+	Created   string                        `json:"Created,omitempty"`
+	Delivered string                        `json:"Delivered,omitempty"`
+	Attempts  []NotificationDeliveryAttempt `json:"Attempts,omitempty"`
+}
+
+type NotificationDeliveryAttempt struct {
+	Attempted string `json:"Attempted,omitempty"`
+	Succeeded bool   `json:"Succeeded"`
+	Error     string `json:"Error,omitempty"`
+}
+
+func NotificationDeliveryFromDatabaseModel(dbDelivery database.NotificationDelivery) NotificationDelivery {
+	var created, delivered string
+	if !dbDelivery.Created.IsZero() {
+		created = fmt.Sprintf("%d", dbDelivery.Created.Unix())
+	}
+	if !dbDelivery.Delivered.IsZero() {
+		delivered = fmt.Sprintf("%d", dbDelivery.Delivered.Unix())
+	}
+
+	var attempts []NotificationDeliveryAttempt
+	for _, dbAttempt := range dbDelivery.Attempts {
+		attempts = append(attempts, NotificationDeliveryAttempt{
+			Attempted: fmt.Sprintf("%d", dbAttempt.Attempted.Unix()),
+			Succeeded: dbAttempt.Succeeded,
+			Error:     dbAttempt.Error,
+		})
+	}
+
+	return NotificationDelivery{
+		Notifier:  dbDelivery.Notifier,
+		Key:       dbDelivery.Key,
+		Created:   created,
+		Delivered: delivered,
+		Attempts:  attempts,
 	}
 }
 
@@ -319,29 +492,13 @@ type NotificationEnvelope struct {
 	Error        *Error        `json:"Error,omitempty"`
 }
 
+type NotificationDeliveryEnvelope struct {
+	Deliveries *[]NotificationDelivery `json:"Deliveries,omitempty"`
+	Error      *Error                  `json:"Error,omitempty"`
+}
+
 type FeatureEnvelope struct {
 	Feature  *Feature   `json:"Feature,omitempty"`
 	Features *[]Feature `json:"Features,omitempty"`
 	Error    *Error     `json:"Error,omitempty"`
 }
-
-func tokenUnmarshal(token string, key string, v interface{}) error {
-	k, _ := fernet.DecodeKey(key)
-	msg := fernet.VerifyAndDecrypt([]byte(token), time.Hour, []*fernet.Key{k})
-	if msg == nil {
-		return errors.New("invalid or expired pagination token")
-	}
-
-	return json.NewDecoder(bytes.NewBuffer(msg)).Decode(&v)
-}
-
-func tokenMarshal(v interface{}, key string) ([]byte, error) {
-	var buf bytes.Buffer
-	err := json.NewEncoder(&buf).Encode(v)
-	if err != nil {
-		return nil, err
-	}
-
-	k, _ := fernet.DecodeKey(key)
-	return fernet.EncryptAndSign(buf.Bytes(), k)
-}
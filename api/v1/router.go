@@ -26,28 +26,29 @@ func NewRouter(ctx *context.RouteContext) *httprouter.Router {
 	router := httprouter.New()
 
 	// Layers
-	router.POST("/layers", context.HTTPHandler(postLayer, ctx))
+	router.POST("/layers", context.HTTPHandler(writeHandler(postLayer), ctx))
 	router.GET("/layers/:layerName", context.HTTPHandler(getLayer, ctx))
-	router.DELETE("/layers/:layerName", context.HTTPHandler(deleteLayer, ctx))
+	router.DELETE("/layers/:layerName", context.HTTPHandler(writeHandler(deleteLayer), ctx))
 
 	// Namespaces
 	router.GET("/namespaces", context.HTTPHandler(getNamespaces, ctx))
 
 	// Vulnerabilities
 	router.GET("/namespaces/:namespaceName/vulnerabilities", context.HTTPHandler(getVulnerabilities, ctx))
-	router.POST("/namespaces/:namespaceName/vulnerabilities", context.HTTPHandler(postVulnerability, ctx))
+	router.POST("/namespaces/:namespaceName/vulnerabilities", context.HTTPHandler(writeHandler(postVulnerability), ctx))
 	router.GET("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", context.HTTPHandler(getVulnerability, ctx))
-	router.PUT("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", context.HTTPHandler(putVulnerability, ctx))
-	router.DELETE("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", context.HTTPHandler(deleteVulnerability, ctx))
+	router.PUT("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", context.HTTPHandler(writeHandler(putVulnerability), ctx))
+	router.DELETE("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", context.HTTPHandler(writeHandler(deleteVulnerability), ctx))
 
 	// Fixes
 	router.GET("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName/fixes", context.HTTPHandler(getFixes, ctx))
-	router.PUT("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName/fixes/:fixName", context.HTTPHandler(putFix, ctx))
-	router.DELETE("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName/fixes/:fixName", context.HTTPHandler(deleteFix, ctx))
+	router.PUT("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName/fixes/:fixName", context.HTTPHandler(writeHandler(putFix), ctx))
+	router.DELETE("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName/fixes/:fixName", context.HTTPHandler(writeHandler(deleteFix), ctx))
 
 	// Notifications
 	router.GET("/notifications/:notificationName", context.HTTPHandler(getNotification, ctx))
-	router.DELETE("/notifications/:notificationName", context.HTTPHandler(deleteNotification, ctx))
+	router.DELETE("/notifications/:notificationName", context.HTTPHandler(writeHandler(deleteNotification), ctx))
+	router.GET("/notifications/:notificationName/deliveries", context.HTTPHandler(getNotificationDeliveries, ctx))
 
 	// Metrics
 	router.GET("/metrics", context.HTTPHandler(getMetrics, ctx))
@@ -17,6 +17,7 @@ package v1
 import (
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
@@ -26,6 +27,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/api/token"
 	"github.com/coreos/clair/database"
 	"github.com/coreos/clair/utils"
 	cerrors "github.com/coreos/clair/utils/errors"
@@ -48,7 +50,9 @@ const (
 	deleteFixRoute           = "v1/deleteFix"
 	getNotificationRoute     = "v1/getNotification"
 	deleteNotificationRoute  = "v1/deleteNotification"
+	getDeliveriesRoute       = "v1/getNotificationDeliveries"
 	getMetricsRoute          = "v1/getMetrics"
+	readOnlyRoute            = "v1/readOnly"
 
 	// maxBodySize restricts client request bodies to 1MiB.
 	maxBodySize int64 = 1048576
@@ -61,6 +65,21 @@ const (
 	statusUnprocessableEntity = 422
 )
 
+// writeHandler wraps a handler that modifies the datastore so its requests are rejected while the
+// API is in read-only mode.
+func writeHandler(handler context.Handler) context.Handler {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+		if ctx.Config != nil && ctx.Config.ReadOnly {
+			writeResponse(w, r, http.StatusServiceUnavailable, struct {
+				Error *Error `json:"Error,omitempty"`
+			}{&Error{"clair is in read-only mode"}})
+			return readOnlyRoute, http.StatusServiceUnavailable
+		}
+
+		return handler(w, r, p, ctx)
+	}
+}
+
 func decodeJSON(r *http.Request, v interface{}) error {
 	defer r.Body.Close()
 	return json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(v)
@@ -109,11 +128,18 @@ func postLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx
 		return postLayerRoute, http.StatusBadRequest
 	}
 
-	err = worker.Process(ctx.Store, request.Layer.Format, request.Layer.Name, request.Layer.ParentName, request.Layer.Path, request.Layer.Headers)
+	err = ctx.Queue.Process(r.Context(), ctx.Store, worker.Interactive, request.Layer.Format, request.Layer.Name, request.Layer.ParentName, request.Layer.Path, request.Layer.Digest, request.Layer.Headers)
 	if err != nil {
+		if err == worker.ErrQueueFull {
+			w.Header().Set("Retry-After", strconv.Itoa(int(worker.QueueRetryAfter.Seconds())))
+			writeResponse(w, r, http.StatusServiceUnavailable, LayerEnvelope{Error: &Error{err.Error()}})
+			return postLayerRoute, http.StatusServiceUnavailable
+		}
+
 		if err == utils.ErrCouldNotExtract ||
-			err == utils.ErrExtractedFileTooBig ||
-			err == worker.ErrUnsupported {
+			err == utils.ErrInsecureArchive ||
+			err == worker.ErrUnsupported ||
+			isBudgetExceeded(err) {
 			writeResponse(w, r, statusUnprocessableEntity, LayerEnvelope{Error: &Error{err.Error()}})
 			return postLayerRoute, statusUnprocessableEntity
 		}
@@ -131,6 +157,7 @@ func postLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx
 		Name:             request.Layer.Name,
 		ParentName:       request.Layer.ParentName,
 		Path:             request.Layer.Path,
+		Digest:           request.Layer.Digest,
 		Headers:          request.Layer.Headers,
 		Format:           request.Layer.Format,
 		IndexedByVersion: worker.Version,
@@ -138,6 +165,22 @@ func postLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx
 	return postLayerRoute, http.StatusCreated
 }
 
+// datastoreErrorStatus returns the status to respond with when reading the datastore failed with
+// the given error, advising the client when to retry if the schema is being migrated.
+func datastoreErrorStatus(w http.ResponseWriter, err error) int {
+	if err == database.ErrMigrationInProgress {
+		w.Header().Set("Retry-After", strconv.Itoa(int(database.MigrationRetryAfter.Seconds())))
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// isBudgetExceeded returns whether the analysis of a layer failed because it exceeded its budget.
+func isBudgetExceeded(err error) bool {
+	_, exceeded := err.(*worker.ErrBudgetExceeded)
+	return exceeded
+}
+
 func getLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
 	_, withFeatures := r.URL.Query()["features"]
 	_, withVulnerabilities := r.URL.Query()["vulnerabilities"]
@@ -147,8 +190,9 @@ func getLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *
 		writeResponse(w, r, http.StatusNotFound, LayerEnvelope{Error: &Error{err.Error()}})
 		return getLayerRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, LayerEnvelope{Error: &Error{err.Error()}})
-		return getLayerRoute, http.StatusInternalServerError
+		status := datastoreErrorStatus(w, err)
+		writeResponse(w, r, status, LayerEnvelope{Error: &Error{err.Error()}})
+		return getLayerRoute, status
 	}
 
 	layer := LayerFromDatabaseModel(dbLayer, withFeatures, withVulnerabilities)
@@ -174,8 +218,9 @@ func deleteLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ct
 func getNamespaces(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
 	dbNamespaces, err := ctx.Store.ListNamespaces()
 	if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, NamespaceEnvelope{Error: &Error{err.Error()}})
-		return getNamespacesRoute, http.StatusInternalServerError
+		status := datastoreErrorStatus(w, err)
+		writeResponse(w, r, status, NamespaceEnvelope{Error: &Error{err.Error()}})
+		return getNamespacesRoute, status
 	}
 	var namespaces []Namespace
 	for _, dbNamespace := range dbNamespaces {
@@ -209,7 +254,7 @@ func getVulnerabilities(w http.ResponseWriter, r *http.Request, p httprouter.Par
 	page := 0
 	pageStrs, pageExists := query["page"]
 	if pageExists {
-		err = tokenUnmarshal(pageStrs[0], ctx.Config.PaginationKey, &page)
+		err = token.Unmarshal(pageStrs[0], ctx.Config.PaginationKey, &page)
 		if err != nil {
 			writeResponse(w, r, http.StatusBadRequest, VulnerabilityEnvelope{Error: &Error{"invalid page format: " + err.Error()}})
 			return getNotificationRoute, http.StatusBadRequest
@@ -222,13 +267,20 @@ func getVulnerabilities(w http.ResponseWriter, r *http.Request, p httprouter.Par
 		return getNotificationRoute, http.StatusBadRequest
 	}
 
-	dbVulns, nextPage, err := ctx.Store.ListVulnerabilities(namespace, limit, page)
+	var dbVulns []database.Vulnerability
+	var nextPage int
+	if _, archived := query["archived"]; archived {
+		dbVulns, nextPage, err = ctx.Store.ListArchivedVulnerabilities(namespace, limit, page)
+	} else {
+		dbVulns, nextPage, err = ctx.Store.ListVulnerabilities(namespace, limit, page)
+	}
 	if err == cerrors.ErrNotFound {
 		writeResponse(w, r, http.StatusNotFound, VulnerabilityEnvelope{Error: &Error{err.Error()}})
 		return getVulnerabilityRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, VulnerabilityEnvelope{Error: &Error{err.Error()}})
-		return getVulnerabilitiesRoute, http.StatusInternalServerError
+		status := datastoreErrorStatus(w, err)
+		writeResponse(w, r, status, VulnerabilityEnvelope{Error: &Error{err.Error()}})
+		return getVulnerabilitiesRoute, status
 	}
 
 	var vulns []Vulnerability
@@ -239,7 +291,7 @@ func getVulnerabilities(w http.ResponseWriter, r *http.Request, p httprouter.Par
 
 	var nextPageStr string
 	if nextPage != -1 {
-		nextPageBytes, err := tokenMarshal(nextPage, ctx.Config.PaginationKey)
+		nextPageBytes, err := token.Marshal(nextPage, ctx.Config.PaginationKey)
 		if err != nil {
 			writeResponse(w, r, http.StatusBadRequest, VulnerabilityEnvelope{Error: &Error{"failed to marshal token: " + err.Error()}})
 			return getNotificationRoute, http.StatusBadRequest
@@ -289,16 +341,26 @@ func postVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Para
 func getVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
 	_, withFixedIn := r.URL.Query()["fixedIn"]
 
-	dbVuln, err := ctx.Store.FindVulnerability(p.ByName("namespaceName"), p.ByName("vulnerabilityName"))
+	var dbVuln database.Vulnerability
+	var err error
+	if _, archived := r.URL.Query()["archived"]; archived {
+		dbVuln, err = ctx.Store.FindArchivedVulnerability(p.ByName("namespaceName"), p.ByName("vulnerabilityName"))
+	} else {
+		dbVuln, err = ctx.Store.FindVulnerability(p.ByName("namespaceName"), p.ByName("vulnerabilityName"))
+	}
 	if err == cerrors.ErrNotFound {
 		writeResponse(w, r, http.StatusNotFound, VulnerabilityEnvelope{Error: &Error{err.Error()}})
 		return getVulnerabilityRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, VulnerabilityEnvelope{Error: &Error{err.Error()}})
-		return getVulnerabilityRoute, http.StatusInternalServerError
+		status := datastoreErrorStatus(w, err)
+		writeResponse(w, r, status, VulnerabilityEnvelope{Error: &Error{err.Error()}})
+		return getVulnerabilityRoute, status
 	}
 
 	vuln := VulnerabilityFromDatabaseModel(dbVuln, withFixedIn)
+	if _, archived := r.URL.Query()["archived"]; !archived {
+		w.Header().Set("ETag", vulnerabilityETag(dbVuln))
+	}
 
 	writeResponse(w, r, http.StatusOK, VulnerabilityEnvelope{Vulnerability: &vuln})
 	return getVulnerabilityRoute, http.StatusOK
@@ -331,6 +393,11 @@ func putVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Param
 	vuln.Namespace.Name = p.ByName("namespaceName")
 	vuln.Name = p.ByName("vulnerabilityName")
 
+	if status, err := checkVulnerabilityRevision(r, ctx, vuln.Namespace.Name, vuln.Name); err != nil {
+		writeResponse(w, r, status, VulnerabilityEnvelope{Error: &Error{err.Error()}})
+		return putVulnerabilityRoute, status
+	}
+
 	err = ctx.Store.InsertVulnerabilities([]database.Vulnerability{vuln}, true)
 	if err != nil {
 		switch err.(type) {
@@ -343,11 +410,17 @@ func putVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Param
 		}
 	}
 
+	setVulnerabilityETag(w, ctx, vuln.Namespace.Name, vuln.Name)
 	writeResponse(w, r, http.StatusOK, VulnerabilityEnvelope{Vulnerability: request.Vulnerability})
 	return putVulnerabilityRoute, http.StatusOK
 }
 
 func deleteVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	if status, err := checkVulnerabilityRevision(r, ctx, p.ByName("namespaceName"), p.ByName("vulnerabilityName")); err != nil {
+		writeResponse(w, r, status, VulnerabilityEnvelope{Error: &Error{err.Error()}})
+		return deleteVulnerabilityRoute, status
+	}
+
 	err := ctx.Store.DeleteVulnerability(p.ByName("namespaceName"), p.ByName("vulnerabilityName"))
 	if err == cerrors.ErrNotFound {
 		writeResponse(w, r, http.StatusNotFound, VulnerabilityEnvelope{Error: &Error{err.Error()}})
@@ -361,17 +434,61 @@ func deleteVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Pa
 	return deleteVulnerabilityRoute, http.StatusOK
 }
 
+// vulnerabilityETag returns the entity tag of the current revision of the vulnerability.
+func vulnerabilityETag(dbVuln database.Vulnerability) string {
+	return strconv.Quote(database.Revision(dbVuln))
+}
+
+// setVulnerabilityETag sets the entity tag of the vulnerability after it has been modified. It is
+// omitted if the vulnerability can't be read back.
+func setVulnerabilityETag(w http.ResponseWriter, ctx *context.RouteContext, namespaceName, vulnerabilityName string) {
+	dbVuln, err := ctx.Store.FindVulnerability(namespaceName, vulnerabilityName)
+	if err != nil {
+		log.Warningf("could not read the modified vulnerability %s: %s", vulnerabilityName, err)
+		return
+	}
+	w.Header().Set("ETag", vulnerabilityETag(dbVuln))
+}
+
+// checkVulnerabilityRevision verifies that the If-Match header of a modification of the
+// vulnerability matches its current revision, so that the modifications made since the client read
+// it, by another client or by the updater, aren't silently overwritten. It returns the status to
+// respond with otherwise.
+func checkVulnerabilityRevision(r *http.Request, ctx *context.RouteContext, namespaceName, vulnerabilityName string) (int, error) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return http.StatusPreconditionRequired, errors.New("the If-Match header must be set to the ETag of the vulnerability")
+	}
+
+	dbVuln, err := ctx.Store.FindVulnerability(namespaceName, vulnerabilityName)
+	if err == cerrors.ErrNotFound {
+		return http.StatusNotFound, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	etag := vulnerabilityETag(dbVuln)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+			return http.StatusOK, nil
+		}
+	}
+	return http.StatusPreconditionFailed, errors.New("the vulnerability has been modified since it was read")
+}
+
 func getFixes(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
 	dbVuln, err := ctx.Store.FindVulnerability(p.ByName("namespaceName"), p.ByName("vulnerabilityName"))
 	if err == cerrors.ErrNotFound {
 		writeResponse(w, r, http.StatusNotFound, FeatureEnvelope{Error: &Error{err.Error()}})
 		return getFixesRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, FeatureEnvelope{Error: &Error{err.Error()}})
-		return getFixesRoute, http.StatusInternalServerError
+		status := datastoreErrorStatus(w, err)
+		writeResponse(w, r, status, FeatureEnvelope{Error: &Error{err.Error()}})
+		return getFixesRoute, status
 	}
 
 	vuln := VulnerabilityFromDatabaseModel(dbVuln, true)
+	w.Header().Set("ETag", vulnerabilityETag(dbVuln))
 	writeResponse(w, r, http.StatusOK, FeatureEnvelope{Features: &vuln.FixedIn})
 	return getFixesRoute, http.StatusOK
 }
@@ -400,7 +517,12 @@ func putFix(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *co
 		return putFixRoute, http.StatusBadRequest
 	}
 
-	err = ctx.Store.InsertVulnerabilityFixes(p.ByName("vulnerabilityNamespace"), p.ByName("vulnerabilityName"), []database.FeatureVersion{dbFix})
+	if status, err := checkVulnerabilityRevision(r, ctx, p.ByName("namespaceName"), p.ByName("vulnerabilityName")); err != nil {
+		writeResponse(w, r, status, FeatureEnvelope{Error: &Error{err.Error()}})
+		return putFixRoute, status
+	}
+
+	err = ctx.Store.InsertVulnerabilityFixes(p.ByName("namespaceName"), p.ByName("vulnerabilityName"), []database.FeatureVersion{dbFix})
 	if err != nil {
 		switch err.(type) {
 		case *cerrors.ErrBadRequest:
@@ -416,12 +538,18 @@ func putFix(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *co
 		}
 	}
 
+	setVulnerabilityETag(w, ctx, p.ByName("namespaceName"), p.ByName("vulnerabilityName"))
 	writeResponse(w, r, http.StatusOK, FeatureEnvelope{Feature: request.Feature})
 	return putFixRoute, http.StatusOK
 }
 
 func deleteFix(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
-	err := ctx.Store.DeleteVulnerabilityFix(p.ByName("vulnerabilityNamespace"), p.ByName("vulnerabilityName"), p.ByName("fixName"))
+	if status, err := checkVulnerabilityRevision(r, ctx, p.ByName("namespaceName"), p.ByName("vulnerabilityName")); err != nil {
+		writeResponse(w, r, status, FeatureEnvelope{Error: &Error{err.Error()}})
+		return deleteFixRoute, status
+	}
+
+	err := ctx.Store.DeleteVulnerabilityFix(p.ByName("namespaceName"), p.ByName("vulnerabilityName"), p.ByName("fixName"))
 	if err == cerrors.ErrNotFound {
 		writeResponse(w, r, http.StatusNotFound, FeatureEnvelope{Error: &Error{err.Error()}})
 		return deleteFixRoute, http.StatusNotFound
@@ -452,14 +580,14 @@ func getNotification(w http.ResponseWriter, r *http.Request, p httprouter.Params
 	page := database.VulnerabilityNotificationFirstPage
 	pageStrs, pageExists := query["page"]
 	if pageExists {
-		err := tokenUnmarshal(pageStrs[0], ctx.Config.PaginationKey, &page)
+		err := token.Unmarshal(pageStrs[0], ctx.Config.PaginationKey, &page)
 		if err != nil {
 			writeResponse(w, r, http.StatusBadRequest, NotificationEnvelope{Error: &Error{"invalid page format: " + err.Error()}})
 			return getNotificationRoute, http.StatusBadRequest
 		}
 		pageToken = pageStrs[0]
 	} else {
-		pageTokenBytes, err := tokenMarshal(page, ctx.Config.PaginationKey)
+		pageTokenBytes, err := token.Marshal(page, ctx.Config.PaginationKey)
 		if err != nil {
 			writeResponse(w, r, http.StatusBadRequest, NotificationEnvelope{Error: &Error{"failed to marshal token: " + err.Error()}})
 			return getNotificationRoute, http.StatusBadRequest
@@ -472,8 +600,9 @@ func getNotification(w http.ResponseWriter, r *http.Request, p httprouter.Params
 		writeResponse(w, r, http.StatusNotFound, NotificationEnvelope{Error: &Error{err.Error()}})
 		return deleteNotificationRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, NotificationEnvelope{Error: &Error{err.Error()}})
-		return getNotificationRoute, http.StatusInternalServerError
+		status := datastoreErrorStatus(w, err)
+		writeResponse(w, r, status, NotificationEnvelope{Error: &Error{err.Error()}})
+		return getNotificationRoute, status
 	}
 
 	notification := NotificationFromDatabaseModel(dbNotification, limit, pageToken, nextPage, ctx.Config.PaginationKey)
@@ -496,6 +625,23 @@ func deleteNotification(w http.ResponseWriter, r *http.Request, p httprouter.Par
 	return deleteNotificationRoute, http.StatusOK
 }
 
+func getNotificationDeliveries(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	dbDeliveries, err := ctx.Store.ListNotificationDeliveries(p.ByName("notificationName"))
+	if err != nil {
+		status := datastoreErrorStatus(w, err)
+		writeResponse(w, r, status, NotificationDeliveryEnvelope{Error: &Error{err.Error()}})
+		return getDeliveriesRoute, status
+	}
+
+	deliveries := []NotificationDelivery{}
+	for _, dbDelivery := range dbDeliveries {
+		deliveries = append(deliveries, NotificationDeliveryFromDatabaseModel(dbDelivery))
+	}
+
+	writeResponse(w, r, http.StatusOK, NotificationDeliveryEnvelope{Deliveries: &deliveries})
+	return getDeliveriesRoute, http.StatusOK
+}
+
 func getMetrics(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
 	prometheus.Handler().ServeHTTP(w, r)
 	return getMetricsRoute, 0
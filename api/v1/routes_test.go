@@ -0,0 +1,141 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestVulnerabilityRevision(t *testing.T) {
+	stored := database.Vulnerability{
+		Name:      "CVE-2014-9471",
+		Namespace: database.Namespace{Name: "debian:8"},
+		Severity:  types.Low,
+	}
+	var deletedFix string
+	datastore := &database.MockDatastore{
+		FctFindVulnerability: func(namespaceName, name string) (database.Vulnerability, error) {
+			if namespaceName != stored.Namespace.Name || name != stored.Name {
+				return database.Vulnerability{}, cerrors.ErrNotFound
+			}
+			return stored, nil
+		},
+		FctInsertVulnerabilities: func(vulnerabilities []database.Vulnerability, createNotification bool) error {
+			stored.Severity = vulnerabilities[0].Severity
+			return nil
+		},
+		FctDeleteVulnerabilityFix: func(vulnerabilityNamespace, vulnerabilityName, featureName string) error {
+			deletedFix = vulnerabilityNamespace + " " + vulnerabilityName + " " + featureName
+			return nil
+		},
+	}
+	router := NewRouter(&context.RouteContext{Store: datastore, Config: &config.APIConfig{}})
+	serve := func(method, path, ifMatch, body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	const path = "/namespaces/debian:8/vulnerabilities/CVE-2014-9471"
+	const body = `{"Vulnerability": {"Name": "CVE-2014-9471", "NamespaceName": "debian:8", "Severity": "High"}}`
+
+	// The ETag of the vulnerability is its revision.
+	w := serve("GET", path, "", "")
+	etag := w.Header().Get("ETag")
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, `"`+database.Revision(stored)+`"`, etag)
+	}
+
+	// Modifications require the ETag of the current revision.
+	assert.Equal(t, http.StatusPreconditionRequired, serve("PUT", path, "", body).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, serve("PUT", path, `"stale"`, body).Code)
+	assert.Equal(t, http.StatusNotFound, serve("PUT", "/namespaces/debian:8/vulnerabilities/CVE-0000-0000", etag, body).Code)
+	assert.Equal(t, types.Low, stored.Severity)
+
+	w = serve("PUT", path, etag, body)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, types.High, stored.Severity)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	}
+
+	// The previous ETag is stale once the vulnerability has been modified.
+	assert.Equal(t, http.StatusPreconditionFailed, serve("DELETE", path+"/fixes/coreutils", etag, "").Code)
+	assert.Empty(t, deletedFix)
+	assert.Equal(t, http.StatusOK, serve("DELETE", path+"/fixes/coreutils", "*", "").Code)
+	assert.Equal(t, "debian:8 CVE-2014-9471 coreutils", deletedFix)
+}
+
+func TestMigrationInProgress(t *testing.T) {
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{}, database.ErrMigrationInProgress
+		},
+	}
+	router := NewRouter(&context.RouteContext{Store: datastore, Config: &config.APIConfig{}})
+
+	// Reads are retried once the schema is migrated, e.g. by the instances of the new version.
+	r, _ := http.NewRequest("GET", "/layers/layer", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+}
+
+func TestReadOnly(t *testing.T) {
+	// The datastore must not be modified, which the mock would panic on.
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{Name: name}, nil
+		},
+	}
+	router := NewRouter(&context.RouteContext{Store: datastore, Config: &config.APIConfig{ReadOnly: true}})
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, request := range [][2]string{
+		{"POST", "/layers"},
+		{"DELETE", "/layers/layer"},
+		{"POST", "/namespaces/debian:8/vulnerabilities"},
+		{"PUT", "/namespaces/debian:8/vulnerabilities/CVE-2014-9471"},
+		{"DELETE", "/namespaces/debian:8/vulnerabilities/CVE-2014-9471"},
+		{"PUT", "/namespaces/debian:8/vulnerabilities/CVE-2014-9471/fixes/coreutils"},
+		{"DELETE", "/namespaces/debian:8/vulnerabilities/CVE-2014-9471/fixes/coreutils"},
+		{"DELETE", "/notifications/notification"},
+	} {
+		w := serve(request[0], request[1], "{}")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, request[0]+" "+request[1])
+		assert.Contains(t, w.Body.String(), "clair is in read-only mode", request[0]+" "+request[1])
+	}
+
+	assert.Equal(t, http.StatusOK, serve("GET", "/layers/layer", "").Code)
+}
@@ -0,0 +1,254 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// advisoryHandler restricts a route modifying the vulnerabilities to the clients presenting one of
+// the advisory tokens of the configuration.
+func advisoryHandler(handler context.Handler) context.Handler {
+	return writeHandler(func(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+		if ctx.Config == nil || len(ctx.Config.AdvisoryTokens) == 0 {
+			writeError(w, r, http.StatusForbidden, errors.New("no advisory token is configured"))
+			return unauthorizedRoute, http.StatusForbidden
+		}
+
+		if !isAdvisoryToken(r.Header.Get("Authorization"), ctx.Config.AdvisoryTokens) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="clair"`)
+			writeError(w, r, http.StatusUnauthorized, errors.New("a valid advisory token is required"))
+			return unauthorizedRoute, http.StatusUnauthorized
+		}
+
+		return handler(w, r, p, ctx)
+	})
+}
+
+// isAdvisoryToken returns whether the Authorization header bears one of the tokens.
+func isAdvisoryToken(authorization string, tokens []string) bool {
+	const prefix = "Bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return false
+	}
+	bearer := []byte(authorization[len(prefix):])
+
+	for _, token := range tokens {
+		if token != "" && subtle.ConstantTimeCompare(bearer, []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// vulnerabilityETag returns the entity tag of the current revision of the vulnerability.
+func vulnerabilityETag(dbVuln database.Vulnerability) string {
+	return strconv.Quote(database.Revision(dbVuln))
+}
+
+// checkVulnerabilityRevision verifies that the If-Match header of a modification of the
+// vulnerability matches its current revision, so that the modifications made since the client read
+// it aren't silently overwritten. It returns the status to respond with otherwise.
+func checkVulnerabilityRevision(r *http.Request, ctx *context.RouteContext, namespaceName, vulnerabilityName string) (int, error) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return http.StatusPreconditionRequired, errors.New("the If-Match header must be set to the ETag of the vulnerability")
+	}
+
+	dbVuln, err := ctx.Store.FindVulnerability(namespaceName, vulnerabilityName)
+	if err == cerrors.ErrNotFound {
+		return http.StatusNotFound, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	etag := vulnerabilityETag(dbVuln)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+			return http.StatusOK, nil
+		}
+	}
+	return http.StatusPreconditionFailed, errors.New("the vulnerability has been modified since it was read")
+}
+
+// writeVulnerability responds with the vulnerability as stored after it has been modified, along
+// with its new entity tag.
+func writeVulnerability(w http.ResponseWriter, r *http.Request, ctx *context.RouteContext, status int, namespaceName, vulnerabilityName string) int {
+	dbVuln, err := ctx.Store.FindVulnerability(namespaceName, vulnerabilityName)
+	if err != nil {
+		return writeDatastoreError(w, r, err)
+	}
+
+	w.Header().Set("ETag", vulnerabilityETag(dbVuln))
+	writeResponse(w, r, status, vulnerabilityFromDatabaseModel(dbVuln))
+	return status
+}
+
+func postVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	var vuln Vulnerability
+	if err := decodeJSON(r, &vuln); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return postVulnerabilityRoute, http.StatusBadRequest
+	}
+
+	namespaceName := p.ByName("namespaceName")
+	if vuln.NamespaceName != "" && vuln.NamespaceName != namespaceName {
+		writeError(w, r, http.StatusBadRequest, errors.New("the namespace of the vulnerability doesn't match the URL"))
+		return postVulnerabilityRoute, http.StatusBadRequest
+	}
+	vuln.NamespaceName = namespaceName
+	if vuln.Name == "" {
+		writeError(w, r, http.StatusBadRequest, errors.New("the vulnerability must have a name"))
+		return postVulnerabilityRoute, http.StatusBadRequest
+	}
+
+	dbVuln, err := vuln.databaseModel()
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return postVulnerabilityRoute, http.StatusBadRequest
+	}
+
+	// Replacing a vulnerability must go through its revision.
+	if _, err := ctx.Store.FindVulnerability(namespaceName, vuln.Name); err == nil {
+		writeError(w, r, http.StatusConflict, errors.New("vulnerability "+vuln.Name+" already exists"))
+		return postVulnerabilityRoute, http.StatusConflict
+	} else if err != cerrors.ErrNotFound {
+		status := writeDatastoreError(w, r, err)
+		return postVulnerabilityRoute, status
+	}
+
+	if err := ctx.Store.InsertVulnerabilities([]database.Vulnerability{dbVuln}, true); err != nil {
+		status := writeDatastoreError(w, r, err)
+		return postVulnerabilityRoute, status
+	}
+
+	w.Header().Set("Location", "/v2/namespaces/"+namespaceName+"/vulnerabilities/"+vuln.Name)
+	status := writeVulnerability(w, r, ctx, http.StatusCreated, namespaceName, vuln.Name)
+	return postVulnerabilityRoute, status
+}
+
+func putVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	var vuln Vulnerability
+	if err := decodeJSON(r, &vuln); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return putVulnerabilityRoute, http.StatusBadRequest
+	}
+
+	// The fixes are merged into the existing ones rather than replacing them, so they are modified
+	// one by one.
+	if len(vuln.FixedIn) != 0 {
+		writeError(w, r, http.StatusBadRequest, errors.New("the fixes must be modified through their own routes"))
+		return putVulnerabilityRoute, http.StatusBadRequest
+	}
+
+	vuln.NamespaceName = p.ByName("namespaceName")
+	vuln.Name = p.ByName("vulnerabilityName")
+	dbVuln, err := vuln.databaseModel()
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return putVulnerabilityRoute, http.StatusBadRequest
+	}
+
+	if status, err := checkVulnerabilityRevision(r, ctx, vuln.NamespaceName, vuln.Name); err != nil {
+		writeError(w, r, status, err)
+		return putVulnerabilityRoute, status
+	}
+
+	if err := ctx.Store.InsertVulnerabilities([]database.Vulnerability{dbVuln}, true); err != nil {
+		status := writeDatastoreError(w, r, err)
+		return putVulnerabilityRoute, status
+	}
+
+	status := writeVulnerability(w, r, ctx, http.StatusOK, vuln.NamespaceName, vuln.Name)
+	return putVulnerabilityRoute, status
+}
+
+func deleteVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	namespaceName, vulnerabilityName := p.ByName("namespaceName"), p.ByName("vulnerabilityName")
+	if status, err := checkVulnerabilityRevision(r, ctx, namespaceName, vulnerabilityName); err != nil {
+		writeError(w, r, status, err)
+		return deleteVulnerabilityRoute, status
+	}
+
+	if err := ctx.Store.DeleteVulnerability(namespaceName, vulnerabilityName); err != nil {
+		status := writeDatastoreError(w, r, err)
+		return deleteVulnerabilityRoute, status
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return deleteVulnerabilityRoute, http.StatusNoContent
+}
+
+func putFix(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	var fix Feature
+	if err := decodeJSON(r, &fix); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return putFixRoute, http.StatusBadRequest
+	}
+
+	namespaceName, vulnerabilityName := p.ByName("namespaceName"), p.ByName("vulnerabilityName")
+	if fix.Name != p.ByName("fixName") {
+		writeError(w, r, http.StatusBadRequest, errors.New("the name of the feature doesn't match the URL"))
+		return putFixRoute, http.StatusBadRequest
+	}
+	if fix.NamespaceName == "" {
+		fix.NamespaceName = namespaceName
+	}
+
+	dbFix, err := fix.databaseModel()
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return putFixRoute, http.StatusBadRequest
+	}
+
+	if status, err := checkVulnerabilityRevision(r, ctx, namespaceName, vulnerabilityName); err != nil {
+		writeError(w, r, status, err)
+		return putFixRoute, status
+	}
+
+	if err := ctx.Store.InsertVulnerabilityFixes(namespaceName, vulnerabilityName, []database.FeatureVersion{dbFix}); err != nil {
+		status := writeDatastoreError(w, r, err)
+		return putFixRoute, status
+	}
+
+	status := writeVulnerability(w, r, ctx, http.StatusOK, namespaceName, vulnerabilityName)
+	return putFixRoute, status
+}
+
+func deleteFix(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	namespaceName, vulnerabilityName := p.ByName("namespaceName"), p.ByName("vulnerabilityName")
+	if status, err := checkVulnerabilityRevision(r, ctx, namespaceName, vulnerabilityName); err != nil {
+		writeError(w, r, status, err)
+		return deleteFixRoute, status
+	}
+
+	if err := ctx.Store.DeleteVulnerabilityFix(namespaceName, vulnerabilityName, p.ByName("fixName")); err != nil {
+		status := writeDatastoreError(w, r, err)
+		return deleteFixRoute, status
+	}
+
+	status := writeVulnerability(w, r, ctx, http.StatusOK, namespaceName, vulnerabilityName)
+	return deleteFixRoute, status
+}
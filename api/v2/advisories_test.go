@@ -0,0 +1,124 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func TestAdvisories(t *testing.T) {
+	vulnerabilities := make(map[string]database.Vulnerability)
+	datastore := &database.MockDatastore{
+		FctFindVulnerability: func(namespaceName, name string) (database.Vulnerability, error) {
+			if vuln, ok := vulnerabilities[namespaceName+"/"+name]; ok {
+				return vuln, nil
+			}
+			return database.Vulnerability{}, cerrors.ErrNotFound
+		},
+		FctInsertVulnerabilities: func(vulns []database.Vulnerability, createNotification bool) error {
+			assert.True(t, createNotification)
+			for _, vuln := range vulns {
+				if existing, ok := vulnerabilities[vuln.Namespace.Name+"/"+vuln.Name]; ok {
+					vuln.FixedIn = existing.FixedIn
+				}
+				vulnerabilities[vuln.Namespace.Name+"/"+vuln.Name] = vuln
+			}
+			return nil
+		},
+		FctInsertVulnerabilityFixes: func(namespaceName, name string, fixes []database.FeatureVersion) error {
+			vuln, ok := vulnerabilities[namespaceName+"/"+name]
+			if !ok {
+				return cerrors.ErrNotFound
+			}
+			vuln.FixedIn = append(vuln.FixedIn, fixes...)
+			vulnerabilities[namespaceName+"/"+name] = vuln
+			return nil
+		},
+		FctDeleteVulnerability: func(namespaceName, name string) error {
+			delete(vulnerabilities, namespaceName+"/"+name)
+			return nil
+		},
+	}
+	router := NewRouter(&context.RouteContext{Store: datastore, Config: &config.APIConfig{AdvisoryTokens: []string{"s3cr3t"}}})
+
+	request := func(method, path, token, ifMatch, body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	const path = "/namespaces/debian:8/vulnerabilities"
+	const advisory = `{"Name": "ACME-2016-1", "Severity": "High", "FixedIn": [{"Name": "acme", "VersionFormat": "dpkg", "Version": "1.2"}]}`
+
+	// The clients must present an advisory token.
+	assert.Equal(t, http.StatusUnauthorized, request("POST", path, "", "", advisory).Code)
+	assert.Equal(t, http.StatusUnauthorized, request("POST", path, "guess", "", advisory).Code)
+	assert.Empty(t, vulnerabilities)
+
+	w := request("POST", path, "s3cr3t", "", advisory)
+	if assert.Equal(t, http.StatusCreated, w.Code) {
+		vuln := vulnerabilities["debian:8/ACME-2016-1"]
+		if assert.Len(t, vuln.FixedIn, 1) {
+			assert.Equal(t, "debian:8", vuln.FixedIn[0].Feature.Namespace.Name, "the fixes are in the namespace of the vulnerability")
+		}
+		assert.Equal(t, vulnerabilityETag(vuln), w.Header().Get("ETag"))
+	}
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, http.StatusConflict, request("POST", path, "s3cr3t", "", advisory).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", path, "s3cr3t", "", `{"Name": "ACME-2016-2", "Severity": "Severe"}`).Code)
+
+	// The modifications require the current revision.
+	update := `{"Severity": "Critical", "Description": "Remote code execution"}`
+	assert.Equal(t, http.StatusPreconditionRequired, request("PUT", path+"/ACME-2016-1", "s3cr3t", "", update).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, request("PUT", path+"/ACME-2016-1", "s3cr3t", `"stale"`, update).Code)
+	w = request("PUT", path+"/ACME-2016-1", "s3cr3t", etag, update)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, "Remote code execution", vulnerabilities["debian:8/ACME-2016-1"].Description)
+		assert.Len(t, vulnerabilities["debian:8/ACME-2016-1"].FixedIn, 1, "the fixes are kept")
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	}
+	assert.Equal(t, http.StatusPreconditionFailed, request("DELETE", path+"/ACME-2016-1", "s3cr3t", etag, "").Code)
+	etag = w.Header().Get("ETag")
+
+	w = request("PUT", path+"/ACME-2016-1/fixes/acme-tools", "s3cr3t", etag, `{"Name": "acme-tools", "VersionFormat": "dpkg", "Version": "1.2"}`)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Len(t, vulnerabilities["debian:8/ACME-2016-1"].FixedIn, 2)
+	}
+	assert.Equal(t, http.StatusBadRequest, request("PUT", path+"/ACME-2016-1/fixes/acme", "s3cr3t", "*", `{"Name": "acme-tools", "VersionFormat": "dpkg", "Version": "1.2"}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, request("DELETE", path+"/ACME-2016-1", "s3cr3t", w.Header().Get("ETag"), "").Code)
+	assert.Empty(t, vulnerabilities)
+	assert.Equal(t, http.StatusNotFound, request("DELETE", path+"/ACME-2016-1", "s3cr3t", "*", "").Code)
+
+	// The routes are disabled unless a token is configured.
+	router = NewRouter(&context.RouteContext{Store: datastore, Config: &config.APIConfig{}})
+	assert.Equal(t, http.StatusForbidden, request("POST", path, "", "", advisory).Code)
+}
@@ -0,0 +1,160 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"sort"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/registry"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// watchedTagsPageSize is the number of watched tags listed at once to detect base images.
+const watchedTagsPageSize = 100
+
+// recommendBaseImage detects the base image of the image of a report, and returns how many of its
+// findings the newer tags of the repository of the base image would eliminate, or nil if no base
+// image is detected.
+//
+// The base image is the watched tag whose image is the closest ancestor of the image, i.e. whose
+// top layer is the closest parent of the layers of the image. Its newer tags are the indexed tags
+// of its repository which moved to their image after it did.
+func recommendBaseImage(ctx *context.RouteContext, report Report) (*BaseImage, error) {
+	ancestors, err := layerAncestors(ctx.Store, report.LayerName)
+	if err != nil || len(ancestors) == 0 {
+		return nil, err
+	}
+
+	byLayer := make(map[string]database.WatchedTag)
+	var dbWatchedTags []database.WatchedTag
+	for page := 0; page != -1; {
+		var dbPage []database.WatchedTag
+		if dbPage, page, err = ctx.Store.ListWatchedTags(watchedTagsPageSize, page); err != nil {
+			return nil, err
+		}
+		for _, dbWatchedTag := range dbPage {
+			if _, ok := byLayer[dbWatchedTag.LayerName]; !ok && dbWatchedTag.LayerName != "" {
+				byLayer[dbWatchedTag.LayerName] = dbWatchedTag
+			}
+		}
+		dbWatchedTags = append(dbWatchedTags, dbPage...)
+	}
+
+	var base database.WatchedTag
+	baseLayers := make(map[string]struct{})
+	for i, ancestor := range ancestors {
+		if dbWatchedTag, ok := byLayer[ancestor]; ok {
+			base = dbWatchedTag
+			for _, baseLayer := range ancestors[i:] {
+				baseLayers[baseLayer] = struct{}{}
+			}
+			break
+		}
+	}
+	if base.LayerName == "" {
+		return nil, nil
+	}
+
+	// The findings of the base image are the ones of the features it added to the image.
+	findings := reportFindings(report)
+	baseFindings := make(map[findingKey]struct{})
+	for _, feature := range report.Features {
+		if _, ok := baseLayers[feature.AddedBy]; !ok {
+			continue
+		}
+		for _, vuln := range feature.Vulnerabilities {
+			if vuln.FalsePositive == nil {
+				baseFindings[findingKey{vuln.NamespaceName, vuln.Name, feature.Name}] = struct{}{}
+			}
+		}
+	}
+
+	baseImage := &BaseImage{
+		Image:     registry.ImageName(base.Registry, base.Repository) + ":" + base.Tag,
+		LayerName: base.LayerName,
+		Findings:  len(baseFindings),
+		Upgrades:  []BaseImageUpgrade{},
+	}
+	for _, dbWatchedTag := range dbWatchedTags {
+		if dbWatchedTag.Registry != base.Registry || dbWatchedTag.Repository != base.Repository ||
+			dbWatchedTag.LayerName == "" || dbWatchedTag.LayerName == base.LayerName ||
+			!dbWatchedTag.Changed.After(base.Changed) {
+			continue
+		}
+
+		upgrade, err := buildReport(ctx, dbWatchedTag.LayerName, nil)
+		if err == cerrors.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		upgradeFindings := reportFindings(upgrade)
+
+		candidate := BaseImageUpgrade{
+			Image:     registry.ImageName(dbWatchedTag.Registry, dbWatchedTag.Repository) + ":" + dbWatchedTag.Tag,
+			LayerName: dbWatchedTag.LayerName,
+		}
+		for key := range baseFindings {
+			if _, ok := upgradeFindings[key]; !ok {
+				candidate.Eliminated++
+			}
+		}
+		for key, finding := range upgradeFindings {
+			if _, ok := findings[key]; !ok && finding.Vulnerability.FalsePositive == nil {
+				candidate.Introduced++
+			}
+		}
+		if candidate.Eliminated > 0 {
+			baseImage.Upgrades = append(baseImage.Upgrades, candidate)
+		}
+	}
+	sort.Sort(baseImageUpgrades(baseImage.Upgrades))
+
+	return baseImage, nil
+}
+
+// layerAncestors returns the names of the ancestors of a layer, from its parent to the root.
+func layerAncestors(datastore database.Datastore, layerName string) ([]string, error) {
+	var ancestors []string
+	for {
+		dbLayer, err := datastore.FindLayer(layerName, false, false)
+		if err != nil {
+			return nil, err
+		}
+		if dbLayer.Parent == nil {
+			return ancestors, nil
+		}
+		layerName = dbLayer.Parent.Name
+		ancestors = append(ancestors, layerName)
+	}
+}
+
+// baseImageUpgrades sorts upgrades from the one eliminating the most findings, then introducing the
+// fewest, to the other ones.
+type baseImageUpgrades []BaseImageUpgrade
+
+func (s baseImageUpgrades) Len() int      { return len(s) }
+func (s baseImageUpgrades) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s baseImageUpgrades) Less(i, j int) bool {
+	if s[i].Eliminated != s[j].Eliminated {
+		return s[i].Eliminated > s[j].Eliminated
+	}
+	if s[i].Introduced != s[j].Introduced {
+		return s[i].Introduced < s[j].Introduced
+	}
+	return s[i].Image < s[j].Image
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestRecommendBaseImage(t *testing.T) {
+	namespace := database.Namespace{Name: "debian:8"}
+	vulnerability := func(name string) database.Vulnerability {
+		return database.Vulnerability{Name: name, Namespace: namespace, Severity: types.High}
+	}
+	featureVersion := func(name, addedBy string, vulns ...database.Vulnerability) database.FeatureVersion {
+		return database.FeatureVersion{
+			Feature:    database.Feature{Name: name, Namespace: namespace},
+			Version:    "1.0",
+			AddedBy:    database.Layer{Name: addedBy},
+			AffectedBy: vulns,
+		}
+	}
+
+	layers := map[string]database.Layer{
+		"debian-8.4": {Name: "debian-8.4"},
+		"debian-8.5": {Name: "debian-8.5", Features: []database.FeatureVersion{
+			featureVersion("openssl", "debian-8.5", vulnerability("CVE-1"), vulnerability("CVE-2")),
+		}},
+		"debian-8.6": {Name: "debian-8.6", Features: []database.FeatureVersion{
+			featureVersion("openssl", "debian-8.6", vulnerability("CVE-2")),
+			featureVersion("zlib", "debian-8.6", vulnerability("CVE-4")),
+		}},
+		"app": {Name: "app", Parent: &database.Layer{Name: "debian-8.5"}, Features: []database.FeatureVersion{
+			featureVersion("openssl", "debian-8.5", vulnerability("CVE-1"), vulnerability("CVE-2")),
+			featureVersion("bash", "app", vulnerability("CVE-3")),
+		}},
+	}
+	now := time.Now()
+	watchedTag := func(repository, tag, layerName string, changed time.Time) database.WatchedTag {
+		return database.WatchedTag{Registry: "https://registry.example.com", Repository: repository, Tag: tag, LayerName: layerName, Changed: changed}
+	}
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			if layer, ok := layers[name]; ok {
+				return layer, nil
+			}
+			return database.Layer{}, cerrors.ErrNotFound
+		},
+		FctFindFalsePositives: func([]database.Vulnerability) ([]database.FalsePositive, error) {
+			return nil, nil
+		},
+		FctListWatchedTags: func(limit, page int) ([]database.WatchedTag, int, error) {
+			return []database.WatchedTag{
+				watchedTag("library/debian", "8.4", "debian-8.4", now.Add(-2*time.Hour)),
+				watchedTag("library/debian", "8.5", "debian-8.5", now.Add(-time.Hour)),
+				watchedTag("library/debian", "8.6", "debian-8.6", now),
+				watchedTag("library/ubuntu", "16.04", "ubuntu", now),
+				watchedTag("team/app", "latest", "app", now),
+			}, -1, nil
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{}}
+
+	report, err := buildReport(ctx, "app", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	baseImage, err := recommendBaseImage(ctx, report)
+	if assert.Nil(t, err) && assert.NotNil(t, baseImage) {
+		assert.Equal(t, "registry.example.com/library/debian:8.5", baseImage.Image)
+		assert.Equal(t, 2, baseImage.Findings)
+		assert.Equal(t, []BaseImageUpgrade{
+			{Image: "registry.example.com/library/debian:8.6", LayerName: "debian-8.6", Eliminated: 1, Introduced: 1},
+		}, baseImage.Upgrades)
+	}
+
+	// Images without a watched base image have no recommendation.
+	report, err = buildReport(ctx, "debian-8.6", nil)
+	if assert.Nil(t, err) {
+		baseImage, err = recommendBaseImage(ctx, report)
+		assert.Nil(t, err)
+		assert.Nil(t, baseImage)
+	}
+}
@@ -0,0 +1,480 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The Go types of the messages of clair.proto. They are written by hand, as protoc isn't part of the
+// build, following the output of protoc-gen-go. TestProtoFiles verifies them against clair.proto.
+
+package clairpb
+
+import proto "github.com/golang/protobuf/proto"
+
+type VulnerabilitySource struct {
+	Name    string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Url     string `protobuf:"bytes,2,opt,name=url" json:"url,omitempty"`
+	License string `protobuf:"bytes,3,opt,name=license" json:"license,omitempty"`
+}
+
+func (m *VulnerabilitySource) Reset()         { *m = VulnerabilitySource{} }
+func (m *VulnerabilitySource) String() string { return proto.CompactTextString(m) }
+func (*VulnerabilitySource) ProtoMessage()    {}
+
+// CVSS is a vector of the Common Vulnerability Scoring System, along with its base score.
+type CVSS struct {
+	Vector string  `protobuf:"bytes,1,opt,name=vector" json:"vector,omitempty"`
+	Score  float64 `protobuf:"fixed64,2,opt,name=score" json:"score,omitempty"`
+}
+
+func (m *CVSS) Reset()         { *m = CVSS{} }
+func (m *CVSS) String() string { return proto.CompactTextString(m) }
+func (*CVSS) ProtoMessage()    {}
+
+type Vulnerability struct {
+	Name          string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	NamespaceName string `protobuf:"bytes,2,opt,name=namespace_name" json:"namespace_name,omitempty"`
+	Description   string `protobuf:"bytes,3,opt,name=description" json:"description,omitempty"`
+	Link          string `protobuf:"bytes,4,opt,name=link" json:"link,omitempty"`
+	Severity      string `protobuf:"bytes,5,opt,name=severity" json:"severity,omitempty"`
+	// JSON-encoded metadata, as its schema depends on the metadata fetchers.
+	Metadata      string                 `protobuf:"bytes,6,opt,name=metadata" json:"metadata,omitempty"`
+	Sources       []*VulnerabilitySource `protobuf:"bytes,7,rep,name=sources" json:"sources,omitempty"`
+	FixedBy       string                 `protobuf:"bytes,8,opt,name=fixed_by" json:"fixed_by,omitempty"`
+	FixedIn       []*Feature             `protobuf:"bytes,9,rep,name=fixed_in" json:"fixed_in,omitempty"`
+	Explanation   *Explanation           `protobuf:"bytes,10,opt,name=explanation" json:"explanation,omitempty"`
+	FalsePositive *FalsePositive         `protobuf:"bytes,11,opt,name=false_positive" json:"false_positive,omitempty"`
+	CvssV2        *CVSS                  `protobuf:"bytes,12,opt,name=cvss_v2" json:"cvss_v2,omitempty"`
+	CvssV3        *CVSS                  `protobuf:"bytes,13,opt,name=cvss_v3" json:"cvss_v3,omitempty"`
+}
+
+func (m *Vulnerability) Reset()         { *m = Vulnerability{} }
+func (m *Vulnerability) String() string { return proto.CompactTextString(m) }
+func (*Vulnerability) ProtoMessage()    {}
+
+func (m *Vulnerability) GetSources() []*VulnerabilitySource {
+	if m != nil {
+		return m.Sources
+	}
+	return nil
+}
+
+func (m *Vulnerability) GetFixedIn() []*Feature {
+	if m != nil {
+		return m.FixedIn
+	}
+	return nil
+}
+
+func (m *Vulnerability) GetExplanation() *Explanation {
+	if m != nil {
+		return m.Explanation
+	}
+	return nil
+}
+
+func (m *Vulnerability) GetFalsePositive() *FalsePositive {
+	if m != nil {
+		return m.FalsePositive
+	}
+	return nil
+}
+
+func (m *Vulnerability) GetCvssV2() *CVSS {
+	if m != nil {
+		return m.CvssV2
+	}
+	return nil
+}
+
+func (m *Vulnerability) GetCvssV3() *CVSS {
+	if m != nil {
+		return m.CvssV3
+	}
+	return nil
+}
+
+type Explanation struct {
+	Detector      string   `protobuf:"bytes,1,opt,name=detector" json:"detector,omitempty"`
+	Feeds         []string `protobuf:"bytes,2,rep,name=feeds" json:"feeds,omitempty"`
+	VersionFormat string   `protobuf:"bytes,3,opt,name=version_format" json:"version_format,omitempty"`
+	Comparison    string   `protobuf:"bytes,4,opt,name=comparison" json:"comparison,omitempty"`
+}
+
+func (m *Explanation) Reset()         { *m = Explanation{} }
+func (m *Explanation) String() string { return proto.CompactTextString(m) }
+func (*Explanation) ProtoMessage()    {}
+
+type FalsePositive struct {
+	Name   string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Reason string `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+	// Unix timestamp.
+	Created string `protobuf:"bytes,3,opt,name=created" json:"created,omitempty"`
+}
+
+func (m *FalsePositive) Reset()         { *m = FalsePositive{} }
+func (m *FalsePositive) String() string { return proto.CompactTextString(m) }
+func (*FalsePositive) ProtoMessage()    {}
+
+type Feature struct {
+	Name            string           `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	NamespaceName   string           `protobuf:"bytes,2,opt,name=namespace_name" json:"namespace_name,omitempty"`
+	VersionFormat   string           `protobuf:"bytes,3,opt,name=version_format" json:"version_format,omitempty"`
+	Version         string           `protobuf:"bytes,4,opt,name=version" json:"version,omitempty"`
+	AddedBy         string           `protobuf:"bytes,5,opt,name=added_by" json:"added_by,omitempty"`
+	Vulnerabilities []*Vulnerability `protobuf:"bytes,6,rep,name=vulnerabilities" json:"vulnerabilities,omitempty"`
+	Kernel          bool             `protobuf:"varint,7,opt,name=kernel" json:"kernel,omitempty"`
+	State           string           `protobuf:"bytes,8,opt,name=state" json:"state,omitempty"`
+	Evidence        string           `protobuf:"bytes,9,opt,name=evidence" json:"evidence,omitempty"`
+}
+
+func (m *Feature) Reset()         { *m = Feature{} }
+func (m *Feature) String() string { return proto.CompactTextString(m) }
+func (*Feature) ProtoMessage()    {}
+
+func (m *Feature) GetVulnerabilities() []*Vulnerability {
+	if m != nil {
+		return m.Vulnerabilities
+	}
+	return nil
+}
+
+type Report struct {
+	LayerName   string        `protobuf:"bytes,1,opt,name=layer_name" json:"layer_name,omitempty"`
+	Features    []*Feature    `protobuf:"bytes,2,rep,name=features" json:"features,omitempty"`
+	Signature   string        `protobuf:"bytes,3,opt,name=signature" json:"signature,omitempty"`
+	Provenances []*Provenance `protobuf:"bytes,4,rep,name=provenances" json:"provenances,omitempty"`
+	Owners      []string      `protobuf:"bytes,5,rep,name=owners" json:"owners,omitempty"`
+}
+
+func (m *Report) Reset()         { *m = Report{} }
+func (m *Report) String() string { return proto.CompactTextString(m) }
+func (*Report) ProtoMessage()    {}
+
+func (m *Report) GetFeatures() []*Feature {
+	if m != nil {
+		return m.Features
+	}
+	return nil
+}
+
+func (m *Report) GetProvenances() []*Provenance {
+	if m != nil {
+		return m.Provenances
+	}
+	return nil
+}
+
+type Provenance struct {
+	Name          string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Digest        string `protobuf:"bytes,2,opt,name=digest" json:"digest,omitempty"`
+	PredicateType string `protobuf:"bytes,3,opt,name=predicate_type" json:"predicate_type,omitempty"`
+	BuilderId     string `protobuf:"bytes,4,opt,name=builder_id" json:"builder_id,omitempty"`
+	Statement     string `protobuf:"bytes,5,opt,name=statement" json:"statement,omitempty"`
+	Created       string `protobuf:"bytes,6,opt,name=created" json:"created,omitempty"`
+}
+
+func (m *Provenance) Reset()         { *m = Provenance{} }
+func (m *Provenance) String() string { return proto.CompactTextString(m) }
+func (*Provenance) ProtoMessage()    {}
+
+type VulnerabilityPage struct {
+	Vulnerabilities []*Vulnerability `protobuf:"bytes,1,rep,name=vulnerabilities" json:"vulnerabilities,omitempty"`
+	NextCursor      string           `protobuf:"bytes,2,opt,name=next_cursor" json:"next_cursor,omitempty"`
+}
+
+func (m *VulnerabilityPage) Reset()         { *m = VulnerabilityPage{} }
+func (m *VulnerabilityPage) String() string { return proto.CompactTextString(m) }
+func (*VulnerabilityPage) ProtoMessage()    {}
+
+func (m *VulnerabilityPage) GetVulnerabilities() []*Vulnerability {
+	if m != nil {
+		return m.Vulnerabilities
+	}
+	return nil
+}
+
+type Layer struct {
+	Name             string            `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	ParentName       string            `protobuf:"bytes,2,opt,name=parent_name" json:"parent_name,omitempty"`
+	NamespaceName    string            `protobuf:"bytes,3,opt,name=namespace_name" json:"namespace_name,omitempty"`
+	Path             string            `protobuf:"bytes,4,opt,name=path" json:"path,omitempty"`
+	Headers          map[string]string `protobuf:"bytes,5,rep,name=headers" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Format           string            `protobuf:"bytes,6,opt,name=format" json:"format,omitempty"`
+	Priority         string            `protobuf:"bytes,7,opt,name=priority" json:"priority,omitempty"`
+	Labels           map[string]string `protobuf:"bytes,8,rep,name=labels" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	IndexedByVersion int32             `protobuf:"varint,9,opt,name=indexed_by_version" json:"indexed_by_version,omitempty"`
+	Digest           string            `protobuf:"bytes,10,opt,name=digest" json:"digest,omitempty"`
+}
+
+func (m *Layer) Reset()         { *m = Layer{} }
+func (m *Layer) String() string { return proto.CompactTextString(m) }
+func (*Layer) ProtoMessage()    {}
+
+func (m *Layer) GetHeaders() map[string]string {
+	if m != nil {
+		return m.Headers
+	}
+	return nil
+}
+
+func (m *Layer) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+type Namespace struct {
+	Name          string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	VersionFormat string `protobuf:"bytes,2,opt,name=version_format" json:"version_format,omitempty"`
+}
+
+func (m *Namespace) Reset()         { *m = Namespace{} }
+func (m *Namespace) String() string { return proto.CompactTextString(m) }
+func (*Namespace) ProtoMessage()    {}
+
+type NotificationVulnerability struct {
+	Vulnerability  *Vulnerability `protobuf:"bytes,1,opt,name=vulnerability" json:"vulnerability,omitempty"`
+	AffectedLayers []string       `protobuf:"bytes,2,rep,name=affected_layers" json:"affected_layers,omitempty"`
+}
+
+func (m *NotificationVulnerability) Reset()         { *m = NotificationVulnerability{} }
+func (m *NotificationVulnerability) String() string { return proto.CompactTextString(m) }
+func (*NotificationVulnerability) ProtoMessage()    {}
+
+func (m *NotificationVulnerability) GetVulnerability() *Vulnerability {
+	if m != nil {
+		return m.Vulnerability
+	}
+	return nil
+}
+
+type Notification struct {
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	// Unix timestamps.
+	Created    string                     `protobuf:"bytes,2,opt,name=created" json:"created,omitempty"`
+	Notified   string                     `protobuf:"bytes,3,opt,name=notified" json:"notified,omitempty"`
+	Deleted    string                     `protobuf:"bytes,4,opt,name=deleted" json:"deleted,omitempty"`
+	Priority   string                     `protobuf:"bytes,5,opt,name=priority" json:"priority,omitempty"`
+	Owners     []string                   `protobuf:"bytes,6,rep,name=owners" json:"owners,omitempty"`
+	Old        *NotificationVulnerability `protobuf:"bytes,7,opt,name=old" json:"old,omitempty"`
+	New        *NotificationVulnerability `protobuf:"bytes,8,opt,name=new" json:"new,omitempty"`
+	NextCursor string                     `protobuf:"bytes,9,opt,name=next_cursor" json:"next_cursor,omitempty"`
+	Reason     string                     `protobuf:"bytes,10,opt,name=reason" json:"reason,omitempty"`
+	Changes    *VulnerabilityChanges      `protobuf:"bytes,11,opt,name=changes" json:"changes,omitempty"`
+}
+
+func (m *Notification) Reset()         { *m = Notification{} }
+func (m *Notification) String() string { return proto.CompactTextString(m) }
+func (*Notification) ProtoMessage()    {}
+
+func (m *Notification) GetOld() *NotificationVulnerability {
+	if m != nil {
+		return m.Old
+	}
+	return nil
+}
+
+func (m *Notification) GetNew() *NotificationVulnerability {
+	if m != nil {
+		return m.New
+	}
+	return nil
+}
+
+func (m *Notification) GetChanges() *VulnerabilityChanges {
+	if m != nil {
+		return m.Changes
+	}
+	return nil
+}
+
+type VulnerabilityChanges struct {
+	// Description, Link, Severity, Metadata or Sources.
+	ChangedFields  []string   `protobuf:"bytes,1,rep,name=changed_fields" json:"changed_fields,omitempty"`
+	AddedFixedIn   []*Feature `protobuf:"bytes,2,rep,name=added_fixed_in" json:"added_fixed_in,omitempty"`
+	RemovedFixedIn []*Feature `protobuf:"bytes,3,rep,name=removed_fixed_in" json:"removed_fixed_in,omitempty"`
+}
+
+func (m *VulnerabilityChanges) Reset()         { *m = VulnerabilityChanges{} }
+func (m *VulnerabilityChanges) String() string { return proto.CompactTextString(m) }
+func (*VulnerabilityChanges) ProtoMessage()    {}
+
+func (m *VulnerabilityChanges) GetAddedFixedIn() []*Feature {
+	if m != nil {
+		return m.AddedFixedIn
+	}
+	return nil
+}
+
+func (m *VulnerabilityChanges) GetRemovedFixedIn() []*Feature {
+	if m != nil {
+		return m.RemovedFixedIn
+	}
+	return nil
+}
+
+type PostLayerRequest struct {
+	Layer *Layer `protobuf:"bytes,1,opt,name=layer" json:"layer,omitempty"`
+}
+
+func (m *PostLayerRequest) Reset()         { *m = PostLayerRequest{} }
+func (m *PostLayerRequest) String() string { return proto.CompactTextString(m) }
+func (*PostLayerRequest) ProtoMessage()    {}
+
+func (m *PostLayerRequest) GetLayer() *Layer {
+	if m != nil {
+		return m.Layer
+	}
+	return nil
+}
+
+type GetReportRequest struct {
+	LayerName string `protobuf:"bytes,1,opt,name=layer_name" json:"layer_name,omitempty"`
+}
+
+func (m *GetReportRequest) Reset()         { *m = GetReportRequest{} }
+func (m *GetReportRequest) String() string { return proto.CompactTextString(m) }
+func (*GetReportRequest) ProtoMessage()    {}
+
+type DeleteLayerRequest struct {
+	LayerName string `protobuf:"bytes,1,opt,name=layer_name" json:"layer_name,omitempty"`
+}
+
+func (m *DeleteLayerRequest) Reset()         { *m = DeleteLayerRequest{} }
+func (m *DeleteLayerRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteLayerRequest) ProtoMessage()    {}
+
+type ListNamespacesRequest struct {
+}
+
+func (m *ListNamespacesRequest) Reset()         { *m = ListNamespacesRequest{} }
+func (m *ListNamespacesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListNamespacesRequest) ProtoMessage()    {}
+
+type ListVulnerabilitiesRequest struct {
+	NamespaceName string `protobuf:"bytes,1,opt,name=namespace_name" json:"namespace_name,omitempty"`
+}
+
+func (m *ListVulnerabilitiesRequest) Reset()         { *m = ListVulnerabilitiesRequest{} }
+func (m *ListVulnerabilitiesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListVulnerabilitiesRequest) ProtoMessage()    {}
+
+type GetVulnerabilityRequest struct {
+	NamespaceName     string `protobuf:"bytes,1,opt,name=namespace_name" json:"namespace_name,omitempty"`
+	VulnerabilityName string `protobuf:"bytes,2,opt,name=vulnerability_name" json:"vulnerability_name,omitempty"`
+}
+
+func (m *GetVulnerabilityRequest) Reset()         { *m = GetVulnerabilityRequest{} }
+func (m *GetVulnerabilityRequest) String() string { return proto.CompactTextString(m) }
+func (*GetVulnerabilityRequest) ProtoMessage()    {}
+
+type GetNotificationRequest struct {
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	// Number of affected layers per page, 50 by default.
+	Limit  int32  `protobuf:"varint,2,opt,name=limit" json:"limit,omitempty"`
+	Cursor string `protobuf:"bytes,3,opt,name=cursor" json:"cursor,omitempty"`
+}
+
+func (m *GetNotificationRequest) Reset()         { *m = GetNotificationRequest{} }
+func (m *GetNotificationRequest) String() string { return proto.CompactTextString(m) }
+func (*GetNotificationRequest) ProtoMessage()    {}
+
+type DeleteNotificationRequest struct {
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *DeleteNotificationRequest) Reset()         { *m = DeleteNotificationRequest{} }
+func (m *DeleteNotificationRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteNotificationRequest) ProtoMessage()    {}
+
+type SubscribeRequest struct {
+	Group string `protobuf:"bytes,1,opt,name=group" json:"group,omitempty"`
+}
+
+func (m *SubscribeRequest) Reset()         { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()    {}
+
+type NotificationDelivery struct {
+	// Identifies the delivery in Ack and Nack, and stays the same when it is redelivered.
+	Key string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	// The notification, without its vulnerabilities, which GetNotification returns.
+	Notification *Notification `protobuf:"bytes,2,opt,name=notification" json:"notification,omitempty"`
+}
+
+func (m *NotificationDelivery) Reset()         { *m = NotificationDelivery{} }
+func (m *NotificationDelivery) String() string { return proto.CompactTextString(m) }
+func (*NotificationDelivery) ProtoMessage()    {}
+
+func (m *NotificationDelivery) GetNotification() *Notification {
+	if m != nil {
+		return m.Notification
+	}
+	return nil
+}
+
+type AckRequest struct {
+	Group string `protobuf:"bytes,1,opt,name=group" json:"group,omitempty"`
+	Key   string `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+}
+
+func (m *AckRequest) Reset()         { *m = AckRequest{} }
+func (m *AckRequest) String() string { return proto.CompactTextString(m) }
+func (*AckRequest) ProtoMessage()    {}
+
+type NackRequest struct {
+	Group  string `protobuf:"bytes,1,opt,name=group" json:"group,omitempty"`
+	Key    string `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+	Reason string `protobuf:"bytes,3,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *NackRequest) Reset()         { *m = NackRequest{} }
+func (m *NackRequest) String() string { return proto.CompactTextString(m) }
+func (*NackRequest) ProtoMessage()    {}
+
+type Empty struct {
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+
+func init() {
+	proto.RegisterType((*VulnerabilitySource)(nil), "clairpb.VulnerabilitySource")
+	proto.RegisterType((*CVSS)(nil), "clairpb.CVSS")
+	proto.RegisterType((*Vulnerability)(nil), "clairpb.Vulnerability")
+	proto.RegisterType((*Explanation)(nil), "clairpb.Explanation")
+	proto.RegisterType((*FalsePositive)(nil), "clairpb.FalsePositive")
+	proto.RegisterType((*Feature)(nil), "clairpb.Feature")
+	proto.RegisterType((*Report)(nil), "clairpb.Report")
+	proto.RegisterType((*Provenance)(nil), "clairpb.Provenance")
+	proto.RegisterType((*VulnerabilityPage)(nil), "clairpb.VulnerabilityPage")
+	proto.RegisterType((*Layer)(nil), "clairpb.Layer")
+	proto.RegisterType((*Namespace)(nil), "clairpb.Namespace")
+	proto.RegisterType((*NotificationVulnerability)(nil), "clairpb.NotificationVulnerability")
+	proto.RegisterType((*Notification)(nil), "clairpb.Notification")
+	proto.RegisterType((*VulnerabilityChanges)(nil), "clairpb.VulnerabilityChanges")
+	proto.RegisterType((*PostLayerRequest)(nil), "clairpb.PostLayerRequest")
+	proto.RegisterType((*GetReportRequest)(nil), "clairpb.GetReportRequest")
+	proto.RegisterType((*DeleteLayerRequest)(nil), "clairpb.DeleteLayerRequest")
+	proto.RegisterType((*ListNamespacesRequest)(nil), "clairpb.ListNamespacesRequest")
+	proto.RegisterType((*ListVulnerabilitiesRequest)(nil), "clairpb.ListVulnerabilitiesRequest")
+	proto.RegisterType((*GetVulnerabilityRequest)(nil), "clairpb.GetVulnerabilityRequest")
+	proto.RegisterType((*GetNotificationRequest)(nil), "clairpb.GetNotificationRequest")
+	proto.RegisterType((*DeleteNotificationRequest)(nil), "clairpb.DeleteNotificationRequest")
+	proto.RegisterType((*SubscribeRequest)(nil), "clairpb.SubscribeRequest")
+	proto.RegisterType((*NotificationDelivery)(nil), "clairpb.NotificationDelivery")
+	proto.RegisterType((*AckRequest)(nil), "clairpb.AckRequest")
+	proto.RegisterType((*NackRequest)(nil), "clairpb.NackRequest")
+	proto.RegisterType((*Empty)(nil), "clairpb.Empty")
+}
@@ -0,0 +1,236 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clairpb
+
+import (
+	"bufio"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	protoMessage = regexp.MustCompile(`^\s*(message|enum)\s+(\w+)\s*\{`)
+	protoPackage = regexp.MustCompile(`^\s*package\s+([\w.]+)\s*;`)
+	protoField   = regexp.MustCompile(`^\s*(repeated\s+)?(map<\w+,\s*\w+>|[\w.]+)\s+(\w+)\s*=\s*(\d+)\s*;`)
+)
+
+type protoFieldDef struct {
+	repeated bool
+	kind     string
+	name     string
+	number   int
+}
+
+// parseProto reads the messages of a .proto file, keyed by their registered name, along with the
+// names of the enums it declares. It only understands the subset of the language used by clair.
+func parseProto(t *testing.T, path string) (map[string][]protoFieldDef, map[string]bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var (
+		pkg      string
+		scopes   []string
+		messages = make(map[string][]protoFieldDef)
+		enums    = make(map[string]bool)
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		if m := protoPackage.FindStringSubmatch(line); m != nil {
+			pkg = m[1]
+			continue
+		}
+		if m := protoMessage.FindStringSubmatch(line); m != nil {
+			scopes = append(scopes, m[2])
+			if m[1] == "enum" {
+				enums[m[2]] = true
+			} else {
+				messages[pkg+"."+strings.Join(scopes, "_")] = nil
+			}
+			if strings.Contains(line, "}") {
+				scopes = scopes[:len(scopes)-1]
+			}
+			continue
+		}
+		if strings.Contains(line, "{") {
+			// A service, which nests its own braces.
+			scopes = append(scopes, "")
+			continue
+		}
+		if strings.Contains(line, "}") {
+			scopes = scopes[:len(scopes)-1]
+			continue
+		}
+		if m := protoField.FindStringSubmatch(line); m != nil && len(scopes) > 0 {
+			name := pkg + "." + strings.Join(scopes, "_")
+			number, _ := strconv.Atoi(m[4])
+			messages[name] = append(messages[name], protoFieldDef{
+				repeated: m[1] != "",
+				kind:     m[2],
+				name:     m[3],
+				number:   number,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return messages, enums
+}
+
+// wireType returns the encoding protoc-gen-go writes in the struct tag of a field of the given type.
+func wireType(kind string, enums map[string]bool) string {
+	switch {
+	case strings.HasPrefix(kind, "map<"):
+		return "bytes"
+	case enums[kind]:
+		return "varint"
+	}
+	switch kind {
+	case "bool", "int32", "int64", "uint32", "uint64":
+		return "varint"
+	case "sint32":
+		return "zigzag32"
+	case "sint64":
+		return "zigzag64"
+	case "double", "fixed64", "sfixed64":
+		return "fixed64"
+	case "float", "fixed32", "sfixed32":
+		return "fixed32"
+	}
+	// Strings, bytes and messages.
+	return "bytes"
+}
+
+func TestProtoFiles(t *testing.T) {
+	for _, path := range []string{"clair.proto", "health.proto"} {
+		messages, enums := parseProto(t, path)
+		assert.NotEmpty(t, messages, path)
+
+		for name, fields := range messages {
+			typ := proto.MessageType(name)
+			if !assert.NotNil(t, typ, "%s: message %s isn't registered", path, name) {
+				continue
+			}
+			typ = typ.Elem()
+
+			tags := make(map[string]string)
+			for i := 0; i < typ.NumField(); i++ {
+				if tag := typ.Field(i).Tag.Get("protobuf"); tag != "" {
+					tags[tag] = typ.Field(i).Name
+				}
+			}
+			assert.Len(t, tags, len(fields), "%s: message %s has a different number of fields", path, name)
+
+			for _, field := range fields {
+				rule := "opt"
+				if field.repeated || strings.HasPrefix(field.kind, "map<") {
+					rule = "rep"
+				}
+				tag := wireType(field.kind, enums) + "," + strconv.Itoa(field.number) + "," + rule + ",name=" + field.name
+				if enums[field.kind] {
+					tag += ",enum=" + strings.TrimSuffix(name, "_"+field.kind) + "_" + field.kind
+				}
+				_, ok := tags[tag]
+				assert.True(t, ok, "%s: %s.%s has no Go field tagged %q", path, name, field.name, tag)
+			}
+		}
+	}
+}
+
+// fill sets every field of the message v to a non-zero value, so that a field which
+// doesn't survive encoding makes the round-trip comparison fail.
+func fill(v reflect.Value, depth int) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(v.Type().String())
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int32, reflect.Int64:
+		v.SetInt(int64(depth + 1))
+	case reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(depth + 1))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(depth) + 0.5)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte{byte(depth + 1)})
+			return
+		}
+		if v.Type().Elem().Kind() == reflect.Ptr && depth > 2 {
+			return
+		}
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0), depth)
+	case reflect.Map:
+		key, value := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(key, depth)
+		fill(value, depth)
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(key, value)
+	case reflect.Ptr:
+		if depth > 2 {
+			return
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).Tag.Get("protobuf") != "" {
+				fill(v.Field(i), depth)
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, path := range []string{"clair.proto", "health.proto"} {
+		messages, _ := parseProto(t, path)
+
+		for name := range messages {
+			typ := proto.MessageType(name)
+			if typ == nil {
+				// Reported by TestProtoFiles.
+				continue
+			}
+
+			msg := reflect.New(typ.Elem())
+			fill(msg.Elem(), 0)
+
+			b, err := proto.Marshal(msg.Interface().(proto.Message))
+			if !assert.Nil(t, err, "%s: %s", name, err) {
+				continue
+			}
+			decoded := reflect.New(typ.Elem()).Interface().(proto.Message)
+			if assert.Nil(t, proto.Unmarshal(b, decoded), name) {
+				assert.True(t, proto.Equal(msg.Interface().(proto.Message), decoded), "%s doesn't round-trip: %v != %v", name, msg.Interface(), decoded)
+			}
+		}
+	}
+}
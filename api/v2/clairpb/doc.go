@@ -0,0 +1,24 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clairpb holds the Protocol Buffers messages of the Clair API, declared in clair.proto and
+// health.proto. The messages are kept in their own package so that every API speaking Protocol
+// Buffers shares the same types.
+//
+// The Go types are written by hand, as protoc isn't part of the build. When protoc is available,
+// go generate replaces them with equivalent generated code.
+package clairpb
+
+//go:generate protoc --go_out=. clair.proto
+//go:generate protoc --go_out=. health.proto
@@ -0,0 +1,131 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/coreos/clair/api/context"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+func getReportDiff(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	query := r.URL.Query()
+	from, to := query.Get("from"), query.Get("to")
+	if from == "" || to == "" {
+		writeError(w, r, http.StatusBadRequest, errors.New("the from and to parameters are required"))
+		return getReportDiffRoute, http.StatusBadRequest
+	}
+
+	fromReport, err := imageReport(ctx, from)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getReportDiffRoute, status
+	}
+	toReport, err := imageReport(ctx, to)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getReportDiffRoute, status
+	}
+
+	diff := diffReports(fromReport, toReport)
+	diff.From, diff.To = from, to
+	writeResponse(w, r, http.StatusOK, diff)
+	return getReportDiffRoute, http.StatusOK
+}
+
+// imageReport returns the report of the image whose manifest has the given digest, as recorded by
+// the tracker, or of the layer of the given name if there is no such image.
+func imageReport(ctx *context.RouteContext, digest string) (Report, error) {
+	layerName := digest
+	dbImage, err := ctx.Store.FindImage(digest)
+	if err == nil {
+		layerName = dbImage.LayerName
+	} else if err != cerrors.ErrNotFound {
+		return Report{}, err
+	}
+	return buildReport(ctx, layerName, nil)
+}
+
+// A findingKey identifies a finding across images, regardless of the version of the feature, so
+// that the findings of a feature upgraded to a version still affected are unchanged.
+type findingKey struct {
+	namespaceName, vulnerabilityName, featureName string
+}
+
+// diffReports compares the findings of two reports. The unchanged findings are the ones of to.
+func diffReports(from, to Report) ReportDiff {
+	fromFindings, toFindings := reportFindings(from), reportFindings(to)
+
+	diff := ReportDiff{
+		FromLayerName: from.LayerName,
+		ToLayerName:   to.LayerName,
+		Fixed:         []Finding{},
+		Introduced:    []Finding{},
+		Unchanged:     []Finding{},
+	}
+	for key, finding := range fromFindings {
+		if _, ok := toFindings[key]; !ok {
+			diff.Fixed = append(diff.Fixed, finding)
+		}
+	}
+	for key, finding := range toFindings {
+		if _, ok := fromFindings[key]; ok {
+			diff.Unchanged = append(diff.Unchanged, finding)
+		} else {
+			diff.Introduced = append(diff.Introduced, finding)
+		}
+	}
+
+	sort.Sort(diffFindings(diff.Fixed))
+	sort.Sort(diffFindings(diff.Introduced))
+	sort.Sort(diffFindings(diff.Unchanged))
+	return diff
+}
+
+func reportFindings(report Report) map[findingKey]Finding {
+	findings := make(map[findingKey]Finding)
+	for _, feature := range report.Features {
+		for _, vuln := range feature.Vulnerabilities {
+			findings[findingKey{vuln.NamespaceName, vuln.Name, feature.Name}] = Finding{
+				FeatureName:    feature.Name,
+				FeatureVersion: feature.Version,
+				Vulnerability:  vuln,
+			}
+		}
+	}
+	return findings
+}
+
+// diffFindings sorts findings from the highest severity to the lowest, then by vulnerability and
+// feature.
+type diffFindings []Finding
+
+func (s diffFindings) Len() int      { return len(s) }
+func (s diffFindings) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s diffFindings) Less(i, j int) bool {
+	if c := types.Priority(s[i].Vulnerability.Severity).Compare(types.Priority(s[j].Vulnerability.Severity)); c != 0 {
+		return c > 0
+	}
+	if s[i].Vulnerability.Name != s[j].Vulnerability.Name {
+		return s[i].Vulnerability.Name < s[j].Vulnerability.Name
+	}
+	return s[i].FeatureName < s[j].FeatureName
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestReportDiff(t *testing.T) {
+	namespace := database.Namespace{Name: "debian:8"}
+	fixed := database.Vulnerability{Name: "CVE-2016-0001", Namespace: namespace, Severity: types.High}
+	unchanged := database.Vulnerability{Name: "CVE-2016-0002", Namespace: namespace, Severity: types.Low}
+	introduced := database.Vulnerability{Name: "CVE-2016-0003", Namespace: namespace, Severity: types.Critical}
+	datastore := &database.MockDatastore{
+		FctFindImage: func(digest string) (database.Image, error) {
+			switch digest {
+			case "sha256:old":
+				return database.Image{Digest: digest, LayerName: "old"}, nil
+			case "sha256:new":
+				return database.Image{Digest: digest, LayerName: "new"}, nil
+			}
+			return database.Image{}, cerrors.ErrNotFound
+		},
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			switch name {
+			case "old":
+				return database.Layer{Name: name, Features: []database.FeatureVersion{
+					{Feature: database.Feature{Name: "openssl", Namespace: namespace}, Version: "1.0.1", AffectedBy: []database.Vulnerability{fixed, unchanged}},
+				}}, nil
+			case "new":
+				return database.Layer{Name: name, Features: []database.FeatureVersion{
+					{Feature: database.Feature{Name: "openssl", Namespace: namespace}, Version: "1.0.2", AffectedBy: []database.Vulnerability{unchanged}},
+					{Feature: database.Feature{Name: "bash", Namespace: namespace}, Version: "4.3", AffectedBy: []database.Vulnerability{introduced}},
+				}}, nil
+			}
+			return database.Layer{}, cerrors.ErrNotFound
+		},
+		FctFindFalsePositives: func([]database.Vulnerability) ([]database.FalsePositive, error) {
+			return nil, nil
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{}}
+
+	r, _ := http.NewRequest("GET", "/reports/diff?from=sha256:old&to=sha256:new", nil)
+	w := httptest.NewRecorder()
+	getReportDiff(w, r, nil, ctx)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		var diff ReportDiff
+		if assert.Nil(t, json.NewDecoder(w.Body).Decode(&diff)) {
+			assert.Equal(t, "old", diff.FromLayerName)
+			assert.Equal(t, "new", diff.ToLayerName)
+			if assert.Len(t, diff.Fixed, 1) {
+				assert.Equal(t, "CVE-2016-0001", diff.Fixed[0].Vulnerability.Name)
+				assert.Equal(t, "1.0.1", diff.Fixed[0].FeatureVersion)
+			}
+			if assert.Len(t, diff.Introduced, 1) {
+				assert.Equal(t, "CVE-2016-0003", diff.Introduced[0].Vulnerability.Name)
+				assert.Equal(t, "bash", diff.Introduced[0].FeatureName)
+			}
+			// Findings of upgraded features still affected are unchanged.
+			if assert.Len(t, diff.Unchanged, 1) {
+				assert.Equal(t, "CVE-2016-0002", diff.Unchanged[0].Vulnerability.Name)
+				assert.Equal(t, "1.0.2", diff.Unchanged[0].FeatureVersion)
+			}
+		}
+	}
+
+	// Layers can be compared by name.
+	r, _ = http.NewRequest("GET", "/reports/diff?from=new&to=old", nil)
+	w = httptest.NewRecorder()
+	getReportDiff(w, r, nil, ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r, _ = http.NewRequest("GET", "/reports/diff?from=sha256:old&to=sha256:unknown", nil)
+	w = httptest.NewRecorder()
+	getReportDiff(w, r, nil, ctx)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	r, _ = http.NewRequest("GET", "/reports/diff?from=sha256:old", nil)
+	w = httptest.NewRecorder()
+	getReportDiff(w, r, nil, ctx)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
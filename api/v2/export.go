@@ -0,0 +1,314 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/registry"
+)
+
+const (
+	csvContentType  = "text/csv;charset=utf-8"
+	xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+	// exportVulnerabilitiesPage is the size of the pages of vulnerabilities that the exports of
+	// the namespaces are listed by.
+	exportVulnerabilitiesPage = 1000
+)
+
+// An exportRow is a row of an export: a vulnerability affecting a feature of a layer, or a
+// vulnerability of a namespace.
+type exportRow struct {
+	Layer         string
+	Image         string
+	Owners        []string
+	Feature       Feature
+	Vulnerability Vulnerability
+}
+
+// exportColumns are the columns of the exports, by name.
+var exportColumns = map[string]func(exportRow) string{
+	"layer":         func(row exportRow) string { return row.Layer },
+	"image":         func(row exportRow) string { return row.Image },
+	"owners":        func(row exportRow) string { return strings.Join(row.Owners, ",") },
+	"feature":       func(row exportRow) string { return row.Feature.Name },
+	"version":       func(row exportRow) string { return row.Feature.Version },
+	"addedby":       func(row exportRow) string { return row.Feature.AddedBy },
+	"kernel":        func(row exportRow) string { return exportBool(row.Feature.Kernel) },
+	"namespace":     func(row exportRow) string { return row.Vulnerability.NamespaceName },
+	"vulnerability": func(row exportRow) string { return row.Vulnerability.Name },
+	"severity":      func(row exportRow) string { return row.Vulnerability.Severity },
+	"cvss": func(row exportRow) string {
+		if cvss := row.Vulnerability.CVSS.latest(); cvss != nil {
+			return strconv.FormatFloat(cvss.Score, 'f', 1, 64)
+		}
+		return ""
+	},
+	"cvssvector": func(row exportRow) string {
+		if cvss := row.Vulnerability.CVSS.latest(); cvss != nil {
+			return cvss.Vector
+		}
+		return ""
+	},
+	"fixedby":       func(row exportRow) string { return row.Vulnerability.FixedBy },
+	"remediation":   func(row exportRow) string { return row.Vulnerability.Remediation },
+	"link":          func(row exportRow) string { return row.Vulnerability.Link },
+	"description":   func(row exportRow) string { return row.Vulnerability.Description },
+	"falsepositive": func(row exportRow) string { return exportBool(row.Vulnerability.FalsePositive != nil) },
+	"reason": func(row exportRow) string {
+		if row.Vulnerability.FalsePositive == nil {
+			return ""
+		}
+		return row.Vulnerability.FalsePositive.Reason
+	},
+}
+
+// defaultExportColumns are the columns of the exports unless they are configured or requested.
+var defaultExportColumns = []string{"image", "layer", "feature", "version", "namespace", "vulnerability", "severity", "fixedby", "link", "falsepositive", "reason"}
+
+func exportBool(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func getReportExport(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	report, err := buildReport(ctx, p.ByName("layerName"), nil)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getReportExportRoute, status
+	}
+
+	status := writeExport(w, r, ctx, report.LayerName, reportRows(report, ""))
+	return getReportExportRoute, status
+}
+
+func getWatchExport(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	dbWatchedTag, err := ctx.Store.FindWatchedTag(p.ByName("watchName"))
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getWatchExportRoute, status
+	}
+	if dbWatchedTag.LayerName == "" {
+		writeError(w, r, http.StatusNotFound, errors.New("the tag has not been indexed yet"))
+		return getWatchExportRoute, http.StatusNotFound
+	}
+
+	report, err := buildReport(ctx, dbWatchedTag.LayerName, &dbWatchedTag)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getWatchExportRoute, status
+	}
+
+	image := registry.ImageName(dbWatchedTag.Registry, dbWatchedTag.Repository) + ":" + dbWatchedTag.Tag
+	status := writeExport(w, r, ctx, dbWatchedTag.Name, reportRows(report, image))
+	return getWatchExportRoute, status
+}
+
+func getNamespaceExport(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	namespaceName := p.ByName("namespaceName")
+
+	var rows []exportRow
+	for page := 0; page != -1; {
+		dbVulns, nextPage, err := ctx.Store.ListVulnerabilities(namespaceName, exportVulnerabilitiesPage, page)
+		if err != nil {
+			status := writeDatastoreError(w, r, err)
+			return getNamespaceExportRoute, status
+		}
+		for _, dbVuln := range dbVulns {
+			rows = append(rows, exportRow{Vulnerability: vulnerabilityFromDatabaseModel(dbVuln)})
+		}
+		page = nextPage
+	}
+
+	status := writeExport(w, r, ctx, namespaceName, rows)
+	return getNamespaceExportRoute, status
+}
+
+// reportRows returns the rows of the export of a report, one per vulnerability of a feature.
+func reportRows(report Report, image string) []exportRow {
+	var rows []exportRow
+	for _, feature := range report.Features {
+		for _, vuln := range feature.Vulnerabilities {
+			rows = append(rows, exportRow{
+				Layer:         report.LayerName,
+				Image:         image,
+				Owners:        report.Owners,
+				Feature:       feature,
+				Vulnerability: vuln,
+			})
+		}
+	}
+	return rows
+}
+
+// writeExport writes the rows as a CSV file, or as an XLSX workbook if the "format" parameter is
+// "xlsx", with the columns of the "columns" parameter or of the configuration, and returns the
+// status of the response.
+func writeExport(w http.ResponseWriter, r *http.Request, ctx *context.RouteContext, name string, rows []exportRow) int {
+	query := r.URL.Query()
+
+	columns := defaultExportColumns
+	if ctx.Config != nil && len(ctx.Config.ExportColumns) > 0 {
+		columns = ctx.Config.ExportColumns
+	}
+	if c := query.Get("columns"); c != "" {
+		columns = strings.Split(c, ",")
+	}
+	for _, column := range columns {
+		if _, ok := exportColumns[column]; !ok {
+			writeError(w, r, http.StatusBadRequest, fmt.Errorf("unknown column '%s'", column))
+			return http.StatusBadRequest
+		}
+	}
+
+	records := [][]string{columns}
+	for _, row := range rows {
+		record := make([]string, 0, len(columns))
+		for _, column := range columns {
+			record = append(record, exportColumns[column](row))
+		}
+		records = append(records, record)
+	}
+
+	var buf bytes.Buffer
+	var contentType, extension string
+	switch format := query.Get("format"); format {
+	case "", "csv":
+		contentType, extension = csvContentType, "csv"
+		writeCSV(&buf, records)
+	case "xlsx":
+		contentType, extension = xlsxContentType, "xlsx"
+		if err := writeXLSX(&buf, records); err != nil {
+			writeError(w, r, http.StatusInternalServerError, err)
+			return http.StatusInternalServerError
+		}
+	default:
+		writeError(w, r, http.StatusBadRequest, fmt.Errorf("unknown format '%s', expected csv or xlsx", format))
+		return http.StatusBadRequest
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", strconv.Quote(exportFilename(name)+"."+extension)))
+	header.Set("Server", "clair")
+	w.WriteHeader(http.StatusOK)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Warningf("failed to write response: %s", err.Error())
+	}
+	return http.StatusOK
+}
+
+// exportFilename returns the name of the file of an export, made of the characters of the given
+// name that are safe in file names.
+func exportFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// writeCSV writes the records as CSV. The cells that spreadsheets would evaluate as formulas are
+// prefixed with a quote.
+func writeCSV(w io.Writer, records [][]string) {
+	writer := csv.NewWriter(w)
+	for _, record := range records {
+		cells := make([]string, len(record))
+		for i, cell := range record {
+			if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+				cell = "'" + cell
+			}
+			cells[i] = cell
+		}
+		writer.Write(cells)
+	}
+	writer.Flush()
+}
+
+// xlsxParts are the parts of an XLSX workbook having a single sheet, besides the sheet.
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Report" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// writeXLSX writes the records as an XLSX workbook having a single sheet of inline strings.
+func writeXLSX(w io.Writer, records [][]string) error {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	f, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var sheet bytes.Buffer
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, record := range records {
+		fmt.Fprintf(&sheet, `<row r="%d">`, i+1)
+		for j, cell := range record {
+			fmt.Fprintf(&sheet, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, xlsxColumn(j), i+1)
+			xml.EscapeText(&sheet, []byte(cell))
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+	if _, err := sheet.WriteTo(f); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// xlsxColumn returns the name of the column of the given index, e.g. "A" for 0 or "AA" for 26.
+func xlsxColumn(index int) string {
+	var name string
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestExport(t *testing.T) {
+	vulnerability := database.Vulnerability{
+		Name:        "CVE-2016-0001",
+		Namespace:   database.Namespace{Name: "debian:8"},
+		Severity:    types.High,
+		Description: "=HYPERLINK(\"http://example.com\")",
+		FixedBy:     "1.0.2",
+		CVSS:        database.VulnerabilityCVSS{V2: &types.CVSS{Vector: "AV:N/AC:L/Au:N/C:P/I:P/A:P", Score: 7.5}},
+	}
+	datastore := &database.MockDatastore{
+		FctFindWatchedTag: func(name string) (database.WatchedTag, error) {
+			return database.WatchedTag{Name: name, Registry: "https://registry.example.com", Repository: "team/app", Tag: "latest", LayerName: "layer"}, nil
+		},
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{Name: name, Features: []database.FeatureVersion{
+				{Feature: database.Feature{Name: "openssl", Namespace: vulnerability.Namespace}, Version: "1.0.1", AffectedBy: []database.Vulnerability{vulnerability}},
+				{Feature: database.Feature{Name: "bash", Namespace: vulnerability.Namespace}, Version: "4.3"},
+			}}, nil
+		},
+		FctFindFalsePositives: func([]database.Vulnerability) ([]database.FalsePositive, error) {
+			return []database.FalsePositive{{Namespace: vulnerability.Namespace, VulnerabilityName: vulnerability.Name, FeatureName: "openssl", FeatureVersion: "1.0.1", Reason: "not reachable"}}, nil
+		},
+		FctListVulnerabilities: func(namespaceName string, limit int, page int) ([]database.Vulnerability, int, error) {
+			if page == 0 {
+				return []database.Vulnerability{vulnerability}, 1, nil
+			}
+			return []database.Vulnerability{{Name: "CVE-2016-0002", Namespace: vulnerability.Namespace, Severity: types.Low}}, -1, nil
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{}}
+
+	// The export of a watch has a row per vulnerability of a feature, with the default columns.
+	r, _ := http.NewRequest("GET", "/watches/app/export", nil)
+	w := httptest.NewRecorder()
+	getWatchExport(w, r, httprouter.Params{{Key: "watchName", Value: "app"}}, ctx)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, csvContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="app.csv"`, w.Header().Get("Content-Disposition"))
+		records, err := csv.NewReader(w.Body).ReadAll()
+		assert.Nil(t, err)
+		assert.Equal(t, [][]string{
+			defaultExportColumns,
+			{"registry.example.com/team/app:latest", "layer", "openssl", "1.0.1", "debian:8", "CVE-2016-0001", "High", "1.0.2", "", "yes", "not reachable"},
+		}, records)
+	}
+
+	// The columns can be configured and requested, and formulas are neutralized.
+	ctx.Config.ExportColumns = []string{"vulnerability"}
+	r, _ = http.NewRequest("GET", "/layers/layer/export", nil)
+	w = httptest.NewRecorder()
+	getReportExport(w, r, httprouter.Params{{Key: "layerName", Value: "layer"}}, ctx)
+	assert.Equal(t, "vulnerability\nCVE-2016-0001\n", w.Body.String())
+
+	r, _ = http.NewRequest("GET", "/namespaces/debian:8/export?columns=vulnerability,description", nil)
+	w = httptest.NewRecorder()
+	getNamespaceExport(w, r, httprouter.Params{{Key: "namespaceName", Value: "debian:8"}}, ctx)
+	assert.Equal(t, "vulnerability,description\nCVE-2016-0001,\"'=HYPERLINK(\"\"http://example.com\"\")\"\nCVE-2016-0002,\n", w.Body.String())
+
+	r, _ = http.NewRequest("GET", "/namespaces/debian:8/export?columns=vulnerability,cvss,cvssvector", nil)
+	w = httptest.NewRecorder()
+	getNamespaceExport(w, r, httprouter.Params{{Key: "namespaceName", Value: "debian:8"}}, ctx)
+	assert.Equal(t, "vulnerability,cvss,cvssvector\nCVE-2016-0001,7.5,AV:N/AC:L/Au:N/C:P/I:P/A:P\nCVE-2016-0002,,\n", w.Body.String())
+
+	r, _ = http.NewRequest("GET", "/namespaces/debian:8/export?columns=unknown", nil)
+	w = httptest.NewRecorder()
+	getNamespaceExport(w, r, httprouter.Params{{Key: "namespaceName", Value: "debian:8"}}, ctx)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The XLSX export is a workbook whose sheet has the cells as inline strings.
+	r, _ = http.NewRequest("GET", "/namespaces/debian:8/export?format=xlsx", nil)
+	w = httptest.NewRecorder()
+	getNamespaceExport(w, r, httprouter.Params{{Key: "namespaceName", Value: "debian:8"}}, ctx)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, `attachment; filename="debian_8.xlsx"`, w.Header().Get("Content-Disposition"))
+		archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		if assert.Nil(t, err) && assert.Len(t, archive.File, 5) {
+			f, _ := archive.File[4].Open()
+			sheet, _ := ioutil.ReadAll(f)
+			assert.Contains(t, string(sheet), `<row r="3"><c r="A3" t="inlineStr"><is><t xml:space="preserve">CVE-2016-0002</t></is></c></row>`)
+		}
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumn(0))
+	assert.Equal(t, "Z", xlsxColumn(25))
+	assert.Equal(t, "AA", xlsxColumn(26))
+	assert.Equal(t, "BA", xlsxColumn(52))
+}
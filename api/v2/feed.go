@@ -0,0 +1,185 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/attestation"
+	"github.com/coreos/clair/bundle"
+)
+
+// lastUpdateKey is the key of the time of the last successful update of the vulnerabilities, as
+// stored by the updater. The bundle of the feed is written again once it changes.
+const lastUpdateKey = "updater/last"
+
+var (
+	errFeedDisabled = errors.New("the feed is disabled")
+	errFeedNotReady = errors.New("the vulnerabilities haven't been updated yet")
+)
+
+// A feed serves the vulnerabilities of the datastore as a signed bundle, which other Clair
+// instances mirror. The bundle is written to a temporary file after every update of the
+// vulnerabilities, when it is first requested.
+type feed struct {
+	mu sync.Mutex
+
+	lastUpdate string
+	path       string
+	header     bundle.Header
+	signature  []byte
+}
+
+// open returns the bundle of the last update, writing it first if needed, along with its header
+// and signature. The file stays readable after a newer bundle replaces it.
+func (f *feed) open(ctx *context.RouteContext) (*os.File, bundle.Header, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lastUpdate, err := ctx.Store.GetKeyValue(lastUpdateKey)
+	if err != nil {
+		return nil, bundle.Header{}, nil, err
+	}
+	if lastUpdate == "" {
+		return nil, bundle.Header{}, nil, errFeedNotReady
+	}
+	if lastUpdate != f.lastUpdate || f.path == "" {
+		if err := f.write(ctx, lastUpdate); err != nil {
+			return nil, bundle.Header{}, nil, err
+		}
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, bundle.Header{}, nil, err
+	}
+	return file, f.header, f.signature, nil
+}
+
+// write writes and signs the bundle of the vulnerabilities of the given last update, replacing the
+// previous one.
+func (f *feed) write(ctx *context.RouteContext, lastUpdate string) error {
+	unix, err := strconv.ParseInt(lastUpdate, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid time of the last update '%s': %s", lastUpdate, err)
+	}
+
+	key, err := ioutil.ReadFile(ctx.Config.Feed.Key)
+	if err != nil {
+		return fmt.Errorf("could not read the signing key of the feed: %s", err)
+	}
+	signer, err := attestation.NewSigner(key)
+	if err != nil {
+		return fmt.Errorf("could not parse the signing key of the feed: %s", err)
+	}
+
+	header := bundle.Header{
+		Version: time.Unix(unix, 0).UTC().Format("20060102T150405Z"),
+		Created: time.Now().UTC(),
+	}
+	start := time.Now()
+
+	file, err := ioutil.TempFile("", "clair-feed-")
+	if err != nil {
+		return err
+	}
+	w, err := bundle.NewWriter(file, header)
+	if err == nil {
+		err = bundle.WriteDatastore(w, ctx.Store)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	var signature []byte
+	if err == nil {
+		signature, err = signer.SignBlob(w.Digest())
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("could not write the bundle of the feed: %s", err)
+	}
+
+	if f.path != "" {
+		os.Remove(f.path)
+	}
+	f.lastUpdate, f.path, f.header, f.signature = lastUpdate, file.Name(), header, signature
+
+	log.Infof("wrote %d vulnerabilities to the bundle %s of the feed in %v", w.Count(), header.Version, time.Since(start))
+	return nil
+}
+
+// serve opens the bundle of the feed, or writes the error preventing it and returns its status.
+func (f *feed) serve(w http.ResponseWriter, r *http.Request, ctx *context.RouteContext) (*os.File, bundle.Header, []byte, int) {
+	if ctx.Config == nil || ctx.Config.Feed == nil {
+		writeError(w, r, http.StatusNotFound, errFeedDisabled)
+		return nil, bundle.Header{}, nil, http.StatusNotFound
+	}
+
+	file, header, signature, err := f.open(ctx)
+	if err == errFeedNotReady {
+		writeError(w, r, http.StatusServiceUnavailable, err)
+		return nil, bundle.Header{}, nil, http.StatusServiceUnavailable
+	} else if err != nil {
+		log.Errorf("could not serve the feed: %s", err)
+		writeError(w, r, http.StatusInternalServerError, err)
+		return nil, bundle.Header{}, nil, http.StatusInternalServerError
+	}
+	return file, header, signature, http.StatusOK
+}
+
+// getBundle serves the bundle of the feed. Clients can skip unchanged bundles with conditional
+// requests.
+func (f *feed) getBundle(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	file, header, _, status := f.serve(w, r, ctx)
+	if file == nil {
+		return getFeedRoute, status
+	}
+	defer file.Close()
+
+	w.Header().Set("Server", "clair")
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("ETag", strconv.Quote(header.Version))
+	http.ServeContent(w, r, "", header.Created, file)
+	return getFeedRoute, status
+}
+
+// getBundleSignature serves the signature of the bundle of the feed.
+func (f *feed) getBundleSignature(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	file, header, signature, status := f.serve(w, r, ctx)
+	if file == nil {
+		return getFeedSignatureRoute, status
+	}
+	file.Close()
+
+	w.Header().Set("Server", "clair")
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("ETag", strconv.Quote(header.Version))
+	w.WriteHeader(http.StatusOK)
+	w.Write(signature)
+	return getFeedSignatureRoute, status
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/bundle"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+func TestFeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clair-feed")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	keyPath := filepath.Join(dir, "feed.key")
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+
+	var lastUpdate string
+	writes := 0
+	datastore := &database.MockDatastore{
+		FctGetKeyValue: func(key string) (string, error) {
+			assert.Equal(t, lastUpdateKey, key)
+			return lastUpdate, nil
+		},
+		FctListNamespaces: func() ([]database.Namespace, error) {
+			writes++
+			return []database.Namespace{{Name: "debian:8"}}, nil
+		},
+		FctStreamVulnerabilities: func(namespaceName string, fn func(database.Vulnerability) error) error {
+			return fn(database.Vulnerability{Name: "CVE-1", Namespace: database.Namespace{Name: namespaceName}})
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{Feed: &config.FeedConfig{Key: keyPath}}}
+	f := new(feed)
+	defer func() { os.Remove(f.path) }()
+
+	get := func(handler context.Handler, header http.Header) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/feed/vulnerabilities.ndjson.gz", nil)
+		if header != nil {
+			r.Header = header
+		}
+		w := httptest.NewRecorder()
+		handler(w, r, httprouter.Params{}, ctx)
+		return w
+	}
+
+	// Nothing is served before the first update.
+	assert.Equal(t, http.StatusServiceUnavailable, get(f.getBundle, nil).Code)
+
+	// The bundle is signed, and written once per update.
+	lastUpdate = "1476705600"
+	w := get(f.getBundle, nil)
+	signature := get(f.getBundleSignature, nil)
+	if assert.Equal(t, http.StatusOK, w.Code) && assert.Equal(t, http.StatusOK, signature.Code) {
+		digest := sha256.Sum256(w.Body.Bytes())
+		assert.True(t, bundle.Verify(digest[:], signature.Body.Bytes(), []*ecdsa.PublicKey{&key.PublicKey}))
+
+		reader, err := bundle.NewReader(bytes.NewReader(w.Body.Bytes()))
+		if assert.Nil(t, err) {
+			assert.Equal(t, "20161017T120000Z", reader.Header.Version)
+			vulnerability, err := reader.Next()
+			if assert.Nil(t, err) {
+				assert.Equal(t, "CVE-1", vulnerability.Name)
+			}
+			_, err = reader.Next()
+			assert.Equal(t, io.EOF, err)
+		}
+	}
+	assert.Equal(t, 1, writes)
+
+	// Unchanged bundles aren't downloaded again.
+	w = get(f.getBundle, http.Header{"If-None-Match": {`"20161017T120000Z"`}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// The bundle is written again after an update.
+	previous := f.path
+	lastUpdate = "1476709200"
+	w = get(f.getBundle, nil)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, `"20161017T130000Z"`, w.Header().Get("ETag"))
+		assert.Equal(t, 2, writes)
+		_, err := os.Stat(previous)
+		assert.True(t, os.IsNotExist(err), "the previous bundle is removed")
+	}
+
+	// The feed is disabled without configuration.
+	ctx.Config.Feed = nil
+	assert.Equal(t, http.StatusNotFound, get(f.getBundle, nil).Code)
+	assert.Equal(t, http.StatusNotFound, get(f.getBundleSignature, nil).Code)
+}
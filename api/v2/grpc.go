@@ -0,0 +1,452 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/julienschmidt/httprouter"
+	netcontext "golang.org/x/net/context"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/api/token"
+	"github.com/coreos/clair/api/v2/clairpb"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/health"
+	"github.com/coreos/clair/notifier"
+	"github.com/coreos/clair/utils"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/worker"
+)
+
+// The gRPC API serves the Clair service of clair.proto. It speaks the gRPC protocol over HTTP/2
+// on top of net/http: every call is a POST of a length-prefixed request message, answered by
+// length-prefixed response messages followed by the status of the call in the trailers.
+const (
+	grpcContentType = "application/grpc"
+
+	// grpcServicePath prefixes the paths of the methods of the service.
+	grpcServicePath = "/clairpb.Clair/"
+
+	// grpcHealthServicePath prefixes the paths of the methods of the standard health service.
+	grpcHealthServicePath = "/grpc.health.v1.Health/"
+
+	// grpcHealthTimeout bounds the time spent checking the health of every service.
+	grpcHealthTimeout = 5 * time.Second
+)
+
+// The gRPC status codes of the calls.
+const (
+	grpcOK                = 0
+	grpcInvalidArgument   = 3
+	grpcNotFound          = 5
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+)
+
+// grpcMethod is a method of the Clair service. It decodes its request into a new message and
+// sends its responses one by one, which the streaming methods do any number of times, until the
+// context of the call is done when the client goes away.
+type grpcMethod struct {
+	request func() proto.Message
+	call    func(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error
+
+	// write methods are rejected in read-only mode.
+	write bool
+}
+
+var grpcMethods = map[string]grpcMethod{
+	"PostLayer": {
+		request: func() proto.Message { return &clairpb.PostLayerRequest{} },
+		call:    grpcPostLayer,
+		write:   true,
+	},
+	"GetReport": {
+		request: func() proto.Message { return &clairpb.GetReportRequest{} },
+		call:    grpcGetReport,
+	},
+	"DeleteLayer": {
+		request: func() proto.Message { return &clairpb.DeleteLayerRequest{} },
+		call:    grpcDeleteLayer,
+		write:   true,
+	},
+	"ListNamespaces": {
+		request: func() proto.Message { return &clairpb.ListNamespacesRequest{} },
+		call:    grpcListNamespaces,
+	},
+	"ListVulnerabilities": {
+		request: func() proto.Message { return &clairpb.ListVulnerabilitiesRequest{} },
+		call:    grpcListVulnerabilities,
+	},
+	"GetVulnerability": {
+		request: func() proto.Message { return &clairpb.GetVulnerabilityRequest{} },
+		call:    grpcGetVulnerability,
+	},
+	"GetNotification": {
+		request: func() proto.Message { return &clairpb.GetNotificationRequest{} },
+		call:    grpcGetNotification,
+	},
+	"DeleteNotification": {
+		request: func() proto.Message { return &clairpb.DeleteNotificationRequest{} },
+		call:    grpcDeleteNotification,
+		write:   true,
+	},
+	"Subscribe": {
+		request: func() proto.Message { return &clairpb.SubscribeRequest{} },
+		call:    grpcSubscribe,
+	},
+	"Ack": {
+		request: func() proto.Message { return &clairpb.AckRequest{} },
+		call:    grpcAck,
+	},
+	"Nack": {
+		request: func() proto.Message { return &clairpb.NackRequest{} },
+		call:    grpcNack,
+	},
+}
+
+var grpcHealthMethods = map[string]grpcMethod{
+	"Check": {
+		request: func() proto.Message { return &clairpb.HealthCheckRequest{} },
+		call:    grpcHealthCheck,
+	},
+}
+
+// NewGRPCHandler creates an HTTP handler serving the gRPC API. It must be served over HTTP/2.
+func NewGRPCHandler(ctx *context.RouteContext) http.Handler {
+	router := httprouter.New()
+	router.POST(grpcServicePath+":method", context.HTTPHandler(serveGRPC("v2/grpc/", grpcMethods), ctx))
+	router.POST(grpcHealthServicePath+":method", context.HTTPHandler(serveGRPC("v2/grpc/health/", grpcHealthMethods), ctx))
+	return router
+}
+
+// serveGRPC returns a handler of the calls to the given methods of a service, whose routes have
+// the given prefix. The returned status is the HTTP equivalent of the status of the call, so that
+// the metrics of both APIs read the same.
+func serveGRPC(routePrefix string, methods map[string]grpcMethod) context.Handler {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+		name := p.ByName("method")
+		route := routePrefix + name
+
+		if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), grpcContentType) {
+			writeError(w, r, http.StatusUnsupportedMediaType, errors.New("gRPC calls must be made over HTTP/2 with the "+grpcContentType+" content type"))
+			return route, http.StatusUnsupportedMediaType
+		}
+
+		w.Header().Set("Content-Type", grpcContentType)
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+		method, ok := methods[name]
+		if !ok {
+			writeGRPCStatus(w, grpcUnimplemented, "unknown method "+name)
+			return "v2/grpc/unknown", http.StatusNotFound
+		}
+
+		if method.write && ctx.Config != nil && ctx.Config.ReadOnly {
+			writeGRPCStatus(w, grpcUnavailable, "clair is in read-only mode")
+			return route, http.StatusServiceUnavailable
+		}
+
+		request := method.request()
+		if err := readGRPCMessage(r.Body, request); err != nil {
+			writeGRPCStatus(w, grpcInvalidArgument, err.Error())
+			return route, http.StatusBadRequest
+		}
+
+		err := method.call(ctx, request, r.Context(), func(response proto.Message) error {
+			return writeGRPCMessage(w, response)
+		})
+		if err != nil {
+			code, status := grpcStatus(err)
+			writeGRPCStatus(w, code, err.Error())
+			return route, status
+		}
+
+		writeGRPCStatus(w, grpcOK, "")
+		return route, http.StatusOK
+	}
+}
+
+// grpcStatus returns the gRPC status code of the error of a call, and its HTTP equivalent.
+func grpcStatus(err error) (int, int) {
+	switch {
+	case err == cerrors.ErrNotFound:
+		return grpcNotFound, http.StatusNotFound
+	case isBadRequest(err):
+		return grpcInvalidArgument, http.StatusBadRequest
+	case err == worker.ErrQueueFull:
+		return grpcResourceExhausted, http.StatusServiceUnavailable
+	case isBudgetExceeded(err):
+		return grpcResourceExhausted, statusUnprocessableEntity
+	case err == notifier.ErrSubscriptionClosed, err == database.ErrMigrationInProgress:
+		return grpcUnavailable, http.StatusServiceUnavailable
+	case err == utils.ErrCouldNotExtract,
+		err == utils.ErrInsecureArchive,
+		err == worker.ErrUnsupported:
+		return grpcInvalidArgument, statusUnprocessableEntity
+	default:
+		return grpcInternal, http.StatusInternalServerError
+	}
+}
+
+// readGRPCMessage decodes the length-prefixed message of a request.
+func readGRPCMessage(r io.Reader, message proto.Message) error {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return errors.New("could not read the request message: " + err.Error())
+	}
+	if prefix[0] != 0 {
+		return errors.New("compressed request messages are not supported")
+	}
+
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if int64(length) > maxBodySize {
+		return fmt.Errorf("the request message is larger than %d bytes", maxBodySize)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return errors.New("could not read the request message: " + err.Error())
+	}
+	return proto.Unmarshal(buf, message)
+}
+
+// writeGRPCMessage writes a length-prefixed response message and flushes it to the client.
+func writeGRPCMessage(w http.ResponseWriter, message proto.Message) error {
+	buf, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(buf)))
+	if _, err := w.Write(append(prefix[:], buf...)); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// writeGRPCStatus sets the trailers holding the status of the call. The message is
+// percent-encoded, as the trailers must be printable ASCII.
+func writeGRPCStatus(w http.ResponseWriter, code int, message string) {
+	var encoded bytes.Buffer
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c >= ' ' && c <= '~' && c != '%' {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", encoded.String())
+}
+
+func grpcPostLayer(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	layer := request.(*clairpb.PostLayerRequest).GetLayer()
+	if layer == nil {
+		return cerrors.NewBadRequestError("failed to provide layer")
+	}
+
+	priority, err := worker.ParsePriority(layer.Priority)
+	if err != nil {
+		return cerrors.NewBadRequestError(err.Error())
+	}
+	if err := validateLabels(layer.Labels); err != nil {
+		return cerrors.NewBadRequestError(err.Error())
+	}
+
+	err = ctx.Queue.Process(rctx, ctx.Store, priority, layer.Format, layer.Name, layer.ParentName, layer.Path, layer.Digest, layer.Headers)
+	if err != nil {
+		return err
+	}
+
+	// Labels are attached to layers that were already indexed as well.
+	if len(layer.Labels) > 0 {
+		if err := ctx.Store.InsertLayerLabels(layer.Name, layer.Labels); err != nil {
+			return err
+		}
+	}
+
+	layer.IndexedByVersion = worker.Version
+	return send(layer)
+}
+
+func grpcGetReport(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	report, err := buildReport(ctx, request.(*clairpb.GetReportRequest).LayerName, nil)
+	if err != nil {
+		return err
+	}
+	return send(report.toProto())
+}
+
+func grpcDeleteLayer(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	if err := ctx.Store.DeleteLayer(request.(*clairpb.DeleteLayerRequest).LayerName); err != nil {
+		return err
+	}
+	return send(&clairpb.Empty{})
+}
+
+func grpcListNamespaces(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	dbNamespaces, err := ctx.Store.ListNamespaces()
+	if err != nil {
+		return err
+	}
+
+	for _, dbNamespace := range dbNamespaces {
+		if err := send(&clairpb.Namespace{Name: dbNamespace.Name, VersionFormat: dbNamespace.VersionFormat}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func grpcListVulnerabilities(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	return ctx.Store.StreamVulnerabilities(request.(*clairpb.ListVulnerabilitiesRequest).NamespaceName, func(dbVuln database.Vulnerability) error {
+		return send(vulnerabilityFromDatabaseModel(dbVuln).toProtoVulnerability())
+	})
+}
+
+func grpcGetVulnerability(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	req := request.(*clairpb.GetVulnerabilityRequest)
+	dbVuln, err := ctx.Store.FindVulnerability(req.NamespaceName, req.VulnerabilityName)
+	if err != nil {
+		return err
+	}
+	return send(vulnerabilityFromDatabaseModel(dbVuln).toProtoVulnerability())
+}
+
+func grpcGetNotification(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	req := request.(*clairpb.GetNotificationRequest)
+
+	limit := defaultLimit
+	if req.Limit < 0 {
+		return cerrors.NewBadRequestError("limit value should be greater than zero")
+	} else if req.Limit > 0 {
+		limit = int(req.Limit)
+	}
+
+	page := database.VulnerabilityNotificationFirstPage
+	if req.Cursor != "" {
+		if err := token.Unmarshal(req.Cursor, ctx.Config.PaginationKey, &page); err != nil {
+			return cerrors.NewBadRequestError("invalid cursor: " + err.Error())
+		}
+	}
+
+	notification, err := findNotification(ctx, req.Name, limit, page)
+	if err != nil {
+		return err
+	}
+	return send(notification.toProtoNotification())
+}
+
+func grpcDeleteNotification(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	if err := ctx.Store.DeleteNotification(request.(*clairpb.DeleteNotificationRequest).Name); err != nil {
+		return err
+	}
+	return send(&clairpb.Empty{})
+}
+
+// grpcHealthCheck serves the standard gRPC health checking protocol. The overall service, named
+// by an empty string, and the Clair service are serving as long as Clair is ready, and the
+// services of the health package, such as "database", as long as they aren't unhealthy.
+func grpcHealthCheck(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	healthCtx, cancel := netcontext.WithTimeout(netcontext.Background(), grpcHealthTimeout)
+	defer cancel()
+
+	report := health.Check(healthCtx, false)
+	state := report.State
+	if service := request.(*clairpb.HealthCheckRequest).Service; service != "" && service != "clairpb.Clair" {
+		status, ok := report.Services[service]
+		if !ok {
+			return cerrors.ErrNotFound
+		}
+		state = status.State
+	}
+
+	response := &clairpb.HealthCheckResponse{Status: clairpb.HealthCheckResponse_SERVING}
+	if state == database.Unhealthy {
+		response.Status = clairpb.HealthCheckResponse_NOT_SERVING
+	}
+	return send(response)
+}
+
+// grpcSubscribe streams the notifications delivered to a consumer group until the client goes
+// away. The consumer gets a notification as soon as it has been sent the previous one, so it may
+// acknowledge several of them concurrently.
+func grpcSubscribe(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	group := request.(*clairpb.SubscribeRequest).Group
+	done := rctx.Done()
+
+	for {
+		dbNotification, key, err := notifier.Receive(group, done)
+		if err != nil {
+			select {
+			case <-done:
+				return nil
+			default:
+				return subscriptionError(err)
+			}
+		}
+
+		delivery := &clairpb.NotificationDelivery{
+			Key:          key,
+			Notification: notificationFromDatabaseModel(dbNotification).toProtoNotification(),
+		}
+		if err := send(delivery); err != nil {
+			// Redeliver the notification to another consumer rather than waiting for its
+			// acknowledgement to time out.
+			notifier.Nack(group, key, "could not send the notification: "+err.Error())
+			return err
+		}
+	}
+}
+
+func grpcAck(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	req := request.(*clairpb.AckRequest)
+	if err := subscriptionError(notifier.Ack(req.Group, req.Key)); err != nil {
+		return err
+	}
+	return send(&clairpb.Empty{})
+}
+
+func grpcNack(ctx *context.RouteContext, request proto.Message, rctx netcontext.Context, send func(proto.Message) error) error {
+	req := request.(*clairpb.NackRequest)
+	if err := subscriptionError(notifier.Nack(req.Group, req.Key, req.Reason)); err != nil {
+		return err
+	}
+	return send(&clairpb.Empty{})
+}
+
+// subscriptionError returns the error of a call to a consumer group.
+func subscriptionError(err error) error {
+	if err == notifier.ErrUnknownGroup {
+		return cerrors.NewBadRequestError(err.Error())
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	netcontext "golang.org/x/net/context"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/api/v2/clairpb"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/health"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestGRPC(t *testing.T) {
+	namespace := database.Namespace{Name: "debian:8", VersionFormat: "dpkg"}
+	vulnerabilities := []database.Vulnerability{
+		{Name: "CVE-2016-0001", Namespace: namespace, Severity: types.High},
+		{Name: "CVE-2016-0002", Namespace: namespace, Severity: types.Low},
+	}
+	datastore := &database.MockDatastore{
+		FctStreamVulnerabilities: func(namespaceName string, fn func(database.Vulnerability) error) error {
+			if namespaceName != namespace.Name {
+				return cerrors.ErrNotFound
+			}
+			for _, vulnerability := range vulnerabilities {
+				if err := fn(vulnerability); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		FctFindVulnerability: func(namespaceName, name string) (database.Vulnerability, error) {
+			for _, vulnerability := range vulnerabilities {
+				if vulnerability.Namespace.Name == namespaceName && vulnerability.Name == name {
+					return vulnerability, nil
+				}
+			}
+			return database.Vulnerability{}, cerrors.ErrNotFound
+		},
+		FctDeleteLayer: func(name string) error {
+			return nil
+		},
+	}
+	config := &config.APIConfig{}
+	handler := NewGRPCHandler(&context.RouteContext{Store: datastore, Config: config})
+
+	call := func(method string, request proto.Message) (*http.Response, []byte) {
+		message := httptest.NewRecorder()
+		assert.Nil(t, writeGRPCMessage(message, request))
+
+		r, _ := http.NewRequest("POST", grpcServicePath+method, message.Body)
+		r.ProtoMajor, r.ProtoMinor = 2, 0
+		r.Header.Set("Content-Type", grpcContentType+"+proto")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Result(), w.Body.Bytes()
+	}
+
+	// The streaming calls send a message per vulnerability.
+	res, body := call("ListVulnerabilities", &clairpb.ListVulnerabilitiesRequest{NamespaceName: "debian:8"})
+	assert.Equal(t, grpcContentType, res.Header.Get("Content-Type"))
+	assert.Equal(t, "0", res.Trailer.Get("Grpc-Status"))
+	var names []string
+	for len(body) >= 5 {
+		length := int(body[1])<<24 | int(body[2])<<16 | int(body[3])<<8 | int(body[4])
+		var vuln clairpb.Vulnerability
+		if assert.Nil(t, proto.Unmarshal(body[5:5+length], &vuln)) {
+			names = append(names, vuln.Name)
+		}
+		body = body[5+length:]
+	}
+	assert.Equal(t, []string{"CVE-2016-0001", "CVE-2016-0002"}, names)
+
+	res, body = call("GetVulnerability", &clairpb.GetVulnerabilityRequest{NamespaceName: "debian:8", VulnerabilityName: "CVE-2016-0002"})
+	var vuln clairpb.Vulnerability
+	if assert.Equal(t, "0", res.Trailer.Get("Grpc-Status")) && assert.Nil(t, proto.Unmarshal(body[5:], &vuln)) {
+		assert.Equal(t, "Low", vuln.Severity)
+	}
+
+	// The errors are statuses.
+	res, body = call("GetVulnerability", &clairpb.GetVulnerabilityRequest{NamespaceName: "debian:8", VulnerabilityName: "CVE-2016-0003"})
+	assert.Equal(t, "5", res.Trailer.Get("Grpc-Status"))
+	assert.Equal(t, "the resource cannot be found", res.Trailer.Get("Grpc-Message"))
+	assert.Empty(t, body)
+
+	res, _ = call("PostVulnerability", &clairpb.Empty{})
+	assert.Equal(t, "12", res.Trailer.Get("Grpc-Status"))
+
+	res, _ = call("DeleteLayer", &clairpb.DeleteLayerRequest{LayerName: "layer"})
+	assert.Equal(t, "0", res.Trailer.Get("Grpc-Status"))
+	config.ReadOnly = true
+	res, _ = call("DeleteLayer", &clairpb.DeleteLayerRequest{LayerName: "layer"})
+	assert.Equal(t, "14", res.Trailer.Get("Grpc-Status"))
+
+	// Consumers subscribe to the configured consumer groups.
+	res, _ = call("Subscribe", &clairpb.SubscribeRequest{Group: "unknown"})
+	assert.Equal(t, "3", res.Trailer.Get("Grpc-Status"))
+	res, _ = call("Ack", &clairpb.AckRequest{Group: "unknown", Key: "key"})
+	assert.Equal(t, "3", res.Trailer.Get("Grpc-Status"))
+
+	// The health of Clair and of its services is served by the standard health service.
+	health.Register("database", func(netcontext.Context) health.Status {
+		return health.Status{State: database.Unhealthy, Reason: health.ReasonUnreachable}
+	}, true)
+	defer health.Unregister("database")
+	checkHealth := func(service string) (string, clairpb.HealthCheckResponse_ServingStatus) {
+		message := httptest.NewRecorder()
+		assert.Nil(t, writeGRPCMessage(message, &clairpb.HealthCheckRequest{Service: service}))
+		r, _ := http.NewRequest("POST", grpcHealthServicePath+"Check", message.Body)
+		r.ProtoMajor, r.ProtoMinor = 2, 0
+		r.Header.Set("Content-Type", grpcContentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		var response clairpb.HealthCheckResponse
+		if body := w.Body.Bytes(); len(body) > 5 {
+			assert.Nil(t, proto.Unmarshal(body[5:], &response))
+		}
+		return w.Result().Trailer.Get("Grpc-Status"), response.Status
+	}
+	code, status := checkHealth("")
+	assert.Equal(t, "0", code)
+	assert.Equal(t, clairpb.HealthCheckResponse_NOT_SERVING, status)
+	_, status = checkHealth("database")
+	assert.Equal(t, clairpb.HealthCheckResponse_NOT_SERVING, status)
+	code, _ = checkHealth("unknown")
+	assert.Equal(t, "5", code)
+
+	// The calls require HTTP/2.
+	r, _ := http.NewRequest("POST", grpcServicePath+"GetVulnerability", nil)
+	r.Header.Set("Content-Type", grpcContentType)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
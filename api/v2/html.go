@@ -0,0 +1,264 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/registry"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+const htmlContentType = "text/html;charset=utf-8"
+
+// An htmlReport is the data the HTML report of an image is rendered with.
+type htmlReport struct {
+	Image     string
+	Report    Report
+	Generated time.Time
+	Summary   []htmlSeverityCount
+	// FalsePositives is the number of findings flagged as false positives, which aren't counted
+	// in the Summary.
+	FalsePositives int
+	Findings       []exportRow
+
+	// Header and Footer are the branding of the reports, as configured.
+	Header template.HTML
+	Footer template.HTML
+}
+
+// An htmlSeverityCount is the number of findings of a severity.
+type htmlSeverityCount struct {
+	Severity string
+	Count    int
+}
+
+func getImageHTMLReport(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	html, status, err := renderImageReport(ctx, p.ByName("name"))
+	if err != nil {
+		writeHTMLError(w, status, err)
+		return getImageHTMLReportRoute, status
+	}
+
+	w.Header().Set("Content-Type", htmlContentType)
+	w.Header().Set("Server", "clair")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(html); err != nil {
+		log.Warningf("failed to write response: %s", err.Error())
+	}
+	return getImageHTMLReportRoute, http.StatusOK
+}
+
+// renderImageReport renders the HTML report of the image of the watch of the given name, or of
+// the layer of the given name if there is no such watch. It returns the status of the error, if
+// any.
+func renderImageReport(ctx *context.RouteContext, name string) ([]byte, int, error) {
+	layerName, image := name, ""
+	var watchedTag *database.WatchedTag
+	dbWatchedTag, err := ctx.Store.FindWatchedTag(name)
+	switch {
+	case err == nil && dbWatchedTag.LayerName == "":
+		return nil, http.StatusNotFound, errors.New("the tag has not been indexed yet")
+	case err == nil:
+		watchedTag = &dbWatchedTag
+		layerName = dbWatchedTag.LayerName
+		image = registry.ImageName(dbWatchedTag.Registry, dbWatchedTag.Repository) + ":" + dbWatchedTag.Tag
+	case err != cerrors.ErrNotFound:
+		return nil, http.StatusInternalServerError, err
+	}
+
+	report, err := buildReport(ctx, layerName, watchedTag)
+	if err == cerrors.ErrNotFound {
+		return nil, http.StatusNotFound, errors.New("the image could not be found")
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if image == "" {
+		image = report.LayerName
+	}
+
+	data := htmlReport{
+		Image:     image,
+		Report:    report,
+		Generated: time.Now().UTC(),
+		Findings:  reportRows(report, image),
+	}
+	if ctx.Config != nil && ctx.Config.Reports != nil {
+		data.Header = template.HTML(ctx.Config.Reports.Header)
+		data.Footer = template.HTML(ctx.Config.Reports.Footer)
+	}
+	sort.Stable(findingsBySeverity(data.Findings))
+
+	counts := make(map[string]int)
+	for _, finding := range data.Findings {
+		if finding.Vulnerability.FalsePositive != nil {
+			data.FalsePositives++
+			continue
+		}
+		counts[finding.Vulnerability.Severity]++
+	}
+	for i := len(types.Priorities) - 1; i >= 0; i-- {
+		severity := string(types.Priorities[i])
+		data.Summary = append(data.Summary, htmlSeverityCount{Severity: severity, Count: counts[severity]})
+	}
+
+	var buf bytes.Buffer
+	if err := htmlReportTemplate.Execute(&buf, data); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return buf.Bytes(), http.StatusOK, nil
+}
+
+// writeHTMLError writes an error as a plain text response, which browsers display as is.
+func writeHTMLError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "text/plain;charset=utf-8")
+	w.Header().Set("Server", "clair")
+	w.WriteHeader(status)
+	w.Write([]byte(err.Error() + "\n"))
+}
+
+// findingsBySeverity sorts findings from the highest severity to the lowest.
+type findingsBySeverity []exportRow
+
+func (s findingsBySeverity) Len() int      { return len(s) }
+func (s findingsBySeverity) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s findingsBySeverity) Less(i, j int) bool {
+	return types.Priority(s[i].Vulnerability.Severity).Compare(types.Priority(s[j].Vulnerability.Severity)) > 0
+}
+
+// severityRank returns the rank of a severity, which the table of the report is sorted by.
+func severityRank(severity string) int {
+	return types.Priority(severity).Compare(types.Unknown)
+}
+
+// htmlReportTemplate renders a self-contained report, i.e. without external stylesheets or
+// scripts, so that it can be emailed and archived.
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"rank": severityRank,
+	"date": func(t time.Time) string { return t.Format(time.RFC1123) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Vulnerability report of {{.Image}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; word-break: break-all; }
+dl { display: grid; grid-template-columns: max-content auto; gap: .25em 1em; }
+dt { font-weight: bold; }
+dd { margin: 0; word-break: break-all; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: .4em .6em; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+table.findings th { cursor: pointer; }
+tr.falsepositive td { color: #888; text-decoration: line-through; }
+tr.falsepositive td.annotation { text-decoration: none; }
+.Defcon1, .Critical { color: #b00020; font-weight: bold; }
+.High { color: #d35400; font-weight: bold; }
+.Medium { color: #b7950b; }
+header.branding { border-bottom: 1px solid #ccc; padding-bottom: 1em; margin-bottom: 1em; }
+footer.branding { border-top: 1px solid #ccc; padding-top: 1em; margin-top: 2em; font-size: .9em; color: #555; }
+@media print { table.findings th { cursor: auto; } tr { page-break-inside: avoid; } }
+</style>
+</head>
+<body>
+{{- with .Header}}
+<header class="branding">{{.}}</header>
+{{- end}}
+<h1>Vulnerability report of {{.Image}}</h1>
+<dl>
+<dt>Layer</dt><dd>{{.Report.LayerName}}</dd>
+{{- with .Report.Owners}}
+<dt>Owners</dt><dd>{{range $i, $owner := .}}{{if $i}}, {{end}}{{$owner}}{{end}}</dd>
+{{- end}}
+{{- with .Report.Signature}}
+<dt>Signature</dt><dd>{{.}}</dd>
+{{- end}}
+<dt>Generated</dt><dd>{{date .Generated}}</dd>
+</dl>
+
+<h2>Summary</h2>
+<table class="summary">
+<tr><th>Severity</th><th>Findings</th></tr>
+{{- range .Summary}}
+<tr><td class="{{.Severity}}">{{.Severity}}</td><td>{{.Count}}</td></tr>
+{{- end}}
+<tr><td>False positives</td><td>{{.FalsePositives}}</td></tr>
+</table>
+
+<h2>Findings</h2>
+{{- if .Findings}}
+<table class="findings" id="findings">
+<thead>
+<tr><th>Severity</th><th>Vulnerability</th><th>Feature</th><th>Version</th><th>Fixed by</th><th>Annotation</th></tr>
+</thead>
+<tbody>
+{{- range .Findings}}
+<tr{{if .Vulnerability.FalsePositive}} class="falsepositive"{{end}}>
+<td class="{{.Vulnerability.Severity}}" data-sort="{{rank .Vulnerability.Severity}}">{{.Vulnerability.Severity}}</td>
+<td>{{if .Vulnerability.Link}}<a href="{{.Vulnerability.Link}}">{{.Vulnerability.Name}}</a>{{else}}{{.Vulnerability.Name}}{{end}}</td>
+<td>{{.Feature.Name}}</td>
+<td>{{.Feature.Version}}</td>
+<td>{{.Vulnerability.FixedBy}}</td>
+<td class="annotation">{{with .Vulnerability.FalsePositive}}False positive{{with .Reason}}: {{.}}{{end}}{{end}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+(function() {
+  var table = document.getElementById("findings");
+  var headers = table.tHead.rows[0].cells;
+  for (var i = 0; i < headers.length; i++) {
+    headers[i].addEventListener("click", sortBy.bind(null, i));
+  }
+  var sorted = {column: 0, ascending: false};
+  function key(row, column) {
+    var cell = row.cells[column];
+    var value = cell.getAttribute("data-sort");
+    return value !== null ? Number(value) : cell.textContent.toLowerCase();
+  }
+  function sortBy(column) {
+    var ascending = sorted.column === column ? !sorted.ascending : true;
+    var body = table.tBodies[0];
+    var rows = Array.prototype.slice.call(body.rows);
+    rows.sort(function(a, b) {
+      var x = key(a, column), y = key(b, column);
+      return (x < y ? -1 : x > y ? 1 : 0) * (ascending ? 1 : -1);
+    });
+    rows.forEach(function(row) { body.appendChild(row); });
+    sorted = {column: column, ascending: ascending};
+  }
+})();
+</script>
+{{- else}}
+<p>No vulnerability affects the image.</p>
+{{- end}}
+{{- with .Footer}}
+<footer class="branding">{{.}}</footer>
+{{- end}}
+</body>
+</html>
+`))
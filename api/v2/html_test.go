@@ -0,0 +1,91 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestImageHTMLReport(t *testing.T) {
+	namespace := database.Namespace{Name: "debian:8"}
+	low := database.Vulnerability{Name: "CVE-2016-0001", Namespace: namespace, Severity: types.Low}
+	critical := database.Vulnerability{Name: "CVE-2016-0002", Namespace: namespace, Severity: types.Critical, Link: "https://example.com/<CVE-2016-0002>"}
+	high := database.Vulnerability{Name: "CVE-2016-0003", Namespace: namespace, Severity: types.High}
+	datastore := &database.MockDatastore{
+		FctFindWatchedTag: func(name string) (database.WatchedTag, error) {
+			if name != "app" {
+				return database.WatchedTag{}, cerrors.ErrNotFound
+			}
+			return database.WatchedTag{Name: name, Registry: "https://registry.example.com", Repository: "team/app", Tag: "latest", LayerName: "layer"}, nil
+		},
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			if name != "layer" {
+				return database.Layer{}, cerrors.ErrNotFound
+			}
+			return database.Layer{Name: name, Features: []database.FeatureVersion{
+				{Feature: database.Feature{Name: "openssl", Namespace: namespace}, Version: "1.0.1", AffectedBy: []database.Vulnerability{low, critical, high}},
+			}}, nil
+		},
+		FctFindFalsePositives: func([]database.Vulnerability) ([]database.FalsePositive, error) {
+			return []database.FalsePositive{{Namespace: namespace, VulnerabilityName: high.Name, FeatureName: "openssl", FeatureVersion: "1.0.1", Reason: "not reachable"}}, nil
+		},
+		FctFindProvenances: func(digest string) ([]database.Provenance, error) {
+			return nil, nil
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{}}
+
+	r, _ := http.NewRequest("GET", "/images/app/report.html", nil)
+	w := httptest.NewRecorder()
+	getImageHTMLReport(w, r, httprouter.Params{{Key: "name", Value: "app"}}, ctx)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, htmlContentType, w.Header().Get("Content-Type"))
+		body := w.Body.String()
+		assert.Contains(t, body, "<title>Vulnerability report of registry.example.com/team/app:latest</title>")
+		assert.Contains(t, body, `<tr><td class="Critical">Critical</td><td>1</td></tr>`)
+		assert.Contains(t, body, `<tr><td class="High">High</td><td>0</td></tr>`)
+		assert.Contains(t, body, `<tr><td>False positives</td><td>1</td></tr>`)
+		assert.Contains(t, body, `<a href="https://example.com/%3cCVE-2016-0002%3e">CVE-2016-0002</a>`)
+		assert.Contains(t, body, `<td class="annotation">False positive: not reachable</td>`)
+
+		// Findings are sorted from the highest severity to the lowest.
+		assert.True(t, strings.Index(body, "CVE-2016-0002") < strings.Index(body, "CVE-2016-0003"))
+		assert.True(t, strings.Index(body, "CVE-2016-0003") < strings.Index(body, "CVE-2016-0001"))
+	}
+
+	// Layers can be reported on by name, and unknown images aren't found.
+	r, _ = http.NewRequest("GET", "/images/layer/report.html", nil)
+	w = httptest.NewRecorder()
+	getImageHTMLReport(w, r, httprouter.Params{{Key: "name", Value: "layer"}}, ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<title>Vulnerability report of layer</title>")
+
+	r, _ = http.NewRequest("GET", "/images/unknown/report.html", nil)
+	w = httptest.NewRecorder()
+	getImageHTMLReport(w, r, httprouter.Params{{Key: "name", Value: "unknown"}}, ctx)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
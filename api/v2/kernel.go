@@ -0,0 +1,49 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"strings"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/ext/versionfmt/rpm"
+)
+
+// notKernelPackages are the packages of the distributions that are named like the kernel but
+// are user space software.
+var notKernelPackages = map[string]struct{}{
+	"linux-atm":  {},
+	"linux-base": {},
+	"linux-pam":  {},
+}
+
+// isKernel returns whether a feature is a package of the kernel of a distribution, e.g. the
+// "linux" source package of Debian or the "kernel-headers" package of CentOS. Containers run on
+// the kernel of their host, so the vulnerabilities of these packages don't affect them.
+func isKernel(dbFeatureVersion database.FeatureVersion) bool {
+	name := dbFeatureVersion.Feature.Name
+	switch dbFeatureVersion.Feature.Namespace.VersionFormat {
+	case dpkg.ParserName:
+		if _, ok := notKernelPackages[name]; ok {
+			return false
+		}
+		return name == "linux" || strings.HasPrefix(name, "linux-")
+	case rpm.ParserName:
+		return name == "kernel" || strings.HasPrefix(name, "kernel-")
+	default:
+		return false
+	}
+}
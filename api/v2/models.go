@@ -0,0 +1,941 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/coreos/clair/api/v2/clairpb"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ownership"
+	"github.com/coreos/clair/registry"
+	"github.com/coreos/clair/remediation"
+	"github.com/coreos/clair/utils/types"
+)
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "v2")
+
+// Error is the body of every unsuccessful response.
+type Error struct {
+	Message string `json:"Message"`
+
+	// ExceededBudget is the resource, e.g. "time", whose budget the analysis of a layer exceeded.
+	ExceededBudget string `json:"ExceededBudget,omitempty"`
+}
+
+// Layer is the resource representing an indexed layer.
+type Layer struct {
+	Name             string            `json:"Name"`
+	ParentName       string            `json:"ParentName,omitempty"`
+	NamespaceName    string            `json:"NamespaceName,omitempty"`
+	Path             string            `json:"Path,omitempty"`
+	Digest           string            `json:"Digest,omitempty"`
+	Headers          map[string]string `json:"Headers,omitempty"`
+	Format           string            `json:"Format,omitempty"`
+	UploadName       string            `json:"UploadName,omitempty"`
+	Priority         string            `json:"Priority,omitempty"`
+	Labels           map[string]string `json:"Labels,omitempty"`
+	IndexedByVersion int               `json:"IndexedByVersion"`
+	Stats            *LayerStats       `json:"Stats,omitempty"`
+}
+
+// LayerPage is a page of the layers having the requested labels.
+type LayerPage struct {
+	Layers     []Layer `json:"Layers"`
+	NextCursor string  `json:"NextCursor,omitempty"`
+}
+
+func layerFromDatabaseModel(dbLayer database.Layer) Layer {
+	layer := Layer{
+		Name:             dbLayer.Name,
+		Labels:           dbLayer.Labels,
+		IndexedByVersion: dbLayer.EngineVersion,
+		Stats:            layerStatsFromDatabaseModel(dbLayer.Stats),
+	}
+	if dbLayer.Parent != nil {
+		layer.ParentName = dbLayer.Parent.Name
+	}
+	if dbLayer.Namespace != nil {
+		layer.NamespaceName = dbLayer.Namespace.Name
+	}
+	return layer
+}
+
+// LayerStats is what the analysis of a layer processed, and how long it took, in seconds.
+type LayerStats struct {
+	BytesRead        int64              `json:"BytesRead"`
+	FilesInspected   int                `json:"FilesInspected"`
+	FilesMatched     int                `json:"FilesMatched"`
+	BytesMatched     int64              `json:"BytesMatched"`
+	Seconds          float64            `json:"Seconds"`
+	DetectorsSeconds map[string]float64 `json:"DetectorsSeconds,omitempty"`
+}
+
+// layerStatsFromDatabaseModel returns the statistics of the analysis of a layer, or nil if they
+// weren't recorded, e.g. for the layers analyzed before they were.
+func layerStatsFromDatabaseModel(dbStats database.LayerStats) *LayerStats {
+	if dbStats.Duration == 0 {
+		return nil
+	}
+
+	stats := &LayerStats{
+		BytesRead:      dbStats.BytesRead,
+		FilesInspected: dbStats.FilesInspected,
+		FilesMatched:   dbStats.FilesMatched,
+		BytesMatched:   dbStats.BytesMatched,
+		Seconds:        dbStats.Duration.Seconds(),
+	}
+	if len(dbStats.Detectors) > 0 {
+		stats.DetectorsSeconds = make(map[string]float64, len(dbStats.Detectors))
+		for name, duration := range dbStats.Detectors {
+			stats.DetectorsSeconds[name] = duration.Seconds()
+		}
+	}
+	return stats
+}
+
+// Upload is the resource representing a layer tarball being uploaded in chunks; Offset is the
+// number of bytes received so far.
+type Upload struct {
+	Name   string `json:"Name"`
+	Offset int64  `json:"Offset"`
+}
+
+// Report is the resource listing the features of a layer, including the ones inherited from its
+// parents, and the vulnerabilities affecting them along with the explanation of each match.
+//
+// Features are sorted by name and version, and vulnerabilities by name, so identical layers yield
+// identical reports.
+//
+// The reports of the images of watched tags carry the status of the verification of their
+// Signature, if any, their Owners, if the ownership service is enabled, and their Provenances.
+type Report struct {
+	LayerName   string       `json:"LayerName"`
+	Signature   string       `json:"Signature,omitempty"`
+	Owners      []string     `json:"Owners,omitempty"`
+	Provenances []Provenance `json:"Provenances,omitempty"`
+	BaseImage   *BaseImage   `json:"BaseImage,omitempty"`
+	Features    []Feature    `json:"Features"`
+}
+
+func reportFromDatabaseModel(dbLayer database.Layer, dbFalsePositives []database.FalsePositive, excludeFalsePositives, excludeKernelVulnerabilities bool) Report {
+	falsePositives := make(map[falsePositiveKey]database.FalsePositive)
+	for _, dbFalsePositive := range dbFalsePositives {
+		falsePositives[falsePositiveKey{
+			namespaceName:     dbFalsePositive.Namespace.Name,
+			vulnerabilityName: dbFalsePositive.VulnerabilityName,
+			featureName:       dbFalsePositive.FeatureName,
+			featureVersion:    dbFalsePositive.FeatureVersion,
+		}] = dbFalsePositive
+	}
+
+	report := Report{LayerName: dbLayer.Name, Features: []Feature{}}
+	for _, dbFeatureVersion := range dbLayer.Features {
+		feature := featureFromDatabaseModel(dbFeatureVersion)
+		feature.Kernel = isKernel(dbFeatureVersion)
+		dbVulns := dbFeatureVersion.AffectedBy
+		if feature.Kernel && excludeKernelVulnerabilities {
+			dbVulns = nil
+		}
+		for _, dbVuln := range dbVulns {
+			vuln := vulnerabilityFromDatabaseModel(dbVuln)
+			if dbVuln.FixedBy != versionfmt.MaxVersion {
+				vuln.FixedBy = dbVuln.FixedBy
+				vuln.Remediation = remediation.Command(dbFeatureVersion.Feature.Namespace.Name, dbFeatureVersion.Feature.Name, dbVuln.FixedBy)
+			}
+			vuln.Explanation = explanationFromDatabaseModel(dbFeatureVersion, dbVuln)
+
+			dbFalsePositive, flagged := falsePositives[falsePositiveKey{
+				namespaceName:     dbVuln.Namespace.Name,
+				vulnerabilityName: dbVuln.Name,
+				featureName:       dbFeatureVersion.Feature.Name,
+				featureVersion:    dbFeatureVersion.Version,
+			}]
+			if flagged {
+				if excludeFalsePositives {
+					continue
+				}
+				falsePositive := falsePositiveFromDatabaseModel(dbFalsePositive)
+				vuln.FalsePositive = &falsePositive
+			}
+
+			feature.Vulnerabilities = append(feature.Vulnerabilities, vuln)
+		}
+		sort.Sort(vulnerabilitiesByName(feature.Vulnerabilities))
+		report.Features = append(report.Features, feature)
+	}
+	sort.Sort(featuresByNameAndVersion(report.Features))
+	return report
+}
+
+// falsePositiveKey identifies a finding: a vulnerability affecting a version of a feature.
+type falsePositiveKey struct {
+	namespaceName, vulnerabilityName, featureName, featureVersion string
+}
+
+type featuresByNameAndVersion []Feature
+
+func (s featuresByNameAndVersion) Len() int      { return len(s) }
+func (s featuresByNameAndVersion) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s featuresByNameAndVersion) Less(i, j int) bool {
+	if s[i].Name != s[j].Name {
+		return s[i].Name < s[j].Name
+	}
+	if s[i].Version != s[j].Version {
+		return s[i].Version < s[j].Version
+	}
+	return s[i].NamespaceName < s[j].NamespaceName
+}
+
+type vulnerabilitiesByName []Vulnerability
+
+func (s vulnerabilitiesByName) Len() int           { return len(s) }
+func (s vulnerabilitiesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s vulnerabilitiesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// Explanation details how a vulnerability was matched to a feature of a layer, so users can
+// reproduce, and dispute, the finding.
+type Explanation struct {
+	// Detector is the features detector that found the feature.
+	Detector string `json:"Detector,omitempty"`
+	// Feeds are the names of the sources that assert the vulnerability.
+	Feeds []string `json:"Feeds,omitempty"`
+	// VersionFormat is the format according to which the versions have been compared.
+	VersionFormat string `json:"VersionFormat"`
+	// Comparison is the comparison that matched, e.g. "1.0-1 < 1.0-2", or states that no version
+	// fixes the vulnerability.
+	Comparison string `json:"Comparison"`
+}
+
+func explanationFromDatabaseModel(dbFeatureVersion database.FeatureVersion, dbVuln database.Vulnerability) *Explanation {
+	explanation := &Explanation{
+		Detector:      dbFeatureVersion.DetectedBy,
+		VersionFormat: dbFeatureVersion.Feature.Namespace.VersionFormat,
+	}
+	for _, dbSource := range dbVuln.Sources {
+		explanation.Feeds = append(explanation.Feeds, dbSource.Name)
+	}
+	if dbVuln.FixedBy == versionfmt.MaxVersion {
+		explanation.Comparison = dbFeatureVersion.Version + " is affected: no version fixes the vulnerability"
+	} else {
+		explanation.Comparison = dbFeatureVersion.Version + " < " + dbVuln.FixedBy
+	}
+	return explanation
+}
+
+func (report Report) toProto() proto.Message {
+	pb := &clairpb.Report{LayerName: report.LayerName, Signature: report.Signature, Owners: report.Owners}
+	for _, provenance := range report.Provenances {
+		pb.Provenances = append(pb.Provenances, provenance.toProto())
+	}
+	for _, feature := range report.Features {
+		pb.Features = append(pb.Features, feature.toProto())
+	}
+	return pb
+}
+
+// The Evidence of a Feature tells whether any of the executables and libraries its package
+// installed is still in the image; it is empty when they are unknown.
+const (
+	evidencePresent = "present"
+	evidenceMissing = "missing"
+)
+
+type Feature struct {
+	Name            string          `json:"Name"`
+	NamespaceName   string          `json:"NamespaceName"`
+	VersionFormat   string          `json:"VersionFormat,omitempty"`
+	Version         string          `json:"Version"`
+	AddedBy         string          `json:"AddedBy,omitempty"`
+	State           string          `json:"State,omitempty"`
+	Kernel          bool            `json:"Kernel,omitempty"`
+	Evidence        string          `json:"Evidence,omitempty"`
+	Remediation     string          `json:"Remediation,omitempty"`
+	Vulnerabilities []Vulnerability `json:"Vulnerabilities,omitempty"`
+}
+
+func featureFromDatabaseModel(dbFeatureVersion database.FeatureVersion) Feature {
+	version := dbFeatureVersion.Version
+	if version == versionfmt.MaxVersion {
+		version = "None"
+	}
+
+	feature := Feature{
+		Name:          dbFeatureVersion.Feature.Name,
+		NamespaceName: dbFeatureVersion.Feature.Namespace.Name,
+		VersionFormat: dbFeatureVersion.Feature.Namespace.VersionFormat,
+		Version:       version,
+		AddedBy:       dbFeatureVersion.AddedBy.Name,
+		State:         dbFeatureVersion.State,
+	}
+	if len(dbFeatureVersion.Evidence) > 0 {
+		feature.Evidence = evidencePresent
+	} else if dbFeatureVersion.Evidence != nil {
+		feature.Evidence = evidenceMissing
+	}
+	return feature
+}
+
+// databaseModel returns the fix described by the feature, whose version is validated against its
+// format. "None" means that no version fixes the vulnerability.
+func (feature Feature) databaseModel() (database.FeatureVersion, error) {
+	version := versionfmt.MaxVersion
+	if feature.Version != "None" {
+		if err := versionfmt.Valid(feature.VersionFormat, feature.Version); err != nil {
+			return database.FeatureVersion{}, err
+		}
+		version = feature.Version
+	}
+
+	return database.FeatureVersion{
+		Feature: database.Feature{
+			Name: feature.Name,
+			Namespace: database.Namespace{
+				Name:          feature.NamespaceName,
+				VersionFormat: feature.VersionFormat,
+			},
+		},
+		Version: version,
+	}, nil
+}
+
+func (feature Feature) toProto() *clairpb.Feature {
+	pb := &clairpb.Feature{
+		Name:          feature.Name,
+		NamespaceName: feature.NamespaceName,
+		VersionFormat: feature.VersionFormat,
+		Version:       feature.Version,
+		AddedBy:       feature.AddedBy,
+		State:         feature.State,
+		Kernel:        feature.Kernel,
+		Evidence:      feature.Evidence,
+	}
+	for _, vuln := range feature.Vulnerabilities {
+		pb.Vulnerabilities = append(pb.Vulnerabilities, vuln.toProtoVulnerability())
+	}
+	return pb
+}
+
+type Vulnerability struct {
+	Name          string                 `json:"Name"`
+	NamespaceName string                 `json:"NamespaceName"`
+	Description   string                 `json:"Description,omitempty"`
+	Link          string                 `json:"Link,omitempty"`
+	Severity      string                 `json:"Severity"`
+	Metadata      map[string]interface{} `json:"Metadata,omitempty"`
+	Sources       []VulnerabilitySource  `json:"Sources,omitempty"`
+	CVSS          *VulnerabilityCVSS     `json:"CVSS,omitempty"`
+	FixedBy       string                 `json:"FixedBy,omitempty"`
+	Remediation   string                 `json:"Remediation,omitempty"`
+	FixedIn       []Feature              `json:"FixedIn,omitempty"`
+	Explanation   *Explanation           `json:"Explanation,omitempty"`
+	FalsePositive *FalsePositive         `json:"FalsePositive,omitempty"`
+}
+
+type VulnerabilitySource struct {
+	Name    string `json:"Name"`
+	URL     string `json:"URL,omitempty"`
+	License string `json:"License,omitempty"`
+}
+
+// VulnerabilityCVSS holds the CVSS v2 and v3 vectors and base scores of a vulnerability, which are
+// finer than its severity.
+type VulnerabilityCVSS struct {
+	V2 *CVSS `json:"V2,omitempty"`
+	V3 *CVSS `json:"V3,omitempty"`
+}
+
+type CVSS struct {
+	Vector string  `json:"Vector"`
+	Score  float64 `json:"Score"`
+}
+
+func vulnerabilityCVSSFromDatabaseModel(dbCVSS database.VulnerabilityCVSS) *VulnerabilityCVSS {
+	if dbCVSS.V2 == nil && dbCVSS.V3 == nil {
+		return nil
+	}
+
+	var cvss VulnerabilityCVSS
+	if dbCVSS.V2 != nil {
+		cvss.V2 = &CVSS{Vector: dbCVSS.V2.Vector, Score: dbCVSS.V2.Score}
+	}
+	if dbCVSS.V3 != nil {
+		cvss.V3 = &CVSS{Vector: dbCVSS.V3.Vector, Score: dbCVSS.V3.Score}
+	}
+	return &cvss
+}
+
+func (cvss *VulnerabilityCVSS) databaseModel() database.VulnerabilityCVSS {
+	var dbCVSS database.VulnerabilityCVSS
+	if cvss == nil {
+		return dbCVSS
+	}
+	if cvss.V2 != nil {
+		dbCVSS.V2 = &types.CVSS{Vector: cvss.V2.Vector, Score: cvss.V2.Score}
+	}
+	if cvss.V3 != nil {
+		dbCVSS.V3 = &types.CVSS{Vector: cvss.V3.Vector, Score: cvss.V3.Score}
+	}
+	return dbCVSS
+}
+
+// latest returns the CVSS of the most recent version of the specification that describes the
+// vulnerability, if any.
+func (cvss *VulnerabilityCVSS) latest() *CVSS {
+	switch {
+	case cvss == nil:
+		return nil
+	case cvss.V3 != nil:
+		return cvss.V3
+	default:
+		return cvss.V2
+	}
+}
+
+func (cvss *CVSS) toProto() *clairpb.CVSS {
+	if cvss == nil {
+		return nil
+	}
+	return &clairpb.CVSS{Vector: cvss.Vector, Score: cvss.Score}
+}
+
+func vulnerabilityFromDatabaseModel(dbVuln database.Vulnerability) Vulnerability {
+	vuln := Vulnerability{
+		Name:          dbVuln.Name,
+		NamespaceName: dbVuln.Namespace.Name,
+		Description:   dbVuln.Description,
+		Link:          dbVuln.Link,
+		Severity:      string(dbVuln.Severity),
+		Metadata:      dbVuln.Metadata,
+		CVSS:          vulnerabilityCVSSFromDatabaseModel(dbVuln.CVSS),
+	}
+	for _, dbSource := range dbVuln.Sources {
+		vuln.Sources = append(vuln.Sources, VulnerabilitySource{
+			Name:    dbSource.Name,
+			URL:     dbSource.URL,
+			License: dbSource.License,
+		})
+	}
+	for _, dbFeatureVersion := range dbVuln.FixedIn {
+		feature := featureFromDatabaseModel(dbFeatureVersion)
+		feature.Remediation = remediation.Command(dbFeatureVersion.Feature.Namespace.Name, dbFeatureVersion.Feature.Name, dbFeatureVersion.Version)
+		vuln.FixedIn = append(vuln.FixedIn, feature)
+	}
+	return vuln
+}
+
+// databaseModel returns the vulnerability along with its fixes, which are in its namespace unless
+// they name another one.
+func (vuln Vulnerability) databaseModel() (database.Vulnerability, error) {
+	severity := types.Priority(vuln.Severity)
+	if !severity.IsValid() {
+		return database.Vulnerability{}, errors.New("invalid severity " + vuln.Severity)
+	}
+
+	dbVuln := database.Vulnerability{
+		Name:        vuln.Name,
+		Namespace:   database.Namespace{Name: vuln.NamespaceName},
+		Description: vuln.Description,
+		Link:        vuln.Link,
+		Severity:    severity,
+		Metadata:    vuln.Metadata,
+		CVSS:        vuln.CVSS.databaseModel(),
+	}
+	for _, source := range vuln.Sources {
+		dbVuln.Sources = append(dbVuln.Sources, database.VulnerabilitySource{
+			Name:    source.Name,
+			URL:     source.URL,
+			License: source.License,
+		})
+	}
+	for _, feature := range vuln.FixedIn {
+		if feature.NamespaceName == "" {
+			feature.NamespaceName = vuln.NamespaceName
+		}
+		dbFix, err := feature.databaseModel()
+		if err != nil {
+			return database.Vulnerability{}, err
+		}
+		dbVuln.FixedIn = append(dbVuln.FixedIn, dbFix)
+	}
+	return dbVuln, nil
+}
+
+func (vuln Vulnerability) toProto() proto.Message {
+	return vuln.toProtoVulnerability()
+}
+
+// toProtoVulnerability converts the vulnerability to its Protocol Buffers message, where the
+// metadata is JSON-encoded as its schema depends on the metadata fetchers.
+func (vuln Vulnerability) toProtoVulnerability() *clairpb.Vulnerability {
+	pb := &clairpb.Vulnerability{
+		Name:          vuln.Name,
+		NamespaceName: vuln.NamespaceName,
+		Description:   vuln.Description,
+		Link:          vuln.Link,
+		Severity:      vuln.Severity,
+		FixedBy:       vuln.FixedBy,
+	}
+	if len(vuln.Metadata) > 0 {
+		metadata, err := json.Marshal(vuln.Metadata)
+		if err != nil {
+			panic("v2: failed to marshal vulnerability metadata: " + err.Error())
+		}
+		pb.Metadata = string(metadata)
+	}
+	for _, source := range vuln.Sources {
+		pb.Sources = append(pb.Sources, &clairpb.VulnerabilitySource{
+			Name:    source.Name,
+			Url:     source.URL,
+			License: source.License,
+		})
+	}
+	if vuln.CVSS != nil {
+		pb.CvssV2 = vuln.CVSS.V2.toProto()
+		pb.CvssV3 = vuln.CVSS.V3.toProto()
+	}
+	for _, feature := range vuln.FixedIn {
+		pb.FixedIn = append(pb.FixedIn, feature.toProto())
+	}
+	if vuln.Explanation != nil {
+		pb.Explanation = &clairpb.Explanation{
+			Detector:      vuln.Explanation.Detector,
+			Feeds:         vuln.Explanation.Feeds,
+			VersionFormat: vuln.Explanation.VersionFormat,
+			Comparison:    vuln.Explanation.Comparison,
+		}
+	}
+	if vuln.FalsePositive != nil {
+		pb.FalsePositive = &clairpb.FalsePositive{
+			Name:    vuln.FalsePositive.Name,
+			Reason:  vuln.FalsePositive.Reason,
+			Created: vuln.FalsePositive.Created,
+		}
+	}
+	return pb
+}
+
+// VulnerabilityPage is a page of the vulnerabilities of a namespace.
+type VulnerabilityPage struct {
+	Vulnerabilities []Vulnerability `json:"Vulnerabilities"`
+	NextCursor      string          `json:"NextCursor,omitempty"`
+}
+
+func (page VulnerabilityPage) toProto() proto.Message {
+	pb := &clairpb.VulnerabilityPage{NextCursor: page.NextCursor}
+	for _, vuln := range page.Vulnerabilities {
+		pb.Vulnerabilities = append(pb.Vulnerabilities, vuln.toProtoVulnerability())
+	}
+	return pb
+}
+
+// FalsePositive is the resource flagging a finding, i.e. a vulnerability affecting a version of a
+// feature, as a false positive.
+type FalsePositive struct {
+	Name              string `json:"Name,omitempty"`
+	NamespaceName     string `json:"NamespaceName"`
+	VulnerabilityName string `json:"VulnerabilityName"`
+	FeatureName       string `json:"FeatureName"`
+	FeatureVersion    string `json:"FeatureVersion"`
+	Reason            string `json:"Reason,omitempty"`
+	Created           string `json:"Created,omitempty"`
+}
+
+func falsePositiveFromDatabaseModel(dbFalsePositive database.FalsePositive) FalsePositive {
+	return FalsePositive{
+		Name:              dbFalsePositive.Name,
+		NamespaceName:     dbFalsePositive.Namespace.Name,
+		VulnerabilityName: dbFalsePositive.VulnerabilityName,
+		FeatureName:       dbFalsePositive.FeatureName,
+		FeatureVersion:    dbFalsePositive.FeatureVersion,
+		Reason:            dbFalsePositive.Reason,
+		Created:           timestamp(dbFalsePositive.Created),
+	}
+}
+
+func (falsePositive FalsePositive) databaseModel() database.FalsePositive {
+	return database.FalsePositive{
+		Namespace:         database.Namespace{Name: falsePositive.NamespaceName},
+		VulnerabilityName: falsePositive.VulnerabilityName,
+		FeatureName:       falsePositive.FeatureName,
+		FeatureVersion:    falsePositive.FeatureVersion,
+		Reason:            falsePositive.Reason,
+	}
+}
+
+// FalsePositivePage is a page of the false positives, to triage the feeds and the matching.
+type FalsePositivePage struct {
+	FalsePositives []FalsePositive `json:"FalsePositives"`
+	NextCursor     string          `json:"NextCursor,omitempty"`
+}
+
+// Watch is the resource representing a tag that Clair keeps indexed. Digest is the digest of the
+// manifest of the image the tag pointed to when it was last Resolved, and Changed is when it
+// last moved.
+type Watch struct {
+	Name       string `json:"Name,omitempty"`
+	Registry   string `json:"Registry"`
+	Repository string `json:"Repository"`
+	Tag        string `json:"Tag"`
+	Digest     string `json:"Digest,omitempty"`
+	LayerName  string `json:"LayerName,omitempty"`
+	Signature  string `json:"Signature,omitempty"`
+	Created    string `json:"Created,omitempty"`
+	Resolved   string `json:"Resolved,omitempty"`
+	Changed    string `json:"Changed,omitempty"`
+}
+
+func watchFromDatabaseModel(dbWatchedTag database.WatchedTag) Watch {
+	return Watch{
+		Name:       dbWatchedTag.Name,
+		Registry:   dbWatchedTag.Registry,
+		Repository: dbWatchedTag.Repository,
+		Tag:        dbWatchedTag.Tag,
+		Digest:     dbWatchedTag.Digest,
+		LayerName:  dbWatchedTag.LayerName,
+		Signature:  string(dbWatchedTag.Signature),
+		Created:    timestamp(dbWatchedTag.Created),
+		Resolved:   timestamp(dbWatchedTag.Resolved),
+		Changed:    timestamp(dbWatchedTag.Changed),
+	}
+}
+
+// Provenance is the resource representing an in-toto statement attesting how the image whose
+// manifest has the Digest was built.
+type Provenance struct {
+	Name          string          `json:"Name"`
+	Digest        string          `json:"Digest"`
+	PredicateType string          `json:"PredicateType"`
+	BuilderID     string          `json:"BuilderID,omitempty"`
+	Statement     json.RawMessage `json:"Statement"`
+	Created       string          `json:"Created,omitempty"`
+}
+
+func provenanceFromDatabaseModel(dbProvenance database.Provenance) Provenance {
+	return Provenance{
+		Name:          dbProvenance.Name,
+		Digest:        dbProvenance.Digest,
+		PredicateType: dbProvenance.PredicateType,
+		BuilderID:     dbProvenance.BuilderID,
+		Statement:     json.RawMessage(dbProvenance.Statement),
+		Created:       timestamp(dbProvenance.Created),
+	}
+}
+
+func (provenance Provenance) toProto() *clairpb.Provenance {
+	return &clairpb.Provenance{
+		Name:          provenance.Name,
+		Digest:        provenance.Digest,
+		PredicateType: provenance.PredicateType,
+		BuilderId:     provenance.BuilderID,
+		Statement:     string(provenance.Statement),
+		Created:       provenance.Created,
+	}
+}
+
+// ProvenanceList lists the provenances of images.
+type ProvenanceList struct {
+	Provenances []Provenance `json:"Provenances"`
+}
+
+// Manifest is the resource representing the manifest of an image resolved by the tracker, whose
+// top layer is LayerName.
+type Manifest struct {
+	Digest    string `json:"Digest"`
+	LayerName string `json:"LayerName"`
+	Created   string `json:"Created,omitempty"`
+}
+
+func manifestFromDatabaseModel(dbImage database.Image) Manifest {
+	return Manifest{
+		Digest:    dbImage.Digest,
+		LayerName: dbImage.LayerName,
+		Created:   timestamp(dbImage.Created),
+	}
+}
+
+// Image is the resource representing an image, named either by a watch or by the digest of its
+// manifest. Image is the reference of the image when it is named by a watch.
+type Image struct {
+	Name      string `json:"Name"`
+	Image     string `json:"Image,omitempty"`
+	Digest    string `json:"Digest,omitempty"`
+	LayerName string `json:"LayerName"`
+}
+
+// Move is the resource representing a watched tag whose digest changed since it was last
+// reported, from OldDigest to NewDigest.
+type Move struct {
+	Name       string `json:"Name"`
+	Registry   string `json:"Registry"`
+	Repository string `json:"Repository"`
+	Tag        string `json:"Tag"`
+	OldDigest  string `json:"OldDigest"`
+	NewDigest  string `json:"NewDigest"`
+	Changed    string `json:"Changed,omitempty"`
+}
+
+func moveFromDatabaseModel(dbWatchedTag database.WatchedTag) Move {
+	return Move{
+		Name:       dbWatchedTag.Name,
+		Registry:   dbWatchedTag.Registry,
+		Repository: dbWatchedTag.Repository,
+		Tag:        dbWatchedTag.Tag,
+		OldDigest:  dbWatchedTag.ReportedDigest,
+		NewDigest:  dbWatchedTag.Digest,
+		Changed:    timestamp(dbWatchedTag.Changed),
+	}
+}
+
+// MovePage is a page of the moves.
+type MovePage struct {
+	Moves      []Move `json:"Moves"`
+	NextCursor string `json:"NextCursor,omitempty"`
+}
+
+// ReportDiff is the resource representing the differences between the findings of two images:
+// the ones of From only have been fixed in To, the ones of To only have been introduced.
+type ReportDiff struct {
+	From          string    `json:"From"`
+	To            string    `json:"To"`
+	FromLayerName string    `json:"FromLayerName"`
+	ToLayerName   string    `json:"ToLayerName"`
+	Fixed         []Finding `json:"Fixed"`
+	Introduced    []Finding `json:"Introduced"`
+	Unchanged     []Finding `json:"Unchanged"`
+}
+
+// Finding is a vulnerability affecting a feature of an image.
+type Finding struct {
+	FeatureName    string        `json:"FeatureName"`
+	FeatureVersion string        `json:"FeatureVersion"`
+	Vulnerability  Vulnerability `json:"Vulnerability"`
+}
+
+// BaseImage is the base image of an image, detected among the watched tags, and the newer tags of
+// its repository that would eliminate findings of the image, the recommended one first.
+type BaseImage struct {
+	Image     string `json:"Image"`
+	LayerName string `json:"LayerName"`
+	// Findings is the number of findings of the image in the features added by its base image.
+	Findings int                `json:"Findings"`
+	Upgrades []BaseImageUpgrade `json:"Upgrades"`
+}
+
+// BaseImageUpgrade is a newer tag of a base image, with the number of findings of the image that
+// moving to it would eliminate, and the number it would introduce.
+type BaseImageUpgrade struct {
+	Image      string `json:"Image"`
+	LayerName  string `json:"LayerName"`
+	Eliminated int    `json:"Eliminated"`
+	Introduced int    `json:"Introduced"`
+}
+
+// WatchPage is a page of the watched tags.
+type WatchPage struct {
+	Watches    []Watch `json:"Watches"`
+	NextCursor string  `json:"NextCursor,omitempty"`
+}
+
+// Notification is the resource representing a change of a vulnerability.
+//
+// The layers affected by the old and the new vulnerability are paginated together using the
+// cursor: NextCursor is empty on the last page.
+type Notification struct {
+	Name       string                     `json:"Name"`
+	Created    string                     `json:"Created,omitempty"`
+	Notified   string                     `json:"Notified,omitempty"`
+	Deleted    string                     `json:"Deleted,omitempty"`
+	Priority   string                     `json:"Priority,omitempty"`
+	Reason     string                     `json:"Reason,omitempty"`
+	Owners     []string                   `json:"Owners,omitempty"`
+	Old        *NotificationVulnerability `json:"Old,omitempty"`
+	New        *NotificationVulnerability `json:"New,omitempty"`
+	Changes    *VulnerabilityChanges      `json:"Changes,omitempty"`
+	NextCursor string                     `json:"NextCursor,omitempty"`
+}
+
+// VulnerabilityChanges is the difference between the old and the new vulnerability of a
+// notification: the names of the fields that changed, and the fixes that only exist in the new
+// or the old vulnerability.
+type VulnerabilityChanges struct {
+	ChangedFields  []string  `json:"ChangedFields,omitempty"`
+	AddedFixedIn   []Feature `json:"AddedFixedIn,omitempty"`
+	RemovedFixedIn []Feature `json:"RemovedFixedIn,omitempty"`
+}
+
+func vulnerabilityChangesFromDatabaseModel(dbDiff database.VulnerabilityDiff) VulnerabilityChanges {
+	changes := VulnerabilityChanges{ChangedFields: dbDiff.ChangedFields}
+	for _, dbFeatureVersion := range dbDiff.AddedFixedIn {
+		changes.AddedFixedIn = append(changes.AddedFixedIn, featureFromDatabaseModel(dbFeatureVersion))
+	}
+	for _, dbFeatureVersion := range dbDiff.RemovedFixedIn {
+		changes.RemovedFixedIn = append(changes.RemovedFixedIn, featureFromDatabaseModel(dbFeatureVersion))
+	}
+	return changes
+}
+
+// toProto converts the changes to their Protocol Buffers message, for the gRPC API.
+func (changes VulnerabilityChanges) toProto() *clairpb.VulnerabilityChanges {
+	pb := &clairpb.VulnerabilityChanges{ChangedFields: changes.ChangedFields}
+	for _, feature := range changes.AddedFixedIn {
+		pb.AddedFixedIn = append(pb.AddedFixedIn, feature.toProto())
+	}
+	for _, feature := range changes.RemovedFixedIn {
+		pb.RemovedFixedIn = append(pb.RemovedFixedIn, feature.toProto())
+	}
+	return pb
+}
+
+// watchedTagsOwners returns the owners of the images of the given watched tags, sorted.
+func watchedTagsOwners(dbWatchedTags []database.WatchedTag) []string {
+	var owners []string
+	seen := make(map[string]struct{})
+	for _, dbWatchedTag := range dbWatchedTags {
+		for _, owner := range ownership.Owners(registry.ImageName(dbWatchedTag.Registry, dbWatchedTag.Repository)) {
+			if _, ok := seen[owner]; !ok {
+				seen[owner] = struct{}{}
+				owners = append(owners, owner)
+			}
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// NotificationVulnerability is a version of a vulnerability along with the names of the layers
+// that introduce it, and the labels of the ones that have any, by layer name.
+type NotificationVulnerability struct {
+	Vulnerability       Vulnerability                `json:"Vulnerability"`
+	AffectedLayers      []string                     `json:"AffectedLayers"`
+	AffectedLayerLabels map[string]map[string]string `json:"AffectedLayerLabels,omitempty"`
+}
+
+func notificationFromDatabaseModel(dbNotification database.VulnerabilityNotification) Notification {
+	notification := Notification{
+		Name:     dbNotification.Name,
+		Created:  timestamp(dbNotification.Created),
+		Notified: timestamp(dbNotification.Notified),
+		Deleted:  timestamp(dbNotification.Deleted),
+		Priority: string(dbNotification.Priority),
+		Reason:   string(dbNotification.Reason),
+	}
+	if dbNotification.OldVulnerability != nil {
+		v := notificationVulnerabilityFromDatabaseModel(*dbNotification.OldVulnerability)
+		notification.Old = &v
+	}
+	if dbNotification.NewVulnerability != nil {
+		v := notificationVulnerabilityFromDatabaseModel(*dbNotification.NewVulnerability)
+		notification.New = &v
+	}
+	changes := vulnerabilityChangesFromDatabaseModel(database.DiffVulnerabilities(dbNotification.OldVulnerability, dbNotification.NewVulnerability))
+	notification.Changes = &changes
+	return notification
+}
+
+// toProtoNotification converts the notification to its Protocol Buffers message, for the gRPC API.
+func (notification Notification) toProtoNotification() *clairpb.Notification {
+	pb := &clairpb.Notification{
+		Name:       notification.Name,
+		Created:    notification.Created,
+		Notified:   notification.Notified,
+		Deleted:    notification.Deleted,
+		Priority:   notification.Priority,
+		Reason:     notification.Reason,
+		Owners:     notification.Owners,
+		NextCursor: notification.NextCursor,
+	}
+	if notification.Old != nil {
+		pb.Old = &clairpb.NotificationVulnerability{
+			Vulnerability:  notification.Old.Vulnerability.toProtoVulnerability(),
+			AffectedLayers: notification.Old.AffectedLayers,
+		}
+	}
+	if notification.New != nil {
+		pb.New = &clairpb.NotificationVulnerability{
+			Vulnerability:  notification.New.Vulnerability.toProtoVulnerability(),
+			AffectedLayers: notification.New.AffectedLayers,
+		}
+	}
+	if notification.Changes != nil {
+		pb.Changes = notification.Changes.toProto()
+	}
+	return pb
+}
+
+func notificationVulnerabilityFromDatabaseModel(dbVuln database.Vulnerability) NotificationVulnerability {
+	notificationVuln := NotificationVulnerability{
+		Vulnerability:  vulnerabilityFromDatabaseModel(dbVuln),
+		AffectedLayers: []string{},
+	}
+	for _, layer := range dbVuln.LayersIntroducingVulnerability {
+		notificationVuln.AffectedLayers = append(notificationVuln.AffectedLayers, layer.Name)
+		if len(layer.Labels) > 0 {
+			if notificationVuln.AffectedLayerLabels == nil {
+				notificationVuln.AffectedLayerLabels = make(map[string]map[string]string)
+			}
+			notificationVuln.AffectedLayerLabels[layer.Name] = layer.Labels
+		}
+	}
+	return notificationVuln
+}
+
+// NotificationLayersDiff is a page of the difference between the layers introducing the old and
+// the new vulnerability of a notification, ordered by the time Clair analyzed them: the layers
+// that only introduce the new vulnerability are added, and the ones that only introduce the old
+// one are removed. It is paginated using the cursor: NextCursor is empty on the last page.
+type NotificationLayersDiff struct {
+	Name        string                       `json:"Name"`
+	Added       []string                     `json:"Added"`
+	Removed     []string                     `json:"Removed"`
+	Unchanged   []string                     `json:"Unchanged"`
+	LayerLabels map[string]map[string]string `json:"LayerLabels,omitempty"`
+	NextCursor  string                       `json:"NextCursor,omitempty"`
+}
+
+func notificationLayersDiffFromDatabaseModel(dbDiff database.NotificationLayersDiff) NotificationLayersDiff {
+	diff := NotificationLayersDiff{Added: []string{}, Removed: []string{}, Unchanged: []string{}}
+	add := func(names *[]string, layers []database.Layer) {
+		for _, layer := range layers {
+			*names = append(*names, layer.Name)
+			if len(layer.Labels) > 0 {
+				if diff.LayerLabels == nil {
+					diff.LayerLabels = make(map[string]map[string]string)
+				}
+				diff.LayerLabels[layer.Name] = layer.Labels
+			}
+		}
+	}
+	add(&diff.Added, dbDiff.Added)
+	add(&diff.Removed, dbDiff.Removed)
+	add(&diff.Unchanged, dbDiff.Unchanged)
+	return diff
+}
+
+// timestamp formats the given time as a Unix timestamp, or returns an empty string if it isn't set.
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d", t.Unix())
+}
@@ -0,0 +1,267 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/ext/versionfmt/rpm"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestReportFromDatabaseModel(t *testing.T) {
+	debian7 := database.Namespace{Name: "debian:7", VersionFormat: dpkg.ParserName}
+	openssl := database.FeatureVersion{
+		Feature:    database.Feature{Name: "openssl", Namespace: debian7},
+		Version:    "1.0",
+		DetectedBy: "dpkg",
+		AffectedBy: []database.Vulnerability{
+			{
+				Name:      "CVE-2",
+				Namespace: debian7,
+				FixedBy:   versionfmt.MaxVersion,
+			},
+			{
+				Name:      "CVE-1",
+				Namespace: debian7,
+				Sources:   database.VulnerabilitySources{{Name: "Debian Security Tracker"}},
+				FixedBy:   "2.0",
+			},
+		},
+	}
+	bash := database.FeatureVersion{
+		Feature:    database.Feature{Name: "bash", Namespace: debian7},
+		Version:    "4.3",
+		DetectedBy: "dpkg",
+	}
+
+	layer := database.Layer{Name: "layer", Features: []database.FeatureVersion{openssl, bash}}
+	report := reportFromDatabaseModel(layer, nil, false, false)
+	if !assert.Len(t, report.Features, 2) {
+		return
+	}
+
+	// Features and vulnerabilities are sorted.
+	assert.Equal(t, "bash", report.Features[0].Name)
+	assert.Empty(t, report.Features[0].Vulnerabilities)
+	vulns := report.Features[1].Vulnerabilities
+	if !assert.Len(t, vulns, 2) {
+		return
+	}
+	assert.Equal(t, "CVE-1", vulns[0].Name)
+	assert.Equal(t, "CVE-2", vulns[1].Name)
+
+	// Every match is explained.
+	assert.Equal(t, &Explanation{
+		Detector:      "dpkg",
+		Feeds:         []string{"Debian Security Tracker"},
+		VersionFormat: dpkg.ParserName,
+		Comparison:    "1.0 < 2.0",
+	}, vulns[0].Explanation)
+	assert.Equal(t, "apt-get install --only-upgrade openssl=2.0", vulns[0].Remediation)
+	assert.Equal(t, "", vulns[1].FixedBy)
+	assert.Equal(t, "", vulns[1].Remediation)
+	assert.Equal(t, "1.0 is affected: no version fixes the vulnerability", vulns[1].Explanation.Comparison)
+	assert.Nil(t, vulns[0].FalsePositive)
+
+	// Flagged findings are annotated or excluded, depending on the policy.
+	falsePositives := []database.FalsePositive{
+		{
+			Name:              "fp",
+			Namespace:         debian7,
+			VulnerabilityName: "CVE-2",
+			FeatureName:       "openssl",
+			FeatureVersion:    "1.0",
+			Reason:            "backported",
+		},
+		{
+			Name:              "other",
+			Namespace:         debian7,
+			VulnerabilityName: "CVE-1",
+			FeatureName:       "openssl",
+			FeatureVersion:    "0.9",
+		},
+	}
+
+	vulns = reportFromDatabaseModel(layer, falsePositives, false, false).Features[1].Vulnerabilities
+	if assert.Len(t, vulns, 2) && assert.NotNil(t, vulns[1].FalsePositive) {
+		assert.Nil(t, vulns[0].FalsePositive)
+		assert.Equal(t, "fp", vulns[1].FalsePositive.Name)
+		assert.Equal(t, "backported", vulns[1].FalsePositive.Reason)
+	}
+
+	vulns = reportFromDatabaseModel(layer, falsePositives, true, false).Features[1].Vulnerabilities
+	if assert.Len(t, vulns, 1) {
+		assert.Equal(t, "CVE-1", vulns[0].Name)
+	}
+}
+
+func TestReportKernelVulnerabilities(t *testing.T) {
+	debian7 := database.Namespace{Name: "debian:7", VersionFormat: dpkg.ParserName}
+	linux := database.FeatureVersion{
+		Feature:    database.Feature{Name: "linux", Namespace: debian7},
+		Version:    "3.2.78-1",
+		AffectedBy: []database.Vulnerability{{Name: "CVE-1", Namespace: debian7, FixedBy: "3.2.81-1"}},
+	}
+	base := database.FeatureVersion{
+		Feature:    database.Feature{Name: "linux-base", Namespace: debian7},
+		Version:    "3.5",
+		AffectedBy: []database.Vulnerability{{Name: "CVE-2", Namespace: debian7, FixedBy: "3.6"}},
+	}
+	layer := database.Layer{Name: "layer", Features: []database.FeatureVersion{linux, base}}
+
+	// Kernel packages are flagged, and their vulnerabilities reported or excluded depending on
+	// the policy.
+	report := reportFromDatabaseModel(layer, nil, false, false)
+	if assert.Len(t, report.Features, 2) {
+		assert.True(t, report.Features[0].Kernel)
+		assert.Len(t, report.Features[0].Vulnerabilities, 1)
+		assert.False(t, report.Features[1].Kernel)
+	}
+
+	report = reportFromDatabaseModel(layer, nil, false, true)
+	if assert.Len(t, report.Features, 2) {
+		assert.True(t, report.Features[0].Kernel)
+		assert.Empty(t, report.Features[0].Vulnerabilities)
+		assert.Len(t, report.Features[1].Vulnerabilities, 1)
+	}
+}
+
+func TestIsKernel(t *testing.T) {
+	dpkgNamespace := database.Namespace{Name: "ubuntu:16.04", VersionFormat: dpkg.ParserName}
+	rpmNamespace := database.Namespace{Name: "centos:7", VersionFormat: rpm.ParserName}
+	otherNamespace := database.Namespace{Name: "crates.io", VersionFormat: "semver"}
+
+	for _, c := range []struct {
+		namespace database.Namespace
+		name      string
+		kernel    bool
+	}{
+		{dpkgNamespace, "linux", true},
+		{dpkgNamespace, "linux-aws", true},
+		{dpkgNamespace, "linux-base", false},
+		{dpkgNamespace, "linuxdoc-tools", false},
+		{rpmNamespace, "kernel-headers", true},
+		{rpmNamespace, "kernelshark", false},
+		{otherNamespace, "linux-raw-sys", false},
+	} {
+		fv := database.FeatureVersion{Feature: database.Feature{Name: c.name, Namespace: c.namespace}}
+		assert.Equal(t, c.kernel, isKernel(fv), c.name)
+	}
+}
+
+func TestFeatureEvidence(t *testing.T) {
+	fv := database.FeatureVersion{Feature: database.Feature{Name: "curl"}, Version: "7.0"}
+	assert.Equal(t, "", featureFromDatabaseModel(fv).Evidence)
+
+	fv.Evidence = []string{"usr/bin/curl"}
+	assert.Equal(t, evidencePresent, featureFromDatabaseModel(fv).Evidence)
+
+	// The package is listed but all of its executables and libraries were removed.
+	fv.Evidence = []string{}
+	assert.Equal(t, evidenceMissing, featureFromDatabaseModel(fv).Evidence)
+}
+
+func TestNotificationChanges(t *testing.T) {
+	debian8 := database.Namespace{Name: "debian:8", VersionFormat: dpkg.ParserName}
+	grep := func(version string) database.FeatureVersion {
+		return database.FeatureVersion{Feature: database.Feature{Namespace: debian8, Name: "grep"}, Version: version}
+	}
+	oldVuln := database.Vulnerability{Name: "CVE-TEST", Namespace: debian8, Severity: "Low", FixedIn: []database.FeatureVersion{grep("2.25")}}
+	newVuln := database.Vulnerability{Name: "CVE-TEST", Namespace: debian8, Severity: "High", FixedIn: []database.FeatureVersion{grep("2.26")}}
+
+	notification := notificationFromDatabaseModel(database.VulnerabilityNotification{
+		Name:             "test",
+		OldVulnerability: &oldVuln,
+		NewVulnerability: &newVuln,
+	})
+	if !assert.NotNil(t, notification.Changes) {
+		return
+	}
+	assert.Equal(t, []string{"Severity"}, notification.Changes.ChangedFields)
+	if assert.Len(t, notification.Changes.AddedFixedIn, 1) && assert.Len(t, notification.Changes.RemovedFixedIn, 1) {
+		assert.Equal(t, "2.26", notification.Changes.AddedFixedIn[0].Version)
+		assert.Equal(t, "2.25", notification.Changes.RemovedFixedIn[0].Version)
+	}
+
+	pb := notification.toProtoNotification()
+	if assert.NotNil(t, pb.Changes) && assert.Len(t, pb.Changes.AddedFixedIn, 1) {
+		assert.Equal(t, []string{"Severity"}, pb.Changes.ChangedFields)
+		assert.Equal(t, "grep", pb.Changes.AddedFixedIn[0].Name)
+	}
+}
+
+func TestVulnerabilityCVSS(t *testing.T) {
+	debian8 := database.Namespace{Name: "debian:8", VersionFormat: dpkg.ParserName}
+	dbVuln := database.Vulnerability{
+		Name:      "CVE-TEST",
+		Namespace: debian8,
+		Severity:  types.Critical,
+		CVSS: database.VulnerabilityCVSS{
+			V3: &types.CVSS{Vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", Score: 9.8},
+		},
+	}
+
+	vuln := vulnerabilityFromDatabaseModel(dbVuln)
+	if assert.NotNil(t, vuln.CVSS) {
+		assert.Nil(t, vuln.CVSS.V2)
+		assert.Equal(t, &CVSS{Vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", Score: 9.8}, vuln.CVSS.V3)
+	}
+	assert.Nil(t, vulnerabilityFromDatabaseModel(database.Vulnerability{Namespace: debian8}).CVSS)
+
+	pb := vuln.toProtoVulnerability()
+	assert.Nil(t, pb.CvssV2)
+	if assert.NotNil(t, pb.CvssV3) {
+		assert.Equal(t, 9.8, pb.CvssV3.Score)
+	}
+
+	roundTrip, err := vuln.databaseModel()
+	if assert.Nil(t, err) {
+		assert.Equal(t, dbVuln.CVSS, roundTrip.CVSS)
+	}
+}
+
+func TestLayerStats(t *testing.T) {
+	dbLayer := database.Layer{
+		Name: "layer",
+		Stats: database.LayerStats{
+			BytesRead:      4096,
+			FilesInspected: 12,
+			FilesMatched:   2,
+			BytesMatched:   1024,
+			Duration:       1500 * time.Millisecond,
+			Detectors:      map[string]time.Duration{"dpkg": 250 * time.Millisecond},
+		},
+	}
+
+	layer := layerFromDatabaseModel(dbLayer)
+	if assert.NotNil(t, layer.Stats) {
+		assert.Equal(t, int64(4096), layer.Stats.BytesRead)
+		assert.Equal(t, 12, layer.Stats.FilesInspected)
+		assert.Equal(t, 2, layer.Stats.FilesMatched)
+		assert.Equal(t, int64(1024), layer.Stats.BytesMatched)
+		assert.Equal(t, 1.5, layer.Stats.Seconds)
+		assert.Equal(t, map[string]float64{"dpkg": 0.25}, layer.Stats.DetectorsSeconds)
+	}
+
+	// The layers analyzed before the statistics were recorded have none.
+	assert.Nil(t, layerFromDatabaseModel(database.Layer{Name: "layer"}).Stats)
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/utils"
+)
+
+const (
+	pdfContentType = "application/pdf"
+
+	// defaultPDFTimeout is the time after which the conversion of a report is aborted unless it
+	// is configured.
+	defaultPDFTimeout = time.Minute
+
+	// maxPDFStderr is the size of the standard error of the conversions kept for their errors.
+	maxPDFStderr = 4096
+)
+
+var errPDFTimeout = errors.New("the conversion of the report to PDF timed out")
+
+func getImagePDFReport(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	if ctx.Config == nil || ctx.Config.Reports == nil || len(ctx.Config.Reports.PDFCommand) == 0 {
+		writeHTMLError(w, http.StatusNotImplemented, errors.New("the PDF reports are not enabled"))
+		return getImagePDFReportRoute, http.StatusNotImplemented
+	}
+
+	name := p.ByName("name")
+	html, status, err := renderImageReport(ctx, name)
+	if err != nil {
+		writeHTMLError(w, status, err)
+		return getImagePDFReportRoute, status
+	}
+
+	pdf, err := convertToPDF(ctx.Config.Reports, html)
+	if err != nil {
+		log.Errorf("could not convert the report of '%s' to PDF: %s", name, err)
+		writeHTMLError(w, http.StatusInternalServerError, err)
+		return getImagePDFReportRoute, http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", pdfContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%s", strconv.Quote(exportFilename(name)+".pdf")))
+	w.Header().Set("Server", "clair")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(pdf); err != nil {
+		log.Warningf("failed to write response: %s", err.Error())
+	}
+	return getImagePDFReportRoute, http.StatusOK
+}
+
+// convertToPDF converts an HTML report into a PDF document with the configured command.
+func convertToPDF(cfg *config.ReportsConfig, html []byte) ([]byte, error) {
+	var stdout bytes.Buffer
+	stderr := &utils.LimitedBuffer{Max: maxPDFStderr}
+	cmd := exec.Command(cfg.PDFCommand[0], cfg.PDFCommand[1:]...)
+	cmd.Stdin = bytes.NewReader(html)
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start the conversion of the report to PDF: %s", err)
+	}
+
+	timeout := cfg.PDFTimeout
+	if timeout <= 0 {
+		timeout = defaultPDFTimeout
+	}
+	timedOut := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() {
+		close(timedOut)
+		cmd.Process.Kill()
+	})
+	defer timer.Stop()
+
+	err := cmd.Wait()
+	select {
+	case <-timedOut:
+		return nil, errPDFTimeout
+	default:
+	}
+	if err != nil {
+		return nil, fmt.Errorf("the conversion of the report to PDF failed: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, errors.New("the conversion of the report to PDF produced no document")
+	}
+	return stdout.Bytes(), nil
+}
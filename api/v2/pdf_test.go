@@ -0,0 +1,84 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func TestImagePDFReport(t *testing.T) {
+	datastore := &database.MockDatastore{
+		FctFindWatchedTag: func(name string) (database.WatchedTag, error) {
+			return database.WatchedTag{}, cerrors.ErrNotFound
+		},
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{Name: name}, nil
+		},
+		FctFindFalsePositives: func([]database.Vulnerability) ([]database.FalsePositive, error) {
+			return nil, nil
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{}}
+	get := func() *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/images/layer/report.pdf", nil)
+		w := httptest.NewRecorder()
+		getImagePDFReport(w, r, httprouter.Params{{Key: "name", Value: "layer"}}, ctx)
+		return w
+	}
+
+	// The PDF reports are disabled unless a command is configured.
+	assert.Equal(t, http.StatusNotImplemented, get().Code)
+
+	// The command converts the branded HTML report, which cat keeps as is.
+	ctx.Config.Reports = &config.ReportsConfig{
+		Header:     `<img alt="ACME" src="data:image/png;base64,AAAA">`,
+		Footer:     "Confidential",
+		PDFCommand: []string{"cat"},
+	}
+	w := get()
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, pdfContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, `inline; filename="layer.pdf"`, w.Header().Get("Content-Disposition"))
+		assert.Contains(t, w.Body.String(), `<header class="branding"><img alt="ACME" src="data:image/png;base64,AAAA"></header>`)
+		assert.Contains(t, w.Body.String(), `<footer class="branding">Confidential</footer>`)
+	}
+
+	ctx.Config.Reports.PDFCommand = []string{"false"}
+	assert.Equal(t, http.StatusInternalServerError, get().Code)
+
+	ctx.Config.Reports.PDFCommand = []string{"sleep", "5"}
+	ctx.Config.Reports.PDFTimeout = 10 * time.Millisecond
+	_, err := convertToPDF(ctx.Config.Reports, nil)
+	assert.Equal(t, errPDFTimeout, err)
+
+	// Only the beginning of the error output of a failed conversion is kept.
+	ctx.Config.Reports.PDFCommand = []string{"sh", "-c", "yes error | head -c 1048576 >&2; exit 1"}
+	ctx.Config.Reports.PDFTimeout = 0
+	_, err = convertToPDF(ctx.Config.Reports, nil)
+	if assert.Error(t, err) {
+		assert.True(t, len(err.Error()) < 2*maxPDFStderr)
+	}
+}
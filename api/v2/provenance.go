@@ -0,0 +1,116 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/coreos/clair/database"
+)
+
+const (
+	inTotoPayloadType = "application/vnd.in-toto+json"
+
+	slsaPredicateTypePrefix = "https://slsa.dev/provenance/"
+)
+
+var (
+	// inTotoStatementTypes are the supported versions of the in-toto statements.
+	inTotoStatementTypes = map[string]struct{}{
+		"https://in-toto.io/Statement/v0.1": {},
+		"https://in-toto.io/Statement/v1":   {},
+	}
+
+	errNotProvenance = errors.New("the statement is not a SLSA provenance about an image")
+)
+
+// provenancesFromStatement parses an in-toto statement, possibly wrapped in a DSSE envelope, into
+// the provenances of the images it is about. The signatures of the envelope are not verified.
+func provenancesFromStatement(data []byte) ([]database.Provenance, error) {
+	var envelope struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.PayloadType != "" {
+		if envelope.PayloadType != inTotoPayloadType {
+			return nil, errors.New("the envelope does not contain an in-toto statement")
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return nil, err
+		}
+		data = payload
+	}
+
+	var statement struct {
+		Type    string `json:"_type"`
+		Subject []struct {
+			Digest map[string]string `json:"digest"`
+		} `json:"subject"`
+		PredicateType string `json:"predicateType"`
+		Predicate     struct {
+			// SLSA v0.2
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+			// SLSA v1
+			RunDetails struct {
+				Builder struct {
+					ID string `json:"id"`
+				} `json:"builder"`
+			} `json:"runDetails"`
+		} `json:"predicate"`
+	}
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return nil, err
+	}
+	if _, ok := inTotoStatementTypes[statement.Type]; !ok || !strings.HasPrefix(statement.PredicateType, slsaPredicateTypePrefix) {
+		return nil, errNotProvenance
+	}
+
+	// Statements are stored compacted so that the same statement is only stored once.
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err != nil {
+		return nil, err
+	}
+
+	builderID := statement.Predicate.Builder.ID
+	if builderID == "" {
+		builderID = statement.Predicate.RunDetails.Builder.ID
+	}
+
+	var provenances []database.Provenance
+	for _, subject := range statement.Subject {
+		if digest, ok := subject.Digest["sha256"]; ok {
+			provenances = append(provenances, database.Provenance{
+				Digest:        "sha256:" + digest,
+				PredicateType: statement.PredicateType,
+				BuilderID:     builderID,
+				Statement:     compacted.String(),
+			})
+		}
+	}
+	if len(provenances) == 0 {
+		return nil, errNotProvenance
+	}
+	return provenances, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStatement = `{
+  "_type": "https://in-toto.io/Statement/v1",
+  "subject": [
+    {"name": "registry.example.com/debian", "digest": {"sha256": "aaaa"}},
+    {"name": "registry.example.com/debian", "digest": {"sha512": "bbbb"}}
+  ],
+  "predicateType": "https://slsa.dev/provenance/v1",
+  "predicate": {"runDetails": {"builder": {"id": "https://builder.example.com"}}}
+}`
+
+func TestProvenancesFromStatement(t *testing.T) {
+	provenances, err := provenancesFromStatement([]byte(testStatement))
+	if assert.Nil(t, err) && assert.Len(t, provenances, 1) {
+		assert.Equal(t, "sha256:aaaa", provenances[0].Digest)
+		assert.Equal(t, "https://slsa.dev/provenance/v1", provenances[0].PredicateType)
+		assert.Equal(t, "https://builder.example.com", provenances[0].BuilderID)
+		assert.NotContains(t, provenances[0].Statement, "\n", "statements are compacted")
+	}
+
+	// DSSE envelope.
+	envelope := `{"payloadType": "application/vnd.in-toto+json", "payload": "` + base64.StdEncoding.EncodeToString([]byte(testStatement)) + `", "signatures": []}`
+	enveloped, err := provenancesFromStatement([]byte(envelope))
+	if assert.Nil(t, err) {
+		assert.Equal(t, provenances, enveloped)
+	}
+
+	// SLSA v0.2 names the builder in the predicate.
+	provenances, err = provenancesFromStatement([]byte(`{"_type": "https://in-toto.io/Statement/v0.1", "subject": [{"digest": {"sha256": "aaaa"}}], "predicateType": "https://slsa.dev/provenance/v0.2", "predicate": {"builder": {"id": "https://ci.example.com"}}}`))
+	if assert.Nil(t, err) && assert.Len(t, provenances, 1) {
+		assert.Equal(t, "https://ci.example.com", provenances[0].BuilderID)
+	}
+
+	for _, invalid := range []string{
+		`{"_type": "https://in-toto.io/Statement/v1", "subject": [{"digest": {"sha256": "aaaa"}}], "predicateType": "https://spdx.dev/Document"}`,
+		`{"_type": "https://in-toto.io/Statement/v1", "subject": [], "predicateType": "https://slsa.dev/provenance/v1"}`,
+		`{"payloadType": "application/json", "payload": ""}`,
+		`not json`,
+	} {
+		_, err := provenancesFromStatement([]byte(invalid))
+		assert.NotNil(t, err, invalid)
+	}
+}
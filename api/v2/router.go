@@ -0,0 +1,100 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package v2 implements the second version of the Clair API.
+//
+// Resources are returned as is rather than wrapped in envelopes, and collections are paginated
+// using opaque cursors.
+package v2
+
+import (
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/coreos/clair/api/context"
+)
+
+// NewRouter creates an HTTP router for version 2 of the Clair API.
+func NewRouter(ctx *context.RouteContext) *httprouter.Router {
+	router := httprouter.New()
+
+	// Layers
+	router.POST("/layers", context.HTTPHandler(writeHandler(postLayer), ctx))
+	router.GET("/layers", context.HTTPHandler(getLayers, ctx))
+	router.GET("/layers/:layerName", context.HTTPHandler(getLayer, ctx))
+	router.DELETE("/layers/:layerName", context.HTTPHandler(writeHandler(deleteLayer), ctx))
+
+	// Uploads
+	router.POST("/uploads", context.HTTPHandler(writeHandler(postUpload), ctx))
+	router.GET("/uploads/:uploadName", context.HTTPHandler(getUpload, ctx))
+	router.PATCH("/uploads/:uploadName", context.HTTPHandler(writeHandler(patchUpload), ctx))
+	router.DELETE("/uploads/:uploadName", context.HTTPHandler(writeHandler(deleteUpload), ctx))
+
+	// Reports
+	router.GET("/layers/:layerName/report", context.HTTPHandler(getReport, ctx))
+	router.GET("/layers/:layerName/export", context.HTTPHandler(getReportExport, ctx))
+	router.GET("/watches/:watchName/export", context.HTTPHandler(getWatchExport, ctx))
+	router.GET("/namespaces/:namespaceName/export", context.HTTPHandler(getNamespaceExport, ctx))
+	router.GET("/images/:name/report.html", context.HTTPHandler(getImageHTMLReport, ctx))
+	router.GET("/images/:name/report.pdf", context.HTTPHandler(getImagePDFReport, ctx))
+	router.GET("/reports/diff", context.HTTPHandler(getReportDiff, ctx))
+
+	// Vulnerabilities
+	router.GET("/namespaces/:namespaceName/vulnerabilities", context.HTTPHandler(getVulnerabilities, ctx))
+	router.GET("/namespaces/:namespaceName/vulnerabilities.ndjson", context.HTTPHandler(getVulnerabilitiesStream, ctx))
+	router.GET("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", context.HTTPHandler(getVulnerability, ctx))
+
+	// Advisories
+	router.POST("/namespaces/:namespaceName/vulnerabilities", context.HTTPHandler(advisoryHandler(postVulnerability), ctx))
+	router.PUT("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", context.HTTPHandler(advisoryHandler(putVulnerability), ctx))
+	router.DELETE("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", context.HTTPHandler(advisoryHandler(deleteVulnerability), ctx))
+	router.PUT("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName/fixes/:fixName", context.HTTPHandler(advisoryHandler(putFix), ctx))
+	router.DELETE("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName/fixes/:fixName", context.HTTPHandler(advisoryHandler(deleteFix), ctx))
+
+	// Notifications
+	router.GET("/notifications/:notificationName", context.HTTPHandler(getNotification, ctx))
+	router.GET("/notifications/:notificationName/diff", context.HTTPHandler(getNotificationDiff, ctx))
+	router.DELETE("/notifications/:notificationName", context.HTTPHandler(writeHandler(deleteNotification), ctx))
+
+	// Watches
+	router.POST("/watches", context.HTTPHandler(writeHandler(postWatch), ctx))
+	router.GET("/watches", context.HTTPHandler(getWatches, ctx))
+	router.GET("/watches/:watchName", context.HTTPHandler(getWatch, ctx))
+	router.GET("/watches/:watchName/report", context.HTTPHandler(getWatchReport, ctx))
+	router.DELETE("/watches/:watchName", context.HTTPHandler(writeHandler(deleteWatch), ctx))
+
+	// Provenances
+	router.POST("/provenances", context.HTTPHandler(writeHandler(postProvenance), ctx))
+	router.GET("/provenances/:digest", context.HTTPHandler(getProvenances, ctx))
+
+	// Images and their manifests
+	router.GET("/images/:name", context.HTTPHandler(getImage, ctx))
+	router.GET("/manifests/:digest", context.HTTPHandler(getManifest, ctx))
+	router.GET("/manifests/:digest/report", context.HTTPHandler(getManifestReport, ctx))
+
+	// Moves of the watched tags
+	router.GET("/moves", context.HTTPHandler(getMoves, ctx))
+	router.DELETE("/moves/:watchName", context.HTTPHandler(writeHandler(deleteMove), ctx))
+
+	// False positives
+	router.POST("/falsepositives", context.HTTPHandler(writeHandler(postFalsePositive), ctx))
+	router.GET("/falsepositives", context.HTTPHandler(getFalsePositives, ctx))
+	router.DELETE("/falsepositives/:falsePositiveName", context.HTTPHandler(writeHandler(deleteFalsePositive), ctx))
+
+	// Feed
+	f := new(feed)
+	router.GET("/feed/vulnerabilities.ndjson.gz", context.HTTPHandler(f.getBundle, ctx))
+	router.GET("/feed/vulnerabilities.ndjson.gz.sig", context.HTTPHandler(f.getBundleSignature, ctx))
+
+	return router
+}
@@ -0,0 +1,1083 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/api/token"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ownership"
+	"github.com/coreos/clair/registry"
+	"github.com/coreos/clair/utils"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/worker"
+)
+
+const (
+	// These are the route identifiers for prometheus.
+	postLayerRoute           = "v2/postLayer"
+	getLayerRoute            = "v2/getLayer"
+	getLayersRoute           = "v2/getLayers"
+	deleteLayerRoute         = "v2/deleteLayer"
+	postUploadRoute          = "v2/postUpload"
+	getUploadRoute           = "v2/getUpload"
+	patchUploadRoute         = "v2/patchUpload"
+	deleteUploadRoute        = "v2/deleteUpload"
+	getReportRoute           = "v2/getReport"
+	getReportExportRoute     = "v2/getReportExport"
+	getImageHTMLReportRoute  = "v2/getImageHTMLReport"
+	getImagePDFReportRoute   = "v2/getImagePDFReport"
+	getReportDiffRoute       = "v2/getReportDiff"
+	getVulnerabilitiesRoute  = "v2/getVulnerabilities"
+	getVulnerabilityRoute    = "v2/getVulnerability"
+	getVulnStreamRoute       = "v2/getVulnerabilitiesStream"
+	postVulnerabilityRoute   = "v2/postVulnerability"
+	putVulnerabilityRoute    = "v2/putVulnerability"
+	deleteVulnerabilityRoute = "v2/deleteVulnerability"
+	putFixRoute              = "v2/putFix"
+	deleteFixRoute           = "v2/deleteFix"
+	getNamespaceExportRoute  = "v2/getNamespaceExport"
+	getNotificationRoute     = "v2/getNotification"
+	getNotificationDiffRoute = "v2/getNotificationDiff"
+	deleteNotificationRoute  = "v2/deleteNotification"
+	postFalsePositiveRoute   = "v2/postFalsePositive"
+	getFalsePositivesRoute   = "v2/getFalsePositives"
+	deleteFalsePositiveRoute = "v2/deleteFalsePositive"
+	postWatchRoute           = "v2/postWatch"
+	getWatchesRoute          = "v2/getWatches"
+	getWatchRoute            = "v2/getWatch"
+	getWatchReportRoute      = "v2/getWatchReport"
+	getWatchExportRoute      = "v2/getWatchExport"
+	deleteWatchRoute         = "v2/deleteWatch"
+	getMovesRoute            = "v2/getMoves"
+	deleteMoveRoute          = "v2/deleteMove"
+	postProvenanceRoute      = "v2/postProvenance"
+	getProvenancesRoute      = "v2/getProvenances"
+	getManifestRoute         = "v2/getManifest"
+	getManifestReportRoute   = "v2/getManifestReport"
+	getImageRoute            = "v2/getImage"
+	getFeedRoute             = "v2/getFeed"
+	getFeedSignatureRoute    = "v2/getFeedSignature"
+	readOnlyRoute            = "v2/readOnly"
+	unauthorizedRoute        = "v2/unauthorized"
+
+	// maxBodySize restricts client request bodies to 1MiB.
+	maxBodySize int64 = 1048576
+
+	// maxLabelKeySize and maxLabelValueSize are the sizes of the largest keys and values of the
+	// labels of the layers that the datastores store.
+	maxLabelKeySize   = 128
+	maxLabelValueSize = 256
+
+	// defaultLimit is the size of the pages of a collection when the client doesn't specify one.
+	defaultLimit = 50
+
+	// protobufContentType is the media type of the Protocol Buffers responses.
+	protobufContentType = "application/x-protobuf"
+
+	// excludeFalsePositives is the false positives policy removing the flagged findings from the
+	// reports, instead of annotating them.
+	excludeFalsePositives = "exclude"
+
+	// excludeKernelVulnerabilities is the kernel vulnerabilities policy removing the
+	// vulnerabilities of the kernel packages from the reports, instead of reporting them.
+	excludeKernelVulnerabilities = "exclude"
+
+	// statusUnprocessableEntity represents the 422 (Unprocessable Entity) status code.
+	statusUnprocessableEntity = 422
+)
+
+// writeHandler wraps a handler that modifies the datastore so its requests are rejected while the
+// API is in read-only mode.
+func writeHandler(handler context.Handler) context.Handler {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+		if ctx.Config != nil && ctx.Config.ReadOnly {
+			writeError(w, r, http.StatusServiceUnavailable, errors.New("clair is in read-only mode"))
+			return readOnlyRoute, http.StatusServiceUnavailable
+		}
+
+		return handler(w, r, p, ctx)
+	}
+}
+
+func decodeJSON(r *http.Request, v interface{}) error {
+	defer r.Body.Close()
+	return json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(v)
+}
+
+// protoMessager is implemented by the resources that can also be encoded as Protocol Buffers.
+type protoMessager interface {
+	toProto() proto.Message
+}
+
+// acceptsProtobuf returns whether the client asked for a Protocol Buffers response: its Accept
+// header must list them explicitly, with a quality at least as high as the one of JSON, which is
+// served otherwise.
+func acceptsProtobuf(r *http.Request) bool {
+	// The quality of JSON is the one of the most specific range matching it.
+	protobuf := -1.0
+	var json [3]float64
+	for i := range json {
+		json[i] = -1
+	}
+
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case protobufContentType:
+			protobuf = math.Max(protobuf, q)
+		case "application/json":
+			json[0] = math.Max(json[0], q)
+		case "application/*":
+			json[1] = math.Max(json[1], q)
+		case "*/*":
+			json[2] = math.Max(json[2], q)
+		}
+	}
+
+	if protobuf <= 0 {
+		return false
+	}
+	for _, q := range json {
+		if q >= 0 {
+			return protobuf >= q
+		}
+	}
+	return true
+}
+
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, resp interface{}) {
+	// Encode the response as Protocol Buffers when it is requested and supported.
+	var pb []byte
+	if m, ok := resp.(protoMessager); ok && acceptsProtobuf(r) {
+		var err error
+		if pb, err = proto.Marshal(m.toProto()); err != nil {
+			panic("v2: failed to marshal response: " + err.Error())
+		}
+	}
+
+	// Headers must be written before the response.
+	header := w.Header()
+	if pb != nil {
+		header.Set("Content-Type", protobufContentType)
+	} else {
+		header.Set("Content-Type", "application/json;charset=utf-8")
+	}
+	header.Set("Server", "clair")
+
+	// Gzip the response if the client supports it.
+	var writer io.Writer = w
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		gzipWriter := gzip.NewWriter(w)
+		defer gzipWriter.Close()
+		writer = gzipWriter
+
+		header.Set("Content-Encoding", "gzip")
+	}
+
+	// Write the response.
+	w.WriteHeader(status)
+	if pb != nil {
+		if _, err := writer.Write(pb); err != nil {
+			log.Warningf("failed to write response: %s", err.Error())
+		}
+		return
+	}
+	err := json.NewEncoder(writer).Encode(resp)
+
+	if err != nil {
+		switch err.(type) {
+		case *json.MarshalerError, *json.UnsupportedTypeError, *json.UnsupportedValueError:
+			panic("v2: failed to marshal response: " + err.Error())
+		default:
+			log.Warningf("failed to write response: %s", err.Error())
+		}
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	e := Error{Message: err.Error()}
+	if budgetErr, ok := err.(*worker.ErrBudgetExceeded); ok {
+		e.ExceededBudget = string(budgetErr.Resource)
+	}
+	writeResponse(w, r, status, e)
+}
+
+// writeDatastoreError writes the error returned by the datastore and returns the matching status.
+func writeDatastoreError(w http.ResponseWriter, r *http.Request, err error) int {
+	status := http.StatusInternalServerError
+	switch {
+	case err == cerrors.ErrNotFound:
+		status = http.StatusNotFound
+	case isBadRequest(err):
+		status = http.StatusBadRequest
+	case err == database.ErrMigrationInProgress:
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", strconv.Itoa(int(database.MigrationRetryAfter.Seconds())))
+	}
+
+	writeError(w, r, status, err)
+	return status
+}
+
+func isBadRequest(err error) bool {
+	_, badreq := err.(*cerrors.ErrBadRequest)
+	return badreq
+}
+
+// isBudgetExceeded returns whether the analysis of a layer failed because it exceeded its budget.
+func isBudgetExceeded(err error) bool {
+	_, exceeded := err.(*worker.ErrBudgetExceeded)
+	return exceeded
+}
+
+// parsePagination returns the limit and decodes the cursor of the request into the given value.
+func parsePagination(r *http.Request, key string, cursor interface{}) (int, error) {
+	query := r.URL.Query()
+
+	limit := defaultLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			return 0, errors.New("invalid limit format: " + err.Error())
+		}
+		if limit <= 0 {
+			return 0, errors.New("limit value should be greater than zero")
+		}
+	}
+
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		if err := token.Unmarshal(cursorStr, key, cursor); err != nil {
+			return 0, errors.New("invalid cursor: " + err.Error())
+		}
+	}
+
+	return limit, nil
+}
+
+func postLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	var layer Layer
+	var path string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		// The tarball is sent along with the layer.
+		var err error
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize(ctx)+maxBodySize)
+		if path, err = decodeMultipartLayer(r, ctx, &layer); err == errUploadTooLarge {
+			writeError(w, r, http.StatusRequestEntityTooLarge, err)
+			return postLayerRoute, http.StatusRequestEntityTooLarge
+		} else if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return postLayerRoute, http.StatusBadRequest
+		}
+		defer os.Remove(path)
+	} else {
+		if err := decodeJSON(r, &layer); err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return postLayerRoute, http.StatusBadRequest
+		}
+
+		path = layer.Path
+		if layer.UploadName != "" {
+			// The tarball has been uploaded beforehand.
+			if layer.Path != "" {
+				writeError(w, r, http.StatusBadRequest, errors.New("a layer can't have both a Path and an UploadName"))
+				return postLayerRoute, http.StatusBadRequest
+			}
+
+			var err error
+			if path, err = uploadPath(ctx, layer.UploadName); err == nil {
+				_, err = os.Stat(path)
+			}
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, errors.New("could not find upload "+layer.UploadName))
+				return postLayerRoute, http.StatusBadRequest
+			}
+
+			// Keep the upload from being appended to or removed while it's analyzed.
+			release, err := acquireUpload(path)
+			if err != nil {
+				writeError(w, r, http.StatusConflict, err)
+				return postLayerRoute, http.StatusConflict
+			}
+			defer release()
+		}
+	}
+
+	priority, err := worker.ParsePriority(layer.Priority)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return postLayerRoute, http.StatusBadRequest
+	}
+	if err := validateLabels(layer.Labels); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return postLayerRoute, http.StatusBadRequest
+	}
+
+	err = ctx.Queue.Process(r.Context(), ctx.Store, priority, layer.Format, layer.Name, layer.ParentName, path, layer.Digest, layer.Headers)
+	if err != nil {
+		if err == worker.ErrQueueFull {
+			w.Header().Set("Retry-After", strconv.Itoa(int(worker.QueueRetryAfter.Seconds())))
+			writeError(w, r, http.StatusServiceUnavailable, err)
+			return postLayerRoute, http.StatusServiceUnavailable
+		}
+
+		if err == utils.ErrCouldNotExtract ||
+			err == utils.ErrInsecureArchive ||
+			err == worker.ErrUnsupported ||
+			isBudgetExceeded(err) {
+			writeError(w, r, statusUnprocessableEntity, err)
+			return postLayerRoute, statusUnprocessableEntity
+		}
+
+		status := writeDatastoreError(w, r, err)
+		return postLayerRoute, status
+	}
+
+	if layer.UploadName != "" {
+		if err := os.Remove(path); err != nil {
+			log.Warningf("could not remove upload %s: %s", layer.UploadName, err)
+		}
+	}
+
+	// Labels are attached to layers that were already indexed as well.
+	if len(layer.Labels) > 0 {
+		if err := ctx.Store.InsertLayerLabels(layer.Name, layer.Labels); err != nil {
+			status := writeDatastoreError(w, r, err)
+			return postLayerRoute, status
+		}
+	}
+
+	layer.IndexedByVersion = worker.Version
+	writeResponse(w, r, http.StatusCreated, layer)
+	return postLayerRoute, http.StatusCreated
+}
+
+// decodeMultipartLayer decodes a multipart/form-data request made of a "layer" part, holding the
+// layer as JSON, and a "tarball" part. The tarball is streamed to a temporary file whose path is
+// returned; the caller is responsible for removing it.
+func decodeMultipartLayer(r *http.Request, ctx *context.RouteContext, layer *Layer) (path string, err error) {
+	defer r.Body.Close()
+	defer func() {
+		if err != nil && path != "" {
+			os.Remove(path)
+			path = ""
+		}
+	}()
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", err
+	}
+
+	var hasLayer bool
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return path, err
+		}
+
+		switch part.FormName() {
+		case "layer":
+			if err := json.NewDecoder(io.LimitReader(part, maxBodySize)).Decode(layer); err != nil {
+				return path, err
+			}
+			hasLayer = true
+		case "tarball":
+			if path != "" {
+				return path, errors.New("multiple tarball parts")
+			}
+			if path, err = writeTemporaryUpload(ctx, part); err != nil {
+				return path, err
+			}
+		}
+	}
+
+	switch {
+	case !hasLayer:
+		return path, errors.New("missing layer part")
+	case path == "":
+		return path, errors.New("missing tarball part")
+	case layer.Path != "" || layer.UploadName != "":
+		return path, errors.New("a layer sent with its tarball can't have a Path or an UploadName")
+	}
+	return path, nil
+}
+
+func postUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	upload, err := createUpload(ctx)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return postUploadRoute, status
+	}
+
+	w.Header().Set("Location", "/v2/uploads/"+upload.Name)
+	writeResponse(w, r, http.StatusCreated, upload)
+	return postUploadRoute, http.StatusCreated
+}
+
+func getUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	upload, err := statUpload(ctx, p.ByName("uploadName"))
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getUploadRoute, status
+	}
+
+	writeResponse(w, r, http.StatusOK, upload)
+	return getUploadRoute, http.StatusOK
+}
+
+func patchUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	defer r.Body.Close()
+
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeError(w, r, http.StatusBadRequest, errors.New("invalid or missing offset"))
+		return patchUploadRoute, http.StatusBadRequest
+	}
+
+	// The chunk is read one byte past the remaining size so that appendUpload notices the excess.
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize(ctx)-offset+1)
+	upload, err := appendUpload(ctx, p.ByName("uploadName"), offset, r.Body)
+	if err == errUploadOffset || err == errUploadBusy {
+		writeError(w, r, http.StatusConflict, err)
+		return patchUploadRoute, http.StatusConflict
+	} else if err == errUploadTooLarge {
+		writeError(w, r, http.StatusRequestEntityTooLarge, err)
+		return patchUploadRoute, http.StatusRequestEntityTooLarge
+	} else if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return patchUploadRoute, status
+	}
+
+	writeResponse(w, r, http.StatusOK, upload)
+	return patchUploadRoute, http.StatusOK
+}
+
+func deleteUpload(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	if err := removeUpload(ctx, p.ByName("uploadName")); err == errUploadBusy {
+		writeError(w, r, http.StatusConflict, err)
+		return deleteUploadRoute, http.StatusConflict
+	} else if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return deleteUploadRoute, status
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return deleteUploadRoute, http.StatusNoContent
+}
+
+// validateLabels returns an error if any of the labels can't be stored.
+func validateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if key == "" || len(key) > maxLabelKeySize {
+			return fmt.Errorf("label keys must have between 1 and %d bytes", maxLabelKeySize)
+		}
+		if len(value) > maxLabelValueSize {
+			return fmt.Errorf("label values must have at most %d bytes", maxLabelValueSize)
+		}
+	}
+	return nil
+}
+
+// getLayers lists the layers having every label given as a "label" query parameter, as
+// "key=value".
+func getLayers(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	startID := 0
+	limit, err := parsePagination(r, ctx.Config.PaginationKey, &startID)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return getLayersRoute, http.StatusBadRequest
+	}
+
+	labels := make(map[string]string)
+	for _, label := range r.URL.Query()["label"] {
+		i := strings.Index(label, "=")
+		if i <= 0 {
+			writeError(w, r, http.StatusBadRequest, errors.New("labels must be given as key=value"))
+			return getLayersRoute, http.StatusBadRequest
+		}
+		labels[label[:i]] = label[i+1:]
+	}
+
+	dbLayers, nextID, err := ctx.Store.ListLayers(labels, limit, startID)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getLayersRoute, status
+	}
+
+	page := LayerPage{Layers: []Layer{}}
+	for _, dbLayer := range dbLayers {
+		page.Layers = append(page.Layers, layerFromDatabaseModel(dbLayer))
+	}
+
+	if nextID != -1 {
+		cursor, err := token.Marshal(nextID, ctx.Config.PaginationKey)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err)
+			return getLayersRoute, http.StatusInternalServerError
+		}
+		page.NextCursor = string(cursor)
+	}
+
+	writeResponse(w, r, http.StatusOK, page)
+	return getLayersRoute, http.StatusOK
+}
+
+func getLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	dbLayer, err := ctx.Store.FindLayer(p.ByName("layerName"), false, false)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getLayerRoute, status
+	}
+
+	writeResponse(w, r, http.StatusOK, layerFromDatabaseModel(dbLayer))
+	return getLayerRoute, http.StatusOK
+}
+
+func deleteLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	if err := ctx.Store.DeleteLayer(p.ByName("layerName")); err != nil {
+		status := writeDatastoreError(w, r, err)
+		return deleteLayerRoute, status
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return deleteLayerRoute, http.StatusNoContent
+}
+
+func getReport(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	status := writeReport(w, r, ctx, p.ByName("layerName"), nil)
+	return getReportRoute, status
+}
+
+// writeReport writes the report of the layer, with the upgrades of its base image, and returns the
+// status of the response.
+func writeReport(w http.ResponseWriter, r *http.Request, ctx *context.RouteContext, layerName string, dbWatchedTag *database.WatchedTag) int {
+	report, err := buildReport(ctx, layerName, dbWatchedTag)
+	if err != nil {
+		return writeDatastoreError(w, r, err)
+	}
+	if report.BaseImage, err = recommendBaseImage(ctx, report); err != nil {
+		return writeDatastoreError(w, r, err)
+	}
+	writeResponse(w, r, http.StatusOK, report)
+	return http.StatusOK
+}
+
+// buildReport returns the report of the layer. The report of the image of a watched tag also has
+// the signature status and the provenances of the image.
+func buildReport(ctx *context.RouteContext, layerName string, dbWatchedTag *database.WatchedTag) (Report, error) {
+	dbLayer, err := ctx.Store.FindLayer(layerName, true, true)
+	if err != nil {
+		return Report{}, err
+	}
+
+	var dbVulns []database.Vulnerability
+	for _, dbFeatureVersion := range dbLayer.Features {
+		dbVulns = append(dbVulns, dbFeatureVersion.AffectedBy...)
+	}
+	dbFalsePositives, err := ctx.Store.FindFalsePositives(dbVulns)
+	if err != nil {
+		return Report{}, err
+	}
+
+	exclude := ctx.Config != nil && ctx.Config.FalsePositives == excludeFalsePositives
+	excludeKernel := ctx.Config != nil && ctx.Config.KernelVulnerabilities == excludeKernelVulnerabilities
+	report := reportFromDatabaseModel(dbLayer, dbFalsePositives, exclude, excludeKernel)
+	if dbWatchedTag != nil {
+		report.Signature = string(dbWatchedTag.Signature)
+		report.Owners = ownership.Owners(registry.ImageName(dbWatchedTag.Registry, dbWatchedTag.Repository))
+
+		if dbWatchedTag.Digest != "" {
+			dbProvenances, err := ctx.Store.FindProvenances(dbWatchedTag.Digest)
+			if err != nil {
+				return Report{}, err
+			}
+			for _, dbProvenance := range dbProvenances {
+				report.Provenances = append(report.Provenances, provenanceFromDatabaseModel(dbProvenance))
+			}
+		}
+	}
+	return report, nil
+}
+
+func getVulnerabilities(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	startID := 0
+	limit, err := parsePagination(r, ctx.Config.PaginationKey, &startID)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return getVulnerabilitiesRoute, http.StatusBadRequest
+	}
+
+	dbVulns, nextID, err := ctx.Store.ListVulnerabilities(p.ByName("namespaceName"), limit, startID)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getVulnerabilitiesRoute, status
+	}
+
+	page := VulnerabilityPage{Vulnerabilities: []Vulnerability{}}
+	for _, dbVuln := range dbVulns {
+		page.Vulnerabilities = append(page.Vulnerabilities, vulnerabilityFromDatabaseModel(dbVuln))
+	}
+
+	if nextID != -1 {
+		cursor, err := token.Marshal(nextID, ctx.Config.PaginationKey)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err)
+			return getVulnerabilitiesRoute, http.StatusInternalServerError
+		}
+		page.NextCursor = string(cursor)
+	}
+
+	writeResponse(w, r, http.StatusOK, page)
+	return getVulnerabilitiesRoute, http.StatusOK
+}
+
+func getVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	dbVuln, err := ctx.Store.FindVulnerability(p.ByName("namespaceName"), p.ByName("vulnerabilityName"))
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getVulnerabilityRoute, status
+	}
+
+	w.Header().Set("ETag", vulnerabilityETag(dbVuln))
+	writeResponse(w, r, http.StatusOK, vulnerabilityFromDatabaseModel(dbVuln))
+	return getVulnerabilityRoute, http.StatusOK
+}
+
+func getNotification(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	page := database.VulnerabilityNotificationFirstPage
+	limit, err := parsePagination(r, ctx.Config.PaginationKey, &page)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return getNotificationRoute, http.StatusBadRequest
+	}
+
+	notification, err := findNotification(ctx, p.ByName("notificationName"), limit, page)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getNotificationRoute, status
+	}
+
+	writeResponse(w, r, http.StatusOK, notification)
+	return getNotificationRoute, http.StatusOK
+}
+
+// findNotification returns the given page of the notification, along with the cursor of the next
+// one and the owners of the affected images.
+func findNotification(ctx *context.RouteContext, name string, limit int, page database.VulnerabilityNotificationPageNumber) (Notification, error) {
+	dbNotification, nextPage, err := ctx.Store.GetNotification(name, limit, page)
+	if err != nil {
+		return Notification{}, err
+	}
+
+	notification := notificationFromDatabaseModel(dbNotification)
+	if ownership.Enabled() {
+		dbWatchedTags, err := ctx.Store.ListNotificationWatchedTags(dbNotification.Name)
+		if err != nil {
+			return Notification{}, err
+		}
+		notification.Owners = watchedTagsOwners(dbWatchedTags)
+	}
+	if nextPage != database.NoVulnerabilityNotificationPage {
+		cursor, err := token.Marshal(nextPage, ctx.Config.PaginationKey)
+		if err != nil {
+			return Notification{}, err
+		}
+		notification.NextCursor = string(cursor)
+	}
+	return notification, nil
+}
+
+func getNotificationDiff(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	startID := 0
+	limit, err := parsePagination(r, ctx.Config.PaginationKey, &startID)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return getNotificationDiffRoute, http.StatusBadRequest
+	}
+
+	dbNotification, dbDiff, nextID, err := database.DiffNotificationLayers(ctx.Store, p.ByName("notificationName"), limit, startID)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getNotificationDiffRoute, status
+	}
+
+	diff := notificationLayersDiffFromDatabaseModel(dbDiff)
+	diff.Name = dbNotification.Name
+	if nextID != -1 {
+		cursor, err := token.Marshal(nextID, ctx.Config.PaginationKey)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err)
+			return getNotificationDiffRoute, http.StatusInternalServerError
+		}
+		diff.NextCursor = string(cursor)
+	}
+
+	writeResponse(w, r, http.StatusOK, diff)
+	return getNotificationDiffRoute, http.StatusOK
+}
+
+func deleteNotification(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	if err := ctx.Store.DeleteNotification(p.ByName("notificationName")); err != nil {
+		status := writeDatastoreError(w, r, err)
+		return deleteNotificationRoute, status
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return deleteNotificationRoute, http.StatusNoContent
+}
+
+func postFalsePositive(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	var falsePositive FalsePositive
+	if err := decodeJSON(r, &falsePositive); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return postFalsePositiveRoute, http.StatusBadRequest
+	}
+
+	// Only findings of known vulnerabilities can be flagged.
+	dbVuln, err := ctx.Store.FindVulnerability(falsePositive.NamespaceName, falsePositive.VulnerabilityName)
+	if err == cerrors.ErrNotFound {
+		writeError(w, r, http.StatusBadRequest, errors.New("could not find vulnerability "+falsePositive.VulnerabilityName))
+		return postFalsePositiveRoute, http.StatusBadRequest
+	} else if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return postFalsePositiveRoute, status
+	}
+
+	dbFalsePositive := falsePositive.databaseModel()
+	dbFalsePositive.Namespace = dbVuln.Namespace
+	dbFalsePositive, err = ctx.Store.InsertFalsePositive(dbFalsePositive)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return postFalsePositiveRoute, status
+	}
+
+	writeResponse(w, r, http.StatusCreated, falsePositiveFromDatabaseModel(dbFalsePositive))
+	return postFalsePositiveRoute, http.StatusCreated
+}
+
+func getFalsePositives(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	startID := 0
+	limit, err := parsePagination(r, ctx.Config.PaginationKey, &startID)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return getFalsePositivesRoute, http.StatusBadRequest
+	}
+
+	dbFalsePositives, nextID, err := ctx.Store.ListFalsePositives(limit, startID)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getFalsePositivesRoute, status
+	}
+
+	page := FalsePositivePage{FalsePositives: []FalsePositive{}}
+	for _, dbFalsePositive := range dbFalsePositives {
+		page.FalsePositives = append(page.FalsePositives, falsePositiveFromDatabaseModel(dbFalsePositive))
+	}
+
+	if nextID != -1 {
+		cursor, err := token.Marshal(nextID, ctx.Config.PaginationKey)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err)
+			return getFalsePositivesRoute, http.StatusInternalServerError
+		}
+		page.NextCursor = string(cursor)
+	}
+
+	writeResponse(w, r, http.StatusOK, page)
+	return getFalsePositivesRoute, http.StatusOK
+}
+
+func deleteFalsePositive(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	if err := ctx.Store.DeleteFalsePositive(p.ByName("falsePositiveName")); err != nil {
+		status := writeDatastoreError(w, r, err)
+		return deleteFalsePositiveRoute, status
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return deleteFalsePositiveRoute, http.StatusNoContent
+}
+
+func postWatch(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	var watch Watch
+	if err := decodeJSON(r, &watch); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return postWatchRoute, http.StatusBadRequest
+	}
+
+	if u, err := url.Parse(watch.Registry); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, r, http.StatusBadRequest, errors.New("the registry must be an http or https URL"))
+		return postWatchRoute, http.StatusBadRequest
+	}
+
+	dbWatchedTag, err := ctx.Store.InsertWatchedTag(database.WatchedTag{
+		Registry:   strings.TrimSuffix(watch.Registry, "/"),
+		Repository: watch.Repository,
+		Tag:        watch.Tag,
+	})
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return postWatchRoute, status
+	}
+
+	writeResponse(w, r, http.StatusCreated, watchFromDatabaseModel(dbWatchedTag))
+	return postWatchRoute, http.StatusCreated
+}
+
+func getWatches(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	startID := 0
+	limit, err := parsePagination(r, ctx.Config.PaginationKey, &startID)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return getWatchesRoute, http.StatusBadRequest
+	}
+
+	dbWatchedTags, nextID, err := ctx.Store.ListWatchedTags(limit, startID)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getWatchesRoute, status
+	}
+
+	page := WatchPage{Watches: []Watch{}}
+	for _, dbWatchedTag := range dbWatchedTags {
+		page.Watches = append(page.Watches, watchFromDatabaseModel(dbWatchedTag))
+	}
+
+	if nextID != -1 {
+		cursor, err := token.Marshal(nextID, ctx.Config.PaginationKey)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err)
+			return getWatchesRoute, http.StatusInternalServerError
+		}
+		page.NextCursor = string(cursor)
+	}
+
+	writeResponse(w, r, http.StatusOK, page)
+	return getWatchesRoute, http.StatusOK
+}
+
+func getWatch(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	dbWatchedTag, err := ctx.Store.FindWatchedTag(p.ByName("watchName"))
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getWatchRoute, status
+	}
+
+	writeResponse(w, r, http.StatusOK, watchFromDatabaseModel(dbWatchedTag))
+	return getWatchRoute, http.StatusOK
+}
+
+func getWatchReport(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	dbWatchedTag, err := ctx.Store.FindWatchedTag(p.ByName("watchName"))
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getWatchReportRoute, status
+	}
+	if dbWatchedTag.LayerName == "" {
+		writeError(w, r, http.StatusNotFound, errors.New("the tag has not been indexed yet"))
+		return getWatchReportRoute, http.StatusNotFound
+	}
+
+	status := writeReport(w, r, ctx, dbWatchedTag.LayerName, &dbWatchedTag)
+	return getWatchReportRoute, status
+}
+
+func deleteWatch(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	if err := ctx.Store.DeleteWatchedTag(p.ByName("watchName")); err != nil {
+		status := writeDatastoreError(w, r, err)
+		return deleteWatchRoute, status
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return deleteWatchRoute, http.StatusNoContent
+}
+
+func getManifest(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	dbImage, err := ctx.Store.FindImage(p.ByName("digest"))
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getManifestRoute, status
+	}
+
+	writeResponse(w, r, http.StatusOK, manifestFromDatabaseModel(dbImage))
+	return getManifestRoute, http.StatusOK
+}
+
+func getManifestReport(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	dbImage, err := ctx.Store.FindImage(p.ByName("digest"))
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getManifestReportRoute, status
+	}
+
+	status := writeReport(w, r, ctx, dbImage.LayerName, nil)
+	return getManifestReportRoute, status
+}
+
+// getImage resolves the image named by a watch, or by the digest of its manifest, to its top layer.
+func getImage(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	name := p.ByName("name")
+	dbWatchedTag, err := ctx.Store.FindWatchedTag(name)
+	switch {
+	case err == nil && dbWatchedTag.LayerName == "":
+		writeError(w, r, http.StatusNotFound, errors.New("the tag has not been indexed yet"))
+		return getImageRoute, http.StatusNotFound
+	case err == nil:
+		writeResponse(w, r, http.StatusOK, Image{
+			Name:      name,
+			Image:     registry.ImageName(dbWatchedTag.Registry, dbWatchedTag.Repository) + ":" + dbWatchedTag.Tag,
+			Digest:    dbWatchedTag.Digest,
+			LayerName: dbWatchedTag.LayerName,
+		})
+		return getImageRoute, http.StatusOK
+	case err != cerrors.ErrNotFound:
+		status := writeDatastoreError(w, r, err)
+		return getImageRoute, status
+	}
+
+	dbImage, err := ctx.Store.FindImage(name)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getImageRoute, status
+	}
+	writeResponse(w, r, http.StatusOK, Image{Name: name, Digest: dbImage.Digest, LayerName: dbImage.LayerName})
+	return getImageRoute, http.StatusOK
+}
+
+func getMoves(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	startID := 0
+	limit, err := parsePagination(r, ctx.Config.PaginationKey, &startID)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return getMovesRoute, http.StatusBadRequest
+	}
+
+	dbWatchedTags, nextID, err := ctx.Store.ListMovedWatchedTags(limit, startID)
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getMovesRoute, status
+	}
+
+	page := MovePage{Moves: []Move{}}
+	for _, dbWatchedTag := range dbWatchedTags {
+		page.Moves = append(page.Moves, moveFromDatabaseModel(dbWatchedTag))
+	}
+
+	if nextID != -1 {
+		cursor, err := token.Marshal(nextID, ctx.Config.PaginationKey)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err)
+			return getMovesRoute, http.StatusInternalServerError
+		}
+		page.NextCursor = string(cursor)
+	}
+
+	writeResponse(w, r, http.StatusOK, page)
+	return getMovesRoute, http.StatusOK
+}
+
+func deleteMove(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	dbWatchedTag, err := ctx.Store.FindWatchedTag(p.ByName("watchName"))
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return deleteMoveRoute, status
+	}
+
+	// The digest that has been listed can be given so that a move happening meanwhile is still
+	// reported. Otherwise, the current digest is acknowledged.
+	digest := dbWatchedTag.Digest
+	if listed := r.URL.Query().Get("digest"); listed != "" {
+		digest = listed
+	}
+
+	if err := ctx.Store.MarkWatchedTagReported(dbWatchedTag.Name, digest); err != nil {
+		status := writeDatastoreError(w, r, err)
+		return deleteMoveRoute, status
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return deleteMoveRoute, http.StatusNoContent
+}
+
+func postProvenance(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	var statement json.RawMessage
+	if err := decodeJSON(r, &statement); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return postProvenanceRoute, http.StatusBadRequest
+	}
+
+	dbProvenances, err := provenancesFromStatement(statement)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return postProvenanceRoute, http.StatusBadRequest
+	}
+
+	list := ProvenanceList{Provenances: []Provenance{}}
+	for _, dbProvenance := range dbProvenances {
+		dbProvenance, err = ctx.Store.InsertProvenance(dbProvenance)
+		if err != nil {
+			status := writeDatastoreError(w, r, err)
+			return postProvenanceRoute, status
+		}
+		list.Provenances = append(list.Provenances, provenanceFromDatabaseModel(dbProvenance))
+	}
+
+	writeResponse(w, r, http.StatusCreated, list)
+	return postProvenanceRoute, http.StatusCreated
+}
+
+func getProvenances(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	dbProvenances, err := ctx.Store.FindProvenances(p.ByName("digest"))
+	if err != nil {
+		status := writeDatastoreError(w, r, err)
+		return getProvenancesRoute, status
+	}
+
+	list := ProvenanceList{Provenances: []Provenance{}}
+	for _, dbProvenance := range dbProvenances {
+		list.Provenances = append(list.Provenances, provenanceFromDatabaseModel(dbProvenance))
+	}
+
+	writeResponse(w, r, http.StatusOK, list)
+	return getProvenancesRoute, http.StatusOK
+}
@@ -0,0 +1,440 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fernet/fernet-go"
+	"github.com/golang/protobuf/proto"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	netcontext "golang.org/x/net/context"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/api/v2/clairpb"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ownership"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/worker"
+)
+
+func TestWriteResponseNegotiation(t *testing.T) {
+	vuln := Vulnerability{
+		Name:          "CVE-OPENSSL-1-DEB7",
+		NamespaceName: "debian:7",
+		Severity:      "High",
+		Metadata:      map[string]interface{}{"NVD": map[string]interface{}{"Score": 7.5}},
+		Sources:       []VulnerabilitySource{{Name: "Debian Security Tracker"}},
+		FixedIn:       []Feature{{Name: "openssl", NamespaceName: "debian:7", Version: "2.0"}},
+	}
+
+	// JSON is served by default.
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	writeResponse(w, r, http.StatusOK, vuln)
+	assert.Equal(t, "application/json;charset=utf-8", w.Header().Get("Content-Type"))
+	var jsonVuln Vulnerability
+	if assert.Nil(t, json.NewDecoder(w.Body).Decode(&jsonVuln)) {
+		assert.Equal(t, vuln.Name, jsonVuln.Name)
+	}
+
+	// Protocol Buffers are served on request.
+	r.Header.Set("Accept", protobufContentType)
+	w = httptest.NewRecorder()
+	writeResponse(w, r, http.StatusOK, vuln)
+	assert.Equal(t, protobufContentType, w.Header().Get("Content-Type"))
+	var pbVuln clairpb.Vulnerability
+	if assert.Nil(t, proto.Unmarshal(w.Body.Bytes(), &pbVuln)) {
+		assert.Equal(t, vuln.Name, pbVuln.Name)
+		assert.Equal(t, vuln.Severity, pbVuln.Severity)
+		assert.JSONEq(t, `{"NVD":{"Score":7.5}}`, pbVuln.Metadata)
+		if assert.Len(t, pbVuln.Sources, 1) {
+			assert.Equal(t, "Debian Security Tracker", pbVuln.Sources[0].Name)
+		}
+		if assert.Len(t, pbVuln.FixedIn, 1) {
+			assert.Equal(t, "2.0", pbVuln.FixedIn[0].Version)
+		}
+	}
+
+	// Resources without a Protocol Buffers message are still served as JSON.
+	w = httptest.NewRecorder()
+	writeResponse(w, r, http.StatusOK, Layer{Name: "layer"})
+	assert.Equal(t, "application/json;charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestAcceptsProtobuf(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":                              false,
+		"*/*":                           false,
+		"application/json":              false,
+		"application/x-protobuf":        true,
+		"application/x-protobuf;q=0":    false,
+		"application/x-protobuf; q=0.0": false,
+		"application/x-protobuf;q=0.5, */*;q=0.1":                             true,
+		"application/x-protobuf;q=0.5, application/json":                      false,
+		"application/json;q=0.5, application/x-protobuf":                      true,
+		"application/json, application/x-protobuf":                            true,
+		"application/x-protobuf;q=0.5, application/*":                         false,
+		"application/x-protobuf;q=0.5, application/*, application/json;q=0.1": true,
+		"application/x-protobuf;q=invalid":                                    false,
+		"application/x-protobufs":                                             false,
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		assert.Equal(t, expected, acceptsProtobuf(r), accept)
+	}
+}
+
+func TestPostLayerBackpressure(t *testing.T) {
+	// A queue holding a single layer, which is already being indexed.
+	indexing := make(chan struct{})
+	defer close(indexing)
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			<-indexing
+			return database.Layer{}, errors.New("interrupted")
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Queue: worker.NewQueue(1, 1)}
+	go ctx.Queue.Process(netcontext.Background(), ctx.Store, worker.Bulk, "Docker", "indexing", "", "/layer.tar", "", nil)
+	for ctx.Queue.Depth() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/layers", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		postLayer(w, r, nil, ctx)
+		return w
+	}
+
+	w := post(`{"Name": "layer", "Path": "/layer.tar", "Format": "Docker", "Priority": "urgent"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = post(`{"Name": "layer", "Path": "/layer.tar", "Format": "Docker", "Priority": "interactive"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+}
+
+func TestMoves(t *testing.T) {
+	watchedTag := database.WatchedTag{
+		Name:           "watch",
+		Registry:       "https://registry.example.com",
+		Repository:     "debian",
+		Tag:            "latest",
+		Digest:         "sha256:new",
+		ReportedDigest: "sha256:old",
+	}
+	var reported []string
+	datastore := &database.MockDatastore{
+		FctListMovedWatchedTags: func(limit int, page int) ([]database.WatchedTag, int, error) {
+			return []database.WatchedTag{watchedTag}, -1, nil
+		},
+		FctFindWatchedTag: func(name string) (database.WatchedTag, error) {
+			return watchedTag, nil
+		},
+		FctMarkWatchedTagReported: func(name, digest string) error {
+			reported = append(reported, digest)
+			return nil
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{}}
+
+	r, _ := http.NewRequest("GET", "/moves", nil)
+	w := httptest.NewRecorder()
+	getMoves(w, r, nil, ctx)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		var page MovePage
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&page))
+		if assert.Len(t, page.Moves, 1) {
+			assert.Equal(t, "sha256:old", page.Moves[0].OldDigest)
+			assert.Equal(t, "sha256:new", page.Moves[0].NewDigest)
+		}
+	}
+
+	params := httprouter.Params{{Key: "watchName", Value: "watch"}}
+	r, _ = http.NewRequest("DELETE", "/moves/watch?digest=sha256:listed", nil)
+	w = httptest.NewRecorder()
+	deleteMove(w, r, params, ctx)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	r, _ = http.NewRequest("DELETE", "/moves/watch", nil)
+	w = httptest.NewRecorder()
+	deleteMove(w, r, params, ctx)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	assert.Equal(t, []string{"sha256:listed", "sha256:new"}, reported)
+}
+
+func TestGetLayers(t *testing.T) {
+	var filtered map[string]string
+	datastore := &database.MockDatastore{
+		FctListLayers: func(labels map[string]string, limit int, page int) ([]database.Layer, int, error) {
+			filtered = labels
+			return []database.Layer{{Name: "layer", Labels: labels}}, -1, nil
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{}}
+
+	get := func(url string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		getLayers(w, r, nil, ctx)
+		return w
+	}
+
+	w := get("/layers?label=team=payments&label=sha=a%3Db")
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Equal(t, map[string]string{"team": "payments", "sha": "a=b"}, filtered)
+		var page LayerPage
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&page))
+		if assert.Len(t, page.Layers, 1) {
+			assert.Equal(t, "payments", page.Layers[0].Labels["team"])
+		}
+		assert.Empty(t, page.NextCursor)
+	}
+
+	w = get("/layers?label=team")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Reads are retried once the schema is migrated, e.g. by the instances of the new version.
+	datastore.FctListLayers = func(labels map[string]string, limit int, page int) ([]database.Layer, int, error) {
+		return nil, 0, database.ErrMigrationInProgress
+	}
+	w = get("/layers")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+
+	// Labels that can't be stored are rejected.
+	assert.Nil(t, validateLabels(map[string]string{"team": "payments", "env": ""}))
+	assert.Error(t, validateLabels(map[string]string{"": "payments"}))
+	assert.Error(t, validateLabels(map[string]string{"team": strings.Repeat("a", maxLabelValueSize+1)}))
+}
+
+func TestOwners(t *testing.T) {
+	m, err := ownership.Parse([]byte("rules:\n  - pattern: registry.example.com/payments\n    owners: [payments]\n"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	ownership.Set(m)
+	defer ownership.Set(nil)
+
+	watchedTags := []database.WatchedTag{
+		{Name: "api", Registry: "https://registry.example.com", Repository: "payments/api", LayerName: "layer"},
+		{Name: "web", Registry: "https://registry.example.com", Repository: "web", LayerName: "layer"},
+	}
+	datastore := &database.MockDatastore{
+		FctFindWatchedTag: func(name string) (database.WatchedTag, error) {
+			return watchedTags[0], nil
+		},
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{Name: name}, nil
+		},
+		FctFindFalsePositives: func([]database.Vulnerability) ([]database.FalsePositive, error) {
+			return nil, nil
+		},
+		FctFindProvenances: func(digest string) ([]database.Provenance, error) {
+			return nil, nil
+		},
+		FctGetNotification: func(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
+			return database.VulnerabilityNotification{Name: name}, database.NoVulnerabilityNotificationPage, nil
+		},
+		FctListNotificationWatchedTags: func(name string) ([]database.WatchedTag, error) {
+			return watchedTags, nil
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{}}
+
+	r, _ := http.NewRequest("GET", "/watches/api/report", nil)
+	w := httptest.NewRecorder()
+	getWatchReport(w, r, httprouter.Params{{Key: "watchName", Value: "api"}}, ctx)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		var report Report
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&report))
+		assert.Equal(t, []string{"payments"}, report.Owners)
+	}
+
+	r, _ = http.NewRequest("GET", "/notifications/notification", nil)
+	w = httptest.NewRecorder()
+	getNotification(w, r, httprouter.Params{{Key: "notificationName", Value: "notification"}}, ctx)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		var notification Notification
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&notification))
+		assert.Equal(t, []string{"payments"}, notification.Owners)
+	}
+}
+
+func TestGetNotificationDiff(t *testing.T) {
+	layer := func(id int, name string) database.Layer {
+		return database.Layer{Model: database.Model{ID: id}, Name: name}
+	}
+	datastore := &database.MockDatastore{
+		FctGetNotification: func(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
+			if name != "notification" {
+				return database.VulnerabilityNotification{}, page, cerrors.ErrNotFound
+			}
+			notification := database.VulnerabilityNotification{
+				Name:             name,
+				OldVulnerability: &database.Vulnerability{},
+				NewVulnerability: &database.Vulnerability{},
+			}
+			if page.OldVulnerability == 0 {
+				notification.OldVulnerability.LayersIntroducingVulnerability = []database.Layer{layer(1, "base"), layer(2, "app")}
+				notification.NewVulnerability.LayersIntroducingVulnerability = []database.Layer{layer(2, "app")}
+				return notification, database.VulnerabilityNotificationPageNumber{OldVulnerability: -1, NewVulnerability: 3}, nil
+			}
+			notification.NewVulnerability.LayersIntroducingVulnerability = []database.Layer{layer(3, "web")}
+			return notification, database.NoVulnerabilityNotificationPage, nil
+		},
+	}
+	var key fernet.Key
+	assert.Nil(t, key.Generate())
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{PaginationKey: key.Encode()}}
+	params := httprouter.Params{{Key: "notificationName", Value: "notification"}}
+
+	r, _ := http.NewRequest("GET", "/notifications/notification/diff?limit=2", nil)
+	w := httptest.NewRecorder()
+	getNotificationDiff(w, r, params, ctx)
+	var diff NotificationLayersDiff
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&diff))
+		assert.Equal(t, "notification", diff.Name)
+		assert.Equal(t, []string{}, diff.Added)
+		assert.Equal(t, []string{"base"}, diff.Removed)
+		assert.Equal(t, []string{"app"}, diff.Unchanged)
+		assert.NotEmpty(t, diff.NextCursor)
+	}
+
+	r, _ = http.NewRequest("GET", "/notifications/notification/diff?limit=2&cursor="+diff.NextCursor, nil)
+	w = httptest.NewRecorder()
+	getNotificationDiff(w, r, params, ctx)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		diff = NotificationLayersDiff{}
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&diff))
+		assert.Equal(t, []string{"web"}, diff.Added)
+		assert.Empty(t, diff.NextCursor)
+	}
+
+	r, _ = http.NewRequest("GET", "/notifications/unknown/diff", nil)
+	w = httptest.NewRecorder()
+	getNotificationDiff(w, r, httprouter.Params{{Key: "notificationName", Value: "unknown"}}, ctx)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReadOnly(t *testing.T) {
+	// The datastore must not be modified, which the mock would panic on.
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{Name: name}, nil
+		},
+	}
+	router := NewRouter(&context.RouteContext{Store: datastore, Config: &config.APIConfig{ReadOnly: true}})
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, path, strings.NewReader("{}"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, request := range [][2]string{
+		{"POST", "/layers"},
+		{"DELETE", "/layers/layer"},
+		{"POST", "/uploads"},
+		{"PATCH", "/uploads/upload"},
+		{"DELETE", "/uploads/upload"},
+		{"POST", "/namespaces/debian:8/vulnerabilities"},
+		{"PUT", "/namespaces/debian:8/vulnerabilities/CVE-2014-9471/fixes/coreutils"},
+		{"DELETE", "/notifications/notification"},
+		{"POST", "/watches"},
+		{"DELETE", "/watches/watch"},
+		{"POST", "/provenances"},
+		{"DELETE", "/moves/watch"},
+		{"POST", "/falsepositives"},
+		{"DELETE", "/falsepositives/falsepositive"},
+	} {
+		w := serve(request[0], request[1])
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, request[0]+" "+request[1])
+		assert.Contains(t, w.Body.String(), "clair is in read-only mode", request[0]+" "+request[1])
+	}
+
+	assert.Equal(t, http.StatusOK, serve("GET", "/layers/layer").Code)
+}
+
+func TestImages(t *testing.T) {
+	datastore := &database.MockDatastore{
+		FctFindWatchedTag: func(name string) (database.WatchedTag, error) {
+			switch name {
+			case "watch":
+				return database.WatchedTag{Name: name, Registry: "https://registry.example.com", Repository: "debian", Tag: "latest", Digest: "sha256:manifest", LayerName: "layer"}, nil
+			case "unresolved":
+				return database.WatchedTag{Name: name}, nil
+			}
+			return database.WatchedTag{}, cerrors.ErrNotFound
+		},
+		FctFindImage: func(digest string) (database.Image, error) {
+			if digest != "sha256:manifest" {
+				return database.Image{}, cerrors.ErrNotFound
+			}
+			return database.Image{Digest: digest, LayerName: "layer", Created: time.Unix(1456247389, 0)}, nil
+		},
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{Name: name}, nil
+		},
+		FctFindFalsePositives: func(vulnerabilities []database.Vulnerability) ([]database.FalsePositive, error) {
+			return nil, nil
+		},
+	}
+	router := NewRouter(&context.RouteContext{Store: datastore, Config: &config.APIConfig{}})
+	get := func(path string, v interface{}) int {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code == http.StatusOK {
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(v), path)
+		}
+		return w.Code
+	}
+
+	var image Image
+	if assert.Equal(t, http.StatusOK, get("/images/watch", &image)) {
+		assert.Equal(t, Image{Name: "watch", Image: "registry.example.com/debian:latest", Digest: "sha256:manifest", LayerName: "layer"}, image)
+	}
+	image = Image{}
+	if assert.Equal(t, http.StatusOK, get("/images/sha256:manifest", &image)) {
+		assert.Equal(t, Image{Name: "sha256:manifest", Digest: "sha256:manifest", LayerName: "layer"}, image)
+	}
+	assert.Equal(t, http.StatusNotFound, get("/images/unresolved", nil))
+	assert.Equal(t, http.StatusNotFound, get("/images/sha256:unknown", nil))
+
+	var manifest Manifest
+	if assert.Equal(t, http.StatusOK, get("/manifests/sha256:manifest", &manifest)) {
+		assert.Equal(t, Manifest{Digest: "sha256:manifest", LayerName: "layer", Created: "1456247389"}, manifest)
+	}
+	assert.Equal(t, http.StatusNotFound, get("/manifests/sha256:unknown", nil))
+
+	var report Report
+	if assert.Equal(t, http.StatusOK, get("/manifests/sha256:manifest/report", &report)) {
+		assert.Equal(t, "layer", report.LayerName)
+	}
+	assert.Equal(t, http.StatusNotFound, get("/manifests/sha256:unknown/report", nil))
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/database"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+
+	// streamFlushLines is the number of lines after which a stream is flushed to the client.
+	streamFlushLines = 100
+)
+
+// A streamError is the last line of a stream that failed after it started.
+type streamError struct {
+	Error Error `json:"Error"`
+}
+
+// An ndjsonWriter writes a response made of one JSON document per line, flushing it regularly so
+// that clients can process it as it comes.
+type ndjsonWriter struct {
+	w       http.ResponseWriter
+	gzip    *gzip.Writer
+	encoder *json.Encoder
+	lines   int
+}
+
+// newNDJSONWriter writes the headers of a successful stream, gzipped if the client supports it.
+func newNDJSONWriter(w http.ResponseWriter, r *http.Request) *ndjsonWriter {
+	s := &ndjsonWriter{w: w, encoder: json.NewEncoder(w)}
+
+	header := w.Header()
+	header.Set("Content-Type", ndjsonContentType)
+	header.Set("Server", "clair")
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		s.gzip = gzip.NewWriter(w)
+		s.encoder = json.NewEncoder(s.gzip)
+
+		header.Set("Content-Encoding", "gzip")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	return s
+}
+
+// encode writes v as a line of the stream.
+func (s *ndjsonWriter) encode(v interface{}) error {
+	if err := s.encoder.Encode(v); err != nil {
+		return err
+	}
+
+	s.lines++
+	if s.lines%streamFlushLines == 0 {
+		s.flush()
+	}
+	return nil
+}
+
+func (s *ndjsonWriter) flush() {
+	if s.gzip != nil {
+		s.gzip.Flush()
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *ndjsonWriter) close() {
+	if s.gzip != nil {
+		s.gzip.Close()
+	}
+}
+
+// getVulnerabilitiesStream streams every vulnerability of a namespace, with its fixes, as NDJSON.
+// The vulnerabilities are read from a single snapshot of the database, so that mirroring clients
+// get a consistent copy while the updaters run.
+func getVulnerabilitiesStream(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context.RouteContext) (string, int) {
+	// The stream starts with the first vulnerability, so that the errors happening before, such as
+	// an unknown namespace, still get their status.
+	var stream *ndjsonWriter
+	err := ctx.Store.StreamVulnerabilities(p.ByName("namespaceName"), func(dbVuln database.Vulnerability) error {
+		if stream == nil {
+			stream = newNDJSONWriter(w, r)
+		}
+		return stream.encode(vulnerabilityFromDatabaseModel(dbVuln))
+	})
+	if stream == nil {
+		if err != nil {
+			status := writeDatastoreError(w, r, err)
+			return getVulnStreamRoute, status
+		}
+		stream = newNDJSONWriter(w, r)
+	}
+	defer stream.close()
+
+	if err != nil {
+		log.Warningf("failed to stream vulnerabilities: %s", err.Error())
+		stream.encode(streamError{Error{Message: err.Error()}})
+	}
+	return getVulnStreamRoute, http.StatusOK
+}
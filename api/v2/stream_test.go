@@ -0,0 +1,94 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestVulnerabilitiesStream(t *testing.T) {
+	namespace := database.Namespace{Name: "debian:8"}
+	vulnerabilities := []database.Vulnerability{
+		{Name: "CVE-2016-0001", Namespace: namespace, Severity: types.High, FixedIn: []database.FeatureVersion{
+			{Feature: database.Feature{Name: "openssl", Namespace: namespace}, Version: "1.0.2"},
+		}},
+		{Name: "CVE-2016-0002", Namespace: namespace, Severity: types.Low},
+	}
+	var streamErr error
+	datastore := &database.MockDatastore{
+		FctStreamVulnerabilities: func(namespaceName string, fn func(database.Vulnerability) error) error {
+			if namespaceName != namespace.Name {
+				return cerrors.ErrNotFound
+			}
+			for _, vulnerability := range vulnerabilities {
+				if err := fn(vulnerability); err != nil {
+					return err
+				}
+			}
+			return streamErr
+		},
+	}
+	ctx := &context.RouteContext{Store: datastore, Config: &config.APIConfig{}}
+
+	stream := func(namespaceName string) (*httptest.ResponseRecorder, []map[string]interface{}) {
+		r, _ := http.NewRequest("GET", "/namespaces/"+namespaceName+"/vulnerabilities.ndjson", nil)
+		w := httptest.NewRecorder()
+		getVulnerabilitiesStream(w, r, httprouter.Params{{Key: "namespaceName", Value: namespaceName}}, ctx)
+
+		var lines []map[string]interface{}
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			if assert.Nil(t, json.Unmarshal(scanner.Bytes(), &line)) {
+				lines = append(lines, line)
+			}
+		}
+		return w, lines
+	}
+
+	// Every vulnerability is a line, along with its fixes.
+	w, lines := stream("debian:8")
+	if assert.Equal(t, http.StatusOK, w.Code) && assert.Len(t, lines, 2) {
+		assert.Equal(t, ndjsonContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, "CVE-2016-0001", lines[0]["Name"])
+		assert.Len(t, lines[0]["FixedIn"], 1)
+		assert.Equal(t, "CVE-2016-0002", lines[1]["Name"])
+	}
+
+	// The errors happening before the first vulnerability have their status.
+	w, _ = stream("unknown")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// The errors happening afterwards end the stream.
+	streamErr = errors.New("connection lost")
+	w, lines = stream("debian:8")
+	if assert.Equal(t, http.StatusOK, w.Code) && assert.Len(t, lines, 3) {
+		assert.Equal(t, map[string]interface{}{"Error": map[string]interface{}{"Message": "connection lost"}}, lines[2])
+	}
+}
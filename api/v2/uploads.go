@@ -0,0 +1,257 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/api/context"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+const (
+	// uploadTTL is the duration after which an upload that hasn't been written to is removed.
+	uploadTTL = 24 * time.Hour
+
+	// defaultMaxUploadSize is the size of the largest layer tarball accepted when the
+	// configuration doesn't specify one.
+	defaultMaxUploadSize int64 = 10 << 30
+)
+
+var (
+	// errUploadOffset is returned when a chunk doesn't start where the upload currently ends.
+	errUploadOffset = errors.New("offset does not match the size of the upload")
+
+	// errUploadBusy is returned when an upload is already being written to, removed or analyzed
+	// by another request.
+	errUploadBusy = errors.New("the upload is in use by another request")
+
+	// errUploadTooLarge is returned when a layer tarball exceeds the maximum upload size.
+	errUploadTooLarge = errors.New("the upload exceeds the maximum size")
+
+	// busyUploads holds the paths of the uploads in use by a request.
+	busyUploads      = make(map[string]struct{})
+	busyUploadsMutex sync.Mutex
+)
+
+// uploadDir returns the directory where the uploads are stored.
+func uploadDir(ctx *context.RouteContext) string {
+	if ctx.Config != nil && ctx.Config.UploadDir != "" {
+		return ctx.Config.UploadDir
+	}
+	return filepath.Join(os.TempDir(), "clair-uploads")
+}
+
+// maxUploadSize returns the size of the largest layer tarball accepted.
+func maxUploadSize(ctx *context.RouteContext) int64 {
+	if ctx.Config != nil && ctx.Config.MaxUploadSize > 0 {
+		return ctx.Config.MaxUploadSize
+	}
+	return defaultMaxUploadSize
+}
+
+// uploadPath returns the path of the file backing the specified upload.
+//
+// Upload names are generated UUIDs, anything else is rejected so names can't escape the upload
+// directory.
+func uploadPath(ctx *context.RouteContext, name string) (string, error) {
+	if uuid.Parse(name) == nil {
+		return "", cerrors.ErrNotFound
+	}
+	return filepath.Join(uploadDir(ctx), name), nil
+}
+
+// acquireUpload marks the upload at the specified path as in use until the returned function is
+// called, so that concurrent requests can't interleave their chunks or remove it while it's being
+// written to or analyzed.
+func acquireUpload(path string) (func(), error) {
+	busyUploadsMutex.Lock()
+	defer busyUploadsMutex.Unlock()
+
+	if _, busy := busyUploads[path]; busy {
+		return nil, errUploadBusy
+	}
+	busyUploads[path] = struct{}{}
+
+	return func() {
+		busyUploadsMutex.Lock()
+		delete(busyUploads, path)
+		busyUploadsMutex.Unlock()
+	}, nil
+}
+
+// copyUpload copies r to f, failing with errUploadTooLarge once more than max bytes are read.
+func copyUpload(f *os.File, r io.Reader, max int64) (int64, error) {
+	if max < 0 {
+		max = 0
+	}
+	n, err := io.Copy(f, io.LimitReader(r, max+1))
+	if err == nil && n > max {
+		err = errUploadTooLarge
+	}
+	return n, err
+}
+
+// createUpload creates an empty upload, removing the ones that have expired along the way.
+func createUpload(ctx *context.RouteContext) (Upload, error) {
+	dir := uploadDir(ctx)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Upload{}, err
+	}
+	removeExpiredUploads(dir)
+
+	upload := Upload{Name: uuid.New()}
+	f, err := os.OpenFile(filepath.Join(dir, upload.Name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return Upload{}, err
+	}
+	return upload, f.Close()
+}
+
+// removeExpiredUploads removes the uploads that haven't been written to for uploadTTL.
+func removeExpiredUploads(dir string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Warningf("could not list uploads: %s", err)
+		return
+	}
+
+	for _, file := range files {
+		if uuid.Parse(file.Name()) == nil || time.Since(file.ModTime()) < uploadTTL {
+			continue
+		}
+
+		path := filepath.Join(dir, file.Name())
+		release, err := acquireUpload(path)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warningf("could not remove expired upload %s: %s", file.Name(), err)
+		}
+		release()
+	}
+}
+
+// statUpload returns the specified upload along with the number of bytes received so far.
+func statUpload(ctx *context.RouteContext, name string) (Upload, error) {
+	path, err := uploadPath(ctx, name)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return Upload{}, cerrors.ErrNotFound
+	} else if err != nil {
+		return Upload{}, err
+	}
+
+	return Upload{Name: name, Offset: info.Size()}, nil
+}
+
+// appendUpload streams the chunk to the end of the specified upload, which must currently be
+// offset bytes long so clients resuming an interrupted upload can't corrupt it.
+//
+// A chunk that would make the upload exceed the maximum size is discarded entirely, while one that
+// is interrupted is kept so that the client can resume from the returned offset.
+func appendUpload(ctx *context.RouteContext, name string, offset int64, chunk io.Reader) (Upload, error) {
+	path, err := uploadPath(ctx, name)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	release, err := acquireUpload(path)
+	if err != nil {
+		return Upload{}, err
+	}
+	defer release()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if os.IsNotExist(err) {
+		return Upload{}, cerrors.ErrNotFound
+	} else if err != nil {
+		return Upload{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return Upload{}, err
+	}
+	if info.Size() != offset {
+		return Upload{}, errUploadOffset
+	}
+
+	n, err := copyUpload(f, chunk, maxUploadSize(ctx)-offset)
+	if err == errUploadTooLarge {
+		if terr := f.Truncate(offset); terr != nil {
+			return Upload{}, terr
+		}
+		return Upload{Name: name, Offset: offset}, err
+	}
+	return Upload{Name: name, Offset: offset + n}, err
+}
+
+// removeUpload removes the specified upload.
+func removeUpload(ctx *context.RouteContext, name string) error {
+	path, err := uploadPath(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	release, err := acquireUpload(path)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := os.Remove(path); os.IsNotExist(err) {
+		return cerrors.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeTemporaryUpload streams r to a new file in the upload directory and returns its path,
+// failing with errUploadTooLarge if it exceeds the maximum upload size. The caller is responsible
+// for removing it.
+func writeTemporaryUpload(ctx *context.RouteContext, r io.Reader) (string, error) {
+	dir := uploadDir(ctx)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	f, err := ioutil.TempFile(dir, "multipart-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := copyUpload(f, r, maxUploadSize(ctx)); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/config"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func TestUploads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clair-uploads-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := &context.RouteContext{Config: &config.APIConfig{UploadDir: dir}}
+
+	upload, err := createUpload(ctx)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, int64(0), upload.Offset)
+
+	// Append chunks.
+	upload, err = appendUpload(ctx, upload.Name, 0, strings.NewReader("hello "))
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(6), upload.Offset)
+	}
+	_, err = appendUpload(ctx, upload.Name, 0, strings.NewReader("hello "))
+	assert.Equal(t, errUploadOffset, err)
+	upload, err = appendUpload(ctx, upload.Name, 6, strings.NewReader("world"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(11), upload.Offset)
+	}
+
+	// Resume.
+	upload, err = statUpload(ctx, upload.Name)
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(11), upload.Offset)
+	}
+	path, err := uploadPath(ctx, upload.Name)
+	if assert.Nil(t, err) {
+		content, _ := ioutil.ReadFile(path)
+		assert.Equal(t, "hello world", string(content))
+	}
+
+	// Unknown and invalid names.
+	_, err = uploadPath(ctx, "../config.yaml")
+	assert.Equal(t, cerrors.ErrNotFound, err)
+	_, err = statUpload(ctx, "00000000-0000-0000-0000-000000000000")
+	assert.Equal(t, cerrors.ErrNotFound, err)
+
+	// Remove.
+	assert.Nil(t, removeUpload(ctx, upload.Name))
+	assert.Equal(t, cerrors.ErrNotFound, removeUpload(ctx, upload.Name))
+}
+
+func TestConcurrentUploads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clair-uploads-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := &context.RouteContext{Config: &config.APIConfig{UploadDir: dir}}
+
+	upload, err := createUpload(ctx)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Start a chunk that is still being received.
+	chunk, writer := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := appendUpload(ctx, upload.Name, 0, chunk)
+		done <- err
+	}()
+	writer.Write([]byte("hello "))
+
+	// Other requests can't interleave their chunks or remove the upload meanwhile, even though
+	// they see the same offset.
+	_, err = appendUpload(ctx, upload.Name, 0, strings.NewReader("world"))
+	assert.Equal(t, errUploadBusy, err)
+	assert.Equal(t, errUploadBusy, removeUpload(ctx, upload.Name))
+
+	writer.Close()
+	assert.Nil(t, <-done)
+
+	upload, err = appendUpload(ctx, upload.Name, 6, strings.NewReader("world"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(11), upload.Offset)
+	}
+	assert.Nil(t, removeUpload(ctx, upload.Name))
+}
+
+func TestUploadSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clair-uploads-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := &context.RouteContext{Config: &config.APIConfig{UploadDir: dir, MaxUploadSize: 10}}
+
+	upload, err := createUpload(ctx)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// A chunk that overflows is discarded entirely.
+	upload, err = appendUpload(ctx, upload.Name, 0, strings.NewReader("hello "))
+	assert.Nil(t, err)
+	upload, err = appendUpload(ctx, upload.Name, 6, strings.NewReader("world"))
+	assert.Equal(t, errUploadTooLarge, err)
+	assert.Equal(t, int64(6), upload.Offset)
+	upload, err = statUpload(ctx, upload.Name)
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(6), upload.Offset)
+	}
+
+	// Up to the maximum size.
+	upload, err = appendUpload(ctx, upload.Name, 6, strings.NewReader("worl"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(10), upload.Offset)
+	}
+
+	// Through the API.
+	r, _ := http.NewRequest("PATCH", "/uploads/"+upload.Name+"?offset=10", strings.NewReader("d"))
+	w := httptest.NewRecorder()
+	patchUpload(w, r, httprouter.Params{{Key: "uploadName", Value: upload.Name}}, ctx)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormField("layer")
+	part.Write([]byte(`{"Name": "layer", "Format": "Docker"}`))
+	part, _ = form.CreateFormFile("tarball", "layer.tar")
+	part.Write([]byte("hello world"))
+	form.Close()
+
+	r, _ = http.NewRequest("POST", "/layers", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w = httptest.NewRecorder()
+	postLayer(w, r, nil, ctx)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// The temporary tarball has been removed.
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+}
@@ -0,0 +1,231 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package attestation produces signed in-toto attestations of the vulnerability reports of images,
+// in the format of the vulnerability attestations of cosign, so that policy engines can consume
+// them.
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/clair/database"
+)
+
+const (
+	// PredicateType is the type of the vulnerability attestations of cosign.
+	PredicateType = "https://cosign.sigstore.dev/attestation/vuln/v1"
+
+	statementType = "https://in-toto.io/Statement/v0.1"
+	payloadType   = "application/vnd.in-toto+json"
+	scannerURI    = "https://github.com/coreos/clair"
+)
+
+// Finding is a vulnerability affecting a feature of an image.
+type Finding struct {
+	Vulnerability  string `json:"vulnerability"`
+	Namespace      string `json:"namespace"`
+	Severity       string `json:"severity"`
+	Link           string `json:"link,omitempty"`
+	Feature        string `json:"feature"`
+	FeatureVersion string `json:"featureVersion"`
+	FixedBy        string `json:"fixedBy,omitempty"`
+}
+
+// Result is the result of the scan of an image, attested as the result of the scanner.
+type Result struct {
+	Findings []Finding `json:"findings"`
+}
+
+// ResultFromLayer returns the result of the scan of the image whose top layer is the given one,
+// which has been retrieved with its features and their vulnerabilities. The findings are sorted so
+// that identical results are identical documents.
+func ResultFromLayer(layer database.Layer) Result {
+	result := Result{Findings: []Finding{}}
+	for _, featureVersion := range layer.Features {
+		for _, vulnerability := range featureVersion.AffectedBy {
+			result.Findings = append(result.Findings, Finding{
+				Vulnerability:  vulnerability.Name,
+				Namespace:      featureVersion.Feature.Namespace.Name,
+				Severity:       string(vulnerability.Severity),
+				Link:           vulnerability.Link,
+				Feature:        featureVersion.Feature.Name,
+				FeatureVersion: featureVersion.Version,
+				FixedBy:        vulnerability.FixedBy,
+			})
+		}
+	}
+
+	sort.Sort(byFinding(result.Findings))
+	return result
+}
+
+// Hash identifies the attestation of the result for the image whose manifest has the given
+// digest, to know whether it changed since it was last attested.
+func (result Result) Hash(digest string) string {
+	content, _ := json.Marshal(result)
+	hash := sha256.Sum256(append([]byte(digest+"\n"), content...))
+	return hex.EncodeToString(hash[:])
+}
+
+// statement is an in-toto statement whose predicate is a cosign vulnerability attestation.
+type statement struct {
+	Type          string    `json:"_type"`
+	PredicateType string    `json:"predicateType"`
+	Subject       []subject `json:"subject"`
+	Predicate     struct {
+		Scanner struct {
+			URI    string `json:"uri"`
+			Result Result `json:"result"`
+		} `json:"scanner"`
+		Metadata struct {
+			ScanStartedOn  time.Time `json:"scanStartedOn"`
+			ScanFinishedOn time.Time `json:"scanFinishedOn"`
+		} `json:"metadata"`
+	} `json:"predicate"`
+}
+
+type subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Statement returns the in-toto statement attesting the result of the scan of the image whose
+// manifest has the given digest. The name is the one of the image, without tag, e.g.
+// "registry.example.com/debian".
+func Statement(name, digest string, result Result, scanned time.Time) ([]byte, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("attestation: invalid digest %q", digest)
+	}
+
+	s := statement{
+		Type:          statementType,
+		PredicateType: PredicateType,
+		Subject:       []subject{{Name: name, Digest: map[string]string{parts[0]: parts[1]}}},
+	}
+	s.Predicate.Scanner.URI = scannerURI
+	s.Predicate.Scanner.Result = result
+	s.Predicate.Metadata.ScanStartedOn = scanned.UTC()
+	s.Predicate.Metadata.ScanFinishedOn = scanned.UTC()
+
+	return json.Marshal(s)
+}
+
+// Signer signs statements into DSSE envelopes, which cosign verifies with the matching public key.
+type Signer struct {
+	key *ecdsa.PrivateKey
+}
+
+// NewSigner creates a Signer from a PEM-encoded ECDSA private key, either in the SEC 1 ("EC
+// PRIVATE KEY") or in the PKCS #8 ("PRIVATE KEY") format. Encrypted keys aren't supported.
+func NewSigner(data []byte) (*Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("attestation: no private key found")
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &Signer{key: key}, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("attestation: only ECDSA private keys are supported")
+		}
+		return &Signer{key: ecdsaKey}, nil
+	}
+	return nil, fmt.Errorf("attestation: unsupported private key %q", block.Type)
+}
+
+// Sign returns the DSSE envelope of the statement, signed with the key of the Signer.
+func (s *Signer) Sign(statement []byte) ([]byte, error) {
+	hash := sha256.Sum256(pae(payloadType, statement))
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	signature, err := asn1.Marshal(struct{ R, S interface{} }{r, ss})
+	if err != nil {
+		return nil, err
+	}
+
+	type envelopeSignature struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"`
+	}
+	return json.Marshal(struct {
+		PayloadType string              `json:"payloadType"`
+		Payload     string              `json:"payload"`
+		Signatures  []envelopeSignature `json:"signatures"`
+	}{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(statement),
+		Signatures:  []envelopeSignature{{Sig: base64.StdEncoding.EncodeToString(signature)}},
+	})
+}
+
+// SignBlob returns the base64-encoded signature of the file with the given SHA-256 digest, as
+// cosign sign-blob outputs it.
+func (s *Signer) SignBlob(digest []byte) ([]byte, error) {
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, digest)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := asn1.Marshal(struct{ R, S interface{} }{r, ss})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(signature)), nil
+}
+
+// pae returns the pre-authentication encoding of a DSSE payload, which is what is signed.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+type byFinding []Finding
+
+func (f byFinding) Len() int      { return len(f) }
+func (f byFinding) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f byFinding) Less(i, j int) bool {
+	if f[i].Feature != f[j].Feature {
+		return f[i].Feature < f[j].Feature
+	}
+	if f[i].FeatureVersion != f[j].FeatureVersion {
+		return f[i].FeatureVersion < f[j].FeatureVersion
+	}
+	return f[i].Vulnerability < f[j].Vulnerability
+}
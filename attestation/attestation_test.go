@@ -0,0 +1,121 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestResultFromLayer(t *testing.T) {
+	debian := database.Namespace{Name: "debian:8"}
+	layer := database.Layer{Features: []database.FeatureVersion{
+		{
+			Feature:    database.Feature{Name: "openssl", Namespace: debian},
+			Version:    "1.0",
+			AffectedBy: []database.Vulnerability{{Name: "CVE-2"}, {Name: "CVE-1", Severity: types.High, FixedBy: "1.1"}},
+		},
+		{
+			Feature:    database.Feature{Name: "bash", Namespace: debian},
+			Version:    "4.3",
+			AffectedBy: []database.Vulnerability{{Name: "CVE-3"}},
+		},
+	}}
+
+	result := ResultFromLayer(layer)
+	if assert.Len(t, result.Findings, 3) {
+		assert.Equal(t, "CVE-3", result.Findings[0].Vulnerability)
+		assert.Equal(t, Finding{
+			Vulnerability:  "CVE-1",
+			Namespace:      "debian:8",
+			Severity:       "High",
+			Feature:        "openssl",
+			FeatureVersion: "1.0",
+			FixedBy:        "1.1",
+		}, result.Findings[1])
+		assert.Equal(t, "CVE-2", result.Findings[2].Vulnerability)
+	}
+
+	assert.Equal(t, result.Hash("sha256:a"), ResultFromLayer(layer).Hash("sha256:a"))
+	assert.NotEqual(t, result.Hash("sha256:a"), result.Hash("sha256:b"))
+	assert.NotEqual(t, result.Hash("sha256:a"), Result{Findings: []Finding{}}.Hash("sha256:a"))
+}
+
+func TestSign(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	payload, err := Statement("registry.example.com/debian", "sha256:abcd", Result{Findings: []Finding{}}, time.Unix(0, 0))
+	if !assert.Nil(t, err) {
+		return
+	}
+	var s statement
+	if assert.Nil(t, json.Unmarshal(payload, &s)) {
+		assert.Equal(t, PredicateType, s.PredicateType)
+		assert.Equal(t, []subject{{Name: "registry.example.com/debian", Digest: map[string]string{"sha256": "abcd"}}}, s.Subject)
+	}
+
+	data, err := signer.Sign(payload)
+	if !assert.Nil(t, err) {
+		return
+	}
+	var envelope struct {
+		PayloadType string
+		Payload     string
+		Signatures  []struct{ Sig string }
+	}
+	if !assert.Nil(t, json.Unmarshal(data, &envelope)) || !assert.Len(t, envelope.Signatures, 1) {
+		return
+	}
+	assert.Equal(t, payloadType, envelope.PayloadType)
+	decoded, _ := base64.StdEncoding.DecodeString(envelope.Payload)
+	assert.Equal(t, payload, decoded)
+
+	// The signature is the one of the pre-authentication encoding of the payload.
+	sig, _ := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); assert.Nil(t, err) {
+		hash := sha256.Sum256(pae(payloadType, payload))
+		assert.True(t, ecdsa.Verify(&key.PublicKey, hash[:], rs.R, rs.S))
+	}
+
+	_, err = NewSigner([]byte("not a key"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,310 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backfill submits every image of an existing Docker registry to Clair for indexing.
+//
+// The registry's catalog is walked repository by repository and tag by tag, and the layers of
+// each image are submitted to the v2 API of Clair with the bulk priority, so that interactive
+// scans keep going first. Layers that Clair has already indexed are skipped, and the images that
+// have been entirely submitted are recorded in a checkpoint file so an interrupted backfill can be
+// resumed.
+package backfill
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/registry"
+)
+
+const (
+	// maxRetries is the number of times a layer is submitted again while Clair is overloaded.
+	maxRetries = 10
+
+	// defaultRetryAfter is how long to wait before submitting a layer again when Clair is
+	// overloaded but doesn't say for how long.
+	defaultRetryAfter = 30 * time.Second
+)
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "backfill")
+
+// Options configures a backfill.
+type Options struct {
+	// RegistryURL is the base URL of the registry, e.g. "https://registry.example.com". Clair
+	// downloads the layers from it, so it must be reachable by Clair as well.
+	RegistryURL string
+	// Username and Password are the credentials of the registry, if any.
+	Username, Password string
+
+	// ClairURL is the base URL of the Clair API, e.g. "http://localhost:6060".
+	ClairURL string
+
+	// Checkpoint is the path of the file recording the images that have been submitted. The
+	// images it lists are skipped; no checkpoint is kept if it is empty.
+	Checkpoint string
+
+	// Rate is the maximum number of layers submitted per second, zero meaning no limit.
+	Rate float64
+
+	// Repositories restricts the backfill to the repositories having one of these prefixes.
+	Repositories []string
+
+	// Client is the HTTP client used to talk to the registry and Clair.
+	Client *http.Client
+}
+
+// Stats summarizes a backfill.
+type Stats struct {
+	// Images is the number of images that have been submitted.
+	Images int
+	// Skipped is the number of images skipped as they were in the checkpoint.
+	Skipped int
+	// Failed is the number of images that could not be submitted.
+	Failed int
+	// Layers is the number of layers that have been submitted; the others were already indexed.
+	Layers int
+}
+
+// Run submits every image of the registry to Clair.
+//
+// An image that fails is logged and counted in the stats, but doesn't stop the backfill. An error
+// is only returned if the registry can't be walked or the checkpoint can't be written.
+func Run(opts Options) (Stats, error) {
+	var stats Stats
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Minute}
+	}
+	b := &backfill{
+		registry: registry.NewClient(opts.RegistryURL, opts.Username, opts.Password, client),
+		clairURL: strings.TrimSuffix(opts.ClairURL, "/"),
+		client:   client,
+	}
+	if opts.Rate > 0 {
+		b.interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+
+	checkpoint, err := openCheckpoint(opts.Checkpoint)
+	if err != nil {
+		return stats, err
+	}
+	defer checkpoint.Close()
+
+	repositories, err := b.registry.Catalog()
+	if err != nil {
+		return stats, err
+	}
+	sort.Strings(repositories)
+
+	for _, repository := range repositories {
+		if !hasPrefix(repository, opts.Repositories) {
+			continue
+		}
+
+		tags, err := b.registry.Tags(repository)
+		if err != nil {
+			log.Errorf("could not list the tags of %s: %s", repository, err)
+			stats.Failed++
+			continue
+		}
+		sort.Strings(tags)
+
+		for _, tag := range tags {
+			image := repository + ":" + tag
+			manifestDigest, digests, err := b.registry.Manifest(repository, tag)
+			if err != nil {
+				log.Errorf("could not get the manifest of %s: %s", image, err)
+				stats.Failed++
+				continue
+			}
+
+			// Tags are checkpointed along with the digest of their manifest, so moved tags are
+			// submitted again.
+			if manifestDigest != "" {
+				image += "@" + manifestDigest
+			}
+			if checkpoint.Contains(image) {
+				stats.Skipped++
+				continue
+			}
+
+			submitted, err := b.submitImage(repository, digests)
+			stats.Layers += submitted
+			if err != nil {
+				log.Errorf("could not submit %s: %s", image, err)
+				stats.Failed++
+				continue
+			}
+
+			if err := checkpoint.Add(image); err != nil {
+				return stats, err
+			}
+			stats.Images++
+			log.Infof("submitted %s (%d layers, %d new)", image, len(digests), submitted)
+		}
+	}
+
+	return stats, nil
+}
+
+type backfill struct {
+	registry *registry.Client
+	clairURL string
+	client   *http.Client
+
+	// interval is the minimum time between two submissions.
+	interval time.Duration
+	last     time.Time
+}
+
+// clairLayer is the layer resource of the v2 API of Clair.
+type clairLayer struct {
+	Name       string            `json:"Name"`
+	ParentName string            `json:"ParentName,omitempty"`
+	Path       string            `json:"Path,omitempty"`
+	Headers    map[string]string `json:"Headers,omitempty"`
+	Format     string            `json:"Format,omitempty"`
+	Priority   string            `json:"Priority,omitempty"`
+}
+
+// submitImage submits the layers of an image that Clair hasn't indexed yet, and returns how many
+// it submitted.
+func (b *backfill) submitImage(repository string, digests []string) (int, error) {
+	var submitted int
+	var parentName string
+	for _, digest := range digests {
+		layer := clairLayer{
+			Name:       registry.LayerName(parentName, digest),
+			ParentName: parentName,
+			Path:       b.registry.BlobURL(repository, digest),
+			Format:     "Docker",
+			Priority:   "bulk",
+		}
+		if authorization := b.registry.Authorization(repository); authorization != "" {
+			layer.Headers = map[string]string{"Authorization": authorization}
+		}
+		parentName = layer.Name
+
+		indexed, err := b.indexed(layer.Name)
+		if err != nil {
+			return submitted, err
+		}
+		if indexed {
+			continue
+		}
+
+		if err := b.submit(layer); err != nil {
+			return submitted, err
+		}
+		submitted++
+	}
+	return submitted, nil
+}
+
+// indexed returns whether Clair has already indexed the layer.
+func (b *backfill) indexed(name string) (bool, error) {
+	resp, err := b.client.Get(b.clairURL + "/v2/layers/" + name)
+	if err != nil {
+		return false, err
+	}
+	defer drain(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, clairError(resp)
+	}
+}
+
+// submit submits the layer to Clair, respecting the rate limit and waiting while Clair is
+// overloaded.
+func (b *backfill) submit(layer clairLayer) error {
+	body, err := json.Marshal(layer)
+	if err != nil {
+		return err
+	}
+
+	for retries := 0; ; retries++ {
+		if wait := b.interval - time.Since(b.last); wait > 0 {
+			time.Sleep(wait)
+		}
+		b.last = time.Now()
+
+		resp, err := b.client.Post(b.clairURL+"/v2/layers", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusCreated {
+			drain(resp.Body)
+			return nil
+		}
+		if resp.StatusCode != http.StatusServiceUnavailable || retries >= maxRetries {
+			err := clairError(resp)
+			drain(resp.Body)
+			return err
+		}
+		drain(resp.Body)
+
+		wait := defaultRetryAfter
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		log.Infof("clair is overloaded, waiting %v before submitting layer %s again", wait, layer.Name)
+		time.Sleep(wait)
+	}
+}
+
+// clairError returns the error described by an unsuccessful response of Clair.
+func clairError(resp *http.Response) error {
+	var body struct {
+		Message string `json:"Message"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Message != "" {
+		return errors.New("clair: " + body.Message)
+	}
+	return fmt.Errorf("clair: got status %d", resp.StatusCode)
+}
+
+func hasPrefix(s string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// drain reads the rest of the body so the connection can be reused, and closes it.
+func drain(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, body)
+	body.Close()
+}
@@ -0,0 +1,156 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backfill
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/registry"
+)
+
+// newTestRegistry serves two repositories, the first one paginated, protected by bearer tokens.
+func newTestRegistry(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			json.NewEncoder(w).Encode(map[string]string{"token": "token-" + r.URL.Query().Get("scope")})
+			return
+		}
+
+		scope := "repository:" + strings.Split(strings.TrimPrefix(r.URL.Path, "/v2/"), "/")[0] + ":pull"
+		if r.URL.Path == "/v2/_catalog" {
+			scope = "registry:catalog:*"
+		}
+		if r.Header.Get("Authorization") != "Bearer token-"+scope {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="%s"`, server.URL, scope))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/_catalog":
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/_catalog?last=debian&n=100>; rel="next"`)
+				fmt.Fprint(w, `{"repositories": ["debian"]}`)
+			} else {
+				fmt.Fprint(w, `{"repositories": ["alpine"]}`)
+			}
+		case "/v2/debian/tags/list":
+			fmt.Fprint(w, `{"name": "debian", "tags": ["jessie", "wheezy"]}`)
+		case "/v2/alpine/tags/list":
+			fmt.Fprint(w, `{"name": "alpine", "tags": ["3.4"]}`)
+		case "/v2/debian/manifests/jessie":
+			w.Header().Set("Docker-Content-Digest", "sha256:jessie")
+			fmt.Fprint(w, `{"schemaVersion": 2, "layers": [{"digest": "sha256:base"}, {"digest": "sha256:jessie-top"}]}`)
+		case "/v2/debian/manifests/wheezy":
+			w.Header().Set("Docker-Content-Digest", "sha256:wheezy")
+			fmt.Fprint(w, `{"schemaVersion": 2, "layers": [{"digest": "sha256:base"}, {"digest": "sha256:wheezy-top"}]}`)
+		case "/v2/alpine/manifests/3.4":
+			// Schema 1 lists the layers from the top one.
+			fmt.Fprint(w, `{"schemaVersion": 1, "fsLayers": [{"blobSum": "sha256:alpine-top"}, {"blobSum": "sha256:alpine-base"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+// testClair is a fake Clair API, which is overloaded for the first submission.
+type testClair struct {
+	sync.Mutex
+	layers     map[string]clairLayer
+	overloaded bool
+}
+
+func (c *testClair) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+
+	if r.Method == "GET" {
+		if _, ok := c.layers[strings.TrimPrefix(r.URL.Path, "/v2/layers/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+
+	if !c.overloaded {
+		c.overloaded = true
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var layer clairLayer
+	json.NewDecoder(r.Body).Decode(&layer)
+	if _, ok := c.layers[layer.ParentName]; layer.ParentName != "" && !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"Message": "unknown parent"}`)
+		return
+	}
+	c.layers[layer.Name] = layer
+	w.WriteHeader(http.StatusCreated)
+}
+
+func TestRun(t *testing.T) {
+	registryServer := newTestRegistry(t)
+	defer registryServer.Close()
+	clair := &testClair{layers: make(map[string]clairLayer)}
+	clairServer := httptest.NewServer(clair)
+	defer clairServer.Close()
+
+	dir, err := ioutil.TempDir("", "clair-backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Options{
+		RegistryURL:  registryServer.URL,
+		ClairURL:     clairServer.URL,
+		Checkpoint:   filepath.Join(dir, "checkpoint"),
+		Repositories: []string{"debian"},
+	}
+	stats, err := Run(opts)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, Stats{Images: 2, Layers: 3}, stats, "the base layer is shared")
+
+	jessie := clair.layers[registry.LayerName(registry.LayerName("", "sha256:base"), "sha256:jessie-top")]
+	assert.Equal(t, "sha256:base", jessie.ParentName)
+	assert.Equal(t, registryServer.URL+"/v2/debian/blobs/sha256:jessie-top", jessie.Path)
+	assert.Equal(t, "Bearer token-repository:debian:pull", jessie.Headers["Authorization"])
+	assert.Equal(t, "bulk", jessie.Priority)
+
+	// Resuming skips the checkpointed images.
+	opts.Repositories = nil
+	stats, err = Run(opts)
+	if assert.Nil(t, err) {
+		assert.Equal(t, Stats{Images: 1, Skipped: 2, Layers: 2}, stats)
+	}
+	alpine := clair.layers[registry.LayerName(registry.LayerName("", "sha256:alpine-base"), "sha256:alpine-top")]
+	assert.Equal(t, "sha256:alpine-base", alpine.ParentName)
+}
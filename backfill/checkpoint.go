@@ -0,0 +1,82 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backfill
+
+import (
+	"bufio"
+	"os"
+)
+
+// checkpoint records the images that have been submitted, one per line. Lines are appended as
+// images are submitted, so the file stays valid if the backfill is interrupted.
+type checkpoint struct {
+	file   *os.File
+	images map[string]struct{}
+}
+
+// openCheckpoint loads the checkpoint at the given path, creating it if needed. An empty path
+// opens a checkpoint that is only kept in memory.
+func openCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{images: make(map[string]struct{})}
+	if path == "" {
+		return c, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			c.images[line] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	c.file = f
+	return c, nil
+}
+
+// Contains returns whether the image has been submitted.
+func (c *checkpoint) Contains(image string) bool {
+	_, ok := c.images[image]
+	return ok
+}
+
+// Add records that the image has been submitted.
+func (c *checkpoint) Add(image string) error {
+	c.images[image] = struct{}{}
+	if c.file == nil {
+		return nil
+	}
+
+	if _, err := c.file.WriteString(image + "\n"); err != nil {
+		return err
+	}
+	return c.file.Sync()
+}
+
+// Close closes the checkpoint file.
+func (c *checkpoint) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
@@ -0,0 +1,240 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bundle writes and reads vulnerability bundles: versioned snapshots of the
+// vulnerabilities of a database, which new instances import so that they can be queried before
+// their first update completes.
+//
+// A bundle is a gzipped stream of JSON documents, one per line: a Header followed by the
+// vulnerabilities. Bundles are signed like cosign sign-blob signs files, with a detached
+// base64-encoded ECDSA signature of the SHA-256 digest of the bundle.
+package bundle
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+// Format is the version of the format of the bundles that this package writes and reads.
+const Format = 1
+
+// ErrFormat is returned when reading a bundle that isn't in the supported format.
+var ErrFormat = errors.New("bundle: unsupported bundle format")
+
+// Header is the first line of a bundle.
+type Header struct {
+	// Format is the version of the format of the bundle.
+	Format int
+	// Version identifies the content of the bundle, e.g. the date it has been published.
+	Version string
+	// Created is when the vulnerabilities have been read from the database.
+	Created time.Time
+}
+
+// vulnerability is the line of a vulnerability in a bundle. Unlike database.Vulnerability, its
+// encoding is stable.
+type vulnerability struct {
+	Name          string
+	Namespace     string
+	VersionFormat string
+	Description   string                        `json:",omitempty"`
+	Link          string                        `json:",omitempty"`
+	Severity      types.Priority                `json:",omitempty"`
+	Metadata      database.MetadataMap          `json:",omitempty"`
+	Sources       database.VulnerabilitySources `json:",omitempty"`
+	FixedIn       []fix                         `json:",omitempty"`
+}
+
+type fix struct {
+	Name    string
+	Version string
+}
+
+// A Writer writes a bundle and computes its digest.
+type Writer struct {
+	gzip    *gzip.Writer
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+	hash    hash.Hash
+	count   int
+}
+
+// NewWriter starts writing a bundle with the given header to w. Its Format is set.
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	bw := &Writer{hash: sha256.New()}
+	bw.gzip = gzip.NewWriter(io.MultiWriter(w, bw.hash))
+	bw.buffer = bufio.NewWriter(bw.gzip)
+	bw.encoder = json.NewEncoder(bw.buffer)
+
+	header.Format = Format
+	if err := bw.encoder.Encode(header); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+// Write adds a vulnerability to the bundle.
+func (w *Writer) Write(v database.Vulnerability) error {
+	line := vulnerability{
+		Name:          v.Name,
+		Namespace:     v.Namespace.Name,
+		VersionFormat: v.Namespace.VersionFormat,
+		Description:   v.Description,
+		Link:          v.Link,
+		Severity:      v.Severity,
+		Metadata:      v.Metadata,
+		Sources:       v.Sources,
+	}
+	for _, fv := range v.FixedIn {
+		line.FixedIn = append(line.FixedIn, fix{Name: fv.Feature.Name, Version: fv.Version})
+	}
+
+	if err := w.encoder.Encode(line); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+// Count returns the number of vulnerabilities written so far.
+func (w *Writer) Count() int {
+	return w.count
+}
+
+// Close completes the bundle. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.buffer.Flush(); err != nil {
+		return err
+	}
+	return w.gzip.Close()
+}
+
+// Digest returns the SHA-256 digest of the bundle, once it is closed.
+func (w *Writer) Digest() []byte {
+	return w.hash.Sum(nil)
+}
+
+// WriteDatastore writes a bundle of every vulnerability of the datastore, namespace by namespace.
+// Each namespace is read from a consistent snapshot.
+func WriteDatastore(w *Writer, datastore database.Datastore) error {
+	namespaces, err := datastore.ListNamespaces()
+	if err != nil {
+		return err
+	}
+
+	for _, namespace := range namespaces {
+		err := datastore.StreamVulnerabilities(namespace.Name, func(v database.Vulnerability) error {
+			return w.Write(v)
+		})
+		if err != nil {
+			return fmt.Errorf("bundle: could not read the vulnerabilities of namespace '%s': %s", namespace.Name, err)
+		}
+	}
+	return nil
+}
+
+// A Reader reads the vulnerabilities of a bundle.
+type Reader struct {
+	Header Header
+
+	gzip    *gzip.Reader
+	decoder *json.Decoder
+}
+
+// NewReader starts reading a bundle from r, whose Header is read.
+func NewReader(r io.Reader) (*Reader, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	br := &Reader{gzip: gr, decoder: json.NewDecoder(bufio.NewReader(gr))}
+	if err := br.decoder.Decode(&br.Header); err != nil {
+		return nil, fmt.Errorf("bundle: could not read header: %s", err)
+	}
+	if br.Header.Format != Format {
+		return nil, ErrFormat
+	}
+	return br, nil
+}
+
+// Next returns the next vulnerability of the bundle, or io.EOF once they have all been read.
+func (r *Reader) Next() (database.Vulnerability, error) {
+	var line vulnerability
+	if err := r.decoder.Decode(&line); err != nil {
+		if err != io.EOF {
+			err = fmt.Errorf("bundle: could not read vulnerability: %s", err)
+		}
+		return database.Vulnerability{}, err
+	}
+
+	namespace := database.Namespace{Name: line.Namespace, VersionFormat: line.VersionFormat}
+	v := database.Vulnerability{
+		Name:        line.Name,
+		Namespace:   namespace,
+		Description: line.Description,
+		Link:        line.Link,
+		Severity:    line.Severity,
+		Metadata:    line.Metadata,
+		Sources:     line.Sources,
+	}
+	if v.Severity == "" {
+		v.Severity = types.Unknown
+	}
+	for _, f := range line.FixedIn {
+		v.FixedIn = append(v.FixedIn, database.FeatureVersion{
+			Feature: database.Feature{Name: f.Name, Namespace: namespace},
+			Version: f.Version,
+		})
+	}
+	return v, nil
+}
+
+// Verify returns whether the base64-encoded signature of the bundle with the given SHA-256 digest
+// has been made by one of the keys.
+func Verify(digest, signature []byte, keys []*ecdsa.PublicKey) bool {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return false
+	}
+
+	var rs struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(der, &rs); err != nil || len(rest) > 0 {
+		return false
+	}
+
+	for _, key := range keys {
+		if ecdsa.Verify(key, digest, rs.R, rs.S) {
+			return true
+		}
+	}
+	return false
+}
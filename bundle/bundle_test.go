@@ -0,0 +1,129 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/attestation"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestWriteRead(t *testing.T) {
+	namespace := database.Namespace{Name: "debian:8", VersionFormat: "dpkg"}
+	vulnerabilities := []database.Vulnerability{
+		{
+			Name:      "CVE-2016-0001",
+			Namespace: namespace,
+			Link:      "https://security-tracker.debian.org/tracker/CVE-2016-0001",
+			Severity:  types.High,
+			Metadata:  database.MetadataMap{"NVD": map[string]interface{}{"CVSSv2": map[string]interface{}{"Score": 7.5}}},
+			Sources:   database.VulnerabilitySources{{Name: "debian", URL: "https://security-tracker.debian.org"}},
+			FixedIn: []database.FeatureVersion{
+				{Feature: database.Feature{Name: "openssl", Namespace: namespace}, Version: "1.0.1t-1"},
+			},
+		},
+		{
+			Name:      "CVE-2016-0002",
+			Namespace: namespace,
+			Severity:  types.Unknown,
+		},
+	}
+
+	var buf bytes.Buffer
+	created := time.Date(2016, 10, 17, 12, 0, 0, 0, time.UTC)
+	w, err := NewWriter(&buf, Header{Version: "20161017", Created: created})
+	if !assert.Nil(t, err) {
+		return
+	}
+	for _, v := range vulnerabilities {
+		assert.Nil(t, w.Write(v))
+	}
+	assert.Nil(t, w.Close())
+	assert.Equal(t, 2, w.Count())
+
+	digest := sha256.Sum256(buf.Bytes())
+	assert.Equal(t, digest[:], w.Digest())
+
+	r, err := NewReader(&buf)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, Header{Format: Format, Version: "20161017", Created: created}, r.Header)
+
+	for _, expected := range vulnerabilities {
+		v, err := r.Next()
+		if assert.Nil(t, err) {
+			assert.Equal(t, expected, v)
+		}
+	}
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReadUnsupportedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte(`{"Format": 2, "Version": "future"}` + "\n"))
+	gw.Close()
+
+	_, err := NewReader(&buf)
+	assert.Equal(t, ErrFormat, err)
+
+	_, err = NewReader(bytes.NewReader([]byte("not gzip")))
+	assert.NotNil(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.Nil(t, err) {
+		return
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if !assert.Nil(t, err) {
+		return
+	}
+	signer, err := attestation.NewSigner(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	digest := sha256.Sum256([]byte("bundle"))
+	signature, err := signer.SignBlob(digest[:])
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.True(t, Verify(digest[:], append(signature, '\n'), []*ecdsa.PublicKey{&other.PublicKey, &key.PublicKey}))
+	assert.False(t, Verify(digest[:], signature, []*ecdsa.PublicKey{&other.PublicKey}))
+
+	tampered := sha256.Sum256([]byte("tampered"))
+	assert.False(t, Verify(tampered[:], signature, []*ecdsa.PublicKey{&key.PublicKey}))
+	assert.False(t, Verify(digest[:], []byte("not base64"), []*ecdsa.PublicKey{&key.PublicKey}))
+}
@@ -27,9 +27,16 @@ import (
 	"github.com/coreos/clair/api/context"
 	"github.com/coreos/clair/config"
 	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/enricher"
+	"github.com/coreos/clair/health"
 	"github.com/coreos/clair/notifier"
+	"github.com/coreos/clair/ownership"
+	"github.com/coreos/clair/tracing"
+	"github.com/coreos/clair/tracker"
 	"github.com/coreos/clair/updater"
 	"github.com/coreos/clair/utils"
+	"github.com/coreos/clair/worker"
+	"github.com/coreos/clair/worker/detectors"
 	"github.com/coreos/pkg/capnslog"
 )
 
@@ -41,27 +48,101 @@ func Boot(config *config.Config) {
 	rand.Seed(time.Now().UnixNano())
 	st := utils.NewStopper()
 
+	if config.Notifier != nil {
+		if err := database.UseNotificationNameFormat(config.Notifier.NameFormat); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Export the traces, if configured, until Clair stops.
+	if err := tracing.Configure(config.Tracing); err != nil {
+		log.Fatal(err)
+	}
+	defer tracing.Shutdown()
+
 	// Open database
 	db, err := database.Open(config.Database)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
+	health.Register("database", health.CheckDatastore(db), true)
 
 	// Start notifier
 	st.Begin()
 	go notifier.Run(config.Notifier, db, st)
 
+	// The API and the tracker share the indexing queue.
+	var queue *worker.Queue
+	if config.API != nil {
+		queue = worker.NewQueue(config.API.IndexingWorkers, config.API.MaxIndexingQueueDepth)
+		worker.IndexInstalledOnly(config.API.InstalledOnly)
+		worker.RecordEvidence(config.API.Evidence)
+		if d := config.API.Detectors; d != nil {
+			if err := worker.ConfigureDetectors(d.Disabled, d.Params); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if _, err := detectors.ExecutionPlan(); err != nil {
+			log.Fatal(err)
+		}
+		if budget := config.API.Budget; budget != nil {
+			worker.UseBudget(worker.Budget{
+				Timeout:        budget.Timeout,
+				MaxGoroutines:  budget.MaxGoroutines,
+				MaxFileSize:    budget.MaxFileSize,
+				MaxArchiveSize: budget.MaxArchiveSize,
+			})
+		}
+	}
+
+	if config.Worker != nil && config.Worker.Sandbox != nil {
+		sandbox := config.Worker.Sandbox
+		worker.UseSandbox(&worker.Sandbox{
+			Command:    worker.DefaultSandboxCommand(),
+			Timeout:    sandbox.Timeout,
+			Namespaces: sandbox.Namespaces,
+			Seccomp:    sandbox.Seccomp,
+			Limits: worker.SandboxLimits{
+				CPUTime:      sandbox.CPUTime,
+				MaxOpenFiles: sandbox.MaxOpenFiles,
+				MaxMemory:    sandbox.MaxMemory,
+			},
+		})
+	}
+
+	var accessLog *context.AccessLog
+	if config.API != nil && config.API.AccessLog != nil {
+		accessLog, err = context.NewAccessLog(config.API.AccessLog)
+		if err != nil {
+			log.Fatalf("could not open the access log: %s", err)
+		}
+	}
+
 	// Start API
 	st.Begin()
-	go api.Run(config.API, &context.RouteContext{db, config.API}, st)
+	go api.Run(config.API, &context.RouteContext{Store: db, Config: config.API, Queue: queue, AccessLog: accessLog}, st)
+	st.Begin()
+	go api.RunHealth(config.API, &context.RouteContext{Store: db, Config: config.API}, st)
 	st.Begin()
-	go api.RunHealth(config.API, &context.RouteContext{db, config.API}, st)
+	go api.RunGRPC(config.API, &context.RouteContext{Store: db, Config: config.API, Queue: queue, AccessLog: accessLog}, st)
 
 	// Start updater
 	st.Begin()
 	go updater.Run(config.Updater, db, st)
 
+	// Start enricher
+	st.Begin()
+	go enricher.Run(config.Enricher, db, st)
+
+	// Start tracker
+	st.Begin()
+	go tracker.Run(config.Tracker, db, queue, st)
+
+	// Start ownership service
+	st.Begin()
+	go ownership.Run(config.Ownership, st)
+
 	// Wait for interruption and shutdown gracefully.
 	waitForSignals(syscall.SIGINT, syscall.SIGTERM)
 	log.Info("Received interruption, gracefully stopping ...")
@@ -0,0 +1,70 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/backfill"
+)
+
+// backfillMain runs the backfill command, which submits every image of a registry to a running
+// Clair.
+func backfillMain(args []string) {
+	flags := flag.NewFlagSet(os.Args[0]+" backfill", flag.ExitOnError)
+	flagRegistry := flags.String("registry", "", "Base URL of the registry to backfill, which Clair must be able to reach.")
+	flagUsername := flags.String("username", "", "Username of the registry.")
+	flagClair := flags.String("clair", "http://localhost:6060", "Base URL of the Clair API.")
+	flagCheckpoint := flags.String("checkpoint", "clair-backfill.checkpoint", "Record the submitted images in the specified file, and skip the images it lists.")
+	flagRate := flags.Float64("rate", 5, "Maximum number of layers submitted per second, 0 meaning no limit.")
+	flagRepositories := flags.String("repositories", "", "Comma-separated prefixes of the repositories to backfill; every repository is backfilled if empty.")
+	flagLogLevel := flags.String("log-level", "info", "Define the logging level.")
+	flags.Parse(args)
+
+	logLevel, err := capnslog.ParseLevel(strings.ToUpper(*flagLogLevel))
+	capnslog.SetGlobalLogLevel(logLevel)
+	capnslog.SetFormatter(capnslog.NewPrettyFormatter(os.Stdout, false))
+
+	if *flagRegistry == "" {
+		log.Fatal("the registry to backfill is required")
+	}
+
+	opts := backfill.Options{
+		RegistryURL: *flagRegistry,
+		Username:    *flagUsername,
+		// The password isn't a flag so it doesn't show up in the process list.
+		Password:   os.Getenv("CLAIR_BACKFILL_PASSWORD"),
+		ClairURL:   *flagClair,
+		Checkpoint: *flagCheckpoint,
+		Rate:       *flagRate,
+	}
+	if *flagRepositories != "" {
+		opts.Repositories = strings.Split(*flagRepositories, ",")
+	}
+
+	stats, err := backfill.Run(opts)
+	log.Infof("submitted %d images (%d layers), skipped %d checkpointed images, %d failed",
+		stats.Images, stats.Layers, stats.Skipped, stats.Failed)
+	if err != nil {
+		log.Fatalf("backfill interrupted: %s", err)
+	}
+	if stats.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/attestation"
+	"github.com/coreos/clair/bundle"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+// bundleMain runs the bundle command, which writes the vulnerabilities of the database to a
+// signed bundle that new deployments can be initialized with.
+func bundleMain(args []string) {
+	flags := flag.NewFlagSet(os.Args[0]+" bundle", flag.ExitOnError)
+	flagConfigPath := flags.String("config", "/etc/clair/config.yaml", "Load configuration from the specified file.")
+	flagOutput := flags.String("output", "vulnerabilities.ndjson.gz", "Write the bundle to the specified file, and its signature to the file followed by \".sig\".")
+	flagKey := flags.String("key", "", "PEM file of the unencrypted ECDSA private key signing the bundle; the bundle isn't signed if empty.")
+	flagVersion := flags.String("version", "", "Version of the bundle, its creation date by default.")
+	flagLogLevel := flags.String("log-level", "info", "Define the logging level.")
+	flags.Parse(args)
+
+	logLevel, err := capnslog.ParseLevel(strings.ToUpper(*flagLogLevel))
+	capnslog.SetGlobalLogLevel(logLevel)
+	capnslog.SetFormatter(capnslog.NewPrettyFormatter(os.Stdout, false))
+
+	config, err := config.Load(*flagConfigPath)
+	if err != nil {
+		log.Fatalf("failed to load configuration: %s", err)
+	}
+
+	var signer *attestation.Signer
+	if *flagKey != "" {
+		data, err := ioutil.ReadFile(*flagKey)
+		if err != nil {
+			log.Fatalf("failed to read the signing key: %s", err)
+		}
+		if signer, err = attestation.NewSigner(data); err != nil {
+			log.Fatalf("failed to parse the signing key: %s", err)
+		}
+	}
+
+	datastore, err := database.Open(config.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer datastore.Close()
+
+	header := bundle.Header{Version: *flagVersion, Created: time.Now().UTC()}
+	if header.Version == "" {
+		header.Version = header.Created.Format("20060102T150405Z")
+	}
+
+	// The bundle is written to a temporary file first, so that the output is never incomplete.
+	f, err := ioutil.TempFile(filepath.Dir(*flagOutput), ".clair-bundle-")
+	if err != nil {
+		log.Fatalf("failed to create the bundle: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	w, err := bundle.NewWriter(f, header)
+	if err == nil {
+		err = bundle.WriteDatastore(w, datastore)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatalf("failed to write the bundle: %s", err)
+	}
+
+	if signer != nil {
+		signature, err := signer.SignBlob(w.Digest())
+		if err != nil {
+			log.Fatalf("failed to sign the bundle: %s", err)
+		}
+		if err := ioutil.WriteFile(*flagOutput+".sig", signature, 0644); err != nil {
+			log.Fatalf("failed to write the signature of the bundle: %s", err)
+		}
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		log.Fatalf("failed to write the bundle: %s", err)
+	}
+	if err := os.Rename(f.Name(), *flagOutput); err != nil {
+		log.Fatalf("failed to write the bundle: %s", err)
+	}
+
+	log.Infof("wrote %d vulnerabilities to bundle %s (version %s)", w.Count(), *flagOutput, header.Version)
+}
@@ -18,28 +18,41 @@ import (
 	"flag"
 	"os"
 	"runtime/pprof"
-	"strings"
 
 	"github.com/coreos/pkg/capnslog"
 
 	"github.com/coreos/clair"
 	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/logging"
+	"github.com/coreos/clair/worker"
 
 	// Register components
 	_ "github.com/coreos/clair/notifier/notifiers"
 
+	_ "github.com/coreos/clair/updater/fetchers/advisories"
 	_ "github.com/coreos/clair/updater/fetchers/alpine"
+	_ "github.com/coreos/clair/updater/fetchers/amzn"
 	_ "github.com/coreos/clair/updater/fetchers/debian"
+	_ "github.com/coreos/clair/updater/fetchers/friendsofphp"
+	_ "github.com/coreos/clair/updater/fetchers/ghsa"
 	_ "github.com/coreos/clair/updater/fetchers/oracle"
+	_ "github.com/coreos/clair/updater/fetchers/osv"
 	_ "github.com/coreos/clair/updater/fetchers/rhel"
+	_ "github.com/coreos/clair/updater/fetchers/rustsec"
+	_ "github.com/coreos/clair/updater/fetchers/suse"
 	_ "github.com/coreos/clair/updater/fetchers/ubuntu"
+	_ "github.com/coreos/clair/updater/fetchers/vex"
 	_ "github.com/coreos/clair/updater/metadata_fetchers/nvd"
 
 	_ "github.com/coreos/clair/worker/detectors/data/aci"
 	_ "github.com/coreos/clair/worker/detectors/data/docker"
 
 	_ "github.com/coreos/clair/worker/detectors/feature/apk"
+	_ "github.com/coreos/clair/worker/detectors/feature/cargo"
+	_ "github.com/coreos/clair/worker/detectors/feature/composer"
+	_ "github.com/coreos/clair/worker/detectors/feature/conda"
 	_ "github.com/coreos/clair/worker/detectors/feature/dpkg"
+	_ "github.com/coreos/clair/worker/detectors/feature/nuget"
 	_ "github.com/coreos/clair/worker/detectors/feature/rpm"
 
 	_ "github.com/coreos/clair/worker/detectors/namespace/alpinerelease"
@@ -48,12 +61,28 @@ import (
 	_ "github.com/coreos/clair/worker/detectors/namespace/osrelease"
 	_ "github.com/coreos/clair/worker/detectors/namespace/redhatrelease"
 
+	_ "github.com/coreos/clair/database/memory"
+	_ "github.com/coreos/clair/database/mysql"
 	_ "github.com/coreos/clair/database/pgsql"
+	_ "github.com/coreos/clair/database/sqlite"
 )
 
 var log = capnslog.NewPackageLogger("github.com/coreos/clair/cmd/clair", "main")
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		backfillMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bundle" {
+		bundleMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == worker.SandboxCommand {
+		sandboxMain()
+		return
+	}
+
 	// Parse command-line arguments
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	flagConfigPath := flag.String("config", "/etc/clair/config.yaml", "Load configuration from the specified file.")
@@ -67,9 +96,14 @@ func main() {
 	}
 
 	// Initialize logging system
-	logLevel, err := capnslog.ParseLevel(strings.ToUpper(*flagLogLevel))
-	capnslog.SetGlobalLogLevel(logLevel)
-	capnslog.SetFormatter(capnslog.NewPrettyFormatter(os.Stdout, false))
+	var logFormat string
+	var logLevels map[string]string
+	if config.Log != nil {
+		logFormat, logLevels = config.Log.Format, config.Log.Levels
+	}
+	if err := logging.Configure(os.Stdout, logFormat, *flagLogLevel, logLevels); err != nil {
+		log.Fatalf("failed to configure logging: %s", err)
+	}
 
 	// Enable CPU Profiling if specified
 	if *flagCPUProfilePath != "" {
@@ -0,0 +1,34 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/worker"
+)
+
+// sandboxMain runs the sandbox command, which Clair executes to analyze a layer in a separate
+// process. Its standard output is reserved for the result, so it logs on its standard error.
+func sandboxMain() {
+	capnslog.SetGlobalLogLevel(capnslog.WARNING)
+	capnslog.SetFormatter(capnslog.NewPrettyFormatter(os.Stderr, false))
+
+	if err := worker.ServeSandbox(os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("failed to serve the sandbox: %s", err)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/clair/utils"
+)
+
+const (
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	dockerListMediaType  = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// refNameAnnotation is the annotation of the descriptors of an index naming their image, e.g.
+	// its tag.
+	refNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// errNoImage is returned when no image of the layout matches the requested reference.
+var errNoImage = errors.New("no image of the layout matches")
+
+// descriptor is an OCI content descriptor, referring to a blob of the layout.
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+		Variant      string `json:"variant,omitempty"`
+	} `json:"platform,omitempty"`
+}
+
+// index is an OCI image index, or a Docker manifest list, which have the same structure.
+type index struct {
+	MediaType string       `json:"mediaType"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+// manifest is an OCI image manifest, or a Docker image manifest.
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Layers    []descriptor `json:"layers"`
+}
+
+// A layer is a layer of an image to analyze, named after the chain of the digests of its blob and
+// of the ones of its parents, so that the same blob in different images isn't confused.
+type layer struct {
+	Name, ParentName string
+	Path, Digest     string
+}
+
+// An image is an image of a layout, with its layers from the base one.
+type image struct {
+	Reference string
+	Digest    string
+	Layers    []layer
+}
+
+// readImage returns the image of the OCI layout in the given directory whose reference is ref, or
+// its only image if ref is empty. The images of multi-platform indexes are selected by platform,
+// such as "linux/amd64".
+func readImage(dir, ref, platform string) (image, error) {
+	if _, err := os.Stat(filepath.Join(dir, "oci-layout")); err != nil {
+		return image{}, fmt.Errorf("%s is not an OCI layout: %s", dir, err)
+	}
+
+	var root index
+	if err := readJSON(filepath.Join(dir, "index.json"), &root); err != nil {
+		return image{}, err
+	}
+
+	var candidates []descriptor
+	for _, d := range root.Manifests {
+		if ref == "" || d.Annotations[refNameAnnotation] == ref {
+			candidates = append(candidates, d)
+		}
+	}
+	switch {
+	case len(candidates) == 0 && ref != "":
+		return image{}, fmt.Errorf("%s %q", errNoImage, ref)
+	case len(candidates) == 0:
+		return image{}, errors.New("the layout has no image")
+	case len(candidates) > 1:
+		var refs []string
+		for _, d := range candidates {
+			refs = append(refs, d.Annotations[refNameAnnotation])
+		}
+		return image{}, fmt.Errorf("the layout has %d images, select one of them by reference: %s", len(candidates), strings.Join(refs, ", "))
+	}
+
+	d := candidates[0]
+	img := image{Reference: d.Annotations[refNameAnnotation]}
+	for d.MediaType == ociIndexMediaType || d.MediaType == dockerListMediaType {
+		var platforms index
+		if err := readJSON(blobPath(dir, d.Digest), &platforms); err != nil {
+			return image{}, err
+		}
+		var found bool
+		for _, m := range platforms.Manifests {
+			if m.Platform != nil && matchPlatform(platform, m.Platform.OS, m.Platform.Architecture, m.Platform.Variant) {
+				d, found = m, true
+				break
+			}
+		}
+		if !found {
+			return image{}, fmt.Errorf("%s for platform %s", errNoImage, platform)
+		}
+	}
+	img.Digest = d.Digest
+
+	var m manifest
+	if err := readJSON(blobPath(dir, d.Digest), &m); err != nil {
+		return image{}, err
+	}
+	if len(m.Layers) == 0 {
+		return image{}, fmt.Errorf("the manifest %s has no layer", d.Digest)
+	}
+
+	var parentName string
+	for _, l := range m.Layers {
+		name := l.Digest
+		if parentName != "" {
+			sum := sha256.Sum256([]byte(parentName + " " + l.Digest))
+			name = "sha256:" + hex.EncodeToString(sum[:])
+		}
+		img.Layers = append(img.Layers, layer{Name: name, ParentName: parentName, Path: blobPath(dir, l.Digest), Digest: l.Digest})
+		parentName = name
+	}
+	return img, nil
+}
+
+// matchPlatform returns whether the platform of a manifest is the given one, e.g. "linux/arm64"
+// or "linux/arm/v7".
+func matchPlatform(platform, goos, architecture, variant string) bool {
+	parts := strings.SplitN(platform, "/", 3)
+	if len(parts) < 2 || parts[0] != goos || parts[1] != architecture {
+		return false
+	}
+	return len(parts) == 2 || parts[2] == variant
+}
+
+// blobPath returns the path of the blob of the layout with the given digest.
+func blobPath(dir, digest string) string {
+	if utils.ValidateDigest(digest) != nil {
+		// An invalid digest must not be used as a path; the blob doesn't exist anyway.
+		return filepath.Join(dir, "blobs", "invalid")
+	}
+	return filepath.Join(dir, "blobs", strings.Replace(digest, ":", string(filepath.Separator), 1))
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("could not parse %s: %s", path, err)
+	}
+	return nil
+}
+
+// extractLayout extracts the OCI layout archived in the tar stream to the given directory. Only
+// its directories and regular files are extracted, and none outside of the directory.
+func extractLayout(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not read the layout archive: %s", err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("the layout archive has an invalid path %q", hdr.Name)
+		}
+		path := filepath.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clairctl")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = readImage(dir, "", "linux/amd64")
+	assert.Error(t, err, "a directory without oci-layout isn't a layout")
+
+	// A layout with a single-platform image and a multi-platform one.
+	amd64 := writeJSONBlob(t, dir, manifest{Layers: []descriptor{{Digest: writeBlob(t, dir, []byte("amd64 base"))}, {Digest: writeBlob(t, dir, []byte("amd64 top"))}}})
+	armv7 := writeJSONBlob(t, dir, manifest{Layers: []descriptor{{Digest: writeBlob(t, dir, []byte("arm base"))}}})
+	platforms := `{"manifests": [
+		{"mediaType": "` + ociManifestMediaType + `", "digest": "` + amd64 + `", "platform": {"os": "linux", "architecture": "amd64"}},
+		{"mediaType": "` + ociManifestMediaType + `", "digest": "` + armv7 + `", "platform": {"os": "linux", "architecture": "arm", "variant": "v7"}}
+	]}`
+	root := index{Manifests: []descriptor{
+		{MediaType: ociManifestMediaType, Digest: amd64, Annotations: map[string]string{refNameAnnotation: "1.0"}},
+		{MediaType: ociIndexMediaType, Digest: writeBlob(t, dir, []byte(platforms)), Annotations: map[string]string{refNameAnnotation: "latest"}},
+	}}
+	data, _ := json.Marshal(root)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.json"), data, 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion": "1.0.0"}`), 0644))
+
+	_, err = readImage(dir, "", "linux/amd64")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "1.0, latest")
+	}
+	_, err = readImage(dir, "2.0", "linux/amd64")
+	assert.Error(t, err)
+
+	img, err := readImage(dir, "1.0", "linux/arm/v7")
+	if assert.Nil(t, err) && assert.Len(t, img.Layers, 2) {
+		assert.Equal(t, "1.0", img.Reference)
+		assert.Equal(t, amd64, img.Digest)
+
+		// The base layer is named after its digest, the others after the chain of digests.
+		base, top := img.Layers[0], img.Layers[1]
+		assert.Equal(t, base.Digest, base.Name)
+		assert.Empty(t, base.ParentName)
+		assert.Equal(t, base.Name, top.ParentName)
+		assert.NotEqual(t, top.Digest, top.Name)
+		assert.Equal(t, blobPath(dir, top.Digest), top.Path)
+	}
+
+	img, err = readImage(dir, "latest", "linux/arm/v7")
+	if assert.Nil(t, err) {
+		assert.Equal(t, armv7, img.Digest)
+		assert.Len(t, img.Layers, 1)
+	}
+	_, err = readImage(dir, "latest", "linux/arm64")
+	assert.Error(t, err)
+}
+
+func TestOpenLayout(t *testing.T) {
+	archive := func(names ...string) string {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, name := range names {
+			if strings.HasSuffix(name, "/") {
+				tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Typeflag: tar.TypeDir})
+				continue
+			}
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(name)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(name))
+		}
+		tw.WriteHeader(&tar.Header{Name: "link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+		tw.Close()
+
+		f, err := ioutil.TempFile("", "clairctl-layout")
+		assert.Nil(t, err)
+		f.Write(buf.Bytes())
+		f.Close()
+		return f.Name()
+	}
+
+	path := archive("oci-layout", "blobs/", "blobs/sha256/abc", "./index.json")
+	defer os.Remove(path)
+	dir, cleanup, err := openLayout(path)
+	if assert.Nil(t, err) {
+		for _, name := range []string{"oci-layout", "index.json", "blobs/sha256/abc"} {
+			data, err := ioutil.ReadFile(filepath.Join(dir, name))
+			assert.Nil(t, err, name)
+			assert.Contains(t, string(data), filepath.Base(name), name)
+		}
+		_, err = os.Lstat(filepath.Join(dir, "link"))
+		assert.True(t, os.IsNotExist(err), "the symbolic links are not extracted")
+
+		cleanup()
+		_, err = os.Stat(dir)
+		assert.True(t, os.IsNotExist(err), "the extracted layout is removed")
+	}
+
+	for _, name := range []string{"../escape", "blobs/../../escape", "/etc/escape"} {
+		path := archive(name)
+		_, _, err := openLayout(path)
+		assert.Error(t, err, name)
+		os.Remove(path)
+	}
+
+	// A directory is used as is.
+	dir, cleanup, err = openLayout(os.TempDir())
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.TempDir(), dir)
+		cleanup()
+		_, err = os.Stat(dir)
+		assert.Nil(t, err)
+	}
+}
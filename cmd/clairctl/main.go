@@ -0,0 +1,319 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command clairctl analyzes the images of a local OCI layout entirely client-side, without a
+// Clair server, and prints their report in the formats of the v2 API.
+//
+// The layers are analyzed by the same detectors as Clair's, and matched against the
+// vulnerabilities of a bundle, made by "clair bundle" or downloaded from the feed of the v2 API,
+// which are kept in memory. Nothing is sent over the network, so that it can run on air-gapped
+// machines.
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"golang.org/x/net/context"
+
+	apicontext "github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/api/v2"
+	"github.com/coreos/clair/bundle"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/registry"
+	"github.com/coreos/clair/worker"
+
+	// Register components
+	_ "github.com/coreos/clair/database/memory"
+
+	_ "github.com/coreos/clair/worker/detectors/data/docker"
+
+	_ "github.com/coreos/clair/worker/detectors/feature/apk"
+	_ "github.com/coreos/clair/worker/detectors/feature/cargo"
+	_ "github.com/coreos/clair/worker/detectors/feature/composer"
+	_ "github.com/coreos/clair/worker/detectors/feature/conda"
+	_ "github.com/coreos/clair/worker/detectors/feature/dpkg"
+	_ "github.com/coreos/clair/worker/detectors/feature/nuget"
+	_ "github.com/coreos/clair/worker/detectors/feature/rpm"
+
+	_ "github.com/coreos/clair/worker/detectors/namespace/alpinerelease"
+	_ "github.com/coreos/clair/worker/detectors/namespace/aptsources"
+	_ "github.com/coreos/clair/worker/detectors/namespace/lsbrelease"
+	_ "github.com/coreos/clair/worker/detectors/namespace/osrelease"
+	_ "github.com/coreos/clair/worker/detectors/namespace/redhatrelease"
+)
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair/cmd/clairctl", "main")
+
+// bundleBatchSize is the number of vulnerabilities of the bundle inserted at once.
+const bundleBatchSize = 1000
+
+func main() {
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flagLayout := flags.String("layout", "-", "OCI layout to analyze: a directory, a tar archive of one, or \"-\" to read the archive from the standard input.")
+	flagRef := flags.String("ref", "", "Reference of the image of the layout to analyze, as given by its org.opencontainers.image.ref.name annotation; required if the layout has several images.")
+	flagPlatform := flags.String("platform", "linux/amd64", "Platform of the image to analyze, for multi-platform images.")
+	flagBundle := flags.String("bundle", "", "Vulnerability bundle to match the features of the image against; only the features are reported if empty.")
+	flagKey := flags.String("key", "", "PEM file of the public keys trusted to sign the bundle, whose signature is read from the bundle file followed by \".sig\"; the bundle isn't verified if empty.")
+	flagFormat := flags.String("format", "json", "Format of the report: json, html, pdf, csv or xlsx.")
+	flagOutput := flags.String("output", "-", "Write the report to the specified file, or to the standard output if \"-\".")
+	flagConfigPath := flags.String("config", "", "Load the configuration of the detectors and of the reports from the specified Clair configuration file.")
+	flagLogLevel := flags.String("log-level", "warning", "Define the logging level.")
+	flags.Parse(os.Args[1:])
+
+	logLevel, err := capnslog.ParseLevel(strings.ToUpper(*flagLogLevel))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid log level %q\n", *flagLogLevel)
+		os.Exit(2)
+	}
+	capnslog.SetGlobalLogLevel(logLevel)
+	capnslog.SetFormatter(capnslog.NewPrettyFormatter(os.Stderr, false))
+
+	cfg, err := config.Load(*flagConfigPath)
+	if err != nil {
+		log.Fatalf("failed to load configuration: %s", err)
+	}
+	if err := configureWorker(cfg.API); err != nil {
+		log.Fatal(err)
+	}
+
+	dir, cleanup, err := openLayout(*flagLayout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cleanup()
+
+	img, err := readImage(dir, *flagRef, *flagPlatform)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	datastore, err := database.Open(config.RegistrableComponentConfig{Type: "memory"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer datastore.Close()
+
+	if *flagBundle != "" {
+		start := time.Now()
+		header, count, err := importBundle(datastore, *flagBundle, *flagKey)
+		if err != nil {
+			log.Fatalf("failed to import the vulnerability bundle: %s", err)
+		}
+		log.Infof("imported %d vulnerabilities of bundle %s, created %v, in %v", count, header.Version, header.Created, time.Since(start))
+	} else {
+		log.Warning("no vulnerability bundle is given: only the features of the image are reported")
+	}
+
+	if err := analyze(context.Background(), datastore, img); err != nil {
+		log.Fatal(err)
+	}
+
+	report, err := render(&apicontext.RouteContext{Store: datastore, Config: cfg.API}, img, *flagFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := writeOutput(*flagOutput, report); err != nil {
+		log.Fatalf("failed to write the report: %s", err)
+	}
+}
+
+// configureWorker applies the configuration of the detectors of the API, as Clair would.
+func configureWorker(cfg *config.APIConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	worker.IndexInstalledOnly(cfg.InstalledOnly)
+	if d := cfg.Detectors; d != nil {
+		if err := worker.ConfigureDetectors(d.Disabled, d.Params); err != nil {
+			return err
+		}
+	}
+	if budget := cfg.Budget; budget != nil {
+		worker.UseBudget(worker.Budget{
+			Timeout:        budget.Timeout,
+			MaxGoroutines:  budget.MaxGoroutines,
+			MaxFileSize:    budget.MaxFileSize,
+			MaxArchiveSize: budget.MaxArchiveSize,
+		})
+	}
+	return nil
+}
+
+// openLayout returns the directory of the given OCI layout, extracting it first to a temporary
+// directory if it is archived, and a function removing that directory.
+func openLayout(path string) (string, func(), error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", nil, err
+		}
+		if info.IsDir() {
+			return path, func() {}, nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return "", nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dir, err := ioutil.TempDir("", "clairctl-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	if err := extractLayout(r, dir); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+// importBundle inserts the vulnerabilities of the bundle at the given path, once its signature is
+// verified with the keys of the given PEM file, if any.
+func importBundle(datastore database.Datastore, path, keyPath string) (bundle.Header, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return bundle.Header{}, 0, err
+	}
+	defer f.Close()
+
+	if keyPath != "" {
+		data, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			return bundle.Header{}, 0, err
+		}
+		keys, err := registry.ParsePublicKeys(data)
+		if err != nil {
+			return bundle.Header{}, 0, fmt.Errorf("could not parse public keys %s: %s", keyPath, err)
+		}
+		signature, err := ioutil.ReadFile(path + ".sig")
+		if err != nil {
+			return bundle.Header{}, 0, err
+		}
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return bundle.Header{}, 0, err
+		}
+		if !bundle.Verify(hash.Sum(nil), signature, keys) {
+			return bundle.Header{}, 0, errors.New("the signature of the bundle isn't valid")
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return bundle.Header{}, 0, err
+		}
+	}
+
+	reader, err := bundle.NewReader(f)
+	if err != nil {
+		return bundle.Header{}, 0, err
+	}
+
+	// No notification is created, as no layer can be affected yet.
+	var count int
+	batch := make([]database.Vulnerability, 0, bundleBatchSize)
+	insert := func() error {
+		if err := datastore.InsertVulnerabilities(batch, false); err != nil {
+			return err
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		vulnerability, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return reader.Header, count, err
+		}
+
+		batch = append(batch, vulnerability)
+		if len(batch) == bundleBatchSize {
+			if err := insert(); err != nil {
+				return reader.Header, count, err
+			}
+		}
+	}
+	if err := insert(); err != nil {
+		return reader.Header, count, err
+	}
+
+	return reader.Header, count, nil
+}
+
+// analyze analyzes the layers of the image, from the base one.
+func analyze(ctx context.Context, datastore database.Datastore, img image) error {
+	for i, l := range img.Layers {
+		log.Infof("analyzing layer %d/%d (%s)", i+1, len(img.Layers), l.Digest)
+		if err := worker.Process(ctx, datastore, "Docker", l.Name, l.ParentName, l.Path, l.Digest, nil); err != nil {
+			return fmt.Errorf("could not analyze layer %s: %s", l.Digest, err)
+		}
+	}
+	return nil
+}
+
+// render renders the report of the image in the given format, with the routes of the v2 API, so
+// that the reports are the same as Clair's.
+func render(ctx *apicontext.RouteContext, img image, format string) ([]byte, error) {
+	name := url.PathEscape(img.Layers[len(img.Layers)-1].Name)
+	var path string
+	switch format {
+	case "json":
+		path = "/layers/" + name + "/report"
+	case "html":
+		path = "/images/" + name + "/report.html"
+	case "pdf":
+		path = "/images/" + name + "/report.pdf"
+	case "csv", "xlsx":
+		path = "/layers/" + name + "/export?format=" + format
+	default:
+		return nil, fmt.Errorf("unknown format '%s', expected json, html, pdf, csv or xlsx", format)
+	}
+
+	r, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	w := httptest.NewRecorder()
+	v2.NewRouter(ctx).ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("could not render the %s report: %s", format, strings.TrimSpace(w.Body.String()))
+	}
+	return w.Body.Bytes(), nil
+}
+
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,189 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	apicontext "github.com/coreos/clair/api/context"
+	"github.com/coreos/clair/api/v2"
+	"github.com/coreos/clair/attestation"
+	"github.com/coreos/clair/bundle"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+// writeBlob writes a blob to the OCI layout in the directory and returns its digest.
+func writeBlob(t *testing.T, dir string, data []byte) string {
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755))
+	assert.Nil(t, ioutil.WriteFile(blobPath(dir, digest), data, 0644))
+	return digest
+}
+
+// writeJSONBlob writes the JSON encoding of v as a blob of the OCI layout.
+func writeJSONBlob(t *testing.T, dir string, v interface{}) string {
+	data, err := json.Marshal(v)
+	assert.Nil(t, err)
+	return writeBlob(t, dir, data)
+}
+
+// layerBlob returns a gzip-compressed layer with the given files.
+func layerBlob(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		assert.Nil(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		tw.Write([]byte(content))
+	}
+	assert.Nil(t, tw.Close())
+	assert.Nil(t, gw.Close())
+	return buf.Bytes()
+}
+
+// writeLayout writes an OCI layout with an image of the given layers, tagged "latest".
+func writeLayout(t *testing.T, dir string, layers ...map[string]string) {
+	var m manifest
+	m.MediaType = ociManifestMediaType
+	for _, files := range layers {
+		m.Layers = append(m.Layers, descriptor{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: writeBlob(t, dir, layerBlob(t, files))})
+	}
+	root := index{Manifests: []descriptor{{
+		MediaType:   ociManifestMediaType,
+		Digest:      writeJSONBlob(t, dir, m),
+		Annotations: map[string]string{refNameAnnotation: "latest"},
+	}}}
+	data, _ := json.Marshal(root)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.json"), data, 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion": "1.0.0"}`), 0644))
+}
+
+func TestAnalyze(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clairctl")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	writeLayout(t, filepath.Join(dir, "layout"),
+		map[string]string{
+			"etc/os-release":      "ID=debian\nVERSION_ID=\"8\"\n",
+			"var/lib/dpkg/status": "Package: openssl\nStatus: install ok installed\nVersion: 1.0.1e-2\n\n",
+		},
+		map[string]string{"app/main": "#!/bin/sh\n"},
+	)
+
+	// The bundle is signed as "clair bundle" signs it.
+	namespace := database.Namespace{Name: "debian:8", VersionFormat: "dpkg"}
+	var buf bytes.Buffer
+	w, err := bundle.NewWriter(&buf, bundle.Header{Version: "20161017", Created: time.Now()})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, w.Write(database.Vulnerability{
+		Name:      "CVE-2016-0001",
+		Namespace: namespace,
+		Severity:  types.High,
+		FixedIn:   []database.FeatureVersion{{Feature: database.Feature{Name: "openssl", Namespace: namespace}, Version: "1.0.1t-1"}},
+	}))
+	assert.Nil(t, w.Close())
+	bundlePath := filepath.Join(dir, "vulnerabilities.ndjson.gz")
+	assert.Nil(t, ioutil.WriteFile(bundlePath, buf.Bytes(), 0644))
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	signer, err := attestation.NewSigner(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if !assert.Nil(t, err) {
+		return
+	}
+	signature, err := signer.SignBlob(w.Digest())
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(bundlePath+".sig", signature, 0644))
+	publicDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	keyPath := filepath.Join(dir, "key.pub")
+	assert.Nil(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644))
+
+	img, err := readImage(filepath.Join(dir, "layout"), "", "linux/amd64")
+	if !assert.Nil(t, err) || !assert.Len(t, img.Layers, 2) {
+		return
+	}
+
+	datastore, err := database.Open(config.RegistrableComponentConfig{Type: "memory"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer datastore.Close()
+
+	// A bundle signed by another key is rejected.
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherDER, _ := x509.MarshalPKIXPublicKey(&other.PublicKey)
+	otherPath := filepath.Join(dir, "other.pub")
+	assert.Nil(t, ioutil.WriteFile(otherPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: otherDER}), 0644))
+	_, _, err = importBundle(datastore, bundlePath, otherPath)
+	assert.Error(t, err)
+
+	_, count, err := importBundle(datastore, bundlePath, keyPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	if !assert.Nil(t, analyze(context.Background(), datastore, img)) {
+		return
+	}
+
+	data, err := render(&apicontext.RouteContext{Store: datastore, Config: &config.APIConfig{}}, img, "json")
+	if !assert.Nil(t, err) {
+		return
+	}
+	var report v2.Report
+	assert.Nil(t, json.Unmarshal(data, &report))
+	assert.Equal(t, img.Layers[1].Name, report.LayerName)
+	if assert.Len(t, report.Features, 1) {
+		feature := report.Features[0]
+		assert.Equal(t, "openssl", feature.Name)
+		assert.Equal(t, "debian:8", feature.NamespaceName)
+		if assert.Len(t, feature.Vulnerabilities, 1) {
+			assert.Equal(t, "CVE-2016-0001", feature.Vulnerabilities[0].Name)
+			assert.Equal(t, "1.0.1t-1", feature.Vulnerabilities[0].FixedBy)
+		}
+	}
+
+	data, err = render(&apicontext.RouteContext{Store: datastore, Config: &config.APIConfig{}}, img, "csv")
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "CVE-2016-0001")
+
+	_, err = render(&apicontext.RouteContext{Store: datastore, Config: &config.APIConfig{}}, img, "yaml")
+	assert.Error(t, err)
+}
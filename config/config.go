@@ -43,22 +43,224 @@ type File struct {
 
 // Config is the global configuration for an instance of Clair.
 type Config struct {
-	Database RegistrableComponentConfig
-	Updater  *UpdaterConfig
-	Notifier *NotifierConfig
-	API      *APIConfig
+	Database  RegistrableComponentConfig
+	Updater   *UpdaterConfig
+	Notifier  *NotifierConfig
+	API       *APIConfig
+	Worker    *WorkerConfig
+	Tracker   *TrackerConfig
+	Ownership *OwnershipConfig
+	Enricher  *EnricherConfig
+	Log       *LogConfig
+	Tracing   *TracingConfig
+}
+
+// TracingConfig is the configuration of the export of the traces to an OpenTelemetry collector.
+type TracingConfig struct {
+	// Endpoint is the base URL of the OTLP/HTTP receiver of the collector, e.g.
+	// "http://localhost:4318", to which the traces are posted under "/v1/traces". Tracing is
+	// disabled unless it is set.
+	Endpoint string
+
+	// Headers are added to the requests to the collector, e.g. for authentication.
+	Headers map[string]string
+
+	// SampleRatio is the fraction of the traces started by Clair that are exported, between 0 and
+	// 1. Zero exports every trace. The traces of the requests are exported if their caller's are.
+	SampleRatio float64
+
+	// ServiceName is the name of the service in the traces, "clair" by default.
+	ServiceName string
+}
+
+// LogConfig is the configuration of the logs.
+type LogConfig struct {
+	// Format is the format of the logs: "text" (the default), "json" or "logfmt", or another
+	// registered one.
+	Format string
+
+	// Levels overrides the level of the logs of some components, e.g. "debug" for "worker".
+	Levels map[string]string
 }
 
 // UpdaterConfig is the configuration for the Updater service.
 type UpdaterConfig struct {
 	Interval time.Duration
+
+	// ArchivedNamespaces lists the end-of-life namespaces whose vulnerabilities are moved to the
+	// archive after every update and no longer updated.
+	ArchivedNamespaces []string
+
+	// DisabledFetchers are the names of the registered fetchers that aren't run, e.g. "rhel".
+	DisabledFetchers []string
+
+	// Namespaces restricts the vulnerabilities that are stored to the namespaces matching one of
+	// these patterns, e.g. "ubuntu:22.04" or "debian:*", to keep the database small. Every
+	// namespace is stored if it is empty.
+	Namespaces []string
+
+	// PruneGracePeriod is how long the namespaces that no indexed layer uses are kept before their
+	// vulnerabilities and features are removed from the database and no longer stored, until a
+	// layer uses them. The unused namespaces are kept if it is zero.
+	PruneGracePeriod time.Duration
+
+	// Bundle configures the vulnerability bundle that an empty database is initialized with
+	// before its first update, or that is mirrored instead of running the fetchers; nil disables
+	// it.
+	Bundle *BundleConfig
+
+	// Params are the configurations of the registered fetchers that need one, by fetcher name.
+	Params map[string]interface{} `yaml:",inline"`
+
+	// decoded are the names of the Params that the fetchers decoded.
+	decoded map[string]bool
+}
+
+// BundleConfig is the configuration of the signed vulnerability bundle that an empty database is
+// initialized with, so that it can be queried before its first update completes.
+type BundleConfig struct {
+	// URL is the HTTPS URL of the bundle.
+	URL string
+
+	// SignatureURL is the HTTPS URL of the signature of the bundle, the URL followed by ".sig" by
+	// default.
+	SignatureURL string
+
+	// Keys are the paths of the PEM files of the ECDSA public keys trusted to sign the bundle.
+	Keys []string
+
+	// Timeout bounds the download of the bundle, 10 minutes by default.
+	Timeout time.Duration
+
+	// Mirror makes the bundle the sole source of the vulnerabilities: it is downloaded at every
+	// update instead of running the fetchers, typically from the feed of another Clair instance.
+	Mirror bool
 }
 
 // NotifierConfig is the configuration for the Notifier service and its registered notifiers.
 type NotifierConfig struct {
 	Attempts         int
 	RenotifyInterval time.Duration
-	Params           map[string]interface{} `yaml:",inline"`
+
+	// BackOff is how long a failed delivery waits before its first retry, which doubles after each
+	// attempt up to MaxBackOff. Once a delivery fails Attempts times, the notification is marked as
+	// failed and retried after the RenotifyInterval.
+	BackOff    time.Duration
+	MaxBackOff time.Duration
+
+	// NameFormat is the format of the names of the new notifications: "uuid" by default, or
+	// "uuidv7" and "ulid" for names ordered by creation time.
+	NameFormat string
+
+	// Workers is the number of notifications delivered concurrently. New notifications are only
+	// fetched when a worker is available, so slow receivers throttle the notifier.
+	Workers int
+
+	// Routes send the notifications affecting the images that have some labels to channels of the
+	// notifiers, e.g. to the chat room of the team owning the images.
+	Routes []NotificationRoute
+
+	// MaintenanceWindows hold the deliveries of the notifications below a priority to some
+	// notifiers and channels during recurring windows, and send them as digests once the windows
+	// end.
+	MaintenanceWindows []MaintenanceWindow
+
+	Params map[string]interface{} `yaml:",inline"`
+
+	// decoded are the names of the Params that the notifiers decoded.
+	decoded map[string]bool
+}
+
+// NotificationRoute routes the notifications affecting an image that has all the given labels to
+// the given channels, instead of the default destinations of the notifiers having the channels.
+type NotificationRoute struct {
+	Labels   map[string]string
+	Channels []string
+}
+
+// MaintenanceWindow is a recurring window during which the deliveries of the notifications to the
+// targets are held, unless their priority is at least the Severity.
+type MaintenanceWindow struct {
+	// Targets are the notifiers and their channels, e.g. "webhook" or "webhook/payments". The
+	// window applies to every target if there is none.
+	Targets []string
+	// Days are the days of the week on which the window starts, e.g. "Sat", every day by default.
+	Days []string
+	// Start and End are the times of the day, e.g. "22:00" and "06:00", in the Location, UTC by
+	// default. A window ending before it starts ends on the next day.
+	Start    string
+	End      string
+	Location string
+	// Severity is the lowest priority of the notifications that are delivered during the window
+	// anyway, Critical by default.
+	Severity string
+}
+
+// EnricherConfig is the configuration for the service augmenting the vulnerabilities with the
+// severities, CVSS, CWEs and references of the National Vulnerability Database.
+type EnricherConfig struct {
+	// Interval is how often the vulnerabilities are enriched when the Updater doesn't update them
+	// in the meantime, which always triggers an enrichment; zero disables the service.
+	Interval time.Duration
+
+	// FeedURL is the base URL of the NVD JSON feeds, e.g. of a mirror. It defaults to the feeds
+	// of the NVD.
+	FeedURL string
+}
+
+// OwnershipConfig is the configuration of the mapping of the images to their owners.
+type OwnershipConfig struct {
+	// Source is the path of a YAML file, or the HTTP(S) URL of a YAML document, listing the rules
+	// that map image name patterns to owners.
+	Source string
+
+	// Interval is how often the source is loaded again; zero loads it once at startup.
+	Interval time.Duration
+}
+
+// TrackerConfig is the configuration for the service keeping the watched tags indexed.
+type TrackerConfig struct {
+	// Interval is how often the watched tags are resolved; zero disables the service.
+	Interval time.Duration
+
+	// Registries are the configurations of the registries, by base URL.
+	Registries map[string]RegistryConfig
+
+	// Signatures configures the verification of the signatures of the images; nil disables it.
+	Signatures *SignatureConfig
+
+	// Attestations configures the attestation of the vulnerability reports of the images; nil
+	// disables it.
+	Attestations *AttestationConfig
+}
+
+// AttestationConfig is the configuration of the attestations of the vulnerability reports of the
+// images of the watched tags, which are pushed to their registries.
+type AttestationConfig struct {
+	// Key is the path of the PEM file of the ECDSA private key signing the attestations.
+	Key string
+}
+
+// SignatureConfig is the configuration of the verification of the cosign signatures of the images
+// of the watched tags.
+type SignatureConfig struct {
+	// Keys are the paths of the PEM files of the public keys trusted to sign the images.
+	Keys []string
+
+	// Require prevents indexing the images that aren't signed by any of the keys.
+	Require bool
+}
+
+// RegistryConfig is the configuration of a registry hosting watched tags.
+type RegistryConfig struct {
+	// Username and Password are the credentials used to pull the images, and to push their
+	// attestations and reports.
+	Username string
+	Password string
+
+	// Publish enables publishing the vulnerability reports of the images to the registry, as
+	// their OCI referrers.
+	Publish bool
 }
 
 // APIConfig is the configuration for the API service.
@@ -68,6 +270,187 @@ type APIConfig struct {
 	Timeout                   time.Duration
 	PaginationKey             string
 	CertFile, KeyFile, CAFile string
+
+	// ReadHeaderTimeout bounds the time that the clients have to send the headers of a request,
+	// and IdleTimeout the time that a connection may stay idle, whether between two requests or
+	// while the body of a request is read or its response written, so that slow clients can't hold
+	// connections open indefinitely. Zero means no limit.
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+
+	// GRPCPort is the port of the gRPC API, served with the same certificates as the main API. It
+	// is disabled unless it is set.
+	GRPCPort int
+
+	// ReadOnly rejects the requests that modify layers, vulnerabilities or notifications while
+	// still serving reads, e.g. during maintenance windows or datastore failovers.
+	ReadOnly bool
+
+	// AdvisoryTokens are the bearer tokens of the clients allowed to create, update and delete
+	// vulnerabilities and their fixes through the v2 API, e.g. to publish the advisories of in-house
+	// packages. Those routes are disabled unless at least one is set.
+	AdvisoryTokens []string
+
+	// UploadDir is where the layer tarballs uploaded to the API are stored until they are
+	// analyzed. It defaults to a directory in the system's temporary directory.
+	UploadDir string
+
+	// MaxUploadSize is the size in bytes of the largest layer tarball accepted by the API, whether
+	// uploaded in chunks or sent along with a layer. It defaults to 10 GiB.
+	MaxUploadSize int64
+
+	// FalsePositives is the policy applied to the findings flagged as false positives in the
+	// reports: "annotate" (the default) keeps them along with the flag, "exclude" removes them.
+	FalsePositives string
+
+	// KernelVulnerabilities is the policy applied to the vulnerabilities of the kernel packages in
+	// the reports, which don't affect containers as they run on the kernel of their host:
+	// "report" (the default) keeps them, "exclude" removes them. Kernel packages are flagged
+	// either way.
+	KernelVulnerabilities string
+
+	// ExportColumns are the columns of the CSV and XLSX exports of the reports, unless a request
+	// specifies them.
+	ExportColumns []string
+
+	// Reports configures the HTML and PDF reports of the images.
+	Reports *ReportsConfig
+
+	// IndexingWorkers is the number of layers indexed concurrently, the others waiting in priority
+	// order. Zero means no limit.
+	IndexingWorkers int
+
+	// MaxIndexingQueueDepth is the number of layers being indexed or waiting to be above which new
+	// layers are rejected until the queue drains. Zero means no limit.
+	MaxIndexingQueueDepth int
+
+	// InstalledOnly makes the layers be indexed with only the packages that are fully installed,
+	// instead of every package along with its state, e.g. the removed dpkg packages whose
+	// configuration files remain.
+	InstalledOnly bool
+
+	// Evidence makes the layers be indexed with the executables and libraries of their packages
+	// that are in the image, i.e. not deleted by later layers, so that the reports tell which
+	// packages are listed while their binaries are gone.
+	Evidence bool
+
+	// Budget, if set, bounds the resources spent on the analysis of every layer, which is canceled
+	// once it exceeds them.
+	Budget *BudgetConfig
+
+	// Detectors disables and configures the detectors the layers are analyzed with.
+	Detectors *DetectorsConfig
+
+	// Feed, if set, serves the vulnerabilities of the database as a signed bundle that other Clair
+	// instances mirror.
+	Feed *FeedConfig
+
+	// AccessLog, if set, logs the requests to the main and gRPC APIs as JSON lines.
+	AccessLog *AccessLogConfig
+}
+
+// AccessLogConfig is the configuration of the access log of the API.
+type AccessLogConfig struct {
+	// Path is the file the access log is appended to. It is written to the standard output unless
+	// it is set.
+	Path string
+
+	// Sample logs one in every Sample requests of every route, e.g. to spare the high-volume ones.
+	// Zero or one logs every request.
+	Sample int
+
+	// RouteSamples overrides Sample for some routes, by route name, e.g. "v2/getLayer".
+	RouteSamples map[string]int
+
+	// SlowThreshold is the duration above which the requests are logged regardless of the
+	// sampling, along with their headers and the time spent in every method of the datastore.
+	// Zero disables it. The requests failing with a server error are always logged.
+	SlowThreshold time.Duration
+}
+
+// FeedConfig is the configuration of the feed of the vulnerabilities, served by the v2 API as a
+// signed bundle.
+type FeedConfig struct {
+	// Key is the path of the PEM file of the ECDSA private key signing the bundle.
+	Key string
+}
+
+// ReportsConfig is the configuration of the HTML and PDF reports of the images.
+type ReportsConfig struct {
+	// Header and Footer are HTML fragments branding the reports, e.g. with a logo as a data URI.
+	Header string
+	Footer string
+
+	// PDFCommand converts the HTML report read from its standard input into a PDF document
+	// written to its standard output, e.g. ["wkhtmltopdf", "--quiet", "-", "-"]. The PDF reports
+	// are disabled unless it is set.
+	PDFCommand []string
+
+	// PDFTimeout is the time after which the conversion of a report is aborted.
+	PDFTimeout time.Duration
+}
+
+// WorkerConfig is the configuration of the analysis of the layers.
+type WorkerConfig struct {
+	// Sandbox, if set, makes every layer be downloaded, extracted and analyzed in a separate
+	// process with restricted resources.
+	Sandbox *SandboxConfig
+}
+
+// SandboxConfig is the configuration of the processes in which the layers are analyzed.
+type SandboxConfig struct {
+	// Timeout is the time after which the analysis of a layer is aborted. Zero means no limit.
+	Timeout time.Duration
+
+	// CPUTime is the CPU time after which the analysis of a layer is aborted. Zero means no
+	// limit.
+	CPUTime time.Duration
+
+	// MaxOpenFiles is the number of files the analysis of a layer may have open at the same time.
+	// Zero means no limit.
+	MaxOpenFiles uint64
+
+	// MaxMemory is the size in bytes of the memory the analysis of a layer may allocate, beyond
+	// which it crashes. Zero means no limit.
+	MaxMemory int64
+
+	// Namespaces runs the analyses in their own user, mount, PID, IPC and UTS namespaces. They
+	// share the network of Clair, which they download the layers with.
+	Namespaces bool
+
+	// Seccomp denies the analyses the system calls that only serve to escape or attack the host,
+	// e.g. mount, ptrace or the loading of kernel modules.
+	Seccomp bool
+}
+
+// DetectorsConfig is the configuration of the detectors the layers are analyzed with.
+type DetectorsConfig struct {
+	// Disabled are the names of the registered detectors that aren't run, e.g. "cargo" to skip
+	// the scan of the executables.
+	Disabled []string
+
+	// Params are the options of the registered detectors that have some, by detector name, e.g.
+	// the paths searched by "composer".
+	Params map[string]interface{} `yaml:",inline"`
+}
+
+// BudgetConfig bounds the resources spent on the analysis of every layer, whether in-process or in
+// the sandbox.
+type BudgetConfig struct {
+	// Timeout is the wall-clock time after which the analysis of a layer is canceled. Zero means no
+	// limit.
+	Timeout time.Duration
+
+	// MaxGoroutines is the number of detectors run at the same time on a layer. Zero means one.
+	MaxGoroutines int
+
+	// MaxFileSize is the size in bytes of the largest file extracted from a layer, e.g. a package
+	// database. Zero means 200 MiB.
+	MaxFileSize int64
+
+	// MaxArchiveSize is the size in bytes of the largest layer once decompressed. Zero means
+	// 16 GiB.
+	MaxArchiveSize int64
 }
 
 // DefaultConfig is a configuration that can be used as a fallback value.
@@ -80,13 +463,27 @@ func DefaultConfig() Config {
 			Interval: 1 * time.Hour,
 		},
 		API: &APIConfig{
-			Port:       6060,
-			HealthPort: 6061,
-			Timeout:    900 * time.Second,
+			Port:              6060,
+			HealthPort:        6061,
+			Timeout:           900 * time.Second,
+			ReadHeaderTimeout: 30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+		},
+		Tracker: &TrackerConfig{
+			Interval: 15 * time.Minute,
+		},
+		Ownership: &OwnershipConfig{
+			Interval: 10 * time.Minute,
+		},
+		Enricher: &EnricherConfig{
+			Interval: 24 * time.Hour,
 		},
 		Notifier: &NotifierConfig{
 			Attempts:         5,
 			RenotifyInterval: 2 * time.Hour,
+			BackOff:          time.Second,
+			MaxBackOff:       15 * time.Minute,
+			Workers:          1,
 		},
 	}
 }
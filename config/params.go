@@ -0,0 +1,171 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// DecodeParams decodes the Params of the fetcher with the given name into v and returns whether
+// it has some. The options that v doesn't have are rejected rather than ignored, e.g. misspelled
+// ones.
+func (c *UpdaterConfig) DecodeParams(name string, v interface{}) (bool, error) {
+	if c.decoded == nil {
+		c.decoded = make(map[string]bool)
+	}
+	return decodeParams(c.Params, c.decoded, name, v)
+}
+
+// UnknownParams returns the names of the Params that no fetcher decoded and that aren't one of
+// the given names, sorted.
+func (c *UpdaterConfig) UnknownParams(known []string) []string {
+	return unknownParams(c.Params, c.decoded, known)
+}
+
+// DecodeParams decodes the Params of the notifier with the given name into v and returns whether
+// it has some. The options that v doesn't have are rejected rather than ignored, e.g. misspelled
+// ones.
+func (c *NotifierConfig) DecodeParams(name string, v interface{}) (bool, error) {
+	if c.decoded == nil {
+		c.decoded = make(map[string]bool)
+	}
+	return decodeParams(c.Params, c.decoded, name, v)
+}
+
+// UnknownParams returns the names of the Params that no notifier decoded and that aren't one of
+// the given names, sorted.
+func (c *NotifierConfig) UnknownParams(known []string) []string {
+	return unknownParams(c.Params, c.decoded, known)
+}
+
+func decodeParams(params map[string]interface{}, decoded map[string]bool, name string, v interface{}) (bool, error) {
+	decoded[name] = true
+	param, ok := params[name]
+	if !ok {
+		return false, nil
+	}
+
+	if err := checkFields(param, reflect.TypeOf(v), name); err != nil {
+		return true, err
+	}
+	d, err := yaml.Marshal(param)
+	if err != nil {
+		return true, fmt.Errorf("invalid configuration: %s", err)
+	}
+	if err := yaml.Unmarshal(d, v); err != nil {
+		return true, fmt.Errorf("invalid configuration: %s", err)
+	}
+	return true, nil
+}
+
+func unknownParams(params map[string]interface{}, decoded map[string]bool, known []string) []string {
+	isKnown := make(map[string]bool, len(known))
+	for _, name := range known {
+		isKnown[name] = true
+	}
+
+	var unknown []string
+	for name := range params {
+		if !decoded[name] && !isKnown[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// checkFields returns an error if a map of the YAML node has a key that isn't a field of the type
+// it is decoded into. The path locates the node in the error.
+func checkFields(node interface{}, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// The types decoding themselves accept what they want.
+	if t.Implements(unmarshalerType) || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+
+	n := reflect.ValueOf(node)
+	switch n.Kind() {
+	case reflect.Map:
+		for _, k := range n.MapKeys() {
+			key, v := fmt.Sprint(k.Interface()), n.MapIndex(k).Interface()
+			switch t.Kind() {
+			case reflect.Struct:
+				field, ok := yamlField(t, key)
+				if !ok {
+					return fmt.Errorf("%s has an unknown option '%s'", path, key)
+				}
+				if err := checkFields(v, field, path+"."+key); err != nil {
+					return err
+				}
+			case reflect.Map:
+				if err := checkFields(v, t.Elem(), path+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i := 0; i < n.Len(); i++ {
+				if err := checkFields(n.Index(i).Interface(), t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// yamlField returns the type of the field of the struct that the given key decodes into, named
+// as the yaml package does: by its tag, or else its lowercased name.
+func yamlField(t reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		name, inline := tag[0], false
+		for _, flag := range tag[1:] {
+			inline = inline || flag == "inline"
+		}
+		switch {
+		case name == "-":
+			continue
+		case inline && field.Type.Kind() == reflect.Map:
+			return field.Type.Elem(), true
+		case inline:
+			if ft, ok := yamlField(field.Type, key); ok {
+				return ft, true
+			}
+			continue
+		case name == "":
+			name = strings.ToLower(field.Name)
+		}
+		if name == key {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
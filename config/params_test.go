@@ -0,0 +1,68 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+type testParams struct {
+	URL      string            `yaml:"url"`
+	Channels map[string]string `yaml:"channels"`
+	Retry    struct {
+		Attempts int
+	}
+}
+
+func TestDecodeParams(t *testing.T) {
+	var c NotifierConfig
+	err := yaml.Unmarshal([]byte(`
+attempts: 3
+test:
+  url: https://example.com
+  channels:
+    payments: https://example.com/payments
+  retry:
+    attempts: 2
+misspelled:
+  url: https://example.com
+`), &c)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var params testParams
+	ok, err := c.DecodeParams("test", &params)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", params.URL)
+	assert.Equal(t, map[string]string{"payments": "https://example.com/payments"}, params.Channels)
+	assert.Equal(t, 2, params.Retry.Attempts)
+
+	ok, err = c.DecodeParams("missing", &params)
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
+	// The options that no notifier decoded and the ones that the notifiers don't have are
+	// rejected, at any depth.
+	assert.Equal(t, []string{"misspelled"}, c.UnknownParams(nil))
+	assert.Empty(t, c.UnknownParams([]string{"misspelled"}))
+	c.Params["test"].(map[interface{}]interface{})["retry"] = map[interface{}]interface{}{"attempt": 2}
+	_, err = c.DecodeParams("test", &params)
+	assert.EqualError(t, err, "test.retry has an unknown option 'attempt'")
+}
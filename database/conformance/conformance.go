@@ -0,0 +1,1023 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conformance is a test suite that every database.Datastore implementation must pass.
+//
+// Drivers, including third-party ones, run it from their tests by giving a testutil.Harness that
+// opens empty datastores:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, testutil.Harness{Open: openEmptyDatastore, Fixture: testutil.DefaultFixture()})
+//	}
+//
+// The harness must load testutil.DefaultFixture, which the suite's assertions are based on.
+package conformance
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/database/testutil"
+	"github.com/coreos/clair/ext/versionfmt"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+// Run runs the whole suite.
+func Run(t *testing.T, h testutil.Harness) {
+	Health(t, h)
+	Namespaces(t, h)
+	Layers(t, h)
+	LayerLabels(t, h)
+	Features(t, h)
+	Vulnerabilities(t, h)
+	StreamVulnerabilities(t, h)
+	FalsePositives(t, h)
+	WatchedTags(t, h)
+	Provenances(t, h)
+	Images(t, h)
+	LayerAnalyses(t, h)
+	PruneNamespaces(t, h)
+	ArchiveVulnerabilities(t, h)
+	Notifications(t, h)
+	NotificationLocks(t, h)
+	NotificationReasons(t, h)
+	NotificationOrder(t, h)
+}
+
+// Health verifies that the datastore reports itself as healthy, along with its version.
+func Health(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	status, err := datastore.Health(context.Background())
+	if assert.Nil(t, err, "Health") {
+		assert.NotEqual(t, database.Unhealthy, status.State, "Health")
+		assert.NotEmpty(t, status.Version, "Health")
+	}
+}
+
+// Namespaces verifies that the namespaces of layers and vulnerabilities are listed.
+func Namespaces(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	namespaces, err := datastore.ListNamespaces()
+	if assert.Nil(t, err, "Namespaces") && assert.Len(t, namespaces, 1, "Namespaces") {
+		assert.Equal(t, "debian:7", namespaces[0].Name, "Namespaces")
+		assert.Equal(t, testutil.Namespace("debian:7").VersionFormat, namespaces[0].VersionFormat, "Namespaces")
+	}
+}
+
+// Layers verifies the insertion, retrieval and deletion of layers.
+func Layers(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	_, err := datastore.FindLayer("unknown", false, false)
+	assert.Equal(t, cerrors.ErrNotFound, err, "Layers: finding an unknown layer")
+	assert.Error(t, datastore.InsertLayer(database.Layer{EngineVersion: 1}), "Layers: inserting a layer without a name")
+
+	layer, err := datastore.FindLayer("layer-1", false, false)
+	if assert.Nil(t, err, "Layers") {
+		assert.Equal(t, "layer-1", layer.Name, "Layers")
+		assert.Equal(t, 1, layer.EngineVersion, "Layers")
+		assert.Empty(t, layer.Features, "Layers: features are only filled on request")
+		if assert.NotNil(t, layer.Parent, "Layers") {
+			assert.Equal(t, "layer-0", layer.Parent.Name, "Layers")
+		}
+		if assert.NotNil(t, layer.Namespace, "Layers: namespaces are inherited") {
+			assert.Equal(t, "debian:7", layer.Namespace.Name, "Layers")
+		}
+
+		// Insertions are idempotent.
+		assert.Nil(t, datastore.InsertLayer(layer), "Layers: inserting an existing layer")
+		assert.Equal(t, database.LayerStats{}, layer.Stats, "Layers: no statistics were recorded")
+	}
+
+	// The statistics of the analysis are stored.
+	stats := database.LayerStats{
+		BytesRead:      1 << 20,
+		FilesInspected: 120,
+		FilesMatched:   2,
+		BytesMatched:   4096,
+		Duration:       1500 * time.Millisecond,
+		Detectors:      map[string]time.Duration{"dpkg": 20 * time.Millisecond, "rpm": 0},
+	}
+	if parent, err := datastore.FindLayer("layer-2", false, false); assert.Nil(t, err, "Layers") {
+		assert.Nil(t, datastore.InsertLayer(database.Layer{Name: "layer-3", EngineVersion: 1, Parent: &parent, Stats: stats}), "Layers")
+		layer, err = datastore.FindLayer("layer-3", false, false)
+		if assert.Nil(t, err, "Layers") {
+			assert.Equal(t, stats, layer.Stats, "Layers: statistics are stored")
+		}
+	}
+
+	// Features are inherited and attributed to the layer that added them.
+	layer, err = datastore.FindLayer("layer-2", true, false)
+	if assert.Nil(t, err, "Layers") {
+		assert.Equal(t, map[string]string{
+			"wechat 0.5":  "layer-0",
+			"nginx 1.0":   "layer-1",
+			"openssl 2.0": "layer-2",
+		}, addedBy(layer), "Layers")
+		for _, featureVersion := range layer.Features {
+			assert.Equal(t, "dpkg", featureVersion.DetectedBy, "Layers: detectors are stored and inherited")
+			if featureVersion.Feature.Name == "nginx" {
+				assert.Equal(t, "config-files", featureVersion.State, "Layers: states are stored and inherited")
+			} else {
+				assert.Equal(t, database.InstalledState, featureVersion.State, "Layers: states are stored and inherited")
+			}
+		}
+		assert.Equal(t, map[string][]string{
+			"wechat 0.5":  {},
+			"nginx 1.0":   nil,
+			"openssl 2.0": {"usr/bin/openssl", "usr/lib/libssl.so.2"},
+		}, evidence(layer), "Layers: evidence is stored for every layer")
+	}
+	layer, err = datastore.FindLayer("layer-0", true, false)
+	if assert.Nil(t, err, "Layers") {
+		assert.Equal(t, map[string][]string{
+			"wechat 0.5":  {"usr/bin/wechat"},
+			"openssl 1.0": nil,
+		}, evidence(layer), "Layers: evidence is stored for every layer")
+	}
+
+	// Deletions are recursive.
+	assert.Nil(t, datastore.DeleteLayer("layer-1"), "Layers")
+	assert.Equal(t, cerrors.ErrNotFound, datastore.DeleteLayer("layer-1"), "Layers: deleting a deleted layer")
+	for name, expected := range map[string]error{"layer-0": nil, "layer-1": cerrors.ErrNotFound, "layer-2": cerrors.ErrNotFound} {
+		_, err := datastore.FindLayer(name, false, false)
+		assert.Equal(t, expected, err, "Layers: finding "+name+" after deleting layer-1")
+	}
+}
+
+// LayerLabels verifies the labelling of layers and their listing by label.
+func LayerLabels(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	layer, err := datastore.FindLayer("layer-2", false, false)
+	if assert.Nil(t, err, "LayerLabels") {
+		assert.Equal(t, map[string]string{"team": "web", "env": "prod"}, layer.Labels, "LayerLabels")
+	}
+	assert.Equal(t, cerrors.ErrNotFound, datastore.InsertLayerLabels("unknown", map[string]string{"team": "web"}), "LayerLabels: labelling an unknown layer")
+	assert.Error(t, datastore.InsertLayerLabels("layer-0", map[string]string{"": "web"}), "LayerLabels: a label without a key")
+
+	// Labels are replaced, and removed when their value is empty.
+	assert.Nil(t, datastore.InsertLayerLabels("layer-2", map[string]string{"team": "payments", "env": "", "sha": "abc123"}), "LayerLabels")
+	layer, err = datastore.FindLayer("layer-2", false, false)
+	if assert.Nil(t, err, "LayerLabels") {
+		assert.Equal(t, map[string]string{"team": "payments", "sha": "abc123"}, layer.Labels, "LayerLabels: updating labels")
+	}
+
+	// Layers are listed by label, and paginated.
+	names := func(labels map[string]string, limit int) []string {
+		var names []string
+		for page := 0; page != -1; {
+			var layers []database.Layer
+			layers, page, err = datastore.ListLayers(labels, limit, page)
+			if !assert.Nil(t, err, "LayerLabels") {
+				return names
+			}
+			for _, layer := range layers {
+				names = append(names, layer.Name)
+			}
+		}
+		return names
+	}
+	assert.Equal(t, []string{"layer-0", "layer-1", "layer-2"}, names(nil, 2), "LayerLabels: listing every layer")
+	assert.Equal(t, []string{"layer-1"}, names(map[string]string{"team": "web"}, 2), "LayerLabels: listing by label")
+	assert.Equal(t, []string{"layer-2"}, names(map[string]string{"team": "payments", "sha": "abc123"}, 1), "LayerLabels: listing by labels")
+	assert.Empty(t, names(map[string]string{"team": "payments", "sha": "def456"}, 1), "LayerLabels: listing by labels")
+
+	// Listed layers carry their labels.
+	layers, _, err := datastore.ListLayers(map[string]string{"team": "web"}, 10, 0)
+	if assert.Nil(t, err, "LayerLabels") && assert.Len(t, layers, 1, "LayerLabels") {
+		assert.Equal(t, map[string]string{"team": "web"}, layers[0].Labels, "LayerLabels")
+	}
+}
+
+// Features verifies that features are affected by the vulnerabilities fixed in later versions,
+// as fixes are added and removed.
+func Features(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	assert.Equal(t, map[string][]string{
+		"openssl 1.0": {"CVE-OPENSSL-1-DEB7"},
+		"wechat 0.5":  {"CVE-WECHAT"},
+	}, affectedBy(t, datastore, "layer-0"), "Features")
+	assert.Equal(t, map[string][]string{
+		"wechat 0.5": {"CVE-WECHAT"},
+		"nginx 1.0":  {"CVE-NOPE"},
+	}, affectedBy(t, datastore, "layer-2"), "Features")
+
+	// Fix CVE-WECHAT and make CVE-NOPE affect openssl as well.
+	debian7 := testutil.Namespace("debian:7")
+	assert.Nil(t, datastore.InsertVulnerabilityFixes("debian:7", "CVE-WECHAT", []database.FeatureVersion{
+		testutil.FeatureVersion(debian7, "wechat", "0.5"),
+	}), "Features")
+	assert.Nil(t, datastore.InsertVulnerabilityFixes("debian:7", "CVE-NOPE", []database.FeatureVersion{
+		testutil.FeatureVersion(debian7, "openssl", "3.0"),
+	}), "Features")
+	assert.Equal(t, map[string][]string{
+		"nginx 1.0":   {"CVE-NOPE"},
+		"openssl 2.0": {"CVE-NOPE"},
+	}, affectedBy(t, datastore, "layer-2"), "Features: after inserting fixes")
+
+	// Removing a fix means the feature isn't affected in any version.
+	assert.Nil(t, datastore.DeleteVulnerabilityFix("debian:7", "CVE-NOPE", "nginx"), "Features")
+	assert.Equal(t, map[string][]string{
+		"openssl 2.0": {"CVE-NOPE"},
+	}, affectedBy(t, datastore, "layer-2"), "Features: after deleting a fix")
+}
+
+// Vulnerabilities verifies the insertion, update, listing and deletion of vulnerabilities.
+func Vulnerabilities(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	debian7 := testutil.Namespace("debian:7")
+	assert.Error(t, datastore.InsertVulnerabilities([]database.Vulnerability{{Namespace: debian7}}, false), "Vulnerabilities: inserting a vulnerability without a name")
+	_, err := datastore.FindVulnerability("debian:7", "unknown")
+	assert.Equal(t, cerrors.ErrNotFound, err, "Vulnerabilities: finding an unknown vulnerability")
+
+	vulnerability, err := datastore.FindVulnerability("debian:7", "CVE-OPENSSL-1-DEB7")
+	if assert.Nil(t, err, "Vulnerabilities") {
+		assert.Equal(t, "Description of CVE-OPENSSL-1-DEB7", vulnerability.Description, "Vulnerabilities")
+		assert.Equal(t, types.High, vulnerability.Severity, "Vulnerabilities")
+		if assert.Len(t, vulnerability.FixedIn, 1, "Vulnerabilities") {
+			assert.Equal(t, "openssl", vulnerability.FixedIn[0].Feature.Name, "Vulnerabilities")
+			assert.Equal(t, "2.0", vulnerability.FixedIn[0].Version, "Vulnerabilities")
+		}
+	}
+
+	// Update.
+	updated := testutil.Vulnerability(debian7, "CVE-OPENSSL-1-DEB7", types.Critical)
+	updated.Description = "Updated description"
+	updated.CVSS.V3 = &types.CVSS{Vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", Score: 9.8}
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{updated}, false), "Vulnerabilities")
+	vulnerability, err = datastore.FindVulnerability("debian:7", "CVE-OPENSSL-1-DEB7")
+	if assert.Nil(t, err, "Vulnerabilities") {
+		assert.Equal(t, "Updated description", vulnerability.Description, "Vulnerabilities: after an update")
+		assert.Equal(t, types.Critical, vulnerability.Severity, "Vulnerabilities: after an update")
+		assert.Equal(t, updated.CVSS, vulnerability.CVSS, "Vulnerabilities: after an update")
+		assert.Len(t, vulnerability.FixedIn, 1, "Vulnerabilities: updates keep the fixes that aren't given")
+	}
+
+	// Update the CVSS alone.
+	updated.CVSS.V2 = &types.CVSS{Vector: "AV:N/AC:L/Au:N/C:C/I:C/A:C", Score: 10}
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{updated}, false), "Vulnerabilities")
+	vulnerability, err = datastore.FindVulnerability("debian:7", "CVE-OPENSSL-1-DEB7")
+	if assert.Nil(t, err, "Vulnerabilities") {
+		assert.Equal(t, updated.CVSS, vulnerability.CVSS, "Vulnerabilities: after an update of the CVSS")
+	}
+
+	// List every page.
+	_, _, err = datastore.ListVulnerabilities("unknown", 10, 0)
+	assert.Equal(t, cerrors.ErrNotFound, err, "Vulnerabilities: listing an unknown namespace")
+	var names []string
+	for page, pages := 0, 0; page != -1; pages++ {
+		if !assert.True(t, pages < 3, "Vulnerabilities: too many pages") {
+			break
+		}
+
+		var vulnerabilities []database.Vulnerability
+		vulnerabilities, page, err = datastore.ListVulnerabilities("debian:7", 2, page)
+		if !assert.Nil(t, err, "Vulnerabilities") {
+			break
+		}
+		assert.True(t, len(vulnerabilities) <= 2, "Vulnerabilities: pages are limited")
+		for _, vulnerability := range vulnerabilities {
+			names = append(names, vulnerability.Name)
+		}
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"CVE-NOPE", "CVE-OPENSSL-1-DEB7", "CVE-WECHAT"}, names, "Vulnerabilities")
+
+	// Delete.
+	assert.Nil(t, datastore.DeleteVulnerability("debian:7", "CVE-NOPE"), "Vulnerabilities")
+	assert.Equal(t, cerrors.ErrNotFound, datastore.DeleteVulnerability("debian:7", "CVE-NOPE"), "Vulnerabilities: deleting a deleted vulnerability")
+	_, err = datastore.FindVulnerability("debian:7", "CVE-NOPE")
+	assert.Equal(t, cerrors.ErrNotFound, err, "Vulnerabilities: finding a deleted vulnerability")
+}
+
+// StreamVulnerabilities verifies that every vulnerability of a namespace is streamed with its
+// fixes, and that the stream stops on the first error.
+func StreamVulnerabilities(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	err := datastore.StreamVulnerabilities("unknown", func(database.Vulnerability) error { return nil })
+	assert.Equal(t, cerrors.ErrNotFound, err, "StreamVulnerabilities: streaming an unknown namespace")
+
+	var names []string
+	err = datastore.StreamVulnerabilities("debian:7", func(vulnerability database.Vulnerability) error {
+		names = append(names, vulnerability.Name)
+		if vulnerability.Name == "CVE-OPENSSL-1-DEB7" && assert.Len(t, vulnerability.FixedIn, 1, "StreamVulnerabilities") {
+			assert.Equal(t, "openssl", vulnerability.FixedIn[0].Feature.Name, "StreamVulnerabilities")
+			assert.Equal(t, "2.0", vulnerability.FixedIn[0].Version, "StreamVulnerabilities")
+		}
+		return nil
+	})
+	assert.Nil(t, err, "StreamVulnerabilities")
+	sort.Strings(names)
+	assert.Equal(t, []string{"CVE-NOPE", "CVE-OPENSSL-1-DEB7", "CVE-WECHAT"}, names, "StreamVulnerabilities")
+
+	errStop := errors.New("stop")
+	streamed := 0
+	err = datastore.StreamVulnerabilities("debian:7", func(database.Vulnerability) error {
+		streamed++
+		return errStop
+	})
+	assert.Equal(t, errStop, err, "StreamVulnerabilities: stopping the stream")
+	assert.Equal(t, 1, streamed, "StreamVulnerabilities: stopping the stream")
+}
+
+// FalsePositives verifies the flagging of findings as false positives, their lookup, export and
+// deletion.
+func FalsePositives(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	debian7 := testutil.Namespace("debian:7")
+	_, err := datastore.InsertFalsePositive(database.FalsePositive{Namespace: debian7, VulnerabilityName: "CVE-NOPE"})
+	assert.Error(t, err, "FalsePositives: inserting a false positive without a feature")
+
+	flag := database.FalsePositive{
+		Namespace:         debian7,
+		VulnerabilityName: "CVE-OPENSSL-1-DEB7",
+		FeatureName:       "openssl",
+		FeatureVersion:    "1.0",
+		Reason:            "backported",
+	}
+	inserted, err := datastore.InsertFalsePositive(flag)
+	if !assert.Nil(t, err, "FalsePositives") {
+		return
+	}
+	assert.NotEmpty(t, inserted.Name, "FalsePositives")
+	assert.False(t, inserted.Created.IsZero(), "FalsePositives")
+
+	// Flagging the same finding again updates the reason.
+	flag.Reason = "patched"
+	updated, err := datastore.InsertFalsePositive(flag)
+	if assert.Nil(t, err, "FalsePositives") {
+		assert.Equal(t, inserted.Name, updated.Name, "FalsePositives: flagging a finding twice")
+		assert.Equal(t, "patched", updated.Reason, "FalsePositives")
+	}
+
+	flag.VulnerabilityName, flag.FeatureName = "CVE-WECHAT", "wechat"
+	_, err = datastore.InsertFalsePositive(flag)
+	assert.Nil(t, err, "FalsePositives")
+
+	found, err := datastore.FindFalsePositives([]database.Vulnerability{
+		{Name: "CVE-OPENSSL-1-DEB7", Namespace: debian7},
+		{Name: "CVE-WECHAT", Namespace: testutil.Namespace("debian:8")},
+	})
+	if assert.Nil(t, err, "FalsePositives") && assert.Len(t, found, 1, "FalsePositives: finding by vulnerability") {
+		assert.Equal(t, inserted.Name, found[0].Name, "FalsePositives")
+		assert.Equal(t, "debian:7", found[0].Namespace.Name, "FalsePositives")
+		assert.Equal(t, "openssl", found[0].FeatureName, "FalsePositives")
+		assert.Equal(t, "1.0", found[0].FeatureVersion, "FalsePositives")
+		assert.Equal(t, "patched", found[0].Reason, "FalsePositives")
+	}
+
+	// List every page.
+	var names []string
+	for page, pages := 0, 0; page != -1; pages++ {
+		if !assert.True(t, pages < 3, "FalsePositives: too many pages") {
+			break
+		}
+
+		var falsePositives []database.FalsePositive
+		falsePositives, page, err = datastore.ListFalsePositives(1, page)
+		if !assert.Nil(t, err, "FalsePositives") {
+			break
+		}
+		assert.True(t, len(falsePositives) <= 1, "FalsePositives: pages are limited")
+		for _, falsePositive := range falsePositives {
+			names = append(names, falsePositive.VulnerabilityName)
+		}
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"CVE-OPENSSL-1-DEB7", "CVE-WECHAT"}, names, "FalsePositives")
+
+	// Delete.
+	assert.Nil(t, datastore.DeleteFalsePositive(inserted.Name), "FalsePositives")
+	assert.Equal(t, cerrors.ErrNotFound, datastore.DeleteFalsePositive(inserted.Name), "FalsePositives: deleting a deleted false positive")
+	found, err = datastore.FindFalsePositives([]database.Vulnerability{{Name: "CVE-OPENSSL-1-DEB7", Namespace: debian7}})
+	if assert.Nil(t, err, "FalsePositives") {
+		assert.Empty(t, found, "FalsePositives: finding a deleted false positive")
+	}
+}
+
+// WatchedTags verifies the insertion, update, listing and deletion of watched tags.
+func WatchedTags(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	_, err := datastore.InsertWatchedTag(database.WatchedTag{Registry: "https://registry.example.com", Repository: "debian"})
+	assert.Error(t, err, "WatchedTags: inserting a watched tag without a tag")
+
+	jessie := database.WatchedTag{Registry: "https://registry.example.com", Repository: "debian", Tag: "jessie"}
+	inserted, err := datastore.InsertWatchedTag(jessie)
+	if !assert.Nil(t, err, "WatchedTags") {
+		return
+	}
+	assert.NotEmpty(t, inserted.Name, "WatchedTags")
+	assert.False(t, inserted.Created.IsZero(), "WatchedTags")
+	assert.True(t, inserted.Resolved.IsZero(), "WatchedTags: a new tag hasn't been resolved")
+
+	again, err := datastore.InsertWatchedTag(jessie)
+	if assert.Nil(t, err, "WatchedTags") {
+		assert.Equal(t, inserted.Name, again.Name, "WatchedTags: watching a tag twice")
+	}
+
+	// Update.
+	resolved := time.Now().Add(-time.Minute)
+	inserted.Digest, inserted.LayerName = "sha256:jessie", "layer-2"
+	inserted.Signature = database.SignatureVerified
+	inserted.Attested, inserted.Published = "report", "report"
+	inserted.Resolved, inserted.Changed = resolved, resolved
+	assert.Nil(t, datastore.UpdateWatchedTag(inserted), "WatchedTags")
+	assert.Equal(t, cerrors.ErrNotFound, datastore.UpdateWatchedTag(database.WatchedTag{Name: "unknown"}), "WatchedTags: updating an unknown tag")
+
+	found, err := datastore.FindWatchedTag(inserted.Name)
+	if assert.Nil(t, err, "WatchedTags") {
+		assert.Equal(t, "debian", found.Repository, "WatchedTags")
+		assert.Equal(t, "jessie", found.Tag, "WatchedTags")
+		assert.Equal(t, "sha256:jessie", found.Digest, "WatchedTags")
+		assert.Equal(t, "layer-2", found.LayerName, "WatchedTags")
+		assert.Equal(t, resolved.Unix(), found.Resolved.Unix(), "WatchedTags")
+		assert.Equal(t, resolved.Unix(), found.Changed.Unix(), "WatchedTags")
+		assert.Equal(t, "sha256:jessie", found.ReportedDigest, "WatchedTags: the first digest isn't a move")
+		assert.Equal(t, database.SignatureVerified, found.Signature, "WatchedTags")
+		assert.Equal(t, "report", found.Attested, "WatchedTags")
+		assert.Equal(t, "report", found.Published, "WatchedTags")
+	}
+
+	// Moves.
+	moved, _, err := datastore.ListMovedWatchedTags(10, 0)
+	if assert.Nil(t, err, "WatchedTags") {
+		assert.Len(t, moved, 0, "WatchedTags: no tag moved yet")
+	}
+
+	inserted.Digest, inserted.LayerName = "sha256:jessie-2", "layer-3"
+	assert.Nil(t, datastore.UpdateWatchedTag(inserted), "WatchedTags")
+	moved, _, err = datastore.ListMovedWatchedTags(10, 0)
+	if assert.Nil(t, err, "WatchedTags") && assert.Len(t, moved, 1, "WatchedTags: the tag moved") {
+		assert.Equal(t, "sha256:jessie", moved[0].ReportedDigest, "WatchedTags")
+		assert.Equal(t, "sha256:jessie-2", moved[0].Digest, "WatchedTags")
+	}
+
+	assert.Nil(t, datastore.MarkWatchedTagReported(inserted.Name, "sha256:jessie-2"), "WatchedTags")
+	assert.Equal(t, cerrors.ErrNotFound, datastore.MarkWatchedTagReported("unknown", "sha256:jessie"), "WatchedTags: reporting an unknown tag")
+	moved, _, err = datastore.ListMovedWatchedTags(10, 0)
+	if assert.Nil(t, err, "WatchedTags") {
+		assert.Len(t, moved, 0, "WatchedTags: the move has been reported")
+	}
+
+	// List every page.
+	wheezy := jessie
+	wheezy.Tag = "wheezy"
+	_, err = datastore.InsertWatchedTag(wheezy)
+	assert.Nil(t, err, "WatchedTags")
+
+	var tags []string
+	for page, pages := 0, 0; page != -1; pages++ {
+		if !assert.True(t, pages < 3, "WatchedTags: too many pages") {
+			break
+		}
+
+		var watchedTags []database.WatchedTag
+		watchedTags, page, err = datastore.ListWatchedTags(1, page)
+		if !assert.Nil(t, err, "WatchedTags") {
+			break
+		}
+		assert.True(t, len(watchedTags) <= 1, "WatchedTags: pages are limited")
+		for _, watchedTag := range watchedTags {
+			tags = append(tags, watchedTag.Tag)
+		}
+	}
+	sort.Strings(tags)
+	assert.Equal(t, []string{"jessie", "wheezy"}, tags, "WatchedTags")
+
+	// Delete.
+	assert.Nil(t, datastore.DeleteWatchedTag(inserted.Name), "WatchedTags")
+	assert.Equal(t, cerrors.ErrNotFound, datastore.DeleteWatchedTag(inserted.Name), "WatchedTags: deleting a deleted tag")
+	_, err = datastore.FindWatchedTag(inserted.Name)
+	assert.Equal(t, cerrors.ErrNotFound, err, "WatchedTags: finding a deleted tag")
+}
+
+// Provenances verifies that the provenances of images are stored once per statement.
+func Provenances(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	_, err := datastore.InsertProvenance(database.Provenance{Digest: "sha256:image"})
+	assert.Error(t, err, "Provenances: inserting a provenance without a statement")
+
+	provenance := database.Provenance{
+		Digest:        "sha256:image",
+		PredicateType: "https://slsa.dev/provenance/v1",
+		BuilderID:     "https://builder.example.com",
+		Statement:     `{"predicateType": "https://slsa.dev/provenance/v1"}`,
+	}
+	inserted, err := datastore.InsertProvenance(provenance)
+	if !assert.Nil(t, err, "Provenances") {
+		return
+	}
+	assert.NotEmpty(t, inserted.Name, "Provenances")
+	assert.False(t, inserted.Created.IsZero(), "Provenances")
+
+	again, err := datastore.InsertProvenance(provenance)
+	if assert.Nil(t, err, "Provenances") {
+		assert.Equal(t, inserted.Name, again.Name, "Provenances: inserting a statement twice")
+	}
+
+	other := provenance
+	other.Statement = `{"predicateType": "https://slsa.dev/provenance/v1", "predicate": {}}`
+	_, err = datastore.InsertProvenance(other)
+	assert.Nil(t, err, "Provenances")
+
+	provenances, err := datastore.FindProvenances("sha256:image")
+	if assert.Nil(t, err, "Provenances") && assert.Len(t, provenances, 2, "Provenances") {
+		assert.Equal(t, inserted.Name, provenances[0].Name, "Provenances")
+		assert.Equal(t, "https://slsa.dev/provenance/v1", provenances[0].PredicateType, "Provenances")
+		assert.Equal(t, "https://builder.example.com", provenances[0].BuilderID, "Provenances")
+		assert.Equal(t, provenance.Statement, provenances[0].Statement, "Provenances")
+	}
+
+	provenances, err = datastore.FindProvenances("sha256:other")
+	assert.Nil(t, err, "Provenances")
+	assert.Len(t, provenances, 0, "Provenances: an image without provenance")
+}
+
+// Images verifies that the top layers of images are stored once per digest.
+func Images(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	assert.Error(t, datastore.InsertImage(database.Image{Digest: "sha256:image"}), "Images: inserting an image without a layer")
+	assert.Error(t, datastore.InsertImage(database.Image{Digest: "sha256:image", LayerName: "layer-unknown"}), "Images: inserting an image of an unknown layer")
+
+	if !assert.Nil(t, datastore.InsertImage(database.Image{Digest: "sha256:image", LayerName: "layer-2"}), "Images") {
+		return
+	}
+	assert.Nil(t, datastore.InsertImage(database.Image{Digest: "sha256:image", LayerName: "layer-1"}), "Images: inserting an image twice")
+
+	image, err := datastore.FindImage("sha256:image")
+	if assert.Nil(t, err, "Images") {
+		assert.Equal(t, "sha256:image", image.Digest, "Images")
+		assert.Equal(t, "layer-2", image.LayerName, "Images: inserting an image again has no effect")
+		assert.False(t, image.Created.IsZero(), "Images")
+	}
+
+	_, err = datastore.FindImage("sha256:other")
+	assert.Equal(t, cerrors.ErrNotFound, err, "Images: an unknown image")
+}
+
+// LayerAnalyses verifies that the analyses of the blobs of layers are stored once per digest.
+func LayerAnalyses(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	assert.Error(t, datastore.InsertLayerAnalysis(database.LayerAnalysis{Digest: "sha256:blob"}), "LayerAnalyses: inserting an analysis without a version")
+
+	_, err := datastore.FindLayerAnalysis("sha256:blob")
+	assert.Equal(t, cerrors.ErrNotFound, err, "LayerAnalyses: an unknown analysis")
+
+	result := database.LayerAnalysisResult{
+		Namespace: &database.Namespace{Name: "debian:8", VersionFormat: "dpkg"},
+		Features: []database.FeatureVersion{
+			{Feature: database.Feature{Name: "openssl"}, Version: "1.0", DetectedBy: "dpkg"},
+		},
+		Stats: database.LayerStats{BytesRead: 4096, FilesInspected: 12, Duration: time.Second},
+	}
+	if !assert.Nil(t, datastore.InsertLayerAnalysis(database.LayerAnalysis{Digest: "sha256:blob", Version: "1", Result: result}), "LayerAnalyses") {
+		return
+	}
+
+	analysis, err := datastore.FindLayerAnalysis("sha256:blob")
+	if assert.Nil(t, err, "LayerAnalyses") {
+		assert.Equal(t, "1", analysis.Version, "LayerAnalyses")
+		assert.Equal(t, result, analysis.Result, "LayerAnalyses")
+		assert.False(t, analysis.Created.IsZero(), "LayerAnalyses")
+	}
+
+	// Analyzing the blob again replaces its analysis.
+	result.Features = nil
+	if assert.Nil(t, datastore.InsertLayerAnalysis(database.LayerAnalysis{Digest: "sha256:blob", Version: "2", Result: result}), "LayerAnalyses") {
+		analysis, err = datastore.FindLayerAnalysis("sha256:blob")
+		if assert.Nil(t, err, "LayerAnalyses") {
+			assert.Equal(t, "2", analysis.Version, "LayerAnalyses: analyzing a blob again")
+			assert.Empty(t, analysis.Result.Features, "LayerAnalyses: analyzing a blob again")
+		}
+	}
+}
+
+// PruneNamespaces verifies that the vulnerabilities of the namespaces that no layer uses can be
+// removed, and only theirs.
+func PruneNamespaces(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	debian8 := testutil.Namespace("debian:8")
+	if !assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{
+		testutil.Vulnerability(debian8, "CVE-OPENSSL-1-DEB8", types.High, testutil.FeatureVersion(debian8, "openssl", "1.1")),
+	}, false), "PruneNamespaces") {
+		return
+	}
+	assert.Equal(t, []string{"debian:8"}, unusedNamespaceNames(t, datastore), "PruneNamespaces")
+
+	// A namespace is used by the layers detected in it and by the ones having its features.
+	layer := testutil.Layer("layer-8", nil, nil, testutil.FeatureVersion(debian8, "curl", "7.0"))
+	if assert.Nil(t, datastore.InsertLayer(layer), "PruneNamespaces") {
+		assert.Empty(t, unusedNamespaceNames(t, datastore), "PruneNamespaces: a layer has features of the namespace")
+		_, err := datastore.PruneNamespace("debian:8")
+		assert.Equal(t, database.ErrNamespaceInUse, err, "PruneNamespaces: pruning a used namespace")
+		assert.Nil(t, datastore.DeleteLayer("layer-8"), "PruneNamespaces")
+	}
+	_, err := datastore.PruneNamespace("debian:7")
+	assert.Equal(t, database.ErrNamespaceInUse, err, "PruneNamespaces: pruning a used namespace")
+	_, err = datastore.PruneNamespace("unknown")
+	assert.Equal(t, cerrors.ErrNotFound, err, "PruneNamespaces: pruning an unknown namespace")
+
+	pruned, err := datastore.PruneNamespace("debian:8")
+	if assert.Nil(t, err, "PruneNamespaces") {
+		assert.Equal(t, 1, pruned.Vulnerabilities, "PruneNamespaces")
+	}
+	_, err = datastore.FindVulnerability("debian:8", "CVE-OPENSSL-1-DEB8")
+	assert.Equal(t, cerrors.ErrNotFound, err, "PruneNamespaces: finding a pruned vulnerability")
+	_, err = datastore.FindVulnerability("debian:7", "CVE-OPENSSL-1-DEB7")
+	assert.Nil(t, err, "PruneNamespaces: the vulnerabilities of the used namespaces are kept")
+
+	// The namespace can be used again.
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{
+		testutil.Vulnerability(debian8, "CVE-OPENSSL-1-DEB8", types.High, testutil.FeatureVersion(debian8, "openssl", "1.1")),
+	}, false), "PruneNamespaces: inserting a vulnerability in a pruned namespace")
+	assert.Nil(t, datastore.InsertLayer(layer), "PruneNamespaces: inserting a layer in a pruned namespace")
+}
+
+// ArchiveVulnerabilities verifies that the vulnerabilities of a namespace can be moved out of the
+// analysis into the archive, along with their FixedIn lists, and that their notifications are
+// removed.
+func ArchiveVulnerabilities(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	debian7 := testutil.Namespace("debian:7")
+	assert.Nil(t, datastore.InsertVulnerabilityFixes("debian:7", "CVE-WECHAT", []database.FeatureVersion{
+		testutil.FeatureVersion(debian7, "wechat", "0.6"),
+	}), "ArchiveVulnerabilities")
+
+	_, err := datastore.ArchiveVulnerabilities("")
+	assert.IsType(t, &cerrors.ErrBadRequest{}, err, "ArchiveVulnerabilities: archiving an empty namespace")
+	_, err = datastore.ArchiveVulnerabilities("unknown")
+	assert.Equal(t, cerrors.ErrNotFound, err, "ArchiveVulnerabilities: archiving an unknown namespace")
+
+	// Drivers that keep the previous revisions of the vulnerabilities count them as well.
+	archived, err := datastore.ArchiveVulnerabilities("debian:7")
+	if assert.Nil(t, err, "ArchiveVulnerabilities") {
+		assert.True(t, archived >= 3, "ArchiveVulnerabilities: %d revisions archived", archived)
+	}
+	_, err = datastore.GetAvailableNotification(time.Hour, "test", time.Minute)
+	assert.Equal(t, cerrors.ErrNotFound, err, "ArchiveVulnerabilities: the notifications are removed")
+
+	_, err = datastore.FindVulnerability("debian:7", "CVE-WECHAT")
+	assert.Equal(t, cerrors.ErrNotFound, err, "ArchiveVulnerabilities: finding an archived vulnerability")
+	layer, err := datastore.FindLayer("layer-2", true, true)
+	if assert.Nil(t, err, "ArchiveVulnerabilities") {
+		for _, featureVersion := range layer.Features {
+			assert.Empty(t, featureVersion.AffectedBy, "ArchiveVulnerabilities: archived vulnerabilities don't affect layers")
+		}
+	}
+
+	vulnerability, err := datastore.FindArchivedVulnerability("debian:7", "CVE-WECHAT")
+	if assert.Nil(t, err, "ArchiveVulnerabilities") && assert.Len(t, vulnerability.FixedIn, 1, "ArchiveVulnerabilities") {
+		assert.Equal(t, "wechat", vulnerability.FixedIn[0].Feature.Name, "ArchiveVulnerabilities")
+		assert.Equal(t, "0.6", vulnerability.FixedIn[0].Version, "ArchiveVulnerabilities")
+	}
+	_, err = datastore.FindArchivedVulnerability("debian:7", "unknown")
+	assert.Equal(t, cerrors.ErrNotFound, err, "ArchiveVulnerabilities: finding an unknown archived vulnerability")
+
+	vulnerabilities, nextPage, err := datastore.ListArchivedVulnerabilities("debian:7", 10, 0)
+	if assert.Nil(t, err, "ArchiveVulnerabilities") {
+		assert.Len(t, vulnerabilities, 3, "ArchiveVulnerabilities")
+		assert.Equal(t, -1, nextPage, "ArchiveVulnerabilities")
+	}
+	vulnerabilities, nextPage, err = datastore.ListArchivedVulnerabilities("debian:7", 2, 0)
+	if assert.Nil(t, err, "ArchiveVulnerabilities") {
+		assert.Len(t, vulnerabilities, 2, "ArchiveVulnerabilities")
+		assert.NotEqual(t, -1, nextPage, "ArchiveVulnerabilities")
+	}
+
+	// The namespace can be updated again.
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{
+		testutil.Vulnerability(debian7, "CVE-WECHAT", types.High, testutil.FeatureVersion(debian7, "wechat", "0.7")),
+	}, false), "ArchiveVulnerabilities: inserting a vulnerability in an archived namespace")
+}
+
+// unusedNamespaceNames returns the names of the unused namespaces.
+func unusedNamespaceNames(t *testing.T, datastore database.Datastore) []string {
+	namespaces, err := datastore.ListUnusedNamespaces()
+	assert.Nil(t, err, "PruneNamespaces")
+
+	var names []string
+	for _, namespace := range namespaces {
+		names = append(names, namespace.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Notifications verifies that changes of vulnerabilities create notifications, and their
+// lifecycle.
+func Notifications(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	// The fixture is loaded without notifications.
+	_, err := datastore.GetAvailableNotification(time.Hour, "notifier", time.Minute)
+	assert.Equal(t, cerrors.ErrNotFound, err, "Notifications: before any change")
+
+	debian7 := testutil.Namespace("debian:7")
+	vulnerability := testutil.Vulnerability(debian7, "CVE-NGINX", types.High, testutil.FeatureVersion(debian7, "nginx", "1.1"))
+	if !assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true), "Notifications") {
+		return
+	}
+
+	notification, err := datastore.GetAvailableNotification(time.Hour, "notifier", time.Minute)
+	if !assert.Nil(t, err, "Notifications") {
+		return
+	}
+	notification, nextPage, err := datastore.GetNotification(notification.Name, 10, database.VulnerabilityNotificationFirstPage)
+	if assert.Nil(t, err, "Notifications") {
+		assert.Equal(t, database.NoVulnerabilityNotificationPage, nextPage, "Notifications")
+		assert.Nil(t, notification.OldVulnerability, "Notifications: a new vulnerability has no old revision")
+		if assert.NotNil(t, notification.NewVulnerability, "Notifications") {
+			assert.Equal(t, "CVE-NGINX", notification.NewVulnerability.Name, "Notifications")
+
+			var layers []string
+			for _, layer := range notification.NewVulnerability.LayersIntroducingVulnerability {
+				layers = append(layers, layer.Name)
+			}
+			assert.Equal(t, []string{"layer-1"}, layers, "Notifications: layers introducing the vulnerability")
+			if len(layers) == 1 {
+				assert.Equal(t, map[string]string{"team": "web"}, notification.NewVulnerability.LayersIntroducingVulnerability[0].Labels, "Notifications: labels of the layers")
+			}
+		}
+	}
+
+	// The labels of the layers based on the ones introducing the vulnerability are routed too.
+	labels, err := datastore.ListNotificationLabels(notification.Name)
+	if assert.Nil(t, err, "Notifications") {
+		assert.Equal(t, []map[string]string{{"team": "web"}, {"team": "web", "env": "prod"}}, labels, "Notifications: labels of the affected layers")
+	}
+
+	// So are the watched tags whose image is based on them.
+	watchedTag, err := datastore.InsertWatchedTag(database.WatchedTag{Registry: "https://registry.example.com", Repository: "web", Tag: "latest"})
+	if assert.Nil(t, err, "Notifications") {
+		watchedTag.Digest, watchedTag.LayerName = "sha256:web", "layer-2"
+		assert.Nil(t, datastore.UpdateWatchedTag(watchedTag), "Notifications")
+		watchedTags, err := datastore.ListNotificationWatchedTags(notification.Name)
+		if assert.Nil(t, err, "Notifications") && assert.Len(t, watchedTags, 1, "Notifications: affected watched tags") {
+			assert.Equal(t, watchedTag.Name, watchedTags[0].Name, "Notifications: affected watched tags")
+		}
+	}
+
+	// So are failed notifications.
+	assert.Nil(t, datastore.SetNotificationFailed(notification.Name), "Notifications")
+	datastore.ReleaseNotificationLock(notification.Name, "notifier")
+	_, err = datastore.GetAvailableNotification(time.Hour, "notifier", time.Minute)
+	assert.Equal(t, cerrors.ErrNotFound, err, "Notifications: after failing")
+	time.Sleep(10 * time.Millisecond)
+	available, err := datastore.GetAvailableNotification(time.Millisecond, "notifier", time.Minute)
+	if assert.Nil(t, err, "Notifications: after the renotify interval") {
+		assert.Equal(t, notification.Name, available.Name, "Notifications")
+		assert.False(t, available.Failed.IsZero(), "Notifications: failed")
+	}
+
+	// Notified notifications are only available again after the renotify interval.
+	assert.Nil(t, datastore.SetNotificationNotified(notification.Name), "Notifications")
+	datastore.ReleaseNotificationLock(notification.Name, "notifier")
+	_, err = datastore.GetAvailableNotification(time.Hour, "notifier", time.Minute)
+	assert.Equal(t, cerrors.ErrNotFound, err, "Notifications: after being notified")
+	time.Sleep(10 * time.Millisecond)
+	available, err = datastore.GetAvailableNotification(time.Millisecond, "notifier", time.Minute)
+	if assert.Nil(t, err, "Notifications: after the renotify interval") {
+		assert.Equal(t, notification.Name, available.Name, "Notifications")
+		assert.True(t, available.Failed.IsZero(), "Notifications: notified after failing")
+	}
+
+	// Deleted notifications are never available again.
+	assert.Nil(t, datastore.DeleteNotification(notification.Name), "Notifications")
+	datastore.ReleaseNotificationLock(notification.Name, "notifier")
+	_, err = datastore.GetAvailableNotification(time.Millisecond, "notifier", time.Minute)
+	assert.Equal(t, cerrors.ErrNotFound, err, "Notifications: after being deleted")
+
+	// Deleting a vulnerability creates a notification holding its last revision.
+	assert.Nil(t, datastore.DeleteVulnerability("debian:7", "CVE-NGINX"), "Notifications")
+	notification, err = datastore.GetAvailableNotification(time.Hour, "notifier", time.Minute)
+	if assert.Nil(t, err, "Notifications: after deleting a vulnerability") {
+		notification, _, err = datastore.GetNotification(notification.Name, 10, database.VulnerabilityNotificationFirstPage)
+		if assert.Nil(t, err, "Notifications") {
+			assert.Nil(t, notification.NewVulnerability, "Notifications: a deleted vulnerability has no new revision")
+			if assert.NotNil(t, notification.OldVulnerability, "Notifications") {
+				assert.Equal(t, "CVE-NGINX", notification.OldVulnerability.Name, "Notifications")
+			}
+		}
+	}
+}
+
+// NotificationLocks verifies that a notification is claimed by a single owner at a time, until its
+// lock is released or expires.
+func NotificationLocks(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	_, err := datastore.GetAvailableNotification(time.Hour, "", time.Minute)
+	assert.IsType(t, &cerrors.ErrBadRequest{}, err, "NotificationLocks: without an owner")
+
+	debian7 := testutil.Namespace("debian:7")
+	vulnerability := testutil.Vulnerability(debian7, "CVE-NGINX", types.High, testutil.FeatureVersion(debian7, "nginx", "1.1"))
+	if !assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true), "NotificationLocks") {
+		return
+	}
+
+	notification, err := datastore.GetAvailableNotification(time.Hour, "notifier-a", time.Minute)
+	if !assert.Nil(t, err, "NotificationLocks") {
+		return
+	}
+
+	// The claimed notification isn't available to the other owners.
+	_, err = datastore.GetAvailableNotification(time.Hour, "notifier-b", time.Minute)
+	assert.Equal(t, cerrors.ErrNotFound, err, "NotificationLocks: while claimed")
+
+	// Only the owner extends its lock.
+	extended, until := datastore.ExtendNotificationLock(notification.Name, "notifier-a", time.Hour)
+	assert.True(t, extended, "NotificationLocks: by the owner")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), until, time.Minute, "NotificationLocks")
+	extended, _ = datastore.ExtendNotificationLock(notification.Name, "notifier-b", time.Hour)
+	assert.False(t, extended, "NotificationLocks: by another owner")
+
+	// Nor does another owner release it.
+	datastore.ReleaseNotificationLock(notification.Name, "notifier-b")
+	_, err = datastore.GetAvailableNotification(time.Hour, "notifier-b", time.Minute)
+	assert.Equal(t, cerrors.ErrNotFound, err, "NotificationLocks: released by another owner")
+
+	// A released notification is available again.
+	datastore.ReleaseNotificationLock(notification.Name, "notifier-a")
+	available, err := datastore.GetAvailableNotification(time.Hour, "notifier-b", 10*time.Millisecond)
+	if assert.Nil(t, err, "NotificationLocks: after being released") {
+		assert.Equal(t, notification.Name, available.Name, "NotificationLocks")
+	}
+	extended, _ = datastore.ExtendNotificationLock(notification.Name, "notifier-a", time.Hour)
+	assert.False(t, extended, "NotificationLocks: after being released")
+
+	// So is a notification whose lock expired.
+	time.Sleep(20 * time.Millisecond)
+	available, err = datastore.GetAvailableNotification(time.Hour, "notifier-a", time.Minute)
+	if assert.Nil(t, err, "NotificationLocks: after the lock expired") {
+		assert.Equal(t, notification.Name, available.Name, "NotificationLocks")
+	}
+}
+
+// NotificationReasons verifies that notifications are classified by the kind of change of their
+// vulnerability.
+func NotificationReasons(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	debian7 := testutil.Namespace("debian:7")
+	vulnerability := testutil.Vulnerability(debian7, "CVE-NGINX", types.High, testutil.FeatureVersion(debian7, "nginx", "1.1"))
+
+	// next returns the reason of the next notification, and marks it as notified so that the
+	// following change of the vulnerability is available.
+	next := func(step string) database.NotificationReason {
+		notification, err := datastore.GetAvailableNotification(time.Hour, "notifier", time.Minute)
+		if !assert.Nil(t, err, "NotificationReasons: "+step) {
+			return ""
+		}
+		assert.Nil(t, datastore.SetNotificationNotified(notification.Name), "NotificationReasons")
+		datastore.ReleaseNotificationLock(notification.Name, "notifier")
+
+		notification, _, err = datastore.GetNotification(notification.Name, 10, database.VulnerabilityNotificationFirstPage)
+		assert.Nil(t, err, "NotificationReasons: "+step)
+		return notification.Reason
+	}
+
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true), "NotificationReasons")
+	assert.Equal(t, database.NotificationReasonNewVulnerability, next("insert"), "NotificationReasons: insert")
+
+	vulnerability.Severity = types.Critical
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true), "NotificationReasons")
+	assert.Equal(t, database.NotificationReasonSeverityChanged, next("severity"), "NotificationReasons: severity")
+
+	vulnerability.FixedIn = []database.FeatureVersion{testutil.FeatureVersion(debian7, "nginx", "1.2")}
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true), "NotificationReasons")
+	assert.Equal(t, database.NotificationReasonFixAdded, next("new fix"), "NotificationReasons: new fix")
+
+	vulnerability.FixedIn = []database.FeatureVersion{testutil.FeatureVersion(debian7, "nginx", versionfmt.MinVersion)}
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true), "NotificationReasons")
+	assert.Equal(t, database.NotificationReasonFixRemoved, next("removed fix"), "NotificationReasons: removed fix")
+
+	vulnerability.Description = "nginx is vulnerable"
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true), "NotificationReasons")
+	assert.Equal(t, database.NotificationReasonUpdated, next("description"), "NotificationReasons: description")
+
+	assert.Nil(t, datastore.DeleteVulnerability("debian:7", "CVE-NGINX"), "NotificationReasons")
+	assert.Equal(t, database.NotificationReasonDeleted, next("delete"), "NotificationReasons: delete")
+}
+
+// addedBy maps the features of the layer, as "name version", to the layer that added them.
+func addedBy(layer database.Layer) map[string]string {
+	m := make(map[string]string)
+	for _, featureVersion := range layer.Features {
+		m[featureVersion.Feature.Name+" "+featureVersion.Version] = featureVersion.AddedBy.Name
+	}
+	return m
+}
+
+// evidence maps the features of the specified layer, as "name version", to their evidence.
+func evidence(layer database.Layer) map[string][]string {
+	m := make(map[string][]string)
+	for _, featureVersion := range layer.Features {
+		m[featureVersion.Feature.Name+" "+featureVersion.Version] = featureVersion.Evidence
+	}
+	return m
+}
+
+// affectedBy maps the affected features of the specified layer, as "name version", to the
+// sorted names of the vulnerabilities affecting them.
+func affectedBy(t *testing.T, datastore database.Datastore, layerName string) map[string][]string {
+	layer, err := datastore.FindLayer(layerName, true, true)
+	if !assert.Nil(t, err, "finding "+layerName) {
+		return nil
+	}
+
+	m := make(map[string][]string)
+	for _, featureVersion := range layer.Features {
+		key := featureVersion.Feature.Name + " " + featureVersion.Version
+		for _, vulnerability := range featureVersion.AffectedBy {
+			m[key] = append(m[key], vulnerability.Name)
+		}
+		sort.Strings(m[key])
+	}
+	return m
+}
+
+// NotificationOrder verifies that the changes of a vulnerability are handed out in creation order,
+// regardless of their priority, and that a failed change stops holding back the following ones.
+func NotificationOrder(t *testing.T, h testutil.Harness) {
+	datastore := h.Datastore(t)
+	defer datastore.Close()
+
+	// Insert a low vulnerability and raise it to critical afterwards.
+	debian7 := testutil.Namespace("debian:7")
+	vulnerability := testutil.Vulnerability(debian7, "CVE-NGINX", types.Low, testutil.FeatureVersion(debian7, "nginx", "1.1"))
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true), "NotificationOrder")
+	vulnerability.Severity = types.Critical
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true), "NotificationOrder")
+
+	older, err := datastore.GetAvailableNotification(time.Hour, "notifier", time.Minute)
+	if !assert.Nil(t, err, "NotificationOrder") || !assert.Equal(t, types.Low, older.Priority, "NotificationOrder: the older change comes first") {
+		return
+	}
+
+	// The critical change is held back while the low one is pending, locked or not.
+	_, err = datastore.GetAvailableNotification(time.Hour, "notifier", time.Minute)
+	assert.Equal(t, cerrors.ErrNotFound, err, "NotificationOrder: while the older change is locked")
+	datastore.ReleaseNotificationLock(older.Name, "notifier")
+	older, err = datastore.GetAvailableNotification(time.Hour, "notifier", time.Minute)
+	if !assert.Nil(t, err, "NotificationOrder") || !assert.Equal(t, types.Low, older.Priority, "NotificationOrder: after the older change is released") {
+		return
+	}
+
+	// Once the low change failed, the critical one isn't held back anymore, while the failed one
+	// waits for the renotify interval.
+	assert.Nil(t, datastore.SetNotificationFailed(older.Name), "NotificationOrder")
+	datastore.ReleaseNotificationLock(older.Name, "notifier")
+	newer, err := datastore.GetAvailableNotification(time.Hour, "notifier", time.Minute)
+	if assert.Nil(t, err, "NotificationOrder: after the older change failed") {
+		assert.Equal(t, types.Critical, newer.Priority, "NotificationOrder")
+		assert.NotEqual(t, older.Name, newer.Name, "NotificationOrder")
+	}
+}
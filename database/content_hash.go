@@ -0,0 +1,57 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ContentHash returns a canonical hash of the content of the given Vulnerability: its Severity,
+// Link, Description and FixedIn set.
+//
+// The hash doesn't depend on the order of the FixedIn FeatureVersions, nor on the attributes that
+// only describe how the Vulnerability got stored (e.g. its ID, Metadata, Sources or CVSS), so that two
+// revisions of a Vulnerability that carry the same information have the same hash.
+func ContentHash(vulnerability Vulnerability) string {
+	fixedIn := make([]string, 0, len(vulnerability.FixedIn))
+	for _, fv := range vulnerability.FixedIn {
+		fixedIn = append(fixedIn, fmt.Sprintf("%q %q", fv.Feature.Name, fv.Version))
+	}
+	sort.Strings(fixedIn)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n%q\n%q\n", vulnerability.Severity, vulnerability.Link, vulnerability.Description)
+	for _, fv := range fixedIn {
+		fmt.Fprintln(h, fv)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Revision returns a hash of every attribute of the given Vulnerability that can be modified: its
+// content, as hashed by ContentHash, along with its Metadata, Sources and CVSS. It changes whenever the
+// Vulnerability is modified, which lets clients detect concurrent modifications.
+func Revision(vulnerability Vulnerability) string {
+	metadata, _ := json.Marshal(vulnerability.Metadata)
+	sources, _ := json.Marshal(vulnerability.Sources)
+	cvss, _ := json.Marshal(vulnerability.CVSS)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", ContentHash(vulnerability), metadata, sources, cvss)
+	return hex.EncodeToString(h.Sum(nil))
+}
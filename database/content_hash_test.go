@@ -0,0 +1,93 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+
+	"github.com/coreos/clair/utils/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentHash(t *testing.T) {
+	openssl := FeatureVersion{Feature: Feature{Name: "openssl"}, Version: "1.0.2g"}
+	libssl := FeatureVersion{Feature: Feature{Name: "libssl"}, Version: "1.0.2g"}
+
+	vulnerability := Vulnerability{
+		Model:       Model{ID: 1},
+		Name:        "CVE-2016-2108",
+		Description: "ASN.1 encoder negative zero memory corruption",
+		Link:        "https://security-tracker.debian.org/tracker/CVE-2016-2108",
+		Severity:    types.High,
+		Sources:     VulnerabilitySources{{Name: "debian"}},
+		FixedIn:     []FeatureVersion{openssl, libssl},
+	}
+	hash := ContentHash(vulnerability)
+	assert.Len(t, hash, 64)
+
+	// The storage attributes and the order of the FixedIn set don't change the hash.
+	same := vulnerability
+	same.ID = 2
+	same.Sources = VulnerabilitySources{{Name: "debian"}, {Name: "nvd"}}
+	same.Metadata = MetadataMap{"NVD": map[string]interface{}{"Score": 10}}
+	same.FixedIn = []FeatureVersion{libssl, openssl}
+	assert.Equal(t, hash, ContentHash(same))
+
+	// Any change of the content does.
+	changed := vulnerability
+	changed.Severity = types.Medium
+	assert.NotEqual(t, hash, ContentHash(changed))
+
+	changed = vulnerability
+	changed.Description = "ASN.1 encoder negative zero memory corruption."
+	assert.NotEqual(t, hash, ContentHash(changed))
+
+	changed = vulnerability
+	changed.FixedIn = []FeatureVersion{openssl}
+	assert.NotEqual(t, hash, ContentHash(changed))
+
+	changed = vulnerability
+	changed.FixedIn = []FeatureVersion{openssl, {Feature: Feature{Name: "libssl"}, Version: "1.0.2h"}}
+	assert.NotEqual(t, hash, ContentHash(changed))
+}
+
+func TestRevision(t *testing.T) {
+	vulnerability := Vulnerability{
+		Name:     "CVE-2016-2108",
+		Severity: types.High,
+		Metadata: MetadataMap{"NVD": map[string]interface{}{"Score": 10}},
+		Sources:  VulnerabilitySources{{Name: "debian"}},
+		FixedIn:  []FeatureVersion{{Feature: Feature{Name: "openssl"}, Version: "1.0.2g"}},
+	}
+	revision := Revision(vulnerability)
+
+	same := vulnerability
+	same.ID = 2
+	assert.Equal(t, revision, Revision(same))
+
+	// Unlike the content hash, the revision changes with the Metadata and the Sources.
+	changed := vulnerability
+	changed.Metadata = MetadataMap{"NVD": map[string]interface{}{"Score": 9.8}}
+	assert.NotEqual(t, revision, Revision(changed))
+	assert.Equal(t, ContentHash(vulnerability), ContentHash(changed))
+
+	changed = vulnerability
+	changed.Sources = VulnerabilitySources{{Name: "debian"}, {Name: "nvd"}}
+	assert.NotEqual(t, revision, Revision(changed))
+
+	changed = vulnerability
+	changed.Severity = types.Critical
+	assert.NotEqual(t, revision, Revision(changed))
+}
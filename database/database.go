@@ -18,8 +18,11 @@ package database
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
+	"golang.org/x/net/context"
+
 	"github.com/coreos/clair/config"
 )
 
@@ -31,8 +34,20 @@ var (
 	// ErrInconsistent is an error that occurs when a database consistency check
 	// fails (ie. when an entity which is supposed to be unique is detected twice)
 	ErrInconsistent = errors.New("database: inconsistent database")
+
+	// ErrNamespaceInUse is an error that occurs when pruning a Namespace that a Layer uses.
+	ErrNamespaceInUse = errors.New("database: the namespace is used by a layer")
+
+	// ErrMigrationInProgress is an error that occurs when the schema of the database doesn't match
+	// the queries, as another version of Clair is migrating it, in which case the request can be
+	// retried after MigrationRetryAfter, e.g. by an instance of the new version.
+	ErrMigrationInProgress = errors.New("database: the schema of the database is being migrated")
 )
 
+// MigrationRetryAfter is how long clients are advised to wait before retrying a request that
+// failed with ErrMigrationInProgress.
+const MigrationRetryAfter = 10 * time.Second
+
 var drivers = make(map[string]Driver)
 
 // Driver is a function that opens a Datastore specified by its database driver type and specific
@@ -53,13 +68,51 @@ func Register(name string, driver Driver) {
 	drivers[name] = driver
 }
 
-// Open opens a Datastore specified by a configuration.
+// Drivers returns the sorted names of the registered Drivers.
+func Drivers() []string {
+	var names []string
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens a Datastore specified by a configuration. The latency and errors of its methods
+// are exported as metrics labeled by its driver.
 func Open(cfg config.RegistrableComponentConfig) (Datastore, error) {
 	driver, ok := drivers[cfg.Type]
 	if !ok {
 		return nil, fmt.Errorf("database: unknown Driver %q (forgotten configuration or import?)", cfg.Type)
 	}
-	return driver(cfg)
+
+	datastore, err := driver(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return Observe(datastore, metricsObserver{driver: cfg.Type}), nil
+}
+
+// HealthState describes how well a service is working.
+type HealthState string
+
+const (
+	// Healthy means that the service is fully working.
+	Healthy HealthState = "healthy"
+
+	// Degraded means that the service is working, but slowly or partially.
+	Degraded HealthState = "degraded"
+
+	// Unhealthy means that the service is not working.
+	Unhealthy HealthState = "unhealthy"
+)
+
+// HealthStatus is the health report of a service.
+type HealthStatus struct {
+	State   HealthState
+	Latency time.Duration
+	Version string
+	Message string
 }
 
 // Datastore is the interface that describes a database backend implementation.
@@ -81,13 +134,26 @@ type Datastore interface {
 	// FindLayer retrieves a Layer from the database.
 	// withFeatures specifies whether the Features field should be filled. When withVulnerabilities is
 	// true, the Features field should be filled and their AffectedBy fields should contain every
-	// vulnerabilities that affect them.
+	// vulnerabilities that affect them. The Features and their vulnerabilities have to be read
+	// from a single snapshot of the database, so that a concurrent update of the vulnerabilities
+	// can't leave the Layer with a mix of the old and the new ones.
 	FindLayer(name string, withFeatures, withVulnerabilities bool) (Layer, error)
 
 	// DeleteLayer deletes a Layer from the database and every layers that are based on it,
 	// recursively.
 	DeleteLayer(name string) error
 
+	// # Layer Label
+	// InsertLayerLabels attaches the given labels to a Layer, replacing the values of the labels
+	// it already has with the same keys. Labels with an empty value are removed. FindLayer fills
+	// the Labels of a Layer, and so does GetNotification for the Layers introducing
+	// Vulnerabilities.
+	InsertLayerLabels(name string, labels map[string]string) error
+
+	// ListLayers returns the Name and Labels of every Layer that has all the given labels,
+	// paginated in the same way as ListVulnerabilities.
+	ListLayers(labels map[string]string, limit int, page int) ([]Layer, int, error)
+
 	// # Vulnerability
 	// ListVulnerabilities returns the list of vulnerabilies of a certain Namespace.
 	// The Limit and page parameters are used to paginate the return list.
@@ -95,6 +161,12 @@ type Datastore interface {
 	// If there is no more page, -1 has to be returned.
 	ListVulnerabilities(namespaceName string, limit int, page int) ([]Vulnerability, int, error)
 
+	// StreamVulnerabilities calls fn with every Vulnerability of a certain Namespace, including
+	// the FixedIn list, ordered by ID. Every Vulnerability is read from the same snapshot of the
+	// database, regardless of the concurrent updates. An error returned by fn stops the stream and
+	// is returned.
+	StreamVulnerabilities(namespaceName string, fn func(Vulnerability) error) error
+
 	// InsertVulnerabilities stores the given Vulnerabilities in the database, updating them if
 	// necessary. A vulnerability is uniquely identified by its Namespace and its Name.
 	// The FixedIn field may only contain a partial list of Features that are affected by the
@@ -127,13 +199,56 @@ type Datastore interface {
 	// It has has to create a Notification that will contain the old and the updated Vulnerability.
 	DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerabilityName, featureName string) error
 
+	// # Vulnerability Archive
+	// ArchiveVulnerabilities moves every Vulnerability of the specified Namespace, including their
+	// previous revisions and FixedIn lists, out of the tables that are used to analyze layers and
+	// into archive tables. Notifications that reference these Vulnerabilities are removed. It
+	// returns the number of Vulnerability revisions that have been archived.
+	ArchiveVulnerabilities(namespaceName string) (int, error)
+
+	// ListArchivedVulnerabilities returns the list of archived vulnerabilities of a certain
+	// Namespace, paginated in the same way as ListVulnerabilities.
+	ListArchivedVulnerabilities(namespaceName string, limit int, page int) ([]Vulnerability, int, error)
+
+	// FindArchivedVulnerability retrieves an archived Vulnerability, including the FixedIn list.
+	FindArchivedVulnerability(namespaceName, name string) (Vulnerability, error)
+
+	// # Namespace Pruning
+	// ListUnusedNamespaces returns the Namespaces that no Layer uses, neither as its Namespace nor
+	// through its FeatureVersions.
+	ListUnusedNamespaces() ([]Namespace, error)
+
+	// PruneNamespace removes the Vulnerabilities of an unused Namespace, including their previous
+	// revisions, FixedIn lists and Notifications, without creating any Notification. The Features
+	// and FeatureVersions of the Namespace that nothing references anymore are removed as well,
+	// unless the backend caches their identifiers. The Namespace itself, its archived
+	// Vulnerabilities and its FalsePositives are kept. It returns ErrNamespaceInUse if a Layer uses
+	// the Namespace.
+	PruneNamespace(name string) (PrunedNamespace, error)
+
 	// # Notification
-	// GetAvailableNotification returns the Name, Created, Notified and Deleted fields of a
-	// Notification that should be handled. The renotify interval defines how much time after being
-	// marked as Notified by SetNotificationNotified, a Notification that hasn't been deleted should
-	// be returned again by this function. A Notification for which there is a valid Lock with the
-	// same Name should not be returned.
-	GetAvailableNotification(renotifyInterval time.Duration) (VulnerabilityNotification, error)
+	// GetAvailableNotification returns the Name, Created, Notified, Deleted and Failed fields of a
+	// Notification that should be handled, and claims it for the given owner by creating a Lock
+	// with the same Name that expires after the lock duration, so that no other owner handles it
+	// concurrently. The renotify interval defines how much time after being marked as Notified by
+	// SetNotificationNotified, a Notification that hasn't been deleted should be returned again by
+	// this function, and so does the renotify interval after being marked as Failed. A Notification
+	// for which there is a valid Lock with the same Name should not be returned, nor a Notification
+	// of a Vulnerability that has an older Notification neither marked as Notified, Failed nor
+	// deleted, so that the changes of a Vulnerability are delivered in creation order. The
+	// Notification is returned only once the Lock has been acquired.
+	GetAvailableNotification(renotifyInterval time.Duration, owner string, lockDuration time.Duration) (VulnerabilityNotification, error)
+
+	// ExtendNotificationLock pushes back the expiration of the Lock of a Notification claimed by
+	// GetAvailableNotification, to the current time plus the given duration. It returns false if
+	// the owner doesn't hold the Lock anymore, in which case another owner may handle the
+	// Notification.
+	ExtendNotificationLock(name, owner string, duration time.Duration) (bool, time.Time)
+
+	// ReleaseNotificationLock releases the Lock of a Notification claimed by
+	// GetAvailableNotification, making it available to other owners unless it has been marked as
+	// Notified or deleted in the meantime.
+	ReleaseNotificationLock(name, owner string)
 
 	// GetNotification returns a Notification, including its OldVulnerability and NewVulnerability
 	// fields. On these Vulnerabilities, LayersIntroducingVulnerability should be filled with
@@ -143,14 +258,126 @@ type Datastore interface {
 	// availage page. If there is no more page, NoVulnerabilityNotificationPage has to be returned.
 	GetNotification(name string, limit int, page VulnerabilityNotificationPageNumber) (VulnerabilityNotification, VulnerabilityNotificationPageNumber, error)
 
+	// ListNotificationLabels returns the distinct Labels of the labeled Layers affected by the old
+	// or the new Vulnerability of a Notification, that is the Layers introducing them and every
+	// Layer based on these, so that the Notification can be routed by the labels of the images.
+	ListNotificationLabels(name string) ([]map[string]string, error)
+
+	// ListNotificationWatchedTags returns every WatchedTag whose image is affected by the old or
+	// the new Vulnerability of a Notification, in the same way as ListNotificationLabels.
+	ListNotificationWatchedTags(name string) ([]WatchedTag, error)
+
 	// SetNotificationNotified marks a Notification as notified and thus, makes it unavailable for
-	// GetAvailableNotification, until the renotify duration is elapsed.
+	// GetAvailableNotification, until the renotify duration is elapsed. It clears its Failed time.
 	SetNotificationNotified(name string) error
 
+	// SetNotificationFailed marks a Notification as failed, after its delivery exhausted its
+	// attempts, and thus, makes it unavailable for GetAvailableNotification, until the renotify
+	// duration is elapsed. The newer Notifications of its Vulnerability stop being held back by it,
+	// so that a Notification that can't be delivered doesn't block the following ones forever.
+	SetNotificationFailed(name string) error
+
 	// DeleteNotification marks a Notification as deleted, and thus, makes it unavailable for
 	// GetAvailableNotification.
 	DeleteNotification(name string) error
 
+	// # Notification Delivery
+	// InsertNotificationDelivery returns the delivery of the specified Notification via the given
+	// notifier from the outbox, creating it if necessary. A delivery that has been completed before
+	// the Notification was last marked as notified by SetNotificationNotified is reopened with a new
+	// Key, so renotifications are not mistaken for duplicates.
+	InsertNotificationDelivery(notificationName, notifier string) (NotificationDelivery, error)
+
+	// InsertNotificationDeliveryAttempt records the outcome of an attempt at completing the given
+	// NotificationDelivery, which must have been retrieved using InsertNotificationDelivery. A
+	// successful attempt marks the delivery as delivered in the same transaction.
+	InsertNotificationDeliveryAttempt(delivery NotificationDelivery, succeeded bool, message string) error
+
+	// ListNotificationDeliveries returns every NotificationDelivery of a Notification, including
+	// their Attempts.
+	ListNotificationDeliveries(notificationName string) ([]NotificationDelivery, error)
+
+	// ListUndeliveredNotifications returns the Notifications that have been marked as notified and
+	// aren't deleted, but whose delivery via the given notifier hasn't been completed, e.g. because
+	// it was held during a maintenance window, oldest first, without their Vulnerabilities.
+	ListUndeliveredNotifications(notifier string) ([]VulnerabilityNotification, error)
+
+	// # False Positive
+
+	// InsertFalsePositive flags the finding identified by the Namespace, VulnerabilityName,
+	// FeatureName and FeatureVersion of the given FalsePositive, or updates the Reason of an
+	// existing flag. A Name is generated when the finding is flagged for the first time. The
+	// stored FalsePositive is returned.
+	InsertFalsePositive(FalsePositive) (FalsePositive, error)
+
+	// FindFalsePositives returns the FalsePositives that flag any of the given Vulnerabilities,
+	// which are identified by the Name of their Namespace and their Name.
+	FindFalsePositives(vulnerabilities []Vulnerability) ([]FalsePositive, error)
+
+	// ListFalsePositives returns every FalsePositive, paginated in the same way as
+	// ListVulnerabilities.
+	ListFalsePositives(limit int, page int) ([]FalsePositive, int, error)
+
+	// DeleteFalsePositive removes a FalsePositive, so the finding is reported again.
+	DeleteFalsePositive(name string) error
+
+	// # Watched Tag
+
+	// InsertWatchedTag starts watching the tag identified by the Registry, Repository and Tag of
+	// the given WatchedTag, generating its Name, or returns the existing WatchedTag if the tag is
+	// already watched.
+	InsertWatchedTag(WatchedTag) (WatchedTag, error)
+
+	// FindWatchedTag retrieves a WatchedTag by its Name.
+	FindWatchedTag(name string) (WatchedTag, error)
+
+	// ListWatchedTags returns every WatchedTag, paginated in the same way as ListVulnerabilities.
+	ListWatchedTags(limit int, page int) ([]WatchedTag, int, error)
+
+	// UpdateWatchedTag stores the Digest, LayerName, Signature, Attested, Published, Resolved and
+	// Changed fields of the
+	// WatchedTag identified by the Name of the given one. The first Digest stored is also the
+	// ReportedDigest, so that resolving a tag for the first time isn't reported as a move.
+	UpdateWatchedTag(WatchedTag) error
+
+	// ListMovedWatchedTags returns the WatchedTags whose Digest differs from their ReportedDigest,
+	// paginated in the same way as ListVulnerabilities.
+	ListMovedWatchedTags(limit int, page int) ([]WatchedTag, int, error)
+
+	// MarkWatchedTagReported sets the ReportedDigest of the WatchedTag identified by the given
+	// name.
+	MarkWatchedTagReported(name, digest string) error
+
+	// DeleteWatchedTag stops watching a tag. The layers of its images are kept.
+	DeleteWatchedTag(name string) error
+
+	// # Provenance
+
+	// InsertProvenance stores the Provenance of an image, generating its Name, or returns the
+	// stored one if the same Statement is already stored for the image.
+	InsertProvenance(Provenance) (Provenance, error)
+
+	// FindProvenances returns the Provenances of the image whose manifest has the given digest.
+	FindProvenances(digest string) ([]Provenance, error)
+
+	// # Image
+
+	// InsertImage stores the name of the top layer of the image whose manifest has the given
+	// digest, which must be indexed. Inserting an image again has no effect.
+	InsertImage(Image) error
+
+	// FindImage returns the Image whose manifest has the given digest.
+	FindImage(digest string) (Image, error)
+
+	// # Layer Analysis
+
+	// InsertLayerAnalysis stores the LayerAnalysis of the blob with the given digest, replacing the
+	// one stored for it, if any.
+	InsertLayerAnalysis(LayerAnalysis) error
+
+	// FindLayerAnalysis returns the LayerAnalysis of the blob with the given digest.
+	FindLayerAnalysis(digest string) (LayerAnalysis, error)
+
 	// # Key/Value
 	// InsertKeyValue stores or updates a simple key/value pair in the database.
 	InsertKeyValue(key, value string) error
@@ -176,8 +403,15 @@ type Datastore interface {
 	FindLock(name string) (string, time.Time, error)
 
 	// # Miscellaneous
-	// Ping returns the health status of the database.
-	Ping() bool
+	// WithContext returns the database making the queries of the calls to its methods with the
+	// given context, which cancels them once it is done and carries the span of the operation they
+	// are part of. The returned database shares the connections of this one and must not be closed.
+	WithContext(ctx context.Context) Datastore
+
+	// Health reports the state of the database, the latency of a round-trip to the backend and its
+	// version. The given context bounds the time spent checking the backend, after which the
+	// database should be considered as Unhealthy.
+	Health(ctx context.Context) (HealthStatus, error)
 
 	// Close closes the database and free any allocated resource.
 	Close()
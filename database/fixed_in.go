@@ -0,0 +1,82 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/utils"
+)
+
+// ApplyFixedInDiff applies a FeatureVersion diff on a FeatureVersion list, as the datastores do
+// when a Vulnerability is inserted over an existing one, and returns the result along with whether
+// it differs from the current list.
+//
+// A FeatureVersion of the diff replaces the one of the same Feature, unless its Version is
+// versionfmt.MinVersion, which removes the Feature from the list.
+func ApplyFixedInDiff(currentList, diff []FeatureVersion) ([]FeatureVersion, bool) {
+	currentMap, currentNames := createFeatureVersionNameMap(currentList)
+	diffMap, diffNames := createFeatureVersionNameMap(diff)
+
+	addedNames := utils.CompareStringLists(diffNames, currentNames)
+	inBothNames := utils.CompareStringListsInBoth(diffNames, currentNames)
+
+	different := false
+
+	for _, name := range addedNames {
+		if diffMap[name].Version == versionfmt.MinVersion {
+			// MinVersion only makes sense when a Feature is already fixed in some version,
+			// in which case we would be in the "inBothNames".
+			continue
+		}
+
+		currentMap[name] = diffMap[name]
+		different = true
+	}
+
+	for _, name := range inBothNames {
+		fv := diffMap[name]
+
+		if fv.Version == versionfmt.MinVersion {
+			// MinVersion means that the Feature doesn't affect the Vulnerability anymore.
+			delete(currentMap, name)
+			different = true
+		} else if fv.Version != currentMap[name].Version {
+			// The version got updated.
+			currentMap[name] = diffMap[name]
+			different = true
+		}
+	}
+
+	// Convert currentMap to a slice and return it.
+	var newList []FeatureVersion
+	for _, fv := range currentMap {
+		newList = append(newList, fv)
+	}
+
+	return newList, different
+}
+
+func createFeatureVersionNameMap(features []FeatureVersion) (map[string]FeatureVersion, []string) {
+	m := make(map[string]FeatureVersion, 0)
+	s := make([]string, 0, len(features))
+
+	for i := 0; i < len(features); i++ {
+		featureVersion := features[i]
+		m[featureVersion.Feature.Name] = featureVersion
+		s = append(s, featureVersion.Feature.Name)
+	}
+
+	return m, s
+}
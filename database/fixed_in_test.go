@@ -0,0 +1,60 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+func TestApplyFixedInDiff(t *testing.T) {
+	fixedIn := func(name, version string) FeatureVersion {
+		return FeatureVersion{Feature: Feature{Name: name}, Version: version}
+	}
+	sorted := func(list []FeatureVersion) []FeatureVersion {
+		sort.Slice(list, func(i, j int) bool { return list[i].Feature.Name < list[j].Feature.Name })
+		return list
+	}
+	current := []FeatureVersion{fixedIn("openssl", "1.0"), fixedIn("libssl", "1.0")}
+
+	// No changes.
+	list, different := ApplyFixedInDiff(current, nil)
+	assert.False(t, different)
+	assert.Equal(t, sorted([]FeatureVersion{fixedIn("libssl", "1.0"), fixedIn("openssl", "1.0")}), sorted(list))
+	_, different = ApplyFixedInDiff(current, []FeatureVersion{fixedIn("openssl", "1.0")})
+	assert.False(t, different)
+
+	// Add, update and remove Features.
+	list, different = ApplyFixedInDiff(current, []FeatureVersion{
+		fixedIn("nginx", "1.2"),
+		fixedIn("openssl", "1.1"),
+		fixedIn("libssl", versionfmt.MinVersion),
+	})
+	assert.True(t, different)
+	assert.Equal(t, []FeatureVersion{fixedIn("nginx", "1.2"), fixedIn("openssl", "1.1")}, sorted(list))
+
+	// Removing a Feature that isn't fixed does nothing.
+	list, different = ApplyFixedInDiff(current, []FeatureVersion{fixedIn("nginx", versionfmt.MinVersion)})
+	assert.False(t, different)
+	assert.Len(t, list, 2)
+
+	list, different = ApplyFixedInDiff(nil, []FeatureVersion{fixedIn("nginx", "1.2")})
+	assert.True(t, different)
+	assert.Equal(t, []FeatureVersion{fixedIn("nginx", "1.2")}, list)
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SortedKeys returns the keys of the given map in order, e.g. so that the queries built from a
+// set of labels are deterministic.
+func SortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LabelsID identifies a set of labels, independently of the order of its keys.
+func LabelsID(labels map[string]string) string {
+	var id string
+	for _, key := range SortedKeys(labels) {
+		id += fmt.Sprintf("%q=%q,", key, labels[key])
+	}
+	return id
+}
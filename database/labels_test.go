@@ -0,0 +1,36 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortedKeys(t *testing.T) {
+	assert.Equal(t, []string{}, SortedKeys(nil))
+	assert.Equal(t, []string{"app", "env", "team"}, SortedKeys(map[string]string{"team": "a", "app": "b", "env": "c"}))
+}
+
+func TestLabelsID(t *testing.T) {
+	assert.Equal(t, "", LabelsID(nil))
+	assert.Equal(t, LabelsID(map[string]string{"app": "web", "env": "prod"}), LabelsID(map[string]string{"env": "prod", "app": "web"}))
+	assert.NotEqual(t, LabelsID(map[string]string{"app": "web", "env": "prod"}), LabelsID(map[string]string{"app": "web"}))
+
+	// Keys and values can't be confused with one another.
+	assert.NotEqual(t, LabelsID(map[string]string{"a": "b=c"}), LabelsID(map[string]string{"a=b": "c"}))
+	assert.NotEqual(t, LabelsID(map[string]string{"a": "b,", "c": "d"}), LabelsID(map[string]string{"a": "b", ",c": "d"}))
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertFalsePositive flags a finding as a false positive, or updates the reason of an existing
+// flag.
+func (db *memory) InsertFalsePositive(falsePositive database.FalsePositive) (database.FalsePositive, error) {
+	if falsePositive.Namespace.Name == "" || falsePositive.VulnerabilityName == "" ||
+		falsePositive.FeatureName == "" || falsePositive.FeatureVersion == "" {
+		return falsePositive, cerrors.NewBadRequestError("could not insert a false positive which does not identify a finding")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, existing := range db.falsePositives {
+		if existing.Namespace.Name == falsePositive.Namespace.Name &&
+			existing.VulnerabilityName == falsePositive.VulnerabilityName &&
+			existing.FeatureName == falsePositive.FeatureName &&
+			existing.FeatureVersion == falsePositive.FeatureVersion {
+			existing.Reason = falsePositive.Reason
+			return *existing, nil
+		}
+	}
+
+	namespace, err := db.insertNamespace(falsePositive.Namespace)
+	if err != nil {
+		return falsePositive, err
+	}
+	falsePositive.Namespace = namespace
+	falsePositive.ID = db.nextID()
+	falsePositive.Name = uuid.New()
+	falsePositive.Created = time.Now().UTC()
+
+	stored := falsePositive
+	db.falsePositives[stored.Name] = &stored
+	return falsePositive, nil
+}
+
+// FindFalsePositives returns the false positives flagging any of the given vulnerabilities.
+func (db *memory) FindFalsePositives(vulnerabilities []database.Vulnerability) ([]database.FalsePositive, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	flagged := make(map[vulnerabilityKey]struct{})
+	for _, vulnerability := range vulnerabilities {
+		flagged[vulnerabilityKey{vulnerability.Namespace.Name, vulnerability.Name}] = struct{}{}
+	}
+
+	return db.listFalsePositives(func(falsePositive *database.FalsePositive) bool {
+		_, ok := flagged[vulnerabilityKey{falsePositive.Namespace.Name, falsePositive.VulnerabilityName}]
+		return ok
+	}), nil
+}
+
+func (db *memory) ListFalsePositives(limit int, startID int) ([]database.FalsePositive, int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	falsePositives := db.listFalsePositives(func(falsePositive *database.FalsePositive) bool {
+		return falsePositive.ID >= startID
+	})
+
+	nextID := -1
+	if len(falsePositives) > limit {
+		nextID = falsePositives[limit].ID
+		falsePositives = falsePositives[:limit]
+	}
+	return falsePositives, nextID, nil
+}
+
+// listFalsePositives returns the false positives for which keep returns true, ordered by ID.
+func (db *memory) listFalsePositives(keep func(*database.FalsePositive) bool) []database.FalsePositive {
+	byID := make(map[int]database.FalsePositive)
+	var ids []int
+	for _, falsePositive := range db.falsePositives {
+		if keep(falsePositive) {
+			byID[falsePositive.ID] = *falsePositive
+			ids = append(ids, falsePositive.ID)
+		}
+	}
+	sort.Ints(ids)
+
+	var falsePositives []database.FalsePositive
+	for _, id := range ids {
+		falsePositives = append(falsePositives, byID[id])
+	}
+	return falsePositives
+}
+
+// DeleteFalsePositive removes a false positive.
+func (db *memory) DeleteFalsePositive(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.falsePositives[name]; !ok {
+		return cerrors.ErrNotFound
+	}
+	delete(db.falsePositives, name)
+	return nil
+}
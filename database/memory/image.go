@@ -0,0 +1,60 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"time"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertImage stores the top layer of the image whose manifest has the given digest, unless the
+// image is already stored.
+func (db *memory) InsertImage(image database.Image) error {
+	if image.Digest == "" || image.LayerName == "" {
+		return cerrors.NewBadRequestError("could not insert an image which does not have a digest and a layer")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.layers[image.LayerName]; !ok {
+		return cerrors.ErrNotFound
+	}
+	if _, ok := db.images[image.Digest]; ok {
+		return nil
+	}
+
+	db.images[image.Digest] = database.Image{
+		Model:     database.Model{ID: db.nextID()},
+		Digest:    image.Digest,
+		LayerName: image.LayerName,
+		Created:   time.Now().UTC(),
+	}
+	return nil
+}
+
+// FindImage returns the image whose manifest has the given digest.
+func (db *memory) FindImage(digest string) (database.Image, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	image, ok := db.images[digest]
+	if !ok {
+		return database.Image{Digest: digest}, cerrors.ErrNotFound
+	}
+	return image, nil
+}
@@ -0,0 +1,281 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// storedLayer is a stored Layer, which references its parent and its Namespace by name.
+type storedLayer struct {
+	id            int
+	name          string
+	engineVersion int
+	parent        string
+	namespace     string
+
+	// features holds every FeatureVersion of the layer, including the ones it inherits, without
+	// their AffectedBy.
+	features []database.FeatureVersion
+	labels   map[string]string
+	stats    database.LayerStats
+}
+
+// featureVersionKey identifies a FeatureVersion within a layer.
+type featureVersionKey struct {
+	namespace string
+	name      string
+	version   string
+}
+
+func keyOf(fv database.FeatureVersion) featureVersionKey {
+	return featureVersionKey{fv.Feature.Namespace.Name, fv.Feature.Name, fv.Version}
+}
+
+func (db *memory) FindLayer(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	stored, ok := db.layers[name]
+	if !ok {
+		return database.Layer{}, cerrors.ErrNotFound
+	}
+
+	layer := db.toLayer(stored)
+	if withFeatures || withVulnerabilities {
+		for _, fv := range stored.features {
+			fv.Evidence = copyStrings(fv.Evidence)
+			if withVulnerabilities {
+				fv.AffectedBy = db.affectedBy(fv)
+			}
+			layer.Features = append(layer.Features, fv)
+		}
+	}
+
+	return layer, nil
+}
+
+// copyStats returns a copy of the given LayerStats, which don't share their Detectors.
+func copyStats(stats database.LayerStats) database.LayerStats {
+	if stats.Detectors != nil {
+		detectors := make(map[string]time.Duration, len(stats.Detectors))
+		for name, duration := range stats.Detectors {
+			detectors[name] = duration
+		}
+		stats.Detectors = detectors
+	}
+	return stats
+}
+
+// toLayer returns the Layer, without its Features, of a stored layer.
+func (db *memory) toLayer(stored *storedLayer) database.Layer {
+	layer := database.Layer{
+		Model:         database.Model{ID: stored.id},
+		Name:          stored.name,
+		EngineVersion: stored.engineVersion,
+		Labels:        copyLabels(stored.labels),
+		Stats:         copyStats(stored.stats),
+	}
+	if parent, ok := db.layers[stored.parent]; ok {
+		layer.Parent = &database.Layer{Model: database.Model{ID: parent.id}, Name: parent.name}
+	}
+	if namespace, ok := db.namespaces[stored.namespace]; ok {
+		ns := *namespace
+		layer.Namespace = &ns
+	}
+	return layer
+}
+
+// affectedBy returns the latest revisions of the vulnerabilities fixed in a later version of the
+// Feature of the given FeatureVersion, ordered by ID, without their FixedIn lists.
+func (db *memory) affectedBy(fv database.FeatureVersion) []database.Vulnerability {
+	var ids []int
+	for id := range db.fixes[featureKey{fv.Feature.Namespace.Name, fv.Feature.Name}] {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var vulnerabilities []database.Vulnerability
+	for _, id := range ids {
+		vulnerability := copyVulnerability(db.revisions[id], false)
+		for _, fixedIn := range db.revisions[id].FixedIn {
+			if fixedIn.Feature.Name == fv.Feature.Name {
+				vulnerability.FixedBy = fixedIn.Version
+			}
+		}
+
+		cmp, err := versionfmt.Compare(fv.Feature.Namespace.VersionFormat, fv.Version, vulnerability.FixedBy)
+		if err != nil {
+			log.Warningf("could not compare %s with %s: %s", fv.Version, vulnerability.FixedBy, err)
+			continue
+		}
+		if cmp < 0 {
+			vulnerabilities = append(vulnerabilities, vulnerability)
+		}
+	}
+	return vulnerabilities
+}
+
+func (db *memory) InsertLayer(layer database.Layer) error {
+	// Verify parameters
+	if layer.Name == "" {
+		log.Warning("could not insert a layer which has an empty Name")
+		return cerrors.NewBadRequestError("could not insert a layer which has an empty Name")
+	}
+	if layer.Namespace != nil && layer.Namespace.Name == "" {
+		return cerrors.NewBadRequestError("could not find/insert invalid Namespace")
+	}
+	for _, fv := range layer.Features {
+		if fv.Feature.Name == "" || fv.Feature.Namespace.Name == "" || fv.Version == "" {
+			return cerrors.NewBadRequestError("could not find/insert invalid FeatureVersion")
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	existing, ok := db.layers[layer.Name]
+	if ok && existing.engineVersion >= layer.EngineVersion {
+		// The layer exists and has an equal or higher engine version, do nothing.
+		return nil
+	}
+
+	var parent *storedLayer
+	if layer.Parent != nil {
+		if parent, ok = db.layers[layer.Parent.Name]; !ok {
+			log.Warning("Parent is expected to be retrieved from database when inserting a layer.")
+			return cerrors.NewBadRequestError("Parent is expected to be retrieved from database when inserting a layer.")
+		}
+	}
+
+	stored := &storedLayer{name: layer.Name, engineVersion: layer.EngineVersion, stats: copyStats(layer.Stats)}
+	if existing != nil {
+		// Update an existing layer, which keeps its identifier, its parent and its labels.
+		stored.id, stored.parent, stored.labels = existing.id, existing.parent, existing.labels
+	} else {
+		stored.id = db.nextID()
+		if parent != nil {
+			stored.parent = parent.name
+		}
+	}
+
+	// Find or insert namespace if provided, or import the one of the parent.
+	if layer.Namespace != nil {
+		namespace, _ := db.insertNamespace(*layer.Namespace)
+		stored.namespace = namespace.Name
+	} else if parent != nil {
+		stored.namespace = parent.namespace
+	}
+
+	// A FeatureVersion that the parent layer already has keeps the layer that added it, along with
+	// the detector that found it there and its state there. Its evidence is the one of the layer.
+	inherited := make(map[featureVersionKey]database.FeatureVersion)
+	if parent != nil {
+		for _, fv := range parent.features {
+			inherited[keyOf(fv)] = fv
+		}
+	}
+	seen := make(map[featureVersionKey]struct{})
+	for _, fv := range layer.Features {
+		if _, ok := seen[keyOf(fv)]; ok {
+			continue
+		}
+		seen[keyOf(fv)] = struct{}{}
+
+		namespace, _ := db.insertNamespace(fv.Feature.Namespace)
+		storedFV := database.FeatureVersion{
+			Feature:    database.Feature{Name: fv.Feature.Name, Namespace: namespace},
+			Version:    fv.Version,
+			AddedBy:    database.Layer{Model: database.Model{ID: stored.id}, Name: stored.name},
+			DetectedBy: fv.DetectedBy,
+			State:      fv.State,
+			Evidence:   copyStrings(fv.Evidence),
+		}
+		if parentFV, ok := inherited[keyOf(fv)]; ok {
+			storedFV.AddedBy, storedFV.DetectedBy, storedFV.State = parentFV.AddedBy, parentFV.DetectedBy, parentFV.State
+		}
+		stored.features = append(stored.features, storedFV)
+	}
+
+	db.layers[stored.name] = stored
+	return nil
+}
+
+func (db *memory) DeleteLayer(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.layers[name]; !ok {
+		return cerrors.ErrNotFound
+	}
+
+	// Delete the layers based on the deleted one, recursively, and the images of all of them.
+	deleted := db.descendants([]string{name})
+	for _, name := range deleted {
+		for digest, image := range db.images {
+			if image.LayerName == name {
+				delete(db.images, digest)
+			}
+		}
+		delete(db.layers, name)
+	}
+
+	return nil
+}
+
+// descendants returns the names of the given layers and of every layer based on them, ordered by
+// ID.
+func (db *memory) descendants(names []string) []string {
+	found := make(map[string]struct{})
+	for _, name := range names {
+		found[name] = struct{}{}
+	}
+	for more := true; more; {
+		more = false
+		for _, layer := range db.layers {
+			_, isFound := found[layer.name]
+			if _, parentFound := found[layer.parent]; parentFound && !isFound {
+				found[layer.name] = struct{}{}
+				more = true
+			}
+		}
+	}
+
+	return db.sortLayerNames(found)
+}
+
+// sortLayerNames returns the names of the given stored layers, ordered by ID.
+func (db *memory) sortLayerNames(names map[string]struct{}) []string {
+	byID := make(map[int]string)
+	var ids []int
+	for name := range names {
+		if layer, ok := db.layers[name]; ok {
+			byID[layer.id] = name
+			ids = append(ids, layer.id)
+		}
+	}
+	sort.Ints(ids)
+
+	var sorted []string
+	for _, id := range ids {
+		sorted = append(sorted, byID[id])
+	}
+	return sorted
+}
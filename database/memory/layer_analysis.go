@@ -0,0 +1,71 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"time"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// storedLayerAnalysis is a LayerAnalysis whose result is encoded, as the other datastores store
+// it, so that it doesn't share anything with the callers.
+type storedLayerAnalysis struct {
+	version string
+	result  []byte
+	created time.Time
+}
+
+// InsertLayerAnalysis stores the analysis of the blob with the given digest, replacing the one
+// stored for it, if any.
+func (db *memory) InsertLayerAnalysis(analysis database.LayerAnalysis) error {
+	if analysis.Digest == "" || analysis.Version == "" {
+		return cerrors.NewBadRequestError("could not insert a layer analysis which does not have a digest and a version")
+	}
+
+	result, err := analysis.Result.Value()
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.layerAnalyses[analysis.Digest] = storedLayerAnalysis{
+		version: analysis.Version,
+		result:  []byte(result.(string)),
+		created: time.Now().UTC(),
+	}
+	return nil
+}
+
+// FindLayerAnalysis returns the analysis of the blob with the given digest.
+func (db *memory) FindLayerAnalysis(digest string) (database.LayerAnalysis, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	analysis := database.LayerAnalysis{Digest: digest}
+	stored, ok := db.layerAnalyses[digest]
+	if !ok {
+		return analysis, cerrors.ErrNotFound
+	}
+
+	analysis.Version, analysis.Created = stored.version, stored.created
+	if err := analysis.Result.Scan(stored.result); err != nil {
+		return analysis, err
+	}
+	return analysis, nil
+}
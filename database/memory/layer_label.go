@@ -0,0 +1,119 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertLayerLabels attaches labels to a layer, removing the ones with an empty value.
+func (db *memory) InsertLayerLabels(name string, labels map[string]string) error {
+	for key := range labels {
+		if key == "" {
+			return cerrors.NewBadRequestError("could not insert a label which has an empty key")
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	layer, ok := db.layers[name]
+	if !ok {
+		return cerrors.ErrNotFound
+	}
+
+	merged := copyLabels(layer.labels)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	for key, value := range labels {
+		if value == "" {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+	layer.labels = merged
+
+	return nil
+}
+
+// ListLayers paginates over the layers having all the given labels.
+func (db *memory) ListLayers(labels map[string]string, limit int, startID int) ([]database.Layer, int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	matching := make(map[int]*storedLayer)
+	var ids []int
+	for _, layer := range db.layers {
+		if hasLabels(layer.labels, labels) {
+			matching[layer.id] = layer
+			ids = append(ids, layer.id)
+		}
+	}
+	sort.Ints(ids)
+
+	ids, nextID := paginate(ids, limit, startID)
+	var layers []database.Layer
+	for _, id := range ids {
+		layers = append(layers, database.Layer{
+			Model:  database.Model{ID: id},
+			Name:   matching[id].name,
+			Labels: copyLabels(matching[id].labels),
+		})
+	}
+	return layers, nextID, nil
+}
+
+// hasLabels returns whether the given labels contain every wanted one.
+func hasLabels(labels, wanted map[string]string) bool {
+	for key, value := range wanted {
+		if labels[key] != value || value == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (db *memory) ListNotificationLabels(name string) ([]map[string]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	layerNames, err := db.notificationAffectedLayers(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Images sharing the same labels, e.g. the successive builds of a project, are routed once.
+	var labels []map[string]string
+	seen := make(map[string]struct{})
+	for _, layerName := range layerNames {
+		layerLabels := db.layers[layerName].labels
+		if len(layerLabels) == 0 {
+			continue
+		}
+
+		id := database.LabelsID(layerLabels)
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			labels = append(labels, copyLabels(layerLabels))
+		}
+	}
+
+	return labels, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"time"
+
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+type lock struct {
+	owner string
+	until time.Time
+}
+
+// Lock tries to set a temporary lock in the datastore. An expired lock can be taken by anyone.
+func (db *memory) Lock(name string, owner string, duration time.Duration, renew bool) (bool, time.Time) {
+	if name == "" || owner == "" || duration == 0 {
+		log.Warning("could not create an invalid lock")
+		return false, time.Time{}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// Compute expiration.
+	now := time.Now()
+	until := now.Add(duration)
+
+	existing, ok := db.locks[name]
+	if ok && existing.until.Before(now) {
+		// The lock expired.
+		ok = false
+	}
+	if ok && !(renew && existing.owner == owner) {
+		return false, until
+	}
+
+	db.locks[name] = lock{owner: owner, until: until}
+	return true, until
+}
+
+// Unlock releases a lock specified by its name if the given owner holds it.
+func (db *memory) Unlock(name, owner string) {
+	if name == "" || owner == "" {
+		log.Warning("could not delete an invalid lock")
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if existing, ok := db.locks[name]; ok && existing.owner == owner {
+		delete(db.locks, name)
+	}
+}
+
+// FindLock returns the owner of a lock specified by its name and its
+// expiration time.
+func (db *memory) FindLock(name string) (string, time.Time, error) {
+	if name == "" {
+		log.Warning("could not find an invalid lock")
+		return "", time.Time{}, cerrors.NewBadRequestError("could not find an invalid lock")
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	existing, ok := db.locks[name]
+	if !ok {
+		return "", time.Time{}, cerrors.ErrNotFound
+	}
+	return existing.owner, existing.until, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memory implements database.Datastore with in-process maps, so Clair can run without any
+// database, e.g. in CI pipelines, in unit tests or to scan images once and exit.
+//
+// Like the sqlite driver, every layer stores its entire list of FeatureVersions and the
+// vulnerabilities affecting them are determined when the layer is read. Like the pgsql driver,
+// the previous revisions of the Vulnerabilities are kept so that notifications can be generated.
+//
+// Everything is lost when the process exits, and every call to database.Open returns a new, empty
+// datastore: it can't be shared by several Clair instances.
+package memory
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/coreos/pkg/capnslog"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "memory")
+
+func init() {
+	database.Register("memory", openDatabase)
+}
+
+// vulnerabilityKey identifies a Vulnerability across its revisions.
+type vulnerabilityKey struct {
+	namespace string
+	name      string
+}
+
+// featureKey identifies a Feature, which vulnerabilities are fixed in.
+type featureKey struct {
+	namespace string
+	name      string
+}
+
+// memory is a datastore whose every method holds mu for its whole duration, which makes each of
+// them atomic and lets reads see a consistent snapshot.
+type memory struct {
+	mu sync.RWMutex
+
+	// lastID is the last identifier that has been given to any model.
+	lastID int
+
+	namespaces map[string]*database.Namespace
+	layers     map[string]*storedLayer
+
+	// revisions holds every revision of the Vulnerabilities, by identifier, and latest the
+	// identifier of the current revision of the ones that haven't been deleted.
+	revisions map[int]*database.Vulnerability
+	latest    map[vulnerabilityKey]int
+	// fixes indexes the identifiers of the latest revisions by the Features they are fixed in.
+	fixes    map[featureKey]map[int]struct{}
+	archived map[vulnerabilityKey]database.Vulnerability
+
+	notifications  map[string]*notification
+	falsePositives map[string]*database.FalsePositive
+	watchedTags    map[string]*database.WatchedTag
+	provenances    []database.Provenance
+	images         map[string]database.Image
+	layerAnalyses  map[string]storedLayerAnalysis
+	keyValues      map[string]string
+	locks          map[string]lock
+}
+
+// openDatabase returns a new, empty datastore. It doesn't have any option.
+func openDatabase(config.RegistrableComponentConfig) (database.Datastore, error) {
+	return &memory{
+		namespaces:     make(map[string]*database.Namespace),
+		layers:         make(map[string]*storedLayer),
+		revisions:      make(map[int]*database.Vulnerability),
+		latest:         make(map[vulnerabilityKey]int),
+		fixes:          make(map[featureKey]map[int]struct{}),
+		archived:       make(map[vulnerabilityKey]database.Vulnerability),
+		notifications:  make(map[string]*notification),
+		falsePositives: make(map[string]*database.FalsePositive),
+		watchedTags:    make(map[string]*database.WatchedTag),
+		images:         make(map[string]database.Image),
+		layerAnalyses:  make(map[string]storedLayerAnalysis),
+		keyValues:      make(map[string]string),
+		locks:          make(map[string]lock),
+	}, nil
+}
+
+// nextID returns a new identifier, greater than every identifier given before.
+func (db *memory) nextID() int {
+	db.lastID++
+	return db.lastID
+}
+
+// Close does nothing: the data is released with the datastore.
+func (db *memory) Close() {}
+
+// WithContext returns the database itself, as its calls don't block on queries.
+func (db *memory) WithContext(ctx context.Context) database.Datastore {
+	return db
+}
+
+// Health reports the datastore as always healthy, as it doesn't depend on anything. Its version
+// is the one of the Go runtime.
+func (db *memory) Health(ctx context.Context) (database.HealthStatus, error) {
+	return database.HealthStatus{State: database.Healthy, Version: runtime.Version()}, nil
+}
+
+// copyStrings returns a copy of the given list, keeping the difference between nil and empty.
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+// copyLabels returns a copy of the given labels, or nil if there is none.
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(labels))
+	for key, value := range labels {
+		c[key] = value
+	}
+	return c
+}
+
+// paginate returns, out of the given identifiers sorted in increasing order, the ones starting at
+// startID, at most limit of them, and the identifier starting the next page or -1 if there isn't
+// any.
+func paginate(ids []int, limit, startID int) ([]int, int) {
+	var page []int
+	for _, id := range ids {
+		if id < startID {
+			continue
+		}
+		if len(page) == limit {
+			return page, id
+		}
+		page = append(page, id)
+	}
+	return page, -1
+}
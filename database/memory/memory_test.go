@@ -0,0 +1,204 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/database/testutil"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+func openDatabaseForTest(t *testing.T) database.Datastore {
+	datastore, err := database.Open(config.RegistrableComponentConfig{Type: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return datastore
+}
+
+func TestKeyValue(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	// Get non-existing key/value
+	f, err := datastore.GetKeyValue("test")
+	assert.Nil(t, err)
+	assert.Empty(t, f)
+
+	// Try to insert invalid key/value.
+	assert.Error(t, datastore.InsertKeyValue("test", ""))
+	assert.Error(t, datastore.InsertKeyValue("", "test"))
+
+	// Insert, update and verify.
+	assert.Nil(t, datastore.InsertKeyValue("test", "test1"))
+	assert.Nil(t, datastore.InsertKeyValue("test", "test2"))
+	f, err = datastore.GetKeyValue("test")
+	assert.Nil(t, err)
+	assert.Equal(t, "test2", f)
+}
+
+func TestLock(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	// Create a first lock.
+	l, _ := datastore.Lock("test1", "owner1", time.Minute, false)
+	assert.True(t, l)
+
+	// Try to lock the same lock with another owner.
+	l, _ = datastore.Lock("test1", "owner2", time.Minute, true)
+	assert.False(t, l)
+	l, _ = datastore.Lock("test1", "owner2", time.Minute, false)
+	assert.False(t, l)
+
+	// Renew the lock.
+	l, _ = datastore.Lock("test1", "owner1", 2*time.Minute, true)
+	assert.True(t, l)
+
+	// Unlock and then relock by someone else.
+	datastore.Unlock("test1", "owner2")
+	l, _ = datastore.Lock("test1", "owner2", time.Minute, false)
+	assert.False(t, l, "only the owner can unlock")
+	datastore.Unlock("test1", "owner1")
+	l, until := datastore.Lock("test1", "owner2", time.Minute, false)
+	assert.True(t, l)
+
+	// LockInfo
+	o, u, err := datastore.FindLock("test1")
+	assert.Nil(t, err)
+	assert.Equal(t, "owner2", o)
+	assert.Equal(t, until.UnixNano(), u.UnixNano())
+	_, _, err = datastore.FindLock("test2")
+	assert.Equal(t, cerrors.ErrNotFound, err)
+
+	// Create a second lock which is actually already expired ...
+	l, _ = datastore.Lock("test2", "owner1", -time.Minute, false)
+	assert.True(t, l)
+
+	// Take over the lock
+	l, _ = datastore.Lock("test2", "owner2", time.Minute, false)
+	assert.True(t, l)
+}
+
+func TestNotificationDelivery(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	// Create a notification.
+	vulnerability := testutil.Vulnerability(testutil.Namespace("debian:7"), "CVE-NOTIFIED", types.High)
+	if !assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true)) {
+		return
+	}
+	notification, err := datastore.GetAvailableNotification(time.Second, "test", time.Minute)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Create the delivery, it must be found again with the same key.
+	delivery, err := datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.NotEmpty(t, delivery.Key)
+		assert.True(t, delivery.Delivered.IsZero())
+	}
+	sameDelivery, err := datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.Equal(t, delivery.ID, sameDelivery.ID)
+		assert.Equal(t, delivery.Key, sameDelivery.Key)
+	}
+	_, err = datastore.InsertNotificationDelivery("unknown", "TestNotifier")
+	assert.Equal(t, cerrors.ErrNotFound, err)
+
+	// Record a failed attempt and a successful one.
+	assert.Nil(t, datastore.InsertNotificationDeliveryAttempt(delivery, false, "connection refused"))
+	assert.Nil(t, datastore.InsertNotificationDeliveryAttempt(delivery, true, ""))
+
+	deliveries, err := datastore.ListNotificationDeliveries(notification.Name)
+	if assert.Nil(t, err) && assert.Len(t, deliveries, 1) {
+		assert.Equal(t, "TestNotifier", deliveries[0].Notifier)
+		assert.False(t, deliveries[0].Delivered.IsZero())
+		if assert.Len(t, deliveries[0].Attempts, 2) {
+			assert.False(t, deliveries[0].Attempts[0].Succeeded)
+			assert.Equal(t, "connection refused", deliveries[0].Attempts[0].Error)
+			assert.True(t, deliveries[0].Attempts[1].Succeeded)
+		}
+	}
+
+	// Once delivered, the delivery must not be reopened until the notification is sent again.
+	delivery, err = datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.False(t, delivery.Delivered.IsZero())
+	}
+
+	// Sending the notification again reopens the delivery with a new key.
+	assert.Nil(t, datastore.SetNotificationNotified(notification.Name))
+	delivery, err = datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.True(t, delivery.Delivered.IsZero())
+		assert.NotEqual(t, sameDelivery.Key, delivery.Key)
+	}
+
+	// The notification is notified but its delivery is open, e.g. held during a maintenance window.
+	notifications, err := datastore.ListUndeliveredNotifications("TestNotifier")
+	if assert.Nil(t, err) && assert.Len(t, notifications, 1) {
+		assert.Equal(t, notification.Name, notifications[0].Name)
+		assert.Equal(t, types.High, notifications[0].Priority)
+	}
+	assert.Nil(t, datastore.InsertNotificationDeliveryAttempt(delivery, true, ""))
+	notifications, err = datastore.ListUndeliveredNotifications("TestNotifier")
+	assert.Nil(t, err)
+	assert.Len(t, notifications, 0)
+}
+
+func TestCopies(t *testing.T) {
+	datastore := testutil.Harness{
+		Open: func() (database.Datastore, error) {
+			return openDatabase(config.RegistrableComponentConfig{})
+		},
+		Fixture: testutil.DefaultFixture(),
+	}.Datastore(t)
+	defer datastore.Close()
+
+	// Modifying what the datastore returns doesn't modify what it stores.
+	layer, err := datastore.FindLayer("layer-2", true, false)
+	if assert.Nil(t, err) {
+		layer.Labels["team"] = "payments"
+		layer.Namespace.Name = "debian:8"
+		layer.Features[0].Feature.Name = "modified"
+	}
+	layer, err = datastore.FindLayer("layer-2", true, false)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "web", layer.Labels["team"])
+		assert.Equal(t, "debian:7", layer.Namespace.Name)
+		for _, featureVersion := range layer.Features {
+			assert.NotEqual(t, "modified", featureVersion.Feature.Name)
+		}
+	}
+
+	vulnerability, err := datastore.FindVulnerability("debian:7", "CVE-OPENSSL-1-DEB7")
+	if assert.Nil(t, err) {
+		vulnerability.FixedIn[0].Version = "3.0"
+	}
+	vulnerability, err = datastore.FindVulnerability("debian:7", "CVE-OPENSSL-1-DEB7")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "2.0", vulnerability.FixedIn[0].Version)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// insertNamespace returns the stored Namespace with the name of the given one, storing it first if
+// necessary.
+func (db *memory) insertNamespace(namespace database.Namespace) (database.Namespace, error) {
+	if namespace.Name == "" {
+		return namespace, cerrors.NewBadRequestError("could not find/insert invalid Namespace")
+	}
+
+	stored, ok := db.namespaces[namespace.Name]
+	if !ok {
+		stored = &database.Namespace{
+			Model:         database.Model{ID: db.nextID()},
+			Name:          namespace.Name,
+			VersionFormat: namespace.VersionFormat,
+		}
+		db.namespaces[namespace.Name] = stored
+	}
+	return *stored, nil
+}
+
+func (db *memory) ListNamespaces() ([]database.Namespace, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.listNamespaces(func(database.Namespace) bool { return true }), nil
+}
+
+func (db *memory) ListUnusedNamespaces() ([]database.Namespace, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.listNamespaces(func(namespace database.Namespace) bool {
+		return !db.namespaceInUse(namespace.Name)
+	}), nil
+}
+
+// listNamespaces returns the Namespaces for which keep returns true, ordered by ID.
+func (db *memory) listNamespaces(keep func(database.Namespace) bool) []database.Namespace {
+	byID := make(map[int]database.Namespace)
+	var ids []int
+	for _, namespace := range db.namespaces {
+		if keep(*namespace) {
+			byID[namespace.ID] = *namespace
+			ids = append(ids, namespace.ID)
+		}
+	}
+	sort.Ints(ids)
+
+	var namespaces []database.Namespace
+	for _, id := range ids {
+		namespaces = append(namespaces, byID[id])
+	}
+	return namespaces
+}
+
+// namespaceInUse returns whether a Layer is detected in the given Namespace or has FeatureVersions
+// of it.
+func (db *memory) namespaceInUse(name string) bool {
+	for _, layer := range db.layers {
+		if layer.namespace == name {
+			return true
+		}
+		for _, fv := range layer.features {
+			if fv.Feature.Namespace.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PruneNamespace removes every revision of the vulnerabilities of an unused Namespace, along with
+// their notifications. The datastore doesn't store Features and FeatureVersions on their own, so
+// there are none to remove, and the reclaimed space isn't measured.
+func (db *memory) PruneNamespace(name string) (database.PrunedNamespace, error) {
+	var pruned database.PrunedNamespace
+	if name == "" {
+		return pruned, cerrors.NewBadRequestError("could not prune an empty namespace")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.namespaces[name]; !ok {
+		return pruned, cerrors.ErrNotFound
+	}
+	if db.namespaceInUse(name) {
+		return pruned, database.ErrNamespaceInUse
+	}
+
+	pruned.Vulnerabilities = db.removeRevisions(name)
+	return pruned, nil
+}
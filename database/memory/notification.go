@@ -0,0 +1,271 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"time"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+// notification is a stored VulnerabilityNotification, which references the revisions of its
+// Vulnerability by identifier.
+type notification struct {
+	database.VulnerabilityNotification
+
+	oldID, newID int
+	deliveries   []*database.NotificationDelivery
+}
+
+// createNotification creates the notification of a change of a vulnerability.
+func (db *memory) createNotification(oldVulnerabilityID, newVulnerabilityID int, priority types.Priority) {
+	n := &notification{oldID: oldVulnerabilityID, newID: newVulnerabilityID}
+	n.ID = db.nextID()
+	n.Name = database.NewNotificationName()
+	n.Created = time.Now().UTC()
+	n.Priority = priority
+	n.Reason = database.NotificationReasonOf(db.revisions[oldVulnerabilityID], db.revisions[newVulnerabilityID])
+	db.notifications[n.Name] = n
+}
+
+// vulnerabilityKey returns the key of the Vulnerability whose change is notified.
+func (n *notification) vulnerabilityKey(db *memory) vulnerabilityKey {
+	id := n.newID
+	if id == 0 {
+		id = n.oldID
+	}
+	revision := db.revisions[id]
+	return vulnerabilityKey{revision.Namespace.Name, revision.Name}
+}
+
+// GetAvailableNotification returns one available notification name (!locked && !deleted &&
+// (!notified || notified_but_timed-out)) and locks it for the given owner. Notifications with the
+// highest priority are returned first, the oldest first amongst them. It does not fill the
+// vulnerabilities.
+func (db *memory) GetAvailableNotification(renotifyInterval time.Duration, owner string, lockDuration time.Duration) (database.VulnerabilityNotification, error) {
+	if owner == "" || lockDuration <= 0 {
+		log.Warning("could not claim a notification with an invalid lock")
+		return database.VulnerabilityNotification{}, cerrors.NewBadRequestError("could not claim a notification with an invalid lock")
+	}
+
+	// The notification is searched and locked atomically.
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	// The notifications of a vulnerability that has older pending notifications are skipped, so
+	// that the changes of a vulnerability are delivered in creation order, unless the older ones
+	// failed.
+	oldestPending := make(map[vulnerabilityKey]int)
+	for _, n := range db.notifications {
+		if n.Notified.IsZero() && n.Deleted.IsZero() && n.Failed.IsZero() {
+			key := n.vulnerabilityKey(db)
+			if id, ok := oldestPending[key]; !ok || n.ID < id {
+				oldestPending[key] = n.ID
+			}
+		}
+	}
+
+	var available *notification
+	for _, n := range db.notifications {
+		if !n.Deleted.IsZero() || (!n.Notified.IsZero() && !n.Notified.Before(now.Add(-renotifyInterval))) {
+			continue
+		}
+		if !n.Failed.IsZero() && !n.Failed.Before(now.Add(-renotifyInterval)) {
+			continue
+		}
+		if lock, ok := db.locks[n.Name]; ok && lock.until.After(now) {
+			continue
+		}
+		if id, ok := oldestPending[n.vulnerabilityKey(db)]; ok && id < n.ID {
+			continue
+		}
+
+		if available != nil {
+			cmp := n.Priority.Compare(available.Priority)
+			if cmp < 0 || (cmp == 0 && n.ID > available.ID) {
+				continue
+			}
+		}
+		available = n
+	}
+	if available == nil {
+		return database.VulnerabilityNotification{}, cerrors.ErrNotFound
+	}
+	db.locks[available.Name] = lock{owner: owner, until: time.Now().Add(lockDuration)}
+
+	return available.VulnerabilityNotification, nil
+}
+
+// ExtendNotificationLock renews the lock of a notification if the given owner still holds it.
+func (db *memory) ExtendNotificationLock(name, owner string, duration time.Duration) (bool, time.Time) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	until := time.Now().Add(duration)
+	existing, ok := db.locks[name]
+	if !ok || existing.owner != owner {
+		return false, until
+	}
+	db.locks[name] = lock{owner: owner, until: until}
+
+	return true, until
+}
+
+// ReleaseNotificationLock unlocks a notification if the given owner holds its lock.
+func (db *memory) ReleaseNotificationLock(name, owner string) {
+	db.Unlock(name, owner)
+}
+
+func (db *memory) GetNotification(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	n, ok := db.notifications[name]
+	if !ok {
+		return database.VulnerabilityNotification{}, page, cerrors.ErrNotFound
+	}
+
+	notification := n.VulnerabilityNotification
+	if n.oldID != 0 {
+		vulnerability := copyVulnerability(db.revisions[n.oldID], true)
+		notification.OldVulnerability = &vulnerability
+	}
+	if n.newID != 0 {
+		vulnerability := copyVulnerability(db.revisions[n.newID], true)
+		notification.NewVulnerability = &vulnerability
+	}
+
+	// Load vulnerabilities' LayersIntroducingVulnerability.
+	page.OldVulnerability = db.loadLayersIntroducingVulnerability(notification.OldVulnerability, limit, page.OldVulnerability)
+	page.NewVulnerability = db.loadLayersIntroducingVulnerability(notification.NewVulnerability, limit, page.NewVulnerability)
+
+	return notification, page, nil
+}
+
+// loadLayersIntroducingVulnerability fills Vulnerability.LayersIntroducingVulnerability.
+// limit -1: won't do anything
+// limit 0: will just get the startID of the second page
+func (db *memory) loadLayersIntroducingVulnerability(vulnerability *database.Vulnerability, limit, startID int) int {
+	// A startID equals to -1 means that we reached the end already.
+	if vulnerability == nil || startID == -1 || limit == -1 {
+		return -1
+	}
+
+	nextID := -1
+	for _, name := range db.layersIntroducingVulnerability(*vulnerability) {
+		layer := db.layers[name]
+		if layer.id < startID {
+			continue
+		}
+		if len(vulnerability.LayersIntroducingVulnerability) == limit {
+			nextID = layer.id
+			break
+		}
+
+		vulnerability.LayersIntroducingVulnerability = append(vulnerability.LayersIntroducingVulnerability, database.Layer{
+			Model:  database.Model{ID: layer.id},
+			Name:   layer.name,
+			Labels: copyLabels(layer.labels),
+		})
+	}
+
+	return nextID
+}
+
+// layersIntroducingVulnerability returns the names of the layers, ordered by ID, that add a
+// FeatureVersion affected by the given revision of a Vulnerability.
+func (db *memory) layersIntroducingVulnerability(vulnerability database.Vulnerability) []string {
+	fixedIn := make(map[string]string)
+	for _, fv := range vulnerability.FixedIn {
+		fixedIn[fv.Feature.Name] = fv.Version
+	}
+
+	introducing := make(map[string]struct{})
+	for _, layer := range db.layers {
+		for _, fv := range layer.features {
+			fixedInVersion, ok := fixedIn[fv.Feature.Name]
+			if !ok || fv.AddedBy.ID != layer.id || fv.Feature.Namespace.Name != vulnerability.Namespace.Name {
+				continue
+			}
+
+			cmp, err := versionfmt.Compare(vulnerability.Namespace.VersionFormat, fv.Version, fixedInVersion)
+			if err != nil {
+				log.Warningf("could not compare %s with %s: %s", fv.Version, fixedInVersion, err)
+				continue
+			}
+			if cmp < 0 {
+				introducing[layer.name] = struct{}{}
+				break
+			}
+		}
+	}
+
+	return db.sortLayerNames(introducing)
+}
+
+// notificationAffectedLayers returns the names of the layers introducing the old or the new
+// Vulnerability of a Notification, and of every layer based on these, ordered by ID.
+func (db *memory) notificationAffectedLayers(name string) ([]string, error) {
+	n, ok := db.notifications[name]
+	if !ok {
+		return nil, cerrors.ErrNotFound
+	}
+
+	var introducing []string
+	for _, id := range []int{n.oldID, n.newID} {
+		if id != 0 {
+			introducing = append(introducing, db.layersIntroducingVulnerability(*db.revisions[id])...)
+		}
+	}
+	return db.descendants(introducing), nil
+}
+
+func (db *memory) SetNotificationNotified(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if n, ok := db.notifications[name]; ok {
+		n.Notified = time.Now().UTC()
+		n.Failed = time.Time{}
+	}
+	return nil
+}
+
+func (db *memory) SetNotificationFailed(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if n, ok := db.notifications[name]; ok {
+		n.Failed = time.Now().UTC()
+	}
+	return nil
+}
+
+func (db *memory) DeleteNotification(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n, ok := db.notifications[name]
+	if !ok {
+		return cerrors.ErrNotFound
+	}
+	n.Deleted = time.Now().UTC()
+	return nil
+}
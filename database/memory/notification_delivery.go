@@ -0,0 +1,149 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertNotificationDelivery finds or creates the outbox entry of a notification for the given
+// notifier.
+func (db *memory) InsertNotificationDelivery(notificationName, notifier string) (database.NotificationDelivery, error) {
+	if notificationName == "" || notifier == "" {
+		return database.NotificationDelivery{}, cerrors.NewBadRequestError("could not insert a notification delivery which has an empty notification or notifier name")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n, ok := db.notifications[notificationName]
+	if !ok {
+		return database.NotificationDelivery{}, cerrors.ErrNotFound
+	}
+
+	for _, delivery := range n.deliveries {
+		if delivery.Notifier != notifier {
+			continue
+		}
+
+		// Reopen the delivery if it has been completed during a previous round, so the receivers
+		// see a new key for what is an intended renotification.
+		if !delivery.Delivered.IsZero() && !n.Notified.IsZero() && !delivery.Delivered.After(n.Notified) {
+			delivery.Key = uuid.New()
+			delivery.Delivered = time.Time{}
+		}
+		return copyDelivery(delivery, false), nil
+	}
+
+	delivery := &database.NotificationDelivery{
+		Model:    database.Model{ID: db.nextID()},
+		Notifier: notifier,
+		Key:      uuid.New(),
+		Created:  time.Now().UTC(),
+	}
+	n.deliveries = append(n.deliveries, delivery)
+	return copyDelivery(delivery, false), nil
+}
+
+// InsertNotificationDeliveryAttempt records an attempt and, when it succeeded, completes the
+// delivery atomically.
+func (db *memory) InsertNotificationDeliveryAttempt(delivery database.NotificationDelivery, succeeded bool, message string) error {
+	if delivery.ID == 0 {
+		return cerrors.NewBadRequestError("could not insert an attempt for an unknown notification delivery")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, n := range db.notifications {
+		for _, stored := range n.deliveries {
+			if stored.ID != delivery.ID {
+				continue
+			}
+
+			attempt := database.NotificationDeliveryAttempt{
+				Model:     database.Model{ID: db.nextID()},
+				Attempted: time.Now().UTC(),
+				Succeeded: succeeded,
+				Error:     message,
+			}
+			stored.Attempts = append(stored.Attempts, attempt)
+			if succeeded && stored.Delivered.IsZero() {
+				stored.Delivered = attempt.Attempted
+			}
+			return nil
+		}
+	}
+
+	return cerrors.ErrNotFound
+}
+
+// ListNotificationDeliveries returns the outbox entries of a notification and their attempts.
+func (db *memory) ListNotificationDeliveries(notificationName string) ([]database.NotificationDelivery, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var deliveries []database.NotificationDelivery
+	if n, ok := db.notifications[notificationName]; ok {
+		for _, delivery := range n.deliveries {
+			deliveries = append(deliveries, copyDelivery(delivery, true))
+		}
+	}
+	return deliveries, nil
+}
+
+// copyDelivery returns a copy of a stored delivery, with or without its attempts.
+func copyDelivery(delivery *database.NotificationDelivery, withAttempts bool) database.NotificationDelivery {
+	c := *delivery
+	c.Attempts = nil
+	if withAttempts {
+		c.Attempts = append(c.Attempts, delivery.Attempts...)
+	}
+	return c
+}
+
+// ListUndeliveredNotifications returns the notifications marked as notified whose delivery via the
+// given notifier is still open.
+func (db *memory) ListUndeliveredNotifications(notifier string) ([]database.VulnerabilityNotification, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	undelivered := make(map[int]database.VulnerabilityNotification)
+	var ids []int
+	for _, n := range db.notifications {
+		if n.Notified.IsZero() || !n.Deleted.IsZero() {
+			continue
+		}
+		for _, delivery := range n.deliveries {
+			if delivery.Notifier == notifier && delivery.Delivered.IsZero() {
+				undelivered[n.ID] = n.VulnerabilityNotification
+				ids = append(ids, n.ID)
+			}
+		}
+	}
+	sort.Ints(ids)
+
+	var notifications []database.VulnerabilityNotification
+	for _, id := range ids {
+		notifications = append(notifications, undelivered[id])
+	}
+	return notifications, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertProvenance stores the provenance of an image, or returns the stored one if the same
+// statement is already stored for the image.
+func (db *memory) InsertProvenance(provenance database.Provenance) (database.Provenance, error) {
+	if provenance.Digest == "" || provenance.Statement == "" {
+		return provenance, cerrors.NewBadRequestError("could not insert a provenance which does not have a digest and a statement")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, existing := range db.provenances {
+		if existing.Digest == provenance.Digest && existing.Statement == provenance.Statement {
+			return existing, nil
+		}
+	}
+
+	provenance.ID = db.nextID()
+	provenance.Name = uuid.New()
+	provenance.Created = time.Now().UTC()
+	db.provenances = append(db.provenances, provenance)
+	return provenance, nil
+}
+
+// FindProvenances returns the provenances of an image.
+func (db *memory) FindProvenances(digest string) ([]database.Provenance, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var provenances []database.Provenance
+	for _, provenance := range db.provenances {
+		if provenance.Digest == digest {
+			provenances = append(provenances, provenance)
+		}
+	}
+	return provenances, nil
+}
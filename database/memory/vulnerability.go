@@ -0,0 +1,373 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func (db *memory) ListVulnerabilities(namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	ids, err := db.namespaceVulnerabilities(namespaceName)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	ids, nextID := paginate(ids, limit, startID)
+	var vulnerabilities []database.Vulnerability
+	for _, id := range ids {
+		vulnerabilities = append(vulnerabilities, copyVulnerability(db.revisions[id], false))
+	}
+	return vulnerabilities, nextID, nil
+}
+
+// StreamVulnerabilities copies the vulnerabilities of the namespace before calling fn with them, so
+// that fn can use the datastore.
+func (db *memory) StreamVulnerabilities(namespaceName string, fn func(database.Vulnerability) error) error {
+	db.mu.RLock()
+	ids, err := db.namespaceVulnerabilities(namespaceName)
+	vulnerabilities := make([]database.Vulnerability, 0, len(ids))
+	for _, id := range ids {
+		vulnerabilities = append(vulnerabilities, copyVulnerability(db.revisions[id], true))
+	}
+	db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, vulnerability := range vulnerabilities {
+		if err := fn(vulnerability); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namespaceVulnerabilities returns the identifiers of the latest revisions of the vulnerabilities
+// of a Namespace, in increasing order.
+func (db *memory) namespaceVulnerabilities(namespaceName string) ([]int, error) {
+	if _, ok := db.namespaces[namespaceName]; !ok {
+		return nil, cerrors.ErrNotFound
+	}
+
+	var ids []int
+	for key, id := range db.latest {
+		if key.namespace == namespaceName {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (db *memory) FindVulnerability(namespaceName, name string) (database.Vulnerability, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	id, ok := db.latest[vulnerabilityKey{namespaceName, name}]
+	if !ok {
+		return database.Vulnerability{}, cerrors.ErrNotFound
+	}
+	return copyVulnerability(db.revisions[id], true), nil
+}
+
+// copyVulnerability returns a copy of a revision of a Vulnerability, that doesn't share anything
+// with the stored one, with or without its FixedIn list.
+func copyVulnerability(revision *database.Vulnerability, withFixedIn bool) database.Vulnerability {
+	vulnerability := *revision
+	vulnerability.Metadata = castMetadata(revision.Metadata)
+	vulnerability.Sources = copySources(revision.Sources)
+	vulnerability.CVSS = copyCVSS(revision.CVSS)
+	vulnerability.FixedIn = nil
+	if withFixedIn {
+		for _, fv := range revision.FixedIn {
+			vulnerability.FixedIn = append(vulnerability.FixedIn, database.FeatureVersion{
+				Feature: database.Feature{Name: fv.Feature.Name, Namespace: revision.Namespace},
+				Version: fv.Version,
+			})
+		}
+	}
+	return vulnerability
+}
+
+// castMetadata returns a deep copy of the given metadata, as it would be read back from a database
+// storing it as JSON.
+func castMetadata(m database.MetadataMap) database.MetadataMap {
+	if m == nil {
+		return nil
+	}
+	c := make(database.MetadataMap)
+	j, _ := json.Marshal(m)
+	json.Unmarshal(j, &c)
+	return c
+}
+
+func copySources(sources database.VulnerabilitySources) database.VulnerabilitySources {
+	if len(sources) == 0 {
+		return nil
+	}
+	return append(database.VulnerabilitySources{}, sources...)
+}
+
+func copyCVSS(cvss database.VulnerabilityCVSS) database.VulnerabilityCVSS {
+	if cvss.V2 != nil {
+		v2 := *cvss.V2
+		cvss.V2 = &v2
+	}
+	if cvss.V3 != nil {
+		v3 := *cvss.V3
+		cvss.V3 = &v3
+	}
+	return cvss
+}
+
+func (db *memory) InsertVulnerabilities(vulnerabilities []database.Vulnerability, generateNotifications bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, vulnerability := range vulnerabilities {
+		if err := db.insertVulnerability(vulnerability, false, generateNotifications); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertVulnerability stores a new revision of a vulnerability, unless nothing changed. When
+// onlyFixedIn is true, only the FixedIn list of the given vulnerability is used, to update the one
+// of an existing vulnerability.
+func (db *memory) insertVulnerability(vulnerability database.Vulnerability, onlyFixedIn, generateNotification bool) error {
+	// Verify parameters
+	if vulnerability.Name == "" || vulnerability.Namespace.Name == "" {
+		return cerrors.NewBadRequestError("insertVulnerability needs at least the Name and the Namespace")
+	}
+	if !onlyFixedIn && !vulnerability.Severity.IsValid() {
+		msg := fmt.Sprintf("could not insert a vulnerability that has an invalid Severity: %s", vulnerability.Severity)
+		log.Warning(msg)
+		return cerrors.NewBadRequestError(msg)
+	}
+	for i := 0; i < len(vulnerability.FixedIn); i++ {
+		fifv := &vulnerability.FixedIn[i]
+
+		if fifv.Feature.Namespace.Name == "" {
+			// As there is no Namespace on that FixedIn FeatureVersion, set it to the Vulnerability's
+			// Namespace.
+			fifv.Feature.Namespace.Name = vulnerability.Namespace.Name
+		} else if fifv.Feature.Namespace.Name != vulnerability.Namespace.Name {
+			msg := "could not insert an invalid vulnerability that contains FixedIn FeatureVersion that are not in the same namespace as the Vulnerability"
+			log.Warning(msg)
+			return cerrors.NewBadRequestError(msg)
+		}
+	}
+
+	// Find the existing vulnerability.
+	key := vulnerabilityKey{vulnerability.Namespace.Name, vulnerability.Name}
+	existingID, exists := db.latest[key]
+	var existing database.Vulnerability
+	if exists {
+		existing = *db.revisions[existingID]
+	}
+
+	if onlyFixedIn {
+		// Because this call tries to update FixedIn FeatureVersion, import all other data from the
+		// existing one.
+		if !exists {
+			return cerrors.ErrNotFound
+		}
+
+		fixedIn := vulnerability.FixedIn
+		vulnerability = copyVulnerability(&existing, false)
+		vulnerability.FixedIn = fixedIn
+	}
+
+	if exists {
+		updateMetadata := vulnerability.Description != existing.Description ||
+			vulnerability.Link != existing.Link ||
+			vulnerability.Severity != existing.Severity ||
+			!reflect.DeepEqual(castMetadata(vulnerability.Metadata), existing.Metadata) ||
+			!reflect.DeepEqual(copySources(vulnerability.Sources), existing.Sources) ||
+			!reflect.DeepEqual(vulnerability.CVSS, existing.CVSS)
+
+		// Construct the entire list of FixedIn FeatureVersion, by using the
+		// the FixedIn list of the old vulnerability.
+		var updateFixedIn bool
+		vulnerability.FixedIn, updateFixedIn = database.ApplyFixedInDiff(existing.FixedIn, vulnerability.FixedIn)
+
+		if !updateMetadata && !updateFixedIn {
+			return nil
+		}
+	} else {
+		// The vulnerability is new, we don't want to have any types.MinVersion as they are only used
+		// for diffing existing vulnerabilities.
+		var fixedIn []database.FeatureVersion
+		for _, fv := range vulnerability.FixedIn {
+			if fv.Version != versionfmt.MinVersion {
+				fixedIn = append(fixedIn, fv)
+			}
+		}
+		vulnerability.FixedIn = fixedIn
+	}
+
+	// Store the new revision, which refers to the stored Namespace.
+	namespace, err := db.insertNamespace(vulnerability.Namespace)
+	if err != nil {
+		return err
+	}
+	revision := copyVulnerability(&vulnerability, false)
+	revision.ID = db.nextID()
+	revision.Namespace = namespace
+	revision.FixedBy = ""
+	revision.LayersIntroducingVulnerability = nil
+	for _, fv := range vulnerability.FixedIn {
+		revision.FixedIn = append(revision.FixedIn, database.FeatureVersion{
+			Feature: database.Feature{Name: fv.Feature.Name, Namespace: namespace},
+			Version: fv.Version,
+		})
+	}
+	sort.Sort(byFeatureName(revision.FixedIn))
+	db.revisions[revision.ID] = &revision
+	db.setLatest(key, revision.ID)
+
+	// Create a notification.
+	if generateNotification {
+		priority := database.NotificationPriority(existing.Severity, revision.Severity)
+		db.createNotification(existing.ID, revision.ID, priority)
+	}
+
+	return nil
+}
+
+// setLatest makes the revision with the given identifier the latest one of a vulnerability, or
+// deletes the vulnerability if the identifier is 0, and indexes its fixes.
+func (db *memory) setLatest(key vulnerabilityKey, id int) {
+	if previousID, ok := db.latest[key]; ok {
+		for _, fv := range db.revisions[previousID].FixedIn {
+			delete(db.fixes[featureKey{key.namespace, fv.Feature.Name}], previousID)
+		}
+		delete(db.latest, key)
+	}
+	if id == 0 {
+		return
+	}
+
+	db.latest[key] = id
+	for _, fv := range db.revisions[id].FixedIn {
+		fk := featureKey{key.namespace, fv.Feature.Name}
+		if db.fixes[fk] == nil {
+			db.fixes[fk] = make(map[int]struct{})
+		}
+		db.fixes[fk][id] = struct{}{}
+	}
+}
+
+// removeRevisions removes every revision of the vulnerabilities of a Namespace along with their
+// notifications, and returns the number of revisions that have been removed.
+func (db *memory) removeRevisions(namespaceName string) int {
+	for key := range db.latest {
+		if key.namespace == namespaceName {
+			db.setLatest(key, 0)
+		}
+	}
+
+	removed := make(map[int]struct{})
+	for id, revision := range db.revisions {
+		if revision.Namespace.Name == namespaceName {
+			removed[id] = struct{}{}
+			delete(db.revisions, id)
+		}
+	}
+	for name, notification := range db.notifications {
+		_, oldRemoved := removed[notification.oldID]
+		_, newRemoved := removed[notification.newID]
+		if oldRemoved || newRemoved {
+			delete(db.notifications, name)
+		}
+	}
+
+	return len(removed)
+}
+
+// byFeatureName sorts FixedIn lists, so they don't depend on the order of the maps.
+type byFeatureName []database.FeatureVersion
+
+func (s byFeatureName) Len() int           { return len(s) }
+func (s byFeatureName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byFeatureName) Less(i, j int) bool { return s[i].Feature.Name < s[j].Feature.Name }
+
+func (db *memory) InsertVulnerabilityFixes(vulnerabilityNamespace, vulnerabilityName string, fixes []database.FeatureVersion) error {
+	v := database.Vulnerability{
+		Name: vulnerabilityName,
+		Namespace: database.Namespace{
+			Name: vulnerabilityNamespace,
+		},
+		FixedIn: fixes,
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.insertVulnerability(v, true, true)
+}
+
+func (db *memory) DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerabilityName, featureName string) error {
+	v := database.Vulnerability{
+		Name: vulnerabilityName,
+		Namespace: database.Namespace{
+			Name: vulnerabilityNamespace,
+		},
+		FixedIn: []database.FeatureVersion{
+			{
+				Feature: database.Feature{
+					Name: featureName,
+					Namespace: database.Namespace{
+						Name: vulnerabilityNamespace,
+					},
+				},
+				Version: versionfmt.MinVersion,
+			},
+		},
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.insertVulnerability(v, true, true)
+}
+
+// DeleteVulnerability keeps the last revision of the vulnerability, which the notification refers
+// to.
+func (db *memory) DeleteVulnerability(namespaceName, name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := vulnerabilityKey{namespaceName, name}
+	id, ok := db.latest[key]
+	if !ok {
+		return cerrors.ErrNotFound
+	}
+
+	db.setLatest(key, 0)
+	db.createNotification(id, 0, db.revisions[id].Severity)
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// ArchiveVulnerabilities archives the latest revision of every vulnerability of a Namespace, which
+// replaces the previously archived vulnerabilities with the same names, and removes all their
+// revisions.
+func (db *memory) ArchiveVulnerabilities(namespaceName string) (int, error) {
+	if namespaceName == "" {
+		return 0, cerrors.NewBadRequestError("could not archive the vulnerabilities of an empty namespace")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.namespaces[namespaceName]; !ok {
+		return 0, cerrors.ErrNotFound
+	}
+
+	for key, id := range db.latest {
+		if key.namespace == namespaceName {
+			db.archived[key] = copyVulnerability(db.revisions[id], true)
+		}
+	}
+	return db.removeRevisions(namespaceName), nil
+}
+
+func (db *memory) ListArchivedVulnerabilities(namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, ok := db.namespaces[namespaceName]; !ok {
+		return nil, -1, cerrors.ErrNotFound
+	}
+
+	archived := make(map[int]database.Vulnerability)
+	var ids []int
+	for key, vulnerability := range db.archived {
+		if key.namespace == namespaceName {
+			archived[vulnerability.ID] = vulnerability
+			ids = append(ids, vulnerability.ID)
+		}
+	}
+	sort.Ints(ids)
+
+	ids, nextID := paginate(ids, limit, startID)
+	var vulnerabilities []database.Vulnerability
+	for _, id := range ids {
+		vulnerability := archived[id]
+		vulnerabilities = append(vulnerabilities, copyVulnerability(&vulnerability, false))
+	}
+	return vulnerabilities, nextID, nil
+}
+
+func (db *memory) FindArchivedVulnerability(namespaceName, name string) (database.Vulnerability, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	vulnerability, ok := db.archived[vulnerabilityKey{namespaceName, name}]
+	if !ok {
+		return database.Vulnerability{}, cerrors.ErrNotFound
+	}
+	return copyVulnerability(&vulnerability, true), nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertWatchedTag starts watching a tag, or returns the existing WatchedTag.
+func (db *memory) InsertWatchedTag(watchedTag database.WatchedTag) (database.WatchedTag, error) {
+	if watchedTag.Registry == "" || watchedTag.Repository == "" || watchedTag.Tag == "" {
+		return watchedTag, cerrors.NewBadRequestError("could not insert a watched tag which does not have a registry, a repository and a tag")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, existing := range db.watchedTags {
+		if existing.Registry == watchedTag.Registry && existing.Repository == watchedTag.Repository &&
+			existing.Tag == watchedTag.Tag {
+			return *existing, nil
+		}
+	}
+
+	stored := database.WatchedTag{
+		Model:      database.Model{ID: db.nextID()},
+		Name:       uuid.New(),
+		Registry:   watchedTag.Registry,
+		Repository: watchedTag.Repository,
+		Tag:        watchedTag.Tag,
+		Created:    time.Now().UTC(),
+	}
+	db.watchedTags[stored.Name] = &stored
+	return stored, nil
+}
+
+// FindWatchedTag retrieves a WatchedTag by its name.
+func (db *memory) FindWatchedTag(name string) (database.WatchedTag, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	watchedTag, ok := db.watchedTags[name]
+	if !ok {
+		return database.WatchedTag{}, cerrors.ErrNotFound
+	}
+	return *watchedTag, nil
+}
+
+// ListWatchedTags paginates over every watched tag.
+func (db *memory) ListWatchedTags(limit int, startID int) ([]database.WatchedTag, int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.pageWatchedTags(limit, func(watchedTag *database.WatchedTag) bool {
+		return watchedTag.ID >= startID
+	})
+}
+
+// ListMovedWatchedTags paginates over the watched tags that moved since their last report.
+func (db *memory) ListMovedWatchedTags(limit int, startID int) ([]database.WatchedTag, int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.pageWatchedTags(limit, func(watchedTag *database.WatchedTag) bool {
+		return watchedTag.ID >= startID && watchedTag.Digest != watchedTag.ReportedDigest
+	})
+}
+
+// pageWatchedTags returns the first limit watched tags for which keep returns true, ordered by ID,
+// and the ID of the next one or -1 if there is none.
+func (db *memory) pageWatchedTags(limit int, keep func(*database.WatchedTag) bool) ([]database.WatchedTag, int, error) {
+	watchedTags := db.listWatchedTags(keep)
+
+	nextID := -1
+	if len(watchedTags) > limit {
+		nextID = watchedTags[limit].ID
+		watchedTags = watchedTags[:limit]
+	}
+	return watchedTags, nextID, nil
+}
+
+// ListNotificationWatchedTags returns the watched tags whose image is affected by a notification.
+func (db *memory) ListNotificationWatchedTags(name string) ([]database.WatchedTag, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	layerNames, err := db.notificationAffectedLayers(name)
+	if err != nil || len(layerNames) == 0 {
+		return nil, err
+	}
+
+	affected := make(map[string]struct{})
+	for _, layerName := range layerNames {
+		affected[layerName] = struct{}{}
+	}
+	return db.listWatchedTags(func(watchedTag *database.WatchedTag) bool {
+		_, ok := affected[watchedTag.LayerName]
+		return ok
+	}), nil
+}
+
+// listWatchedTags returns the watched tags for which keep returns true, ordered by ID.
+func (db *memory) listWatchedTags(keep func(*database.WatchedTag) bool) []database.WatchedTag {
+	byID := make(map[int]database.WatchedTag)
+	var ids []int
+	for _, watchedTag := range db.watchedTags {
+		if keep(watchedTag) {
+			byID[watchedTag.ID] = *watchedTag
+			ids = append(ids, watchedTag.ID)
+		}
+	}
+	sort.Ints(ids)
+
+	var watchedTags []database.WatchedTag
+	for _, id := range ids {
+		watchedTags = append(watchedTags, byID[id])
+	}
+	return watchedTags
+}
+
+// UpdateWatchedTag stores the resolution of a watched tag.
+func (db *memory) UpdateWatchedTag(watchedTag database.WatchedTag) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.watchedTags[watchedTag.Name]
+	if !ok {
+		return cerrors.ErrNotFound
+	}
+
+	stored.Digest, stored.LayerName = watchedTag.Digest, watchedTag.LayerName
+	stored.Resolved, stored.Changed = watchedTag.Resolved, watchedTag.Changed
+	stored.Signature, stored.Attested, stored.Published = watchedTag.Signature, watchedTag.Attested, watchedTag.Published
+	if stored.ReportedDigest == "" {
+		// Resolving a tag for the first time isn't a move.
+		stored.ReportedDigest = watchedTag.Digest
+	}
+	return nil
+}
+
+// MarkWatchedTagReported sets the digest a watched tag pointed to when it was last reported.
+func (db *memory) MarkWatchedTagReported(name, digest string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.watchedTags[name]
+	if !ok {
+		return cerrors.ErrNotFound
+	}
+	stored.ReportedDigest = digest
+	return nil
+}
+
+// DeleteWatchedTag stops watching a tag.
+func (db *memory) DeleteWatchedTag(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.watchedTags[name]; !ok {
+		return cerrors.ErrNotFound
+	}
+	delete(db.watchedTags, name)
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+var (
+	promDatastoreQueryDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "clair_datastore_query_duration_seconds",
+		Help: "Time it takes to execute the methods of the datastore, by driver.",
+	}, []string{"driver", "method"})
+
+	promDatastoreErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clair_datastore_errors_total",
+		Help: "Number of errors that the methods of the datastore returned, by driver, except for the resources not found.",
+	}, []string{"driver", "method"})
+
+	promDatastoreLocksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clair_datastore_locks_total",
+		Help: "Number of attempts to acquire or renew the locks, by driver, lock name and result: acquired, contended, renewed or lost.",
+	}, []string{"driver", "name", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(promDatastoreQueryDurationSeconds)
+	prometheus.MustRegister(promDatastoreErrorsTotal)
+	prometheus.MustRegister(promDatastoreLocksTotal)
+}
+
+// metricsObserver exports the latency and the errors of the methods of a Datastore, and the
+// contention of its locks, labeled by its driver.
+type metricsObserver struct {
+	driver string
+}
+
+func (o metricsObserver) ObserveCall(method string, duration time.Duration, err error) {
+	promDatastoreQueryDurationSeconds.WithLabelValues(o.driver, method).Observe(duration.Seconds())
+	if err != nil && err != cerrors.ErrNotFound {
+		promDatastoreErrorsTotal.WithLabelValues(o.driver, method).Inc()
+	}
+}
+
+func (o metricsObserver) ObserveLock(name string, renew, locked bool) {
+	var result string
+	switch {
+	case locked && renew:
+		result = "renewed"
+	case locked:
+		result = "acquired"
+	case renew:
+		result = "lost"
+	default:
+		result = "contended"
+	}
+	promDatastoreLocksTotal.WithLabelValues(o.driver, name, result).Inc()
+}
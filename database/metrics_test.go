@@ -0,0 +1,68 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func TestMetricsObserver(t *testing.T) {
+	counter := func(c interface {
+		Write(*dto.Metric) error
+	}) float64 {
+		var metric dto.Metric
+		assert.Nil(t, c.Write(&metric))
+		return metric.GetCounter().GetValue()
+	}
+
+	var err error
+	locked := true
+	datastore := Observe(&MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (Layer, error) {
+			return Layer{Name: name}, err
+		},
+		FctLock: func(name string, owner string, duration time.Duration, renew bool) (bool, time.Time) {
+			return locked, time.Time{}
+		},
+	}, metricsObserver{driver: "test"})
+
+	// The results are passed through, and the errors counted unless the resource isn't found.
+	layer, _ := datastore.FindLayer("layer", false, false)
+	assert.Equal(t, "layer", layer.Name)
+	err = cerrors.ErrNotFound
+	_, err = datastore.FindLayer("layer", false, false)
+	assert.Equal(t, cerrors.ErrNotFound, err)
+	assert.Equal(t, 0.0, counter(promDatastoreErrorsTotal.WithLabelValues("test", "FindLayer")))
+	err = errors.New("connection refused")
+	datastore.FindLayer("layer", false, false)
+	assert.Equal(t, 1.0, counter(promDatastoreErrorsTotal.WithLabelValues("test", "FindLayer")))
+
+	// The locks are counted by result.
+	datastore.Lock("updater", "owner", time.Minute, false)
+	datastore.Lock("updater", "owner", time.Minute, true)
+	locked = false
+	datastore.Lock("updater", "other", time.Minute, false)
+	datastore.Lock("updater", "owner", time.Minute, true)
+	for _, result := range []string{"acquired", "renewed", "contended", "lost"} {
+		assert.Equal(t, 1.0, counter(promDatastoreLocksTotal.WithLabelValues("test", "updater", result)), result)
+	}
+}
@@ -14,32 +14,71 @@
 
 package database
 
-import "time"
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
 
 // MockDatastore implements Datastore and enables overriding each available method.
 // The default behavior of each method is to simply panic.
 type MockDatastore struct {
-	FctListNamespaces           func() ([]Namespace, error)
-	FctInsertLayer              func(Layer) error
-	FctFindLayer                func(name string, withFeatures, withVulnerabilities bool) (Layer, error)
-	FctDeleteLayer              func(name string) error
-	FctListVulnerabilities      func(namespaceName string, limit int, page int) ([]Vulnerability, int, error)
-	FctInsertVulnerabilities    func(vulnerabilities []Vulnerability, createNotification bool) error
-	FctFindVulnerability        func(namespaceName, name string) (Vulnerability, error)
-	FctDeleteVulnerability      func(namespaceName, name string) error
-	FctInsertVulnerabilityFixes func(vulnerabilityNamespace, vulnerabilityName string, fixes []FeatureVersion) error
-	FctDeleteVulnerabilityFix   func(vulnerabilityNamespace, vulnerabilityName, featureName string) error
-	FctGetAvailableNotification func(renotifyInterval time.Duration) (VulnerabilityNotification, error)
-	FctGetNotification          func(name string, limit int, page VulnerabilityNotificationPageNumber) (VulnerabilityNotification, VulnerabilityNotificationPageNumber, error)
-	FctSetNotificationNotified  func(name string) error
-	FctDeleteNotification       func(name string) error
-	FctInsertKeyValue           func(key, value string) error
-	FctGetKeyValue              func(key string) (string, error)
-	FctLock                     func(name string, owner string, duration time.Duration, renew bool) (bool, time.Time)
-	FctUnlock                   func(name, owner string)
-	FctFindLock                 func(name string) (string, time.Time, error)
-	FctPing                     func() bool
-	FctClose                    func()
+	FctListNamespaces                    func() ([]Namespace, error)
+	FctInsertLayer                       func(Layer) error
+	FctFindLayer                         func(name string, withFeatures, withVulnerabilities bool) (Layer, error)
+	FctDeleteLayer                       func(name string) error
+	FctListVulnerabilities               func(namespaceName string, limit int, page int) ([]Vulnerability, int, error)
+	FctStreamVulnerabilities             func(namespaceName string, fn func(Vulnerability) error) error
+	FctInsertVulnerabilities             func(vulnerabilities []Vulnerability, createNotification bool) error
+	FctFindVulnerability                 func(namespaceName, name string) (Vulnerability, error)
+	FctDeleteVulnerability               func(namespaceName, name string) error
+	FctInsertVulnerabilityFixes          func(vulnerabilityNamespace, vulnerabilityName string, fixes []FeatureVersion) error
+	FctDeleteVulnerabilityFix            func(vulnerabilityNamespace, vulnerabilityName, featureName string) error
+	FctArchiveVulnerabilities            func(namespaceName string) (int, error)
+	FctListArchivedVulnerabilities       func(namespaceName string, limit int, page int) ([]Vulnerability, int, error)
+	FctFindArchivedVulnerability         func(namespaceName, name string) (Vulnerability, error)
+	FctListUnusedNamespaces              func() ([]Namespace, error)
+	FctPruneNamespace                    func(name string) (PrunedNamespace, error)
+	FctGetAvailableNotification          func(renotifyInterval time.Duration, owner string, lockDuration time.Duration) (VulnerabilityNotification, error)
+	FctExtendNotificationLock            func(name, owner string, duration time.Duration) (bool, time.Time)
+	FctReleaseNotificationLock           func(name, owner string)
+	FctGetNotification                   func(name string, limit int, page VulnerabilityNotificationPageNumber) (VulnerabilityNotification, VulnerabilityNotificationPageNumber, error)
+	FctSetNotificationNotified           func(name string) error
+	FctSetNotificationFailed             func(name string) error
+	FctDeleteNotification                func(name string) error
+	FctInsertNotificationDelivery        func(notificationName, notifier string) (NotificationDelivery, error)
+	FctInsertNotificationDeliveryAttempt func(delivery NotificationDelivery, succeeded bool, message string) error
+	FctListNotificationDeliveries        func(notificationName string) ([]NotificationDelivery, error)
+	FctListUndeliveredNotifications      func(notifier string) ([]VulnerabilityNotification, error)
+	FctInsertFalsePositive               func(FalsePositive) (FalsePositive, error)
+	FctFindFalsePositives                func(vulnerabilities []Vulnerability) ([]FalsePositive, error)
+	FctListFalsePositives                func(limit int, page int) ([]FalsePositive, int, error)
+	FctDeleteFalsePositive               func(name string) error
+	FctInsertWatchedTag                  func(WatchedTag) (WatchedTag, error)
+	FctFindWatchedTag                    func(name string) (WatchedTag, error)
+	FctListWatchedTags                   func(limit int, page int) ([]WatchedTag, int, error)
+	FctUpdateWatchedTag                  func(WatchedTag) error
+	FctDeleteWatchedTag                  func(name string) error
+	FctListMovedWatchedTags              func(limit int, page int) ([]WatchedTag, int, error)
+	FctMarkWatchedTagReported            func(name, digest string) error
+	FctInsertLayerLabels                 func(name string, labels map[string]string) error
+	FctListLayers                        func(labels map[string]string, limit int, page int) ([]Layer, int, error)
+	FctListNotificationLabels            func(name string) ([]map[string]string, error)
+	FctListNotificationWatchedTags       func(name string) ([]WatchedTag, error)
+	FctInsertProvenance                  func(Provenance) (Provenance, error)
+	FctFindProvenances                   func(digest string) ([]Provenance, error)
+	FctInsertImage                       func(Image) error
+	FctFindImage                         func(digest string) (Image, error)
+	FctInsertLayerAnalysis               func(LayerAnalysis) error
+	FctFindLayerAnalysis                 func(digest string) (LayerAnalysis, error)
+	FctInsertKeyValue                    func(key, value string) error
+	FctGetKeyValue                       func(key string) (string, error)
+	FctLock                              func(name string, owner string, duration time.Duration, renew bool) (bool, time.Time)
+	FctUnlock                            func(name, owner string)
+	FctFindLock                          func(name string) (string, time.Time, error)
+	FctWithContext                       func(ctx context.Context) Datastore
+	FctHealth                            func(ctx context.Context) (HealthStatus, error)
+	FctClose                             func()
 }
 
 func (mds *MockDatastore) ListNamespaces() ([]Namespace, error) {
@@ -77,6 +116,13 @@ func (mds *MockDatastore) ListVulnerabilities(namespaceName string, limit int, p
 	panic("required mock function not implemented")
 }
 
+func (mds *MockDatastore) StreamVulnerabilities(namespaceName string, fn func(Vulnerability) error) error {
+	if mds.FctStreamVulnerabilities != nil {
+		return mds.FctStreamVulnerabilities(namespaceName, fn)
+	}
+	panic("required mock function not implemented")
+}
+
 func (mds *MockDatastore) InsertVulnerabilities(vulnerabilities []Vulnerability, createNotification bool) error {
 	if mds.FctInsertVulnerabilities != nil {
 		return mds.FctInsertVulnerabilities(vulnerabilities, createNotification)
@@ -112,9 +158,59 @@ func (mds *MockDatastore) DeleteVulnerabilityFix(vulnerabilityNamespace, vulnera
 	panic("required mock function not implemented")
 }
 
-func (mds *MockDatastore) GetAvailableNotification(renotifyInterval time.Duration) (VulnerabilityNotification, error) {
+func (mds *MockDatastore) ArchiveVulnerabilities(namespaceName string) (int, error) {
+	if mds.FctArchiveVulnerabilities != nil {
+		return mds.FctArchiveVulnerabilities(namespaceName)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListArchivedVulnerabilities(namespaceName string, limit int, page int) ([]Vulnerability, int, error) {
+	if mds.FctListArchivedVulnerabilities != nil {
+		return mds.FctListArchivedVulnerabilities(namespaceName, limit, page)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindArchivedVulnerability(namespaceName, name string) (Vulnerability, error) {
+	if mds.FctFindArchivedVulnerability != nil {
+		return mds.FctFindArchivedVulnerability(namespaceName, name)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListUnusedNamespaces() ([]Namespace, error) {
+	if mds.FctListUnusedNamespaces != nil {
+		return mds.FctListUnusedNamespaces()
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) PruneNamespace(name string) (PrunedNamespace, error) {
+	if mds.FctPruneNamespace != nil {
+		return mds.FctPruneNamespace(name)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) GetAvailableNotification(renotifyInterval time.Duration, owner string, lockDuration time.Duration) (VulnerabilityNotification, error) {
 	if mds.FctGetAvailableNotification != nil {
-		return mds.FctGetAvailableNotification(renotifyInterval)
+		return mds.FctGetAvailableNotification(renotifyInterval, owner, lockDuration)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ExtendNotificationLock(name, owner string, duration time.Duration) (bool, time.Time) {
+	if mds.FctExtendNotificationLock != nil {
+		return mds.FctExtendNotificationLock(name, owner, duration)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ReleaseNotificationLock(name, owner string) {
+	if mds.FctReleaseNotificationLock != nil {
+		mds.FctReleaseNotificationLock(name, owner)
+		return
 	}
 	panic("required mock function not implemented")
 }
@@ -133,12 +229,195 @@ func (mds *MockDatastore) SetNotificationNotified(name string) error {
 	panic("required mock function not implemented")
 }
 
+func (mds *MockDatastore) SetNotificationFailed(name string) error {
+	if mds.FctSetNotificationFailed != nil {
+		return mds.FctSetNotificationFailed(name)
+	}
+	panic("required mock function not implemented")
+}
+
 func (mds *MockDatastore) DeleteNotification(name string) error {
 	if mds.FctDeleteNotification != nil {
 		return mds.FctDeleteNotification(name)
 	}
 	panic("required mock function not implemented")
 }
+
+func (mds *MockDatastore) InsertNotificationDelivery(notificationName, notifier string) (NotificationDelivery, error) {
+	if mds.FctInsertNotificationDelivery != nil {
+		return mds.FctInsertNotificationDelivery(notificationName, notifier)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) InsertNotificationDeliveryAttempt(delivery NotificationDelivery, succeeded bool, message string) error {
+	if mds.FctInsertNotificationDeliveryAttempt != nil {
+		return mds.FctInsertNotificationDeliveryAttempt(delivery, succeeded, message)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListNotificationDeliveries(notificationName string) ([]NotificationDelivery, error) {
+	if mds.FctListNotificationDeliveries != nil {
+		return mds.FctListNotificationDeliveries(notificationName)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListUndeliveredNotifications(notifier string) ([]VulnerabilityNotification, error) {
+	if mds.FctListUndeliveredNotifications != nil {
+		return mds.FctListUndeliveredNotifications(notifier)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) InsertFalsePositive(falsePositive FalsePositive) (FalsePositive, error) {
+	if mds.FctInsertFalsePositive != nil {
+		return mds.FctInsertFalsePositive(falsePositive)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindFalsePositives(vulnerabilities []Vulnerability) ([]FalsePositive, error) {
+	if mds.FctFindFalsePositives != nil {
+		return mds.FctFindFalsePositives(vulnerabilities)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListFalsePositives(limit int, page int) ([]FalsePositive, int, error) {
+	if mds.FctListFalsePositives != nil {
+		return mds.FctListFalsePositives(limit, page)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) DeleteFalsePositive(name string) error {
+	if mds.FctDeleteFalsePositive != nil {
+		return mds.FctDeleteFalsePositive(name)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) InsertWatchedTag(watchedTag WatchedTag) (WatchedTag, error) {
+	if mds.FctInsertWatchedTag != nil {
+		return mds.FctInsertWatchedTag(watchedTag)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindWatchedTag(name string) (WatchedTag, error) {
+	if mds.FctFindWatchedTag != nil {
+		return mds.FctFindWatchedTag(name)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListWatchedTags(limit int, page int) ([]WatchedTag, int, error) {
+	if mds.FctListWatchedTags != nil {
+		return mds.FctListWatchedTags(limit, page)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) UpdateWatchedTag(watchedTag WatchedTag) error {
+	if mds.FctUpdateWatchedTag != nil {
+		return mds.FctUpdateWatchedTag(watchedTag)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) DeleteWatchedTag(name string) error {
+	if mds.FctDeleteWatchedTag != nil {
+		return mds.FctDeleteWatchedTag(name)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListMovedWatchedTags(limit int, page int) ([]WatchedTag, int, error) {
+	if mds.FctListMovedWatchedTags != nil {
+		return mds.FctListMovedWatchedTags(limit, page)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) MarkWatchedTagReported(name, digest string) error {
+	if mds.FctMarkWatchedTagReported != nil {
+		return mds.FctMarkWatchedTagReported(name, digest)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) InsertLayerLabels(name string, labels map[string]string) error {
+	if mds.FctInsertLayerLabels != nil {
+		return mds.FctInsertLayerLabels(name, labels)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListLayers(labels map[string]string, limit int, page int) ([]Layer, int, error) {
+	if mds.FctListLayers != nil {
+		return mds.FctListLayers(labels, limit, page)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListNotificationLabels(name string) ([]map[string]string, error) {
+	if mds.FctListNotificationLabels != nil {
+		return mds.FctListNotificationLabels(name)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListNotificationWatchedTags(name string) ([]WatchedTag, error) {
+	if mds.FctListNotificationWatchedTags != nil {
+		return mds.FctListNotificationWatchedTags(name)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) InsertProvenance(provenance Provenance) (Provenance, error) {
+	if mds.FctInsertProvenance != nil {
+		return mds.FctInsertProvenance(provenance)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindProvenances(digest string) ([]Provenance, error) {
+	if mds.FctFindProvenances != nil {
+		return mds.FctFindProvenances(digest)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) InsertImage(image Image) error {
+	if mds.FctInsertImage != nil {
+		return mds.FctInsertImage(image)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindImage(digest string) (Image, error) {
+	if mds.FctFindImage != nil {
+		return mds.FctFindImage(digest)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) InsertLayerAnalysis(analysis LayerAnalysis) error {
+	if mds.FctInsertLayerAnalysis != nil {
+		return mds.FctInsertLayerAnalysis(analysis)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindLayerAnalysis(digest string) (LayerAnalysis, error) {
+	if mds.FctFindLayerAnalysis != nil {
+		return mds.FctFindLayerAnalysis(digest)
+	}
+	panic("required mock function not implemented")
+}
+
 func (mds *MockDatastore) InsertKeyValue(key, value string) error {
 	if mds.FctInsertKeyValue != nil {
 		return mds.FctInsertKeyValue(key, value)
@@ -175,9 +454,16 @@ func (mds *MockDatastore) FindLock(name string) (string, time.Time, error) {
 	panic("required mock function not implemented")
 }
 
-func (mds *MockDatastore) Ping() bool {
-	if mds.FctPing != nil {
-		return mds.FctPing()
+func (mds *MockDatastore) WithContext(ctx context.Context) Datastore {
+	if mds.FctWithContext != nil {
+		return mds.FctWithContext(ctx)
+	}
+	return mds
+}
+
+func (mds *MockDatastore) Health(ctx context.Context) (HealthStatus, error) {
+	if mds.FctHealth != nil {
+		return mds.FctHealth(ctx)
 	}
 	panic("required mock function not implemented")
 }
@@ -35,6 +35,46 @@ type Layer struct {
 	Parent        *Layer
 	Namespace     *Namespace
 	Features      []FeatureVersion
+
+	// Labels are key/value pairs attached by clients, e.g. the team owning the image, used to
+	// filter and route.
+	Labels map[string]string
+
+	// Stats are the statistics of the analysis of the layer, zero if it was analyzed before Clair
+	// recorded them. The layers indexed with a cached LayerAnalysis have the ones of the analysis.
+	Stats LayerStats
+}
+
+// LayerStats are the statistics of the analysis of a Layer, which help planning the capacity of
+// Clair and spotting pathological images.
+type LayerStats struct {
+	// BytesRead is the size of the decompressed archive of the layer, and FilesInspected the
+	// number of its entries.
+	BytesRead      int64
+	FilesInspected int
+
+	// FilesMatched is the number of files extracted for the detectors, and BytesMatched their
+	// size.
+	FilesMatched int
+	BytesMatched int64
+
+	// Duration is the wall-clock time of the analysis, download included, and Detectors the time
+	// each features detector took, by name.
+	Duration  time.Duration
+	Detectors map[string]time.Duration `json:",omitempty"`
+}
+
+func (ls *LayerStats) Scan(value interface{}) error {
+	val, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(val, ls)
+}
+
+func (ls *LayerStats) Value() (driver.Value, error) {
+	json, err := json.Marshal(*ls)
+	return string(json), err
 }
 
 type Namespace struct {
@@ -44,6 +84,16 @@ type Namespace struct {
 	VersionFormat string
 }
 
+// PrunedNamespace describes what pruning an unused Namespace removed from the database.
+type PrunedNamespace struct {
+	Vulnerabilities int
+	Features        int
+	FeatureVersions int
+
+	// Bytes estimates the space that the removed rows occupied.
+	Bytes int64
+}
+
 type Feature struct {
 	Model
 
@@ -60,8 +110,21 @@ type FeatureVersion struct {
 
 	// For output purposes. Only make sense when the feature version is in the context of an image.
 	AddedBy Layer
+	// DetectedBy is the name of the FeaturesDetector that found the feature version in AddedBy.
+	DetectedBy string
+	// State is the state of the package in AddedBy according to its package manager, e.g.
+	// InstalledState or "config-files" for a removed dpkg package whose configuration files remain.
+	// It is empty when the FeaturesDetector doesn't know it.
+	State string
+	// Evidence are the paths of the executables and libraries installed by the package that are
+	// in the image, at the layer the feature version is in the context of. It is nil when unknown,
+	// and empty when they have all been removed.
+	Evidence []string
 }
 
+// InstalledState is the State of the fully installed packages.
+const InstalledState = "installed"
+
 type Vulnerability struct {
 	Model
 
@@ -74,6 +137,12 @@ type Vulnerability struct {
 
 	Metadata MetadataMap
 
+	// Sources lists the feeds that contributed to the Vulnerability.
+	Sources VulnerabilitySources
+
+	// CVSS holds the CVSS vectors and base scores of the Vulnerability, when they are known.
+	CVSS VulnerabilityCVSS
+
 	FixedIn                        []FeatureVersion
 	LayersIntroducingVulnerability []Layer
 
@@ -97,6 +166,203 @@ func (mm *MetadataMap) Value() (driver.Value, error) {
 	return string(json), err
 }
 
+// VulnerabilitySource describes a feed from which vulnerability data has been retrieved.
+//
+// Feeds come with different attribution and redistribution requirements: the License is the SPDX
+// identifier of the license of the feed, or empty when the feed doesn't specify one.
+type VulnerabilitySource struct {
+	Name    string
+	URL     string
+	License string `json:",omitempty"`
+}
+
+type VulnerabilitySources []VulnerabilitySource
+
+func (vs *VulnerabilitySources) Scan(value interface{}) error {
+	val, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(val, vs)
+}
+
+func (vs *VulnerabilitySources) Value() (driver.Value, error) {
+	json, err := json.Marshal(*vs)
+	return string(json), err
+}
+
+// VulnerabilityCVSS holds the vectors of the Common Vulnerability Scoring System v2 and v3 that
+// describe a Vulnerability, along with their base scores, which are finer than its Severity.
+type VulnerabilityCVSS struct {
+	V2 *types.CVSS `json:",omitempty"`
+	V3 *types.CVSS `json:",omitempty"`
+}
+
+// Score returns the base score of the most recent version of CVSS that describes the
+// Vulnerability, and false if there is none.
+func (vc VulnerabilityCVSS) Score() (float64, bool) {
+	if vc.V3 != nil {
+		return vc.V3.Score, true
+	}
+	if vc.V2 != nil {
+		return vc.V2.Score, true
+	}
+	return 0, false
+}
+
+func (vc *VulnerabilityCVSS) Scan(value interface{}) error {
+	val, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(val, vc)
+}
+
+func (vc *VulnerabilityCVSS) Value() (driver.Value, error) {
+	json, err := json.Marshal(*vc)
+	return string(json), err
+}
+
+// FalsePositive is the feedback of a user stating that a FeatureVersion isn't affected by a
+// Vulnerability of the same Namespace, even though its version matches.
+type FalsePositive struct {
+	Model
+
+	Name string
+
+	Namespace         Namespace
+	VulnerabilityName string
+	FeatureName       string
+	FeatureVersion    string
+
+	Reason  string
+	Created time.Time
+}
+
+// WatchedTag is a mutable tag of an image that Clair keeps indexed: the tag is resolved
+// periodically and the image it points to is indexed again whenever it changes.
+type WatchedTag struct {
+	Model
+
+	Name string
+
+	// Registry is the base URL of the registry, e.g. "https://registry.example.com".
+	Registry   string
+	Repository string
+	Tag        string
+
+	// Digest is the digest of the manifest the tag pointed to when it was last resolved, and
+	// LayerName the name of the top layer of that image, whose report is the one of the tag.
+	Digest    string
+	LayerName string
+
+	// ReportedDigest is the Digest the tag pointed to when its last move was reported. The tag
+	// moved since if they differ.
+	ReportedDigest string
+
+	// Signature is the result of the verification of the signatures of the image, empty if they
+	// haven't been verified.
+	Signature SignatureStatus
+
+	// Attested and Published identify the vulnerability reports of the image that were last
+	// attested and published to the registry, empty if none were.
+	Attested  string
+	Published string
+
+	Created time.Time
+	// Resolved is when the tag was last resolved, and Changed when its Digest last changed.
+	Resolved time.Time
+	Changed  time.Time
+}
+
+// Provenance is an in-toto statement attesting how an image was built, e.g. SLSA provenance.
+type Provenance struct {
+	Model
+
+	Name string
+
+	// Digest is the digest of the manifest of the image the statement is about.
+	Digest        string
+	PredicateType string
+	// BuilderID identifies the builder of the image, according to the statement.
+	BuilderID string
+	// Statement is the JSON statement.
+	Statement string
+
+	Created time.Time
+}
+
+// An Image maps the digest of the manifest of an image resolved by the tracker to the name of its
+// top layer, which identifies the chain of its layers.
+type Image struct {
+	Model
+
+	Digest    string
+	LayerName string
+
+	Created time.Time
+}
+
+// A LayerAnalysis is the result of the analysis of the blob of a layer, regardless of its parents,
+// which is content-addressed by its digest and is reused to index the layers having the same blob
+// as long as the engine and the detectors that analyzed it, which Version identifies, don't change.
+// Otherwise, the detectors that changed can be run again on the files retained with the analysis.
+type LayerAnalysis struct {
+	Digest  string
+	Version string
+	Result  LayerAnalysisResult
+
+	Created time.Time
+}
+
+// LayerAnalysisResult is what the detectors found in the blob of a layer.
+type LayerAnalysisResult struct {
+	Namespace *Namespace
+	Features  []FeatureVersion
+
+	// Deleted is the paths of the files of the parents deleted by the layer, when evidence is
+	// recorded.
+	Deleted []string `json:",omitempty"`
+
+	Stats LayerStats
+
+	// FeaturesDetectors and NamespaceDetectors are the fingerprints of the detectors that made the
+	// analysis, by name, which tell whose results can be reused.
+	FeaturesDetectors  map[string]string `json:",omitempty"`
+	NamespaceDetectors map[string]string `json:",omitempty"`
+
+	// Data is the files extracted from the blob for the detectors, by path, unless they were too
+	// big to be retained, and Extraction the fingerprint of their extraction.
+	Data       map[string][]byte `json:",omitempty"`
+	Extraction string            `json:",omitempty"`
+}
+
+func (r *LayerAnalysisResult) Scan(value interface{}) error {
+	val, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(val, r)
+}
+
+func (r *LayerAnalysisResult) Value() (driver.Value, error) {
+	json, err := json.Marshal(*r)
+	return string(json), err
+}
+
+// SignatureStatus is the result of the verification of the signatures of an image.
+type SignatureStatus string
+
+const (
+	// SignatureVerified is the status of the images signed by a trusted key.
+	SignatureVerified SignatureStatus = "verified"
+	// SignatureUnsigned is the status of the images that have no signature.
+	SignatureUnsigned SignatureStatus = "unsigned"
+	// SignatureUntrusted is the status of the images whose signatures are all invalid or made by
+	// keys that aren't trusted.
+	SignatureUntrusted SignatureStatus = "untrusted"
+)
+
 type VulnerabilityNotification struct {
 	Model
 
@@ -106,10 +372,50 @@ type VulnerabilityNotification struct {
 	Notified time.Time
 	Deleted  time.Time
 
+	// Failed is when the delivery of the Notification last gave up, after the maximum number of
+	// attempts, unless it has been marked as Notified since.
+	Failed time.Time
+
+	// Priority is the highest Severity of the old and new Vulnerabilities.
+	// Notifications with a higher Priority are delivered first.
+	Priority types.Priority
+
+	// Reason is the kind of change of the Vulnerability, as classified by NotificationReasonOf
+	// when the Notification was created. It is empty for older Notifications.
+	Reason NotificationReason
+
 	OldVulnerability *Vulnerability
 	NewVulnerability *Vulnerability
 }
 
+// NotificationDelivery is the outbox entry representing the delivery of a
+// VulnerabilityNotification via a specific notifier.
+//
+// The Key is stable across the attempts of a single delivery and is forwarded
+// to the receivers, which can use it to deduplicate deliveries that have been
+// retried after a crash.
+type NotificationDelivery struct {
+	Model
+
+	Notifier string
+	Key      string
+
+	Created   time.Time
+	Delivered time.Time
+
+	Attempts []NotificationDeliveryAttempt
+}
+
+// NotificationDeliveryAttempt records the outcome of a single attempt at
+// completing a NotificationDelivery.
+type NotificationDeliveryAttempt struct {
+	Model
+
+	Attempted time.Time
+	Succeeded bool
+	Error     string
+}
+
 type VulnerabilityNotificationPageNumber struct {
 	// -1 means that we reached the end already.
 	OldVulnerability int
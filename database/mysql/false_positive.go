@@ -0,0 +1,171 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertFalsePositive flags a finding as a false positive, or updates the reason of an existing
+// flag.
+func (db *mySQL) InsertFalsePositive(falsePositive database.FalsePositive) (database.FalsePositive, error) {
+	if falsePositive.Namespace.Name == "" || falsePositive.VulnerabilityName == "" ||
+		falsePositive.FeatureName == "" || falsePositive.FeatureVersion == "" {
+		return falsePositive, cerrors.NewBadRequestError("could not insert a false positive which does not identify a finding")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return falsePositive, handleError("InsertFalsePositive.Begin()", err)
+	}
+
+	namespaceID, err := insertNamespace(tx, falsePositive.Namespace)
+	if err != nil {
+		tx.Rollback()
+		return falsePositive, err
+	}
+	falsePositive.Namespace.ID = namespaceID
+
+	reason := falsePositive.Reason
+	existing, err := searchFalsePositives(tx, searchFalsePositiveByFinding, namespaceID,
+		falsePositive.VulnerabilityName, falsePositive.FeatureName, falsePositive.FeatureVersion)
+	if err != nil {
+		tx.Rollback()
+		return falsePositive, err
+	}
+
+	if len(existing) > 0 {
+		falsePositive = existing[0]
+		falsePositive.Reason = reason
+		if _, err = tx.Exec(updateFalsePositive, reason, falsePositive.ID); err != nil {
+			tx.Rollback()
+			return falsePositive, handleError("updateFalsePositive", err)
+		}
+	} else {
+		falsePositive.Name = uuid.New()
+		falsePositive.Created = time.Now().UTC()
+		result, err := tx.Exec(insertFalsePositive, falsePositive.Name, namespaceID,
+			falsePositive.VulnerabilityName, falsePositive.FeatureName, falsePositive.FeatureVersion,
+			reason, falsePositive.Created)
+		if err != nil {
+			tx.Rollback()
+			return falsePositive, handleError("insertFalsePositive", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			return falsePositive, handleError("insertFalsePositive.LastInsertId()", err)
+		}
+		falsePositive.ID = int(id)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return falsePositive, handleError("InsertFalsePositive.Commit()", err)
+	}
+	return falsePositive, nil
+}
+
+// FindFalsePositives returns the false positives flagging any of the given vulnerabilities.
+func (db *mySQL) FindFalsePositives(vulnerabilities []database.Vulnerability) ([]database.FalsePositive, error) {
+	var found []database.FalsePositive
+	seen := make(map[string]struct{})
+	for _, vulnerability := range vulnerabilities {
+		key := vulnerability.Namespace.Name + ":" + vulnerability.Name
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		falsePositives, err := searchFalsePositives(db, searchFalsePositiveByVulnerability,
+			vulnerability.Namespace.Name, vulnerability.Name)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, falsePositives...)
+	}
+	return found, nil
+}
+
+// ListFalsePositives paginates over every false positive.
+func (db *mySQL) ListFalsePositives(limit int, startID int) ([]database.FalsePositive, int, error) {
+	falsePositives, err := searchFalsePositives(db, searchFalsePositivePage, startID, limit+1)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	nextID := -1
+	if len(falsePositives) > limit {
+		nextID = falsePositives[limit].ID
+		falsePositives = falsePositives[:limit]
+	}
+	return falsePositives, nextID, nil
+}
+
+func searchFalsePositives(q queryer, condition string, args ...interface{}) ([]database.FalsePositive, error) {
+	rows, err := q.Query(searchFalsePositiveBase+condition, args...)
+	if err != nil {
+		return nil, handleError("searchFalsePositive", err)
+	}
+	defer rows.Close()
+
+	var falsePositives []database.FalsePositive
+	for rows.Next() {
+		var falsePositive database.FalsePositive
+		err := rows.Scan(
+			&falsePositive.ID,
+			&falsePositive.Name,
+			&falsePositive.Namespace.ID,
+			&falsePositive.Namespace.Name,
+			&falsePositive.Namespace.VersionFormat,
+			&falsePositive.VulnerabilityName,
+			&falsePositive.FeatureName,
+			&falsePositive.FeatureVersion,
+			&falsePositive.Reason,
+			&falsePositive.Created,
+		)
+		if err != nil {
+			return nil, handleError("searchFalsePositive.Scan()", err)
+		}
+		falsePositives = append(falsePositives, falsePositive)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchFalsePositive.Rows()", err)
+	}
+
+	return falsePositives, nil
+}
+
+// DeleteFalsePositive removes a false positive.
+func (db *mySQL) DeleteFalsePositive(name string) error {
+	result, err := db.Exec(removeFalsePositive, name)
+	if err != nil {
+		return handleError("removeFalsePositive", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("removeFalsePositive.RowsAffected()", err)
+	}
+	if affected <= 0 {
+		return cerrors.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func insertFeature(q queryer, feature database.Feature) (int, error) {
+	if feature.Name == "" {
+		return 0, cerrors.NewBadRequestError("could not find/insert invalid Feature")
+	}
+
+	namespaceID, err := insertNamespace(q, feature.Namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	return findOrInsert(q, "Feature", searchFeature, soiFeature, namespaceID, feature.Name)
+}
+
+func insertFeatureVersion(q queryer, fv database.FeatureVersion) (int, error) {
+	err := versionfmt.Valid(fv.Feature.Namespace.VersionFormat, fv.Version)
+	if err != nil {
+		return 0, cerrors.NewBadRequestError("could not find/insert invalid FeatureVersion")
+	}
+
+	featureID, err := insertFeature(q, fv.Feature)
+	if err != nil {
+		return 0, err
+	}
+
+	return findOrInsert(q, "FeatureVersion", searchFeatureVersion, soiFeatureVersion, featureID, fv.Version)
+}
+
+// findOrInsert returns the identifier of the row that the search query finds with the given
+// arguments, inserting it with the insert query if it doesn't exist yet.
+//
+// The row is searched first, as every insertion attempt consumes an AUTO_INCREMENT value. The
+// insert query updates the identifier with LAST_INSERT_ID() when the row exists, which happens
+// when it has been inserted concurrently, as the search may have been read from a snapshot older
+// than the row.
+func findOrInsert(q queryer, table, search, insert string, args ...interface{}) (int, error) {
+	var id int
+	err := q.QueryRow(search, args...).Scan(&id)
+	if err == nil {
+		return id, nil
+	} else if err != sql.ErrNoRows {
+		return 0, handleError("search"+table, err)
+	}
+
+	result, err := q.Exec(insert, args...)
+	if err != nil {
+		return 0, handleError("soi"+table, err)
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return 0, handleError("soi"+table+".LastInsertId()", err)
+	}
+
+	return int(lastID), nil
+}
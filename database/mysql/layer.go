@@ -0,0 +1,414 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/guregu/null/zero"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func (db *mySQL) FindLayer(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+	// Find the layer
+	var (
+		layer           database.Layer
+		parentID        zero.Int
+		parentName      zero.String
+		nsID            zero.Int
+		nsName          sql.NullString
+		nsVersionFormat sql.NullString
+	)
+
+	err := db.QueryRow(searchLayer, name).Scan(
+		&layer.ID,
+		&layer.Name,
+		&layer.EngineVersion,
+		&layer.Stats,
+		&parentID,
+		&parentName,
+		&nsID,
+		&nsName,
+		&nsVersionFormat,
+	)
+	if err != nil {
+		return layer, handleError("searchLayer", err)
+	}
+
+	if !parentID.IsZero() {
+		layer.Parent = &database.Layer{
+			Model: database.Model{ID: int(parentID.Int64)},
+			Name:  parentName.String,
+		}
+	}
+	if !nsID.IsZero() {
+		layer.Namespace = &database.Namespace{
+			Model:         database.Model{ID: int(nsID.Int64)},
+			Name:          nsName.String,
+			VersionFormat: nsVersionFormat.String,
+		}
+	}
+
+	// Find its labels
+	if layer.Labels, err = searchLabels(db, layer.ID); err != nil {
+		return layer, err
+	}
+
+	// Find its features
+	if withFeatures || withVulnerabilities {
+		// Read them in a transaction, so that the writes of other requests can't be interleaved
+		// between the queries and make the features mix vulnerabilities of different states.
+		tx, err := db.Begin()
+		if err != nil {
+			return layer, handleError("FindLayer.Begin()", err)
+		}
+		defer tx.Rollback()
+
+		layer.Features, err = getLayerFeatureVersions(tx, layer.ID)
+		if err != nil {
+			return layer, err
+		}
+
+		if withVulnerabilities {
+			// Load the vulnerabilities that affect the FeatureVersions.
+			if err = loadAffectedBy(tx, layer.Features); err != nil {
+				return layer, err
+			}
+		}
+	}
+
+	return layer, nil
+}
+
+// getLayerFeatureVersions returns list of database.FeatureVersion that a database.Layer has.
+func getLayerFeatureVersions(q queryer, layerID int) ([]database.FeatureVersion, error) {
+	var featureVersions []database.FeatureVersion
+
+	rows, err := q.Query(searchLayerFeatureVersion, layerID)
+	if err != nil {
+		return featureVersions, handleError("searchLayerFeatureVersion", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fv database.FeatureVersion
+		var evidence sql.NullString
+		err = rows.Scan(
+			&fv.ID,
+			&fv.Version,
+			&fv.Feature.ID,
+			&fv.Feature.Name,
+			&fv.Feature.Namespace.ID,
+			&fv.Feature.Namespace.Name,
+			&fv.Feature.Namespace.VersionFormat,
+			&fv.AddedBy.ID,
+			&fv.AddedBy.Name,
+			&fv.DetectedBy,
+			&fv.State,
+			&evidence,
+		)
+		if err != nil {
+			return featureVersions, handleError("searchLayerFeatureVersion.Scan()", err)
+		}
+		fv.Evidence = decodeEvidence(evidence)
+
+		featureVersions = append(featureVersions, fv)
+	}
+	if err = rows.Err(); err != nil {
+		return featureVersions, handleError("searchLayerFeatureVersion.Rows()", err)
+	}
+
+	return featureVersions, nil
+}
+
+// encodeEvidence returns the stored form of the evidence of a FeatureVersion: its paths separated
+// by newlines, or NULL when it is unknown.
+func encodeEvidence(evidence []string) sql.NullString {
+	return sql.NullString{String: strings.Join(evidence, "\n"), Valid: evidence != nil}
+}
+
+// decodeEvidence returns the evidence of a FeatureVersion from its stored form.
+func decodeEvidence(evidence sql.NullString) []string {
+	if !evidence.Valid {
+		return nil
+	}
+	if evidence.String == "" {
+		return []string{}
+	}
+	return strings.Split(evidence.String, "\n")
+}
+
+// loadAffectedBy assigns the list of database.Vulnerability that affect each of the given
+// FeatureVersions.
+//
+// The affected FeatureVersions aren't stored: a Vulnerability affects a FeatureVersion when the
+// version is lower than the one in which its Feature has been fixed.
+func loadAffectedBy(q queryer, featureVersions []database.FeatureVersion) error {
+	for i := range featureVersions {
+		fv := &featureVersions[i]
+
+		vulnerabilities, err := searchFeatureVulnerabilities(q, fv.Feature.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, vulnerability := range vulnerabilities {
+			cmp, err := versionfmt.Compare(fv.Feature.Namespace.VersionFormat, fv.Version, vulnerability.FixedBy)
+			if err != nil {
+				log.Warningf("could not compare %s with %s: %s", fv.Version, vulnerability.FixedBy, err)
+				continue
+			}
+			if cmp < 0 {
+				fv.AffectedBy = append(fv.AffectedBy, vulnerability)
+			}
+		}
+	}
+
+	return nil
+}
+
+// searchFeatureVulnerabilities returns every database.Vulnerability that has a fix for the given
+// Feature, with the fixed version in FixedBy.
+func searchFeatureVulnerabilities(q queryer, featureID int) ([]database.Vulnerability, error) {
+	var vulnerabilities []database.Vulnerability
+
+	rows, err := q.Query(searchFeatureVulnerability, featureID)
+	if err != nil {
+		return vulnerabilities, handleError("searchFeatureVulnerability", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vulnerability database.Vulnerability
+		err = rows.Scan(
+			&vulnerability.ID,
+			&vulnerability.Name,
+			&vulnerability.Description,
+			&vulnerability.Link,
+			&vulnerability.Severity,
+			&vulnerability.Metadata,
+			&vulnerability.Sources,
+			&vulnerability.CVSS,
+			&vulnerability.Namespace.Name,
+			&vulnerability.Namespace.VersionFormat,
+			&vulnerability.FixedBy,
+		)
+		if err != nil {
+			return vulnerabilities, handleError("searchFeatureVulnerability.Scan()", err)
+		}
+
+		vulnerabilities = append(vulnerabilities, vulnerability)
+	}
+	if err = rows.Err(); err != nil {
+		return vulnerabilities, handleError("searchFeatureVulnerability.Rows()", err)
+	}
+
+	return vulnerabilities, nil
+}
+
+// InsertLayer insert a single layer in the database.
+//
+// Every layer stores its whole list of FeatureVersions. When a FeatureVersion is already present
+// in the parent layer, the layer that added it to the parent is kept.
+func (db *mySQL) InsertLayer(layer database.Layer) error {
+	return withDeadlockRetry(func() error {
+		return db.insertLayer(layer)
+	})
+}
+
+func (db *mySQL) insertLayer(layer database.Layer) error {
+	// Verify parameters
+	if layer.Name == "" {
+		log.Warning("could not insert a layer which has an empty Name")
+		return cerrors.NewBadRequestError("could not insert a layer which has an empty Name")
+	}
+
+	// Get a potentially existing layer.
+	existingLayer, err := db.FindLayer(layer.Name, false, false)
+	if err != nil && err != cerrors.ErrNotFound {
+		return err
+	} else if err == nil {
+		if existingLayer.EngineVersion >= layer.EngineVersion {
+			// The layer exists and has an equal or higher engine version, do nothing.
+			return nil
+		}
+
+		layer.ID = existingLayer.ID
+	}
+
+	// Get parent ID.
+	var parentID zero.Int
+	if layer.Parent != nil {
+		if layer.Parent.ID == 0 {
+			log.Warning("Parent is expected to be retrieved from database when inserting a layer.")
+			return cerrors.NewBadRequestError("Parent is expected to be retrieved from database when inserting a layer.")
+		}
+
+		parentID = zero.IntFrom(int64(layer.Parent.ID))
+	}
+
+	// Begin transaction.
+	tx, err := db.Begin()
+	if err != nil {
+		return handleError("InsertLayer.Begin()", err)
+	}
+
+	// Find or insert namespace if provided.
+	var namespaceID zero.Int
+	if layer.Namespace != nil {
+		n, err := insertNamespace(tx, *layer.Namespace)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		namespaceID = zero.IntFrom(int64(n))
+	} else if layer.Parent != nil && layer.Parent.Namespace != nil {
+		// Import the Namespace from the parent if it has one and this layer doesn't specify one.
+		namespaceID = zero.IntFrom(int64(layer.Parent.Namespace.ID))
+	}
+
+	if layer.ID == 0 {
+		// Insert a new layer.
+		r, err := tx.Exec(insertLayer, layer.Name, layer.EngineVersion, parentID, namespaceID, &layer.Stats)
+		if err != nil {
+			tx.Rollback()
+			return handleError("insertLayer", err)
+		}
+
+		id, err := r.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			return handleError("insertLayer.LastInsertId()", err)
+		}
+		layer.ID = int(id)
+	} else {
+		// Update an existing layer.
+		_, err = tx.Exec(updateLayer, layer.EngineVersion, namespaceID, &layer.Stats, layer.ID)
+		if err != nil {
+			tx.Rollback()
+			return handleError("updateLayer", err)
+		}
+
+		// Remove all existing Layer_FeatureVersion.
+		_, err = tx.Exec(removeLayerFeatureVersion, layer.ID)
+		if err != nil {
+			tx.Rollback()
+			return handleError("removeLayerFeatureVersion", err)
+		}
+	}
+
+	// Insert FeatureVersions.
+	for _, fv := range layer.Features {
+		fvID, err := insertFeatureVersion(tx, fv)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Exec(insertLayerFeatureVersion, layer.ID, fvID, layer.ID, fv.DetectedBy, fv.State,
+			encodeEvidence(fv.Evidence), parentID, fvID)
+		if err != nil {
+			tx.Rollback()
+			return handleError("insertLayerFeatureVersion", err)
+		}
+	}
+
+	// Commit transaction.
+	if err = tx.Commit(); err != nil {
+		return handleError("InsertLayer.Commit()", err)
+	}
+
+	return nil
+}
+
+// DeleteLayer deletes a layer and its children.
+//
+// The descendants are deleted explicitly, deepest first, as InnoDB doesn't cascade deletions more
+// than 15 levels deep, which images can easily exceed.
+func (db *mySQL) DeleteLayer(name string) error {
+	return withDeadlockRetry(func() error {
+		return db.deleteLayer(name)
+	})
+}
+
+func (db *mySQL) deleteLayer(name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return handleError("DeleteLayer.Begin()", err)
+	}
+
+	var layerID int
+	if err = tx.QueryRow(searchLayerIDForUpdate, name).Scan(&layerID); err != nil {
+		tx.Rollback()
+		return handleError("searchLayerIDForUpdate", err)
+	}
+
+	layerIDs, err := searchDescendantLayers(tx, []int{layerID})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i := len(layerIDs) - 1; i >= 0; i-- {
+		if _, err = tx.Exec(removeLayer, layerIDs[i]); err != nil {
+			tx.Rollback()
+			return handleError("removeLayer", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return handleError("DeleteLayer.Commit()", err)
+	}
+
+	return nil
+}
+
+// searchDescendantLayers returns the given layers followed by their descendants, breadth first.
+func searchDescendantLayers(q queryer, layerIDs []int) ([]int, error) {
+	seen := make(map[int]struct{}, len(layerIDs))
+	for _, layerID := range layerIDs {
+		seen[layerID] = struct{}{}
+	}
+
+	for i := 0; i < len(layerIDs); i++ {
+		rows, err := q.Query(searchLayerChildren, layerIDs[i])
+		if err != nil {
+			return nil, handleError("searchLayerChildren", err)
+		}
+
+		for rows.Next() {
+			var childID int
+			if err = rows.Scan(&childID); err != nil {
+				rows.Close()
+				return nil, handleError("searchLayerChildren.Scan()", err)
+			}
+			if _, ok := seen[childID]; !ok {
+				seen[childID] = struct{}{}
+				layerIDs = append(layerIDs, childID)
+			}
+		}
+		if err = rows.Err(); err != nil {
+			rows.Close()
+			return nil, handleError("searchLayerChildren.Rows()", err)
+		}
+		rows.Close()
+	}
+
+	return layerIDs, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"time"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertLayerAnalysis stores the analysis of the blob with the given digest, replacing the one
+// stored for it, if any.
+func (db *mySQL) InsertLayerAnalysis(analysis database.LayerAnalysis) error {
+	if analysis.Digest == "" || analysis.Version == "" {
+		return cerrors.NewBadRequestError("could not insert a layer analysis which does not have a digest and a version")
+	}
+
+	_, err := db.Exec(insertOrReplaceLayerAnalysis, analysis.Digest, analysis.Version, &analysis.Result, time.Now().UTC())
+	if err != nil {
+		return handleError("insertOrReplaceLayerAnalysis", err)
+	}
+	return nil
+}
+
+// FindLayerAnalysis returns the analysis of the blob with the given digest.
+func (db *mySQL) FindLayerAnalysis(digest string) (database.LayerAnalysis, error) {
+	analysis := database.LayerAnalysis{Digest: digest}
+	err := db.QueryRow(searchLayerAnalysis, digest).Scan(&analysis.Version, &analysis.Result, &analysis.Created)
+	if err != nil {
+		return analysis, handleError("searchLayerAnalysis", err)
+	}
+	return analysis, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertLayerLabels attaches labels to a layer, removing the ones with an empty value.
+func (db *mySQL) InsertLayerLabels(name string, labels map[string]string) error {
+	for key := range labels {
+		if key == "" {
+			return cerrors.NewBadRequestError("could not insert a label which has an empty key")
+		}
+	}
+
+	var layerID int
+	if err := db.QueryRow(searchLayerID, name).Scan(&layerID); err != nil {
+		return handleError("searchLayerID", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return handleError("InsertLayerLabels.Begin()", err)
+	}
+	for _, key := range database.SortedKeys(labels) {
+		if labels[key] == "" {
+			_, err = tx.Exec(removeLayerLabel, layerID, key)
+		} else {
+			_, err = tx.Exec(insertOrReplaceLayerLabel, layerID, key, labels[key])
+		}
+		if err != nil {
+			tx.Rollback()
+			return handleError("insertOrReplaceLayerLabel", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return handleError("InsertLayerLabels.Commit()", err)
+	}
+
+	return nil
+}
+
+// ListLayers paginates over the layers having all the given labels.
+func (db *mySQL) ListLayers(labels map[string]string, limit int, startID int) ([]database.Layer, int, error) {
+	query := searchLayerPage
+	args := []interface{}{startID}
+	for _, key := range database.SortedKeys(labels) {
+		query += searchLayerPageLabel
+		args = append(args, key, labels[key])
+	}
+	query += searchLayerPageEnd
+	args = append(args, limit+1)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, -1, handleError("searchLayerPage", err)
+	}
+	defer rows.Close()
+
+	var layers []database.Layer
+	for rows.Next() {
+		var layer database.Layer
+		if err := rows.Scan(&layer.ID, &layer.Name); err != nil {
+			return nil, -1, handleError("searchLayerPage.Scan()", err)
+		}
+		layers = append(layers, layer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, -1, handleError("searchLayerPage.Rows()", err)
+	}
+	rows.Close()
+
+	nextID := -1
+	if len(layers) > limit {
+		nextID = layers[limit].ID
+		layers = layers[:limit]
+	}
+
+	for i := range layers {
+		if layers[i].Labels, err = searchLabels(db, layers[i].ID); err != nil {
+			return nil, -1, err
+		}
+	}
+	return layers, nextID, nil
+}
+
+func (db *mySQL) ListNotificationLabels(name string) ([]map[string]string, error) {
+	// Read the notification and the layers from the same snapshot.
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, handleError("ListNotificationLabels.Begin()", err)
+	}
+	defer tx.Rollback()
+
+	layerIDs, err := searchNotificationAffectedLayers(tx, name)
+	if err != nil || len(layerIDs) == 0 {
+		return nil, err
+	}
+
+	rows, err := tx.Query(searchLayerLabelsIn+"("+placeholders(len(layerIDs))+") ORDER BY layer_id", intArgs(layerIDs)...)
+	if err != nil {
+		return nil, handleError("searchLayerLabelsIn", err)
+	}
+	defer rows.Close()
+
+	var layers []map[string]string
+	lastID := -1
+	for rows.Next() {
+		var layerID int
+		var key, value string
+		if err := rows.Scan(&layerID, &key, &value); err != nil {
+			return nil, handleError("searchLayerLabelsIn.Scan()", err)
+		}
+		if layerID != lastID {
+			layers = append(layers, make(map[string]string))
+			lastID = layerID
+		}
+		layers[len(layers)-1][key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchLayerLabelsIn.Rows()", err)
+	}
+
+	// Images sharing the same labels, e.g. the successive builds of a project, are routed once.
+	var labels []map[string]string
+	seen := make(map[string]struct{})
+	for _, layerLabels := range layers {
+		id := database.LabelsID(layerLabels)
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			labels = append(labels, layerLabels)
+		}
+	}
+
+	return labels, nil
+}
+
+// searchLabels returns the labels of a layer, or nil if it has none.
+func searchLabels(q queryer, layerID int) (map[string]string, error) {
+	rows, err := q.Query(searchLayerLabels, layerID)
+	if err != nil {
+		return nil, handleError("searchLayerLabels", err)
+	}
+	defer rows.Close()
+
+	var labels map[string]string
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, handleError("searchLayerLabels.Scan()", err)
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchLayerLabels.Rows()", err)
+	}
+
+	return labels, nil
+}
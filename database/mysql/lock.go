@@ -0,0 +1,96 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"time"
+
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// Lock tries to set a temporary lock in the database.
+//
+// The expiration time is computed by Clair rather than by the server, in UTC, so that it is
+// compared consistently regardless of the time zone of the server.
+func (db *mySQL) Lock(name string, owner string, duration time.Duration, renew bool) (bool, time.Time) {
+	if name == "" || owner == "" || duration == 0 {
+		log.Warning("could not create an invalid lock")
+		return false, time.Time{}
+	}
+
+	// Compute expiration.
+	until := time.Now().UTC().Add(duration)
+
+	if renew {
+		// Renew lock.
+		r, err := db.Exec(updateLock, until, name, owner)
+		if err != nil {
+			handleError("updateLock", err)
+			return false, until
+		}
+		if n, _ := r.RowsAffected(); n > 0 {
+			// Updated successfully.
+			return true, until
+		}
+	} else {
+		// Prune locks.
+		db.pruneLocks()
+	}
+
+	// Lock.
+	if _, err := db.Exec(insertLock, name, owner, until); err != nil {
+		if !isErrDuplicate(err) {
+			handleError("insertLock", err)
+		}
+		return false, until
+	}
+
+	return true, until
+}
+
+// Unlock unlocks a lock specified by its name if I own it
+func (db *mySQL) Unlock(name, owner string) {
+	if name == "" || owner == "" {
+		log.Warning("could not delete an invalid lock")
+		return
+	}
+
+	db.Exec(removeLock, name, owner)
+}
+
+// FindLock returns the owner of a lock specified by its name and its
+// expiration time.
+func (db *mySQL) FindLock(name string) (string, time.Time, error) {
+	if name == "" {
+		log.Warning("could not find an invalid lock")
+		return "", time.Time{}, cerrors.NewBadRequestError("could not find an invalid lock")
+	}
+
+	var owner string
+	var until time.Time
+	err := db.QueryRow(searchLock, name).Scan(&owner, &until)
+	if err != nil {
+		return owner, until, handleError("searchLock", err)
+	}
+
+	return owner, until, nil
+}
+
+// pruneLocks removes every expired locks from the database
+func (db *mySQL) pruneLocks() {
+	if _, err := db.Exec(removeLockExpired, time.Now().UTC()); err != nil {
+		handleError("removeLockExpired", err)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mysql implements database.Datastore with MySQL 5.7+ or MariaDB 10.2+, using InnoDB.
+//
+// Like the sqlite driver, every layer stores its entire list of FeatureVersions and the
+// vulnerabilities affecting them are determined when the layer is read. Like the pgsql driver,
+// the previous revisions of the Vulnerabilities are kept so that notifications can be generated.
+//
+// The driver relies on the REPEATABLE READ isolation level, which is the default of InnoDB, to read
+// layers and notifications from a consistent snapshot.
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/tracing"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+const (
+	// errDuplicateEntry is the error number of the unique constraint violations.
+	errDuplicateEntry = 1062
+
+	// errDeadlock is the error number of the transactions rolled back by the deadlock detector.
+	errDeadlock = 1213
+
+	// maxDeadlockRetries is how many times a transaction rolled back by the deadlock detector is
+	// retried.
+	maxDeadlockRetries = 5
+
+	// degradedLatency is the round-trip duration above which the database is reported as degraded.
+	degradedLatency = 500 * time.Millisecond
+)
+
+var (
+	log = capnslog.NewPackageLogger("github.com/coreos/clair", "mysql")
+
+	// errDeadlockRetry is returned by the transactions that should be retried because the deadlock
+	// detector rolled them back.
+	errDeadlockRetry = errors.New("mysql: transaction rolled back by the deadlock detector")
+)
+
+// requiredParameters are the parameters of the data source name that the datastore relies on.
+var requiredParameters = map[string]string{
+	"clientFoundRows": "true",
+	"collation":       "utf8mb4_bin",
+	"loc":             "UTC",
+	"parseTime":       "true",
+}
+
+func init() {
+	database.Register("mysql", openDatabase)
+}
+
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type mySQL struct {
+	*tracing.DB
+	config Config
+}
+
+// Config is the configuration that is used by openDatabase.
+type Config struct {
+	// Source is the data source name of the database, e.g.
+	// "clair:password@tcp(localhost:3306)/clair". The times are always read and written in UTC.
+	Source string
+
+	// ManageDatabaseLifecycle creates the database when it is opened and drops it when it is
+	// closed, which is meant for tests.
+	ManageDatabaseLifecycle bool
+}
+
+// openDatabase opens a MySQL-backed Datastore using the given configuration and creates the
+// schema if necessary.
+func openDatabase(registrableComponentConfig config.RegistrableComponentConfig) (database.Datastore, error) {
+	var db mySQL
+
+	// Parse configuration.
+	bytes, err := yaml.Marshal(registrableComponentConfig.Options)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not load configuration: %v", err)
+	}
+	err = yaml.Unmarshal(bytes, &db.config)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not load configuration: %v", err)
+	}
+	if db.config.Source == "" {
+		return nil, cerrors.NewBadRequestError("mysql: no database source specified")
+	}
+	source, dbName, err := parseDataSourceName(db.config.Source)
+	if err != nil {
+		return nil, cerrors.NewBadRequestError("mysql: " + err.Error())
+	}
+
+	// Create database.
+	if db.config.ManageDatabaseLifecycle {
+		if err = execWithoutDatabase(source, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", dbName)); err != nil {
+			return nil, fmt.Errorf("mysql: could not create database: %v", err)
+		}
+	}
+
+	// Open database.
+	sqlDB, err := sql.Open("mysql", source)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("mysql: could not open database: %v", err)
+	}
+	db.DB = tracing.NewDB(sqlDB, "mysql")
+
+	// Create schema.
+	for _, query := range schema {
+		if _, err = db.Exec(query); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("mysql: could not create schema: %v", err)
+		}
+	}
+
+	return &db, nil
+}
+
+// parseDataSourceName returns the given data source name with the parameters that the driver
+// requires, along with the name of its database.
+func parseDataSourceName(source string) (string, string, error) {
+	slash := strings.LastIndex(source, "/")
+	if slash < 0 {
+		return "", "", errors.New("the data source name has no database")
+	}
+
+	dbName, params := source[slash+1:], ""
+	if question := strings.Index(dbName, "?"); question >= 0 {
+		dbName, params = dbName[:question], dbName[question+1:]
+	}
+	if dbName == "" {
+		return "", "", errors.New("the data source name has no database")
+	}
+
+	// DATETIME columns are scanned into time.Time, which are all in UTC, strings are exchanged in
+	// utf8mb4 and the UPDATE statements report the rows they matched rather than the rows they
+	// changed, as the other datastores do.
+	var kept []string
+	for _, param := range strings.Split(params, "&") {
+		name := strings.SplitN(param, "=", 2)[0]
+		if _, ok := requiredParameters[name]; param != "" && !ok {
+			kept = append(kept, param)
+		}
+	}
+	for _, name := range database.SortedKeys(requiredParameters) {
+		kept = append(kept, name+"="+requiredParameters[name])
+	}
+
+	return source[:slash+1] + dbName + "?" + strings.Join(kept, "&"), dbName, nil
+}
+
+// execWithoutDatabase executes a query on the server of the given data source name, without
+// selecting its database.
+func execWithoutDatabase(source, query string) error {
+	slash := strings.LastIndex(source, "/")
+	question := strings.Index(source[slash:], "?")
+
+	db, err := sql.Open("mysql", source[:slash+1]+source[slash+question:])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(query)
+	return err
+}
+
+// Close closes the database and drops it if ManageDatabaseLifecycle has been specified in the
+// configuration.
+func (db *mySQL) Close() {
+	if db.DB != nil {
+		db.DB.Close()
+	}
+
+	if db.config.ManageDatabaseLifecycle {
+		if source, dbName, err := parseDataSourceName(db.config.Source); err == nil {
+			execWithoutDatabase(source, fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", dbName))
+		}
+	}
+}
+
+// WithContext returns a copy of the database making its queries with the given context.
+func (db *mySQL) WithContext(ctx context.Context) database.Datastore {
+	bound := *db
+	bound.DB = db.DB.WithContext(ctx)
+	return &bound
+}
+
+// Health verifies that the database is accessible and reports how long a round-trip takes.
+func (db *mySQL) Health(ctx context.Context) (database.HealthStatus, error) {
+	start := time.Now()
+	var version string
+	err := db.QueryRowContext(ctx, searchServerVersion).Scan(&version)
+	status := database.HealthStatus{
+		State:   database.Healthy,
+		Latency: time.Since(start),
+		Version: version,
+	}
+
+	if err != nil {
+		status.State = database.Unhealthy
+		if ctx.Err() != nil {
+			status.Message = "timed out waiting for the database"
+			return status, ctx.Err()
+		}
+		status.Message = err.Error()
+		return status, handleError("searchServerVersion", err)
+	}
+
+	if status.Latency > degradedLatency {
+		status.State = database.Degraded
+		status.Message = fmt.Sprintf("round-trip took more than %v", degradedLatency)
+	}
+
+	return status, nil
+}
+
+// withDeadlockRetry calls f until it succeeds or fails with another error than errDeadlockRetry,
+// at most maxDeadlockRetries times.
+func withDeadlockRetry(f func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxDeadlockRetries; attempt++ {
+		if err = f(); err != errDeadlockRetry {
+			return err
+		}
+		log.Debugf("mysql: retrying transaction after deadlock (attempt %d)", attempt)
+	}
+
+	return database.ErrBackendException
+}
+
+// handleError logs an error with an extra description and masks the error if it's an SQL one.
+// This ensures we never return an error containing the database content.
+func handleError(desc string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if err == sql.ErrNoRows {
+		return cerrors.ErrNotFound
+	}
+
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == errDeadlock {
+		log.Debugf("%s: %v", desc, err)
+		return errDeadlockRetry
+	}
+
+	log.Errorf("%s: %v", desc, err)
+
+	if _, o := err.(*mysql.MySQLError); o || err == mysql.ErrInvalidConn || err == sql.ErrTxDone || strings.HasPrefix(err.Error(), "sql:") {
+		return database.ErrBackendException
+	}
+
+	return err
+}
+
+// isErrDuplicate determines if the given error is a unique constraint violation.
+func isErrDuplicate(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == errDuplicateEntry
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	_ "github.com/coreos/clair/ext/versionfmt/apk"
+	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/utils/types"
+)
+
+// testSource returns the data source name of a new database of the server given by
+// CLAIR_TEST_MYSQL, which contains a %s verb in place of the name of the database, and skips the
+// test if there is none.
+func testSource(t *testing.T) string {
+	sourceEnv := os.Getenv("CLAIR_TEST_MYSQL")
+	if sourceEnv == "" {
+		t.Skip("CLAIR_TEST_MYSQL isn't set")
+	}
+	return fmt.Sprintf(sourceEnv, "test_"+strings.Replace(uuid.New(), "-", "_", -1))
+}
+
+func TestOpenDatabaseWithoutSource(t *testing.T) {
+	_, err := openDatabase(config.RegistrableComponentConfig{Options: map[string]interface{}{}})
+	assert.NotNil(t, err)
+}
+
+func TestParseDataSourceName(t *testing.T) {
+	for _, test := range []struct {
+		source         string
+		expectedSource string
+		expectedDBName string
+		expectedError  bool
+	}{
+		{
+			source:         "clair:password@tcp(localhost:3306)/clair",
+			expectedSource: "clair:password@tcp(localhost:3306)/clair?clientFoundRows=true&collation=utf8mb4_bin&loc=UTC&parseTime=true",
+			expectedDBName: "clair",
+		},
+		{
+			source:         "clair@unix(/var/run/mysqld/mysqld.sock)/clair?timeout=5s&loc=Local&parseTime=false",
+			expectedSource: "clair@unix(/var/run/mysqld/mysqld.sock)/clair?timeout=5s&clientFoundRows=true&collation=utf8mb4_bin&loc=UTC&parseTime=true",
+			expectedDBName: "clair",
+		},
+		{
+			source:        "clair@tcp(localhost:3306)",
+			expectedError: true,
+		},
+		{
+			source:        "clair@tcp(localhost:3306)/?timeout=5s",
+			expectedError: true,
+		},
+	} {
+		source, dbName, err := parseDataSourceName(test.source)
+		if test.expectedError {
+			assert.NotNil(t, err, test.source)
+			continue
+		}
+		if assert.Nil(t, err, test.source) {
+			assert.Equal(t, test.expectedSource, source, test.source)
+			assert.Equal(t, test.expectedDBName, dbName, test.source)
+		}
+	}
+}
+
+func TestAlpineVersionFormatMigration(t *testing.T) {
+	datastore, err := openDatabase(config.RegistrableComponentConfig{
+		Options: map[string]interface{}{
+			"source":                  testSource(t),
+			"managedatabaselifecycle": true,
+		},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer datastore.Close()
+
+	// The Alpine packages were compared with the dpkg rules, which order the release candidates
+	// after the releases.
+	namespace := database.Namespace{Name: "alpine:v3.18", VersionFormat: dpkg.ParserName}
+	openssl := database.Feature{Name: "openssl", Namespace: namespace}
+	vulnerability := database.Vulnerability{
+		Name:      "CVE-2024-0001",
+		Namespace: namespace,
+		Severity:  types.High,
+		FixedIn:   []database.FeatureVersion{{Feature: openssl, Version: "1.2.3-r0"}},
+	}
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, false))
+	layer := database.Layer{
+		Name:          "alpine",
+		EngineVersion: 1,
+		Namespace:     &namespace,
+		Features:      []database.FeatureVersion{{Feature: openssl, Version: "1.2.3_rc1-r0"}},
+	}
+	assert.Nil(t, datastore.InsertLayer(layer))
+	affectedBy := func() []database.Vulnerability {
+		l, err := datastore.FindLayer(layer.Name, true, true)
+		if !assert.Nil(t, err) || !assert.Len(t, l.Features, 1) {
+			return nil
+		}
+		return l.Features[0].AffectedBy
+	}
+	assert.Len(t, affectedBy(), 0)
+
+	// The vulnerabilities affecting a package are determined when the layer is read, so the
+	// statement of the schema switching the namespace to the apk rules is enough.
+	for _, query := range schema {
+		if strings.Contains(query, "alpine:%") {
+			_, err := datastore.(*mySQL).Exec(query)
+			assert.Nil(t, err)
+		}
+	}
+	if vulnerabilities := affectedBy(); assert.Len(t, vulnerabilities, 1) {
+		assert.Equal(t, "CVE-2024-0001", vulnerabilities[0].Name)
+	}
+}
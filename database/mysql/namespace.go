@@ -0,0 +1,192 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func insertNamespace(q queryer, namespace database.Namespace) (int, error) {
+	if namespace.Name == "" {
+		return 0, cerrors.NewBadRequestError("could not find/insert invalid Namespace")
+	}
+
+	var id int
+	err := q.QueryRow(searchNamespace, namespace.Name).Scan(&id)
+	if err == nil {
+		return id, nil
+	} else if err != sql.ErrNoRows {
+		return 0, handleError("searchNamespace", err)
+	}
+
+	// See findOrInsert.
+	result, err := q.Exec(soiNamespace, namespace.Name, namespace.VersionFormat)
+	if err != nil {
+		return 0, handleError("soiNamespace", err)
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return 0, handleError("soiNamespace.LastInsertId()", err)
+	}
+
+	return int(lastID), nil
+}
+
+func (db *mySQL) ListNamespaces() (namespaces []database.Namespace, err error) {
+	rows, err := db.Query(listNamespace)
+	if err != nil {
+		return namespaces, handleError("listNamespace", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ns database.Namespace
+
+		err = rows.Scan(&ns.ID, &ns.Name, &ns.VersionFormat)
+		if err != nil {
+			return namespaces, handleError("listNamespace.Scan()", err)
+		}
+
+		namespaces = append(namespaces, ns)
+	}
+	if err = rows.Err(); err != nil {
+		return namespaces, handleError("listNamespace.Rows()", err)
+	}
+
+	return namespaces, err
+}
+
+func (db *mySQL) ListUnusedNamespaces() (namespaces []database.Namespace, err error) {
+	rows, err := db.Query(searchUnusedNamespace)
+	if err != nil {
+		return namespaces, handleError("searchUnusedNamespace", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ns database.Namespace
+
+		err = rows.Scan(&ns.ID, &ns.Name, &ns.VersionFormat)
+		if err != nil {
+			return namespaces, handleError("searchUnusedNamespace.Scan()", err)
+		}
+
+		namespaces = append(namespaces, ns)
+	}
+	if err = rows.Err(); err != nil {
+		return namespaces, handleError("searchUnusedNamespace.Rows()", err)
+	}
+
+	return namespaces, err
+}
+
+// PruneNamespace removes the vulnerabilities of an unused Namespace, along with its features and
+// feature versions that nothing references anymore, in a single transaction. The reclaimed space
+// is the growth of the free pages of the database file.
+func (db *mySQL) PruneNamespace(name string) (database.PrunedNamespace, error) {
+	var pruned database.PrunedNamespace
+	if name == "" {
+		return pruned, cerrors.NewBadRequestError("could not prune an empty namespace")
+	}
+
+	rowLengths, err := searchAverageRowLengths(db)
+	if err != nil {
+		return pruned, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return pruned, handleError("PruneNamespace.Begin()", err)
+	}
+
+	// Lock the namespace, so that no layer or vulnerability can be inserted into it meanwhile.
+	var namespaceID int
+	if err = tx.QueryRow(searchNamespaceForUpdate, name).Scan(&namespaceID); err != nil {
+		tx.Rollback()
+		return pruned, handleError("searchNamespaceForUpdate", err)
+	}
+
+	var inUse bool
+	if err = tx.QueryRow(searchNamespaceInUse, namespaceID, namespaceID).Scan(&inUse); err != nil {
+		tx.Rollback()
+		return pruned, handleError("searchNamespaceInUse", err)
+	}
+	if inUse {
+		tx.Rollback()
+		return pruned, database.ErrNamespaceInUse
+	}
+
+	// Removing the vulnerabilities cascades to their FixedIn lists and notifications.
+	prunes := []struct {
+		name  string
+		query string
+		table string
+		count *int
+	}{
+		{"pruneVulnerability", pruneVulnerability, "Vulnerability", &pruned.Vulnerabilities},
+		{"pruneFeatureVersion", pruneFeatureVersion, "FeatureVersion", &pruned.FeatureVersions},
+		{"pruneFeature", pruneFeature, "Feature", &pruned.Features},
+	}
+	for _, prune := range prunes {
+		result, err := tx.Exec(prune.query, namespaceID)
+		if err != nil {
+			tx.Rollback()
+			return database.PrunedNamespace{}, handleError(prune.name, err)
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return database.PrunedNamespace{}, handleError(prune.name+".RowsAffected()", err)
+		}
+		*prune.count = int(count)
+		pruned.Bytes += count * rowLengths[strings.ToLower(prune.table)]
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return database.PrunedNamespace{}, handleError("PruneNamespace.Commit()", err)
+	}
+
+	return pruned, nil
+}
+
+// searchAverageRowLengths returns the average length of the rows of the tables of the database,
+// by lowercase table name, as estimated by the server.
+func searchAverageRowLengths(q queryer) (map[string]int64, error) {
+	rows, err := q.Query(searchAverageRowLength)
+	if err != nil {
+		return nil, handleError("searchAverageRowLength", err)
+	}
+	defer rows.Close()
+
+	rowLengths := make(map[string]int64)
+	for rows.Next() {
+		var table string
+		var length sql.NullInt64
+		if err := rows.Scan(&table, &length); err != nil {
+			return nil, handleError("searchAverageRowLength.Scan()", err)
+		}
+		rowLengths[strings.ToLower(table)] = length.Int64
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchAverageRowLength.Rows()", err)
+	}
+
+	return rowLengths, nil
+}
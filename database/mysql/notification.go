@@ -0,0 +1,335 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/guregu/null/zero"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/tracing"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+// createNotification creates the notification of a change of a vulnerability, in the transaction
+// that changes it so that there can't be a change without notification and vice-versa.
+func createNotification(tx *tracing.Tx, oldVulnerabilityID, newVulnerabilityID int, priority types.Priority, reason database.NotificationReason) error {
+	oldVulnerabilityNullableID := sql.NullInt64{Int64: int64(oldVulnerabilityID), Valid: oldVulnerabilityID != 0}
+	newVulnerabilityNullableID := sql.NullInt64{Int64: int64(newVulnerabilityID), Valid: newVulnerabilityID != 0}
+
+	_, err := tx.Exec(insertNotification, database.NewNotificationName(), oldVulnerabilityNullableID, newVulnerabilityNullableID, &priority, string(reason))
+	return handleError("insertNotification", err)
+}
+
+// GetAvailableNotification returns one available notification name (!locked && !deleted &&
+// (!notified || notified_but_timed-out)) and locks it for the given owner. Notifications with the
+// highest priority are returned first. It does not fill the vulnerabilities.
+//
+// The renotify interval is subtracted from the time of the server, which sets notified_at and
+// failed_at.
+func (db *mySQL) GetAvailableNotification(renotifyInterval time.Duration, owner string, lockDuration time.Duration) (database.VulnerabilityNotification, error) {
+	if owner == "" || lockDuration <= 0 {
+		log.Warning("could not claim a notification with an invalid lock")
+		return database.VulnerabilityNotification{}, cerrors.NewBadRequestError("could not claim a notification with an invalid lock")
+	}
+
+	// Expired locks would hide their notifications from the search.
+	db.pruneLocks()
+
+	for {
+		interval := int64(renotifyInterval / time.Microsecond)
+		row := db.QueryRow(searchNotificationAvailable, interval, interval)
+		notification, err := scanNotification(db, row, false)
+		if err != nil {
+			return notification, handleError("searchNotificationAvailable", err)
+		}
+
+		// Another owner may have locked the notification since it has been searched, in which case
+		// it isn't returned by the search anymore.
+		if locked, _ := db.Lock(notification.Name, owner, lockDuration, false); locked {
+			return notification, nil
+		}
+	}
+}
+
+// ExtendNotificationLock renews the lock of a notification if the given owner still holds it.
+func (db *mySQL) ExtendNotificationLock(name, owner string, duration time.Duration) (bool, time.Time) {
+	until := time.Now().UTC().Add(duration)
+	r, err := db.Exec(updateLock, until, name, owner)
+	if err != nil {
+		handleError("updateLock", err)
+		return false, until
+	}
+	n, _ := r.RowsAffected()
+
+	return n > 0, until
+}
+
+// ReleaseNotificationLock unlocks a notification if the given owner holds its lock.
+func (db *mySQL) ReleaseNotificationLock(name, owner string) {
+	db.Unlock(name, owner)
+}
+
+func (db *mySQL) GetNotification(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
+	// Read the notification and the layers from the same snapshot.
+	tx, err := db.Begin()
+	if err != nil {
+		return database.VulnerabilityNotification{}, page, handleError("GetNotification.Begin()", err)
+	}
+	defer tx.Rollback()
+
+	// Get Notification.
+	notification, err := scanNotification(tx, tx.QueryRow(searchNotification, name), true)
+	if err != nil {
+		return notification, page, handleError("searchNotification", err)
+	}
+
+	// Load vulnerabilities' LayersIntroducingVulnerability.
+	page.OldVulnerability, err = loadLayerIntroducingVulnerability(tx, notification.OldVulnerability, limit, page.OldVulnerability)
+	if err != nil {
+		return notification, page, err
+	}
+
+	page.NewVulnerability, err = loadLayerIntroducingVulnerability(tx, notification.NewVulnerability, limit, page.NewVulnerability)
+	if err != nil {
+		return notification, page, err
+	}
+
+	return notification, page, nil
+}
+
+func scanNotification(q queryer, row *sql.Row, hasVulns bool) (database.VulnerabilityNotification, error) {
+	var notification database.VulnerabilityNotification
+	var created zero.Time
+	var notified zero.Time
+	var deleted zero.Time
+	var failed zero.Time
+	var reason zero.String
+	var oldVulnerabilityNullableID sql.NullInt64
+	var newVulnerabilityNullableID sql.NullInt64
+
+	// Scan notification.
+	if hasVulns {
+		err := row.Scan(
+			&notification.ID,
+			&notification.Name,
+			&created,
+			&notified,
+			&deleted,
+			&failed,
+			&notification.Priority,
+			&reason,
+			&oldVulnerabilityNullableID,
+			&newVulnerabilityNullableID,
+		)
+		if err != nil {
+			return notification, err
+		}
+	} else {
+		err := row.Scan(&notification.ID, &notification.Name, &created, &notified, &deleted, &failed, &notification.Priority, &reason)
+		if err != nil {
+			return notification, err
+		}
+	}
+
+	notification.Reason = database.NotificationReason(reason.String)
+	notification.Created = created.Time
+	notification.Notified = notified.Time
+	notification.Deleted = deleted.Time
+	notification.Failed = failed.Time
+
+	if hasVulns {
+		if oldVulnerabilityNullableID.Valid {
+			vulnerability, err := findVulnerabilityByIDWithDeleted(q, int(oldVulnerabilityNullableID.Int64))
+			if err != nil {
+				return notification, err
+			}
+
+			notification.OldVulnerability = &vulnerability
+		}
+
+		if newVulnerabilityNullableID.Valid {
+			vulnerability, err := findVulnerabilityByIDWithDeleted(q, int(newVulnerabilityNullableID.Int64))
+			if err != nil {
+				return notification, err
+			}
+
+			notification.NewVulnerability = &vulnerability
+		}
+	}
+
+	return notification, nil
+}
+
+// loadLayerIntroducingVulnerability fills Vulnerability.LayersIntroducingVulnerability.
+// limit -1: won't do anything
+// limit 0: will just get the startID of the second page
+func loadLayerIntroducingVulnerability(q queryer, vulnerability *database.Vulnerability, limit, startID int) (int, error) {
+	if vulnerability == nil {
+		return -1, nil
+	}
+
+	// A startID equals to -1 means that we reached the end already.
+	if startID == -1 || limit == -1 {
+		return -1, nil
+	}
+
+	// Search limit + 1 layers, the last one will be used to know the next starting ID.
+	layers, err := searchLayersIntroducingVulnerability(q, *vulnerability, startID, limit+1)
+	if err != nil {
+		return -1, err
+	}
+
+	size := limit
+	if len(layers) < limit {
+		size = len(layers)
+	}
+	vulnerability.LayersIntroducingVulnerability = layers[:size]
+	for i := range vulnerability.LayersIntroducingVulnerability {
+		layer := &vulnerability.LayersIntroducingVulnerability[i]
+		if layer.Labels, err = searchLabels(q, layer.ID); err != nil {
+			return -1, err
+		}
+	}
+
+	nextID := -1
+	if len(layers) > limit {
+		nextID = layers[limit].ID
+	}
+
+	return nextID, nil
+}
+
+// searchLayersIntroducingVulnerability returns, ordered by ID, the layers starting at the given ID
+// that add a FeatureVersion affected by the given revision of a Vulnerability, at most max of them
+// unless max is negative.
+//
+// As the affected FeatureVersions aren't stored, the versions of the FeatureVersions of the fixed
+// Features that the layers add are compared to the ones in which they have been fixed.
+func searchLayersIntroducingVulnerability(q queryer, vulnerability database.Vulnerability, startID, max int) ([]database.Layer, error) {
+	rows, err := q.Query(searchNotificationLayerIntroducingVulnerability, vulnerability.ID, startID)
+	if err != nil {
+		return nil, handleError("searchNotificationLayerIntroducingVulnerability", err)
+	}
+	defer rows.Close()
+
+	var layers []database.Layer
+	for rows.Next() && (max < 0 || len(layers) < max) {
+		var layer database.Layer
+		var version, fixedInVersion string
+
+		if err := rows.Scan(&layer.ID, &layer.Name, &version, &fixedInVersion); err != nil {
+			return nil, handleError("searchNotificationLayerIntroducingVulnerability.Scan()", err)
+		}
+		if len(layers) > 0 && layers[len(layers)-1].ID == layer.ID {
+			continue
+		}
+
+		cmp, err := versionfmt.Compare(vulnerability.Namespace.VersionFormat, version, fixedInVersion)
+		if err != nil {
+			log.Warningf("could not compare %s with %s: %s", version, fixedInVersion, err)
+			continue
+		}
+		if cmp < 0 {
+			layers = append(layers, layer)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, handleError("searchNotificationLayerIntroducingVulnerability.Rows()", err)
+	}
+
+	return layers, nil
+}
+
+// searchNotificationAffectedLayers returns the identifiers of the layers introducing the old or
+// the new Vulnerability of a Notification, followed by every layer based on these.
+func searchNotificationAffectedLayers(q queryer, name string) ([]int, error) {
+	notification, err := scanNotification(q, q.QueryRow(searchNotification, name), true)
+	if err != nil {
+		return nil, handleError("searchNotification", err)
+	}
+
+	var layerIDs []int
+	seen := make(map[int]struct{})
+	for _, vulnerability := range []*database.Vulnerability{notification.OldVulnerability, notification.NewVulnerability} {
+		if vulnerability == nil {
+			continue
+		}
+
+		layers, err := searchLayersIntroducingVulnerability(q, *vulnerability, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		for _, layer := range layers {
+			if _, ok := seen[layer.ID]; !ok {
+				seen[layer.ID] = struct{}{}
+				layerIDs = append(layerIDs, layer.ID)
+			}
+		}
+	}
+
+	return searchDescendantLayers(q, layerIDs)
+}
+
+func (db *mySQL) SetNotificationNotified(name string) error {
+	if _, err := db.Exec(updatedNotificationNotified, name); err != nil {
+		return handleError("updatedNotificationNotified", err)
+	}
+	return nil
+}
+
+func (db *mySQL) SetNotificationFailed(name string) error {
+	if _, err := db.Exec(updatedNotificationFailed, name); err != nil {
+		return handleError("updatedNotificationFailed", err)
+	}
+	return nil
+}
+
+func (db *mySQL) DeleteNotification(name string) error {
+	result, err := db.Exec(removeNotification, name)
+	if err != nil {
+		return handleError("removeNotification", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("removeNotification.RowsAffected()", err)
+	}
+
+	if affected <= 0 {
+		return cerrors.ErrNotFound
+	}
+
+	return nil
+}
+
+// placeholders returns the list of n placeholders of an IN condition, e.g. "?, ?, ?".
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// intArgs converts the given identifiers into query arguments.
+func intArgs(ids []int) []interface{} {
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return args
+}
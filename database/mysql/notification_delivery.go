@@ -0,0 +1,207 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"github.com/guregu/null/zero"
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertNotificationDelivery finds or creates the outbox entry of a notification for the given
+// notifier.
+func (db *mySQL) InsertNotificationDelivery(notificationName, notifier string) (database.NotificationDelivery, error) {
+	if notificationName == "" || notifier == "" {
+		return database.NotificationDelivery{}, cerrors.NewBadRequestError("could not insert a notification delivery which has an empty notification or notifier name")
+	}
+
+	var delivery database.NotificationDelivery
+	err := withDeadlockRetry(func() (err error) {
+		delivery, err = db.insertNotificationDelivery(notificationName, notifier)
+		return
+	})
+	return delivery, err
+}
+
+func (db *mySQL) insertNotificationDelivery(notificationName, notifier string) (database.NotificationDelivery, error) {
+	delivery := database.NotificationDelivery{Notifier: notifier}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return delivery, handleError("InsertNotificationDelivery.Begin()", err)
+	}
+
+	var notificationID int
+	if err = tx.QueryRow(searchNotificationID, notificationName).Scan(&notificationID); err != nil {
+		tx.Rollback()
+		return delivery, handleError("searchNotificationID", err)
+	}
+
+	// Reopen the delivery if it has been completed during a previous round, so the receivers see a
+	// new key for what is an intended renotification.
+	if _, err = tx.Exec(reopenNotificationDelivery, uuid.New(), notificationID, notifier); err != nil {
+		tx.Rollback()
+		return delivery, handleError("reopenNotificationDelivery", err)
+	}
+
+	if _, err = tx.Exec(insertNotificationDelivery, notificationID, notifier, uuid.New()); err != nil {
+		tx.Rollback()
+		return delivery, handleError("insertNotificationDelivery", err)
+	}
+
+	// The delivery is read with a locking read, which sees it even if it has been inserted
+	// concurrently after the snapshot of the transaction.
+	var delivered zero.Time
+	err = tx.QueryRow(searchNotificationDeliveryForUpdate, notificationID, notifier).
+		Scan(&delivery.ID, &delivery.Key, &delivery.Created, &delivered)
+	if err != nil {
+		tx.Rollback()
+		return delivery, handleError("searchNotificationDeliveryForUpdate", err)
+	}
+	delivery.Delivered = delivered.Time
+
+	if err = tx.Commit(); err != nil {
+		return delivery, handleError("InsertNotificationDelivery.Commit()", err)
+	}
+
+	return delivery, nil
+}
+
+// InsertNotificationDeliveryAttempt records an attempt and, when it succeeded, completes the
+// delivery atomically.
+func (db *mySQL) InsertNotificationDeliveryAttempt(delivery database.NotificationDelivery, succeeded bool, message string) error {
+	if delivery.ID == 0 {
+		return cerrors.NewBadRequestError("could not insert an attempt for an unknown notification delivery")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return handleError("InsertNotificationDeliveryAttempt.Begin()", err)
+	}
+
+	if _, err = tx.Exec(insertNotificationDeliveryAttempt, delivery.ID, succeeded, zero.StringFrom(message)); err != nil {
+		tx.Rollback()
+		return handleError("insertNotificationDeliveryAttempt", err)
+	}
+
+	if succeeded {
+		if _, err = tx.Exec(updateNotificationDeliveryDelivered, delivery.ID); err != nil {
+			tx.Rollback()
+			return handleError("updateNotificationDeliveryDelivered", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return handleError("InsertNotificationDeliveryAttempt.Commit()", err)
+	}
+
+	return nil
+}
+
+// ListNotificationDeliveries returns the outbox entries of a notification and their attempts.
+func (db *mySQL) ListNotificationDeliveries(notificationName string) ([]database.NotificationDelivery, error) {
+	rows, err := db.Query(searchNotificationDelivery, notificationName)
+	if err != nil {
+		return nil, handleError("searchNotificationDelivery", err)
+	}
+	defer rows.Close()
+
+	var deliveries []database.NotificationDelivery
+	var deliveryIDs []int
+	deliveryIndexes := make(map[int]int)
+	for rows.Next() {
+		var delivery database.NotificationDelivery
+		var delivered zero.Time
+
+		err := rows.Scan(&delivery.ID, &delivery.Notifier, &delivery.Key, &delivery.Created, &delivered)
+		if err != nil {
+			return nil, handleError("searchNotificationDelivery.Scan()", err)
+		}
+		delivery.Delivered = delivered.Time
+
+		deliveryIndexes[delivery.ID] = len(deliveries)
+		deliveryIDs = append(deliveryIDs, delivery.ID)
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, handleError("searchNotificationDelivery.Rows()", err)
+	}
+
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+
+	// Load the attempts of every delivery at once.
+	attemptRows, err := db.Query(searchNotificationDeliveryAttempt+"("+placeholders(len(deliveryIDs))+") ORDER BY id", intArgs(deliveryIDs)...)
+	if err != nil {
+		return nil, handleError("searchNotificationDeliveryAttempt", err)
+	}
+	defer attemptRows.Close()
+
+	for attemptRows.Next() {
+		var deliveryID int
+		var attempt database.NotificationDeliveryAttempt
+		var message zero.String
+
+		err := attemptRows.Scan(&deliveryID, &attempt.ID, &attempt.Attempted, &attempt.Succeeded, &message)
+		if err != nil {
+			return nil, handleError("searchNotificationDeliveryAttempt.Scan()", err)
+		}
+		attempt.Error = message.String
+
+		delivery := &deliveries[deliveryIndexes[deliveryID]]
+		delivery.Attempts = append(delivery.Attempts, attempt)
+	}
+	if err = attemptRows.Err(); err != nil {
+		return nil, handleError("searchNotificationDeliveryAttempt.Rows()", err)
+	}
+
+	return deliveries, nil
+}
+
+// ListUndeliveredNotifications returns the notifications marked as notified whose delivery via the
+// given notifier is still open.
+func (db *mySQL) ListUndeliveredNotifications(notifier string) ([]database.VulnerabilityNotification, error) {
+	rows, err := db.Query(searchUndeliveredNotification, notifier)
+	if err != nil {
+		return nil, handleError("searchUndeliveredNotification", err)
+	}
+	defer rows.Close()
+
+	var notifications []database.VulnerabilityNotification
+	for rows.Next() {
+		var notification database.VulnerabilityNotification
+		var created, notified, deleted zero.Time
+		var reason zero.String
+
+		err := rows.Scan(&notification.ID, &notification.Name, &created, &notified, &deleted, &notification.Priority, &reason)
+		if err != nil {
+			return nil, handleError("searchUndeliveredNotification.Scan()", err)
+		}
+		notification.Reason = database.NotificationReason(reason.String)
+		notification.Created = created.Time
+		notification.Notified = notified.Time
+		notification.Deleted = deleted.Time
+
+		notifications = append(notifications, notification)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, handleError("searchUndeliveredNotification.Rows()", err)
+	}
+
+	return notifications, nil
+}
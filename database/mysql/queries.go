@@ -0,0 +1,640 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+const (
+	searchServerVersion = `SELECT VERSION()`
+
+	// namespace.go
+	searchNamespace = `SELECT id FROM Namespace WHERE name = ?`
+	soiNamespace    = `
+		INSERT INTO Namespace(name, version_format) VALUES(?, ?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`
+	listNamespace = `SELECT id, name, version_format FROM Namespace`
+
+	searchUnusedNamespace = `
+		SELECT n.id, n.name, n.version_format
+		FROM Namespace n
+		WHERE NOT EXISTS (SELECT 1 FROM Layer l WHERE l.namespace_id = n.id)
+			AND NOT EXISTS (
+				SELECT 1
+				FROM Layer_FeatureVersion lfv
+					JOIN FeatureVersion fv ON lfv.featureversion_id = fv.id
+					JOIN Feature f ON fv.feature_id = f.id
+				WHERE f.namespace_id = n.id)`
+
+	searchNamespaceForUpdate = `SELECT id FROM Namespace WHERE name = ? FOR UPDATE`
+
+	searchNamespaceInUse = `
+		SELECT EXISTS (SELECT 1 FROM Layer WHERE namespace_id = ?)
+			OR EXISTS (
+				SELECT 1
+				FROM Layer_FeatureVersion lfv
+					JOIN FeatureVersion fv ON lfv.featureversion_id = fv.id
+					JOIN Feature f ON fv.feature_id = f.id
+				WHERE f.namespace_id = ?)`
+
+	pruneVulnerability  = `DELETE FROM Vulnerability WHERE namespace_id = ?`
+	pruneFeatureVersion = `
+		DELETE FROM FeatureVersion
+		WHERE feature_id IN (SELECT id FROM Feature WHERE namespace_id = ?)
+			AND id NOT IN (SELECT featureversion_id FROM Layer_FeatureVersion)`
+	pruneFeature = `
+		DELETE FROM Feature
+		WHERE namespace_id = ?
+			AND id NOT IN (SELECT feature_id FROM FeatureVersion)
+			AND id NOT IN (SELECT feature_id FROM Vulnerability_FixedIn_Feature)
+			AND id NOT IN (SELECT feature_id FROM Vulnerability_FixedIn_Feature_Archive)`
+
+	searchAverageRowLength = `
+		SELECT TABLE_NAME, AVG_ROW_LENGTH
+		FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE()`
+
+	// feature.go
+	searchFeature = `SELECT id FROM Feature WHERE namespace_id = ? AND name = ?`
+	soiFeature    = `
+		INSERT INTO Feature(namespace_id, name) VALUES(?, ?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`
+
+	searchFeatureVersion = `SELECT id FROM FeatureVersion WHERE feature_id = ? AND version = ?`
+	soiFeatureVersion    = `
+		INSERT INTO FeatureVersion(feature_id, version) VALUES(?, ?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`
+
+	// layer.go
+	searchLayer = `
+		SELECT l.id, l.name, l.engineversion, l.stats, p.id, p.name, n.id, n.name, n.version_format
+		FROM Layer l
+			LEFT JOIN Layer p ON l.parent_id = p.id
+			LEFT JOIN Namespace n ON l.namespace_id = n.id
+		WHERE l.name = ?`
+
+	searchLayerFeatureVersion = `
+		SELECT fv.id, fv.version, f.id, f.name, n.id, n.name, n.version_format, a.id, a.name,
+			COALESCE(lfv.detector, ''), COALESCE(lfv.state, ''), lfv.evidence
+		FROM Layer_FeatureVersion lfv
+			JOIN FeatureVersion fv ON lfv.featureversion_id = fv.id
+			JOIN Feature f ON fv.feature_id = f.id
+			JOIN Namespace n ON f.namespace_id = n.id
+			JOIN Layer a ON lfv.added_by = a.id
+		WHERE lfv.layer_id = ?`
+
+	searchFeatureVulnerability = `
+		SELECT v.id, v.name, v.description, v.link, v.severity, v.metadata, v.sources, v.cvss,
+			n.name, n.version_format, vfif.version
+		FROM Vulnerability_FixedIn_Feature vfif
+			JOIN Vulnerability v ON vfif.vulnerability_id = v.id
+			JOIN Namespace n ON v.namespace_id = n.id
+		WHERE vfif.feature_id = ? AND v.deleted_at IS NULL
+		ORDER BY v.id`
+
+	insertLayer = `
+		INSERT INTO Layer(name, engineversion, parent_id, namespace_id, stats, created_at)
+		VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP(6))`
+
+	updateLayer = `UPDATE Layer SET engineversion = ?, namespace_id = ?, stats = ? WHERE id = ?`
+
+	// A FeatureVersion that the parent layer already has keeps the layer that added it, along with
+	// the detector that found it there and its state there. Its evidence is the one of the layer.
+	insertLayerFeatureVersion = `
+		INSERT IGNORE INTO Layer_FeatureVersion(layer_id, featureversion_id, added_by, detector, state, evidence)
+		SELECT ?, ?, COALESCE(p.added_by, ?),
+			CASE WHEN p.added_by IS NULL THEN NULLIF(?, '') ELSE p.detector END,
+			CASE WHEN p.added_by IS NULL THEN NULLIF(?, '') ELSE p.state END, ?
+		FROM (SELECT 1 AS one) o
+			LEFT JOIN Layer_FeatureVersion p ON p.layer_id = ? AND p.featureversion_id = ?`
+
+	removeLayerFeatureVersion = `DELETE FROM Layer_FeatureVersion WHERE layer_id = ?`
+
+	searchLayerID          = `SELECT id FROM Layer WHERE name = ?`
+	searchLayerIDForUpdate = `SELECT id FROM Layer WHERE name = ? FOR UPDATE`
+	searchLayerChildren    = `SELECT id FROM Layer WHERE parent_id = ?`
+
+	insertOrReplaceLayerLabel = `
+		INSERT INTO Layer_Label(layer_id, ` + "`key`" + `, value) VALUES(?, ?, ?)
+		ON DUPLICATE KEY UPDATE value = VALUES(value)`
+	removeLayerLabel  = "DELETE FROM Layer_Label WHERE layer_id = ? AND `key` = ?"
+	searchLayerLabels = "SELECT `key`, value FROM Layer_Label WHERE layer_id = ?"
+
+	// searchLayerLabelsIn is followed by the list of the identifiers of the layers.
+	searchLayerLabelsIn = "SELECT layer_id, `key`, value FROM Layer_Label WHERE layer_id IN "
+
+	// searchLayerPage is followed by a condition per label, then by searchLayerPageEnd.
+	searchLayerPage      = `SELECT l.id, l.name FROM Layer l WHERE l.id >= ?`
+	searchLayerPageLabel = `
+		AND EXISTS (SELECT 1 FROM Layer_Label ll WHERE ll.layer_id = l.id AND ll.` + "`key`" + ` = ? AND ll.value = ?)`
+	searchLayerPageEnd = ` ORDER BY l.id LIMIT ?`
+
+	removeLayer = `DELETE FROM Layer WHERE id = ?`
+
+	// false_positive.go
+	searchFalsePositiveBase = `
+		SELECT fp.id, fp.name, n.id, n.name, n.version_format, fp.vulnerability_name, fp.feature_name,
+			fp.feature_version, fp.reason, fp.created_at
+		FROM False_Positive fp JOIN Namespace n ON fp.namespace_id = n.id`
+
+	searchFalsePositiveByVulnerability = ` WHERE n.name = ? AND fp.vulnerability_name = ? ORDER BY fp.id`
+
+	searchFalsePositivePage = ` WHERE fp.id >= ? ORDER BY fp.id LIMIT ?`
+
+	searchFalsePositiveByFinding = ` WHERE fp.namespace_id = ? AND fp.vulnerability_name = ? AND fp.feature_name = ? AND fp.feature_version = ?`
+
+	updateFalsePositive = `UPDATE False_Positive SET reason = ? WHERE id = ?`
+
+	insertFalsePositive = `
+		INSERT INTO False_Positive(name, namespace_id, vulnerability_name, feature_name, feature_version,
+			reason, created_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`
+
+	removeFalsePositive = `DELETE FROM False_Positive WHERE name = ?`
+
+	// watched_tag.go
+	searchWatchedTagBase = `
+		SELECT id, name, registry, repository, tag, digest, layer_name, reported_digest, signature,
+			attested, published, created_at, resolved_at, changed_at
+		FROM Watched_Tag`
+
+	searchWatchedTagByName = ` WHERE name = ?`
+
+	searchWatchedTagByReference = ` WHERE registry = ? AND repository = ? AND tag = ?`
+
+	searchWatchedTagPage = ` WHERE id >= ? ORDER BY id LIMIT ?`
+
+	searchMovedWatchedTagPage = ` WHERE digest <> reported_digest AND id >= ? ORDER BY id LIMIT ?`
+
+	// searchWatchedTagByLayerIDs is followed by the list of the identifiers of the layers and by a
+	// closing parenthesis.
+	searchWatchedTagByLayerIDs = ` WHERE layer_name IN (SELECT name FROM Layer WHERE id IN `
+
+	insertWatchedTag = `
+		INSERT IGNORE INTO Watched_Tag(name, registry, repository, tag, created_at)
+		VALUES(?, ?, ?, ?, ?)`
+
+	// The assignments of a single-table UPDATE are applied from left to right, so reported_digest is
+	// initialized with the new digest.
+	updateWatchedTag = `
+		UPDATE Watched_Tag SET digest = ?, layer_name = ?, resolved_at = ?, changed_at = ?,
+			reported_digest = CASE WHEN reported_digest = '' THEN digest ELSE reported_digest END,
+			signature = ?, attested = ?, published = ?
+		WHERE name = ?`
+
+	updateWatchedTagReported = `UPDATE Watched_Tag SET reported_digest = ? WHERE name = ?`
+
+	removeWatchedTag = `DELETE FROM Watched_Tag WHERE name = ?`
+
+	// provenance.go
+	searchProvenanceBase = `
+		SELECT id, name, digest, predicate_type, builder_id, statement, created_at
+		FROM Provenance`
+
+	searchProvenanceByDigest = ` WHERE digest = ? ORDER BY id`
+
+	searchProvenanceByStatement = ` WHERE digest = ? AND statement_hash = ?`
+
+	insertProvenance = `
+		INSERT IGNORE INTO Provenance(name, digest, predicate_type, builder_id, statement, statement_hash, created_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`
+
+	// image.go
+	insertImage = `INSERT IGNORE INTO Image(digest, layer_id, created_at) VALUES(?, ?, ?)`
+
+	searchImage = `
+		SELECT i.id, l.name, i.created_at
+		FROM Image i JOIN Layer l ON i.layer_id = l.id
+		WHERE i.digest = ?`
+
+	// layer_analysis.go
+	insertOrReplaceLayerAnalysis = `
+		INSERT INTO Layer_Analysis(digest, version, result, created_at) VALUES(?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE version = VALUES(version), result = VALUES(result),
+			created_at = VALUES(created_at)`
+
+	searchLayerAnalysis = `SELECT version, result, created_at FROM Layer_Analysis WHERE digest = ?`
+
+	// vulnerability.go
+	searchVulnerabilityBase = `
+		SELECT v.id, v.name, n.id, n.name, n.version_format, v.description, v.link, v.severity, v.metadata,
+			v.sources, v.cvss
+		FROM Vulnerability v JOIN Namespace n ON v.namespace_id = n.id`
+	searchVulnerabilityByNamespaceAndName = ` WHERE n.name = ? AND v.name = ? AND v.deleted_at IS NULL`
+	searchVulnerabilityByNamespace        = ` WHERE n.name = ? AND v.deleted_at IS NULL AND v.id >= ? ORDER BY v.id LIMIT ?`
+	searchVulnerabilityByID               = ` WHERE v.id = ?`
+	searchVulnerabilityForUpdate          = ` FOR UPDATE`
+
+	searchVulnerabilityFixedIn = `
+		SELECT vfif.version, f.id, f.name
+		FROM Vulnerability_FixedIn_Feature vfif JOIN Feature f ON vfif.feature_id = f.id
+		WHERE vfif.vulnerability_id = ?`
+
+	insertVulnerability = `
+		INSERT INTO Vulnerability(namespace_id, name, description, link, severity, metadata, sources,
+			cvss, created_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(6))`
+
+	updateVulnerabilityInPlace = `UPDATE Vulnerability SET metadata = ?, sources = ?, cvss = ? WHERE id = ?`
+
+	insertVulnerabilityFixedInFeature = `
+		INSERT INTO Vulnerability_FixedIn_Feature(vulnerability_id, feature_id, version)
+		VALUES(?, ?, ?)`
+
+	removeVulnerability = `UPDATE Vulnerability SET deleted_at = UTC_TIMESTAMP(6) WHERE id = ?`
+
+	// vulnerability_archive.go
+	archiveVulnerability = `
+		INSERT INTO Vulnerability_Archive(id, namespace_id, name, description, link, severity, metadata,
+			sources, cvss, created_at, deleted_at, archived_at)
+		SELECT id, namespace_id, name, description, link, severity, metadata, sources, cvss,
+			created_at, deleted_at, UTC_TIMESTAMP(6)
+		FROM Vulnerability
+		WHERE namespace_id = ?`
+
+	archiveVulnerabilityFixedInFeature = `
+		INSERT INTO Vulnerability_FixedIn_Feature_Archive(vulnerability_id, feature_id, version)
+		SELECT vfif.vulnerability_id, vfif.feature_id, vfif.version
+		FROM Vulnerability_FixedIn_Feature vfif JOIN Vulnerability v ON vfif.vulnerability_id = v.id
+		WHERE v.namespace_id = ?`
+
+	searchArchivedVulnerabilityBase = `
+		SELECT v.id, v.name, n.id, n.name, n.version_format, v.description, v.link, v.severity, v.metadata,
+			v.sources, v.cvss
+		FROM Vulnerability_Archive v JOIN Namespace n ON v.namespace_id = n.id`
+
+	searchArchivedVulnerabilityFixedIn = `
+		SELECT vfif.version, f.id, f.name
+		FROM Vulnerability_FixedIn_Feature_Archive vfif JOIN Feature f ON vfif.feature_id = f.id
+		WHERE vfif.vulnerability_id = ?`
+
+	// notification.go
+	insertNotification = `
+		INSERT INTO Vulnerability_Notification(name, created_at, old_vulnerability_id, new_vulnerability_id, priority, reason)
+		VALUES(?, UTC_TIMESTAMP(6), ?, ?, ?, ?)`
+
+	updatedNotificationNotified = `
+		UPDATE Vulnerability_Notification
+		SET notified_at = UTC_TIMESTAMP(6), failed_at = NULL
+		WHERE name = ?`
+
+	updatedNotificationFailed = `
+		UPDATE Vulnerability_Notification
+		SET failed_at = UTC_TIMESTAMP(6)
+		WHERE name = ?`
+
+	removeNotification = `
+		UPDATE Vulnerability_Notification
+		SET deleted_at = UTC_TIMESTAMP(6)
+		WHERE name = ?`
+
+	// searchNotificationAvailable skips the notifications of a vulnerability that has older pending
+	// notifications, so that the changes of a vulnerability are delivered in creation order, unless
+	// the older ones failed. As several notifications can be created within a microsecond, they are
+	// ordered by identifier.
+	searchNotificationAvailable = `
+		SELECT vn.id, vn.name, vn.created_at, vn.notified_at, vn.deleted_at, vn.failed_at, vn.priority, vn.reason
+		FROM Vulnerability_Notification vn
+			JOIN Vulnerability v ON v.id = COALESCE(vn.new_vulnerability_id, vn.old_vulnerability_id)
+		WHERE (vn.notified_at IS NULL OR vn.notified_at < UTC_TIMESTAMP(6) - INTERVAL ? MICROSECOND)
+			AND (vn.failed_at IS NULL OR vn.failed_at < UTC_TIMESTAMP(6) - INTERVAL ? MICROSECOND)
+			AND vn.deleted_at IS NULL
+			AND vn.name NOT IN (SELECT name FROM ` + "`Lock`" + `)
+			AND NOT EXISTS (
+				SELECT 1
+				FROM Vulnerability_Notification older
+					JOIN Vulnerability ov ON ov.id = COALESCE(older.new_vulnerability_id, older.old_vulnerability_id)
+				WHERE older.id < vn.id
+					AND older.notified_at IS NULL
+					AND older.deleted_at IS NULL
+					AND older.failed_at IS NULL
+					AND ov.namespace_id = v.namespace_id
+					AND ov.name = v.name)
+		ORDER BY vn.priority DESC, RAND()
+		LIMIT 1`
+
+	searchNotification = `
+		SELECT id, name, created_at, notified_at, deleted_at, failed_at, priority, reason, old_vulnerability_id, new_vulnerability_id
+		FROM Vulnerability_Notification
+		WHERE name = ?`
+
+	// searchNotificationLayerIntroducingVulnerability returns the layers adding a FeatureVersion of
+	// a Feature fixed by a Vulnerability, with the version of the FeatureVersion and the one of the
+	// fix, so that the affected ones can be selected.
+	searchNotificationLayerIntroducingVulnerability = `
+		SELECT l.id, l.name, fv.version, vfif.version
+		FROM Vulnerability_FixedIn_Feature vfif
+			JOIN FeatureVersion fv ON fv.feature_id = vfif.feature_id
+			JOIN Layer_FeatureVersion lfv ON lfv.featureversion_id = fv.id AND lfv.added_by = lfv.layer_id
+			JOIN Layer l ON lfv.layer_id = l.id
+		WHERE vfif.vulnerability_id = ? AND l.id >= ?
+		ORDER BY l.id`
+
+	// notification_delivery.go
+	searchNotificationID = `SELECT id FROM Vulnerability_Notification WHERE name = ?`
+
+	reopenNotificationDelivery = `
+		UPDATE Notification_Delivery d JOIN Vulnerability_Notification n ON d.notification_id = n.id
+		SET d.` + "`key`" + ` = ?, d.delivered_at = NULL
+		WHERE n.id = ?
+			AND d.notifier = ?
+			AND d.delivered_at IS NOT NULL
+			AND n.notified_at IS NOT NULL
+			AND d.delivered_at <= n.notified_at`
+
+	insertNotificationDelivery = `
+		INSERT INTO Notification_Delivery(notification_id, notifier, ` + "`key`" + `, created_at)
+		VALUES(?, ?, ?, UTC_TIMESTAMP(6))
+		ON DUPLICATE KEY UPDATE id = id`
+
+	searchNotificationDeliveryForUpdate = `
+		SELECT id, ` + "`key`" + `, created_at, delivered_at
+		FROM Notification_Delivery
+		WHERE notification_id = ? AND notifier = ?
+		FOR UPDATE`
+
+	insertNotificationDeliveryAttempt = `
+		INSERT INTO Notification_Delivery_Attempt(delivery_id, attempted_at, succeeded, error)
+		VALUES(?, UTC_TIMESTAMP(6), ?, ?)`
+
+	updateNotificationDeliveryDelivered = `
+		UPDATE Notification_Delivery
+		SET delivered_at = UTC_TIMESTAMP(6)
+		WHERE id = ? AND delivered_at IS NULL`
+
+	searchNotificationDelivery = `
+		SELECT d.id, d.notifier, d.` + "`key`" + `, d.created_at, d.delivered_at
+		FROM Notification_Delivery d JOIN Vulnerability_Notification n ON d.notification_id = n.id
+		WHERE n.name = ?
+		ORDER BY d.id`
+
+	// searchNotificationDeliveryAttempt is followed by the list of the identifiers of the
+	// deliveries.
+	searchNotificationDeliveryAttempt = `
+		SELECT delivery_id, id, attempted_at, succeeded, error
+		FROM Notification_Delivery_Attempt
+		WHERE delivery_id IN `
+
+	searchUndeliveredNotification = `
+		SELECT n.id, n.name, n.created_at, n.notified_at, n.deleted_at, n.priority, n.reason
+		FROM Notification_Delivery d JOIN Vulnerability_Notification n ON d.notification_id = n.id
+		WHERE d.notifier = ?
+			AND d.delivered_at IS NULL
+			AND n.notified_at IS NOT NULL
+			AND n.deleted_at IS NULL
+		ORDER BY n.id`
+
+	// keyvalue.go
+	insertOrReplaceKeyValue = "INSERT INTO KeyValue(`key`, value) VALUES(?, ?) ON DUPLICATE KEY UPDATE value = VALUES(value)"
+	searchKeyValue          = "SELECT value FROM KeyValue WHERE `key` = ?"
+
+	// lock.go
+	insertLock        = "INSERT INTO `Lock`(name, owner, until) VALUES(?, ?, ?)"
+	searchLock        = "SELECT owner, until FROM `Lock` WHERE name = ?"
+	updateLock        = "UPDATE `Lock` SET until = ? WHERE name = ? AND owner = ?"
+	removeLock        = "DELETE FROM `Lock` WHERE name = ? AND owner = ?"
+	removeLockExpired = "DELETE FROM `Lock` WHERE until < ?"
+)
+
+// schema creates the tables of the datastore if they don't exist yet.
+//
+// The columns that are part of an index are limited to 255 characters, which is what InnoDB can
+// index in utf8mb4 with the DYNAMIC row format. The strings are compared byte-wise, as they are by
+// the other datastores. The severities and priorities are enumerated from the lowest to the
+// highest, so that they are sorted the same way as types.Priority.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS Namespace (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL UNIQUE,
+		version_format VARCHAR(128) NOT NULL DEFAULT ''
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Feature (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		namespace_id INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		UNIQUE (namespace_id, name),
+		FOREIGN KEY (namespace_id) REFERENCES Namespace (id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS FeatureVersion (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		feature_id INT NOT NULL,
+		version VARCHAR(255) NOT NULL,
+		UNIQUE (feature_id, version),
+		FOREIGN KEY (feature_id) REFERENCES Feature (id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Layer (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL UNIQUE,
+		engineversion SMALLINT NOT NULL,
+		parent_id INT NULL,
+		namespace_id INT NULL,
+		stats TEXT NULL,
+		created_at DATETIME(6) NULL,
+		INDEX (parent_id),
+		FOREIGN KEY (parent_id) REFERENCES Layer (id) ON DELETE CASCADE,
+		FOREIGN KEY (namespace_id) REFERENCES Namespace (id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Layer_FeatureVersion (
+		layer_id INT NOT NULL,
+		featureversion_id INT NOT NULL,
+		added_by INT NOT NULL,
+		detector VARCHAR(128) NULL,
+		state VARCHAR(64) NULL,
+		evidence MEDIUMTEXT NULL,
+		PRIMARY KEY (layer_id, featureversion_id),
+		INDEX (featureversion_id),
+		INDEX (added_by),
+		FOREIGN KEY (layer_id) REFERENCES Layer (id) ON DELETE CASCADE,
+		FOREIGN KEY (featureversion_id) REFERENCES FeatureVersion (id),
+		FOREIGN KEY (added_by) REFERENCES Layer (id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Vulnerability (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		namespace_id INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		description TEXT NOT NULL,
+		link VARCHAR(2048) NOT NULL DEFAULT '',
+		severity ENUM('Unknown', 'Negligible', 'Low', 'Medium', 'High', 'Critical', 'Defcon1') NOT NULL,
+		metadata MEDIUMTEXT NULL,
+		sources TEXT NULL,
+		cvss TEXT NULL,
+		created_at DATETIME(6) NULL,
+		deleted_at DATETIME(6) NULL,
+		INDEX (namespace_id, name),
+		FOREIGN KEY (namespace_id) REFERENCES Namespace (id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Vulnerability_FixedIn_Feature (
+		vulnerability_id INT NOT NULL,
+		feature_id INT NOT NULL,
+		version VARCHAR(255) NOT NULL,
+		PRIMARY KEY (vulnerability_id, feature_id),
+		INDEX (feature_id),
+		FOREIGN KEY (vulnerability_id) REFERENCES Vulnerability (id) ON DELETE CASCADE,
+		FOREIGN KEY (feature_id) REFERENCES Feature (id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Vulnerability_Notification (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(64) NOT NULL UNIQUE,
+		created_at DATETIME(6) NULL,
+		notified_at DATETIME(6) NULL,
+		deleted_at DATETIME(6) NULL,
+		failed_at DATETIME(6) NULL,
+		old_vulnerability_id INT NULL,
+		new_vulnerability_id INT NULL,
+		priority ENUM('Unknown', 'Negligible', 'Low', 'Medium', 'High', 'Critical', 'Defcon1') NOT NULL DEFAULT 'Unknown',
+		reason VARCHAR(32) NULL,
+		INDEX (notified_at),
+		FOREIGN KEY (old_vulnerability_id) REFERENCES Vulnerability (id) ON DELETE CASCADE,
+		FOREIGN KEY (new_vulnerability_id) REFERENCES Vulnerability (id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	"CREATE TABLE IF NOT EXISTS Notification_Delivery (" + `
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		notification_id INT NOT NULL,
+		notifier VARCHAR(64) NOT NULL,
+		` + "`key`" + ` VARCHAR(64) NOT NULL,
+		created_at DATETIME(6) NULL,
+		delivered_at DATETIME(6) NULL,
+		UNIQUE (notification_id, notifier),
+		FOREIGN KEY (notification_id) REFERENCES Vulnerability_Notification (id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Notification_Delivery_Attempt (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		delivery_id INT NOT NULL,
+		attempted_at DATETIME(6) NULL,
+		succeeded BOOLEAN NOT NULL,
+		error TEXT NULL,
+		INDEX (delivery_id),
+		FOREIGN KEY (delivery_id) REFERENCES Notification_Delivery (id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	"CREATE TABLE IF NOT EXISTS KeyValue (" + `
+		` + "`key`" + ` VARCHAR(255) NOT NULL PRIMARY KEY,
+		value MEDIUMTEXT NULL
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	"CREATE TABLE IF NOT EXISTS `Lock` (" + `
+		name VARCHAR(64) NOT NULL PRIMARY KEY,
+		owner VARCHAR(64) NOT NULL,
+		until DATETIME(6) NOT NULL,
+		INDEX (until)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS False_Positive (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(64) NOT NULL UNIQUE,
+		namespace_id INT NOT NULL,
+		vulnerability_name VARCHAR(255) NOT NULL,
+		feature_name VARCHAR(255) NOT NULL,
+		feature_version VARCHAR(255) NOT NULL,
+		reason TEXT NOT NULL,
+		created_at DATETIME(6) NULL,
+		UNIQUE (namespace_id, vulnerability_name, feature_name, feature_version),
+		FOREIGN KEY (namespace_id) REFERENCES Namespace (id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Watched_Tag (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(64) NOT NULL UNIQUE,
+		registry VARCHAR(255) NOT NULL,
+		repository VARCHAR(255) NOT NULL,
+		tag VARCHAR(255) NOT NULL,
+		digest VARCHAR(255) NOT NULL DEFAULT '',
+		layer_name VARCHAR(255) NOT NULL DEFAULT '',
+		reported_digest VARCHAR(255) NOT NULL DEFAULT '',
+		signature VARCHAR(64) NOT NULL DEFAULT '',
+		attested VARCHAR(255) NOT NULL DEFAULT '',
+		published VARCHAR(255) NOT NULL DEFAULT '',
+		created_at DATETIME(6) NULL,
+		resolved_at DATETIME(6) NULL,
+		changed_at DATETIME(6) NULL,
+		UNIQUE (registry, repository, tag),
+		INDEX (layer_name)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Provenance (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(64) NOT NULL UNIQUE,
+		digest VARCHAR(255) NOT NULL,
+		predicate_type VARCHAR(255) NOT NULL,
+		builder_id VARCHAR(255) NOT NULL,
+		statement MEDIUMTEXT NOT NULL,
+		statement_hash CHAR(64) NOT NULL,
+		created_at DATETIME(6) NULL,
+		UNIQUE (digest, statement_hash)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	"CREATE TABLE IF NOT EXISTS Layer_Label (" + `
+		layer_id INT NOT NULL,
+		` + "`key`" + ` VARCHAR(255) NOT NULL,
+		value VARCHAR(255) NOT NULL,
+		PRIMARY KEY (layer_id, ` + "`key`" + `),
+		INDEX (` + "`key`" + `, value),
+		FOREIGN KEY (layer_id) REFERENCES Layer (id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Image (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		digest VARCHAR(255) NOT NULL UNIQUE,
+		layer_id INT NOT NULL,
+		created_at DATETIME(6) NULL,
+		FOREIGN KEY (layer_id) REFERENCES Layer (id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Layer_Analysis (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		digest VARCHAR(255) NOT NULL UNIQUE,
+		version VARCHAR(255) NOT NULL,
+		result MEDIUMTEXT NOT NULL,
+		created_at DATETIME(6) NULL
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	// The vulnerabilities of the namespaces that stopped being updated are archived with their
+	// original identifiers, along with their previous revisions.
+	`CREATE TABLE IF NOT EXISTS Vulnerability_Archive (
+		id INT NOT NULL PRIMARY KEY,
+		namespace_id INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		description TEXT NOT NULL,
+		link VARCHAR(2048) NOT NULL DEFAULT '',
+		severity ENUM('Unknown', 'Negligible', 'Low', 'Medium', 'High', 'Critical', 'Defcon1') NOT NULL,
+		metadata MEDIUMTEXT NULL,
+		sources TEXT NULL,
+		cvss TEXT NULL,
+		created_at DATETIME(6) NULL,
+		deleted_at DATETIME(6) NULL,
+		archived_at DATETIME(6) NULL,
+		INDEX (namespace_id, name),
+		FOREIGN KEY (namespace_id) REFERENCES Namespace (id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	`CREATE TABLE IF NOT EXISTS Vulnerability_FixedIn_Feature_Archive (
+		vulnerability_id INT NOT NULL,
+		feature_id INT NOT NULL,
+		version VARCHAR(255) NOT NULL,
+		PRIMARY KEY (vulnerability_id, feature_id),
+		INDEX (feature_id),
+		FOREIGN KEY (vulnerability_id) REFERENCES Vulnerability_Archive (id) ON DELETE CASCADE,
+		FOREIGN KEY (feature_id) REFERENCES Feature (id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+	// The Alpine namespaces created before the apk version format existed used the dpkg one.
+	`UPDATE Namespace SET version_format = 'apk' WHERE name LIKE 'alpine:%' AND version_format = 'dpkg'`,
+}
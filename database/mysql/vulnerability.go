@@ -0,0 +1,473 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/tracing"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// streamVulnerabilitiesPage is the number of vulnerabilities that StreamVulnerabilities reads at
+// once.
+const streamVulnerabilitiesPage = 500
+
+func (db *mySQL) ListVulnerabilities(namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
+	return listVulnerabilities(db, searchVulnerabilityBase, namespaceName, limit, startID)
+}
+
+func (db *mySQL) StreamVulnerabilities(namespaceName string, fn func(database.Vulnerability) error) error {
+	// Read every page from the same snapshot, so that the updaters running meanwhile can't make
+	// the stream skip or repeat vulnerabilities.
+	tx, err := db.Begin()
+	if err != nil {
+		return handleError("StreamVulnerabilities.Begin()", err)
+	}
+	defer tx.Rollback()
+
+	for startID := 0; startID != -1; {
+		var vulnerabilities []database.Vulnerability
+		vulnerabilities, startID, err = listVulnerabilities(tx, searchVulnerabilityBase, namespaceName, streamVulnerabilitiesPage, startID)
+		if err != nil {
+			return err
+		}
+
+		for _, vulnerability := range vulnerabilities {
+			if err = loadVulnerabilityFixedIn(tx, searchVulnerabilityFixedIn, &vulnerability); err != nil {
+				return err
+			}
+			if err = fn(vulnerability); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// listVulnerabilities returns a page of the vulnerabilities of a Namespace, read with the given
+// base query from either the current or the archived vulnerabilities.
+func listVulnerabilities(q queryer, baseQuery, namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
+	// Query Namespace.
+	var id int
+	err := q.QueryRow(searchNamespace, namespaceName).Scan(&id)
+	if err != nil {
+		return nil, -1, handleError("searchNamespace", err)
+	}
+
+	// Query.
+	query := baseQuery + searchVulnerabilityByNamespace
+	rows, err := q.Query(query, namespaceName, startID, limit+1)
+	if err != nil {
+		return nil, -1, handleError("searchVulnerabilityByNamespace", err)
+	}
+	defer rows.Close()
+
+	var vulns []database.Vulnerability
+	nextID := -1
+	size := 0
+	// Scan query.
+	for rows.Next() {
+		var vulnerability database.Vulnerability
+
+		err := rows.Scan(
+			&vulnerability.ID,
+			&vulnerability.Name,
+			&vulnerability.Namespace.ID,
+			&vulnerability.Namespace.Name,
+			&vulnerability.Namespace.VersionFormat,
+			&vulnerability.Description,
+			&vulnerability.Link,
+			&vulnerability.Severity,
+			&vulnerability.Metadata,
+			&vulnerability.Sources,
+			&vulnerability.CVSS,
+		)
+		if err != nil {
+			return nil, -1, handleError("searchVulnerabilityByNamespace.Scan()", err)
+		}
+		size++
+		if size > limit {
+			nextID = vulnerability.ID
+		} else {
+			vulns = append(vulns, vulnerability)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, -1, handleError("searchVulnerabilityByNamespace.Rows()", err)
+	}
+
+	return vulns, nextID, nil
+}
+
+func (db *mySQL) FindVulnerability(namespaceName, name string) (database.Vulnerability, error) {
+	return findVulnerability(db, namespaceName, name, false)
+}
+
+func findVulnerability(q queryer, namespaceName, name string, forUpdate bool) (database.Vulnerability, error) {
+	queryName := "searchVulnerabilityByNamespaceAndName"
+	query := searchVulnerabilityBase + searchVulnerabilityByNamespaceAndName
+	if forUpdate {
+		queryName += "+searchVulnerabilityForUpdate"
+		query += searchVulnerabilityForUpdate
+	}
+
+	return scanVulnerability(q, queryName, q.QueryRow(query, namespaceName, name), searchVulnerabilityFixedIn)
+}
+
+// findVulnerabilityByIDWithDeleted retrieves a revision of a Vulnerability, even if it has been
+// replaced or deleted since.
+func findVulnerabilityByIDWithDeleted(q queryer, id int) (database.Vulnerability, error) {
+	return scanVulnerability(q, "searchVulnerabilityByID", q.QueryRow(searchVulnerabilityBase+searchVulnerabilityByID, id), searchVulnerabilityFixedIn)
+}
+
+// scanVulnerability reads the Vulnerability of the given row, and its FixedIn list with the given
+// query.
+func scanVulnerability(q queryer, queryName string, row *sql.Row, fixedInQuery string) (database.Vulnerability, error) {
+	var vulnerability database.Vulnerability
+
+	err := row.Scan(
+		&vulnerability.ID,
+		&vulnerability.Name,
+		&vulnerability.Namespace.ID,
+		&vulnerability.Namespace.Name,
+		&vulnerability.Namespace.VersionFormat,
+		&vulnerability.Description,
+		&vulnerability.Link,
+		&vulnerability.Severity,
+		&vulnerability.Metadata,
+		&vulnerability.Sources,
+		&vulnerability.CVSS,
+	)
+	if err != nil {
+		return vulnerability, handleError(queryName+".Scan()", err)
+	}
+
+	err = loadVulnerabilityFixedIn(q, fixedInQuery, &vulnerability)
+	return vulnerability, err
+}
+
+// loadVulnerabilityFixedIn fills the FixedIn list of the given Vulnerability with the given query.
+func loadVulnerabilityFixedIn(q queryer, query string, vulnerability *database.Vulnerability) error {
+	rows, err := q.Query(query, vulnerability.ID)
+	if err != nil {
+		return handleError("searchVulnerabilityFixedIn", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version, featureName string
+		var featureID int
+
+		if err := rows.Scan(&version, &featureID, &featureName); err != nil {
+			return handleError("searchVulnerabilityFixedIn.Scan()", err)
+		}
+
+		// Note that the ID we fill in featureVersion is actually a Feature ID, and not
+		// a FeatureVersion ID.
+		vulnerability.FixedIn = append(vulnerability.FixedIn, database.FeatureVersion{
+			Model: database.Model{ID: featureID},
+			Feature: database.Feature{
+				Model:     database.Model{ID: featureID},
+				Namespace: vulnerability.Namespace,
+				Name:      featureName,
+			},
+			Version: version,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return handleError("searchVulnerabilityFixedIn.Rows()", err)
+	}
+
+	return nil
+}
+
+// InsertVulnerabilities inserts or updates the given Vulnerabilities.
+//
+// FixedIn.Namespace are not necessary, they are overwritten by the vuln.
+// By setting the fixed version to minVersion, we can say that the vuln does'nt affect anymore.
+func (db *mySQL) InsertVulnerabilities(vulnerabilities []database.Vulnerability, generateNotifications bool) error {
+	for _, vulnerability := range vulnerabilities {
+		err := withDeadlockRetry(func() error {
+			return db.insertVulnerability(vulnerability, false, generateNotifications)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *mySQL) insertVulnerability(vulnerability database.Vulnerability, onlyFixedIn, generateNotification bool) error {
+	// Verify parameters
+	if vulnerability.Name == "" || vulnerability.Namespace.Name == "" {
+		return cerrors.NewBadRequestError("insertVulnerability needs at least the Name and the Namespace")
+	}
+	if !onlyFixedIn && !vulnerability.Severity.IsValid() {
+		msg := fmt.Sprintf("could not insert a vulnerability that has an invalid Severity: %s", vulnerability.Severity)
+		log.Warning(msg)
+		return cerrors.NewBadRequestError(msg)
+	}
+	for i := 0; i < len(vulnerability.FixedIn); i++ {
+		fifv := &vulnerability.FixedIn[i]
+
+		if fifv.Feature.Namespace.Name == "" {
+			// As there is no Namespace on that FixedIn FeatureVersion, set it to the Vulnerability's
+			// Namespace.
+			fifv.Feature.Namespace.Name = vulnerability.Namespace.Name
+		} else if fifv.Feature.Namespace.Name != vulnerability.Namespace.Name {
+			msg := "could not insert an invalid vulnerability that contains FixedIn FeatureVersion that are not in the same namespace as the Vulnerability"
+			log.Warning(msg)
+			return cerrors.NewBadRequestError(msg)
+		}
+	}
+
+	// Begin transaction.
+	tx, err := db.Begin()
+	if err != nil {
+		return handleError("insertVulnerability.Begin()", err)
+	}
+
+	// Find existing vulnerability and its Vulnerability_FixedIn_Features (for update).
+	existingVulnerability, err := findVulnerability(tx, vulnerability.Namespace.Name, vulnerability.Name, true)
+	if err != nil && err != cerrors.ErrNotFound {
+		tx.Rollback()
+		return err
+	}
+
+	if onlyFixedIn {
+		// Because this call tries to update FixedIn FeatureVersion, import all other data from the
+		// existing one.
+		if existingVulnerability.ID == 0 {
+			tx.Rollback()
+			return cerrors.ErrNotFound
+		}
+
+		fixedIn := vulnerability.FixedIn
+		vulnerability = existingVulnerability
+		vulnerability.FixedIn = fixedIn
+	}
+
+	if existingVulnerability.ID != 0 {
+		// Construct the entire list of FixedIn FeatureVersion, by using the
+		// the FixedIn list of the old vulnerability.
+		vulnerability.FixedIn, _ = database.ApplyFixedInDiff(existingVulnerability.FixedIn, vulnerability.FixedIn)
+
+		if database.ContentHash(vulnerability) == database.ContentHash(existingVulnerability) {
+			// Nothing that matters to the affected images changed: update the Metadata, the Sources
+			// and the CVSS in place rather than creating a new revision and a notification.
+			if !reflect.DeepEqual(castMetadata(vulnerability.Metadata), existingVulnerability.Metadata) ||
+				!reflect.DeepEqual(vulnerability.Sources, existingVulnerability.Sources) ||
+				!reflect.DeepEqual(vulnerability.CVSS, existingVulnerability.CVSS) {
+				_, err = tx.Exec(updateVulnerabilityInPlace, &vulnerability.Metadata, &vulnerability.Sources, &vulnerability.CVSS, existingVulnerability.ID)
+				if err != nil {
+					tx.Rollback()
+					return handleError("updateVulnerabilityInPlace", err)
+				}
+			}
+
+			if err = tx.Commit(); err != nil {
+				return handleError("insertVulnerability.Commit()", err)
+			}
+			return nil
+		}
+
+		// Mark the old vulnerability as non latest.
+		if _, err = tx.Exec(removeVulnerability, existingVulnerability.ID); err != nil {
+			tx.Rollback()
+			return handleError("removeVulnerability", err)
+		}
+	} else {
+		// The vulnerability is new, we don't want to have any types.MinVersion as they are only used
+		// for diffing existing vulnerabilities.
+		var fixedIn []database.FeatureVersion
+		for _, fv := range vulnerability.FixedIn {
+			if fv.Version != versionfmt.MinVersion {
+				fixedIn = append(fixedIn, fv)
+			}
+		}
+		vulnerability.FixedIn = fixedIn
+	}
+
+	// Find or insert Vulnerability's Namespace.
+	namespaceID, err := insertNamespace(tx, vulnerability.Namespace)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Insert vulnerability.
+	r, err := tx.Exec(
+		insertVulnerability,
+		namespaceID,
+		vulnerability.Name,
+		vulnerability.Description,
+		vulnerability.Link,
+		&vulnerability.Severity,
+		&vulnerability.Metadata,
+		&vulnerability.Sources,
+		&vulnerability.CVSS,
+	)
+	if err != nil {
+		tx.Rollback()
+		return handleError("insertVulnerability", err)
+	}
+
+	id, err := r.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return handleError("insertVulnerability.LastInsertId()", err)
+	}
+	vulnerability.ID = int(id)
+
+	// Insert Vulnerability_FixedIn_Feature.
+	if err = insertVulnerabilityFixedInFeatures(tx, vulnerability.ID, vulnerability.FixedIn); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Create a notification.
+	if generateNotification {
+		priority := database.NotificationPriority(existingVulnerability.Severity, vulnerability.Severity)
+		reason := database.NotificationReasonNewVulnerability
+		if existingVulnerability.ID != 0 {
+			reason = database.NotificationReasonOf(&existingVulnerability, &vulnerability)
+		}
+		if err = createNotification(tx, existingVulnerability.ID, vulnerability.ID, priority, reason); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Commit transaction.
+	if err = tx.Commit(); err != nil {
+		return handleError("insertVulnerability.Commit()", err)
+	}
+
+	return nil
+}
+
+// insertVulnerabilityFixedInFeatures populates Vulnerability_FixedIn_Feature for the given
+// vulnerability with the specified database.FeatureVersion list.
+func insertVulnerabilityFixedInFeatures(tx *tracing.Tx, vulnerabilityID int, fixedIn []database.FeatureVersion) error {
+	for _, fv := range fixedIn {
+		featureID, err := insertFeature(tx, fv.Feature)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(insertVulnerabilityFixedInFeature, vulnerabilityID, featureID, fv.Version)
+		if err != nil {
+			return handleError("insertVulnerabilityFixedInFeature", err)
+		}
+	}
+
+	return nil
+}
+
+// castMetadata marshals the given database.MetadataMap and unmarshals it again to make sure that
+// everything has the interface{} type.
+// It is required when comparing crafted MetadataMap against MetadataMap that we get from the
+// database.
+func castMetadata(m database.MetadataMap) database.MetadataMap {
+	c := make(database.MetadataMap)
+	j, _ := json.Marshal(m)
+	json.Unmarshal(j, &c)
+	return c
+}
+
+func (db *mySQL) InsertVulnerabilityFixes(vulnerabilityNamespace, vulnerabilityName string, fixes []database.FeatureVersion) error {
+	v := database.Vulnerability{
+		Name: vulnerabilityName,
+		Namespace: database.Namespace{
+			Name: vulnerabilityNamespace,
+		},
+		FixedIn: fixes,
+	}
+
+	return withDeadlockRetry(func() error {
+		return db.insertVulnerability(v, true, true)
+	})
+}
+
+func (db *mySQL) DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerabilityName, featureName string) error {
+	v := database.Vulnerability{
+		Name: vulnerabilityName,
+		Namespace: database.Namespace{
+			Name: vulnerabilityNamespace,
+		},
+		FixedIn: []database.FeatureVersion{
+			{
+				Feature: database.Feature{
+					Name: featureName,
+					Namespace: database.Namespace{
+						Name: vulnerabilityNamespace,
+					},
+				},
+				Version: versionfmt.MinVersion,
+			},
+		},
+	}
+
+	return withDeadlockRetry(func() error {
+		return db.insertVulnerability(v, true, true)
+	})
+}
+
+func (db *mySQL) DeleteVulnerability(namespaceName, name string) error {
+	return withDeadlockRetry(func() error {
+		return db.deleteVulnerability(namespaceName, name)
+	})
+}
+
+func (db *mySQL) deleteVulnerability(namespaceName, name string) error {
+	// Begin transaction.
+	tx, err := db.Begin()
+	if err != nil {
+		return handleError("DeleteVulnerability.Begin()", err)
+	}
+
+	vulnerability, err := findVulnerability(tx, namespaceName, name, true)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.Exec(removeVulnerability, vulnerability.ID); err != nil {
+		tx.Rollback()
+		return handleError("removeVulnerability", err)
+	}
+
+	// Create a notification.
+	if err = createNotification(tx, vulnerability.ID, 0, vulnerability.Severity, database.NotificationReasonDeleted); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Commit transaction.
+	if err = tx.Commit(); err != nil {
+		return handleError("DeleteVulnerability.Commit()", err)
+	}
+
+	return nil
+}
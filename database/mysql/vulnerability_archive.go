@@ -0,0 +1,90 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// ArchiveVulnerabilities moves the vulnerabilities of a Namespace, including their previous
+// revisions, and their FixedIn rows into the archive tables, in a single transaction.
+func (db *mySQL) ArchiveVulnerabilities(namespaceName string) (int, error) {
+	if namespaceName == "" {
+		return 0, cerrors.NewBadRequestError("could not archive the vulnerabilities of an empty namespace")
+	}
+
+	var archived int
+	err := withDeadlockRetry(func() (err error) {
+		archived, err = db.archiveVulnerabilities(namespaceName)
+		return
+	})
+	return archived, err
+}
+
+func (db *mySQL) archiveVulnerabilities(namespaceName string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, handleError("ArchiveVulnerabilities.Begin()", err)
+	}
+
+	// Lock the namespace, so that no vulnerability can be inserted into it meanwhile.
+	var namespaceID int
+	if err = tx.QueryRow(searchNamespaceForUpdate, namespaceName).Scan(&namespaceID); err != nil {
+		tx.Rollback()
+		return 0, handleError("searchNamespaceForUpdate", err)
+	}
+
+	result, err := tx.Exec(archiveVulnerability, namespaceID)
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("archiveVulnerability", err)
+	}
+	archived, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("archiveVulnerability.RowsAffected()", err)
+	}
+
+	if _, err = tx.Exec(archiveVulnerabilityFixedInFeature, namespaceID); err != nil {
+		tx.Rollback()
+		return 0, handleError("archiveVulnerabilityFixedInFeature", err)
+	}
+
+	// Removing the vulnerabilities cascades to their FixedIn rows and to the notifications that
+	// reference them.
+	if _, err = tx.Exec(pruneVulnerability, namespaceID); err != nil {
+		tx.Rollback()
+		return 0, handleError("pruneVulnerability", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, handleError("ArchiveVulnerabilities.Commit()", err)
+	}
+
+	return int(archived), nil
+}
+
+func (db *mySQL) ListArchivedVulnerabilities(namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
+	return listVulnerabilities(db, searchArchivedVulnerabilityBase, namespaceName, limit, startID)
+}
+
+func (db *mySQL) FindArchivedVulnerability(namespaceName, name string) (database.Vulnerability, error) {
+	queryName := "searchArchivedVulnerabilityBase+searchVulnerabilityByNamespaceAndName"
+	query := searchArchivedVulnerabilityBase + searchVulnerabilityByNamespaceAndName
+
+	return scanVulnerability(db, queryName, db.QueryRow(query, namespaceName, name), searchArchivedVulnerabilityFixedIn)
+}
@@ -0,0 +1,203 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"time"
+
+	"github.com/guregu/null/zero"
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertWatchedTag starts watching a tag, or returns the existing WatchedTag.
+func (db *mySQL) InsertWatchedTag(watchedTag database.WatchedTag) (database.WatchedTag, error) {
+	if watchedTag.Registry == "" || watchedTag.Repository == "" || watchedTag.Tag == "" {
+		return watchedTag, cerrors.NewBadRequestError("could not insert a watched tag which does not have a registry, a repository and a tag")
+	}
+
+	_, err := db.Exec(insertWatchedTag, uuid.New(), watchedTag.Registry, watchedTag.Repository, watchedTag.Tag,
+		time.Now().UTC())
+	if err != nil {
+		return watchedTag, handleError("insertWatchedTag", err)
+	}
+
+	watchedTags, err := searchWatchedTags(db, searchWatchedTagByReference, watchedTag.Registry, watchedTag.Repository, watchedTag.Tag)
+	if err != nil {
+		return watchedTag, err
+	}
+	if len(watchedTags) == 0 {
+		return watchedTag, cerrors.ErrNotFound
+	}
+	return watchedTags[0], nil
+}
+
+// FindWatchedTag retrieves a WatchedTag by its name.
+func (db *mySQL) FindWatchedTag(name string) (database.WatchedTag, error) {
+	watchedTags, err := searchWatchedTags(db, searchWatchedTagByName, name)
+	if err != nil {
+		return database.WatchedTag{}, err
+	}
+	if len(watchedTags) == 0 {
+		return database.WatchedTag{}, cerrors.ErrNotFound
+	}
+	return watchedTags[0], nil
+}
+
+// ListWatchedTags paginates over every watched tag.
+func (db *mySQL) ListWatchedTags(limit int, startID int) ([]database.WatchedTag, int, error) {
+	watchedTags, err := searchWatchedTags(db, searchWatchedTagPage, startID, limit+1)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	nextID := -1
+	if len(watchedTags) > limit {
+		nextID = watchedTags[limit].ID
+		watchedTags = watchedTags[:limit]
+	}
+	return watchedTags, nextID, nil
+}
+
+// ListMovedWatchedTags paginates over the watched tags that moved since their last report.
+func (db *mySQL) ListMovedWatchedTags(limit int, startID int) ([]database.WatchedTag, int, error) {
+	watchedTags, err := searchWatchedTags(db, searchMovedWatchedTagPage, startID, limit+1)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	nextID := -1
+	if len(watchedTags) > limit {
+		nextID = watchedTags[limit].ID
+		watchedTags = watchedTags[:limit]
+	}
+	return watchedTags, nextID, nil
+}
+
+// ListNotificationWatchedTags returns the watched tags whose image is affected by a notification.
+func (db *mySQL) ListNotificationWatchedTags(name string) ([]database.WatchedTag, error) {
+	// Read the notification and the layers from the same snapshot.
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, handleError("ListNotificationWatchedTags.Begin()", err)
+	}
+	defer tx.Rollback()
+
+	layerIDs, err := searchNotificationAffectedLayers(tx, name)
+	if err != nil || len(layerIDs) == 0 {
+		return nil, err
+	}
+
+	return searchWatchedTags(tx, searchWatchedTagByLayerIDs+"("+placeholders(len(layerIDs))+")) ORDER BY id", intArgs(layerIDs)...)
+}
+
+func searchWatchedTags(q queryer, condition string, args ...interface{}) ([]database.WatchedTag, error) {
+	rows, err := q.Query(searchWatchedTagBase+condition, args...)
+	if err != nil {
+		return nil, handleError("searchWatchedTag", err)
+	}
+	defer rows.Close()
+
+	var watchedTags []database.WatchedTag
+	for rows.Next() {
+		var watchedTag database.WatchedTag
+		var resolved, changed zero.Time
+		err := rows.Scan(
+			&watchedTag.ID,
+			&watchedTag.Name,
+			&watchedTag.Registry,
+			&watchedTag.Repository,
+			&watchedTag.Tag,
+			&watchedTag.Digest,
+			&watchedTag.LayerName,
+			&watchedTag.ReportedDigest,
+			&watchedTag.Signature,
+			&watchedTag.Attested,
+			&watchedTag.Published,
+			&watchedTag.Created,
+			&resolved,
+			&changed,
+		)
+		if err != nil {
+			return nil, handleError("searchWatchedTag.Scan()", err)
+		}
+		watchedTag.Resolved = resolved.Time
+		watchedTag.Changed = changed.Time
+		watchedTags = append(watchedTags, watchedTag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchWatchedTag.Rows()", err)
+	}
+
+	return watchedTags, nil
+}
+
+// UpdateWatchedTag stores the resolution of a watched tag.
+func (db *mySQL) UpdateWatchedTag(watchedTag database.WatchedTag) error {
+	result, err := db.Exec(updateWatchedTag, watchedTag.Digest, watchedTag.LayerName,
+		zero.TimeFrom(watchedTag.Resolved), zero.TimeFrom(watchedTag.Changed),
+		string(watchedTag.Signature), watchedTag.Attested, watchedTag.Published, watchedTag.Name)
+	if err != nil {
+		return handleError("updateWatchedTag", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("updateWatchedTag.RowsAffected()", err)
+	}
+	if affected <= 0 {
+		return cerrors.ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkWatchedTagReported sets the digest a watched tag pointed to when it was last reported.
+func (db *mySQL) MarkWatchedTagReported(name, digest string) error {
+	result, err := db.Exec(updateWatchedTagReported, digest, name)
+	if err != nil {
+		return handleError("updateWatchedTagReported", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("updateWatchedTagReported.RowsAffected()", err)
+	}
+	if affected <= 0 {
+		return cerrors.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteWatchedTag stops watching a tag.
+func (db *mySQL) DeleteWatchedTag(name string) error {
+	result, err := db.Exec(removeWatchedTag, name)
+	if err != nil {
+		return handleError("removeWatchedTag", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("removeWatchedTag.RowsAffected()", err)
+	}
+	if affected <= 0 {
+		return cerrors.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import cerrors "github.com/coreos/clair/utils/errors"
+
+// NotificationLayersDiff is a page of the difference between the Layers introducing the old and
+// the new revision of the Vulnerability of a VulnerabilityNotification.
+type NotificationLayersDiff struct {
+	// Added are the Layers that only introduce the new revision, Removed the ones that only
+	// introduce the old one and Unchanged the ones that introduce both, ordered by ID.
+	Added     []Layer
+	Removed   []Layer
+	Unchanged []Layer
+}
+
+// DiffNotificationLayers returns the VulnerabilityNotification of the given name along with the
+// difference between the Layers introducing its old and its new Vulnerability, starting at the
+// Layer of the given ID and spanning up to limit Layers of each revision.
+//
+// The Layers of both revisions are merged by ID, so that a Layer is never split across pages.
+// The returned ID starts the next page, and is -1 on the last one.
+func DiffNotificationLayers(datastore Datastore, name string, limit, startID int) (VulnerabilityNotification, NotificationLayersDiff, int, error) {
+	var diff NotificationLayersDiff
+	if limit <= 0 {
+		return VulnerabilityNotification{}, diff, -1, cerrors.NewBadRequestError("the limit should be greater than zero")
+	}
+	if startID < 0 {
+		return VulnerabilityNotification{}, diff, -1, cerrors.NewBadRequestError("the start ID should not be negative")
+	}
+
+	page := VulnerabilityNotificationPageNumber{OldVulnerability: startID, NewVulnerability: startID}
+	notification, nextPage, err := datastore.GetNotification(name, limit, page)
+	if err != nil {
+		return notification, diff, -1, err
+	}
+
+	// The page ends before the first Layer that was left out of either revision, as the other one
+	// may still introduce it.
+	nextID := -1
+	for _, id := range []int{nextPage.OldVulnerability, nextPage.NewVulnerability} {
+		if id != -1 && (nextID == -1 || id < nextID) {
+			nextID = id
+		}
+	}
+	inPage := func(layer Layer) bool {
+		return nextID == -1 || layer.ID < nextID
+	}
+
+	var oldLayers, newLayers []Layer
+	if notification.OldVulnerability != nil {
+		oldLayers = notification.OldVulnerability.LayersIntroducingVulnerability
+	}
+	if notification.NewVulnerability != nil {
+		newLayers = notification.NewVulnerability.LayersIntroducingVulnerability
+	}
+
+	for len(oldLayers) > 0 || len(newLayers) > 0 {
+		switch {
+		case len(newLayers) == 0 || len(oldLayers) > 0 && oldLayers[0].ID < newLayers[0].ID:
+			if inPage(oldLayers[0]) {
+				diff.Removed = append(diff.Removed, oldLayers[0])
+			}
+			oldLayers = oldLayers[1:]
+		case len(oldLayers) == 0 || newLayers[0].ID < oldLayers[0].ID:
+			if inPage(newLayers[0]) {
+				diff.Added = append(diff.Added, newLayers[0])
+			}
+			newLayers = newLayers[1:]
+		default:
+			if inPage(newLayers[0]) {
+				diff.Unchanged = append(diff.Unchanged, newLayers[0])
+			}
+			oldLayers, newLayers = oldLayers[1:], newLayers[1:]
+		}
+	}
+
+	return notification, diff, nextID, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffNotificationLayers(t *testing.T) {
+	layers := func(ids ...int) []Layer {
+		var layers []Layer
+		for _, id := range ids {
+			layers = append(layers, Layer{Model: Model{ID: id}})
+		}
+		return layers
+	}
+	oldLayers, newLayers := layers(1, 2, 3, 5, 8), layers(2, 4, 5, 6, 7, 9)
+
+	// Paginate the layers by ID, like the backends do.
+	paginate := func(all []Layer, limit, startID int) ([]Layer, int) {
+		var page []Layer
+		for _, layer := range all {
+			if startID == -1 || layer.ID < startID {
+				continue
+			}
+			if len(page) == limit {
+				return page, layer.ID
+			}
+			page = append(page, layer)
+		}
+		return page, -1
+	}
+	datastore := &MockDatastore{
+		FctGetNotification: func(name string, limit int, page VulnerabilityNotificationPageNumber) (VulnerabilityNotification, VulnerabilityNotificationPageNumber, error) {
+			notification := VulnerabilityNotification{
+				Name:             name,
+				OldVulnerability: &Vulnerability{},
+				NewVulnerability: &Vulnerability{},
+			}
+			notification.OldVulnerability.LayersIntroducingVulnerability, page.OldVulnerability = paginate(oldLayers, limit, page.OldVulnerability)
+			notification.NewVulnerability.LayersIntroducingVulnerability, page.NewVulnerability = paginate(newLayers, limit, page.NewVulnerability)
+			return notification, page, nil
+		},
+	}
+
+	var diff NotificationLayersDiff
+	var pages int
+	for startID := 0; startID != -1; pages++ {
+		notification, page, nextID, err := DiffNotificationLayers(datastore, "notification", 2, startID)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, "notification", notification.Name)
+		assert.True(t, nextID == -1 || nextID > startID)
+
+		diff.Added = append(diff.Added, page.Added...)
+		diff.Removed = append(diff.Removed, page.Removed...)
+		diff.Unchanged = append(diff.Unchanged, page.Unchanged...)
+		startID = nextID
+	}
+	assert.Equal(t, 4, pages)
+	assert.Equal(t, layers(4, 6, 7, 9), diff.Added)
+	assert.Equal(t, layers(1, 3, 8), diff.Removed)
+	assert.Equal(t, layers(2, 5), diff.Unchanged)
+
+	// Notifications of created vulnerabilities only add layers.
+	oldLayers = nil
+	_, page, nextID, err := DiffNotificationLayers(datastore, "notification", 10, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, nextID)
+	assert.Equal(t, newLayers, page.Added)
+	assert.Empty(t, page.Removed)
+	assert.Empty(t, page.Unchanged)
+
+	_, _, _, err = DiffNotificationLayers(datastore, "notification", 0, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// A NotificationNameGenerator returns a new unique name for a VulnerabilityNotification.
+type NotificationNameGenerator func() string
+
+const (
+	// DefaultNotificationNameFormat names the notifications with random UUIDs.
+	DefaultNotificationNameFormat = "uuid"
+
+	// crockfordAlphabet is the base32 alphabet of the ULIDs.
+	crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+var (
+	notificationNamesM    sync.RWMutex
+	notificationNames     = make(map[string]NotificationNameGenerator)
+	notificationNamesUsed = uuid.New
+)
+
+func init() {
+	RegisterNotificationNameFormat(DefaultNotificationNameFormat, uuid.New)
+	RegisterNotificationNameFormat("uuidv7", newUUIDv7)
+	RegisterNotificationNameFormat("ulid", newULID)
+}
+
+// RegisterNotificationNameFormat makes a NotificationNameGenerator available by the provided
+// format. If RegisterNotificationNameFormat is called twice with the same format or if generator
+// is nil, it panics.
+func RegisterNotificationNameFormat(format string, generator NotificationNameGenerator) {
+	if format == "" {
+		panic("database: could not register a NotificationNameGenerator with an empty format")
+	}
+	if generator == nil {
+		panic("database: could not register a nil NotificationNameGenerator")
+	}
+
+	notificationNamesM.Lock()
+	defer notificationNamesM.Unlock()
+
+	if _, dup := notificationNames[format]; dup {
+		panic("database: RegisterNotificationNameFormat called twice for " + format)
+	}
+	notificationNames[format] = generator
+}
+
+// UseNotificationNameFormat makes the datastores name the new notifications using the
+// NotificationNameGenerator registered with the given format, the default one if it is empty.
+//
+// Time-ordered names, such as "uuidv7" or "ulid", keep the new notifications together in the
+// indexes on their name, instead of scattering them as random UUIDs do.
+func UseNotificationNameFormat(format string) error {
+	if format == "" {
+		format = DefaultNotificationNameFormat
+	}
+
+	notificationNamesM.Lock()
+	defer notificationNamesM.Unlock()
+
+	generator, ok := notificationNames[format]
+	if !ok {
+		return fmt.Errorf("database: unknown notification name format %q", format)
+	}
+	notificationNamesUsed = generator
+	return nil
+}
+
+// NewNotificationName returns a new name for a VulnerabilityNotification, in the format that
+// UseNotificationNameFormat set.
+func NewNotificationName() string {
+	notificationNamesM.RLock()
+	defer notificationNamesM.RUnlock()
+
+	return notificationNamesUsed()
+}
+
+// newUUIDv7 returns a UUID of version 7, whose first 48 bits are the Unix time in milliseconds.
+func newUUIDv7() string {
+	id := make(uuid.UUID, 16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic("database: could not read random bytes: " + err.Error())
+	}
+	putMilliseconds(id, time.Now())
+	id[6] = id[6]&0x0f | 0x70 // Version 7.
+	id[8] = id[8]&0x3f | 0x80 // Variant RFC 4122.
+	return id.String()
+}
+
+// newULID returns a ULID, whose first 48 bits are the Unix time in milliseconds, followed by 80
+// random bits, encoded as 26 characters of Crockford's base32.
+func newULID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic("database: could not read random bytes: " + err.Error())
+	}
+	putMilliseconds(id[:], time.Now())
+
+	// The 128 bits are encoded by groups of 5 bits, the first character holding the 3 first ones.
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	var name [26]byte
+	for i := len(name) - 1; i >= 0; i-- {
+		name[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(name[:])
+}
+
+// putMilliseconds writes the Unix time of t in milliseconds in the first 6 bytes of b.
+func putMilliseconds(b []byte, t time.Time) {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationNameFormats(t *testing.T) {
+	defer UseNotificationNameFormat("")
+
+	formats := map[string]*regexp.Regexp{
+		"uuid":   regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		"uuidv7": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		"ulid":   regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+	}
+	for format, pattern := range formats {
+		if !assert.Nil(t, UseNotificationNameFormat(format)) {
+			continue
+		}
+		for i := 0; i < 10; i++ {
+			name := NewNotificationName()
+			assert.Regexp(t, pattern, name, format)
+		}
+	}
+
+	assert.Error(t, UseNotificationNameFormat("unknown"))
+}
+
+func TestTimeOrderedNotificationNames(t *testing.T) {
+	for _, generator := range []NotificationNameGenerator{newUUIDv7, newULID} {
+		var names []string
+		for i := 0; i < 3; i++ {
+			names = append(names, generator())
+			time.Sleep(2 * time.Millisecond)
+		}
+		assert.True(t, sort.StringsAreSorted(names), "%v", names)
+	}
+
+	// The timestamp is encoded first.
+	id := make([]byte, 16)
+	putMilliseconds(id, time.Unix(0, 0x010203040506*int64(time.Millisecond)))
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6}, id[:6])
+}
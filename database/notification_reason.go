@@ -0,0 +1,104 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/utils/types"
+)
+
+// NotificationReason is the kind of change of a Vulnerability that a VulnerabilityNotification
+// announces, so that its consumers can filter notifications without comparing the old and new
+// Vulnerabilities themselves.
+type NotificationReason string
+
+const (
+	// NotificationReasonNewVulnerability announces a Vulnerability that didn't exist before.
+	NotificationReasonNewVulnerability NotificationReason = "NewVulnerability"
+	// NotificationReasonDeleted announces the deletion of a Vulnerability.
+	NotificationReasonDeleted NotificationReason = "Deleted"
+	// NotificationReasonFixRemoved announces that a Feature isn't known to be fixed anymore.
+	NotificationReasonFixRemoved NotificationReason = "FixRemoved"
+	// NotificationReasonSeverityChanged announces a new Severity.
+	NotificationReasonSeverityChanged NotificationReason = "SeverityChanged"
+	// NotificationReasonFixAdded announces that a Feature is fixed in a new version.
+	NotificationReasonFixAdded NotificationReason = "FixAdded"
+	// NotificationReasonUpdated announces any other change, e.g. of the Description or of the
+	// affected Features.
+	NotificationReasonUpdated NotificationReason = "Updated"
+)
+
+// NotificationReasonOf classifies the change from the old to the new revision of a Vulnerability,
+// either of which is nil when the Vulnerability has been created or deleted.
+//
+// When a change falls into several classes, the one that is the most likely to require action is
+// returned: a removed fix first, then a new severity and finally a new fix.
+func NotificationReasonOf(oldVulnerability, newVulnerability *Vulnerability) NotificationReason {
+	switch {
+	case oldVulnerability == nil:
+		return NotificationReasonNewVulnerability
+	case newVulnerability == nil:
+		return NotificationReasonDeleted
+	}
+
+	oldFixes, newFixes := fixedVersions(oldVulnerability.FixedIn), fixedVersions(newVulnerability.FixedIn)
+	fixAdded, fixRemoved := false, false
+	for feature, version := range newFixes {
+		if oldFixes[feature] != version {
+			fixAdded = true
+		}
+	}
+	for feature := range oldFixes {
+		if _, ok := newFixes[feature]; !ok {
+			fixRemoved = true
+		}
+	}
+
+	switch {
+	case fixRemoved:
+		return NotificationReasonFixRemoved
+	case oldVulnerability.Severity != newVulnerability.Severity:
+		return NotificationReasonSeverityChanged
+	case fixAdded:
+		return NotificationReasonFixAdded
+	default:
+		return NotificationReasonUpdated
+	}
+}
+
+// fixedVersions maps the names of the Features of the given FixedIn list that have a fix to the
+// version that fixes them.
+func fixedVersions(fixedIn []FeatureVersion) map[string]string {
+	fixes := make(map[string]string)
+	for _, fv := range fixedIn {
+		if fv.Version == "" || fv.Version == versionfmt.MinVersion || fv.Version == versionfmt.MaxVersion {
+			continue
+		}
+		fixes[fv.Feature.Name] = fv.Version
+	}
+	return fixes
+}
+
+// NotificationPriority returns the highest valid severity amongst the given ones, which the
+// datastores use as the delivery lane of a VulnerabilityNotification.
+func NotificationPriority(severities ...types.Priority) types.Priority {
+	priority := types.Unknown
+	for _, severity := range severities {
+		if severity.IsValid() && severity.Compare(priority) > 0 {
+			priority = severity
+		}
+	}
+	return priority
+}
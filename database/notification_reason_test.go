@@ -0,0 +1,65 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/utils/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationReasonOf(t *testing.T) {
+	fixedIn := func(name, version string) FeatureVersion {
+		return FeatureVersion{Feature: Feature{Name: name}, Version: version}
+	}
+	vulnerability := Vulnerability{
+		Name:     "CVE-2016-2108",
+		Severity: types.High,
+		FixedIn:  []FeatureVersion{fixedIn("openssl", "1.0.2g"), fixedIn("libssl", versionfmt.MaxVersion)},
+	}
+
+	assert.Equal(t, NotificationReasonNewVulnerability, NotificationReasonOf(nil, &vulnerability))
+	assert.Equal(t, NotificationReasonDeleted, NotificationReasonOf(&vulnerability, nil))
+
+	changed := vulnerability
+	changed.Description = "ASN.1 encoder negative zero memory corruption"
+	assert.Equal(t, NotificationReasonUpdated, NotificationReasonOf(&vulnerability, &changed))
+
+	changed = vulnerability
+	changed.Severity = types.Critical
+	assert.Equal(t, NotificationReasonSeverityChanged, NotificationReasonOf(&vulnerability, &changed))
+
+	// A Feature that gets a fix, or a new fix.
+	changed = vulnerability
+	changed.FixedIn = []FeatureVersion{fixedIn("openssl", "1.0.2g"), fixedIn("libssl", "1.0.2g")}
+	assert.Equal(t, NotificationReasonFixAdded, NotificationReasonOf(&vulnerability, &changed))
+	changed.FixedIn = []FeatureVersion{fixedIn("openssl", "1.0.2h"), fixedIn("libssl", versionfmt.MaxVersion)}
+	assert.Equal(t, NotificationReasonFixAdded, NotificationReasonOf(&vulnerability, &changed))
+
+	// A removed fix takes precedence over the other changes.
+	changed = vulnerability
+	changed.Severity = types.Critical
+	changed.FixedIn = []FeatureVersion{fixedIn("openssl", versionfmt.MaxVersion), fixedIn("libssl", "1.0.2g")}
+	assert.Equal(t, NotificationReasonFixRemoved, NotificationReasonOf(&vulnerability, &changed))
+}
+
+func TestNotificationPriority(t *testing.T) {
+	assert.Equal(t, types.Unknown, NotificationPriority())
+	assert.Equal(t, types.Unknown, NotificationPriority(""))
+	assert.Equal(t, types.High, NotificationPriority("", types.High))
+	assert.Equal(t, types.Critical, NotificationPriority(types.Critical, types.Low))
+}
@@ -0,0 +1,329 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// An Observer is notified of the calls to the methods of an observed Datastore.
+type Observer interface {
+	// ObserveCall is called after every call to a method, with its duration and the error it
+	// returned, if any.
+	ObserveCall(method string, duration time.Duration, err error)
+
+	// ObserveLock is called after every attempt to acquire or renew a Lock, with its result.
+	ObserveLock(name string, renew, locked bool)
+}
+
+// observedDatastore notifies an Observer of the calls to the methods of a Datastore.
+type observedDatastore struct {
+	Datastore
+	observer Observer
+}
+
+// Observe returns a Datastore notifying the given Observer of the calls to the methods of the
+// given one, e.g. to measure their latency.
+func Observe(datastore Datastore, observer Observer) Datastore {
+	return &observedDatastore{Datastore: datastore, observer: observer}
+}
+
+// observe notifies the Observer of the call to a method that started at the given time, and of
+// its error, if any.
+func (ds *observedDatastore) observe(method string, start time.Time, err *error) {
+	var e error
+	if err != nil {
+		e = *err
+	}
+	ds.observer.ObserveCall(method, time.Since(start), e)
+}
+
+func (ds *observedDatastore) Lock(name string, owner string, duration time.Duration, renew bool) (bool, time.Time) {
+	defer ds.observe("Lock", time.Now(), nil)
+	locked, until := ds.Datastore.Lock(name, owner, duration, renew)
+	ds.observer.ObserveLock(name, renew, locked)
+	return locked, until
+}
+
+func (ds *observedDatastore) ListNamespaces() (_ []Namespace, err error) {
+	defer ds.observe("ListNamespaces", time.Now(), &err)
+	return ds.Datastore.ListNamespaces()
+}
+
+func (ds *observedDatastore) InsertLayer(layer Layer) (err error) {
+	defer ds.observe("InsertLayer", time.Now(), &err)
+	return ds.Datastore.InsertLayer(layer)
+}
+
+func (ds *observedDatastore) FindLayer(name string, withFeatures, withVulnerabilities bool) (_ Layer, err error) {
+	defer ds.observe("FindLayer", time.Now(), &err)
+	return ds.Datastore.FindLayer(name, withFeatures, withVulnerabilities)
+}
+
+func (ds *observedDatastore) DeleteLayer(name string) (err error) {
+	defer ds.observe("DeleteLayer", time.Now(), &err)
+	return ds.Datastore.DeleteLayer(name)
+}
+
+func (ds *observedDatastore) ListVulnerabilities(namespaceName string, limit int, page int) (_ []Vulnerability, _ int, err error) {
+	defer ds.observe("ListVulnerabilities", time.Now(), &err)
+	return ds.Datastore.ListVulnerabilities(namespaceName, limit, page)
+}
+
+func (ds *observedDatastore) StreamVulnerabilities(namespaceName string, fn func(Vulnerability) error) error {
+	defer ds.observe("StreamVulnerabilities", time.Now(), nil)
+	return ds.Datastore.StreamVulnerabilities(namespaceName, fn)
+}
+
+func (ds *observedDatastore) InsertVulnerabilities(vulnerabilities []Vulnerability, createNotification bool) (err error) {
+	defer ds.observe("InsertVulnerabilities", time.Now(), &err)
+	return ds.Datastore.InsertVulnerabilities(vulnerabilities, createNotification)
+}
+
+func (ds *observedDatastore) FindVulnerability(namespaceName, name string) (_ Vulnerability, err error) {
+	defer ds.observe("FindVulnerability", time.Now(), &err)
+	return ds.Datastore.FindVulnerability(namespaceName, name)
+}
+
+func (ds *observedDatastore) DeleteVulnerability(namespaceName, name string) (err error) {
+	defer ds.observe("DeleteVulnerability", time.Now(), &err)
+	return ds.Datastore.DeleteVulnerability(namespaceName, name)
+}
+
+func (ds *observedDatastore) InsertVulnerabilityFixes(vulnerabilityNamespace, vulnerabilityName string, fixes []FeatureVersion) (err error) {
+	defer ds.observe("InsertVulnerabilityFixes", time.Now(), &err)
+	return ds.Datastore.InsertVulnerabilityFixes(vulnerabilityNamespace, vulnerabilityName, fixes)
+}
+
+func (ds *observedDatastore) DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerabilityName, featureName string) (err error) {
+	defer ds.observe("DeleteVulnerabilityFix", time.Now(), &err)
+	return ds.Datastore.DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerabilityName, featureName)
+}
+
+func (ds *observedDatastore) ArchiveVulnerabilities(namespaceName string) (_ int, err error) {
+	defer ds.observe("ArchiveVulnerabilities", time.Now(), &err)
+	return ds.Datastore.ArchiveVulnerabilities(namespaceName)
+}
+
+func (ds *observedDatastore) ListArchivedVulnerabilities(namespaceName string, limit int, page int) (_ []Vulnerability, _ int, err error) {
+	defer ds.observe("ListArchivedVulnerabilities", time.Now(), &err)
+	return ds.Datastore.ListArchivedVulnerabilities(namespaceName, limit, page)
+}
+
+func (ds *observedDatastore) FindArchivedVulnerability(namespaceName, name string) (_ Vulnerability, err error) {
+	defer ds.observe("FindArchivedVulnerability", time.Now(), &err)
+	return ds.Datastore.FindArchivedVulnerability(namespaceName, name)
+}
+
+func (ds *observedDatastore) ListUnusedNamespaces() (_ []Namespace, err error) {
+	defer ds.observe("ListUnusedNamespaces", time.Now(), &err)
+	return ds.Datastore.ListUnusedNamespaces()
+}
+
+func (ds *observedDatastore) PruneNamespace(name string) (_ PrunedNamespace, err error) {
+	defer ds.observe("PruneNamespace", time.Now(), &err)
+	return ds.Datastore.PruneNamespace(name)
+}
+
+func (ds *observedDatastore) GetAvailableNotification(renotifyInterval time.Duration, owner string, lockDuration time.Duration) (_ VulnerabilityNotification, err error) {
+	defer ds.observe("GetAvailableNotification", time.Now(), &err)
+	return ds.Datastore.GetAvailableNotification(renotifyInterval, owner, lockDuration)
+}
+
+func (ds *observedDatastore) ExtendNotificationLock(name, owner string, duration time.Duration) (bool, time.Time) {
+	defer ds.observe("ExtendNotificationLock", time.Now(), nil)
+	return ds.Datastore.ExtendNotificationLock(name, owner, duration)
+}
+
+func (ds *observedDatastore) ReleaseNotificationLock(name, owner string) {
+	defer ds.observe("ReleaseNotificationLock", time.Now(), nil)
+	ds.Datastore.ReleaseNotificationLock(name, owner)
+}
+
+func (ds *observedDatastore) GetNotification(name string, limit int, page VulnerabilityNotificationPageNumber) (_ VulnerabilityNotification, _ VulnerabilityNotificationPageNumber, err error) {
+	defer ds.observe("GetNotification", time.Now(), &err)
+	return ds.Datastore.GetNotification(name, limit, page)
+}
+
+func (ds *observedDatastore) SetNotificationNotified(name string) (err error) {
+	defer ds.observe("SetNotificationNotified", time.Now(), &err)
+	return ds.Datastore.SetNotificationNotified(name)
+}
+
+func (ds *observedDatastore) SetNotificationFailed(name string) (err error) {
+	defer ds.observe("SetNotificationFailed", time.Now(), &err)
+	return ds.Datastore.SetNotificationFailed(name)
+}
+
+func (ds *observedDatastore) DeleteNotification(name string) (err error) {
+	defer ds.observe("DeleteNotification", time.Now(), &err)
+	return ds.Datastore.DeleteNotification(name)
+}
+
+func (ds *observedDatastore) InsertNotificationDelivery(notificationName, notifier string) (_ NotificationDelivery, err error) {
+	defer ds.observe("InsertNotificationDelivery", time.Now(), &err)
+	return ds.Datastore.InsertNotificationDelivery(notificationName, notifier)
+}
+
+func (ds *observedDatastore) InsertNotificationDeliveryAttempt(delivery NotificationDelivery, succeeded bool, message string) (err error) {
+	defer ds.observe("InsertNotificationDeliveryAttempt", time.Now(), &err)
+	return ds.Datastore.InsertNotificationDeliveryAttempt(delivery, succeeded, message)
+}
+
+func (ds *observedDatastore) ListNotificationDeliveries(notificationName string) (_ []NotificationDelivery, err error) {
+	defer ds.observe("ListNotificationDeliveries", time.Now(), &err)
+	return ds.Datastore.ListNotificationDeliveries(notificationName)
+}
+
+func (ds *observedDatastore) ListUndeliveredNotifications(notifier string) (_ []VulnerabilityNotification, err error) {
+	defer ds.observe("ListUndeliveredNotifications", time.Now(), &err)
+	return ds.Datastore.ListUndeliveredNotifications(notifier)
+}
+
+func (ds *observedDatastore) InsertFalsePositive(falsePositive FalsePositive) (_ FalsePositive, err error) {
+	defer ds.observe("InsertFalsePositive", time.Now(), &err)
+	return ds.Datastore.InsertFalsePositive(falsePositive)
+}
+
+func (ds *observedDatastore) FindFalsePositives(vulnerabilities []Vulnerability) (_ []FalsePositive, err error) {
+	defer ds.observe("FindFalsePositives", time.Now(), &err)
+	return ds.Datastore.FindFalsePositives(vulnerabilities)
+}
+
+func (ds *observedDatastore) ListFalsePositives(limit int, page int) (_ []FalsePositive, _ int, err error) {
+	defer ds.observe("ListFalsePositives", time.Now(), &err)
+	return ds.Datastore.ListFalsePositives(limit, page)
+}
+
+func (ds *observedDatastore) DeleteFalsePositive(name string) (err error) {
+	defer ds.observe("DeleteFalsePositive", time.Now(), &err)
+	return ds.Datastore.DeleteFalsePositive(name)
+}
+
+func (ds *observedDatastore) InsertWatchedTag(watchedTag WatchedTag) (_ WatchedTag, err error) {
+	defer ds.observe("InsertWatchedTag", time.Now(), &err)
+	return ds.Datastore.InsertWatchedTag(watchedTag)
+}
+
+func (ds *observedDatastore) FindWatchedTag(name string) (_ WatchedTag, err error) {
+	defer ds.observe("FindWatchedTag", time.Now(), &err)
+	return ds.Datastore.FindWatchedTag(name)
+}
+
+func (ds *observedDatastore) ListWatchedTags(limit int, page int) (_ []WatchedTag, _ int, err error) {
+	defer ds.observe("ListWatchedTags", time.Now(), &err)
+	return ds.Datastore.ListWatchedTags(limit, page)
+}
+
+func (ds *observedDatastore) UpdateWatchedTag(watchedTag WatchedTag) (err error) {
+	defer ds.observe("UpdateWatchedTag", time.Now(), &err)
+	return ds.Datastore.UpdateWatchedTag(watchedTag)
+}
+
+func (ds *observedDatastore) DeleteWatchedTag(name string) (err error) {
+	defer ds.observe("DeleteWatchedTag", time.Now(), &err)
+	return ds.Datastore.DeleteWatchedTag(name)
+}
+
+func (ds *observedDatastore) ListMovedWatchedTags(limit int, page int) (_ []WatchedTag, _ int, err error) {
+	defer ds.observe("ListMovedWatchedTags", time.Now(), &err)
+	return ds.Datastore.ListMovedWatchedTags(limit, page)
+}
+
+func (ds *observedDatastore) MarkWatchedTagReported(name, digest string) (err error) {
+	defer ds.observe("MarkWatchedTagReported", time.Now(), &err)
+	return ds.Datastore.MarkWatchedTagReported(name, digest)
+}
+
+func (ds *observedDatastore) InsertLayerLabels(name string, labels map[string]string) (err error) {
+	defer ds.observe("InsertLayerLabels", time.Now(), &err)
+	return ds.Datastore.InsertLayerLabels(name, labels)
+}
+
+func (ds *observedDatastore) ListLayers(labels map[string]string, limit int, page int) (_ []Layer, _ int, err error) {
+	defer ds.observe("ListLayers", time.Now(), &err)
+	return ds.Datastore.ListLayers(labels, limit, page)
+}
+
+func (ds *observedDatastore) ListNotificationLabels(name string) (_ []map[string]string, err error) {
+	defer ds.observe("ListNotificationLabels", time.Now(), &err)
+	return ds.Datastore.ListNotificationLabels(name)
+}
+
+func (ds *observedDatastore) ListNotificationWatchedTags(name string) (_ []WatchedTag, err error) {
+	defer ds.observe("ListNotificationWatchedTags", time.Now(), &err)
+	return ds.Datastore.ListNotificationWatchedTags(name)
+}
+
+func (ds *observedDatastore) InsertProvenance(provenance Provenance) (_ Provenance, err error) {
+	defer ds.observe("InsertProvenance", time.Now(), &err)
+	return ds.Datastore.InsertProvenance(provenance)
+}
+
+func (ds *observedDatastore) FindProvenances(digest string) (_ []Provenance, err error) {
+	defer ds.observe("FindProvenances", time.Now(), &err)
+	return ds.Datastore.FindProvenances(digest)
+}
+
+func (ds *observedDatastore) InsertImage(image Image) (err error) {
+	defer ds.observe("InsertImage", time.Now(), &err)
+	return ds.Datastore.InsertImage(image)
+}
+
+func (ds *observedDatastore) FindImage(digest string) (_ Image, err error) {
+	defer ds.observe("FindImage", time.Now(), &err)
+	return ds.Datastore.FindImage(digest)
+}
+
+func (ds *observedDatastore) InsertLayerAnalysis(analysis LayerAnalysis) (err error) {
+	defer ds.observe("InsertLayerAnalysis", time.Now(), &err)
+	return ds.Datastore.InsertLayerAnalysis(analysis)
+}
+
+func (ds *observedDatastore) FindLayerAnalysis(digest string) (_ LayerAnalysis, err error) {
+	defer ds.observe("FindLayerAnalysis", time.Now(), &err)
+	return ds.Datastore.FindLayerAnalysis(digest)
+}
+
+func (ds *observedDatastore) InsertKeyValue(key, value string) (err error) {
+	defer ds.observe("InsertKeyValue", time.Now(), &err)
+	return ds.Datastore.InsertKeyValue(key, value)
+}
+
+func (ds *observedDatastore) GetKeyValue(key string) (_ string, err error) {
+	defer ds.observe("GetKeyValue", time.Now(), &err)
+	return ds.Datastore.GetKeyValue(key)
+}
+
+func (ds *observedDatastore) Unlock(name, owner string) {
+	defer ds.observe("Unlock", time.Now(), nil)
+	ds.Datastore.Unlock(name, owner)
+}
+
+func (ds *observedDatastore) FindLock(name string) (_ string, _ time.Time, err error) {
+	defer ds.observe("FindLock", time.Now(), &err)
+	return ds.Datastore.FindLock(name)
+}
+
+func (ds *observedDatastore) WithContext(ctx context.Context) Datastore {
+	return &observedDatastore{Datastore: ds.Datastore.WithContext(ctx), observer: ds.observer}
+}
+
+func (ds *observedDatastore) Health(ctx context.Context) (_ HealthStatus, err error) {
+	defer ds.observe("Health", time.Now(), &err)
+	return ds.Datastore.Health(ctx)
+}
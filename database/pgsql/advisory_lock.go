@@ -0,0 +1,77 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"database/sql"
+	"hash/crc32"
+
+	"github.com/lib/pq"
+
+	"github.com/coreos/clair/tracing"
+)
+
+var (
+	// migrationLockKey is the key of the advisory lock that the migrations hold exclusively and the
+	// heavy writes of the updater hold shared, so that a new version of Clair doesn't migrate the
+	// schema under the writes of the instances it replaces. It is the key the previous versions of
+	// Clair lock their migrations with, so they exclude each other too.
+	migrationLockKey = int64(crc32.ChecksumIEEE([]byte("migrations")))
+
+	// vulnerabilityWritesLockKey is the key of the advisory lock serializing the heavy writes of
+	// the vulnerabilities, which lock many rows and Vulnerability_Affects_FeatureVersion, so that
+	// concurrent updaters or API calls wait for each other instead of deadlocking.
+	vulnerabilityWritesLockKey = int64(crc32.ChecksumIEEE([]byte("vulnerability_writes")))
+)
+
+const (
+	lockMigrations          = `SELECT pg_advisory_xact_lock($1)`
+	lockVulnerabilityWrites = `SELECT pg_advisory_xact_lock_shared($1), pg_advisory_xact_lock($2)`
+)
+
+// beginMigrations begins the transaction holding the migration lock exclusively until it is
+// committed. Unlike a session lock, which would be held by whichever connection of the pool took
+// it, the lock is always released with the transaction.
+func beginMigrations(db *sql.DB) (*sql.Tx, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec(lockMigrations, migrationLockKey); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// lockVulnerabilityWrites waits, in the given transaction, for the migrations in progress and for
+// the other heavy writes of the vulnerabilities, unless the CockroachDB compatibility mode, which
+// has no advisory locks, is enabled.
+func (pgSQL *pgSQL) lockVulnerabilityWrites(tx *tracing.Tx) error {
+	if pgSQL.config.CockroachDB {
+		return nil
+	}
+
+	_, err := tx.Exec(lockVulnerabilityWrites, migrationLockKey, vulnerabilityWritesLockKey)
+	return err
+}
+
+// isErrSchemaChanged determines if the given error is caused by a table or a column that doesn't
+// exist, which happens when a newer version of Clair migrated the schema that this one queries.
+func isErrSchemaChanged(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && (pqErr.Code == "42P01" || pqErr.Code == "42703")
+}
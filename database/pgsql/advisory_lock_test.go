@@ -0,0 +1,68 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestAdvisoryLocks(t *testing.T) {
+	datastore, err := openDatabaseForTest("AdvisoryLocks", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer datastore.Close()
+
+	// The writes of the vulnerabilities wait for the migrations in progress.
+	migrations, err := beginMigrations(datastore.DB.DB)
+	if !assert.Nil(t, err) {
+		return
+	}
+	vulnerability := database.Vulnerability{
+		Name:      "TestAdvisoryLocks",
+		Namespace: database.Namespace{Name: "TestAdvisoryLocksNamespace", VersionFormat: dpkg.ParserName},
+		Severity:  types.Low,
+	}
+	inserted := make(chan error, 1)
+	go func() {
+		inserted <- datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, false)
+	}()
+
+	select {
+	case <-inserted:
+		t.Error("the vulnerability was inserted during the migrations")
+	case <-time.After(500 * time.Millisecond):
+	}
+	assert.Nil(t, migrations.Commit())
+	select {
+	case err := <-inserted:
+		assert.Nil(t, err)
+	case <-time.After(10 * time.Second):
+		t.Error("the vulnerability wasn't inserted after the migrations")
+	}
+
+	// The queries of a schema that has been migrated by another version fail temporarily.
+	assert.Equal(t, database.ErrMigrationInProgress, handleError("test", &pq.Error{Code: "42703"}))
+	assert.Equal(t, database.ErrBackendException, handleError("test", &pq.Error{Code: "23502"}))
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/tracing"
+	"github.com/coreos/clair/utils/types"
+)
+
+// maxSerializationRetries is the number of times a transaction that failed to serialize is run
+// before giving up.
+const maxSerializationRetries = 5
+
+// errSerializationFailure is returned by handleError when a transaction has been aborted because
+// it conflicted with a concurrent one, in which case it can safely be retried.
+var errSerializationFailure = errors.New("pgsql: could not serialize access due to a concurrent transaction")
+
+// isErrSerializationFailure determines if the given error is a serialization failure.
+func isErrSerializationFailure(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "40001"
+}
+
+// withSerializationRetry runs f until it doesn't fail because of a serialization failure or until
+// maxSerializationRetries is reached.
+//
+// Serialization failures are rare with PostgreSQL as Clair explicitly locks the tables it
+// modifies concurrently, but CockroachDB doesn't support table locks and aborts conflicting
+// transactions instead, expecting the client to run them again.
+func withSerializationRetry(f func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxSerializationRetries; attempt++ {
+		if err = f(); err != errSerializationFailure {
+			return err
+		}
+		log.Debugf("pgsql: retrying transaction after serialization failure (attempt %d)", attempt)
+	}
+
+	return database.ErrBackendException
+}
+
+// lockAffects locks Vulnerability_Affects_FeatureVersion exclusively in the given transaction,
+// unless the CockroachDB compatibility mode is enabled, in which case the transaction relies on
+// the SERIALIZABLE isolation level enforced by CockroachDB.
+func (pgSQL *pgSQL) lockAffects(tx *tracing.Tx) error {
+	if pgSQL.config.CockroachDB {
+		return nil
+	}
+
+	_, err := tx.Exec(lockVulnerabilityAffects)
+	return err
+}
+
+// setPlannerHint executes the given PostgreSQL-specific query planner setting in the transaction.
+// It does nothing when the CockroachDB compatibility mode is enabled as CockroachDB would reject
+// it and abort the transaction.
+func (pgSQL *pgSQL) setPlannerHint(tx *tracing.Tx, hint string) error {
+	if pgSQL.config.CockroachDB {
+		return nil
+	}
+
+	_, err := tx.Exec(hint)
+	return err
+}
+
+// beginSnapshot begins a read-only transaction whose queries all see the same snapshot of the
+// database, regardless of the transactions committed meanwhile. CockroachDB transactions are
+// SERIALIZABLE, which already guarantees it.
+func (pgSQL *pgSQL) beginSnapshot() (*tracing.Tx, error) {
+	tx, err := pgSQL.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if !pgSQL.config.CockroachDB {
+		if _, err = tx.Exec(setTransactionSnapshot); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return tx, nil
+}
+
+// searchNotificationAvailableQuery returns the query finding the next notification to send.
+//
+// In the CockroachDB compatibility mode, the priorities are stored as strings rather than as an
+// enumerated type, hence the notifications are ordered by the rank of their priority instead.
+func (pgSQL *pgSQL) searchNotificationAvailableQuery() string {
+	if !pgSQL.config.CockroachDB {
+		return searchNotificationAvailable
+	}
+	return strings.Replace(searchNotificationAvailable, "ORDER BY vn.priority DESC", "ORDER BY "+priorityRank("vn.priority")+" DESC", 1)
+}
+
+// priorityRank returns an SQL expression evaluating to the rank of the priority in the given
+// column, following the order of types.Priorities.
+func priorityRank(column string) string {
+	rank := "CASE " + column
+	for i, priority := range types.Priorities {
+		rank += fmt.Sprintf(" WHEN '%s' THEN %d", priority, i)
+	}
+	return rank + " END"
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+)
+
+func TestWithSerializationRetry(t *testing.T) {
+	assert.True(t, isErrSerializationFailure(&pq.Error{Code: "40001"}))
+	assert.False(t, isErrSerializationFailure(&pq.Error{Code: "23505"}))
+
+	// A transaction that eventually succeeds is retried.
+	var attempts int
+	err := withSerializationRetry(func() error {
+		attempts++
+		if attempts < 3 {
+			return errSerializationFailure
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// Other errors are returned immediately.
+	attempts = 0
+	errOther := errors.New("other")
+	err = withSerializationRetry(func() error {
+		attempts++
+		return errOther
+	})
+	assert.Equal(t, errOther, err)
+	assert.Equal(t, 1, attempts)
+
+	// Give up after too many serialization failures.
+	attempts = 0
+	err = withSerializationRetry(func() error {
+		attempts++
+		return errSerializationFailure
+	})
+	assert.Equal(t, database.ErrBackendException, err)
+	assert.Equal(t, maxSerializationRetries, attempts)
+}
+
+func TestSearchNotificationAvailableQuery(t *testing.T) {
+	pg := &pgSQL{}
+	assert.Equal(t, searchNotificationAvailable, pg.searchNotificationAvailableQuery())
+
+	// CockroachDB stores the priorities as strings, which must not be ordered alphabetically.
+	pg.config.CockroachDB = true
+	query := pg.searchNotificationAvailableQuery()
+	assert.NotContains(t, query, "ORDER BY vn.priority DESC")
+	assert.Contains(t, query, "ORDER BY CASE vn.priority WHEN 'Unknown' THEN 0 WHEN 'Negligible' THEN 1 WHEN 'Low' THEN 2 WHEN 'Medium' THEN 3 WHEN 'High' THEN 4 WHEN 'Critical' THEN 5 WHEN 'Defcon1' THEN 6 END DESC")
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"os"
+	"testing"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/database/conformance"
+	"github.com/coreos/clair/database/testutil"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, testutil.Harness{
+		Open: func() (database.Datastore, error) {
+			return openDatabaseForTest("Conformance", false)
+		},
+		Fixture: testutil.DefaultFixture(),
+	})
+}
+
+// TestCockroachDBConformance runs the suite in the CockroachDB compatibility mode, which needs a
+// cluster given with CLAIR_TEST_COCKROACHDB or started by setting CLAIR_TEST_COCKROACHDB_DOCKER.
+func TestCockroachDBConformance(t *testing.T) {
+	if os.Getenv("CLAIR_TEST_COCKROACHDB") == "" {
+		t.Skip("CLAIR_TEST_COCKROACHDB isn't set")
+	}
+
+	conformance.Run(t, testutil.Harness{
+		Open: func() (database.Datastore, error) {
+			return openDatabase(generateCockroachDBTestConfig("Conformance"))
+		},
+		Fixture: testutil.DefaultFixture(),
+	})
+}
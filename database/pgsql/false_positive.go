@@ -0,0 +1,170 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertFalsePositive flags a finding as a false positive, or updates the reason of an existing
+// flag.
+func (pgSQL *pgSQL) InsertFalsePositive(falsePositive database.FalsePositive) (database.FalsePositive, error) {
+	if falsePositive.Namespace.Name == "" || falsePositive.VulnerabilityName == "" ||
+		falsePositive.FeatureName == "" || falsePositive.FeatureVersion == "" {
+		return falsePositive, cerrors.NewBadRequestError("could not insert a false positive which does not identify a finding")
+	}
+
+	defer observeQueryTime("InsertFalsePositive", "all", time.Now())
+
+	namespaceID, err := pgSQL.insertNamespace(falsePositive.Namespace)
+	if err != nil {
+		return falsePositive, err
+	}
+	falsePositive.Namespace.ID = namespaceID
+
+	for {
+		err = pgSQL.QueryRow(updateFalsePositive, namespaceID, falsePositive.VulnerabilityName,
+			falsePositive.FeatureName, falsePositive.FeatureVersion, falsePositive.Reason).
+			Scan(&falsePositive.ID, &falsePositive.Name, &falsePositive.Created)
+		if err != sql.ErrNoRows {
+			if err != nil {
+				return falsePositive, handleError("updateFalsePositive", err)
+			}
+			return falsePositive, nil
+		}
+
+		err = pgSQL.QueryRow(insertFalsePositive, uuid.New(), namespaceID, falsePositive.VulnerabilityName,
+			falsePositive.FeatureName, falsePositive.FeatureVersion, falsePositive.Reason).
+			Scan(&falsePositive.ID, &falsePositive.Name, &falsePositive.Created)
+		if err != nil {
+			if isErrUniqueViolation(err) {
+				// Someone else flagged the same finding concurrently, update it instead.
+				continue
+			}
+			return falsePositive, handleError("insertFalsePositive", err)
+		}
+		return falsePositive, nil
+	}
+}
+
+// FindFalsePositives returns the false positives flagging any of the given vulnerabilities.
+func (pgSQL *pgSQL) FindFalsePositives(vulnerabilities []database.Vulnerability) ([]database.FalsePositive, error) {
+	if len(vulnerabilities) == 0 {
+		return nil, nil
+	}
+
+	defer observeQueryTime("FindFalsePositives", "all", time.Now())
+
+	// Query by name and filter the namespaces afterwards.
+	namespacesByName := make(map[string]map[string]struct{})
+	var names []string
+	for _, vulnerability := range vulnerabilities {
+		if _, ok := namespacesByName[vulnerability.Name]; !ok {
+			namespacesByName[vulnerability.Name] = make(map[string]struct{})
+			names = append(names, vulnerability.Name)
+		}
+		namespacesByName[vulnerability.Name][vulnerability.Namespace.Name] = struct{}{}
+	}
+
+	falsePositives, err := pgSQL.searchFalsePositives(searchFalsePositiveByVulnerabilityName, buildStringInputArray(names))
+	if err != nil {
+		return nil, err
+	}
+
+	var found []database.FalsePositive
+	for _, falsePositive := range falsePositives {
+		if _, ok := namespacesByName[falsePositive.VulnerabilityName][falsePositive.Namespace.Name]; ok {
+			found = append(found, falsePositive)
+		}
+	}
+	return found, nil
+}
+
+// ListFalsePositives paginates over every false positive.
+func (pgSQL *pgSQL) ListFalsePositives(limit int, startID int) ([]database.FalsePositive, int, error) {
+	defer observeQueryTime("ListFalsePositives", "all", time.Now())
+
+	falsePositives, err := pgSQL.searchFalsePositives(searchFalsePositivePage, startID, limit+1)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	nextID := -1
+	if len(falsePositives) > limit {
+		nextID = falsePositives[limit].ID
+		falsePositives = falsePositives[:limit]
+	}
+	return falsePositives, nextID, nil
+}
+
+func (pgSQL *pgSQL) searchFalsePositives(condition string, args ...interface{}) ([]database.FalsePositive, error) {
+	rows, err := pgSQL.Query(searchFalsePositiveBase+condition, args...)
+	if err != nil {
+		return nil, handleError("searchFalsePositive", err)
+	}
+	defer rows.Close()
+
+	var falsePositives []database.FalsePositive
+	for rows.Next() {
+		var falsePositive database.FalsePositive
+		err := rows.Scan(
+			&falsePositive.ID,
+			&falsePositive.Name,
+			&falsePositive.Namespace.ID,
+			&falsePositive.Namespace.Name,
+			&falsePositive.Namespace.VersionFormat,
+			&falsePositive.VulnerabilityName,
+			&falsePositive.FeatureName,
+			&falsePositive.FeatureVersion,
+			&falsePositive.Reason,
+			&falsePositive.Created,
+		)
+		if err != nil {
+			return nil, handleError("searchFalsePositive.Scan()", err)
+		}
+		falsePositives = append(falsePositives, falsePositive)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchFalsePositive.Rows()", err)
+	}
+
+	return falsePositives, nil
+}
+
+// DeleteFalsePositive removes a false positive.
+func (pgSQL *pgSQL) DeleteFalsePositive(name string) error {
+	defer observeQueryTime("DeleteFalsePositive", "all", time.Now())
+
+	result, err := pgSQL.Exec(removeFalsePositive, name)
+	if err != nil {
+		return handleError("removeFalsePositive", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("removeFalsePositive.RowsAffected()", err)
+	}
+	if affected <= 0 {
+		return cerrors.ErrNotFound
+	}
+
+	return nil
+}
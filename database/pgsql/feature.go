@@ -21,6 +21,7 @@ import (
 
 	"github.com/coreos/clair/database"
 	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/tracing"
 	cerrors "github.com/coreos/clair/utils/errors"
 )
 
@@ -121,7 +122,7 @@ func (pgSQL *pgSQL) insertFeatureVersion(fv database.FeatureVersion) (id int, er
 	promConcurrentLockVAFV.Inc()
 	defer promConcurrentLockVAFV.Dec()
 	t = time.Now()
-	_, err = tx.Exec(lockVulnerabilityAffects)
+	err = pgSQL.lockAffects(tx)
 	observeQueryTime("insertFeatureVersion", "lock", t)
 
 	if err != nil {
@@ -198,7 +199,7 @@ type vulnerabilityAffectsFeatureVersion struct {
 	fixedInVersion  string
 }
 
-func linkFeatureVersionToVulnerabilities(tx *sql.Tx, featureVersion database.FeatureVersion) error {
+func linkFeatureVersionToVulnerabilities(tx *tracing.Tx, featureVersion database.FeatureVersion) error {
 	// Select every vulnerability and the fixed version that affect this Feature.
 	// TODO(Quentin-M): LIMIT
 	rows, err := tx.Query(searchVulnerabilityFixedInFeature, featureVersion.Feature.ID)
@@ -22,6 +22,7 @@ import (
 	"github.com/guregu/null/zero"
 
 	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/tracing"
 	"github.com/coreos/clair/utils"
 	cerrors "github.com/coreos/clair/utils/errors"
 )
@@ -50,6 +51,7 @@ func (pgSQL *pgSQL) FindLayer(name string, withFeatures, withVulnerabilities boo
 		&layer.ID,
 		&layer.Name,
 		&layer.EngineVersion,
+		&layer.Stats,
 		&parentID,
 		&parentName,
 		&nsID,
@@ -76,6 +78,13 @@ func (pgSQL *pgSQL) FindLayer(name string, withFeatures, withVulnerabilities boo
 		}
 	}
 
+	// Find its labels
+	layers := []database.Layer{layer}
+	if err = loadLayerLabels(pgSQL, layers); err != nil {
+		return layer, err
+	}
+	layer.Labels = layers[0].Labels
+
 	// Find its features
 	if withFeatures || withVulnerabilities {
 		// Create a transaction to disable hash/merge joins as our experiments have shown that
@@ -85,17 +94,19 @@ func (pgSQL *pgSQL) FindLayer(name string, withFeatures, withVulnerabilities boo
 		// It would for instance do a merge join between affected feature versions (300 rows, estimated
 		// 3000 rows) and fixed in feature version (100k rows). In this case, it is much more
 		// preferred to use a nested loop.
-		tx, err := pgSQL.Begin()
+		// The transaction reads from a single snapshot, so that an updater run committing between
+		// the queries can't make the report mix the features with vulnerabilities of another state.
+		tx, err := pgSQL.beginSnapshot()
 		if err != nil {
 			return layer, handleError("FindLayer.Begin()", err)
 		}
 		defer tx.Commit()
 
-		_, err = tx.Exec(disableHashJoin)
+		err = pgSQL.setPlannerHint(tx, disableHashJoin)
 		if err != nil {
 			log.Warningf("FindLayer: could not disable hash join: %s", err)
 		}
-		_, err = tx.Exec(disableMergeJoin)
+		err = pgSQL.setPlannerHint(tx, disableMergeJoin)
 		if err != nil {
 			log.Warningf("FindLayer: could not disable merge join: %s", err)
 		}
@@ -126,7 +137,7 @@ func (pgSQL *pgSQL) FindLayer(name string, withFeatures, withVulnerabilities boo
 }
 
 // getLayerFeatureVersions returns list of database.FeatureVersion that a database.Layer has.
-func getLayerFeatureVersions(tx *sql.Tx, layerID int) ([]database.FeatureVersion, error) {
+func getLayerFeatureVersions(tx *tracing.Tx, layerID int) ([]database.FeatureVersion, error) {
 	var featureVersions []database.FeatureVersion
 
 	// Query.
@@ -153,6 +164,8 @@ func getLayerFeatureVersions(tx *sql.Tx, layerID int) ([]database.FeatureVersion
 			&fv.Version,
 			&fv.AddedBy.ID,
 			&fv.AddedBy.Name,
+			&fv.DetectedBy,
+			&fv.State,
 		)
 		if err != nil {
 			return featureVersions, handleError("searchLayerFeatureVersion.Scan()", err)
@@ -173,6 +186,30 @@ func getLayerFeatureVersions(tx *sql.Tx, layerID int) ([]database.FeatureVersion
 		return featureVersions, handleError("searchLayerFeatureVersion.Rows()", err)
 	}
 
+	// Add the evidence the layer has for its FeatureVersions.
+	rows, err = tx.Query(searchLayerFeatureVersionEvidence, layerID)
+	if err != nil {
+		return featureVersions, handleError("searchLayerFeatureVersionEvidence", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var evidence string
+		if err = rows.Scan(&id, &evidence); err != nil {
+			return featureVersions, handleError("searchLayerFeatureVersionEvidence.Scan()", err)
+		}
+		if fv, ok := mapFeatureVersions[id]; ok {
+			fv.Evidence = []string{}
+			if evidence != "" {
+				fv.Evidence = strings.Split(evidence, "\n")
+			}
+			mapFeatureVersions[id] = fv
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return featureVersions, handleError("searchLayerFeatureVersionEvidence.Rows()", err)
+	}
+
 	// Build result by converting our map to a slice.
 	for _, featureVersion := range mapFeatureVersions {
 		featureVersions = append(featureVersions, featureVersion)
@@ -183,7 +220,7 @@ func getLayerFeatureVersions(tx *sql.Tx, layerID int) ([]database.FeatureVersion
 
 // loadAffectedBy returns the list of database.Vulnerability that affect the given
 // FeatureVersion.
-func loadAffectedBy(tx *sql.Tx, featureVersions []database.FeatureVersion) error {
+func loadAffectedBy(tx *tracing.Tx, featureVersions []database.FeatureVersion) error {
 	if len(featureVersions) == 0 {
 		return nil
 	}
@@ -213,6 +250,8 @@ func loadAffectedBy(tx *sql.Tx, featureVersions []database.FeatureVersion) error
 			&vulnerability.Link,
 			&vulnerability.Severity,
 			&vulnerability.Metadata,
+			&vulnerability.Sources,
+			&vulnerability.CVSS,
 			&vulnerability.Namespace.Name,
 			&vulnerability.Namespace.VersionFormat,
 			&vulnerability.FixedBy,
@@ -242,6 +281,12 @@ func loadAffectedBy(tx *sql.Tx, featureVersions []database.FeatureVersion) error
 // Feature has the same Name/Version as its parent, InsertLayer considers that the Feature hasn't
 // been modified.
 func (pgSQL *pgSQL) InsertLayer(layer database.Layer) error {
+	return withSerializationRetry(func() error {
+		return pgSQL.insertLayer(layer)
+	})
+}
+
+func (pgSQL *pgSQL) insertLayer(layer database.Layer) error {
 	tf := time.Now()
 
 	// Verify parameters
@@ -301,7 +346,7 @@ func (pgSQL *pgSQL) InsertLayer(layer database.Layer) error {
 
 	if layer.ID == 0 {
 		// Insert a new layer.
-		err = tx.QueryRow(insertLayer, layer.Name, layer.EngineVersion, parentID, namespaceID).
+		err = tx.QueryRow(insertLayer, layer.Name, layer.EngineVersion, parentID, namespaceID, &layer.Stats).
 			Scan(&layer.ID)
 		if err != nil {
 			tx.Rollback()
@@ -315,7 +360,7 @@ func (pgSQL *pgSQL) InsertLayer(layer database.Layer) error {
 		}
 	} else {
 		// Update an existing layer.
-		_, err = tx.Exec(updateLayer, layer.ID, layer.EngineVersion, namespaceID)
+		_, err = tx.Exec(updateLayer, layer.ID, layer.EngineVersion, namespaceID, &layer.Stats)
 		if err != nil {
 			tx.Rollback()
 			return handleError("updateLayer", err)
@@ -327,6 +372,12 @@ func (pgSQL *pgSQL) InsertLayer(layer database.Layer) error {
 			tx.Rollback()
 			return handleError("removeLayerDiffFeatureVersion", err)
 		}
+
+		_, err = tx.Exec(removeLayerFeatureVersionEvidence, layer.ID)
+		if err != nil {
+			tx.Rollback()
+			return handleError("removeLayerFeatureVersionEvidence", err)
+		}
 	}
 
 	// Update Layer_diff_FeatureVersion now.
@@ -336,6 +387,12 @@ func (pgSQL *pgSQL) InsertLayer(layer database.Layer) error {
 		return err
 	}
 
+	err = pgSQL.insertFeatureVersionsEvidence(tx, &layer)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Commit transaction.
 	err = tx.Commit()
 	if err != nil {
@@ -346,7 +403,7 @@ func (pgSQL *pgSQL) InsertLayer(layer database.Layer) error {
 	return nil
 }
 
-func (pgSQL *pgSQL) updateDiffFeatureVersions(tx *sql.Tx, layer, existingLayer *database.Layer) error {
+func (pgSQL *pgSQL) updateDiffFeatureVersions(tx *tracing.Tx, layer, existingLayer *database.Layer) error {
 	// add and del are the FeatureVersion diff we should insert.
 	var add []database.FeatureVersion
 	var del []database.FeatureVersion
@@ -384,15 +441,22 @@ func (pgSQL *pgSQL) updateDiffFeatureVersions(tx *sql.Tx, layer, existingLayer *
 		return err
 	}
 
-	// Insert diff in the database.
-	if len(addIDs) > 0 {
-		_, err = tx.Exec(insertLayerDiffFeatureVersion, layer.ID, "add", buildInputArray(addIDs))
+	// Insert diff in the database, grouping the added FeatureVersions by the detector that found
+	// them and their state.
+	type addGroup struct{ detector, state string }
+	addIDsByGroup := make(map[addGroup][]int)
+	for i, id := range addIDs {
+		group := addGroup{add[i].DetectedBy, add[i].State}
+		addIDsByGroup[group] = append(addIDsByGroup[group], id)
+	}
+	for group, ids := range addIDsByGroup {
+		_, err = tx.Exec(insertLayerDiffFeatureVersion, layer.ID, "add", buildInputArray(ids), group.detector, group.state)
 		if err != nil {
 			return handleError("insertLayerDiffFeatureVersion.Add", err)
 		}
 	}
 	if len(delIDs) > 0 {
-		_, err = tx.Exec(insertLayerDiffFeatureVersion, layer.ID, "del", buildInputArray(delIDs))
+		_, err = tx.Exec(insertLayerDiffFeatureVersion, layer.ID, "del", buildInputArray(delIDs), "", "")
 		if err != nil {
 			return handleError("insertLayerDiffFeatureVersion.Del", err)
 		}
@@ -401,6 +465,30 @@ func (pgSQL *pgSQL) updateDiffFeatureVersions(tx *sql.Tx, layer, existingLayer *
 	return nil
 }
 
+// insertFeatureVersionsEvidence stores the evidence of every FeatureVersion of the layer that has
+// one, including the ones it inherits, whose files it may have deleted.
+func (pgSQL *pgSQL) insertFeatureVersionsEvidence(tx *tracing.Tx, layer *database.Layer) error {
+	var featureVersions []database.FeatureVersion
+	for _, fv := range layer.Features {
+		if fv.Evidence != nil {
+			featureVersions = append(featureVersions, fv)
+		}
+	}
+
+	ids, err := pgSQL.insertFeatureVersions(featureVersions)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		_, err = tx.Exec(insertLayerFeatureVersionEvidence, layer.ID, id, strings.Join(featureVersions[i].Evidence, "\n"))
+		if err != nil {
+			return handleError("insertLayerFeatureVersionEvidence", err)
+		}
+	}
+
+	return nil
+}
+
 func createNV(features []database.FeatureVersion) (map[string]*database.FeatureVersion, []string) {
 	mapNV := make(map[string]*database.FeatureVersion, 0)
 	sliceNV := make([]string, 0, len(features))
@@ -0,0 +1,199 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertLayerLabels attaches labels to a layer, removing the ones with an empty value.
+func (pgSQL *pgSQL) InsertLayerLabels(name string, labels map[string]string) error {
+	for key := range labels {
+		if key == "" {
+			return cerrors.NewBadRequestError("could not insert a label which has an empty key")
+		}
+	}
+
+	defer observeQueryTime("InsertLayerLabels", "all", time.Now())
+
+	var layerID int
+	if err := pgSQL.QueryRow(searchLayerID, name).Scan(&layerID); err != nil {
+		return handleError("searchLayerID", err)
+	}
+
+	// Upsert every label as InsertKeyValue does, as UPSERT requires PostgreSQL 9.5.
+	for _, key := range database.SortedKeys(labels) {
+		value := labels[key]
+		if value == "" {
+			if _, err := pgSQL.Exec(removeLayerLabel, layerID, key); err != nil {
+				return handleError("removeLayerLabel", err)
+			}
+			continue
+		}
+
+		for {
+			r, err := pgSQL.Exec(updateLayerLabel, layerID, key, value)
+			if err != nil {
+				return handleError("updateLayerLabel", err)
+			}
+			if n, _ := r.RowsAffected(); n > 0 {
+				break
+			}
+
+			_, err = pgSQL.Exec(insertLayerLabel, layerID, key, value)
+			if err != nil {
+				if isErrUniqueViolation(err) {
+					// The label has been inserted concurrently, update it.
+					continue
+				}
+				return handleError("insertLayerLabel", err)
+			}
+			break
+		}
+	}
+
+	return nil
+}
+
+// ListLayers paginates over the layers having all the given labels.
+func (pgSQL *pgSQL) ListLayers(labels map[string]string, limit int, startID int) ([]database.Layer, int, error) {
+	defer observeQueryTime("ListLayers", "all", time.Now())
+
+	query := searchLayerPage
+	args := []interface{}{startID, limit + 1}
+	for _, key := range database.SortedKeys(labels) {
+		query += fmt.Sprintf(searchLayerPageLabel, len(args)+1, len(args)+2)
+		args = append(args, key, labels[key])
+	}
+	query += searchLayerPageEnd
+
+	rows, err := pgSQL.Query(query, args...)
+	if err != nil {
+		return nil, -1, handleError("searchLayerPage", err)
+	}
+	defer rows.Close()
+
+	var layers []database.Layer
+	for rows.Next() {
+		var layer database.Layer
+		if err := rows.Scan(&layer.ID, &layer.Name); err != nil {
+			return nil, -1, handleError("searchLayerPage.Scan()", err)
+		}
+		layers = append(layers, layer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, -1, handleError("searchLayerPage.Rows()", err)
+	}
+
+	nextID := -1
+	if len(layers) > limit {
+		nextID = layers[limit].ID
+		layers = layers[:limit]
+	}
+
+	if err := loadLayerLabels(pgSQL, layers); err != nil {
+		return nil, -1, err
+	}
+	return layers, nextID, nil
+}
+
+// ListNotificationLabels returns the distinct label sets of the labeled layers affected by a
+// notification, in the order in which the layers were inserted.
+func (pgSQL *pgSQL) ListNotificationLabels(name string) ([]map[string]string, error) {
+	defer observeQueryTime("ListNotificationLabels", "all", time.Now())
+
+	rows, err := pgSQL.Query(searchNotificationLayerLabels, name)
+	if err != nil {
+		return nil, handleError("searchNotificationLayerLabels", err)
+	}
+	defer rows.Close()
+
+	var layers []map[string]string
+	lastID := -1
+	for rows.Next() {
+		var layerID int
+		var key, value string
+		if err := rows.Scan(&layerID, &key, &value); err != nil {
+			return nil, handleError("searchNotificationLayerLabels.Scan()", err)
+		}
+		if layerID != lastID {
+			layers = append(layers, make(map[string]string))
+			lastID = layerID
+		}
+		layers[len(layers)-1][key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchNotificationLayerLabels.Rows()", err)
+	}
+
+	// Images sharing the same labels, e.g. the successive builds of a project, are routed once.
+	var labels []map[string]string
+	seen := make(map[string]struct{})
+	for _, layerLabels := range layers {
+		var id string
+		for _, key := range database.SortedKeys(layerLabels) {
+			id += fmt.Sprintf("%q=%q,", key, layerLabels[key])
+		}
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			labels = append(labels, layerLabels)
+		}
+	}
+
+	return labels, nil
+}
+
+// loadLayerLabels fills the Labels of the given layers.
+func loadLayerLabels(q Queryer, layers []database.Layer) error {
+	if len(layers) == 0 {
+		return nil
+	}
+
+	indexes := make(map[int][]int)
+	ids := make([]int, 0, len(layers))
+	for i, layer := range layers {
+		indexes[layer.ID] = append(indexes[layer.ID], i)
+		ids = append(ids, layer.ID)
+	}
+
+	rows, err := q.Query(searchLayerLabels, buildInputArray(ids))
+	if err != nil {
+		return handleError("searchLayerLabels", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var layerID int
+		var key, value string
+		if err := rows.Scan(&layerID, &key, &value); err != nil {
+			return handleError("searchLayerLabels.Scan()", err)
+		}
+		for _, i := range indexes[layerID] {
+			if layers[i].Labels == nil {
+				layers[i].Labels = make(map[string]string)
+			}
+			layers[i].Labels[key] = value
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return handleError("searchLayerLabels.Rows()", err)
+	}
+
+	return nil
+}
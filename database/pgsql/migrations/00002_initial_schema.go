@@ -20,86 +20,93 @@ func init() {
 	// This migration creates the initial Clair's schema.
 	RegisterMigration(migrate.Migration{
 		ID: 2,
-		Up: migrate.Queries([]string{
-			`CREATE TABLE IF NOT EXISTS Namespace (
+		Up: withDialect(func(cockroachDB bool) []string {
+			// CockroachDB doesn't support enumerated types, see enumType.
+			var queries []string
+			if !cockroachDB {
+				queries = append(queries,
+					`CREATE TYPE modification AS ENUM ('add', 'del');`,
+					`CREATE TYPE severity AS ENUM ('Unknown', 'Negligible', 'Low', 'Medium', 'High', 'Critical', 'Defcon1');`)
+			}
+
+			return append(queries,
+				`CREATE TABLE IF NOT EXISTS Namespace (
         id SERIAL PRIMARY KEY,
         name VARCHAR(128) NULL);`,
 
-			`CREATE TABLE IF NOT EXISTS Layer (
+				`CREATE TABLE IF NOT EXISTS Layer (
         id SERIAL PRIMARY KEY,
         name VARCHAR(128) NOT NULL UNIQUE,
         engineversion SMALLINT NOT NULL,
         parent_id INT NULL REFERENCES Layer ON DELETE CASCADE,
         namespace_id INT NULL REFERENCES Namespace,
         created_at TIMESTAMP WITH TIME ZONE);`,
-			`CREATE INDEX ON Layer (parent_id);`,
-			`CREATE INDEX ON Layer (namespace_id);`,
+				`CREATE INDEX ON Layer (parent_id);`,
+				`CREATE INDEX ON Layer (namespace_id);`,
 
-			`CREATE TABLE IF NOT EXISTS Feature (
+				`CREATE TABLE IF NOT EXISTS Feature (
         id SERIAL PRIMARY KEY,
         namespace_id INT NOT NULL REFERENCES Namespace,
         name VARCHAR(128) NOT NULL,
         UNIQUE (namespace_id, name));`,
 
-			`CREATE TABLE IF NOT EXISTS FeatureVersion (
+				`CREATE TABLE IF NOT EXISTS FeatureVersion (
         id SERIAL PRIMARY KEY,
         feature_id INT NOT NULL REFERENCES Feature,
         version VARCHAR(128) NOT NULL);`,
-			`CREATE INDEX ON FeatureVersion (feature_id);`,
+				`CREATE INDEX ON FeatureVersion (feature_id);`,
 
-			`CREATE TYPE modification AS ENUM ('add', 'del');`,
-			`CREATE TABLE IF NOT EXISTS Layer_diff_FeatureVersion (
+				`CREATE TABLE IF NOT EXISTS Layer_diff_FeatureVersion (
         id SERIAL PRIMARY KEY,
         layer_id INT NOT NULL REFERENCES Layer ON DELETE CASCADE,
         featureversion_id INT NOT NULL REFERENCES FeatureVersion,
-        modification modification NOT NULL,
+        modification `+enumType(cockroachDB, "modification")+` NOT NULL,
         UNIQUE (layer_id, featureversion_id));`,
-			`CREATE INDEX ON Layer_diff_FeatureVersion (layer_id);`,
-			`CREATE INDEX ON Layer_diff_FeatureVersion (featureversion_id);`,
-			`CREATE INDEX ON Layer_diff_FeatureVersion (featureversion_id, layer_id);`,
+				`CREATE INDEX ON Layer_diff_FeatureVersion (layer_id);`,
+				`CREATE INDEX ON Layer_diff_FeatureVersion (featureversion_id);`,
+				`CREATE INDEX ON Layer_diff_FeatureVersion (featureversion_id, layer_id);`,
 
-			`CREATE TYPE severity AS ENUM ('Unknown', 'Negligible', 'Low', 'Medium', 'High', 'Critical', 'Defcon1');`,
-			`CREATE TABLE IF NOT EXISTS Vulnerability (
+				`CREATE TABLE IF NOT EXISTS Vulnerability (
         id SERIAL PRIMARY KEY,
         namespace_id INT NOT NULL REFERENCES Namespace,
         name VARCHAR(128) NOT NULL,
         description TEXT NULL,
         link VARCHAR(128) NULL,
-        severity severity NOT NULL,
+        severity `+enumType(cockroachDB, "severity")+` NOT NULL,
         metadata TEXT NULL,
         created_at TIMESTAMP WITH TIME ZONE,
         deleted_at TIMESTAMP WITH TIME ZONE NULL);`,
 
-			`CREATE TABLE IF NOT EXISTS Vulnerability_FixedIn_Feature (
+				`CREATE TABLE IF NOT EXISTS Vulnerability_FixedIn_Feature (
         id SERIAL PRIMARY KEY,
         vulnerability_id INT NOT NULL REFERENCES Vulnerability ON DELETE CASCADE,
         feature_id INT NOT NULL REFERENCES Feature,
         version VARCHAR(128) NOT NULL,
         UNIQUE (vulnerability_id, feature_id));`,
-			`CREATE INDEX ON Vulnerability_FixedIn_Feature (feature_id, vulnerability_id);`,
+				`CREATE INDEX ON Vulnerability_FixedIn_Feature (feature_id, vulnerability_id);`,
 
-			`CREATE TABLE IF NOT EXISTS Vulnerability_Affects_FeatureVersion (
+				`CREATE TABLE IF NOT EXISTS Vulnerability_Affects_FeatureVersion (
         id SERIAL PRIMARY KEY,
         vulnerability_id INT NOT NULL REFERENCES Vulnerability ON DELETE CASCADE,
         featureversion_id INT NOT NULL REFERENCES FeatureVersion,
         fixedin_id INT NOT NULL REFERENCES Vulnerability_FixedIn_Feature ON DELETE CASCADE,
         UNIQUE (vulnerability_id, featureversion_id));`,
-			`CREATE INDEX ON Vulnerability_Affects_FeatureVersion (fixedin_id);`,
-			`CREATE INDEX ON Vulnerability_Affects_FeatureVersion (featureversion_id, vulnerability_id);`,
+				`CREATE INDEX ON Vulnerability_Affects_FeatureVersion (fixedin_id);`,
+				`CREATE INDEX ON Vulnerability_Affects_FeatureVersion (featureversion_id, vulnerability_id);`,
 
-			`CREATE TABLE IF NOT EXISTS KeyValue (
+				`CREATE TABLE IF NOT EXISTS KeyValue (
         id SERIAL PRIMARY KEY,
         key VARCHAR(128) NOT NULL UNIQUE,
         value TEXT);`,
 
-			`CREATE TABLE IF NOT EXISTS Lock (
+				`CREATE TABLE IF NOT EXISTS Lock (
         id SERIAL PRIMARY KEY,
         name VARCHAR(64) NOT NULL UNIQUE,
         owner VARCHAR(64) NOT NULL,
         until TIMESTAMP WITH TIME ZONE);`,
-			`CREATE INDEX ON Lock (owner);`,
+				`CREATE INDEX ON Lock (owner);`,
 
-			`CREATE TABLE IF NOT EXISTS Vulnerability_Notification (
+				`CREATE TABLE IF NOT EXISTS Vulnerability_Notification (
         id SERIAL PRIMARY KEY,
         name VARCHAR(64) NOT NULL UNIQUE,
         created_at TIMESTAMP WITH TIME ZONE,
@@ -107,7 +114,7 @@ func init() {
         deleted_at TIMESTAMP WITH TIME ZONE NULL,
         old_vulnerability_id INT NULL REFERENCES Vulnerability ON DELETE CASCADE,
         new_vulnerability_id INT NULL REFERENCES Vulnerability ON DELETE CASCADE);`,
-			`CREATE INDEX ON Vulnerability_Notification (notified_at);`,
+				`CREATE INDEX ON Vulnerability_Notification (notified_at);`)
 		}),
 		Down: migrate.Queries([]string{
 			`DROP TABLE IF EXISTS
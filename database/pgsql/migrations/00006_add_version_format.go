@@ -19,10 +19,13 @@ import "github.com/remind101/migrate"
 func init() {
 	RegisterMigration(migrate.Migration{
 		ID: 6,
-		Up: migrate.Queries([]string{
-			`ALTER TABLE Namespace ADD COLUMN version_format varchar(128);`,
-			`UPDATE Namespace SET version_format = 'rpm' WHERE name LIKE 'rhel%' OR name LIKE 'centos%' OR name LIKE 'fedora%' OR name LIKE 'amzn%' OR name LIKE 'scientific%' OR name LIKE 'ol%' OR name LIKE 'oracle%';`,
-			`UPDATE Namespace SET version_format = 'dpkg' WHERE version_format is NULL;`,
+		Up: withDialect(func(cockroachDB bool) []string {
+			return append([]string{
+				`ALTER TABLE Namespace ADD COLUMN version_format varchar(128);`,
+			}, backfill(cockroachDB,
+				`UPDATE Namespace SET version_format = 'rpm' WHERE name LIKE 'rhel%' OR name LIKE 'centos%' OR name LIKE 'fedora%' OR name LIKE 'amzn%' OR name LIKE 'scientific%' OR name LIKE 'ol%' OR name LIKE 'oracle%';`,
+				`UPDATE Namespace SET version_format = 'dpkg' WHERE version_format is NULL;`,
+			)...)
 		}),
 		Down: migrate.Queries([]string{
 			`ALTER TABLE Namespace DROP COLUMN version_format;`,
@@ -0,0 +1,42 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration adds a priority lane to the notifications, which is the
+	// highest severity of the old and new vulnerabilities.
+	RegisterMigration(migrate.Migration{
+		ID: 7,
+		Up: withDialect(func(cockroachDB bool) []string {
+			queries := []string{
+				`ALTER TABLE Vulnerability_Notification ADD COLUMN priority ` + enumType(cockroachDB, "severity") + ` NOT NULL DEFAULT 'Unknown';`,
+			}
+			queries = append(queries, backfill(cockroachDB,
+				`UPDATE Vulnerability_Notification vn
+			 SET priority = COALESCE(GREATEST(
+			   (SELECT severity FROM Vulnerability WHERE id = vn.old_vulnerability_id),
+			   (SELECT severity FROM Vulnerability WHERE id = vn.new_vulnerability_id)), 'Unknown');`,
+			)...)
+			return append(queries,
+				`CREATE INDEX vulnerability_notification_priority_idx ON Vulnerability_Notification (priority);`)
+		}),
+		Down: migrate.Queries([]string{
+			`DROP INDEX vulnerability_notification_priority_idx;`,
+			`ALTER TABLE Vulnerability_Notification DROP COLUMN priority;`,
+		}),
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration creates the notification delivery outbox and the record of
+	// every delivery attempt.
+	RegisterMigration(migrate.Migration{
+		ID: 8,
+		Up: migrate.Queries([]string{
+			`CREATE TABLE IF NOT EXISTS Notification_Delivery (
+        id SERIAL PRIMARY KEY,
+        notification_id INT NOT NULL REFERENCES Vulnerability_Notification ON DELETE CASCADE,
+        notifier VARCHAR(64) NOT NULL,
+        key VARCHAR(64) NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE,
+        delivered_at TIMESTAMP WITH TIME ZONE NULL,
+        UNIQUE (notification_id, notifier));`,
+
+			`CREATE TABLE IF NOT EXISTS Notification_Delivery_Attempt (
+        id SERIAL PRIMARY KEY,
+        delivery_id INT NOT NULL REFERENCES Notification_Delivery ON DELETE CASCADE,
+        attempted_at TIMESTAMP WITH TIME ZONE,
+        succeeded BOOLEAN NOT NULL,
+        error TEXT NULL);`,
+			`CREATE INDEX ON Notification_Delivery_Attempt (delivery_id);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS Notification_Delivery, Notification_Delivery_Attempt CASCADE;`,
+		}),
+	})
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration creates the tables into which the vulnerabilities of end-of-life namespaces
+	// are archived, keeping their original identifiers.
+	RegisterMigration(migrate.Migration{
+		ID: 9,
+		Up: withDialect(func(cockroachDB bool) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS Vulnerability_Archive (
+        id INT PRIMARY KEY,
+        namespace_id INT NOT NULL REFERENCES Namespace,
+        name VARCHAR(128) NOT NULL,
+        description TEXT NULL,
+        link VARCHAR(128) NULL,
+        severity ` + enumType(cockroachDB, "severity") + ` NOT NULL,
+        metadata TEXT NULL,
+        created_at TIMESTAMP WITH TIME ZONE,
+        deleted_at TIMESTAMP WITH TIME ZONE NULL,
+        archived_at TIMESTAMP WITH TIME ZONE);`,
+				`CREATE INDEX ON Vulnerability_Archive (namespace_id, name);`,
+
+				`CREATE TABLE IF NOT EXISTS Vulnerability_FixedIn_Feature_Archive (
+        id INT PRIMARY KEY,
+        vulnerability_id INT NOT NULL REFERENCES Vulnerability_Archive ON DELETE CASCADE,
+        feature_id INT NOT NULL REFERENCES Feature,
+        version VARCHAR(128) NOT NULL);`,
+				`CREATE INDEX ON Vulnerability_FixedIn_Feature_Archive (vulnerability_id);`,
+			}
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS Vulnerability_Archive, Vulnerability_FixedIn_Feature_Archive CASCADE;`,
+		}),
+	})
+}
@@ -0,0 +1,33 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration stores the feeds that contributed to every vulnerability, along with their
+	// license.
+	RegisterMigration(migrate.Migration{
+		ID: 10,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability ADD COLUMN sources TEXT NULL;`,
+			`ALTER TABLE Vulnerability_Archive ADD COLUMN sources TEXT NULL;`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability DROP COLUMN sources;`,
+			`ALTER TABLE Vulnerability_Archive DROP COLUMN sources;`,
+		}),
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration stores the name of the features detector that found every FeatureVersion
+	// added by a layer, so matches can be explained.
+	RegisterMigration(migrate.Migration{
+		ID: 11,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE Layer_diff_FeatureVersion ADD COLUMN detector VARCHAR(64) NULL;`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Layer_diff_FeatureVersion DROP COLUMN detector;`,
+		}),
+	})
+}
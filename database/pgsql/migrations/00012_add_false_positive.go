@@ -0,0 +1,40 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration stores the findings that users have flagged as false positives.
+	RegisterMigration(migrate.Migration{
+		ID: 12,
+		Up: migrate.Queries([]string{
+			`CREATE TABLE IF NOT EXISTS False_Positive (
+				id SERIAL PRIMARY KEY,
+				name VARCHAR(64) NOT NULL UNIQUE,
+				namespace_id INT NOT NULL REFERENCES Namespace,
+				vulnerability_name VARCHAR(128) NOT NULL,
+				feature_name VARCHAR(128) NOT NULL,
+				feature_version VARCHAR(128) NOT NULL,
+				reason TEXT NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE,
+				UNIQUE (namespace_id, vulnerability_name, feature_name, feature_version));`,
+			`CREATE INDEX ON False_Positive (vulnerability_name);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS False_Positive;`,
+		}),
+	})
+}
@@ -0,0 +1,41 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration stores the mutable tags that Clair keeps indexed.
+	RegisterMigration(migrate.Migration{
+		ID: 13,
+		Up: migrate.Queries([]string{
+			`CREATE TABLE IF NOT EXISTS Watched_Tag (
+				id SERIAL PRIMARY KEY,
+				name VARCHAR(64) NOT NULL UNIQUE,
+				registry VARCHAR(256) NOT NULL,
+				repository VARCHAR(256) NOT NULL,
+				tag VARCHAR(128) NOT NULL,
+				digest VARCHAR(128) NOT NULL DEFAULT '',
+				layer_name VARCHAR(128) NOT NULL DEFAULT '',
+				created_at TIMESTAMP WITH TIME ZONE,
+				resolved_at TIMESTAMP WITH TIME ZONE NULL,
+				changed_at TIMESTAMP WITH TIME ZONE NULL,
+				UNIQUE (registry, repository, tag));`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS Watched_Tag;`,
+		}),
+	})
+}
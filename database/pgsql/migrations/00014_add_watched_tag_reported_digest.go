@@ -0,0 +1,36 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration stores the digest the watched tags pointed to when they were last reported,
+	// so that their moves can be listed. The tags that were already resolved start from their
+	// current digest.
+	RegisterMigration(migrate.Migration{
+		ID: 14,
+		Up: withDialect(func(cockroachDB bool) []string {
+			return append([]string{
+				`ALTER TABLE Watched_Tag ADD COLUMN reported_digest VARCHAR(128) NOT NULL DEFAULT '';`,
+			}, backfill(cockroachDB,
+				`UPDATE Watched_Tag SET reported_digest = digest;`,
+			)...)
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Watched_Tag DROP COLUMN reported_digest;`,
+		}),
+	})
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration stores the in-toto statements attesting how images were built.
+	RegisterMigration(migrate.Migration{
+		ID: 16,
+		Up: migrate.Queries([]string{
+			`CREATE TABLE IF NOT EXISTS Provenance (
+				id SERIAL PRIMARY KEY,
+				name VARCHAR(64) NOT NULL UNIQUE,
+				digest VARCHAR(128) NOT NULL,
+				predicate_type VARCHAR(256) NOT NULL,
+				builder_id TEXT NOT NULL,
+				statement TEXT NOT NULL,
+				statement_hash VARCHAR(64) NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE,
+				UNIQUE (digest, statement_hash));`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS Provenance;`,
+		}),
+	})
+}
@@ -0,0 +1,36 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration stores, for every layer rather than for the one adding them, the executables
+	// and libraries of its FeatureVersions that are in the image, since a layer may delete the
+	// files of the FeatureVersions of its parents without changing them.
+	RegisterMigration(migrate.Migration{
+		ID: 20,
+		Up: migrate.Queries([]string{
+			`CREATE TABLE IF NOT EXISTS Layer_FeatureVersion_Evidence (
+				layer_id INT NOT NULL REFERENCES Layer ON DELETE CASCADE,
+				featureversion_id INT NOT NULL REFERENCES FeatureVersion,
+				evidence TEXT NOT NULL,
+				PRIMARY KEY (layer_id, featureversion_id));`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS Layer_FeatureVersion_Evidence CASCADE;`,
+		}),
+	})
+}
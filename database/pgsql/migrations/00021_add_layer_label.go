@@ -0,0 +1,35 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration stores the labels that clients attach to layers.
+	RegisterMigration(migrate.Migration{
+		ID: 21,
+		Up: migrate.Queries([]string{
+			`CREATE TABLE IF NOT EXISTS Layer_Label (
+				layer_id INT NOT NULL REFERENCES Layer ON DELETE CASCADE,
+				key VARCHAR(128) NOT NULL,
+				value VARCHAR(256) NOT NULL,
+				PRIMARY KEY (layer_id, key));`,
+			`CREATE INDEX ON Layer_Label (key, value);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS Layer_Label;`,
+		}),
+	})
+}
@@ -0,0 +1,34 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration maps the digests of the images resolved by the tracker to their top layer.
+	RegisterMigration(migrate.Migration{
+		ID: 22,
+		Up: migrate.Queries([]string{
+			`CREATE TABLE IF NOT EXISTS Image (
+				id SERIAL PRIMARY KEY,
+				digest VARCHAR(128) NOT NULL UNIQUE,
+				layer_id INT NOT NULL REFERENCES Layer ON DELETE CASCADE,
+				created_at TIMESTAMP WITH TIME ZONE);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS Image;`,
+		}),
+	})
+}
@@ -0,0 +1,37 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration records the kind of change that the notifications announce. The creations and
+	// deletions of vulnerabilities are classified retroactively, the other notifications have no
+	// reason.
+	RegisterMigration(migrate.Migration{
+		ID: 25,
+		Up: withDialect(func(cockroachDB bool) []string {
+			return append([]string{
+				`ALTER TABLE Vulnerability_Notification ADD COLUMN reason VARCHAR(32) NULL;`,
+			}, backfill(cockroachDB,
+				`UPDATE Vulnerability_Notification SET reason = 'NewVulnerability' WHERE old_vulnerability_id IS NULL;`,
+				`UPDATE Vulnerability_Notification SET reason = 'Deleted' WHERE new_vulnerability_id IS NULL;`,
+			)...)
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability_Notification DROP COLUMN reason;`,
+		}),
+	})
+}
@@ -0,0 +1,36 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	// This migration stores the results of the analyses of the blobs of the layers, by digest, so
+	// the layers sharing a blob are only analyzed once.
+	RegisterMigration(migrate.Migration{
+		ID: 28,
+		Up: migrate.Queries([]string{
+			`CREATE TABLE IF NOT EXISTS Layer_Analysis (
+				id SERIAL PRIMARY KEY,
+				digest VARCHAR(128) NOT NULL UNIQUE,
+				version VARCHAR(128) NOT NULL,
+				result TEXT NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS Layer_Analysis;`,
+		}),
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/remind101/migrate"
+
+	"github.com/coreos/clair/ext/versionfmt"
+	// Register the version format of the Alpine namespaces.
+	_ "github.com/coreos/clair/ext/versionfmt/apk"
+)
+
+const (
+	searchAlpineFixedInFeatureVersion = `
+		SELECT vff.id, vff.vulnerability_id, vff.version, fv.id, fv.version, n.version_format
+		FROM Vulnerability_FixedIn_Feature vff
+			JOIN Feature f ON f.id = vff.feature_id
+			JOIN Namespace n ON n.id = f.namespace_id
+			JOIN FeatureVersion fv ON fv.feature_id = f.id
+		WHERE n.name LIKE 'alpine:%'`
+
+	removeAlpineVulnerabilityAffectsFeatureVersion = `
+		DELETE FROM Vulnerability_Affects_FeatureVersion
+		WHERE fixedin_id IN (
+			SELECT vff.id
+			FROM Vulnerability_FixedIn_Feature vff
+				JOIN Feature f ON f.id = vff.feature_id
+				JOIN Namespace n ON n.id = f.namespace_id
+			WHERE n.name LIKE 'alpine:%')`
+
+	insertAlpineVulnerabilityAffectsFeatureVersion = `
+		INSERT INTO Vulnerability_Affects_FeatureVersion(vulnerability_id, featureversion_id, fixedin_id)
+		VALUES($1, $2, $3)`
+)
+
+func init() {
+	// This migration links the Alpine packages to the vulnerabilities affecting them again, as
+	// they were compared with the dpkg rules before the 24th migration switched the Alpine
+	// namespaces to the apk ones. The updaters don't do it, as the vulnerabilities are unchanged.
+	RegisterMigration(migrate.Migration{
+		ID: 30,
+		Up: relinkAlpineVulnerabilities,
+		// The affected versions are still the ones of the apk rules.
+		Down: migrate.Queries([]string{}),
+	})
+}
+
+// relinkAlpineVulnerabilities computes the Vulnerability_Affects_FeatureVersion rows of the
+// Alpine namespaces again, using their current version format.
+func relinkAlpineVulnerabilities(tx *sql.Tx) error {
+	type affect struct {
+		vulnerabilityID, featureVersionID, fixedInID int
+	}
+
+	rows, err := tx.Query(searchAlpineFixedInFeatureVersion)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var affects []affect
+	for rows.Next() {
+		var (
+			a                                      affect
+			fixedInVersion, version, versionFormat string
+		)
+		if err := rows.Scan(&a.fixedInID, &a.vulnerabilityID, &fixedInVersion, &a.featureVersionID, &version, &versionFormat); err != nil {
+			return err
+		}
+
+		cmp, err := versionfmt.Compare(versionFormat, version, fixedInVersion)
+		if err != nil {
+			return err
+		}
+		if cmp < 0 {
+			affects = append(affects, a)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(removeAlpineVulnerabilityAffectsFeatureVersion); err != nil {
+		return err
+	}
+	for _, a := range affects {
+		if _, err := tx.Exec(insertAlpineVulnerabilityAffectsFeatureVersion, a.vulnerabilityID, a.featureVersionID, a.fixedInID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -16,7 +16,12 @@
 // backend.
 package migrations
 
-import "github.com/remind101/migrate"
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/remind101/migrate"
+)
 
 // Migrations contains every available migrations.
 var Migrations []migrate.Migration
@@ -25,3 +30,36 @@ var Migrations []migrate.Migration
 func RegisterMigration(migration migrate.Migration) {
 	Migrations = append(Migrations, migration)
 }
+
+// withDialect runs the queries that build returns for the database, depending on whether it is
+// CockroachDB, which lacks some of the PostgreSQL features that the migrations use.
+func withDialect(build func(cockroachDB bool) []string) func(*sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		var version string
+		if err := tx.QueryRow("SELECT version()").Scan(&version); err != nil {
+			return err
+		}
+		return migrate.Queries(build(strings.Contains(version, "CockroachDB")))(tx)
+	}
+}
+
+// enumType returns the type of a column holding values of the given enumerated type.
+// CockroachDB doesn't support enumerated types, in which case the values are stored as strings.
+func enumType(cockroachDB bool, name string) string {
+	if cockroachDB {
+		return "VARCHAR(16)"
+	}
+	return name
+}
+
+// backfill returns the given queries, which fill a column added by the same migration, unless the
+// database is CockroachDB, which can't write to a column in the transaction that adds it.
+//
+// Clair could not run on CockroachDB before the migrations supported it, hence the tables are
+// always empty when they run there and there is nothing to fill.
+func backfill(cockroachDB bool, queries ...string) []string {
+	if cockroachDB {
+		return nil
+	}
+	return queries
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/database/pgsql/migrations"
+	"github.com/coreos/clair/database/testutil"
+	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestRelinkAlpineVulnerabilities(t *testing.T) {
+	datastore, err := openDatabaseForTest("RelinkAlpineVulnerabilities", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer datastore.Close()
+
+	// The Alpine packages were compared with the dpkg rules, which order the release candidates
+	// after the releases.
+	namespace := database.Namespace{Name: "alpine:v3.18", VersionFormat: dpkg.ParserName}
+	layer := testutil.Layer("TestRelinkAlpineVulnerabilities", nil, &namespace, testutil.FeatureVersion(namespace, "openssl", "1.2.3_rc1-r0"))
+	if !assert.Nil(t, datastore.InsertLayer(layer)) {
+		return
+	}
+	vulnerability := testutil.Vulnerability(namespace, "CVE-2024-0001", types.High, testutil.FeatureVersion(namespace, "openssl", "1.2.3-r0"))
+	if !assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, false)) {
+		return
+	}
+	affectedBy := func() []database.Vulnerability {
+		layer, err := datastore.FindLayer(layer.Name, true, true)
+		if !assert.Nil(t, err) || !assert.Len(t, layer.Features, 1) {
+			return nil
+		}
+		return layer.Features[0].AffectedBy
+	}
+	assert.Len(t, affectedBy(), 0)
+
+	// The 24th migration switched the namespace to the apk rules, and the next one links the
+	// package to the vulnerability again.
+	_, err = datastore.DB.DB.Exec(`UPDATE Namespace SET version_format = 'apk' WHERE name LIKE 'alpine:%'`)
+	if !assert.Nil(t, err) {
+		return
+	}
+	for _, migration := range migrations.Migrations {
+		if migration.ID != 30 {
+			continue
+		}
+		tx, err := datastore.DB.DB.Begin()
+		if !assert.Nil(t, err) {
+			return
+		}
+		if !assert.Nil(t, migration.Up(tx)) {
+			tx.Rollback()
+			return
+		}
+		assert.Nil(t, tx.Commit())
+	}
+	if vulnerabilities := affectedBy(); assert.Len(t, vulnerabilities, 1) {
+		assert.Equal(t, "CVE-2024-0001", vulnerabilities[0].Name)
+	}
+}
@@ -73,3 +73,117 @@ func (pgSQL *pgSQL) ListNamespaces() (namespaces []database.Namespace, err error
 
 	return namespaces, err
 }
+
+func (pgSQL *pgSQL) ListUnusedNamespaces() (namespaces []database.Namespace, err error) {
+	defer observeQueryTime("ListUnusedNamespaces", "all", time.Now())
+
+	rows, err := pgSQL.Query(searchUnusedNamespace)
+	if err != nil {
+		return namespaces, handleError("searchUnusedNamespace", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ns database.Namespace
+
+		err = rows.Scan(&ns.ID, &ns.Name, &ns.VersionFormat)
+		if err != nil {
+			return namespaces, handleError("searchUnusedNamespace.Scan()", err)
+		}
+
+		namespaces = append(namespaces, ns)
+	}
+	if err = rows.Err(); err != nil {
+		return namespaces, handleError("searchUnusedNamespace.Rows()", err)
+	}
+
+	return namespaces, err
+}
+
+// PruneNamespace removes the vulnerabilities of an unused Namespace and, unless the cache is
+// enabled, its features and feature versions that nothing references anymore, in a single
+// transaction. The features are kept when the cache is enabled because the Clair instances sharing
+// the database may hold their identifiers.
+func (pgSQL *pgSQL) PruneNamespace(name string) (database.PrunedNamespace, error) {
+	if name == "" {
+		return database.PrunedNamespace{}, cerrors.NewBadRequestError("could not prune an empty namespace")
+	}
+
+	defer observeQueryTime("PruneNamespace", "all", time.Now())
+
+	var pruned database.PrunedNamespace
+	err := withSerializationRetry(func() (err error) {
+		pruned, err = pgSQL.pruneNamespace(name)
+		return
+	})
+	return pruned, err
+}
+
+func (pgSQL *pgSQL) pruneNamespace(name string) (database.PrunedNamespace, error) {
+	var pruned database.PrunedNamespace
+
+	tx, err := pgSQL.Begin()
+	if err != nil {
+		return pruned, handleError("PruneNamespace.Begin()", err)
+	}
+
+	// Lock Vulnerability_Affects_FeatureVersion exclusively so that no FeatureVersion is linked to
+	// the vulnerabilities while they are being removed, then lock the Namespace so that no Layer can
+	// start using it.
+	if err = pgSQL.lockAffects(tx); err != nil {
+		tx.Rollback()
+		return pruned, handleError("PruneNamespace.lockVulnerabilityAffects", err)
+	}
+
+	var namespaceID int
+	if err = tx.QueryRow(searchNamespaceForUpdate, name).Scan(&namespaceID); err != nil {
+		tx.Rollback()
+		return pruned, handleError("searchNamespaceForUpdate", err)
+	}
+
+	var inUse bool
+	if err = tx.QueryRow(searchNamespaceInUse, namespaceID).Scan(&inUse); err != nil {
+		tx.Rollback()
+		return pruned, handleError("searchNamespaceInUse", err)
+	}
+	if inUse {
+		tx.Rollback()
+		return pruned, database.ErrNamespaceInUse
+	}
+
+	// Removing the vulnerabilities cascades to the notifications that reference them.
+	prunes := []struct {
+		name  string
+		query string
+		count *int
+	}{
+		{"pruneVulnerabilityAffects", pruneVulnerabilityAffects, nil},
+		{"pruneVulnerabilityFixedIn", pruneVulnerabilityFixedIn, nil},
+		{"pruneVulnerability", pruneVulnerability, &pruned.Vulnerabilities},
+		{"pruneFeatureVersion", pruneFeatureVersion, &pruned.FeatureVersions},
+		{"pruneFeature", pruneFeature, &pruned.Features},
+	}
+	if pgSQL.cache != nil {
+		prunes = prunes[:3]
+	}
+
+	for _, prune := range prunes {
+		var count int
+		var size int64
+		if err = tx.QueryRow(prune.query, namespaceID).Scan(&count, &size); err != nil {
+			tx.Rollback()
+			return database.PrunedNamespace{}, handleError(prune.name, err)
+		}
+		if prune.count != nil {
+			*prune.count = count
+		}
+		pruned.Bytes += size
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return database.PrunedNamespace{}, handleError("PruneNamespace.Commit()", err)
+	}
+
+	return pruned, nil
+}
@@ -19,20 +19,22 @@ import (
 	"time"
 
 	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/tracing"
 	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
 	"github.com/guregu/null/zero"
-	"github.com/pborman/uuid"
 )
 
 // do it in tx so we won't insert/update a vuln without notification and vice-versa.
 // name and created doesn't matter.
-func createNotification(tx *sql.Tx, oldVulnerabilityID, newVulnerabilityID int) error {
+// contentHash is the database.ContentHash of the new vulnerability, if any.
+func createNotification(tx *tracing.Tx, oldVulnerabilityID, newVulnerabilityID int, priority types.Priority, reason database.NotificationReason, contentHash string) error {
 	defer observeQueryTime("createNotification", "all", time.Now())
 
 	// Insert Notification.
 	oldVulnerabilityNullableID := sql.NullInt64{Int64: int64(oldVulnerabilityID), Valid: oldVulnerabilityID != 0}
 	newVulnerabilityNullableID := sql.NullInt64{Int64: int64(newVulnerabilityID), Valid: newVulnerabilityID != 0}
-	_, err := tx.Exec(insertNotification, uuid.New(), oldVulnerabilityNullableID, newVulnerabilityNullableID)
+	_, err := tx.Exec(insertNotification, database.NewNotificationName(), oldVulnerabilityNullableID, newVulnerabilityNullableID, &priority, string(reason), zero.StringFrom(contentHash))
 	if err != nil {
 		tx.Rollback()
 		return handleError("insertNotification", err)
@@ -41,16 +43,70 @@ func createNotification(tx *sql.Tx, oldVulnerabilityID, newVulnerabilityID int)
 	return nil
 }
 
-// Get one available notification name (!locked && !deleted && (!notified || notified_but_timed-out)).
+// isDuplicateNotification returns whether a notification created after the given time already
+// announced the same content of the vulnerability, e.g. because the feed flaps the vulnerability
+// between two states.
+func isDuplicateNotification(tx *tracing.Tx, namespaceID int, name, contentHash string, after time.Time) (bool, error) {
+	defer observeQueryTime("isDuplicateNotification", "all", time.Now())
+
+	var duplicate bool
+	err := tx.QueryRow(searchNotificationDuplicate, namespaceID, name, contentHash, after).Scan(&duplicate)
+	if err != nil {
+		tx.Rollback()
+		return false, handleError("searchNotificationDuplicate", err)
+	}
+
+	return duplicate, nil
+}
+
+// Get one available notification name (!locked && !deleted && (!notified || notified_but_timed-out))
+// and lock it for the given owner. Notifications with the highest priority are returned first.
 // Does not fill new/old vuln.
-func (pgSQL *pgSQL) GetAvailableNotification(renotifyInterval time.Duration) (database.VulnerabilityNotification, error) {
+func (pgSQL *pgSQL) GetAvailableNotification(renotifyInterval time.Duration, owner string, lockDuration time.Duration) (database.VulnerabilityNotification, error) {
+	if owner == "" || lockDuration <= 0 {
+		log.Warning("could not claim a notification with an invalid lock")
+		return database.VulnerabilityNotification{}, cerrors.NewBadRequestError("could not claim a notification with an invalid lock")
+	}
+
 	defer observeQueryTime("GetAvailableNotification", "all", time.Now())
 
+	// Expired locks would hide their notifications from the search.
+	pgSQL.pruneLocks()
+
 	before := time.Now().Add(-renotifyInterval)
-	row := pgSQL.QueryRow(searchNotificationAvailable, before)
-	notification, err := pgSQL.scanNotification(row, false)
+	for {
+		row := pgSQL.QueryRow(pgSQL.searchNotificationAvailableQuery(), before)
+		notification, err := pgSQL.scanNotification(row, false)
+		if err != nil {
+			return notification, handleError("searchNotificationAvailable", err)
+		}
+
+		// Another owner may have locked the notification since it has been searched, in which case
+		// it isn't returned by the search anymore.
+		if locked, _ := pgSQL.Lock(notification.Name, owner, lockDuration, false); locked {
+			return notification, nil
+		}
+	}
+}
+
+// ExtendNotificationLock renews the lock of a notification if the given owner still holds it.
+func (pgSQL *pgSQL) ExtendNotificationLock(name, owner string, duration time.Duration) (bool, time.Time) {
+	defer observeQueryTime("ExtendNotificationLock", "all", time.Now())
+
+	until := time.Now().Add(duration)
+	r, err := pgSQL.Exec(updateLock, name, owner, until)
+	if err != nil {
+		handleError("updateLock", err)
+		return false, until
+	}
+	n, _ := r.RowsAffected()
+
+	return n > 0, until
+}
 
-	return notification, handleError("searchNotificationAvailable", err)
+// ReleaseNotificationLock unlocks a notification if the given owner holds its lock.
+func (pgSQL *pgSQL) ReleaseNotificationLock(name, owner string) {
+	pgSQL.Unlock(name, owner)
 }
 
 func (pgSQL *pgSQL) GetNotification(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
@@ -91,6 +147,8 @@ func (pgSQL *pgSQL) scanNotification(row *sql.Row, hasVulns bool) (database.Vuln
 	var created zero.Time
 	var notified zero.Time
 	var deleted zero.Time
+	var failed zero.Time
+	var reason zero.String
 	var oldVulnerabilityNullableID sql.NullInt64
 	var newVulnerabilityNullableID sql.NullInt64
 
@@ -102,6 +160,9 @@ func (pgSQL *pgSQL) scanNotification(row *sql.Row, hasVulns bool) (database.Vuln
 			&created,
 			&notified,
 			&deleted,
+			&failed,
+			&notification.Priority,
+			&reason,
 			&oldVulnerabilityNullableID,
 			&newVulnerabilityNullableID,
 		)
@@ -110,16 +171,18 @@ func (pgSQL *pgSQL) scanNotification(row *sql.Row, hasVulns bool) (database.Vuln
 			return notification, err
 		}
 	} else {
-		err := row.Scan(&notification.ID, &notification.Name, &created, &notified, &deleted)
+		err := row.Scan(&notification.ID, &notification.Name, &created, &notified, &deleted, &failed, &notification.Priority, &reason)
 
 		if err != nil {
 			return notification, err
 		}
 	}
 
+	notification.Reason = database.NotificationReason(reason.String)
 	notification.Created = created.Time
 	notification.Notified = notified.Time
 	notification.Deleted = deleted.Time
+	notification.Failed = failed.Time
 
 	if hasVulns {
 		if oldVulnerabilityNullableID.Valid {
@@ -175,7 +238,7 @@ func (pgSQL *pgSQL) loadLayerIntroducingVulnerability(vulnerability *database.Vu
 	}
 	defer tx.Commit()
 
-	_, err = tx.Exec(disableHashJoin)
+	err = pgSQL.setPlannerHint(tx, disableHashJoin)
 	if err != nil {
 		log.Warningf("searchNotificationLayerIntroducingVulnerability: could not disable hash join: %s", err)
 	}
@@ -210,6 +273,9 @@ func (pgSQL *pgSQL) loadLayerIntroducingVulnerability(vulnerability *database.Vu
 		size = len(layers)
 	}
 	vulnerability.LayersIntroducingVulnerability = layers[:size]
+	if err = loadLayerLabels(tx, vulnerability.LayersIntroducingVulnerability); err != nil {
+		return -1, err
+	}
 
 	nextID := -1
 	if len(layers) > limit {
@@ -228,6 +294,15 @@ func (pgSQL *pgSQL) SetNotificationNotified(name string) error {
 	return nil
 }
 
+func (pgSQL *pgSQL) SetNotificationFailed(name string) error {
+	defer observeQueryTime("SetNotificationFailed", "all", time.Now())
+
+	if _, err := pgSQL.Exec(updatedNotificationFailed, name); err != nil {
+		return handleError("updatedNotificationFailed", err)
+	}
+	return nil
+}
+
 func (pgSQL *pgSQL) DeleteNotification(name string) error {
 	defer observeQueryTime("DeleteNotification", "all", time.Now())
 
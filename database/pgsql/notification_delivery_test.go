@@ -0,0 +1,104 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestNotificationDelivery(t *testing.T) {
+	datastore, err := openDatabaseForTest("NotificationDelivery", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer datastore.Close()
+
+	// Create a notification.
+	vulnerability := database.Vulnerability{
+		Name: "TestNotificationDeliveryVulnerability",
+		Namespace: database.Namespace{
+			Name:          "TestNotificationDeliveryNamespace",
+			VersionFormat: dpkg.ParserName,
+		},
+		Severity: types.High,
+	}
+	if !assert.Nil(t, datastore.insertVulnerability(vulnerability, false, true)) {
+		return
+	}
+	notification, err := datastore.GetAvailableNotification(time.Second, "test", time.Minute)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Create the delivery, it must be found again with the same key.
+	delivery, err := datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.NotEmpty(t, delivery.Key)
+		assert.True(t, delivery.Delivered.IsZero())
+	}
+	sameDelivery, err := datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.Equal(t, delivery.ID, sameDelivery.ID)
+		assert.Equal(t, delivery.Key, sameDelivery.Key)
+	}
+
+	// Record a failed attempt and a successful one.
+	assert.Nil(t, datastore.InsertNotificationDeliveryAttempt(delivery, false, "connection refused"))
+	assert.Nil(t, datastore.InsertNotificationDeliveryAttempt(delivery, true, ""))
+
+	deliveries, err := datastore.ListNotificationDeliveries(notification.Name)
+	if assert.Nil(t, err) && assert.Len(t, deliveries, 1) {
+		assert.Equal(t, "TestNotifier", deliveries[0].Notifier)
+		assert.False(t, deliveries[0].Delivered.IsZero())
+		if assert.Len(t, deliveries[0].Attempts, 2) {
+			assert.False(t, deliveries[0].Attempts[0].Succeeded)
+			assert.Equal(t, "connection refused", deliveries[0].Attempts[0].Error)
+			assert.True(t, deliveries[0].Attempts[1].Succeeded)
+		}
+	}
+
+	// Once delivered, the delivery must not be reopened until the notification is sent again.
+	delivery, err = datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.False(t, delivery.Delivered.IsZero())
+	}
+
+	// Sending the notification again reopens the delivery with a new key.
+	assert.Nil(t, datastore.SetNotificationNotified(notification.Name))
+	delivery, err = datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.True(t, delivery.Delivered.IsZero())
+		assert.NotEqual(t, sameDelivery.Key, delivery.Key)
+	}
+
+	// The notification is notified but its delivery is open, e.g. held during a maintenance window.
+	notifications, err := datastore.ListUndeliveredNotifications("TestNotifier")
+	if assert.Nil(t, err) && assert.Len(t, notifications, 1) {
+		assert.Equal(t, notification.Name, notifications[0].Name)
+		assert.Equal(t, types.High, notifications[0].Priority)
+	}
+	assert.Nil(t, datastore.InsertNotificationDeliveryAttempt(delivery, true, ""))
+	notifications, err = datastore.ListUndeliveredNotifications("TestNotifier")
+	assert.Nil(t, err)
+	assert.Len(t, notifications, 0)
+}
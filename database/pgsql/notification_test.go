@@ -36,7 +36,7 @@ func TestNotification(t *testing.T) {
 	defer datastore.Close()
 
 	// Try to get a notification when there is none.
-	_, err = datastore.GetAvailableNotification(time.Second)
+	_, err = datastore.GetAvailableNotification(time.Second, "test", time.Minute)
 	assert.Equal(t, cerrors.ErrNotFound, err)
 
 	// Create some data.
@@ -120,16 +120,17 @@ func TestNotification(t *testing.T) {
 	assert.Nil(t, datastore.insertVulnerability(v1, false, true))
 
 	// Get the notification associated to the previously inserted vulnerability.
-	notification, err := datastore.GetAvailableNotification(time.Second)
+	notification, err := datastore.GetAvailableNotification(time.Second, "test", time.Minute)
 
 	if assert.Nil(t, err) && assert.NotEmpty(t, notification.Name) {
 		// Verify the renotify behaviour.
 		if assert.Nil(t, datastore.SetNotificationNotified(notification.Name)) {
-			_, err := datastore.GetAvailableNotification(time.Second)
+			datastore.ReleaseNotificationLock(notification.Name, "test")
+			_, err := datastore.GetAvailableNotification(time.Second, "test", time.Minute)
 			assert.Equal(t, cerrors.ErrNotFound, err)
 
 			time.Sleep(50 * time.Millisecond)
-			notificationB, err := datastore.GetAvailableNotification(20 * time.Millisecond)
+			notificationB, err := datastore.GetAvailableNotification(20*time.Millisecond, "test", time.Minute)
 			assert.Nil(t, err)
 			assert.Equal(t, notification.Name, notificationB.Name)
 
@@ -163,7 +164,7 @@ func TestNotification(t *testing.T) {
 		// Delete notification.
 		assert.Nil(t, datastore.DeleteNotification(notification.Name))
 
-		_, err = datastore.GetAvailableNotification(time.Millisecond)
+		_, err = datastore.GetAvailableNotification(time.Millisecond, "test", time.Minute)
 		assert.Equal(t, cerrors.ErrNotFound, err)
 	}
 
@@ -182,7 +183,7 @@ func TestNotification(t *testing.T) {
 	}
 
 	if assert.Nil(t, datastore.insertVulnerability(v1b, false, true)) {
-		notification, err = datastore.GetAvailableNotification(time.Second)
+		notification, err = datastore.GetAvailableNotification(time.Second, "test", time.Minute)
 		assert.Nil(t, err)
 		assert.NotEmpty(t, notification.Name)
 
@@ -210,7 +211,7 @@ func TestNotification(t *testing.T) {
 
 	// Delete a vulnerability and verify the notification.
 	if assert.Nil(t, datastore.DeleteVulnerability(v1b.Namespace.Name, v1b.Name)) {
-		notification, err = datastore.GetAvailableNotification(time.Second)
+		notification, err = datastore.GetAvailableNotification(time.Second, "test", time.Minute)
 		assert.Nil(t, err)
 		assert.NotEmpty(t, notification.Name)
 
@@ -230,3 +231,130 @@ func TestNotification(t *testing.T) {
 		}
 	}
 }
+
+func TestNotificationPriority(t *testing.T) {
+	datastore, err := openDatabaseForTest("NotificationPriority", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer datastore.Close()
+
+	namespace := database.Namespace{
+		Name:          "TestNotificationPriorityNamespace",
+		VersionFormat: dpkg.ParserName,
+	}
+
+	// Insert a low vulnerability first and a critical one afterwards.
+	low := database.Vulnerability{
+		Name:      "TestNotificationPriorityVulnerabilityLow",
+		Namespace: namespace,
+		Severity:  types.Low,
+	}
+	critical := database.Vulnerability{
+		Name:      "TestNotificationPriorityVulnerabilityCritical",
+		Namespace: namespace,
+		Severity:  types.Critical,
+	}
+	if !assert.Nil(t, datastore.insertVulnerability(low, false, true)) ||
+		!assert.Nil(t, datastore.insertVulnerability(critical, false, true)) {
+		return
+	}
+
+	// The critical notification must be handed out before the low one.
+	notification, err := datastore.GetAvailableNotification(time.Second, "test", time.Minute)
+	if assert.Nil(t, err) && assert.Equal(t, types.Critical, notification.Priority) {
+		assert.Nil(t, datastore.DeleteNotification(notification.Name))
+
+		notification, err = datastore.GetAvailableNotification(time.Second, "test", time.Minute)
+		if assert.Nil(t, err) {
+			assert.Equal(t, types.Low, notification.Priority)
+		}
+	}
+}
+
+func TestNotificationOrder(t *testing.T) {
+	datastore, err := openDatabaseForTest("NotificationOrder", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer datastore.Close()
+
+	// Insert a low vulnerability and raise it to critical afterwards.
+	vulnerability := database.Vulnerability{
+		Name: "TestNotificationOrderVulnerability",
+		Namespace: database.Namespace{
+			Name:          "TestNotificationOrderNamespace",
+			VersionFormat: dpkg.ParserName,
+		},
+		Severity: types.Low,
+	}
+	if !assert.Nil(t, datastore.insertVulnerability(vulnerability, false, true)) {
+		return
+	}
+	vulnerability.Severity = types.Critical
+	if !assert.Nil(t, datastore.insertVulnerability(vulnerability, false, true)) {
+		return
+	}
+
+	// The changes of a vulnerability are handed out in creation order, regardless of their priority.
+	notification, err := datastore.GetAvailableNotification(time.Hour, "test", time.Minute)
+	if assert.Nil(t, err) && assert.Equal(t, types.Low, notification.Priority) {
+		// The critical change is held back while the low one is being delivered.
+		_, err = datastore.GetAvailableNotification(time.Hour, "test", time.Minute)
+		assert.Equal(t, cerrors.ErrNotFound, err)
+
+		assert.Nil(t, datastore.SetNotificationNotified(notification.Name))
+		datastore.ReleaseNotificationLock(notification.Name, "test")
+		notification, err = datastore.GetAvailableNotification(time.Hour, "test", time.Minute)
+		if assert.Nil(t, err) {
+			assert.Equal(t, types.Critical, notification.Priority)
+		}
+	}
+}
+
+func TestNotificationDeduplication(t *testing.T) {
+	datastore, err := openDatabaseForTest("NotificationDeduplication", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer datastore.Close()
+	datastore.config.DeduplicationWindows = map[types.Priority]time.Duration{types.High: time.Hour}
+
+	namespace := database.Namespace{
+		Name:          "TestNotificationDeduplicationNamespace",
+		VersionFormat: dpkg.ParserName,
+	}
+
+	// Flap a high and a low vulnerability between two descriptions.
+	for _, severity := range []types.Priority{types.High, types.Low} {
+		vulnerability := database.Vulnerability{
+			Name:      "TestNotificationDeduplicationVulnerability" + string(severity),
+			Namespace: namespace,
+			Severity:  severity,
+		}
+		for _, description := range []string{"A", "B", "A", "B"} {
+			vulnerability.Description = description
+			if !assert.Nil(t, datastore.insertVulnerability(vulnerability, false, true)) {
+				return
+			}
+		}
+	}
+
+	// Only the first announcement of each content of the high vulnerability has been kept.
+	count := make(map[types.Priority]int)
+	for {
+		notification, err := datastore.GetAvailableNotification(time.Hour, "test", time.Minute)
+		if err == cerrors.ErrNotFound {
+			break
+		}
+		if !assert.Nil(t, err) || !assert.Nil(t, datastore.SetNotificationNotified(notification.Name)) {
+			return
+		}
+		count[notification.Priority]++
+	}
+	assert.Equal(t, 2, count[types.High])
+	assert.Equal(t, 4, count[types.Low])
+}
@@ -30,12 +30,15 @@ import (
 	"github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/remind101/migrate"
+	"golang.org/x/net/context"
 
 	"github.com/coreos/clair/config"
 	"github.com/coreos/clair/database"
 	"github.com/coreos/clair/database/pgsql/migrations"
+	"github.com/coreos/clair/tracing"
 	"github.com/coreos/clair/utils"
 	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
 )
 
 var (
@@ -65,6 +68,16 @@ var (
 		Name: "clair_pgsql_concurrent_lock_vafv_total",
 		Help: "Number of transactions trying to hold the exclusive Vulnerability_Affects_FeatureVersion lock.",
 	})
+
+	promNotificationsDeduplicatedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clair_pgsql_notifications_deduplicated_total",
+		Help: "Number of notifications suppressed because their content was already announced.",
+	}, []string{"priority"})
+
+	promVulnerabilitiesUnchangedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_pgsql_vulnerabilities_unchanged_total",
+		Help: "Number of inserted vulnerabilities whose content was already stored.",
+	})
 )
 
 func init() {
@@ -73,6 +86,8 @@ func init() {
 	prometheus.MustRegister(promCacheQueriesTotal)
 	prometheus.MustRegister(promQueryDurationMilliseconds)
 	prometheus.MustRegister(promConcurrentLockVAFV)
+	prometheus.MustRegister(promNotificationsDeduplicatedTotal)
+	prometheus.MustRegister(promVulnerabilitiesUnchangedTotal)
 
 	database.Register("pgsql", openDatabase)
 }
@@ -83,7 +98,7 @@ type Queryer interface {
 }
 
 type pgSQL struct {
-	*sql.DB
+	*tracing.DB
 	cache  *lru.ARCCache
 	config Config
 }
@@ -97,13 +112,47 @@ func (pgSQL *pgSQL) Close() {
 
 	if pgSQL.config.ManageDatabaseLifecycle {
 		dbName, pgSourceURL, _ := parseConnectionString(pgSQL.config.Source)
-		dropDatabase(pgSourceURL, dbName)
+		dropDatabase(pgSourceURL, dbName, pgSQL.config.CockroachDB)
 	}
 }
 
-// Ping verifies that the database is accessible.
-func (pgSQL *pgSQL) Ping() bool {
-	return pgSQL.DB.Ping() == nil
+// degradedLatency is the round-trip duration above which the database is reported as degraded.
+const degradedLatency = 500 * time.Millisecond
+
+// WithContext returns a copy of the database making its queries with the given context.
+func (pgSQL *pgSQL) WithContext(ctx context.Context) database.Datastore {
+	bound := *pgSQL
+	bound.DB = pgSQL.DB.WithContext(ctx)
+	return &bound
+}
+
+// Health verifies that the database is accessible and reports how long a round-trip takes.
+func (pgSQL *pgSQL) Health(ctx context.Context) (database.HealthStatus, error) {
+	start := time.Now()
+	var version string
+	err := pgSQL.QueryRowContext(ctx, searchServerVersion).Scan(&version)
+	status := database.HealthStatus{
+		State:   database.Healthy,
+		Latency: time.Since(start),
+		Version: version,
+	}
+
+	if err != nil {
+		status.State = database.Unhealthy
+		if ctx.Err() != nil {
+			status.Message = "timed out waiting for the database"
+			return status, ctx.Err()
+		}
+		status.Message = err.Error()
+		return status, handleError("searchServerVersion", err)
+	}
+
+	if status.Latency > degradedLatency {
+		status.State = database.Degraded
+		status.Message = fmt.Sprintf("round-trip took more than %v", degradedLatency)
+	}
+
+	return status, nil
 }
 
 // Config is the configuration that is used by openDatabase.
@@ -113,6 +162,21 @@ type Config struct {
 
 	ManageDatabaseLifecycle bool
 	FixturePath             string
+
+	// CockroachDB enables a compatibility mode that avoids PostgreSQL-only features (table locks,
+	// advisory locks and query planner settings) and retries the transactions that fail to
+	// serialize, so the driver can run against CockroachDB. The migrations detect CockroachDB by
+	// themselves and avoid enumerated types there.
+	CockroachDB bool
+
+	// DeduplicationWindows suppresses, for each severity, the notifications that announce the same
+	// content of a vulnerability as a notification created within the window, e.g. when a feed
+	// flaps an entry between two states.
+	DeduplicationWindows map[types.Priority]time.Duration
+
+	// InsertBatchSize is the number of vulnerabilities that InsertVulnerabilities inserts in a
+	// single transaction.
+	InsertBatchSize int
 }
 
 // openDatabase opens a PostgresSQL-backed Datastore using the given configuration.
@@ -125,7 +189,8 @@ func openDatabase(registrableComponentConfig config.RegistrableComponentConfig)
 
 	// Parse configuration.
 	pg.config = Config{
-		CacheSize: 16384,
+		CacheSize:       16384,
+		InsertBatchSize: 100,
 	}
 	bytes, err := yaml.Marshal(registrableComponentConfig.Options)
 	if err != nil {
@@ -136,6 +201,16 @@ func openDatabase(registrableComponentConfig config.RegistrableComponentConfig)
 		return nil, fmt.Errorf("pgsql: could not load configuration: %v", err)
 	}
 
+	for severity := range pg.config.DeduplicationWindows {
+		if !severity.IsValid() {
+			return nil, fmt.Errorf("pgsql: invalid severity in the deduplication windows: %s", severity)
+		}
+	}
+
+	if pg.config.InsertBatchSize < 1 {
+		return nil, fmt.Errorf("pgsql: invalid insert batch size: %d", pg.config.InsertBatchSize)
+	}
+
 	dbName, pgSourceURL, err := parseConnectionString(pg.config.Source)
 	if err != nil {
 		return nil, err
@@ -150,11 +225,12 @@ func openDatabase(registrableComponentConfig config.RegistrableComponentConfig)
 	}
 
 	// Open database.
-	pg.DB, err = sql.Open("postgres", pg.config.Source)
+	db, err := sql.Open("postgres", pg.config.Source)
 	if err != nil {
 		pg.Close()
 		return nil, fmt.Errorf("pgsql: could not open database: %v", err)
 	}
+	pg.DB = tracing.NewDB(db, "postgresql")
 
 	// Verify database state.
 	if err = pg.DB.Ping(); err != nil {
@@ -163,7 +239,7 @@ func openDatabase(registrableComponentConfig config.RegistrableComponentConfig)
 	}
 
 	// Run migrations.
-	if err = migrateDatabase(pg.DB); err != nil {
+	if err = migrateDatabase(pg.DB.DB, pg.config.CockroachDB); err != nil {
 		pg.Close()
 		return nil, err
 	}
@@ -214,10 +290,21 @@ func parseConnectionString(source string) (dbName string, pgSourceURL string, er
 }
 
 // migrate runs all available migrations on a pgSQL database.
-func migrateDatabase(db *sql.DB) error {
+func migrateDatabase(db *sql.DB, cockroachDB bool) error {
 	log.Info("running database migrations")
 
-	err := migrate.NewPostgresMigrator(db).Exec(migrate.Up, migrations.Migrations...)
+	// CockroachDB doesn't support the advisory locks that prevent concurrent migrations, in which
+	// case only one instance of Clair should be started when upgrading.
+	var lock *sql.Tx
+	if !cockroachDB {
+		var err error
+		if lock, err = beginMigrations(db); err != nil {
+			return fmt.Errorf("pgsql: could not lock the migrations: %v", err)
+		}
+		defer lock.Commit()
+	}
+
+	err := migrate.NewMigrator(db).Exec(migrate.Up, migrations.Migrations...)
 	if err != nil {
 		return fmt.Errorf("pgsql: an error occured while running migrations: %v", err)
 	}
@@ -247,7 +334,7 @@ func createDatabase(source, dbName string) error {
 
 // dropDatabase drops an existing database.
 // The source parameter should not contain a dbname.
-func dropDatabase(source, dbName string) error {
+func dropDatabase(source, dbName string, cockroachDB bool) error {
 	// Open database.
 	db, err := sql.Open("postgres", source)
 	if err != nil {
@@ -255,13 +342,15 @@ func dropDatabase(source, dbName string) error {
 	}
 	defer db.Close()
 
-	// Kill any opened connection.
-	if _, err = db.Exec(`
+	// Kill any opened connection. CockroachDB can't terminate them, but drops the database anyway.
+	if !cockroachDB {
+		if _, err = db.Exec(`
     SELECT pg_terminate_backend(pg_stat_activity.pid)
     FROM pg_stat_activity
     WHERE pg_stat_activity.datname = $1
     AND pid <> pg_backend_pid()`, dbName); err != nil {
-		return fmt.Errorf("could not drop database: %v", err)
+			return fmt.Errorf("could not drop database: %v", err)
+		}
 	}
 
 	// Drop database.
@@ -286,6 +375,14 @@ func handleError(desc string, err error) error {
 	log.Errorf("%s: %v", desc, err)
 	promErrorsTotal.WithLabelValues(desc).Inc()
 
+	if isErrSerializationFailure(err) {
+		return errSerializationFailure
+	}
+
+	if isErrSchemaChanged(err) {
+		return database.ErrMigrationInProgress
+	}
+
 	if _, o := err.(*pq.Error); o || err == sql.ErrTxDone || strings.HasPrefix(err.Error(), "sql:") {
 		return database.ErrBackendException
 	}
@@ -20,11 +20,49 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"testing"
 
 	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database/testutil"
 	"github.com/pborman/uuid"
 )
 
+// TestMain starts a disposable PostgreSQL server for the tests when CLAIR_TEST_PGSQL_DOCKER is set
+// and no server is given with CLAIR_TEST_PGSQL, and likewise a CockroachDB cluster with
+// CLAIR_TEST_COCKROACHDB_DOCKER and CLAIR_TEST_COCKROACHDB.
+func TestMain(m *testing.M) {
+	var servers []*testutil.Postgres
+	stop := func() {
+		for _, server := range servers {
+			if err := server.Stop(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+
+	for env, start := range map[string]func() (*testutil.Postgres, error){
+		"CLAIR_TEST_PGSQL":       testutil.StartPostgres,
+		"CLAIR_TEST_COCKROACHDB": testutil.StartCockroachDB,
+	} {
+		if os.Getenv(env) != "" || os.Getenv(env+"_DOCKER") == "" {
+			continue
+		}
+
+		server, err := start()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			stop()
+			os.Exit(1)
+		}
+		os.Setenv(env, server.Source)
+		servers = append(servers, server)
+	}
+
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
 func openDatabaseForTest(testName string, loadFixture bool) (*pgSQL, error) {
 	ds, err := openDatabase(generateTestConfig(testName, loadFixture))
 	if err != nil {
@@ -35,7 +73,7 @@ func openDatabaseForTest(testName string, loadFixture bool) (*pgSQL, error) {
 }
 
 func generateTestConfig(testName string, loadFixture bool) config.RegistrableComponentConfig {
-	dbName := "test_" + strings.ToLower(testName) + "_" + strings.Replace(uuid.New(), "-", "_", -1)
+	dbName := testDatabaseName(testName)
 
 	var fixturePath string
 	if loadFixture {
@@ -57,3 +95,21 @@ func generateTestConfig(testName string, loadFixture bool) config.RegistrableCom
 		},
 	}
 }
+
+// generateCockroachDBTestConfig returns the configuration of a datastore in the CockroachDB
+// compatibility mode, using the cluster given with CLAIR_TEST_COCKROACHDB.
+func generateCockroachDBTestConfig(testName string) config.RegistrableComponentConfig {
+	return config.RegistrableComponentConfig{
+		Options: map[string]interface{}{
+			"source":                  fmt.Sprintf(os.Getenv("CLAIR_TEST_COCKROACHDB"), testDatabaseName(testName)),
+			"cachesize":               0,
+			"managedatabaselifecycle": true,
+			"cockroachdb":             true,
+		},
+	}
+}
+
+// testDatabaseName returns a unique name for the database of a test.
+func testDatabaseName(testName string) string {
+	return "test_" + strings.ToLower(testName) + "_" + strings.Replace(uuid.New(), "-", "_", -1)
+}
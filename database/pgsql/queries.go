@@ -14,7 +14,11 @@
 
 package pgsql
 
-import "strconv"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 const (
 	lockVulnerabilityAffects = `LOCK Vulnerability_Affects_FeatureVersion IN SHARE ROW EXCLUSIVE MODE`
@@ -26,6 +30,9 @@ const (
 	insertKeyValue = `INSERT INTO KeyValue(key, value) VALUES($1, $2)`
 	searchKeyValue = `SELECT value FROM KeyValue WHERE key = $1`
 
+	// pgsql.go
+	searchServerVersion = `SHOW server_version`
+
 	// namespace.go
 	soiNamespace = `
 		WITH new_namespace AS (
@@ -41,6 +48,72 @@ const (
 	searchNamespace = `SELECT id FROM Namespace WHERE name = $1`
 	listNamespace   = `SELECT id, name, version_format FROM Namespace`
 
+	searchUnusedNamespace = `
+		SELECT n.id, n.name, n.version_format
+		FROM Namespace n
+		WHERE NOT EXISTS (SELECT 1 FROM Layer l WHERE l.namespace_id = n.id)
+			AND NOT EXISTS (
+				SELECT 1
+				FROM Layer_diff_FeatureVersion ldfv
+					JOIN FeatureVersion fv ON ldfv.featureversion_id = fv.id
+					JOIN Feature f ON fv.feature_id = f.id
+				WHERE f.namespace_id = n.id)`
+
+	searchNamespaceForUpdate = `SELECT id FROM Namespace WHERE name = $1 FOR UPDATE`
+
+	searchNamespaceInUse = `
+		SELECT EXISTS (SELECT 1 FROM Layer WHERE namespace_id = $1)
+			OR EXISTS (
+				SELECT 1
+				FROM Layer_diff_FeatureVersion ldfv
+					JOIN FeatureVersion fv ON ldfv.featureversion_id = fv.id
+					JOIN Feature f ON fv.feature_id = f.id
+				WHERE f.namespace_id = $1)`
+
+	// The prune queries return the number of rows they removed and the size of these rows.
+	pruneVulnerabilityAffects = `
+		WITH deleted AS (
+			DELETE FROM Vulnerability_Affects_FeatureVersion vafv
+			WHERE vafv.vulnerability_id IN (SELECT id FROM Vulnerability WHERE namespace_id = $1)
+			RETURNING pg_column_size(vafv) AS size)
+		SELECT COUNT(*), COALESCE(SUM(size), 0) FROM deleted`
+
+	pruneVulnerabilityFixedIn = `
+		WITH deleted AS (
+			DELETE FROM Vulnerability_FixedIn_Feature vfif
+			WHERE vfif.vulnerability_id IN (SELECT id FROM Vulnerability WHERE namespace_id = $1)
+			RETURNING pg_column_size(vfif) AS size)
+		SELECT COUNT(*), COALESCE(SUM(size), 0) FROM deleted`
+
+	pruneVulnerability = `
+		WITH deleted AS (
+			DELETE FROM Vulnerability v
+			WHERE v.namespace_id = $1
+			RETURNING pg_column_size(v) AS size)
+		SELECT COUNT(*), COALESCE(SUM(size), 0) FROM deleted`
+
+	pruneFeatureVersion = `
+		WITH deleted AS (
+			DELETE FROM FeatureVersion fv
+			USING Feature f
+			WHERE fv.feature_id = f.id
+				AND f.namespace_id = $1
+				AND NOT EXISTS (SELECT 1 FROM Layer_diff_FeatureVersion WHERE featureversion_id = fv.id)
+				AND NOT EXISTS (SELECT 1 FROM Layer_FeatureVersion_Evidence WHERE featureversion_id = fv.id)
+				AND NOT EXISTS (SELECT 1 FROM Vulnerability_Affects_FeatureVersion WHERE featureversion_id = fv.id)
+			RETURNING pg_column_size(fv) AS size)
+		SELECT COUNT(*), COALESCE(SUM(size), 0) FROM deleted`
+
+	pruneFeature = `
+		WITH deleted AS (
+			DELETE FROM Feature f
+			WHERE f.namespace_id = $1
+				AND NOT EXISTS (SELECT 1 FROM FeatureVersion WHERE feature_id = f.id)
+				AND NOT EXISTS (SELECT 1 FROM Vulnerability_FixedIn_Feature WHERE feature_id = f.id)
+				AND NOT EXISTS (SELECT 1 FROM Vulnerability_FixedIn_Feature_Archive WHERE feature_id = f.id)
+			RETURNING pg_column_size(f) AS size)
+		SELECT COUNT(*), COALESCE(SUM(size), 0) FROM deleted`
+
 	// feature.go
 	soiFeature = `
 		WITH new_feature AS (
@@ -73,11 +146,11 @@ const (
 
 	insertVulnerabilityAffectsFeatureVersion = `
 		INSERT INTO Vulnerability_Affects_FeatureVersion(vulnerability_id, featureversion_id, fixedin_id)
-		VALUES($1, $2, $3)`
+		VALUES`
 
 	// layer.go
 	searchLayer = `
-		SELECT l.id, l.name, l.engineversion, p.id, p.name, n.id, n.name, n.version_format
+		SELECT l.id, l.name, l.engineversion, l.stats, p.id, p.name, n.id, n.name, n.version_format
 		FROM Layer l
 			LEFT JOIN Layer p ON l.parent_id = p.id
 			LEFT JOIN Namespace n ON l.namespace_id = n.id
@@ -93,7 +166,8 @@ const (
 			FROM Layer l, layer_tree lt
 			WHERE l.id = lt.parent_id
 		)
-		SELECT ldf.featureversion_id, ldf.modification, fn.id, fn.name, fn.version_format, f.id, f.name, fv.id, fv.version, ltree.id, ltree.name
+		SELECT ldf.featureversion_id, ldf.modification, fn.id, fn.name, fn.version_format, f.id, f.name, fv.id, fv.version, ltree.id, ltree.name, COALESCE(ldf.detector, ''),
+			COALESCE(ldf.state, '')
 		FROM Layer_diff_FeatureVersion ldf
 		JOIN (
 			SELECT row_number() over (ORDER BY depth DESC), id, name FROM layer_tree
@@ -103,7 +177,7 @@ const (
 
 	searchFeatureVersionVulnerability = `
 			SELECT vafv.featureversion_id, v.id, v.name, v.description, v.link, v.severity, v.metadata,
-				vn.name, vn.version_format, vfif.version
+				v.sources, v.cvss, vn.name, vn.version_format, vfif.version
 			FROM Vulnerability_Affects_FeatureVersion vafv, Vulnerability v,
 					 Namespace vn, Vulnerability_FixedIn_Feature vfif
 			WHERE vafv.featureversion_id = ANY($1::integer[])
@@ -113,24 +187,72 @@ const (
 						AND v.deleted_at IS NULL`
 
 	insertLayer = `
-		INSERT INTO Layer(name, engineversion, parent_id, namespace_id, created_at)
-    VALUES($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		INSERT INTO Layer(name, engineversion, parent_id, namespace_id, stats, created_at)
+    VALUES($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
     RETURNING id`
 
-	updateLayer = `UPDATE LAYER SET engineversion = $2, namespace_id = $3 WHERE id = $1`
+	updateLayer = `UPDATE LAYER SET engineversion = $2, namespace_id = $3, stats = $4 WHERE id = $1`
 
 	removeLayerDiffFeatureVersion = `
 		DELETE FROM Layer_diff_FeatureVersion
 		WHERE layer_id = $1`
 
 	insertLayerDiffFeatureVersion = `
-		INSERT INTO Layer_diff_FeatureVersion(layer_id, featureversion_id, modification)
-			SELECT $1, fv.id, $2
+		INSERT INTO Layer_diff_FeatureVersion(layer_id, featureversion_id, modification, detector, state)
+			SELECT $1, fv.id, $2, NULLIF($4, ''), NULLIF($5, '')
 			FROM FeatureVersion fv
 			WHERE fv.id = ANY($3::integer[])`
 
+	searchLayerFeatureVersionEvidence = `
+		SELECT featureversion_id, evidence FROM Layer_FeatureVersion_Evidence WHERE layer_id = $1`
+
+	removeLayerFeatureVersionEvidence = `
+		DELETE FROM Layer_FeatureVersion_Evidence
+		WHERE layer_id = $1`
+
+	insertLayerFeatureVersionEvidence = `
+		INSERT INTO Layer_FeatureVersion_Evidence(layer_id, featureversion_id, evidence)
+		VALUES($1, $2, $3)`
+
 	removeLayer = `DELETE FROM Layer WHERE name = $1`
 
+	// layer_label.go
+	searchLayerID = `SELECT id FROM Layer WHERE name = $1`
+
+	updateLayerLabel = `UPDATE Layer_Label SET value = $3 WHERE layer_id = $1 AND key = $2`
+	insertLayerLabel = `INSERT INTO Layer_Label(layer_id, key, value) VALUES($1, $2, $3)`
+
+	removeLayerLabel = `DELETE FROM Layer_Label WHERE layer_id = $1 AND key = $2`
+
+	searchLayerLabels = `
+		SELECT layer_id, key, value FROM Layer_Label WHERE layer_id = ANY($1::integer[])`
+
+	// searchLayerPage is followed by a condition per label, then by searchLayerPageEnd.
+	searchLayerPage      = `SELECT l.id, l.name FROM Layer l WHERE l.id >= $1`
+	searchLayerPageLabel = `
+		AND EXISTS (SELECT 1 FROM Layer_Label ll WHERE ll.layer_id = l.id AND ll.key = $%d AND ll.value = $%d)`
+	searchLayerPageEnd = ` ORDER BY l.id LIMIT $2`
+
+	// notificationAffectedLayers follows the layers introducing the vulnerabilities of a
+	// notification down to their descendants, which are the images they affect.
+	notificationAffectedLayers = `
+		WITH RECURSIVE Affected(id) AS (
+		  SELECT DISTINCT ldfv.layer_id
+		  FROM Vulnerability_Notification n, Vulnerability_Affects_FeatureVersion vafv, Layer_diff_FeatureVersion ldfv
+		  WHERE n.name = $1
+		    AND vafv.vulnerability_id IN (n.old_vulnerability_id, n.new_vulnerability_id)
+		    AND ldfv.featureversion_id = vafv.featureversion_id
+		    AND ldfv.modification = 'add'
+		  UNION
+		  SELECT l.id FROM Layer l, Affected a WHERE l.parent_id = a.id
+		)`
+
+	searchNotificationLayerLabels = notificationAffectedLayers + `
+		SELECT ll.layer_id, ll.key, ll.value
+		FROM Affected a, Layer_Label ll
+		WHERE ll.layer_id = a.id
+		ORDER BY ll.layer_id`
+
 	// lock.go
 	insertLock        = `INSERT INTO Lock(name, owner, until) VALUES($1, $2, $3)`
 	searchLock        = `SELECT owner, until FROM Lock WHERE name = $1`
@@ -140,7 +262,8 @@ const (
 
 	// vulnerability.go
 	searchVulnerabilityBase = `
-	  SELECT v.id, v.name, n.id, n.name, n.version_format, v.description, v.link, v.severity, v.metadata
+	  SELECT v.id, v.name, n.id, n.name, n.version_format, v.description, v.link, v.severity, v.metadata,
+	         v.sources, v.cvss
 	  FROM Vulnerability v JOIN Namespace n ON v.namespace_id = n.id`
 	searchVulnerabilityForUpdate          = ` FOR UPDATE OF v`
 	searchVulnerabilityByNamespaceAndName = ` WHERE n.name = $1 AND v.name = $2 AND v.deleted_at IS NULL`
@@ -150,16 +273,21 @@ const (
 						  ORDER BY v.id
 						  LIMIT $3`
 
+	setTransactionSnapshot = `SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY`
+
 	searchVulnerabilityFixedIn = `
 		SELECT vfif.version, f.id, f.Name
 		FROM Vulnerability_FixedIn_Feature vfif JOIN Feature f ON vfif.feature_id = f.id
 		WHERE vfif.vulnerability_id = $1`
 
 	insertVulnerability = `
-		INSERT INTO Vulnerability(namespace_id, name, description, link, severity, metadata, created_at)
-		VALUES($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		INSERT INTO Vulnerability(namespace_id, name, description, link, severity, metadata, sources,
+		                          cvss, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP)
 		RETURNING id`
 
+	updateVulnerabilityInPlace = `UPDATE Vulnerability SET metadata = $2, sources = $3, cvss = $4 WHERE id = $1`
+
 	soiVulnerabilityFixedInFeature = `
 		WITH new_fixedinfeature AS (
 			INSERT INTO Vulnerability_FixedIn_Feature(vulnerability_id, feature_id, version)
@@ -179,16 +307,28 @@ const (
     WHERE namespace_id = (SELECT id FROM Namespace WHERE name = $1)
           AND name = $2
           AND deleted_at IS NULL
-    RETURNING id`
+    RETURNING id, severity`
 
 	// notification.go
 	insertNotification = `
-		INSERT INTO Vulnerability_Notification(name, created_at, old_vulnerability_id, new_vulnerability_id)
-    VALUES($1, CURRENT_TIMESTAMP, $2, $3)`
+		INSERT INTO Vulnerability_Notification(name, created_at, old_vulnerability_id, new_vulnerability_id, priority, reason, content_hash)
+    VALUES($1, CURRENT_TIMESTAMP, $2, $3, $4, $5, $6)`
+
+	searchNotificationDuplicate = `
+		SELECT EXISTS(
+			SELECT 1
+			FROM Vulnerability_Notification vn
+			JOIN Vulnerability v ON v.id = vn.new_vulnerability_id
+			WHERE v.namespace_id = $1 AND v.name = $2 AND vn.content_hash = $3 AND vn.created_at > $4)`
 
 	updatedNotificationNotified = `
 		UPDATE Vulnerability_Notification
-		SET notified_at = CURRENT_TIMESTAMP
+		SET notified_at = CURRENT_TIMESTAMP, failed_at = NULL
+		WHERE name = $1`
+
+	updatedNotificationFailed = `
+		UPDATE Vulnerability_Notification
+		SET failed_at = CURRENT_TIMESTAMP
 		WHERE name = $1`
 
 	removeNotification = `
@@ -196,17 +336,32 @@ const (
 	  SET deleted_at = CURRENT_TIMESTAMP
 	  WHERE name = $1`
 
+	// searchNotificationAvailable skips the notifications of a vulnerability that has older pending
+	// notifications, so that the changes of a vulnerability are delivered in creation order, unless
+	// the older ones failed.
 	searchNotificationAvailable = `
-		SELECT id, name, created_at, notified_at, deleted_at
-		FROM Vulnerability_Notification
-		WHERE (notified_at IS NULL OR notified_at < $1)
-					AND deleted_at IS NULL
-					AND name NOT IN (SELECT name FROM Lock)
-		ORDER BY Random()
+		SELECT vn.id, vn.name, vn.created_at, vn.notified_at, vn.deleted_at, vn.failed_at, vn.priority, vn.reason
+		FROM Vulnerability_Notification vn
+		JOIN Vulnerability v ON v.id = COALESCE(vn.new_vulnerability_id, vn.old_vulnerability_id)
+		WHERE (vn.notified_at IS NULL OR vn.notified_at < $1)
+					AND (vn.failed_at IS NULL OR vn.failed_at < $1)
+					AND vn.deleted_at IS NULL
+					AND vn.name NOT IN (SELECT name FROM Lock)
+					AND NOT EXISTS (
+						SELECT 1
+						FROM Vulnerability_Notification older
+						JOIN Vulnerability ov ON ov.id = COALESCE(older.new_vulnerability_id, older.old_vulnerability_id)
+						WHERE older.created_at < vn.created_at
+									AND older.notified_at IS NULL
+									AND older.deleted_at IS NULL
+									AND older.failed_at IS NULL
+									AND ov.namespace_id = v.namespace_id
+									AND ov.name = v.name)
+		ORDER BY vn.priority DESC, Random()
 		LIMIT 1`
 
 	searchNotification = `
-		SELECT id, name, created_at, notified_at, deleted_at, old_vulnerability_id, new_vulnerability_id
+		SELECT id, name, created_at, notified_at, deleted_at, failed_at, priority, reason, old_vulnerability_id, new_vulnerability_id
 		FROM Vulnerability_Notification
 		WHERE name = $1`
 
@@ -226,6 +381,183 @@ const (
 		WHERE LDFV.layer_id = l.id
 		LIMIT $3`
 
+	// notification_delivery.go
+	reopenNotificationDelivery = `
+		UPDATE Notification_Delivery d
+		SET key = $3, delivered_at = NULL
+		FROM Vulnerability_Notification n
+		WHERE d.notification_id = n.id
+			AND n.name = $1
+			AND d.notifier = $2
+			AND d.delivered_at IS NOT NULL
+			AND n.notified_at IS NOT NULL
+			AND d.delivered_at <= n.notified_at`
+
+	soiNotificationDelivery = `
+		WITH notification AS (
+			SELECT id FROM Vulnerability_Notification WHERE name = $1
+		),
+		new_delivery AS (
+			INSERT INTO Notification_Delivery(notification_id, notifier, key, created_at)
+			SELECT notification.id, CAST($2 AS VARCHAR), CAST($3 AS VARCHAR), CURRENT_TIMESTAMP
+			FROM notification
+			WHERE NOT EXISTS (
+				SELECT d.id FROM Notification_Delivery d, notification
+				WHERE d.notification_id = notification.id AND d.notifier = $2
+			)
+			RETURNING id, key, created_at, delivered_at
+		)
+		SELECT d.id, d.key, d.created_at, d.delivered_at
+		FROM Notification_Delivery d, notification
+		WHERE d.notification_id = notification.id AND d.notifier = $2
+		UNION
+		SELECT id, key, created_at, delivered_at FROM new_delivery`
+
+	insertNotificationDeliveryAttempt = `
+		INSERT INTO Notification_Delivery_Attempt(delivery_id, attempted_at, succeeded, error)
+		VALUES($1, CURRENT_TIMESTAMP, $2, $3)`
+
+	updateNotificationDeliveryDelivered = `
+		UPDATE Notification_Delivery
+		SET delivered_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND delivered_at IS NULL`
+
+	searchNotificationDelivery = `
+		SELECT d.id, d.notifier, d.key, d.created_at, d.delivered_at
+		FROM Notification_Delivery d JOIN Vulnerability_Notification n ON d.notification_id = n.id
+		WHERE n.name = $1
+		ORDER BY d.id`
+
+	searchNotificationDeliveryAttempt = `
+		SELECT delivery_id, id, attempted_at, succeeded, error
+		FROM Notification_Delivery_Attempt
+		WHERE delivery_id = ANY($1::integer[])
+		ORDER BY id`
+
+	searchUndeliveredNotification = `
+		SELECT n.id, n.name, n.created_at, n.notified_at, n.deleted_at, n.priority, n.reason
+		FROM Notification_Delivery d JOIN Vulnerability_Notification n ON d.notification_id = n.id
+		WHERE d.notifier = $1
+			AND d.delivered_at IS NULL
+			AND n.notified_at IS NOT NULL
+			AND n.deleted_at IS NULL
+		ORDER BY n.id`
+
+	// vulnerability_archive.go
+	archiveVulnerability = `
+		INSERT INTO Vulnerability_Archive(id, namespace_id, name, description, link, severity, metadata,
+		                                  sources, cvss, created_at, deleted_at, archived_at)
+		SELECT id, namespace_id, name, description, link, severity, metadata, sources, cvss,
+		       created_at, deleted_at, CURRENT_TIMESTAMP
+		FROM Vulnerability
+		WHERE namespace_id = $1`
+
+	archiveVulnerabilityFixedInFeature = `
+		INSERT INTO Vulnerability_FixedIn_Feature_Archive(id, vulnerability_id, feature_id, version)
+		SELECT vfif.id, vfif.vulnerability_id, vfif.feature_id, vfif.version
+		FROM Vulnerability_FixedIn_Feature vfif JOIN Vulnerability v ON vfif.vulnerability_id = v.id
+		WHERE v.namespace_id = $1`
+
+	removeArchivedVulnerability = `DELETE FROM Vulnerability WHERE namespace_id = $1`
+
+	searchArchivedVulnerabilityBase = `
+	  SELECT v.id, v.name, n.id, n.name, n.version_format, v.description, v.link, v.severity, v.metadata,
+	         v.sources, v.cvss
+	  FROM Vulnerability_Archive v JOIN Namespace n ON v.namespace_id = n.id`
+
+	searchArchivedVulnerabilityFixedIn = `
+		SELECT vfif.version, f.id, f.Name
+		FROM Vulnerability_FixedIn_Feature_Archive vfif JOIN Feature f ON vfif.feature_id = f.id
+		WHERE vfif.vulnerability_id = $1`
+
+	// false_positive.go
+	searchFalsePositiveBase = `
+		SELECT fp.id, fp.name, n.id, n.name, n.version_format, fp.vulnerability_name, fp.feature_name,
+			fp.feature_version, fp.reason, fp.created_at
+		FROM False_Positive fp JOIN Namespace n ON fp.namespace_id = n.id`
+
+	searchFalsePositiveByVulnerabilityName = ` WHERE fp.vulnerability_name = ANY($1::text[])`
+
+	searchFalsePositivePage = ` WHERE fp.id >= $1 ORDER BY fp.id LIMIT $2`
+
+	updateFalsePositive = `
+		UPDATE False_Positive SET reason = $5
+		WHERE namespace_id = $1 AND vulnerability_name = $2 AND feature_name = $3 AND feature_version = $4
+		RETURNING id, name, created_at`
+
+	insertFalsePositive = `
+		INSERT INTO False_Positive(name, namespace_id, vulnerability_name, feature_name, feature_version,
+			reason, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		RETURNING id, name, created_at`
+
+	removeFalsePositive = `DELETE FROM False_Positive WHERE name = $1`
+
+	// watched_tag.go
+	searchWatchedTagBase = `
+		SELECT id, name, registry, repository, tag, digest, layer_name, reported_digest, signature,
+			attested, published, created_at, resolved_at, changed_at
+		FROM Watched_Tag`
+
+	searchWatchedTagByName = ` WHERE name = $1`
+
+	searchWatchedTagByReference = ` WHERE registry = $1 AND repository = $2 AND tag = $3`
+
+	searchWatchedTagPage = ` WHERE id >= $1 ORDER BY id LIMIT $2`
+
+	searchMovedWatchedTagPage = ` WHERE digest <> reported_digest AND id >= $1 ORDER BY id LIMIT $2`
+
+	searchNotificationWatchedTags = ` WHERE layer_name IN (` + notificationAffectedLayers + `
+		SELECT l.name FROM Affected a, Layer l WHERE l.id = a.id) ORDER BY id`
+
+	insertWatchedTag = `
+		INSERT INTO Watched_Tag(name, registry, repository, tag, created_at)
+		VALUES($1, $2, $3, $4, CURRENT_TIMESTAMP)`
+
+	updateWatchedTag = `
+		UPDATE Watched_Tag SET digest = $2, layer_name = $3, resolved_at = $4, changed_at = $5,
+			signature = $6, attested = $7, published = $8, reported_digest = CASE WHEN reported_digest = '' THEN $2 ELSE reported_digest END
+		WHERE name = $1`
+
+	updateWatchedTagReported = `UPDATE Watched_Tag SET reported_digest = $2 WHERE name = $1`
+
+	removeWatchedTag = `DELETE FROM Watched_Tag WHERE name = $1`
+
+	// provenance.go
+	searchProvenanceBase = `
+		SELECT id, name, digest, predicate_type, builder_id, statement, created_at
+		FROM Provenance`
+
+	searchProvenanceByDigest = ` WHERE digest = $1 ORDER BY id`
+
+	searchProvenanceByStatement = ` WHERE digest = $1 AND statement_hash = $2`
+
+	insertProvenance = `
+		INSERT INTO Provenance(name, digest, predicate_type, builder_id, statement, statement_hash, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)`
+
+	// image.go
+	insertImage = `
+		INSERT INTO Image(digest, layer_id, created_at)
+		SELECT $1, $2, CURRENT_TIMESTAMP
+		WHERE NOT EXISTS (SELECT 1 FROM Image WHERE digest = $1)`
+
+	searchImage = `
+		SELECT i.id, l.name, i.created_at
+		FROM Image i JOIN Layer l ON i.layer_id = l.id
+		WHERE i.digest = $1`
+
+	// layer_analysis.go
+	updateLayerAnalysis = `
+		UPDATE Layer_Analysis SET version = $2, result = $3, created_at = CURRENT_TIMESTAMP
+		WHERE digest = $1`
+
+	insertLayerAnalysis = `
+		INSERT INTO Layer_Analysis(digest, version, result, created_at)
+		VALUES($1, $2, $3, CURRENT_TIMESTAMP)`
+
+	searchLayerAnalysis = `SELECT version, result, created_at FROM Layer_Analysis WHERE digest = $1`
+
 	// complex_test.go
 	searchComplexTestFeatureVersionAffects = `
 		SELECT v.name
@@ -246,3 +578,31 @@ func buildInputArray(ints []int) string {
 	str = str + strconv.Itoa(ints[len(ints)-1]) + "}"
 	return str
 }
+
+// buildStringInputArray constructs a PostgreSQL input array from the specified strings, to be used
+// with the `= ANY($1::text[])` syntax.
+func buildStringInputArray(strs []string) string {
+	quoted := make([]string, 0, len(strs))
+	for _, str := range strs {
+		str = strings.Replace(str, `\`, `\\`, -1)
+		str = strings.Replace(str, `"`, `\"`, -1)
+		quoted = append(quoted, `"`+str+`"`)
+	}
+	return "{" + strings.Join(quoted, ",") + "}"
+}
+
+// maxAffectsPerInsert is the number of rows inserted at most by a single
+// insertVulnerabilityAffectsFeatureVersion query, which keeps its placeholders well under the
+// limit of PostgreSQL.
+const maxAffectsPerInsert = 1000
+
+// buildInsertVulnerabilityAffectsFeatureVersion constructs the query inserting the given number of
+// rows into Vulnerability_Affects_FeatureVersion, whose columns are given by three placeholders
+// per row.
+func buildInsertVulnerabilityAffectsFeatureVersion(rows int) string {
+	values := make([]string, 0, rows)
+	for i := 0; i < rows; i++ {
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d)", 3*i+1, 3*i+2, 3*i+3))
+	}
+	return insertVulnerabilityAffectsFeatureVersion + " " + strings.Join(values, ", ")
+}
@@ -23,17 +23,59 @@ import (
 
 	"github.com/coreos/clair/database"
 	"github.com/coreos/clair/ext/versionfmt"
-	"github.com/coreos/clair/utils"
+	"github.com/coreos/clair/tracing"
 	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
 	"github.com/guregu/null/zero"
 )
 
+// streamVulnerabilitiesPage is the number of vulnerabilities that StreamVulnerabilities reads at
+// once.
+const streamVulnerabilitiesPage = 500
+
 func (pgSQL *pgSQL) ListVulnerabilities(namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
 	defer observeQueryTime("listVulnerabilities", "all", time.Now())
 
+	return listVulnerabilities(pgSQL, searchVulnerabilityBase, namespaceName, limit, startID)
+}
+
+func (pgSQL *pgSQL) StreamVulnerabilities(namespaceName string, fn func(database.Vulnerability) error) error {
+	defer observeQueryTime("StreamVulnerabilities", "all", time.Now())
+
+	// Read every page from the same snapshot, so that the updaters running meanwhile can't make
+	// the stream skip or repeat vulnerabilities.
+	tx, err := pgSQL.beginSnapshot()
+	if err != nil {
+		return handleError("StreamVulnerabilities.Begin()", err)
+	}
+	defer tx.Rollback()
+
+	for startID := 0; startID != -1; {
+		var vulnerabilities []database.Vulnerability
+		vulnerabilities, startID, err = listVulnerabilities(tx, searchVulnerabilityBase, namespaceName, streamVulnerabilitiesPage, startID)
+		if err != nil {
+			return err
+		}
+
+		for _, vulnerability := range vulnerabilities {
+			if err = loadVulnerabilityFixedIn(tx, &vulnerability, searchVulnerabilityFixedIn); err != nil {
+				return err
+			}
+			if err = fn(vulnerability); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// listVulnerabilities paginates over the vulnerabilities of a Namespace that are returned by the
+// given base query, which is either searchVulnerabilityBase or searchArchivedVulnerabilityBase.
+func listVulnerabilities(queryer Queryer, baseQuery, namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
 	// Query Namespace.
 	var id int
-	err := pgSQL.QueryRow(searchNamespace, namespaceName).Scan(&id)
+	err := queryer.QueryRow(searchNamespace, namespaceName).Scan(&id)
 	if err != nil {
 		return nil, -1, handleError("searchNamespace", err)
 	} else if id == 0 {
@@ -41,8 +83,8 @@ func (pgSQL *pgSQL) ListVulnerabilities(namespaceName string, limit int, startID
 	}
 
 	// Query.
-	query := searchVulnerabilityBase + searchVulnerabilityByNamespace
-	rows, err := pgSQL.Query(query, namespaceName, startID, limit+1)
+	query := baseQuery + searchVulnerabilityByNamespace
+	rows, err := queryer.Query(query, namespaceName, startID, limit+1)
 	if err != nil {
 		return nil, -1, handleError("searchVulnerabilityByNamespace", err)
 	}
@@ -65,6 +107,8 @@ func (pgSQL *pgSQL) ListVulnerabilities(namespaceName string, limit int, startID
 			&vulnerability.Link,
 			&vulnerability.Severity,
 			&vulnerability.Metadata,
+			&vulnerability.Sources,
+			&vulnerability.CVSS,
 		)
 		if err != nil {
 			return nil, -1, handleError("searchVulnerabilityByNamespace.Scan()", err)
@@ -98,7 +142,7 @@ func findVulnerability(queryer Queryer, namespaceName, name string, forUpdate bo
 		query = query + searchVulnerabilityForUpdate
 	}
 
-	return scanVulnerability(queryer, queryName, queryer.QueryRow(query, namespaceName, name))
+	return scanVulnerability(queryer, queryName, queryer.QueryRow(query, namespaceName, name), searchVulnerabilityFixedIn)
 }
 
 func (pgSQL *pgSQL) findVulnerabilityByIDWithDeleted(id int) (database.Vulnerability, error) {
@@ -107,10 +151,12 @@ func (pgSQL *pgSQL) findVulnerabilityByIDWithDeleted(id int) (database.Vulnerabi
 	queryName := "searchVulnerabilityBase+searchVulnerabilityByID"
 	query := searchVulnerabilityBase + searchVulnerabilityByID
 
-	return scanVulnerability(pgSQL, queryName, pgSQL.QueryRow(query, id))
+	return scanVulnerability(pgSQL, queryName, pgSQL.QueryRow(query, id), searchVulnerabilityFixedIn)
 }
 
-func scanVulnerability(queryer Queryer, queryName string, vulnerabilityRow *sql.Row) (database.Vulnerability, error) {
+// scanVulnerability scans the given Vulnerability row and loads its FixedIn list using
+// fixedInQuery, which is either searchVulnerabilityFixedIn or searchArchivedVulnerabilityFixedIn.
+func scanVulnerability(queryer Queryer, queryName string, vulnerabilityRow *sql.Row, fixedInQuery string) (database.Vulnerability, error) {
 	var vulnerability database.Vulnerability
 
 	err := vulnerabilityRow.Scan(
@@ -123,6 +169,8 @@ func scanVulnerability(queryer Queryer, queryName string, vulnerabilityRow *sql.
 		&vulnerability.Link,
 		&vulnerability.Severity,
 		&vulnerability.Metadata,
+		&vulnerability.Sources,
+		&vulnerability.CVSS,
 	)
 
 	if err != nil {
@@ -133,10 +181,15 @@ func scanVulnerability(queryer Queryer, queryName string, vulnerabilityRow *sql.
 		return vulnerability, cerrors.ErrNotFound
 	}
 
-	// Query the FixedIn FeatureVersion now.
-	rows, err := queryer.Query(searchVulnerabilityFixedIn, vulnerability.ID)
+	err = loadVulnerabilityFixedIn(queryer, &vulnerability, fixedInQuery)
+	return vulnerability, err
+}
+
+// loadVulnerabilityFixedIn fills the FixedIn list of the given Vulnerability using fixedInQuery.
+func loadVulnerabilityFixedIn(queryer Queryer, vulnerability *database.Vulnerability, fixedInQuery string) error {
+	rows, err := queryer.Query(fixedInQuery, vulnerability.ID)
 	if err != nil {
-		return vulnerability, handleError("searchVulnerabilityFixedIn.Scan()", err)
+		return handleError("searchVulnerabilityFixedIn.Scan()", err)
 	}
 	defer rows.Close()
 
@@ -152,7 +205,7 @@ func scanVulnerability(queryer Queryer, queryName string, vulnerabilityRow *sql.
 		)
 
 		if err != nil {
-			return vulnerability, handleError("searchVulnerabilityFixedIn.Scan()", err)
+			return handleError("searchVulnerabilityFixedIn.Scan()", err)
 		}
 
 		if !featureVersionID.IsZero() {
@@ -172,17 +225,33 @@ func scanVulnerability(queryer Queryer, queryName string, vulnerabilityRow *sql.
 	}
 
 	if err := rows.Err(); err != nil {
-		return vulnerability, handleError("searchVulnerabilityFixedIn.Rows()", err)
+		return handleError("searchVulnerabilityFixedIn.Rows()", err)
 	}
 
-	return vulnerability, nil
+	return nil
 }
 
 // FixedIn.Namespace are not necessary, they are overwritten by the vuln.
 // By setting the fixed version to minVersion, we can say that the vuln does'nt affect anymore.
+//
+// The vulnerabilities are all validated first, then inserted by batches of InsertBatchSize, each
+// in a single transaction.
 func (pgSQL *pgSQL) InsertVulnerabilities(vulnerabilities []database.Vulnerability, generateNotifications bool) error {
-	for _, vulnerability := range vulnerabilities {
-		err := pgSQL.insertVulnerability(vulnerability, false, generateNotifications)
+	for i := range vulnerabilities {
+		if err := validateVulnerability(&vulnerabilities[i], false); err != nil {
+			return err
+		}
+	}
+
+	for start := 0; start < len(vulnerabilities); start += pgSQL.config.InsertBatchSize {
+		end := start + pgSQL.config.InsertBatchSize
+		if end > len(vulnerabilities) {
+			end = len(vulnerabilities)
+		}
+
+		err := withSerializationRetry(func() error {
+			return pgSQL.insertVulnerabilityBatch(vulnerabilities[start:end], false, generateNotifications)
+		})
 		if err != nil {
 			return err
 		}
@@ -191,9 +260,15 @@ func (pgSQL *pgSQL) InsertVulnerabilities(vulnerabilities []database.Vulnerabili
 }
 
 func (pgSQL *pgSQL) insertVulnerability(vulnerability database.Vulnerability, onlyFixedIn, generateNotification bool) error {
-	tf := time.Now()
+	if err := validateVulnerability(&vulnerability, onlyFixedIn); err != nil {
+		return err
+	}
+	return pgSQL.insertVulnerabilityBatch([]database.Vulnerability{vulnerability}, onlyFixedIn, generateNotification)
+}
 
-	// Verify parameters
+// validateVulnerability verifies that the given vulnerability can be inserted, and sets the
+// Namespace of its FixedIn FeatureVersions that don't have one.
+func validateVulnerability(vulnerability *database.Vulnerability, onlyFixedIn bool) error {
 	if vulnerability.Name == "" || vulnerability.Namespace.Name == "" {
 		return cerrors.NewBadRequestError("insertVulnerability needs at least the Name and the Namespace")
 	}
@@ -215,21 +290,51 @@ func (pgSQL *pgSQL) insertVulnerability(vulnerability database.Vulnerability, on
 			return cerrors.NewBadRequestError(msg)
 		}
 	}
+	return nil
+}
 
-	// We do `defer observeQueryTime` here because we don't want to observe invalid vulnerabilities.
-	defer observeQueryTime("insertVulnerability", "all", tf)
+// insertVulnerabilityBatch inserts the given validated vulnerabilities in a single transaction,
+// which is rolled back entirely if any of them fails.
+func (pgSQL *pgSQL) insertVulnerabilityBatch(vulnerabilities []database.Vulnerability, onlyFixedIn, generateNotification bool) error {
+	defer observeQueryTime("insertVulnerabilityBatch", "all", time.Now())
 
 	// Begin transaction.
 	tx, err := pgSQL.Begin()
 	if err != nil {
 		tx.Rollback()
-		return handleError("insertVulnerability.Begin()", err)
+		return handleError("insertVulnerabilityBatch.Begin()", err)
+	}
+
+	if err = pgSQL.lockVulnerabilityWrites(tx); err != nil {
+		tx.Rollback()
+		return handleError("insertVulnerabilityBatch.lockVulnerabilityWrites", err)
+	}
+
+	for _, vulnerability := range vulnerabilities {
+		if err = pgSQL.insertVulnerabilityInTx(tx, vulnerability, onlyFixedIn, generateNotification); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Commit transaction.
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return handleError("insertVulnerabilityBatch.Commit()", err)
 	}
 
+	return nil
+}
+
+// insertVulnerabilityInTx inserts the given validated vulnerability in the given transaction, which
+// the caller rolls back on error.
+func (pgSQL *pgSQL) insertVulnerabilityInTx(tx *tracing.Tx, vulnerability database.Vulnerability, onlyFixedIn, generateNotification bool) error {
+	defer observeQueryTime("insertVulnerability", "all", time.Now())
+
 	// Find existing vulnerability and its Vulnerability_FixedIn_Features (for update).
 	existingVulnerability, err := findVulnerability(tx, vulnerability.Namespace.Name, vulnerability.Name, true)
 	if err != nil && err != cerrors.ErrNotFound {
-		tx.Rollback()
 		return err
 	}
 
@@ -246,28 +351,30 @@ func (pgSQL *pgSQL) insertVulnerability(vulnerability database.Vulnerability, on
 	}
 
 	if existingVulnerability.ID != 0 {
-		updateMetadata := vulnerability.Description != existingVulnerability.Description ||
-			vulnerability.Link != existingVulnerability.Link ||
-			vulnerability.Severity != existingVulnerability.Severity ||
-			!reflect.DeepEqual(castMetadata(vulnerability.Metadata), existingVulnerability.Metadata)
-
 		// Construct the entire list of FixedIn FeatureVersion, by using the
 		// the FixedIn list of the old vulnerability.
-		//
-		// TODO(Quentin-M): We could use !updateFixedIn to just copy FixedIn/Affects rows from the
-		// existing vulnerability in order to make metadata updates much faster.
-		var updateFixedIn bool
-		vulnerability.FixedIn, updateFixedIn = applyFixedInDiff(existingVulnerability.FixedIn, vulnerability.FixedIn)
-
-		if !updateMetadata && !updateFixedIn {
-			tx.Commit()
+		vulnerability.FixedIn, _ = database.ApplyFixedInDiff(existingVulnerability.FixedIn, vulnerability.FixedIn)
+
+		if database.ContentHash(vulnerability) == database.ContentHash(existingVulnerability) {
+			// Nothing that matters to the affected images changed, which is what most updater runs
+			// end up with: update the Metadata, the Sources and the CVSS in place rather than
+			// creating a new revision and a notification.
+			if !reflect.DeepEqual(castMetadata(vulnerability.Metadata), existingVulnerability.Metadata) ||
+				!reflect.DeepEqual(vulnerability.Sources, existingVulnerability.Sources) ||
+				!reflect.DeepEqual(vulnerability.CVSS, existingVulnerability.CVSS) {
+				_, err = tx.Exec(updateVulnerabilityInPlace, existingVulnerability.ID, &vulnerability.Metadata, &vulnerability.Sources, &vulnerability.CVSS)
+				if err != nil {
+					return handleError("updateVulnerabilityInPlace", err)
+				}
+			}
+
+			promVulnerabilitiesUnchangedTotal.Inc()
 			return nil
 		}
 
 		// Mark the old vulnerability as non latest.
 		_, err = tx.Exec(removeVulnerability, vulnerability.Namespace.Name, vulnerability.Name)
 		if err != nil {
-			tx.Rollback()
 			return handleError("removeVulnerability", err)
 		}
 	} else {
@@ -297,33 +404,48 @@ func (pgSQL *pgSQL) insertVulnerability(vulnerability database.Vulnerability, on
 		vulnerability.Link,
 		&vulnerability.Severity,
 		&vulnerability.Metadata,
+		&vulnerability.Sources,
+		&vulnerability.CVSS,
 	).Scan(&vulnerability.ID)
 
 	if err != nil {
-		tx.Rollback()
 		return handleError("insertVulnerability", err)
 	}
 
 	// Update Vulnerability_FixedIn_Feature and Vulnerability_Affects_FeatureVersion now.
 	err = pgSQL.insertVulnerabilityFixedInFeatureVersions(tx, vulnerability.ID, vulnerability.FixedIn)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
 	// Create a notification.
 	if generateNotification {
-		err = createNotification(tx, existingVulnerability.ID, vulnerability.ID)
-		if err != nil {
-			return err
+		priority := database.NotificationPriority(existingVulnerability.Severity, vulnerability.Severity)
+		contentHash := database.ContentHash(vulnerability)
+
+		// Suppress the notification if the same content was already announced within the
+		// deduplication window of its severity.
+		duplicate := false
+		if window := pgSQL.config.DeduplicationWindows[priority]; window > 0 {
+			duplicate, err = isDuplicateNotification(tx, namespaceID, vulnerability.Name, contentHash, time.Now().Add(-window))
+			if err != nil {
+				return err
+			}
 		}
-	}
 
-	// Commit transaction.
-	err = tx.Commit()
-	if err != nil {
-		tx.Rollback()
-		return handleError("insertVulnerability.Commit()", err)
+		if duplicate {
+			promNotificationsDeduplicatedTotal.WithLabelValues(string(priority)).Inc()
+		} else {
+			reason := database.NotificationReasonNewVulnerability
+			if existingVulnerability.ID != 0 {
+				reason = database.NotificationReasonOf(&existingVulnerability, &vulnerability)
+			}
+
+			err = createNotification(tx, existingVulnerability.ID, vulnerability.ID, priority, reason, contentHash)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -340,68 +462,11 @@ func castMetadata(m database.MetadataMap) database.MetadataMap {
 	return c
 }
 
-// applyFixedInDiff applies a FeatureVersion diff on a FeatureVersion list and returns the result.
-func applyFixedInDiff(currentList, diff []database.FeatureVersion) ([]database.FeatureVersion, bool) {
-	currentMap, currentNames := createFeatureVersionNameMap(currentList)
-	diffMap, diffNames := createFeatureVersionNameMap(diff)
-
-	addedNames := utils.CompareStringLists(diffNames, currentNames)
-	inBothNames := utils.CompareStringListsInBoth(diffNames, currentNames)
-
-	different := false
-
-	for _, name := range addedNames {
-		if diffMap[name].Version == versionfmt.MinVersion {
-			// MinVersion only makes sense when a Feature is already fixed in some version,
-			// in which case we would be in the "inBothNames".
-			continue
-		}
-
-		currentMap[name] = diffMap[name]
-		different = true
-	}
-
-	for _, name := range inBothNames {
-		fv := diffMap[name]
-
-		if fv.Version == versionfmt.MinVersion {
-			// MinVersion means that the Feature doesn't affect the Vulnerability anymore.
-			delete(currentMap, name)
-			different = true
-		} else if fv.Version != currentMap[name].Version {
-			// The version got updated.
-			currentMap[name] = diffMap[name]
-			different = true
-		}
-	}
-
-	// Convert currentMap to a slice and return it.
-	var newList []database.FeatureVersion
-	for _, fv := range currentMap {
-		newList = append(newList, fv)
-	}
-
-	return newList, different
-}
-
-func createFeatureVersionNameMap(features []database.FeatureVersion) (map[string]database.FeatureVersion, []string) {
-	m := make(map[string]database.FeatureVersion, 0)
-	s := make([]string, 0, len(features))
-
-	for i := 0; i < len(features); i++ {
-		featureVersion := features[i]
-		m[featureVersion.Feature.Name] = featureVersion
-		s = append(s, featureVersion.Feature.Name)
-	}
-
-	return m, s
-}
-
 // insertVulnerabilityFixedInFeatureVersions populates Vulnerability_FixedIn_Feature for the given
 // vulnerability with the specified database.FeatureVersion list and uses
 // linkVulnerabilityToFeatureVersions to propagate the changes on Vulnerability_FixedIn_Feature to
 // Vulnerability_Affects_FeatureVersion.
-func (pgSQL *pgSQL) insertVulnerabilityFixedInFeatureVersions(tx *sql.Tx, vulnerabilityID int, fixedIn []database.FeatureVersion) error {
+func (pgSQL *pgSQL) insertVulnerabilityFixedInFeatureVersions(tx *tracing.Tx, vulnerabilityID int, fixedIn []database.FeatureVersion) error {
 	defer observeQueryTime("insertVulnerabilityFixedInFeatureVersions", "all", time.Now())
 
 	// Insert or find the Features.
@@ -424,11 +489,10 @@ func (pgSQL *pgSQL) insertVulnerabilityFixedInFeatureVersions(tx *sql.Tx, vulner
 	promConcurrentLockVAFV.Inc()
 	defer promConcurrentLockVAFV.Dec()
 	t := time.Now()
-	_, err = tx.Exec(lockVulnerabilityAffects)
+	err = pgSQL.lockAffects(tx)
 	observeQueryTime("insertVulnerability", "lock", t)
 
 	if err != nil {
-		tx.Rollback()
 		return handleError("insertVulnerability.lockVulnerabilityAffects", err)
 	}
 
@@ -463,7 +527,7 @@ func (pgSQL *pgSQL) insertVulnerabilityFixedInFeatureVersions(tx *sql.Tx, vulner
 	return nil
 }
 
-func linkVulnerabilityToFeatureVersions(tx *sql.Tx, fixedInID, vulnerabilityID, featureID int, versionFormat, fixedInVersion string) error {
+func linkVulnerabilityToFeatureVersions(tx *tracing.Tx, fixedInID, vulnerabilityID, featureID int, versionFormat, fixedInVersion string) error {
 	// Find every FeatureVersions of the Feature that the vulnerability affects.
 	// TODO(Quentin-M): LIMIT
 	rows, err := tx.Query(searchFeatureVersionByFeature, featureID)
@@ -496,10 +560,18 @@ func linkVulnerabilityToFeatureVersions(tx *sql.Tx, fixedInID, vulnerabilityID,
 	}
 	rows.Close()
 
-	// Insert into Vulnerability_Affects_FeatureVersion.
-	for _, affected := range affecteds {
-		// TODO(Quentin-M): Batch me.
-		_, err := tx.Exec(insertVulnerabilityAffectsFeatureVersion, vulnerabilityID, affected.ID, fixedInID)
+	// Insert into Vulnerability_Affects_FeatureVersion, with multi-row INSERTs.
+	for start := 0; start < len(affecteds); start += maxAffectsPerInsert {
+		end := start + maxAffectsPerInsert
+		if end > len(affecteds) {
+			end = len(affecteds)
+		}
+
+		args := make([]interface{}, 0, 3*(end-start))
+		for _, affected := range affecteds[start:end] {
+			args = append(args, vulnerabilityID, affected.ID, fixedInID)
+		}
+		_, err := tx.Exec(buildInsertVulnerabilityAffectsFeatureVersion(end-start), args...)
 		if err != nil {
 			return handleError("insertVulnerabilityAffectsFeatureVersion", err)
 		}
@@ -519,7 +591,9 @@ func (pgSQL *pgSQL) InsertVulnerabilityFixes(vulnerabilityNamespace, vulnerabili
 		FixedIn: fixes,
 	}
 
-	return pgSQL.insertVulnerability(v, true, true)
+	return withSerializationRetry(func() error {
+		return pgSQL.insertVulnerability(v, true, true)
+	})
 }
 
 func (pgSQL *pgSQL) DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerabilityName, featureName string) error {
@@ -543,12 +617,20 @@ func (pgSQL *pgSQL) DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerability
 		},
 	}
 
-	return pgSQL.insertVulnerability(v, true, true)
+	return withSerializationRetry(func() error {
+		return pgSQL.insertVulnerability(v, true, true)
+	})
 }
 
 func (pgSQL *pgSQL) DeleteVulnerability(namespaceName, name string) error {
 	defer observeQueryTime("DeleteVulnerability", "all", time.Now())
 
+	return withSerializationRetry(func() error {
+		return pgSQL.deleteVulnerability(namespaceName, name)
+	})
+}
+
+func (pgSQL *pgSQL) deleteVulnerability(namespaceName, name string) error {
 	// Begin transaction.
 	tx, err := pgSQL.Begin()
 	if err != nil {
@@ -557,14 +639,15 @@ func (pgSQL *pgSQL) DeleteVulnerability(namespaceName, name string) error {
 	}
 
 	var vulnerabilityID int
-	err = tx.QueryRow(removeVulnerability, namespaceName, name).Scan(&vulnerabilityID)
+	var severity types.Priority
+	err = tx.QueryRow(removeVulnerability, namespaceName, name).Scan(&vulnerabilityID, &severity)
 	if err != nil {
 		tx.Rollback()
 		return handleError("removeVulnerability", err)
 	}
 
 	// Create a notification.
-	err = createNotification(tx, vulnerabilityID, 0)
+	err = createNotification(tx, vulnerabilityID, 0, severity, database.NotificationReasonDeleted, "")
 	if err != nil {
 		return err
 	}
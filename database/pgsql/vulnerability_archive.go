@@ -0,0 +1,110 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"time"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// ArchiveVulnerabilities moves the vulnerabilities of a Namespace and their FixedIn rows into the
+// archive tables, in a single transaction.
+func (pgSQL *pgSQL) ArchiveVulnerabilities(namespaceName string) (int, error) {
+	if namespaceName == "" {
+		return 0, cerrors.NewBadRequestError("could not archive the vulnerabilities of an empty namespace")
+	}
+
+	defer observeQueryTime("ArchiveVulnerabilities", "all", time.Now())
+
+	var archived int
+	err := withSerializationRetry(func() (err error) {
+		archived, err = pgSQL.archiveVulnerabilities(namespaceName)
+		return
+	})
+	return archived, err
+}
+
+func (pgSQL *pgSQL) archiveVulnerabilities(namespaceName string) (int, error) {
+	// Find the Namespace.
+	var namespaceID int
+	err := pgSQL.QueryRow(searchNamespace, namespaceName).Scan(&namespaceID)
+	if err != nil {
+		return 0, handleError("searchNamespace", err)
+	}
+
+	tx, err := pgSQL.Begin()
+	if err != nil {
+		return 0, handleError("ArchiveVulnerabilities.Begin()", err)
+	}
+
+	if err = pgSQL.lockVulnerabilityWrites(tx); err != nil {
+		tx.Rollback()
+		return 0, handleError("ArchiveVulnerabilities.lockVulnerabilityWrites", err)
+	}
+
+	// Lock Vulnerability_Affects_FeatureVersion exclusively so the vulnerabilities can't be modified
+	// while they are being archived.
+	if err = pgSQL.lockAffects(tx); err != nil {
+		tx.Rollback()
+		return 0, handleError("ArchiveVulnerabilities.lockVulnerabilityAffects", err)
+	}
+
+	result, err := tx.Exec(archiveVulnerability, namespaceID)
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("archiveVulnerability", err)
+	}
+	archived, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("archiveVulnerability.RowsAffected()", err)
+	}
+
+	if _, err = tx.Exec(archiveVulnerabilityFixedInFeature, namespaceID); err != nil {
+		tx.Rollback()
+		return 0, handleError("archiveVulnerabilityFixedInFeature", err)
+	}
+
+	// Removing the vulnerabilities cascades to their FixedIn and Affects rows, as well as to the
+	// notifications that reference them.
+	if _, err = tx.Exec(removeArchivedVulnerability, namespaceID); err != nil {
+		tx.Rollback()
+		return 0, handleError("removeArchivedVulnerability", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, handleError("ArchiveVulnerabilities.Commit()", err)
+	}
+
+	return int(archived), nil
+}
+
+func (pgSQL *pgSQL) ListArchivedVulnerabilities(namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
+	defer observeQueryTime("ListArchivedVulnerabilities", "all", time.Now())
+
+	return listVulnerabilities(pgSQL, searchArchivedVulnerabilityBase, namespaceName, limit, startID)
+}
+
+func (pgSQL *pgSQL) FindArchivedVulnerability(namespaceName, name string) (database.Vulnerability, error) {
+	defer observeQueryTime("FindArchivedVulnerability", "all", time.Now())
+
+	queryName := "searchArchivedVulnerabilityBase+searchVulnerabilityByNamespaceAndName"
+	query := searchArchivedVulnerabilityBase + searchVulnerabilityByNamespaceAndName
+
+	return scanVulnerability(pgSQL, queryName, pgSQL.QueryRow(query, namespaceName, name), searchArchivedVulnerabilityFixedIn)
+}
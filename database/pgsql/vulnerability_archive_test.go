@@ -0,0 +1,71 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func TestArchiveVulnerabilities(t *testing.T) {
+	datastore, err := openDatabaseForTest("ArchiveVulnerabilities", true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer datastore.Close()
+
+	// Archive a namespace that does not exist.
+	_, err = datastore.ArchiveVulnerabilities("TestArchiveVulnerabilitiesNamespace")
+	assert.Equal(t, cerrors.ErrNotFound, err)
+
+	v1, err := datastore.FindVulnerability("debian:7", "CVE-OPENSSL-1-DEB7")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Archive debian:7.
+	count, err := datastore.ArchiveVulnerabilities("debian:7")
+	if assert.Nil(t, err) {
+		assert.NotZero(t, count)
+	}
+
+	// The vulnerability must only be found in the archive, with its FixedIn list.
+	_, err = datastore.FindVulnerability("debian:7", "CVE-OPENSSL-1-DEB7")
+	assert.Equal(t, cerrors.ErrNotFound, err)
+
+	v1a, err := datastore.FindArchivedVulnerability("debian:7", "CVE-OPENSSL-1-DEB7")
+	if assert.Nil(t, err) {
+		equalsVuln(t, &v1, &v1a)
+	}
+
+	vulnerabilities, _, err := datastore.ListVulnerabilities("debian:7", 10, 0)
+	if assert.Nil(t, err) {
+		assert.Len(t, vulnerabilities, 0)
+	}
+	vulnerabilities, _, err = datastore.ListArchivedVulnerabilities("debian:7", 10, 0)
+	if assert.Nil(t, err) {
+		assert.NotEmpty(t, vulnerabilities)
+	}
+
+	// Archiving again has nothing to move.
+	count, err = datastore.ArchiveVulnerabilities("debian:7")
+	if assert.Nil(t, err) {
+		assert.Zero(t, count)
+	}
+}
@@ -15,8 +15,11 @@
 package pgsql
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -227,6 +230,7 @@ func TestInsertVulnerability(t *testing.T) {
 		Description: "TestInsertVulnerabilityDescription1",
 		Link:        "TestInsertVulnerabilityLink1",
 		Metadata:    v1meta,
+		Sources:     database.VulnerabilitySources{{Name: "TestInsertVulnerabilitySource1", License: "CC-BY-4.0"}},
 	}
 	err = datastore.InsertVulnerabilities([]database.Vulnerability{v1}, true)
 	if assert.Nil(t, err) {
@@ -261,6 +265,130 @@ func TestInsertVulnerability(t *testing.T) {
 			equalsVuln(t, &v1, &v1f)
 		}
 	}
+
+	// Update the sources only.
+	v1.Sources = append(v1.Sources, database.VulnerabilitySource{Name: "TestInsertVulnerabilitySource2"})
+
+	err = datastore.InsertVulnerabilities([]database.Vulnerability{v1}, true)
+	if assert.Nil(t, err) {
+		v1f, err := datastore.FindVulnerability(n1.Name, v1.Name)
+		if assert.Nil(t, err) {
+			equalsVuln(t, &v1, &v1f)
+		}
+	}
+}
+
+func TestInsertVulnerabilityUnchanged(t *testing.T) {
+	datastore, err := openDatabaseForTest("InsertVulnerabilityUnchanged", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer datastore.Close()
+
+	namespace := database.Namespace{
+		Name:          "TestInsertVulnerabilityUnchangedNamespace",
+		VersionFormat: dpkg.ParserName,
+	}
+	f1 := database.FeatureVersion{
+		Feature: database.Feature{Name: "TestInsertVulnerabilityUnchangedFeature1", Namespace: namespace},
+		Version: "1.0",
+	}
+	f2 := database.FeatureVersion{
+		Feature: database.Feature{Name: "TestInsertVulnerabilityUnchangedFeature2", Namespace: namespace},
+		Version: "2.0",
+	}
+	vulnerability := database.Vulnerability{
+		Name:        "TestInsertVulnerabilityUnchanged",
+		Namespace:   namespace,
+		Description: "TestInsertVulnerabilityUnchangedDescription",
+		Severity:    types.Medium,
+		FixedIn:     []database.FeatureVersion{f1, f2},
+	}
+	if !assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true)) {
+		return
+	}
+	notification, err := datastore.GetAvailableNotification(time.Hour, "test", time.Minute)
+	if !assert.Nil(t, err) || !assert.Nil(t, datastore.SetNotificationNotified(notification.Name)) {
+		return
+	}
+	existing, err := datastore.FindVulnerability(namespace.Name, vulnerability.Name)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Insert the same content again, with the FixedIn set in another order and new Metadata.
+	vulnerability.FixedIn = []database.FeatureVersion{f2, f1}
+	vulnerability.Metadata = database.MetadataMap{"TestInsertVulnerabilityUnchangedMetadata": "1"}
+	if !assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true)) {
+		return
+	}
+
+	// The Metadata is updated in place, without a new revision nor a notification.
+	v, err := datastore.FindVulnerability(namespace.Name, vulnerability.Name)
+	if assert.Nil(t, err) {
+		assert.Equal(t, existing.ID, v.ID)
+		equalsVuln(t, &vulnerability, &v)
+	}
+	_, err = datastore.GetAvailableNotification(time.Hour, "test", time.Minute)
+	assert.Equal(t, cerrors.ErrNotFound, err)
+}
+
+func TestInsertVulnerabilitiesBatch(t *testing.T) {
+	datastore, err := openDatabaseForTest("InsertVulnerabilitiesBatch", false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer datastore.Close()
+	datastore.config.InsertBatchSize = 2
+
+	namespace := database.Namespace{
+		Name:          "TestInsertVulnerabilitiesBatchNamespace",
+		VersionFormat: dpkg.ParserName,
+	}
+	feature := database.Feature{Name: "TestInsertVulnerabilitiesBatchFeature", Namespace: namespace}
+	for _, version := range []string{"0.1", "0.2", "0.3", "1.0"} {
+		if _, err := datastore.insertFeatureVersion(database.FeatureVersion{Feature: feature, Version: version}); !assert.Nil(t, err) {
+			return
+		}
+	}
+
+	var vulnerabilities []database.Vulnerability
+	for i := 0; i < 5; i++ {
+		vulnerabilities = append(vulnerabilities, database.Vulnerability{
+			Name:      fmt.Sprintf("TestInsertVulnerabilitiesBatch%d", i),
+			Namespace: namespace,
+			Severity:  types.Low,
+			FixedIn:   []database.FeatureVersion{{Feature: feature, Version: "0.5"}},
+		})
+	}
+
+	// Nothing is inserted when any vulnerability is invalid, regardless of its batch.
+	invalid := append(append([]database.Vulnerability(nil), vulnerabilities...), database.Vulnerability{Name: "TestInsertVulnerabilitiesBatchInvalid", Namespace: namespace})
+	assert.IsType(t, &cerrors.ErrBadRequest{}, datastore.InsertVulnerabilities(invalid, true))
+	_, err = datastore.FindVulnerability(namespace.Name, vulnerabilities[0].Name)
+	assert.Equal(t, cerrors.ErrNotFound, err)
+
+	if !assert.Nil(t, datastore.InsertVulnerabilities(vulnerabilities, true)) {
+		return
+	}
+	for _, vulnerability := range vulnerabilities {
+		v, err := datastore.FindVulnerability(namespace.Name, vulnerability.Name)
+		if assert.Nil(t, err) {
+			equalsVuln(t, &vulnerability, &v)
+		}
+	}
+
+	// Each vulnerability affects the three versions lower than its fixed one.
+	var count int
+	if assert.Nil(t, datastore.QueryRow("SELECT COUNT(*) FROM Vulnerability_Affects_FeatureVersion").Scan(&count)) {
+		assert.Equal(t, 15, count)
+	}
+}
+
+func TestBuildInsertVulnerabilityAffectsFeatureVersion(t *testing.T) {
+	assert.True(t, strings.HasSuffix(buildInsertVulnerabilityAffectsFeatureVersion(2), "VALUES ($1, $2, $3), ($4, $5, $6)"))
 }
 
 func equalsVuln(t *testing.T, expected, actual *database.Vulnerability) {
@@ -270,6 +398,7 @@ func equalsVuln(t *testing.T, expected, actual *database.Vulnerability) {
 	assert.Equal(t, expected.Link, actual.Link)
 	assert.Equal(t, expected.Severity, actual.Severity)
 	assert.True(t, reflect.DeepEqual(castMetadata(expected.Metadata), actual.Metadata), "Got metadata %#v, expected %#v", actual.Metadata, castMetadata(expected.Metadata))
+	assert.Equal(t, expected.Sources, actual.Sources)
 
 	if assert.Len(t, actual.FixedIn, len(expected.FixedIn)) {
 		for _, actualFeatureVersion := range actual.FixedIn {
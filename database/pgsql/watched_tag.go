@@ -0,0 +1,208 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgsql
+
+import (
+	"time"
+
+	"github.com/guregu/null/zero"
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertWatchedTag starts watching a tag, or returns the existing WatchedTag.
+func (pgSQL *pgSQL) InsertWatchedTag(watchedTag database.WatchedTag) (database.WatchedTag, error) {
+	if watchedTag.Registry == "" || watchedTag.Repository == "" || watchedTag.Tag == "" {
+		return watchedTag, cerrors.NewBadRequestError("could not insert a watched tag which does not have a registry, a repository and a tag")
+	}
+
+	defer observeQueryTime("InsertWatchedTag", "all", time.Now())
+
+	for {
+		existing, err := pgSQL.searchWatchedTags(searchWatchedTagByReference, watchedTag.Registry, watchedTag.Repository, watchedTag.Tag)
+		if err != nil {
+			return watchedTag, err
+		}
+		if len(existing) > 0 {
+			return existing[0], nil
+		}
+
+		_, err = pgSQL.Exec(insertWatchedTag, uuid.New(), watchedTag.Registry, watchedTag.Repository, watchedTag.Tag)
+		if err != nil && !isErrUniqueViolation(err) {
+			return watchedTag, handleError("insertWatchedTag", err)
+		}
+		// The tag has been inserted, possibly concurrently: search it again.
+	}
+}
+
+// FindWatchedTag retrieves a WatchedTag by its name.
+func (pgSQL *pgSQL) FindWatchedTag(name string) (database.WatchedTag, error) {
+	defer observeQueryTime("FindWatchedTag", "all", time.Now())
+
+	watchedTags, err := pgSQL.searchWatchedTags(searchWatchedTagByName, name)
+	if err != nil {
+		return database.WatchedTag{}, err
+	}
+	if len(watchedTags) == 0 {
+		return database.WatchedTag{}, cerrors.ErrNotFound
+	}
+	return watchedTags[0], nil
+}
+
+// ListWatchedTags paginates over every watched tag.
+func (pgSQL *pgSQL) ListWatchedTags(limit int, startID int) ([]database.WatchedTag, int, error) {
+	defer observeQueryTime("ListWatchedTags", "all", time.Now())
+
+	watchedTags, err := pgSQL.searchWatchedTags(searchWatchedTagPage, startID, limit+1)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	nextID := -1
+	if len(watchedTags) > limit {
+		nextID = watchedTags[limit].ID
+		watchedTags = watchedTags[:limit]
+	}
+	return watchedTags, nextID, nil
+}
+
+// ListMovedWatchedTags paginates over the watched tags that moved since their last report.
+func (pgSQL *pgSQL) ListMovedWatchedTags(limit int, startID int) ([]database.WatchedTag, int, error) {
+	defer observeQueryTime("ListMovedWatchedTags", "all", time.Now())
+
+	watchedTags, err := pgSQL.searchWatchedTags(searchMovedWatchedTagPage, startID, limit+1)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	nextID := -1
+	if len(watchedTags) > limit {
+		nextID = watchedTags[limit].ID
+		watchedTags = watchedTags[:limit]
+	}
+	return watchedTags, nextID, nil
+}
+
+// ListNotificationWatchedTags returns the watched tags whose image is affected by a notification.
+func (pgSQL *pgSQL) ListNotificationWatchedTags(name string) ([]database.WatchedTag, error) {
+	defer observeQueryTime("ListNotificationWatchedTags", "all", time.Now())
+
+	return pgSQL.searchWatchedTags(searchNotificationWatchedTags, name)
+}
+
+func (pgSQL *pgSQL) searchWatchedTags(condition string, args ...interface{}) ([]database.WatchedTag, error) {
+	rows, err := pgSQL.Query(searchWatchedTagBase+condition, args...)
+	if err != nil {
+		return nil, handleError("searchWatchedTag", err)
+	}
+	defer rows.Close()
+
+	var watchedTags []database.WatchedTag
+	for rows.Next() {
+		var watchedTag database.WatchedTag
+		var resolved, changed zero.Time
+		err := rows.Scan(
+			&watchedTag.ID,
+			&watchedTag.Name,
+			&watchedTag.Registry,
+			&watchedTag.Repository,
+			&watchedTag.Tag,
+			&watchedTag.Digest,
+			&watchedTag.LayerName,
+			&watchedTag.ReportedDigest,
+			&watchedTag.Signature,
+			&watchedTag.Attested,
+			&watchedTag.Published,
+			&watchedTag.Created,
+			&resolved,
+			&changed,
+		)
+		if err != nil {
+			return nil, handleError("searchWatchedTag.Scan()", err)
+		}
+		watchedTag.Resolved = resolved.Time
+		watchedTag.Changed = changed.Time
+		watchedTags = append(watchedTags, watchedTag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchWatchedTag.Rows()", err)
+	}
+
+	return watchedTags, nil
+}
+
+// UpdateWatchedTag stores the resolution of a watched tag.
+func (pgSQL *pgSQL) UpdateWatchedTag(watchedTag database.WatchedTag) error {
+	defer observeQueryTime("UpdateWatchedTag", "all", time.Now())
+
+	result, err := pgSQL.Exec(updateWatchedTag, watchedTag.Name, watchedTag.Digest, watchedTag.LayerName,
+		zero.TimeFrom(watchedTag.Resolved), zero.TimeFrom(watchedTag.Changed), string(watchedTag.Signature),
+		watchedTag.Attested, watchedTag.Published)
+	if err != nil {
+		return handleError("updateWatchedTag", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("updateWatchedTag.RowsAffected()", err)
+	}
+	if affected <= 0 {
+		return cerrors.ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkWatchedTagReported sets the digest a watched tag pointed to when it was last reported.
+func (pgSQL *pgSQL) MarkWatchedTagReported(name, digest string) error {
+	defer observeQueryTime("MarkWatchedTagReported", "all", time.Now())
+
+	result, err := pgSQL.Exec(updateWatchedTagReported, name, digest)
+	if err != nil {
+		return handleError("updateWatchedTagReported", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("updateWatchedTagReported.RowsAffected()", err)
+	}
+	if affected <= 0 {
+		return cerrors.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteWatchedTag stops watching a tag.
+func (pgSQL *pgSQL) DeleteWatchedTag(name string) error {
+	defer observeQueryTime("DeleteWatchedTag", "all", time.Now())
+
+	result, err := pgSQL.Exec(removeWatchedTag, name)
+	if err != nil {
+		return handleError("removeWatchedTag", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("removeWatchedTag.RowsAffected()", err)
+	}
+	if affected <= 0 {
+		return cerrors.ErrNotFound
+	}
+
+	return nil
+}
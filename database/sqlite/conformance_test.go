@@ -0,0 +1,54 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/database/conformance"
+	"github.com/coreos/clair/database/testutil"
+)
+
+func TestConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clair-sqlite-conformance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := testutil.Harness{
+		Open: func() (database.Datastore, error) {
+			f, err := ioutil.TempFile(dir, "clair.db")
+			if err != nil {
+				return nil, err
+			}
+			f.Close()
+			return openDatabase(config.RegistrableComponentConfig{
+				Options: map[string]interface{}{"path": filepath.Join(dir, filepath.Base(f.Name()))},
+			})
+		},
+		Fixture: testutil.DefaultFixture(),
+	}
+
+	conformance.Run(t, h)
+}
@@ -0,0 +1,23 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlite implements database.Datastore with an embedded SQLite database that is stored in
+// a single file, so Clair can run without any external dependency.
+//
+// The Vulnerability table has only the latest revision of every Vulnerability: the revisions that
+// notifications reference are copied along with them.
+//
+// The SQLite driver requires cgo. When Clair is built without it, the package is empty and the
+// sqlite database type isn't available.
+package sqlite
@@ -0,0 +1,69 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func insertFeature(q queryer, feature database.Feature) (int, error) {
+	if feature.Name == "" {
+		return 0, cerrors.NewBadRequestError("could not find/insert invalid Feature")
+	}
+
+	namespaceID, err := insertNamespace(q, feature.Namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = q.Exec(insertOrIgnoreFeature, namespaceID, feature.Name); err != nil {
+		return 0, handleError("insertOrIgnoreFeature", err)
+	}
+
+	var id int
+	if err = q.QueryRow(searchFeature, namespaceID, feature.Name).Scan(&id); err != nil {
+		return 0, handleError("searchFeature", err)
+	}
+
+	return id, nil
+}
+
+func insertFeatureVersion(q queryer, fv database.FeatureVersion) (int, error) {
+	err := versionfmt.Valid(fv.Feature.Namespace.VersionFormat, fv.Version)
+	if err != nil {
+		return 0, cerrors.NewBadRequestError("could not find/insert invalid FeatureVersion")
+	}
+
+	featureID, err := insertFeature(q, fv.Feature)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = q.Exec(insertOrIgnoreFeatureVersion, featureID, fv.Version); err != nil {
+		return 0, handleError("insertOrIgnoreFeatureVersion", err)
+	}
+
+	var id int
+	if err = q.QueryRow(searchFeatureVersion, featureID, fv.Version).Scan(&id); err != nil {
+		return 0, handleError("searchFeatureVersion", err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"time"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertImage stores the top layer of the image whose manifest has the given digest, unless the
+// image is already stored.
+func (db *sqlite) InsertImage(image database.Image) error {
+	if image.Digest == "" || image.LayerName == "" {
+		return cerrors.NewBadRequestError("could not insert an image which does not have a digest and a layer")
+	}
+
+	var layerID int
+	if err := db.QueryRow(searchLayerID, image.LayerName).Scan(&layerID); err != nil {
+		return handleError("searchLayerID", err)
+	}
+
+	if _, err := db.Exec(insertImage, image.Digest, layerID, time.Now().UTC()); err != nil {
+		return handleError("insertImage", err)
+	}
+	return nil
+}
+
+// FindImage returns the image whose manifest has the given digest.
+func (db *sqlite) FindImage(digest string) (database.Image, error) {
+	image := database.Image{Digest: digest}
+	err := db.QueryRow(searchImage, digest).Scan(&image.ID, &image.LayerName, &image.Created)
+	if err != nil {
+		return image, handleError("searchImage", err)
+	}
+	return image, nil
+}
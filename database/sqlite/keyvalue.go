@@ -0,0 +1,50 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"database/sql"
+
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertKeyValue stores (or updates) a single key / value tuple.
+func (db *sqlite) InsertKeyValue(key, value string) error {
+	if key == "" || value == "" {
+		log.Warning("could not insert a flag which has an empty name or value")
+		return cerrors.NewBadRequestError("could not insert a flag which has an empty name or value")
+	}
+
+	_, err := db.Exec(insertOrReplaceKeyValue, key, value)
+	return handleError("insertOrReplaceKeyValue", err)
+}
+
+// GetKeyValue reads a single key / value tuple and returns an empty string if the key doesn't exist.
+func (db *sqlite) GetKeyValue(key string) (string, error) {
+	var value string
+	err := db.QueryRow(searchKeyValue, key).Scan(&value)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", handleError("searchKeyValue", err)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func insertNamespace(q queryer, namespace database.Namespace) (int, error) {
+	if namespace.Name == "" {
+		return 0, cerrors.NewBadRequestError("could not find/insert invalid Namespace")
+	}
+
+	if _, err := q.Exec(insertOrIgnoreNamespace, namespace.Name, namespace.VersionFormat); err != nil {
+		return 0, handleError("insertOrIgnoreNamespace", err)
+	}
+
+	var id int
+	if err := q.QueryRow(searchNamespace, namespace.Name).Scan(&id); err != nil {
+		return 0, handleError("searchNamespace", err)
+	}
+
+	return id, nil
+}
+
+func (db *sqlite) ListNamespaces() (namespaces []database.Namespace, err error) {
+	rows, err := db.Query(listNamespace)
+	if err != nil {
+		return namespaces, handleError("listNamespace", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ns database.Namespace
+
+		err = rows.Scan(&ns.ID, &ns.Name, &ns.VersionFormat)
+		if err != nil {
+			return namespaces, handleError("listNamespace.Scan()", err)
+		}
+
+		namespaces = append(namespaces, ns)
+	}
+	if err = rows.Err(); err != nil {
+		return namespaces, handleError("listNamespace.Rows()", err)
+	}
+
+	return namespaces, err
+}
+
+func (db *sqlite) ListUnusedNamespaces() (namespaces []database.Namespace, err error) {
+	rows, err := db.Query(searchUnusedNamespace)
+	if err != nil {
+		return namespaces, handleError("searchUnusedNamespace", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ns database.Namespace
+
+		err = rows.Scan(&ns.ID, &ns.Name, &ns.VersionFormat)
+		if err != nil {
+			return namespaces, handleError("searchUnusedNamespace.Scan()", err)
+		}
+
+		namespaces = append(namespaces, ns)
+	}
+	if err = rows.Err(); err != nil {
+		return namespaces, handleError("searchUnusedNamespace.Rows()", err)
+	}
+
+	return namespaces, err
+}
+
+// PruneNamespace removes the vulnerabilities of an unused Namespace, along with its features and
+// feature versions that nothing references anymore, in a single transaction. The reclaimed space
+// is the growth of the free pages of the database file.
+func (db *sqlite) PruneNamespace(name string) (database.PrunedNamespace, error) {
+	var pruned database.PrunedNamespace
+	if name == "" {
+		return pruned, cerrors.NewBadRequestError("could not prune an empty namespace")
+	}
+
+	var freePages, pageSize int64
+	if err := db.QueryRow(searchFreelistCount).Scan(&freePages); err != nil {
+		return pruned, handleError("searchFreelistCount", err)
+	}
+	if err := db.QueryRow(searchPageSize).Scan(&pageSize); err != nil {
+		return pruned, handleError("searchPageSize", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return pruned, handleError("PruneNamespace.Begin()", err)
+	}
+
+	var namespaceID int
+	if err = tx.QueryRow(searchNamespace, name).Scan(&namespaceID); err != nil {
+		tx.Rollback()
+		return pruned, handleError("searchNamespace", err)
+	}
+
+	var inUse bool
+	if err = tx.QueryRow(searchNamespaceInUse, namespaceID).Scan(&inUse); err != nil {
+		tx.Rollback()
+		return pruned, handleError("searchNamespaceInUse", err)
+	}
+	if inUse {
+		tx.Rollback()
+		return pruned, database.ErrNamespaceInUse
+	}
+
+	// Removing the vulnerabilities and their revisions cascades to their FixedIn lists and to the
+	// notifications. The revisions aren't counted as vulnerabilities.
+	prunes := []struct {
+		name  string
+		query string
+		count *int
+	}{
+		{"pruneVulnerabilityRevision", pruneVulnerabilityRevision, nil},
+		{"pruneVulnerability", pruneVulnerability, &pruned.Vulnerabilities},
+		{"pruneFeatureVersion", pruneFeatureVersion, &pruned.FeatureVersions},
+		{"pruneFeature", pruneFeature, &pruned.Features},
+	}
+	for _, prune := range prunes {
+		result, err := tx.Exec(prune.query, namespaceID)
+		if err != nil {
+			tx.Rollback()
+			return database.PrunedNamespace{}, handleError(prune.name, err)
+		}
+		if prune.count == nil {
+			continue
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return database.PrunedNamespace{}, handleError(prune.name+".RowsAffected()", err)
+		}
+		*prune.count = int(count)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return database.PrunedNamespace{}, handleError("PruneNamespace.Commit()", err)
+	}
+
+	var newFreePages int64
+	if err := db.QueryRow(searchFreelistCount).Scan(&newFreePages); err == nil && newFreePages > freePages {
+		pruned.Bytes = (newFreePages - freePages) * pageSize
+	}
+
+	return pruned, nil
+}
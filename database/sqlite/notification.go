@@ -0,0 +1,444 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/tracing"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+// createNotification creates the notification of a change of a vulnerability, in the transaction
+// that changes it so that there can't be a change without notification and vice-versa. The old and
+// new revisions of the vulnerability are copied, as the Vulnerability table only has the latest.
+func createNotification(tx *tracing.Tx, oldVulnerability, newVulnerability *database.Vulnerability) error {
+	var revisionIDs [2]sql.NullInt64
+	var severities []types.Priority
+	for i, vulnerability := range []*database.Vulnerability{oldVulnerability, newVulnerability} {
+		if vulnerability == nil {
+			continue
+		}
+
+		id, err := insertRevision(tx, *vulnerability)
+		if err != nil {
+			return err
+		}
+		revisionIDs[i] = sql.NullInt64{Int64: int64(id), Valid: true}
+		severities = append(severities, vulnerability.Severity)
+	}
+
+	priority := database.NotificationPriority(severities...)
+	reason := database.NotificationReasonOf(oldVulnerability, newVulnerability)
+	_, err := tx.Exec(insertNotification, database.NewNotificationName(), time.Now().UnixNano(), revisionIDs[0], revisionIDs[1], &priority, string(reason))
+	return handleError("insertNotification", err)
+}
+
+// insertRevision copies a revision of a Vulnerability, along with its FixedIn list.
+func insertRevision(tx *tracing.Tx, vulnerability database.Vulnerability) (int, error) {
+	namespaceID, err := insertNamespace(tx, vulnerability.Namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	r, err := tx.Exec(
+		insertVulnerabilityRevision,
+		namespaceID,
+		vulnerability.Name,
+		vulnerability.Description,
+		vulnerability.Link,
+		&vulnerability.Severity,
+		&vulnerability.Metadata,
+		&vulnerability.Sources,
+		&vulnerability.CVSS,
+	)
+	if err != nil {
+		return 0, handleError("insertVulnerabilityRevision", err)
+	}
+	id, err := r.LastInsertId()
+	if err != nil {
+		return 0, handleError("insertVulnerabilityRevision.LastInsertId()", err)
+	}
+
+	for _, fv := range vulnerability.FixedIn {
+		featureID, err := insertFeature(tx, fv.Feature)
+		if err != nil {
+			return 0, err
+		}
+		if _, err = tx.Exec(insertVulnerabilityRevisionFixedInFeature, id, featureID, fv.Version); err != nil {
+			return 0, handleError("insertVulnerabilityRevisionFixedInFeature", err)
+		}
+	}
+
+	return int(id), nil
+}
+
+// findRevision returns a copied revision of a Vulnerability, including its FixedIn list.
+func findRevision(q queryer, id int) (database.Vulnerability, error) {
+	var vulnerability database.Vulnerability
+
+	err := q.QueryRow(searchVulnerabilityRevision, id).Scan(
+		&vulnerability.ID,
+		&vulnerability.Name,
+		&vulnerability.Namespace.ID,
+		&vulnerability.Namespace.Name,
+		&vulnerability.Namespace.VersionFormat,
+		&vulnerability.Description,
+		&vulnerability.Link,
+		&vulnerability.Severity,
+		&vulnerability.Metadata,
+		&vulnerability.Sources,
+		&vulnerability.CVSS,
+	)
+	if err != nil {
+		return vulnerability, handleError("searchVulnerabilityRevision.Scan()", err)
+	}
+
+	rows, err := q.Query(searchVulnerabilityRevisionFixedIn, id)
+	if err != nil {
+		return vulnerability, handleError("searchVulnerabilityRevisionFixedIn", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version, featureName string
+		var featureID int
+
+		if err := rows.Scan(&version, &featureID, &featureName); err != nil {
+			return vulnerability, handleError("searchVulnerabilityRevisionFixedIn.Scan()", err)
+		}
+
+		vulnerability.FixedIn = append(vulnerability.FixedIn, database.FeatureVersion{
+			Model: database.Model{ID: featureID},
+			Feature: database.Feature{
+				Model:     database.Model{ID: featureID},
+				Namespace: vulnerability.Namespace,
+				Name:      featureName,
+			},
+			Version: version,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return vulnerability, handleError("searchVulnerabilityRevisionFixedIn.Rows()", err)
+	}
+
+	return vulnerability, nil
+}
+
+// nanoTime converts a number of nanoseconds since the Unix epoch, as the times of the notifications
+// are stored, into a time that is zero if the number is NULL.
+func nanoTime(nanoseconds sql.NullInt64) time.Time {
+	if !nanoseconds.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, nanoseconds.Int64).UTC()
+}
+
+// GetAvailableNotification returns one available notification name (!locked && !deleted &&
+// (!notified || notified_but_timed-out)) and locks it for the given owner. Notifications with the
+// highest priority are returned first. It does not fill the vulnerabilities.
+func (db *sqlite) GetAvailableNotification(renotifyInterval time.Duration, owner string, lockDuration time.Duration) (database.VulnerabilityNotification, error) {
+	if owner == "" || lockDuration <= 0 {
+		log.Warning("could not claim a notification with an invalid lock")
+		return database.VulnerabilityNotification{}, cerrors.NewBadRequestError("could not claim a notification with an invalid lock")
+	}
+
+	// Expired locks would hide their notifications from the search.
+	db.pruneLocks()
+
+	before := time.Now().Add(-renotifyInterval).UnixNano()
+	for {
+		row := db.QueryRow(searchNotificationAvailable, before)
+		notification, err := scanNotification(db, row, false)
+		if err != nil {
+			return notification, handleError("searchNotificationAvailable", err)
+		}
+
+		// Another owner may have locked the notification since it has been searched, in which case
+		// it isn't returned by the search anymore.
+		if locked, _ := db.Lock(notification.Name, owner, lockDuration, false); locked {
+			return notification, nil
+		}
+	}
+}
+
+// ExtendNotificationLock renews the lock of a notification if the given owner still holds it.
+func (db *sqlite) ExtendNotificationLock(name, owner string, duration time.Duration) (bool, time.Time) {
+	until := time.Now().Add(duration)
+	r, err := db.Exec(updateLock, until.UnixNano(), name, owner)
+	if err != nil {
+		handleError("updateLock", err)
+		return false, until
+	}
+	n, _ := r.RowsAffected()
+
+	return n > 0, until
+}
+
+// ReleaseNotificationLock unlocks a notification if the given owner holds its lock.
+func (db *sqlite) ReleaseNotificationLock(name, owner string) {
+	db.Unlock(name, owner)
+}
+
+func (db *sqlite) GetNotification(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
+	// Read the notification and the layers from the same snapshot.
+	tx, err := db.Begin()
+	if err != nil {
+		return database.VulnerabilityNotification{}, page, handleError("GetNotification.Begin()", err)
+	}
+	defer tx.Rollback()
+
+	// Get Notification.
+	notification, err := scanNotification(tx, tx.QueryRow(searchNotification, name), true)
+	if err != nil {
+		return notification, page, handleError("searchNotification", err)
+	}
+
+	// Load vulnerabilities' LayersIntroducingVulnerability.
+	page.OldVulnerability, err = loadLayerIntroducingVulnerability(tx, notification.OldVulnerability, limit, page.OldVulnerability)
+	if err != nil {
+		return notification, page, err
+	}
+
+	page.NewVulnerability, err = loadLayerIntroducingVulnerability(tx, notification.NewVulnerability, limit, page.NewVulnerability)
+	if err != nil {
+		return notification, page, err
+	}
+
+	return notification, page, nil
+}
+
+func scanNotification(q queryer, row *sql.Row, hasVulns bool) (database.VulnerabilityNotification, error) {
+	var notification database.VulnerabilityNotification
+	var created, notified, deleted, failed sql.NullInt64
+	var reason sql.NullString
+	var oldRevisionID, newRevisionID sql.NullInt64
+
+	// Scan notification.
+	if hasVulns {
+		err := row.Scan(
+			&notification.ID,
+			&notification.Name,
+			&created,
+			&notified,
+			&deleted,
+			&failed,
+			&notification.Priority,
+			&reason,
+			&oldRevisionID,
+			&newRevisionID,
+		)
+		if err != nil {
+			return notification, err
+		}
+	} else {
+		err := row.Scan(&notification.ID, &notification.Name, &created, &notified, &deleted, &failed, &notification.Priority, &reason)
+		if err != nil {
+			return notification, err
+		}
+	}
+
+	notification.Reason = database.NotificationReason(reason.String)
+	notification.Created = nanoTime(created)
+	notification.Notified = nanoTime(notified)
+	notification.Deleted = nanoTime(deleted)
+	notification.Failed = nanoTime(failed)
+
+	if hasVulns {
+		if oldRevisionID.Valid {
+			vulnerability, err := findRevision(q, int(oldRevisionID.Int64))
+			if err != nil {
+				return notification, err
+			}
+
+			notification.OldVulnerability = &vulnerability
+		}
+
+		if newRevisionID.Valid {
+			vulnerability, err := findRevision(q, int(newRevisionID.Int64))
+			if err != nil {
+				return notification, err
+			}
+
+			notification.NewVulnerability = &vulnerability
+		}
+	}
+
+	return notification, nil
+}
+
+// loadLayerIntroducingVulnerability fills Vulnerability.LayersIntroducingVulnerability.
+// limit -1: won't do anything
+// limit 0: will just get the startID of the second page
+func loadLayerIntroducingVulnerability(q queryer, vulnerability *database.Vulnerability, limit, startID int) (int, error) {
+	if vulnerability == nil {
+		return -1, nil
+	}
+
+	// A startID equals to -1 means that we reached the end already.
+	if startID == -1 || limit == -1 {
+		return -1, nil
+	}
+
+	// Search limit + 1 layers, the last one will be used to know the next starting ID.
+	layers, err := searchLayersIntroducingVulnerability(q, *vulnerability, startID, limit+1)
+	if err != nil {
+		return -1, err
+	}
+
+	size := limit
+	if len(layers) < limit {
+		size = len(layers)
+	}
+	vulnerability.LayersIntroducingVulnerability = layers[:size]
+	for i := range vulnerability.LayersIntroducingVulnerability {
+		layer := &vulnerability.LayersIntroducingVulnerability[i]
+		if layer.Labels, err = searchLabels(q, layer.ID); err != nil {
+			return -1, err
+		}
+	}
+
+	nextID := -1
+	if len(layers) > limit {
+		nextID = layers[limit].ID
+	}
+
+	return nextID, nil
+}
+
+// searchLayersIntroducingVulnerability returns, ordered by ID, the layers starting at the given ID
+// that add a FeatureVersion affected by the given revision of a Vulnerability, at most max of them
+// unless max is negative.
+//
+// As the affected FeatureVersions aren't stored, the versions of the FeatureVersions of the fixed
+// Features that the layers add are compared to the ones in which they have been fixed.
+func searchLayersIntroducingVulnerability(q queryer, vulnerability database.Vulnerability, startID, max int) ([]database.Layer, error) {
+	rows, err := q.Query(searchNotificationLayerIntroducingVulnerability, vulnerability.ID, startID)
+	if err != nil {
+		return nil, handleError("searchNotificationLayerIntroducingVulnerability", err)
+	}
+	defer rows.Close()
+
+	var layers []database.Layer
+	for rows.Next() && (max < 0 || len(layers) < max) {
+		var layer database.Layer
+		var version, fixedInVersion string
+
+		if err := rows.Scan(&layer.ID, &layer.Name, &version, &fixedInVersion); err != nil {
+			return nil, handleError("searchNotificationLayerIntroducingVulnerability.Scan()", err)
+		}
+		if len(layers) > 0 && layers[len(layers)-1].ID == layer.ID {
+			continue
+		}
+
+		cmp, err := versionfmt.Compare(vulnerability.Namespace.VersionFormat, version, fixedInVersion)
+		if err != nil {
+			log.Warningf("could not compare %s with %s: %s", version, fixedInVersion, err)
+			continue
+		}
+		if cmp < 0 {
+			layers = append(layers, layer)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, handleError("searchNotificationLayerIntroducingVulnerability.Rows()", err)
+	}
+
+	return layers, nil
+}
+
+// searchNotificationAffectedLayers returns the identifiers of the layers introducing the old or
+// the new Vulnerability of a Notification, followed by every layer based on these.
+func searchNotificationAffectedLayers(q queryer, name string) ([]int, error) {
+	notification, err := scanNotification(q, q.QueryRow(searchNotification, name), true)
+	if err != nil {
+		return nil, handleError("searchNotification", err)
+	}
+
+	var layerIDs []int
+	seen := make(map[int]struct{})
+	for _, vulnerability := range []*database.Vulnerability{notification.OldVulnerability, notification.NewVulnerability} {
+		if vulnerability == nil {
+			continue
+		}
+
+		layers, err := searchLayersIntroducingVulnerability(q, *vulnerability, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		for _, layer := range layers {
+			if _, ok := seen[layer.ID]; !ok {
+				seen[layer.ID] = struct{}{}
+				layerIDs = append(layerIDs, layer.ID)
+			}
+		}
+	}
+
+	return searchDescendantLayers(q, layerIDs)
+}
+
+func (db *sqlite) SetNotificationNotified(name string) error {
+	if _, err := db.Exec(updatedNotificationNotified, time.Now().UnixNano(), name); err != nil {
+		return handleError("updatedNotificationNotified", err)
+	}
+	return nil
+}
+
+func (db *sqlite) SetNotificationFailed(name string) error {
+	if _, err := db.Exec(updatedNotificationFailed, time.Now().UnixNano(), name); err != nil {
+		return handleError("updatedNotificationFailed", err)
+	}
+	return nil
+}
+
+func (db *sqlite) DeleteNotification(name string) error {
+	result, err := db.Exec(removeNotification, time.Now().UnixNano(), name)
+	if err != nil {
+		return handleError("removeNotification", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("removeNotification.RowsAffected()", err)
+	}
+
+	if affected <= 0 {
+		return cerrors.ErrNotFound
+	}
+
+	return nil
+}
+
+// placeholders returns the list of n placeholders of an IN condition, e.g. "?, ?, ?".
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// intArgs converts the given identifiers into query arguments.
+func intArgs(ids []int) []interface{} {
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return args
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// InsertProvenance stores the provenance of an image, or returns the stored one if the same
+// statement is already stored for the image.
+func (db *sqlite) InsertProvenance(provenance database.Provenance) (database.Provenance, error) {
+	if provenance.Digest == "" || provenance.Statement == "" {
+		return provenance, cerrors.NewBadRequestError("could not insert a provenance which does not have a digest and a statement")
+	}
+
+	hash := sha256.Sum256([]byte(provenance.Statement))
+	statementHash := hex.EncodeToString(hash[:])
+
+	_, err := db.Exec(insertProvenance, uuid.New(), provenance.Digest, provenance.PredicateType,
+		provenance.BuilderID, provenance.Statement, statementHash, time.Now().UTC())
+	if err != nil {
+		return provenance, handleError("insertProvenance", err)
+	}
+
+	provenances, err := searchProvenances(db, searchProvenanceByStatement, provenance.Digest, statementHash)
+	if err != nil {
+		return provenance, err
+	}
+	if len(provenances) == 0 {
+		return provenance, cerrors.ErrNotFound
+	}
+	return provenances[0], nil
+}
+
+// FindProvenances returns the provenances of an image.
+func (db *sqlite) FindProvenances(digest string) ([]database.Provenance, error) {
+	return searchProvenances(db, searchProvenanceByDigest, digest)
+}
+
+func searchProvenances(q queryer, condition string, args ...interface{}) ([]database.Provenance, error) {
+	rows, err := q.Query(searchProvenanceBase+condition, args...)
+	if err != nil {
+		return nil, handleError("searchProvenance", err)
+	}
+	defer rows.Close()
+
+	var provenances []database.Provenance
+	for rows.Next() {
+		var provenance database.Provenance
+		err := rows.Scan(
+			&provenance.ID,
+			&provenance.Name,
+			&provenance.Digest,
+			&provenance.PredicateType,
+			&provenance.BuilderID,
+			&provenance.Statement,
+			&provenance.Created,
+		)
+		if err != nil {
+			return nil, handleError("searchProvenance.Scan()", err)
+		}
+		provenances = append(provenances, provenance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchProvenance.Rows()", err)
+	}
+
+	return provenances, nil
+}
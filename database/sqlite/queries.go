@@ -0,0 +1,640 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+const (
+	enableForeignKeys   = `PRAGMA foreign_keys = ON`
+	searchSQLiteVersion = `SELECT sqlite_version()`
+
+	// namespace.go
+	insertOrIgnoreNamespace = `INSERT OR IGNORE INTO Namespace(name, version_format) VALUES(?, ?)`
+	searchNamespace         = `SELECT id FROM Namespace WHERE name = ?`
+	listNamespace           = `SELECT id, name, version_format FROM Namespace`
+
+	searchUnusedNamespace = `
+		SELECT n.id, n.name, n.version_format
+		FROM Namespace n
+		WHERE NOT EXISTS (SELECT 1 FROM Layer l WHERE l.namespace_id = n.id)
+			AND NOT EXISTS (
+				SELECT 1
+				FROM Layer_FeatureVersion lfv
+					JOIN FeatureVersion fv ON lfv.featureversion_id = fv.id
+					JOIN Feature f ON fv.feature_id = f.id
+				WHERE f.namespace_id = n.id)`
+
+	searchNamespaceInUse = `
+		SELECT EXISTS (SELECT 1 FROM Layer WHERE namespace_id = ?1)
+			OR EXISTS (
+				SELECT 1
+				FROM Layer_FeatureVersion lfv
+					JOIN FeatureVersion fv ON lfv.featureversion_id = fv.id
+					JOIN Feature f ON fv.feature_id = f.id
+				WHERE f.namespace_id = ?1)`
+
+	// Removing the revisions cascades to their notifications.
+	pruneVulnerabilityRevision = `DELETE FROM Vulnerability_Revision WHERE namespace_id = ?`
+
+	pruneVulnerability  = `DELETE FROM Vulnerability WHERE namespace_id = ?`
+	pruneFeatureVersion = `
+		DELETE FROM FeatureVersion
+		WHERE feature_id IN (SELECT id FROM Feature WHERE namespace_id = ?)
+			AND id NOT IN (SELECT featureversion_id FROM Layer_FeatureVersion)`
+	pruneFeature = `
+		DELETE FROM Feature
+		WHERE namespace_id = ?
+			AND id NOT IN (SELECT feature_id FROM FeatureVersion)
+			AND id NOT IN (SELECT feature_id FROM Vulnerability_FixedIn_Feature)
+			AND id NOT IN (SELECT feature_id FROM Vulnerability_Revision_FixedIn_Feature)
+			AND id NOT IN (SELECT feature_id FROM Vulnerability_FixedIn_Feature_Archive)`
+
+	searchFreelistCount = `PRAGMA freelist_count`
+	searchPageSize      = `PRAGMA page_size`
+
+	// feature.go
+	insertOrIgnoreFeature = `INSERT OR IGNORE INTO Feature(namespace_id, name) VALUES(?, ?)`
+	searchFeature         = `SELECT id FROM Feature WHERE namespace_id = ? AND name = ?`
+
+	insertOrIgnoreFeatureVersion = `INSERT OR IGNORE INTO FeatureVersion(feature_id, version) VALUES(?, ?)`
+	searchFeatureVersion         = `SELECT id FROM FeatureVersion WHERE feature_id = ? AND version = ?`
+
+	// layer.go
+	searchLayer = `
+		SELECT l.id, l.name, l.engineversion, l.stats, p.id, p.name, n.id, n.name, n.version_format
+		FROM Layer l
+			LEFT JOIN Layer p ON l.parent_id = p.id
+			LEFT JOIN Namespace n ON l.namespace_id = n.id
+		WHERE l.name = ?`
+
+	searchLayerFeatureVersion = `
+		SELECT fv.id, fv.version, f.id, f.name, n.id, n.name, n.version_format, a.id, a.name,
+			COALESCE(lfv.detector, ''), COALESCE(lfv.state, ''), lfv.evidence
+		FROM Layer_FeatureVersion lfv
+			JOIN FeatureVersion fv ON lfv.featureversion_id = fv.id
+			JOIN Feature f ON fv.feature_id = f.id
+			JOIN Namespace n ON f.namespace_id = n.id
+			JOIN Layer a ON lfv.added_by = a.id
+		WHERE lfv.layer_id = ?`
+
+	searchFeatureVulnerability = `
+		SELECT v.id, v.name, v.description, v.link, v.severity, v.metadata, v.sources, v.cvss,
+			n.name, n.version_format, vfif.version
+		FROM Vulnerability_FixedIn_Feature vfif
+			JOIN Vulnerability v ON vfif.vulnerability_id = v.id
+			JOIN Namespace n ON v.namespace_id = n.id
+		WHERE vfif.feature_id = ?
+		ORDER BY v.id`
+
+	insertLayer = `
+		INSERT INTO Layer(name, engineversion, parent_id, namespace_id, stats, created_at)
+		VALUES(?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+
+	updateLayer = `UPDATE Layer SET engineversion = ?, namespace_id = ?, stats = ? WHERE id = ?`
+
+	// A FeatureVersion that the parent layer already has keeps the layer that added it, along with
+	// the detector that found it there and its state there. Its evidence is the one of the layer.
+	insertLayerFeatureVersion = `
+		INSERT OR IGNORE INTO Layer_FeatureVersion(layer_id, featureversion_id, added_by, detector, state, evidence)
+		SELECT ?1, ?2, COALESCE(p.added_by, ?1),
+			CASE WHEN p.added_by IS NULL THEN NULLIF(?4, '') ELSE p.detector END,
+			CASE WHEN p.added_by IS NULL THEN NULLIF(?5, '') ELSE p.state END, ?6
+		FROM (SELECT 1) LEFT JOIN Layer_FeatureVersion p ON p.layer_id = ?3 AND p.featureversion_id = ?2`
+
+	removeLayerFeatureVersion = `DELETE FROM Layer_FeatureVersion WHERE layer_id = ?`
+
+	searchLayerID = `SELECT id FROM Layer WHERE name = ?`
+
+	insertOrReplaceLayerLabel = `INSERT OR REPLACE INTO Layer_Label(layer_id, key, value) VALUES(?, ?, ?)`
+	removeLayerLabel          = `DELETE FROM Layer_Label WHERE layer_id = ? AND key = ?`
+	searchLayerLabels         = `SELECT key, value FROM Layer_Label WHERE layer_id = ?`
+
+	// searchLayerPage is followed by a condition per label, then by searchLayerPageEnd.
+	searchLayerPage      = `SELECT l.id, l.name FROM Layer l WHERE l.id >= ?`
+	searchLayerPageLabel = `
+		AND EXISTS (SELECT 1 FROM Layer_Label ll WHERE ll.layer_id = l.id AND ll.key = ? AND ll.value = ?)`
+	searchLayerPageEnd = ` ORDER BY l.id LIMIT ?`
+
+	removeLayer = `DELETE FROM Layer WHERE name = ?`
+
+	searchLayerChildren = `SELECT id FROM Layer WHERE parent_id = ?`
+
+	// searchLayerLabelsIn is followed by the list of the identifiers of the layers.
+	searchLayerLabelsIn = `SELECT layer_id, key, value FROM Layer_Label WHERE layer_id IN `
+
+	// vulnerability_archive.go
+	removeReplacedArchivedVulnerability = `
+		DELETE FROM Vulnerability_Archive
+		WHERE namespace_id = ?1 AND name IN (SELECT name FROM Vulnerability WHERE namespace_id = ?1)`
+
+	archiveVulnerability = `
+		INSERT INTO Vulnerability_Archive(id, namespace_id, name, description, link, severity, metadata,
+			sources, cvss, created_at, archived_at)
+		SELECT id, namespace_id, name, description, link, severity, metadata, sources, cvss, created_at,
+			CURRENT_TIMESTAMP
+		FROM Vulnerability
+		WHERE namespace_id = ?`
+
+	archiveVulnerabilityFixedInFeature = `
+		INSERT INTO Vulnerability_FixedIn_Feature_Archive(vulnerability_id, feature_id, version)
+		SELECT vfif.vulnerability_id, vfif.feature_id, vfif.version
+		FROM Vulnerability_FixedIn_Feature vfif JOIN Vulnerability v ON vfif.vulnerability_id = v.id
+		WHERE v.namespace_id = ?`
+
+	searchArchivedVulnerabilityBase = `
+		SELECT v.id, v.name, n.id, n.name, n.version_format, v.description, v.link, v.severity, v.metadata,
+			v.sources, v.cvss
+		FROM Vulnerability_Archive v JOIN Namespace n ON v.namespace_id = n.id`
+
+	searchArchivedVulnerabilityFixedIn = `
+		SELECT vfif.version, f.id, f.name
+		FROM Vulnerability_FixedIn_Feature_Archive vfif JOIN Feature f ON vfif.feature_id = f.id
+		WHERE vfif.vulnerability_id = ?`
+
+	// false_positive.go
+	searchFalsePositiveBase = `
+		SELECT fp.id, fp.name, n.id, n.name, n.version_format, fp.vulnerability_name, fp.feature_name,
+			fp.feature_version, fp.reason, fp.created_at
+		FROM False_Positive fp JOIN Namespace n ON fp.namespace_id = n.id`
+
+	searchFalsePositiveByVulnerability = ` WHERE n.name = ? AND fp.vulnerability_name = ? ORDER BY fp.id`
+
+	searchFalsePositivePage = ` WHERE fp.id >= ? ORDER BY fp.id LIMIT ?`
+
+	searchFalsePositiveByFinding = ` WHERE fp.namespace_id = ? AND fp.vulnerability_name = ? AND fp.feature_name = ? AND fp.feature_version = ?`
+
+	updateFalsePositive = `UPDATE False_Positive SET reason = ? WHERE id = ?`
+
+	insertFalsePositive = `
+		INSERT INTO False_Positive(name, namespace_id, vulnerability_name, feature_name, feature_version,
+			reason, created_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`
+
+	removeFalsePositive = `DELETE FROM False_Positive WHERE name = ?`
+
+	// watched_tag.go
+	searchWatchedTagBase = `
+		SELECT id, name, registry, repository, tag, digest, layer_name, reported_digest, signature,
+			attested, published, created_at, resolved_at, changed_at
+		FROM Watched_Tag`
+
+	searchWatchedTagByName = ` WHERE name = ?`
+
+	searchWatchedTagByReference = ` WHERE registry = ? AND repository = ? AND tag = ?`
+
+	searchWatchedTagPage = ` WHERE id >= ? ORDER BY id LIMIT ?`
+
+	searchMovedWatchedTagPage = ` WHERE digest <> reported_digest AND id >= ? ORDER BY id LIMIT ?`
+
+	// searchWatchedTagByLayerIDs is followed by the list of the identifiers of the layers and by a
+	// closing parenthesis.
+	searchWatchedTagByLayerIDs = ` WHERE layer_name IN (SELECT name FROM Layer WHERE id IN `
+
+	insertWatchedTag = `
+		INSERT OR IGNORE INTO Watched_Tag(name, registry, repository, tag, created_at)
+		VALUES(?, ?, ?, ?, ?)`
+
+	updateWatchedTag = `
+		UPDATE Watched_Tag SET digest = ?1, layer_name = ?2, resolved_at = ?3, changed_at = ?4,
+			signature = ?6, attested = ?7, published = ?8, reported_digest = CASE WHEN reported_digest = '' THEN ?1 ELSE reported_digest END
+		WHERE name = ?5`
+
+	updateWatchedTagReported = `UPDATE Watched_Tag SET reported_digest = ? WHERE name = ?`
+
+	removeWatchedTag = `DELETE FROM Watched_Tag WHERE name = ?`
+
+	// provenance.go
+	searchProvenanceBase = `
+		SELECT id, name, digest, predicate_type, builder_id, statement, created_at
+		FROM Provenance`
+
+	searchProvenanceByDigest = ` WHERE digest = ? ORDER BY id`
+
+	searchProvenanceByStatement = ` WHERE digest = ? AND statement_hash = ?`
+
+	insertProvenance = `
+		INSERT OR IGNORE INTO Provenance(name, digest, predicate_type, builder_id, statement, statement_hash, created_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`
+
+	// image.go
+	insertImage = `INSERT OR IGNORE INTO Image(digest, layer_id, created_at) VALUES(?, ?, ?)`
+
+	searchImage = `
+		SELECT i.id, l.name, i.created_at
+		FROM Image i JOIN Layer l ON i.layer_id = l.id
+		WHERE i.digest = ?`
+
+	// layer_analysis.go
+	insertOrReplaceLayerAnalysis = `
+		INSERT OR REPLACE INTO Layer_Analysis(digest, version, result, created_at) VALUES(?, ?, ?, ?)`
+
+	searchLayerAnalysis = `SELECT version, result, created_at FROM Layer_Analysis WHERE digest = ?`
+
+	// vulnerability.go
+	searchVulnerabilityBase = `
+		SELECT v.id, v.name, n.id, n.name, n.version_format, v.description, v.link, v.severity, v.metadata,
+			v.sources, v.cvss
+		FROM Vulnerability v JOIN Namespace n ON v.namespace_id = n.id`
+	searchVulnerabilityByNamespaceAndName = ` WHERE n.name = ? AND v.name = ?`
+	searchVulnerabilityByNamespace        = ` WHERE n.name = ? AND v.id >= ? ORDER BY v.id LIMIT ?`
+
+	searchVulnerabilityFixedIn = `
+		SELECT vfif.version, f.id, f.name
+		FROM Vulnerability_FixedIn_Feature vfif JOIN Feature f ON vfif.feature_id = f.id
+		WHERE vfif.vulnerability_id = ?`
+
+	insertVulnerability = `
+		INSERT INTO Vulnerability(namespace_id, name, description, link, severity, metadata, sources,
+			cvss, created_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+
+	updateVulnerability = `
+		UPDATE Vulnerability SET description = ?, link = ?, severity = ?, metadata = ?, sources = ?,
+			cvss = ?
+		WHERE id = ?`
+
+	insertVulnerabilityFixedInFeature = `
+		INSERT INTO Vulnerability_FixedIn_Feature(vulnerability_id, feature_id, version)
+		VALUES(?, ?, ?)`
+
+	removeVulnerabilityFixedInFeature = `DELETE FROM Vulnerability_FixedIn_Feature WHERE vulnerability_id = ?`
+
+	removeVulnerability = `DELETE FROM Vulnerability WHERE id = ?`
+
+	insertVulnerabilityRevision = `
+		INSERT INTO Vulnerability_Revision(namespace_id, name, description, link, severity, metadata,
+			sources, cvss, created_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+
+	insertVulnerabilityRevisionFixedInFeature = `
+		INSERT INTO Vulnerability_Revision_FixedIn_Feature(revision_id, feature_id, version)
+		VALUES(?, ?, ?)`
+
+	searchVulnerabilityRevision = `
+		SELECT vr.id, vr.name, n.id, n.name, n.version_format, vr.description, vr.link, vr.severity,
+			vr.metadata, vr.sources, vr.cvss
+		FROM Vulnerability_Revision vr JOIN Namespace n ON vr.namespace_id = n.id
+		WHERE vr.id = ?`
+
+	searchVulnerabilityRevisionFixedIn = `
+		SELECT vrf.version, f.id, f.name
+		FROM Vulnerability_Revision_FixedIn_Feature vrf JOIN Feature f ON vrf.feature_id = f.id
+		WHERE vrf.revision_id = ?`
+
+	// notification.go
+	insertNotification = `
+		INSERT INTO Vulnerability_Notification(name, created_at, old_revision_id, new_revision_id, priority, reason)
+		VALUES(?, ?, ?, ?, ?, ?)`
+
+	updatedNotificationNotified = `UPDATE Vulnerability_Notification SET notified_at = ?, failed_at = NULL WHERE name = ?`
+
+	updatedNotificationFailed = `UPDATE Vulnerability_Notification SET failed_at = ? WHERE name = ?`
+
+	removeNotification = `UPDATE Vulnerability_Notification SET deleted_at = ? WHERE name = ?`
+
+	// searchNotificationAvailable skips the notifications of a vulnerability that has older pending
+	// notifications, so that the changes of a vulnerability are delivered in creation order, unless
+	// the older ones failed. The priorities are stored as text and thus ranked explicitly.
+	searchNotificationAvailable = `
+		SELECT vn.id, vn.name, vn.created_at, vn.notified_at, vn.deleted_at, vn.failed_at, vn.priority, vn.reason
+		FROM Vulnerability_Notification vn
+			JOIN Vulnerability_Revision v ON v.id = COALESCE(vn.new_revision_id, vn.old_revision_id)
+		WHERE (vn.notified_at IS NULL OR vn.notified_at < ?1)
+			AND (vn.failed_at IS NULL OR vn.failed_at < ?1)
+			AND vn.deleted_at IS NULL
+			AND vn.name NOT IN (SELECT name FROM Lock)
+			AND NOT EXISTS (
+				SELECT 1
+				FROM Vulnerability_Notification older
+					JOIN Vulnerability_Revision ov ON ov.id = COALESCE(older.new_revision_id, older.old_revision_id)
+				WHERE older.id < vn.id
+					AND older.notified_at IS NULL
+					AND older.deleted_at IS NULL
+					AND older.failed_at IS NULL
+					AND ov.namespace_id = v.namespace_id
+					AND ov.name = v.name)
+		ORDER BY CASE vn.priority
+				WHEN 'Defcon1' THEN 6
+				WHEN 'Critical' THEN 5
+				WHEN 'High' THEN 4
+				WHEN 'Medium' THEN 3
+				WHEN 'Low' THEN 2
+				WHEN 'Negligible' THEN 1
+				ELSE 0
+			END DESC, RANDOM()
+		LIMIT 1`
+
+	searchNotification = `
+		SELECT id, name, created_at, notified_at, deleted_at, failed_at, priority, reason, old_revision_id, new_revision_id
+		FROM Vulnerability_Notification
+		WHERE name = ?`
+
+	// searchNotificationLayerIntroducingVulnerability returns the layers adding a FeatureVersion of
+	// a Feature fixed by a revision of a Vulnerability, with the version of the FeatureVersion and
+	// the one of the fix, so that the affected ones can be selected.
+	searchNotificationLayerIntroducingVulnerability = `
+		SELECT l.id, l.name, fv.version, vrf.version
+		FROM Vulnerability_Revision_FixedIn_Feature vrf
+			JOIN FeatureVersion fv ON fv.feature_id = vrf.feature_id
+			JOIN Layer_FeatureVersion lfv ON lfv.featureversion_id = fv.id AND lfv.added_by = lfv.layer_id
+			JOIN Layer l ON lfv.layer_id = l.id
+		WHERE vrf.revision_id = ? AND l.id >= ?
+		ORDER BY l.id`
+
+	// notification_delivery.go
+	searchNotificationID = `SELECT id FROM Vulnerability_Notification WHERE name = ?`
+
+	reopenNotificationDelivery = `
+		UPDATE Notification_Delivery SET key = ?1, delivered_at = NULL
+		WHERE notification_id = ?2
+			AND notifier = ?3
+			AND delivered_at <= (SELECT notified_at FROM Vulnerability_Notification WHERE id = ?2)`
+
+	insertNotificationDelivery = `
+		INSERT OR IGNORE INTO Notification_Delivery(notification_id, notifier, key, created_at)
+		VALUES(?, ?, ?, ?)`
+
+	searchNotificationDeliveryByNotifier = `
+		SELECT id, key, created_at, delivered_at
+		FROM Notification_Delivery
+		WHERE notification_id = ? AND notifier = ?`
+
+	insertNotificationDeliveryAttempt = `
+		INSERT INTO Notification_Delivery_Attempt(delivery_id, attempted_at, succeeded, error)
+		VALUES(?, ?, ?, ?)`
+
+	updateNotificationDeliveryDelivered = `
+		UPDATE Notification_Delivery SET delivered_at = ?
+		WHERE id = ? AND delivered_at IS NULL`
+
+	searchNotificationDelivery = `
+		SELECT d.id, d.notifier, d.key, d.created_at, d.delivered_at
+		FROM Notification_Delivery d JOIN Vulnerability_Notification n ON d.notification_id = n.id
+		WHERE n.name = ?
+		ORDER BY d.id`
+
+	// searchNotificationDeliveryAttempt is followed by the list of the identifiers of the
+	// deliveries.
+	searchNotificationDeliveryAttempt = `
+		SELECT delivery_id, id, attempted_at, succeeded, error
+		FROM Notification_Delivery_Attempt
+		WHERE delivery_id IN `
+
+	searchUndeliveredNotification = `
+		SELECT n.id, n.name, n.created_at, n.notified_at, n.deleted_at, n.priority, n.reason
+		FROM Notification_Delivery d JOIN Vulnerability_Notification n ON d.notification_id = n.id
+		WHERE d.notifier = ?
+			AND d.delivered_at IS NULL
+			AND n.notified_at IS NOT NULL
+			AND n.deleted_at IS NULL
+		ORDER BY n.id`
+
+	// keyvalue.go
+	insertOrReplaceKeyValue = `INSERT OR REPLACE INTO KeyValue(key, value) VALUES(?, ?)`
+	searchKeyValue          = `SELECT value FROM KeyValue WHERE key = ?`
+
+	// lock.go
+	insertLock        = `INSERT INTO Lock(name, owner, until) VALUES(?, ?, ?)`
+	searchLock        = `SELECT owner, until FROM Lock WHERE name = ?`
+	updateLock        = `UPDATE Lock SET until = ? WHERE name = ? AND owner = ?`
+	removeLock        = `DELETE FROM Lock WHERE name = ? AND owner = ?`
+	removeLockExpired = `DELETE FROM Lock WHERE until < ?`
+)
+
+// schema creates the tables of the embedded datastore if they don't exist yet.
+//
+// Unlike the pgsql driver, every layer stores its entire list of FeatureVersions along with the
+// layer that added them, and the vulnerabilities affecting a FeatureVersion are determined when
+// the layer is read.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS Namespace (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		version_format TEXT NOT NULL DEFAULT '')`,
+
+	`CREATE TABLE IF NOT EXISTS Feature (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		namespace_id INTEGER NOT NULL REFERENCES Namespace,
+		name TEXT NOT NULL,
+		UNIQUE (namespace_id, name))`,
+
+	`CREATE TABLE IF NOT EXISTS FeatureVersion (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		feature_id INTEGER NOT NULL REFERENCES Feature,
+		version TEXT NOT NULL,
+		UNIQUE (feature_id, version))`,
+
+	`CREATE TABLE IF NOT EXISTS Layer (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		engineversion INTEGER NOT NULL,
+		parent_id INTEGER NULL REFERENCES Layer ON DELETE CASCADE,
+		namespace_id INTEGER NULL REFERENCES Namespace,
+		created_at DATETIME)`,
+	`CREATE INDEX IF NOT EXISTS layer_parent_id_idx ON Layer (parent_id)`,
+
+	`CREATE TABLE IF NOT EXISTS Layer_FeatureVersion (
+		layer_id INTEGER NOT NULL REFERENCES Layer ON DELETE CASCADE,
+		featureversion_id INTEGER NOT NULL REFERENCES FeatureVersion,
+		added_by INTEGER NOT NULL REFERENCES Layer ON DELETE CASCADE,
+		PRIMARY KEY (layer_id, featureversion_id))`,
+	`CREATE INDEX IF NOT EXISTS layer_featureversion_added_by_idx ON Layer_FeatureVersion (added_by)`,
+
+	`CREATE TABLE IF NOT EXISTS Vulnerability (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		namespace_id INTEGER NOT NULL REFERENCES Namespace,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		link TEXT NOT NULL DEFAULT '',
+		severity TEXT NOT NULL,
+		metadata TEXT NULL,
+		sources TEXT NULL,
+		created_at DATETIME,
+		UNIQUE (namespace_id, name))`,
+
+	`CREATE TABLE IF NOT EXISTS Vulnerability_FixedIn_Feature (
+		vulnerability_id INTEGER NOT NULL REFERENCES Vulnerability ON DELETE CASCADE,
+		feature_id INTEGER NOT NULL REFERENCES Feature,
+		version TEXT NOT NULL,
+		PRIMARY KEY (vulnerability_id, feature_id))`,
+	`CREATE INDEX IF NOT EXISTS vulnerability_fixedin_feature_feature_id_idx
+		ON Vulnerability_FixedIn_Feature (feature_id)`,
+
+	`CREATE TABLE IF NOT EXISTS KeyValue (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL)`,
+
+	`CREATE TABLE IF NOT EXISTS Lock (
+		name TEXT PRIMARY KEY,
+		owner TEXT NOT NULL,
+		until INTEGER NOT NULL)`,
+
+	`CREATE TABLE IF NOT EXISTS False_Positive (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		namespace_id INTEGER NOT NULL REFERENCES Namespace,
+		vulnerability_name TEXT NOT NULL,
+		feature_name TEXT NOT NULL,
+		feature_version TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		created_at DATETIME,
+		UNIQUE (namespace_id, vulnerability_name, feature_name, feature_version))`,
+
+	`CREATE TABLE IF NOT EXISTS Watched_Tag (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		registry TEXT NOT NULL,
+		repository TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		digest TEXT NOT NULL DEFAULT '',
+		layer_name TEXT NOT NULL DEFAULT '',
+		created_at DATETIME,
+		resolved_at DATETIME NULL,
+		changed_at DATETIME NULL,
+		UNIQUE (registry, repository, tag))`,
+
+	`CREATE TABLE IF NOT EXISTS Provenance (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		digest TEXT NOT NULL,
+		predicate_type TEXT NOT NULL,
+		builder_id TEXT NOT NULL,
+		statement TEXT NOT NULL,
+		statement_hash TEXT NOT NULL,
+		created_at DATETIME,
+		UNIQUE (digest, statement_hash))`,
+
+	`CREATE TABLE IF NOT EXISTS Layer_Label (
+		layer_id INTEGER NOT NULL REFERENCES Layer ON DELETE CASCADE,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (layer_id, key))`,
+	`CREATE INDEX IF NOT EXISTS layer_label_key_value_idx ON Layer_Label (key, value)`,
+
+	`CREATE TABLE IF NOT EXISTS Image (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		digest TEXT NOT NULL UNIQUE,
+		layer_id INTEGER NOT NULL REFERENCES Layer ON DELETE CASCADE,
+		created_at DATETIME)`,
+}
+
+// migrations alter the schema of the databases created by earlier versions of the driver. They are
+// applied in order and the number of applied migrations is stored as the user_version of the
+// database.
+var migrations = []string{
+	`ALTER TABLE Layer_FeatureVersion ADD COLUMN detector TEXT NULL`,
+	`ALTER TABLE Watched_Tag ADD COLUMN reported_digest TEXT NOT NULL DEFAULT ''`,
+	`UPDATE Watched_Tag SET reported_digest = digest`,
+	`ALTER TABLE Watched_Tag ADD COLUMN signature TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE Watched_Tag ADD COLUMN attested TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE Watched_Tag ADD COLUMN published TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE Layer_FeatureVersion ADD COLUMN state TEXT NULL`,
+	`ALTER TABLE Layer_FeatureVersion ADD COLUMN evidence TEXT NULL`,
+
+	// The Vulnerability table only has the latest revision of every Vulnerability: the revisions
+	// referenced by notifications are copied, and the times of the notifications and of their
+	// deliveries are numbers of nanoseconds since the Unix epoch, so that SQLite compares them.
+	`CREATE TABLE Vulnerability_Revision (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		namespace_id INTEGER NOT NULL REFERENCES Namespace,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		link TEXT NOT NULL DEFAULT '',
+		severity TEXT NOT NULL,
+		metadata TEXT NULL,
+		sources TEXT NULL,
+		created_at DATETIME)`,
+	`CREATE INDEX vulnerability_revision_namespace_id_name_idx ON Vulnerability_Revision (namespace_id, name)`,
+	`CREATE TABLE Vulnerability_Revision_FixedIn_Feature (
+		revision_id INTEGER NOT NULL REFERENCES Vulnerability_Revision ON DELETE CASCADE,
+		feature_id INTEGER NOT NULL REFERENCES Feature,
+		version TEXT NOT NULL,
+		PRIMARY KEY (revision_id, feature_id))`,
+	`CREATE INDEX vulnerability_revision_fixedin_feature_feature_id_idx
+		ON Vulnerability_Revision_FixedIn_Feature (feature_id)`,
+	`CREATE TABLE Vulnerability_Notification (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		created_at INTEGER NOT NULL,
+		notified_at INTEGER NULL,
+		deleted_at INTEGER NULL,
+		priority TEXT NOT NULL DEFAULT 'Unknown',
+		old_revision_id INTEGER NULL REFERENCES Vulnerability_Revision ON DELETE CASCADE,
+		new_revision_id INTEGER NULL REFERENCES Vulnerability_Revision ON DELETE CASCADE)`,
+	`CREATE INDEX vulnerability_notification_old_revision_id_idx ON Vulnerability_Notification (old_revision_id)`,
+	`CREATE INDEX vulnerability_notification_new_revision_id_idx ON Vulnerability_Notification (new_revision_id)`,
+	`CREATE TABLE Notification_Delivery (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		notification_id INTEGER NOT NULL REFERENCES Vulnerability_Notification ON DELETE CASCADE,
+		notifier TEXT NOT NULL,
+		key TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		delivered_at INTEGER NULL,
+		UNIQUE (notification_id, notifier))`,
+	`CREATE TABLE Notification_Delivery_Attempt (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		delivery_id INTEGER NOT NULL REFERENCES Notification_Delivery ON DELETE CASCADE,
+		attempted_at INTEGER NOT NULL,
+		succeeded BOOLEAN NOT NULL,
+		error TEXT NULL)`,
+	`CREATE INDEX notification_delivery_attempt_delivery_id_idx ON Notification_Delivery_Attempt (delivery_id)`,
+
+	// The Alpine namespaces created before the apk version format existed used the dpkg one.
+	`UPDATE Namespace SET version_format = 'apk' WHERE name LIKE 'alpine:%'`,
+
+	// The kind of change that the notifications announce. The creations and deletions of
+	// vulnerabilities are classified retroactively, the other notifications have no reason.
+	`ALTER TABLE Vulnerability_Notification ADD COLUMN reason TEXT NULL`,
+	`UPDATE Vulnerability_Notification SET reason = 'NewVulnerability' WHERE old_revision_id IS NULL`,
+	`UPDATE Vulnerability_Notification SET reason = 'Deleted' WHERE new_revision_id IS NULL`,
+
+	`ALTER TABLE Vulnerability ADD COLUMN cvss TEXT NULL`,
+	`ALTER TABLE Vulnerability_Revision ADD COLUMN cvss TEXT NULL`,
+
+	`ALTER TABLE Layer ADD COLUMN stats TEXT NULL`,
+
+	`CREATE TABLE Layer_Analysis (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		digest TEXT NOT NULL UNIQUE,
+		version TEXT NOT NULL,
+		result TEXT NOT NULL,
+		created_at DATETIME)`,
+
+	`ALTER TABLE Vulnerability_Notification ADD COLUMN failed_at INTEGER NULL`,
+
+	// The vulnerabilities of the namespaces that stopped being updated are archived with their
+	// original identifiers, an archived Vulnerability replacing the previous one of the same name.
+	`CREATE TABLE Vulnerability_Archive (
+		id INTEGER PRIMARY KEY,
+		namespace_id INTEGER NOT NULL REFERENCES Namespace,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		link TEXT NOT NULL DEFAULT '',
+		severity TEXT NOT NULL,
+		metadata TEXT NULL,
+		sources TEXT NULL,
+		cvss TEXT NULL,
+		created_at DATETIME,
+		archived_at DATETIME,
+		UNIQUE (namespace_id, name))`,
+	`CREATE TABLE Vulnerability_FixedIn_Feature_Archive (
+		vulnerability_id INTEGER NOT NULL REFERENCES Vulnerability_Archive ON DELETE CASCADE,
+		feature_id INTEGER NOT NULL REFERENCES Feature,
+		version TEXT NOT NULL,
+		PRIMARY KEY (vulnerability_id, feature_id))`,
+	`CREATE INDEX vulnerability_fixedin_feature_archive_feature_id_idx
+		ON Vulnerability_FixedIn_Feature_Archive (feature_id)`,
+}
@@ -0,0 +1,200 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/tracing"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// driverName is the name of the database/sql driver that enables foreign keys on every connection.
+const driverName = "sqlite3_clair"
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "sqlite")
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			_, err := conn.Exec(enableForeignKeys, nil)
+			return err
+		},
+	})
+
+	database.Register("sqlite", openDatabase)
+}
+
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type sqlite struct {
+	*tracing.DB
+	config Config
+}
+
+// Config is the configuration that is used by openDatabase.
+type Config struct {
+	// Path is the file in which the database is stored. It is created if it doesn't exist.
+	Path string
+}
+
+// openDatabase opens a SQLite-backed Datastore using the given configuration and creates the
+// schema if necessary.
+func openDatabase(registrableComponentConfig config.RegistrableComponentConfig) (database.Datastore, error) {
+	var db sqlite
+
+	// Parse configuration.
+	bytes, err := yaml.Marshal(registrableComponentConfig.Options)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: could not load configuration: %v", err)
+	}
+	err = yaml.Unmarshal(bytes, &db.config)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: could not load configuration: %v", err)
+	}
+	if db.config.Path == "" {
+		return nil, cerrors.NewBadRequestError("sqlite: no database path specified")
+	}
+
+	// Open database.
+	sqlDB, err := sql.Open(driverName, db.config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: could not open database: %v", err)
+	}
+	db.DB = tracing.NewDB(sqlDB, "sqlite")
+
+	// SQLite only allows a single writer at a time: use a single connection to serialize the
+	// transactions instead of failing them with SQLITE_BUSY.
+	db.DB.SetMaxOpenConns(1)
+
+	// Create schema.
+	for _, query := range schema {
+		if _, err = db.Exec(query); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("sqlite: could not create schema: %v", err)
+		}
+	}
+	if err = migrate(db.DB.DB); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlite: could not migrate schema: %v", err)
+	}
+
+	return &db, nil
+}
+
+// migrate applies the migrations that haven't been applied to the database yet.
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(migrations[version]); err == nil {
+			_, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the database.
+func (db *sqlite) Close() {
+	if db.DB != nil {
+		db.DB.Close()
+	}
+}
+
+// WithContext returns a copy of the database making its queries with the given context.
+func (db *sqlite) WithContext(ctx context.Context) database.Datastore {
+	bound := *db
+	bound.DB = db.DB.WithContext(ctx)
+	return &bound
+}
+
+// Health verifies that the database file is accessible.
+func (db *sqlite) Health(ctx context.Context) (database.HealthStatus, error) {
+	var status database.HealthStatus
+
+	start := time.Now()
+	err := db.QueryRowContext(ctx, searchSQLiteVersion).Scan(&status.Version)
+	status.Latency = time.Since(start)
+	if err != nil {
+		status.State = database.Unhealthy
+		if ctx.Err() != nil {
+			status.Message = "timed out waiting for the database"
+			return status, ctx.Err()
+		}
+		status.Message = err.Error()
+		return status, handleError("searchSQLiteVersion", err)
+	}
+
+	status.State = database.Healthy
+	return status, nil
+}
+
+// handleError logs an error with an extra description and masks the error if it's an SQL one.
+// This ensures we never return an error containing the database content.
+func handleError(desc string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if err == sql.ErrNoRows {
+		return cerrors.ErrNotFound
+	}
+
+	log.Errorf("%s: %v", desc, err)
+
+	if _, o := err.(sqlite3.Error); o || err == sql.ErrTxDone || strings.HasPrefix(err.Error(), "sql:") {
+		return database.ErrBackendException
+	}
+
+	return err
+}
+
+// isErrConstraint determines if the given error is a constraint violation, such as an unique one.
+func isErrConstraint(err error) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && sqliteErr.Code == sqlite3.ErrConstraint
+}
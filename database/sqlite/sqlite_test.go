@@ -0,0 +1,424 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	_ "github.com/coreos/clair/ext/versionfmt/apk"
+	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+type sqliteTest struct {
+	database.Datastore
+	dir string
+}
+
+func (test sqliteTest) Close() {
+	test.Datastore.Close()
+	os.RemoveAll(test.dir)
+}
+
+func openDatabaseForTest(t *testing.T) *sqliteTest {
+	dir, err := ioutil.TempDir("", "clair-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	datastore, err := openDatabase(config.RegistrableComponentConfig{
+		Options: map[string]interface{}{"path": filepath.Join(dir, "clair.db")},
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return &sqliteTest{Datastore: datastore, dir: dir}
+}
+
+func TestOpenDatabaseWithoutPath(t *testing.T) {
+	_, err := openDatabase(config.RegistrableComponentConfig{})
+	assert.IsType(t, &cerrors.ErrBadRequest{}, err)
+}
+
+func TestHealth(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	status, err := datastore.Health(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, database.Healthy, status.State)
+	assert.NotEmpty(t, status.Version)
+
+	// The query is abandoned once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	status, err = datastore.Health(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, database.Unhealthy, status.State)
+	assert.Equal(t, "timed out waiting for the database", status.Message)
+}
+
+func TestWithContext(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	assert.Nil(t, datastore.WithContext(context.Background()).InsertKeyValue("test", "test"))
+
+	// The queries of a datastore bound to a context are abandoned once it is done, while the
+	// datastore it was returned by keeps working.
+	ctx, cancel := context.WithCancel(context.Background())
+	bound := datastore.WithContext(ctx)
+	f, err := bound.GetKeyValue("test")
+	assert.Nil(t, err)
+	assert.Equal(t, "test", f)
+	cancel()
+	_, err = bound.GetKeyValue("test")
+	assert.Error(t, err)
+	assert.Error(t, bound.InsertKeyValue("test", "canceled"))
+
+	f, err = datastore.GetKeyValue("test")
+	assert.Nil(t, err)
+	assert.Equal(t, "test", f)
+}
+
+func TestKeyValue(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	// Get non-existing key/value
+	f, err := datastore.GetKeyValue("test")
+	assert.Nil(t, err)
+	assert.Empty(t, f)
+
+	// Try to insert invalid key/value.
+	assert.Error(t, datastore.InsertKeyValue("test", ""))
+	assert.Error(t, datastore.InsertKeyValue("", "test"))
+
+	// Insert, update and verify.
+	assert.Nil(t, datastore.InsertKeyValue("test", "test1"))
+	assert.Nil(t, datastore.InsertKeyValue("test", "test2"))
+	f, err = datastore.GetKeyValue("test")
+	assert.Nil(t, err)
+	assert.Equal(t, "test2", f)
+}
+
+func TestLock(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	// Create a first lock.
+	l, _ := datastore.Lock("test1", "owner1", time.Minute, false)
+	assert.True(t, l)
+
+	// Try to lock the same lock with another owner.
+	l, _ = datastore.Lock("test1", "owner2", time.Minute, true)
+	assert.False(t, l)
+	l, _ = datastore.Lock("test1", "owner2", time.Minute, false)
+	assert.False(t, l)
+
+	// Renew the lock.
+	l, _ = datastore.Lock("test1", "owner1", 2*time.Minute, true)
+	assert.True(t, l)
+
+	// Unlock and then relock by someone else.
+	datastore.Unlock("test1", "owner1")
+	l, until := datastore.Lock("test1", "owner2", time.Minute, false)
+	assert.True(t, l)
+
+	// LockInfo
+	o, u, err := datastore.FindLock("test1")
+	assert.Nil(t, err)
+	assert.Equal(t, "owner2", o)
+	assert.Equal(t, until.UnixNano(), u.UnixNano())
+
+	// Create a second lock which is actually already expired ...
+	l, _ = datastore.Lock("test2", "owner1", -time.Minute, false)
+	assert.True(t, l)
+
+	// Take over the lock
+	l, _ = datastore.Lock("test2", "owner2", time.Minute, false)
+	assert.True(t, l)
+}
+
+func TestLayerAndVulnerability(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	namespace := database.Namespace{Name: "debian:7", VersionFormat: dpkg.ParserName}
+	openssl := database.Feature{Name: "openssl", Namespace: namespace}
+
+	// Insert a vulnerability fixed in openssl 1.0.
+	vulnerability := database.Vulnerability{
+		Name:      "CVE-OPENSSL-1-DEB7",
+		Namespace: namespace,
+		Severity:  types.High,
+		Sources:   database.VulnerabilitySources{{Name: "Source1", License: "CC-BY-4.0"}},
+		FixedIn:   []database.FeatureVersion{{Feature: openssl, Version: "1.0"}},
+	}
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true))
+
+	v, err := datastore.FindVulnerability(namespace.Name, vulnerability.Name)
+	if assert.Nil(t, err) && assert.Len(t, v.FixedIn, 1) {
+		assert.Equal(t, types.High, v.Severity)
+		assert.Equal(t, vulnerability.Sources, v.Sources)
+		assert.Equal(t, "1.0", v.FixedIn[0].Version)
+	}
+
+	// Insert a layer and its child, which upgrades openssl.
+	parent := database.Layer{
+		Name:          "parent",
+		EngineVersion: 1,
+		Namespace:     &namespace,
+		Features:      []database.FeatureVersion{{Feature: openssl, Version: "0.9"}},
+	}
+	assert.Nil(t, datastore.InsertLayer(parent))
+
+	p, err := datastore.FindLayer("parent", true, true)
+	if assert.Nil(t, err) && assert.Len(t, p.Features, 1) {
+		assert.Equal(t, "parent", p.Features[0].AddedBy.Name)
+		if assert.Len(t, p.Features[0].AffectedBy, 1) {
+			assert.Equal(t, vulnerability.Name, p.Features[0].AffectedBy[0].Name)
+			assert.Equal(t, "1.0", p.Features[0].AffectedBy[0].FixedBy)
+		}
+	}
+
+	child := database.Layer{
+		Name:          "child",
+		EngineVersion: 1,
+		Parent:        &p,
+		Features:      []database.FeatureVersion{{Feature: openssl, Version: "1.1"}},
+	}
+	assert.Nil(t, datastore.InsertLayer(child))
+
+	c, err := datastore.FindLayer("child", true, true)
+	if assert.Nil(t, err) && assert.Len(t, c.Features, 1) {
+		assert.Equal(t, "parent", c.Parent.Name)
+		assert.Equal(t, namespace.Name, c.Namespace.Name)
+		assert.Equal(t, "child", c.Features[0].AddedBy.Name)
+		assert.Empty(t, c.Features[0].AffectedBy)
+	}
+
+	// Fix the vulnerability in a later version: the child is now affected.
+	assert.Nil(t, datastore.InsertVulnerabilityFixes(namespace.Name, vulnerability.Name,
+		[]database.FeatureVersion{{Feature: openssl, Version: "2.0"}}))
+	c, err = datastore.FindLayer("child", true, true)
+	if assert.Nil(t, err) && assert.Len(t, c.Features, 1) {
+		assert.Len(t, c.Features[0].AffectedBy, 1)
+	}
+
+	// Remove the fix: nothing is affected anymore.
+	assert.Nil(t, datastore.DeleteVulnerabilityFix(namespace.Name, vulnerability.Name, openssl.Name))
+	p, err = datastore.FindLayer("parent", true, true)
+	if assert.Nil(t, err) && assert.Len(t, p.Features, 1) {
+		assert.Empty(t, p.Features[0].AffectedBy)
+	}
+
+	// Deleting the parent deletes the child as well.
+	assert.Nil(t, datastore.DeleteLayer("parent"))
+	_, err = datastore.FindLayer("child", false, false)
+	assert.Equal(t, cerrors.ErrNotFound, err)
+
+	// Delete the vulnerability.
+	assert.Nil(t, datastore.DeleteVulnerability(namespace.Name, vulnerability.Name))
+	assert.Equal(t, cerrors.ErrNotFound, datastore.DeleteVulnerability(namespace.Name, vulnerability.Name))
+
+	vulnerabilities, nextPage, err := datastore.ListVulnerabilities(namespace.Name, 10, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, vulnerabilities)
+	assert.Equal(t, -1, nextPage)
+}
+
+func TestAlpineVersionFormatMigration(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	// The Alpine packages were compared with the dpkg rules, which order the release candidates
+	// after the releases.
+	namespace := database.Namespace{Name: "alpine:v3.18", VersionFormat: dpkg.ParserName}
+	openssl := database.Feature{Name: "openssl", Namespace: namespace}
+	vulnerability := database.Vulnerability{
+		Name:      "CVE-2024-0001",
+		Namespace: namespace,
+		Severity:  types.High,
+		FixedIn:   []database.FeatureVersion{{Feature: openssl, Version: "1.2.3-r0"}},
+	}
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, false))
+	layer := database.Layer{
+		Name:          "alpine",
+		EngineVersion: 1,
+		Namespace:     &namespace,
+		Features:      []database.FeatureVersion{{Feature: openssl, Version: "1.2.3_rc1-r0"}},
+	}
+	assert.Nil(t, datastore.InsertLayer(layer))
+	affectedBy := func() []database.Vulnerability {
+		l, err := datastore.FindLayer(layer.Name, true, true)
+		if !assert.Nil(t, err) || !assert.Len(t, l.Features, 1) {
+			return nil
+		}
+		return l.Features[0].AffectedBy
+	}
+	assert.Len(t, affectedBy(), 0)
+
+	// The vulnerabilities affecting a package are determined when the layer is read, so the
+	// migration switching the namespace to the apk rules is enough.
+	for _, migration := range migrations {
+		if strings.Contains(migration, "alpine:%") {
+			_, err := datastore.Datastore.(*sqlite).Exec(migration)
+			assert.Nil(t, err)
+		}
+	}
+	if vulnerabilities := affectedBy(); assert.Len(t, vulnerabilities, 1) {
+		assert.Equal(t, "CVE-2024-0001", vulnerabilities[0].Name)
+	}
+}
+
+func TestNotificationRevisions(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	namespace := database.Namespace{Name: "debian:7", VersionFormat: dpkg.ParserName}
+	openssl := database.Feature{Name: "openssl", Namespace: namespace}
+	assert.Nil(t, datastore.InsertLayer(database.Layer{
+		Name:          "layer",
+		EngineVersion: 1,
+		Namespace:     &namespace,
+		Features:      []database.FeatureVersion{{Feature: openssl, Version: "1.5"}},
+	}))
+
+	// The first revision doesn't affect the layer, the second one does.
+	vulnerability := database.Vulnerability{
+		Name:      "CVE-OPENSSL-1-DEB7",
+		Namespace: namespace,
+		Severity:  types.Low,
+		FixedIn:   []database.FeatureVersion{{Feature: openssl, Version: "1.0"}},
+	}
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, false))
+	vulnerability.Severity = types.High
+	vulnerability.FixedIn[0].Version = "2.0"
+	assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true))
+
+	available, err := datastore.GetAvailableNotification(time.Hour, "test", time.Minute)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, types.High, available.Priority)
+	notification, _, err := datastore.GetNotification(available.Name, 10, database.VulnerabilityNotificationFirstPage)
+	if assert.Nil(t, err) && assert.NotNil(t, notification.OldVulnerability) && assert.NotNil(t, notification.NewVulnerability) {
+		assert.Equal(t, types.Low, notification.OldVulnerability.Severity)
+		if assert.Len(t, notification.OldVulnerability.FixedIn, 1) {
+			assert.Equal(t, "1.0", notification.OldVulnerability.FixedIn[0].Version)
+		}
+		assert.Empty(t, notification.OldVulnerability.LayersIntroducingVulnerability)
+
+		if assert.Len(t, notification.NewVulnerability.FixedIn, 1) {
+			assert.Equal(t, "2.0", notification.NewVulnerability.FixedIn[0].Version)
+		}
+		if assert.Len(t, notification.NewVulnerability.LayersIntroducingVulnerability, 1) {
+			assert.Equal(t, "layer", notification.NewVulnerability.LayersIntroducingVulnerability[0].Name)
+		}
+	}
+
+	// Pruning the namespace removes its notifications.
+	assert.Nil(t, datastore.DeleteLayer("layer"))
+	_, err = datastore.PruneNamespace(namespace.Name)
+	assert.Nil(t, err)
+	_, _, err = datastore.GetNotification(available.Name, 10, database.VulnerabilityNotificationFirstPage)
+	assert.Equal(t, cerrors.ErrNotFound, err)
+}
+
+func TestNotificationDelivery(t *testing.T) {
+	datastore := openDatabaseForTest(t)
+	defer datastore.Close()
+
+	// Create a notification.
+	vulnerability := database.Vulnerability{Name: "CVE-NOTIFIED", Namespace: database.Namespace{Name: "debian:7"}, Severity: types.High}
+	if !assert.Nil(t, datastore.InsertVulnerabilities([]database.Vulnerability{vulnerability}, true)) {
+		return
+	}
+	notification, err := datastore.GetAvailableNotification(time.Second, "test", time.Minute)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Create the delivery, it must be found again with the same key.
+	delivery, err := datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.NotEmpty(t, delivery.Key)
+		assert.True(t, delivery.Delivered.IsZero())
+	}
+	sameDelivery, err := datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.Equal(t, delivery.ID, sameDelivery.ID)
+		assert.Equal(t, delivery.Key, sameDelivery.Key)
+	}
+	_, err = datastore.InsertNotificationDelivery("unknown", "TestNotifier")
+	assert.Equal(t, cerrors.ErrNotFound, err)
+
+	// Record a failed attempt and a successful one.
+	assert.Nil(t, datastore.InsertNotificationDeliveryAttempt(delivery, false, "connection refused"))
+	assert.Nil(t, datastore.InsertNotificationDeliveryAttempt(delivery, true, ""))
+
+	deliveries, err := datastore.ListNotificationDeliveries(notification.Name)
+	if assert.Nil(t, err) && assert.Len(t, deliveries, 1) {
+		assert.Equal(t, "TestNotifier", deliveries[0].Notifier)
+		assert.False(t, deliveries[0].Delivered.IsZero())
+		if assert.Len(t, deliveries[0].Attempts, 2) {
+			assert.False(t, deliveries[0].Attempts[0].Succeeded)
+			assert.Equal(t, "connection refused", deliveries[0].Attempts[0].Error)
+			assert.True(t, deliveries[0].Attempts[1].Succeeded)
+		}
+	}
+
+	// Once delivered, the delivery must not be reopened until the notification is sent again.
+	delivery, err = datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.False(t, delivery.Delivered.IsZero())
+	}
+
+	// Sending the notification again reopens the delivery with a new key.
+	assert.Nil(t, datastore.SetNotificationNotified(notification.Name))
+	delivery, err = datastore.InsertNotificationDelivery(notification.Name, "TestNotifier")
+	if assert.Nil(t, err) {
+		assert.True(t, delivery.Delivered.IsZero())
+		assert.NotEqual(t, sameDelivery.Key, delivery.Key)
+	}
+
+	// The notification is notified but its delivery is open.
+	notifications, err := datastore.ListUndeliveredNotifications("TestNotifier")
+	if assert.Nil(t, err) && assert.Len(t, notifications, 1) {
+		assert.Equal(t, notification.Name, notifications[0].Name)
+		assert.Equal(t, types.High, notifications[0].Priority)
+	}
+	assert.Nil(t, datastore.InsertNotificationDeliveryAttempt(delivery, true, ""))
+	notifications, err = datastore.ListUndeliveredNotifications("TestNotifier")
+	assert.Nil(t, err)
+	assert.Len(t, notifications, 0)
+}
@@ -0,0 +1,462 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/tracing"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// streamVulnerabilitiesPage is the number of vulnerabilities that StreamVulnerabilities reads at
+// once.
+const streamVulnerabilitiesPage = 500
+
+func (db *sqlite) ListVulnerabilities(namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
+	return listVulnerabilities(db, searchVulnerabilityBase, namespaceName, limit, startID)
+}
+
+// StreamVulnerabilities reads every Vulnerability of the Namespace in a single transaction before
+// calling fn, as holding the only connection to the database while fn runs would block every
+// other request.
+func (db *sqlite) StreamVulnerabilities(namespaceName string, fn func(database.Vulnerability) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return handleError("StreamVulnerabilities.Begin()", err)
+	}
+
+	var vulnerabilities []database.Vulnerability
+	for startID := 0; startID != -1; {
+		var page []database.Vulnerability
+		page, startID, err = listVulnerabilities(tx, searchVulnerabilityBase, namespaceName, streamVulnerabilitiesPage, startID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for i := range page {
+			if err = loadVulnerabilityFixedIn(tx, searchVulnerabilityFixedIn, &page[i]); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		vulnerabilities = append(vulnerabilities, page...)
+	}
+	tx.Rollback()
+
+	for _, vulnerability := range vulnerabilities {
+		if err = fn(vulnerability); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listVulnerabilities returns a page of the vulnerabilities of a Namespace, read with the given
+// base query from either the current or the archived vulnerabilities.
+func listVulnerabilities(q queryer, baseQuery, namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
+	// Query Namespace.
+	var id int
+	err := q.QueryRow(searchNamespace, namespaceName).Scan(&id)
+	if err != nil {
+		return nil, -1, handleError("searchNamespace", err)
+	}
+
+	// Query.
+	query := baseQuery + searchVulnerabilityByNamespace
+	rows, err := q.Query(query, namespaceName, startID, limit+1)
+	if err != nil {
+		return nil, -1, handleError("searchVulnerabilityByNamespace", err)
+	}
+	defer rows.Close()
+
+	var vulns []database.Vulnerability
+	nextID := -1
+	size := 0
+	// Scan query.
+	for rows.Next() {
+		var vulnerability database.Vulnerability
+
+		err := rows.Scan(
+			&vulnerability.ID,
+			&vulnerability.Name,
+			&vulnerability.Namespace.ID,
+			&vulnerability.Namespace.Name,
+			&vulnerability.Namespace.VersionFormat,
+			&vulnerability.Description,
+			&vulnerability.Link,
+			&vulnerability.Severity,
+			&vulnerability.Metadata,
+			&vulnerability.Sources,
+			&vulnerability.CVSS,
+		)
+		if err != nil {
+			return nil, -1, handleError("searchVulnerabilityByNamespace.Scan()", err)
+		}
+		size++
+		if size > limit {
+			nextID = vulnerability.ID
+		} else {
+			vulns = append(vulns, vulnerability)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, -1, handleError("searchVulnerabilityByNamespace.Rows()", err)
+	}
+
+	return vulns, nextID, nil
+}
+
+func (db *sqlite) FindVulnerability(namespaceName, name string) (database.Vulnerability, error) {
+	return findVulnerability(db, namespaceName, name)
+}
+
+func findVulnerability(q queryer, namespaceName, name string) (database.Vulnerability, error) {
+	return searchVulnerability(q, searchVulnerabilityBase, searchVulnerabilityFixedIn, namespaceName, name)
+}
+
+// searchVulnerability returns a Vulnerability along with its FixedIn list, read with the given
+// queries from either the current or the archived vulnerabilities.
+func searchVulnerability(q queryer, baseQuery, fixedInQuery, namespaceName, name string) (database.Vulnerability, error) {
+	var vulnerability database.Vulnerability
+
+	err := q.QueryRow(baseQuery+searchVulnerabilityByNamespaceAndName, namespaceName, name).Scan(
+		&vulnerability.ID,
+		&vulnerability.Name,
+		&vulnerability.Namespace.ID,
+		&vulnerability.Namespace.Name,
+		&vulnerability.Namespace.VersionFormat,
+		&vulnerability.Description,
+		&vulnerability.Link,
+		&vulnerability.Severity,
+		&vulnerability.Metadata,
+		&vulnerability.Sources,
+		&vulnerability.CVSS,
+	)
+	if err != nil {
+		return vulnerability, handleError("searchVulnerabilityByNamespaceAndName.Scan()", err)
+	}
+
+	err = loadVulnerabilityFixedIn(q, fixedInQuery, &vulnerability)
+	return vulnerability, err
+}
+
+// loadVulnerabilityFixedIn fills the FixedIn list of the given Vulnerability with the given query.
+func loadVulnerabilityFixedIn(q queryer, query string, vulnerability *database.Vulnerability) error {
+	rows, err := q.Query(query, vulnerability.ID)
+	if err != nil {
+		return handleError("searchVulnerabilityFixedIn", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version, featureName string
+		var featureID int
+
+		if err := rows.Scan(&version, &featureID, &featureName); err != nil {
+			return handleError("searchVulnerabilityFixedIn.Scan()", err)
+		}
+
+		// Note that the ID we fill in featureVersion is actually a Feature ID, and not
+		// a FeatureVersion ID.
+		vulnerability.FixedIn = append(vulnerability.FixedIn, database.FeatureVersion{
+			Model: database.Model{ID: featureID},
+			Feature: database.Feature{
+				Model:     database.Model{ID: featureID},
+				Namespace: vulnerability.Namespace,
+				Name:      featureName,
+			},
+			Version: version,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return handleError("searchVulnerabilityFixedIn.Rows()", err)
+	}
+
+	return nil
+}
+
+// InsertVulnerabilities inserts or updates the given Vulnerabilities, and creates a notification
+// for each change if generateNotifications is true.
+func (db *sqlite) InsertVulnerabilities(vulnerabilities []database.Vulnerability, generateNotifications bool) error {
+	for _, vulnerability := range vulnerabilities {
+		if err := db.insertVulnerability(vulnerability, false, generateNotifications); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *sqlite) insertVulnerability(vulnerability database.Vulnerability, onlyFixedIn, generateNotification bool) error {
+	// Verify parameters
+	if vulnerability.Name == "" || vulnerability.Namespace.Name == "" {
+		return cerrors.NewBadRequestError("insertVulnerability needs at least the Name and the Namespace")
+	}
+	if !onlyFixedIn && !vulnerability.Severity.IsValid() {
+		msg := fmt.Sprintf("could not insert a vulnerability that has an invalid Severity: %s", vulnerability.Severity)
+		log.Warning(msg)
+		return cerrors.NewBadRequestError(msg)
+	}
+	for i := 0; i < len(vulnerability.FixedIn); i++ {
+		fifv := &vulnerability.FixedIn[i]
+
+		if fifv.Feature.Namespace.Name == "" {
+			// As there is no Namespace on that FixedIn FeatureVersion, set it to the Vulnerability's
+			// Namespace.
+			fifv.Feature.Namespace.Name = vulnerability.Namespace.Name
+		} else if fifv.Feature.Namespace.Name != vulnerability.Namespace.Name {
+			msg := "could not insert an invalid vulnerability that contains FixedIn FeatureVersion that are not in the same namespace as the Vulnerability"
+			log.Warning(msg)
+			return cerrors.NewBadRequestError(msg)
+		}
+	}
+
+	// Begin transaction.
+	tx, err := db.Begin()
+	if err != nil {
+		return handleError("insertVulnerability.Begin()", err)
+	}
+
+	// Find existing vulnerability and its Vulnerability_FixedIn_Features.
+	existingVulnerability, err := findVulnerability(tx, vulnerability.Namespace.Name, vulnerability.Name)
+	if err != nil && err != cerrors.ErrNotFound {
+		tx.Rollback()
+		return err
+	}
+
+	if onlyFixedIn {
+		// Because this call tries to update FixedIn FeatureVersion, import all other data from the
+		// existing one.
+		if existingVulnerability.ID == 0 {
+			tx.Rollback()
+			return cerrors.ErrNotFound
+		}
+
+		fixedIn := vulnerability.FixedIn
+		vulnerability = existingVulnerability
+		vulnerability.FixedIn = fixedIn
+	}
+
+	if existingVulnerability.ID != 0 {
+		updateMetadata := vulnerability.Description != existingVulnerability.Description ||
+			vulnerability.Link != existingVulnerability.Link ||
+			vulnerability.Severity != existingVulnerability.Severity ||
+			!reflect.DeepEqual(castMetadata(vulnerability.Metadata), existingVulnerability.Metadata) ||
+			!reflect.DeepEqual(vulnerability.Sources, existingVulnerability.Sources) ||
+			!reflect.DeepEqual(vulnerability.CVSS, existingVulnerability.CVSS)
+
+		// Construct the entire list of FixedIn FeatureVersion, by using the
+		// the FixedIn list of the old vulnerability.
+		var updateFixedIn bool
+		vulnerability.FixedIn, updateFixedIn = database.ApplyFixedInDiff(existingVulnerability.FixedIn, vulnerability.FixedIn)
+
+		if !updateMetadata && !updateFixedIn {
+			tx.Commit()
+			return nil
+		}
+
+		// Update the vulnerability in place: only the revisions that notifications reference are
+		// kept.
+		vulnerability.ID = existingVulnerability.ID
+		_, err = tx.Exec(
+			updateVulnerability,
+			vulnerability.Description,
+			vulnerability.Link,
+			&vulnerability.Severity,
+			&vulnerability.Metadata,
+			&vulnerability.Sources,
+			&vulnerability.CVSS,
+			vulnerability.ID,
+		)
+		if err != nil {
+			tx.Rollback()
+			return handleError("updateVulnerability", err)
+		}
+
+		_, err = tx.Exec(removeVulnerabilityFixedInFeature, vulnerability.ID)
+		if err != nil {
+			tx.Rollback()
+			return handleError("removeVulnerabilityFixedInFeature", err)
+		}
+	} else {
+		// The vulnerability is new, we don't want to have any types.MinVersion as they are only used
+		// for diffing existing vulnerabilities.
+		var fixedIn []database.FeatureVersion
+		for _, fv := range vulnerability.FixedIn {
+			if fv.Version != versionfmt.MinVersion {
+				fixedIn = append(fixedIn, fv)
+			}
+		}
+		vulnerability.FixedIn = fixedIn
+
+		// Find or insert Vulnerability's Namespace.
+		namespaceID, err := insertNamespace(tx, vulnerability.Namespace)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// Insert vulnerability.
+		r, err := tx.Exec(
+			insertVulnerability,
+			namespaceID,
+			vulnerability.Name,
+			vulnerability.Description,
+			vulnerability.Link,
+			&vulnerability.Severity,
+			&vulnerability.Metadata,
+			&vulnerability.Sources,
+			&vulnerability.CVSS,
+		)
+		if err != nil {
+			tx.Rollback()
+			return handleError("insertVulnerability", err)
+		}
+
+		id, err := r.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			return handleError("insertVulnerability.LastInsertId()", err)
+		}
+		vulnerability.ID = int(id)
+	}
+
+	// Insert Vulnerability_FixedIn_Feature.
+	if err = insertVulnerabilityFixedInFeatures(tx, vulnerability.ID, vulnerability.FixedIn); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Create a notification.
+	if generateNotification {
+		var oldVulnerability *database.Vulnerability
+		if existingVulnerability.ID != 0 {
+			oldVulnerability = &existingVulnerability
+		}
+		if err = createNotification(tx, oldVulnerability, &vulnerability); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Commit transaction.
+	if err = tx.Commit(); err != nil {
+		return handleError("insertVulnerability.Commit()", err)
+	}
+
+	return nil
+}
+
+// insertVulnerabilityFixedInFeatures populates Vulnerability_FixedIn_Feature for the given
+// vulnerability with the specified database.FeatureVersion list.
+func insertVulnerabilityFixedInFeatures(tx *tracing.Tx, vulnerabilityID int, fixedIn []database.FeatureVersion) error {
+	for _, fv := range fixedIn {
+		featureID, err := insertFeature(tx, fv.Feature)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(insertVulnerabilityFixedInFeature, vulnerabilityID, featureID, fv.Version)
+		if err != nil {
+			return handleError("insertVulnerabilityFixedInFeature", err)
+		}
+	}
+
+	return nil
+}
+
+// castMetadata marshals the given database.MetadataMap and unmarshals it again to make sure that
+// everything has the interface{} type.
+// It is required when comparing crafted MetadataMap against MetadataMap that we get from the
+// database.
+func castMetadata(m database.MetadataMap) database.MetadataMap {
+	c := make(database.MetadataMap)
+	j, _ := json.Marshal(m)
+	json.Unmarshal(j, &c)
+	return c
+}
+
+func (db *sqlite) InsertVulnerabilityFixes(vulnerabilityNamespace, vulnerabilityName string, fixes []database.FeatureVersion) error {
+	v := database.Vulnerability{
+		Name: vulnerabilityName,
+		Namespace: database.Namespace{
+			Name: vulnerabilityNamespace,
+		},
+		FixedIn: fixes,
+	}
+
+	return db.insertVulnerability(v, true, true)
+}
+
+func (db *sqlite) DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerabilityName, featureName string) error {
+	v := database.Vulnerability{
+		Name: vulnerabilityName,
+		Namespace: database.Namespace{
+			Name: vulnerabilityNamespace,
+		},
+		FixedIn: []database.FeatureVersion{
+			{
+				Feature: database.Feature{
+					Name: featureName,
+					Namespace: database.Namespace{
+						Name: vulnerabilityNamespace,
+					},
+				},
+				Version: versionfmt.MinVersion,
+			},
+		},
+	}
+
+	return db.insertVulnerability(v, true, true)
+}
+
+func (db *sqlite) DeleteVulnerability(namespaceName, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return handleError("DeleteVulnerability.Begin()", err)
+	}
+
+	vulnerability, err := findVulnerability(tx, namespaceName, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.Exec(removeVulnerability, vulnerability.ID); err != nil {
+		tx.Rollback()
+		return handleError("removeVulnerability", err)
+	}
+
+	// Create a notification holding the last revision of the vulnerability.
+	if err = createNotification(tx, &vulnerability, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return handleError("DeleteVulnerability.Commit()", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// ArchiveVulnerabilities moves the vulnerabilities of a Namespace and their FixedIn rows into the
+// archive tables, in a single transaction. Only the latest revision of every Vulnerability is
+// stored, so the previous revisions, which notifications reference, are removed along with their
+// notifications.
+func (db *sqlite) ArchiveVulnerabilities(namespaceName string) (int, error) {
+	if namespaceName == "" {
+		return 0, cerrors.NewBadRequestError("could not archive the vulnerabilities of an empty namespace")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, handleError("ArchiveVulnerabilities.Begin()", err)
+	}
+
+	var namespaceID int
+	if err = tx.QueryRow(searchNamespace, namespaceName).Scan(&namespaceID); err != nil {
+		tx.Rollback()
+		return 0, handleError("searchNamespace", err)
+	}
+
+	if _, err = tx.Exec(removeReplacedArchivedVulnerability, namespaceID); err != nil {
+		tx.Rollback()
+		return 0, handleError("removeReplacedArchivedVulnerability", err)
+	}
+
+	result, err := tx.Exec(archiveVulnerability, namespaceID)
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("archiveVulnerability", err)
+	}
+	archived, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("archiveVulnerability.RowsAffected()", err)
+	}
+
+	if _, err = tx.Exec(archiveVulnerabilityFixedInFeature, namespaceID); err != nil {
+		tx.Rollback()
+		return 0, handleError("archiveVulnerabilityFixedInFeature", err)
+	}
+
+	// Removing the vulnerabilities and their revisions cascades to their FixedIn lists and to the
+	// notifications.
+	if _, err = tx.Exec(pruneVulnerabilityRevision, namespaceID); err != nil {
+		tx.Rollback()
+		return 0, handleError("pruneVulnerabilityRevision", err)
+	}
+	if _, err = tx.Exec(pruneVulnerability, namespaceID); err != nil {
+		tx.Rollback()
+		return 0, handleError("pruneVulnerability", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, handleError("ArchiveVulnerabilities.Commit()", err)
+	}
+
+	return int(archived), nil
+}
+
+func (db *sqlite) ListArchivedVulnerabilities(namespaceName string, limit int, startID int) ([]database.Vulnerability, int, error) {
+	return listVulnerabilities(db, searchArchivedVulnerabilityBase, namespaceName, limit, startID)
+}
+
+func (db *sqlite) FindArchivedVulnerability(namespaceName, name string) (database.Vulnerability, error) {
+	return searchVulnerability(db, searchArchivedVulnerabilityBase, searchArchivedVulnerabilityFixedIn, namespaceName, name)
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil provides helpers to test any database.Datastore implementation: builders for
+// the models, deterministic fixtures and a disposable PostgreSQL server.
+package testutil
+
+import (
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/utils/types"
+)
+
+// Namespace returns a namespace whose versions are compared using dpkg.
+func Namespace(name string) database.Namespace {
+	return database.Namespace{Name: name, VersionFormat: dpkg.ParserName}
+}
+
+// FeatureVersion returns the version of the feature of the given namespace.
+func FeatureVersion(namespace database.Namespace, name, version string) database.FeatureVersion {
+	return database.FeatureVersion{
+		Feature: database.Feature{Name: name, Namespace: namespace},
+		Version: version,
+	}
+}
+
+// Layer returns a layer, optionally detected in the given namespace, that contains the given
+// features in addition to the ones of its parent.
+func Layer(name string, parent *database.Layer, namespace *database.Namespace, features ...database.FeatureVersion) database.Layer {
+	layer := database.Layer{
+		Name:          name,
+		EngineVersion: 1,
+		Parent:        parent,
+		Namespace:     namespace,
+	}
+	if parent != nil {
+		layer.Features = append(layer.Features, parent.Features...)
+		if namespace == nil {
+			layer.Namespace = parent.Namespace
+		}
+	}
+	layer.Features = append(layer.Features, features...)
+	return layer
+}
+
+// Vulnerability returns a vulnerability of the given namespace, fixed in the given features.
+//
+// Its description and link are derived from its name so two calls with the same arguments return
+// equal vulnerabilities.
+func Vulnerability(namespace database.Namespace, name string, severity types.Priority, fixedIn ...database.FeatureVersion) database.Vulnerability {
+	return database.Vulnerability{
+		Name:        name,
+		Namespace:   namespace,
+		Description: "Description of " + name,
+		Link:        "https://example.com/vulnerabilities/" + name,
+		Severity:    severity,
+		FixedIn:     fixedIn,
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build chaos
+// +build chaos
+
+package testutil
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+// The "chaos" driver injects faults into another driver, configured by its options, e.g. to run
+// integration tests against a slow or failing database. It is only built with the "chaos" tag.
+func init() {
+	database.Register("chaos", openChaosDatabase)
+}
+
+// chaosConfig is the configuration of the "chaos" driver: the faults, and the driver they're
+// injected into along with its options.
+type chaosConfig struct {
+	Faults  `yaml:",inline"`
+	Driver  string
+	Options map[string]interface{}
+}
+
+func openChaosDatabase(registrableComponentConfig config.RegistrableComponentConfig) (database.Datastore, error) {
+	var cfg chaosConfig
+	bytes, err := yaml.Marshal(registrableComponentConfig.Options)
+	if err != nil {
+		return nil, fmt.Errorf("chaos: could not load configuration: %v", err)
+	}
+	if err := yaml.Unmarshal(bytes, &cfg); err != nil {
+		return nil, fmt.Errorf("chaos: could not load configuration: %v", err)
+	}
+	if cfg.Driver == "" || cfg.Driver == "chaos" {
+		return nil, fmt.Errorf("chaos: invalid driver %q", cfg.Driver)
+	}
+
+	datastore, err := database.Open(config.RegistrableComponentConfig{Type: cfg.Driver, Options: cfg.Options})
+	if err != nil {
+		return nil, err
+	}
+	return InjectFaults(datastore, cfg.Faults), nil
+}
@@ -0,0 +1,486 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/database"
+)
+
+// ErrInjected is returned by the calls that a FaultyDatastore fails.
+var ErrInjected = errors.New("testutil: injected datastore error")
+
+// Faults are the latency and errors that a FaultyDatastore injects into the calls to its methods,
+// to test how their callers handle a slow or failing database, e.g. the timeouts of the API or
+// the retries of the notifier.
+type Faults struct {
+	// Latency delays every call, plus a random duration up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// ErrorRate is the probability, between 0 and 1, that a call fails with ErrInjected without
+	// reaching the datastore. The locks fail to be acquired instead.
+	ErrorRate float64
+
+	// Methods restricts the faults to the given methods, e.g. "FindLayer". Every method is
+	// affected if it is empty.
+	Methods []string
+}
+
+// FaultyDatastore is a database.Datastore injecting faults into the calls to another one.
+type FaultyDatastore struct {
+	database.Datastore
+	*injector
+}
+
+// injector holds the faults, which the datastores returned by WithContext share.
+type injector struct {
+	mu     sync.Mutex
+	faults Faults
+	rand   *rand.Rand
+}
+
+// InjectFaults returns a FaultyDatastore injecting the given faults into the calls to the
+// methods of the given datastore.
+func InjectFaults(datastore database.Datastore, faults Faults) *FaultyDatastore {
+	return &FaultyDatastore{
+		Datastore: datastore,
+		injector: &injector{
+			faults: faults,
+			rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		},
+	}
+}
+
+// SetFaults replaces the faults injected into the subsequent calls, e.g. to test the recovery of
+// the callers once the datastore is healthy again.
+func (ds *FaultyDatastore) SetFaults(faults Faults) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.faults = faults
+}
+
+// inject delays a call to the given method and returns ErrInjected if it must fail.
+func (ds *FaultyDatastore) inject(method string) error {
+	ds.mu.Lock()
+	faults := ds.faults
+	affected := len(faults.Methods) == 0
+	for _, m := range faults.Methods {
+		if m == method {
+			affected = true
+			break
+		}
+	}
+	var delay time.Duration
+	var fail bool
+	if affected {
+		delay = faults.Latency
+		if faults.Jitter > 0 {
+			delay += time.Duration(ds.rand.Int63n(int64(faults.Jitter)))
+		}
+		fail = faults.ErrorRate > 0 && ds.rand.Float64() < faults.ErrorRate
+	}
+	ds.mu.Unlock()
+
+	time.Sleep(delay)
+	if fail {
+		return ErrInjected
+	}
+	return nil
+}
+
+func (ds *FaultyDatastore) Lock(name string, owner string, duration time.Duration, renew bool) (bool, time.Time) {
+	if err := ds.inject("Lock"); err != nil {
+		return false, time.Time{}
+	}
+	return ds.Datastore.Lock(name, owner, duration, renew)
+}
+
+func (ds *FaultyDatastore) ListNamespaces() (_ []database.Namespace, err error) {
+	if err = ds.inject("ListNamespaces"); err != nil {
+		return
+	}
+	return ds.Datastore.ListNamespaces()
+}
+
+func (ds *FaultyDatastore) InsertLayer(layer database.Layer) (err error) {
+	if err = ds.inject("InsertLayer"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertLayer(layer)
+}
+
+func (ds *FaultyDatastore) FindLayer(name string, withFeatures, withVulnerabilities bool) (_ database.Layer, err error) {
+	if err = ds.inject("FindLayer"); err != nil {
+		return
+	}
+	return ds.Datastore.FindLayer(name, withFeatures, withVulnerabilities)
+}
+
+func (ds *FaultyDatastore) DeleteLayer(name string) (err error) {
+	if err = ds.inject("DeleteLayer"); err != nil {
+		return
+	}
+	return ds.Datastore.DeleteLayer(name)
+}
+
+func (ds *FaultyDatastore) ListVulnerabilities(namespaceName string, limit int, page int) (_ []database.Vulnerability, _ int, err error) {
+	if err = ds.inject("ListVulnerabilities"); err != nil {
+		return
+	}
+	return ds.Datastore.ListVulnerabilities(namespaceName, limit, page)
+}
+
+func (ds *FaultyDatastore) StreamVulnerabilities(namespaceName string, fn func(database.Vulnerability) error) error {
+	if err := ds.inject("StreamVulnerabilities"); err != nil {
+		return err
+	}
+	return ds.Datastore.StreamVulnerabilities(namespaceName, fn)
+}
+
+func (ds *FaultyDatastore) InsertVulnerabilities(vulnerabilities []database.Vulnerability, createNotification bool) (err error) {
+	if err = ds.inject("InsertVulnerabilities"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertVulnerabilities(vulnerabilities, createNotification)
+}
+
+func (ds *FaultyDatastore) FindVulnerability(namespaceName, name string) (_ database.Vulnerability, err error) {
+	if err = ds.inject("FindVulnerability"); err != nil {
+		return
+	}
+	return ds.Datastore.FindVulnerability(namespaceName, name)
+}
+
+func (ds *FaultyDatastore) DeleteVulnerability(namespaceName, name string) (err error) {
+	if err = ds.inject("DeleteVulnerability"); err != nil {
+		return
+	}
+	return ds.Datastore.DeleteVulnerability(namespaceName, name)
+}
+
+func (ds *FaultyDatastore) InsertVulnerabilityFixes(vulnerabilityNamespace, vulnerabilityName string, fixes []database.FeatureVersion) (err error) {
+	if err = ds.inject("InsertVulnerabilityFixes"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertVulnerabilityFixes(vulnerabilityNamespace, vulnerabilityName, fixes)
+}
+
+func (ds *FaultyDatastore) DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerabilityName, featureName string) (err error) {
+	if err = ds.inject("DeleteVulnerabilityFix"); err != nil {
+		return
+	}
+	return ds.Datastore.DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerabilityName, featureName)
+}
+
+func (ds *FaultyDatastore) ArchiveVulnerabilities(namespaceName string) (_ int, err error) {
+	if err = ds.inject("ArchiveVulnerabilities"); err != nil {
+		return
+	}
+	return ds.Datastore.ArchiveVulnerabilities(namespaceName)
+}
+
+func (ds *FaultyDatastore) ListArchivedVulnerabilities(namespaceName string, limit int, page int) (_ []database.Vulnerability, _ int, err error) {
+	if err = ds.inject("ListArchivedVulnerabilities"); err != nil {
+		return
+	}
+	return ds.Datastore.ListArchivedVulnerabilities(namespaceName, limit, page)
+}
+
+func (ds *FaultyDatastore) FindArchivedVulnerability(namespaceName, name string) (_ database.Vulnerability, err error) {
+	if err = ds.inject("FindArchivedVulnerability"); err != nil {
+		return
+	}
+	return ds.Datastore.FindArchivedVulnerability(namespaceName, name)
+}
+
+func (ds *FaultyDatastore) ListUnusedNamespaces() (_ []database.Namespace, err error) {
+	if err = ds.inject("ListUnusedNamespaces"); err != nil {
+		return
+	}
+	return ds.Datastore.ListUnusedNamespaces()
+}
+
+func (ds *FaultyDatastore) PruneNamespace(name string) (_ database.PrunedNamespace, err error) {
+	if err = ds.inject("PruneNamespace"); err != nil {
+		return
+	}
+	return ds.Datastore.PruneNamespace(name)
+}
+
+func (ds *FaultyDatastore) GetAvailableNotification(renotifyInterval time.Duration, owner string, lockDuration time.Duration) (_ database.VulnerabilityNotification, err error) {
+	if err = ds.inject("GetAvailableNotification"); err != nil {
+		return
+	}
+	return ds.Datastore.GetAvailableNotification(renotifyInterval, owner, lockDuration)
+}
+
+func (ds *FaultyDatastore) ExtendNotificationLock(name, owner string, duration time.Duration) (bool, time.Time) {
+	if err := ds.inject("ExtendNotificationLock"); err != nil {
+		return false, time.Time{}
+	}
+	return ds.Datastore.ExtendNotificationLock(name, owner, duration)
+}
+
+func (ds *FaultyDatastore) ReleaseNotificationLock(name, owner string) {
+	ds.inject("ReleaseNotificationLock")
+	ds.Datastore.ReleaseNotificationLock(name, owner)
+}
+
+func (ds *FaultyDatastore) GetNotification(name string, limit int, page database.VulnerabilityNotificationPageNumber) (_ database.VulnerabilityNotification, _ database.VulnerabilityNotificationPageNumber, err error) {
+	if err = ds.inject("GetNotification"); err != nil {
+		return
+	}
+	return ds.Datastore.GetNotification(name, limit, page)
+}
+
+func (ds *FaultyDatastore) SetNotificationNotified(name string) (err error) {
+	if err = ds.inject("SetNotificationNotified"); err != nil {
+		return
+	}
+	return ds.Datastore.SetNotificationNotified(name)
+}
+
+func (ds *FaultyDatastore) SetNotificationFailed(name string) (err error) {
+	if err = ds.inject("SetNotificationFailed"); err != nil {
+		return
+	}
+	return ds.Datastore.SetNotificationFailed(name)
+}
+
+func (ds *FaultyDatastore) DeleteNotification(name string) (err error) {
+	if err = ds.inject("DeleteNotification"); err != nil {
+		return
+	}
+	return ds.Datastore.DeleteNotification(name)
+}
+
+func (ds *FaultyDatastore) InsertNotificationDelivery(notificationName, notifier string) (_ database.NotificationDelivery, err error) {
+	if err = ds.inject("InsertNotificationDelivery"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertNotificationDelivery(notificationName, notifier)
+}
+
+func (ds *FaultyDatastore) InsertNotificationDeliveryAttempt(delivery database.NotificationDelivery, succeeded bool, message string) (err error) {
+	if err = ds.inject("InsertNotificationDeliveryAttempt"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertNotificationDeliveryAttempt(delivery, succeeded, message)
+}
+
+func (ds *FaultyDatastore) ListNotificationDeliveries(notificationName string) (_ []database.NotificationDelivery, err error) {
+	if err = ds.inject("ListNotificationDeliveries"); err != nil {
+		return
+	}
+	return ds.Datastore.ListNotificationDeliveries(notificationName)
+}
+
+func (ds *FaultyDatastore) ListUndeliveredNotifications(notifier string) (_ []database.VulnerabilityNotification, err error) {
+	if err = ds.inject("ListUndeliveredNotifications"); err != nil {
+		return
+	}
+	return ds.Datastore.ListUndeliveredNotifications(notifier)
+}
+
+func (ds *FaultyDatastore) InsertFalsePositive(falsePositive database.FalsePositive) (_ database.FalsePositive, err error) {
+	if err = ds.inject("InsertFalsePositive"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertFalsePositive(falsePositive)
+}
+
+func (ds *FaultyDatastore) FindFalsePositives(vulnerabilities []database.Vulnerability) (_ []database.FalsePositive, err error) {
+	if err = ds.inject("FindFalsePositives"); err != nil {
+		return
+	}
+	return ds.Datastore.FindFalsePositives(vulnerabilities)
+}
+
+func (ds *FaultyDatastore) ListFalsePositives(limit int, page int) (_ []database.FalsePositive, _ int, err error) {
+	if err = ds.inject("ListFalsePositives"); err != nil {
+		return
+	}
+	return ds.Datastore.ListFalsePositives(limit, page)
+}
+
+func (ds *FaultyDatastore) DeleteFalsePositive(name string) (err error) {
+	if err = ds.inject("DeleteFalsePositive"); err != nil {
+		return
+	}
+	return ds.Datastore.DeleteFalsePositive(name)
+}
+
+func (ds *FaultyDatastore) InsertWatchedTag(watchedTag database.WatchedTag) (_ database.WatchedTag, err error) {
+	if err = ds.inject("InsertWatchedTag"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertWatchedTag(watchedTag)
+}
+
+func (ds *FaultyDatastore) FindWatchedTag(name string) (_ database.WatchedTag, err error) {
+	if err = ds.inject("FindWatchedTag"); err != nil {
+		return
+	}
+	return ds.Datastore.FindWatchedTag(name)
+}
+
+func (ds *FaultyDatastore) ListWatchedTags(limit int, page int) (_ []database.WatchedTag, _ int, err error) {
+	if err = ds.inject("ListWatchedTags"); err != nil {
+		return
+	}
+	return ds.Datastore.ListWatchedTags(limit, page)
+}
+
+func (ds *FaultyDatastore) UpdateWatchedTag(watchedTag database.WatchedTag) (err error) {
+	if err = ds.inject("UpdateWatchedTag"); err != nil {
+		return
+	}
+	return ds.Datastore.UpdateWatchedTag(watchedTag)
+}
+
+func (ds *FaultyDatastore) DeleteWatchedTag(name string) (err error) {
+	if err = ds.inject("DeleteWatchedTag"); err != nil {
+		return
+	}
+	return ds.Datastore.DeleteWatchedTag(name)
+}
+
+func (ds *FaultyDatastore) ListMovedWatchedTags(limit int, page int) (_ []database.WatchedTag, _ int, err error) {
+	if err = ds.inject("ListMovedWatchedTags"); err != nil {
+		return
+	}
+	return ds.Datastore.ListMovedWatchedTags(limit, page)
+}
+
+func (ds *FaultyDatastore) MarkWatchedTagReported(name, digest string) (err error) {
+	if err = ds.inject("MarkWatchedTagReported"); err != nil {
+		return
+	}
+	return ds.Datastore.MarkWatchedTagReported(name, digest)
+}
+
+func (ds *FaultyDatastore) InsertLayerLabels(name string, labels map[string]string) (err error) {
+	if err = ds.inject("InsertLayerLabels"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertLayerLabels(name, labels)
+}
+
+func (ds *FaultyDatastore) ListLayers(labels map[string]string, limit int, page int) (_ []database.Layer, _ int, err error) {
+	if err = ds.inject("ListLayers"); err != nil {
+		return
+	}
+	return ds.Datastore.ListLayers(labels, limit, page)
+}
+
+func (ds *FaultyDatastore) ListNotificationLabels(name string) (_ []map[string]string, err error) {
+	if err = ds.inject("ListNotificationLabels"); err != nil {
+		return
+	}
+	return ds.Datastore.ListNotificationLabels(name)
+}
+
+func (ds *FaultyDatastore) ListNotificationWatchedTags(name string) (_ []database.WatchedTag, err error) {
+	if err = ds.inject("ListNotificationWatchedTags"); err != nil {
+		return
+	}
+	return ds.Datastore.ListNotificationWatchedTags(name)
+}
+
+func (ds *FaultyDatastore) InsertProvenance(provenance database.Provenance) (_ database.Provenance, err error) {
+	if err = ds.inject("InsertProvenance"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertProvenance(provenance)
+}
+
+func (ds *FaultyDatastore) FindProvenances(digest string) (_ []database.Provenance, err error) {
+	if err = ds.inject("FindProvenances"); err != nil {
+		return
+	}
+	return ds.Datastore.FindProvenances(digest)
+}
+
+func (ds *FaultyDatastore) InsertImage(image database.Image) (err error) {
+	if err = ds.inject("InsertImage"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertImage(image)
+}
+
+func (ds *FaultyDatastore) FindImage(digest string) (_ database.Image, err error) {
+	if err = ds.inject("FindImage"); err != nil {
+		return
+	}
+	return ds.Datastore.FindImage(digest)
+}
+
+func (ds *FaultyDatastore) InsertLayerAnalysis(analysis database.LayerAnalysis) (err error) {
+	if err = ds.inject("InsertLayerAnalysis"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertLayerAnalysis(analysis)
+}
+
+func (ds *FaultyDatastore) FindLayerAnalysis(digest string) (_ database.LayerAnalysis, err error) {
+	if err = ds.inject("FindLayerAnalysis"); err != nil {
+		return
+	}
+	return ds.Datastore.FindLayerAnalysis(digest)
+}
+
+func (ds *FaultyDatastore) InsertKeyValue(key, value string) (err error) {
+	if err = ds.inject("InsertKeyValue"); err != nil {
+		return
+	}
+	return ds.Datastore.InsertKeyValue(key, value)
+}
+
+func (ds *FaultyDatastore) GetKeyValue(key string) (_ string, err error) {
+	if err = ds.inject("GetKeyValue"); err != nil {
+		return
+	}
+	return ds.Datastore.GetKeyValue(key)
+}
+
+func (ds *FaultyDatastore) Unlock(name, owner string) {
+	ds.inject("Unlock")
+	ds.Datastore.Unlock(name, owner)
+}
+
+func (ds *FaultyDatastore) FindLock(name string) (_ string, _ time.Time, err error) {
+	if err = ds.inject("FindLock"); err != nil {
+		return
+	}
+	return ds.Datastore.FindLock(name)
+}
+
+func (ds *FaultyDatastore) WithContext(ctx context.Context) database.Datastore {
+	return &FaultyDatastore{Datastore: ds.Datastore.WithContext(ctx), injector: ds.injector}
+}
+
+func (ds *FaultyDatastore) Health(ctx context.Context) (_ database.HealthStatus, err error) {
+	if err = ds.inject("Health"); err != nil {
+		return
+	}
+	return ds.Datastore.Health(ctx)
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/database/testutil"
+)
+
+func TestInjectFaults(t *testing.T) {
+	datastore := testutil.InjectFaults(&database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{Name: name}, nil
+		},
+		FctListNamespaces: func() ([]database.Namespace, error) {
+			return []database.Namespace{{Name: "debian:8"}}, nil
+		},
+		FctLock: func(name string, owner string, duration time.Duration, renew bool) (bool, time.Time) {
+			return true, time.Now().Add(duration)
+		},
+	}, testutil.Faults{ErrorRate: 1, Methods: []string{"FindLayer", "Lock"}})
+
+	// Only the given methods fail.
+	_, err := datastore.FindLayer("layer", false, false)
+	assert.Equal(t, testutil.ErrInjected, err)
+	locked, _ := datastore.Lock("updater", "owner", time.Minute, false)
+	assert.False(t, locked)
+	namespaces, err := datastore.ListNamespaces()
+	assert.Nil(t, err)
+	assert.Len(t, namespaces, 1)
+
+	// Every method is delayed, and the datastore recovers once the faults are removed.
+	datastore.SetFaults(testutil.Faults{Latency: 20 * time.Millisecond})
+	start := time.Now()
+	layer, err := datastore.FindLayer("layer", false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "layer", layer.Name)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"testing"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/utils/types"
+)
+
+// Fixture is a set of layers and vulnerabilities loaded through the database.Datastore interface,
+// so every driver can be brought to the same state.
+type Fixture struct {
+	// Layers are inserted in order, hence parents must come before their children.
+	Layers          []database.Layer
+	Vulnerabilities []database.Vulnerability
+}
+
+// Load inserts the fixture into the datastore, without creating notifications.
+func (f Fixture) Load(datastore database.Datastore) error {
+	for _, layer := range f.Layers {
+		// Drivers expect parents to be retrieved from the datastore.
+		if layer.Parent != nil {
+			parent, err := datastore.FindLayer(layer.Parent.Name, false, false)
+			if err != nil {
+				return err
+			}
+			layer.Parent = &parent
+		}
+
+		if err := datastore.InsertLayer(layer); err != nil {
+			return err
+		}
+		if len(layer.Labels) > 0 {
+			if err := datastore.InsertLayerLabels(layer.Name, layer.Labels); err != nil {
+				return err
+			}
+		}
+	}
+	if len(f.Vulnerabilities) > 0 {
+		return datastore.InsertVulnerabilities(f.Vulnerabilities, false)
+	}
+	return nil
+}
+
+// DefaultFixture returns a small Debian layer tree along with vulnerabilities that affect it:
+//
+//	layer-0 (debian:7): wechat 0.5, openssl 1.0
+//	└── layer-1:        + nginx 1.0                                               team=web
+//	    └── layer-2:    + openssl 2.0 instead of 1.0, - the executable of wechat  team=web, env=prod
+//
+// CVE-OPENSSL-1-DEB7 is fixed in openssl 2.0 and CVE-NOPE is fixed in nginx 2.0, while
+// CVE-WECHAT is unfixed.
+func DefaultFixture() Fixture {
+	debian7 := Namespace("debian:7")
+	wechat := FeatureVersion(debian7, "wechat", "0.5")
+	openssl1 := FeatureVersion(debian7, "openssl", "1.0")
+	openssl2 := FeatureVersion(debian7, "openssl", "2.0")
+	nginx := FeatureVersion(debian7, "nginx", "1.0")
+	for _, fv := range []*database.FeatureVersion{&wechat, &openssl1, &openssl2, &nginx} {
+		fv.DetectedBy = "dpkg"
+		fv.State = database.InstalledState
+	}
+	nginx.State = "config-files"
+	wechat.Evidence = []string{"usr/bin/wechat"}
+	openssl2.Evidence = []string{"usr/bin/openssl", "usr/lib/libssl.so.2"}
+
+	layer0 := Layer("layer-0", nil, &debian7, wechat, openssl1)
+	layer1 := Layer("layer-1", &layer0, nil, nginx)
+	layer1.Labels = map[string]string{"team": "web"}
+	layer2 := Layer("layer-2", &layer1, nil)
+	layer2.Labels = map[string]string{"team": "web", "env": "prod"}
+	removedWechat := wechat
+	removedWechat.Evidence = []string{}
+	layer2.Features = []database.FeatureVersion{removedWechat, openssl2, nginx}
+
+	return Fixture{
+		Layers: []database.Layer{layer0, layer1, layer2},
+		Vulnerabilities: []database.Vulnerability{
+			Vulnerability(debian7, "CVE-OPENSSL-1-DEB7", types.High, openssl2),
+			Vulnerability(debian7, "CVE-NOPE", types.Medium, FeatureVersion(debian7, "nginx", "2.0")),
+			Vulnerability(debian7, "CVE-WECHAT", types.Low, FeatureVersion(debian7, "wechat", versionfmt.MaxVersion)),
+		},
+	}
+}
+
+// Harness opens datastores for tests.
+//
+// Rather than snapshotting and restoring the state of a datastore, which no driver exposes, every
+// test gets a fresh datastore into which the fixture is replayed: tests can't interfere with each
+// other and always start from the same state.
+type Harness struct {
+	// Open returns a new, empty datastore. Closing it must release everything it holds.
+	Open    func() (database.Datastore, error)
+	Fixture Fixture
+}
+
+// Datastore returns a fresh datastore loaded with the fixture. The test fails immediately if it
+// can't be opened or loaded.
+func (h Harness) Datastore(t *testing.T) database.Datastore {
+	datastore, err := h.Open()
+	if err != nil {
+		t.Fatalf("could not open datastore: %s", err)
+	}
+	if err := h.Fixture.Load(datastore); err != nil {
+		datastore.Close()
+		t.Fatalf("could not load fixture: %s", err)
+	}
+	return datastore
+}
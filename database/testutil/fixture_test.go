@@ -0,0 +1,76 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package testutil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	_ "github.com/coreos/clair/database/sqlite"
+	"github.com/coreos/clair/database/testutil"
+)
+
+func TestDefaultFixture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clair-testutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	harness := testutil.Harness{
+		Open: func() (database.Datastore, error) {
+			f, err := ioutil.TempFile(dir, "clair.db")
+			if err != nil {
+				return nil, err
+			}
+			f.Close()
+			return database.Open(config.RegistrableComponentConfig{
+				Type:    "sqlite",
+				Options: map[string]interface{}{"path": filepath.Join(dir, filepath.Base(f.Name()))},
+			})
+		},
+		Fixture: testutil.DefaultFixture(),
+	}
+
+	// Every datastore starts from the same state.
+	for i := 0; i < 2; i++ {
+		datastore := harness.Datastore(t)
+
+		layer, err := datastore.FindLayer("layer-2", true, true)
+		if assert.Nil(t, err) && assert.Len(t, layer.Features, 3) {
+			affectedBy := make(map[string][]string)
+			for _, featureVersion := range layer.Features {
+				for _, vulnerability := range featureVersion.AffectedBy {
+					affectedBy[featureVersion.Feature.Name] = append(affectedBy[featureVersion.Feature.Name], vulnerability.Name)
+				}
+			}
+			assert.Equal(t, map[string][]string{
+				"wechat": {"CVE-WECHAT"},
+				"nginx":  {"CVE-NOPE"},
+			}, affectedBy)
+		}
+
+		datastore.Close()
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	// Register the PostgreSQL driver used to wait for the server.
+	_ "github.com/lib/pq"
+)
+
+const (
+	// postgresImage is the Docker image of the disposable PostgreSQL servers.
+	postgresImage = "postgres:9.5"
+
+	// cockroachDBImage is the Docker image of the disposable CockroachDB clusters.
+	cockroachDBImage = "cockroachdb/cockroach:v23.1.11"
+
+	// postgresStartTimeout is how long to wait for a disposable server to accept connections.
+	postgresStartTimeout = 30 * time.Second
+)
+
+// Postgres is a disposable PostgreSQL server running in a Docker container, or a CockroachDB
+// cluster, which speaks the same protocol.
+type Postgres struct {
+	image       string
+	containerID string
+
+	// Source is the connection string of the server, with a %s verb in place of the database
+	// name, as expected by CLAIR_TEST_PGSQL.
+	Source string
+}
+
+// StartPostgres starts a disposable PostgreSQL server using the docker command and waits until it
+// accepts connections.
+func StartPostgres() (*Postgres, error) {
+	return startServer(postgresImage, "5432/tcp", "postgres")
+}
+
+// StartCockroachDB starts a disposable single-node CockroachDB cluster using the docker command and
+// waits until it accepts connections. The pgsql driver uses it in its CockroachDB compatibility
+// mode.
+func StartCockroachDB() (*Postgres, error) {
+	return startServer(cockroachDBImage, "26257/tcp", "root", "start-single-node", "--insecure")
+}
+
+// startServer runs the given image with the given arguments, connecting as user to the published
+// port.
+func startServer(image, port, user string, args ...string) (*Postgres, error) {
+	out, err := exec.Command("docker", append([]string{"run", "--detach", "--publish-all", image}, args...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not start %s: %s", image, err)
+	}
+	pg := &Postgres{image: image, containerID: strings.TrimSpace(string(out))}
+
+	out, err = exec.Command("docker", "port", pg.containerID, port).Output()
+	if err != nil {
+		pg.Stop()
+		return nil, fmt.Errorf("could not find the port of %s: %s", image, err)
+	}
+	// The output looks like "0.0.0.0:32768".
+	address := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	pg.Source = "postgresql://" + user + "@127.0.0.1:" + address[strings.LastIndex(address, ":")+1:] + "/%s?sslmode=disable"
+
+	if err := pg.wait(); err != nil {
+		pg.Stop()
+		return nil, err
+	}
+	return pg, nil
+}
+
+// wait blocks until the server accepts connections or postgresStartTimeout elapses.
+func (pg *Postgres) wait() error {
+	db, err := sql.Open("postgres", fmt.Sprintf(pg.Source, "postgres"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for deadline := time.Now().Add(postgresStartTimeout); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+		if err := db.Ping(); err == nil {
+			return nil
+		}
+	}
+	return errors.New("timed out waiting for " + pg.image + " to accept connections")
+}
+
+// Stop removes the server along with its data.
+func (pg *Postgres) Stop() error {
+	return exec.Command("docker", "rm", "--force", "--volumes", pg.containerID).Run()
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"reflect"
+	"sort"
+)
+
+// VulnerabilityDiff is the structured difference between the old and new revisions of a
+// Vulnerability that a VulnerabilityNotification announces, so that its consumers don't have to
+// compare them themselves.
+type VulnerabilityDiff struct {
+	// ChangedFields are the names of the fields of the Vulnerability whose value changed, among
+	// Description, Link, Severity, Metadata, Sources and CVSS.
+	ChangedFields []string
+
+	// AddedFixedIn and RemovedFixedIn are the FixedIn entries that only exist in the new and the old
+	// revision respectively, sorted by namespace and Feature name: an entry whose Version changed
+	// is both removed and added.
+	AddedFixedIn   []FeatureVersion
+	RemovedFixedIn []FeatureVersion
+}
+
+// DiffVulnerabilities returns the difference between the old and new revisions of a
+// Vulnerability, either of which is nil when the Vulnerability has been created or deleted, in
+// which case all of its FixedIn entries are added or removed.
+func DiffVulnerabilities(oldVulnerability, newVulnerability *Vulnerability) VulnerabilityDiff {
+	var diff VulnerabilityDiff
+	if oldVulnerability == nil || newVulnerability == nil {
+		if oldVulnerability != nil {
+			diff.RemovedFixedIn = fixedInDifference(oldVulnerability.FixedIn, nil)
+		}
+		if newVulnerability != nil {
+			diff.AddedFixedIn = fixedInDifference(newVulnerability.FixedIn, nil)
+		}
+		return diff
+	}
+
+	if oldVulnerability.Description != newVulnerability.Description {
+		diff.ChangedFields = append(diff.ChangedFields, "Description")
+	}
+	if oldVulnerability.Link != newVulnerability.Link {
+		diff.ChangedFields = append(diff.ChangedFields, "Link")
+	}
+	if oldVulnerability.Severity != newVulnerability.Severity {
+		diff.ChangedFields = append(diff.ChangedFields, "Severity")
+	}
+	if (len(oldVulnerability.Metadata) > 0 || len(newVulnerability.Metadata) > 0) &&
+		!reflect.DeepEqual(oldVulnerability.Metadata, newVulnerability.Metadata) {
+		diff.ChangedFields = append(diff.ChangedFields, "Metadata")
+	}
+	if (len(oldVulnerability.Sources) > 0 || len(newVulnerability.Sources) > 0) &&
+		!reflect.DeepEqual(oldVulnerability.Sources, newVulnerability.Sources) {
+		diff.ChangedFields = append(diff.ChangedFields, "Sources")
+	}
+	if !reflect.DeepEqual(oldVulnerability.CVSS, newVulnerability.CVSS) {
+		diff.ChangedFields = append(diff.ChangedFields, "CVSS")
+	}
+
+	diff.AddedFixedIn = fixedInDifference(newVulnerability.FixedIn, oldVulnerability.FixedIn)
+	diff.RemovedFixedIn = fixedInDifference(oldVulnerability.FixedIn, newVulnerability.FixedIn)
+	return diff
+}
+
+// fixedInDifference returns the entries of a that aren't in b, sorted by namespace and Feature
+// name.
+func fixedInDifference(a, b []FeatureVersion) []FeatureVersion {
+	versions := make(map[[2]string]string, len(b))
+	for _, fv := range b {
+		versions[[2]string{fv.Feature.Namespace.Name, fv.Feature.Name}] = fv.Version
+	}
+
+	var difference []FeatureVersion
+	for _, fv := range a {
+		version, ok := versions[[2]string{fv.Feature.Namespace.Name, fv.Feature.Name}]
+		if !ok || version != fv.Version {
+			difference = append(difference, fv)
+		}
+	}
+	sort.Sort(byNamespaceAndFeatureName(difference))
+	return difference
+}
+
+type byNamespaceAndFeatureName []FeatureVersion
+
+func (s byNamespaceAndFeatureName) Len() int      { return len(s) }
+func (s byNamespaceAndFeatureName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byNamespaceAndFeatureName) Less(i, j int) bool {
+	if s[i].Feature.Namespace.Name != s[j].Feature.Namespace.Name {
+		return s[i].Feature.Namespace.Name < s[j].Feature.Namespace.Name
+	}
+	return s[i].Feature.Name < s[j].Feature.Name
+}
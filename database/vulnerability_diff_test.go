@@ -0,0 +1,68 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+
+	"github.com/coreos/clair/utils/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffVulnerabilities(t *testing.T) {
+	fixedIn := func(namespace, name, version string) FeatureVersion {
+		return FeatureVersion{Feature: Feature{Namespace: Namespace{Name: namespace}, Name: name}, Version: version}
+	}
+	vulnerability := Vulnerability{
+		Name:     "CVE-2016-2108",
+		Severity: types.High,
+		Metadata: MetadataMap{},
+		FixedIn: []FeatureVersion{
+			fixedIn("debian:8", "openssl", "1.0.1t-1+deb8u1"),
+			fixedIn("debian:7", "openssl", "1.0.1e-2+deb7u21"),
+		},
+	}
+
+	// Created and deleted Vulnerabilities.
+	diff := DiffVulnerabilities(nil, &vulnerability)
+	assert.Empty(t, diff.ChangedFields)
+	assert.Equal(t, []FeatureVersion{vulnerability.FixedIn[1], vulnerability.FixedIn[0]}, diff.AddedFixedIn)
+	assert.Empty(t, diff.RemovedFixedIn)
+	diff = DiffVulnerabilities(&vulnerability, nil)
+	assert.Empty(t, diff.AddedFixedIn)
+	assert.Equal(t, []FeatureVersion{vulnerability.FixedIn[1], vulnerability.FixedIn[0]}, diff.RemovedFixedIn)
+
+	// An empty and a missing Metadata are the same.
+	changed := vulnerability
+	changed.Metadata = nil
+	assert.Equal(t, VulnerabilityDiff{}, DiffVulnerabilities(&vulnerability, &changed))
+
+	changed = vulnerability
+	changed.Description = "ASN.1 encoder negative zero memory corruption"
+	changed.Severity = types.Critical
+	changed.Metadata = MetadataMap{"NVD": map[string]interface{}{"CVSSv2": 10}}
+	changed.FixedIn = []FeatureVersion{
+		fixedIn("debian:8", "openssl", "1.0.1t-1+deb8u2"),
+		fixedIn("debian:7", "openssl", "1.0.1e-2+deb7u21"),
+		fixedIn("debian:7", "libssl", "1.0.1e-2+deb7u21"),
+	}
+	diff = DiffVulnerabilities(&vulnerability, &changed)
+	assert.Equal(t, []string{"Description", "Severity", "Metadata"}, diff.ChangedFields)
+	assert.Equal(t, []FeatureVersion{
+		fixedIn("debian:7", "libssl", "1.0.1e-2+deb7u21"),
+		fixedIn("debian:8", "openssl", "1.0.1t-1+deb8u2"),
+	}, diff.AddedFixedIn)
+	assert.Equal(t, []FeatureVersion{fixedIn("debian:8", "openssl", "1.0.1t-1+deb8u1")}, diff.RemovedFixedIn)
+}
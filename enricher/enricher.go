@@ -0,0 +1,446 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package enricher augments the vulnerabilities of the database with the severities, CVSS, CWEs
+// and references of the National Vulnerability Database, once the Updater stored them.
+package enricher
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/pborman/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/updater"
+	"github.com/coreos/clair/utils"
+)
+
+const (
+	defaultFeedURL = "https://nvd.nist.gov/feeds/json/cve/2.0"
+
+	lockName     = "enricher"
+	lockDuration = time.Hour
+
+	// pollInterval is how often the enricher checks whether the Updater updated the
+	// vulnerabilities, and errorRetryInterval how long it waits after a failed enrichment.
+	pollInterval       = time.Minute
+	errorRetryInterval = 10 * time.Minute
+
+	// fullSyncInterval is how often the feeds of every year are synchronized. In-between, the
+	// modified feed, which lists the CVEs modified in the last eight days, is enough.
+	fullSyncInterval = 7 * 24 * time.Hour
+
+	// firstYear is the year of the oldest feed.
+	firstYear = 2002
+
+	// The flags record, as Unix timestamps, the last enrichment, the last update of the Updater
+	// it followed and the last full synchronization, and the digest of the last synchronized
+	// modified feed.
+	flagName         = "enricher/last"
+	updateFlagName   = "enricher/update"
+	fullSyncFlagName = "enricher/nvd/full"
+	modifiedFlagName = "enricher/nvd/modified"
+)
+
+var (
+	log = capnslog.NewPackageLogger("github.com/coreos/clair", "enricher")
+
+	promEnricherErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_enricher_errors_total",
+		Help: "Number of enrichments of the vulnerabilities that failed.",
+	})
+
+	promEnricherEnrichedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_enricher_enriched_vulnerabilities_total",
+		Help: "Number of vulnerabilities that have been modified by the enricher.",
+	})
+
+	promEnricherDurationSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "clair_enricher_duration_seconds",
+		Help: "Time it takes to enrich the vulnerabilities.",
+	})
+
+	// cache holds the records of the CVEs of the database, as synchronized by this instance.
+	cache struct {
+		sync.RWMutex
+		records map[string]record
+		// known are the IDs of every CVE of the NVD as of the last full synchronization.
+		known map[string]struct{}
+	}
+)
+
+func init() {
+	prometheus.MustRegister(promEnricherErrorsTotal)
+	prometheus.MustRegister(promEnricherEnrichedTotal)
+	prometheus.MustRegister(promEnricherDurationSeconds)
+
+	updater.RegisterMetadataFetcher("enricher", metadataFetcher{})
+}
+
+// Run enriches the vulnerabilities after every update of the Updater, and at regular intervals in
+// between.
+func Run(config *config.EnricherConfig, datastore database.Datastore, st *utils.Stopper) {
+	defer st.End()
+
+	// Do not run the enricher if there is no config or if the interval is 0.
+	if config == nil || config.Interval == 0 {
+		log.Infof("enricher service is disabled.")
+		return
+	}
+
+	e := &enricher{datastore: datastore, feedURL: strings.TrimSuffix(config.FeedURL, "/")}
+	if e.feedURL == "" {
+		e.feedURL = defaultFeedURL
+	}
+
+	whoAmI := uuid.New()
+	log.Infof("enricher service started. lock identifier: %s", whoAmI)
+
+	for {
+		wait := pollInterval
+
+		if due, err := e.isDue(config.Interval, time.Now()); err != nil {
+			log.Errorf("an error occured while getting the last enrichment time: %s", err)
+		} else if due {
+			// Only one instance enriches the vulnerabilities at a time.
+			if hasLock, _ := datastore.Lock(lockName, whoAmI, lockDuration, false); hasLock {
+				if err := e.enrich(time.Now()); err != nil {
+					promEnricherErrorsTotal.Inc()
+					log.Errorf("an error occured when enriching vulnerabilities: %s", err)
+					wait = errorRetryInterval
+				}
+				datastore.Unlock(lockName, whoAmI)
+			} else {
+				log.Debug("enricher lock is already taken")
+			}
+		}
+
+		if !st.Sleep(wait) {
+			break
+		}
+	}
+
+	log.Info("enricher service stopped")
+}
+
+type enricher struct {
+	datastore database.Datastore
+	feedURL   string
+}
+
+// isDue returns whether the vulnerabilities must be enriched: once the Updater updated them, when
+// they haven't been since, or when the interval elapsed.
+func (e *enricher) isDue(interval time.Duration, now time.Time) (bool, error) {
+	lastUpdate, firstUpdate, err := updater.LastUpdate(e.datastore)
+	if err != nil || firstUpdate {
+		return false, err
+	}
+
+	enrichedUpdate, err := e.datastore.GetKeyValue(updateFlagName)
+	if err != nil {
+		return false, err
+	}
+	if enrichedUpdate != strconv.FormatInt(lastUpdate.Unix(), 10) {
+		return true, nil
+	}
+
+	lastEnrichment, err := e.getTime(flagName)
+	if err != nil {
+		return false, err
+	}
+	return !now.Before(lastEnrichment.Add(interval)), nil
+}
+
+// enrich synchronizes the feeds and enriches the vulnerabilities of the database.
+//
+// The feeds of every year are synchronized on the first enrichment of the instance, once a week,
+// or when the database has CVEs that this instance hasn't synchronized yet. Otherwise, only the
+// modified feed is, if it changed since the last enrichment.
+func (e *enricher) enrich(now time.Time) error {
+	defer setEnricherDuration(time.Now())
+
+	log.Info("enriching vulnerabilities")
+
+	lastUpdate, _, err := updater.LastUpdate(e.datastore)
+	if err != nil {
+		return err
+	}
+	lastFullSync, err := e.getTime(fullSyncFlagName)
+	if err != nil {
+		return err
+	}
+	lastModified, err := e.datastore.GetKeyValue(modifiedFlagName)
+	if err != nil {
+		return err
+	}
+	names, err := e.cveNames()
+	if err != nil {
+		return err
+	}
+
+	cache.RLock()
+	full := cache.known == nil || now.Sub(lastFullSync) >= fullSyncInterval || !isCovered(names)
+	cache.RUnlock()
+
+	records := make(map[string]record)
+	var known map[string]struct{}
+	if full {
+		known = make(map[string]struct{})
+		for year := firstYear; year <= now.Year(); year++ {
+			digest, _, err := e.meta(yearFeed(year))
+			if err != nil {
+				return err
+			}
+			feedRecords, err := e.download(yearFeed(year), digest)
+			if err != nil {
+				return err
+			}
+			for id, r := range feedRecords {
+				known[id] = struct{}{}
+				if _, ok := names[id]; ok {
+					records[id] = r
+				}
+			}
+		}
+	}
+
+	modifiedDigest, _, err := e.meta(modifiedFeed)
+	if err != nil {
+		return err
+	}
+	if full || modifiedDigest != lastModified {
+		feedRecords, err := e.download(modifiedFeed, modifiedDigest)
+		if err != nil {
+			return err
+		}
+		for id, r := range feedRecords {
+			if _, ok := names[id]; ok {
+				records[id] = r
+			}
+		}
+	}
+
+	cache.Lock()
+	if full {
+		cache.records, cache.known = records, known
+	} else {
+		for id, r := range records {
+			cache.records[id] = r
+		}
+	}
+	cache.Unlock()
+
+	count, err := e.apply()
+	if err != nil {
+		return err
+	}
+	promEnricherEnrichedTotal.Add(float64(count))
+
+	timestamp := strconv.FormatInt(now.UTC().Unix(), 10)
+	flags := map[string]string{
+		flagName:         timestamp,
+		updateFlagName:   strconv.FormatInt(lastUpdate.Unix(), 10),
+		modifiedFlagName: modifiedDigest,
+	}
+	if full {
+		flags[fullSyncFlagName] = timestamp
+	}
+	for key, value := range flags {
+		if err := e.datastore.InsertKeyValue(key, value); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("enrichment finished: %d vulnerabilities modified", count)
+	return nil
+}
+
+// apply enriches the vulnerabilities of the database with the cached records and returns how many
+// were modified.
+func (e *enricher) apply() (int, error) {
+	namespaces, err := e.datastore.ListNamespaces()
+	if err != nil {
+		return 0, err
+	}
+
+	cache.RLock()
+	defer cache.RUnlock()
+
+	var count int
+	for _, namespace := range namespaces {
+		var enriched []database.Vulnerability
+		err := e.datastore.StreamVulnerabilities(namespace.Name, func(vulnerability database.Vulnerability) error {
+			r, ok := cache.records[vulnerability.Name]
+			if !ok {
+				return nil
+			}
+
+			// Only the attributes of the vulnerability are modified, not the FixedIn list.
+			vulnerability.FixedIn = nil
+			if enrich(&vulnerability, r) {
+				enriched = append(enriched, vulnerability)
+			}
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+
+		if len(enriched) > 0 {
+			if err := e.datastore.InsertVulnerabilities(enriched, true); err != nil {
+				return count, err
+			}
+			count += len(enriched)
+		}
+	}
+	return count, nil
+}
+
+// cveNames returns the names of the CVEs of the database.
+func (e *enricher) cveNames() (map[string]struct{}, error) {
+	namespaces, err := e.datastore.ListNamespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{})
+	for _, namespace := range namespaces {
+		err := e.datastore.StreamVulnerabilities(namespace.Name, func(vulnerability database.Vulnerability) error {
+			if strings.HasPrefix(vulnerability.Name, "CVE-") {
+				names[vulnerability.Name] = struct{}{}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// isCovered returns whether the cache has the records of the given CVEs that the NVD knows. The
+// cache must be locked.
+func isCovered(names map[string]struct{}) bool {
+	for name := range names {
+		if _, ok := cache.known[name]; !ok {
+			continue
+		}
+		if _, ok := cache.records[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// meta returns the SHA-256 digest and the modification time of the given feed.
+func (e *enricher) meta(feed string) (string, string, error) {
+	r, err := http.Get(e.feedURL + "/" + feed + ".meta")
+	if err != nil {
+		return "", "", err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("could not download NVD feed %s: %s", feed, r.Status)
+	}
+	return parseMeta(r.Body)
+}
+
+// download returns the records of the CVEs of the given feed, whose decompressed content must have
+// the given SHA-256 digest.
+func (e *enricher) download(feed, digest string) (map[string]record, error) {
+	r, err := http.Get(e.feedURL + "/" + feed + ".json.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not download NVD feed %s: %s", feed, r.Status)
+	}
+	gr, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read NVD feed %s: %s", feed, err)
+	}
+	defer gr.Close()
+
+	h := sha256.New()
+	content := io.TeeReader(gr, h)
+	records := make(map[string]record)
+	if err := parseFeed(content, func(id string, r record) { records[id] = r }); err != nil {
+		return nil, fmt.Errorf("could not parse NVD feed %s: %s", feed, err)
+	}
+	if _, err := io.Copy(ioutil.Discard, content); err != nil {
+		return nil, fmt.Errorf("could not read NVD feed %s: %s", feed, err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != digest {
+		return nil, fmt.Errorf("NVD feed %s doesn't match its digest", feed)
+	}
+
+	return records, nil
+}
+
+// getTime returns the time recorded in the given flag, the zero time if there is none.
+func (e *enricher) getTime(flag string) (time.Time, error) {
+	value, err := e.datastore.GetKeyValue(flag)
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(timestamp, 0).UTC(), nil
+}
+
+func setEnricherDuration(start time.Time) {
+	promEnricherDurationSeconds.Set(time.Since(start).Seconds())
+}
+
+// metadataFetcher enriches the vulnerabilities that the Updater updates with the cached records,
+// so that their updates don't revert their enrichments.
+type metadataFetcher struct{}
+
+func (metadataFetcher) Load(database.Datastore) error { return nil }
+
+func (metadataFetcher) AddMetadata(vulnerability *updater.VulnerabilityWithLock) error {
+	cache.RLock()
+	r, ok := cache.records[vulnerability.Name]
+	cache.RUnlock()
+
+	if ok {
+		vulnerability.Lock.Lock()
+		enrich(vulnerability.Vulnerability, r)
+		vulnerability.Lock.Unlock()
+	}
+	return nil
+}
+
+func (metadataFetcher) Unload() {}
+
+func (metadataFetcher) Clean() {}
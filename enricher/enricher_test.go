@@ -0,0 +1,263 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enricher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+const testFeed = `{
+  "resultsPerPage": 2,
+  "format": "NVD_CVE",
+  "vulnerabilities": [
+    {
+      "cve": {
+        "id": "CVE-2021-0001",
+        "lastModified": "2021-05-01T10:00:00.000",
+        "metrics": {
+          "cvssMetricV31": [
+            {"source": "secalert@example.com", "type": "Secondary", "cvssData": {"vectorString": "CVSS:3.1/AV:L/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N", "baseScore": 1.6}},
+            {"source": "nvd@nist.gov", "type": "Primary", "cvssData": {"vectorString": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", "baseScore": 9.8}}
+          ],
+          "cvssMetricV2": [
+            {"source": "nvd@nist.gov", "type": "Primary", "cvssData": {"vectorString": "AV:N/AC:L/Au:N/C:P/I:P/A:P", "baseScore": 7.5}}
+          ]
+        },
+        "weaknesses": [
+          {"type": "Primary", "description": [{"lang": "en", "value": "CWE-787"}, {"lang": "en", "value": "NVD-CWE-Other"}]},
+          {"type": "Secondary", "description": [{"lang": "en", "value": "CWE-787"}]}
+        ],
+        "references": [{"url": "https://example.com/advisory"}]
+      }
+    },
+    {
+      "cve": {
+        "id": "CVE-2021-0002",
+        "lastModified": "2021-05-02T10:00:00.000",
+        "metrics": {
+          "cvssMetricV2": [
+            {"source": "nvd@nist.gov", "type": "Primary", "cvssData": {"vectorString": "AV:N/AC:M/Au:N/C:N/I:P/A:N", "baseScore": 4.3}}
+          ]
+        }
+      }
+    }
+  ],
+  "timestamp": "2021-06-01T00:00:00.000"
+}`
+
+func TestParseFeed(t *testing.T) {
+	records := make(map[string]record)
+	err := parseFeed(strings.NewReader(testFeed), func(id string, r record) { records[id] = r })
+	if assert.Nil(t, err) && assert.Len(t, records, 2) {
+		r := records["CVE-2021-0001"]
+		if assert.NotNil(t, r.CVSS.V3) {
+			assert.Equal(t, "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", r.CVSS.V3.Vector)
+			assert.Equal(t, 9.8, r.CVSS.V3.Score)
+		}
+		assert.Equal(t, &types.CVSS{Vector: "AV:N/AC:L/Au:N/C:P/I:P/A:P", Score: 7.5}, r.CVSS.V2)
+		assert.Equal(t, []string{"CWE-787"}, r.CWEs)
+		assert.Equal(t, []string{"https://example.com/advisory"}, r.References)
+		assert.Equal(t, "2021-05-01T10:00:00.000", r.LastModified)
+
+		r = records["CVE-2021-0002"]
+		assert.Nil(t, r.CVSS.V3)
+		assert.Equal(t, &types.CVSS{Vector: "AV:N/AC:M/Au:N/C:N/I:P/A:N", Score: 4.3}, r.CVSS.V2)
+		assert.Empty(t, r.CWEs)
+	}
+
+	assert.Nil(t, parseFeed(strings.NewReader(`{"format": "NVD_CVE"}`), func(string, record) {}))
+	assert.NotNil(t, parseFeed(strings.NewReader(`[]`), func(string, record) {}))
+}
+
+func TestParseMeta(t *testing.T) {
+	digest, lastModified, err := parseMeta(strings.NewReader("lastModifiedDate:2021-06-01T00:00:00-04:00\r\nsize:1000\r\nsha256:ABCDEF\r\n"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "abcdef", digest)
+		assert.Equal(t, "2021-06-01T00:00:00-04:00", lastModified)
+	}
+
+	_, _, err = parseMeta(strings.NewReader("size:1000\n"))
+	assert.Equal(t, errInvalidMeta, err)
+}
+
+func TestEnrich(t *testing.T) {
+	records := make(map[string]record)
+	parseFeed(strings.NewReader(testFeed), func(id string, r record) { records[id] = r })
+
+	// The vulnerabilities without CVSS nor severity get the ones of the NVD.
+	vulnerability := database.Vulnerability{Name: "CVE-2021-0001", Severity: types.Unknown}
+	assert.True(t, enrich(&vulnerability, records["CVE-2021-0001"]))
+	assert.Equal(t, types.Critical, vulnerability.Severity)
+	assert.Equal(t, records["CVE-2021-0001"].CVSS, vulnerability.CVSS)
+	assert.Equal(t, database.VulnerabilitySources{source}, vulnerability.Sources)
+	metadata := vulnerability.Metadata[metadataKey].(map[string]interface{})
+	assert.Equal(t, []interface{}{"CWE-787"}, metadata["CWEs"])
+	assert.Equal(t, map[string]interface{}{"Vectors": "AV:N/AC:L/Au:N/C:P/I:P/A:P", "Score": 7.5}, metadata["CVSSv2"])
+
+	// Enriching is idempotent, including once the metadata is stored as JSON.
+	assert.False(t, enrich(&vulnerability, records["CVE-2021-0001"]))
+	var stored database.MetadataMap
+	value, _ := vulnerability.Metadata.Value()
+	stored.Scan([]byte(value.(string)))
+	vulnerability.Metadata = stored
+	assert.False(t, enrich(&vulnerability, records["CVE-2021-0001"]))
+
+	// The assessments of the distributions are kept.
+	v3 := &types.CVSS{Vector: "CVSS:3.1/AV:L/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N", Score: 1.6}
+	vulnerability = database.Vulnerability{
+		Name:     "CVE-2021-0001",
+		Severity: types.Low,
+		CVSS:     database.VulnerabilityCVSS{V3: v3},
+		Sources:  database.VulnerabilitySources{{Name: "Debian"}},
+	}
+	assert.True(t, enrich(&vulnerability, records["CVE-2021-0001"]))
+	assert.Equal(t, types.Low, vulnerability.Severity)
+	assert.Equal(t, v3, vulnerability.CVSS.V3)
+	assert.Equal(t, records["CVE-2021-0001"].CVSS.V2, vulnerability.CVSS.V2)
+	assert.Equal(t, database.VulnerabilitySources{{Name: "Debian"}, source}, vulnerability.Sources)
+}
+
+// testServer serves the given feeds, the others being empty, and counts the feeds downloaded.
+func testServer(feeds map[string]string, downloads map[string]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		feed := strings.TrimSuffix(strings.TrimSuffix(name, ".meta"), ".json.gz")
+		content, ok := feeds[feed]
+		if !ok {
+			content = `{"vulnerabilities": []}`
+		}
+
+		if strings.HasSuffix(name, ".meta") {
+			digest := sha256.Sum256([]byte(content))
+			fmt.Fprintf(w, "lastModifiedDate:2021-06-01T00:00:00-04:00\r\nsha256:%s\r\n", strings.ToUpper(hex.EncodeToString(digest[:])))
+			return
+		}
+
+		downloads[feed]++
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		gw.Write([]byte(content))
+		gw.Close()
+		w.Write(buf.Bytes())
+	}))
+}
+
+func TestEnricher(t *testing.T) {
+	defer func() { cache.records, cache.known = nil, nil }()
+
+	feeds := map[string]string{"nvdcve-2.0-2021": testFeed, modifiedFeed: `{"vulnerabilities": []}`}
+	downloads := make(map[string]int)
+	server := testServer(feeds, downloads)
+	defer server.Close()
+
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	flags := map[string]string{"updater/last": strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)}
+	vulnerabilities := map[string]database.Vulnerability{
+		"CVE-2021-0001": {Name: "CVE-2021-0001", Namespace: database.Namespace{Name: "debian:11"}, Severity: types.Unknown, FixedIn: []database.FeatureVersion{{Version: "1.0"}}},
+		"DSA-0001":      {Name: "DSA-0001", Namespace: database.Namespace{Name: "debian:11"}, Severity: types.High},
+	}
+	var inserted []database.Vulnerability
+	datastore := &database.MockDatastore{
+		FctGetKeyValue: func(key string) (string, error) {
+			return flags[key], nil
+		},
+		FctInsertKeyValue: func(key, value string) error {
+			flags[key] = value
+			return nil
+		},
+		FctListNamespaces: func() ([]database.Namespace, error) {
+			return []database.Namespace{{Name: "debian:11"}}, nil
+		},
+		FctStreamVulnerabilities: func(namespaceName string, fn func(database.Vulnerability) error) error {
+			for _, vulnerability := range vulnerabilities {
+				if err := fn(vulnerability); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		FctInsertVulnerabilities: func(updated []database.Vulnerability, createNotification bool) error {
+			for _, vulnerability := range updated {
+				vulnerability.FixedIn = vulnerabilities[vulnerability.Name].FixedIn
+				vulnerabilities[vulnerability.Name] = vulnerability
+			}
+			inserted = append(inserted, updated...)
+			return nil
+		},
+	}
+	e := &enricher{datastore: datastore, feedURL: server.URL}
+
+	// The enrichment follows the updates.
+	due, err := e.isDue(24*time.Hour, now)
+	assert.Nil(t, err)
+	assert.True(t, due)
+
+	// Every feed is synchronized first.
+	if assert.Nil(t, e.enrich(now)) && assert.Len(t, inserted, 1) {
+		assert.Equal(t, types.Critical, inserted[0].Severity)
+		assert.Nil(t, inserted[0].FixedIn)
+		assert.Equal(t, types.Critical, vulnerabilities["CVE-2021-0001"].Severity)
+	}
+	assert.Equal(t, 2021-firstYear+1, len(downloads)-1)
+	assert.Equal(t, 1, downloads[modifiedFeed])
+	assert.Equal(t, strconv.FormatInt(now.Unix(), 10), flags[fullSyncFlagName])
+
+	due, err = e.isDue(24*time.Hour, now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.False(t, due)
+	due, err = e.isDue(24*time.Hour, now.Add(24*time.Hour))
+	assert.Nil(t, err)
+	assert.True(t, due)
+
+	// Then only the modified feed is, once it changes.
+	inserted = nil
+	assert.Nil(t, e.enrich(now.Add(24*time.Hour)))
+	assert.Empty(t, inserted)
+	assert.Equal(t, 1, downloads["nvdcve-2.0-2021"])
+	assert.Equal(t, 1, downloads[modifiedFeed])
+
+	feeds[modifiedFeed] = strings.Replace(testFeed, "https://example.com/advisory", "https://example.com/advisory-2", -1)
+	assert.Nil(t, e.enrich(now.Add(48*time.Hour)))
+	assert.Equal(t, 1, downloads["nvdcve-2.0-2021"])
+	assert.Equal(t, 2, downloads[modifiedFeed])
+	if assert.Len(t, inserted, 1) {
+		metadata := inserted[0].Metadata[metadataKey].(map[string]interface{})
+		assert.Equal(t, []interface{}{"https://example.com/advisory-2"}, metadata["References"])
+	}
+
+	// New CVEs of the database that the NVD knows trigger a full synchronization.
+	vulnerabilities["CVE-2021-0002"] = database.Vulnerability{Name: "CVE-2021-0002", Namespace: database.Namespace{Name: "debian:11"}, Severity: types.Unknown}
+	inserted = nil
+	assert.Nil(t, e.enrich(now.Add(72*time.Hour)))
+	assert.Equal(t, 2, downloads["nvdcve-2.0-2021"])
+	if assert.Len(t, inserted, 1) {
+		assert.Equal(t, types.Medium, inserted[0].Severity)
+	}
+}
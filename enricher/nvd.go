@@ -0,0 +1,278 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enricher
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+// metadataKey is the key of the NVD metadata of the vulnerabilities, which the NVD metadata
+// fetcher of the Updater uses too.
+const metadataKey = "NVD"
+
+// modifiedFeed is the NVD JSON 2.0 feed of the CVEs modified in the last eight days.
+const modifiedFeed = "nvdcve-2.0-modified"
+
+var (
+	// source attributes the enrichments to the National Vulnerability Database.
+	source = database.VulnerabilitySource{Name: "NVD", URL: "https://nvd.nist.gov"}
+
+	errInvalidFeed = errors.New("invalid NVD feed")
+	errInvalidMeta = errors.New("invalid NVD feed .meta file")
+)
+
+// record is what the NVD knows about a CVE.
+type record struct {
+	CVSS         database.VulnerabilityCVSS
+	CWEs         []string
+	References   []string
+	LastModified string
+}
+
+// metadata is the NVD metadata of the vulnerabilities. Its CVSSv2 has the shape of the one of the
+// NVD metadata fetcher.
+type metadata struct {
+	CVSSv2 *struct {
+		Vectors string
+		Score   float64
+	} `json:",omitempty"`
+	CVSSv3       *types.CVSS `json:",omitempty"`
+	CWEs         []string    `json:",omitempty"`
+	References   []string    `json:",omitempty"`
+	LastModified string      `json:",omitempty"`
+}
+
+// feedItem is the part of an item of the NVD JSON 2.0 feeds that enriches vulnerabilities.
+type feedItem struct {
+	CVE struct {
+		ID           string `json:"id"`
+		LastModified string `json:"lastModified"`
+		Metrics      struct {
+			CVSSMetricV31 []feedMetric `json:"cvssMetricV31"`
+			CVSSMetricV30 []feedMetric `json:"cvssMetricV30"`
+			CVSSMetricV2  []feedMetric `json:"cvssMetricV2"`
+		} `json:"metrics"`
+		Weaknesses []struct {
+			Description []struct {
+				Value string `json:"value"`
+			} `json:"description"`
+		} `json:"weaknesses"`
+		References []struct {
+			URL string `json:"url"`
+		} `json:"references"`
+	} `json:"cve"`
+}
+
+type feedMetric struct {
+	Type     string `json:"type"`
+	CVSSData struct {
+		VectorString string  `json:"vectorString"`
+		BaseScore    float64 `json:"baseScore"`
+	} `json:"cvssData"`
+}
+
+// primaryMetric returns the metric scored by the NVD itself, or the first one.
+func primaryMetric(metrics []feedMetric) (feedMetric, bool) {
+	for _, metric := range metrics {
+		if metric.Type == "Primary" {
+			return metric, true
+		}
+	}
+	if len(metrics) > 0 {
+		return metrics[0], true
+	}
+	return feedMetric{}, false
+}
+
+// record returns the record of the CVE of the item.
+func (item feedItem) record() record {
+	var r record
+	r.LastModified = item.CVE.LastModified
+
+	v3, ok := primaryMetric(item.CVE.Metrics.CVSSMetricV31)
+	if !ok {
+		v3, ok = primaryMetric(item.CVE.Metrics.CVSSMetricV30)
+	}
+	if ok {
+		if cvss, err := types.ParseCVSSv3(v3.CVSSData.VectorString); err == nil {
+			r.CVSS.V3 = &cvss
+		} else {
+			log.Debugf("could not parse CVSS vector of %s: %s", item.CVE.ID, err)
+		}
+	}
+	if v2, ok := primaryMetric(item.CVE.Metrics.CVSSMetricV2); ok && v2.CVSSData.VectorString != "" {
+		r.CVSS.V2 = &types.CVSS{Vector: v2.CVSSData.VectorString, Score: v2.CVSSData.BaseScore}
+	}
+
+	// The NVD-CWE-Other and NVD-CWE-noinfo placeholders aren't weaknesses.
+	cwes := make(map[string]struct{})
+	for _, weakness := range item.CVE.Weaknesses {
+		for _, description := range weakness.Description {
+			if _, dup := cwes[description.Value]; !dup && strings.HasPrefix(description.Value, "CWE-") {
+				cwes[description.Value] = struct{}{}
+				r.CWEs = append(r.CWEs, description.Value)
+			}
+		}
+	}
+	for _, reference := range item.CVE.References {
+		r.References = append(r.References, reference.URL)
+	}
+
+	return r
+}
+
+// parseFeed calls fn with the ID and the record of every CVE of the given NVD JSON 2.0 feed,
+// which is streamed as feeds are large.
+func parseFeed(r io.Reader, fn func(id string, r record)) error {
+	d := json.NewDecoder(bufio.NewReader(r))
+
+	// Skip to the array of vulnerabilities.
+	if t, err := d.Token(); err != nil || t != json.Delim('{') {
+		return errInvalidFeed
+	}
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := t.(string)
+		if !ok {
+			// The feed has no vulnerabilities.
+			return nil
+		}
+		if key == "vulnerabilities" {
+			break
+		}
+		var skipped json.RawMessage
+		if err := d.Decode(&skipped); err != nil {
+			return err
+		}
+	}
+
+	if t, err := d.Token(); err != nil || t != json.Delim('[') {
+		return errInvalidFeed
+	}
+	for d.More() {
+		var item feedItem
+		if err := d.Decode(&item); err != nil {
+			return err
+		}
+		if item.CVE.ID != "" {
+			fn(item.CVE.ID, item.record())
+		}
+	}
+	return nil
+}
+
+// parseMeta returns the SHA-256 digest of a feed and the time it was last modified, as listed by
+// its .meta file.
+func parseMeta(r io.Reader) (sha256, lastModified string, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "sha256:") {
+			sha256 = strings.ToLower(strings.TrimPrefix(line, "sha256:"))
+		} else if strings.HasPrefix(line, "lastModifiedDate:") {
+			lastModified = strings.TrimPrefix(line, "lastModifiedDate:")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+	if sha256 == "" {
+		return "", "", errInvalidMeta
+	}
+	return sha256, lastModified, nil
+}
+
+// enrich augments the given Vulnerability with the given record and returns whether it changed.
+//
+// The NVD metadata, i.e. the CWEs and the references, are replaced, while the CVSS and the Severity
+// are only set when the feed of the Vulnerability doesn't have them, as the distributions assess
+// the impact of the vulnerabilities on their packages.
+func enrich(vulnerability *database.Vulnerability, r record) bool {
+	changed := false
+
+	if vulnerability.CVSS.V2 == nil && r.CVSS.V2 != nil {
+		vulnerability.CVSS.V2 = r.CVSS.V2
+		changed = true
+	}
+	if vulnerability.CVSS.V3 == nil && r.CVSS.V3 != nil {
+		vulnerability.CVSS.V3 = r.CVSS.V3
+		changed = true
+	}
+	if vulnerability.Severity == "" || vulnerability.Severity == types.Unknown {
+		if score, ok := vulnerability.CVSS.Score(); ok && types.ScorePriority(score) != vulnerability.Severity {
+			vulnerability.Severity = types.ScorePriority(score)
+			changed = true
+		}
+	}
+
+	m := metadata{
+		CVSSv3:       r.CVSS.V3,
+		CWEs:         r.CWEs,
+		References:   r.References,
+		LastModified: r.LastModified,
+	}
+	if r.CVSS.V2 != nil {
+		m.CVSSv2 = &struct {
+			Vectors string
+			Score   float64
+		}{r.CVSS.V2.Vector, r.CVSS.V2.Score}
+	}
+	// The metadata is compared as it is stored, i.e. as JSON.
+	var value interface{}
+	if encoded, err := json.Marshal(m); err == nil {
+		json.Unmarshal(encoded, &value)
+	}
+	if !reflect.DeepEqual(vulnerability.Metadata[metadataKey], value) {
+		if vulnerability.Metadata == nil {
+			vulnerability.Metadata = make(map[string]interface{})
+		}
+		vulnerability.Metadata[metadataKey] = value
+		changed = true
+	}
+
+	if !hasSource(vulnerability.Sources, source) {
+		vulnerability.Sources = append(vulnerability.Sources, source)
+		changed = true
+	}
+
+	return changed
+}
+
+// hasSource returns whether the given source is one of the sources.
+func hasSource(sources database.VulnerabilitySources, source database.VulnerabilitySource) bool {
+	for _, s := range sources {
+		if s.Name == source.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// yearFeed returns the name of the NVD JSON 2.0 feed of the CVEs of the given year.
+func yearFeed(year int) string {
+	return fmt.Sprintf("nvdcve-2.0-%d", year)
+}
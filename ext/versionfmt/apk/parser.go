@@ -0,0 +1,202 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apk implements a versionfmt.Parser for the versions of Alpine Linux packages, which are
+// ordered as by apk-tools, following the rules of Gentoo's package manager specification.
+package apk
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+// ParserName is the name by which the apk parser is registered.
+const ParserName = "apk"
+
+var errInvalidVersion = errors.New("apk: invalid version")
+
+// versionRegexp matches the versions as "numbers[letter][_suffix...][~hash][-rrevision]".
+var versionRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)*)([a-z]?)((?:_[a-z]+[0-9]*)*)(?:~[0-9a-f]+)?(?:-r([0-9]+))?$`)
+
+var suffixRegexp = regexp.MustCompile(`_([a-z]+)([0-9]*)`)
+
+// suffixes ranks the suffixes: the pre-release ones come before the version without suffix, which
+// has the rank noSuffix, and the other ones after it.
+var suffixes = map[string]int{
+	"alpha": 0,
+	"beta":  1,
+	"pre":   2,
+	"rc":    3,
+	"cvs":   5,
+	"svn":   6,
+	"git":   7,
+	"hg":    8,
+	"p":     9,
+}
+
+const noSuffix = 4
+
+type suffix struct {
+	rank   int
+	number uint64
+}
+
+type version struct {
+	// numbers are the components of the version, the first one being compared numerically and
+	// the other ones as well unless one of them has a leading zero.
+	numbers  []string
+	letter   string
+	suffixes []suffix
+	revision uint64
+
+	// special is versionfmt.MinVersion or versionfmt.MaxVersion.
+	special string
+}
+
+// newVersion parses a version. The commit hash of the versions built from a git snapshot is
+// ignored.
+func newVersion(str string) (version, error) {
+	str = strings.TrimSpace(str)
+	if str == versionfmt.MinVersion || str == versionfmt.MaxVersion {
+		return version{special: str}, nil
+	}
+
+	m := versionRegexp.FindStringSubmatch(str)
+	if m == nil {
+		return version{}, errInvalidVersion
+	}
+
+	v := version{numbers: strings.Split(m[1], "."), letter: m[2]}
+	for _, s := range suffixRegexp.FindAllStringSubmatch(m[3], -1) {
+		rank, ok := suffixes[s[1]]
+		if !ok {
+			return version{}, errInvalidVersion
+		}
+		sfx := suffix{rank: rank}
+		if s[2] != "" {
+			var err error
+			if sfx.number, err = strconv.ParseUint(s[2], 10, 64); err != nil {
+				return version{}, errInvalidVersion
+			}
+		}
+		v.suffixes = append(v.suffixes, sfx)
+	}
+	if m[4] != "" {
+		var err error
+		if v.revision, err = strconv.ParseUint(m[4], 10, 64); err != nil {
+			return version{}, errInvalidVersion
+		}
+	}
+
+	return v, nil
+}
+
+type parser struct{}
+
+func (p parser) Valid(str string) bool {
+	_, err := newVersion(str)
+	return err == nil
+}
+
+// Compare function compares two apk versions: numbers first, then letters, suffixes and
+// revisions.
+func (p parser) Compare(a, b string) (int, error) {
+	v1, err := newVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	v2, err := newVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Max/Min comparison
+	if v1.special != "" || v2.special != "" {
+		switch {
+		case v1.special == v2.special:
+			return 0, nil
+		case v1.special == versionfmt.MinVersion || v2.special == versionfmt.MaxVersion:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+
+	// A version with more numbers is greater, e.g. "1.0.1" > "1.0".
+	for i := 0; i < len(v1.numbers) && i < len(v2.numbers); i++ {
+		if c := compareNumbers(v1.numbers[i], v2.numbers[i], i == 0); c != 0 {
+			return c, nil
+		}
+	}
+	if c := compareInts(uint64(len(v1.numbers)), uint64(len(v2.numbers))); c != 0 {
+		return c, nil
+	}
+
+	if c := strings.Compare(v1.letter, v2.letter); c != 0 {
+		return c, nil
+	}
+
+	// A version with more suffixes is lower if the first additional one is a pre-release, e.g.
+	// "1.0_rc1" < "1.0", and greater otherwise, e.g. "1.0_p1" > "1.0".
+	for i := 0; i < len(v1.suffixes) || i < len(v2.suffixes); i++ {
+		s1, s2 := suffix{rank: noSuffix}, suffix{rank: noSuffix}
+		if i < len(v1.suffixes) {
+			s1 = v1.suffixes[i]
+		}
+		if i < len(v2.suffixes) {
+			s2 = v2.suffixes[i]
+		}
+		if c := compareInts(uint64(s1.rank), uint64(s2.rank)); c != 0 {
+			return c, nil
+		}
+		if c := compareInts(s1.number, s2.number); c != 0 {
+			return c, nil
+		}
+	}
+
+	return compareInts(v1.revision, v2.revision), nil
+}
+
+// compareNumbers compares two components of versions. The components following the first one
+// that have a leading zero are compared as decimal fractions, e.g. "1.01" < "1.1".
+func compareNumbers(a, b string, first bool) int {
+	if !first && (strings.HasPrefix(a, "0") || strings.HasPrefix(b, "0")) {
+		return strings.Compare(strings.TrimRight(a, "0"), strings.TrimRight(b, "0"))
+	}
+
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return compareInts(uint64(len(a)), uint64(len(b)))
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func init() {
+	versionfmt.RegisterParser(ParserName, parser{})
+}
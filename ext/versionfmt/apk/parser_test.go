@@ -0,0 +1,84 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+func TestValid(t *testing.T) {
+	for _, v := range []string{"1", "1.2.3", "1.24.2-r0", "2.4.23-r1", "1.0a", "1.0_rc1", "1.0_p20160101-r3", "1.0_alpha_p2", "0.2_git20200101~abc123-r0", versionfmt.MinVersion, versionfmt.MaxVersion} {
+		assert.True(t, parser{}.Valid(v), v)
+	}
+	for _, v := range []string{"", "a1", "1.0-", "1..0", "1.0ab", "1.0_gamma1", "1.0-r", "1.0 r1", "1.0-1"} {
+		assert.False(t, parser{}.Valid(v), v)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Versions in increasing order.
+	ordered := []string{
+		versionfmt.MinVersion,
+		"0.9.9",
+		"1.0_alpha",
+		"1.0_alpha1",
+		"1.0_alpha2_p1",
+		"1.0_beta",
+		"1.0_pre1",
+		"1.0_rc1",
+		"1.0_rc1-r1",
+		"1.0",
+		"1.0-r1",
+		"1.0-r10",
+		"1.0_cvs",
+		"1.0_git20200101",
+		"1.0_p1",
+		"1.0a",
+		"1.0b",
+		"1.0.1",
+		"1.01",
+		"1.1",
+		"1.9",
+		"1.10",
+		"2.0",
+		versionfmt.MaxVersion,
+	}
+	for i := range ordered {
+		for j := range ordered {
+			cmp, err := parser{}.Compare(ordered[i], ordered[j])
+			if assert.Nil(t, err) {
+				switch {
+				case i < j:
+					assert.Equal(t, -1, cmp, "%s < %s", ordered[i], ordered[j])
+				case i > j:
+					assert.Equal(t, 1, cmp, "%s > %s", ordered[i], ordered[j])
+				default:
+					assert.Equal(t, 0, cmp, "%s == %s", ordered[i], ordered[j])
+				}
+			}
+		}
+	}
+
+	// Missing revisions and suffix numbers are zeroes, and commit hashes are ignored.
+	for _, c := range [][2]string{{"1.0", "1.0-r0"}, {"1.0_rc", "1.0_rc0"}, {"1.0_git1~abc-r1", "1.0_git1-r1"}, {"1.010", "1.01"}} {
+		cmp, err := parser{}.Compare(c[0], c[1])
+		assert.Nil(t, err)
+		assert.Equal(t, 0, cmp, "%s == %s", c[0], c[1])
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package composer implements a versionfmt.Parser for the versions of the PHP packages installed
+// with Composer.
+package composer
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+// ParserName is the name by which the composer parser is registered.
+const ParserName = "composer"
+
+var (
+	errInvalidVersion = errors.New("composer: invalid version")
+
+	// versionRegexp matches the versions Composer normalizes, except branches and dates, as
+	// described by https://getcomposer.org/doc/articles/versions.md.
+	versionRegexp = regexp.MustCompile(`(?i)^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:\.(\d+))?(?:[._-]?(stable|beta|b|rc|alpha|a|patch|pl|p)((?:[.-]?\d+)*))?([.-]?dev)?(?:\+\S+)?$`)
+
+	// stabilities are the expanded forms of the stability modifiers.
+	stabilities = map[string]string{"a": "alpha", "b": "beta", "p": "patch", "pl": "patch", "rc": "RC"}
+
+	// specialForms are the orders of the special forms of version_compare, by prefix.
+	specialForms = []struct {
+		prefix string
+		order  int
+	}{
+		{"dev", 0}, {"alpha", 1}, {"a", 1}, {"beta", 2}, {"b", 2}, {"RC", 3}, {"rc", 3}, {"#", 4}, {"pl", 5}, {"p", 5},
+	}
+)
+
+// normalize returns the normalized form of a version, e.g. "1.2.0.0-beta1" for "v1.2-b1", as
+// Composer does before comparing versions.
+func normalize(str string) (string, error) {
+	str = strings.TrimSpace(str)
+	if str == versionfmt.MinVersion || str == versionfmt.MaxVersion {
+		return str, nil
+	}
+
+	m := versionRegexp.FindStringSubmatch(str)
+	if m == nil {
+		return "", errInvalidVersion
+	}
+
+	parts := make([]string, 4)
+	for i := range parts {
+		parts[i] = "0"
+		if m[i+1] != "" {
+			n, err := strconv.ParseUint(m[i+1], 10, 64)
+			if err != nil {
+				return "", errInvalidVersion
+			}
+			parts[i] = strconv.FormatUint(n, 10)
+		}
+	}
+	normalized := strings.Join(parts, ".")
+
+	if stability := strings.ToLower(m[5]); stability != "" && stability != "stable" {
+		if expanded, ok := stabilities[stability]; ok {
+			stability = expanded
+		}
+		normalized += "-" + stability + strings.TrimLeft(m[6], ".-")
+	}
+	if m[7] != "" {
+		normalized += "-dev"
+	}
+
+	return normalized, nil
+}
+
+type parser struct{}
+
+func (p parser) Valid(str string) bool {
+	_, err := normalize(str)
+	return err == nil
+}
+
+// Compare function compares two normalized versions with the algorithm of PHP's version_compare,
+// which Composer uses.
+func (p parser) Compare(a, b string) (int, error) {
+	v1, err := normalize(a)
+	if err != nil {
+		return 0, err
+	}
+
+	v2, err := normalize(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Quick check
+	if v1 == v2 {
+		return 0, nil
+	}
+
+	// Max/Min comparison
+	if v1 == versionfmt.MinVersion || v2 == versionfmt.MaxVersion {
+		return -1, nil
+	}
+	if v2 == versionfmt.MinVersion || v1 == versionfmt.MaxVersion {
+		return 1, nil
+	}
+
+	return versionCompare(canonicalize(v1), canonicalize(v2)), nil
+}
+
+// canonicalize splits a version into the parts compared by version_compare: the separators are
+// replaced by dots, and dots are inserted between digits and other characters.
+func canonicalize(v string) []string {
+	var parts []string
+	var current []rune
+	for _, r := range v {
+		switch {
+		case r == '.' || r == '-' || r == '_' || r == '+':
+			if len(current) > 0 {
+				parts = append(parts, string(current))
+				current = nil
+			}
+		case len(current) > 0 && unicode.IsDigit(current[0]) != unicode.IsDigit(r):
+			parts = append(parts, string(current))
+			current = []rune{r}
+		default:
+			current = append(current, r)
+		}
+	}
+	if len(current) > 0 {
+		parts = append(parts, string(current))
+	}
+	return parts
+}
+
+func versionCompare(p1, p2 []string) int {
+	for i := 0; i < len(p1) && i < len(p2); i++ {
+		if c := comparePart(p1[i], p2[i]); c != 0 {
+			return c
+		}
+	}
+
+	// A remaining number makes a version greater; other remaining parts are compared to a
+	// number.
+	switch {
+	case len(p1) > len(p2):
+		if isNumeric(p1[len(p2)]) {
+			return 1
+		}
+		return versionCompare(p1[len(p2):], []string{"#N#"})
+	case len(p1) < len(p2):
+		if isNumeric(p2[len(p1)]) {
+			return -1
+		}
+		return versionCompare([]string{"#N#"}, p2[len(p1):])
+	}
+	return 0
+}
+
+func comparePart(a, b string) int {
+	aNumeric, bNumeric := isNumeric(a), isNumeric(b)
+	switch {
+	case aNumeric && bNumeric:
+		na, _ := strconv.ParseUint(a, 10, 64)
+		nb, _ := strconv.ParseUint(b, 10, 64)
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	case aNumeric:
+		return compareSpecialForms("#N#", b)
+	case bNumeric:
+		return compareSpecialForms(a, "#N#")
+	}
+	return compareSpecialForms(a, b)
+}
+
+func compareSpecialForms(a, b string) int {
+	o1, o2 := specialFormOrder(a), specialFormOrder(b)
+	switch {
+	case o1 < o2:
+		return -1
+	case o1 > o2:
+		return 1
+	}
+	return 0
+}
+
+// specialFormOrder returns the order of a special form, the unknown ones being the lowest.
+func specialFormOrder(form string) int {
+	for _, f := range specialForms {
+		if strings.HasPrefix(form, f.prefix) {
+			return f.order
+		}
+	}
+	return -1
+}
+
+func isNumeric(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }) < 0
+}
+
+func init() {
+	versionfmt.RegisterParser(ParserName, parser{})
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+func TestNormalize(t *testing.T) {
+	for version, expected := range map[string]string{
+		"1.2.3":               "1.2.3.0",
+		"v1.2.3":              "1.2.3.0",
+		"1.2":                 "1.2.0.0",
+		"2.4.1.3":             "2.4.1.3",
+		"1.0.0-beta1":         "1.0.0.0-beta1",
+		"1.0.0-b.2":           "1.0.0.0-beta2",
+		"1.0.0RC1":            "1.0.0.0-RC1",
+		"1.0.0-alpha":         "1.0.0.0-alpha",
+		"1.0.0-stable":        "1.0.0.0",
+		"1.0.0-p1":            "1.0.0.0-patch1",
+		"1.0.x-dev":           "",
+		"1.0.0-dev":           "1.0.0.0-dev",
+		"1.0.0+20200101":      "1.0.0.0",
+		"dev-master":          "",
+		"not a version":       "",
+		versionfmt.MaxVersion: versionfmt.MaxVersion,
+	} {
+		normalized, err := normalize(version)
+		if expected == "" {
+			assert.Equal(t, errInvalidVersion, err, version)
+			continue
+		}
+		if assert.Nil(t, err, version) {
+			assert.Equal(t, expected, normalized, version)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{
+		versionfmt.MinVersion,
+		"1.0.0-dev",
+		"1.0.0-alpha1",
+		"1.0.0-alpha2",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-RC1",
+		"1.0.0",
+		"1.0.0-p1",
+		"1.0.1",
+		"1.0.1.1",
+		"1.2",
+		"v1.10.0",
+		"2.0.0",
+		versionfmt.MaxVersion,
+	}
+	for i := range ordered {
+		for j := range ordered {
+			cmp, err := parser{}.Compare(ordered[i], ordered[j])
+			if assert.Nil(t, err) {
+				switch {
+				case i < j:
+					assert.Equal(t, -1, cmp, "%s < %s", ordered[i], ordered[j])
+				case i > j:
+					assert.Equal(t, 1, cmp, "%s > %s", ordered[i], ordered[j])
+				default:
+					assert.Equal(t, 0, cmp, "%s == %s", ordered[i], ordered[j])
+				}
+			}
+		}
+	}
+
+	// Equivalent versions are equal.
+	cmp, err := parser{}.Compare("v1.2", "1.2.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, cmp)
+
+	_, err = parser{}.Compare("1.0.0", "dev-master")
+	assert.Equal(t, errInvalidVersion, err)
+}
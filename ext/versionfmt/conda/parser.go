@@ -0,0 +1,232 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conda implements a versionfmt.Parser for the versions of conda packages, which are
+// ordered as by conda's VersionOrder.
+package conda
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+// ParserName is the name by which the conda parser is registered.
+const ParserName = "conda"
+
+var errInvalidVersion = errors.New("conda: invalid version")
+
+// element is a run of digits or of other characters of a version component.
+type element struct {
+	// rank orders the kinds of elements: "dev" pre-releases, other strings, numbers and "post"
+	// releases.
+	rank   int
+	number uint64
+	str    string
+}
+
+const (
+	rankDev = iota
+	rankString
+	rankNumber
+	rankPost
+)
+
+type version struct {
+	epoch uint64
+	// release and local are the components of the version and of its local version, e.g.
+	// [[1] [2] [0 "rc" 1]] for "1.2.rc1".
+	release, local [][]element
+
+	// special is versionfmt.MinVersion or versionfmt.MaxVersion.
+	special string
+}
+
+// newVersion parses a version as "[epoch!]version[+local]".
+func newVersion(str string) (version, error) {
+	str = strings.TrimSpace(str)
+	if str == versionfmt.MinVersion || str == versionfmt.MaxVersion {
+		return version{special: str}, nil
+	}
+	str = strings.ToLower(str)
+
+	var v version
+	if i := strings.Index(str, "!"); i >= 0 {
+		var err error
+		if v.epoch, err = strconv.ParseUint(str[:i], 10, 64); err != nil {
+			return version{}, errInvalidVersion
+		}
+		str = str[i+1:]
+	}
+
+	var err error
+	if i := strings.Index(str, "+"); i >= 0 {
+		if v.local, err = parseComponents(str[i+1:]); err != nil {
+			return version{}, err
+		}
+		str = str[:i]
+	}
+	if v.release, err = parseComponents(str); err != nil {
+		return version{}, err
+	}
+
+	return v, nil
+}
+
+// parseComponents splits a version into components at dots and underscores, and every component
+// into elements. Components starting with a string get an implicit leading zero, so that e.g.
+// "1.rc1" is ordered like "1.0rc1".
+func parseComponents(str string) ([][]element, error) {
+	if str == "" {
+		return nil, errInvalidVersion
+	}
+
+	var components [][]element
+	for _, c := range strings.FieldsFunc(str, func(r rune) bool { return r == '.' || r == '_' }) {
+		var elements []element
+		for c != "" {
+			n := 0
+			digits := c[0] >= '0' && c[0] <= '9'
+			for n < len(c) && (c[n] >= '0' && c[n] <= '9') == digits {
+				if !digits && !(c[n] >= 'a' && c[n] <= 'z') {
+					return nil, errInvalidVersion
+				}
+				n++
+			}
+
+			e := element{str: c[:n]}
+			switch {
+			case digits:
+				var err error
+				if e.number, err = strconv.ParseUint(e.str, 10, 64); err != nil {
+					return nil, errInvalidVersion
+				}
+				e.rank = rankNumber
+			case e.str == "dev":
+				e.rank = rankDev
+			case e.str == "post":
+				e.rank = rankPost
+			default:
+				e.rank = rankString
+			}
+			if len(elements) == 0 && !digits {
+				elements = append(elements, element{rank: rankNumber})
+			}
+			elements = append(elements, e)
+			c = c[n:]
+		}
+		components = append(components, elements)
+	}
+	if len(components) == 0 {
+		return nil, errInvalidVersion
+	}
+
+	return components, nil
+}
+
+type parser struct{}
+
+func (p parser) Valid(str string) bool {
+	_, err := newVersion(str)
+	return err == nil
+}
+
+// Compare function compares two conda versions: epochs first, then versions and local versions
+// component by component, the missing components and elements being zeroes.
+func (p parser) Compare(a, b string) (int, error) {
+	v1, err := newVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	v2, err := newVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Max/Min comparison
+	if v1.special != "" || v2.special != "" {
+		switch {
+		case v1.special == v2.special:
+			return 0, nil
+		case v1.special == versionfmt.MinVersion || v2.special == versionfmt.MaxVersion:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+
+	if v1.epoch != v2.epoch {
+		if v1.epoch < v2.epoch {
+			return -1, nil
+		}
+		return 1, nil
+	}
+	if c := compareComponents(v1.release, v2.release); c != 0 {
+		return c, nil
+	}
+	return compareComponents(v1.local, v2.local), nil
+}
+
+func compareComponents(a, b [][]element) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var c1, c2 []element
+		if i < len(a) {
+			c1 = a[i]
+		}
+		if i < len(b) {
+			c2 = b[i]
+		}
+
+		for j := 0; j < len(c1) || j < len(c2); j++ {
+			e1, e2 := element{rank: rankNumber}, element{rank: rankNumber}
+			if j < len(c1) {
+				e1 = c1[j]
+			}
+			if j < len(c2) {
+				e2 = c2[j]
+			}
+			if c := compareElements(e1, e2); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func compareElements(a, b element) int {
+	switch {
+	case a.rank != b.rank:
+		if a.rank < b.rank {
+			return -1
+		}
+		return 1
+	case a.rank == rankNumber:
+		if a.number != b.number {
+			if a.number < b.number {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	default:
+		return strings.Compare(a.str, b.str)
+	}
+}
+
+func init() {
+	versionfmt.RegisterParser(ParserName, parser{})
+}
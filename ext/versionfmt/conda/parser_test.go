@@ -0,0 +1,89 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conda
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+func TestValid(t *testing.T) {
+	for _, v := range []string{"1", "1.2.3", "2022.07.19", "1.21.5", "1.0rc1", "1.0.DEV1", "1.1_2", "1!2.0", "1.0+cuda11.2", "0.4.1.post1", versionfmt.MinVersion, versionfmt.MaxVersion} {
+		assert.True(t, parser{}.Valid(v), v)
+	}
+	for _, v := range []string{"", "1.0-1", "a!1.0", "1.0+", "1.0 beta", "1.*", "..."} {
+		assert.False(t, parser{}.Valid(v), v)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Versions in increasing order, from the documentation of conda's VersionOrder.
+	ordered := []string{
+		versionfmt.MinVersion,
+		"0.4",
+		"0.4.1.rc",
+		"0.4.1",
+		"0.5a1",
+		"0.5b3",
+		"0.5c1",
+		"0.5",
+		"0.9.6",
+		"0.960923",
+		"1.0",
+		"1.1dev1",
+		"1.1a1",
+		"1.1.0dev1",
+		"1.1.a1",
+		"1.1.0rc1",
+		"1.1.0",
+		"1.1.0post1",
+		"1.1post1",
+		"1996.07.12",
+		"1!0.4.1",
+		"1!3.1.1.6",
+		"2!0.4.1",
+		versionfmt.MaxVersion,
+	}
+	for i := range ordered {
+		for j := range ordered {
+			cmp, err := parser{}.Compare(ordered[i], ordered[j])
+			if assert.Nil(t, err) {
+				switch {
+				case i < j:
+					assert.Equal(t, -1, cmp, "%s < %s", ordered[i], ordered[j])
+				case i > j:
+					assert.Equal(t, 1, cmp, "%s > %s", ordered[i], ordered[j])
+				default:
+					assert.Equal(t, 0, cmp, "%s == %s", ordered[i], ordered[j])
+				}
+			}
+		}
+	}
+
+	// Missing components are zeroes, underscores are dots and case is ignored.
+	for _, c := range [][2]string{{"1.1", "1.1.0"}, {"1.1_2", "1.1.2"}, {"1.0RC1", "1.0rc1"}, {"0!1.0", "1.0"}} {
+		cmp, err := parser{}.Compare(c[0], c[1])
+		assert.Nil(t, err)
+		assert.Equal(t, 0, cmp, "%s == %s", c[0], c[1])
+	}
+
+	// Local versions are compared after the versions.
+	cmp, err := parser{}.Compare("1.0+cuda10", "1.0+cuda11")
+	assert.Nil(t, err)
+	assert.Equal(t, -1, cmp)
+}
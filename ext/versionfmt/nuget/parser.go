@@ -0,0 +1,201 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nuget implements a versionfmt.Parser for the versions of NuGet packages, which follow
+// Semantic Versioning 2.0.0 with an optional fourth, revision, number.
+package nuget
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+// ParserName is the name by which the nuget parser is registered.
+const ParserName = "nuget"
+
+var errInvalidVersion = errors.New("nuget: invalid version")
+
+type version struct {
+	// numbers are the major, minor, patch and revision numbers, the missing ones being zero.
+	numbers    [4]uint64
+	prerelease []string
+
+	// special is versionfmt.MinVersion or versionfmt.MaxVersion.
+	special string
+}
+
+// newVersion parses a version, ignoring its build metadata. Like NuGet, it accepts from one to
+// four numbers with leading zeroes, so that "1.0", "1.0.0" and "1.00.0.0" are the same version.
+func newVersion(str string) (version, error) {
+	str = strings.TrimSpace(str)
+	if str == versionfmt.MinVersion || str == versionfmt.MaxVersion {
+		return version{special: str}, nil
+	}
+
+	if i := strings.Index(str, "+"); i >= 0 {
+		if !validIdentifiers(str[i+1:]) {
+			return version{}, errInvalidVersion
+		}
+		str = str[:i]
+	}
+
+	var v version
+	if i := strings.Index(str, "-"); i >= 0 {
+		if !validIdentifiers(str[i+1:]) {
+			return version{}, errInvalidVersion
+		}
+		// Pre-release labels are case insensitive.
+		v.prerelease = strings.Split(strings.ToLower(str[i+1:]), ".")
+		str = str[:i]
+	}
+
+	numbers := strings.Split(str, ".")
+	if len(numbers) > len(v.numbers) {
+		return version{}, errInvalidVersion
+	}
+	for i, n := range numbers {
+		if !isNumeric(n) {
+			return version{}, errInvalidVersion
+		}
+		var err error
+		if v.numbers[i], err = strconv.ParseUint(n, 10, 64); err != nil {
+			return version{}, errInvalidVersion
+		}
+	}
+
+	return v, nil
+}
+
+// validIdentifiers returns whether s is a valid list of dot-separated pre-release or build
+// identifiers.
+func validIdentifiers(s string) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, r := range id {
+			if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+type parser struct{}
+
+func (p parser) Valid(str string) bool {
+	_, err := newVersion(str)
+	return err == nil
+}
+
+// Compare function compares two NuGet versions according to
+// https://docs.microsoft.com/nuget/concepts/package-versioning.
+func (p parser) Compare(a, b string) (int, error) {
+	v1, err := newVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	v2, err := newVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Max/Min comparison
+	if v1.special != "" || v2.special != "" {
+		switch {
+		case v1.special == v2.special:
+			return 0, nil
+		case v1.special == versionfmt.MinVersion || v2.special == versionfmt.MaxVersion:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+
+	// Compare major, minor, patch and revision numbers
+	for i := range v1.numbers {
+		if v1.numbers[i] != v2.numbers[i] {
+			if v1.numbers[i] < v2.numbers[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+
+	// A pre-release version has a lower precedence than the normal version.
+	switch {
+	case len(v1.prerelease) == 0 && len(v2.prerelease) == 0:
+		return 0, nil
+	case len(v1.prerelease) == 0:
+		return 1, nil
+	case len(v2.prerelease) == 0:
+		return -1, nil
+	}
+
+	// Compare pre-release identifiers
+	for i := 0; i < len(v1.prerelease) && i < len(v2.prerelease); i++ {
+		if c := compareIdentifiers(v1.prerelease[i], v2.prerelease[i]); c != 0 {
+			return c, nil
+		}
+	}
+	switch {
+	case len(v1.prerelease) < len(v2.prerelease):
+		return -1, nil
+	case len(v1.prerelease) > len(v2.prerelease):
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// compareIdentifiers compares two pre-release identifiers: numeric ones numerically and with a
+// lower precedence than alphanumeric ones, which are compared lexically.
+func compareIdentifiers(a, b string) int {
+	aNumeric, bNumeric := isNumeric(a), isNumeric(b)
+	switch {
+	case aNumeric && bNumeric:
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func init() {
+	versionfmt.RegisterParser(ParserName, parser{})
+}
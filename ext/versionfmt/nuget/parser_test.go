@@ -0,0 +1,79 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nuget
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+func TestValid(t *testing.T) {
+	for _, v := range []string{"1", "1.0", "1.0.0", "1.0.0.0", "01.2.3", "1.0.0-alpha", "1.0.0-Beta.1", "1.0.0-beta1", "1.0.0+build", "1.0.0-rc.1+sha.5114f85", versionfmt.MinVersion, versionfmt.MaxVersion} {
+		assert.True(t, parser{}.Valid(v), v)
+	}
+	for _, v := range []string{"", "1.2.3.4.5", "v1.2.3", "1..2", "1.2.3-", "1.2.3-a..b", "1.2.3+", "1.2.3-a_b", "[1.0,2.0)", "a.b.c"} {
+		assert.False(t, parser{}.Valid(v), v)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{
+		versionfmt.MinVersion,
+		"0.9",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.0.1",
+		"1.0.1",
+		"1.2",
+		"1.10.0",
+		"2.0.0.0",
+		versionfmt.MaxVersion,
+	}
+	for i := range ordered {
+		for j := range ordered {
+			cmp, err := parser{}.Compare(ordered[i], ordered[j])
+			if assert.Nil(t, err) {
+				switch {
+				case i < j:
+					assert.Equal(t, -1, cmp, "%s < %s", ordered[i], ordered[j])
+				case i > j:
+					assert.Equal(t, 1, cmp, "%s > %s", ordered[i], ordered[j])
+				default:
+					assert.Equal(t, 0, cmp, "%s == %s", ordered[i], ordered[j])
+				}
+			}
+		}
+	}
+
+	// Missing numbers are zeroes, pre-release labels are case insensitive and build metadata is
+	// ignored.
+	for _, c := range [][2]string{{"1", "1.0.0.0"}, {"1.0", "01.00.000"}, {"1.0.0-RC.1", "1.0.0-rc.1"}, {"1.0.0-rc.01", "1.0.0-rc.1"}, {"1.0.0+build.1", "1.0.0+build.2"}} {
+		cmp, err := parser{}.Compare(c[0], c[1])
+		assert.Nil(t, err)
+		assert.Equal(t, 0, cmp, "%s == %s", c[0], c[1])
+	}
+
+	_, err := parser{}.Compare("1.0.0", "1.0.0.0.0")
+	assert.Equal(t, errInvalidVersion, err)
+}
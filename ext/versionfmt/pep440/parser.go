@@ -0,0 +1,270 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pep440 implements a versionfmt.Parser for the versions of Python packages, which are
+// ordered as specified by PEP 440 (https://peps.python.org/pep-0440).
+package pep440
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+// ParserName is the name by which the pep440 parser is registered.
+const ParserName = "pep440"
+
+var errInvalidVersion = errors.New("pep440: invalid version")
+
+// versionRegexp matches the versions that PEP 440 accepts before normalization, lowercased.
+var versionRegexp = regexp.MustCompile(`^v?` +
+	`(?:(?P<epoch>[0-9]+)!)?` +
+	`(?P<release>[0-9]+(?:\.[0-9]+)*)` +
+	`(?:[-_.]?(?P<pre>a|b|c|rc|alpha|beta|pre|preview)[-_.]?(?P<pre_n>[0-9]+)?)?` +
+	`(?:-(?P<post_n1>[0-9]+)|[-_.]?(?P<post>post|rev|r)[-_.]?(?P<post_n2>[0-9]+)?)?` +
+	`(?:[-_.]?(?P<dev>dev)[-_.]?(?P<dev_n>[0-9]+)?)?` +
+	`(?:\+(?P<local>[a-z0-9]+(?:[-_.][a-z0-9]+)*))?$`)
+
+// preReleases ranks the normalized pre-release phases.
+var preReleases = map[string]int{
+	"a": 0, "alpha": 0,
+	"b": 1, "beta": 1,
+	"c": 2, "rc": 2, "pre": 2, "preview": 2,
+}
+
+const (
+	// rankDevRelease orders the developmental releases of a final release, e.g. "1.0.dev1",
+	// before its pre-releases.
+	rankDevRelease = -1
+	// rankFinal orders the final releases, and their post-releases, after their pre-releases.
+	rankFinal = 3
+)
+
+type version struct {
+	epoch   uint64
+	release []uint64
+
+	// pre is the rank of the pre-release phase, or rankDevRelease or rankFinal, and preNumber
+	// its number.
+	pre       int
+	preNumber uint64
+
+	hasPost, hasDev       bool
+	postNumber, devNumber uint64
+
+	// local is the local version label, split at separators.
+	local []string
+
+	// special is versionfmt.MinVersion or versionfmt.MaxVersion.
+	special string
+}
+
+// newVersion parses a version, accepting the alternative spellings that PEP 440 normalizes,
+// e.g. "1.0-RC.1" for "1.0rc1".
+func newVersion(str string) (version, error) {
+	str = strings.TrimSpace(str)
+	if str == versionfmt.MinVersion || str == versionfmt.MaxVersion {
+		return version{special: str}, nil
+	}
+
+	m := versionRegexp.FindStringSubmatch(strings.ToLower(str))
+	if m == nil {
+		return version{}, errInvalidVersion
+	}
+	group := func(name string) string { return m[versionRegexp.SubexpIndex(name)] }
+	number := func(s string) (uint64, error) {
+		if s == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return 0, errInvalidVersion
+		}
+		return n, nil
+	}
+
+	var v version
+	var err error
+	if v.epoch, err = number(group("epoch")); err != nil {
+		return version{}, err
+	}
+
+	// Trailing zeroes don't matter, so that "1.0" and "1.0.0" are the same version.
+	for _, s := range strings.Split(group("release"), ".") {
+		n, err := number(s)
+		if err != nil {
+			return version{}, err
+		}
+		v.release = append(v.release, n)
+	}
+	for len(v.release) > 1 && v.release[len(v.release)-1] == 0 {
+		v.release = v.release[:len(v.release)-1]
+	}
+
+	if v.preNumber, err = number(group("pre_n")); err != nil {
+		return version{}, err
+	}
+	if group("post") != "" || group("post_n1") != "" {
+		v.hasPost = true
+		if v.postNumber, err = number(group("post_n1") + group("post_n2")); err != nil {
+			return version{}, err
+		}
+	}
+	if group("dev") != "" {
+		v.hasDev = true
+		if v.devNumber, err = number(group("dev_n")); err != nil {
+			return version{}, err
+		}
+	}
+	switch {
+	case group("pre") != "":
+		v.pre = preReleases[group("pre")]
+	case v.hasDev && !v.hasPost:
+		v.pre = rankDevRelease
+	default:
+		v.pre = rankFinal
+	}
+
+	if local := group("local"); local != "" {
+		v.local = strings.FieldsFunc(local, func(r rune) bool { return r == '.' || r == '-' || r == '_' })
+	}
+
+	return v, nil
+}
+
+type parser struct{}
+
+func (p parser) Valid(str string) bool {
+	_, err := newVersion(str)
+	return err == nil
+}
+
+// Compare function compares two PEP 440 versions: epochs and releases first, then pre-releases,
+// post-releases, developmental releases and local versions.
+func (p parser) Compare(a, b string) (int, error) {
+	v1, err := newVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	v2, err := newVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Max/Min comparison
+	if v1.special != "" || v2.special != "" {
+		switch {
+		case v1.special == v2.special:
+			return 0, nil
+		case v1.special == versionfmt.MinVersion || v2.special == versionfmt.MaxVersion:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+
+	if c := compareNumbers(v1.epoch, v2.epoch); c != 0 {
+		return c, nil
+	}
+	for i := 0; i < len(v1.release) || i < len(v2.release); i++ {
+		var n1, n2 uint64
+		if i < len(v1.release) {
+			n1 = v1.release[i]
+		}
+		if i < len(v2.release) {
+			n2 = v2.release[i]
+		}
+		if c := compareNumbers(n1, n2); c != 0 {
+			return c, nil
+		}
+	}
+
+	if v1.pre != v2.pre {
+		if v1.pre < v2.pre {
+			return -1, nil
+		}
+		return 1, nil
+	}
+	if c := compareNumbers(v1.preNumber, v2.preNumber); c != 0 {
+		return c, nil
+	}
+
+	// Versions without post-release come before the post-releases, and the ones without
+	// developmental release after the developmental releases.
+	if c := compareOptional(v1.hasPost, v2.hasPost, v1.postNumber, v2.postNumber, -1); c != 0 {
+		return c, nil
+	}
+	if c := compareOptional(v1.hasDev, v2.hasDev, v1.devNumber, v2.devNumber, 1); c != 0 {
+		return c, nil
+	}
+
+	return compareLocal(v1.local, v2.local), nil
+}
+
+func compareNumbers(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareOptional compares two optional numbers, returning missing if only the first one is
+// missing.
+func compareOptional(hasA, hasB bool, a, b uint64, missing int) int {
+	switch {
+	case hasA && hasB:
+		return compareNumbers(a, b)
+	case hasA:
+		return -missing
+	case hasB:
+		return missing
+	}
+	return 0
+}
+
+// compareLocal compares local versions segment by segment: numeric segments numerically and
+// after alphanumeric ones, which are compared lexically. A local version comes after the
+// versions it extends.
+func compareLocal(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		n1, err1 := strconv.ParseUint(a[i], 10, 64)
+		n2, err2 := strconv.ParseUint(b[i], 10, 64)
+		switch {
+		case err1 == nil && err2 == nil:
+			if c := compareNumbers(n1, n2); c != 0 {
+				return c
+			}
+		case err1 == nil:
+			return 1
+		case err2 == nil:
+			return -1
+		default:
+			if c := strings.Compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareNumbers(uint64(len(a)), uint64(len(b)))
+}
+
+func init() {
+	versionfmt.RegisterParser(ParserName, parser{})
+}
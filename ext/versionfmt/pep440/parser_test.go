@@ -0,0 +1,84 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pep440
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+func TestValid(t *testing.T) {
+	for _, v := range []string{"1", "1.2.3", "2023.10", "v1.0", "1!2.0", "1.0a1", "1.0-RC.1", "1.0.post1", "1.0-1", "1.0.dev", "1.0+ubuntu.1", versionfmt.MinVersion, versionfmt.MaxVersion} {
+		assert.True(t, parser{}.Valid(v), v)
+	}
+	for _, v := range []string{"", "a1", "1.0-", "1..0", "1.0+", "1.0 beta", "1.*", "1.0gamma1"} {
+		assert.False(t, parser{}.Valid(v), v)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Versions in increasing order, from the examples of PEP 440.
+	ordered := []string{
+		versionfmt.MinVersion,
+		"0.9",
+		"1.0.dev456",
+		"1.0a1",
+		"1.0a2.dev456",
+		"1.0a12.dev456",
+		"1.0a12",
+		"1.0b1.dev456",
+		"1.0b2",
+		"1.0b2.post345.dev456",
+		"1.0b2.post345",
+		"1.0rc1.dev456",
+		"1.0rc1",
+		"1.0",
+		"1.0+abc.5",
+		"1.0+abc.7",
+		"1.0+5",
+		"1.0.post456.dev34",
+		"1.0.post456",
+		"1.0.15",
+		"1.1.dev1",
+		"2023.10",
+		"1!0.1",
+		versionfmt.MaxVersion,
+	}
+	for i := range ordered {
+		for j := range ordered {
+			cmp, err := parser{}.Compare(ordered[i], ordered[j])
+			if assert.Nil(t, err) {
+				switch {
+				case i < j:
+					assert.Equal(t, -1, cmp, "%s < %s", ordered[i], ordered[j])
+				case i > j:
+					assert.Equal(t, 1, cmp, "%s > %s", ordered[i], ordered[j])
+				default:
+					assert.Equal(t, 0, cmp, "%s == %s", ordered[i], ordered[j])
+				}
+			}
+		}
+	}
+
+	// Versions are normalized before being compared.
+	for _, c := range [][2]string{{"1.0", "1.0.0"}, {"v1.0", "1.0"}, {"0!1.0", "1.0"}, {"1.0RC1", "1.0rc1"}, {"1.0-c.1", "1.0rc1"}, {"1.0alpha", "1.0a0"}, {"1.0-1", "1.0.post1"}, {"1.0.rev", "1.0.post0"}, {"1.0-dev", "1.0.dev0"}, {"1.0+ubuntu-1", "1.0+ubuntu.1"}} {
+		cmp, err := parser{}.Compare(c[0], c[1])
+		assert.Nil(t, err)
+		assert.Equal(t, 0, cmp, "%s == %s", c[0], c[1])
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpm
+
+import "testing"
+
+// FuzzVersion fuzzes the version parser, whose inputs come from the package databases of the
+// analyzed images. Any version that parses has to compare equal to itself.
+func FuzzVersion(f *testing.F) {
+	for _, seed := range []string{"0", "1:2.30-1.el7", "7.6p2-4.fc25", "1.0~rc1-1", "2.30^20180101git-1", "0:0-0:0-0"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, str string) {
+		if _, err := newVersion(str); err != nil {
+			return
+		}
+
+		cmp, err := parser{}.Compare(str, str)
+		if err != nil || cmp != 0 {
+			t.Errorf("a valid version doesn't compare equal to itself: %q", str)
+		}
+	})
+}
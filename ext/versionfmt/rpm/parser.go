@@ -74,7 +74,9 @@ func newVersion(str string) (version, error) {
 		} else {
 			return version{}, errors.New("epoch in version is not a number")
 		}
-		if intepoch < 0 {
+		// Atoi accepts "-0", which is still a negative epoch and would put the release
+		// separator before the version.
+		if intepoch < 0 || str[0] == '-' {
 			return version{}, errors.New("epoch in version is negative")
 		}
 	} else {
@@ -62,6 +62,8 @@ func TestParse(t *testing.T) {
 		{"0:0 0-1", version{}, true},
 		// Test version with negative epoch
 		{"-1:0-1", version{}, true},
+		{"-0:0-1", version{}, true},
+		{"-0:", version{}, true},
 		// Test invalid characters in epoch
 		{"a:0-0", version{}, true},
 		{"A:0-0", version{}, true},
@@ -0,0 +1,202 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package semver implements a versionfmt.Parser for Semantic Versioning 2.0.0 versions, as used
+// by language package registries such as crates.io.
+package semver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+// ParserName is the name by which the semver parser is registered.
+const ParserName = "semver"
+
+var errInvalidVersion = errors.New("semver: invalid version")
+
+type version struct {
+	major, minor, patch uint64
+	prerelease          []string
+
+	// special is versionfmt.MinVersion or versionfmt.MaxVersion.
+	special string
+}
+
+// newVersion parses a version, ignoring its build metadata.
+func newVersion(str string) (version, error) {
+	str = strings.TrimSpace(str)
+	if str == versionfmt.MinVersion || str == versionfmt.MaxVersion {
+		return version{special: str}, nil
+	}
+
+	if i := strings.Index(str, "+"); i >= 0 {
+		if !validIdentifiers(str[i+1:], false) {
+			return version{}, errInvalidVersion
+		}
+		str = str[:i]
+	}
+
+	var v version
+	if i := strings.Index(str, "-"); i >= 0 {
+		if !validIdentifiers(str[i+1:], true) {
+			return version{}, errInvalidVersion
+		}
+		v.prerelease = strings.Split(str[i+1:], ".")
+		str = str[:i]
+	}
+
+	core := strings.Split(str, ".")
+	if len(core) != 3 {
+		return version{}, errInvalidVersion
+	}
+	for i, n := range []*uint64{&v.major, &v.minor, &v.patch} {
+		if !isNumeric(core[i]) || (len(core[i]) > 1 && core[i][0] == '0') {
+			return version{}, errInvalidVersion
+		}
+		var err error
+		if *n, err = strconv.ParseUint(core[i], 10, 64); err != nil {
+			return version{}, errInvalidVersion
+		}
+	}
+
+	return v, nil
+}
+
+// validIdentifiers returns whether s is a valid list of dot-separated pre-release or build
+// identifiers.
+func validIdentifiers(s string, prerelease bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, r := range id {
+			if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+				return false
+			}
+		}
+		// Numeric pre-release identifiers must not have leading zeroes.
+		if prerelease && len(id) > 1 && id[0] == '0' && isNumeric(id) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+type parser struct{}
+
+func (p parser) Valid(str string) bool {
+	_, err := newVersion(str)
+	return err == nil
+}
+
+// Compare function compares two semantic versions according to the precedence rules of
+// https://semver.org/spec/v2.0.0.html#spec-item-11.
+func (p parser) Compare(a, b string) (int, error) {
+	v1, err := newVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	v2, err := newVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Max/Min comparison
+	if v1.special != "" || v2.special != "" {
+		switch {
+		case v1.special == v2.special:
+			return 0, nil
+		case v1.special == versionfmt.MinVersion || v2.special == versionfmt.MaxVersion:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+
+	// Compare major, minor and patch versions
+	for _, c := range [][2]uint64{{v1.major, v2.major}, {v1.minor, v2.minor}, {v1.patch, v2.patch}} {
+		if c[0] != c[1] {
+			if c[0] < c[1] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+
+	// A pre-release version has a lower precedence than the normal version.
+	switch {
+	case len(v1.prerelease) == 0 && len(v2.prerelease) == 0:
+		return 0, nil
+	case len(v1.prerelease) == 0:
+		return 1, nil
+	case len(v2.prerelease) == 0:
+		return -1, nil
+	}
+
+	// Compare pre-release identifiers
+	for i := 0; i < len(v1.prerelease) && i < len(v2.prerelease); i++ {
+		if c := compareIdentifiers(v1.prerelease[i], v2.prerelease[i]); c != 0 {
+			return c, nil
+		}
+	}
+	switch {
+	case len(v1.prerelease) < len(v2.prerelease):
+		return -1, nil
+	case len(v1.prerelease) > len(v2.prerelease):
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// compareIdentifiers compares two pre-release identifiers: numeric ones numerically and with a
+// lower precedence than alphanumeric ones, which are compared lexically.
+func compareIdentifiers(a, b string) int {
+	aNumeric, bNumeric := isNumeric(a), isNumeric(b)
+	switch {
+	case aNumeric && bNumeric:
+		// Identifiers don't have leading zeroes, so longer is bigger.
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func init() {
+	versionfmt.RegisterParser(ParserName, parser{})
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health aggregates the health of the services of Clair, such as the datastore, the
+// updater and the notifier, which register a Checker when they start.
+package health
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/database"
+)
+
+// Reasons of the services that aren't healthy, which the services may complement with their own.
+const (
+	// ReasonTimeout means that the service didn't report its health in time.
+	ReasonTimeout = "timeout"
+	// ReasonUnreachable means that the datastore could not be queried.
+	ReasonUnreachable = "unreachable"
+	// ReasonMigrating means that the schema of the datastore is being migrated.
+	ReasonMigrating = "migrating"
+	// ReasonDegraded means that the datastore reported itself as degraded.
+	ReasonDegraded = "degraded"
+)
+
+// severity ranks the health states so that the worst one can be reported as the overall state.
+var severity = map[database.HealthState]int{
+	database.Healthy:   0,
+	database.Degraded:  1,
+	database.Unhealthy: 2,
+}
+
+// Status is the health of a service. Reason is a short machine-readable explanation of why the
+// service isn't healthy, e.g. "unreachable", and Message its human-readable details.
+type Status struct {
+	State   database.HealthState
+	Reason  string
+	Message string
+	Version string
+	Latency time.Duration
+}
+
+// A Checker reports the health of a service. It should return once the context is done.
+type Checker func(ctx context.Context) Status
+
+type service struct {
+	checker Checker
+	// readinessOnly services are only required to serve requests, and aren't checked for liveness.
+	readinessOnly bool
+}
+
+var (
+	servicesM sync.RWMutex
+	services  = make(map[string]service)
+)
+
+// Register makes the health of a service available by the provided name, replacing the Checker
+// previously registered with the name, if any.
+//
+// The services that Clair depends on to serve requests but that restarting it can't fix, such as
+// the datastore, are readinessOnly: they only affect the readiness of Clair, not its liveness.
+func Register(name string, checker Checker, readinessOnly bool) {
+	if checker == nil {
+		panic("health: could not register a nil Checker")
+	}
+
+	servicesM.Lock()
+	defer servicesM.Unlock()
+	services[name] = service{checker: checker, readinessOnly: readinessOnly}
+}
+
+// Unregister removes the Checker of the service of the given name, e.g. once it stopped.
+func Unregister(name string) {
+	servicesM.Lock()
+	defer servicesM.Unlock()
+	delete(services, name)
+}
+
+// Report is the health of every service checked, and their overall state: the worst of theirs.
+// Reason is the reason of the service in the worst state, prefixed by its name, e.g.
+// "database/unreachable", and is empty when every service is healthy.
+type Report struct {
+	State    database.HealthState
+	Reason   string
+	Services map[string]Status
+}
+
+// Ready returns whether Clair can serve requests: none of the services checked is unhealthy.
+func (r Report) Ready() bool {
+	return r.State != database.Unhealthy
+}
+
+// Check returns the health of the registered services, checked concurrently. Only the ones that
+// aren't readinessOnly are checked when liveness is true. The services that haven't reported
+// their health once the context is done are unhealthy.
+func Check(ctx context.Context, liveness bool) Report {
+	servicesM.RLock()
+	checked := make(map[string]Checker)
+	for name, s := range services {
+		if !liveness || !s.readinessOnly {
+			checked[name] = s.checker
+		}
+	}
+	servicesM.RUnlock()
+
+	type result struct {
+		name   string
+		status Status
+	}
+	results := make(chan result, len(checked))
+	for name, checker := range checked {
+		go func(name string, checker Checker) {
+			start := time.Now()
+			status := checker(ctx)
+			if status.Latency == 0 {
+				status.Latency = time.Since(start)
+			}
+			results <- result{name, status}
+		}(name, checker)
+	}
+
+	report := Report{State: database.Healthy, Services: make(map[string]Status)}
+	for len(report.Services) < len(checked) {
+		select {
+		case r := <-results:
+			report.Services[r.name] = r.status
+		case <-ctx.Done():
+			for name := range checked {
+				if _, ok := report.Services[name]; !ok {
+					report.Services[name] = Status{State: database.Unhealthy, Reason: ReasonTimeout, Message: ctx.Err().Error()}
+				}
+			}
+		}
+	}
+
+	// Report the first service in the worst state, by name, so that the reason is stable.
+	names := make([]string, 0, len(report.Services))
+	for name := range report.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		status := report.Services[name]
+		if severity[status.State] > severity[report.State] {
+			report.State = status.State
+			report.Reason = name + "/" + status.Reason
+		}
+	}
+
+	return report
+}
+
+// CheckDatastore returns a Checker of the health of the given datastore.
+func CheckDatastore(datastore database.Datastore) Checker {
+	return func(ctx context.Context) Status {
+		dbStatus, err := datastore.Health(ctx)
+		status := Status{
+			State:   dbStatus.State,
+			Message: dbStatus.Message,
+			Version: dbStatus.Version,
+			Latency: dbStatus.Latency,
+		}
+
+		switch {
+		case err == database.ErrMigrationInProgress:
+			status.State, status.Reason = database.Unhealthy, ReasonMigrating
+		case err != nil:
+			status.State, status.Reason = database.Unhealthy, ReasonUnreachable
+		case status.State == database.Degraded:
+			status.Reason = ReasonDegraded
+		}
+		if err != nil && status.Message == "" {
+			status.Message = err.Error()
+		}
+		return status
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/database"
+)
+
+func register(name string, status Status, readinessOnly bool) {
+	Register(name, func(context.Context) Status { return status }, readinessOnly)
+}
+
+func TestCheck(t *testing.T) {
+	defer func() {
+		for _, name := range []string{"database", "notifier", "updater", "stuck"} {
+			Unregister(name)
+		}
+	}()
+
+	register("database", Status{State: database.Healthy, Version: "9.6"}, true)
+	register("notifier", Status{State: database.Healthy}, false)
+	report := Check(context.Background(), false)
+	assert.Equal(t, database.Healthy, report.State)
+	assert.Empty(t, report.Reason)
+	assert.Len(t, report.Services, 2)
+	assert.Equal(t, "9.6", report.Services["database"].Version)
+
+	// The worst state is reported, with the reason of its service.
+	register("updater", Status{State: database.Degraded, Reason: "stale"}, false)
+	register("database", Status{State: database.Unhealthy, Reason: ReasonUnreachable}, true)
+	report = Check(context.Background(), false)
+	assert.Equal(t, database.Unhealthy, report.State)
+	assert.Equal(t, "database/unreachable", report.Reason)
+	assert.False(t, report.Ready())
+
+	// The liveness doesn't depend on the readinessOnly services.
+	report = Check(context.Background(), true)
+	assert.Equal(t, database.Degraded, report.State)
+	assert.Equal(t, "updater/stale", report.Reason)
+	assert.True(t, report.Ready())
+	assert.Len(t, report.Services, 2)
+
+	// The services that don't report their health in time are unhealthy.
+	Unregister("database")
+	block := make(chan struct{})
+	defer close(block)
+	Register("stuck", func(ctx context.Context) Status {
+		<-block
+		return Status{State: database.Healthy}
+	}, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	report = Check(ctx, false)
+	assert.Equal(t, "stuck/timeout", report.Reason)
+	assert.Equal(t, database.Degraded, report.Services["updater"].State)
+}
+
+func TestCheckDatastore(t *testing.T) {
+	var status database.HealthStatus
+	var err error
+	check := CheckDatastore(&database.MockDatastore{
+		FctHealth: func(context.Context) (database.HealthStatus, error) {
+			return status, err
+		},
+	})
+
+	status = database.HealthStatus{State: database.Degraded, Latency: time.Second}
+	s := check(context.Background())
+	assert.Equal(t, Status{State: database.Degraded, Reason: ReasonDegraded, Latency: time.Second}, s)
+
+	status, err = database.HealthStatus{}, errors.New("connection refused")
+	s = check(context.Background())
+	assert.Equal(t, Status{State: database.Unhealthy, Reason: ReasonUnreachable, Message: "connection refused"}, s)
+
+	err = database.ErrMigrationInProgress
+	assert.Equal(t, ReasonMigrating, check(context.Background()).Reason)
+}
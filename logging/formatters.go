@@ -0,0 +1,107 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+// jsonFormatter writes every entry as a JSON object on its own line, with its fields along with
+// the "time", "level", "component" and "msg" keys.
+type jsonFormatter struct {
+	w io.Writer
+}
+
+func newJSONFormatter(w io.Writer) capnslog.Formatter {
+	return &jsonFormatter{w: w}
+}
+
+func (f *jsonFormatter) Format(pkg string, level capnslog.LogLevel, depth int, entries ...interface{}) {
+	e := entryOf(entries)
+	object := make(map[string]interface{}, len(e.fields)+4)
+	for name, value := range e.fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		object[name] = value
+	}
+	object["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	object["level"] = strings.ToLower(level.String())
+	object["component"] = pkg
+	object["msg"] = e.message
+
+	line, err := json.Marshal(object)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{
+			"time":      object["time"].(string),
+			"level":     object["level"].(string),
+			"component": pkg,
+			"msg":       e.String(),
+		})
+	}
+	f.w.Write(append(line, '\n'))
+}
+
+func (f *jsonFormatter) Flush() {}
+
+// logfmtFormatter writes every entry as a line of key=value pairs: "time", "level", "component"
+// and "msg" followed by its fields.
+type logfmtFormatter struct {
+	w io.Writer
+}
+
+func newLogfmtFormatter(w io.Writer) capnslog.Formatter {
+	return &logfmtFormatter{w: w}
+}
+
+func (f *logfmtFormatter) Format(pkg string, level capnslog.LogLevel, depth int, entries ...interface{}) {
+	e := entryOf(entries)
+	var b bytes.Buffer
+	writePair(&b, "time", time.Now().UTC().Format(time.RFC3339Nano))
+	b.WriteByte(' ')
+	writePair(&b, "level", strings.ToLower(level.String()))
+	b.WriteByte(' ')
+	writePair(&b, "component", pkg)
+	b.WriteByte(' ')
+	writePair(&b, "msg", e.message)
+	for _, name := range sortedNames(e.fields) {
+		b.WriteByte(' ')
+		writePair(&b, name, e.fields[name])
+	}
+	b.WriteByte('\n')
+	f.w.Write(b.Bytes())
+}
+
+func (f *logfmtFormatter) Flush() {}
+
+// writePair writes a key=value pair, quoting the value if it is empty or contains spaces, quotes
+// or equal signs.
+func writePair(b *bytes.Buffer, name string, value interface{}) {
+	s := fmt.Sprint(value)
+	b.WriteString(name)
+	b.WriteByte('=')
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		s = strconv.Quote(s)
+	}
+	b.WriteString(s)
+}
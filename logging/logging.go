@@ -0,0 +1,214 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging provides structured logs on top of capnslog: loggers whose entries carry fields,
+// e.g. the name of the layer being analyzed, and the formats that the logs are written in, such
+// as JSON or logfmt, so that they can be shipped to log aggregators.
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+// repo is the capnslog repository of the components of Clair.
+const repo = "github.com/coreos/clair"
+
+// DefaultFormat is the format of the logs unless another one is configured.
+const DefaultFormat = "text"
+
+// Fields are the context of a log entry, by name, e.g. "layer" or "vulnerability".
+type Fields map[string]interface{}
+
+// Logger logs the entries of a component, along with its fields.
+type Logger struct {
+	pkg    *capnslog.PackageLogger
+	fields Fields
+}
+
+// New returns the Logger of the given component, e.g. "worker", whose level can be configured
+// separately.
+func New(component string) *Logger {
+	return &Logger{pkg: capnslog.NewPackageLogger(repo, component)}
+}
+
+// With returns a Logger adding the given fields to the ones of this one.
+func (l *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for name, value := range l.fields {
+		merged[name] = value
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+	return &Logger{pkg: l.pkg, fields: merged}
+}
+
+func (l *Logger) log(level capnslog.LogLevel, message string) {
+	e := entry{message: message, fields: l.fields}
+	switch level {
+	case capnslog.TRACE:
+		l.pkg.Trace(e)
+	case capnslog.DEBUG:
+		l.pkg.Debug(e)
+	case capnslog.INFO:
+		l.pkg.Info(e)
+	case capnslog.WARNING:
+		l.pkg.Warning(e)
+	case capnslog.ERROR:
+		l.pkg.Error(e)
+	}
+}
+
+func (l *Logger) logf(level capnslog.LogLevel, format string, args ...interface{}) {
+	if l.pkg.LevelAt(level) {
+		l.log(level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *Logger) Tracef(format string, args ...interface{}) { l.logf(capnslog.TRACE, format, args...) }
+func (l *Logger) Debugf(format string, args ...interface{}) { l.logf(capnslog.DEBUG, format, args...) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.logf(capnslog.INFO, format, args...) }
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.logf(capnslog.WARNING, format, args...)
+}
+func (l *Logger) Errorf(format string, args ...interface{}) { l.logf(capnslog.ERROR, format, args...) }
+
+func (l *Logger) Debug(args ...interface{}) { l.logf(capnslog.DEBUG, "%s", fmt.Sprint(args...)) }
+func (l *Logger) Info(args ...interface{})  { l.logf(capnslog.INFO, "%s", fmt.Sprint(args...)) }
+
+// Fatalf logs a critical entry and exits.
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.pkg.Fatal(entry{message: fmt.Sprintf(format, args...), fields: l.fields})
+}
+
+// entry is a message along with its fields, as passed to the formatters.
+type entry struct {
+	message string
+	fields  Fields
+}
+
+// String renders the entry for the formatters that aren't structured, e.g. the capnslog ones.
+func (e entry) String() string {
+	var b bytes.Buffer
+	b.WriteString(e.message)
+	for _, name := range sortedNames(e.fields) {
+		b.WriteByte(' ')
+		writePair(&b, name, e.fields[name])
+	}
+	return b.String()
+}
+
+// entryOf returns the entry that a component logged, whether through a Logger or directly
+// through capnslog.
+func entryOf(entries []interface{}) entry {
+	if len(entries) == 1 {
+		if e, ok := entries[0].(entry); ok {
+			return e
+		}
+	}
+	return entry{message: strings.TrimRight(fmt.Sprint(entries...), "\n")}
+}
+
+func sortedNames(fields Fields) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A FormatterFunc returns a capnslog.Formatter writing the logs to the given writer in some
+// format.
+type FormatterFunc func(w io.Writer) capnslog.Formatter
+
+var (
+	formatsM sync.RWMutex
+	formats  = map[string]FormatterFunc{
+		"text":   func(w io.Writer) capnslog.Formatter { return capnslog.NewPrettyFormatter(w, false) },
+		"json":   newJSONFormatter,
+		"logfmt": newLogfmtFormatter,
+	}
+)
+
+// RegisterFormat makes a format of the logs available by the provided name.
+//
+// If called twice with the same name, the name is blank, or if the provided FormatterFunc is nil,
+// this function panics.
+func RegisterFormat(name string, f FormatterFunc) {
+	if name == "" {
+		panic("logging: could not register a format with an empty name")
+	}
+	if f == nil {
+		panic("logging: could not register a nil FormatterFunc")
+	}
+
+	formatsM.Lock()
+	defer formatsM.Unlock()
+
+	if _, dup := formats[name]; dup {
+		panic("logging: RegisterFormat called twice for " + name)
+	}
+	formats[name] = f
+}
+
+// Configure writes the logs to the given writer in the given format, or DefaultFormat if it is
+// empty, and sets the level of every component, e.g. "debug", before the levels of some components
+// by name. Only the components whose Logger already exists are configured, which is the case of
+// the package variables once the program starts.
+func Configure(w io.Writer, format, level string, levels map[string]string) error {
+	if format == "" {
+		format = DefaultFormat
+	}
+	formatsM.RLock()
+	f, ok := formats[format]
+	formatsM.RUnlock()
+	if !ok {
+		return fmt.Errorf("logging: unknown format %q", format)
+	}
+
+	l, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	componentLevels := make(map[string]capnslog.LogLevel, len(levels))
+	for component, level := range levels {
+		componentLevels[component], err = parseLevel(level)
+		if err != nil {
+			return err
+		}
+	}
+
+	capnslog.SetFormatter(f(w))
+	capnslog.SetGlobalLogLevel(l)
+	if r, err := capnslog.GetRepoLogger(repo); err == nil {
+		r.SetLogLevel(componentLevels)
+	}
+	return nil
+}
+
+func parseLevel(level string) (capnslog.LogLevel, error) {
+	l, err := capnslog.ParseLevel(strings.ToUpper(level))
+	if err != nil {
+		return l, fmt.Errorf("logging: unknown level %q", level)
+	}
+	return l, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONFormat(t *testing.T) {
+	// The components are configured once their loggers are created, like the package variables.
+	log, debug := New("test/json").With(Fields{"layer": "sha256:abc"}), New("test/debug")
+	var buf bytes.Buffer
+	assert.Nil(t, Configure(&buf, "json", "info", map[string]string{"test/debug": "debug"}))
+
+	// The fields of the loggers are merged, and the entries below the level are dropped.
+	log.With(Fields{"error": errors.New("timeout")}).Warningf("could not analyze %d files", 2)
+	log.Debugf("dropped")
+	debug.Debugf("kept")
+
+	// The entries logged directly through capnslog have no field.
+	capnslog.NewPackageLogger(repo, "test/capnslog").Infof("started\n")
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var object map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &object), line)
+		lines = append(lines, object)
+	}
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, "warning", lines[0]["level"])
+		assert.Equal(t, "test/json", lines[0]["component"])
+		assert.Equal(t, "could not analyze 2 files", lines[0]["msg"])
+		assert.Equal(t, "sha256:abc", lines[0]["layer"])
+		assert.Equal(t, "timeout", lines[0]["error"])
+		assert.NotEmpty(t, lines[0]["time"])
+
+		assert.Equal(t, "debug", lines[1]["level"])
+		assert.Equal(t, "kept", lines[1]["msg"])
+
+		assert.Equal(t, "started", lines[2]["msg"])
+		assert.Equal(t, "test/capnslog", lines[2]["component"])
+	}
+}
+
+func TestLogfmtFormat(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, Configure(&buf, "logfmt", "info", nil))
+
+	New("test/logfmt").With(Fields{"notification": "abc", "notifier": "slack"}).Infof("sent the notification")
+	line := strings.TrimSpace(buf.String())
+	assert.Contains(t, line, ` level=info component=test/logfmt msg="sent the notification" notification=abc notifier=slack`)
+	assert.True(t, strings.HasPrefix(line, "time="))
+}
+
+func TestConfigure(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NotNil(t, Configure(&buf, "xml", "info", nil))
+	assert.NotNil(t, Configure(&buf, "json", "verbose", nil))
+	assert.NotNil(t, Configure(&buf, "json", "info", map[string]string{"worker": "verbose"}))
+
+	// The default format renders the fields after the message.
+	assert.Nil(t, Configure(&buf, "", "info", nil))
+	New("test/text").With(Fields{"layer": "a b"}).Infof("processing")
+	assert.Contains(t, buf.String(), `processing layer="a b"`)
+}
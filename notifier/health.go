@@ -0,0 +1,72 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/health"
+)
+
+const (
+	// reasonDatastoreErrors means that the notifications could not be looked for the last time.
+	reasonDatastoreErrors = "datastore_errors"
+	// reasonDeliveryFailed means that the last notification handled could not be delivered.
+	reasonDeliveryFailed = "delivery_failed"
+)
+
+// status tracks the state of the notifier that its health is made of.
+var status struct {
+	sync.Mutex
+	datastoreFailing bool
+	deliveryFailing  bool
+}
+
+// setDatastoreFailing records whether the datastore failed the last time the notifier looked for
+// a notification.
+func setDatastoreFailing(failing bool) {
+	status.Lock()
+	defer status.Unlock()
+	status.datastoreFailing = failing
+}
+
+// recordOutcome records whether the last notification handled could be delivered.
+func recordOutcome(o outcome) {
+	if o == interrupted {
+		return
+	}
+
+	status.Lock()
+	defer status.Unlock()
+	status.deliveryFailing = o != delivered
+}
+
+// checkHealth is the Checker of the notifier, which is degraded when the datastore failed the
+// last time it was queried, or when the last notification handled could not be delivered.
+func checkHealth(ctx context.Context) health.Status {
+	status.Lock()
+	defer status.Unlock()
+
+	switch {
+	case status.datastoreFailing:
+		return health.Status{State: database.Degraded, Reason: reasonDatastoreErrors, Message: "could not look for notifications to send"}
+	case status.deliveryFailing:
+		return health.Status{State: database.Degraded, Reason: reasonDeliveryFailed, Message: "could not deliver the last notification"}
+	}
+	return health.Status{State: database.Healthy}
+}
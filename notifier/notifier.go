@@ -17,15 +17,19 @@
 package notifier
 
 import (
+	"errors"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/coreos/pkg/capnslog"
 	"github.com/coreos/pkg/timeutil"
 	"github.com/pborman/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/coreos/clair/config"
 	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/health"
+	"github.com/coreos/clair/logging"
 	"github.com/coreos/clair/utils"
 	cerrors "github.com/coreos/clair/utils/errors"
 )
@@ -34,11 +38,61 @@ const (
 	checkInterval       = 5 * time.Minute
 	refreshLockDuration = time.Minute * 2
 	lockDuration        = time.Minute*8 + refreshLockDuration
-	maxBackOff          = 15 * time.Minute
 )
 
+// outcome is the result of the handling of a notification by a worker.
+type outcome int
+
+const (
+	// delivered means that every notifier delivered the notification, or held it.
+	delivered outcome = iota
+	// exhausted means that a delivery failed as many times as the retryPolicy allows, in which case
+	// the notification is marked as failed.
+	exhausted
+	// errored means that the notification couldn't be handled, e.g. because the datastore failed,
+	// in which case it is released to be handled again.
+	errored
+	// interrupted means that Clair stopped while the notification was handled.
+	interrupted
+)
+
+// retryPolicy is how the failed deliveries are retried: up to attempts times, waiting backOff,
+// doubled after each attempt up to maxBackOff, before every retry.
+type retryPolicy struct {
+	attempts            int
+	backOff, maxBackOff time.Duration
+}
+
+func newRetryPolicy(config *config.NotifierConfig) retryPolicy {
+	policy := retryPolicy{attempts: config.Attempts, backOff: config.BackOff, maxBackOff: config.MaxBackOff}
+	if policy.attempts < 1 {
+		policy.attempts = 1
+	}
+	if policy.backOff <= 0 {
+		policy.backOff = time.Second
+	}
+	if policy.maxBackOff < policy.backOff {
+		policy.maxBackOff = policy.backOff
+	}
+	return policy
+}
+
+// next returns how long to wait before the retry following the one that waited prev.
+func (p retryPolicy) next(prev time.Duration) time.Duration {
+	if prev == 0 {
+		return p.backOff
+	}
+	if prev > p.maxBackOff/2 {
+		return p.maxBackOff
+	}
+	return 2 * prev
+}
+
 var (
-	log = capnslog.NewPackageLogger("github.com/coreos/clair", "notifier")
+	// errHeld is recorded as the outcome of the deliveries held during a maintenance window.
+	errHeld = errors.New("held during a maintenance window")
+
+	log = logging.New("notifier")
 
 	notifiers = make(map[string]Notifier)
 
@@ -51,6 +105,21 @@ var (
 		Name: "clair_notifier_backend_errors_total",
 		Help: "Number of errors that notifier backends generated.",
 	}, []string{"backend"})
+
+	promNotifierLaneLatencyMilliseconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "clair_notifier_lane_latency_milliseconds",
+		Help: "Time it takes to send a notification after it's been created, per priority lane.",
+	}, []string{"priority"})
+
+	promNotifierLaneNotificationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clair_notifier_lane_notifications_total",
+		Help: "Number of notifications handled by the notifier, per priority lane and outcome.",
+	}, []string{"priority", "outcome"})
+
+	promNotifierBusyWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "clair_notifier_busy_workers",
+		Help: "Number of notifications being delivered concurrently.",
+	})
 )
 
 // Notifier represents anything that can transmit notifications.
@@ -62,9 +131,51 @@ type Notifier interface {
 	Send(notification database.VulnerabilityNotification) error
 }
 
+// IdempotentNotifier is a Notifier that is able to forward the key of a delivery to its receiver.
+// As the key stays the same when a delivery is retried, even after a crash, the receiver can use it
+// to deduplicate notifications.
+type IdempotentNotifier interface {
+	Notifier
+	// SendWithKey informs the existence of the specified notification along with the key of the
+	// delivery.
+	SendWithKey(notification database.VulnerabilityNotification, key string) error
+}
+
+// DatastoreNotifier is a Notifier that queries the datastore about the notifications it sends, e.g.
+// to find the images they affect.
+type DatastoreNotifier interface {
+	Notifier
+	// SetDatastore gives the notifier access to the datastore, before it is configured.
+	SetDatastore(database.Datastore)
+}
+
+// ChannelNotifier is a Notifier that is able to deliver notifications to named channels, e.g. the
+// chat rooms of several teams, to which notifications are routed by the labels of the images they
+// affect.
+type ChannelNotifier interface {
+	Notifier
+	// HasChannel returns whether the notifier is able to deliver to the specified channel.
+	HasChannel(channel string) bool
+	// SendToChannel informs the specified channel of the existence of the notification, along with
+	// the key of the delivery.
+	SendToChannel(notification database.VulnerabilityNotification, channel, key string) error
+}
+
+// DigestNotifier is a Notifier that is able to deliver several notifications at once, e.g. the ones
+// held during a maintenance window. Held notifications are delivered one by one otherwise.
+type DigestNotifier interface {
+	Notifier
+	// SendDigest informs the specified channel, or the default destination if it is empty, of the
+	// existence of the notifications, along with the key of the digest.
+	SendDigest(notifications []database.VulnerabilityNotification, channel, key string) error
+}
+
 func init() {
 	prometheus.MustRegister(promNotifierLatencyMilliseconds)
 	prometheus.MustRegister(promNotifierBackendErrorsTotal)
+	prometheus.MustRegister(promNotifierLaneLatencyMilliseconds)
+	prometheus.MustRegister(promNotifierLaneNotificationsTotal)
+	prometheus.MustRegister(promNotifierBusyWorkers)
 }
 
 // RegisterNotifier makes a Fetcher available by the provided name.
@@ -92,6 +203,9 @@ func Run(config *config.NotifierConfig, datastore database.Datastore, stopper *u
 
 	// Configure registered notifiers.
 	for notifierName, notifier := range notifiers {
+		if dn, ok := notifier.(DatastoreNotifier); ok {
+			dn.SetDatastore(datastore)
+		}
 		if configured, err := notifier.Configure(config); configured {
 			log.Infof("notifier '%s' configured\n", notifierName)
 		} else {
@@ -102,16 +216,61 @@ func Run(config *config.NotifierConfig, datastore database.Datastore, stopper *u
 		}
 	}
 
+	// Reject the options that no notifier has, e.g. misspelled ones, rather than ignoring them.
+	if config != nil {
+		if unknown := config.UnknownParams(nil); len(unknown) > 0 {
+			log.Fatalf("unknown notifier options: %s", strings.Join(unknown, ", "))
+		}
+	}
+
 	// Do not run the updater if there is no notifier enabled.
 	if len(notifiers) == 0 {
 		log.Infof("notifier service is disabled")
 		return
 	}
 
+	routes = config.Routes
+	for _, channel := range unknownChannels(routes) {
+		log.Warningf("no notifier has the channel '%s' that notifications are routed to", channel)
+	}
+
+	var err error
+	if maintenanceWindows, err = parseMaintenanceWindows(config.MaintenanceWindows); err != nil {
+		log.Fatalf("could not parse the maintenance windows: %s", err)
+	}
+
+	workers := config.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	policy := newRetryPolicy(config)
+
 	whoAmI := uuid.New()
-	log.Infof("notifier service started. lock identifier: %s\n", whoAmI)
+	log.Infof("notifier service started. lock identifier: %s, workers: %d\n", whoAmI, workers)
+	health.Register("notifier", checkHealth, false)
+	defer health.Unregister("notifier")
+
+	// A notification is only fetched once a worker is available, so slow receivers throttle the
+	// notifier rather than piling up locked notifications.
+	slots := make(chan struct{}, workers)
+	var inFlight sync.WaitGroup
+
+	if len(maintenanceWindows) > 0 {
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			catchUp(datastore, whoAmI, stopper)
+		}()
+	}
+
+outer:
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-stopper.Chan():
+			break outer
+		}
 
-	for running := true; running; {
 		// Find task.
 		notification := findTask(datastore, config.RenotifyInterval, whoAmI, stopper)
 		if notification == nil {
@@ -120,96 +279,189 @@ func Run(config *config.NotifierConfig, datastore database.Datastore, stopper *u
 		}
 
 		// Handle task.
-		done := make(chan bool, 1)
+		inFlight.Add(1)
+		promNotifierBusyWorkers.Inc()
 		go func() {
-			success, interrupted := handleTask(*notification, stopper, config.Attempts)
-			if success {
-				utils.PrometheusObserveTimeMilliseconds(promNotifierLatencyMilliseconds, notification.Created)
-				datastore.SetNotificationNotified(notification.Name)
-			}
-			if interrupted {
-				running = false
-			}
-			datastore.Unlock(notification.Name, whoAmI)
-			done <- true
+			defer func() {
+				promNotifierBusyWorkers.Dec()
+				<-slots
+				inFlight.Done()
+			}()
+			deliver(datastore, *notification, whoAmI, policy, stopper)
 		}()
+	}
 
-		// Refresh task lock until done.
-	outer:
-		for {
-			select {
-			case <-done:
-				break outer
-			case <-time.After(refreshLockDuration):
-				datastore.Lock(notification.Name, whoAmI, lockDuration, true)
+	// Release the consumers of the subscriptions and the deliveries waiting for them.
+	subscriptions.close()
+
+	inFlight.Wait()
+	log.Info("notifier service stopped")
+}
+
+// deliver handles the notification while refreshing its lock.
+func deliver(datastore database.Datastore, notification database.VulnerabilityNotification, whoAmI string, policy retryPolicy, stopper *utils.Stopper) {
+	done := make(chan bool, 1)
+	go func() {
+		lane := string(notification.Priority)
+		result := handleTask(datastore, notification, stopper, policy)
+		recordOutcome(result)
+		switch result {
+		case delivered:
+			utils.PrometheusObserveTimeMilliseconds(promNotifierLatencyMilliseconds, notification.Created)
+			utils.PrometheusObserveTimeMilliseconds(promNotifierLaneLatencyMilliseconds.WithLabelValues(lane), notification.Created)
+			promNotifierLaneNotificationsTotal.WithLabelValues(lane, "sent").Inc()
+			datastore.SetNotificationNotified(notification.Name)
+		case exhausted:
+			promNotifierLaneNotificationsTotal.WithLabelValues(lane, "failed").Inc()
+			if err := datastore.SetNotificationFailed(notification.Name); err != nil {
+				log.With(logging.Fields{"notification": notification.Name}).Warningf("could not mark the notification as failed: %s", err)
 			}
+		case errored:
+			promNotifierLaneNotificationsTotal.WithLabelValues(lane, "failed").Inc()
 		}
-	}
+		datastore.ReleaseNotificationLock(notification.Name, whoAmI)
+		done <- true
+	}()
 
-	log.Info("notifier service stopped")
+	// Refresh task lock until done.
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(refreshLockDuration):
+			if extended, _ := datastore.ExtendNotificationLock(notification.Name, whoAmI, lockDuration); !extended {
+				log.With(logging.Fields{"notification": notification.Name}).Warningf("lost the lock of the notification, another notifier may deliver it concurrently")
+			}
+		}
+	}
 }
 
 func findTask(datastore database.Datastore, renotifyInterval time.Duration, whoAmI string, stopper *utils.Stopper) *database.VulnerabilityNotification {
+	var backOff time.Duration
 	for {
-		// Find a notification to send.
-		notification, err := datastore.GetAvailableNotification(renotifyInterval)
+		// Find and lock a notification to send.
+		notification, err := datastore.GetAvailableNotification(renotifyInterval, whoAmI, lockDuration)
 		if err != nil {
 			// There is no notification or an error occurred.
+			setDatastoreFailing(err != cerrors.ErrNotFound)
+
+			// Wait. When the datastore failed, e.g. because the database is failing over, look again
+			// sooner, backing off exponentially up to the usual interval.
+			wait := checkInterval
 			if err != cerrors.ErrNotFound {
-				log.Warningf("could not get notification to send: %s", err)
+				backOff = timeutil.ExpBackoff(backOff, checkInterval)
+				wait = backOff
+				log.Warningf("could not get notification to send, retrying in %v: %s", wait, err)
+			} else {
+				backOff = 0
 			}
 
-			// Wait.
-			if !stopper.Sleep(checkInterval) {
+			if !stopper.Sleep(wait) {
 				return nil
 			}
 
 			continue
 		}
 
-		// Lock the notification.
-		if hasLock, _ := datastore.Lock(notification.Name, whoAmI, lockDuration, false); hasLock {
-			log.Infof("found and locked a notification: %s", notification.Name)
-			return &notification
-		}
+		setDatastoreFailing(false)
+		log.With(logging.Fields{"notification": notification.Name, "priority": notification.Priority}).Infof("found and locked a notification")
+		return &notification
 	}
 }
 
-func handleTask(notification database.VulnerabilityNotification, st *utils.Stopper, maxAttempts int) (bool, bool) {
+// handleTask delivers the notification via every notifier it is routed to, retrying the failed
+// deliveries according to the policy.
+func handleTask(datastore database.Datastore, notification database.VulnerabilityNotification, st *utils.Stopper, policy retryPolicy) outcome {
+	nlog := log.With(logging.Fields{"notification": notification.Name})
+	targets, err := route(datastore, notification.Name)
+	if err != nil {
+		nlog.Errorf("could not route the notification: %v", err)
+		return errored
+	}
+
 	// Send notification.
-	for notifierName, notifier := range notifiers {
+	for _, target := range targets {
+		notifierName := target.name()
+		tlog := nlog.With(logging.Fields{"notifier": notifierName})
+
+		// Find the delivery in the outbox, skip the notifier if it already delivered the notification.
+		delivery, err := datastore.InsertNotificationDelivery(notification.Name, notifierName)
+		if err != nil {
+			tlog.Errorf("could not find the delivery of the notification: %v", err)
+			return errored
+		}
+		if !delivery.Delivered.IsZero() {
+			tlog.Infof("the notification has already been delivered")
+			continue
+		}
+
+		// Hold the delivery during the maintenance windows, it is sent with the digest of the target
+		// once they close.
+		if held(target, notification.Priority, time.Now()) {
+			tlog.Infof("holding the notification during a maintenance window")
+			recordAttempt(datastore, delivery, errHeld)
+			continue
+		}
+
 		var attempts int
 		var backOff time.Duration
 		for {
 			// Max attempts exceeded.
-			if attempts >= maxAttempts {
-				log.Infof("giving up on sending notification '%s' via notifier '%s': max attempts exceeded (%d)\n", notification.Name, notifierName, maxAttempts)
-				return false, false
+			if attempts >= policy.attempts {
+				tlog.Infof("giving up on sending the notification: max attempts exceeded (%d)", policy.attempts)
+				return exhausted
 			}
 
 			// Backoff.
 			if backOff > 0 {
-				log.Infof("waiting %v before retrying to send notification '%s' via notifier '%s' (Attempt %d / %d)\n", backOff, notification.Name, notifierName, attempts+1, maxAttempts)
+				tlog.Infof("waiting %v before retrying to send the notification (Attempt %d / %d)", backOff, attempts+1, policy.attempts)
 				if !st.Sleep(backOff) {
-					return false, true
+					return interrupted
 				}
 			}
 
 			// Send using the current notifier.
-			if err := notifier.Send(notification); err != nil {
+			if err := send(target, notification, delivery.Key); err != nil {
 				// Send failed; increase attempts/backoff and retry.
-				promNotifierBackendErrorsTotal.WithLabelValues(notifierName).Inc()
-				log.Errorf("could not send notification '%s' via notifier '%s': %v", notification.Name, notifierName, err)
-				backOff = timeutil.ExpBackoff(backOff, maxBackOff)
+				promNotifierBackendErrorsTotal.WithLabelValues(target.notifier).Inc()
+				tlog.Errorf("could not send the notification: %v", err)
+				recordAttempt(datastore, delivery, err)
+				backOff = policy.next(backOff)
 				attempts++
 				continue
 			}
 
 			// Send has been successful. Go to the next notifier.
+			recordAttempt(datastore, delivery, nil)
 			break
 		}
 	}
 
-	log.Infof("successfully sent notification '%s'\n", notification.Name)
-	return true, false
+	nlog.Infof("successfully sent the notification")
+	return delivered
+}
+
+// send delivers the notification to the given target, forwarding the key of the delivery if the
+// notifier supports it.
+func send(t target, notification database.VulnerabilityNotification, key string) error {
+	n := notifiers[t.notifier]
+	if t.channel != "" {
+		return n.(ChannelNotifier).SendToChannel(notification, t.channel, key)
+	}
+	if in, ok := n.(IdempotentNotifier); ok {
+		return in.SendWithKey(notification, key)
+	}
+	return n.Send(notification)
+}
+
+// recordAttempt stores the outcome of a delivery attempt in the outbox.
+func recordAttempt(datastore database.Datastore, delivery database.NotificationDelivery, sendErr error) {
+	var message string
+	if sendErr != nil {
+		message = sendErr.Error()
+	}
+
+	if err := datastore.InsertNotificationDeliveryAttempt(delivery, sendErr == nil, message); err != nil {
+		log.With(logging.Fields{"notifier": delivery.Notifier}).Warningf("could not record the delivery attempt of a notification: %s", err)
+	}
 }
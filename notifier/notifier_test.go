@@ -0,0 +1,138 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/database/testutil"
+	"github.com/coreos/clair/utils"
+)
+
+type failingNotifier struct {
+	mockNotifier
+	failures int
+	sent     int
+}
+
+func (n *failingNotifier) Send(database.VulnerabilityNotification) error {
+	n.sent++
+	if n.sent <= n.failures {
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := newRetryPolicy(&config.NotifierConfig{Attempts: 5, BackOff: time.Second, MaxBackOff: 3 * time.Second})
+	assert.Equal(t, time.Second, policy.next(0))
+	assert.Equal(t, 2*time.Second, policy.next(time.Second))
+	assert.Equal(t, 3*time.Second, policy.next(2*time.Second))
+
+	// Deliveries are attempted at least once.
+	policy = newRetryPolicy(&config.NotifierConfig{})
+	assert.Equal(t, retryPolicy{attempts: 1, backOff: time.Second, maxBackOff: time.Second}, policy)
+}
+
+func TestDeliver(t *testing.T) {
+	defer func(n map[string]Notifier) { notifiers = n }(notifiers)
+	webhook := &failingNotifier{failures: 2}
+	notifiers = map[string]Notifier{"webhook": webhook}
+
+	var attempts []bool
+	var notified, failed, released []string
+	datastore := &database.MockDatastore{
+		FctInsertNotificationDelivery: func(notificationName, notifier string) (database.NotificationDelivery, error) {
+			return database.NotificationDelivery{Notifier: notifier}, nil
+		},
+		FctInsertNotificationDeliveryAttempt: func(delivery database.NotificationDelivery, succeeded bool, message string) error {
+			attempts = append(attempts, succeeded)
+			return nil
+		},
+		FctSetNotificationNotified: func(name string) error {
+			notified = append(notified, name)
+			return nil
+		},
+		FctSetNotificationFailed: func(name string) error {
+			failed = append(failed, name)
+			return nil
+		},
+		FctReleaseNotificationLock: func(name, owner string) {
+			released = append(released, name)
+		},
+	}
+	stopper := utils.NewStopper()
+	policy := retryPolicy{attempts: 2, backOff: time.Millisecond, maxBackOff: time.Millisecond}
+
+	// Notifications whose deliveries fail too many times are marked as failed.
+	deliver(datastore, database.VulnerabilityNotification{Name: "failed"}, "notifier", policy, stopper)
+	assert.Equal(t, []bool{false, false}, attempts)
+	assert.Equal(t, []string{"failed"}, failed)
+	assert.Empty(t, notified)
+	assert.Equal(t, reasonDeliveryFailed, checkHealth(nil).Reason)
+
+	// The others are retried with a backoff until they are delivered.
+	attempts, webhook.sent = nil, 0
+	policy.attempts = 3
+	deliver(datastore, database.VulnerabilityNotification{Name: "notified"}, "notifier", policy, stopper)
+	assert.Equal(t, []bool{false, false, true}, attempts)
+	assert.Equal(t, []string{"notified"}, notified)
+	assert.Equal(t, []string{"failed", "notified"}, released)
+	assert.Equal(t, database.Healthy, checkHealth(nil).State)
+}
+
+func TestFindTaskRecovers(t *testing.T) {
+	defer setDatastoreFailing(false)
+
+	// The datastore is unavailable, e.g. because the database is failing over.
+	datastore := testutil.InjectFaults(&database.MockDatastore{
+		FctGetAvailableNotification: func(renotifyInterval time.Duration, owner string, lockDuration time.Duration) (database.VulnerabilityNotification, error) {
+			return database.VulnerabilityNotification{Name: "n1"}, nil
+		},
+	}, testutil.Faults{ErrorRate: 1})
+
+	stopper := utils.NewStopper()
+	found := make(chan *database.VulnerabilityNotification, 1)
+	stopper.Begin()
+	go func() {
+		defer stopper.End()
+		found <- findTask(datastore, time.Hour, "clair", stopper)
+	}()
+	defer stopper.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for checkHealth(nil).State != database.Degraded && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, reasonDatastoreErrors, checkHealth(nil).Reason)
+
+	// Once the datastore is back, the notifier resumes without waiting for a whole check interval.
+	datastore.SetFaults(testutil.Faults{})
+	select {
+	case notification := <-found:
+		if assert.NotNil(t, notification) {
+			assert.Equal(t, "n1", notification.Name)
+		}
+		assert.Equal(t, database.Healthy, checkHealth(nil).State)
+	case <-time.After(5 * time.Second):
+		t.Error("the notifier did not resume after the datastore recovered")
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/notifier"
+)
+
+// An EmailNotifier sends an email describing the change of the vulnerability of every notification
+// to a list of recipients, over SMTP.
+type EmailNotifier struct {
+	config    EmailNotifierConfiguration
+	host      string
+	datastore database.Datastore
+}
+
+// An EmailNotifierConfiguration represents the configuration of an EmailNotifier.
+type EmailNotifierConfiguration struct {
+	// Address is the address of the SMTP server, e.g. "smtp.example.com:587".
+	Address string
+	// Username and Password authenticate to the SMTP server, if set.
+	Username string
+	Password string
+
+	// From is the address of the sender, and To the addresses of the recipients.
+	From string
+	To   []string
+
+	// Channels are the recipients of the channels that notifications can be routed to, by name.
+	Channels map[string][]string
+}
+
+func init() {
+	notifier.RegisterNotifier("email", &EmailNotifier{})
+}
+
+func (e *EmailNotifier) SetDatastore(datastore database.Datastore) {
+	e.datastore = datastore
+}
+
+func (e *EmailNotifier) Configure(config *config.NotifierConfig) (bool, error) {
+	// Get configuration
+	var emailConfig EmailNotifierConfiguration
+	if config == nil {
+		return false, nil
+	}
+	ok, err := config.DecodeParams("email", &emailConfig)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	// Validate configuration.
+	if emailConfig.Address == "" {
+		return false, nil
+	}
+	if e.host, _, err = net.SplitHostPort(emailConfig.Address); err != nil {
+		return false, fmt.Errorf("could not parse SMTP address: %s", err)
+	}
+	if _, err := mail.ParseAddress(emailConfig.From); err != nil {
+		return false, fmt.Errorf("could not parse sender address: %s", err)
+	}
+	if len(emailConfig.To) == 0 && len(emailConfig.Channels) == 0 {
+		return false, errors.New("no recipients configured")
+	}
+	for _, to := range emailConfig.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return false, fmt.Errorf("could not parse recipient address: %s", err)
+		}
+	}
+	for channel, recipients := range emailConfig.Channels {
+		for _, to := range recipients {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return false, fmt.Errorf("could not parse recipient address of channel '%s': %s", channel, err)
+			}
+		}
+	}
+
+	e.config = emailConfig
+	return true, nil
+}
+
+func (e *EmailNotifier) Send(notification database.VulnerabilityNotification) error {
+	return e.SendWithKey(notification, "")
+}
+
+// SendWithKey sends the email of a notification, whose Message-ID derives from the key of the
+// delivery, so that mail clients can discard the emails of retried deliveries.
+func (e *EmailNotifier) SendWithKey(notification database.VulnerabilityNotification, key string) error {
+	// Only the routed notifications are sent when there are channels but no recipients.
+	if len(e.config.To) == 0 {
+		return nil
+	}
+	return e.send(e.config.To, notification, key)
+}
+
+func (e *EmailNotifier) HasChannel(channel string) bool {
+	_, ok := e.config.Channels[channel]
+	return ok
+}
+
+func (e *EmailNotifier) SendToChannel(notification database.VulnerabilityNotification, channel, key string) error {
+	return e.send(e.config.Channels[channel], notification, key)
+}
+
+func (e *EmailNotifier) send(to []string, notification database.VulnerabilityNotification, key string) error {
+	event, err := notificationEvent(e.datastore, notification.Name, key)
+	if err != nil {
+		return err
+	}
+	return e.sendMail(to, e.message(event, to))
+}
+
+// message returns the email describing an event, with CRLF line endings.
+func (e *EmailNotifier) message(event vulnerabilityEvent, to []string) []byte {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "%s.\n\n", event.Name)
+	fmt.Fprintf(&body, "Vulnerability: %s\n", event.attribute("vulnerability"))
+	fmt.Fprintf(&body, "Namespace: %s\n", event.attribute("namespace"))
+	fmt.Fprintf(&body, "Severity: %s\n", severityChange(event))
+	if link := event.attribute("link"); link != "" {
+		fmt.Fprintf(&body, "Link: %s\n", link)
+	}
+	if images := event.attribute("images"); images != "" {
+		fmt.Fprintf(&body, "\nAffected images:\n")
+		for _, image := range strings.Split(images, ",") {
+			fmt.Fprintf(&body, "- %s\n", image)
+		}
+	}
+	fmt.Fprintf(&body, "\nNotification: %s\n", event.attribute("notification"))
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\n", e.config.From)
+	fmt.Fprintf(&message, "To: %s\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\n", mime.QEncoding.Encode("utf-8", fmt.Sprintf("[Clair] %s (%s)", event.Name, severityChange(event))))
+	fmt.Fprintf(&message, "Date: %s\n", event.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: <%s@clair>\n", event.attribute("externalId"))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\nContent-Type: text/plain; charset=utf-8\n\n")
+	message.Write(body.Bytes())
+
+	return bytes.Replace(message.Bytes(), []byte("\n"), []byte("\r\n"), -1)
+}
+
+// sendMail sends a message to the SMTP server over a new connection, upgraded to TLS if the
+// server supports it.
+func (e *EmailNotifier) sendMail(to []string, message []byte) error {
+	conn, err := net.DialTimeout("tcp", e.config.Address, timeout)
+	if err != nil {
+		return fmt.Errorf("could not connect to the SMTP server: %s", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("could not connect to the SMTP server: %s", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			return fmt.Errorf("could not start TLS: %s", err)
+		}
+	}
+	if e.config.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.config.Username, e.config.Password, e.host)); err != nil {
+			return fmt.Errorf("could not authenticate to the SMTP server: %s", err)
+		}
+	}
+
+	from, _ := mail.ParseAddress(e.config.From)
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		address, _ := mail.ParseAddress(recipient)
+		if err := c.Rcpt(address.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// severityChange describes the severity of the vulnerability of an event, along with its previous
+// one if it changed, e.g. "Medium -> Critical".
+func severityChange(event vulnerabilityEvent) string {
+	oldSeverity, newSeverity := event.attribute("oldSeverity"), event.attribute("newSeverity")
+	switch {
+	case newSeverity == "":
+		return oldSeverity
+	case oldSeverity == "" || oldSeverity == newSeverity:
+		return newSeverity
+	default:
+		return oldSeverity + " -> " + newSeverity
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+// serveSMTP accepts a single SMTP session on the listener and returns the recipients and the data
+// of the message it received.
+func serveSMTP(listener net.Listener, recipients chan<- []string, data chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	var rcpts []string
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); verb {
+		case "EHLO":
+			text.PrintfLine("250 localhost")
+		case "RCPT":
+			rcpts = append(rcpts, strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">"))
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 Go ahead")
+			lines, _ := text.ReadDotLines()
+			recipients <- rcpts
+			data <- strings.Join(lines, "\n")
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer listener.Close()
+
+	e := &EmailNotifier{}
+	e.SetDatastore(syslogDatastore())
+	configured, err := e.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"email": map[string]interface{}{
+			"address":  listener.Addr().String(),
+			"from":     "Clair <clair@example.com>",
+			"channels": map[string][]string{"payments": {"payments@example.com", "Security <security@example.com>"}},
+		},
+	}})
+	if !assert.True(t, configured) || !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, e.HasChannel("payments"))
+
+	// Without recipients, only the routed notifications are sent.
+	assert.Nil(t, e.Send(database.VulnerabilityNotification{Name: "notification"}))
+
+	recipients, data := make(chan []string, 1), make(chan string, 1)
+	go serveSMTP(listener, recipients, data)
+	if !assert.Nil(t, e.SendToChannel(database.VulnerabilityNotification{Name: "notification"}, "payments", "key")) {
+		return
+	}
+
+	assert.Equal(t, []string{"payments@example.com", "security@example.com"}, <-recipients)
+	message := bufio.NewReader(strings.NewReader(<-data))
+	header, err := textproto.NewReader(message).ReadMIMEHeader()
+	if assert.Nil(t, err) {
+		assert.Equal(t, "Clair <clair@example.com>", header.Get("From"))
+		assert.Equal(t, "[Clair] CVE-2016-0001 updated (Medium -> Critical)", header.Get("Subject"))
+		assert.Equal(t, "<key@clair>", header.Get("Message-Id"))
+	}
+	body, _ := message.ReadString(0)
+	assert.Contains(t, body, "Severity: Medium -> Critical\n")
+	assert.Contains(t, body, "Affected images:\n- registry.example.com/team/app:latest\n- registry.example.com/team/legacy:latest\n")
+
+	// The addresses are validated.
+	_, err = e.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"email": map[string]interface{}{"address": "smtp.example.com:25", "from": "clair@example.com", "to": []string{"not an address"}},
+	}})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,169 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/notifier"
+	"github.com/coreos/clair/utils/types"
+)
+
+const defaultGitHubURL = "https://api.github.com"
+
+// A GitHubNotifier opens an issue in a GitHub repository for every image of a watched tag affected
+// by a vulnerability above a severity threshold, in the same way as the JiraNotifier, and labels it
+// with the severity.
+type GitHubNotifier struct {
+	config    GitHubNotifierConfiguration
+	severity  types.Priority
+	datastore database.Datastore
+	client    *http.Client
+}
+
+// A GitHubNotifierConfiguration represents the configuration of a GitHubNotifier.
+type GitHubNotifierConfiguration struct {
+	// URL is the base URL of the API, "https://api.github.com" unless GitHub Enterprise is used.
+	URL   string
+	Token string
+
+	// Repository is the repository in which the issues are opened, e.g. "team/app".
+	Repository string
+
+	// Severity is the lowest severity of the vulnerabilities that issues are opened for.
+	Severity string
+}
+
+func init() {
+	notifier.RegisterNotifier("github", &GitHubNotifier{})
+}
+
+func (g *GitHubNotifier) SetDatastore(datastore database.Datastore) {
+	g.datastore = datastore
+}
+
+func (g *GitHubNotifier) Configure(config *config.NotifierConfig) (bool, error) {
+	// Get configuration
+	var githubConfig GitHubNotifierConfiguration
+	if config == nil {
+		return false, nil
+	}
+	ok, err := config.DecodeParams("github", &githubConfig)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	// Validate configuration.
+	if githubConfig.Repository == "" {
+		return false, nil
+	}
+	if strings.Count(githubConfig.Repository, "/") != 1 {
+		return false, fmt.Errorf("invalid repository '%s', expected owner/name", githubConfig.Repository)
+	}
+	if githubConfig.Token == "" {
+		return false, errors.New("a token is required to open issues")
+	}
+	if githubConfig.URL == "" {
+		githubConfig.URL = defaultGitHubURL
+	}
+	if _, err := url.ParseRequestURI(githubConfig.URL); err != nil {
+		return false, fmt.Errorf("could not parse GitHub URL: %s", err)
+	}
+	githubConfig.URL = strings.TrimSuffix(githubConfig.URL, "/")
+	if g.severity, err = parseSeverity(githubConfig.Severity); err != nil {
+		return false, err
+	}
+
+	g.config = githubConfig
+	g.client = &http.Client{Timeout: timeout}
+	return true, nil
+}
+
+// Send opens, updates or closes the issues of the vulnerability the notification is about.
+func (g *GitHubNotifier) Send(notification database.VulnerabilityNotification) error {
+	return syncIssues(g.datastore, g, notification.Name, g.severity, true)
+}
+
+func (g *GitHubNotifier) searchIssues(label string) ([]issue, error) {
+	var issues []issue
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("state", "open")
+		query.Set("labels", label)
+		query.Set("per_page", fmt.Sprint(issuePageSize))
+		query.Set("page", fmt.Sprint(page))
+
+		var githubIssues []githubIssue
+		if err := g.do("GET", "/issues?"+query.Encode(), nil, &githubIssues); err != nil {
+			return nil, err
+		}
+		for _, githubIssue := range githubIssues {
+			i := issue{ID: fmt.Sprint(githubIssue.Number)}
+			for _, label := range githubIssue.Labels {
+				i.Labels = append(i.Labels, label.Name)
+			}
+			issues = append(issues, i)
+		}
+		if len(githubIssues) < issuePageSize {
+			return issues, nil
+		}
+	}
+}
+
+func (g *GitHubNotifier) openIssue(image imageFindings, title, body string, labels []string) error {
+	return g.do("POST", "/issues", githubIssueRequest{Title: title, Body: body, Labels: labels}, nil)
+}
+
+func (g *GitHubNotifier) updateIssue(issue issue, image imageFindings, title, body string, labels []string) error {
+	return g.do("PATCH", "/issues/"+issue.ID, githubIssueRequest{Title: title, Body: body, Labels: labels}, nil)
+}
+
+func (g *GitHubNotifier) closeIssue(issue issue, comment string) error {
+	if err := g.do("POST", "/issues/"+issue.ID+"/comments", map[string]string{"body": comment}, nil); err != nil {
+		return err
+	}
+	return g.do("PATCH", "/issues/"+issue.ID, githubIssueRequest{State: "closed"}, nil)
+}
+
+func (g *GitHubNotifier) describe(vulnerability database.Vulnerability, image imageFindings) (string, string) {
+	return markdownIssueContent(vulnerability, image)
+}
+
+// do sends a request about the repository to the GitHub API.
+func (g *GitHubNotifier) do(method, path string, body, v interface{}) error {
+	return doJSON(g.client, method, g.config.URL+"/repos/"+g.config.Repository+path, func(req *http.Request) {
+		req.Header.Set("Authorization", "token "+g.config.Token)
+	}, body, v)
+}
+
+type githubIssue struct {
+	Number int `json:"number"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+}
+
+type githubIssueRequest struct {
+	Title  string   `json:"title,omitempty"`
+	Body   string   `json:"body,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+	State  string   `json:"state,omitempty"`
+}
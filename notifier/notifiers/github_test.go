@@ -0,0 +1,125 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestGitHubNotifier(t *testing.T) {
+	vulnerability := database.Vulnerability{
+		Name:      "CVE-2016-0001",
+		Namespace: database.Namespace{Name: "debian:8"},
+		Severity:  types.Critical,
+	}
+	vulnerabilityLabel := "clair-" + vulnerabilityKey(vulnerability)
+	appLabel := "clair-" + findingKey("registry.example.com/team/app:latest", vulnerability)
+	legacyLabel := "clair-" + findingKey("registry.example.com/team/legacy:latest", vulnerability)
+
+	var requests []string
+	updates := make(map[string]githubIssueRequest)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token secret", r.Header.Get("Authorization"))
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/team/security/issues":
+			assert.Equal(t, vulnerabilityLabel, r.URL.Query().Get("labels"))
+			fmt.Fprintf(w, `[
+				{"number": 1, "labels": [{"name": "clair"}, {"name": "%s"}, {"name": "%s"}, {"name": "severity:high"}, {"name": "triaged"}]},
+				{"number": 2, "labels": [{"name": "clair"}, {"name": "%s"}, {"name": "%s"}]}
+			]`, vulnerabilityLabel, appLabel, vulnerabilityLabel, legacyLabel)
+		case "PATCH /repos/team/security/issues/1", "PATCH /repos/team/security/issues/2":
+			var update githubIssueRequest
+			json.NewDecoder(r.Body).Decode(&update)
+			updates[r.URL.Path] = update
+		case "POST /repos/team/security/issues/2/comments":
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	g := &GitHubNotifier{}
+	g.SetDatastore(notificationDatastore(vulnerability))
+	configured, err := g.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"github": map[string]interface{}{"url": server.URL, "token": "secret", "repository": "team/security"},
+	}})
+	if !assert.True(t, configured) || !assert.Nil(t, err) {
+		return
+	}
+
+	// The issue of the affected image is updated along with its severity label, and the one of the
+	// image that isn't affected anymore is closed.
+	if assert.Nil(t, g.Send(database.VulnerabilityNotification{Name: "notification"})) {
+		assert.Equal(t, []string{
+			"GET /repos/team/security/issues",
+			"PATCH /repos/team/security/issues/1",
+			"POST /repos/team/security/issues/2/comments",
+			"PATCH /repos/team/security/issues/2",
+		}, requests)
+		update := updates["/repos/team/security/issues/1"]
+		assert.Equal(t, "CVE-2016-0001 (Critical) in registry.example.com/team/app:latest", update.Title)
+		assert.Contains(t, update.Body, "| openssl | 1.0.1 | 1.0.2 |")
+		assert.Equal(t, []string{"clair", vulnerabilityLabel, appLabel, "triaged", "severity:critical"}, update.Labels)
+		assert.Equal(t, "closed", updates["/repos/team/security/issues/2"].State)
+	}
+}
+
+func TestGitLabNotifier(t *testing.T) {
+	vulnerability := database.Vulnerability{
+		Name:      "CVE-2016-0001",
+		Namespace: database.Namespace{Name: "debian:8"},
+		Severity:  types.High,
+	}
+
+	var created gitlabIssueRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("PRIVATE-TOKEN"))
+		assert.Equal(t, "/api/v4/projects/team%2Fsecurity/issues", r.URL.EscapedPath())
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(`[]`))
+		case "POST":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	g := &GitLabNotifier{}
+	g.SetDatastore(notificationDatastore(vulnerability))
+	configured, err := g.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"gitlab": map[string]interface{}{"url": server.URL, "token": "secret", "project": "team/security"},
+	}})
+	if !assert.True(t, configured) || !assert.Nil(t, err) {
+		return
+	}
+
+	if assert.Nil(t, g.Send(database.VulnerabilityNotification{Name: "notification"})) {
+		assert.Equal(t, "CVE-2016-0001 (High) in registry.example.com/team/app:latest", created.Title)
+		assert.Contains(t, created.Labels, "severity:high")
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/notifier"
+	"github.com/coreos/clair/utils/types"
+)
+
+const defaultGitLabURL = "https://gitlab.com"
+
+// A GitLabNotifier opens an issue in a GitLab project for every image of a watched tag affected by
+// a vulnerability above a severity threshold, in the same way as the JiraNotifier, and labels it
+// with the severity.
+type GitLabNotifier struct {
+	config    GitLabNotifierConfiguration
+	severity  types.Priority
+	datastore database.Datastore
+	client    *http.Client
+}
+
+// A GitLabNotifierConfiguration represents the configuration of a GitLabNotifier.
+type GitLabNotifierConfiguration struct {
+	// URL is the base URL of the GitLab server, "https://gitlab.com" unless it is self-managed.
+	URL   string
+	Token string
+
+	// Project is the path, e.g. "team/app", or the ID of the project in which the issues are
+	// opened.
+	Project string
+
+	// Severity is the lowest severity of the vulnerabilities that issues are opened for.
+	Severity string
+}
+
+func init() {
+	notifier.RegisterNotifier("gitlab", &GitLabNotifier{})
+}
+
+func (g *GitLabNotifier) SetDatastore(datastore database.Datastore) {
+	g.datastore = datastore
+}
+
+func (g *GitLabNotifier) Configure(config *config.NotifierConfig) (bool, error) {
+	// Get configuration
+	var gitlabConfig GitLabNotifierConfiguration
+	if config == nil {
+		return false, nil
+	}
+	ok, err := config.DecodeParams("gitlab", &gitlabConfig)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	// Validate configuration.
+	if gitlabConfig.Project == "" {
+		return false, nil
+	}
+	if gitlabConfig.Token == "" {
+		return false, errors.New("a token is required to open issues")
+	}
+	if gitlabConfig.URL == "" {
+		gitlabConfig.URL = defaultGitLabURL
+	}
+	if _, err := url.ParseRequestURI(gitlabConfig.URL); err != nil {
+		return false, fmt.Errorf("could not parse GitLab URL: %s", err)
+	}
+	gitlabConfig.URL = strings.TrimSuffix(gitlabConfig.URL, "/")
+	if g.severity, err = parseSeverity(gitlabConfig.Severity); err != nil {
+		return false, err
+	}
+
+	g.config = gitlabConfig
+	g.client = &http.Client{Timeout: timeout}
+	return true, nil
+}
+
+// Send opens, updates or closes the issues of the vulnerability the notification is about.
+func (g *GitLabNotifier) Send(notification database.VulnerabilityNotification) error {
+	return syncIssues(g.datastore, g, notification.Name, g.severity, true)
+}
+
+func (g *GitLabNotifier) searchIssues(label string) ([]issue, error) {
+	var issues []issue
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("state", "opened")
+		query.Set("labels", label)
+		query.Set("per_page", fmt.Sprint(issuePageSize))
+		query.Set("page", fmt.Sprint(page))
+
+		var gitlabIssues []gitlabIssue
+		if err := g.do("GET", "/issues?"+query.Encode(), nil, &gitlabIssues); err != nil {
+			return nil, err
+		}
+		for _, gitlabIssue := range gitlabIssues {
+			issues = append(issues, issue{ID: fmt.Sprint(gitlabIssue.IID), Labels: gitlabIssue.Labels})
+		}
+		if len(gitlabIssues) < issuePageSize {
+			return issues, nil
+		}
+	}
+}
+
+func (g *GitLabNotifier) openIssue(image imageFindings, title, description string, labels []string) error {
+	return g.do("POST", "/issues", gitlabIssueRequest{Title: title, Description: description, Labels: strings.Join(labels, ",")}, nil)
+}
+
+func (g *GitLabNotifier) updateIssue(issue issue, image imageFindings, title, description string, labels []string) error {
+	return g.do("PUT", "/issues/"+issue.ID, gitlabIssueRequest{Title: title, Description: description, Labels: strings.Join(labels, ",")}, nil)
+}
+
+func (g *GitLabNotifier) closeIssue(issue issue, comment string) error {
+	if err := g.do("POST", "/issues/"+issue.ID+"/notes", map[string]string{"body": comment}, nil); err != nil {
+		return err
+	}
+	return g.do("PUT", "/issues/"+issue.ID, gitlabIssueRequest{StateEvent: "close"}, nil)
+}
+
+func (g *GitLabNotifier) describe(vulnerability database.Vulnerability, image imageFindings) (string, string) {
+	return markdownIssueContent(vulnerability, image)
+}
+
+// do sends a request about the project to the GitLab API.
+func (g *GitLabNotifier) do(method, path string, body, v interface{}) error {
+	project := strings.Replace(url.QueryEscape(g.config.Project), "+", "%20", -1)
+	return doJSON(g.client, method, g.config.URL+"/api/v4/projects/"+project+path, func(req *http.Request) {
+		req.Header.Set("PRIVATE-TOKEN", g.config.Token)
+	}, body, v)
+}
+
+type gitlabIssue struct {
+	IID    int      `json:"iid"`
+	Labels []string `json:"labels"`
+}
+
+type gitlabIssueRequest struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Labels      string `json:"labels,omitempty"`
+	StateEvent  string `json:"state_event,omitempty"`
+}
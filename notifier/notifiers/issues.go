@@ -0,0 +1,317 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/registry"
+	"github.com/coreos/clair/remediation"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+const (
+	// issueLabel is the label of every issue opened by Clair, and the prefix of the labels
+	// identifying the vulnerability and the finding of an issue.
+	issueLabel = "clair"
+	// severityLabelPrefix is the prefix of the labels giving the severity of the vulnerabilities.
+	severityLabelPrefix = "severity:"
+	// issuePageSize is the number of issues per page of the searches.
+	issuePageSize = 100
+)
+
+// An issue is an open issue in an issue tracker.
+type issue struct {
+	ID     string
+	Labels []string
+}
+
+// An issueTracker is a service in which an issue is opened for every vulnerability affecting the
+// image of a watched tag.
+type issueTracker interface {
+	// searchIssues returns the open issues having the given label.
+	searchIssues(label string) ([]issue, error)
+	// openIssue opens an issue about a vulnerability in the given image.
+	openIssue(image imageFindings, title, body string, labels []string) error
+	// updateIssue replaces the title, the body and the labels of the issue of an image.
+	updateIssue(issue issue, image imageFindings, title, body string, labels []string) error
+	// closeIssue comments and closes an issue.
+	closeIssue(issue issue, comment string) error
+	// describe returns the title and the body of the issue of a vulnerability in an image, in the
+	// markup of the tracker.
+	describe(vulnerability database.Vulnerability, image imageFindings) (string, string)
+}
+
+// syncIssues opens, updates or closes the issues of the vulnerability a notification is about.
+//
+// Issues are identified by labels derived from the vulnerability and the image, so that a single
+// issue is open for a vulnerability in an image across notifications and retries. The issues of
+// the images that the vulnerability no longer affects, e.g. because their tag has been indexed
+// again since, are closed, as are all of them when the vulnerability has been deleted or is below
+// the threshold. If labelSeverity is set, issues are also labeled with the severity.
+func syncIssues(datastore database.Datastore, tracker issueTracker, notificationName string, threshold types.Priority, labelSeverity bool) error {
+	vulnerability, exists, err := notificationVulnerability(datastore, notificationName)
+	if err != nil {
+		return fmt.Errorf("could not get notification: %s", err)
+	}
+
+	var images []imageFindings
+	if exists && vulnerability.Severity.Compare(threshold) >= 0 {
+		images, err = findings(datastore, notificationName, vulnerability)
+		if err != nil {
+			return fmt.Errorf("could not find the affected images: %s", err)
+		}
+	}
+
+	vulnerabilityLabel := issueLabel + "-" + vulnerabilityKey(vulnerability)
+	issues, err := tracker.searchIssues(vulnerabilityLabel)
+	if err != nil {
+		return err
+	}
+	open := make(map[string]issue)
+	for _, issue := range issues {
+		for _, label := range issue.Labels {
+			if strings.HasPrefix(label, issueLabel+"-") && label != vulnerabilityLabel {
+				open[label] = issue
+			}
+		}
+	}
+
+	affected := make(map[string]struct{})
+	for _, image := range images {
+		findingLabel := issueLabel + "-" + findingKey(image.Reference, vulnerability)
+		affected[findingLabel] = struct{}{}
+
+		title, body := tracker.describe(vulnerability, image)
+		if issue, ok := open[findingLabel]; ok {
+			var labels []string
+			for _, label := range issue.Labels {
+				if !labelSeverity || !strings.HasPrefix(label, severityLabelPrefix) {
+					labels = append(labels, label)
+				}
+			}
+			if labelSeverity {
+				labels = append(labels, severityLabel(vulnerability.Severity))
+			}
+			err = tracker.updateIssue(issue, image, title, body, labels)
+		} else {
+			labels := []string{issueLabel, vulnerabilityLabel, findingLabel}
+			if labelSeverity {
+				labels = append(labels, severityLabel(vulnerability.Severity))
+			}
+			err = tracker.openIssue(image, title, body, labels)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for findingLabel, issue := range open {
+		if _, ok := affected[findingLabel]; !ok {
+			if err := tracker.closeIssue(issue, fmt.Sprintf("%s no longer affects the image.", vulnerability.Name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseSeverity parses the severity threshold of the issues, High by default.
+func parseSeverity(s string) (types.Priority, error) {
+	if s == "" {
+		return types.High, nil
+	}
+	if severity := types.Priority(s); severity.IsValid() {
+		return severity, nil
+	}
+	return "", fmt.Errorf("unknown severity '%s'", s)
+}
+
+func severityLabel(severity types.Priority) string {
+	return severityLabelPrefix + strings.ToLower(string(severity))
+}
+
+// markdownIssueContent returns the title and the body, in Markdown, of the issue of a
+// vulnerability in an image.
+func markdownIssueContent(vulnerability database.Vulnerability, image imageFindings) (string, string) {
+	title := fmt.Sprintf("%s (%s) in %s", vulnerability.Name, vulnerability.Severity, image.Reference)
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "**%s** affects the image `%s`.\n\n", vulnerability.Name, image.Reference)
+	if vulnerability.Description != "" {
+		fmt.Fprintf(&body, "%s\n\n", vulnerability.Description)
+	}
+	if vulnerability.Link != "" {
+		fmt.Fprintf(&body, "%s\n\n", vulnerability.Link)
+	}
+	fmt.Fprintf(&body, "| Feature | Version | Fixed by | Remediation |\n| --- | --- | --- | --- |\n")
+	for _, featureVersion := range image.Features {
+		command := "-"
+		if c := remediationCommand(featureVersion); c != "" {
+			command = "`" + c + "`"
+		}
+		fmt.Fprintf(&body, "| %s | %s | %s | %s |\n", featureVersion.Feature.Name, featureVersion.Version, fixedBy(featureVersion), command)
+	}
+
+	return title, body.String()
+}
+
+// fixedBy returns the version fixing the vulnerability affecting a feature of an image, or "-".
+func fixedBy(featureVersion database.FeatureVersion) string {
+	fixedBy := featureVersion.AffectedBy[0].FixedBy
+	if fixedBy == "" || fixedBy == versionfmt.MaxVersion {
+		return "-"
+	}
+	return fixedBy
+}
+
+// remediationCommand returns the command upgrading a feature of an image to the version fixing the
+// vulnerability affecting it, or an empty string.
+func remediationCommand(featureVersion database.FeatureVersion) string {
+	return remediation.Command(featureVersion.Feature.Namespace.Name, featureVersion.Feature.Name, featureVersion.AffectedBy[0].FixedBy)
+}
+
+// An imageFindings lists the features of the image of a watched tag that a vulnerability affects.
+type imageFindings struct {
+	// Name is the name of the image, e.g. "registry.example.com/team/app", and Reference the one
+	// of the tag, e.g. "registry.example.com/team/app:latest".
+	Name      string
+	Reference string
+	Features  []database.FeatureVersion
+}
+
+// notificationVulnerability returns the vulnerability a notification is about, its new version
+// unless it has been deleted, and whether it still exists.
+func notificationVulnerability(datastore database.Datastore, name string) (database.Vulnerability, bool, error) {
+	notification, _, err := datastore.GetNotification(name, 1, database.VulnerabilityNotificationFirstPage)
+	if err != nil {
+		return database.Vulnerability{}, false, err
+	}
+	if notification.NewVulnerability != nil {
+		return *notification.NewVulnerability, true, nil
+	}
+	if notification.OldVulnerability != nil {
+		return *notification.OldVulnerability, false, nil
+	}
+	return database.Vulnerability{}, false, cerrors.ErrNotFound
+}
+
+// findings returns the images of the watched tags that the given vulnerability currently
+// affects, among the ones that the notification affects.
+func findings(datastore database.Datastore, notificationName string, vulnerability database.Vulnerability) ([]imageFindings, error) {
+	watchedTags, err := datastore.ListNotificationWatchedTags(notificationName)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []imageFindings
+	for _, watchedTag := range watchedTags {
+		// The notification also lists the images affected by the old version of the vulnerability:
+		// only keep the ones the layers of which are affected by the new one.
+		layer, err := datastore.FindLayer(watchedTag.LayerName, true, true)
+		if err == cerrors.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		image := imageFindings{Name: registry.ImageName(watchedTag.Registry, watchedTag.Repository)}
+		image.Reference = image.Name + ":" + watchedTag.Tag
+		for _, featureVersion := range layer.Features {
+			for _, affectedBy := range featureVersion.AffectedBy {
+				if affectedBy.Name == vulnerability.Name && affectedBy.Namespace.Name == vulnerability.Namespace.Name {
+					featureVersion.AffectedBy = []database.Vulnerability{affectedBy}
+					image.Features = append(image.Features, featureVersion)
+					break
+				}
+			}
+		}
+		if len(image.Features) > 0 {
+			images = append(images, image)
+		}
+	}
+
+	return images, nil
+}
+
+// findingKey identifies the findings of a vulnerability in an image across notifications, so that
+// a single issue is opened for them.
+func findingKey(reference string, vulnerability database.Vulnerability) string {
+	return hashKey(reference, vulnerability.Namespace.Name, vulnerability.Name)
+}
+
+// vulnerabilityKey identifies the findings of a vulnerability in every image.
+func vulnerabilityKey(vulnerability database.Vulnerability) string {
+	return hashKey(vulnerability.Namespace.Name, vulnerability.Name)
+}
+
+func hashKey(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// doJSON sends a request to the API of an issue tracker, after authorizing it, encoding the body
+// and decoding the response in v if they aren't nil.
+func doJSON(client *http.Client, method, url string, authorize func(*http.Request), body, v interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("could not marshal: %s", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: got status %d: %s", method, req.URL.Path, resp.StatusCode, message)
+	}
+	if v != nil {
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/notifier"
+	"github.com/coreos/clair/ownership"
+	"github.com/coreos/clair/utils/types"
+)
+
+// A JiraNotifier opens an issue in Jira for every image of a watched tag affected by a
+// vulnerability above a severity threshold, updates it when the vulnerability changes and closes
+// it once the image is no longer affected.
+type JiraNotifier struct {
+	config    JiraNotifierConfiguration
+	severity  types.Priority
+	datastore database.Datastore
+	client    *http.Client
+}
+
+// A JiraNotifierConfiguration represents the configuration of a JiraNotifier.
+type JiraNotifierConfiguration struct {
+	// URL is the base URL of the Jira server, e.g. "https://example.atlassian.net".
+	URL string
+	// Username and Token authenticate the requests, the token being an API token or a password.
+	Username string
+	Token    string
+
+	// Project and IssueType are the key of the project and the name of the type of the issues,
+	// unless a mapping of Projects matches the image.
+	Project   string
+	IssueType string
+	Projects  []JiraProjectMapping
+
+	// Severity is the lowest severity of the vulnerabilities that issues are opened for.
+	Severity string
+
+	// Transition is the name of the transition closing the issues. The first transition to a status
+	// of the "done" category is used if it is empty.
+	Transition string
+}
+
+// A JiraProjectMapping files the issues of the images whose name matches the Pattern, as in the
+// ownership rules, or whose owners include the Owner, in another Project or with another IssueType.
+type JiraProjectMapping struct {
+	Pattern   string
+	Owner     string
+	Project   string
+	IssueType string
+}
+
+func init() {
+	notifier.RegisterNotifier("jira", &JiraNotifier{})
+}
+
+func (j *JiraNotifier) SetDatastore(datastore database.Datastore) {
+	j.datastore = datastore
+}
+
+func (j *JiraNotifier) Configure(config *config.NotifierConfig) (bool, error) {
+	// Get configuration
+	var jiraConfig JiraNotifierConfiguration
+	if config == nil {
+		return false, nil
+	}
+	ok, err := config.DecodeParams("jira", &jiraConfig)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	// Validate configuration.
+	if jiraConfig.URL == "" {
+		return false, nil
+	}
+	if _, err := url.ParseRequestURI(jiraConfig.URL); err != nil {
+		return false, fmt.Errorf("could not parse Jira URL: %s", err)
+	}
+	jiraConfig.URL = strings.TrimSuffix(jiraConfig.URL, "/")
+	if jiraConfig.Project == "" || jiraConfig.IssueType == "" {
+		return false, errors.New("the project and the issue type of the issues are required")
+	}
+	if j.severity, err = parseSeverity(jiraConfig.Severity); err != nil {
+		return false, err
+	}
+
+	j.config = jiraConfig
+	j.client = &http.Client{Timeout: timeout}
+	return true, nil
+}
+
+// Send opens, updates or closes the issues of the vulnerability the notification is about.
+func (j *JiraNotifier) Send(notification database.VulnerabilityNotification) error {
+	return syncIssues(j.datastore, j, notification.Name, j.severity, false)
+}
+
+// project returns the project and the issue type of the issues of the specified image.
+func (j *JiraNotifier) project(name string) (string, string) {
+	for _, mapping := range j.config.Projects {
+		if mapping.Pattern != "" && !ownership.Match(mapping.Pattern, name) {
+			continue
+		}
+		if mapping.Owner != "" && !contains(ownership.Owners(name), mapping.Owner) {
+			continue
+		}
+
+		project, issueType := j.config.Project, j.config.IssueType
+		if mapping.Project != "" {
+			project = mapping.Project
+		}
+		if mapping.IssueType != "" {
+			issueType = mapping.IssueType
+		}
+		return project, issueType
+	}
+	return j.config.Project, j.config.IssueType
+}
+
+func (j *JiraNotifier) searchIssues(label string) ([]issue, error) {
+	jql := fmt.Sprintf(`labels = "%s" AND statusCategory != Done`, label)
+
+	var issues []issue
+	for startAt := 0; ; startAt += issuePageSize {
+		query := url.Values{}
+		query.Set("jql", jql)
+		query.Set("fields", "labels")
+		query.Set("startAt", fmt.Sprint(startAt))
+		query.Set("maxResults", fmt.Sprint(issuePageSize))
+
+		var page jiraSearchResult
+		if err := j.do("GET", "/rest/api/2/search?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, i := range page.Issues {
+			issues = append(issues, issue{ID: i.Key, Labels: i.Fields.Labels})
+		}
+		if len(page.Issues) == 0 || startAt+len(page.Issues) >= page.Total {
+			return issues, nil
+		}
+	}
+}
+
+func (j *JiraNotifier) openIssue(image imageFindings, summary, description string, labels []string) error {
+	project, issueType := j.project(image.Name)
+	return j.do("POST", "/rest/api/2/issue", jiraIssue{Fields: jiraFields{
+		Project:     &jiraRef{Key: project},
+		IssueType:   &jiraRef{Name: issueType},
+		Summary:     summary,
+		Description: description,
+		Labels:      labels,
+	}}, nil)
+}
+
+func (j *JiraNotifier) updateIssue(issue issue, image imageFindings, summary, description string, labels []string) error {
+	return j.do("PUT", "/rest/api/2/issue/"+issue.ID, jiraIssue{Fields: jiraFields{
+		Summary:     summary,
+		Description: description,
+		Labels:      labels,
+	}}, nil)
+}
+
+func (j *JiraNotifier) closeIssue(issue issue, comment string) error {
+	var transitions jiraTransitions
+	if err := j.do("GET", "/rest/api/2/issue/"+issue.ID+"/transitions", nil, &transitions); err != nil {
+		return err
+	}
+
+	var id string
+	for _, transition := range transitions.Transitions {
+		if j.config.Transition != "" && transition.Name == j.config.Transition ||
+			j.config.Transition == "" && transition.To.StatusCategory.Key == "done" {
+			id = transition.ID
+			break
+		}
+	}
+	if id == "" {
+		return fmt.Errorf("could not find a transition closing issue %s", issue.ID)
+	}
+
+	if err := j.do("POST", "/rest/api/2/issue/"+issue.ID+"/comment", map[string]string{"body": comment}, nil); err != nil {
+		return err
+	}
+	return j.do("POST", "/rest/api/2/issue/"+issue.ID+"/transitions", map[string]jiraRef{"transition": {ID: id}}, nil)
+}
+
+// do sends a request to the Jira API.
+func (j *JiraNotifier) do(method, path string, body, v interface{}) error {
+	return doJSON(j.client, method, j.config.URL+path, func(req *http.Request) {
+		if j.config.Username != "" {
+			req.SetBasicAuth(j.config.Username, j.config.Token)
+		}
+	}, body, v)
+}
+
+// describe returns the summary and the description, in Jira's markup, of the issue of a
+// vulnerability in an image.
+func (j *JiraNotifier) describe(vulnerability database.Vulnerability, image imageFindings) (string, string) {
+	summary := fmt.Sprintf("%s (%s) in %s", vulnerability.Name, vulnerability.Severity, image.Reference)
+
+	var description bytes.Buffer
+	fmt.Fprintf(&description, "*%s* affects the image *%s*.\n\n", vulnerability.Name, image.Reference)
+	if vulnerability.Description != "" {
+		fmt.Fprintf(&description, "%s\n\n", vulnerability.Description)
+	}
+	if vulnerability.Link != "" {
+		fmt.Fprintf(&description, "%s\n\n", vulnerability.Link)
+	}
+	fmt.Fprintf(&description, "||Feature||Version||Fixed by||Remediation||\n")
+	for _, featureVersion := range image.Features {
+		command := "-"
+		if c := remediationCommand(featureVersion); c != "" {
+			command = "{{" + c + "}}"
+		}
+		fmt.Fprintf(&description, "|%s|%s|%s|%s|\n", featureVersion.Feature.Name, featureVersion.Version, fixedBy(featureVersion), command)
+	}
+
+	return summary, description.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type jiraIssue struct {
+	Key    string     `json:"key,omitempty"`
+	Fields jiraFields `json:"fields"`
+}
+
+type jiraFields struct {
+	Project     *jiraRef `json:"project,omitempty"`
+	IssueType   *jiraRef `json:"issuetype,omitempty"`
+	Summary     string   `json:"summary,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+}
+
+type jiraRef struct {
+	ID   string `json:"id,omitempty"`
+	Key  string `json:"key,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type jiraSearchResult struct {
+	Total  int         `json:"total"`
+	Issues []jiraIssue `json:"issues"`
+}
+
+type jiraTransitions struct {
+	Transitions []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		To   struct {
+			StatusCategory struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		} `json:"to"`
+	} `json:"transitions"`
+}
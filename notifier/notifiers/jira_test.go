@@ -0,0 +1,131 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+// notificationDatastore returns a datastore holding a notification about the given vulnerability,
+// which affects the image of the "app" watched tag but no longer the one of the "legacy" tag.
+func notificationDatastore(vulnerability database.Vulnerability) *database.MockDatastore {
+	return &database.MockDatastore{
+		FctGetNotification: func(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
+			return database.VulnerabilityNotification{Name: name, NewVulnerability: &vulnerability}, database.NoVulnerabilityNotificationPage, nil
+		},
+		FctListNotificationWatchedTags: func(name string) ([]database.WatchedTag, error) {
+			return []database.WatchedTag{
+				{Registry: "https://registry.example.com", Repository: "team/app", Tag: "latest", LayerName: "app"},
+				{Registry: "https://registry.example.com", Repository: "team/legacy", Tag: "latest", LayerName: "legacy"},
+			}, nil
+		},
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			layer := database.Layer{Name: name}
+			if name == "app" {
+				affected := vulnerability
+				affected.FixedBy = "1.0.2"
+				layer.Features = []database.FeatureVersion{{
+					Feature:    database.Feature{Name: "openssl"},
+					Version:    "1.0.1",
+					AffectedBy: []database.Vulnerability{affected},
+				}}
+			}
+			return layer, nil
+		},
+	}
+}
+
+func TestJiraNotifier(t *testing.T) {
+	vulnerability := database.Vulnerability{
+		Name:      "CVE-2016-0001",
+		Namespace: database.Namespace{Name: "debian:8"},
+		Severity:  types.Critical,
+	}
+	legacyKey := findingKey("registry.example.com/team/legacy:latest", vulnerability)
+
+	var requests []string
+	var created jiraIssue
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /rest/api/2/search":
+			assert.Equal(t, `labels = "clair-`+vulnerabilityKey(vulnerability)+`" AND statusCategory != Done`, r.URL.Query().Get("jql"))
+			w.Write([]byte(`{"total": 1, "issues": [{"key": "SEC-1", "fields": {"labels": ["clair", "clair-` + vulnerabilityKey(vulnerability) + `", "clair-` + legacyKey + `"]}}]}`))
+		case "POST /rest/api/2/issue":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"key": "PAY-1"}`))
+		case "GET /rest/api/2/issue/SEC-1/transitions":
+			w.Write([]byte(`{"transitions": [{"id": "1", "name": "Start", "to": {"statusCategory": {"key": "indeterminate"}}}, {"id": "2", "name": "Done", "to": {"statusCategory": {"key": "done"}}}]}`))
+		case "POST /rest/api/2/issue/SEC-1/comment":
+			w.WriteHeader(http.StatusCreated)
+		case "POST /rest/api/2/issue/SEC-1/transitions":
+			var transition map[string]jiraRef
+			json.NewDecoder(r.Body).Decode(&transition)
+			assert.Equal(t, "2", transition["transition"].ID)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	j := &JiraNotifier{}
+	j.SetDatastore(notificationDatastore(vulnerability))
+	configured, err := j.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"jira": map[string]interface{}{
+			"url":       server.URL,
+			"project":   "SEC",
+			"issuetype": "Bug",
+			"projects":  []interface{}{map[string]interface{}{"pattern": "registry.example.com/team/app", "project": "PAY"}},
+		},
+	}})
+	if !assert.True(t, configured) || !assert.Nil(t, err) {
+		return
+	}
+
+	// The issue of the affected image is opened in the mapped project, and the one of the image
+	// that isn't affected anymore is closed.
+	if assert.Nil(t, j.Send(database.VulnerabilityNotification{Name: "notification"})) {
+		assert.Equal(t, []string{
+			"GET /rest/api/2/search",
+			"POST /rest/api/2/issue",
+			"GET /rest/api/2/issue/SEC-1/transitions",
+			"POST /rest/api/2/issue/SEC-1/comment",
+			"POST /rest/api/2/issue/SEC-1/transitions",
+		}, requests)
+		assert.Equal(t, "PAY", created.Fields.Project.Key)
+		assert.Equal(t, "Bug", created.Fields.IssueType.Name)
+		assert.Equal(t, "CVE-2016-0001 (Critical) in registry.example.com/team/app:latest", created.Fields.Summary)
+		assert.Contains(t, created.Fields.Description, "|openssl|1.0.1|1.0.2|")
+		assert.Contains(t, created.Fields.Labels, "clair-"+findingKey("registry.example.com/team/app:latest", vulnerability))
+	}
+
+	// Vulnerabilities below the threshold have no issue.
+	requests = nil
+	vulnerability.Severity = types.Medium
+	j.SetDatastore(notificationDatastore(vulnerability))
+	assert.Nil(t, j.Send(database.VulnerabilityNotification{Name: "notification"}))
+	assert.NotContains(t, requests, "POST /rest/api/2/issue")
+}
@@ -0,0 +1,194 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/notifier"
+	"github.com/coreos/clair/utils/types"
+)
+
+const defaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// A PagerDutyNotifier triggers a PagerDuty alert for every vulnerability above a severity threshold,
+// using the Events API v2.
+//
+// Alerts are deduplicated by vulnerability, so that the notifications about a vulnerability update
+// a single alert, which is resolved once the vulnerability is removed or falls below the threshold.
+type PagerDutyNotifier struct {
+	config    PagerDutyNotifierConfiguration
+	severity  types.Priority
+	datastore database.Datastore
+	client    *http.Client
+}
+
+// A PagerDutyNotifierConfiguration represents the configuration of a PagerDutyNotifier.
+type PagerDutyNotifierConfiguration struct {
+	// RoutingKey is the integration key of the default PagerDuty service.
+	RoutingKey string
+	// URL is the URL of the Events API, "https://events.pagerduty.com/v2/enqueue" by default.
+	URL string
+
+	// Channels are the integration keys of the channels that notifications can be routed to, by
+	// name.
+	Channels map[string]string
+
+	// Severity is the lowest severity of the vulnerabilities that alerts are triggered for.
+	Severity string
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	Links       []pagerDutyLink   `json:"links,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text,omitempty"`
+}
+
+func init() {
+	notifier.RegisterNotifier("pagerduty", &PagerDutyNotifier{})
+}
+
+func (p *PagerDutyNotifier) SetDatastore(datastore database.Datastore) {
+	p.datastore = datastore
+}
+
+func (p *PagerDutyNotifier) Configure(config *config.NotifierConfig) (bool, error) {
+	// Get configuration
+	var pagerDutyConfig PagerDutyNotifierConfiguration
+	if config == nil {
+		return false, nil
+	}
+	ok, err := config.DecodeParams("pagerduty", &pagerDutyConfig)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	// Validate configuration.
+	if pagerDutyConfig.RoutingKey == "" && len(pagerDutyConfig.Channels) == 0 {
+		return false, nil
+	}
+	if pagerDutyConfig.URL == "" {
+		pagerDutyConfig.URL = defaultPagerDutyURL
+	}
+	if _, err := url.ParseRequestURI(pagerDutyConfig.URL); err != nil {
+		return false, fmt.Errorf("could not parse PagerDuty URL: %s", err)
+	}
+	if p.severity, err = parseSeverity(pagerDutyConfig.Severity); err != nil {
+		return false, err
+	}
+
+	p.config = pagerDutyConfig
+	p.client = &http.Client{Timeout: timeout}
+	return true, nil
+}
+
+func (p *PagerDutyNotifier) Send(notification database.VulnerabilityNotification) error {
+	// Only the routed notifications are sent when there are channels but no default service.
+	if p.config.RoutingKey == "" {
+		return nil
+	}
+	return p.send(p.config.RoutingKey, notification)
+}
+
+func (p *PagerDutyNotifier) HasChannel(channel string) bool {
+	_, ok := p.config.Channels[channel]
+	return ok
+}
+
+func (p *PagerDutyNotifier) SendToChannel(notification database.VulnerabilityNotification, channel, key string) error {
+	return p.send(p.config.Channels[channel], notification)
+}
+
+// send triggers or updates the alert of the vulnerability of a notification if it is above the
+// threshold, or resolves it otherwise.
+func (p *PagerDutyNotifier) send(routingKey string, notification database.VulnerabilityNotification) error {
+	event, err := notificationEvent(p.datastore, notification.Name, "")
+	if err != nil {
+		return err
+	}
+
+	pdEvent := pagerDutyEvent{
+		RoutingKey: routingKey,
+		DedupKey:   "clair-" + hashKey(event.attribute("namespace"), event.attribute("vulnerability")),
+	}
+
+	newSeverity := types.Priority(event.attribute("newSeverity"))
+	if newSeverity == "" || newSeverity.Compare(p.severity) < 0 {
+		// There is no alert to resolve if the vulnerability has never been above the threshold.
+		if oldSeverity := types.Priority(event.attribute("oldSeverity")); oldSeverity == "" || oldSeverity.Compare(p.severity) < 0 {
+			return nil
+		}
+		pdEvent.EventAction = "resolve"
+	} else {
+		pdEvent.EventAction = "trigger"
+		pdEvent.Payload = &pagerDutyPayload{
+			Summary:   fmt.Sprintf("%s (%s)", event.Name, severityChange(event)),
+			Source:    eventProduct,
+			Severity:  pagerDutySeverity(event.Severity),
+			Timestamp: event.Time.UTC().Format(time.RFC3339),
+			Component: event.attribute("namespace"),
+			Class:     event.ID,
+			CustomDetails: map[string]string{
+				"notification":  event.attribute("notification"),
+				"vulnerability": event.attribute("vulnerability"),
+				"namespace":     event.attribute("namespace"),
+				"severity":      severityChange(event),
+				"images":        strings.Replace(event.attribute("images"), ",", ", ", -1),
+			},
+		}
+		if link := event.attribute("link"); link != "" {
+			pdEvent.Links = []pagerDutyLink{{Href: link, Text: event.attribute("vulnerability")}}
+		}
+	}
+
+	return doJSON(p.client, "POST", p.config.URL, func(*http.Request) {}, pdEvent, nil)
+}
+
+// pagerDutySeverity returns the PagerDuty severity of the alerts of an event severity.
+func pagerDutySeverity(severity int) string {
+	switch {
+	case severity >= 9:
+		return "critical"
+	case severity >= 7:
+		return "error"
+	case severity >= 5:
+		return "warning"
+	default:
+		return "info"
+	}
+}
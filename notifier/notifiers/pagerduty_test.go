@@ -0,0 +1,83 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestPagerDutyNotifier(t *testing.T) {
+	var events []pagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event pagerDutyEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	datastore := syslogDatastore()
+	p := &PagerDutyNotifier{}
+	p.SetDatastore(datastore)
+	configured, err := p.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"pagerduty": map[string]interface{}{"url": server.URL, "routingkey": "security", "severity": "High"},
+	}})
+	if !assert.True(t, configured) || !assert.Nil(t, err) {
+		return
+	}
+
+	// The vulnerability rose above the threshold: an alert is triggered.
+	if assert.Nil(t, p.Send(database.VulnerabilityNotification{Name: "notification"})) && assert.Len(t, events, 1) {
+		event := events[0]
+		assert.Equal(t, "security", event.RoutingKey)
+		assert.Equal(t, "trigger", event.EventAction)
+		assert.Equal(t, "clair-"+hashKey("debian:8", "CVE-2016-0001"), event.DedupKey)
+		if assert.NotNil(t, event.Payload) {
+			assert.Equal(t, "CVE-2016-0001 updated (Medium -> Critical)", event.Payload.Summary)
+			assert.Equal(t, "critical", event.Payload.Severity)
+			assert.Equal(t, "2016-11-07T10:00:00Z", event.Payload.Timestamp)
+		}
+	}
+
+	// The vulnerability fell below the threshold: the alert is resolved with the same key.
+	getNotification := datastore.FctGetNotification
+	datastore.FctGetNotification = func(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
+		notification, page, err := getNotification(name, limit, page)
+		notification.OldVulnerability, notification.NewVulnerability = notification.NewVulnerability, notification.OldVulnerability
+		notification.NewVulnerability.Namespace = notification.OldVulnerability.Namespace
+		return notification, page, err
+	}
+	if assert.Nil(t, p.Send(database.VulnerabilityNotification{Name: "notification"})) && assert.Len(t, events, 2) {
+		assert.Equal(t, "resolve", events[1].EventAction)
+		assert.Equal(t, events[0].DedupKey, events[1].DedupKey)
+		assert.Nil(t, events[1].Payload)
+	}
+
+	// Nothing is sent about the vulnerabilities that have never been above the threshold.
+	datastore.FctGetNotification = func(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
+		return database.VulnerabilityNotification{Name: name, NewVulnerability: &database.Vulnerability{Name: "CVE-2016-0002", Severity: types.Low}}, database.NoVulnerabilityNotificationPage, nil
+	}
+	assert.Nil(t, p.Send(database.VulnerabilityNotification{Name: "notification"}))
+	assert.Len(t, events, 2)
+}
@@ -0,0 +1,257 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/notifier"
+	"github.com/coreos/clair/ownership"
+	"github.com/coreos/clair/utils/types"
+)
+
+const (
+	defaultServiceNowTable = "sn_si_incident"
+	// serviceNowClosedState is the state of the closed security incidents.
+	serviceNowClosedState = "3"
+)
+
+// A ServiceNowNotifier files a security incident in ServiceNow for every image of a watched tag
+// affected by a vulnerability above a severity threshold, in the same way as the JiraNotifier.
+//
+// Incidents are identified by their correlation ID, and their fields are rendered from templates.
+type ServiceNowNotifier struct {
+	config      ServiceNowNotifierConfiguration
+	severity    types.Priority
+	fields      map[string]*template.Template
+	closeFields map[string]string
+	datastore   database.Datastore
+	client      *http.Client
+}
+
+// A ServiceNowNotifierConfiguration represents the configuration of a ServiceNowNotifier.
+type ServiceNowNotifierConfiguration struct {
+	// URL is the base URL of the instance, e.g. "https://example.service-now.com".
+	URL      string
+	Username string
+	Password string
+
+	// Table is the table of the incidents, "sn_si_incident" by default.
+	Table string
+
+	// Fields are the templates of the fields of the incidents, by field name, which override and
+	// complement the default short_description and description. They are executed with a
+	// ServiceNowIncident.
+	Fields map[string]string
+
+	// CloseFields are the values of the fields closing the incidents, by default a state of 3.
+	CloseFields map[string]string
+
+	// Severity is the lowest severity of the vulnerabilities that incidents are filed for.
+	Severity string
+}
+
+// A ServiceNowIncident is the data the templates of the fields of an incident are executed with.
+type ServiceNowIncident struct {
+	Vulnerability database.Vulnerability
+	// Image is the reference of the affected image, and Owners its owners.
+	Image  string
+	Owners []string
+	// Features are the affected features of the image, as "name version".
+	Features []string
+	// Title and Description are the default short description and description.
+	Title       string
+	Description string
+}
+
+func init() {
+	notifier.RegisterNotifier("servicenow", &ServiceNowNotifier{})
+}
+
+func (s *ServiceNowNotifier) SetDatastore(datastore database.Datastore) {
+	s.datastore = datastore
+}
+
+func (s *ServiceNowNotifier) Configure(config *config.NotifierConfig) (bool, error) {
+	// Get configuration
+	var serviceNowConfig ServiceNowNotifierConfiguration
+	if config == nil {
+		return false, nil
+	}
+	ok, err := config.DecodeParams("servicenow", &serviceNowConfig)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	// Validate configuration.
+	if serviceNowConfig.URL == "" {
+		return false, nil
+	}
+	if _, err := url.ParseRequestURI(serviceNowConfig.URL); err != nil {
+		return false, fmt.Errorf("could not parse ServiceNow URL: %s", err)
+	}
+	serviceNowConfig.URL = strings.TrimSuffix(serviceNowConfig.URL, "/")
+	if serviceNowConfig.Table == "" {
+		serviceNowConfig.Table = defaultServiceNowTable
+	}
+	if s.severity, err = parseSeverity(serviceNowConfig.Severity); err != nil {
+		return false, err
+	}
+
+	s.fields = map[string]*template.Template{
+		"short_description": template.Must(template.New("short_description").Parse("{{.Title}}")),
+		"description":       template.Must(template.New("description").Parse("{{.Description}}")),
+	}
+	for field, text := range serviceNowConfig.Fields {
+		if s.fields[field], err = template.New(field).Parse(text); err != nil {
+			return false, fmt.Errorf("could not parse the template of field '%s': %s", field, err)
+		}
+	}
+	s.closeFields = serviceNowConfig.CloseFields
+	if len(s.closeFields) == 0 {
+		s.closeFields = map[string]string{"state": serviceNowClosedState}
+	}
+
+	s.config = serviceNowConfig
+	s.client = &http.Client{Timeout: timeout}
+	return true, nil
+}
+
+// Send files, updates or closes the incidents of the vulnerability the notification is about.
+func (s *ServiceNowNotifier) Send(notification database.VulnerabilityNotification) error {
+	return syncIssues(s.datastore, s, notification.Name, s.severity, false)
+}
+
+// searchIssues returns the active incidents of a vulnerability. The incidents have no labels: their
+// correlation ID joins the ones identifying their vulnerability and finding with a slash instead,
+// e.g. "clair-<vulnerability>/clair-<finding>".
+func (s *ServiceNowNotifier) searchIssues(label string) ([]issue, error) {
+	var issues []issue
+	for offset := 0; ; offset += issuePageSize {
+		query := url.Values{}
+		query.Set("sysparm_query", "active=true^correlation_idSTARTSWITH"+label+"/")
+		query.Set("sysparm_fields", "sys_id,correlation_id")
+		query.Set("sysparm_limit", fmt.Sprint(issuePageSize))
+		query.Set("sysparm_offset", fmt.Sprint(offset))
+
+		var result struct {
+			Result []struct {
+				SysID         string `json:"sys_id"`
+				CorrelationID string `json:"correlation_id"`
+			} `json:"result"`
+		}
+		if err := s.do("GET", "?"+query.Encode(), nil, &result); err != nil {
+			return nil, err
+		}
+		for _, incident := range result.Result {
+			issues = append(issues, issue{ID: incident.SysID, Labels: strings.Split(incident.CorrelationID, "/")})
+		}
+		if len(result.Result) < issuePageSize {
+			return issues, nil
+		}
+	}
+}
+
+func (s *ServiceNowNotifier) openIssue(image imageFindings, title, description string, labels []string) error {
+	fields, err := s.render(image, title, description)
+	if err != nil {
+		return err
+	}
+	fields["correlation_id"] = strings.Join(labels[1:], "/")
+	return s.do("POST", "", fields, nil)
+}
+
+func (s *ServiceNowNotifier) updateIssue(issue issue, image imageFindings, title, description string, labels []string) error {
+	fields, err := s.render(image, title, description)
+	if err != nil {
+		return err
+	}
+	return s.do("PATCH", "/"+issue.ID, fields, nil)
+}
+
+func (s *ServiceNowNotifier) closeIssue(issue issue, comment string) error {
+	fields := map[string]string{"work_notes": comment}
+	for field, value := range s.closeFields {
+		fields[field] = value
+	}
+	return s.do("PATCH", "/"+issue.ID, fields, nil)
+}
+
+// describe returns the short description and the plain text description of the incident of a
+// vulnerability in an image.
+func (s *ServiceNowNotifier) describe(vulnerability database.Vulnerability, image imageFindings) (string, string) {
+	title := fmt.Sprintf("%s (%s) in %s", vulnerability.Name, vulnerability.Severity, image.Reference)
+
+	var description bytes.Buffer
+	fmt.Fprintf(&description, "%s affects the image %s.\n\n", vulnerability.Name, image.Reference)
+	if vulnerability.Description != "" {
+		fmt.Fprintf(&description, "%s\n\n", vulnerability.Description)
+	}
+	if vulnerability.Link != "" {
+		fmt.Fprintf(&description, "%s\n\n", vulnerability.Link)
+	}
+	for _, featureVersion := range image.Features {
+		fmt.Fprintf(&description, "- %s %s, fixed by %s", featureVersion.Feature.Name, featureVersion.Version, fixedBy(featureVersion))
+		if command := remediationCommand(featureVersion); command != "" {
+			fmt.Fprintf(&description, ": %s", command)
+		}
+		fmt.Fprintf(&description, "\n")
+	}
+
+	return title, description.String()
+}
+
+// render executes the templates of the fields of the incident of an image.
+func (s *ServiceNowNotifier) render(image imageFindings, title, description string) (map[string]string, error) {
+	incident := ServiceNowIncident{
+		Image:       image.Reference,
+		Title:       title,
+		Description: description,
+	}
+	if image.Name != "" {
+		incident.Owners = ownership.Owners(image.Name)
+	}
+	for _, featureVersion := range image.Features {
+		// The findings of an image are all affected by the vulnerability of the incident only.
+		incident.Features = append(incident.Features, featureVersion.Feature.Name+" "+featureVersion.Version)
+		incident.Vulnerability = featureVersion.AffectedBy[0]
+	}
+
+	fields := make(map[string]string)
+	for field, tmpl := range s.fields {
+		var value bytes.Buffer
+		if err := tmpl.Execute(&value, incident); err != nil {
+			return nil, fmt.Errorf("could not execute the template of field '%s': %s", field, err)
+		}
+		fields[field] = value.String()
+	}
+	return fields, nil
+}
+
+// do sends a request about the table of the incidents to the Table API of ServiceNow.
+func (s *ServiceNowNotifier) do(method, path string, body, v interface{}) error {
+	return doJSON(s.client, method, s.config.URL+"/api/now/table/"+s.config.Table+path, func(req *http.Request) {
+		if s.config.Username != "" {
+			req.SetBasicAuth(s.config.Username, s.config.Password)
+		}
+	}, body, v)
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestServiceNowNotifier(t *testing.T) {
+	vulnerability := database.Vulnerability{
+		Name:      "CVE-2016-0001",
+		Namespace: database.Namespace{Name: "debian:8"},
+		Severity:  types.Critical,
+	}
+	vulnerabilityLabel := "clair-" + vulnerabilityKey(vulnerability)
+	legacyLabel := "clair-" + findingKey("registry.example.com/team/legacy:latest", vulnerability)
+	appLabel := "clair-" + findingKey("registry.example.com/team/app:latest", vulnerability)
+
+	var created map[string]string
+	closed := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		assert.Equal(t, "clair:secret", username+":"+password)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/now/table/sn_si_incident":
+			assert.Equal(t, "active=true^correlation_idSTARTSWITH"+vulnerabilityLabel+"/", r.URL.Query().Get("sysparm_query"))
+			fmt.Fprintf(w, `{"result": [{"sys_id": "1", "correlation_id": "%s/%s"}]}`, vulnerabilityLabel, legacyLabel)
+		case "POST /api/now/table/sn_si_incident":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+		case "PATCH /api/now/table/sn_si_incident/1":
+			json.NewDecoder(r.Body).Decode(&closed)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	s := &ServiceNowNotifier{}
+	s.SetDatastore(notificationDatastore(vulnerability))
+	configured, err := s.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"servicenow": map[string]interface{}{
+			"url":      server.URL,
+			"username": "clair",
+			"password": "secret",
+			"fields": map[string]string{
+				"category":          "vulnerability",
+				"priority":          `{{if eq .Vulnerability.Severity "Critical"}}1{{else}}3{{end}}`,
+				"short_description": "{{.Vulnerability.Name}}: {{.Image}}",
+			},
+		},
+	}})
+	if !assert.True(t, configured) || !assert.Nil(t, err) {
+		return
+	}
+
+	// An incident is filed for the affected image, and the one of the image that isn't affected
+	// anymore is closed.
+	if assert.Nil(t, s.Send(database.VulnerabilityNotification{Name: "notification"})) {
+		assert.Equal(t, vulnerabilityLabel+"/"+appLabel, created["correlation_id"])
+		assert.Equal(t, "CVE-2016-0001: registry.example.com/team/app:latest", created["short_description"])
+		assert.Contains(t, created["description"], "- openssl 1.0.1, fixed by 1.0.2")
+		assert.Equal(t, "vulnerability", created["category"])
+		assert.Equal(t, "1", created["priority"])
+		assert.Equal(t, "3", closed["state"])
+		assert.Equal(t, "CVE-2016-0001 no longer affects the image.", closed["work_notes"])
+	}
+}
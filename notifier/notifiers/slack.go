@@ -0,0 +1,163 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/notifier"
+)
+
+// A SlackNotifier posts a message describing the change of the vulnerability of every notification
+// to a Slack channel, via incoming webhooks.
+type SlackNotifier struct {
+	config    SlackNotifierConfiguration
+	datastore database.Datastore
+	client    *http.Client
+}
+
+// A SlackNotifierConfiguration represents the configuration of a SlackNotifier.
+type SlackNotifierConfiguration struct {
+	// URL is the URL of the incoming webhook of the default Slack channel.
+	URL string
+
+	// Channels are the URLs of the incoming webhooks of the channels that notifications can be
+	// routed to, by name.
+	Channels map[string]string
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color     string       `json:"color,omitempty"`
+	Title     string       `json:"title,omitempty"`
+	TitleLink string       `json:"title_link,omitempty"`
+	Fields    []slackField `json:"fields,omitempty"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short,omitempty"`
+}
+
+func init() {
+	notifier.RegisterNotifier("slack", &SlackNotifier{})
+}
+
+func (s *SlackNotifier) SetDatastore(datastore database.Datastore) {
+	s.datastore = datastore
+}
+
+func (s *SlackNotifier) Configure(config *config.NotifierConfig) (bool, error) {
+	// Get configuration
+	var slackConfig SlackNotifierConfiguration
+	if config == nil {
+		return false, nil
+	}
+	ok, err := config.DecodeParams("slack", &slackConfig)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	// Validate webhook URLs.
+	if slackConfig.URL == "" && len(slackConfig.Channels) == 0 {
+		return false, nil
+	}
+	if slackConfig.URL != "" {
+		if _, err := url.ParseRequestURI(slackConfig.URL); err != nil {
+			return false, fmt.Errorf("could not parse Slack webhook URL: %s", err)
+		}
+	}
+	for channel, webhookURL := range slackConfig.Channels {
+		if _, err := url.ParseRequestURI(webhookURL); err != nil {
+			return false, fmt.Errorf("could not parse Slack webhook URL of channel '%s': %s", channel, err)
+		}
+	}
+
+	s.config = slackConfig
+	s.client = &http.Client{Timeout: timeout}
+	return true, nil
+}
+
+func (s *SlackNotifier) Send(notification database.VulnerabilityNotification) error {
+	// Only the routed notifications are sent when there are channels but no default webhook.
+	if s.config.URL == "" {
+		return nil
+	}
+	return s.send(s.config.URL, notification)
+}
+
+func (s *SlackNotifier) HasChannel(channel string) bool {
+	_, ok := s.config.Channels[channel]
+	return ok
+}
+
+func (s *SlackNotifier) SendToChannel(notification database.VulnerabilityNotification, channel, key string) error {
+	return s.send(s.config.Channels[channel], notification)
+}
+
+func (s *SlackNotifier) send(webhookURL string, notification database.VulnerabilityNotification) error {
+	event, err := notificationEvent(s.datastore, notification.Name, "")
+	if err != nil {
+		return err
+	}
+	return doJSON(s.client, "POST", webhookURL, func(*http.Request) {}, slackEventMessage(event), nil)
+}
+
+// slackEventMessage returns the message describing an event, colored by its severity.
+func slackEventMessage(event vulnerabilityEvent) slackMessage {
+	attachment := slackAttachment{
+		Color:     slackColor(event.Severity),
+		Title:     event.attribute("vulnerability"),
+		TitleLink: event.attribute("link"),
+		Fields: []slackField{
+			{Title: "Namespace", Value: event.attribute("namespace"), Short: true},
+			{Title: "Severity", Value: severityChange(event), Short: true},
+		},
+	}
+	if images := event.attribute("images"); images != "" {
+		attachment.Fields = append(attachment.Fields, slackField{
+			Title: "Affected images",
+			Value: strings.Replace(images, ",", "\n", -1),
+		})
+	}
+	attachment.Fields = append(attachment.Fields, slackField{Title: "Notification", Value: event.attribute("notification")})
+
+	return slackMessage{
+		Text:        event.Name,
+		Attachments: []slackAttachment{attachment},
+	}
+}
+
+// slackColor returns the color of the messages of an event severity.
+func slackColor(severity int) string {
+	switch {
+	case severity >= 7:
+		return "danger"
+	case severity >= 5:
+		return "warning"
+	default:
+		return "good"
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+func TestSlackNotifier(t *testing.T) {
+	messages := make(map[string]slackMessage)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message slackMessage
+		json.NewDecoder(r.Body).Decode(&message)
+		messages[r.URL.Path] = message
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	s := &SlackNotifier{}
+	s.SetDatastore(syslogDatastore())
+	configured, err := s.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"slack": map[string]interface{}{
+			"url":      server.URL + "/security",
+			"channels": map[string]string{"payments": server.URL + "/payments"},
+		},
+	}})
+	if !assert.True(t, configured) || !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Nil(t, s.Send(database.VulnerabilityNotification{Name: "notification"}))
+	assert.Nil(t, s.SendToChannel(database.VulnerabilityNotification{Name: "notification"}, "payments", "key"))
+	assert.Equal(t, messages["/security"], messages["/payments"])
+
+	message := messages["/security"]
+	assert.Equal(t, "CVE-2016-0001 updated", message.Text)
+	if assert.Len(t, message.Attachments, 1) {
+		attachment := message.Attachments[0]
+		assert.Equal(t, "danger", attachment.Color)
+		assert.Equal(t, "https://example.com/CVE-2016-0001?a=b", attachment.TitleLink)
+		assert.Contains(t, attachment.Fields, slackField{Title: "Severity", Value: "Medium -> Critical", Short: true})
+		assert.Contains(t, attachment.Fields, slackField{Title: "Affected images", Value: "registry.example.com/team/app:latest\nregistry.example.com/team/legacy:latest"})
+	}
+}
@@ -0,0 +1,424 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/notifier"
+	"github.com/coreos/clair/registry"
+	"github.com/coreos/clair/utils/types"
+)
+
+const (
+	// eventVendor, eventProduct and eventVersion identify Clair in the headers of the events.
+	eventVendor  = "CoreOS"
+	eventProduct = "Clair"
+	eventVersion = "1"
+
+	syslogAppName = "clair"
+	syslogMsgID   = "vulnerability"
+)
+
+// syslogFacilities are the syslog facilities, by name.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// A SyslogNotifier sends an event in the Common Event Format (CEF) or in the Log Event Extended
+// Format (LEEF) to a syslog server for every notification, so that SIEMs can ingest the changes of
+// the vulnerabilities without custom parsers.
+//
+// Messages follow RFC 5424 and are framed by their length over TCP and TLS, as in RFC 5425.
+type SyslogNotifier struct {
+	config    SyslogNotifierConfiguration
+	facility  int
+	hostname  string
+	tlsConfig *tls.Config
+	datastore database.Datastore
+}
+
+// A SyslogNotifierConfiguration represents the configuration of a SyslogNotifier.
+type SyslogNotifierConfiguration struct {
+	// Address is the address of the syslog server, e.g. "siem.example.com:514".
+	Address string
+	// Network is "udp", "tcp" or "tls", "udp" by default.
+	Network string
+	// Format is "cef" or "leef", "cef" by default.
+	Format string
+	// Facility is the name of the syslog facility of the messages, "local0" by default.
+	Facility string
+
+	// ServerName, CertFile, KeyFile and CAFile configure the TLS connections.
+	ServerName string
+	CertFile   string
+	KeyFile    string
+	CAFile     string
+}
+
+// A vulnerabilityEvent is a change of a vulnerability, rendered as an event.
+type vulnerabilityEvent struct {
+	// ID is the kind of change, e.g. "vulnerability-added", and Name describes it.
+	ID   string
+	Name string
+	// Severity is the severity of the event, from 0 to 10.
+	Severity int
+	Time     time.Time
+
+	// Attributes are the attributes of the event, in order.
+	Attributes [][2]string
+}
+
+// attribute returns the value of the named attribute of the event, or an empty string.
+func (event vulnerabilityEvent) attribute(name string) string {
+	for _, attribute := range event.Attributes {
+		if attribute[0] == name {
+			return attribute[1]
+		}
+	}
+	return ""
+}
+
+func init() {
+	notifier.RegisterNotifier("syslog", &SyslogNotifier{})
+}
+
+func (s *SyslogNotifier) SetDatastore(datastore database.Datastore) {
+	s.datastore = datastore
+}
+
+func (s *SyslogNotifier) Configure(config *config.NotifierConfig) (bool, error) {
+	// Get configuration
+	var syslogConfig SyslogNotifierConfiguration
+	if config == nil {
+		return false, nil
+	}
+	ok, err := config.DecodeParams("syslog", &syslogConfig)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	// Validate configuration.
+	if syslogConfig.Address == "" {
+		return false, nil
+	}
+	if _, _, err := net.SplitHostPort(syslogConfig.Address); err != nil {
+		return false, fmt.Errorf("could not parse syslog address: %s", err)
+	}
+	switch syslogConfig.Network {
+	case "":
+		syslogConfig.Network = "udp"
+	case "udp", "tcp", "tls":
+	default:
+		return false, fmt.Errorf("unknown syslog network '%s', expected udp, tcp or tls", syslogConfig.Network)
+	}
+	switch syslogConfig.Format {
+	case "":
+		syslogConfig.Format = "cef"
+	case "cef", "leef":
+	default:
+		return false, fmt.Errorf("unknown event format '%s', expected cef or leef", syslogConfig.Format)
+	}
+	if syslogConfig.Facility == "" {
+		syslogConfig.Facility = "local0"
+	}
+	facility, ok := syslogFacilities[syslogConfig.Facility]
+	if !ok {
+		return false, fmt.Errorf("unknown syslog facility '%s'", syslogConfig.Facility)
+	}
+
+	// Initialize TLS.
+	if syslogConfig.Network == "tls" {
+		if s.tlsConfig, err = loadSyslogTLSConfig(&syslogConfig); err != nil {
+			return false, fmt.Errorf("could not initialize TLS: %s", err)
+		}
+	}
+
+	s.hostname, err = os.Hostname()
+	if err != nil {
+		s.hostname = "-"
+	}
+	s.facility = facility
+	s.config = syslogConfig
+	return true, nil
+}
+
+func (s *SyslogNotifier) Send(notification database.VulnerabilityNotification) error {
+	return s.SendWithKey(notification, "")
+}
+
+// SendWithKey sends the event of a notification, identified by the key of the delivery, so that
+// SIEMs can deduplicate the events of retried deliveries.
+func (s *SyslogNotifier) SendWithKey(notification database.VulnerabilityNotification, key string) error {
+	event, err := notificationEvent(s.datastore, notification.Name, key)
+	if err != nil {
+		return err
+	}
+
+	var message string
+	if s.config.Format == "leef" {
+		message = formatLEEF(event)
+	} else {
+		message = formatCEF(event)
+	}
+	return s.write(s.syslogMessage(event, message))
+}
+
+// syslogMessage returns the RFC 5424 message of an event.
+func (s *SyslogNotifier) syslogMessage(event vulnerabilityEvent, message string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s - %s - %s", s.facility*8+syslogSeverity(event.Severity), event.Time.UTC().Format(time.RFC3339), s.hostname, syslogAppName, syslogMsgID, message)
+}
+
+// write sends a message to the syslog server over a new connection.
+func (s *SyslogNotifier) write(message string) error {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	var err error
+	switch s.config.Network {
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.config.Address, s.tlsConfig)
+	default:
+		conn, err = dialer.Dial(s.config.Network, s.config.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("could not connect to the syslog server: %s", err)
+	}
+	defer conn.Close()
+
+	// Messages are framed by their length over streams.
+	if s.config.Network != "udp" {
+		message = fmt.Sprintf("%d %s", len(message), message)
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte(message)); err != nil {
+		return fmt.Errorf("could not send to the syslog server: %s", err)
+	}
+	return nil
+}
+
+// notificationEvent returns the event of the change of the vulnerability a notification is about.
+func notificationEvent(datastore database.Datastore, name, key string) (vulnerabilityEvent, error) {
+	notification, _, err := datastore.GetNotification(name, 1, database.VulnerabilityNotificationFirstPage)
+	if err != nil {
+		return vulnerabilityEvent{}, fmt.Errorf("could not get notification: %s", err)
+	}
+	watchedTags, err := datastore.ListNotificationWatchedTags(name)
+	if err != nil {
+		return vulnerabilityEvent{}, fmt.Errorf("could not find the affected images: %s", err)
+	}
+
+	var vulnerability database.Vulnerability
+	var oldSeverity, newSeverity types.Priority
+	event := vulnerabilityEvent{Time: notification.Created}
+	switch {
+	case notification.OldVulnerability == nil && notification.NewVulnerability != nil:
+		vulnerability = *notification.NewVulnerability
+		newSeverity = vulnerability.Severity
+		event.ID, event.Name = "vulnerability-added", vulnerability.Name+" added"
+	case notification.NewVulnerability == nil && notification.OldVulnerability != nil:
+		vulnerability = *notification.OldVulnerability
+		oldSeverity = vulnerability.Severity
+		event.ID, event.Name = "vulnerability-removed", vulnerability.Name+" removed"
+	case notification.NewVulnerability != nil:
+		vulnerability = *notification.NewVulnerability
+		oldSeverity, newSeverity = notification.OldVulnerability.Severity, vulnerability.Severity
+		event.ID, event.Name = "vulnerability-updated", vulnerability.Name+" updated"
+	default:
+		return vulnerabilityEvent{}, fmt.Errorf("notification '%s' has no vulnerability", name)
+	}
+	event.Severity = eventSeverity(notification.Priority)
+	if notification.Priority == "" {
+		event.Severity = eventSeverity(vulnerability.Severity)
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if key == "" {
+		key = name
+	}
+
+	var images []string
+	for _, watchedTag := range watchedTags {
+		images = append(images, registry.ImageName(watchedTag.Registry, watchedTag.Repository)+":"+watchedTag.Tag)
+	}
+
+	event.Attributes = [][2]string{
+		{"externalId", key},
+		{"notification", name},
+		{"vulnerability", vulnerability.Name},
+		{"namespace", vulnerability.Namespace.Name},
+		{"oldSeverity", string(oldSeverity)},
+		{"newSeverity", string(newSeverity)},
+		{"link", vulnerability.Link},
+		{"images", strings.Join(images, ",")},
+	}
+	return event, nil
+}
+
+// cefExtensions are the CEF extensions of the attributes of the events.
+var cefExtensions = map[string]string{
+	"externalId":    "externalId",
+	"notification":  "cs1",
+	"vulnerability": "cs2",
+	"namespace":     "cs3",
+	"oldSeverity":   "cs4",
+	"newSeverity":   "cs5",
+	"link":          "cs6",
+	"images":        "msg",
+}
+
+// formatCEF renders an event in the Common Event Format, in which the custom strings are labeled
+// with the names of the attributes.
+func formatCEF(event vulnerabilityEvent) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CEF:0|%s|%s|%s|%s|%s|%d|rt=%d", eventVendor, eventProduct, eventVersion, escapeCEFHeader(event.ID), escapeCEFHeader(event.Name), event.Severity, event.Time.UnixNano()/int64(time.Millisecond))
+	for _, attribute := range event.Attributes {
+		extension := cefExtensions[attribute[0]]
+		fmt.Fprintf(&buf, " %s=%s", extension, escapeCEFExtension(attribute[1]))
+		if strings.HasPrefix(extension, "cs") {
+			fmt.Fprintf(&buf, " %sLabel=%s", extension, attribute[0])
+		}
+	}
+	return buf.String()
+}
+
+// formatLEEF renders an event in the Log Event Extended Format 1.0, whose attributes are separated
+// by tabs.
+func formatLEEF(event vulnerabilityEvent) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "LEEF:1.0|%s|%s|%s|%s|", eventVendor, eventProduct, eventVersion, escapeLEEFHeader(event.ID))
+	fmt.Fprintf(&buf, "devTime=%s\tdevTimeFormat=%s\tsev=%d\tname=%s", event.Time.UTC().Format(leefTimeLayout), leefTimeFormat, leefSeverity(event.Severity), escapeLEEFAttribute(event.Name))
+	for _, attribute := range event.Attributes {
+		fmt.Fprintf(&buf, "\t%s=%s", attribute[0], escapeLEEFAttribute(attribute[1]))
+	}
+	return buf.String()
+}
+
+// leefTimeLayout and leefTimeFormat are the layout of the time of the events and its description.
+const (
+	leefTimeLayout = "Jan 02 2006 15:04:05.000 MST"
+	leefTimeFormat = "MMM dd yyyy HH:mm:ss.SSS zzz"
+)
+
+var (
+	cefHeaderReplacer    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionReplacer = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+	leefHeaderReplacer   = strings.NewReplacer(`|`, `\|`, "\n", " ", "\r", " ")
+	leefValueReplacer    = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+)
+
+func escapeCEFHeader(s string) string {
+	return cefHeaderReplacer.Replace(s)
+}
+
+func escapeCEFExtension(s string) string {
+	return cefExtensionReplacer.Replace(s)
+}
+
+func escapeLEEFHeader(s string) string {
+	return leefHeaderReplacer.Replace(s)
+}
+
+func escapeLEEFAttribute(s string) string {
+	return leefValueReplacer.Replace(s)
+}
+
+// eventSeverity returns the severity, from 0 to 10, of the events of the given severity.
+func eventSeverity(severity types.Priority) int {
+	switch severity {
+	case types.Negligible:
+		return 1
+	case types.Low:
+		return 3
+	case types.Medium:
+		return 5
+	case types.High:
+		return 7
+	case types.Critical:
+		return 9
+	case types.Defcon1:
+		return 10
+	default:
+		return 0
+	}
+}
+
+// leefSeverity returns the LEEF severity, from 1 to 10, of an event severity.
+func leefSeverity(severity int) int {
+	if severity < 1 {
+		return 1
+	}
+	return severity
+}
+
+// syslogSeverity returns the syslog severity of the messages of an event severity.
+func syslogSeverity(severity int) int {
+	switch {
+	case severity >= 9:
+		return 2 // Critical
+	case severity >= 7:
+		return 3 // Error
+	case severity >= 5:
+		return 4 // Warning
+	case severity >= 3:
+		return 5 // Notice
+	default:
+		return 6 // Informational
+	}
+}
+
+// loadSyslogTLSConfig initializes the *tls.Config of the connections to the syslog server.
+//
+// The client certificate is optional, and the CA certificate falls back to the system default.
+func loadSyslogTLSConfig(cfg *SyslogNotifierConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: cfg.ServerName}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(cfg.Address)
+	}
+
+	if cfg.CertFile != "" && cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFile != "" {
+		caCert, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(caCert)
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiers
+
+import (
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+func syslogDatastore() *database.MockDatastore {
+	datastore := notificationDatastore(database.Vulnerability{
+		Name:      "CVE-2016-0001",
+		Namespace: database.Namespace{Name: "debian:8"},
+		Severity:  types.Critical,
+		Link:      "https://example.com/CVE-2016-0001?a=b",
+	})
+	getNotification := datastore.FctGetNotification
+	datastore.FctGetNotification = func(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
+		notification, page, err := getNotification(name, limit, page)
+		notification.OldVulnerability = &database.Vulnerability{Name: "CVE-2016-0001", Severity: types.Medium}
+		notification.Priority = types.Critical
+		notification.Created = time.Date(2016, 11, 7, 10, 0, 0, 0, time.UTC)
+		return notification, page, err
+	}
+	return datastore
+}
+
+func TestSyslogNotifierCEF(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer listener.Close()
+
+	s := &SyslogNotifier{}
+	s.SetDatastore(syslogDatastore())
+	configured, err := s.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"syslog": map[string]interface{}{"address": listener.Addr().String(), "network": "tcp"},
+	}})
+	if !assert.True(t, configured) || !assert.Nil(t, err) {
+		return
+	}
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		message, _ := ioutil.ReadAll(conn)
+		received <- string(message)
+	}()
+
+	if !assert.Nil(t, s.SendWithKey(database.VulnerabilityNotification{Name: "notification"}, "key")) {
+		return
+	}
+	message := <-received
+
+	// The message is framed by its length, and the severity of the event is the one of the
+	// notification.
+	frame := strings.SplitN(message, " ", 2)
+	assert.Equal(t, strconv.Itoa(len(frame[1])), frame[0])
+	assert.True(t, strings.HasPrefix(frame[1], "<130>1 2016-11-07T10:00:00Z "), frame[1])
+	assert.Contains(t, frame[1], " clair - vulnerability - CEF:0|CoreOS|Clair|1|vulnerability-updated|CVE-2016-0001 updated|9|rt=1478512800000 externalId=key")
+	assert.Contains(t, frame[1], " cs4=Medium cs4Label=oldSeverity cs5=Critical cs5Label=newSeverity")
+	assert.Contains(t, frame[1], " cs6=https://example.com/CVE-2016-0001?a\\=b")
+	assert.Contains(t, frame[1], " msg=registry.example.com/team/app:latest,registry.example.com/team/legacy:latest")
+}
+
+func TestSyslogNotifierLEEF(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	s := &SyslogNotifier{}
+	s.SetDatastore(syslogDatastore())
+	configured, err := s.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"syslog": map[string]interface{}{"address": conn.LocalAddr().String(), "format": "leef", "facility": "auth"},
+	}})
+	if !assert.True(t, configured) || !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Nil(t, s.Send(database.VulnerabilityNotification{Name: "notification"})) {
+		return
+	}
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	n, _, err := conn.ReadFrom(buf)
+	if assert.Nil(t, err) {
+		message := string(buf[:n])
+		assert.True(t, strings.HasPrefix(message, "<34>1 "), message)
+		assert.Contains(t, message, "LEEF:1.0|CoreOS|Clair|1|vulnerability-updated|devTime=Nov 07 2016 10:00:00.000 UTC\tdevTimeFormat=MMM dd yyyy HH:mm:ss.SSS zzz\tsev=9\t")
+		assert.Contains(t, message, "\texternalId=notification\t")
+		assert.Contains(t, message, "\tlink=https://example.com/CVE-2016-0001?a=b\t")
+	}
+}
@@ -20,15 +20,12 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"time"
 
-	"gopkg.in/yaml.v2"
-
 	"github.com/coreos/clair/config"
 	"github.com/coreos/clair/database"
 	"github.com/coreos/clair/notifier"
@@ -39,6 +36,7 @@ const timeout = 5 * time.Second
 // A WebhookNotifier dispatches notifications to a webhook endpoint.
 type WebhookNotifier struct {
 	endpoint string
+	channels map[string]string
 	client   *http.Client
 }
 
@@ -50,6 +48,9 @@ type WebhookNotifierConfiguration struct {
 	KeyFile    string
 	CAFile     string
 	Proxy      string
+
+	// Channels are the endpoints of the channels that notifications can be routed to, by name.
+	Channels map[string]string
 }
 
 func init() {
@@ -62,26 +63,27 @@ func (h *WebhookNotifier) Configure(config *config.NotifierConfig) (bool, error)
 	if config == nil {
 		return false, nil
 	}
-	if _, ok := config.Params["http"]; !ok {
-		return false, nil
-	}
-	yamlConfig, err := yaml.Marshal(config.Params["http"])
-	if err != nil {
-		return false, errors.New("invalid configuration")
-	}
-	err = yaml.Unmarshal(yamlConfig, &httpConfig)
-	if err != nil {
-		return false, errors.New("invalid configuration")
+	ok, err := config.DecodeParams("http", &httpConfig)
+	if !ok || err != nil {
+		return false, err
 	}
 
-	// Validate endpoint URL.
-	if httpConfig.Endpoint == "" {
+	// Validate endpoint URLs.
+	if httpConfig.Endpoint == "" && len(httpConfig.Channels) == 0 {
 		return false, nil
 	}
-	if _, err := url.ParseRequestURI(httpConfig.Endpoint); err != nil {
-		return false, fmt.Errorf("could not parse endpoint URL: %s\n", err)
+	if httpConfig.Endpoint != "" {
+		if _, err := url.ParseRequestURI(httpConfig.Endpoint); err != nil {
+			return false, fmt.Errorf("could not parse endpoint URL: %s\n", err)
+		}
+	}
+	for channel, endpoint := range httpConfig.Channels {
+		if _, err := url.ParseRequestURI(endpoint); err != nil {
+			return false, fmt.Errorf("could not parse endpoint URL of channel '%s': %s\n", channel, err)
+		}
 	}
 	h.endpoint = httpConfig.Endpoint
+	h.channels = httpConfig.Channels
 
 	// Setup HTTP client.
 	transport := &http.Transport{}
@@ -110,19 +112,91 @@ func (h *WebhookNotifier) Configure(config *config.NotifierConfig) (bool, error)
 
 type notificationEnvelope struct {
 	Notification struct {
-		Name string
+		Name   string
+		Reason string `json:",omitempty"`
 	}
+	Channel string `json:",omitempty"`
 }
 
+// digestEnvelope is the object sent for the notifications held during a maintenance window.
+type digestEnvelope struct {
+	Notifications []digestNotification
+	Channel       string `json:",omitempty"`
+}
+
+type digestNotification struct {
+	Name   string
+	Reason string `json:",omitempty"`
+}
+
+// deliveryKeyHeader is the HTTP header carrying the key of the delivery, which receivers can use to
+// deduplicate notifications.
+const deliveryKeyHeader = "Clair-Delivery-Key"
+
 func (h *WebhookNotifier) Send(notification database.VulnerabilityNotification) error {
+	return h.SendWithKey(notification, "")
+}
+
+func (h *WebhookNotifier) SendWithKey(notification database.VulnerabilityNotification, key string) error {
+	// Only the routed notifications are sent when the webhook has channels but no endpoint.
+	if h.endpoint == "" {
+		return nil
+	}
+	return h.send(h.endpoint, notification, "", key)
+}
+
+func (h *WebhookNotifier) HasChannel(channel string) bool {
+	_, ok := h.channels[channel]
+	return ok
+}
+
+func (h *WebhookNotifier) SendToChannel(notification database.VulnerabilityNotification, channel, key string) error {
+	return h.send(h.channels[channel], notification, channel, key)
+}
+
+// SendDigest sends the notifications at once, to the endpoint of the channel if it isn't empty.
+func (h *WebhookNotifier) SendDigest(notifications []database.VulnerabilityNotification, channel, key string) error {
+	endpoint := h.endpoint
+	if channel != "" {
+		endpoint = h.channels[channel]
+	}
+	if endpoint == "" {
+		return nil
+	}
+
+	envelope := digestEnvelope{Channel: channel}
+	for _, notification := range notifications {
+		envelope.Notifications = append(envelope.Notifications, digestNotification{Name: notification.Name, Reason: string(notification.Reason)})
+	}
+	return h.post(endpoint, envelope, key)
+}
+
+func (h *WebhookNotifier) send(endpoint string, notification database.VulnerabilityNotification, channel, key string) error {
+	envelope := notificationEnvelope{Channel: channel}
+	envelope.Notification.Name = notification.Name
+	envelope.Notification.Reason = string(notification.Reason)
+	return h.post(endpoint, envelope, key)
+}
+
+// post sends the envelope via HTTP POST, along with the key of the delivery.
+func (h *WebhookNotifier) post(endpoint string, envelope interface{}, key string) error {
 	// Marshal notification.
-	jsonNotification, err := json.Marshal(notificationEnvelope{struct{ Name string }{notification.Name}})
+	jsonNotification, err := json.Marshal(envelope)
 	if err != nil {
 		return fmt.Errorf("could not marshal: %s", err)
 	}
 
 	// Send notification via HTTP POST.
-	resp, err := h.client.Post(h.endpoint, "application/json", bytes.NewBuffer(jsonNotification))
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonNotification))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(deliveryKeyHeader, key)
+	}
+
+	resp, err := h.client.Do(req)
 	if err != nil || resp == nil || (resp.StatusCode != 200 && resp.StatusCode != 201) {
 		if resp != nil {
 			return fmt.Errorf("got status %d, expected 200/201", resp.StatusCode)
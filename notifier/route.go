@@ -0,0 +1,146 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"sort"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+// routes are the configured routes of the notifications to the channels of the notifiers.
+var routes []config.NotificationRoute
+
+// A target is a destination of a notification: either the default destination of a notifier or
+// one of its channels.
+type target struct {
+	notifier string
+	channel  string
+}
+
+// name identifies the target in the outbox, so that every channel has its own delivery.
+func (t target) name() string {
+	if t.channel == "" {
+		return t.notifier
+	}
+	return t.notifier + "/" + t.channel
+}
+
+// route returns the targets of the specified notification.
+//
+// The notifications affecting images whose labels match a route are delivered to the channels of
+// the route, instead of the default destination of the notifiers having these channels. The other
+// notifiers, and the ones that have none of the channels, deliver them to their default
+// destination.
+func route(datastore database.Datastore, notificationName string) ([]target, error) {
+	var channels []string
+	if len(routes) > 0 {
+		labels, err := datastore.ListNotificationLabels(notificationName)
+		if err != nil {
+			return nil, err
+		}
+		channels = routedChannels(routes, labels)
+	}
+
+	names := make([]string, 0, len(notifiers))
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var targets []target
+	for _, name := range names {
+		routed := false
+		if cn, ok := notifiers[name].(ChannelNotifier); ok {
+			for _, channel := range channels {
+				if cn.HasChannel(channel) {
+					targets = append(targets, target{notifier: name, channel: channel})
+					routed = true
+				}
+			}
+		}
+		if !routed {
+			targets = append(targets, target{notifier: name})
+		}
+	}
+
+	return targets, nil
+}
+
+// routedChannels returns the channels of the routes matching any of the given label sets, in the
+// order of the routes. A route without labels matches every notification.
+func routedChannels(routes []config.NotificationRoute, labels []map[string]string) []string {
+	var channels []string
+	seen := make(map[string]struct{})
+	for _, r := range routes {
+		if !matchesAny(r.Labels, labels) {
+			continue
+		}
+		for _, channel := range r.Channels {
+			if _, ok := seen[channel]; !ok {
+				seen[channel] = struct{}{}
+				channels = append(channels, channel)
+			}
+		}
+	}
+	return channels
+}
+
+// matchesAny returns whether one of the given label sets has all the labels of the route.
+func matchesAny(routeLabels map[string]string, labels []map[string]string) bool {
+	if len(routeLabels) == 0 {
+		return true
+	}
+
+outer:
+	for _, layerLabels := range labels {
+		for key, value := range routeLabels {
+			if v, ok := layerLabels[key]; !ok || v != value {
+				continue outer
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// unknownChannels returns the channels of the routes that no configured notifier has.
+func unknownChannels(routes []config.NotificationRoute) []string {
+	var unknown []string
+	seen := make(map[string]struct{})
+	for _, r := range routes {
+		for _, channel := range r.Channels {
+			if _, ok := seen[channel]; ok {
+				continue
+			}
+			seen[channel] = struct{}{}
+			if !hasChannel(channel) {
+				unknown = append(unknown, channel)
+			}
+		}
+	}
+	return unknown
+}
+
+// hasChannel returns whether a configured notifier has the specified channel.
+func hasChannel(channel string) bool {
+	for _, n := range notifiers {
+		if cn, ok := n.(ChannelNotifier); ok && cn.HasChannel(channel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+type mockNotifier struct {
+	channels []string
+}
+
+func (n *mockNotifier) Configure(*config.NotifierConfig) (bool, error) { return true, nil }
+
+func (n *mockNotifier) Send(database.VulnerabilityNotification) error { return nil }
+
+func (n *mockNotifier) HasChannel(channel string) bool {
+	for _, c := range n.channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *mockNotifier) SendToChannel(database.VulnerabilityNotification, string, string) error {
+	return nil
+}
+
+func TestRoute(t *testing.T) {
+	defer func(n map[string]Notifier, r []config.NotificationRoute) { notifiers, routes = n, r }(notifiers, routes)
+	notifiers = map[string]Notifier{
+		"chat":  &mockNotifier{channels: []string{"payments", "security"}},
+		"email": &mockNotifier{},
+	}
+	routes = []config.NotificationRoute{
+		{Labels: map[string]string{"team": "payments"}, Channels: []string{"payments"}},
+		{Labels: map[string]string{"team": "payments", "env": "prod"}, Channels: []string{"security", "pager"}},
+	}
+	assert.Equal(t, []string{"pager"}, unknownChannels(routes))
+
+	var labels []map[string]string
+	datastore := &database.MockDatastore{
+		FctListNotificationLabels: func(name string) ([]map[string]string, error) {
+			return labels, nil
+		},
+	}
+
+	// Notifications that match no route are sent to the default destinations.
+	labels = []map[string]string{{"team": "web"}}
+	targets, err := route(datastore, "notification")
+	if assert.Nil(t, err) {
+		assert.Equal(t, []target{{notifier: "chat"}, {notifier: "email"}}, targets)
+	}
+
+	// Routed notifications are sent to the channels of the notifiers having them instead.
+	labels = []map[string]string{{"team": "web"}, {"team": "payments", "env": "prod", "git": "abc"}}
+	targets, err = route(datastore, "notification")
+	if assert.Nil(t, err) {
+		assert.Equal(t, []target{{"chat", "payments"}, {"chat", "security"}, {notifier: "email"}}, targets)
+		assert.Equal(t, "chat/payments", targets[0].name())
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+const defaultAckTimeout = time.Minute
+
+var (
+	// ErrUnknownGroup is returned when subscribing to a consumer group that isn't configured.
+	ErrUnknownGroup = errors.New("notifier: unknown consumer group")
+
+	// ErrSubscriptionClosed is returned to the consumers once the notifier service is stopping or
+	// their subscription is cancelled.
+	ErrSubscriptionClosed = errors.New("notifier: subscription closed")
+
+	subscriptions = &subscriptionNotifier{}
+)
+
+// SubscriptionConfiguration represents the configuration of the consumer groups to which the
+// notifications are delivered over the subscriptions of the gRPC API.
+type SubscriptionConfiguration struct {
+	// Groups are the names of the consumer groups. Every notification is delivered to every
+	// group, to one of its consumers.
+	Groups []string
+	// AckTimeout is the time a consumer of a group is given to acknowledge a notification, once
+	// it has been offered, before it is redelivered. One minute by default.
+	AckTimeout time.Duration
+}
+
+// subscriptionNotifier delivers the notifications to the consumers subscribed through the gRPC
+// API. As the notifier waits for every group to acknowledge a notification, consumers that are
+// slow or gone make the delivery fail and be retried, like any other notifier.
+type subscriptionNotifier struct {
+	mu         sync.Mutex
+	groups     map[string]*subscriptionGroup
+	ackTimeout time.Duration
+	closed     chan struct{}
+
+	// acked are the groups that acknowledged a delivery, by key, so that the retries of a delivery
+	// are only made to the groups that didn't. They are kept in memory: a delivery retried after a
+	// restart is delivered again, under the same key, to the groups that already acknowledged it.
+	acked map[string]map[string]struct{}
+}
+
+// subscriptionGroup is a consumer group, whose consumers compete for the notifications.
+type subscriptionGroup struct {
+	name string
+	// offers hands the deliveries over to the first consumer waiting for one.
+	offers chan *subscribedDelivery
+
+	mu      sync.Mutex
+	pending map[string]*subscribedDelivery
+}
+
+// subscribedDelivery is the delivery of a notification to a consumer group, waiting for its
+// acknowledgement.
+type subscribedDelivery struct {
+	notification database.VulnerabilityNotification
+	key          string
+	result       chan error
+}
+
+func init() {
+	RegisterNotifier("subscription", subscriptions)
+}
+
+func (s *subscriptionNotifier) Configure(config *config.NotifierConfig) (bool, error) {
+	var subscriptionConfig SubscriptionConfiguration
+	if config == nil {
+		return false, nil
+	}
+	if ok, err := config.DecodeParams("subscription", &subscriptionConfig); !ok || err != nil {
+		return false, err
+	}
+	if len(subscriptionConfig.Groups) == 0 {
+		return false, nil
+	}
+	if subscriptionConfig.AckTimeout <= 0 {
+		subscriptionConfig.AckTimeout = defaultAckTimeout
+	}
+
+	groups := make(map[string]*subscriptionGroup)
+	for _, name := range subscriptionConfig.Groups {
+		if name == "" {
+			return false, errors.New("consumer groups must have a name")
+		}
+		groups[name] = &subscriptionGroup{
+			name:    name,
+			offers:  make(chan *subscribedDelivery),
+			pending: make(map[string]*subscribedDelivery),
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = groups
+	s.ackTimeout = subscriptionConfig.AckTimeout
+	s.closed = make(chan struct{})
+	s.acked = make(map[string]map[string]struct{})
+	return true, nil
+}
+
+func (s *subscriptionNotifier) Send(notification database.VulnerabilityNotification) error {
+	return s.SendWithKey(notification, notification.Name)
+}
+
+// SendWithKey offers the notification to every consumer group that hasn't acknowledged its
+// delivery yet, and waits for their acknowledgements.
+func (s *subscriptionNotifier) SendWithKey(notification database.VulnerabilityNotification, key string) error {
+	s.mu.Lock()
+	var groups []*subscriptionGroup
+	for name, g := range s.groups {
+		if _, ok := s.acked[key][name]; !ok {
+			groups = append(groups, g)
+		}
+	}
+	ackTimeout, closed := s.ackTimeout, s.closed
+	s.mu.Unlock()
+
+	errs := make(chan error, len(groups))
+	for _, g := range groups {
+		go func(g *subscriptionGroup) {
+			err := g.deliver(notification, key, ackTimeout, closed)
+			if err == nil {
+				s.mu.Lock()
+				if s.acked[key] == nil {
+					s.acked[key] = make(map[string]struct{})
+				}
+				s.acked[key][g.name] = struct{}{}
+				s.mu.Unlock()
+			}
+			errs <- err
+		}(g)
+	}
+
+	var messages []string
+	var stopped bool
+	for range groups {
+		if err := <-errs; err == ErrSubscriptionClosed {
+			stopped = true
+		} else if err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+	if stopped {
+		return ErrSubscriptionClosed
+	}
+	if len(messages) > 0 {
+		sort.Strings(messages)
+		return errors.New(strings.Join(messages, "; "))
+	}
+
+	s.mu.Lock()
+	delete(s.acked, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// deliver offers a notification to the consumers of the group, and waits for one of them to
+// acknowledge it, until the timeout.
+func (g *subscriptionGroup) deliver(notification database.VulnerabilityNotification, key string, ackTimeout time.Duration, closed chan struct{}) error {
+	d := &subscribedDelivery{notification: notification, key: key, result: make(chan error, 1)}
+	g.mu.Lock()
+	g.pending[key] = d
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		if g.pending[key] == d {
+			delete(g.pending, key)
+		}
+		g.mu.Unlock()
+	}()
+
+	timeout := time.NewTimer(ackTimeout)
+	defer timeout.Stop()
+
+	select {
+	case g.offers <- d:
+	case <-timeout.C:
+		return fmt.Errorf("no consumer of group '%s' received the notification within %v", g.name, ackTimeout)
+	case <-closed:
+		return ErrSubscriptionClosed
+	}
+
+	select {
+	case err := <-d.result:
+		return err
+	case <-timeout.C:
+		return fmt.Errorf("group '%s' didn't acknowledge the notification within %v", g.name, ackTimeout)
+	case <-closed:
+		return ErrSubscriptionClosed
+	}
+}
+
+// close releases the consumers and the deliveries waiting for them.
+func (s *subscriptionNotifier) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed != nil {
+		select {
+		case <-s.closed:
+		default:
+			close(s.closed)
+		}
+	}
+}
+
+// group returns the configured consumer group of the given name.
+func (s *subscriptionNotifier) group(name string) (*subscriptionGroup, chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.groups[name]
+	if !ok {
+		return nil, nil, ErrUnknownGroup
+	}
+	return g, s.closed, nil
+}
+
+// Receive waits for the next notification delivered to the given consumer group, and returns it
+// along with the key that identifies its delivery. The notification must then be acknowledged
+// with Ack, or rejected with Nack, before it is redelivered. Receive returns ErrSubscriptionClosed
+// once done is closed.
+//
+// The notifications only have their Name, Created, Notified, Deleted and Priority fields.
+func Receive(group string, done <-chan struct{}) (database.VulnerabilityNotification, string, error) {
+	g, closed, err := subscriptions.group(group)
+	if err != nil {
+		return database.VulnerabilityNotification{}, "", err
+	}
+
+	select {
+	case d := <-g.offers:
+		return d.notification, d.key, nil
+	case <-done:
+	case <-closed:
+	}
+	return database.VulnerabilityNotification{}, "", ErrSubscriptionClosed
+}
+
+// Ack acknowledges the delivery of a notification to the given consumer group.
+func Ack(group, key string) error {
+	return complete(group, key, nil)
+}
+
+// Nack rejects the delivery of a notification to the given consumer group, which is retried
+// with a back-off.
+func Nack(group, key, reason string) error {
+	return complete(group, key, fmt.Errorf("group '%s' rejected the notification: %s", group, reason))
+}
+
+// complete records the outcome of the delivery of a notification to a consumer group. It returns
+// cerrors.ErrNotFound if the delivery isn't waiting for it, e.g. because it timed out.
+func complete(group, key string, result error) error {
+	g, _, err := subscriptions.group(group)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	d, ok := g.pending[key]
+	delete(g.pending, key)
+	g.mu.Unlock()
+	if !ok {
+		return cerrors.ErrNotFound
+	}
+
+	d.result <- result
+	return nil
+}
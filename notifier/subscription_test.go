@@ -0,0 +1,86 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func TestSubscriptions(t *testing.T) {
+	defer func(s *subscriptionNotifier) { subscriptions = s }(subscriptions)
+	subscriptions = &subscriptionNotifier{}
+
+	configured, err := subscriptions.Configure(&config.NotifierConfig{Params: map[string]interface{}{
+		"subscription": map[string]interface{}{"groups": []string{"audit", "tickets"}, "acktimeout": "100ms"},
+	}})
+	if !assert.Nil(t, err) || !assert.True(t, configured) {
+		return
+	}
+	_, _, err = Receive("unknown", nil)
+	assert.Equal(t, ErrUnknownGroup, err)
+
+	notification := database.VulnerabilityNotification{Name: "notification"}
+	sent := make(chan error, 1)
+	send := func() {
+		go func() { sent <- subscriptions.SendWithKey(notification, "key") }()
+	}
+
+	// Every group receives the notification, the delivery fails if one of them rejects it.
+	send()
+	for _, group := range []string{"audit", "tickets"} {
+		received, key, err := Receive(group, nil)
+		if assert.Nil(t, err) {
+			assert.Equal(t, "notification", received.Name)
+			assert.Equal(t, "key", key)
+		}
+	}
+	assert.Nil(t, Ack("audit", "key"))
+	assert.Nil(t, Nack("tickets", "key", "database unavailable"))
+	if err := <-sent; assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "database unavailable")
+	}
+	assert.Equal(t, cerrors.ErrNotFound, Ack("tickets", "key"))
+
+	// The retry is only delivered to the groups that didn't acknowledge it.
+	send()
+	_, key, err := Receive("tickets", nil)
+	if assert.Nil(t, err) {
+		assert.Nil(t, Ack("tickets", key))
+	}
+	assert.Nil(t, <-sent)
+
+	// Deliveries that nobody acknowledges time out.
+	send()
+	_, _, err = Receive("audit", nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, <-sent)
+
+	// Consumers are released once they are done, or the notifier stops.
+	done := make(chan struct{})
+	close(done)
+	_, _, err = Receive("audit", done)
+	assert.Equal(t, ErrSubscriptionClosed, err)
+
+	subscriptions.close()
+	_, _, err = Receive("audit", nil)
+	assert.Equal(t, ErrSubscriptionClosed, err)
+	assert.Equal(t, ErrSubscriptionClosed, subscriptions.SendWithKey(database.VulnerabilityNotification{Name: "other"}, "other"))
+}
@@ -0,0 +1,289 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/logging"
+	"github.com/coreos/clair/utils"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+// catchUpLockPrefix prefixes the name of the lock taken while sending the digest of a target, so
+// that a single Clair instance sends it.
+const catchUpLockPrefix = "notifier-catch-up-"
+
+// maintenanceWindows are the configured maintenance windows.
+var maintenanceWindows []maintenanceWindow
+
+// A maintenanceWindow is a parsed config.MaintenanceWindow.
+type maintenanceWindow struct {
+	targets  map[string]struct{}
+	days     map[time.Weekday]struct{}
+	location *time.Location
+	severity types.Priority
+	// start and end are the minutes since midnight.
+	start, end int
+}
+
+// parseMaintenanceWindows validates the configured maintenance windows.
+func parseMaintenanceWindows(configs []config.MaintenanceWindow) ([]maintenanceWindow, error) {
+	var windows []maintenanceWindow
+	for i, c := range configs {
+		w := maintenanceWindow{
+			targets:  make(map[string]struct{}),
+			days:     make(map[time.Weekday]struct{}),
+			location: time.UTC,
+			severity: types.Critical,
+		}
+		for _, target := range c.Targets {
+			w.targets[target] = struct{}{}
+		}
+		for _, day := range c.Days {
+			weekday, ok := parseWeekday(day)
+			if !ok {
+				return nil, fmt.Errorf("maintenance window %d: unknown day '%s'", i, day)
+			}
+			w.days[weekday] = struct{}{}
+		}
+
+		var err error
+		if w.start, err = parseTimeOfDay(c.Start); err != nil {
+			return nil, fmt.Errorf("maintenance window %d: invalid start: %s", i, err)
+		}
+		if w.end, err = parseTimeOfDay(c.End); err != nil {
+			return nil, fmt.Errorf("maintenance window %d: invalid end: %s", i, err)
+		}
+		if c.Location != "" {
+			if w.location, err = time.LoadLocation(c.Location); err != nil {
+				return nil, fmt.Errorf("maintenance window %d: %s", i, err)
+			}
+		}
+		if c.Severity != "" {
+			if w.severity = types.Priority(c.Severity); !w.severity.IsValid() {
+				return nil, fmt.Errorf("maintenance window %d: unknown severity '%s'", i, c.Severity)
+			}
+		}
+
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// parseWeekday parses a day of the week, e.g. "Sat" or "saturday".
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(s)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if s == name || s == name[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// parseTimeOfDay parses a time of the day, e.g. "22:00", as the number of minutes since midnight.
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// appliesTo returns whether the window holds the deliveries to the given target. A notifier stands
+// for its channels too.
+func (w maintenanceWindow) appliesTo(t target) bool {
+	if len(w.targets) == 0 {
+		return true
+	}
+	_, named := w.targets[t.name()]
+	_, notifier := w.targets[t.notifier]
+	return named || notifier
+}
+
+// isOpen returns whether the window is open at the given time.
+func (w maintenanceWindow) isOpen(now time.Time) bool {
+	now = now.In(w.location)
+	minutes := now.Hour()*60 + now.Minute()
+	if w.start < w.end {
+		return w.startsOn(now.Weekday()) && minutes >= w.start && minutes < w.end
+	}
+	// The window ends on the next day.
+	yesterday := (now.Weekday() + 6) % 7
+	return (w.startsOn(now.Weekday()) && minutes >= w.start) || (w.startsOn(yesterday) && minutes < w.end)
+}
+
+func (w maintenanceWindow) startsOn(day time.Weekday) bool {
+	if len(w.days) == 0 {
+		return true
+	}
+	_, ok := w.days[day]
+	return ok
+}
+
+// held returns whether a maintenance window holds the delivery of a notification of the given
+// priority to the target at the given time.
+func held(t target, priority types.Priority, now time.Time) bool {
+	for _, w := range maintenanceWindows {
+		if priority.Compare(w.severity) < 0 && w.appliesTo(t) && w.isOpen(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// inMaintenance returns whether a maintenance window of the target is open at the given time.
+func inMaintenance(t target, now time.Time) bool {
+	for _, w := range maintenanceWindows {
+		if w.appliesTo(t) && w.isOpen(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceTargets returns the targets that maintenance windows apply to: the notifiers and the
+// channels that notifications are routed to.
+func maintenanceTargets() []target {
+	names := make([]string, 0, len(notifiers))
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var candidates []target
+	for _, name := range names {
+		candidates = append(candidates, target{notifier: name})
+		if cn, ok := notifiers[name].(ChannelNotifier); ok {
+			seen := make(map[string]struct{})
+			for _, r := range routes {
+				for _, channel := range r.Channels {
+					if _, ok := seen[channel]; !ok && cn.HasChannel(channel) {
+						seen[channel] = struct{}{}
+						candidates = append(candidates, target{notifier: name, channel: channel})
+					}
+				}
+			}
+		}
+	}
+
+	var targets []target
+	for _, t := range candidates {
+		for _, w := range maintenanceWindows {
+			if w.appliesTo(t) {
+				targets = append(targets, t)
+				break
+			}
+		}
+	}
+	return targets
+}
+
+// catchUp sends the notifications held during the maintenance windows as digests, once the windows
+// of their targets are closed, until Clair stops.
+func catchUp(datastore database.Datastore, whoAmI string, stopper *utils.Stopper) {
+	targets := maintenanceTargets()
+	for {
+		for _, t := range targets {
+			if inMaintenance(t, time.Now()) {
+				continue
+			}
+
+			lockName := catchUpLockPrefix + t.name()
+			if hasLock, _ := datastore.Lock(lockName, whoAmI, lockDuration, false); !hasLock {
+				continue
+			}
+			if err := sendDigest(datastore, t); err != nil {
+				promNotifierBackendErrorsTotal.WithLabelValues(t.notifier).Inc()
+				log.With(logging.Fields{"notifier": t.name()}).Errorf("could not send the digest of the held notifications: %s", err)
+			}
+			datastore.Unlock(lockName, whoAmI)
+		}
+
+		if !stopper.Sleep(checkInterval) {
+			return
+		}
+	}
+}
+
+// sendDigest sends the notifications held for the target at once, if the notifier supports it, or
+// one by one otherwise.
+func sendDigest(datastore database.Datastore, t target) error {
+	notifications, err := datastore.ListUndeliveredNotifications(t.name())
+	if err == cerrors.ErrNotFound || len(notifications) == 0 {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	deliveries := make([]database.NotificationDelivery, 0, len(notifications))
+	for _, notification := range notifications {
+		delivery, err := datastore.InsertNotificationDelivery(notification.Name, t.name())
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	dn, ok := notifiers[t.notifier].(DigestNotifier)
+	if !ok {
+		for i, notification := range notifications {
+			err := send(t, notification, deliveries[i].Key)
+			recordAttempt(datastore, deliveries[i], err)
+			if err != nil {
+				return err
+			}
+			datastore.SetNotificationNotified(notification.Name)
+		}
+		return nil
+	}
+
+	err = dn.SendDigest(notifications, t.channel, digestKey(deliveries))
+	for _, delivery := range deliveries {
+		recordAttempt(datastore, delivery, err)
+	}
+	if err != nil {
+		return err
+	}
+	log.With(logging.Fields{"notifier": t.name()}).Infof("sent the digest of %d held notifications", len(notifications))
+
+	// The deliveries have been completed after the notifications were marked as notified: mark
+	// them again so that they are reopened when the notifications are sent again.
+	for _, notification := range notifications {
+		datastore.SetNotificationNotified(notification.Name)
+	}
+	return nil
+}
+
+// digestKey derives the key of a digest from the keys of its deliveries, so that it stays the same
+// when the digest is retried.
+func digestKey(deliveries []database.NotificationDelivery) string {
+	hash := sha256.New()
+	for _, delivery := range deliveries {
+		hash.Write([]byte(delivery.Key))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+type digestNotifier struct {
+	mockNotifier
+	digests [][]string
+}
+
+func (n *digestNotifier) SendDigest(notifications []database.VulnerabilityNotification, channel, key string) error {
+	var names []string
+	for _, notification := range notifications {
+		names = append(names, notification.Name)
+	}
+	n.digests = append(n.digests, names)
+	return nil
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	defer func(w []maintenanceWindow) { maintenanceWindows = w }(maintenanceWindows)
+
+	var err error
+	maintenanceWindows, err = parseMaintenanceWindows([]config.MaintenanceWindow{
+		{Targets: []string{"chat/oncall"}, Days: []string{"Fri", "saturday"}, Start: "22:00", End: "06:00"},
+		{Targets: []string{"email"}, Start: "12:00", End: "13:00", Location: "America/New_York", Severity: "High"},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	oncall := target{notifier: "chat", channel: "oncall"}
+	at := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339, s)
+		return t
+	}
+	// 2016-01-01 is a Friday.
+	assert.True(t, held(oncall, types.High, at("2016-01-01T23:00:00Z")))
+	assert.True(t, held(oncall, types.High, at("2016-01-02T05:59:00Z")))
+	assert.True(t, held(oncall, types.High, at("2016-01-03T05:59:00Z")))
+	assert.False(t, held(oncall, types.High, at("2016-01-02T06:00:00Z")))
+	assert.False(t, held(oncall, types.High, at("2016-01-01T05:00:00Z")), "the window starting on Thursday")
+	assert.False(t, held(oncall, types.Critical, at("2016-01-01T23:00:00Z")), "critical notifications")
+	assert.False(t, held(target{notifier: "chat"}, types.High, at("2016-01-01T23:00:00Z")), "another channel")
+
+	email := target{notifier: "email"}
+	assert.True(t, held(email, types.Medium, at("2016-01-01T17:30:00Z")))
+	assert.False(t, held(email, types.High, at("2016-01-01T17:30:00Z")))
+	assert.False(t, held(email, types.Medium, at("2016-01-01T12:30:00Z")), "the time zone of the window")
+	assert.True(t, held(target{notifier: "email", channel: "security"}, types.Medium, at("2016-01-01T17:30:00Z")), "the channels of a notifier")
+
+	for _, c := range []config.MaintenanceWindow{
+		{Start: "22:00"},
+		{Start: "22:00", End: "06:00", Days: []string{"Someday"}},
+		{Start: "22:00", End: "06:00", Location: "Nowhere/Special"},
+		{Start: "22:00", End: "06:00", Severity: "Dire"},
+	} {
+		_, err := parseMaintenanceWindows([]config.MaintenanceWindow{c})
+		assert.NotNil(t, err, "%+v", c)
+	}
+}
+
+func TestSendDigest(t *testing.T) {
+	defer func(n map[string]Notifier, r []config.NotificationRoute, w []maintenanceWindow) {
+		notifiers, routes, maintenanceWindows = n, r, w
+	}(notifiers, routes, maintenanceWindows)
+
+	chat := &digestNotifier{mockNotifier: mockNotifier{channels: []string{"oncall"}}}
+	notifiers = map[string]Notifier{"chat": chat, "email": &mockNotifier{}}
+	routes = []config.NotificationRoute{{Channels: []string{"oncall"}}}
+	maintenanceWindows, _ = parseMaintenanceWindows([]config.MaintenanceWindow{
+		{Targets: []string{"chat/oncall"}, Start: "22:00", End: "06:00"},
+	})
+	assert.Equal(t, []target{{"chat", "oncall"}}, maintenanceTargets())
+
+	var delivered, notified []string
+	datastore := &database.MockDatastore{
+		FctListUndeliveredNotifications: func(notifier string) ([]database.VulnerabilityNotification, error) {
+			assert.Equal(t, "chat/oncall", notifier)
+			return []database.VulnerabilityNotification{{Name: "n1"}, {Name: "n2"}}, nil
+		},
+		FctInsertNotificationDelivery: func(notificationName, notifier string) (database.NotificationDelivery, error) {
+			return database.NotificationDelivery{Notifier: notifier, Key: "key-" + notificationName}, nil
+		},
+		FctInsertNotificationDeliveryAttempt: func(delivery database.NotificationDelivery, succeeded bool, message string) error {
+			if succeeded {
+				delivered = append(delivered, delivery.Key)
+			}
+			return nil
+		},
+		FctSetNotificationNotified: func(name string) error {
+			notified = append(notified, name)
+			return nil
+		},
+	}
+
+	if assert.Nil(t, sendDigest(datastore, target{notifier: "chat", channel: "oncall"})) {
+		assert.Equal(t, [][]string{{"n1", "n2"}}, chat.digests)
+		assert.Equal(t, []string{"key-n1", "key-n2"}, delivered)
+		assert.Equal(t, []string{"n1", "n2"}, notified)
+	}
+}
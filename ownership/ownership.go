@@ -0,0 +1,182 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ownership maps the names of images to the identities of their owners, in the manner of
+// CODEOWNERS files, so that the reports and notifications tell who is responsible for remediating
+// their vulnerabilities.
+package ownership
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"gopkg.in/yaml.v2"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/utils"
+)
+
+const timeout = 30 * time.Second
+
+var (
+	log = capnslog.NewPackageLogger("github.com/coreos/clair", "ownership")
+
+	// current is the *Mapping in use, nil when the service is disabled.
+	current atomic.Value
+)
+
+// Rule assigns the images whose name matches the Pattern to the Owners.
+type Rule struct {
+	Pattern string
+	Owners  []string
+}
+
+// Mapping is an ordered list of rules. As in CODEOWNERS files, the last rule matching an image
+// determines its owners.
+type Mapping struct {
+	Rules []Rule
+}
+
+// Parse parses a YAML document listing the rules of a Mapping.
+func Parse(data []byte) (*Mapping, error) {
+	var mapping Mapping
+	if err := yaml.Unmarshal(data, &mapping); err != nil {
+		return nil, err
+	}
+
+	for _, rule := range mapping.Rules {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("a rule has no pattern")
+		}
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", rule.Pattern, err)
+		}
+	}
+
+	return &mapping, nil
+}
+
+// Owners returns the owners of the image with the given name, e.g.
+// "registry.example.com/team/app", or nil if no rule matches it.
+func (m *Mapping) Owners(name string) []string {
+	for i := len(m.Rules) - 1; i >= 0; i-- {
+		if Match(m.Rules[i].Pattern, name) {
+			return m.Rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// Match returns whether a pattern matches the name of an image.
+//
+// Patterns are matched using path.Match against the name and its leading directories, so that a
+// pattern naming a directory, e.g. "registry.example.com/team", matches every image in it.
+func Match(pattern, name string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	for {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// Load reads and parses the Mapping at the given source, which is either the path of a file or an
+// HTTP(S) URL.
+func Load(source string) (*Mapping, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = fetch(source)
+	} else {
+		data, err = ioutil.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+func fetch(url string) ([]byte, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status %d, expected 200", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Set replaces the Mapping in use.
+func Set(m *Mapping) {
+	current.Store(m)
+}
+
+// Enabled returns whether a Mapping is in use.
+func Enabled() bool {
+	m, _ := current.Load().(*Mapping)
+	return m != nil
+}
+
+// Owners returns the owners of the image with the given name according to the Mapping in use.
+func Owners(name string) []string {
+	m, _ := current.Load().(*Mapping)
+	if m == nil {
+		return nil
+	}
+	return m.Owners(name)
+}
+
+// Run loads the Mapping from the configured source and keeps it up to date.
+func Run(config *config.OwnershipConfig, st *utils.Stopper) {
+	defer st.End()
+
+	// Do not run the service if there is no source.
+	if config == nil || config.Source == "" {
+		log.Infof("ownership service is disabled.")
+		return
+	}
+
+	for {
+		// Keep the previous mapping if the source can't be loaded.
+		m, err := Load(config.Source)
+		if err != nil {
+			log.Errorf("could not load the owners of the images from %s: %s", config.Source, err)
+		} else {
+			Set(m)
+			log.Infof("loaded %d ownership rules from %s", len(m.Rules), config.Source)
+		}
+
+		if config.Interval == 0 || !st.Sleep(config.Interval) {
+			break
+		}
+	}
+
+	log.Info("ownership service stopped")
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ownership
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const rules = `
+rules:
+  - pattern: "*"
+    owners: [platform]
+  - pattern: registry.example.com/payments
+    owners: [payments, alice@example.com]
+  - pattern: registry.example.com/payments/legacy-*
+    owners: []
+`
+
+func TestOwners(t *testing.T) {
+	m, err := Parse([]byte(rules))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"platform"}, m.Owners("registry.example.com/web"))
+	assert.Equal(t, []string{"payments", "alice@example.com"}, m.Owners("registry.example.com/payments/api"))
+	assert.Equal(t, []string{"payments", "alice@example.com"}, m.Owners("registry.example.com/payments/api/worker"))
+	assert.Empty(t, m.Owners("registry.example.com/payments/legacy-api"))
+
+	_, err = Parse([]byte("rules:\n  - pattern: \"[\"\n"))
+	assert.Error(t, err)
+	_, err = Parse([]byte("rules:\n  - owners: [platform]\n"))
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/owners.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(rules))
+	}))
+	defer server.Close()
+
+	m, err := Load(server.URL + "/owners.yaml")
+	if assert.Nil(t, err) {
+		assert.Len(t, m.Rules, 3)
+	}
+
+	_, err = Load(server.URL + "/missing.yaml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,270 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+const (
+	ociManifestMediaType  = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType    = "application/vnd.oci.image.config.v1+json"
+	dsseEnvelopeMediaType = "application/vnd.dsse.envelope.v1+json"
+
+	cosignSignatureAnnotation     = "dev.cosignproject.cosign/signature"
+	cosignPredicateTypeAnnotation = "predicateType"
+	cosignSignatureType           = "cosign container image signature"
+
+	// maxPayloadSize bounds the size of the signed payloads, which are small JSON documents.
+	maxPayloadSize = 1 << 20
+)
+
+// CosignSignature is a signature of an image made with cosign: the signature of a payload naming
+// the digest of the manifest of the image.
+type CosignSignature struct {
+	Payload   []byte
+	Signature []byte
+}
+
+// CosignSignatures returns the cosign signatures of the image whose manifest has the given digest.
+// They are stored in the repository, as the layers of the image tagged after the digest. There are
+// none if the image hasn't been signed.
+func (r *Client) CosignSignatures(repository, digest string) ([]CosignSignature, error) {
+	manifest, err := r.cosignManifest(repository, digest, "sig")
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+
+	var signatures []CosignSignature
+	for _, layer := range manifest.Layers {
+		encoded, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		payload, err := r.blob(repository, layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, CosignSignature{Payload: payload, Signature: signature})
+	}
+	return signatures, nil
+}
+
+// PushCosignAttestation attaches the DSSE envelope of an in-toto statement to the image whose
+// manifest has the given digest, where cosign looks for attestations: as a layer of the manifest
+// tagged after the digest with the ".att" suffix. The attestations with the same predicate type
+// are replaced. The manifest also refers to the image as its subject, so that the registries
+// implementing the OCI referrers API list it.
+func (r *Client) PushCosignAttestation(repository, digest, predicateType string, envelope []byte) error {
+	existing, err := r.cosignManifest(repository, digest, "att")
+	if err != nil {
+		return err
+	}
+	subject, err := r.describeManifest(repository, digest)
+	if err != nil {
+		return err
+	}
+
+	layer, err := r.pushBlob(repository, dsseEnvelopeMediaType, envelope)
+	if err != nil {
+		return err
+	}
+	layer.Annotations = map[string]string{
+		cosignSignatureAnnotation:     "",
+		cosignPredicateTypeAnnotation: predicateType,
+	}
+
+	manifest := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		Subject:       &subject,
+	}
+	if existing != nil {
+		for _, l := range existing.Layers {
+			if l.Annotations[cosignPredicateTypeAnnotation] != predicateType {
+				manifest.Layers = append(manifest.Layers, l)
+			}
+		}
+	}
+	manifest.Layers = append(manifest.Layers, layer)
+
+	if manifest.Config, err = r.pushCosignConfig(repository, manifest.Layers); err != nil {
+		return err
+	}
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	_, _, err = r.pushManifest(repository, cosignTag(digest, "att"), ociManifestMediaType, content)
+	return err
+}
+
+// pushCosignConfig uploads the image configuration of a cosign manifest with the given layers.
+func (r *Client) pushCosignConfig(repository string, layers []descriptor) (descriptor, error) {
+	config := struct {
+		Architecture string   `json:"architecture"`
+		OS           string   `json:"os"`
+		Config       struct{} `json:"config"`
+		RootFS       struct {
+			Type    string   `json:"type"`
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}{}
+	config.RootFS.Type = "layers"
+	for _, layer := range layers {
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, layer.Digest)
+	}
+
+	content, err := json.Marshal(config)
+	if err != nil {
+		return descriptor{}, err
+	}
+	return r.pushBlob(repository, ociConfigMediaType, content)
+}
+
+// cosignManifest returns the manifest cosign attaches to the image whose manifest has the given
+// digest, with the given suffix, or nil if there is none.
+func (r *Client) cosignManifest(repository, digest, suffix string) (*ociManifest, error) {
+	var manifest ociManifest
+	path := "/v2/" + repository + "/manifests/" + cosignTag(digest, suffix)
+	resp, err := r.fetch(path, repositoryScope(repository), ociManifestMediaType+", "+schema2MediaType)
+	if err != nil {
+		return nil, err
+	}
+	defer drain(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("registry: got status %d getting %s", resp.StatusCode, path)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("registry: could not decode %s: %s", path, err)
+	}
+	return &manifest, nil
+}
+
+// cosignTag returns the tag of the manifest cosign attaches to the image whose manifest has the
+// given digest, e.g. "sha256-<hex>.sig" for signatures.
+func cosignTag(digest, suffix string) string {
+	return strings.Replace(digest, ":", "-", 1) + "." + suffix
+}
+
+// blob returns the content of a small blob of the repository, after checking its digest.
+func (r *Client) blob(repository, digest string) ([]byte, error) {
+	path := "/v2/" + repository + "/blobs/" + digest
+	resp, err := r.fetch(path, repositoryScope(repository), "")
+	if err != nil {
+		return nil, err
+	}
+	defer drain(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry: got status %d getting %s", resp.StatusCode, path)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPayloadSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if digest != digestOf(content) {
+		return nil, fmt.Errorf("registry: the content of %s doesn't match its digest", path)
+	}
+	return content, nil
+}
+
+// ParsePublicKeys parses the PEM-encoded ECDSA public keys cosign signs with.
+func ParsePublicKeys(data []byte) ([]*ecdsa.PublicKey, error) {
+	var keys []*ecdsa.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ecdsaKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errors.New("registry: only ECDSA public keys are supported")
+		}
+		keys = append(keys, ecdsaKey)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("registry: no public key found")
+	}
+	return keys, nil
+}
+
+// Verify returns whether the signature has been made by one of the keys, for the image whose
+// manifest has the given digest.
+func (s CosignSignature) Verify(digest string, keys []*ecdsa.PublicKey) bool {
+	var payload struct {
+		Critical struct {
+			Type  string `json:"type"`
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(s.Payload)).Decode(&payload); err != nil {
+		return false
+	}
+	if payload.Critical.Type != cosignSignatureType || payload.Critical.Image.DockerManifestDigest != digest {
+		return false
+	}
+
+	var signature struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(s.Signature, &signature); err != nil || len(rest) > 0 {
+		return false
+	}
+
+	hash := sha256.Sum256(s.Payload)
+	for _, key := range keys {
+		if ecdsa.Verify(key, hash[:], signature.R, signature.S) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, payload []byte) []byte {
+	hash := sha256.Sum256(payload)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := asn1.Marshal(struct{ R, S interface{} }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func TestCosignSignatures(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParsePublicKeys(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if !assert.Nil(t, err) || !assert.Len(t, keys, 1) {
+		return
+	}
+
+	payload := []byte(`{"critical": {"identity": {"docker-reference": "registry.example.com/debian"}, "image": {"docker-manifest-digest": "sha256:signed"}, "type": "cosign container image signature"}, "optional": null}`)
+	hash := sha256.Sum256(payload)
+	payloadDigest := "sha256:" + hex.EncodeToString(hash[:])
+	signature := base64.StdEncoding.EncodeToString(sign(t, key, payload))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/debian/manifests/sha256-signed.sig":
+			fmt.Fprintf(w, `{"schemaVersion": 2, "layers": [{"digest": %q, "annotations": {"dev.cosignproject.cosign/signature": %q}}]}`, payloadDigest, signature)
+		case "/v2/debian/blobs/" + payloadDigest:
+			w.Write(payload)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, "", "", http.DefaultClient)
+
+	signatures, err := client.CosignSignatures("debian", "sha256:signed")
+	if assert.Nil(t, err) && assert.Len(t, signatures, 1) {
+		assert.True(t, signatures[0].Verify("sha256:signed", keys))
+		assert.False(t, signatures[0].Verify("sha256:other", keys), "the signature is of another image")
+
+		otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.False(t, signatures[0].Verify("sha256:signed", []*ecdsa.PublicKey{&otherKey.PublicKey}), "the signature is made by another key")
+	}
+
+	signatures, err = client.CosignSignatures("debian", "sha256:unsigned")
+	assert.Nil(t, err)
+	assert.Len(t, signatures, 0)
+
+	_, err = ParsePublicKeys([]byte("not a key"))
+	assert.NotNil(t, err)
+}
+
+func TestPushCosignAttestation(t *testing.T) {
+	registry := newPushRegistry(t, false)
+	defer registry.Close()
+	blobs, manifests := registry.blobs, registry.manifests
+	client := NewClient(registry.URL, "", "", http.DefaultClient)
+
+	push := func(predicateType, envelope string) (manifest ociManifest) {
+		if assert.Nil(t, client.PushCosignAttestation("debian", "sha256:image", predicateType, []byte(envelope))) {
+			assert.Nil(t, json.Unmarshal(manifests["sha256-image.att"], &manifest))
+		}
+		return
+	}
+
+	manifest := push("https://cosign.sigstore.dev/attestation/vuln/v1", `{"payload": "1"}`)
+	if assert.Len(t, manifest.Layers, 1) && assert.NotNil(t, manifest.Subject) {
+		assert.Equal(t, "sha256:image", manifest.Subject.Digest)
+		assert.Equal(t, int64(42), manifest.Subject.Size)
+		assert.Equal(t, dsseEnvelopeMediaType, manifest.Layers[0].MediaType)
+		assert.Equal(t, `{"payload": "1"}`, string(blobs[manifest.Layers[0].Digest]))
+		assert.Contains(t, blobs, manifest.Config.Digest)
+	}
+
+	// Attestations of other types are kept, the ones of the same type are replaced.
+	push("https://slsa.dev/provenance/v1", `{"payload": "2"}`)
+	manifest = push("https://cosign.sigstore.dev/attestation/vuln/v1", `{"payload": "3"}`)
+	if assert.Len(t, manifest.Layers, 2) {
+		assert.Equal(t, `{"payload": "2"}`, string(blobs[manifest.Layers[0].Digest]))
+		assert.Equal(t, `{"payload": "3"}`, string(blobs[manifest.Layers[1].Digest]))
+	}
+}
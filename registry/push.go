@@ -0,0 +1,121 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// descriptor describes the content a manifest refers to.
+type descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest is an OCI image manifest, possibly referring to another manifest as its subject.
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        descriptor        `json:"config"`
+	Layers        []descriptor      `json:"layers"`
+	Subject       *descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// pushBlob uploads a blob to the repository, unless it is already there, and returns its
+// descriptor.
+func (r *Client) pushBlob(repository, mediaType string, content []byte) (descriptor, error) {
+	blob := descriptor{MediaType: mediaType, Digest: digestOf(content), Size: int64(len(content))}
+	scope := pushScope(repository)
+
+	resp, err := r.send("HEAD", "/v2/"+repository+"/blobs/"+blob.Digest, scope, "", "", nil)
+	if err != nil {
+		return blob, err
+	}
+	drain(resp.Body)
+	if resp.StatusCode == http.StatusOK {
+		return blob, nil
+	}
+
+	path := "/v2/" + repository + "/blobs/uploads/"
+	resp, err = r.send("POST", path, scope, "", "", nil)
+	if err != nil {
+		return blob, err
+	}
+	drain(resp.Body)
+	if resp.StatusCode != http.StatusAccepted {
+		return blob, fmt.Errorf("registry: got status %d posting %s", resp.StatusCode, path)
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return blob, fmt.Errorf("registry: no upload location for %s", path)
+	}
+	separator := "?"
+	if strings.Contains(location, "?") {
+		separator = "&"
+	}
+	resp, err = r.send("PUT", location+separator+"digest="+url.QueryEscape(blob.Digest), scope, "", "application/octet-stream", content)
+	if err != nil {
+		return blob, err
+	}
+	drain(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		return blob, fmt.Errorf("registry: got status %d uploading %s", resp.StatusCode, blob.Digest)
+	}
+	return blob, nil
+}
+
+// pushManifest uploads a manifest to the repository under the given reference, a tag or its
+// digest, and returns its descriptor and the headers of the response.
+func (r *Client) pushManifest(repository, reference, mediaType string, manifest []byte) (descriptor, http.Header, error) {
+	path := "/v2/" + repository + "/manifests/" + reference
+	resp, err := r.send("PUT", path, pushScope(repository), "", mediaType, manifest)
+	if err != nil {
+		return descriptor{}, nil, err
+	}
+	drain(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		return descriptor{}, nil, fmt.Errorf("registry: got status %d putting %s", resp.StatusCode, path)
+	}
+	return descriptor{MediaType: mediaType, Digest: digestOf(manifest), Size: int64(len(manifest))}, resp.Header, nil
+}
+
+// describeManifest returns the descriptor of the manifest with the given digest.
+func (r *Client) describeManifest(repository, digest string) (descriptor, error) {
+	path := "/v2/" + repository + "/manifests/" + digest
+	resp, err := r.send("HEAD", path, repositoryScope(repository), ociManifestMediaType+", "+schema2MediaType, "", nil)
+	if err != nil {
+		return descriptor{}, err
+	}
+	drain(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return descriptor{}, fmt.Errorf("registry: got status %d getting %s", resp.StatusCode, path)
+	}
+
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return descriptor{}, fmt.Errorf("registry: no size for %s", path)
+	}
+	return descriptor{MediaType: resp.Header.Get("Content-Type"), Digest: digest, Size: size}, nil
+}
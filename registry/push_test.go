@@ -0,0 +1,72 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pushRegistry is a registry accepting pushes to the "debian" repository, which has the image
+// "sha256:image".
+type pushRegistry struct {
+	*httptest.Server
+	blobs, manifests map[string][]byte
+}
+
+// newPushRegistry starts a pushRegistry, which implements the referrers API if referrers is set.
+func newPushRegistry(t *testing.T, referrers bool) *pushRegistry {
+	registry := &pushRegistry{blobs: make(map[string][]byte), manifests: make(map[string][]byte)}
+	registry.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "HEAD" && r.URL.Path == "/v2/debian/manifests/sha256:image":
+			w.Header().Set("Content-Type", schema2MediaType)
+			w.Header().Set("Content-Length", "42")
+		case r.Method == "HEAD" && strings.HasPrefix(r.URL.Path, "/v2/debian/blobs/"):
+			if _, ok := registry.blobs[strings.TrimPrefix(r.URL.Path, "/v2/debian/blobs/")]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == "POST" && r.URL.Path == "/v2/debian/blobs/uploads/":
+			w.Header().Set("Location", "/v2/debian/blobs/uploads/upload?state=1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == "PUT" && r.URL.Path == "/v2/debian/blobs/uploads/upload":
+			assert.Equal(t, "1", r.URL.Query().Get("state"))
+			registry.blobs[r.URL.Query().Get("digest")], _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v2/debian/manifests/"):
+			manifest, ok := registry.manifests[strings.TrimPrefix(r.URL.Path, "/v2/debian/manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(manifest)
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/v2/debian/manifests/"):
+			manifest, _ := ioutil.ReadAll(r.Body)
+			registry.manifests[strings.TrimPrefix(r.URL.Path, "/v2/debian/manifests/")] = manifest
+			if referrers && strings.Contains(string(manifest), `"subject"`) {
+				w.Header().Set(subjectHeader, "sha256:image")
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return registry
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	ociIndexMediaType = "application/vnd.oci.image.index.v1+json"
+	ociEmptyMediaType = "application/vnd.oci.empty.v1+json"
+
+	// subjectHeader is set by the registries implementing the referrers API when a manifest
+	// with a subject is pushed.
+	subjectHeader = "OCI-Subject"
+)
+
+// PushReferrer attaches an artifact to the image whose manifest has the given digest with the OCI
+// referrers API: the artifact is a manifest of the given type, whose subject is the image and
+// whose single layer is the content. For the registries that don't implement the referrers API,
+// the artifact is added to the index tagged after the digest instead, as the OCI distribution
+// specification prescribes.
+func (r *Client) PushReferrer(repository, digest, artifactType string, content []byte, annotations map[string]string) error {
+	subject, err := r.describeManifest(repository, digest)
+	if err != nil {
+		return err
+	}
+
+	layer, err := r.pushBlob(repository, artifactType, content)
+	if err != nil {
+		return err
+	}
+	config, err := r.pushBlob(repository, ociEmptyMediaType, []byte("{}"))
+	if err != nil {
+		return err
+	}
+
+	manifest := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  artifactType,
+		Config:        config,
+		Layers:        []descriptor{layer},
+		Subject:       &subject,
+		Annotations:   annotations,
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	referrer, header, err := r.pushManifest(repository, digestOf(data), ociManifestMediaType, data)
+	if err != nil {
+		return err
+	}
+	if header.Get(subjectHeader) != "" {
+		return nil
+	}
+
+	referrer.ArtifactType = artifactType
+	referrer.Annotations = annotations
+	return r.addReferrer(repository, digest, referrer)
+}
+
+// addReferrer adds a referrer of the image whose manifest has the given digest to the index
+// tagged after the digest, e.g. "sha256-<hex>".
+func (r *Client) addReferrer(repository, digest string, referrer descriptor) error {
+	var index struct {
+		SchemaVersion int          `json:"schemaVersion"`
+		MediaType     string       `json:"mediaType"`
+		Manifests     []descriptor `json:"manifests"`
+	}
+	tag := strings.Replace(digest, ":", "-", 1)
+	path := "/v2/" + repository + "/manifests/" + tag
+
+	resp, err := r.send("GET", path, pushScope(repository), ociIndexMediaType, "", nil)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		err = json.NewDecoder(resp.Body).Decode(&index)
+		drain(resp.Body)
+		if err != nil {
+			return fmt.Errorf("registry: could not decode %s: %s", path, err)
+		}
+	case http.StatusNotFound:
+		drain(resp.Body)
+	default:
+		drain(resp.Body)
+		return fmt.Errorf("registry: got status %d getting %s", resp.StatusCode, path)
+	}
+
+	index.SchemaVersion = 2
+	index.MediaType = ociIndexMediaType
+	index.Manifests = append(index.Manifests, referrer)
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	_, _, err = r.pushManifest(repository, tag, ociIndexMediaType, data)
+	return err
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushReferrer(t *testing.T) {
+	annotations := map[string]string{"org.opencontainers.image.created": "2016-01-01T00:00:00Z"}
+
+	for _, referrers := range []bool{true, false} {
+		registry := newPushRegistry(t, referrers)
+		client := NewClient(registry.URL, "", "", http.DefaultClient)
+
+		assert.Nil(t, client.PushReferrer("debian", "sha256:image", "application/vnd.example+json", []byte(`{"report": 1}`), annotations))
+		assert.Nil(t, client.PushReferrer("debian", "sha256:image", "application/vnd.example+json", []byte(`{"report": 2}`), annotations))
+
+		var referrerDigests []string
+		for reference, data := range registry.manifests {
+			var manifest ociManifest
+			if !assert.Nil(t, json.Unmarshal(data, &manifest)) || manifest.Subject == nil {
+				continue
+			}
+			assert.Equal(t, reference, digestOf(data), "referrers are pushed by digest")
+			assert.Equal(t, "sha256:image", manifest.Subject.Digest)
+			assert.Equal(t, "application/vnd.example+json", manifest.ArtifactType)
+			assert.Equal(t, annotations, manifest.Annotations)
+			if assert.Len(t, manifest.Layers, 1) {
+				assert.Contains(t, registry.blobs, manifest.Layers[0].Digest)
+			}
+			referrerDigests = append(referrerDigests, reference)
+		}
+		assert.Len(t, referrerDigests, 2)
+
+		// Without the referrers API, the referrers are listed in the index tagged after the digest.
+		data, ok := registry.manifests["sha256-image"]
+		assert.Equal(t, !referrers, ok)
+		if ok {
+			var index struct{ Manifests []descriptor }
+			if assert.Nil(t, json.Unmarshal(data, &index)) && assert.Len(t, index.Manifests, 2) {
+				assert.Equal(t, "application/vnd.example+json", index.Manifests[0].ArtifactType)
+				assert.Contains(t, referrerDigests, index.Manifests[0].Digest)
+				assert.Contains(t, referrerDigests, index.Manifests[1].Digest)
+			}
+		}
+
+		registry.Close()
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package registry implements a client of the Docker Registry HTTP API V2, to find the layers of
+// the images that Clair indexes.
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// catalogPageSize is the number of repositories or tags requested per page.
+	catalogPageSize = 100
+
+	schema1MediaType      = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+	schema2MediaType      = "application/vnd.docker.distribution.manifest.v2+json"
+	manifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// ErrUnsupportedManifest is returned for the manifests that don't describe a single image, e.g.
+// manifest lists.
+var ErrUnsupportedManifest = errors.New("unsupported manifest")
+
+// Client is a client of the Docker Registry HTTP API V2, authenticating either with basic
+// credentials or with the bearer tokens the registry asks for. It is not safe for concurrent use.
+type Client struct {
+	url                string
+	username, password string
+	client             *http.Client
+
+	// tokens are the bearer tokens obtained so far, by scope.
+	tokens map[string]string
+}
+
+// NewClient creates a client of the registry at the given base URL, e.g.
+// "https://registry.example.com".
+func NewClient(registryURL, username, password string, client *http.Client) *Client {
+	return &Client{
+		url:      strings.TrimSuffix(registryURL, "/"),
+		username: username,
+		password: password,
+		client:   client,
+		tokens:   make(map[string]string),
+	}
+}
+
+// Catalog returns the names of every repository of the registry.
+func (r *Client) Catalog() ([]string, error) {
+	var repositories []string
+	for path := fmt.Sprintf("/v2/_catalog?n=%d", catalogPageSize); path != ""; {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		header, err := r.get(path, "registry:catalog:*", "", &page)
+		if err != nil {
+			return nil, err
+		}
+		repositories = append(repositories, page.Repositories...)
+		path = nextPage(header)
+	}
+	return repositories, nil
+}
+
+// Tags returns the tags of the repository.
+func (r *Client) Tags(repository string) ([]string, error) {
+	var tags []string
+	for path := fmt.Sprintf("/v2/%s/tags/list?n=%d", repository, catalogPageSize); path != ""; {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		header, err := r.get(path, repositoryScope(repository), "", &page)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Tags...)
+		path = nextPage(header)
+	}
+	return tags, nil
+}
+
+// Manifest returns the digest of the manifest of the referenced image and the digests of its
+// layers, from the base layer to the top one. The reference is either a tag or a digest.
+func (r *Client) Manifest(repository, reference string) (string, []string, error) {
+	var manifest struct {
+		SchemaVersion int    `json:"schemaVersion"`
+		MediaType     string `json:"mediaType"`
+		Layers        []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+		FSLayers []struct {
+			BlobSum string `json:"blobSum"`
+		} `json:"fsLayers"`
+	}
+	accept := schema2MediaType + ", " + schema1MediaType
+	header, err := r.get("/v2/"+repository+"/manifests/"+reference, repositoryScope(repository), accept, &manifest)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var digests []string
+	switch {
+	case manifest.MediaType == manifestListMediaType:
+		return "", nil, ErrUnsupportedManifest
+	case manifest.SchemaVersion == 1:
+		// Schema 1 manifests list the layers from the top one to the base one.
+		for i := len(manifest.FSLayers) - 1; i >= 0; i-- {
+			digests = append(digests, manifest.FSLayers[i].BlobSum)
+		}
+	case manifest.SchemaVersion == 2:
+		for _, layer := range manifest.Layers {
+			digests = append(digests, layer.Digest)
+		}
+	default:
+		return "", nil, ErrUnsupportedManifest
+	}
+
+	return header.Get("Docker-Content-Digest"), digests, nil
+}
+
+// BlobURL returns the URL of a layer of the repository.
+func (r *Client) BlobURL(repository, digest string) string {
+	return r.url + "/v2/" + repository + "/blobs/" + digest
+}
+
+// Authorization returns the Authorization header allowing to pull the repository, if any.
+func (r *Client) Authorization(repository string) string {
+	if token, ok := r.tokens[repositoryScope(repository)]; ok {
+		return "Bearer " + token
+	}
+	if r.username != "" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(r.username+":"+r.password))
+	}
+	return ""
+}
+
+// get decodes the JSON resource at the given path of the registry, authenticating for the given
+// scope if the registry requires it.
+func (r *Client) get(path, scope, accept string, v interface{}) (http.Header, error) {
+	resp, err := r.fetch(path, scope, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer drain(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry: got status %d getting %s", resp.StatusCode, path)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("registry: could not decode %s: %s", path, err)
+	}
+	return resp.Header, nil
+}
+
+// fetch gets the resource at the given path of the registry, authenticating for the given scope
+// if the registry requires it. The caller checks the status and closes the body.
+func (r *Client) fetch(path, scope, accept string) (*http.Response, error) {
+	return r.send("GET", path, scope, accept, "", nil)
+}
+
+// send sends a request to the given path of the registry, or to the given URL, authenticating for
+// the given scope if the registry requires it. The caller checks the status and closes the body.
+func (r *Client) send(method, path, scope, accept, contentType string, body []byte) (*http.Response, error) {
+	resp, err := r.do(method, path, scope, accept, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		drain(resp.Body)
+
+		if !strings.HasPrefix(challenge, "Bearer ") {
+			return nil, fmt.Errorf("registry: unauthorized to %s %s", method, path)
+		}
+		if err := r.authenticate(challenge, scope); err != nil {
+			return nil, err
+		}
+		return r.do(method, path, scope, accept, contentType, body)
+	}
+	return resp, nil
+}
+
+func (r *Client) do(method, path, scope, accept, contentType string, body []byte) (*http.Response, error) {
+	target := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		target = r.url + path
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token, ok := r.tokens[scope]; ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	return r.client.Do(req)
+}
+
+// authenticate obtains a bearer token for the given scope from the authorization server named
+// by the challenge of the registry.
+func (r *Client) authenticate(challenge, scope string) error {
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("registry: invalid authentication challenge %q", challenge)
+	}
+
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer drain(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry: got status %d getting a token for %s", resp.StatusCode, scope)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("registry: could not decode token: %s", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	r.tokens[scope] = token.Token
+	return nil
+}
+
+// LayerName returns the name of a layer in Clair given the name of its parent. As a layer is
+// indexed along with its parents, the name identifies the whole chain, the same way as the chain
+// IDs of Docker images.
+func LayerName(parentName, digest string) string {
+	if parentName == "" {
+		return digest
+	}
+	hash := sha256.Sum256([]byte(parentName + " " + digest))
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// ImageName returns the name of the images of a repository, e.g.
+// "registry.example.com/team/app", given the base URL of their registry.
+func ImageName(registryURL, repository string) string {
+	if u, err := url.Parse(registryURL); err == nil && u.Host != "" {
+		return u.Host + "/" + repository
+	}
+	return repository
+}
+
+func repositoryScope(repository string) string {
+	return "repository:" + repository + ":pull"
+}
+
+func pushScope(repository string) string {
+	return "repository:" + repository + ":pull,push"
+}
+
+// digestOf returns the digest of the content of a blob or a manifest.
+func digestOf(content []byte) string {
+	hash := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// parseChallenge parses the comma-separated key="value" parameters of an authentication
+// challenge. Values may contain commas.
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		var key, value string
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key, s = strings.TrimSpace(s[:eq]), s[eq+1:]
+
+		if strings.HasPrefix(s, "\"") {
+			end := strings.Index(s[1:], "\"")
+			if end < 0 {
+				break
+			}
+			value, s = s[1:end+1], s[end+2:]
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		params[key] = value
+		s = strings.TrimPrefix(strings.TrimSpace(s), ",")
+	}
+	return params
+}
+
+// nextPage returns the path of the next page given by the Link header, or an empty string on the
+// last page.
+func nextPage(header http.Header) string {
+	link := header.Get("Link")
+	if !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+
+	next, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return next.RequestURI()
+}
+
+// drain reads the rest of the body so the connection can be reused, and closes it.
+func drain(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, body)
+	body.Close()
+}
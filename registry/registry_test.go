@@ -0,0 +1,43 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChallenge(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry",
+		"scope":   "repository:debian:pull,push",
+	}, parseChallenge(`realm="https://auth.example.com/token",service="registry",scope="repository:debian:pull,push"`))
+}
+
+func TestNextPage(t *testing.T) {
+	header := make(http.Header)
+	assert.Equal(t, "", nextPage(header))
+
+	header.Set("Link", `<https://registry.example.com/v2/_catalog?last=debian&n=100>; rel="next"`)
+	assert.Equal(t, "/v2/_catalog?last=debian&n=100", nextPage(header))
+}
+
+func TestLayerName(t *testing.T) {
+	assert.Equal(t, "sha256:base", LayerName("", "sha256:base"))
+	assert.NotEqual(t, LayerName("sha256:a", "sha256:top"), LayerName("sha256:b", "sha256:top"), "layer names depend on the parent")
+}
@@ -0,0 +1,60 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remediation gives the commands upgrading the features affected by vulnerabilities to the
+// versions fixing them, in the package manager of their namespace, so that the reports and
+// notifications tell how to remediate the vulnerabilities that have a fix.
+package remediation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+// commands are the formats of the commands upgrading a package to a version, by the name of the
+// namespaces without their version, e.g. "debian" for "debian:8". They are formatted with the
+// name of the package, then the version.
+var commands = map[string]string{
+	"debian":        "apt-get install --only-upgrade %s=%s",
+	"ubuntu":        "apt-get install --only-upgrade %s=%s",
+	"alpine":        "apk add --upgrade %s=%s",
+	"centos":        "yum update-to %s-%s",
+	"rhel":          "yum update-to %s-%s",
+	"oracle":        "yum update-to %s-%s",
+	"ol":            "yum update-to %s-%s",
+	"amzn":          "yum update-to %s-%s",
+	"fedora":        "dnf upgrade %s-%s",
+	"sles":          "zypper install %s=%s",
+	"opensuse-leap": "zypper install %s=%s",
+	"conda":         "conda install %s=%s",
+	"nuget":         "dotnet add package %s --version %s",
+	"packagist":     "composer require %s:%s",
+	"crates.io":     "cargo update -p %s --precise %s",
+}
+
+// Command returns the command upgrading the feature of the given namespace to the version fixing a
+// vulnerability, or an empty string if no version fixes it or if the package manager of the
+// namespace is unknown.
+func Command(namespaceName, featureName, fixedBy string) string {
+	if fixedBy == "" || fixedBy == versionfmt.MaxVersion {
+		return ""
+	}
+	format, ok := commands[strings.SplitN(namespaceName, ":", 2)[0]]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(format, featureName, fixedBy)
+}
@@ -0,0 +1,42 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remediation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/ext/versionfmt"
+)
+
+func TestCommand(t *testing.T) {
+	for _, test := range []struct {
+		namespace, feature, fixedBy string
+		expected                    string
+	}{
+		{"debian:12", "openssl", "3.0.11-1~deb12u2", "apt-get install --only-upgrade openssl=3.0.11-1~deb12u2"},
+		{"alpine:v3.4", "musl", "1.1.14-r13", "apk add --upgrade musl=1.1.14-r13"},
+		{"centos:7", "openssl", "1:1.0.2k-8.el7", "yum update-to openssl-1:1.0.2k-8.el7"},
+		{"sles:15.5", "curl", "7.79.1-150400.5.12.1", "zypper install curl=7.79.1-150400.5.12.1"},
+		{"crates.io", "smallvec", "1.6.1", "cargo update -p smallvec --precise 1.6.1"},
+		// Nothing can be done without a fixed version or a known package manager.
+		{"debian:12", "openssl", "", ""},
+		{"debian:12", "openssl", versionfmt.MaxVersion, ""},
+		{"gentoo:2.2", "openssl", "1.0.2", ""},
+	} {
+		assert.Equal(t, test.expected, Command(test.namespace, test.feature, test.fixedBy), "%s %s", test.namespace, test.feature)
+	}
+}
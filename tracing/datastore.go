@@ -0,0 +1,76 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// Datastore returns the datastore making its queries with the given context, and recording a
+// span for every call to its methods, as a child of the span of the context. If the given
+// datastore was itself returned by Datastore, the spans of its calls become children of the new
+// context's span instead, rather than being recorded twice. The datastore is only bound to the
+// context while tracing is disabled.
+func Datastore(ctx context.Context, datastore database.Datastore) database.Datastore {
+	if datastore == nil {
+		return nil
+	}
+	if traced, ok := datastore.(*tracedDatastore); ok {
+		datastore = traced.base
+	}
+	if current() == nil {
+		return datastore.WithContext(ctx)
+	}
+	return &tracedDatastore{
+		Datastore: database.Observe(datastore.WithContext(ctx), datastoreObserver{ctx: ctx}),
+		base:      datastore,
+	}
+}
+
+type tracedDatastore struct {
+	database.Datastore
+	base database.Datastore
+}
+
+func (ds *tracedDatastore) WithContext(ctx context.Context) database.Datastore {
+	return Datastore(ctx, ds.base)
+}
+
+// datastoreObserver records the calls to the datastore as client spans. The spans are created
+// once the calls return, from their duration.
+type datastoreObserver struct {
+	ctx context.Context
+}
+
+func (o datastoreObserver) ObserveCall(method string, duration time.Duration, err error) {
+	end := time.Now()
+	_, span := Start(o.ctx, "Datastore."+method, KindClient)
+	if span == nil {
+		return
+	}
+	span.start = end.Add(-duration)
+	span.SetAttribute("db.operation", method)
+	if err == cerrors.ErrNotFound {
+		err = nil
+	}
+	span.endAt(end, err)
+}
+
+func (o datastoreObserver) ObserveLock(name string, renew, locked bool) {}
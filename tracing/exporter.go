@@ -0,0 +1,380 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/logging"
+	"github.com/coreos/clair/version"
+)
+
+const (
+	// queueSize is the number of ended spans waiting to be exported above which new ones are
+	// dropped, e.g. while the collector is unreachable.
+	queueSize = 4096
+
+	// batchSize is the largest number of spans exported at once.
+	batchSize = 512
+
+	// exportInterval is how often the ended spans are exported, unless a batch is full before.
+	exportInterval = 5 * time.Second
+
+	// exportTimeout bounds every export to the collector.
+	exportTimeout = 10 * time.Second
+
+	// defaultServiceName is the name of the service in the exported traces unless another one is
+	// configured.
+	defaultServiceName = "clair"
+)
+
+var (
+	log = logging.New("tracing")
+
+	promSpansTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clair_tracing_spans_total",
+		Help: "Number of sampled spans, by result of their export: exported, failed or dropped.",
+	}, []string{"result"})
+
+	tracerM sync.RWMutex
+	active  *tracer
+)
+
+func init() {
+	prometheus.MustRegister(promSpansTotal)
+}
+
+// tracer samples the traces and exports their spans to an OTLP/HTTP endpoint in batches.
+type tracer struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	ratio       float64
+	client      *http.Client
+
+	randM sync.Mutex
+	rand  *mrand.Rand
+
+	spans chan *Span
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Configure enables tracing with the given configuration, or leaves it disabled if it is nil or
+// has no endpoint.
+func Configure(cfg *config.TracingConfig) error {
+	if cfg == nil || cfg.Endpoint == "" {
+		return nil
+	}
+
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("tracing: invalid endpoint %q", cfg.Endpoint)
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return fmt.Errorf("tracing: invalid sample ratio %v", cfg.SampleRatio)
+	}
+
+	t := &tracer{
+		endpoint:    u.ResolveReference(&url.URL{Path: "v1/traces"}).String(),
+		headers:     cfg.Headers,
+		serviceName: cfg.ServiceName,
+		ratio:       cfg.SampleRatio,
+		client:      &http.Client{Timeout: exportTimeout},
+		rand:        mrand.New(mrand.NewSource(time.Now().UnixNano())),
+		spans:       make(chan *Span, queueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if t.serviceName == "" {
+		t.serviceName = defaultServiceName
+	}
+	if u.Path != "" && u.Path[len(u.Path)-1] != '/' {
+		// The endpoint already includes the path of the traces, e.g. behind a proxy.
+		t.endpoint = u.String()
+	}
+	if t.ratio == 0 {
+		t.ratio = 1
+	}
+
+	tracerM.Lock()
+	previous := active
+	active = t
+	tracerM.Unlock()
+	if previous != nil {
+		previous.shutdown()
+	}
+
+	go t.run()
+	log.Infof("exporting the traces to %s", t.endpoint)
+	return nil
+}
+
+// Shutdown disables tracing, once the spans that ended are exported.
+func Shutdown() {
+	tracerM.Lock()
+	t := active
+	active = nil
+	tracerM.Unlock()
+
+	if t != nil {
+		t.shutdown()
+	}
+}
+
+func current() *tracer {
+	tracerM.RLock()
+	defer tracerM.RUnlock()
+	return active
+}
+
+// sample returns whether a new trace is exported.
+func (t *tracer) sample() bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	t.randM.Lock()
+	defer t.randM.Unlock()
+	return t.rand.Float64() < t.ratio
+}
+
+// export queues an ended span, or drops it if the queue is full.
+func (t *tracer) export(span *Span) {
+	select {
+	case t.spans <- span:
+	default:
+		promSpansTotal.WithLabelValues("dropped").Inc()
+	}
+}
+
+func (t *tracer) shutdown() {
+	close(t.stop)
+	<-t.done
+}
+
+// run exports the queued spans in batches, until the tracer is shut down.
+func (t *tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			t.send(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case span := <-t.spans:
+			if batch = append(batch, span); len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case span := <-t.spans:
+					if batch = append(batch, span); len(batch) == batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send exports a batch of spans to the collector.
+func (t *tracer) send(batch []*Span) {
+	body, err := json.Marshal(t.request(batch))
+	if err != nil {
+		log.Warningf("could not encode %d spans: %s", len(batch), err)
+		promSpansTotal.WithLabelValues("failed").Add(float64(len(batch)))
+		return
+	}
+
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Warningf("could not export %d spans: %s", len(batch), err)
+		promSpansTotal.WithLabelValues("failed").Add(float64(len(batch)))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			err = fmt.Errorf("got status code %d", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		log.Warningf("could not export %d spans: %s", len(batch), err)
+		promSpansTotal.WithLabelValues("failed").Add(float64(len(batch)))
+		return
+	}
+	promSpansTotal.WithLabelValues("exported").Add(float64(len(batch)))
+}
+
+// The OTLP/HTTP request exporting spans, in the JSON encoding of its protobuf messages.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+
+	otlpStatus struct {
+		// Code is 0 if the status is unset, 2 if the operation failed.
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+
+	otlpAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+func (t *tracer) request(batch []*Span) otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, span.otlp())
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: attributes(map[string]interface{}{
+			"service.name":    t.serviceName,
+			"service.version": version.Version,
+		})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/coreos/clair", Version: version.Version},
+			Spans: spans,
+		}},
+	}}}
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        attributes(s.attributes),
+	}
+	if s.parentID != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if s.err != nil {
+		span.Status = otlpStatus{Code: 2, Message: s.err.Error()}
+	}
+	return span
+}
+
+// attributes converts the attributes of a span or a resource, sorted by key.
+func attributes(m map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		var value otlpAnyValue
+		switch v := m[key].(type) {
+		case int:
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		case bool:
+			value.BoolValue = &v
+		case string:
+			value.StringValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		kvs = append(kvs, otlpKeyValue{Key: key, Value: value})
+	}
+	return kvs
+}
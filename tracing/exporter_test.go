@@ -0,0 +1,161 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/version"
+)
+
+// TestOTLPRequest checks the requests against the JSON encoding of the OTLP/HTTP protocol, as
+// defined by opentelemetry-proto: the fields are in lowerCamelCase, the IDs are in hexadecimal
+// rather than in base64, and the 64-bit integers are strings.
+func TestOTLPRequest(t *testing.T) {
+	start := time.Unix(1456247389, 500)
+	parent := &Span{
+		traceID: [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		spanID:  [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		name:    "GET /v1/layers/:layerName",
+		kind:    KindServer,
+		start:   start,
+		end:     start.Add(time.Second),
+		attributes: map[string]interface{}{
+			"http.status_code": 200,
+			"http.method":      "GET",
+			"cached":           true,
+			"ratio":            0.5,
+		},
+	}
+	child := &Span{
+		traceID:  parent.traceID,
+		spanID:   [8]byte{0x53, 0x99, 0x5c, 0x3f, 0x42, 0xcd, 0x8a, 0xd8},
+		parentID: parent.spanID,
+		name:     "SELECT",
+		kind:     KindClient,
+		start:    start,
+		end:      start.Add(time.Millisecond),
+		err:      errors.New("canceled"),
+	}
+
+	body, err := json.Marshal((&tracer{serviceName: "clair"}).request([]*Span{parent, child}))
+	if assert.Nil(t, err) {
+		assert.JSONEq(t, strings.Replace(`{
+  "resourceSpans": [{
+    "resource": {
+      "attributes": [
+        {"key": "service.name", "value": {"stringValue": "clair"}},
+        {"key": "service.version", "value": {"stringValue": "VERSION"}}
+      ]
+    },
+    "scopeSpans": [{
+      "scope": {"name": "github.com/coreos/clair", "version": "VERSION"},
+      "spans": [
+        {
+          "traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+          "spanId": "00f067aa0ba902b7",
+          "name": "GET /v1/layers/:layerName",
+          "kind": 2,
+          "startTimeUnixNano": "1456247389000000500",
+          "endTimeUnixNano": "1456247390000000500",
+          "attributes": [
+            {"key": "cached", "value": {"boolValue": true}},
+            {"key": "http.method", "value": {"stringValue": "GET"}},
+            {"key": "http.status_code", "value": {"intValue": "200"}},
+            {"key": "ratio", "value": {"doubleValue": 0.5}}
+          ],
+          "status": {}
+        },
+        {
+          "traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+          "spanId": "53995c3f42cd8ad8",
+          "parentSpanId": "00f067aa0ba902b7",
+          "name": "SELECT",
+          "kind": 3,
+          "startTimeUnixNano": "1456247389000000500",
+          "endTimeUnixNano": "1456247389001000500",
+          "status": {"code": 2, "message": "canceled"}
+        }
+      ]
+    }]
+  }]
+}`, "VERSION", version.Version, -1), string(body))
+	}
+}
+
+func TestOTLPExport(t *testing.T) {
+	exported := func(result string) float64 {
+		var metric dto.Metric
+		assert.Nil(t, promSpansTotal.WithLabelValues(result).Write(&metric))
+		return metric.GetCounter().GetValue()
+	}
+
+	var requests []*http.Request
+	var bodies []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests, bodies = append(requests, r), append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	// The spans are exported with a POST to the traces path of the endpoint, unless it has a path.
+	for _, endpoint := range []string{server.URL, server.URL + "/", server.URL + "/otlp/v1/traces"} {
+		requests, bodies = nil, nil
+		assert.Nil(t, Configure(&config.TracingConfig{Endpoint: endpoint, Headers: map[string]string{"X-Scope-OrgID": "clair"}}))
+		_, span := Start(context.Background(), "span", KindInternal)
+		span.End(nil)
+		Shutdown()
+
+		if assert.Len(t, requests, 1, endpoint) {
+			r := requests[0]
+			assert.Equal(t, "POST", r.Method, endpoint)
+			if endpoint == server.URL+"/otlp/v1/traces" {
+				assert.Equal(t, "/otlp/v1/traces", r.URL.Path, endpoint)
+			} else {
+				assert.Equal(t, "/v1/traces", r.URL.Path, endpoint)
+			}
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"), endpoint)
+			assert.Equal(t, "clair", r.Header.Get("X-Scope-OrgID"), endpoint)
+
+			var request map[string]interface{}
+			assert.Nil(t, json.Unmarshal([]byte(bodies[0]), &request), endpoint)
+			assert.Contains(t, request, "resourceSpans", endpoint)
+		}
+	}
+
+	// The spans rejected by the collector are counted as failed.
+	status = http.StatusServiceUnavailable
+	failed, ok := exported("failed"), exported("exported")
+	assert.Nil(t, Configure(&config.TracingConfig{Endpoint: server.URL}))
+	_, span := Start(context.Background(), "span", KindInternal)
+	span.End(nil)
+	Shutdown()
+	assert.Equal(t, failed+1, exported("failed"))
+	assert.Equal(t, ok, exported("exported"))
+}
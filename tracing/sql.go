@@ -0,0 +1,137 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"database/sql"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// DB is an SQL database making its queries with a context, which cancels them once it is done,
+// and recording a client span for each of them, as a child of the span of the context.
+//
+// The spans of the queries returning rows end once the rows are returned rather than once they are
+// read, and the spans of the queries returning a single row can't tell whether they failed.
+type DB struct {
+	*sql.DB
+	ctx    context.Context
+	system string
+}
+
+// NewDB returns a DB making the queries to the given database with a background context. The
+// system is the name of the database management system, as defined by OpenTelemetry, e.g.
+// "postgresql".
+func NewDB(db *sql.DB, system string) *DB {
+	return &DB{DB: db, ctx: context.Background(), system: system}
+}
+
+// WithContext returns a DB making the queries to the same database with the given context.
+func (db *DB) WithContext(ctx context.Context) *DB {
+	return &DB{DB: db.DB, ctx: ctx, system: db.system}
+}
+
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	span := startQuery(db.ctx, db.system, query)
+	rows, err := db.DB.QueryContext(db.ctx, query, args...)
+	span.End(err)
+	return rows, err
+}
+
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	span := startQuery(db.ctx, db.system, query)
+	defer span.End(nil)
+	return db.DB.QueryRowContext(db.ctx, query, args...)
+}
+
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	span := startQuery(db.ctx, db.system, query)
+	result, err := db.DB.ExecContext(db.ctx, query, args...)
+	span.End(err)
+	return result, err
+}
+
+// Begin starts a transaction, whose queries are made with the context of the DB.
+func (db *DB) Begin() (*Tx, error) {
+	span := startQuery(db.ctx, db.system, "BEGIN")
+	tx, err := db.DB.BeginTx(db.ctx, nil)
+	span.End(err)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, ctx: db.ctx, system: db.system}, nil
+}
+
+// Tx is a transaction of a DB.
+type Tx struct {
+	*sql.Tx
+	ctx    context.Context
+	system string
+}
+
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	span := startQuery(tx.ctx, tx.system, query)
+	rows, err := tx.Tx.QueryContext(tx.ctx, query, args...)
+	span.End(err)
+	return rows, err
+}
+
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	span := startQuery(tx.ctx, tx.system, query)
+	defer span.End(nil)
+	return tx.Tx.QueryRowContext(tx.ctx, query, args...)
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	span := startQuery(tx.ctx, tx.system, query)
+	result, err := tx.Tx.ExecContext(tx.ctx, query, args...)
+	span.End(err)
+	return result, err
+}
+
+func (tx *Tx) Commit() error {
+	span := startQuery(tx.ctx, tx.system, "COMMIT")
+	err := tx.Tx.Commit()
+	span.End(err)
+	return err
+}
+
+// Rollback aborts the transaction. Rolling back a transaction that is already done, e.g. by a
+// deferred call after a commit, isn't recorded.
+func (tx *Tx) Rollback() error {
+	span := startQuery(tx.ctx, tx.system, "ROLLBACK")
+	err := tx.Tx.Rollback()
+	if err != sql.ErrTxDone {
+		span.End(err)
+	}
+	return err
+}
+
+// startQuery starts the span of a query, named after its operation, e.g. "SELECT".
+func startQuery(ctx context.Context, system, query string) *Span {
+	if current() == nil {
+		return nil
+	}
+	var operation string
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	_, span := Start(ctx, operation, KindClient)
+	span.SetAttribute("db.system", system)
+	span.SetAttribute("db.operation", operation)
+	span.SetAttribute("db.statement", query)
+	return span
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package tracing
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/config"
+)
+
+func TestDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clair-tracing")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	sqlDB, err := sql.Open("sqlite3", filepath.Join(dir, "clair.db"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer sqlDB.Close()
+
+	c := &collector{spans: make(map[string]otlpSpan)}
+	server := httptest.NewServer(c)
+	defer server.Close()
+	assert.Nil(t, Configure(&config.TracingConfig{Endpoint: server.URL}))
+
+	// Every query is recorded as a child of the span of the context of the DB.
+	ctx, parent := Start(context.Background(), "worker.Process", KindInternal)
+	db := NewDB(sqlDB, "sqlite").WithContext(ctx)
+	_, err = db.Exec("CREATE TABLE layer (name TEXT)")
+	assert.Nil(t, err)
+	tx, err := db.Begin()
+	if assert.Nil(t, err) {
+		_, err = tx.Exec("INSERT INTO layer (name) VALUES (?)", "layer")
+		assert.Nil(t, err)
+		assert.Nil(t, tx.Commit())
+		assert.Equal(t, sql.ErrTxDone, tx.Rollback())
+	}
+	var name string
+	assert.Nil(t, db.QueryRow("\n\tselect name FROM layer").Scan(&name))
+	assert.Equal(t, "layer", name)
+	_, err = db.Exec("DELETE FROM missing")
+	assert.NotNil(t, err)
+	parent.End(nil)
+
+	// The queries are canceled with the context of the DB.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewDB(sqlDB, "sqlite").WithContext(canceled).Exec("UPDATE layer SET name = ?", "canceled")
+	assert.Equal(t, context.Canceled, err)
+
+	Shutdown()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.spans["worker.Process"]
+	statements := make(map[string]string)
+	for _, operation := range []string{"CREATE", "BEGIN", "INSERT", "COMMIT", "SELECT", "DELETE"} {
+		s, ok := c.spans[operation]
+		if !assert.True(t, ok, operation) {
+			continue
+		}
+		assert.Equal(t, p.TraceID, s.TraceID, operation)
+		assert.Equal(t, p.SpanID, s.ParentSpanID, operation)
+		assert.Equal(t, KindClient, s.Kind, operation)
+
+		values := make(map[string]string)
+		for _, kv := range s.Attributes {
+			values[kv.Key] = *kv.Value.StringValue
+		}
+		assert.Equal(t, "sqlite", values["db.system"], operation)
+		assert.Equal(t, operation, values["db.operation"], operation)
+		statements[operation] = values["db.statement"]
+	}
+	assert.Equal(t, "\n\tselect name FROM layer", statements["SELECT"])
+	assert.Equal(t, "INSERT INTO layer (name) VALUES (?)", statements["INSERT"])
+	assert.NotContains(t, c.spans, "ROLLBACK")
+	assert.Equal(t, 0, c.spans["SELECT"].Status.Code)
+	assert.Equal(t, 2, c.spans["DELETE"].Status.Code)
+}
@@ -0,0 +1,166 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing records the spans of the operations of Clair, such as the API requests, the
+// analyses of the layers, the calls to the datastore and the fetches of the updater, and exports
+// them to an OpenTelemetry collector over OTLP/HTTP.
+//
+// Tracing is disabled until Configure is called with a configuration, in which case Start returns
+// nil spans, whose methods do nothing.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	mrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// The kinds of the spans, as defined by OpenTelemetry.
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// traceparentHeader is the W3C Trace Context header propagating the trace of a request.
+const traceparentHeader = "Traceparent"
+
+// A Span is an operation of a trace, e.g. the handling of an API request.
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+
+	mu         sync.Mutex
+	name       string
+	kind       int
+	start, end time.Time
+	attributes map[string]interface{}
+	err        error
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// remoteParent is the span of another service that a request is part of.
+type remoteParent struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+// Start starts a span of the given name and kind, child of the span of the given context, if any,
+// and returns it along with a context carrying it. It returns a nil span if tracing is disabled.
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	t := current()
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{name: name, kind: kind, start: time.Now()}
+	randomID(span.spanID[:])
+	if parent := FromContext(ctx); parent != nil {
+		span.traceID, span.parentID, span.sampled = parent.traceID, parent.spanID, parent.sampled
+	} else if remote, ok := ctx.Value(remoteKey).(remoteParent); ok {
+		span.traceID, span.parentID, span.sampled = remote.traceID, remote.spanID, remote.sampled
+	} else {
+		randomID(span.traceID[:])
+		span.sampled = t.sample()
+	}
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+// FromContext returns the span carried by the given context, or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// Extract returns a context carrying the span of another service that the request with the given
+// headers is part of, as given by its W3C Trace Context "traceparent" header, if any.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	// e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(header.Get(traceparentHeader), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ctx
+	}
+
+	var remote remoteParent
+	var flags [1]byte
+	if !decodeHex(remote.traceID[:], parts[1]) || !decodeHex(remote.spanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) {
+		return ctx
+	}
+	if remote.traceID == [16]byte{} || remote.spanID == [8]byte{} {
+		return ctx
+	}
+	remote.sampled = flags[0]&1 == 1
+	return context.WithValue(ctx, remoteKey, remote)
+}
+
+// SetAttribute sets an attribute of the span, e.g. the name of the layer being analyzed. The
+// values are strings, integers, floats or booleans.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+	s.attributes[key] = value
+}
+
+// End ends the span, failed if the given error isn't nil, and exports it if its trace is sampled.
+func (s *Span) End(err error) {
+	s.endAt(time.Now(), err)
+}
+
+func (s *Span) endAt(end time.Time, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end, s.err = end, err
+	s.mu.Unlock()
+
+	if t := current(); t != nil && s.sampled {
+		t.export(s)
+	}
+}
+
+func randomID(id []byte) {
+	if _, err := rand.Read(id); err != nil {
+		mrand.Read(id)
+	}
+}
+
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+// collector records the spans exported to it, by name.
+type collector struct {
+	mu      sync.Mutex
+	headers http.Header
+	spans   map[string]otlpSpan
+	service string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request otlpRequest
+	if r.URL.Path != "/v1/traces" || json.NewDecoder(r.Body).Decode(&request) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.headers = r.Header
+	for _, rs := range request.ResourceSpans {
+		for _, kv := range rs.Resource.Attributes {
+			if kv.Key == "service.name" {
+				c.service = *kv.Value.StringValue
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				c.spans[span.Name] = span
+			}
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "disabled", KindInternal)
+	assert.Nil(t, span)
+	assert.Nil(t, FromContext(ctx))
+	span.SetAttribute("key", "value")
+	span.End(nil)
+
+	datastore := &database.MockDatastore{}
+	assert.Equal(t, database.Datastore(datastore), Datastore(ctx, datastore))
+}
+
+func TestExport(t *testing.T) {
+	c := &collector{spans: make(map[string]otlpSpan)}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	assert.Error(t, Configure(&config.TracingConfig{Endpoint: "localhost:4318"}))
+	assert.Nil(t, Configure(&config.TracingConfig{Endpoint: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}))
+
+	// A request continuing the trace of its caller.
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, request := Start(Extract(context.Background(), header), "GET /v1/layers/:layerName", KindServer)
+	request.SetAttribute("http.status_code", 200)
+
+	ctx, process := Start(ctx, "worker.Process", KindInternal)
+	process.SetAttribute("layer", "layer")
+	datastore := Datastore(ctx, &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{}, cerrors.ErrNotFound
+		},
+		FctInsertLayer: func(database.Layer) error {
+			return errors.New("could not insert")
+		},
+	})
+	// The calls are recorded once, as children of the innermost span.
+	datastore = Datastore(ctx, Datastore(context.Background(), datastore))
+	datastore.FindLayer("layer", false, false)
+	process.End(datastore.InsertLayer(database.Layer{}))
+	request.End(nil)
+
+	// An unsampled request.
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, unsampled := Start(Extract(context.Background(), header), "unsampled", KindServer)
+	unsampled.End(nil)
+
+	Shutdown()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	assert.Equal(t, "Bearer token", c.headers.Get("Authorization"))
+	assert.Equal(t, "clair", c.service)
+	assert.Len(t, c.spans, 4)
+
+	s := c.spans["GET /v1/layers/:layerName"]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", s.ParentSpanID)
+	assert.Equal(t, KindServer, s.Kind)
+	if assert.Len(t, s.Attributes, 1) && assert.NotNil(t, s.Attributes[0].Value.IntValue) {
+		assert.Equal(t, "200", *s.Attributes[0].Value.IntValue)
+	}
+
+	p := c.spans["worker.Process"]
+	assert.Equal(t, s.TraceID, p.TraceID)
+	assert.Equal(t, s.SpanID, p.ParentSpanID)
+	assert.Equal(t, 2, p.Status.Code)
+	assert.Equal(t, "could not insert", p.Status.Message)
+
+	f := c.spans["Datastore.FindLayer"]
+	assert.Equal(t, p.SpanID, f.ParentSpanID)
+	assert.Equal(t, KindClient, f.Kind)
+	assert.Equal(t, 0, f.Status.Code)
+	assert.True(t, f.StartTimeUnixNano <= f.EndTimeUnixNano)
+
+	i := c.spans["Datastore.InsertLayer"]
+	assert.Equal(t, p.SpanID, i.ParentSpanID)
+	assert.Equal(t, 2, i.Status.Code)
+}
+
+func TestExtract(t *testing.T) {
+	for _, traceparent := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+	} {
+		header := http.Header{}
+		header.Set("traceparent", traceparent)
+		_, ok := Extract(context.Background(), header).Value(remoteKey).(remoteParent)
+		assert.False(t, ok, traceparent)
+	}
+}
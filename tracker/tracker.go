@@ -0,0 +1,439 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracker keeps the watched tags indexed: it resolves them periodically and indexes the
+// images they point to whenever they change.
+package tracker
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/pborman/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/attestation"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/registry"
+	"github.com/coreos/clair/utils"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/worker"
+)
+
+const (
+	lockName     = "tracker"
+	lockDuration = 10 * time.Minute
+
+	// pageSize is the number of watched tags loaded at once.
+	pageSize = 100
+
+	// ReportArtifactType is the artifact type of the reports published to the registries.
+	ReportArtifactType = "application/vnd.clair.report.v1+json"
+
+	scannerName       = "clair"
+	createdAnnotation = "org.opencontainers.image.created"
+)
+
+// publishedReport is the vulnerability report published to the registries as a referrer of the
+// image.
+type publishedReport struct {
+	Image   string    `json:"image"`
+	Scanner string    `json:"scanner"`
+	Created time.Time `json:"created"`
+	attestation.Result
+}
+
+var (
+	log = capnslog.NewPackageLogger("github.com/coreos/clair", "tracker")
+
+	promTrackerErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_tracker_errors_total",
+		Help: "Number of watched tags that could not be resolved or indexed.",
+	})
+
+	promTrackerChangesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_tracker_changes_total",
+		Help: "Number of times a watched tag moved to a new image.",
+	})
+
+	promTrackerRejectedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_tracker_rejected_total",
+		Help: "Number of images of watched tags that were not indexed because they are not signed by a trusted key.",
+	})
+
+	promTrackerAttestationsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_tracker_attestations_total",
+		Help: "Number of vulnerability reports of images of watched tags that were attested.",
+	})
+
+	promTrackerPublicationsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_tracker_publications_total",
+		Help: "Number of vulnerability reports of images of watched tags that were published to their registries.",
+	})
+
+	promTrackerNewFindingsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_tracker_new_findings_total",
+		Help: "Number of vulnerabilities affecting the new image of a watched tag but not its previous one.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(promTrackerErrorsTotal)
+	prometheus.MustRegister(promTrackerChangesTotal)
+	prometheus.MustRegister(promTrackerRejectedTotal)
+	prometheus.MustRegister(promTrackerAttestationsTotal)
+	prometheus.MustRegister(promTrackerPublicationsTotal)
+	prometheus.MustRegister(promTrackerNewFindingsTotal)
+}
+
+// Run resolves the watched tags at regular intervals. The images are indexed through the given
+// queue with the bulk priority.
+func Run(config *config.TrackerConfig, datastore database.Datastore, queue *worker.Queue, st *utils.Stopper) {
+	defer st.End()
+
+	// Do not run the tracker if there is no config or if the interval is 0.
+	if config == nil || config.Interval == 0 {
+		log.Infof("tracker service is disabled.")
+		return
+	}
+
+	var keys []*ecdsa.PublicKey
+	if config.Signatures != nil {
+		for _, path := range config.Signatures.Keys {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				log.Fatalf("could not read the public keys: %s", err)
+			}
+			pathKeys, err := registry.ParsePublicKeys(data)
+			if err != nil {
+				log.Fatalf("could not parse the public keys of %s: %s", path, err)
+			}
+			keys = append(keys, pathKeys...)
+		}
+	}
+
+	var signer *attestation.Signer
+	if config.Attestations != nil {
+		data, err := ioutil.ReadFile(config.Attestations.Key)
+		if err != nil {
+			log.Fatalf("could not read the attestation key: %s", err)
+		}
+		if signer, err = attestation.NewSigner(data); err != nil {
+			log.Fatalf("could not parse the attestation key: %s", err)
+		}
+	}
+
+	whoAmI := uuid.New()
+	log.Infof("tracker service started. lock identifier: %s", whoAmI)
+
+	for {
+		// Only one instance tracks the tags at a time.
+		if hasLock, _ := datastore.Lock(lockName, whoAmI, lockDuration, false); hasLock {
+			t := &tracker{
+				datastore: datastore,
+				queue:     queue,
+				config:    config,
+				clients:   make(map[string]*registry.Client),
+				keys:      keys,
+				signer:    signer,
+				renewLock: func() { datastore.Lock(lockName, whoAmI, lockDuration, true) },
+			}
+			if config.Signatures != nil {
+				t.requireSignature = config.Signatures.Require
+			}
+			t.trackAll(st)
+			datastore.Unlock(lockName, whoAmI)
+		} else {
+			log.Debug("tracker lock is already taken")
+		}
+
+		if !st.Sleep(config.Interval) {
+			break
+		}
+	}
+
+	log.Info("tracker service stopped")
+}
+
+type tracker struct {
+	datastore database.Datastore
+	queue     *worker.Queue
+	config    *config.TrackerConfig
+
+	// clients are the registry clients, by base URL, reused during a run to reuse their tokens.
+	clients   map[string]*registry.Client
+	renewLock func()
+
+	// keys are the public keys trusted to sign the images. Their signatures are only verified if
+	// there are any, and required if requireSignature is set.
+	keys             []*ecdsa.PublicKey
+	requireSignature bool
+
+	// signer signs the attestations of the vulnerability reports, if they are enabled.
+	signer *attestation.Signer
+}
+
+// trackAll resolves every watched tag.
+func (t *tracker) trackAll(st *utils.Stopper) {
+	for page := 0; page != -1; {
+		var watchedTags []database.WatchedTag
+		var err error
+		watchedTags, page, err = t.datastore.ListWatchedTags(pageSize, page)
+		if err != nil {
+			log.Errorf("could not list the watched tags: %s", err)
+			promTrackerErrorsTotal.Inc()
+			return
+		}
+
+		for _, watchedTag := range watchedTags {
+			select {
+			case <-st.Chan():
+				return
+			default:
+			}
+
+			if err := t.track(watchedTag); err != nil {
+				log.Errorf("could not track %s/%s:%s: %s", watchedTag.Registry, watchedTag.Repository, watchedTag.Tag, err)
+				promTrackerErrorsTotal.Inc()
+			}
+			t.renewLock()
+		}
+	}
+}
+
+// track resolves a watched tag and indexes its image if it changed.
+func (t *tracker) track(watchedTag database.WatchedTag) error {
+	client, ok := t.clients[watchedTag.Registry]
+	if !ok {
+		credentials := t.config.Registries[watchedTag.Registry]
+		client = registry.NewClient(watchedTag.Registry, credentials.Username, credentials.Password, &http.Client{Timeout: time.Minute})
+		t.clients[watchedTag.Registry] = client
+	}
+
+	digest, digests, err := client.Manifest(watchedTag.Repository, watchedTag.Tag)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	// The layers identify the image even if the registry doesn't give the digest of the manifest.
+	var layerName string
+	for _, digest := range digests {
+		layerName = registry.LayerName(layerName, digest)
+	}
+
+	// Verify the signatures of new images, and of the indexed one until it is signed, as images are
+	// usually signed after being pushed.
+	var signature database.SignatureStatus
+	if len(t.keys) > 0 {
+		signature = watchedTag.Signature
+		if layerName != watchedTag.LayerName || signature != database.SignatureVerified {
+			if signature, err = t.verify(client, watchedTag.Repository, digest); err != nil {
+				return err
+			}
+		}
+	}
+
+	if layerName != watchedTag.LayerName {
+		if t.requireSignature && signature != database.SignatureVerified {
+			promTrackerRejectedTotal.Inc()
+			return fmt.Errorf("the image %s is %s", digest, signature)
+		}
+
+		if err := t.index(client, watchedTag.Repository, digests); err != nil {
+			return err
+		}
+
+		if watchedTag.LayerName != "" {
+			promTrackerChangesTotal.Inc()
+			t.reportNewFindings(watchedTag, layerName)
+		}
+		log.Infof("%s/%s:%s moved to %s", watchedTag.Registry, watchedTag.Repository, watchedTag.Tag, digest)
+
+		watchedTag.Digest = digest
+		watchedTag.LayerName = layerName
+		watchedTag.Changed = now
+	}
+
+	watchedTag.Signature = signature
+	watchedTag.Resolved = now
+
+	// Record the image by digest, so that reports can be compared across digests. Tags indexed
+	// before images were recorded are recorded on their next run.
+	if watchedTag.Digest != "" {
+		image := database.Image{Digest: watchedTag.Digest, LayerName: watchedTag.LayerName}
+		if err := t.datastore.InsertImage(image); err != nil {
+			log.Errorf("could not record the image %s: %s", watchedTag.Digest, err)
+			promTrackerErrorsTotal.Inc()
+		}
+	}
+
+	// Failing to attest or to publish the report doesn't prevent the tag from being updated; they
+	// are retried on the next run.
+	publish := t.config.Registries[watchedTag.Registry].Publish
+	if (t.signer != nil || publish) && watchedTag.LayerName != "" && watchedTag.Digest != "" {
+		if err := t.share(client, &watchedTag, publish); err != nil {
+			log.Errorf("could not share the report of %s/%s:%s: %s", watchedTag.Registry, watchedTag.Repository, watchedTag.Tag, err)
+			promTrackerErrorsTotal.Inc()
+		}
+	}
+
+	return t.datastore.UpdateWatchedTag(watchedTag)
+}
+
+// share pushes the signed attestation of the vulnerability report of the image of the tag to its
+// registry, and publishes the report as a referrer of the image if publish is set, unless the
+// report has been attested or published already.
+func (t *tracker) share(client *registry.Client, watchedTag *database.WatchedTag, publish bool) error {
+	layer, err := t.datastore.FindLayer(watchedTag.LayerName, true, true)
+	if err != nil {
+		return err
+	}
+	result := attestation.ResultFromLayer(layer)
+	hash := result.Hash(watchedTag.Digest)
+	now := time.Now()
+
+	name := registry.ImageName(watchedTag.Registry, watchedTag.Repository)
+
+	if t.signer != nil && hash != watchedTag.Attested {
+		statement, err := attestation.Statement(name, watchedTag.Digest, result, now)
+		if err != nil {
+			return err
+		}
+		envelope, err := t.signer.Sign(statement)
+		if err != nil {
+			return err
+		}
+		if err := client.PushCosignAttestation(watchedTag.Repository, watchedTag.Digest, attestation.PredicateType, envelope); err != nil {
+			return err
+		}
+
+		watchedTag.Attested = hash
+		promTrackerAttestationsTotal.Inc()
+	}
+
+	if publish && hash != watchedTag.Published {
+		report, err := json.Marshal(publishedReport{
+			Image:   name + "@" + watchedTag.Digest,
+			Scanner: scannerName,
+			Created: now.UTC(),
+			Result:  result,
+		})
+		if err != nil {
+			return err
+		}
+		annotations := map[string]string{createdAnnotation: now.UTC().Format(time.RFC3339)}
+		if err := client.PushReferrer(watchedTag.Repository, watchedTag.Digest, ReportArtifactType, report, annotations); err != nil {
+			return err
+		}
+
+		watchedTag.Published = hash
+		promTrackerPublicationsTotal.Inc()
+	}
+
+	return nil
+}
+
+// verify verifies the cosign signatures of the image whose manifest has the given digest.
+func (t *tracker) verify(client *registry.Client, repository, digest string) (database.SignatureStatus, error) {
+	if digest == "" {
+		// The signatures are found by digest, which the registry didn't give.
+		return database.SignatureUnsigned, nil
+	}
+
+	signatures, err := client.CosignSignatures(repository, digest)
+	if err != nil {
+		return "", err
+	}
+	if len(signatures) == 0 {
+		return database.SignatureUnsigned, nil
+	}
+
+	for _, signature := range signatures {
+		if signature.Verify(digest, t.keys) {
+			return database.SignatureVerified, nil
+		}
+	}
+	return database.SignatureUntrusted, nil
+}
+
+// index indexes the layers of an image that haven't been indexed yet.
+func (t *tracker) index(client *registry.Client, repository string, digests []string) error {
+	var headers map[string]string
+	if authorization := client.Authorization(repository); authorization != "" {
+		headers = map[string]string{"Authorization": authorization}
+	}
+
+	var parentName string
+	for _, digest := range digests {
+		name := registry.LayerName(parentName, digest)
+
+		_, err := t.datastore.FindLayer(name, false, false)
+		if err == cerrors.ErrNotFound {
+			err = t.queue.Process(context.Background(), t.datastore, worker.Bulk, "Docker", name, parentName, client.BlobURL(repository, digest), digest, headers)
+		}
+		if err != nil {
+			return err
+		}
+
+		parentName = name
+	}
+	return nil
+}
+
+// reportNewFindings logs the vulnerabilities that affect the new image of the tag but not the
+// previous one.
+func (t *tracker) reportNewFindings(watchedTag database.WatchedTag, layerName string) {
+	previous, err := findings(t.datastore, watchedTag.LayerName)
+	if err != nil && err != cerrors.ErrNotFound {
+		log.Warningf("could not compare the findings of %s/%s:%s: %s", watchedTag.Registry, watchedTag.Repository, watchedTag.Tag, err)
+		return
+	}
+	current, err := findings(t.datastore, layerName)
+	if err != nil {
+		log.Warningf("could not compare the findings of %s/%s:%s: %s", watchedTag.Registry, watchedTag.Repository, watchedTag.Tag, err)
+		return
+	}
+
+	for finding := range current {
+		if _, ok := previous[finding]; !ok {
+			log.Warningf("%s/%s:%s: new finding %s", watchedTag.Registry, watchedTag.Repository, watchedTag.Tag, finding)
+			promTrackerNewFindingsTotal.Inc()
+		}
+	}
+}
+
+// findings returns the vulnerabilities affecting the features of the layer, as
+// "vulnerability (feature version)".
+func findings(datastore database.Datastore, layerName string) (map[string]struct{}, error) {
+	layer, err := datastore.FindLayer(layerName, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := make(map[string]struct{})
+	for _, featureVersion := range layer.Features {
+		for _, vulnerability := range featureVersion.AffectedBy {
+			findings[vulnerability.Name+" ("+featureVersion.Feature.Name+" "+featureVersion.Version+")"] = struct{}{}
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/registry"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+func TestTrack(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/debian/manifests/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:new")
+		fmt.Fprint(w, `{"schemaVersion": 2, "layers": [{"digest": "sha256:base"}, {"digest": "sha256:top"}]}`)
+	}))
+	defer server.Close()
+
+	baseName := registry.LayerName("", "sha256:base")
+	topName := registry.LayerName(baseName, "sha256:top")
+
+	vulnerable := func(names ...string) database.Layer {
+		featureVersion := database.FeatureVersion{Feature: database.Feature{Name: "openssl"}, Version: "1.0"}
+		for _, name := range names {
+			featureVersion.AffectedBy = append(featureVersion.AffectedBy, database.Vulnerability{Name: name})
+		}
+		return database.Layer{Features: []database.FeatureVersion{featureVersion}}
+	}
+
+	var updated []database.WatchedTag
+	var images []database.Image
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			switch name {
+			case "old":
+				return vulnerable("CVE-1"), nil
+			case baseName, topName:
+				return vulnerable("CVE-1", "CVE-2"), nil
+			}
+			return database.Layer{}, cerrors.ErrNotFound
+		},
+		FctUpdateWatchedTag: func(watchedTag database.WatchedTag) error {
+			updated = append(updated, watchedTag)
+			return nil
+		},
+		FctInsertImage: func(image database.Image) error {
+			images = append(images, image)
+			return nil
+		},
+	}
+
+	tr := &tracker{
+		datastore: datastore,
+		config:    &config.TrackerConfig{},
+		clients:   make(map[string]*registry.Client),
+	}
+
+	watchedTag := database.WatchedTag{Registry: server.URL, Repository: "debian", Tag: "latest", Digest: "sha256:old", LayerName: "old"}
+	if assert.Nil(t, tr.track(watchedTag)) && assert.Len(t, updated, 1) {
+		assert.Equal(t, "sha256:new", updated[0].Digest)
+		assert.Equal(t, topName, updated[0].LayerName)
+		assert.False(t, updated[0].Changed.IsZero())
+		assert.False(t, updated[0].Resolved.IsZero())
+		assert.Equal(t, []database.Image{{Digest: "sha256:new", LayerName: topName}}, images)
+	}
+
+	// The tag didn't move: it is only marked as resolved.
+	if assert.Nil(t, tr.track(updated[0])) && assert.Len(t, updated, 2) {
+		assert.Equal(t, updated[0].Changed, updated[1].Changed)
+		assert.False(t, updated[1].Resolved.Before(updated[0].Resolved))
+	}
+
+	// Unknown tags are errors.
+	watchedTag.Tag = "unknown"
+	assert.NotNil(t, tr.track(watchedTag))
+	assert.Len(t, updated, 2)
+}
+
+func TestFindings(t *testing.T) {
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{Features: []database.FeatureVersion{{
+				Feature:    database.Feature{Name: "openssl"},
+				Version:    "1.0",
+				AffectedBy: []database.Vulnerability{{Name: "CVE-1"}, {Name: "CVE-2"}},
+			}}}, nil
+		},
+	}
+
+	f, err := findings(datastore, "layer")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"CVE-1 (openssl 1.0)": {}, "CVE-2 (openssl 1.0)": {}}, f)
+}
+
+func TestTrackSignatures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/debian/manifests/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:unsigned")
+		fmt.Fprint(w, `{"schemaVersion": 2, "layers": [{"digest": "sha256:base"}]}`)
+	}))
+	defer server.Close()
+
+	var updated []database.WatchedTag
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{}, nil
+		},
+		FctUpdateWatchedTag: func(watchedTag database.WatchedTag) error {
+			updated = append(updated, watchedTag)
+			return nil
+		},
+		FctInsertImage: func(image database.Image) error { return nil },
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &tracker{
+		datastore:        datastore,
+		config:           &config.TrackerConfig{},
+		clients:          make(map[string]*registry.Client),
+		keys:             []*ecdsa.PublicKey{&key.PublicKey},
+		requireSignature: true,
+	}
+	watchedTag := database.WatchedTag{Registry: server.URL, Repository: "debian", Tag: "latest"}
+
+	// Unsigned images aren't indexed when signatures are required.
+	assert.NotNil(t, tr.track(watchedTag))
+	assert.Len(t, updated, 0)
+
+	// Otherwise, they are indexed along with their status.
+	tr.requireSignature = false
+	if assert.Nil(t, tr.track(watchedTag)) && assert.Len(t, updated, 1) {
+		assert.Equal(t, database.SignatureUnsigned, updated[0].Signature)
+		assert.Equal(t, "sha256:unsigned", updated[0].Digest)
+	}
+}
+
+func TestTrackPublish(t *testing.T) {
+	var referrers [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v2/debian/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", "sha256:image")
+			fmt.Fprint(w, `{"schemaVersion": 2, "layers": [{"digest": "sha256:base"}]}`)
+		case r.Method == "HEAD" && r.URL.Path == "/v2/debian/manifests/sha256:image":
+			w.Header().Set("Content-Length", "42")
+		case r.Method == "HEAD" && strings.HasPrefix(r.URL.Path, "/v2/debian/blobs/"):
+			// Every blob already exists.
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/v2/debian/manifests/"):
+			manifest, _ := ioutil.ReadAll(r.Body)
+			referrers = append(referrers, manifest)
+			w.Header().Set("OCI-Subject", "sha256:image")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var updated []database.WatchedTag
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			return database.Layer{}, nil
+		},
+		FctUpdateWatchedTag: func(watchedTag database.WatchedTag) error {
+			updated = append(updated, watchedTag)
+			return nil
+		},
+		FctInsertImage: func(image database.Image) error { return nil },
+	}
+	tr := &tracker{
+		datastore: datastore,
+		config:    &config.TrackerConfig{Registries: map[string]config.RegistryConfig{server.URL: {Publish: true}}},
+		clients:   make(map[string]*registry.Client),
+	}
+
+	if assert.Nil(t, tr.track(database.WatchedTag{Registry: server.URL, Repository: "debian", Tag: "latest"})) && assert.Len(t, updated, 1) {
+		assert.NotEmpty(t, updated[0].Published)
+		if assert.Len(t, referrers, 1) {
+			assert.Contains(t, string(referrers[0]), ReportArtifactType)
+		}
+	}
+
+	// The report didn't change: it isn't published again.
+	if assert.Nil(t, tr.track(updated[0])) {
+		assert.Len(t, referrers, 1)
+	}
+}
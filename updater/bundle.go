@@ -0,0 +1,234 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updater
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/coreos/clair/bundle"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/registry"
+)
+
+const (
+	defaultBundleTimeout = 10 * time.Minute
+
+	// bundleBatchSize is the number of vulnerabilities of a bundle inserted at once.
+	bundleBatchSize = 1000
+
+	// maxSignatureSize bounds the size of the signatures of the bundles.
+	maxSignatureSize = 4096
+)
+
+var (
+	// bundleTransport is the transport of the downloads of the bundles, which tests replace.
+	bundleTransport http.RoundTripper = http.DefaultTransport
+
+	promUpdaterBundleVulnerabilitiesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_updater_bundle_vulnerabilities_total",
+		Help: "Number of vulnerabilities that have been imported from a bundle.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(promUpdaterBundleVulnerabilitiesTotal)
+}
+
+// importBundle initializes the database, which has never been updated, with the vulnerabilities of
+// the configured bundle, once its signature is verified. The time of the last update becomes the
+// creation time of the bundle, so that the next update brings the database up to date. It returns
+// whether the bundle has been imported.
+func importBundle(datastore database.Datastore, config *config.UpdaterConfig) bool {
+	if config.Bundle == nil || config.Bundle.URL == "" {
+		return false
+	}
+
+	log.Infof("importing vulnerability bundle %s", config.Bundle.URL)
+	start := time.Now()
+
+	// The vulnerabilities are inserted without notification, as no layer can be affected yet.
+	header, count, err := fetchBundle(datastore, config, "", false, nil)
+	if err != nil {
+		promUpdaterErrorsTotal.Inc()
+		log.Errorf("could not import vulnerability bundle, falling back to a full update: %s", err)
+		return false
+	}
+
+	if err := datastore.InsertKeyValue(flagName, strconv.FormatInt(header.Created.UTC().Unix(), 10)); err != nil {
+		promUpdaterErrorsTotal.Inc()
+		log.Errorf("could not store the time of the vulnerability bundle: %s", err)
+		return false
+	}
+
+	log.Infof("imported %d vulnerabilities of bundle %s, created %v, in %v", count, header.Version, header.Created, time.Since(start))
+	return true
+}
+
+// fetchBundle downloads the configured bundle and its signature, verifies it, then inserts its
+// vulnerabilities, except the ones of the pruned namespaces. Nothing is inserted unless the
+// signature is valid, nor if the bundle has the given last version.
+func fetchBundle(datastore database.Datastore, config *config.UpdaterConfig, lastVersion string, createNotification bool, pruned map[string]struct{}) (bundle.Header, int, error) {
+	keys, err := bundleKeys(config.Bundle.Keys)
+	if err != nil {
+		return bundle.Header{}, 0, err
+	}
+
+	signatureURL := config.Bundle.SignatureURL
+	if signatureURL == "" {
+		signatureURL = config.Bundle.URL + ".sig"
+	}
+	timeout := config.Bundle.Timeout
+	if timeout == 0 {
+		timeout = defaultBundleTimeout
+	}
+	client := &http.Client{Transport: bundleTransport, Timeout: timeout}
+
+	// The bundle is stored in a temporary file while its digest is computed, so that it is only
+	// read once its signature is verified.
+	f, err := ioutil.TempFile("", "clair-bundle-")
+	if err != nil {
+		return bundle.Header{}, 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+	if err := download(client, config.Bundle.URL, io.MultiWriter(f, hash), -1); err != nil {
+		return bundle.Header{}, 0, err
+	}
+
+	var signature bytes.Buffer
+	if err := download(client, signatureURL, &signature, maxSignatureSize); err != nil {
+		return bundle.Header{}, 0, err
+	}
+	if !bundle.Verify(hash.Sum(nil), signature.Bytes(), keys) {
+		return bundle.Header{}, 0, errors.New("the signature of the bundle isn't valid")
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return bundle.Header{}, 0, err
+	}
+	reader, err := bundle.NewReader(f)
+	if err != nil {
+		return bundle.Header{}, 0, err
+	}
+	if lastVersion != "" && reader.Header.Version == lastVersion {
+		return reader.Header, 0, nil
+	}
+
+	var count int
+	batch := make([]database.Vulnerability, 0, bundleBatchSize)
+	insert := func() error {
+		batch = filterNamespaces(batch, config.Namespaces)
+		batch = filterArchivedNamespaces(batch, config.ArchivedNamespaces)
+		batch = filterPrunedNamespaces(batch, pruned)
+		if err := datastore.InsertVulnerabilities(batch, createNotification); err != nil {
+			return err
+		}
+		count += len(batch)
+		promUpdaterBundleVulnerabilitiesTotal.Add(float64(len(batch)))
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		vulnerability, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return reader.Header, count, err
+		}
+
+		batch = append(batch, vulnerability)
+		if len(batch) == bundleBatchSize {
+			if err := insert(); err != nil {
+				return reader.Header, count, err
+			}
+		}
+	}
+	if err := insert(); err != nil {
+		return reader.Header, count, err
+	}
+
+	return reader.Header, count, nil
+}
+
+// bundleKeys reads the public keys trusted to sign the bundles.
+func bundleKeys(paths []string) ([]*ecdsa.PublicKey, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no public key is configured to verify the bundle")
+	}
+
+	var keys []*ecdsa.PublicKey
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := registry.ParsePublicKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse public keys %s: %s", path, err)
+		}
+		keys = append(keys, parsed...)
+	}
+	return keys, nil
+}
+
+// download copies the body of the given HTTPS URL to w, failing if it is larger than max bytes,
+// unless max is negative.
+func download(client *http.Client, rawURL string, w io.Writer, max int64) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("%s isn't an HTTPS URL", rawURL)
+	}
+
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not download %s: %s", rawURL, resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+	if max >= 0 {
+		body = io.LimitReader(resp.Body, max+1)
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return err
+	}
+	if max >= 0 && n > max {
+		return fmt.Errorf("%s is larger than %d bytes", rawURL, max)
+	}
+	return nil
+}
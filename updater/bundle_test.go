@@ -0,0 +1,130 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updater
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/attestation"
+	"github.com/coreos/clair/bundle"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+func TestImportBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clair-bundle")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Sign a bundle of two namespaces.
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	signer, err := attestation.NewSigner(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if !assert.Nil(t, err) {
+		return
+	}
+	publicDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	keyPath := filepath.Join(dir, "bundle.pub")
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0600)
+
+	created := time.Unix(1476705600, 0).UTC()
+	var content bytes.Buffer
+	w, _ := bundle.NewWriter(&content, bundle.Header{Version: "20161017", Created: created})
+	w.Write(database.Vulnerability{Name: "CVE-1", Namespace: database.Namespace{Name: "debian:8"}})
+	w.Write(database.Vulnerability{Name: "CVE-2", Namespace: database.Namespace{Name: "centos:7"}})
+	w.Close()
+	signature, _ := signer.SignBlob(w.Digest())
+
+	var tampered bool
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vulnerabilities.ndjson.gz":
+			data := content.Bytes()
+			if tampered {
+				data = append([]byte(nil), data...)
+				data[len(data)-1] ^= 0xff
+			}
+			rw.Write(data)
+		case "/vulnerabilities.ndjson.gz.sig":
+			rw.Write(signature)
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+	defer server.Close()
+	defer func(transport http.RoundTripper) { bundleTransport = transport }(bundleTransport)
+	bundleTransport = server.Client().Transport
+
+	flags := map[string]string{}
+	var inserted []database.Vulnerability
+	datastore := &database.MockDatastore{
+		FctInsertVulnerabilities: func(vulnerabilities []database.Vulnerability, createNotification bool) error {
+			assert.False(t, createNotification)
+			inserted = append(inserted, vulnerabilities...)
+			return nil
+		},
+		FctInsertKeyValue: func(key, value string) error {
+			flags[key] = value
+			return nil
+		},
+	}
+	cfg := &config.UpdaterConfig{
+		Namespaces: []string{"debian:*"},
+		Bundle: &config.BundleConfig{
+			URL:  server.URL + "/vulnerabilities.ndjson.gz",
+			Keys: []string{keyPath},
+		},
+	}
+
+	// The vulnerabilities of the configured namespaces are imported, and the update resumes from
+	// the creation of the bundle.
+	if assert.True(t, importBundle(datastore, cfg)) && assert.Len(t, inserted, 1) {
+		assert.Equal(t, "CVE-1", inserted[0].Name)
+		assert.Equal(t, "1476705600", flags[flagName])
+	}
+
+	// Nothing is imported from a tampered bundle, over HTTP or without key.
+	inserted, flags = nil, map[string]string{}
+	tampered = true
+	assert.False(t, importBundle(datastore, cfg))
+	tampered = false
+
+	cfg.Bundle.URL = strings.Replace(cfg.Bundle.URL, "https://", "http://", 1)
+	assert.False(t, importBundle(datastore, cfg))
+	cfg.Bundle.URL = server.URL + "/vulnerabilities.ndjson.gz"
+
+	cfg.Bundle.Keys = nil
+	assert.False(t, importBundle(datastore, cfg))
+
+	assert.Empty(t, inserted)
+	assert.Empty(t, flags)
+}
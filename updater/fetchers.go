@@ -14,7 +14,10 @@
 
 package updater
 
-import "github.com/coreos/clair/database"
+import (
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
 
 var fetchers = make(map[string]Fetcher)
 
@@ -28,12 +31,31 @@ type Fetcher interface {
 	Clean()
 }
 
+// ConfigurableFetcher is a Fetcher that needs a configuration, e.g. the URLs of the feeds it
+// fetches.
+type ConfigurableFetcher interface {
+	Fetcher
+
+	// Configure attempts to initialize the fetcher with the provided configuration.
+	// It returns whether the fetcher is enabled or not.
+	Configure(*config.UpdaterConfig) (bool, error)
+}
+
 // FetcherResponse represents the sum of results of an update.
 type FetcherResponse struct {
 	FlagName        string
 	FlagValue       string
 	Notes           []string
 	Vulnerabilities []database.Vulnerability
+
+	// Source is the feed from which the Vulnerabilities have been fetched. It is recorded on each
+	// of them so their attribution and license can be exposed.
+	Source database.VulnerabilitySource
+
+	// FalsePositives are the findings that the feed states are not affected, e.g. because the
+	// vulnerable code of a package isn't used by the image of a vendor. They are flagged unless
+	// they already are, so that the reports annotate or exclude them.
+	FalsePositives []database.FalsePositive
 }
 
 // RegisterFetcher makes a Fetcher available by the provided name.
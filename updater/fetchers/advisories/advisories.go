@@ -0,0 +1,437 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package advisories implements a vulnerability Fetcher using the advisories that operators
+// maintain in a directory of YAML or JSON files, e.g. about in-house packages, typically synced
+// from a git repository.
+package advisories
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+	"gopkg.in/yaml.v2"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/updater"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+const (
+	updaterFlag = "advisoriesUpdater"
+
+	// defaultSourceName attributes the vulnerabilities when the configuration doesn't.
+	defaultSourceName = "Internal advisories"
+
+	maxFileSize = 16 * 1024 * 1024 // 16 MiB
+)
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/advisories")
+
+// Config is the configuration of the directory of advisories.
+type Config struct {
+	// Directory is searched recursively for .yaml, .yml and .json files, skipping the hidden ones
+	// such as .git.
+	Directory string
+
+	// Source attributes the vulnerabilities, e.g. to the security team maintaining them.
+	Source database.VulnerabilitySource
+}
+
+// file is an advisory file, which describes any number of vulnerabilities.
+type file struct {
+	Vulnerabilities []advisory `yaml:"vulnerabilities"`
+}
+
+type advisory struct {
+	Name          string                 `yaml:"name"`
+	Namespace     string                 `yaml:"namespace"`
+	VersionFormat string                 `yaml:"versionformat"`
+	Severity      string                 `yaml:"severity"`
+	Description   string                 `yaml:"description"`
+	Link          string                 `yaml:"link"`
+	Metadata      map[string]interface{} `yaml:"metadata"`
+	FixedIn       []fix                  `yaml:"fixedin"`
+}
+
+// fix is a feature fixed in a version of the namespace and version format of its vulnerability,
+// unless it sets its own. A missing version means that no version fixes the vulnerability yet.
+type fix struct {
+	Name          string `yaml:"name"`
+	Namespace     string `yaml:"namespace"`
+	VersionFormat string `yaml:"versionformat"`
+	Version       string `yaml:"version"`
+}
+
+// The keys of the advisory files, which are rejected if they have others, e.g. misspelled ones.
+var (
+	fileKeys     = []string{"vulnerabilities"}
+	advisoryKeys = []string{"name", "namespace", "versionformat", "severity", "description", "link", "metadata", "fixedin"}
+	fixKeys      = []string{"name", "namespace", "versionformat", "version"}
+)
+
+type fetcher struct {
+	config Config
+}
+
+func init() {
+	updater.RegisterFetcher("advisories", &fetcher{})
+}
+
+// Configure enables the fetcher if a directory of advisories is configured.
+func (f *fetcher) Configure(config *config.UpdaterConfig) (bool, error) {
+	if config == nil {
+		return false, nil
+	}
+	var c Config
+	if ok, err := config.DecodeParams("advisories", &c); !ok || err != nil {
+		return false, err
+	}
+	if c.Directory == "" {
+		return false, nil
+	}
+	if info, err := os.Stat(c.Directory); err != nil || !info.IsDir() {
+		return false, fmt.Errorf("could not find the directory of advisories %s", c.Directory)
+	}
+	if c.Source.Name == "" {
+		c.Source.Name = defaultSourceName
+	}
+
+	f.config = c
+	return true, nil
+}
+
+// FetchUpdate reads the advisories of the directory. They are merged only once every file is
+// valid, so that a mistake doesn't withdraw the fixes of the others.
+func (f *fetcher) FetchUpdate(datastore database.Datastore) (resp updater.FetcherResponse, err error) {
+	log.Infof("reading the advisories of %s", f.config.Directory)
+
+	files, err := readFiles(f.config.Directory)
+	if err != nil {
+		log.Errorf("could not read the advisories of %s: %s", f.config.Directory, err)
+		return resp, cerrors.ErrFilesystem
+	}
+
+	latestHash, err := datastore.GetKeyValue(updaterFlag)
+	if err != nil {
+		return resp, err
+	}
+
+	resp, err = buildResponse(files, latestHash)
+	if err != nil {
+		return resp, err
+	}
+	resp.Source = f.config.Source
+
+	return resp, nil
+}
+
+// readFiles returns the contents of the advisory files of the directory, by path relative to it.
+func readFiles(directory string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != directory && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || !isAdvisoryFile(path) {
+			return nil
+		}
+		if info.Size() > maxFileSize {
+			return fmt.Errorf("%s is bigger than %d bytes", path, maxFileSize)
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = content
+		return nil
+	})
+	return files, err
+}
+
+func isAdvisoryFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+func buildResponse(files map[string][]byte, latestKnownHash string) (resp updater.FetcherResponse, err error) {
+	hash := latestKnownHash
+
+	// Defer the addition of flag information to the response.
+	defer func() {
+		if err == nil {
+			resp.FlagName = updaterFlag
+			resp.FlagValue = hash
+		}
+	}()
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Skip updating if the advisories haven't changed since the last update.
+	sha := sha1.New()
+	for _, name := range names {
+		io.WriteString(sha, name+"\x00")
+		sha.Write(files[name])
+	}
+	hash = hex.EncodeToString(sha.Sum(nil))
+	if latestKnownHash == hash {
+		log.Debug("no advisories update")
+		return resp, nil
+	}
+
+	seen := make(map[string]string)
+	for _, name := range names {
+		vulnerabilities, err := parseFile(files[name])
+		if err != nil {
+			log.Errorf("invalid advisory file %s: %s", name, err)
+			return resp, cerrors.ErrCouldNotParse
+		}
+
+		// The vulnerabilities are split by the namespaces of their fixes, so a vulnerability may
+		// only be described once per namespace.
+		for _, vulnerability := range vulnerabilities {
+			keys := make(map[string]struct{})
+			for _, fv := range vulnerability.FixedIn {
+				key := fv.Feature.Namespace.Name + ":" + vulnerability.Name
+				if other, ok := seen[key]; ok {
+					log.Errorf("invalid advisory file %s: vulnerability %s of %s is also described by %s", name, vulnerability.Name, fv.Feature.Namespace.Name, other)
+					return resp, cerrors.ErrCouldNotParse
+				}
+				keys[key] = struct{}{}
+			}
+			for key := range keys {
+				seen[key] = name
+			}
+		}
+		resp.Vulnerabilities = append(resp.Vulnerabilities, vulnerabilities...)
+	}
+
+	return resp, nil
+}
+
+// parseFile validates an advisory file and returns the vulnerabilities it describes.
+func parseFile(content []byte) ([]database.Vulnerability, error) {
+	if err := checkSchema(content); err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err := yaml.Unmarshal(content, &f); err != nil {
+		return nil, err
+	}
+
+	var vulnerabilities []database.Vulnerability
+	for i, adv := range f.Vulnerabilities {
+		vulnerability, err := parseAdvisory(adv)
+		if err != nil {
+			if adv.Name != "" {
+				return nil, fmt.Errorf("vulnerability %s: %s", adv.Name, err)
+			}
+			return nil, fmt.Errorf("vulnerability #%d: %s", i+1, err)
+		}
+		vulnerabilities = append(vulnerabilities, vulnerability)
+	}
+	return vulnerabilities, nil
+}
+
+// parseAdvisory validates an advisory and returns the vulnerability it describes.
+func parseAdvisory(adv advisory) (database.Vulnerability, error) {
+	switch {
+	case adv.Name == "":
+		return database.Vulnerability{}, errors.New("missing name")
+	case len(adv.FixedIn) == 0:
+		return database.Vulnerability{}, errors.New("missing fixedin")
+	}
+
+	severity := types.Unknown
+	if adv.Severity != "" {
+		severity = types.Priority(adv.Severity)
+		if !severity.IsValid() {
+			return database.Vulnerability{}, fmt.Errorf("invalid severity %s", adv.Severity)
+		}
+	}
+
+	// The namespace of the vulnerability is the one of its fixes.
+	vulnerability := database.Vulnerability{
+		Name:        adv.Name,
+		Description: adv.Description,
+		Link:        adv.Link,
+		Severity:    severity,
+	}
+	if len(adv.Metadata) > 0 {
+		vulnerability.Metadata = database.MetadataMap(stringKeys(adv.Metadata).(map[string]interface{}))
+	}
+
+	for _, fx := range adv.FixedIn {
+		if fx.Name == "" {
+			return database.Vulnerability{}, errors.New("a fix is missing its name")
+		}
+		if fx.Namespace == "" {
+			fx.Namespace = adv.Namespace
+		}
+		if fx.VersionFormat == "" {
+			fx.VersionFormat = adv.VersionFormat
+		}
+		if fx.Namespace == "" {
+			return database.Vulnerability{}, fmt.Errorf("fix %s: missing namespace", fx.Name)
+		}
+
+		version := versionfmt.MaxVersion
+		if fx.Version != "" && fx.Version != "None" {
+			if err := versionfmt.Valid(fx.VersionFormat, fx.Version); err != nil {
+				return database.Vulnerability{}, fmt.Errorf("fix %s: %s %s: %s", fx.Name, fx.VersionFormat, fx.Version, err)
+			}
+			version = fx.Version
+		} else if _, ok := versionfmt.GetParser(fx.VersionFormat); !ok {
+			return database.Vulnerability{}, fmt.Errorf("fix %s: unknown version format %q", fx.Name, fx.VersionFormat)
+		}
+
+		vulnerability.FixedIn = append(vulnerability.FixedIn, database.FeatureVersion{
+			Feature: database.Feature{
+				Name:      fx.Name,
+				Namespace: database.Namespace{Name: fx.Namespace, VersionFormat: fx.VersionFormat},
+			},
+			Version: version,
+		})
+	}
+
+	return vulnerability, nil
+}
+
+// stringKeys converts the maps decoded from YAML, whose keys may be of any type, to maps that can
+// be encoded as JSON.
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = stringKeys(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = stringKeys(value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, value := range v {
+			l[i] = stringKeys(value)
+		}
+		return l
+	default:
+		return value
+	}
+}
+
+// checkSchema rejects the advisory files having unknown keys or values of the wrong kind, which
+// the decoding would otherwise ignore.
+func checkSchema(content []byte) error {
+	var root interface{}
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return err
+	}
+
+	doc, err := checkKeys(root, "the file", fileKeys)
+	if err != nil {
+		return err
+	}
+	advisories, ok := doc["vulnerabilities"].([]interface{})
+	if !ok {
+		return errors.New("vulnerabilities must be a list")
+	}
+	for i, a := range advisories {
+		adv, err := checkKeys(a, fmt.Sprintf("vulnerability #%d", i+1), advisoryKeys)
+		if err != nil {
+			return err
+		}
+		if metadata, ok := adv["metadata"]; ok {
+			if _, ok := metadata.(map[interface{}]interface{}); !ok {
+				return fmt.Errorf("the metadata of vulnerability #%d must be a map", i+1)
+			}
+		}
+		if fixedIn, ok := adv["fixedin"]; ok {
+			fixes, ok := fixedIn.([]interface{})
+			if !ok {
+				return fmt.Errorf("the fixedin of vulnerability #%d must be a list", i+1)
+			}
+			for j, fx := range fixes {
+				if _, err := checkKeys(fx, fmt.Sprintf("fix #%d of vulnerability #%d", j+1, i+1), fixKeys); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkKeys returns the node as a map if it is one having only the given keys.
+func checkKeys(node interface{}, what string, keys []string) (map[string]interface{}, error) {
+	m, ok := node.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a map", what)
+	}
+
+	checked := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		key, ok := k.(string)
+		if !ok || !contains(keys, key) {
+			return nil, fmt.Errorf("%s has an unknown key %v", what, k)
+		}
+		checked[key] = v
+	}
+	return checked, nil
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fetcher) Clean() {}
@@ -0,0 +1,118 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package advisories
+
+import (
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	_ "github.com/coreos/clair/ext/versionfmt/dpkg"
+	_ "github.com/coreos/clair/ext/versionfmt/semver"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestAdvisoriesParser(t *testing.T) {
+	_, filename, _, _ := runtime.Caller(0)
+	files, err := readFiles(filepath.Join(filepath.Dir(filename), "testdata"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Only the advisory files are read, and the hidden directories are skipped.
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"acme/daemon.yaml", "tools.json"}, names)
+
+	resp, err := buildResponse(files, "")
+	if !assert.Nil(t, err) || !assert.Len(t, resp.Vulnerabilities, 3) {
+		return
+	}
+	assert.Equal(t, updaterFlag, resp.FlagName)
+	assert.NotEmpty(t, resp.FlagValue)
+
+	vulnerability := resp.Vulnerabilities[0]
+	assert.Equal(t, "ACME-2016-0001", vulnerability.Name)
+	assert.Equal(t, types.High, vulnerability.Severity)
+	assert.Equal(t, "https://security.example.com/ACME-2016-0001", vulnerability.Link)
+	assert.Equal(t, database.MetadataMap{"ACME": map[string]interface{}{"Team": "platform", "Ticket": "SEC-42"}}, vulnerability.Metadata)
+	assert.Equal(t, []database.FeatureVersion{
+		{
+			Feature: database.Feature{Name: "acme-daemon", Namespace: database.Namespace{Name: "debian:8", VersionFormat: "dpkg"}},
+			Version: "1.2-1",
+		},
+		{
+			Feature: database.Feature{Name: "acme-daemon", Namespace: database.Namespace{Name: "debian:9", VersionFormat: "dpkg"}},
+			Version: "1.3-1",
+		},
+	}, vulnerability.FixedIn)
+
+	// The severity is optional, and a fix without version means that none fixes the
+	// vulnerability yet.
+	vulnerability = resp.Vulnerabilities[1]
+	assert.Equal(t, types.Unknown, vulnerability.Severity)
+	if assert.Len(t, vulnerability.FixedIn, 1) {
+		assert.Equal(t, versionfmt.MaxVersion, vulnerability.FixedIn[0].Version)
+	}
+
+	// JSON files are supported as well.
+	vulnerability = resp.Vulnerabilities[2]
+	assert.Equal(t, "ACME-2016-0003", vulnerability.Name)
+	if assert.Len(t, vulnerability.FixedIn, 1) {
+		assert.Equal(t, database.Namespace{Name: "crates.io", VersionFormat: "semver"}, vulnerability.FixedIn[0].Feature.Namespace)
+	}
+
+	// Nothing is updated if the advisories haven't changed.
+	resp, err = buildResponse(files, resp.FlagValue)
+	if assert.Nil(t, err) {
+		assert.Empty(t, resp.Vulnerabilities)
+	}
+}
+
+func TestAdvisoriesValidation(t *testing.T) {
+	for _, invalid := range []string{
+		// Unknown keys, e.g. misspelled ones.
+		`vulnerabilities: [{name: ACME-1, namespace: debian:8, versionformat: dpkg, fixedin: [{name: acme, version: 1.0-1}], severty: High}]`,
+		`vulnerabilities: [{name: ACME-1, namespace: debian:8, versionformat: dpkg, fixedin: [{name: acme, fixed: 1.0-1}]}]`,
+		`vulnerability: []`,
+		// Missing or invalid values.
+		`vulnerabilities: [{namespace: debian:8, versionformat: dpkg, fixedin: [{name: acme}]}]`,
+		`vulnerabilities: [{name: ACME-1, namespace: debian:8, versionformat: dpkg}]`,
+		`vulnerabilities: [{name: ACME-1, versionformat: dpkg, fixedin: [{name: acme}]}]`,
+		`vulnerabilities: [{name: ACME-1, namespace: debian:8, fixedin: [{name: acme}]}]`,
+		`vulnerabilities: [{name: ACME-1, namespace: debian:8, versionformat: dpkg, severity: Severe, fixedin: [{name: acme}]}]`,
+		`vulnerabilities: [{name: ACME-1, namespace: debian:8, versionformat: semver, fixedin: [{name: acme, version: not-a-version}]}]`,
+		`vulnerabilities: [{name: ACME-1, namespace: debian:8, versionformat: dpkg, metadata: [1, 2], fixedin: [{name: acme}]}]`,
+		`vulnerabilities: {name: ACME-1}`,
+		`not: [valid`,
+	} {
+		_, err := parseFile([]byte(invalid))
+		assert.NotNil(t, err, invalid)
+	}
+
+	// A vulnerability may only be described once per namespace.
+	advisory := []byte(`vulnerabilities: [{name: ACME-1, namespace: debian:8, versionformat: dpkg, fixedin: [{name: acme}]}]`)
+	_, err := buildResponse(map[string][]byte{"a.yaml": advisory, "b.yaml": advisory}, "")
+	assert.Equal(t, cerrors.ErrCouldNotParse, err)
+}
@@ -12,16 +12,19 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package alpine implements a vulnerability Fetcher using the alpine-secdb
-// git repository.
+// Package alpine implements a vulnerability Fetcher using the Alpine Linux security database,
+// whose YAML feeds list the security fixes of the packages of every release.
 package alpine
 
 import (
-	"errors"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
+	"net/http"
+	"regexp"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v2"
@@ -30,281 +33,236 @@ import (
 
 	"github.com/coreos/clair/database"
 	"github.com/coreos/clair/ext/versionfmt"
-	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/ext/versionfmt/apk"
 	"github.com/coreos/clair/updater"
-	"github.com/coreos/clair/utils"
 	cerrors "github.com/coreos/clair/utils/errors"
 	"github.com/coreos/clair/utils/types"
 )
 
 const (
-	// When available, this should be updated to use HTTPS.
-	secdbGitURL  = "http://git.alpinelinux.org/cgit/alpine-secdb"
+	secdbURL     = "https://secdb.alpinelinux.org/"
 	updaterFlag  = "alpine-secdbUpdater"
 	nvdURLPrefix = "https://cve.mitre.org/cgi-bin/cvename.cgi?name="
+
+	maxFeedSize = 64 * 1024 * 1024 // 64 MiB
 )
 
-var (
-	// ErrFilesystem is returned when a fetcher fails to interact with the local filesystem.
-	ErrFilesystem = errors.New("updater/fetchers: something went wrong when interacting with the fs")
+// repositories are the repositories of every release whose feeds are fetched, the community one
+// only existing since Alpine 3.5.
+var repositories = []string{"main", "community"}
 
-	// ErrGitFailure is returned when a fetcher fails to interact with git.
-	ErrGitFailure = errors.New("updater/fetchers: something went wrong when interacting with git")
+// releaseRegexp matches the links to the directories of the releases in the index of the
+// security database, e.g. "v3.4/", leaving out "edge".
+var releaseRegexp = regexp.MustCompile(`href="(v[0-9]+\.[0-9]+)/"`)
 
-	log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/alpine")
-)
+// source attributes the vulnerabilities to the Alpine security database.
+var source = database.VulnerabilitySource{Name: "Alpine secdb", URL: secdbURL}
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/alpine")
 
 func init() {
 	updater.RegisterFetcher("alpine", &fetcher{})
 }
 
-type fetcher struct {
-	repositoryLocalPath string
-}
+type fetcher struct{}
 
 func (f *fetcher) FetchUpdate(db database.Datastore) (resp updater.FetcherResponse, err error) {
 	log.Info("fetching Alpine vulnerabilities")
 
-	// Pull the master branch.
-	var commit string
-	commit, err = f.pullRepository()
+	// List the releases.
+	index, err := download(secdbURL)
 	if err != nil {
-		return
+		log.Errorf("could not download the index of the Alpine secdb: %s", err)
+		return resp, cerrors.ErrCouldNotDownload
 	}
 
-	// Ask the database for the latest commit we successfully applied.
-	var dbCommit string
-	dbCommit, err = db.GetKeyValue(updaterFlag)
-	if err != nil {
-		return
+	// Download the feed of every repository of every release.
+	feeds := make(map[string][]byte)
+	for _, match := range releaseRegexp.FindAllSubmatch(index, -1) {
+		release := string(match[1])
+		for _, repository := range repositories {
+			name := release + "/" + repository + ".yaml"
+			if _, ok := feeds[name]; ok {
+				continue
+			}
+			feed, err := download(secdbURL + name)
+			if err == errNotFound {
+				continue
+			}
+			if err != nil {
+				log.Errorf("could not download the Alpine secdb feed %s: %s", name, err)
+				return resp, cerrors.ErrCouldNotDownload
+			}
+			feeds[name] = feed
+		}
 	}
 
-	// Set the updaterFlag to equal the commit processed.
-	resp.FlagName = updaterFlag
-	resp.FlagValue = commit
-
-	// Short-circuit if there have been no updates.
-	if commit == dbCommit {
-		log.Debug("no alpine update")
-		return
+	// Ask the database for the hash of the latest feeds we successfully applied.
+	latestHash, err := db.GetKeyValue(updaterFlag)
+	if err != nil {
+		return resp, err
 	}
 
-	var namespaces []string
-	namespaces, err = detectNamespaces(f.repositoryLocalPath)
-	// Append any changed vulnerabilities to the response.
-	for _, namespace := range namespaces {
-		var vulns []database.Vulnerability
-		var note string
-		vulns, note, err = parseVulnsFromNamespace(f.repositoryLocalPath, namespace)
-		if err != nil {
-			return
-		}
-		if note != "" {
-			resp.Notes = append(resp.Notes, note)
-		}
-		resp.Vulnerabilities = append(resp.Vulnerabilities, vulns...)
+	resp, err = buildResponse(feeds, latestHash)
+	if err != nil {
+		return resp, err
 	}
+	resp.Source = source
 
-	return
+	return resp, nil
 }
 
-func detectNamespaces(path string) ([]string, error) {
-	// Open the root directory.
-	dir, err := os.Open(path)
+var errNotFound = fmt.Errorf("got status code %d", http.StatusNotFound)
+
+// download returns the content at the given URL.
+func download(url string) ([]byte, error) {
+	r, err := http.Get(url)
 	if err != nil {
 		return nil, err
 	}
-	defer dir.Close()
+	defer r.Body.Close()
+	if r.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d", r.StatusCode)
+	}
 
-	// Get a list of the namspaces from the directory names.
-	finfos, err := dir.Readdir(0)
+	content, err := ioutil.ReadAll(io.LimitReader(r.Body, maxFeedSize+1))
 	if err != nil {
 		return nil, err
 	}
-
-	var namespaces []string
-	for _, info := range finfos {
-		if !info.IsDir() {
-			continue
-		}
-		// Filter out hidden directories like `.git`.
-		if strings.HasPrefix(info.Name(), ".") {
-			continue
-		}
-
-		namespaces = append(namespaces, info.Name())
+	if len(content) > maxFeedSize {
+		return nil, fmt.Errorf("feed bigger than %d bytes", maxFeedSize)
 	}
-
-	return namespaces, nil
+	return content, nil
 }
 
-type parserFunc func(io.Reader) ([]database.Vulnerability, error)
+// buildResponse parses the feeds of the security database, keyed by their path, e.g.
+// "v3.4/main.yaml".
+func buildResponse(feeds map[string][]byte, latestKnownHash string) (resp updater.FetcherResponse, err error) {
+	hash := latestKnownHash
 
-var parsers = map[string]parserFunc{
-	"v3.3": parse33YAML,
-	"v3.4": parse34YAML,
-}
+	// Defer the addition of flag information to the response.
+	defer func() {
+		if err == nil {
+			resp.FlagName = updaterFlag
+			resp.FlagValue = hash
+		}
+	}()
 
-func parseVulnsFromNamespace(repositoryPath, namespace string) (vulns []database.Vulnerability, note string, err error) {
-	var file io.ReadCloser
-	file, err = os.Open(repositoryPath + "/" + namespace + "/main.yaml")
-	if err != nil {
-		return
+	// Skip updating if the hash of the feeds has been seen before.
+	names := make([]string, 0, len(feeds))
+	for name := range feeds {
+		names = append(names, name)
 	}
-	defer file.Close()
+	sort.Strings(names)
 
-	parseFunc, exists := parsers[namespace]
-	if !exists {
-		note = fmt.Sprintf("The file %s is not mapped to any Alpine version number", namespace)
-		return
+	sha := sha1.New()
+	for _, name := range names {
+		io.WriteString(sha, name+"\x00")
+		sha.Write(feeds[name])
+	}
+	hash = hex.EncodeToString(sha.Sum(nil))
+	if latestKnownHash == hash {
+		log.Debug("no alpine update")
+		return resp, nil
 	}
 
-	vulns, err = parseFunc(file)
-	return
-}
-
-func (f *fetcher) pullRepository() (commit string, err error) {
-	// If the repository doesn't exist, clone it.
-	if _, pathExists := os.Stat(f.repositoryLocalPath); f.repositoryLocalPath == "" || os.IsNotExist(pathExists) {
-		if f.repositoryLocalPath, err = ioutil.TempDir(os.TempDir(), "alpine-secdb"); err != nil {
-			return "", ErrFilesystem
-		}
-
-		if out, err := utils.Exec(f.repositoryLocalPath, "git", "clone", secdbGitURL, "."); err != nil {
-			f.Clean()
-			log.Errorf("could not pull alpine-secdb repository: %s. output: %s", err, out)
-			return "", cerrors.ErrCouldNotDownload
-		}
-	} else {
-		// The repository exists and it needs to be refreshed via a pull.
-		_, err := utils.Exec(f.repositoryLocalPath, "git", "pull")
+	for _, name := range names {
+		vulns, err := parseSecDB(feeds[name])
 		if err != nil {
-			return "", ErrGitFailure
+			log.Errorf("could not parse the Alpine secdb feed %s: %s", name, err)
+			return resp, cerrors.ErrCouldNotParse
 		}
+		resp.Vulnerabilities = append(resp.Vulnerabilities, vulns...)
 	}
 
-	out, err := utils.Exec(f.repositoryLocalPath, "git", "rev-parse", "HEAD")
-	if err != nil {
-		return "", ErrGitFailure
-	}
-
-	commit = strings.TrimSpace(string(out))
-	return
+	return resp, nil
 }
 
-func (f *fetcher) Clean() {
-	if f.repositoryLocalPath != "" {
-		os.RemoveAll(f.repositoryLocalPath)
-	}
-}
+func (f *fetcher) Clean() {}
 
-type secdb33File struct {
+// secdbFile is a feed of the security database. The feeds of Alpine 3.3 list the fixes of the
+// latest version of every package, while the later ones list the fixes of every version.
+type secdbFile struct {
 	Distro   string `yaml:"distroversion"`
 	Packages []struct {
 		Pkg struct {
-			Name    string   `yaml:"name"`
+			Name string `yaml:"name"`
+
 			Version string   `yaml:"ver"`
 			Fixes   []string `yaml:"fixes"`
+
+			// SecFixes are the vulnerabilities fixed by each version. The vulnerabilities
+			// fixed in version "0" never affected the package.
+			SecFixes map[string][]string `yaml:"secfixes"`
 		} `yaml:"pkg"`
 	} `yaml:"packages"`
 }
 
-func parse33YAML(r io.Reader) (vulns []database.Vulnerability, err error) {
-	var rBytes []byte
-	rBytes, err = ioutil.ReadAll(r)
-	if err != nil {
-		return
+// parseSecDB returns the vulnerabilities of a feed of the security database, in the alpine:vX.Y
+// namespace of its release.
+func parseSecDB(content []byte) (vulns []database.Vulnerability, err error) {
+	var file secdbFile
+	if err = yaml.Unmarshal(content, &file); err != nil {
+		return nil, err
 	}
-
-	var file secdb33File
-	err = yaml.Unmarshal(rBytes, &file)
-	if err != nil {
-		return
+	if !strings.HasPrefix(file.Distro, "v") {
+		return nil, fmt.Errorf("unknown release '%s'", file.Distro)
 	}
+	namespace := database.Namespace{Name: "alpine:" + file.Distro, VersionFormat: apk.ParserName}
+
 	for _, pack := range file.Packages {
 		pkg := pack.Pkg
-		for _, fix := range pkg.Fixes {
-			err = versionfmt.Valid(dpkg.ParserName, pkg.Version)
-			if err != nil {
-				log.Warningf("could not parse package version '%s': %s. skipping", pkg.Version, err.Error())
-				continue
-			}
 
-			vulns = append(vulns, database.Vulnerability{
-				Name:     fix,
-				Severity: types.Unknown,
-				Link:     nvdURLPrefix + fix,
-				FixedIn: []database.FeatureVersion{
-					{
-						Feature: database.Feature{
-							Namespace: database.Namespace{
-								Name:          "alpine:" + file.Distro,
-								VersionFormat: dpkg.ParserName,
-							},
-							Name: pkg.Name,
-						},
-						Version: pkg.Version,
-					},
-				},
-			})
+		fixes := pkg.SecFixes
+		if len(pkg.Fixes) > 0 {
+			fixes = map[string][]string{pkg.Version: pkg.Fixes}
 		}
-	}
-	return
-}
-
-type secdb34File struct {
-	Distro   string `yaml:"distroversion"`
-	Packages []struct {
-		Pkg struct {
-			Name  string              `yaml:"name"`
-			Fixes map[string][]string `yaml:"secfixes"`
-		} `yaml:"pkg"`
-	} `yaml:"packages"`
-}
 
-func parse34YAML(r io.Reader) (vulns []database.Vulnerability, err error) {
-	var rBytes []byte
-	rBytes, err = ioutil.ReadAll(r)
-	if err != nil {
-		return
-	}
-
-	var file secdb34File
-	err = yaml.Unmarshal(rBytes, &file)
-	if err != nil {
-		return
-	}
+		// Sort the versions so that the vulnerabilities are emitted in a stable order.
+		versions := make([]string, 0, len(fixes))
+		for version := range fixes {
+			versions = append(versions, version)
+		}
+		sort.Strings(versions)
 
-	for _, pack := range file.Packages {
-		pkg := pack.Pkg
-		for version, vulnStrs := range pkg.Fixes {
-			err := versionfmt.Valid(dpkg.ParserName, version)
-			if err != nil {
+		for _, version := range versions {
+			fixedIn := version
+			if version == "0" {
+				fixedIn = versionfmt.MinVersion
+			} else if err := versionfmt.Valid(apk.ParserName, version); err != nil {
 				log.Warningf("could not parse package version '%s': %s. skipping", version, err.Error())
 				continue
 			}
 
-			for _, vulnStr := range vulnStrs {
-				var vuln database.Vulnerability
-				vuln.Severity = types.Unknown
-				vuln.Name = vulnStr
-				vuln.Link = nvdURLPrefix + vulnStr
-				vuln.FixedIn = []database.FeatureVersion{
-					{
-						Feature: database.Feature{
-							Namespace: database.Namespace{
-								Name:          "alpine:" + file.Distro,
-								VersionFormat: dpkg.ParserName,
+			for _, fix := range fixes[version] {
+				// A fix may list several identifiers, e.g. "CVE-2017-1000 CVE-2017-1001", and
+				// comments between parentheses.
+				for _, name := range strings.Fields(fix) {
+					if strings.HasPrefix(name, "(") {
+						break
+					}
+
+					vuln := database.Vulnerability{
+						Name:     name,
+						Severity: types.Unknown,
+						FixedIn: []database.FeatureVersion{
+							{
+								Feature: database.Feature{Namespace: namespace, Name: pkg.Name},
+								Version: fixedIn,
 							},
-							Name: pkg.Name,
 						},
-						Version: version,
-					},
+					}
+					if strings.HasPrefix(name, "CVE-") {
+						vuln.Link = nvdURLPrefix + name
+					}
+					vulns = append(vulns, vuln)
 				}
-				vulns = append(vulns, vuln)
 			}
 		}
 	}
 
-	return
+	return vulns, nil
 }
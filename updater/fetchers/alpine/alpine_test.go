@@ -15,46 +15,84 @@
 package alpine
 
 import (
-	"os"
+	"io/ioutil"
 	"path/filepath"
 	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/apk"
 )
 
-func TestAlpine33YAMLParsing(t *testing.T) {
+func readTestFeed(t *testing.T, name string) []byte {
 	_, filename, _, _ := runtime.Caller(0)
-	path := filepath.Join(filepath.Dir(filename))
-
-	testData, _ := os.Open(path + "/testdata/v33_main.yaml")
-	defer testData.Close()
+	content, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filename), "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
 
-	vulns, err := parse33YAML(testData)
+func TestAlpine33YAMLParsing(t *testing.T) {
+	vulns, err := parseSecDB(readTestFeed(t, "v33_main.yaml"))
 	if err != nil {
 		assert.Nil(t, err)
 	}
 	assert.Equal(t, 15, len(vulns))
 	assert.Equal(t, "CVE-2016-2147", vulns[0].Name)
 	assert.Equal(t, "alpine:v3.3", vulns[0].FixedIn[0].Feature.Namespace.Name)
+	assert.Equal(t, apk.ParserName, vulns[0].FixedIn[0].Feature.Namespace.VersionFormat)
 	assert.Equal(t, "busybox", vulns[0].FixedIn[0].Feature.Name)
 	assert.Equal(t, "https://cve.mitre.org/cgi-bin/cvename.cgi?name=CVE-2016-2147", vulns[0].Link)
 }
 
 func TestAlpine34YAMLParsing(t *testing.T) {
-	_, filename, _, _ := runtime.Caller(0)
-	path := filepath.Join(filepath.Dir(filename))
-
-	testData, _ := os.Open(path + "/testdata/v34_main.yaml")
-	defer testData.Close()
-
-	vulns, err := parse34YAML(testData)
+	vulns, err := parseSecDB(readTestFeed(t, "v34_main.yaml"))
 	if err != nil {
 		assert.Nil(t, err)
 	}
-	assert.Equal(t, 105, len(vulns))
+	// Xen fixes list both the CVE and the XSA identifier on the same line.
+	assert.Equal(t, 112, len(vulns))
 	assert.Equal(t, "CVE-2016-5387", vulns[0].Name)
 	assert.Equal(t, "alpine:v3.4", vulns[0].FixedIn[0].Feature.Namespace.Name)
 	assert.Equal(t, "apache2", vulns[0].FixedIn[0].Feature.Name)
 	assert.Equal(t, "https://cve.mitre.org/cgi-bin/cvename.cgi?name=CVE-2016-5387", vulns[0].Link)
 }
+
+func TestAlpineBuildResponse(t *testing.T) {
+	feeds := map[string][]byte{
+		"v3.4/main.yaml":       readTestFeed(t, "v34_main.yaml"),
+		"v3.18/community.yaml": readTestFeed(t, "v318_community.yaml"),
+	}
+
+	response, err := buildResponse(feeds, "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, updaterFlag, response.FlagName)
+	assert.NotEmpty(t, response.FlagValue)
+	assert.Len(t, response.Vulnerabilities, 112+6)
+
+	fixes := make(map[string]database.FeatureVersion)
+	for _, vuln := range response.Vulnerabilities {
+		if vuln.FixedIn[0].Feature.Namespace.Name == "alpine:v3.18" {
+			fixes[vuln.Name] = vuln.FixedIn[0]
+		}
+	}
+	// Packages fixed in version "0" were never affected, and fixes may list several
+	// vulnerabilities.
+	assert.Equal(t, versionfmt.MinVersion, fixes["CVE-2023-28879"].Version)
+	assert.Equal(t, "9.26-r2", fixes["CVE-2019-6116"].Version)
+	assert.Equal(t, "9.26-r2", fixes["CVE-2019-3835"].Version)
+	assert.Equal(t, "4.17.1_p20230620-r0", fixes["XSA-431"].Version)
+	assert.Equal(t, "xen", fixes["XSA-431"].Feature.Name)
+
+	// The same feeds aren't parsed twice.
+	response, err = buildResponse(feeds, response.FlagValue)
+	if assert.Nil(t, err) {
+		assert.Len(t, response.Vulnerabilities, 0)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package amzn implements a vulnerability Fetcher using the Amazon Linux Security Advisories
+// (ALAS) of Amazon Linux 1, 2 and 2023.
+//
+// The ALAS are published by the Amazon Linux Security Center as an RSS feed, which does not list
+// the fixed packages; they are instead read from the updateinfo metadata of the package
+// repositories, which carries the same advisories along with their fixed rpm versions.
+package amzn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/rpm"
+	"github.com/coreos/clair/updater"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+const (
+	alasURL     = "https://alas.aws.amazon.com/"
+	updaterFlag = "amznUpdater"
+
+	maxFeedSize = 128 * 1024 * 1024 // 128 MiB
+)
+
+// release is a release of Amazon Linux whose advisories are fetched.
+type release struct {
+	// Version is the VERSION_ID of the release in /etc/os-release, which names its namespace.
+	Version string
+	// MirrorList lists the mirrors of the repository carrying the updateinfo of the release.
+	MirrorList string
+	// LinkPrefix is the URL under which the pages of the advisories of the release live.
+	LinkPrefix string
+}
+
+var releases = []release{
+	{
+		Version:    "2018.03",
+		MirrorList: "http://repo.us-west-2.amazonaws.com/2018.03/updates/x86_64/mirror.list",
+		LinkPrefix: alasURL,
+	},
+	{
+		Version:    "2",
+		MirrorList: "https://cdn.amazonlinux.com/2/core/latest/x86_64/mirror.list",
+		LinkPrefix: alasURL + "AL2/",
+	},
+	{
+		Version:    "2023",
+		MirrorList: "https://cdn.amazonlinux.com/al2023/core/mirrors/latest/x86_64/mirror.list",
+		LinkPrefix: alasURL + "AL2023/",
+	},
+}
+
+// source attributes the vulnerabilities to the Amazon Linux Security Center.
+var source = database.VulnerabilitySource{Name: "Amazon Linux Security Center", URL: alasURL}
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/amzn")
+
+func init() {
+	updater.RegisterFetcher("amzn", &fetcher{})
+}
+
+type fetcher struct{}
+
+func (f *fetcher) FetchUpdate(db database.Datastore) (resp updater.FetcherResponse, err error) {
+	log.Info("fetching Amazon Linux vulnerabilities")
+
+	// Download the updateinfo of every release.
+	feeds := make(map[string][]byte)
+	for _, r := range releases {
+		feed, err := fetchUpdateInfo(r)
+		if err != nil {
+			log.Errorf("could not download the updateinfo of Amazon Linux %s: %s", r.Version, err)
+			return resp, cerrors.ErrCouldNotDownload
+		}
+		feeds[r.Version] = feed
+	}
+
+	// Ask the database for the hash of the latest feeds we successfully applied.
+	latestHash, err := db.GetKeyValue(updaterFlag)
+	if err != nil {
+		return resp, err
+	}
+
+	resp, err = buildResponse(feeds, latestHash)
+	if err != nil {
+		return resp, err
+	}
+	resp.Source = source
+
+	return resp, nil
+}
+
+func (f *fetcher) Clean() {}
+
+// repoMD is the index of the metadata of a repository.
+type repoMD struct {
+	Data []struct {
+		Type     string `xml:"type,attr"`
+		Location struct {
+			Href string `xml:"href,attr"`
+		} `xml:"location"`
+	} `xml:"data"`
+}
+
+// fetchUpdateInfo returns the decompressed updateinfo of the repository of the given release,
+// found through the first of its mirrors.
+func fetchUpdateInfo(r release) ([]byte, error) {
+	mirrors, err := download(r.MirrorList)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(mirrors))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no mirror in %s", r.MirrorList)
+	}
+	mirror := strings.TrimSuffix(fields[0], "/") + "/"
+
+	content, err := download(mirror + "repodata/repomd.xml")
+	if err != nil {
+		return nil, err
+	}
+	var md repoMD
+	if err := xml.Unmarshal(content, &md); err != nil {
+		return nil, err
+	}
+
+	for _, data := range md.Data {
+		if data.Type != "updateinfo" {
+			continue
+		}
+		content, err := download(mirror + data.Location.Href)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasSuffix(data.Location.Href, ".gz") {
+			return content, nil
+		}
+		gr, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		return readAll(gr)
+	}
+
+	return nil, fmt.Errorf("no updateinfo in %srepodata/repomd.xml", mirror)
+}
+
+// download returns the content at the given URL.
+func download(url string) ([]byte, error) {
+	r, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d", r.StatusCode)
+	}
+	return readAll(r.Body)
+}
+
+// readAll reads the given reader up to maxFeedSize bytes.
+func readAll(r io.Reader) ([]byte, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(r, maxFeedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxFeedSize {
+		return nil, fmt.Errorf("feed bigger than %d bytes", maxFeedSize)
+	}
+	return content, nil
+}
+
+// buildResponse parses the updateinfo of the releases, keyed by their version, e.g. "2".
+func buildResponse(feeds map[string][]byte, latestKnownHash string) (resp updater.FetcherResponse, err error) {
+	hash := latestKnownHash
+
+	// Defer the addition of flag information to the response.
+	defer func() {
+		if err == nil {
+			resp.FlagName = updaterFlag
+			resp.FlagValue = hash
+		}
+	}()
+
+	// Skip updating if the hash of the feeds has been seen before.
+	versions := make([]string, 0, len(feeds))
+	for version := range feeds {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	sha := sha1.New()
+	for _, version := range versions {
+		io.WriteString(sha, version+"\x00")
+		sha.Write(feeds[version])
+	}
+	hash = hex.EncodeToString(sha.Sum(nil))
+	if latestKnownHash == hash {
+		log.Debug("no Amazon Linux update")
+		return resp, nil
+	}
+
+	for _, version := range versions {
+		r, ok := releaseOf(version)
+		if !ok {
+			log.Errorf("unknown Amazon Linux release %s", version)
+			return resp, cerrors.ErrCouldNotParse
+		}
+
+		vulns, err := parseUpdateInfo(r, bytes.NewReader(feeds[version]))
+		if err != nil {
+			log.Errorf("could not parse the updateinfo of Amazon Linux %s: %s", version, err)
+			return resp, cerrors.ErrCouldNotParse
+		}
+		resp.Vulnerabilities = append(resp.Vulnerabilities, vulns...)
+	}
+
+	return resp, nil
+}
+
+func releaseOf(version string) (release, bool) {
+	for _, r := range releases {
+		if r.Version == version {
+			return r, true
+		}
+	}
+	return release{}, false
+}
+
+type updateInfo struct {
+	Updates []update `xml:"update"`
+}
+
+type update struct {
+	Type        string `xml:"type,attr"`
+	ID          string `xml:"id"`
+	Severity    string `xml:"severity"`
+	Description string `xml:"description"`
+	Packages    []struct {
+		Name    string `xml:"name,attr"`
+		Epoch   string `xml:"epoch,attr"`
+		Version string `xml:"version,attr"`
+		Release string `xml:"release,attr"`
+	} `xml:"pkglist>collection>package"`
+}
+
+// parseUpdateInfo returns a vulnerability for every security advisory of the updateinfo of the
+// given release, in the amzn:VERSION_ID namespace of the release.
+func parseUpdateInfo(r release, reader io.Reader) (vulns []database.Vulnerability, err error) {
+	var info updateInfo
+	if err = xml.NewDecoder(reader).Decode(&info); err != nil {
+		return nil, err
+	}
+	namespace := database.Namespace{Name: "amzn:" + r.Version, VersionFormat: rpm.ParserName}
+
+	for _, u := range info.Updates {
+		if u.Type != "security" || u.ID == "" {
+			continue
+		}
+
+		vuln := database.Vulnerability{
+			Name:        u.ID,
+			Link:        r.LinkPrefix + u.ID + ".html",
+			Severity:    priority(u.Severity),
+			Description: strings.Join(strings.Fields(u.Description), " "),
+		}
+
+		// The packages are listed once per architecture.
+		seen := make(map[string]struct{})
+		for _, p := range u.Packages {
+			if _, ok := seen[p.Name]; ok {
+				continue
+			}
+
+			version := p.Version + "-" + p.Release
+			if p.Epoch != "" && p.Epoch != "0" {
+				version = p.Epoch + ":" + version
+			}
+			if err := versionfmt.Valid(rpm.ParserName, version); err != nil {
+				log.Warningf("could not parse package version '%s': %s. skipping", version, err.Error())
+				continue
+			}
+
+			seen[p.Name] = struct{}{}
+			vuln.FixedIn = append(vuln.FixedIn, database.FeatureVersion{
+				Feature: database.Feature{Namespace: namespace, Name: p.Name},
+				Version: version,
+			})
+		}
+
+		if len(vuln.FixedIn) > 0 {
+			vulns = append(vulns, vuln)
+		}
+	}
+
+	return vulns, nil
+}
+
+func priority(severity string) types.Priority {
+	switch strings.ToLower(severity) {
+	case "low":
+		return types.Low
+	case "medium":
+		return types.Medium
+	case "important":
+		return types.High
+	case "critical":
+		return types.Critical
+	default:
+		log.Warningf("could not determine vulnerability priority from: %s.", severity)
+		return types.Unknown
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amzn
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/rpm"
+	"github.com/coreos/clair/utils/types"
+)
+
+func readTestFeed(t *testing.T, name string) []byte {
+	_, filename, _, _ := runtime.Caller(0)
+	content, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filename), "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestAmazonLinux2UpdateInfoParsing(t *testing.T) {
+	_, filename, _, _ := runtime.Caller(0)
+	f, err := os.Open(filepath.Join(filepath.Dir(filename), "testdata", "al2_updateinfo.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, _ := releaseOf("2")
+	vulns, err := parseUpdateInfo(r, f)
+	if !assert.Nil(t, err) || !assert.Len(t, vulns, 2) {
+		return
+	}
+
+	// Bug fixes are left out, and the packages of every architecture are merged.
+	assert.Equal(t, "ALAS2-2023-1908", vulns[0].Name)
+	assert.Equal(t, "https://alas.aws.amazon.com/AL2/ALAS2-2023-1908.html", vulns[0].Link)
+	assert.Equal(t, types.Medium, vulns[0].Severity)
+	assert.Contains(t, vulns[0].Description, "CVE-2022-43552: A use after free vulnerability exists in curl.")
+	expectedFeatureVersions := []database.FeatureVersion{
+		{
+			Feature: database.Feature{
+				Namespace: database.Namespace{Name: "amzn:2", VersionFormat: rpm.ParserName},
+				Name:      "curl",
+			},
+			Version: "8.0.1-1.amzn2.0.3",
+		},
+		{
+			Feature: database.Feature{
+				Namespace: database.Namespace{Name: "amzn:2", VersionFormat: rpm.ParserName},
+				Name:      "libcurl",
+			},
+			Version: "8.0.1-1.amzn2.0.3",
+		},
+	}
+	assert.Equal(t, expectedFeatureVersions, vulns[0].FixedIn)
+
+	assert.Equal(t, "ALAS2-2023-2001", vulns[1].Name)
+	assert.Equal(t, types.High, vulns[1].Severity)
+	if assert.Len(t, vulns[1].FixedIn, 1) {
+		assert.Equal(t, "32:9.11.4-26.P2.amzn2.13", vulns[1].FixedIn[0].Version)
+	}
+}
+
+func TestAmazonLinuxBuildResponse(t *testing.T) {
+	feeds := map[string][]byte{
+		"2018.03": readTestFeed(t, "al1_updateinfo.xml"),
+		"2":       readTestFeed(t, "al2_updateinfo.xml"),
+		"2023":    readTestFeed(t, "al2023_updateinfo.xml"),
+	}
+
+	response, err := buildResponse(feeds, "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, updaterFlag, response.FlagName)
+	assert.NotEmpty(t, response.FlagValue)
+	if !assert.Len(t, response.Vulnerabilities, 4) {
+		return
+	}
+
+	vulns := make(map[string]database.Vulnerability)
+	for _, vuln := range response.Vulnerabilities {
+		vulns[vuln.Name] = vuln
+	}
+	al1 := vulns["ALAS-2018-1000"]
+	assert.Equal(t, "https://alas.aws.amazon.com/ALAS-2018-1000.html", al1.Link)
+	assert.Equal(t, types.Low, al1.Severity)
+	if assert.Len(t, al1.FixedIn, 1) {
+		assert.Equal(t, "amzn:2018.03", al1.FixedIn[0].Feature.Namespace.Name)
+		assert.Equal(t, "2.7.1-10.13.amzn1", al1.FixedIn[0].Version)
+	}
+	al2023 := vulns["ALAS2023-2023-181"]
+	assert.Equal(t, "https://alas.aws.amazon.com/AL2023/ALAS2023-2023-181.html", al2023.Link)
+	assert.Equal(t, types.Critical, al2023.Severity)
+	if assert.Len(t, al2023.FixedIn, 2) {
+		assert.Equal(t, "amzn:2023", al2023.FixedIn[0].Feature.Namespace.Name)
+		assert.Equal(t, "1:3.0.8-29.amzn2023.0.6", al2023.FixedIn[0].Version)
+	}
+
+	// The same feeds aren't parsed twice.
+	response, err = buildResponse(feeds, response.FlagValue)
+	if assert.Nil(t, err) {
+		assert.Len(t, response.Vulnerabilities, 0)
+	}
+
+	// Unknown releases are rejected.
+	_, err = buildResponse(map[string][]byte{"1": feeds["2018.03"]}, "")
+	assert.NotNil(t, err)
+}
@@ -39,6 +39,9 @@ const (
 	updaterFlag  = "debianUpdater"
 )
 
+// source attributes the vulnerabilities to the Debian Security Tracker.
+var source = database.VulnerabilitySource{Name: "Debian Security Tracker", URL: cveURLPrefix}
+
 var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/debian")
 
 type jsonData map[string]map[string]jsonVuln
@@ -84,6 +87,7 @@ func (fetcher *DebianFetcher) FetchUpdate(datastore database.Datastore) (resp up
 	if err != nil {
 		return resp, err
 	}
+	resp.Source = source
 
 	return resp, nil
 }
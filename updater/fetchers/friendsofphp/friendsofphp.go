@@ -0,0 +1,245 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package friendsofphp implements a vulnerability Fetcher using the FriendsOfPHP security
+// advisories database, which covers the PHP packages published on Packagist.
+package friendsofphp
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/composer"
+	"github.com/coreos/clair/updater"
+	"github.com/coreos/clair/utils"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+const (
+	url           = "https://github.com/FriendsOfPHP/security-advisories/archive/master.tar.gz"
+	archivePrefix = "security-advisories-master/"
+	updaterFlag   = "friendsofphpUpdater"
+
+	// namespace is the namespace of the Composer packages detected in the layers.
+	namespace = "packagist"
+
+	referencePrefix = "composer://"
+
+	maxAdvisorySize = 1024 * 1024       // 1 MiB
+	maxArchiveSize  = 256 * 1024 * 1024 // 256 MiB
+)
+
+// source attributes the vulnerabilities to the FriendsOfPHP security advisories database.
+var source = database.VulnerabilitySource{Name: "FriendsOfPHP Security Advisories", URL: "https://github.com/FriendsOfPHP/security-advisories", License: "Unlicense"}
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/friendsofphp")
+
+// advisory is an advisory of the database, stored in <vendor>/<package>/<id>.yaml.
+type advisory struct {
+	Title     string `yaml:"title"`
+	Link      string `yaml:"link"`
+	CVE       string `yaml:"cve"`
+	Reference string `yaml:"reference"`
+	Branches  map[string]struct {
+		// Versions are the constraints the affected versions satisfy, e.g. [">=2.0.0", "<2.0.5"].
+		Versions []string `yaml:"versions"`
+	} `yaml:"branches"`
+}
+
+type fetcher struct{}
+
+func init() {
+	updater.RegisterFetcher("friendsofphp", &fetcher{})
+}
+
+// FetchUpdate fetches vulnerability updates from the FriendsOfPHP security advisories database.
+func (f *fetcher) FetchUpdate(datastore database.Datastore) (resp updater.FetcherResponse, err error) {
+	log.Info("fetching FriendsOfPHP vulnerabilities")
+
+	// Download the advisories.
+	r, err := http.Get(url)
+	if err != nil {
+		log.Errorf("could not download the FriendsOfPHP security advisories: %s", err)
+		return resp, cerrors.ErrCouldNotDownload
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		log.Errorf("could not download the FriendsOfPHP security advisories: got status code %d", r.StatusCode)
+		return resp, cerrors.ErrCouldNotDownload
+	}
+
+	// Get the SHA-1 of the latest advisories.
+	latestHash, err := datastore.GetKeyValue(updaterFlag)
+	if err != nil {
+		return resp, err
+	}
+
+	resp, err = buildResponse(r.Body, latestHash)
+	if err != nil {
+		return resp, err
+	}
+	resp.Source = source
+
+	return resp, nil
+}
+
+func buildResponse(archive io.Reader, latestKnownHash string) (resp updater.FetcherResponse, err error) {
+	hash := latestKnownHash
+
+	// Defer the addition of flag information to the response.
+	defer func() {
+		if err == nil {
+			resp.FlagName = updaterFlag
+			resp.FlagValue = hash
+		}
+	}()
+
+	extractor := utils.Extractor{
+		Prefix:         archivePrefix,
+		Files:          []string{""},
+		MaxFileSize:    maxAdvisorySize,
+		MaxArchiveSize: maxArchiveSize,
+	}
+	files, err := extractor.Extract(archive)
+	if err != nil {
+		log.Errorf("could not extract the FriendsOfPHP security advisories: %s", err)
+		return resp, cerrors.ErrCouldNotParse
+	}
+
+	// The advisories are the YAML files of the package directories; the others are the
+	// configuration of the repository.
+	var names []string
+	for name := range files {
+		if strings.Count(name, "/") == 2 && strings.HasSuffix(name, ".yaml") && !strings.HasPrefix(name, ".") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// Hash the advisories rather than the archive, whose bytes may change when it is generated
+	// again, and skip updating if the hash has been seen before.
+	sha := sha1.New()
+	for _, name := range names {
+		io.WriteString(sha, name+"\x00")
+		sha.Write(files[name])
+	}
+	hash = hex.EncodeToString(sha.Sum(nil))
+	if latestKnownHash == hash {
+		log.Debug("no FriendsOfPHP update")
+		return resp, nil
+	}
+
+	// Advisories of the same CVE for several packages make a single vulnerability.
+	vulnerabilities := make(map[string]*database.Vulnerability)
+	for _, name := range names {
+		var adv advisory
+		if err = yaml.Unmarshal(files[name], &adv); err != nil {
+			log.Errorf("could not unmarshal FriendsOfPHP advisory %s: %s", name, err)
+			return resp, cerrors.ErrCouldNotParse
+		}
+
+		if !strings.HasPrefix(adv.Reference, referencePrefix) {
+			continue
+		}
+		pkg := strings.TrimPrefix(adv.Reference, referencePrefix)
+
+		// Advisories without CVE are named after their file.
+		vulnName := adv.CVE
+		if vulnName == "" {
+			vulnName = strings.TrimSuffix(name, ".yaml")
+		}
+
+		vulnerability, exists := vulnerabilities[vulnName]
+		if !exists {
+			vulnerability = &database.Vulnerability{
+				Name:        vulnName,
+				Link:        adv.Link,
+				Severity:    types.Unknown,
+				Description: adv.Title,
+			}
+			vulnerabilities[vulnName] = vulnerability
+		}
+
+		// A package can only be fixed once per vulnerability.
+		fixed := false
+		for _, fv := range vulnerability.FixedIn {
+			fixed = fixed || fv.Feature.Name == pkg
+		}
+		if fixed {
+			continue
+		}
+
+		vulnerability.FixedIn = append(vulnerability.FixedIn, database.FeatureVersion{
+			Feature: database.Feature{
+				Name:      pkg,
+				Namespace: database.Namespace{Name: namespace, VersionFormat: composer.ParserName},
+			},
+			Version: fixedVersion(adv),
+		})
+	}
+
+	for _, vulnerability := range vulnerabilities {
+		resp.Vulnerabilities = append(resp.Vulnerabilities, *vulnerability)
+	}
+
+	return resp, nil
+}
+
+// fixedVersion returns the version in which an advisory is fixed. A feature can only be fixed in
+// one version, so the latest fix of its branches is used: versions of older branches that got
+// the fix too are reported as vulnerable rather than the ones of the latest branch as fixed.
+func fixedVersion(adv advisory) string {
+	version := ""
+	for _, branch := range adv.Branches {
+		fixed := ""
+		for _, constraint := range branch.Versions {
+			if strings.HasPrefix(constraint, "<") && !strings.HasPrefix(constraint, "<=") {
+				fixed = strings.TrimSpace(strings.TrimPrefix(constraint, "<"))
+			}
+		}
+
+		// Branches without fix, or whose fix is unknown, affect every version.
+		if fixed == "" {
+			return versionfmt.MaxVersion
+		}
+		if err := versionfmt.Valid(composer.ParserName, fixed); err != nil {
+			log.Warningf("could not parse package version '%s': %s. skipping", fixed, err)
+			return versionfmt.MaxVersion
+		}
+
+		if version == "" {
+			version = fixed
+		} else if cmp, _ := versionfmt.Compare(composer.ParserName, fixed, version); cmp > 0 {
+			version = fixed
+		}
+	}
+
+	if version == "" {
+		return versionfmt.MaxVersion
+	}
+	return version
+}
+
+func (f *fetcher) Clean() {}
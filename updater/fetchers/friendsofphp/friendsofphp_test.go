@@ -0,0 +1,74 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package friendsofphp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/composer"
+	"github.com/coreos/clair/updater/fetchers/testutil"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestFriendsOfPHPParser(t *testing.T) {
+	archive := testutil.TarGz(t, "testdata", archivePrefix)
+
+	response, err := buildResponse(bytes.NewReader(archive), "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, updaterFlag, response.FlagName)
+	assert.NotEmpty(t, response.FlagValue)
+
+	vulnerabilities := make(map[string]database.Vulnerability)
+	for _, vulnerability := range response.Vulnerabilities {
+		vulnerabilities[vulnerability.Name] = vulnerability
+	}
+	if !assert.Len(t, vulnerabilities, 2) {
+		return
+	}
+	pkg := func(name, version string) database.FeatureVersion {
+		return database.FeatureVersion{
+			Feature: database.Feature{Name: name, Namespace: database.Namespace{Name: "packagist", VersionFormat: composer.ParserName}},
+			Version: version,
+		}
+	}
+
+	// The advisories of the same CVE are merged and fixed in their latest branch.
+	cve := vulnerabilities["CVE-2022-24894"]
+	assert.Equal(t, "https://symfony.com/cve-2022-24894", cve.Link)
+	assert.Equal(t, "CVE-2022-24894: Prevent storing cookie headers in HttpCache", cve.Description)
+	assert.Equal(t, types.Unknown, cve.Severity)
+	if assert.Len(t, cve.FixedIn, 2) {
+		assert.Contains(t, cve.FixedIn, pkg("symfony/http-kernel", "6.2.6"))
+		assert.Contains(t, cve.FixedIn, pkg("symfony/symfony", "5.4.20"))
+	}
+
+	// Advisories without CVE are named after their file, and branches without a known fix
+	// affect every version.
+	twig := vulnerabilities["twig/twig/2019-03-12"]
+	assert.Equal(t, []database.FeatureVersion{pkg("twig/twig", versionfmt.MaxVersion)}, twig.FixedIn)
+
+	// The same advisories aren't parsed twice.
+	response, err = buildResponse(bytes.NewReader(archive), response.FlagValue)
+	if assert.Nil(t, err) {
+		assert.Len(t, response.Vulnerabilities, 0)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ghsa implements a vulnerability Fetcher using the GitHub Advisory Database, which covers
+// the packages of several language ecosystems, through its export in the OSV format
+// (https://ossf.github.io/osv-schema) by osv.dev.
+package ghsa
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/nuget"
+	"github.com/coreos/clair/updater"
+	"github.com/coreos/clair/updater/fetchers/osv/schema"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+const (
+	// urlPrefix is followed by the name of an ecosystem and "/all.zip" to get its advisories.
+	urlPrefix = "https://osv-vulnerabilities.storage.googleapis.com/"
+
+	advisoryURLPrefix = "https://github.com/advisories/"
+	updaterFlag       = "ghsaUpdater"
+
+	maxAdvisorySize = 1024 * 1024       // 1 MiB
+	maxArchiveSize  = 256 * 1024 * 1024 // 256 MiB
+)
+
+// ecosystem is an OSV ecosystem whose GitHub advisories are fetched.
+type ecosystem struct {
+	// name is the name of the ecosystem in OSV.
+	name string
+	// namespace is the namespace of the packages of the ecosystem detected in the layers.
+	namespace database.Namespace
+	// normalize returns the name of a package as reported by the detector, if it isn't the
+	// name used by the advisories.
+	normalize func(string) string
+}
+
+var ecosystems = []ecosystem{
+	{
+		name:      "NuGet",
+		namespace: database.Namespace{Name: "nuget", VersionFormat: nuget.ParserName},
+		// Package IDs are case insensitive.
+		normalize: strings.ToLower,
+	},
+}
+
+// source attributes the vulnerabilities to the GitHub Advisory Database.
+var source = database.VulnerabilitySource{Name: "GitHub Advisory Database", URL: "https://github.com/advisories", License: "CC-BY-4.0"}
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/ghsa")
+
+type fetcher struct{}
+
+func init() {
+	updater.RegisterFetcher("ghsa", &fetcher{})
+}
+
+// FetchUpdate fetches vulnerability updates from the GitHub Advisory Database.
+func (f *fetcher) FetchUpdate(datastore database.Datastore) (resp updater.FetcherResponse, err error) {
+	log.Info("fetching GitHub Advisory Database vulnerabilities")
+
+	// Download the advisories of every ecosystem.
+	archives := make(map[string][]byte)
+	for _, e := range ecosystems {
+		if archives[e.name], err = download(urlPrefix + e.name + "/all.zip"); err != nil {
+			log.Errorf("could not download the %s GitHub advisories: %s", e.name, err)
+			return resp, cerrors.ErrCouldNotDownload
+		}
+	}
+
+	// Get the SHA-1 of the latest advisories.
+	latestHash, err := datastore.GetKeyValue(updaterFlag)
+	if err != nil {
+		return resp, err
+	}
+
+	resp, err = buildResponse(archives, latestHash)
+	if err != nil {
+		return resp, err
+	}
+	resp.Source = source
+
+	return resp, nil
+}
+
+// download returns the content at the given URL, which must fit in memory as zip archives can't
+// be streamed.
+func download(url string) ([]byte, error) {
+	r, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d", r.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(r.Body, maxArchiveSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxArchiveSize {
+		return nil, fmt.Errorf("archive bigger than %d bytes", maxArchiveSize)
+	}
+	return content, nil
+}
+
+// buildResponse parses the zip archives of the advisories of the ecosystems, keyed by the name of
+// the ecosystem.
+func buildResponse(archives map[string][]byte, latestKnownHash string) (resp updater.FetcherResponse, err error) {
+	hash := latestKnownHash
+
+	// Defer the addition of flag information to the response.
+	defer func() {
+		if err == nil {
+			resp.FlagName = updaterFlag
+			resp.FlagValue = hash
+		}
+	}()
+
+	// Read the GitHub advisories of every ecosystem.
+	files := make(map[string][]byte)
+	for name, archive := range archives {
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			log.Errorf("could not open the %s GitHub advisories: %s", name, err)
+			return resp, cerrors.ErrCouldNotParse
+		}
+
+		for _, f := range zr.File {
+			if !strings.HasPrefix(f.Name, "GHSA-") || !strings.HasSuffix(f.Name, ".json") {
+				continue
+			}
+			if f.UncompressedSize64 > maxAdvisorySize {
+				log.Warningf("GitHub advisory %s is too big. skipping", f.Name)
+				continue
+			}
+
+			content, err := readFile(f)
+			if err != nil {
+				log.Errorf("could not read GitHub advisory %s: %s", f.Name, err)
+				return resp, cerrors.ErrCouldNotParse
+			}
+			files[name+"/"+f.Name] = content
+		}
+	}
+
+	// Hash the advisories rather than the archives, whose bytes may change when they are
+	// generated again, and skip updating if the hash has been seen before.
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sha := sha1.New()
+	for _, name := range names {
+		io.WriteString(sha, name+"\x00")
+		sha.Write(files[name])
+	}
+	hash = hex.EncodeToString(sha.Sum(nil))
+	if latestKnownHash == hash {
+		log.Debug("no GitHub Advisory Database update")
+		return resp, nil
+	}
+
+	// The same advisory is exported for every ecosystem it affects.
+	seen := make(map[string]struct{})
+	for _, name := range names {
+		var adv schema.Advisory
+		if err = json.Unmarshal(files[name], &adv); err != nil {
+			log.Errorf("could not unmarshal GitHub advisory %s: %s", name, err)
+			return resp, cerrors.ErrCouldNotParse
+		}
+		if _, ok := seen[adv.ID]; ok {
+			continue
+		}
+		seen[adv.ID] = struct{}{}
+
+		if vulnerability, ok := parseAdvisory(adv); ok {
+			resp.Vulnerabilities = append(resp.Vulnerabilities, vulnerability)
+		}
+	}
+
+	return resp, nil
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(io.LimitReader(rc, maxAdvisorySize))
+}
+
+// parseAdvisory returns the vulnerability described by an advisory, if it affects packages of
+// the supported ecosystems.
+func parseAdvisory(adv schema.Advisory) (vulnerability database.Vulnerability, ok bool) {
+	if !strings.HasPrefix(adv.ID, "GHSA-") || adv.Withdrawn != "" {
+		return vulnerability, false
+	}
+
+	vulnerability = adv.Vulnerability(advisoryURLPrefix, "GHSA")
+	vulnerability.FixedIn = adv.FixedIn(func(affected schema.Affected) (database.Feature, bool) {
+		for _, e := range ecosystems {
+			if e.name != affected.Package.Ecosystem {
+				continue
+			}
+			name := affected.Package.Name
+			if e.normalize != nil {
+				name = e.normalize(name)
+			}
+			return database.Feature{Name: name, Namespace: e.namespace}, true
+		}
+		return database.Feature{}, false
+	})
+
+	return vulnerability, len(vulnerability.FixedIn) > 0
+}
+
+func (f *fetcher) Clean() {}
@@ -0,0 +1,82 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ghsa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/nuget"
+	"github.com/coreos/clair/updater/fetchers/testutil"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestGHSAParser(t *testing.T) {
+	archives := map[string][]byte{"NuGet": testutil.Zip(t, "testdata")}
+
+	response, err := buildResponse(archives, "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, updaterFlag, response.FlagName)
+	assert.NotEmpty(t, response.FlagValue)
+
+	// The withdrawn advisories and the ones not from GitHub are ignored.
+	vulnerabilities := make(map[string]database.Vulnerability)
+	for _, vulnerability := range response.Vulnerabilities {
+		vulnerabilities[vulnerability.Name] = vulnerability
+	}
+	if !assert.Len(t, vulnerabilities, 3) {
+		return
+	}
+	pkg := func(name string) database.Feature {
+		return database.Feature{Name: name, Namespace: database.Namespace{Name: "nuget", VersionFormat: nuget.ParserName}}
+	}
+
+	newtonsoft := vulnerabilities["GHSA-5crp-9r3c-p9vr"]
+	assert.Equal(t, "https://github.com/advisories/GHSA-5crp-9r3c-p9vr", newtonsoft.Link)
+	assert.Equal(t, "Improper Handling of Exceptional Conditions in Newtonsoft.Json", newtonsoft.Description)
+	assert.Equal(t, types.High, newtonsoft.Severity)
+	assert.Equal(t, database.MetadataMap{"GHSA": map[string]interface{}{
+		"Aliases": []string{"CVE-2024-21907"},
+		"CVSSv3":  "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:H",
+	}}, newtonsoft.Metadata)
+	assert.Equal(t, &types.CVSS{Vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:H", Score: 7.5}, newtonsoft.CVSS.V3)
+	// Package names are lowercase, as reported by the detector.
+	assert.Equal(t, []database.FeatureVersion{{Feature: pkg("newtonsoft.json"), Version: "13.0.1"}}, newtonsoft.FixedIn)
+
+	// The latest fix is used, and vulnerabilities without fix affect every version.
+	dotnet := vulnerabilities["GHSA-ghhp-997w-qr28"]
+	assert.Equal(t, types.Critical, dotnet.Severity)
+	assert.Equal(t, []database.FeatureVersion{
+		{Feature: pkg("system.text.encodings.web"), Version: "5.0.1"},
+		{Feature: pkg("microsoft.netcore.app.runtime.linux-x64"), Version: versionfmt.MaxVersion},
+	}, dotnet.FixedIn)
+
+	// The release lines of a package listed separately are merged, using the latest fix.
+	netcore := vulnerabilities["GHSA-68w7-72jg-6qpp"]
+	assert.Equal(t, []database.FeatureVersion{
+		{Feature: pkg("microsoft.netcore.app.runtime.linux-arm64"), Version: "8.0.1"},
+	}, netcore.FixedIn)
+
+	// The same advisories aren't parsed twice.
+	response, err = buildResponse(archives, response.FlagValue)
+	if assert.Nil(t, err) {
+		assert.Len(t, response.Vulnerabilities, 0)
+	}
+}
@@ -39,6 +39,9 @@ const (
 	updaterFlag      = "oracleUpdater"
 )
 
+// source attributes the vulnerabilities to the Oracle Linux OVAL definitions.
+var source = database.VulnerabilitySource{Name: "Oracle Linux OVAL", URL: ovalURI}
+
 var (
 	ignoredCriterions = []string{
 		" is signed with the Oracle Linux",
@@ -88,6 +91,7 @@ func init() {
 // FetchUpdate gets vulnerability updates from the Oracle Linux OVAL definitions.
 func (f *OracleFetcher) FetchUpdate(datastore database.Datastore) (resp updater.FetcherResponse, err error) {
 	log.Info("fetching Oracle Linux vulnerabilities")
+	resp.Source = source
 
 	// Get the first ELSA we have to manage.
 	flagValue, err := datastore.GetKeyValue(updaterFlag)
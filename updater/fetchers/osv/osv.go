@@ -0,0 +1,297 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package osv implements a vulnerability Fetcher using the advisories that osv.dev aggregates in
+// the OSV format (https://ossf.github.io/osv-schema) for the packages of the Go, npm and PyPI
+// ecosystems. The crates.io and NuGet advisories are fetched by the rustsec and ghsa fetchers.
+package osv
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/pep440"
+	"github.com/coreos/clair/ext/versionfmt/semver"
+	"github.com/coreos/clair/updater"
+	"github.com/coreos/clair/updater/fetchers/osv/schema"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+const (
+	// urlPrefix is followed by the name of an ecosystem and "/all.zip" to get its advisories.
+	urlPrefix = "https://osv-vulnerabilities.storage.googleapis.com/"
+
+	advisoryURLPrefix = "https://osv.dev/vulnerability/"
+	updaterFlag       = "osvUpdater"
+
+	maxAdvisorySize = 1024 * 1024       // 1 MiB
+	maxArchiveSize  = 512 * 1024 * 1024 // 512 MiB
+)
+
+// ecosystem is an OSV ecosystem whose advisories are fetched.
+type ecosystem struct {
+	// name is the name of the ecosystem in OSV.
+	name string
+	// namespace is the namespace of the packages of the ecosystem.
+	namespace database.Namespace
+	// databases are the prefixes of the IDs of the advisories that are used, from the preferred
+	// database: the advisories that another one aliases are ignored.
+	databases []string
+	// normalize returns the name of a package as reported by the detector, if it isn't the
+	// name used by the advisories.
+	normalize func(string) string
+}
+
+var ecosystems = []ecosystem{
+	{
+		name:      "Go",
+		namespace: database.Namespace{Name: "go", VersionFormat: semver.ParserName},
+		databases: []string{"GO-", "GHSA-"},
+	},
+	{
+		name:      "npm",
+		namespace: database.Namespace{Name: "npm", VersionFormat: semver.ParserName},
+		// The malicious packages of the MAL- advisories are not vulnerabilities.
+		databases: []string{"GHSA-"},
+	},
+	{
+		name:      "PyPI",
+		namespace: database.Namespace{Name: "pypi", VersionFormat: pep440.ParserName},
+		databases: []string{"PYSEC-", "GHSA-"},
+		normalize: normalizePyPI,
+	},
+}
+
+// pypiSeparators are the runs of characters that PEP 503 normalizes to a dash.
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizePyPI returns the normalized name of a Python package, as specified by PEP 503.
+func normalizePyPI(name string) string {
+	return pypiSeparators.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// source attributes the vulnerabilities to osv.dev.
+var source = database.VulnerabilitySource{Name: "OSV", URL: "https://osv.dev", License: "CC-BY-4.0"}
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/osv")
+
+type fetcher struct{}
+
+func init() {
+	updater.RegisterFetcher("osv", &fetcher{})
+}
+
+// FetchUpdate fetches vulnerability updates from osv.dev.
+func (f *fetcher) FetchUpdate(datastore database.Datastore) (resp updater.FetcherResponse, err error) {
+	log.Info("fetching OSV vulnerabilities")
+
+	// Download the advisories of every ecosystem.
+	archives := make(map[string][]byte)
+	for _, e := range ecosystems {
+		if archives[e.name], err = download(urlPrefix + e.name + "/all.zip"); err != nil {
+			log.Errorf("could not download the %s OSV advisories: %s", e.name, err)
+			return resp, cerrors.ErrCouldNotDownload
+		}
+	}
+
+	// Get the SHA-1 of the latest advisories.
+	latestHash, err := datastore.GetKeyValue(updaterFlag)
+	if err != nil {
+		return resp, err
+	}
+
+	resp, err = buildResponse(archives, latestHash)
+	if err != nil {
+		return resp, err
+	}
+	resp.Source = source
+
+	return resp, nil
+}
+
+// download returns the content at the given URL, which must fit in memory as zip archives can't
+// be streamed.
+func download(url string) ([]byte, error) {
+	r, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d", r.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(r.Body, maxArchiveSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxArchiveSize {
+		return nil, fmt.Errorf("archive bigger than %d bytes", maxArchiveSize)
+	}
+	return content, nil
+}
+
+// buildResponse parses the zip archives of the advisories of the ecosystems, keyed by the name of
+// the ecosystem.
+func buildResponse(archives map[string][]byte, latestKnownHash string) (resp updater.FetcherResponse, err error) {
+	hash := latestKnownHash
+
+	// Defer the addition of flag information to the response.
+	defer func() {
+		if err == nil {
+			resp.FlagName = updaterFlag
+			resp.FlagValue = hash
+		}
+	}()
+
+	// Read the advisories of every ecosystem from the databases that are used.
+	files := make(map[string][]byte)
+	for _, e := range ecosystems {
+		archive, ok := archives[e.name]
+		if !ok {
+			continue
+		}
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			log.Errorf("could not open the %s OSV advisories: %s", e.name, err)
+			return resp, cerrors.ErrCouldNotParse
+		}
+
+		for _, f := range zr.File {
+			if e.rank(f.Name) < 0 || !strings.HasSuffix(f.Name, ".json") {
+				continue
+			}
+			if f.UncompressedSize64 > maxAdvisorySize {
+				log.Warningf("OSV advisory %s is too big. skipping", f.Name)
+				continue
+			}
+
+			content, err := readFile(f)
+			if err != nil {
+				log.Errorf("could not read OSV advisory %s: %s", f.Name, err)
+				return resp, cerrors.ErrCouldNotParse
+			}
+			files[e.name+"/"+f.Name] = content
+		}
+	}
+
+	// Hash the advisories rather than the archives, whose bytes may change when they are
+	// generated again, and skip updating if the hash has been seen before.
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sha := sha1.New()
+	for _, name := range names {
+		io.WriteString(sha, name+"\x00")
+		sha.Write(files[name])
+	}
+	hash = hex.EncodeToString(sha.Sum(nil))
+	if latestKnownHash == hash {
+		log.Debug("no OSV update")
+		return resp, nil
+	}
+
+	for _, e := range ecosystems {
+		// Parse the advisories of the preferred databases first, so that the advisories they
+		// alias, e.g. the GitHub advisories of the Go vulnerabilities, are ignored.
+		var advisories []string
+		for _, name := range names {
+			if strings.HasPrefix(name, e.name+"/") {
+				advisories = append(advisories, strings.TrimPrefix(name, e.name+"/"))
+			}
+		}
+		sort.SliceStable(advisories, func(i, j int) bool { return e.rank(advisories[i]) < e.rank(advisories[j]) })
+
+		aliased := make(map[string]struct{})
+		for _, name := range advisories {
+			var adv schema.Advisory
+			if err = json.Unmarshal(files[e.name+"/"+name], &adv); err != nil {
+				log.Errorf("could not unmarshal OSV advisory %s: %s", name, err)
+				return resp, cerrors.ErrCouldNotParse
+			}
+			if _, ok := aliased[adv.ID]; ok {
+				continue
+			}
+
+			if vulnerability, ok := parseAdvisory(adv, e); ok {
+				resp.Vulnerabilities = append(resp.Vulnerabilities, vulnerability)
+				for _, alias := range adv.Aliases {
+					aliased[alias] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// rank returns the index of the database of an advisory, given its ID or file name, in the
+// databases of the ecosystem, or -1 if it isn't used.
+func (e ecosystem) rank(id string) int {
+	for i, prefix := range e.databases {
+		if strings.HasPrefix(id, prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(io.LimitReader(rc, maxAdvisorySize))
+}
+
+// parseAdvisory returns the vulnerability described by an advisory, if it affects packages of
+// the given ecosystem.
+func parseAdvisory(adv schema.Advisory, e ecosystem) (vulnerability database.Vulnerability, ok bool) {
+	if e.rank(adv.ID) < 0 || adv.Withdrawn != "" {
+		return vulnerability, false
+	}
+
+	vulnerability = adv.Vulnerability(advisoryURLPrefix, "OSV")
+	vulnerability.FixedIn = adv.FixedIn(func(affected schema.Affected) (database.Feature, bool) {
+		if affected.Package.Ecosystem != e.name {
+			return database.Feature{}, false
+		}
+		name := affected.Package.Name
+		if e.normalize != nil {
+			name = e.normalize(name)
+		}
+		return database.Feature{Name: name, Namespace: e.namespace}, true
+	})
+
+	return vulnerability, len(vulnerability.FixedIn) > 0
+}
+
+func (f *fetcher) Clean() {}
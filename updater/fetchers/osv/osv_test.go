@@ -0,0 +1,100 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osv
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/pep440"
+	"github.com/coreos/clair/ext/versionfmt/semver"
+	"github.com/coreos/clair/updater/fetchers/testutil"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestOSVParser(t *testing.T) {
+	archives := map[string][]byte{
+		"Go":   testutil.Zip(t, filepath.Join("testdata", "Go")),
+		"npm":  testutil.Zip(t, filepath.Join("testdata", "npm")),
+		"PyPI": testutil.Zip(t, filepath.Join("testdata", "PyPI")),
+	}
+
+	response, err := buildResponse(archives, "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, updaterFlag, response.FlagName)
+	assert.NotEmpty(t, response.FlagValue)
+
+	// The withdrawn advisories, the malicious packages and the GitHub advisories aliased by the
+	// advisories of the Go and PyPI databases are ignored.
+	vulnerabilities := make(map[string]database.Vulnerability)
+	for _, vulnerability := range response.Vulnerabilities {
+		vulnerabilities[vulnerability.Name] = vulnerability
+	}
+	if !assert.Len(t, vulnerabilities, 5) {
+		return
+	}
+	pkg := func(namespace, name string) database.Feature {
+		format := semver.ParserName
+		if namespace == "pypi" {
+			format = pep440.ParserName
+		}
+		return database.Feature{Name: name, Namespace: database.Namespace{Name: namespace, VersionFormat: format}}
+	}
+
+	// The latest fix is used.
+	net := vulnerabilities["GO-2023-1571"]
+	assert.Equal(t, "https://osv.dev/vulnerability/GO-2023-1571", net.Link)
+	assert.Equal(t, "Denial of service via crafted HTTP/2 stream in net/http and golang.org/x/net", net.Description)
+	assert.Equal(t, types.Unknown, net.Severity)
+	assert.Equal(t, database.MetadataMap{"OSV": map[string]interface{}{
+		"Aliases": []string{"CVE-2022-41723", "GHSA-vvpx-j8f3-3w6h"},
+	}}, net.Metadata)
+	assert.Equal(t, []database.FeatureVersion{
+		{Feature: pkg("go", "stdlib"), Version: "1.20.1"},
+		{Feature: pkg("go", "golang.org/x/net"), Version: "0.7.0"},
+	}, net.FixedIn)
+
+	gin := vulnerabilities["GHSA-2c4m-59x9-fr2g"]
+	assert.Equal(t, types.Medium, gin.Severity)
+	assert.Equal(t, []database.FeatureVersion{{Feature: pkg("go", "github.com/gin-gonic/gin"), Version: "1.9.1"}}, gin.FixedIn)
+
+	npm := vulnerabilities["GHSA-c2qf-rxjj-qqgw"]
+	assert.Equal(t, "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:L", npm.Metadata["OSV"].(map[string]interface{})["CVSSv3"])
+	assert.Equal(t, &types.CVSS{Vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:L", Score: 5.3}, npm.CVSS.V3)
+	// Packages whose release lines are listed separately are fixed in the latest one.
+	assert.Equal(t, []database.FeatureVersion{{Feature: pkg("npm", "semver"), Version: "7.5.2"}}, npm.FixedIn)
+
+	// Advisories without summary are described by their details.
+	requests := vulnerabilities["PYSEC-2023-74"]
+	assert.Contains(t, requests.Description, "leaking Proxy-Authorization headers")
+	assert.Equal(t, []database.FeatureVersion{{Feature: pkg("pypi", "requests"), Version: "2.31.0"}}, requests.FixedIn)
+
+	// The names of Python packages are normalized, and vulnerabilities without fix affect every
+	// version.
+	cors := vulnerabilities["GHSA-84pr-m4jr-85g5"]
+	assert.Equal(t, []database.FeatureVersion{{Feature: pkg("pypi", "flask-cors"), Version: versionfmt.MaxVersion}}, cors.FixedIn)
+
+	// The same advisories aren't parsed twice.
+	response, err = buildResponse(archives, response.FlagValue)
+	if assert.Nil(t, err) {
+		assert.Len(t, response.Vulnerabilities, 0)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema parses the advisories in the OSV format (https://ossf.github.io/osv-schema)
+// that the osv, ghsa and rustsec fetchers turn into vulnerabilities.
+package schema
+
+import (
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/utils/types"
+)
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/osv/schema")
+
+// severities maps the severities of the GitHub advisories to the ones of Clair.
+var severities = map[string]types.Priority{
+	"LOW":      types.Low,
+	"MODERATE": types.Medium,
+	"HIGH":     types.High,
+	"CRITICAL": types.Critical,
+}
+
+// Advisory is an advisory in the OSV format.
+type Advisory struct {
+	ID        string     `json:"id"`
+	Withdrawn string     `json:"withdrawn"`
+	Aliases   []string   `json:"aliases"`
+	Summary   string     `json:"summary"`
+	Details   string     `json:"details"`
+	Severity  []Severity `json:"severity"`
+	Affected  []Affected `json:"affected"`
+	// DatabaseSpecific holds the severity that the GitHub advisories rate.
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// Severity is a severity score of an advisory, e.g. a CVSS vector.
+type Severity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+// Affected is a package affected by an advisory, with the ranges of its vulnerable versions.
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges []Range `json:"ranges"`
+	// DatabaseSpecific holds the kind of the RustSec informational advisories.
+	DatabaseSpecific struct {
+		// Informational is the kind of informational advisory, e.g. "unmaintained" or
+		// "unsound", if the advisory isn't about a vulnerability.
+		Informational string `json:"informational"`
+	} `json:"database_specific"`
+}
+
+// Range is a range of versions, delimited by events in the order of the versions.
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event is a version where a package starts or stops being vulnerable.
+type Event struct {
+	Introduced   string `json:"introduced"`
+	Fixed        string `json:"fixed"`
+	LastAffected string `json:"last_affected"`
+}
+
+// Vulnerability returns the vulnerability described by the advisory, without the features it
+// affects. It links to linkPrefix followed by the ID of the advisory, and keeps the aliases and
+// the CVSS vector of the advisory as metadata under metadataKey.
+func (adv Advisory) Vulnerability(linkPrefix, metadataKey string) database.Vulnerability {
+	vulnerability := database.Vulnerability{
+		Name:        adv.ID,
+		Link:        linkPrefix + adv.ID,
+		Severity:    types.Unknown,
+		Description: adv.Summary,
+	}
+	if vulnerability.Description == "" {
+		vulnerability.Description = adv.Details
+	}
+	if severity, ok := severities[adv.DatabaseSpecific.Severity]; ok {
+		vulnerability.Severity = severity
+	}
+
+	metadata := make(map[string]interface{})
+	if len(adv.Aliases) > 0 {
+		metadata["Aliases"] = adv.Aliases
+	}
+	for _, severity := range adv.Severity {
+		if severity.Type == "CVSS_V3" {
+			metadata["CVSSv3"] = severity.Score
+
+			cvss, err := types.ParseCVSSv3(severity.Score)
+			if err != nil {
+				log.Warningf("could not parse the CVSS of advisory %s: %s", adv.ID, err)
+				continue
+			}
+			vulnerability.CVSS.V3 = &cvss
+		}
+	}
+
+	// Set the Severity using the CVSS Score if the advisory doesn't rate it.
+	if score, ok := vulnerability.CVSS.Score(); ok && vulnerability.Severity == types.Unknown {
+		vulnerability.Severity = types.ScorePriority(score)
+	}
+	if len(metadata) > 0 {
+		vulnerability.Metadata = database.MetadataMap{metadataKey: metadata}
+	}
+
+	return vulnerability
+}
+
+// FixedIn returns the features affected by the advisory with the versions fixing them. feature
+// returns the feature of an affected package, if it is one that is fetched.
+//
+// A feature can only be fixed in one version, so the latest fix is used: versions of older
+// release lines that got the fix too are reported as vulnerable rather than the ones of the
+// latest line as fixed. The release lines of a package may be listed separately, and they are
+// merged. Ranges whose last version is known to be affected but which have no fix yet affect
+// every version.
+func (adv Advisory) FixedIn(feature func(Affected) (database.Feature, bool)) []database.FeatureVersion {
+	var fixedIn []database.FeatureVersion
+	features := make(map[string]int)
+	for _, affected := range adv.Affected {
+		f, ok := feature(affected)
+		if !ok {
+			continue
+		}
+
+		version := affected.fixedIn(f.Namespace.VersionFormat)
+		if i, ok := features[f.Name]; ok {
+			fixedIn[i].Version = latest(f.Namespace.VersionFormat, fixedIn[i].Version, version)
+			continue
+		}
+		features[f.Name] = len(fixedIn)
+		fixedIn = append(fixedIn, database.FeatureVersion{Feature: f, Version: version})
+	}
+	return fixedIn
+}
+
+// fixedIn returns the latest version fixing the affected package, or versionfmt.MaxVersion if
+// it isn't fixed.
+func (affected Affected) fixedIn(format string) string {
+	version := ""
+	for _, r := range affected.Ranges {
+		if r.Type != "SEMVER" && r.Type != "ECOSYSTEM" {
+			continue
+		}
+		for _, event := range r.Events {
+			if event.LastAffected != "" {
+				return versionfmt.MaxVersion
+			}
+			if event.Fixed == "" {
+				continue
+			}
+			if err := versionfmt.Valid(format, event.Fixed); err != nil {
+				log.Warningf("could not parse package version '%s': %s. skipping", event.Fixed, err)
+				continue
+			}
+			version = latest(format, version, event.Fixed)
+		}
+	}
+	if version == "" {
+		return versionfmt.MaxVersion
+	}
+	return version
+}
+
+// latest returns the latest of two fixed versions, where an empty version is no fix yet seen
+// and versionfmt.MaxVersion is no fix at all.
+func latest(format, a, b string) string {
+	switch {
+	case a == "" || b == versionfmt.MaxVersion:
+		return b
+	case b == "" || a == versionfmt.MaxVersion:
+		return a
+	}
+	if cmp, _ := versionfmt.Compare(format, b, a); cmp > 0 {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/semver"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestFixedIn(t *testing.T) {
+	namespace := database.Namespace{Name: "test", VersionFormat: semver.ParserName}
+	feature := func(affected Affected) (database.Feature, bool) {
+		if affected.Package.Ecosystem != "test" {
+			return database.Feature{}, false
+		}
+		return database.Feature{Name: affected.Package.Name, Namespace: namespace}, true
+	}
+
+	var adv Advisory
+	err := json.Unmarshal([]byte(`{"id": "TEST-1", "affected": [
+		{"package": {"ecosystem": "test", "name": "lines"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "2.0.0"}, {"fixed": "2.4.1"}]}]},
+		{"package": {"ecosystem": "test", "name": "lines"}, "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "1.9.3"}, {"fixed": "not a version"}]}]},
+		{"package": {"ecosystem": "test", "name": "unfixed"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.0.0"}, {"introduced": "1.2.0"}, {"last_affected": "1.2.5"}]}]},
+		{"package": {"ecosystem": "test", "name": "merged"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "3.0.0"}]}]},
+		{"package": {"ecosystem": "test", "name": "merged"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}]},
+		{"package": {"ecosystem": "test", "name": "git"}, "ranges": [{"type": "GIT", "events": [{"introduced": "0"}, {"fixed": "f00dcafe"}]}]},
+		{"package": {"ecosystem": "other", "name": "lines"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "9.0.0"}]}]}
+	]}`), &adv)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// The release lines of a package are merged using the latest fix, and packages without fix,
+	// in any of their ranges or release lines, affect every version.
+	assert.Equal(t, []database.FeatureVersion{
+		{Feature: database.Feature{Name: "lines", Namespace: namespace}, Version: "2.4.1"},
+		{Feature: database.Feature{Name: "unfixed", Namespace: namespace}, Version: versionfmt.MaxVersion},
+		{Feature: database.Feature{Name: "merged", Namespace: namespace}, Version: versionfmt.MaxVersion},
+		{Feature: database.Feature{Name: "git", Namespace: namespace}, Version: versionfmt.MaxVersion},
+	}, adv.FixedIn(feature))
+}
+
+func TestVulnerability(t *testing.T) {
+	var adv Advisory
+	err := json.Unmarshal([]byte(`{
+		"id": "TEST-2",
+		"aliases": ["CVE-2024-0001"],
+		"details": "Details.",
+		"severity": [{"type": "CVSS_V3", "score": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:H"}]
+	}`), &adv)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// The Severity is rated from the CVSS Score when the advisory doesn't rate it, and advisories
+	// without summary are described by their details.
+	vulnerability := adv.Vulnerability("https://example.com/", "Test")
+	assert.Equal(t, "TEST-2", vulnerability.Name)
+	assert.Equal(t, "https://example.com/TEST-2", vulnerability.Link)
+	assert.Equal(t, "Details.", vulnerability.Description)
+	assert.Equal(t, types.High, vulnerability.Severity)
+	assert.Equal(t, database.MetadataMap{"Test": map[string]interface{}{
+		"Aliases": []string{"CVE-2024-0001"},
+		"CVSSv3":  "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:H",
+	}}, vulnerability.Metadata)
+
+	// The severities of the GitHub advisories take precedence.
+	adv.DatabaseSpecific.Severity = "LOW"
+	assert.Equal(t, types.Low, adv.Vulnerability("", "Test").Severity)
+}
@@ -43,6 +43,10 @@ const (
 	updaterFlag    = "rhelUpdater"
 )
 
+// source attributes the vulnerabilities to the Red Hat security data, which is licensed under
+// the Creative Commons Attribution 4.0 International license.
+var source = database.VulnerabilitySource{Name: "Red Hat Security Data", URL: ovalURI, License: "CC-BY-4.0"}
+
 var (
 	ignoredCriterions = []string{
 		" is signed with Red Hat ",
@@ -93,6 +97,7 @@ func init() {
 // FetchUpdate gets vulnerability updates from the Red Hat OVAL definitions.
 func (f *RHELFetcher) FetchUpdate(datastore database.Datastore) (resp updater.FetcherResponse, err error) {
 	log.Info("fetching Red Hat vulnerabilities")
+	resp.Source = source
 
 	// Get the first RHSA we have to manage.
 	flagValue, err := datastore.GetKeyValue(updaterFlag)
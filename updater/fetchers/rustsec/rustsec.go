@@ -0,0 +1,177 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rustsec implements a vulnerability Fetcher using the RustSec Advisory Database, which
+// covers the Rust crates published on crates.io.
+package rustsec
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/semver"
+	"github.com/coreos/clair/updater"
+	"github.com/coreos/clair/updater/fetchers/osv/schema"
+	"github.com/coreos/clair/utils"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+const (
+	// url is the tarball of the branch of the advisory database holding the advisories in the
+	// OSV format (https://ossf.github.io/osv-schema).
+	url           = "https://github.com/rustsec/advisory-db/archive/osv.tar.gz"
+	archivePrefix = "advisory-db-osv/"
+	advisoriesDir = "crates/"
+
+	advisoryURLPrefix = "https://rustsec.org/advisories/"
+	updaterFlag       = "rustsecUpdater"
+
+	// namespace is the namespace of the crates detected in the layers.
+	namespace = "crates.io"
+
+	maxAdvisorySize = 1024 * 1024       // 1 MiB
+	maxArchiveSize  = 256 * 1024 * 1024 // 256 MiB
+)
+
+// source attributes the vulnerabilities to the RustSec Advisory Database.
+var source = database.VulnerabilitySource{Name: "RustSec Advisory Database", URL: "https://rustsec.org", License: "CC0-1.0"}
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/rustsec")
+
+type fetcher struct{}
+
+func init() {
+	updater.RegisterFetcher("rustsec", &fetcher{})
+}
+
+// FetchUpdate fetches vulnerability updates from the RustSec Advisory Database.
+func (f *fetcher) FetchUpdate(datastore database.Datastore) (resp updater.FetcherResponse, err error) {
+	log.Info("fetching RustSec vulnerabilities")
+
+	// Download the advisories.
+	r, err := http.Get(url)
+	if err != nil {
+		log.Errorf("could not download the RustSec advisory database: %s", err)
+		return resp, cerrors.ErrCouldNotDownload
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		log.Errorf("could not download the RustSec advisory database: got status code %d", r.StatusCode)
+		return resp, cerrors.ErrCouldNotDownload
+	}
+
+	// Get the SHA-1 of the latest advisories.
+	latestHash, err := datastore.GetKeyValue(updaterFlag)
+	if err != nil {
+		return resp, err
+	}
+
+	resp, err = buildResponse(r.Body, latestHash)
+	if err != nil {
+		return resp, err
+	}
+	resp.Source = source
+
+	return resp, nil
+}
+
+func buildResponse(archive io.Reader, latestKnownHash string) (resp updater.FetcherResponse, err error) {
+	hash := latestKnownHash
+
+	// Defer the addition of flag information to the response.
+	defer func() {
+		if err == nil {
+			resp.FlagName = updaterFlag
+			resp.FlagValue = hash
+		}
+	}()
+
+	extractor := utils.Extractor{
+		Prefix:         archivePrefix,
+		Files:          []string{advisoriesDir},
+		MaxFileSize:    maxAdvisorySize,
+		MaxArchiveSize: maxArchiveSize,
+	}
+	files, err := extractor.Extract(archive)
+	if err != nil {
+		log.Errorf("could not extract the RustSec advisory database: %s", err)
+		return resp, cerrors.ErrCouldNotParse
+	}
+
+	// Hash the advisories rather than the archive, whose bytes may change when it is generated
+	// again, and skip updating if the hash has been seen before.
+	var names []string
+	for name := range files {
+		if strings.HasSuffix(name, ".json") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	sha := sha1.New()
+	for _, name := range names {
+		io.WriteString(sha, name+"\x00")
+		sha.Write(files[name])
+	}
+	hash = hex.EncodeToString(sha.Sum(nil))
+	if latestKnownHash == hash {
+		log.Debug("no RustSec update")
+		return resp, nil
+	}
+
+	for _, name := range names {
+		var adv schema.Advisory
+		if err = json.Unmarshal(files[name], &adv); err != nil {
+			log.Errorf("could not unmarshal RustSec advisory %s: %s", name, err)
+			return resp, cerrors.ErrCouldNotParse
+		}
+
+		if vulnerability, ok := parseAdvisory(adv); ok {
+			resp.Vulnerabilities = append(resp.Vulnerabilities, vulnerability)
+		}
+	}
+
+	return resp, nil
+}
+
+// parseAdvisory returns the vulnerability described by an advisory, if it describes one.
+func parseAdvisory(adv schema.Advisory) (vulnerability database.Vulnerability, ok bool) {
+	if !strings.HasPrefix(adv.ID, "RUSTSEC-") || adv.Withdrawn != "" {
+		return vulnerability, false
+	}
+
+	vulnerability = adv.Vulnerability(advisoryURLPrefix, "RustSec")
+	vulnerability.FixedIn = adv.FixedIn(func(affected schema.Affected) (database.Feature, bool) {
+		// Informational advisories, e.g. about unmaintained crates, are not vulnerabilities.
+		if affected.Package.Ecosystem != "crates.io" || affected.DatabaseSpecific.Informational != "" {
+			return database.Feature{}, false
+		}
+		return database.Feature{
+			Name:      affected.Package.Name,
+			Namespace: database.Namespace{Name: namespace, VersionFormat: semver.ParserName},
+		}, true
+	})
+
+	return vulnerability, len(vulnerability.FixedIn) > 0
+}
+
+func (f *fetcher) Clean() {}
@@ -0,0 +1,76 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rustsec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/semver"
+	"github.com/coreos/clair/updater/fetchers/testutil"
+	"github.com/coreos/clair/utils/types"
+)
+
+func TestRustSecParser(t *testing.T) {
+	archive := testutil.TarGz(t, "testdata", archivePrefix+advisoriesDir)
+
+	response, err := buildResponse(bytes.NewReader(archive), "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, updaterFlag, response.FlagName)
+	assert.NotEmpty(t, response.FlagValue)
+
+	// The withdrawn and informational advisories are ignored.
+	vulnerabilities := make(map[string]database.Vulnerability)
+	for _, vulnerability := range response.Vulnerabilities {
+		vulnerabilities[vulnerability.Name] = vulnerability
+	}
+	if !assert.Len(t, vulnerabilities, 2) {
+		return
+	}
+	crate := func(name string) database.Feature {
+		return database.Feature{Name: name, Namespace: database.Namespace{Name: "crates.io", VersionFormat: semver.ParserName}}
+	}
+
+	time := vulnerabilities["RUSTSEC-2020-0071"]
+	assert.Equal(t, "https://rustsec.org/advisories/RUSTSEC-2020-0071", time.Link)
+	assert.Equal(t, "Potential segfault in the time crate", time.Description)
+	// The Severity is rated from the CVSS Score when the advisory doesn't rate it.
+	assert.Equal(t, types.Medium, time.Severity)
+	assert.Equal(t, &types.CVSS{Vector: "CVSS:3.1/AV:L/AC:H/PR:N/UI:N/S:U/C:N/I:N/A:H", Score: 5.1}, time.CVSS.V3)
+	assert.Equal(t, database.MetadataMap{"RustSec": map[string]interface{}{
+		"Aliases": []string{"CVE-2020-26235", "GHSA-wcg3-cvx6-7396"},
+		"CVSSv3":  "CVSS:3.1/AV:L/AC:H/PR:N/UI:N/S:U/C:N/I:N/A:H",
+	}}, time.Metadata)
+	// The latest fix is used.
+	assert.Equal(t, []database.FeatureVersion{{Feature: crate("time"), Version: "0.3.3"}}, time.FixedIn)
+
+	// Vulnerabilities without fix affect every version.
+	openssl := vulnerabilities["RUSTSEC-2023-0044"]
+	assert.Nil(t, openssl.Metadata["RustSec"].(map[string]interface{})["CVSSv3"])
+	assert.Equal(t, types.Unknown, openssl.Severity)
+	assert.Equal(t, []database.FeatureVersion{{Feature: crate("openssl"), Version: versionfmt.MaxVersion}}, openssl.FixedIn)
+
+	// The same advisories aren't parsed twice.
+	response, err = buildResponse(bytes.NewReader(archive), response.FlagValue)
+	if assert.Nil(t, err) {
+		assert.Len(t, response.Vulnerabilities, 0)
+	}
+}
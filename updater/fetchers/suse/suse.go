@@ -0,0 +1,409 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package suse implements a vulnerability Fetcher using the OVAL definitions published by SUSE
+// for SUSE Linux Enterprise Server and openSUSE Leap.
+package suse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/rpm"
+	"github.com/coreos/clair/updater"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/utils/types"
+)
+
+const (
+	ovalURI     = "https://ftp.suse.com/pub/projects/security/oval/"
+	updaterFlag = "suseUpdater"
+
+	maxFeedSize = 512 * 1024 * 1024 // 512 MiB
+)
+
+var (
+	// ovalFileRegexp matches the links to the OVAL files of every major release of SUSE Linux
+	// Enterprise Server, which cover all of its service packs, and of every release of openSUSE
+	// Leap in the index of the OVAL directory.
+	ovalFileRegexp = regexp.MustCompile(`href="((?:suse\.linux\.enterprise\.server\.[0-9]+|opensuse\.leap\.[0-9]+\.[0-9]+)\.xml\.gz)"`)
+
+	// slesRegexp and leapRegexp match the criterions on the installed product, from which the
+	// namespaces are named after the VERSION_ID of their /etc/os-release, e.g. "sles:15.5" for
+	// SUSE Linux Enterprise Server 15 SP5 and "opensuse-leap:15.5" for openSUSE Leap 15.5.
+	slesRegexp = regexp.MustCompile(`^SUSE Linux Enterprise Server ([0-9]+)(?: SP([0-9]+))? is installed$`)
+	leapRegexp = regexp.MustCompile(`^openSUSE Leap ([0-9]+\.[0-9]+) is installed$`)
+
+	// packageRegexp matches the criterions on the version of a package, e.g.
+	// "curl-8.0.1-150400.5.26.1 is installed", which is the version fixing the vulnerability.
+	packageRegexp = regexp.MustCompile(`^(.+)-([^-]+-[^-]+) is installed$`)
+
+	ignoredCriterions = []string{
+		" is signed with ",
+		" is not affected",
+	}
+)
+
+// source attributes the vulnerabilities to the SUSE OVAL definitions.
+var source = database.VulnerabilitySource{Name: "SUSE OVAL", URL: ovalURI}
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/suse")
+
+func init() {
+	updater.RegisterFetcher("suse", &fetcher{})
+}
+
+type fetcher struct{}
+
+func (f *fetcher) FetchUpdate(db database.Datastore) (resp updater.FetcherResponse, err error) {
+	log.Info("fetching SUSE vulnerabilities")
+
+	// List the OVAL files.
+	index, err := download(ovalURI)
+	if err != nil {
+		log.Errorf("could not download the index of the SUSE OVAL definitions: %s", err)
+		return resp, cerrors.ErrCouldNotDownload
+	}
+
+	// Download every OVAL file, compressed.
+	feeds := make(map[string][]byte)
+	for _, match := range ovalFileRegexp.FindAllSubmatch(index, -1) {
+		name := string(match[1])
+		if _, ok := feeds[name]; ok {
+			continue
+		}
+		feed, err := download(ovalURI + name)
+		if err != nil {
+			log.Errorf("could not download the SUSE OVAL file %s: %s", name, err)
+			return resp, cerrors.ErrCouldNotDownload
+		}
+		feeds[name] = feed
+	}
+
+	// Ask the database for the hash of the latest feeds we successfully applied.
+	latestHash, err := db.GetKeyValue(updaterFlag)
+	if err != nil {
+		return resp, err
+	}
+
+	resp, err = buildResponse(feeds, latestHash)
+	if err != nil {
+		return resp, err
+	}
+	resp.Source = source
+
+	return resp, nil
+}
+
+func (f *fetcher) Clean() {}
+
+// download returns the content at the given URL.
+func download(url string) ([]byte, error) {
+	r, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d", r.StatusCode)
+	}
+	return readAll(r.Body)
+}
+
+// readAll reads the given reader up to maxFeedSize bytes.
+func readAll(r io.Reader) ([]byte, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(r, maxFeedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxFeedSize {
+		return nil, fmt.Errorf("feed bigger than %d bytes", maxFeedSize)
+	}
+	return content, nil
+}
+
+// buildResponse parses the gzipped OVAL files, keyed by their name, e.g.
+// "suse.linux.enterprise.server.15.xml.gz".
+func buildResponse(feeds map[string][]byte, latestKnownHash string) (resp updater.FetcherResponse, err error) {
+	hash := latestKnownHash
+
+	// Defer the addition of flag information to the response.
+	defer func() {
+		if err == nil {
+			resp.FlagName = updaterFlag
+			resp.FlagValue = hash
+		}
+	}()
+
+	// Skip updating if the hash of the feeds has been seen before.
+	names := make([]string, 0, len(feeds))
+	for name := range feeds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sha := sha1.New()
+	for _, name := range names {
+		io.WriteString(sha, name+"\x00")
+		sha.Write(feeds[name])
+	}
+	hash = hex.EncodeToString(sha.Sum(nil))
+	if latestKnownHash == hash {
+		log.Debug("no SUSE update")
+		return resp, nil
+	}
+
+	for _, name := range names {
+		gr, err := gzip.NewReader(bytes.NewReader(feeds[name]))
+		if err != nil {
+			log.Errorf("could not decompress the SUSE OVAL file %s: %s", name, err)
+			return resp, cerrors.ErrCouldNotParse
+		}
+		vulns, err := parseOVAL(gr)
+		gr.Close()
+		if err != nil {
+			log.Errorf("could not parse the SUSE OVAL file %s: %s", name, err)
+			return resp, cerrors.ErrCouldNotParse
+		}
+		resp.Vulnerabilities = append(resp.Vulnerabilities, vulns...)
+	}
+
+	return resp, nil
+}
+
+type oval struct {
+	Definitions []definition `xml:"definitions>definition"`
+}
+
+type definition struct {
+	Class       string      `xml:"class,attr"`
+	Title       string      `xml:"metadata>title"`
+	Description string      `xml:"metadata>description"`
+	References  []reference `xml:"metadata>reference"`
+	Severity    string      `xml:"metadata>advisory>severity"`
+	Criteria    criteria    `xml:"criteria"`
+}
+
+type reference struct {
+	Source string `xml:"source,attr"`
+	URI    string `xml:"ref_url,attr"`
+}
+
+type criteria struct {
+	Operator   string      `xml:"operator,attr"`
+	Criterias  []*criteria `xml:"criteria"`
+	Criterions []criterion `xml:"criterion"`
+}
+
+type criterion struct {
+	Comment string `xml:"comment,attr"`
+}
+
+// parseOVAL returns the vulnerabilities of an OVAL file that affect at least one package of a
+// known product.
+func parseOVAL(ovalReader io.Reader) (vulnerabilities []database.Vulnerability, err error) {
+	var ov oval
+	if err = xml.NewDecoder(ovalReader).Decode(&ov); err != nil {
+		return nil, err
+	}
+
+	for _, def := range ov.Definitions {
+		if def.Class != "" && def.Class != "vulnerability" {
+			continue
+		}
+
+		pkgs := toFeatureVersions(def.Criteria)
+		if len(pkgs) == 0 {
+			continue
+		}
+		vulnerabilities = append(vulnerabilities, database.Vulnerability{
+			Name:        strings.TrimSpace(def.Title),
+			Link:        link(def),
+			Severity:    priority(def),
+			Description: strings.Join(strings.Fields(def.Description), " "),
+			FixedIn:     pkgs,
+		})
+	}
+
+	return vulnerabilities, nil
+}
+
+func getCriterions(node criteria) [][]criterion {
+	// Filter useless criterions.
+	var criterions []criterion
+	for _, c := range node.Criterions {
+		ignored := false
+
+		for _, ignoredItem := range ignoredCriterions {
+			if strings.Contains(c.Comment, ignoredItem) {
+				ignored = true
+				break
+			}
+		}
+
+		if !ignored {
+			criterions = append(criterions, c)
+		}
+	}
+
+	if node.Operator == "AND" {
+		return [][]criterion{criterions}
+	} else if node.Operator == "OR" {
+		var possibilities [][]criterion
+		for _, c := range criterions {
+			possibilities = append(possibilities, []criterion{c})
+		}
+		return possibilities
+	}
+
+	return [][]criterion{}
+}
+
+func getPossibilities(node criteria) [][]criterion {
+	if len(node.Criterias) == 0 {
+		return getCriterions(node)
+	}
+
+	var possibilitiesToCompose [][][]criterion
+	for _, criteria := range node.Criterias {
+		possibilitiesToCompose = append(possibilitiesToCompose, getPossibilities(*criteria))
+	}
+	if len(node.Criterions) > 0 {
+		possibilitiesToCompose = append(possibilitiesToCompose, getCriterions(node))
+	}
+
+	var possibilities [][]criterion
+	if node.Operator == "AND" {
+		possibilities = append(possibilities, possibilitiesToCompose[0]...)
+
+		for _, possibilityGroup := range possibilitiesToCompose[1:] {
+			var newPossibilities [][]criterion
+
+			for _, possibility := range possibilities {
+				for _, possibilityInGroup := range possibilityGroup {
+					var p []criterion
+					p = append(p, possibility...)
+					p = append(p, possibilityInGroup...)
+					newPossibilities = append(newPossibilities, p)
+				}
+			}
+
+			possibilities = newPossibilities
+		}
+	} else if node.Operator == "OR" {
+		for _, possibilityGroup := range possibilitiesToCompose {
+			possibilities = append(possibilities, possibilityGroup...)
+		}
+	}
+
+	return possibilities
+}
+
+// toFeatureVersions returns the fixed packages of every product of the given criteria, sorted by
+// namespace and name.
+func toFeatureVersions(criteria criteria) []database.FeatureVersion {
+	// The same package may be listed for several products sharing a namespace, e.g. the modules
+	// of SUSE Linux Enterprise.
+	featureVersions := make(map[string]database.FeatureVersion)
+
+	for _, criterions := range getPossibilities(criteria) {
+		var namespace, name, version string
+
+		// A possibility is the installed product along with the version of a package.
+		for _, c := range criterions {
+			if r := slesRegexp.FindStringSubmatch(c.Comment); r != nil {
+				namespace = "sles:" + r[1]
+				if r[2] != "" && r[2] != "0" {
+					namespace += "." + r[2]
+				}
+			} else if r := leapRegexp.FindStringSubmatch(c.Comment); r != nil {
+				namespace = "opensuse-leap:" + r[1]
+			} else if r := packageRegexp.FindStringSubmatch(c.Comment); r != nil {
+				if err := versionfmt.Valid(rpm.ParserName, r[2]); err != nil {
+					log.Warningf("could not parse package version '%s': %s. skipping", r[2], err.Error())
+					continue
+				}
+				name, version = r[1], r[2]
+			}
+		}
+
+		if namespace == "" || name == "" {
+			continue
+		}
+		featureVersions[namespace+":"+name] = database.FeatureVersion{
+			Feature: database.Feature{
+				Namespace: database.Namespace{Name: namespace, VersionFormat: rpm.ParserName},
+				Name:      name,
+			},
+			Version: version,
+		}
+	}
+
+	keys := make([]string, 0, len(featureVersions))
+	for key := range featureVersions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var fvs []database.FeatureVersion
+	for _, key := range keys {
+		fvs = append(fvs, featureVersions[key])
+	}
+	return fvs
+}
+
+func link(def definition) (link string) {
+	for _, reference := range def.References {
+		if reference.Source == "SUSE CVE" {
+			return reference.URI
+		}
+		if link == "" {
+			link = reference.URI
+		}
+	}
+	return link
+}
+
+func priority(def definition) types.Priority {
+	switch strings.ToLower(def.Severity) {
+	case "low":
+		return types.Low
+	case "moderate":
+		return types.Medium
+	case "important":
+		return types.High
+	case "critical":
+		return types.Critical
+	case "":
+		// Many definitions don't have a severity.
+		return types.Unknown
+	default:
+		log.Warningf("could not determine vulnerability priority from: %s.", def.Severity)
+		return types.Unknown
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package suse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/rpm"
+	"github.com/coreos/clair/utils/types"
+)
+
+func readTestFeed(t *testing.T, name string) []byte {
+	_, filename, _, _ := runtime.Caller(0)
+	content, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filename), "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func gzipped(content []byte) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(content)
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestSLESParsing(t *testing.T) {
+	vulns, err := parseOVAL(bytes.NewReader(readTestFeed(t, "suse.linux.enterprise.server.15.xml")))
+	if !assert.Nil(t, err) || !assert.Len(t, vulns, 2) {
+		return
+	}
+
+	// The products that aren't SUSE Linux Enterprise Server are left out.
+	assert.Equal(t, "CVE-2022-43552", vulns[0].Name)
+	assert.Equal(t, "https://www.suse.com/security/cve/CVE-2022-43552", vulns[0].Link)
+	assert.Equal(t, types.Medium, vulns[0].Severity)
+	assert.Equal(t, "A use after free vulnerability exists in curl <7.87.0.", vulns[0].Description)
+	fixedIn := func(namespace, name string) database.FeatureVersion {
+		return database.FeatureVersion{
+			Feature: database.Feature{
+				Namespace: database.Namespace{Name: namespace, VersionFormat: rpm.ParserName},
+				Name:      name,
+			},
+			Version: "7.79.1-150400.5.12.1",
+		}
+	}
+	assert.Equal(t, []database.FeatureVersion{
+		fixedIn("sles:15.4", "curl"),
+		fixedIn("sles:15.4", "libcurl4"),
+		fixedIn("sles:15.5", "curl"),
+		fixedIn("sles:15.5", "libcurl4"),
+	}, vulns[0].FixedIn)
+
+	// Signatures and unaffected packages are ignored.
+	assert.Equal(t, "CVE-2018-0739", vulns[1].Name)
+	assert.Equal(t, "https://cve.mitre.org/cgi-bin/cvename.cgi?name=CVE-2018-0739", vulns[1].Link)
+	assert.Equal(t, types.Unknown, vulns[1].Severity)
+	if assert.Len(t, vulns[1].FixedIn, 1) {
+		assert.Equal(t, "sles:15", vulns[1].FixedIn[0].Feature.Namespace.Name)
+		assert.Equal(t, "libopenssl1_1", vulns[1].FixedIn[0].Feature.Name)
+		assert.Equal(t, "1.1.0h-2.3", vulns[1].FixedIn[0].Version)
+	}
+}
+
+func TestSUSEBuildResponse(t *testing.T) {
+	feeds := map[string][]byte{
+		"suse.linux.enterprise.server.15.xml.gz": gzipped(readTestFeed(t, "suse.linux.enterprise.server.15.xml")),
+		"opensuse.leap.15.5.xml.gz":              gzipped(readTestFeed(t, "opensuse.leap.15.5.xml")),
+	}
+
+	response, err := buildResponse(feeds, "")
+	if !assert.Nil(t, err) || !assert.Len(t, response.Vulnerabilities, 3) {
+		return
+	}
+	assert.Equal(t, updaterFlag, response.FlagName)
+	assert.NotEmpty(t, response.FlagValue)
+
+	leap := response.Vulnerabilities[0]
+	assert.Equal(t, "CVE-2023-0286", leap.Name)
+	assert.Equal(t, types.High, leap.Severity)
+	if assert.Len(t, leap.FixedIn, 1) {
+		assert.Equal(t, "opensuse-leap:15.5", leap.FixedIn[0].Feature.Namespace.Name)
+		assert.Equal(t, "1.1.1l-150500.17.9.1", leap.FixedIn[0].Version)
+	}
+
+	// The same feeds aren't parsed twice.
+	response, err = buildResponse(feeds, response.FlagValue)
+	if assert.Nil(t, err) {
+		assert.Len(t, response.Vulnerabilities, 0)
+	}
+
+	// Corrupted feeds are rejected.
+	_, err = buildResponse(map[string][]byte{"opensuse.leap.15.5.xml.gz": []byte("<oval")}, "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil provides helpers to test the fetchers, which build the archives the fetchers
+// download from the files of their testdata directory.
+package testutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TarGz returns a gzipped tarball of the files of the given directory, named by prefix followed by
+// their path relative to the directory.
+func TarGz(t testing.TB, dir, prefix string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	walk(t, dir, func(name string, d []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: prefix + name, Mode: 0644, Size: int64(len(d))}); err != nil {
+			return err
+		}
+		_, err := tw.Write(d)
+		return err
+	})
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Zip returns a zip archive of the files of the given directory, named by their path relative to
+// the directory.
+func Zip(t testing.TB, dir string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	walk(t, dir, func(name string, d []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(d)
+		return err
+	})
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// walk calls add with the slash-separated path relative to dir and the content of every file of
+// dir, in lexical order.
+func walk(t testing.TB, dir string, add func(name string, d []byte) error) {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		d, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return add(filepath.ToSlash(rel), d)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
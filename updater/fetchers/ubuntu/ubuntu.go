@@ -44,6 +44,9 @@ const (
 	cveURL            = "http://people.ubuntu.com/~ubuntu-security/cve/%s"
 )
 
+// source attributes the vulnerabilities to the Ubuntu CVE Tracker.
+var source = database.VulnerabilitySource{Name: "Ubuntu CVE Tracker", URL: trackerURI}
+
 var (
 	ubuntuIgnoredReleases = map[string]struct{}{
 		"upstream": {},
@@ -94,6 +97,7 @@ func init() {
 // FetchUpdate gets vulnerability updates from the Ubuntu CVE Tracker.
 func (fetcher *UbuntuFetcher) FetchUpdate(datastore database.Datastore) (resp updater.FetcherResponse, err error) {
 	log.Info("fetching Ubuntu vulnerabilities")
+	resp.Source = source
 
 	// Pull the bzr repository.
 	if err = fetcher.pullRepository(); err != nil {
@@ -0,0 +1,345 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vex implements a vulnerability Fetcher using the VEX documents in the OpenVEX format
+// (https://openvex.dev) that vendors publish about their packaged images, e.g. Bitnami. The
+// findings that a vendor states are not affected or fixed in its packages are flagged as false
+// positives.
+package vex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/updater"
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+const (
+	timeout         = 5 * time.Minute
+	maxDocumentSize = 64 * 1024 * 1024 // 64 MiB
+)
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/vex")
+
+// Feed is the configuration of a VEX document published by a vendor.
+type Feed struct {
+	// Name identifies the vendor in the reasons of the false positives.
+	Name string
+	URL  string
+}
+
+// document is the part of an OpenVEX document stating the status of vulnerabilities.
+type document struct {
+	Statements []statement `json:"statements"`
+}
+
+type statement struct {
+	Vulnerability   vulnerability `json:"vulnerability"`
+	Products        []product     `json:"products"`
+	Status          string        `json:"status"`
+	Justification   string        `json:"justification"`
+	ImpactStatement string        `json:"impact_statement"`
+}
+
+// vulnerability is an object since OpenVEX 0.2.0, and a string before.
+type vulnerability struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+func (v *vulnerability) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &v.Name); err == nil {
+		return nil
+	}
+
+	type object vulnerability
+	return json.Unmarshal(data, (*object)(v))
+}
+
+// product is identified by a package URL. Images list their packages as subcomponents.
+type product struct {
+	ID            string `json:"@id"`
+	Subcomponents []struct {
+		ID string `json:"@id"`
+	} `json:"subcomponents"`
+}
+
+type fetcher struct {
+	feeds  []Feed
+	client *http.Client
+}
+
+func init() {
+	updater.RegisterFetcher("vex", &fetcher{})
+}
+
+// Configure enables the fetcher if VEX documents are configured.
+func (f *fetcher) Configure(config *config.UpdaterConfig) (bool, error) {
+	if config == nil {
+		return false, nil
+	}
+	var feeds []Feed
+	if ok, err := config.DecodeParams("vex", &feeds); !ok || err != nil {
+		return false, err
+	}
+
+	for _, feed := range feeds {
+		if feed.Name == "" {
+			return false, errors.New("a VEX document has no name")
+		}
+		if _, err := url.ParseRequestURI(feed.URL); err != nil {
+			return false, fmt.Errorf("could not parse URL of VEX document '%s': %s", feed.Name, err)
+		}
+	}
+	if len(feeds) == 0 {
+		return false, nil
+	}
+
+	f.feeds = feeds
+	f.client = &http.Client{Timeout: timeout}
+	return true, nil
+}
+
+// FetchUpdate fetches the statements of the configured VEX documents. They are returned on every
+// update, so that the statements about vulnerabilities that weren't known yet are applied once
+// they are.
+func (f *fetcher) FetchUpdate(datastore database.Datastore) (resp updater.FetcherResponse, err error) {
+	for _, feed := range f.feeds {
+		log.Infof("fetching VEX document '%s'", feed.Name)
+
+		content, err := f.download(feed.URL)
+		if err != nil {
+			log.Errorf("could not download VEX document '%s': %s", feed.Name, err)
+			return resp, cerrors.ErrCouldNotDownload
+		}
+
+		falsePositives, notes, err := parseDocument(feed.Name, content)
+		if err != nil {
+			log.Errorf("could not parse VEX document '%s': %s", feed.Name, err)
+			return resp, cerrors.ErrCouldNotParse
+		}
+		resp.FalsePositives = append(resp.FalsePositives, falsePositives...)
+		resp.Notes = append(resp.Notes, notes...)
+	}
+
+	return resp, nil
+}
+
+func (f *fetcher) download(url string) ([]byte, error) {
+	r, err := f.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d", r.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(r.Body, maxDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxDocumentSize {
+		return nil, fmt.Errorf("document bigger than %d bytes", maxDocumentSize)
+	}
+	return content, nil
+}
+
+// parseDocument returns the findings that the statements of a VEX document state are not
+// affected or fixed. As the vulnerabilities of a namespace may be named differently than in the
+// document, e.g. by their GitHub advisory rather than their CVE, a finding is returned for every
+// alias of a vulnerability; only the ones of known vulnerabilities are flagged.
+func parseDocument(feedName string, content []byte) (falsePositives []database.FalsePositive, notes []string, err error) {
+	var doc document
+	if err = json.Unmarshal(content, &doc); err != nil {
+		return nil, nil, err
+	}
+
+	unsupported := make(map[string]struct{})
+	for _, s := range doc.Statements {
+		if s.Status != "not_affected" && s.Status != "fixed" {
+			continue
+		}
+
+		reason := feedName + " VEX: " + s.Status
+		if s.Justification != "" {
+			reason += " (" + s.Justification + ")"
+		}
+		if s.ImpactStatement != "" {
+			reason += ": " + s.ImpactStatement
+		}
+
+		names := append([]string{s.Vulnerability.Name}, s.Vulnerability.Aliases...)
+		for _, p := range s.Products {
+			purls := []string{p.ID}
+			if len(p.Subcomponents) > 0 {
+				purls = purls[:0]
+				for _, subcomponent := range p.Subcomponents {
+					purls = append(purls, subcomponent.ID)
+				}
+			}
+
+			for _, purl := range purls {
+				fv, ok := parsePackageURL(purl)
+				if !ok {
+					unsupported[purl] = struct{}{}
+					continue
+				}
+
+				for _, name := range names {
+					if name == "" {
+						continue
+					}
+					falsePositives = append(falsePositives, database.FalsePositive{
+						Namespace:         fv.Feature.Namespace,
+						VulnerabilityName: name,
+						FeatureName:       fv.Feature.Name,
+						FeatureVersion:    fv.Version,
+						Reason:            reason,
+					})
+				}
+			}
+		}
+	}
+
+	if len(unsupported) > 0 {
+		notes = append(notes, fmt.Sprintf("VEX document '%s' has %d products whose package URL isn't supported.", feedName, len(unsupported)))
+	}
+	return falsePositives, notes, nil
+}
+
+// parsePackageURL returns the feature version identified by a package URL
+// (https://github.com/package-url/purl-spec), if it is of a detected type and has a version.
+func parsePackageURL(purl string) (fv database.FeatureVersion, ok bool) {
+	if !strings.HasPrefix(purl, "pkg:") {
+		return fv, false
+	}
+	purl = strings.TrimPrefix(purl, "pkg:")
+
+	if i := strings.Index(purl, "#"); i >= 0 {
+		purl = purl[:i]
+	}
+	qualifiers := make(map[string]string)
+	if i := strings.Index(purl, "?"); i >= 0 {
+		values, err := url.ParseQuery(purl[i+1:])
+		if err != nil {
+			return fv, false
+		}
+		for key := range values {
+			qualifiers[strings.ToLower(key)] = values.Get(key)
+		}
+		purl = purl[:i]
+	}
+
+	i := strings.LastIndex(purl, "@")
+	if i < 0 {
+		return fv, false
+	}
+	version, err := url.PathUnescape(purl[i+1:])
+	if err != nil || version == "" {
+		return fv, false
+	}
+	purl = purl[:i]
+
+	segments := strings.Split(purl, "/")
+	if len(segments) < 2 {
+		return fv, false
+	}
+	for i := range segments {
+		if segments[i], err = url.PathUnescape(segments[i]); err != nil {
+			return fv, false
+		}
+	}
+	typ, name := strings.ToLower(segments[0]), segments[len(segments)-1]
+
+	var namespace string
+	switch typ {
+	case "deb":
+		// Features are named after their source package.
+		if upstream := qualifiers["upstream"]; upstream != "" {
+			name = upstream
+		}
+		os, osVersion, ok := parseDistro(qualifiers["distro"])
+		if !ok {
+			return fv, false
+		}
+		if os == "debian" {
+			osVersion = strings.SplitN(osVersion, ".", 2)[0]
+		}
+		namespace = os + ":" + osVersion
+	case "rpm":
+		os, osVersion, ok := parseDistro(qualifiers["distro"])
+		if !ok {
+			return fv, false
+		}
+		namespace = os + ":" + strings.SplitN(osVersion, ".", 2)[0]
+		if epoch := qualifiers["epoch"]; epoch != "" && epoch != "0" {
+			version = epoch + ":" + version
+		}
+	case "apk":
+		os, osVersion, ok := parseDistro(qualifiers["distro"])
+		if !ok {
+			return fv, false
+		}
+		numbers := strings.SplitN(strings.TrimPrefix(osVersion, "v"), ".", 3)
+		if len(numbers) < 2 {
+			return fv, false
+		}
+		namespace = os + ":v" + numbers[0] + "." + numbers[1]
+	case "cargo":
+		namespace = "crates.io"
+	case "composer":
+		namespace = "packagist"
+		if len(segments) == 3 {
+			name = strings.ToLower(segments[1] + "/" + name)
+		}
+	case "nuget":
+		// Package IDs are case insensitive.
+		namespace, name = "nuget", strings.ToLower(name)
+	case "conda":
+		namespace = "conda"
+	default:
+		return fv, false
+	}
+
+	fv = database.FeatureVersion{
+		Feature: database.Feature{Name: name, Namespace: database.Namespace{Name: namespace}},
+		Version: version,
+	}
+	return fv, true
+}
+
+// parseDistro splits a distro qualifier such as "debian-11" into the name and the version of the
+// distribution.
+func parseDistro(distro string) (os, version string, ok bool) {
+	i := strings.LastIndex(distro, "-")
+	if i <= 0 || i == len(distro)-1 {
+		return "", "", false
+	}
+	return strings.ToLower(distro[:i]), distro[i+1:], true
+}
+
+func (f *fetcher) Clean() {}
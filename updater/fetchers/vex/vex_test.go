@@ -0,0 +1,132 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vex
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+func TestVEXParser(t *testing.T) {
+	_, filename, _, _ := runtime.Caller(0)
+	content, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filename), "testdata", "bitnami.openvex.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	falsePositives, notes, err := parseDocument("bitnami", content)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	reason := "bitnami VEX: not_affected (vulnerable_code_not_in_execute_path): Policy constraints are not used."
+	expected := []database.FalsePositive{
+		// The packages of images are their subcomponents, and every alias is flagged.
+		{
+			Namespace:         database.Namespace{Name: "debian:11"},
+			VulnerabilityName: "CVE-2023-0464",
+			FeatureName:       "openssl",
+			FeatureVersion:    "1.1.1n-0+deb11u4",
+			Reason:            reason,
+		},
+		{
+			Namespace:         database.Namespace{Name: "debian:11"},
+			VulnerabilityName: "GHSA-h5xr-wr58-9c3j",
+			FeatureName:       "openssl",
+			FeatureVersion:    "1.1.1n-0+deb11u4",
+			Reason:            reason,
+		},
+		// Vulnerabilities may be plain strings, and fixed packages are flagged too.
+		{
+			Namespace:         database.Namespace{Name: "centos:7"},
+			VulnerabilityName: "CVE-2022-1292",
+			FeatureName:       "openssl",
+			FeatureVersion:    "1:1.0.2k-25.el7_9",
+			Reason:            "bitnami VEX: fixed",
+		},
+		{
+			Namespace:         database.Namespace{Name: "alpine:v3.16"},
+			VulnerabilityName: "CVE-2022-1292",
+			FeatureName:       "openssl",
+			FeatureVersion:    "1.1.1o-r0",
+			Reason:            "bitnami VEX: fixed",
+		},
+		{
+			Namespace:         database.Namespace{Name: "crates.io"},
+			VulnerabilityName: "RUSTSEC-2020-0071",
+			FeatureName:       "time",
+			FeatureVersion:    "0.1.45",
+			Reason:            "bitnami VEX: not_affected (vulnerable_code_not_present)",
+		},
+	}
+	assert.Equal(t, expected, falsePositives)
+
+	// Generic packages and packages without version are not supported.
+	assert.Len(t, notes, 1)
+}
+
+func TestParsePackageURL(t *testing.T) {
+	for purl, expected := range map[string][2]string{
+		"pkg:deb/ubuntu/curl@7.81.0-1ubuntu1.10?distro=ubuntu-22.04": {"ubuntu:22.04", "curl"},
+		"pkg:rpm/redhat/openssl@1.1.1k-9.el8_7?distro=rhel-8.7":      {"rhel:8", "openssl"},
+		"pkg:composer/monolog/monolog@1.25.1":                        {"packagist", "monolog/monolog"},
+		"pkg:nuget/Newtonsoft.Json@13.0.1":                           {"nuget", "newtonsoft.json"},
+		"pkg:conda/numpy@1.21.5?channel=main#lib":                    {"conda", "numpy"},
+	} {
+		fv, ok := parsePackageURL(purl)
+		if assert.True(t, ok, purl) {
+			assert.Equal(t, expected[0], fv.Feature.Namespace.Name, purl)
+			assert.Equal(t, expected[1], fv.Feature.Name, purl)
+		}
+	}
+
+	for _, purl := range []string{"", "deb/debian/curl@7.74.0", "pkg:deb/debian/curl@7.74.0", "pkg:npm/lodash@4.17.21", "pkg:cargo/time", "pkg:apk/alpine/musl@1.2.3?distro=alpine"} {
+		_, ok := parsePackageURL(purl)
+		assert.False(t, ok, purl)
+	}
+}
+
+func TestVEXConfigure(t *testing.T) {
+	var f fetcher
+	configured, err := f.Configure(&config.UpdaterConfig{})
+	assert.False(t, configured)
+	assert.Nil(t, err)
+
+	configured, err = f.Configure(&config.UpdaterConfig{Params: map[string]interface{}{
+		"vex": []interface{}{map[interface{}]interface{}{"name": "bitnami", "url": "not a URL"}},
+	}})
+	assert.False(t, configured)
+	assert.NotNil(t, err)
+
+	configured, err = f.Configure(&config.UpdaterConfig{Params: map[string]interface{}{
+		"vex": []interface{}{map[interface{}]interface{}{"name": "bitnami", "uri": "https://vendor.example.com/vex.json"}},
+	}})
+	assert.False(t, configured)
+	assert.EqualError(t, err, "vex[0] has an unknown option 'uri'")
+
+	configured, err = f.Configure(&config.UpdaterConfig{Params: map[string]interface{}{
+		"vex": []interface{}{map[interface{}]interface{}{"name": "bitnami", "url": "https://vendor.example.com/vex.json"}},
+	}})
+	assert.True(t, configured)
+	assert.Nil(t, err)
+	assert.Equal(t, []Feed{{Name: "bitnami", URL: "https://vendor.example.com/vex.json"}}, f.feeds)
+}
@@ -0,0 +1,49 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updater
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/health"
+)
+
+const (
+	// reasonStale means that the vulnerabilities haven't been updated for two intervals.
+	reasonStale = "stale"
+	// reasonNeverUpdated means that the vulnerabilities haven't been updated yet.
+	reasonNeverUpdated = "never_updated"
+)
+
+// checkHealth returns a Checker of the freshness of the vulnerabilities, which is degraded when
+// no update succeeded for two intervals, across every instance of Clair.
+func checkHealth(datastore database.Datastore, interval time.Duration, now func() time.Time) health.Checker {
+	return func(ctx context.Context) health.Status {
+		lastUpdate, firstUpdate, err := LastUpdate(datastore)
+		switch {
+		case err != nil:
+			return health.Status{State: database.Degraded, Reason: health.ReasonUnreachable, Message: "could not get the last update time: " + err.Error()}
+		case firstUpdate:
+			return health.Status{State: database.Degraded, Reason: reasonNeverUpdated, Message: "the vulnerabilities have never been updated"}
+		case now().Sub(lastUpdate) > 2*interval:
+			return health.Status{State: database.Degraded, Reason: reasonStale, Message: fmt.Sprintf("the vulnerabilities were last updated at %s", lastUpdate.Format(time.RFC3339))}
+		}
+		return health.Status{State: database.Healthy}
+	}
+}
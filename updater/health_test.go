@@ -0,0 +1,55 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updater
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/database"
+)
+
+func TestCheckHealth(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	var lastUpdate string
+	var err error
+	datastore := &database.MockDatastore{
+		FctGetKeyValue: func(key string) (string, error) {
+			assert.Equal(t, flagName, key)
+			return lastUpdate, err
+		},
+	}
+	check := checkHealth(datastore, time.Hour, func() time.Time { return now })
+
+	status := check(context.Background())
+	assert.Equal(t, database.Degraded, status.State)
+	assert.Equal(t, reasonNeverUpdated, status.Reason)
+
+	lastUpdate = strconv.FormatInt(now.Add(-90*time.Minute).Unix(), 10)
+	assert.Equal(t, database.Healthy, check(context.Background()).State)
+
+	lastUpdate = strconv.FormatInt(now.Add(-3*time.Hour).Unix(), 10)
+	status = check(context.Background())
+	assert.Equal(t, database.Degraded, status.State)
+	assert.Equal(t, reasonStale, status.Reason)
+
+	err = errors.New("unreachable")
+	assert.Equal(t, database.Degraded, check(context.Background()).State)
+}
@@ -29,6 +29,9 @@ const (
 	metadataKey string = "NVD"
 )
 
+// source attributes the metadata to the National Vulnerability Database.
+var source = database.VulnerabilitySource{Name: "NVD", URL: "https://nvd.nist.gov"}
+
 var (
 	log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater/fetchers/metadata_fetchers")
 )
@@ -112,10 +115,13 @@ func (fetcher *NVDMetadataFetcher) AddMetadata(vulnerability *updater.Vulnerabil
 			vulnerability.Metadata = make(map[string]interface{})
 		}
 		vulnerability.Metadata[metadataKey] = nvdMetadata
+		vulnerability.Sources = append(vulnerability.Sources, source)
+		vulnerability.CVSS.V2 = &types.CVSS{Vector: nvdMetadata.CVSSv2.Vectors, Score: nvdMetadata.CVSSv2.Score}
 
-		// Set the Severity using the CVSSv2 Score if none is set yet.
+		// Set the Severity using the CVSS Score if none is set yet.
 		if vulnerability.Severity == "" || vulnerability.Severity == types.Unknown {
-			vulnerability.Severity = scoreToPriority(nvdMetadata.CVSSv2.Score)
+			score, _ := vulnerability.CVSS.Score()
+			vulnerability.Severity = types.ScorePriority(score)
 		}
 
 		vulnerability.Lock.Unlock()
@@ -230,24 +236,3 @@ func getHashFromMetaURL(metaURL string) (string, error) {
 
 	return "", errors.New("invalid .meta file format")
 }
-
-// scoreToPriority converts the CVSS Score (0.0 - 10.0) into user-friendy
-// types.Priority following the qualitative rating scale available in the
-// CVSS v3.0 specification (https://www.first.org/cvss/specification-document),
-// Table 14. The Negligible level is set for CVSS scores between [0, 1),
-// replacing the specified None level, originally used for a score of 0.
-func scoreToPriority(score float64) types.Priority {
-	switch {
-	case score < 1.0:
-		return types.Negligible
-	case score < 3.9:
-		return types.Low
-	case score < 6.9:
-		return types.Medium
-	case score < 8.9:
-		return types.High
-	case score <= 10:
-		return types.Critical
-	}
-	return types.Unknown
-}
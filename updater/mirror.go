@@ -0,0 +1,67 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updater
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+// mirrorFlagName is the key of the version of the last bundle that has been mirrored.
+const mirrorFlagName = "updater/mirror"
+
+// Mirror updates the vulnerabilities from the configured bundle, typically the feed of another
+// Clair instance, instead of the registered fetchers, and then sends notifications. The bundle is
+// skipped when it has the version of the last one mirrored. Like the fetchers, the bundle only
+// adds or updates vulnerabilities: the ones that it no longer has are kept.
+func Mirror(datastore database.Datastore, firstUpdate bool, config *config.UpdaterConfig) {
+	defer setUpdaterDuration(time.Now())
+
+	log.Infof("mirroring vulnerability bundle %s", config.Bundle.URL)
+
+	lastVersion, err := datastore.GetKeyValue(mirrorFlagName)
+	if err != nil {
+		promUpdaterErrorsTotal.Inc()
+		log.Errorf("could not get the version of the last mirrored vulnerability bundle: %s", err)
+		return
+	}
+
+	pruned := pruneUnusedNamespaces(datastore, config.PruneGracePeriod, time.Now())
+	header, count, err := fetchBundle(datastore, config, lastVersion, !firstUpdate, pruned)
+	if err != nil {
+		promUpdaterErrorsTotal.Inc()
+		log.Errorf("could not mirror vulnerability bundle: %s", err)
+		return
+	}
+
+	// Archive the vulnerabilities of end-of-life namespaces.
+	archive(datastore, config.ArchivedNamespaces)
+
+	if header.Version != lastVersion {
+		if err := datastore.InsertKeyValue(mirrorFlagName, header.Version); err != nil {
+			promUpdaterErrorsTotal.Inc()
+			log.Errorf("could not store the version of the mirrored vulnerability bundle: %s", err)
+			return
+		}
+		log.Infof("mirrored %d vulnerabilities of bundle %s, created %v", count, header.Version, header.Created)
+	} else {
+		log.Infof("vulnerability bundle %s is already mirrored", header.Version)
+	}
+
+	datastore.InsertKeyValue(flagName, strconv.FormatInt(time.Now().UTC().Unix(), 10))
+}
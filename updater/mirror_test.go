@@ -0,0 +1,139 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updater
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/attestation"
+	"github.com/coreos/clair/bundle"
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+func TestMirror(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clair-mirror")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	signer, err := attestation.NewSigner(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if !assert.Nil(t, err) {
+		return
+	}
+	publicDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	keyPath := filepath.Join(dir, "feed.pub")
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0600)
+
+	// The feed of the hub, whose bundle changes with its updates.
+	var content, signature []byte
+	publish := func(version string, names ...string) {
+		var buf bytes.Buffer
+		w, _ := bundle.NewWriter(&buf, bundle.Header{Version: version, Created: time.Now().UTC()})
+		for _, name := range names {
+			w.Write(database.Vulnerability{Name: name, Namespace: database.Namespace{Name: "debian:8"}})
+		}
+		w.Close()
+		content = buf.Bytes()
+		signature, _ = signer.SignBlob(w.Digest())
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/feed/vulnerabilities.ndjson.gz":
+			rw.Write(content)
+		case "/v2/feed/vulnerabilities.ndjson.gz.sig":
+			rw.Write(signature)
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+	defer server.Close()
+	defer func(transport http.RoundTripper) { bundleTransport = transport }(bundleTransport)
+	bundleTransport = server.Client().Transport
+
+	flags := map[string]string{}
+	var inserted []database.Vulnerability
+	var notified bool
+	datastore := &database.MockDatastore{
+		FctInsertVulnerabilities: func(vulnerabilities []database.Vulnerability, createNotification bool) error {
+			notified = createNotification
+			inserted = append(inserted, vulnerabilities...)
+			return nil
+		},
+		FctInsertKeyValue: func(key, value string) error {
+			flags[key] = value
+			return nil
+		},
+		FctGetKeyValue: func(key string) (string, error) {
+			return flags[key], nil
+		},
+	}
+	cfg := &config.UpdaterConfig{
+		Bundle: &config.BundleConfig{
+			URL:    server.URL + "/v2/feed/vulnerabilities.ndjson.gz",
+			Keys:   []string{keyPath},
+			Mirror: true,
+		},
+	}
+
+	// The first update doesn't notify.
+	publish("20161017T120000Z", "CVE-1")
+	Mirror(datastore, true, cfg)
+	if assert.Len(t, inserted, 1) {
+		assert.False(t, notified)
+		assert.Equal(t, "20161017T120000Z", flags[mirrorFlagName])
+		assert.NotEmpty(t, flags[flagName])
+	}
+
+	// Unchanged bundles are skipped, but still count as an update.
+	inserted, flags[flagName] = nil, ""
+	Mirror(datastore, false, cfg)
+	assert.Empty(t, inserted)
+	assert.NotEmpty(t, flags[flagName])
+
+	// The next bundles notify.
+	publish("20161017T130000Z", "CVE-1", "CVE-2")
+	Mirror(datastore, false, cfg)
+	if assert.Len(t, inserted, 2) {
+		assert.True(t, notified)
+		assert.Equal(t, "20161017T130000Z", flags[mirrorFlagName])
+	}
+
+	// Nothing is mirrored from a bundle whose signature isn't valid, which isn't an update.
+	inserted, flags[flagName] = nil, ""
+	publish("20161017T140000Z", "CVE-3")
+	signature = []byte("invalid")
+	Mirror(datastore, false, cfg)
+	assert.Empty(t, inserted)
+	assert.Empty(t, flags[flagName])
+	assert.Equal(t, "20161017T130000Z", flags[mirrorFlagName])
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updater
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/logging"
+)
+
+// unusedFlagName is the flag storing the times since which the namespaces have been unused, by
+// name, as Unix timestamps.
+const unusedFlagName = "updater/unused"
+
+var (
+	promUpdaterPrunedNamespacesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_updater_pruned_namespaces_total",
+		Help: "Number of times that the data of an unused namespace has been removed.",
+	})
+
+	promUpdaterPrunedRowsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clair_updater_pruned_rows_total",
+		Help: "Number of vulnerabilities, features and feature versions removed with the unused namespaces.",
+	}, []string{"kind"})
+
+	promUpdaterReclaimedBytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_updater_reclaimed_bytes_total",
+		Help: "Estimated space reclaimed by removing the data of the unused namespaces.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(promUpdaterPrunedNamespacesTotal)
+	prometheus.MustRegister(promUpdaterPrunedRowsTotal)
+	prometheus.MustRegister(promUpdaterReclaimedBytesTotal)
+}
+
+// pruneUnusedNamespaces removes the vulnerabilities and features of the namespaces that no layer
+// has used for the grace period, and returns the pruned namespaces, whose vulnerabilities must not
+// be stored again until a layer uses them. Nothing is pruned if the grace period is zero.
+func pruneUnusedNamespaces(datastore database.Datastore, gracePeriod time.Duration, now time.Time) map[string]struct{} {
+	if gracePeriod <= 0 {
+		return nil
+	}
+
+	unused, err := datastore.ListUnusedNamespaces()
+	if err != nil {
+		promUpdaterErrorsTotal.Inc()
+		log.Errorf("an error occured when listing the unused namespaces: %s", err)
+		return nil
+	}
+
+	since := make(map[string]int64)
+	if value, err := datastore.GetKeyValue(unusedFlagName); err != nil {
+		promUpdaterErrorsTotal.Inc()
+		log.Errorf("an error occured when getting the unused namespaces: %s", err)
+		return nil
+	} else if value != "" {
+		if err := json.Unmarshal([]byte(value), &since); err != nil {
+			log.Warningf("could not parse the unused namespaces, starting their grace periods over: %s", err)
+		}
+	}
+
+	// Only the namespaces that are still unused are remembered, so that the grace period of a
+	// namespace that gets used again starts over.
+	pruned := make(map[string]struct{})
+	unusedSince := make(map[string]int64, len(unused))
+	for _, namespace := range unused {
+		timestamp, ok := since[namespace.Name]
+		if !ok {
+			timestamp = now.Unix()
+		}
+		unusedSince[namespace.Name] = timestamp
+		if now.Sub(time.Unix(timestamp, 0)) < gracePeriod {
+			continue
+		}
+
+		stats, err := datastore.PruneNamespace(namespace.Name)
+		if err == database.ErrNamespaceInUse {
+			delete(unusedSince, namespace.Name)
+			continue
+		} else if err != nil {
+			promUpdaterErrorsTotal.Inc()
+			log.With(logging.Fields{"namespace": namespace.Name}).Errorf("an error occured when pruning the namespace: %s", err)
+			continue
+		}
+		pruned[namespace.Name] = struct{}{}
+
+		if stats.Vulnerabilities+stats.Features+stats.FeatureVersions == 0 {
+			continue
+		}
+		promUpdaterPrunedNamespacesTotal.Inc()
+		promUpdaterPrunedRowsTotal.WithLabelValues("vulnerabilities").Add(float64(stats.Vulnerabilities))
+		promUpdaterPrunedRowsTotal.WithLabelValues("features").Add(float64(stats.Features))
+		promUpdaterPrunedRowsTotal.WithLabelValues("featureversions").Add(float64(stats.FeatureVersions))
+		promUpdaterReclaimedBytesTotal.Add(float64(stats.Bytes))
+		log.With(logging.Fields{"namespace": namespace.Name}).Infof("pruned the unused namespace: removed %d vulnerabilities, %d features and %d feature versions (%d bytes)", stats.Vulnerabilities, stats.Features, stats.FeatureVersions, stats.Bytes)
+	}
+
+	value, _ := json.Marshal(unusedSince)
+	if err := datastore.InsertKeyValue(unusedFlagName, string(value)); err != nil {
+		promUpdaterErrorsTotal.Inc()
+		log.Errorf("an error occured when storing the unused namespaces: %s", err)
+	}
+
+	return pruned
+}
+
+// filterPrunedNamespaces removes the vulnerabilities that belong to pruned namespaces.
+func filterPrunedNamespaces(vulnerabilities []database.Vulnerability, pruned map[string]struct{}) []database.Vulnerability {
+	if len(pruned) == 0 {
+		return vulnerabilities
+	}
+
+	filtered := vulnerabilities[:0]
+	for _, vulnerability := range vulnerabilities {
+		if _, ok := pruned[vulnerability.Namespace.Name]; !ok {
+			filtered = append(filtered, vulnerability)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updater
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+)
+
+func TestPruneUnusedNamespaces(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	flags := map[string]string{}
+	var prunedNames []string
+
+	datastore := &database.MockDatastore{
+		FctListUnusedNamespaces: func() ([]database.Namespace, error) {
+			return []database.Namespace{{Name: "Namespace1"}, {Name: "Namespace2"}, {Name: "Namespace3"}}, nil
+		},
+		FctGetKeyValue: func(key string) (string, error) {
+			return flags[key], nil
+		},
+		FctInsertKeyValue: func(key, value string) error {
+			flags[key] = value
+			return nil
+		},
+		FctPruneNamespace: func(name string) (database.PrunedNamespace, error) {
+			if name == "Namespace3" {
+				return database.PrunedNamespace{}, database.ErrNamespaceInUse
+			}
+			prunedNames = append(prunedNames, name)
+			return database.PrunedNamespace{Vulnerabilities: 1}, nil
+		},
+	}
+
+	// Nothing is pruned when pruning is disabled.
+	assert.Empty(t, pruneUnusedNamespaces(datastore, 0, now))
+	assert.Empty(t, flags)
+
+	// The grace period of the namespaces starts when they are first seen unused.
+	flags[unusedFlagName] = `{"Namespace1": 1, "Namespace3": 1, "Namespace4": 1}`
+	pruned := pruneUnusedNamespaces(datastore, time.Hour, now)
+	assert.Equal(t, map[string]struct{}{"Namespace1": {}}, pruned)
+	assert.Equal(t, []string{"Namespace1"}, prunedNames)
+
+	// The namespaces that are used again are forgotten.
+	var unusedSince map[string]int64
+	if assert.Nil(t, json.Unmarshal([]byte(flags[unusedFlagName]), &unusedSince)) {
+		assert.Equal(t, map[string]int64{"Namespace1": 1, "Namespace2": now.Unix()}, unusedSince)
+	}
+
+	vulnerabilities := []database.Vulnerability{
+		{Name: "Vulnerability1", Namespace: database.Namespace{Name: "Namespace1"}},
+		{Name: "Vulnerability2", Namespace: database.Namespace{Name: "Namespace2"}},
+	}
+	filtered := filterPrunedNamespaces(vulnerabilities, pruned)
+	if assert.Len(t, filtered, 1) {
+		assert.Equal(t, "Vulnerability2", filtered[0].Name)
+	}
+}
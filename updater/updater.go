@@ -18,16 +18,22 @@ package updater
 
 import (
 	"math/rand"
+	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/coreos/clair/config"
 	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/health"
+	"github.com/coreos/clair/logging"
+	"github.com/coreos/clair/tracing"
 	"github.com/coreos/clair/utils"
-	"github.com/coreos/pkg/capnslog"
+	cerrors "github.com/coreos/clair/utils/errors"
 	"github.com/pborman/uuid"
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -37,10 +43,12 @@ const (
 	lockName            = "updater"
 	lockDuration        = refreshLockDuration + time.Minute*2
 	refreshLockDuration = time.Minute * 8
+
+	errorRetryInterval = time.Minute
 )
 
 var (
-	log = capnslog.NewPackageLogger("github.com/coreos/clair", "updater")
+	log = logging.New("updater")
 
 	promUpdaterErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "clair_updater_errors_total",
@@ -56,12 +64,18 @@ var (
 		Name: "clair_updater_notes_total",
 		Help: "Number of notes that the vulnerability fetchers generated.",
 	})
+
+	promUpdaterArchivedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_updater_archived_vulnerabilities_total",
+		Help: "Number of vulnerabilities that have been moved to the archive.",
+	})
 )
 
 func init() {
 	prometheus.MustRegister(promUpdaterErrorsTotal)
 	prometheus.MustRegister(promUpdaterDurationSeconds)
 	prometheus.MustRegister(promUpdaterNotesTotal)
+	prometheus.MustRegister(promUpdaterArchivedTotal)
 }
 
 // Run updates the vulnerability database at regular intervals.
@@ -74,22 +88,53 @@ func Run(config *config.UpdaterConfig, datastore database.Datastore, st *utils.S
 		return
 	}
 
+	// Remove the disabled fetchers, then configure the registered fetchers that need it.
+	for _, name := range config.DisabledFetchers {
+		if _, ok := fetchers[name]; !ok {
+			log.Warningf("could not disable unknown fetcher '%s'", name)
+			continue
+		}
+		delete(fetchers, name)
+		log.Infof("fetcher '%s' disabled", name)
+	}
+	for _, pattern := range config.Namespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Errorf("invalid namespace pattern '%s': %s", pattern, err)
+		}
+	}
+	for name, fetcher := range fetchers {
+		fetcher, ok := fetcher.(ConfigurableFetcher)
+		if !ok {
+			continue
+		}
+		if configured, err := fetcher.Configure(config); configured {
+			log.Infof("fetcher '%s' configured", name)
+		} else {
+			delete(fetchers, name)
+			if err != nil {
+				log.Errorf("could not configure fetcher '%s': %s", name, err)
+			}
+		}
+	}
+
+	// Reject the options that no fetcher has, e.g. misspelled ones, rather than ignoring them. The
+	// disabled fetchers keep theirs.
+	if unknown := config.UnknownParams(config.DisabledFetchers); len(unknown) > 0 {
+		log.Fatalf("unknown updater options: %s", strings.Join(unknown, ", "))
+	}
+
 	whoAmI := uuid.New()
 	log.Infof("updater service started. lock identifier: %s", whoAmI)
+	health.Register("updater", checkHealth(datastore, config.Interval, time.Now), false)
+	defer health.Unregister("updater")
+	if config.Bundle != nil && config.Bundle.Mirror {
+		log.Infof("updater service mirrors vulnerability bundle %s, fetchers won't run", config.Bundle.URL)
+	}
 
 	for {
 		var stop bool
 
-		// Determine if this is the first update and define the next update time.
-		// The next update time is (last update time + interval) or now if this is the first update.
-		nextUpdate := time.Now().UTC()
-		lastUpdate, firstUpdate, err := getLastUpdate(datastore)
-		if err != nil {
-			log.Errorf("an error occured while getting the last update time")
-			nextUpdate = nextUpdate.Add(config.Interval)
-		} else if firstUpdate == false {
-			nextUpdate = lastUpdate.Add(config.Interval)
-		}
+		nextUpdate, firstUpdate := scheduleUpdate(datastore, config.Interval, time.Now().UTC())
 
 		// If the next update timer is in the past, then try to update.
 		if nextUpdate.Before(time.Now().UTC()) {
@@ -100,7 +145,13 @@ func Run(config *config.UpdaterConfig, datastore database.Datastore, st *utils.S
 				// Launch update in a new go routine.
 				doneC := make(chan bool, 1)
 				go func() {
-					Update(datastore, firstUpdate)
+					// An empty database is initialized with the bundle, if any, and updated
+					// right after when the bundle is older than the interval.
+					if config.Bundle != nil && config.Bundle.Mirror {
+						Mirror(datastore, firstUpdate, config)
+					} else if !firstUpdate || !importBundle(datastore, config) {
+						Update(datastore, firstUpdate, config)
+					}
 					doneC <- true
 				}()
 
@@ -157,19 +208,46 @@ func Run(config *config.UpdaterConfig, datastore database.Datastore, st *utils.S
 	log.Info("updater service stopped")
 }
 
+// scheduleUpdate determines if this is the first update and defines the next update time.
+// The next update time is (last update time + interval) or now if this is the first update.
+func scheduleUpdate(datastore database.Datastore, interval time.Duration, now time.Time) (nextUpdate time.Time, firstUpdate bool) {
+	lastUpdate, firstUpdate, err := LastUpdate(datastore)
+	if err != nil {
+		// The database may be temporarily unavailable (e.g. failing over), retry soon instead
+		// of skipping a whole interval.
+		log.Errorf("an error occured while getting the last update time: %s", err)
+		return now.Add(errorRetryInterval), false
+	}
+	if firstUpdate {
+		return now, true
+	}
+	return lastUpdate.Add(interval), false
+}
+
 // Update fetches all the vulnerabilities from the registered fetchers, upserts
-// them into the database and then sends notifications.
-func Update(datastore database.Datastore, firstUpdate bool) {
+// them into the database and then sends notifications. The vulnerabilities of
+// the namespaces that aren't configured are ignored, and the ones of the
+// archived namespaces are ignored and moved to the archive. The unused
+// namespaces are pruned once their grace period is over.
+func Update(datastore database.Datastore, firstUpdate bool, config *config.UpdaterConfig) {
 	defer setUpdaterDuration(time.Now())
 
+	ctx, span := tracing.Start(context.Background(), "updater.Update", tracing.KindInternal)
+	var err error
+	defer func() { span.End(err) }()
+	datastore = tracing.Datastore(ctx, datastore)
+
 	log.Info("updating vulnerabilities")
 
 	// Fetch updates.
-	status, vulnerabilities, flags, notes := fetch(datastore)
+	status, vulnerabilities, falsePositives, flags, notes := fetch(ctx, datastore)
+	vulnerabilities = filterNamespaces(vulnerabilities, config.Namespaces)
+	vulnerabilities = filterArchivedNamespaces(vulnerabilities, config.ArchivedNamespaces)
+	vulnerabilities = filterPrunedNamespaces(vulnerabilities, pruneUnusedNamespaces(datastore, config.PruneGracePeriod, time.Now()))
 
 	// Insert vulnerabilities.
 	log.Tracef("inserting %d vulnerabilities for update", len(vulnerabilities))
-	err := datastore.InsertVulnerabilities(vulnerabilities, !firstUpdate)
+	err = datastore.InsertVulnerabilities(vulnerabilities, !firstUpdate)
 	if err != nil {
 		promUpdaterErrorsTotal.Inc()
 		log.Errorf("an error occured when inserting vulnerabilities for update: %s", err)
@@ -177,6 +255,9 @@ func Update(datastore database.Datastore, firstUpdate bool) {
 	}
 	vulnerabilities = nil
 
+	// Flag the findings that the feeds state are not affected.
+	flagFalsePositives(datastore, falsePositives)
+
 	// Update flags.
 	for flagName, flagValue := range flags {
 		datastore.InsertKeyValue(flagName, flagValue)
@@ -188,6 +269,9 @@ func Update(datastore database.Datastore, firstUpdate bool) {
 	}
 	promUpdaterNotesTotal.Set(float64(len(notes)))
 
+	// Archive the vulnerabilities of end-of-life namespaces.
+	archive(datastore, config.ArchivedNamespaces)
+
 	// Update last successful update if every fetchers worked properly.
 	if status {
 		datastore.InsertKeyValue(flagName, strconv.FormatInt(time.Now().UTC().Unix(), 10))
@@ -196,13 +280,114 @@ func Update(datastore database.Datastore, firstUpdate bool) {
 	log.Info("update finished")
 }
 
+// archive moves the vulnerabilities of the specified namespaces to the archive.
+func archive(datastore database.Datastore, namespaces []string) {
+	for _, namespace := range namespaces {
+		count, err := datastore.ArchiveVulnerabilities(namespace)
+		if err == cerrors.ErrNotFound {
+			continue
+		} else if err != nil {
+			promUpdaterErrorsTotal.Inc()
+			log.With(logging.Fields{"namespace": namespace}).Errorf("an error occured when archiving the vulnerabilities of the namespace: %s", err)
+			continue
+		}
+
+		if count > 0 {
+			log.With(logging.Fields{"namespace": namespace}).Infof("archived %d vulnerabilities of the namespace", count)
+			promUpdaterArchivedTotal.Add(float64(count))
+		}
+	}
+}
+
+// flagFalsePositives flags the given findings of the known vulnerabilities as false positives.
+// Findings that are already flagged, e.g. by users, keep their flag and its reason.
+func flagFalsePositives(datastore database.Datastore, falsePositives []database.FalsePositive) {
+	for _, falsePositive := range falsePositives {
+		vulnerability, err := datastore.FindVulnerability(falsePositive.Namespace.Name, falsePositive.VulnerabilityName)
+		if err == cerrors.ErrNotFound {
+			continue
+		} else if err != nil {
+			promUpdaterErrorsTotal.Inc()
+			log.With(logging.Fields{"vulnerability": falsePositive.VulnerabilityName}).Errorf("an error occured when finding the vulnerability to flag a false positive: %s", err)
+			continue
+		}
+
+		flagged, err := datastore.FindFalsePositives([]database.Vulnerability{vulnerability})
+		if err != nil {
+			promUpdaterErrorsTotal.Inc()
+			log.With(logging.Fields{"vulnerability": falsePositive.VulnerabilityName}).Errorf("an error occured when finding the false positives of the vulnerability: %s", err)
+			continue
+		}
+		if isFlagged(flagged, falsePositive) {
+			continue
+		}
+
+		falsePositive.Namespace = vulnerability.Namespace
+		if _, err := datastore.InsertFalsePositive(falsePositive); err != nil {
+			promUpdaterErrorsTotal.Inc()
+			log.With(logging.Fields{"vulnerability": falsePositive.VulnerabilityName}).Errorf("an error occured when flagging a false positive of the vulnerability: %s", err)
+		}
+	}
+}
+
+// isFlagged returns whether the finding of the given FalsePositive is one of the flagged ones.
+func isFlagged(flagged []database.FalsePositive, falsePositive database.FalsePositive) bool {
+	for _, f := range flagged {
+		if f.Namespace.Name == falsePositive.Namespace.Name && f.VulnerabilityName == falsePositive.VulnerabilityName &&
+			f.FeatureName == falsePositive.FeatureName && f.FeatureVersion == falsePositive.FeatureVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// filterNamespaces keeps the vulnerabilities whose namespace matches one of the given patterns, if
+// any.
+func filterNamespaces(vulnerabilities []database.Vulnerability, patterns []string) []database.Vulnerability {
+	if len(patterns) == 0 {
+		return vulnerabilities
+	}
+
+	filtered := vulnerabilities[:0]
+	for _, vulnerability := range vulnerabilities {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, vulnerability.Namespace.Name); matched {
+				filtered = append(filtered, vulnerability)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// filterArchivedNamespaces removes the vulnerabilities that belong to archived namespaces.
+func filterArchivedNamespaces(vulnerabilities []database.Vulnerability, archivedNamespaces []string) []database.Vulnerability {
+	if len(archivedNamespaces) == 0 {
+		return vulnerabilities
+	}
+
+	archived := make(map[string]struct{}, len(archivedNamespaces))
+	for _, namespace := range archivedNamespaces {
+		archived[namespace] = struct{}{}
+	}
+
+	filtered := vulnerabilities[:0]
+	for _, vulnerability := range vulnerabilities {
+		if _, ok := archived[vulnerability.Namespace.Name]; !ok {
+			filtered = append(filtered, vulnerability)
+		}
+	}
+	return filtered
+}
+
 func setUpdaterDuration(start time.Time) {
 	promUpdaterDurationSeconds.Set(time.Since(start).Seconds())
 }
 
 // fetch get data from the registered fetchers, in parallel.
-func fetch(datastore database.Datastore) (bool, []database.Vulnerability, map[string]string, []string) {
+func fetch(ctx context.Context, datastore database.Datastore) (bool, []database.Vulnerability, []database.FalsePositive, map[string]string, []string) {
 	var vulnerabilities []database.Vulnerability
+	var falsePositives []database.FalsePositive
 	var notes []string
 	status := true
 	flags := make(map[string]string)
@@ -212,10 +397,13 @@ func fetch(datastore database.Datastore) (bool, []database.Vulnerability, map[st
 	var responseC = make(chan *FetcherResponse, 0)
 	for n, f := range fetchers {
 		go func(name string, fetcher Fetcher) {
-			response, err := fetcher.FetchUpdate(datastore)
+			ctx, span := tracing.Start(ctx, "updater.fetch", tracing.KindInternal)
+			span.SetAttribute("fetcher", name)
+			response, err := fetcher.FetchUpdate(tracing.Datastore(ctx, datastore))
+			span.End(err)
 			if err != nil {
 				promUpdaterErrorsTotal.Inc()
-				log.Errorf("an error occured when fetching update '%s': %s.", name, err)
+				log.With(logging.Fields{"fetcher": name}).Errorf("an error occured when fetching the update: %s.", err)
 				status = false
 				responseC <- nil
 				return
@@ -229,7 +417,8 @@ func fetch(datastore database.Datastore) (bool, []database.Vulnerability, map[st
 	for i := 0; i < len(fetchers); i++ {
 		resp := <-responseC
 		if resp != nil {
-			vulnerabilities = append(vulnerabilities, doVulnerabilitiesNamespacing(resp.Vulnerabilities)...)
+			vulnerabilities = append(vulnerabilities, addSource(doVulnerabilitiesNamespacing(resp.Vulnerabilities), resp.Source)...)
+			falsePositives = append(falsePositives, resp.FalsePositives...)
 			notes = append(notes, resp.Notes...)
 			if resp.FlagName != "" && resp.FlagValue != "" {
 				flags[resp.FlagName] = resp.FlagValue
@@ -238,7 +427,20 @@ func fetch(datastore database.Datastore) (bool, []database.Vulnerability, map[st
 	}
 
 	close(responseC)
-	return status, addMetadata(datastore, vulnerabilities), flags, notes
+	return status, addMetadata(datastore, vulnerabilities), falsePositives, flags, notes
+}
+
+// addSource attributes the specified vulnerabilities to the given source.
+func addSource(vulnerabilities []database.Vulnerability, source database.VulnerabilitySource) []database.Vulnerability {
+	if source.Name == "" {
+		return vulnerabilities
+	}
+
+	for i := range vulnerabilities {
+		vulnerabilities[i].Sources = database.VulnerabilitySources{source}
+	}
+
+	return vulnerabilities
 }
 
 // Add metadata to the specified vulnerabilities using the registered MetadataFetchers, in parallel.
@@ -268,7 +470,7 @@ func addMetadata(datastore database.Datastore, vulnerabilities []database.Vulner
 			// Load the metadata fetcher.
 			if err := metadataFetcher.Load(datastore); err != nil {
 				promUpdaterErrorsTotal.Inc()
-				log.Errorf("an error occured when loading metadata fetcher '%s': %s.", name, err)
+				log.With(logging.Fields{"fetcher": name}).Errorf("an error occured when loading the metadata fetcher: %s.", err)
 				return
 			}
 
@@ -286,7 +488,9 @@ func addMetadata(datastore database.Datastore, vulnerabilities []database.Vulner
 	return vulnerabilities
 }
 
-func getLastUpdate(datastore database.Datastore) (time.Time, bool, error) {
+// LastUpdate returns the time of the last update in which every fetcher succeeded, or whether
+// there has been none yet.
+func LastUpdate(datastore database.Datastore) (time.Time, bool, error) {
 	lastUpdateTSS, err := datastore.GetKeyValue(flagName)
 	if err != nil {
 		return time.Time{}, false, err
@@ -16,11 +16,15 @@ package updater
 
 import (
 	"fmt"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/database/testutil"
+	cerrors "github.com/coreos/clair/utils/errors"
 )
 
 func TestDoVulnerabilitiesNamespacing(t *testing.T) {
@@ -69,3 +73,119 @@ func TestDoVulnerabilitiesNamespacing(t *testing.T) {
 		}
 	}
 }
+
+func TestFilterArchivedNamespaces(t *testing.T) {
+	vulnerabilities := []database.Vulnerability{
+		{Name: "Vulnerability1", Namespace: database.Namespace{Name: "Namespace1"}},
+		{Name: "Vulnerability2", Namespace: database.Namespace{Name: "Namespace2"}},
+		{Name: "Vulnerability3", Namespace: database.Namespace{Name: "Namespace1"}},
+	}
+
+	assert.Len(t, filterArchivedNamespaces(vulnerabilities, nil), 3)
+
+	filtered := filterArchivedNamespaces(vulnerabilities, []string{"Namespace1"})
+	if assert.Len(t, filtered, 1) {
+		assert.Equal(t, "Vulnerability2", filtered[0].Name)
+	}
+}
+
+func TestFilterNamespaces(t *testing.T) {
+	vulnerabilities := []database.Vulnerability{
+		{Name: "Vulnerability1", Namespace: database.Namespace{Name: "ubuntu:22.04"}},
+		{Name: "Vulnerability2", Namespace: database.Namespace{Name: "ubuntu:16.04"}},
+		{Name: "Vulnerability3", Namespace: database.Namespace{Name: "debian:12"}},
+		{Name: "Vulnerability4", Namespace: database.Namespace{Name: "centos:7"}},
+	}
+
+	assert.Len(t, filterNamespaces(vulnerabilities, nil), 4)
+
+	filtered := filterNamespaces(vulnerabilities, []string{"ubuntu:22.04", "debian:*"})
+	if assert.Len(t, filtered, 2) {
+		assert.Equal(t, "Vulnerability1", filtered[0].Name)
+		assert.Equal(t, "Vulnerability3", filtered[1].Name)
+	}
+}
+
+func TestAddSource(t *testing.T) {
+	vulnerabilities := []database.Vulnerability{
+		{Name: "Vulnerability1"},
+		{Name: "Vulnerability2"},
+	}
+
+	assert.Empty(t, addSource(vulnerabilities, database.VulnerabilitySource{})[0].Sources)
+
+	source := database.VulnerabilitySource{Name: "Source1", URL: "http://example.com", License: "CC-BY-4.0"}
+	for _, vulnerability := range addSource(vulnerabilities, source) {
+		assert.Equal(t, database.VulnerabilitySources{source}, vulnerability.Sources)
+	}
+
+	// Appending to the sources of a vulnerability must not affect the others.
+	vulnerabilities[0].Sources = append(vulnerabilities[0].Sources, database.VulnerabilitySource{Name: "Source2"})
+	assert.Len(t, vulnerabilities[1].Sources, 1)
+}
+
+func TestFlagFalsePositives(t *testing.T) {
+	namespace := database.Namespace{Name: "Namespace1", VersionFormat: "dpkg"}
+	flagged := database.FalsePositive{
+		Namespace:         database.Namespace{Name: "Namespace1"},
+		VulnerabilityName: "Vulnerability1",
+		FeatureName:       "Feature1",
+		FeatureVersion:    "0.1",
+		Reason:            "user",
+	}
+
+	var inserted []database.FalsePositive
+	datastore := &database.MockDatastore{
+		FctFindVulnerability: func(namespaceName, name string) (database.Vulnerability, error) {
+			if name != "Vulnerability1" {
+				return database.Vulnerability{}, cerrors.ErrNotFound
+			}
+			return database.Vulnerability{Name: name, Namespace: namespace}, nil
+		},
+		FctFindFalsePositives: func(vulnerabilities []database.Vulnerability) ([]database.FalsePositive, error) {
+			return []database.FalsePositive{flagged}, nil
+		},
+		FctInsertFalsePositive: func(falsePositive database.FalsePositive) (database.FalsePositive, error) {
+			inserted = append(inserted, falsePositive)
+			return falsePositive, nil
+		},
+	}
+
+	notFlagged := flagged
+	notFlagged.FeatureVersion, notFlagged.Reason = "0.2", "vendor"
+	unknown := notFlagged
+	unknown.VulnerabilityName = "Vulnerability2"
+	alreadyFlagged := flagged
+	alreadyFlagged.Reason = "vendor"
+
+	// Only the findings of known vulnerabilities that aren't flagged yet are flagged.
+	flagFalsePositives(datastore, []database.FalsePositive{notFlagged, unknown, alreadyFlagged})
+	if assert.Len(t, inserted, 1) {
+		assert.Equal(t, "0.2", inserted[0].FeatureVersion)
+		assert.Equal(t, "vendor", inserted[0].Reason)
+		assert.Equal(t, namespace, inserted[0].Namespace)
+	}
+}
+
+func TestScheduleUpdateRecovers(t *testing.T) {
+	now := time.Unix(1500000000, 0).UTC()
+	lastUpdate := now.Add(-time.Hour)
+	datastore := testutil.InjectFaults(&database.MockDatastore{
+		FctGetKeyValue: func(key string) (string, error) {
+			assert.Equal(t, flagName, key)
+			return strconv.FormatInt(lastUpdate.Unix(), 10), nil
+		},
+	}, testutil.Faults{ErrorRate: 1})
+
+	// While the database is unavailable, the update is retried soon rather than a whole interval
+	// later.
+	nextUpdate, firstUpdate := scheduleUpdate(datastore, 12*time.Hour, now)
+	assert.Equal(t, now.Add(errorRetryInterval), nextUpdate)
+	assert.False(t, firstUpdate)
+
+	// Once it is back, the updates are scheduled from the last one again.
+	datastore.SetFaults(testutil.Faults{})
+	nextUpdate, firstUpdate = scheduleUpdate(datastore, 12*time.Hour, now)
+	assert.Equal(t, lastUpdate.Add(12*time.Hour), nextUpdate)
+	assert.False(t, firstUpdate)
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"strings"
+
+	cerrors "github.com/coreos/clair/utils/errors"
+)
+
+var (
+	// ErrInvalidDigest occurs when a digest isn't the name of a supported algorithm followed by the
+	// hex-encoded hash, e.g. "sha256:…".
+	ErrInvalidDigest = cerrors.NewBadRequestError("utils: invalid digest, expected sha256:<hex> or sha512:<hex>")
+
+	// ErrDigestMismatch occurs when an archive doesn't have the digest it was expected to.
+	ErrDigestMismatch = cerrors.NewBadRequestError("utils: the archive doesn't match its digest")
+
+	// digestAlgorithms are the hash functions of the supported digests, by name.
+	digestAlgorithms = map[string]func() hash.Hash{
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+)
+
+// ValidateDigest returns ErrInvalidDigest if the given digest isn't supported.
+func ValidateDigest(digest string) error {
+	_, _, err := parseDigest(digest)
+	return err
+}
+
+// parseDigest returns a new hash of the algorithm of the given digest, and the expected sum.
+func parseDigest(digest string) (hash.Hash, []byte, error) {
+	i := strings.Index(digest, ":")
+	if i < 0 {
+		return nil, nil, ErrInvalidDigest
+	}
+	newHash, ok := digestAlgorithms[digest[:i]]
+	if !ok {
+		return nil, nil, ErrInvalidDigest
+	}
+
+	h := newHash()
+	sum, err := hex.DecodeString(digest[i+1:])
+	if err != nil || len(sum) != h.Size() {
+		return nil, nil, ErrInvalidDigest
+	}
+	return h, sum, nil
+}
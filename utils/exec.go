@@ -37,3 +37,27 @@ func Exec(dir string, bin string, args ...string) ([]byte, error) {
 	err = cmd.Run()
 	return buf.Bytes(), err
 }
+
+// LimitedBuffer is a buffer discarding what is written after its first Max bytes, e.g. to hold
+// the error output of a command without trusting its size.
+type LimitedBuffer struct {
+	// buf isn't embedded, as the io.ReaderFrom of a bytes.Buffer would bypass the limit in
+	// io.Copy.
+	buf bytes.Buffer
+	Max int
+}
+
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	if room := b.Max - b.buf.Len(); room < len(p) {
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// String returns the bytes that were kept.
+func (b *LimitedBuffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,391 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// ListingPath and DeletedPath are the paths under which Extract returns, when the Extractor lists
+// the archive, the paths of its files and the ones of the files of the lower layers it deletes, one
+// per line. No entry can have these paths, since ".." entries are rejected.
+const (
+	ListingPath = "../listing"
+	DeletedPath = "../deleted"
+)
+
+// whiteoutPrefix prefixes the names of the entries deleting the files of the lower layers with the
+// same name, and opaqueWhiteout is the name of the ones deleting everything in their directory.
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// maxLinkDepth is the number of links followed to find the content of an extracted link, beyond
+// which it is considered a loop.
+const maxLinkDepth = 16
+
+var (
+	// ErrInsecureArchive occurs when an archive has an entry whose path is absolute or escapes
+	// the root of the archive.
+	ErrInsecureArchive = errors.New("utils: could not extract the archive: an entry is outside of its root")
+
+	// ErrExtractedArchiveTooBig occurs when an archive is too big once decompressed.
+	ErrExtractedArchiveTooBig = errors.New("utils: could not extract the archive: archive too big")
+
+	// ErrExtractionCanceled occurs when the extraction of an archive is canceled.
+	ErrExtractionCanceled = errors.New("utils: could not extract the archive: canceled")
+)
+
+// Extractor extracts selected files from the possibly compressed tarball of a layer into
+// memory, nothing being ever written on disk.
+//
+// Layers are untrusted: the paths of the entries are normalized, the archives with absolute or
+// ".." entries are rejected, links are resolved within the archive and the decompressed size is
+// limited.
+type Extractor struct {
+	// Prefix is the directory of the archive holding the filesystem of the layer, e.g. "rootfs/".
+	// The entries outside of it are ignored.
+	Prefix string
+
+	// Files are the prefixes of the paths, relative to the filesystem of the layer, of the files
+	// to extract.
+	Files []string
+
+	// Names are the patterns, as in path.Match, of the trailing elements of the paths of the
+	// files to extract wherever they are, e.g. "vendor/composer/installed.json" for the
+	// dependencies of every PHP project or "*.deps.json" for the ones of every .NET application.
+	Names []string
+
+	// Optional are the prefixes of the paths of the files to extract only if they are not too
+	// big, e.g. executables searched for embedded metadata.
+	Optional []string
+
+	// List makes Extract also return the listings of the archive under ListingPath and
+	// DeletedPath.
+	List bool
+
+	// MaxFileSize is the size of the largest file that can be extracted; larger files fail the
+	// extraction, unless they are optional and skipped. Zero means no limit.
+	MaxFileSize int64
+
+	// MaxArchiveSize is the size of the largest decompressed archive that can be read, whether its
+	// files are extracted or not. Zero means no limit.
+	MaxArchiveSize int64
+
+	// Cancel, once closed, makes the extraction fail with ErrExtractionCanceled at the next read
+	// of the archive.
+	Cancel <-chan struct{}
+
+	// Stats, if not nil, is set to the statistics of the extraction once it succeeds.
+	Stats *ExtractStats
+
+	// Digest, if not empty, is the digest of the archive as it is read, e.g. "sha256:…". The whole
+	// archive is then read, and the extraction fails with ErrDigestMismatch if it doesn't match.
+	Digest string
+}
+
+// ExtractStats are the statistics of the extraction of an archive.
+type ExtractStats struct {
+	// BytesRead is the size of the decompressed archive, and Entries the number of its entries.
+	BytesRead int64
+	Entries   int
+
+	// Files is the number of extracted files, and FileBytes their size, the links to them
+	// excluded.
+	Files     int
+	FileBytes int64
+}
+
+// Extract extracts the selected files from the archive read from r and returns their content,
+// indexed by their path. The links are replaced with the content of their target when it is one
+// of the extracted files, and ignored otherwise.
+func (e Extractor) Extract(r io.Reader) (map[string][]byte, error) {
+	data := make(map[string][]byte)
+	links := make(map[string]string)
+	var listing, deleted []string
+	var stats ExtractStats
+	var tr *TarReadCloser
+	var err error
+
+	if e.Cancel != nil {
+		r = &cancelableReader{r: r, cancel: e.Cancel}
+	}
+
+	var digester hash.Hash
+	var sum []byte
+	if e.Digest != "" {
+		if digester, sum, err = parseDigest(e.Digest); err != nil {
+			return data, err
+		}
+		r = io.TeeReader(r, digester)
+	}
+
+	// Create a tar or tar/tar-gzip/tar-bzip2/tar-xz reader
+	tr, err = getTarReader(r, e.MaxArchiveSize)
+	if err != nil {
+		return data, extractError(err)
+	}
+	defer tr.Close()
+
+	// For each element in the archive
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return data, extractError(err)
+		}
+		stats.Entries++
+
+		filename, err := e.entryPath(hdr.Name)
+		if err != nil {
+			return data, err
+		}
+		if filename == "" {
+			continue
+		}
+		if e.List && hdr.Typeflag != tar.TypeDir {
+			switch name := path.Base(filename); {
+			case name == opaqueWhiteout:
+				deleted = append(deleted, path.Dir(filename))
+				continue
+			case strings.HasPrefix(name, whiteoutPrefix):
+				deleted = append(deleted, path.Join(path.Dir(filename), strings.TrimPrefix(name, whiteoutPrefix)))
+				continue
+			default:
+				listing = append(listing, filename)
+			}
+		}
+		if !e.selected(filename) {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			// File size limit
+			if e.MaxFileSize > 0 && hdr.Size > e.MaxFileSize {
+				if !e.required(filename) {
+					continue
+				}
+				return data, ErrExtractedFileTooBig
+			}
+
+			// The size of sparse files is the one of their holes; don't trust it.
+			content := io.Reader(tr)
+			if e.MaxFileSize > 0 {
+				content = io.LimitReader(tr, e.MaxFileSize+1)
+			}
+			d, err := ioutil.ReadAll(content)
+			if err != nil {
+				return data, extractError(err)
+			}
+			if e.MaxFileSize > 0 && int64(len(d)) > e.MaxFileSize {
+				if !e.required(filename) {
+					continue
+				}
+				return data, ErrExtractedFileTooBig
+			}
+
+			data[filename] = d
+			delete(links, filename)
+			stats.Files++
+			stats.FileBytes += int64(len(d))
+
+		case tar.TypeSymlink:
+			// The target of a symbolic link is resolved as if the layer was the root of the
+			// filesystem, so it can't escape it.
+			target := hdr.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(filename), target)
+			}
+			links[filename] = strings.TrimPrefix(path.Clean("/"+target), "/")
+			delete(data, filename)
+
+		case tar.TypeLink:
+			// The target of a hard link is an entry of the archive.
+			target, err := e.entryPath(hdr.Linkname)
+			if err != nil {
+				return data, err
+			}
+			if target == "" {
+				continue
+			}
+			links[filename] = target
+			delete(data, filename)
+		}
+	}
+
+	if digester != nil {
+		// The end of the archive, e.g. its padding or the end of its compressed stream, hasn't
+		// necessarily been read. The decompressor reads it first, as it may be running
+		// concurrently, e.g. xz.
+		if _, err := io.Copy(ioutil.Discard, tr.decompressed); err != nil {
+			return data, extractError(err)
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			return data, extractError(err)
+		}
+		if !bytes.Equal(digester.Sum(nil), sum) {
+			return data, ErrDigestMismatch
+		}
+	}
+
+	for filename := range links {
+		if d, ok := resolveLink(filename, links, data); ok {
+			data[filename] = d
+		}
+	}
+
+	if e.List {
+		data[ListingPath] = []byte(strings.Join(listing, "\n"))
+		data[DeletedPath] = []byte(strings.Join(deleted, "\n"))
+	}
+
+	if e.Stats != nil {
+		stats.BytesRead = tr.decompressed.read
+		*e.Stats = stats
+	}
+
+	return data, nil
+}
+
+// entryPath returns the normalized path of the entry of the archive with the given name,
+// relative to the filesystem of the layer, or "" if it is outside of it.
+func (e Extractor) entryPath(name string) (string, error) {
+	if path.IsAbs(name) {
+		return "", ErrInsecureArchive
+	}
+	for _, element := range strings.Split(name, "/") {
+		if element == ".." {
+			return "", ErrInsecureArchive
+		}
+	}
+
+	name = path.Clean(name)
+	if e.Prefix != "" {
+		prefix := path.Clean(e.Prefix) + "/"
+		if !strings.HasPrefix(name, prefix) {
+			return "", nil
+		}
+		name = strings.TrimPrefix(name, prefix)
+	}
+	if name == "." {
+		return "", nil
+	}
+
+	return name, nil
+}
+
+// selected returns whether the file at the given path is to be extracted.
+func (e Extractor) selected(filename string) bool {
+	return e.required(filename) || hasAnyPrefix(filename, e.Optional)
+}
+
+// required returns whether the file at the given path is to be extracted even if it is too big.
+func (e Extractor) required(filename string) bool {
+	if hasAnyPrefix(filename, e.Files) {
+		return true
+	}
+	for _, name := range e.Names {
+		if matchName(filename, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchName returns whether the trailing elements of the given path match the given pattern.
+func matchName(filename, pattern string) bool {
+	elements := strings.Split(filename, "/")
+	n := strings.Count(pattern, "/") + 1
+	if len(elements) < n {
+		return false
+	}
+	matched, _ := path.Match(pattern, strings.Join(elements[len(elements)-n:], "/"))
+	return matched
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveLink follows the link at the given path until an extracted file.
+func resolveLink(filename string, links map[string]string, data map[string][]byte) ([]byte, bool) {
+	for i := 0; i < maxLinkDepth; i++ {
+		target, ok := links[filename]
+		if !ok {
+			return nil, false
+		}
+		if d, ok := data[target]; ok {
+			return d, true
+		}
+		filename = target
+	}
+	return nil, false
+}
+
+// extractError returns the error to return for a failure to read an archive.
+func extractError(err error) error {
+	if err == ErrExtractedArchiveTooBig || err == ErrExtractionCanceled {
+		return err
+	}
+	return ErrCouldNotExtract
+}
+
+// sizeLimitedReader is an io.Reader counting the bytes read, and failing with
+// ErrExtractedArchiveTooBig once more than max bytes have been read, unless max is zero.
+type sizeLimitedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.max > 0 && l.read > l.max {
+		return n, ErrExtractedArchiveTooBig
+	}
+	return n, err
+}
+
+// cancelableReader is an io.Reader failing with ErrExtractionCanceled once cancel is closed.
+type cancelableReader struct {
+	r      io.Reader
+	cancel <-chan struct{}
+}
+
+func (c *cancelableReader) Read(p []byte) (int, error) {
+	select {
+	case <-c.cancel:
+		return 0, ErrExtractionCanceled
+	default:
+	}
+	return c.r.Read(p)
+}
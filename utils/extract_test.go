@@ -0,0 +1,309 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testEntry is an entry of an archive of the malicious archives corpus.
+type testEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+	size     int64
+}
+
+// newTestArchive returns a gzipped tarball made of the given entries.
+func newTestArchive(t *testing.T, entries ...testEntry) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.content))
+			if e.size > 0 {
+				hdr.Size = e.size
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if e.size > 0 {
+			if _, err := tw.Write(make([]byte, e.size)); err != nil {
+				t.Fatal(err)
+			}
+		} else if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractorMaliciousArchives(t *testing.T) {
+	osRelease := testEntry{name: "usr/lib/os-release", content: "ID=debian"}
+
+	for _, test := range []struct {
+		desc      string
+		prefix    string
+		entries   []testEntry
+		err       error
+		extracted map[string]string
+	}{
+		{
+			desc:    "absolute path",
+			entries: []testEntry{{name: "/etc/os-release", content: "ID=debian"}},
+			err:     ErrInsecureArchive,
+		},
+		{
+			desc:    "parent directory",
+			entries: []testEntry{{name: "../etc/os-release", content: "ID=debian"}},
+			err:     ErrInsecureArchive,
+		},
+		{
+			desc:    "zip slip",
+			entries: []testEntry{{name: "etc/../../../../tmp/evil", content: "evil"}},
+			err:     ErrInsecureArchive,
+		},
+		{
+			desc:    "unselected zip slip",
+			entries: []testEntry{osRelease, {name: "var/../../evil", content: "evil"}},
+			err:     ErrInsecureArchive,
+		},
+		{
+			desc:    "prefix escape",
+			prefix:  "rootfs/",
+			entries: []testEntry{{name: "rootfs/../etc/os-release", content: "ID=evil"}},
+			err:     ErrInsecureArchive,
+		},
+		{
+			desc:    "hard link escape",
+			entries: []testEntry{{name: "etc/os-release", typeflag: tar.TypeLink, linkname: "../../etc/shadow"}},
+			err:     ErrInsecureArchive,
+		},
+		{
+			desc:    "hard link to an absolute path",
+			entries: []testEntry{{name: "etc/os-release", typeflag: tar.TypeLink, linkname: "/etc/shadow"}},
+			err:     ErrInsecureArchive,
+		},
+		{
+			desc:      "redundant elements",
+			entries:   []testEntry{{name: "./etc//./os-release", content: "ID=debian"}},
+			extracted: map[string]string{"etc/os-release": "ID=debian"},
+		},
+		{
+			desc:      "outside of the prefix",
+			prefix:    "rootfs/",
+			entries:   []testEntry{{name: "etc/os-release", content: "ID=evil"}, {name: "rootfs/etc/os-release", content: "ID=debian"}},
+			extracted: map[string]string{"etc/os-release": "ID=debian"},
+		},
+		{
+			desc:      "relative symbolic link",
+			entries:   []testEntry{osRelease, {name: "etc/os-release", typeflag: tar.TypeSymlink, linkname: "../usr/lib/os-release"}},
+			extracted: map[string]string{"etc/os-release": "ID=debian", "usr/lib/os-release": "ID=debian"},
+		},
+		{
+			desc:      "absolute symbolic link",
+			entries:   []testEntry{osRelease, {name: "etc/os-release", typeflag: tar.TypeSymlink, linkname: "/usr/lib/os-release"}},
+			extracted: map[string]string{"etc/os-release": "ID=debian", "usr/lib/os-release": "ID=debian"},
+		},
+		{
+			desc:      "symbolic link escape",
+			entries:   []testEntry{osRelease, {name: "etc/os-release", typeflag: tar.TypeSymlink, linkname: "../../../../../usr/lib/os-release"}},
+			extracted: map[string]string{"etc/os-release": "ID=debian", "usr/lib/os-release": "ID=debian"},
+		},
+		{
+			desc:      "symbolic link outside of the extracted files",
+			entries:   []testEntry{{name: "etc/os-release", typeflag: tar.TypeSymlink, linkname: "/proc/self/environ"}},
+			extracted: map[string]string{},
+		},
+		{
+			desc:      "hard link",
+			entries:   []testEntry{osRelease, {name: "etc/os-release", typeflag: tar.TypeLink, linkname: "./usr/lib/os-release"}},
+			extracted: map[string]string{"etc/os-release": "ID=debian", "usr/lib/os-release": "ID=debian"},
+		},
+		{
+			desc: "symbolic link loop",
+			entries: []testEntry{
+				{name: "etc/os-release", typeflag: tar.TypeSymlink, linkname: "lsb-release"},
+				{name: "etc/lsb-release", typeflag: tar.TypeSymlink, linkname: "os-release"},
+			},
+			extracted: map[string]string{},
+		},
+		{
+			desc:      "link replaced by a file",
+			entries:   []testEntry{{name: "etc/os-release", typeflag: tar.TypeSymlink, linkname: "/etc/shadow"}, {name: "etc/os-release", content: "ID=debian"}},
+			extracted: map[string]string{"etc/os-release": "ID=debian"},
+		},
+		{
+			desc: "special files",
+			entries: []testEntry{
+				{name: "etc/os-release", typeflag: tar.TypeChar},
+				{name: "etc/lsb-release", typeflag: tar.TypeFifo},
+				{name: "etc/redhat-release", typeflag: tar.TypeDir},
+			},
+			extracted: map[string]string{},
+		},
+		{
+			desc:    "file too big",
+			entries: []testEntry{{name: "etc/os-release", size: 2048}},
+			err:     ErrExtractedFileTooBig,
+		},
+		{
+			desc:      "optional file too big",
+			entries:   []testEntry{{name: "usr/local/bin/big", size: 2048}, {name: "usr/local/bin/small", content: "ELF"}},
+			extracted: map[string]string{"usr/local/bin/small": "ELF"},
+		},
+		{
+			desc: "names",
+			entries: []testEntry{
+				{name: "var/www/vendor/composer/installed.json", content: "[]"},
+				{name: "vendor/composer/installed.json", content: "{}"},
+				{name: "var/www/myvendor/composer/installed.json", content: "[]"},
+				{name: "app/MyApp.deps.json", content: "{}"},
+				{name: "app/MyApp.runtimeconfig.json", content: "{}"},
+			},
+			extracted: map[string]string{
+				"var/www/vendor/composer/installed.json": "[]",
+				"vendor/composer/installed.json":         "{}",
+				"app/MyApp.deps.json":                    "{}",
+			},
+		},
+		{
+			desc:    "decompression bomb",
+			entries: []testEntry{osRelease, {name: "var/cache/bomb", size: 1 << 20}},
+			err:     ErrExtractedArchiveTooBig,
+		},
+	} {
+		extractor := Extractor{
+			Prefix:         test.prefix,
+			Files:          []string{"etc/", "usr/lib/os-release"},
+			Names:          []string{"vendor/composer/installed.json", "*.deps.json"},
+			Optional:       []string{"usr/local/bin/"},
+			MaxFileSize:    1024,
+			MaxArchiveSize: 64 * 1024,
+		}
+		data, err := extractor.Extract(bytes.NewReader(newTestArchive(t, test.entries...)))
+		if test.err != nil {
+			assert.Equal(t, test.err, err, test.desc)
+			continue
+		}
+		if assert.Nil(t, err, test.desc) {
+			extracted := make(map[string]string)
+			for name, d := range data {
+				extracted[name] = string(d)
+			}
+			assert.Equal(t, test.extracted, extracted, test.desc)
+		}
+	}
+}
+
+func TestExtractorListing(t *testing.T) {
+	extractor := Extractor{Files: []string{"etc/"}, List: true}
+	data, err := extractor.Extract(bytes.NewReader(newTestArchive(t,
+		testEntry{name: "usr/bin/", typeflag: tar.TypeDir},
+		testEntry{name: "usr/bin/curl", content: "ELF"},
+		testEntry{name: "usr/bin/wget", typeflag: tar.TypeSymlink, linkname: "curl"},
+		testEntry{name: "etc/os-release", content: "ID=debian"},
+		testEntry{name: "usr/lib/.wh.libfoo.so.1", content: ""},
+		testEntry{name: "usr/share/doc/.wh..wh..opq", content: ""},
+	)))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Directories aren't listed, and whiteouts are listed as the paths they delete.
+	assert.Equal(t, "usr/bin/curl\nusr/bin/wget\netc/os-release", string(data[ListingPath]))
+	assert.Equal(t, "usr/lib/libfoo.so.1\nusr/share/doc", string(data[DeletedPath]))
+	assert.Equal(t, "ID=debian", string(data["etc/os-release"]))
+	assert.Len(t, data, 3)
+}
+
+func TestExtractorCancel(t *testing.T) {
+	cancel := make(chan struct{})
+	close(cancel)
+
+	extractor := Extractor{Files: []string{"etc/"}, Cancel: cancel}
+	_, err := extractor.Extract(bytes.NewReader(newTestArchive(t, testEntry{name: "etc/os-release", content: "ID=debian"})))
+	assert.Equal(t, ErrExtractionCanceled, err)
+}
+
+func TestExtractorStats(t *testing.T) {
+	var stats ExtractStats
+	extractor := Extractor{Files: []string{"etc/"}, Stats: &stats}
+	_, err := extractor.Extract(bytes.NewReader(newTestArchive(t,
+		testEntry{name: "etc/", typeflag: tar.TypeDir},
+		testEntry{name: "etc/os-release", content: "ID=debian"},
+		testEntry{name: "etc/issue", typeflag: tar.TypeSymlink, linkname: "os-release"},
+		testEntry{name: "usr/bin/curl", content: "ELF"},
+	)))
+	if assert.Nil(t, err) {
+		assert.Equal(t, 4, stats.Entries)
+		assert.Equal(t, 1, stats.Files)
+		assert.Equal(t, int64(len("ID=debian")), stats.FileBytes)
+		// Every entry has a 512 bytes header, and the content of files is padded to 512 bytes.
+		assert.True(t, stats.BytesRead >= 6*512, "read %d bytes", stats.BytesRead)
+	}
+}
+
+func TestExtractorDigest(t *testing.T) {
+	_, f, _, _ := runtime.Caller(0)
+	for _, filename := range []string{"utils_test.tar.gz", "utils_test.tar.bz2", "utils_test.tar.xz", "utils_test.tar"} {
+		archive, err := ioutil.ReadFile(filepath.Join(filepath.Dir(f), "testdata", filename))
+		if !assert.Nil(t, err) {
+			continue
+		}
+		sum := sha256.Sum256(archive)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+
+		// The digest covers the whole archive, not only what the extraction needs.
+		data, err := Extractor{Files: []string{"test/"}, Digest: digest}.Extract(bytes.NewReader(archive))
+		if assert.Nil(t, err, filename) {
+			assert.Contains(t, data, "test/test.txt", filename)
+		}
+
+		other := sha256.Sum256(append(archive, 0))
+		_, err = Extractor{Files: []string{"test/"}, Digest: "sha256:" + hex.EncodeToString(other[:])}.Extract(bytes.NewReader(archive))
+		assert.Equal(t, ErrDigestMismatch, err, filename)
+	}
+
+	archive := newTestArchive(t, testEntry{name: "etc/os-release", content: "ID=debian"})
+	for _, digest := range []string{"sha256", "md5:d41d8cd98f00b204e9800998ecf8427e", "sha256:1234", "sha256:" + strings.Repeat("z", 64)} {
+		_, err := Extractor{Files: []string{"etc/"}, Digest: digest}.Extract(bytes.NewReader(archive))
+		assert.Equal(t, ErrInvalidDigest, err, digest)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// FuzzExtract fuzzes the extraction of layers, with possibly compressed tarballs.
+func FuzzExtract(f *testing.F) {
+	for _, name := range []string{"utils_test.tar", "utils_test.tar.gz"} {
+		seed, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		extractor := Extractor{Files: []string{"etc/", "var/lib/dpkg/status"}, MaxFileSize: 1 << 20, MaxArchiveSize: 1 << 26}
+		extractor.Extract(bytes.NewReader(data))
+	})
+}
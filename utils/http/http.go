@@ -56,7 +56,10 @@ func WriteHTTPError(w http.ResponseWriter, httpStatus int, err error) {
 				httpStatus = http.StatusNotFound
 			case database.ErrBackendException:
 				httpStatus = http.StatusServiceUnavailable
-			case worker.ErrParentUnknown, worker.ErrUnsupported, utils.ErrCouldNotExtract, utils.ErrExtractedFileTooBig:
+			case worker.ErrParentUnknown, worker.ErrUnsupported, utils.ErrCouldNotExtract, utils.ErrInsecureArchive:
+				httpStatus = http.StatusBadRequest
+			}
+			if _, exceeded := err.(*worker.ErrBudgetExceeded); exceeded {
 				httpStatus = http.StatusBadRequest
 			}
 		}
@@ -24,7 +24,6 @@ import (
 	"io"
 	"io/ioutil"
 	"os/exec"
-	"strings"
 )
 
 var (
@@ -86,74 +85,29 @@ func (r *XzReader) Close() error {
 type TarReadCloser struct {
 	*tar.Reader
 	io.Closer
+
+	// decompressed reads the decompressed archive.
+	decompressed *sizeLimitedReader
 }
 
 func (r *TarReadCloser) Close() error {
 	return r.Closer.Close()
 }
 
-// SelectivelyExtractArchive extracts the specified files and folders
-// from targz data read from the given reader and store them in a map indexed by file paths
-func SelectivelyExtractArchive(r io.Reader, prefix string, toExtract []string, maxFileSize int64) (map[string][]byte, error) {
-	data := make(map[string][]byte)
-
-	// Create a tar or tar/tar-gzip/tar-bzip2/tar-xz reader
-	tr, err := getTarReader(r)
-	if err != nil {
-		return data, ErrCouldNotExtract
-	}
-	defer tr.Close()
-
-	// For each element in the archive
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return data, ErrCouldNotExtract
-		}
-
-		// Get element filename
-		filename := hdr.Name
-		filename = strings.TrimPrefix(filename, "./")
-		if prefix != "" {
-			filename = strings.TrimPrefix(filename, prefix)
-		}
-
-		// Determine if we should extract the element
-		toBeExtracted := false
-		for _, s := range toExtract {
-			if strings.HasPrefix(filename, s) {
-				toBeExtracted = true
-				break
-			}
-		}
-
-		if toBeExtracted {
-			// File size limit
-			if maxFileSize > 0 && hdr.Size > maxFileSize {
-				return data, ErrExtractedFileTooBig
-			}
-
-			// Extract the element
-			if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink || hdr.Typeflag == tar.TypeReg {
-				d, _ := ioutil.ReadAll(tr)
-				data[filename] = d
-			}
-		}
-	}
-
-	return data, nil
-}
-
-// getTarReader returns a TarReaderCloser associated with the specified io.Reader.
+// getTarReader returns a TarReaderCloser associated with the specified io.Reader, which fails
+// with ErrExtractedArchiveTooBig once more than maxSize bytes have been decompressed, unless
+// maxSize is zero.
 //
 // Gzip/Bzip2/XZ detection is done by using the magic numbers:
 // Gzip: the first two bytes should be 0x1f and 0x8b. Defined in the RFC1952.
 // Bzip2: the first three bytes should be 0x42, 0x5a and 0x68. No RFC.
 // XZ: the first three bytes should be 0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00. No RFC.
-func getTarReader(r io.Reader) (*TarReadCloser, error) {
+func getTarReader(r io.Reader, maxSize int64) (*TarReadCloser, error) {
+	newTarReadCloser := func(r io.Reader, c io.Closer) *TarReadCloser {
+		decompressed := &sizeLimitedReader{r: r, max: maxSize}
+		return &TarReadCloser{Reader: tar.NewReader(decompressed), Closer: c, decompressed: decompressed}
+	}
+
 	br := bufio.NewReader(r)
 	header, err := br.Peek(readLen)
 	if err == nil {
@@ -163,19 +117,19 @@ func getTarReader(r io.Reader) (*TarReadCloser, error) {
 			if err != nil {
 				return nil, err
 			}
-			return &TarReadCloser{tar.NewReader(gr), gr}, nil
+			return newTarReadCloser(gr, gr), nil
 		case bytes.HasPrefix(header, bzip2Header):
 			bzip2r := ioutil.NopCloser(bzip2.NewReader(br))
-			return &TarReadCloser{tar.NewReader(bzip2r), bzip2r}, nil
+			return newTarReadCloser(bzip2r, bzip2r), nil
 		case bytes.HasPrefix(header, xzHeader):
 			xzr, err := NewXzReader(br)
 			if err != nil {
 				return nil, err
 			}
-			return &TarReadCloser{tar.NewReader(xzr), xzr}, nil
+			return newTarReadCloser(xzr, xzr), nil
 		}
 	}
 
 	dr := ioutil.NopCloser(br)
-	return &TarReadCloser{tar.NewReader(dr), dr}, nil
+	return newTarReadCloser(dr, dr), nil
 }
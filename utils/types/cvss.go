@@ -0,0 +1,137 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// CVSS is a vector of the Common Vulnerability Scoring System, along with the base score it
+// rates the vulnerability with, from 0.0 to 10.0.
+type CVSS struct {
+	Vector string
+	Score  float64
+}
+
+// cvssV3Weights are the weights of the values of the base metrics of CVSS v3. The weights of the
+// Privileges Required metric when the Scope is changed are in cvssV3ChangedPrivileges.
+var (
+	cvssV3Weights = map[string]map[string]float64{
+		"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+		"AC": {"L": 0.77, "H": 0.44},
+		"PR": {"N": 0.85, "L": 0.62, "H": 0.27},
+		"UI": {"N": 0.85, "R": 0.62},
+		"S":  {"U": 0, "C": 0},
+		"C":  {"H": 0.56, "L": 0.22, "N": 0},
+		"I":  {"H": 0.56, "L": 0.22, "N": 0},
+		"A":  {"H": 0.56, "L": 0.22, "N": 0},
+	}
+	cvssV3ChangedPrivileges = map[string]float64{"N": 0.85, "L": 0.68, "H": 0.5}
+)
+
+// ParseCVSSv3 parses a CVSS v3.0 or v3.1 vector, such as
+// "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", and computes its base score as specified in
+// https://www.first.org/cvss/v3.1/specification-document. The temporal and environmental metrics
+// are ignored.
+func ParseCVSSv3(vector string) (CVSS, error) {
+	parts := strings.Split(vector, "/")
+	if parts[0] != "CVSS:3.0" && parts[0] != "CVSS:3.1" {
+		return CVSS{}, fmt.Errorf("invalid CVSS v3 vector '%s': unknown version", vector)
+	}
+
+	values := make(map[string]string, len(cvssV3Weights))
+	for _, part := range parts[1:] {
+		metric := strings.SplitN(part, ":", 2)
+		if len(metric) != 2 {
+			return CVSS{}, fmt.Errorf("invalid CVSS v3 vector '%s': invalid metric '%s'", vector, part)
+		}
+		weights, isBase := cvssV3Weights[metric[0]]
+		if !isBase {
+			continue
+		}
+		if _, ok := weights[metric[1]]; !ok {
+			return CVSS{}, fmt.Errorf("invalid CVSS v3 vector '%s': invalid value for metric '%s'", vector, metric[0])
+		}
+		if _, duplicate := values[metric[0]]; duplicate {
+			return CVSS{}, fmt.Errorf("invalid CVSS v3 vector '%s': duplicate metric '%s'", vector, metric[0])
+		}
+		values[metric[0]] = metric[1]
+	}
+	for metric := range cvssV3Weights {
+		if _, ok := values[metric]; !ok {
+			return CVSS{}, fmt.Errorf("invalid CVSS v3 vector '%s': missing metric '%s'", vector, metric)
+		}
+	}
+
+	weight := func(metric string) float64 { return cvssV3Weights[metric][values[metric]] }
+	changed := values["S"] == "C"
+	privileges := weight("PR")
+	if changed {
+		privileges = cvssV3ChangedPrivileges[values["PR"]]
+	}
+
+	iss := 1 - (1-weight("C"))*(1-weight("I"))*(1-weight("A"))
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	exploitability := 8.22 * weight("AV") * weight("AC") * privileges * weight("UI")
+
+	var score float64
+	switch {
+	case impact <= 0:
+		score = 0
+	case changed:
+		score = roundUp(math.Min(1.08*(impact+exploitability), 10))
+	default:
+		score = roundUp(math.Min(impact+exploitability, 10))
+	}
+
+	return CVSS{Vector: vector, Score: score}, nil
+}
+
+// roundUp returns the smallest number with one decimal that is equal to or higher than the given
+// one, ignoring the floating point errors, as defined in the Appendix A of the CVSS v3.1
+// specification.
+func roundUp(f float64) float64 {
+	i := int(math.Round(f * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
+
+// ScorePriority converts a CVSS score (0.0 - 10.0) into a Priority following the qualitative
+// rating scale of the CVSS v3.1 specification, Table 14. The Negligible level is set for scores
+// between [0, 1), replacing the specified None level, originally used for a score of 0.
+func ScorePriority(score float64) Priority {
+	switch {
+	case score < 0:
+		return Unknown
+	case score < 1.0:
+		return Negligible
+	case score < 4.0:
+		return Low
+	case score < 7.0:
+		return Medium
+	case score < 9.0:
+		return High
+	case score <= 10:
+		return Critical
+	}
+	return Unknown
+}
@@ -16,9 +16,11 @@ package utils
 
 import (
 	"bytes"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/pborman/uuid"
@@ -54,6 +56,23 @@ func TestExec(t *testing.T) {
 	assert.Error(t, err, "An invalid command should return an error")
 }
 
+func TestLimitedBuffer(t *testing.T) {
+	b := &LimitedBuffer{Max: 8}
+	n, err := b.Write([]byte("12345"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	n, err = b.Write([]byte("67890"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	b.Write([]byte("abc"))
+	assert.Equal(t, "12345678", b.String())
+
+	// The limit holds when copying, e.g. the output of a command.
+	b = &LimitedBuffer{Max: 8}
+	io.Copy(b, strings.NewReader("1234567890"))
+	assert.Equal(t, "12345678", b.String())
+}
+
 // TestString tests the string.go file
 func TestString(t *testing.T) {
 	assert.False(t, Contains("", []string{}))
@@ -71,13 +90,13 @@ func TestTar(t *testing.T) {
 		testArchivePath := filepath.Join(filepath.Dir(path), testDataDir, filename)
 
 		// Extract non compressed data
-		data, err = SelectivelyExtractArchive(bytes.NewReader([]byte("that string does not represent a tar or tar-gzip file")), "", []string{}, 0)
+		data, err = Extractor{}.Extract(bytes.NewReader([]byte("that string does not represent a tar or tar-gzip file")))
 		assert.Error(t, err, "Extracting non compressed data should return an error")
 
 		// Extract an archive
 		f, _ := os.Open(testArchivePath)
 		defer f.Close()
-		data, err = SelectivelyExtractArchive(f, "", []string{"test/"}, 0)
+		data, err = Extractor{Files: []string{"test/"}}.Extract(f)
 		assert.Nil(t, err)
 
 		if c, n := data["test/test.txt"]; !n {
@@ -92,8 +111,14 @@ func TestTar(t *testing.T) {
 		// File size limit
 		f, _ = os.Open(testArchivePath)
 		defer f.Close()
-		data, err = SelectivelyExtractArchive(f, "", []string{"test"}, 50)
+		data, err = Extractor{Files: []string{"test"}, MaxFileSize: 50}.Extract(f)
 		assert.Equal(t, ErrExtractedFileTooBig, err)
+
+		// Archive size limit
+		f, _ = os.Open(testArchivePath)
+		defer f.Close()
+		data, err = Extractor{Files: []string{"test"}, MaxArchiveSize: 1024}.Extract(f)
+		assert.Equal(t, ErrExtractedArchiveTooBig, err)
 	}
 }
 
@@ -0,0 +1,81 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package version exposes the version of Clair and the components it was built with, so that
+// operators can track the versions deployed across their fleet.
+package version
+
+import (
+	"runtime"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/coreos/clair/database"
+)
+
+// Version and Commit identify the build of Clair. They are set at link time, e.g. using
+//
+//	go build -ldflags "-X github.com/coreos/clair/version.Version=v1.2.0 -X github.com/coreos/clair/version.Commit=$(git rev-parse HEAD)"
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+var promBuildInfoDesc = prometheus.NewDesc(
+	"clair_build_info",
+	"Always 1, labeled by the version and commit of Clair, the version of Go it was built with and its datastore drivers.",
+	[]string{"version", "commit", "goversion", "drivers"},
+	nil,
+)
+
+func init() {
+	prometheus.MustRegister(buildInfoCollector{})
+}
+
+// Info describes the build of Clair.
+type Info struct {
+	Version   string   `json:"Version"`
+	Commit    string   `json:"Commit,omitempty"`
+	GoVersion string   `json:"GoVersion"`
+	Drivers   []string `json:"Drivers"`
+}
+
+// Get returns the description of the build of Clair.
+func Get() Info {
+	drivers := database.Drivers()
+	if drivers == nil {
+		drivers = []string{}
+	}
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		GoVersion: runtime.Version(),
+		Drivers:   drivers,
+	}
+}
+
+// buildInfoCollector exports the build information as a metric. The drivers are only known once
+// every package registered its own, so the metric is built when it is collected.
+type buildInfoCollector struct{}
+
+func (buildInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- promBuildInfoDesc
+}
+
+func (buildInfoCollector) Collect(ch chan<- prometheus.Metric) {
+	info := Get()
+	ch <- prometheus.MustNewConstMetric(promBuildInfoDesc, prometheus.GaugeValue, 1,
+		info.Version, info.Commit, info.GoVersion, strings.Join(info.Drivers, ","))
+}
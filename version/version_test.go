@@ -0,0 +1,58 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package version
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/config"
+	"github.com/coreos/clair/database"
+)
+
+func init() {
+	database.Register("version-test", func(config.RegistrableComponentConfig) (database.Datastore, error) {
+		return nil, nil
+	})
+}
+
+func TestBuildInfo(t *testing.T) {
+	defer func(v, c string) { Version, Commit = v, c }(Version, Commit)
+	Version, Commit = "v1.2.0", "abcdef"
+
+	info := Get()
+	assert.Equal(t, Info{Version: "v1.2.0", Commit: "abcdef", GoVersion: runtime.Version(), Drivers: []string{"version-test"}}, info)
+
+	ch := make(chan prometheus.Metric, 1)
+	buildInfoCollector{}.Collect(ch)
+	var metric dto.Metric
+	assert.Nil(t, (<-ch).Write(&metric))
+	assert.Equal(t, 1.0, metric.GetGauge().GetValue())
+
+	labels := make(map[string]string)
+	for _, label := range metric.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	assert.Equal(t, map[string]string{
+		"version":   "v1.2.0",
+		"commit":    "abcdef",
+		"goversion": runtime.Version(),
+		"drivers":   "version-test",
+	}, labels)
+}
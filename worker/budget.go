@@ -0,0 +1,128 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/coreos/clair/utils"
+)
+
+// BudgetResource is a resource whose use by the analysis of a layer is bounded by the Budget.
+type BudgetResource string
+
+const (
+	// BudgetTime is the wall-clock time of the analysis.
+	BudgetTime BudgetResource = "time"
+	// BudgetFileSize is the size of the files extracted from the layer.
+	BudgetFileSize BudgetResource = "file size"
+	// BudgetArchiveSize is the decompressed size of the layer.
+	BudgetArchiveSize BudgetResource = "archive size"
+)
+
+// Budget bounds the resources spent on the analysis of every layer, whether in-process or in the
+// sandbox. Zero values keep the defaults.
+type Budget struct {
+	// Timeout is the wall-clock time after which the analysis of a layer is canceled. Zero means
+	// no limit.
+	Timeout time.Duration
+
+	// MaxGoroutines is the number of detectors run at the same time on a layer. Zero means one.
+	MaxGoroutines int
+
+	// MaxFileSize is the size of the largest file extracted from a layer and held in memory, e.g.
+	// a package database. Zero means 200 MiB.
+	MaxFileSize int64
+
+	// MaxArchiveSize is the size of the largest layer once decompressed. Zero means 16 GiB.
+	MaxArchiveSize int64
+}
+
+// ErrBudgetExceeded is the error of the analyses of layers that have been canceled because they
+// exceeded their Budget.
+type ErrBudgetExceeded struct {
+	Resource BudgetResource
+	Limit    string
+}
+
+func (e *ErrBudgetExceeded) Error() string {
+	return fmt.Sprintf("worker: the analysis of the layer exceeded its %s budget of %s", e.Resource, e.Limit)
+}
+
+var (
+	// budget is the Budget of the analysis of every layer.
+	budget Budget
+
+	promBudgetExceededTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clair_worker_budget_exceeded_total",
+		Help: "Number of layer analyses canceled because they exceeded their budget, per resource.",
+	}, []string{"resource"})
+)
+
+func init() {
+	prometheus.MustRegister(promBudgetExceededTotal)
+}
+
+// UseBudget bounds the resources spent on the analysis of every layer.
+func UseBudget(b Budget) {
+	budget = b
+}
+
+func (b Budget) maxFileSize() int64 {
+	if b.MaxFileSize > 0 {
+		return b.MaxFileSize
+	}
+	return maxFileSize
+}
+
+func (b Budget) maxArchiveSize() int64 {
+	if b.MaxArchiveSize > 0 {
+		return b.MaxArchiveSize
+	}
+	return maxArchiveSize
+}
+
+// exceeded returns the error of an analysis that exceeded the budget of the given resource.
+func (b Budget) exceeded(resource BudgetResource) *ErrBudgetExceeded {
+	var limit string
+	switch resource {
+	case BudgetTime:
+		limit = b.Timeout.String()
+	case BudgetFileSize:
+		limit = fmt.Sprintf("%d bytes", b.maxFileSize())
+	case BudgetArchiveSize:
+		limit = fmt.Sprintf("%d bytes", b.maxArchiveSize())
+	}
+	return &ErrBudgetExceeded{Resource: resource, Limit: limit}
+}
+
+// budgetError returns the ErrBudgetExceeded matching the given error of an analysis, if any, and
+// counts it.
+func budgetError(err error) error {
+	switch err {
+	case utils.ErrExtractedFileTooBig:
+		err = budget.exceeded(BudgetFileSize)
+	case utils.ErrExtractedArchiveTooBig:
+		err = budget.exceeded(BudgetArchiveSize)
+	}
+
+	if e, ok := err.(*ErrBudgetExceeded); ok {
+		promBudgetExceededTotal.WithLabelValues(string(e.Resource)).Inc()
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestBudget(t *testing.T) {
+	_, f, _, _ := runtime.Caller(0)
+	path := filepath.Join(filepath.Dir(f), "testdata", "DistUpgrade", "wheezy.tar.gz")
+	defer UseBudget(Budget{})
+
+	expected, err := detectContent(context.Background(), nil, "Docker", "wheezy", path, "", nil, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// The analysis records what it processed.
+	assert.True(t, expected.Stats.BytesRead > 0)
+	assert.True(t, expected.Stats.FilesInspected >= expected.Stats.FilesMatched)
+	assert.True(t, expected.Stats.FilesMatched > 0)
+	assert.True(t, expected.Stats.BytesMatched > 0)
+	assert.True(t, expected.Stats.Duration > 0)
+	assert.NotEmpty(t, expected.Stats.Detectors)
+
+	// Detectors run concurrently find the same features.
+	UseBudget(Budget{MaxGoroutines: 4})
+	d, err := detectContent(context.Background(), nil, "Docker", "wheezy", path, "", nil, nil)
+	if assert.Nil(t, err) {
+		assert.Len(t, d.Features, len(expected.Features))
+	}
+
+	// The package database is larger than 1 KiB.
+	UseBudget(Budget{MaxFileSize: 1024})
+	_, err = detectContent(context.Background(), nil, "Docker", "wheezy", path, "", nil, nil)
+	assert.Equal(t, &ErrBudgetExceeded{Resource: BudgetFileSize, Limit: "1024 bytes"}, err)
+
+	UseBudget(Budget{MaxArchiveSize: 1024})
+	_, err = detectContent(context.Background(), nil, "Docker", "wheezy", path, "", nil, nil)
+	assert.Equal(t, &ErrBudgetExceeded{Resource: BudgetArchiveSize, Limit: "1024 bytes"}, err)
+
+	UseBudget(Budget{Timeout: time.Nanosecond})
+	_, err = detectContent(context.Background(), nil, "Docker", "wheezy", path, "", nil, nil)
+	assert.Equal(t, &ErrBudgetExceeded{Resource: BudgetTime, Limit: "1ns"}, err)
+}
@@ -0,0 +1,202 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package detectors
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigurableDetector is implemented by the FeaturesDetectors and NamespaceDetectors that have
+// options, which operators can set in the configuration of the detectors.
+type ConfigurableDetector interface {
+	// Options returns a pointer to the options of the detector: a struct holding their defaults,
+	// which its configuration is decoded into.
+	Options() interface{}
+	// Configure validates and applies the options once they are decoded.
+	Configure() error
+}
+
+// Configure removes the detectors with the given names, so that no layer is analyzed with them,
+// and configures the ConfigurableDetectors with their YAML-encoded options, by name. It is meant to
+// be called before any layer is analyzed; the detectors that aren't configured keep their
+// defaults.
+func Configure(disabled []string, options map[string][]byte) error {
+	featuresDetectorsLock.Lock()
+	defer featuresDetectorsLock.Unlock()
+	namespaceDetectorsLock.Lock()
+	defer namespaceDetectorsLock.Unlock()
+
+	isDisabled := make(map[string]bool, len(disabled))
+	for _, name := range disabled {
+		isDisabled[name] = true
+		_, isFeatures := featuresDetectors[name]
+		_, isNamespace := namespaceDetectors[name]
+		if !isFeatures && !isNamespace {
+			nlog.Warningf("could not disable unknown detector '%s'", name)
+			continue
+		}
+		delete(featuresDetectors, name)
+		delete(namespaceDetectors, name)
+		nlog.Infof("detector '%s' disabled", name)
+	}
+
+	for name, raw := range options {
+		var detector interface{}
+		if d, ok := featuresDetectors[name]; ok {
+			detector = d
+		} else if d, ok := namespaceDetectors[name]; ok {
+			detector = d
+		} else {
+			if !isDisabled[name] {
+				nlog.Warningf("could not configure unknown detector '%s'", name)
+			}
+			continue
+		}
+
+		configurable, ok := detector.(ConfigurableDetector)
+		if !ok {
+			return fmt.Errorf("detector '%s' has no options", name)
+		}
+		if err := decodeOptions(raw, configurable.Options()); err != nil {
+			return fmt.Errorf("could not configure detector '%s': %s", name, err)
+		}
+		if err := configurable.Configure(); err != nil {
+			return fmt.Errorf("could not configure detector '%s': %s", name, err)
+		}
+		nlog.Infof("detector '%s' configured", name)
+	}
+
+	return nil
+}
+
+// VersionedDetector is implemented by the FeaturesDetectors and NamespaceDetectors that are
+// versioned independently of the engine, so that upgrading the engine doesn't run them again on
+// the files retained from the analyses of the layers, as long as their Version doesn't change.
+type VersionedDetector interface {
+	// Version identifies the logic of the detector: it must change whenever the detector could
+	// detect something else in the same files.
+	Version() string
+}
+
+// Fingerprints returns the fingerprints of the registered FeaturesDetectors and
+// NamespaceDetectors, by name. A fingerprint changes with the options of the detector and with its
+// Version, or with the given version of the engine if it isn't a VersionedDetector, so that the
+// results of a detector can be reused as long as its fingerprint is the same.
+func Fingerprints(engineVersion string) (features, namespaces map[string]string) {
+	featuresDetectorsLock.Lock()
+	defer featuresDetectorsLock.Unlock()
+	namespaceDetectorsLock.Lock()
+	defer namespaceDetectorsLock.Unlock()
+
+	features = make(map[string]string, len(featuresDetectors))
+	for name, detector := range featuresDetectors {
+		features[name] = fingerprint(detector, engineVersion)
+	}
+	namespaces = make(map[string]string, len(namespaceDetectors))
+	for name, detector := range namespaceDetectors {
+		namespaces[name] = fingerprint(detector, engineVersion)
+	}
+	return
+}
+
+func fingerprint(detector interface{}, engineVersion string) string {
+	version := "engine:" + engineVersion
+	if detector, ok := detector.(VersionedDetector); ok {
+		version = "detector:" + detector.Version()
+	}
+
+	h := sha256.New()
+	io.WriteString(h, version)
+	if detector, ok := detector.(ConfigurableDetector); ok {
+		json.NewEncoder(h).Encode(detector.Options())
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// decodeOptions decodes the YAML-encoded options into the given struct, failing on the options it
+// doesn't have so that misspelled options aren't silently ignored.
+func decodeOptions(raw []byte, options interface{}) error {
+	if err := yaml.Unmarshal(raw, options); err != nil {
+		return err
+	}
+
+	var given, known map[string]interface{}
+	if err := yaml.Unmarshal(raw, &given); err != nil {
+		return err
+	}
+	encoded, err := yaml.Marshal(options)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(encoded, &known); err != nil {
+		return err
+	}
+	for option := range given {
+		if _, ok := known[option]; !ok {
+			return fmt.Errorf("unknown option '%s'", option)
+		}
+	}
+	return nil
+}
+
+// PathFilter is an option of the detectors that search files wherever they are in the layers,
+// restricting where they search them, e.g. to skip the dependencies of the tests of applications.
+type PathFilter struct {
+	// Paths are the patterns, as in path.Match, of the directories that are searched along with
+	// their subdirectories. Every directory is searched if there is none.
+	Paths []string
+	// MaxDepth is the largest number of directories in the paths of the files that are searched,
+	// without limit if it is zero.
+	MaxDepth int
+}
+
+// Validate returns an error if the filter is invalid.
+func (f PathFilter) Validate() error {
+	if f.MaxDepth < 0 {
+		return fmt.Errorf("invalid maximum depth %d", f.MaxDepth)
+	}
+	for _, pattern := range f.Paths {
+		if _, err := path.Match(strings.TrimPrefix(pattern, "/"), ""); err != nil {
+			return fmt.Errorf("invalid path pattern '%s': %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Match returns whether the file at the given path, without leading /, is searched.
+func (f PathFilter) Match(filename string) bool {
+	if f.MaxDepth > 0 && strings.Count(filename, "/") > f.MaxDepth {
+		return false
+	}
+	if len(f.Paths) == 0 {
+		return true
+	}
+	for dir := path.Dir(filename); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		for _, pattern := range f.Paths {
+			if matched, _ := path.Match(strings.TrimPrefix(pattern, "/"), dir); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package detectors
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfigurableDetector struct {
+	testDetector
+	options struct {
+		Paths []string
+		Depth int
+	}
+	configured bool
+}
+
+func (d *testConfigurableDetector) Options() interface{} { return &d.options }
+
+func (d *testConfigurableDetector) Configure() error {
+	if d.options.Depth < 0 {
+		return errors.New("negative depth")
+	}
+	d.configured = true
+	return nil
+}
+
+func TestConfigure(t *testing.T) {
+	configurable := &testConfigurableDetector{}
+	configurable.options.Depth = 3
+	withFeaturesDetectors(map[string]FeaturesDetector{
+		"dpkg":     testDetector{},
+		"rpm":      testDetector{},
+		"language": configurable,
+	}, func() {
+		err := Configure([]string{"rpm", "unknown"}, map[string][]byte{
+			"language": []byte("paths: [app]"),
+			"rpm":      []byte("paths: [app]"),
+			"unknown":  []byte("paths: [app]"),
+		})
+		if assert.Nil(t, err) {
+			assert.Len(t, featuresDetectors, 2)
+			assert.NotContains(t, featuresDetectors, "rpm")
+			assert.True(t, configurable.configured)
+			assert.Equal(t, []string{"app"}, configurable.options.Paths)
+			// The options that aren't set keep their defaults.
+			assert.Equal(t, 3, configurable.options.Depth)
+		}
+
+		assert.EqualError(t, Configure(nil, map[string][]byte{"dpkg": []byte("paths: [app]")}), "detector 'dpkg' has no options")
+		assert.EqualError(t, Configure(nil, map[string][]byte{"language": []byte("path: [app]")}), "could not configure detector 'language': unknown option 'path'")
+		assert.EqualError(t, Configure(nil, map[string][]byte{"language": []byte("depth: -1")}), "could not configure detector 'language': negative depth")
+	})
+}
+
+func TestPathFilter(t *testing.T) {
+	filter := PathFilter{}
+	assert.True(t, filter.Match("usr/share/app/package.json"))
+
+	filter = PathFilter{Paths: []string{"/srv/*", "app"}, MaxDepth: 3}
+	if assert.Nil(t, filter.Validate()) {
+		assert.True(t, filter.Match("app/package.json"))
+		assert.True(t, filter.Match("app/node_modules/lib/package.json"))
+		assert.True(t, filter.Match("srv/www/package.json"))
+		assert.False(t, filter.Match("srv/package.json"))
+		assert.False(t, filter.Match("application/package.json"))
+		assert.False(t, filter.Match("app/node_modules/lib/node_modules/dep/package.json"))
+	}
+
+	assert.NotNil(t, PathFilter{Paths: []string{"app["}}.Validate())
+	assert.NotNil(t, PathFilter{MaxDepth: -1}.Validate())
+}
+
+type testVersionedDetector struct {
+	testDetector
+	version string
+}
+
+func (d testVersionedDetector) Version() string { return d.version }
+
+func TestFingerprints(t *testing.T) {
+	configurable := &testConfigurableDetector{}
+	versioned := &testVersionedDetector{version: "1"}
+	withFeaturesDetectors(map[string]FeaturesDetector{
+		"dpkg":      testDetector{},
+		"language":  configurable,
+		"versioned": versioned,
+	}, func() {
+		features, _ := Fingerprints("1")
+		assert.Len(t, features, 3)
+
+		// The detectors that aren't versioned change with the engine.
+		upgraded, _ := Fingerprints("2")
+		assert.NotEqual(t, features["dpkg"], upgraded["dpkg"])
+		assert.NotEqual(t, features["language"], upgraded["language"])
+		assert.Equal(t, features["versioned"], upgraded["versioned"])
+
+		// They all change with their options or their version.
+		configurable.options.Depth = 1
+		versioned.version = "2"
+		reconfigured, _ := Fingerprints("1")
+		assert.Equal(t, features["dpkg"], reconfigured["dpkg"])
+		assert.NotEqual(t, features["language"], reconfigured["language"])
+		assert.NotEqual(t, features["versioned"], reconfigured["versioned"])
+	})
+}
@@ -25,6 +25,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/coreos/clair/utils"
 	cerrors "github.com/coreos/clair/utils/errors"
 	"github.com/coreos/pkg/capnslog"
 )
@@ -33,8 +34,9 @@ import (
 type DataDetector interface {
 	//Support check if the input path and format are supported by the underling detector
 	Supported(path string, format string) bool
-	// Detect detects the required data from input path
-	Detect(layerReader io.ReadCloser, toExtract []string, maxFileSize int64) (data map[string][]byte, err error)
+	// Detect detects the required data from input path, extracting it with the given Extractor
+	// whose Prefix it sets
+	Detect(layerReader io.ReadCloser, extractor utils.Extractor) (data map[string][]byte, err error)
 }
 
 var (
@@ -70,7 +72,7 @@ func RegisterDataDetector(name string, f DataDetector) {
 }
 
 // DetectData finds the Data of the layer by using every registered DataDetector
-func DetectData(format, path string, headers map[string]string, toExtract []string, maxFileSize int64) (data map[string][]byte, err error) {
+func DetectData(format, path string, headers map[string]string, extractor utils.Extractor) (data map[string][]byte, err error) {
 	var layerReader io.ReadCloser
 	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
 		// Create a new HTTP request object.
@@ -110,7 +112,7 @@ func DetectData(format, path string, headers map[string]string, toExtract []stri
 
 	for _, detector := range dataDetectors {
 		if detector.Supported(path, format) {
-			data, err = detector.Detect(layerReader, toExtract, maxFileSize)
+			data, err = detector.Detect(layerReader, extractor)
 			if err != nil {
 				return nil, err
 			}
@@ -36,6 +36,7 @@ func (detector *ACIDataDetector) Supported(path string, format string) bool {
 	return false
 }
 
-func (detector *ACIDataDetector) Detect(layerReader io.ReadCloser, toExtract []string, maxFileSize int64) (map[string][]byte, error) {
-	return utils.SelectivelyExtractArchive(layerReader, "rootfs/", toExtract, maxFileSize)
+func (detector *ACIDataDetector) Detect(layerReader io.ReadCloser, extractor utils.Extractor) (map[string][]byte, error) {
+	extractor.Prefix = "rootfs/"
+	return extractor.Extract(layerReader)
 }
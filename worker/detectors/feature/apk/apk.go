@@ -22,7 +22,7 @@ import (
 
 	"github.com/coreos/clair/database"
 	"github.com/coreos/clair/ext/versionfmt"
-	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/ext/versionfmt/apk"
 	"github.com/coreos/clair/worker/detectors"
 )
 
@@ -34,45 +34,62 @@ func init() {
 
 type detector struct{}
 
+// Detect lists the packages of the apk database. They are named after the package they were built
+// from, if any, which is how the Alpine security database lists them: e.g. the libcrypto and libssl
+// packages are both reported as openssl.
 func (d *detector) Detect(data map[string][]byte) ([]database.FeatureVersion, error) {
 	file, exists := data["lib/apk/db/installed"]
 	if !exists {
 		return []database.FeatureVersion{}, nil
 	}
 
-	// Iterate over each line in the "installed" file attempting to parse each
-	// package into a feature that will be stored in a set to guarantee
+	// Iterate over each paragraph of the "installed" file attempting to parse
+	// each package into a feature that will be stored in a set to guarantee
 	// uniqueness.
 	pkgSet := make(map[string]database.FeatureVersion)
-	ipkg := database.FeatureVersion{}
+	var name, origin, version string
+	addPackage := func() {
+		if origin != "" {
+			name = origin
+		}
+		if name != "" && version != "" {
+			ipkg := database.FeatureVersion{
+				Feature: database.Feature{Name: name},
+				Version: version,
+				State:   database.InstalledState,
+			}
+			pkgSet[ipkg.Feature.Name+"#"+ipkg.Version] = ipkg
+		}
+		name, origin, version = "", "", ""
+	}
+
 	scanner := bufio.NewScanner(bytes.NewBuffer(file))
 	for scanner.Scan() {
 		line := scanner.Text()
+		if line == "" {
+			addPackage()
+			continue
+		}
 		if len(line) < 2 {
 			continue
 		}
 
-		// Parse the package name or version.
-		switch {
-		case line[:2] == "P:":
-			ipkg.Feature.Name = line[2:]
-		case line[:2] == "V:":
-			version := string(line[2:])
-			err := versionfmt.Valid(dpkg.ParserName, version)
+		// Parse the package name, origin or version.
+		switch line[:2] {
+		case "P:":
+			name = line[2:]
+		case "o:":
+			origin = line[2:]
+		case "V:":
+			err := versionfmt.Valid(apk.ParserName, line[2:])
 			if err != nil {
-				log.Warningf("could not parse package version '%s': %s. skipping", version, err.Error())
+				log.Warningf("could not parse package version '%s': %s. skipping", line[2:], err.Error())
 			} else {
-				ipkg.Version = version
+				version = line[2:]
 			}
 		}
-
-		// If we have a whole feature, store it in the set and try to parse a new
-		// one.
-		if ipkg.Feature.Name != "" && ipkg.Version != "" {
-			pkgSet[ipkg.Feature.Name+"#"+ipkg.Version] = ipkg
-			ipkg = database.FeatureVersion{}
-		}
 	}
+	addPackage()
 
 	// Convert the map into a slice.
 	pkgs := make([]database.FeatureVersion, 0, len(pkgSet))
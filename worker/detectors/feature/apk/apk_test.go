@@ -24,50 +24,53 @@ import (
 func TestAPKFeatureDetection(t *testing.T) {
 	testData := []feature.TestData{
 		{
+			// The packages are named after their origin: libcrypto1.0 and libssl1.0 are openssl, and
+			// musl-utils is musl.
 			FeatureVersions: []database.FeatureVersion{
 				{
 					Feature: database.Feature{Name: "musl"},
 					Version: "1.1.14-r10",
+					State:   database.InstalledState,
 				},
 				{
 					Feature: database.Feature{Name: "busybox"},
 					Version: "1.24.2-r9",
+					State:   database.InstalledState,
 				},
 				{
 					Feature: database.Feature{Name: "alpine-baselayout"},
 					Version: "3.0.3-r0",
+					State:   database.InstalledState,
 				},
 				{
 					Feature: database.Feature{Name: "alpine-keys"},
 					Version: "1.1-r0",
+					State:   database.InstalledState,
 				},
 				{
 					Feature: database.Feature{Name: "zlib"},
 					Version: "1.2.8-r2",
+					State:   database.InstalledState,
 				},
 				{
-					Feature: database.Feature{Name: "libcrypto1.0"},
-					Version: "1.0.2h-r1",
-				},
-				{
-					Feature: database.Feature{Name: "libssl1.0"},
+					Feature: database.Feature{Name: "openssl"},
 					Version: "1.0.2h-r1",
+					State:   database.InstalledState,
 				},
 				{
 					Feature: database.Feature{Name: "apk-tools"},
 					Version: "2.6.7-r0",
+					State:   database.InstalledState,
 				},
 				{
-					Feature: database.Feature{Name: "scanelf"},
+					Feature: database.Feature{Name: "pax-utils"},
 					Version: "1.1.6-r0",
+					State:   database.InstalledState,
 				},
 				{
-					Feature: database.Feature{Name: "musl-utils"},
-					Version: "1.1.14-r10",
-				},
-				{
-					Feature: database.Feature{Name: "libc-utils"},
+					Feature: database.Feature{Name: "libc-dev"},
 					Version: "0.7-r0",
+					State:   database.InstalledState,
 				},
 			},
 			Data: map[string][]byte{
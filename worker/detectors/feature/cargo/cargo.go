@@ -0,0 +1,217 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cargo implements a FeaturesDetector for the Rust crates compiled into the executables
+// built with cargo-auditable, which embeds their dependency tree in a ".dep-v0" section.
+package cargo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/semver"
+	"github.com/coreos/clair/worker/detectors"
+)
+
+const (
+	// Namespace is the namespace of the crates published on crates.io.
+	Namespace = "crates.io"
+
+	// section is the ELF section in which cargo-auditable embeds the zlib-compressed JSON
+	// dependency tree of an executable.
+	section = ".dep-v0"
+
+	// maxDependenciesSize is the size above which a dependency tree is ignored, as
+	// cargo-auditable itself does.
+	maxDependenciesSize = 8 * 1024 * 1024
+)
+
+var (
+	log = capnslog.NewPackageLogger("github.com/coreos/clair", "worker/detectors/feature/cargo")
+
+	elfMagic = []byte("\x7fELF")
+
+	errInvalidExecutable  = errors.New("invalid ELF file")
+	errDependenciesTooBig = errors.New("dependency tree too big")
+	errNoDirectories      = errors.New("no directories")
+	errRootDirectory      = errors.New("root directory")
+
+	// directories are where executables are looked for by default. Rust executables are usually copied
+	// there by the Dockerfiles, the ones of the distributions being covered by their package
+	// managers.
+	directories = []string{"usr/local/bin/", "usr/local/cargo/bin/", "bin/", "app/"}
+)
+
+func init() {
+	detectors.RegisterFeaturesDetector("cargo", &detector{options: options{Directories: directories}})
+}
+
+type detector struct {
+	options options
+}
+
+// options are the directories where executables are looked for, every file in them being
+// extracted from the layers.
+type options struct {
+	Directories []string
+}
+
+// dependencies is the dependency tree embedded by cargo-auditable.
+type dependencies struct {
+	Packages []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Source  string `json:"source"`
+		Kind    string `json:"kind"`
+	} `json:"packages"`
+}
+
+func (d *detector) Detect(data map[string][]byte) ([]database.FeatureVersion, error) {
+	// Crates compiled into several executables are reported once.
+	pkgSet := make(map[string]database.FeatureVersion)
+	for filename, content := range data {
+		if !isExecutable(filename, content, d.options.Directories) {
+			continue
+		}
+
+		deps, err := readDependencies(content)
+		if err != nil {
+			log.Warningf("could not read the dependencies of '%s': %s. skipping", filename, err)
+			continue
+		}
+		if deps == nil {
+			continue
+		}
+
+		for _, pkg := range deps.Packages {
+			// Only the crates of crates.io have advisories, and build dependencies, e.g.
+			// procedural macros, are not part of the executable.
+			if pkg.Source != "crates.io" || pkg.Kind == "build" {
+				continue
+			}
+			if err := versionfmt.Valid(semver.ParserName, pkg.Version); err != nil {
+				log.Warningf("could not parse crate version '%s': %s. skipping", pkg.Version, err)
+				continue
+			}
+
+			pkgSet[pkg.Name+"#"+pkg.Version] = database.FeatureVersion{
+				Feature: database.Feature{
+					Name:      pkg.Name,
+					Namespace: database.Namespace{Name: Namespace, VersionFormat: semver.ParserName},
+				},
+				Version: pkg.Version,
+			}
+		}
+	}
+
+	// Convert the map into a slice.
+	pkgs := make([]database.FeatureVersion, 0, len(pkgSet))
+	for _, pkg := range pkgSet {
+		pkgs = append(pkgs, pkg)
+	}
+
+	return pkgs, nil
+}
+
+// isExecutable returns whether the given file is an ELF file in one of the given directories.
+func isExecutable(filename string, content []byte, directories []string) bool {
+	if !bytes.HasPrefix(content, elfMagic) {
+		return false
+	}
+	for _, directory := range directories {
+		if strings.HasPrefix(filename, directory) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDependencies returns the dependency tree embedded in an ELF file, or nil if it has none.
+func readDependencies(content []byte) (deps *dependencies, err error) {
+	// debug/elf isn't hardened against malicious files.
+	defer func() {
+		if r := recover(); r != nil {
+			deps, err = nil, errInvalidExecutable
+		}
+	}()
+
+	f, err := elf.NewFile(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := f.Section(section)
+	if s == nil || s.Type == elf.SHT_NOBITS {
+		return nil, nil
+	}
+
+	zr, err := zlib.NewReader(io.LimitReader(s.Open(), maxDependenciesSize))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	d, err := ioutil.ReadAll(io.LimitReader(zr, maxDependenciesSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(d) > maxDependenciesSize {
+		return nil, errDependenciesTooBig
+	}
+
+	deps = &dependencies{}
+	if err := json.Unmarshal(d, deps); err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+func (d *detector) GetRequiredFiles() []string {
+	return []string{}
+}
+
+func (d *detector) GetOptionalFiles() []string {
+	return d.options.Directories
+}
+
+func (d *detector) Options() interface{} {
+	return &d.options
+}
+
+func (d *detector) Configure() error {
+	if len(d.options.Directories) == 0 {
+		return errNoDirectories
+	}
+	// The directories are prefixes of the paths of the files, which have no leading /. The root
+	// directory isn't allowed as every file of the layers would be extracted.
+	for i, directory := range d.options.Directories {
+		directory = strings.Trim(directory, "/")
+		if directory == "" {
+			return errRootDirectory
+		}
+		d.options.Directories[i] = directory + "/"
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cargo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/semver"
+	"github.com/coreos/clair/worker/detectors/feature"
+)
+
+func TestCargoFeatureDetection(t *testing.T) {
+	namespace := database.Namespace{Name: Namespace, VersionFormat: semver.ParserName}
+	hello := feature.LoadFileForTest("cargo/testdata/hello")
+
+	testData := []feature.TestData{
+		{
+			// The build dependencies, the local and git crates are ignored, and crates found in
+			// several executables are reported once.
+			FeatureVersions: []database.FeatureVersion{
+				{
+					Feature: database.Feature{Name: "smallvec", Namespace: namespace},
+					Version: "1.6.0",
+				},
+				{
+					Feature: database.Feature{Name: "time", Namespace: namespace},
+					Version: "0.1.43",
+				},
+			},
+			Data: map[string][]byte{
+				"usr/local/bin/hello":     hello,
+				"app/hello":               hello,
+				"usr/local/bin/unaudited": feature.LoadFileForTest("cargo/testdata/unaudited"),
+				"usr/local/bin/truncated": hello[:len(hello)/2],
+				"usr/local/bin/script":    []byte("#!/bin/sh\n"),
+				"var/lib/dpkg/status":     []byte("Package: hello\n"),
+			},
+		},
+		{
+			// Executables are only looked for in their usual directories.
+			FeatureVersions: []database.FeatureVersion{},
+			Data: map[string][]byte{
+				"usr/lib/hello": hello,
+			},
+		},
+	}
+	feature.TestDetector(t, &detector{options: options{Directories: directories}}, testData)
+}
+
+func TestCargoDirectoriesOption(t *testing.T) {
+	d := &detector{options: options{Directories: []string{"/opt/bin/", "/srv"}}}
+	assert.Nil(t, d.Configure())
+	assert.Equal(t, []string{"opt/bin/", "srv/"}, d.GetOptionalFiles())
+
+	hello := feature.LoadFileForTest("cargo/testdata/hello")
+	features, err := d.Detect(map[string][]byte{"usr/local/bin/hello": hello})
+	assert.Nil(t, err)
+	assert.Len(t, features, 0)
+	features, err = d.Detect(map[string][]byte{"srv/hello": hello})
+	assert.Nil(t, err)
+	assert.Len(t, features, 2)
+
+	assert.Equal(t, errNoDirectories, (&detector{}).Configure())
+	assert.Equal(t, errRootDirectory, (&detector{options: options{Directories: []string{"/"}}}).Configure())
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package composer implements a FeaturesDetector for the PHP packages installed with Composer,
+// which lists them in the vendor/composer/installed.json file of every project.
+package composer
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/composer"
+	"github.com/coreos/clair/worker/detectors"
+)
+
+const (
+	// Namespace is the namespace of the packages published on Packagist.
+	Namespace = "packagist"
+
+	installed = "vendor/composer/installed.json"
+)
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "worker/detectors/feature/composer")
+
+func init() {
+	detectors.RegisterFeaturesDetector("composer", &detector{})
+}
+
+type detector struct {
+	options options
+}
+
+// options restrict the directories of the projects that are searched.
+type options struct {
+	detectors.PathFilter `yaml:",inline"`
+}
+
+type installedPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func (d *detector) Detect(data map[string][]byte) ([]database.FeatureVersion, error) {
+	// Packages installed in several projects are reported once.
+	pkgSet := make(map[string]database.FeatureVersion)
+	for filename, content := range data {
+		if !d.options.Match(filename) {
+			continue
+		}
+		if filename != installed && !strings.HasSuffix(filename, "/"+installed) {
+			continue
+		}
+
+		pkgs, err := parseInstalled(content)
+		if err != nil {
+			log.Warningf("could not parse '%s': %s. skipping", filename, err)
+			continue
+		}
+
+		for _, pkg := range pkgs {
+			// Branches, e.g. "dev-master", can't be compared to the fixed versions.
+			if err := versionfmt.Valid(composer.ParserName, pkg.Version); err != nil {
+				log.Debugf("could not parse package version '%s': %s. skipping", pkg.Version, err)
+				continue
+			}
+			version := strings.TrimPrefix(pkg.Version, "v")
+
+			pkgSet[pkg.Name+"#"+version] = database.FeatureVersion{
+				Feature: database.Feature{
+					Name:      pkg.Name,
+					Namespace: database.Namespace{Name: Namespace, VersionFormat: composer.ParserName},
+				},
+				Version: version,
+			}
+		}
+	}
+
+	// Convert the map into a slice.
+	pkgs := make([]database.FeatureVersion, 0, len(pkgSet))
+	for _, pkg := range pkgSet {
+		pkgs = append(pkgs, pkg)
+	}
+
+	return pkgs, nil
+}
+
+// parseInstalled returns the packages listed by an installed.json file: an array of packages up
+// to Composer 1, and an object with a "packages" array since Composer 2.
+func parseInstalled(content []byte) ([]installedPackage, error) {
+	var pkgs []installedPackage
+	if err := json.Unmarshal(content, &pkgs); err == nil {
+		return pkgs, nil
+	}
+
+	var v2 struct {
+		Packages []installedPackage `json:"packages"`
+	}
+	if err := json.Unmarshal(content, &v2); err != nil {
+		return nil, err
+	}
+	return v2.Packages, nil
+}
+
+func (d *detector) GetRequiredFiles() []string {
+	return []string{}
+}
+
+func (d *detector) GetRequiredNames() []string {
+	return []string{installed}
+}
+
+func (d *detector) Options() interface{} {
+	return &d.options
+}
+
+func (d *detector) Configure() error {
+	return d.options.Validate()
+}
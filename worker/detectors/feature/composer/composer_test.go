@@ -0,0 +1,79 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composer
+
+import (
+	"testing"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/composer"
+	"github.com/coreos/clair/worker/detectors/feature"
+)
+
+func TestComposerFeatureDetection(t *testing.T) {
+	namespace := database.Namespace{Name: Namespace, VersionFormat: composer.ParserName}
+
+	testData := []feature.TestData{
+		{
+			// Both formats are parsed, branches are ignored, and packages installed in several
+			// projects are reported once.
+			FeatureVersions: []database.FeatureVersion{
+				{
+					Feature: database.Feature{Name: "monolog/monolog", Namespace: namespace},
+					Version: "1.25.1",
+				},
+				{
+					Feature: database.Feature{Name: "psr/log", Namespace: namespace},
+					Version: "1.1.0",
+				},
+				{
+					Feature: database.Feature{Name: "symfony/http-kernel", Namespace: namespace},
+					Version: "5.4.20",
+				},
+			},
+			Data: map[string][]byte{
+				"var/www/legacy/vendor/composer/installed.json": feature.LoadFileForTest("composer/testdata/installed_v1.json"),
+				"app/vendor/composer/installed.json":            feature.LoadFileForTest("composer/testdata/installed_v2.json"),
+				"srv/vendor/composer/installed.json":            []byte("not JSON"),
+			},
+		},
+	}
+	feature.TestDetector(t, &detector{}, testData)
+
+	// The projects can be restricted to some directories, down to some depth.
+	d := &detector{}
+	d.options.Paths = []string{"/var/www/*", "app"}
+	d.options.MaxDepth = 5
+	testData = []feature.TestData{
+		{
+			FeatureVersions: []database.FeatureVersion{
+				{
+					Feature: database.Feature{Name: "monolog/monolog", Namespace: namespace},
+					Version: "1.25.1",
+				},
+				{
+					Feature: database.Feature{Name: "psr/log", Namespace: namespace},
+					Version: "1.1.0",
+				},
+			},
+			Data: map[string][]byte{
+				"var/www/legacy/vendor/composer/installed.json":             feature.LoadFileForTest("composer/testdata/installed_v1.json"),
+				"app/tests/fixtures/project/vendor/composer/installed.json": feature.LoadFileForTest("composer/testdata/installed_v2.json"),
+				"opt/project/vendor/composer/installed.json":                feature.LoadFileForTest("composer/testdata/installed_v2.json"),
+			},
+		},
+	}
+	feature.TestDetector(t, d, testData)
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conda implements a FeaturesDetector for the packages installed with conda, which
+// describes each of them in a JSON file of the conda-meta directory of every environment, e.g.
+// /opt/conda/conda-meta/numpy-1.21.5-py39h7a5d4dd_3.json.
+package conda
+
+import (
+	"encoding/json"
+	"path"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/conda"
+	"github.com/coreos/clair/worker/detectors"
+)
+
+const (
+	// Namespace is the namespace of the packages installed with conda, whatever their channel.
+	Namespace = "conda"
+
+	metaPattern = "conda-meta/*.json"
+)
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "worker/detectors/feature/conda")
+
+func init() {
+	detectors.RegisterFeaturesDetector("conda", &detector{})
+}
+
+type detector struct {
+	options options
+}
+
+// options restrict the directories of the environments that are searched.
+type options struct {
+	detectors.PathFilter `yaml:",inline"`
+}
+
+// meta is the part of a conda-meta file identifying a package.
+type meta struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func (d *detector) Detect(data map[string][]byte) ([]database.FeatureVersion, error) {
+	// Packages installed in several environments are reported once.
+	pkgSet := make(map[string]database.FeatureVersion)
+	for filename, content := range data {
+		if !d.options.Match(filename) {
+			continue
+		}
+		if matched, _ := path.Match(metaPattern, path.Join(path.Base(path.Dir(filename)), path.Base(filename))); !matched {
+			continue
+		}
+
+		var m meta
+		if err := json.Unmarshal(content, &m); err != nil {
+			log.Warningf("could not parse '%s': %s. skipping", filename, err)
+			continue
+		}
+		if m.Name == "" {
+			continue
+		}
+		if err := versionfmt.Valid(conda.ParserName, m.Version); err != nil {
+			log.Warningf("could not parse package version '%s': %s. skipping", m.Version, err)
+			continue
+		}
+
+		pkgSet[m.Name+"#"+m.Version] = database.FeatureVersion{
+			Feature: database.Feature{
+				Name:      m.Name,
+				Namespace: database.Namespace{Name: Namespace, VersionFormat: conda.ParserName},
+			},
+			Version: m.Version,
+		}
+	}
+
+	// Convert the map into a slice.
+	pkgs := make([]database.FeatureVersion, 0, len(pkgSet))
+	for _, pkg := range pkgSet {
+		pkgs = append(pkgs, pkg)
+	}
+
+	return pkgs, nil
+}
+
+func (d *detector) GetRequiredFiles() []string {
+	return []string{}
+}
+
+func (d *detector) GetRequiredNames() []string {
+	return []string{metaPattern}
+}
+
+func (d *detector) Options() interface{} {
+	return &d.options
+}
+
+func (d *detector) Configure() error {
+	return d.options.Validate()
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conda
+
+import (
+	"testing"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/conda"
+	"github.com/coreos/clair/worker/detectors/feature"
+)
+
+func TestCondaFeatureDetection(t *testing.T) {
+	namespace := database.Namespace{Name: Namespace, VersionFormat: conda.ParserName}
+
+	testData := []feature.TestData{
+		{
+			// Packages of every environment are reported, packages installed in several
+			// environments are reported once, and other JSON files are ignored.
+			FeatureVersions: []database.FeatureVersion{
+				{
+					Feature: database.Feature{Name: "numpy", Namespace: namespace},
+					Version: "1.21.5",
+				},
+				{
+					Feature: database.Feature{Name: "pytorch", Namespace: namespace},
+					Version: "1.12.1",
+				},
+				{
+					Feature: database.Feature{Name: "openssl", Namespace: namespace},
+					Version: "1.1.1q",
+				},
+			},
+			Data: map[string][]byte{
+				"opt/conda/conda-meta/numpy-1.21.5-py39h7a5d4dd_3.json":                           feature.LoadFileForTest("conda/testdata/numpy-1.21.5-py39h7a5d4dd_3.json"),
+				"opt/conda/conda-meta/openssl-1.1.1q-h7f8727e_0.json":                             feature.LoadFileForTest("conda/testdata/openssl-1.1.1q-h7f8727e_0.json"),
+				"opt/conda/envs/torch/conda-meta/numpy-1.21.5-py39h7a5d4dd_3.json":                feature.LoadFileForTest("conda/testdata/numpy-1.21.5-py39h7a5d4dd_3.json"),
+				"opt/conda/envs/torch/conda-meta/pytorch-1.12.1-py3.9_cuda11.3_cudnn8.3.2_0.json": feature.LoadFileForTest("conda/testdata/pytorch-1.12.1-py3.9_cuda11.3_cudnn8.3.2_0.json"),
+				"opt/conda/envs/torch/conda-meta/history.json":                                    []byte("not JSON"),
+				"opt/conda/pkgs/numpy-1.21.5-py39h7a5d4dd_3/info/index.json":                      feature.LoadFileForTest("conda/testdata/numpy-1.21.5-py39h7a5d4dd_3.json"),
+			},
+		},
+	}
+	feature.TestDetector(t, &detector{}, testData)
+}
@@ -30,6 +30,9 @@ import (
 var (
 	log = capnslog.NewPackageLogger("github.com/coreos/clair", "worker/detectors/packages")
 
+	// infoDir is the directory in which dpkg lists the files of every package.
+	infoDir = "var/lib/dpkg/info/"
+
 	dpkgSrcCaptureRegexp      = regexp.MustCompile(`Source: (?P<name>[^\s]*)( \((?P<version>.*)\))?`)
 	dpkgSrcCaptureRegexpNames = dpkgSrcCaptureRegexp.SubexpNames()
 )
@@ -51,18 +54,61 @@ func (detector *DpkgFeaturesDetector) Detect(data map[string][]byte) ([]database
 	// Create a map to store packages and ensure their uniqueness
 	packagesMap := make(map[string]database.FeatureVersion)
 
+	// Packages are described by paragraphs separated by empty lines.
 	var pkg database.FeatureVersion
+	var binary, architecture string
 	var err error
+	addPackage := func() {
+		if pkg.Feature.Name != "" && pkg.Version != "" {
+			pkg.Evidence = evidence(data, binary, architecture)
+
+			// Binary packages of the same source may be in different states, e.g. one installed
+			// and the other removed but for its configuration files: the installed one wins. The
+			// files of all of them are evidence.
+			key := pkg.Feature.Name + "#" + pkg.Version
+			if existing, ok := packagesMap[key]; ok {
+				if existing.State == database.InstalledState {
+					pkg.State = existing.State
+				}
+				if existing.Evidence != nil {
+					pkg.Evidence = append(pkg.Evidence, existing.Evidence...)
+				}
+			}
+			packagesMap[key] = pkg
+		}
+		pkg = database.FeatureVersion{}
+		binary, architecture = "", ""
+	}
+
 	scanner := bufio.NewScanner(strings.NewReader(string(f)))
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		if strings.HasPrefix(line, "Package: ") {
+		if strings.TrimSpace(line) == "" {
+			addPackage()
+		} else if strings.HasPrefix(line, "Package: ") {
 			// Package line
-			// Defines the name of the package
+			// Defines the name of the package, unless a Source line defines it
 
-			pkg.Feature.Name = strings.TrimSpace(strings.TrimPrefix(line, "Package: "))
-			pkg.Version = ""
+			binary = strings.TrimSpace(strings.TrimPrefix(line, "Package: "))
+			if pkg.Feature.Name == "" {
+				pkg.Feature.Name = binary
+			}
+		} else if strings.HasPrefix(line, "Architecture: ") {
+			// Architecture line
+			// Qualifies the name of the files of the package in the database of dpkg, when
+			// packages of several architectures may be installed together
+
+			architecture = strings.TrimSpace(strings.TrimPrefix(line, "Architecture: "))
+		} else if strings.HasPrefix(line, "Status: ") {
+			// Status line
+			// Gives the desired action, an error flag and the state of the package, e.g.
+			// "install ok installed" or "deinstall ok config-files"
+
+			fields := strings.Fields(strings.TrimPrefix(line, "Status: "))
+			if len(fields) == 3 {
+				pkg.State = fields[2]
+			}
 		} else if strings.HasPrefix(line, "Source: ") {
 			// Source line (Optionnal)
 			// Gives the name of the source package
@@ -79,7 +125,7 @@ func (detector *DpkgFeaturesDetector) Detect(data map[string][]byte) ([]database
 				version := md["version"]
 				err = versionfmt.Valid(dpkg.ParserName, version)
 				if err != nil {
-					log.Warningf("could not parse package version '%s': %s. skipping", string(line[1]), err.Error())
+					log.Warningf("could not parse package version '%s': %s. skipping", version, err.Error())
 				} else {
 					pkg.Version = version
 				}
@@ -93,19 +139,13 @@ func (detector *DpkgFeaturesDetector) Detect(data map[string][]byte) ([]database
 			version := strings.TrimPrefix(line, "Version: ")
 			err = versionfmt.Valid(dpkg.ParserName, version)
 			if err != nil {
-				log.Warningf("could not parse package version '%s': %s. skipping", string(line[1]), err.Error())
+				log.Warningf("could not parse package version '%s': %s. skipping", version, err.Error())
 			} else {
 				pkg.Version = version
 			}
 		}
-
-		// Add the package to the result array if we have all the informations
-		if pkg.Feature.Name != "" && pkg.Version != "" {
-			packagesMap[pkg.Feature.Name+"#"+pkg.Version] = pkg
-			pkg.Feature.Name = ""
-			pkg.Version = ""
-		}
 	}
+	addPackage()
 
 	// Convert the map to a slice
 	packages := make([]database.FeatureVersion, 0, len(packagesMap))
@@ -116,8 +156,32 @@ func (detector *DpkgFeaturesDetector) Detect(data map[string][]byte) ([]database
 	return packages, nil
 }
 
+// evidence returns the executables and libraries installed by the given binary package according
+// to the list of its files, or nil if the list wasn't extracted.
+func evidence(data map[string][]byte, binary, architecture string) []string {
+	list, ok := data[infoDir+binary+":"+architecture+".list"]
+	if !ok {
+		if list, ok = data[infoDir+binary+".list"]; !ok {
+			return nil
+		}
+	}
+
+	files := []string{}
+	for _, line := range strings.Split(string(list), "\n") {
+		if file := strings.TrimPrefix(strings.TrimSpace(line), "/"); detectors.IsEvidence(file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
 // GetRequiredFiles returns the list of files required for Detect, without
 // leading /
 func (detector *DpkgFeaturesDetector) GetRequiredFiles() []string {
 	return []string{"var/lib/dpkg/status"}
 }
+
+// GetEvidenceNames returns the patterns of the lists of the files of the packages.
+func (detector *DpkgFeaturesDetector) GetEvidenceNames() []string {
+	return []string{infoDir + "*.list"}
+}
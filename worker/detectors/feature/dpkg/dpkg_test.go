@@ -30,20 +30,65 @@ func TestDpkgFeatureDetection(t *testing.T) {
 				{
 					Feature: database.Feature{Name: "pam"},
 					Version: "1.1.8-3.1ubuntu3",
+					State:   database.InstalledState,
 				},
 				{
 					Feature: database.Feature{Name: "makedev"}, // The source name and the package name are equals
 					Version: "2.3.1-93ubuntu1",                 // The version comes from the "Version:" line
+					State:   database.InstalledState,
 				},
 				{
 					Feature: database.Feature{Name: "gcc-5"},
 					Version: "5.1.1-12ubuntu1", // The version comes from the "Source:" line
+					State:   database.InstalledState,
 				},
 			},
 			Data: map[string][]byte{
 				"var/lib/dpkg/status": feature.LoadFileForTest("dpkg/testdata/status"),
 			},
 		},
+		// Test packages that aren't fully installed
+		{
+			FeatureVersions: []database.FeatureVersion{
+				// A binary package of this source is removed but the other is installed
+				{
+					Feature: database.Feature{Name: "openssl"},
+					Version: "1.0.2g-1ubuntu4.15",
+					State:   database.InstalledState,
+				},
+				{
+					Feature: database.Feature{Name: "curl"},
+					Version: "7.47.0-1ubuntu2.19",
+					State:   "half-installed",
+				},
+			},
+			Data: map[string][]byte{
+				"var/lib/dpkg/status": feature.LoadFileForTest("dpkg/testdata/status-removed"),
+			},
+		},
+		// Test the executables and libraries of the packages, listed by dpkg
+		{
+			FeatureVersions: []database.FeatureVersion{
+				// The removed binary package only lists its configuration files
+				{
+					Feature:  database.Feature{Name: "openssl"},
+					Version:  "1.0.2g-1ubuntu4.15",
+					State:    database.InstalledState,
+					Evidence: []string{"usr/bin/c_rehash", "usr/bin/openssl"},
+				},
+				// The files of this package aren't listed
+				{
+					Feature: database.Feature{Name: "curl"},
+					Version: "7.47.0-1ubuntu2.19",
+					State:   "half-installed",
+				},
+			},
+			Data: map[string][]byte{
+				"var/lib/dpkg/status":                      feature.LoadFileForTest("dpkg/testdata/status-removed"),
+				"var/lib/dpkg/info/libssl1.0.0:amd64.list": []byte("/etc/ssl/openssl.cnf\n"),
+				"var/lib/dpkg/info/openssl.list":           []byte("/.\n/usr\n/usr/bin\n/usr/bin/c_rehash\n/usr/bin/openssl\n/usr/lib/ssl/misc/CA.pl\n/usr/share/doc/openssl/README\n"),
+			},
+		},
 	}
 
 	feature.TestDetector(t, &DpkgFeaturesDetector{}, testData)
@@ -0,0 +1,175 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nuget implements a FeaturesDetector for the NuGet packages of .NET applications, which
+// are listed in the .deps.json file of every published application and described by a .nuspec
+// file in every package folder, e.g. of the global packages folder ~/.nuget/packages.
+package nuget
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"path"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt"
+	"github.com/coreos/clair/ext/versionfmt/nuget"
+	"github.com/coreos/clair/worker/detectors"
+)
+
+const (
+	// Namespace is the namespace of the packages published on nuget.org.
+	Namespace = "nuget"
+
+	depsPattern    = "*.deps.json"
+	nuspecPattern  = "*.nuspec"
+	runtimePackTag = "runtimepack."
+)
+
+var log = capnslog.NewPackageLogger("github.com/coreos/clair", "worker/detectors/feature/nuget")
+
+func init() {
+	detectors.RegisterFeaturesDetector("nuget", &detector{})
+}
+
+type detector struct {
+	options options
+}
+
+// options restrict the directories of the applications that are searched.
+type options struct {
+	detectors.PathFilter `yaml:",inline"`
+}
+
+// deps is the part of a .deps.json file listing the libraries of an application.
+type deps struct {
+	Libraries map[string]struct {
+		Type string `json:"type"`
+	} `json:"libraries"`
+}
+
+// nuspec is the part of a .nuspec file identifying a package.
+type nuspec struct {
+	ID      string `xml:"metadata>id"`
+	Version string `xml:"metadata>version"`
+}
+
+func (d *detector) Detect(data map[string][]byte) ([]database.FeatureVersion, error) {
+	// Packages used by several applications are reported once.
+	pkgSet := make(map[string]database.FeatureVersion)
+	for filename, content := range data {
+		if !d.options.Match(filename) {
+			continue
+		}
+		var pkgs [][2]string
+		var err error
+		if matched, _ := path.Match(depsPattern, path.Base(filename)); matched {
+			pkgs, err = parseDeps(content)
+		} else if matched, _ := path.Match(nuspecPattern, path.Base(filename)); matched {
+			pkgs, err = parseNuspec(content)
+		} else {
+			continue
+		}
+		if err != nil {
+			log.Warningf("could not parse '%s': %s. skipping", filename, err)
+			continue
+		}
+
+		for _, pkg := range pkgs {
+			// Package IDs are case insensitive.
+			name, version := strings.ToLower(pkg[0]), pkg[1]
+			if err := versionfmt.Valid(nuget.ParserName, version); err != nil {
+				log.Warningf("could not parse package version '%s': %s. skipping", version, err)
+				continue
+			}
+
+			pkgSet[name+"#"+version] = database.FeatureVersion{
+				Feature: database.Feature{
+					Name:      name,
+					Namespace: database.Namespace{Name: Namespace, VersionFormat: nuget.ParserName},
+				},
+				Version: version,
+			}
+		}
+	}
+
+	// Convert the map into a slice.
+	pkgs := make([]database.FeatureVersion, 0, len(pkgSet))
+	for _, pkg := range pkgSet {
+		pkgs = append(pkgs, pkg)
+	}
+
+	return pkgs, nil
+}
+
+// parseDeps returns the names and versions of the packages listed by a .deps.json file, whose
+// libraries are keyed by "Name/Version". The runtime packs of self-contained applications are
+// reported as the runtime packages they come from.
+func parseDeps(content []byte) ([][2]string, error) {
+	var d deps
+	if err := json.Unmarshal(content, &d); err != nil {
+		return nil, err
+	}
+
+	var pkgs [][2]string
+	for key, library := range d.Libraries {
+		i := strings.LastIndex(key, "/")
+		if i < 0 {
+			continue
+		}
+		name, version := key[:i], key[i+1:]
+
+		switch library.Type {
+		case "package":
+		case "runtimepack":
+			name = strings.TrimPrefix(name, runtimePackTag)
+		default:
+			// Projects are part of the application itself.
+			continue
+		}
+		pkgs = append(pkgs, [2]string{name, version})
+	}
+	return pkgs, nil
+}
+
+// parseNuspec returns the name and version of the package described by a .nuspec file.
+func parseNuspec(content []byte) ([][2]string, error) {
+	var n nuspec
+	if err := xml.Unmarshal(content, &n); err != nil {
+		return nil, err
+	}
+	if n.ID == "" {
+		return nil, nil
+	}
+	return [][2]string{{n.ID, n.Version}}, nil
+}
+
+func (d *detector) GetRequiredFiles() []string {
+	return []string{}
+}
+
+func (d *detector) GetRequiredNames() []string {
+	return []string{depsPattern, nuspecPattern}
+}
+
+func (d *detector) Options() interface{} {
+	return &d.options
+}
+
+func (d *detector) Configure() error {
+	return d.options.Validate()
+}
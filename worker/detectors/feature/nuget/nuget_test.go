@@ -0,0 +1,60 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nuget
+
+import (
+	"testing"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/nuget"
+	"github.com/coreos/clair/worker/detectors/feature"
+)
+
+func TestNuGetFeatureDetection(t *testing.T) {
+	namespace := database.Namespace{Name: Namespace, VersionFormat: nuget.ParserName}
+
+	testData := []feature.TestData{
+		{
+			// Packages and runtime packs of applications and package folders are reported with
+			// lowercase names, projects are ignored, and packages used by several applications
+			// are reported once.
+			FeatureVersions: []database.FeatureVersion{
+				{
+					Feature: database.Feature{Name: "microsoft.netcore.app.runtime.linux-x64", Namespace: namespace},
+					Version: "6.0.5",
+				},
+				{
+					Feature: database.Feature{Name: "newtonsoft.json", Namespace: namespace},
+					Version: "12.0.3",
+				},
+				{
+					Feature: database.Feature{Name: "system.text.encodings.web", Namespace: namespace},
+					Version: "4.7.1",
+				},
+				{
+					Feature: database.Feature{Name: "newtonsoft.json", Namespace: namespace},
+					Version: "13.0.1",
+				},
+			},
+			Data: map[string][]byte{
+				"app/MyApp.deps.json":       feature.LoadFileForTest("nuget/testdata/MyApp.deps.json"),
+				"srv/other/MyApp.deps.json": feature.LoadFileForTest("nuget/testdata/MyApp.deps.json"),
+				"root/.nuget/packages/newtonsoft.json/13.0.1/newtonsoft.json.nuspec": feature.LoadFileForTest("nuget/testdata/newtonsoft.json.nuspec"),
+				"app/Broken.deps.json": []byte("not JSON"),
+			},
+		},
+	}
+	feature.TestDetector(t, &detector{}, testData)
+}
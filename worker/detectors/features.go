@@ -16,7 +16,11 @@ package detectors
 
 import (
 	"fmt"
+	"path"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/coreos/clair/database"
 )
@@ -30,6 +34,62 @@ type FeaturesDetector interface {
 	GetRequiredFiles() []string
 }
 
+// OptionalFilesDetector is implemented by the FeaturesDetectors that also use files which are
+// not extracted when they are too big, e.g. executables searched for embedded metadata.
+type OptionalFilesDetector interface {
+	// GetOptionalFiles returns the list of optional files used by Detect, without leading /.
+	GetOptionalFiles() []string
+}
+
+// NamesDetector is implemented by the FeaturesDetectors that use files wherever they are in the
+// layers, e.g. the manifests of the dependencies of applications.
+type NamesDetector interface {
+	// GetRequiredNames returns the list of patterns, as in path.Match, of the trailing path
+	// elements of the files used by Detect.
+	GetRequiredNames() []string
+}
+
+// EvidenceDetector is implemented by the FeaturesDetectors that can tell which executables and
+// libraries the packages they detect installed, from the files matching the returned patterns.
+// Those files are only extracted when the presence of the files of the packages is recorded, and
+// Detect then fills the Evidence of the FeatureVersions with the paths of their files.
+type EvidenceDetector interface {
+	// GetEvidenceNames returns the list of patterns, as in path.Match, of the trailing path
+	// elements of the files listing the files of the packages.
+	GetEvidenceNames() []string
+}
+
+// NamespaceDependency is the dependency of the DependentDetectors that use the Namespace detected
+// by the registered NamespaceDetectors.
+const NamespaceDependency = "namespace"
+
+// DependentDetector is implemented by the FeaturesDetectors that use the output of other
+// detectors, e.g. to make their own decision based on the Namespace of the layer. DetectFeatures
+// runs the detectors they depend on first, and calls DetectWithDependencies instead of Detect.
+type DependentDetector interface {
+	// GetDependencies returns the names of the registered FeaturesDetectors whose FeatureVersions
+	// are used by DetectWithDependencies, and NamespaceDependency if it uses the Namespace.
+	GetDependencies() []string
+	// DetectWithDependencies detects a list of FeatureVersion from the input data and the output
+	// of the dependencies.
+	DetectWithDependencies(map[string][]byte, Dependencies) ([]database.FeatureVersion, error)
+}
+
+// Dependencies is the output of the detectors a DependentDetector depends on.
+type Dependencies struct {
+	// Namespace is the Namespace detected in the layer itself, if any.
+	Namespace *database.Namespace
+	// FeatureVersions are the FeatureVersions detected by each dependency, by name.
+	FeatureVersions map[string][]database.FeatureVersion
+}
+
+var (
+	// executableDirs are the directories of the executables whose presence is evidence that a
+	// package is installed, and libraryDirs the prefixes of the paths of the libraries.
+	executableDirs = []string{"bin", "sbin", "usr/bin", "usr/sbin", "usr/local/bin", "usr/local/sbin"}
+	libraryDirs    = []string{"lib/", "lib64/", "usr/lib/", "usr/lib64/", "usr/local/lib/"}
+)
+
 var (
 	featuresDetectorsLock sync.Mutex
 	featuresDetectors     = make(map[string]FeaturesDetector)
@@ -53,19 +113,182 @@ func RegisterFeaturesDetector(name string, f FeaturesDetector) {
 	featuresDetectors[name] = f
 }
 
-// DetectFeatures detects a list of FeatureVersion using every registered FeaturesDetector.
-func DetectFeatures(data map[string][]byte) ([]database.FeatureVersion, error) {
+// ExecutionPlan returns the names of the registered FeaturesDetectors, grouped in the stages in
+// which DetectFeatures runs them: the detectors of a stage only depend on the detectors of the
+// previous stages. It fails if a dependency is not registered or if the dependencies form a cycle.
+func ExecutionPlan() ([][]string, error) {
+	dependencies := make(map[string][]string, len(featuresDetectors))
+	for name, detector := range featuresDetectors {
+		dependencies[name] = nil
+		detector, ok := detector.(DependentDetector)
+		if !ok {
+			continue
+		}
+		for _, dependency := range detector.GetDependencies() {
+			if dependency == NamespaceDependency {
+				continue
+			}
+			if _, ok := featuresDetectors[dependency]; !ok {
+				return nil, fmt.Errorf("detector '%s' depends on '%s', which is not registered", name, dependency)
+			}
+			dependencies[name] = append(dependencies[name], dependency)
+		}
+	}
+
+	var plan [][]string
+	planned := make(map[string]bool, len(dependencies))
+	for len(planned) < len(dependencies) {
+		var stage []string
+		for name, nameDependencies := range dependencies {
+			if planned[name] {
+				continue
+			}
+			ready := true
+			for _, dependency := range nameDependencies {
+				if !planned[dependency] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				stage = append(stage, name)
+			}
+		}
+
+		if len(stage) == 0 {
+			var cycle []string
+			for name := range dependencies {
+				if !planned[name] {
+					cycle = append(cycle, name)
+				}
+			}
+			sort.Strings(cycle)
+			return nil, fmt.Errorf("detectors %s have circular dependencies", strings.Join(cycle, ", "))
+		}
+
+		sort.Strings(stage)
+		for _, name := range stage {
+			planned[name] = true
+		}
+		plan = append(plan, stage)
+	}
+
+	return plan, nil
+}
+
+// DetectFeatures detects a list of FeatureVersion using every registered FeaturesDetector, given
+// the Namespace detected in the layer, if any, along with the time each detector took, by name.
+// It follows the ExecutionPlan, running up to maxGoroutines of the detectors of a stage at the same
+// time. Zero runs them one at a time.
+func DetectFeatures(data map[string][]byte, namespace *database.Namespace, maxGoroutines int) ([]database.FeatureVersion, map[string]time.Duration, error) {
+	return RedetectFeatures(data, namespace, maxGoroutines, nil, false)
+}
+
+// RedetectFeatures is DetectFeatures reusing the FeatureVersions that some detectors previously
+// detected in the same data, by name, rather than running them again. A detector is run anyway if
+// a detector it depends on is, or if it depends on the Namespace and namespaceChanged. Only the
+// detectors that are run have their time returned.
+func RedetectFeatures(data map[string][]byte, namespace *database.Namespace, maxGoroutines int, previous map[string][]database.FeatureVersion, namespaceChanged bool) ([]database.FeatureVersion, map[string]time.Duration, error) {
+	if maxGoroutines < 1 {
+		maxGoroutines = 1
+	}
+
+	plan, err := ExecutionPlan()
+	if err != nil {
+		return []database.FeatureVersion{}, nil, err
+	}
+
+	detected := make(map[string][]database.FeatureVersion, len(featuresDetectors))
+	durations := make(map[string]time.Duration, len(featuresDetectors))
 	var packages []database.FeatureVersion
+	for _, names := range plan {
+		results := make([][]database.FeatureVersion, len(names))
+		errs := make([]error, len(names))
+		stageDurations := make([]time.Duration, len(names))
+		ran := make([]bool, len(names))
+		slots := make(chan struct{}, maxGoroutines)
+		var wg sync.WaitGroup
+		for i, name := range names {
+			if reusable(name, previous, namespaceChanged, durations) {
+				results[i] = previous[name]
+				continue
+			}
 
-	for _, detector := range featuresDetectors {
-		pkgs, err := detector.Detect(data)
-		if err != nil {
-			return []database.FeatureVersion{}, err
+			ran[i] = true
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(i int, detector FeaturesDetector) {
+				start := time.Now()
+				defer func() {
+					stageDurations[i] = time.Since(start)
+					<-slots
+					wg.Done()
+				}()
+				if detector, ok := detector.(DependentDetector); ok {
+					results[i], errs[i] = detector.DetectWithDependencies(data, dependenciesOf(detector, namespace, detected))
+					return
+				}
+				results[i], errs[i] = detector.Detect(data)
+			}(i, featuresDetectors[name])
+		}
+		wg.Wait()
+
+		for i, name := range names {
+			if errs[i] != nil {
+				return []database.FeatureVersion{}, nil, errs[i]
+			}
+			if ran[i] {
+				durations[name] = stageDurations[i]
+			}
+			for j := range results[i] {
+				results[i][j].DetectedBy = name
+			}
+			detected[name] = results[i]
+			packages = append(packages, results[i]...)
 		}
-		packages = append(packages, pkgs...)
 	}
 
-	return packages, nil
+	return packages, durations, nil
+}
+
+// reusable returns whether the previous FeatureVersions of the detector with the given name can be
+// reused, given the detectors that have been run so far, which have a duration.
+func reusable(name string, previous map[string][]database.FeatureVersion, namespaceChanged bool, run map[string]time.Duration) bool {
+	if _, ok := previous[name]; !ok {
+		return false
+	}
+	detector, ok := featuresDetectors[name].(DependentDetector)
+	if !ok {
+		return true
+	}
+	for _, dependency := range detector.GetDependencies() {
+		if dependency == NamespaceDependency {
+			if namespaceChanged {
+				return false
+			}
+			continue
+		}
+		if _, ok := run[dependency]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// dependenciesOf returns the output of the detectors the given DependentDetector depends on.
+func dependenciesOf(detector DependentDetector, namespace *database.Namespace, detected map[string][]database.FeatureVersion) Dependencies {
+	var dependencies Dependencies
+	for _, dependency := range detector.GetDependencies() {
+		if dependency == NamespaceDependency {
+			dependencies.Namespace = namespace
+			continue
+		}
+		if dependencies.FeatureVersions == nil {
+			dependencies.FeatureVersions = make(map[string][]database.FeatureVersion)
+		}
+		dependencies.FeatureVersions[dependency] = detected[dependency]
+	}
+	return dependencies
 }
 
 // GetRequiredFilesFeatures returns the list of files required for Detect for every
@@ -77,3 +300,59 @@ func GetRequiredFilesFeatures() (files []string) {
 
 	return
 }
+
+// GetOptionalFilesFeatures returns the list of optional files used by Detect for every
+// registered FeaturesDetector implementing OptionalFilesDetector, without leading /.
+func GetOptionalFilesFeatures() (files []string) {
+	for _, detector := range featuresDetectors {
+		if detector, ok := detector.(OptionalFilesDetector); ok {
+			files = append(files, detector.GetOptionalFiles()...)
+		}
+	}
+
+	return
+}
+
+// GetRequiredNamesFeatures returns the list of patterns of the trailing path elements of the files
+// used by Detect for every registered FeaturesDetector implementing NamesDetector.
+func GetRequiredNamesFeatures() (names []string) {
+	for _, detector := range featuresDetectors {
+		if detector, ok := detector.(NamesDetector); ok {
+			names = append(names, detector.GetRequiredNames()...)
+		}
+	}
+
+	return
+}
+
+// GetEvidenceNamesFeatures returns the list of patterns of the trailing path elements of the files
+// listing the files of the packages for every registered FeaturesDetector implementing
+// EvidenceDetector.
+func GetEvidenceNamesFeatures() (names []string) {
+	for _, detector := range featuresDetectors {
+		if detector, ok := detector.(EvidenceDetector); ok {
+			names = append(names, detector.GetEvidenceNames()...)
+		}
+	}
+
+	return
+}
+
+// IsEvidence returns whether the file at the given path, without leading /, is an executable or a
+// shared library, whose presence is evidence that the package which installed it is usable.
+func IsEvidence(filename string) bool {
+	dir, name := path.Split(filename)
+	for _, executableDir := range executableDirs {
+		if dir == executableDir+"/" {
+			return true
+		}
+	}
+	if strings.HasSuffix(name, ".so") || strings.Contains(name, ".so.") {
+		for _, libraryDir := range libraryDirs {
+			if strings.HasPrefix(dir, libraryDir) {
+				return true
+			}
+		}
+	}
+	return false
+}
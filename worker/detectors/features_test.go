@@ -0,0 +1,163 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package detectors
+
+import (
+	"testing"
+
+	"github.com/coreos/clair/database"
+	"github.com/stretchr/testify/assert"
+)
+
+type testDetector struct {
+	features []database.FeatureVersion
+}
+
+func (d testDetector) Detect(map[string][]byte) ([]database.FeatureVersion, error) {
+	return d.features, nil
+}
+
+func (d testDetector) GetRequiredFiles() []string { return nil }
+
+type testDependentDetector struct {
+	testDetector
+	dependencies []string
+	detected     *Dependencies
+}
+
+func (d *testDependentDetector) GetDependencies() []string { return d.dependencies }
+
+func (d *testDependentDetector) DetectWithDependencies(data map[string][]byte, dependencies Dependencies) ([]database.FeatureVersion, error) {
+	d.detected = &dependencies
+	return d.Detect(data)
+}
+
+// withFeaturesDetectors replaces the registered FeaturesDetectors during f.
+func withFeaturesDetectors(detectors map[string]FeaturesDetector, f func()) {
+	registered := featuresDetectors
+	featuresDetectors = detectors
+	defer func() { featuresDetectors = registered }()
+	f()
+}
+
+func TestExecutionPlan(t *testing.T) {
+	withFeaturesDetectors(map[string]FeaturesDetector{
+		"dpkg":     testDetector{},
+		"rpm":      testDetector{},
+		"language": &testDependentDetector{dependencies: []string{NamespaceDependency, "dpkg"}},
+		"bundled":  &testDependentDetector{dependencies: []string{"language", "rpm"}},
+		"os":       &testDependentDetector{dependencies: []string{NamespaceDependency}},
+	}, func() {
+		plan, err := ExecutionPlan()
+		if assert.Nil(t, err) {
+			assert.Equal(t, [][]string{{"dpkg", "os", "rpm"}, {"language"}, {"bundled"}}, plan)
+		}
+	})
+
+	withFeaturesDetectors(map[string]FeaturesDetector{
+		"language": &testDependentDetector{dependencies: []string{"dpkg"}},
+	}, func() {
+		_, err := ExecutionPlan()
+		assert.EqualError(t, err, "detector 'language' depends on 'dpkg', which is not registered")
+	})
+
+	withFeaturesDetectors(map[string]FeaturesDetector{
+		"dpkg": testDetector{},
+		"a":    &testDependentDetector{dependencies: []string{"b"}},
+		"b":    &testDependentDetector{dependencies: []string{"dpkg", "a"}},
+	}, func() {
+		_, err := ExecutionPlan()
+		assert.EqualError(t, err, "detectors a, b have circular dependencies")
+	})
+}
+
+func TestDetectFeaturesDependencies(t *testing.T) {
+	namespace := &database.Namespace{Name: "debian:8", VersionFormat: "dpkg"}
+	dpkg := []database.FeatureVersion{{Feature: database.Feature{Name: "openssl"}, Version: "1.0.1t-1"}}
+	language := &testDependentDetector{
+		testDetector: testDetector{features: []database.FeatureVersion{{Feature: database.Feature{Name: "requests"}, Version: "2.9.1"}}},
+		dependencies: []string{NamespaceDependency, "dpkg"},
+	}
+	other := &testDependentDetector{dependencies: []string{"language"}}
+
+	withFeaturesDetectors(map[string]FeaturesDetector{
+		"dpkg":     testDetector{features: dpkg},
+		"language": language,
+		"other":    other,
+	}, func() {
+		features, durations, err := DetectFeatures(nil, namespace, 2)
+		if assert.Nil(t, err) && assert.Len(t, features, 2) {
+			assert.Equal(t, "dpkg", features[0].DetectedBy)
+			assert.Equal(t, "language", features[1].DetectedBy)
+		}
+		assert.Len(t, durations, 3)
+		if assert.NotNil(t, language.detected) {
+			assert.Equal(t, namespace, language.detected.Namespace)
+			assert.Equal(t, dpkg, language.detected.FeatureVersions["dpkg"])
+		}
+		if assert.NotNil(t, other.detected) {
+			assert.Nil(t, other.detected.Namespace)
+			assert.Len(t, other.detected.FeatureVersions["language"], 1)
+		}
+	})
+}
+
+func TestRedetectFeatures(t *testing.T) {
+	namespace := &database.Namespace{Name: "debian:8", VersionFormat: "dpkg"}
+	dpkg := []database.FeatureVersion{{Feature: database.Feature{Name: "openssl"}, Version: "1.0.1u-1"}}
+	language := &testDependentDetector{
+		testDetector: testDetector{features: []database.FeatureVersion{{Feature: database.Feature{Name: "requests"}, Version: "2.9.1"}}},
+		dependencies: []string{NamespaceDependency, "dpkg"},
+	}
+	rpm := &testDependentDetector{dependencies: []string{}}
+
+	withFeaturesDetectors(map[string]FeaturesDetector{
+		"dpkg":     testDetector{features: dpkg},
+		"language": language,
+		"rpm":      rpm,
+	}, func() {
+		previous := map[string][]database.FeatureVersion{
+			"language": {{Feature: database.Feature{Name: "requests"}, Version: "2.9.0"}},
+			"rpm":      nil,
+		}
+
+		// The detectors depending on a detector that runs again run again too.
+		features, durations, err := RedetectFeatures(nil, namespace, 1, previous, false)
+		if assert.Nil(t, err) && assert.Len(t, features, 2) {
+			assert.Equal(t, "1.0.1u-1", features[0].Version)
+			assert.Equal(t, "2.9.1", features[1].Version)
+		}
+		assert.Len(t, durations, 2)
+		assert.NotContains(t, durations, "rpm")
+		assert.Nil(t, rpm.detected)
+
+		// The others reuse their previous results, unless they depend on the namespace and it
+		// changed.
+		previous["dpkg"] = dpkg
+		language.detected = nil
+		features, durations, err = RedetectFeatures(nil, namespace, 1, previous, false)
+		if assert.Nil(t, err) && assert.Len(t, features, 2) {
+			assert.Equal(t, "2.9.0", features[1].Version)
+			assert.Equal(t, "language", features[1].DetectedBy)
+		}
+		assert.Empty(t, durations)
+		assert.Nil(t, language.detected)
+
+		_, durations, err = RedetectFeatures(nil, namespace, 1, previous, true)
+		assert.Nil(t, err)
+		assert.Len(t, durations, 1)
+		assert.NotNil(t, language.detected)
+	})
+}
@@ -21,7 +21,7 @@ import (
 	"strings"
 
 	"github.com/coreos/clair/database"
-	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/ext/versionfmt/apk"
 	"github.com/coreos/clair/worker/detectors"
 )
 
@@ -51,7 +51,7 @@ func (d *detector) Detect(data map[string][]byte) *database.Namespace {
 				versionNumbers := strings.Split(match[0], ".")
 				return &database.Namespace{
 					Name:          osName + ":" + "v" + versionNumbers[0] + "." + versionNumbers[1],
-					VersionFormat: dpkg.ParserName,
+					VersionFormat: apk.ParserName,
 				}
 			}
 		}
@@ -20,6 +20,7 @@ import (
 	"strings"
 
 	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/ext/versionfmt/apk"
 	"github.com/coreos/clair/ext/versionfmt/dpkg"
 	"github.com/coreos/clair/ext/versionfmt/rpm"
 	"github.com/coreos/clair/worker/detectors"
@@ -30,6 +31,10 @@ var (
 
 	osReleaseOSRegexp      = regexp.MustCompile(`^ID=(.*)`)
 	osReleaseVersionRegexp = regexp.MustCompile(`^VERSION_ID=(.*)`)
+
+	// alpineVersionRegexp matches the major and minor versions of Alpine, which name its branches,
+	// e.g. 3.18 for 3.18.4.
+	alpineVersionRegexp = regexp.MustCompile(`^(\d+\.\d+)(\.|$)`)
 )
 
 // OsReleaseNamespaceDetector implements NamespaceDetector and detects the OS from the
@@ -79,8 +84,20 @@ func (detector *OsReleaseNamespaceDetector) Detect(data map[string][]byte) *data
 	switch OS {
 	case "debian", "ubuntu":
 		versionFormat = dpkg.ParserName
-	case "centos", "rhel", "fedora", "amzn", "ol", "oracle":
+	case "centos", "rhel", "fedora", "amzn", "ol", "oracle", "sles", "opensuse-leap":
+		versionFormat = rpm.ParserName
+	case "opensuse":
+		// openSUSE Leap 42 predates the opensuse-leap ID.
 		versionFormat = rpm.ParserName
+		OS = "opensuse-leap"
+	case "alpine":
+		// The Alpine namespaces are named after the branches, as in /etc/alpine-release.
+		versionFormat = apk.ParserName
+		r := alpineVersionRegexp.FindStringSubmatch(version)
+		if r == nil {
+			return nil
+		}
+		version = "v" + r[1]
 	default:
 		return nil
 	}
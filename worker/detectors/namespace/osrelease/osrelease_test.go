@@ -71,6 +71,67 @@ REDHAT_SUPPORT_PRODUCT="Fedora"
 REDHAT_SUPPORT_PRODUCT_VERSION=20`),
 			},
 		},
+		{ // Alpine is named after its branch
+			ExpectedNamespace: &database.Namespace{Name: "alpine:v3.18"},
+			Data: map[string][]byte{
+				"etc/os-release": []byte(
+					`NAME="Alpine Linux"
+ID=alpine
+VERSION_ID=3.18.4
+PRETTY_NAME="Alpine Linux v3.18"
+HOME_URL="https://alpinelinux.org/"
+BUG_REPORT_URL="https://gitlab.alpinelinux.org/alpine/aports/-/issues"`),
+			},
+		},
+		{ // The edge snapshots have no branch
+			ExpectedNamespace: nil,
+			Data: map[string][]byte{
+				"etc/os-release": []byte(
+					`NAME="Alpine Linux"
+ID=alpine
+VERSION_ID=20231016
+PRETTY_NAME="Alpine Linux edge"`),
+			},
+		},
+		{ // SUSE Linux Enterprise Server 15 SP5, e.g. a BCI image
+			ExpectedNamespace: &database.Namespace{Name: "sles:15.5"},
+			Data: map[string][]byte{
+				"usr/lib/os-release": []byte(
+					`NAME="SLES"
+VERSION="15-SP5"
+VERSION_ID="15.5"
+PRETTY_NAME="SUSE Linux Enterprise Server 15 SP5"
+ID="sles"
+ID_LIKE="suse"
+ANSI_COLOR="0;32"
+CPE_NAME="cpe:/o:suse:sles:15:sp5"`),
+			},
+		},
+		{
+			ExpectedNamespace: &database.Namespace{Name: "opensuse-leap:15.5"},
+			Data: map[string][]byte{
+				"etc/os-release": []byte(
+					`NAME="openSUSE Leap"
+VERSION="15.5"
+ID="opensuse-leap"
+ID_LIKE="suse opensuse"
+VERSION_ID="15.5"
+PRETTY_NAME="openSUSE Leap 15.5"
+CPE_NAME="cpe:/o:opensuse:leap:15.5"`),
+			},
+		},
+		{ // openSUSE Leap 42 has the opensuse ID
+			ExpectedNamespace: &database.Namespace{Name: "opensuse-leap:42.3"},
+			Data: map[string][]byte{
+				"etc/os-release": []byte(
+					`NAME="openSUSE Leap"
+VERSION="42.3"
+ID=opensuse
+ID_LIKE="suse"
+VERSION_ID="42.3"
+PRETTY_NAME="openSUSE Leap 42.3"`),
+			},
+		},
 	}
 
 	namespace.TestDetector(t, &OsReleaseNamespaceDetector{}, testData)
@@ -0,0 +1,196 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/clair/database"
+)
+
+// Priority is the priority of a layer submitted to a Queue.
+type Priority int
+
+const (
+	// Interactive layers, e.g. submitted by CI pipelines waiting for their report, are indexed
+	// first.
+	Interactive Priority = iota
+	// Bulk layers, e.g. submitted by registry backfills, are only indexed when no interactive layer
+	// is waiting.
+	Bulk
+
+	numPriorities = 2
+
+	// QueueRetryAfter is how long clients are advised to wait before submitting again a layer that
+	// has been rejected with ErrQueueFull.
+	QueueRetryAfter = 30 * time.Second
+)
+
+var (
+	// ErrQueueFull is returned when a layer is submitted while too many layers are already being
+	// indexed or waiting to be.
+	ErrQueueFull = errors.New("worker: too many layers are waiting to be indexed")
+
+	// ErrInvalidPriority is returned when parsing an unknown priority.
+	ErrInvalidPriority = errors.New("worker: invalid priority")
+
+	priorityNames = [numPriorities]string{"interactive", "bulk"}
+
+	promQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "clair_worker_queue_depth",
+		Help: "Number of layers waiting to be indexed, per priority.",
+	}, []string{"priority"})
+
+	promQueueProcessing = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "clair_worker_queue_processing",
+		Help: "Number of layers being indexed.",
+	})
+
+	promQueueRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clair_worker_queue_rejected_total",
+		Help: "Number of layers rejected because the queue was full, per priority.",
+	}, []string{"priority"})
+)
+
+func init() {
+	prometheus.MustRegister(promQueueDepth)
+	prometheus.MustRegister(promQueueProcessing)
+	prometheus.MustRegister(promQueueRejectedTotal)
+}
+
+// ParsePriority returns the priority of the given name; the empty name is Interactive.
+func ParsePriority(name string) (Priority, error) {
+	if name == "" {
+		return Interactive, nil
+	}
+	for priority, priorityName := range priorityNames {
+		if name == priorityName {
+			return Priority(priority), nil
+		}
+	}
+	return Interactive, ErrInvalidPriority
+}
+
+func (p Priority) String() string {
+	if p < 0 || p >= numPriorities {
+		return "unknown"
+	}
+	return priorityNames[p]
+}
+
+// Queue bounds the number of layers indexed concurrently. Layers wait for their turn in priority
+// order, and are rejected with ErrQueueFull once too many of them are queued.
+//
+// A nil Queue processes the layers immediately.
+type Queue struct {
+	concurrency int
+	maxDepth    int
+
+	mu         sync.Mutex
+	processing int
+	waiting    [numPriorities][]chan struct{}
+}
+
+// NewQueue creates a Queue indexing up to concurrency layers at once and rejecting the layers
+// submitted while maxDepth layers are being indexed or waiting to be. Zero disables either limit.
+func NewQueue(concurrency, maxDepth int) *Queue {
+	return &Queue{concurrency: concurrency, maxDepth: maxDepth}
+}
+
+// Depth returns the number of layers being indexed or waiting to be.
+func (q *Queue) Depth() int {
+	if q == nil {
+		return 0
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depth()
+}
+
+func (q *Queue) depth() int {
+	depth := q.processing
+	for _, waiting := range q.waiting {
+		depth += len(waiting)
+	}
+	return depth
+}
+
+// Process waits for the turn of the layer and processes it, see Process.
+func (q *Queue) Process(ctx context.Context, datastore database.Datastore, priority Priority, imageFormat, name, parentName, path, digest string, headers map[string]string) error {
+	if q == nil {
+		return Process(ctx, datastore, imageFormat, name, parentName, path, digest, headers)
+	}
+
+	if err := q.acquire(priority); err != nil {
+		return err
+	}
+	defer q.release()
+
+	return Process(ctx, datastore, imageFormat, name, parentName, path, digest, headers)
+}
+
+// acquire waits until the layer can be indexed.
+func (q *Queue) acquire(priority Priority) error {
+	if priority < 0 || priority >= numPriorities {
+		return ErrInvalidPriority
+	}
+
+	q.mu.Lock()
+	if q.maxDepth > 0 && q.depth() >= q.maxDepth {
+		q.mu.Unlock()
+		promQueueRejectedTotal.WithLabelValues(priority.String()).Inc()
+		return ErrQueueFull
+	}
+
+	// Layers only wait while every slot is taken, as release hands the freed slots over to them.
+	if q.concurrency <= 0 || q.processing < q.concurrency {
+		q.processing++
+		q.mu.Unlock()
+		promQueueProcessing.Inc()
+		return nil
+	}
+
+	turn := make(chan struct{})
+	q.waiting[priority] = append(q.waiting[priority], turn)
+	q.mu.Unlock()
+	promQueueDepth.WithLabelValues(priority.String()).Inc()
+
+	<-turn
+	promQueueDepth.WithLabelValues(priority.String()).Dec()
+	return nil
+}
+
+// release frees the slot of a processed layer, or hands it over to the next waiting layer.
+func (q *Queue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for priority, waiting := range q.waiting {
+		if len(waiting) > 0 {
+			close(waiting[0])
+			q.waiting[priority] = waiting[1:]
+			return
+		}
+	}
+
+	q.processing--
+	promQueueProcessing.Dec()
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	q := NewQueue(1, 3)
+
+	// The first layer is indexed immediately.
+	assert.Nil(t, q.acquire(Bulk))
+
+	// The next ones wait, interactive ones first.
+	order := make(chan Priority, 2)
+	for _, priority := range []Priority{Bulk, Interactive} {
+		go func(priority Priority) {
+			if assert.Nil(t, q.acquire(priority)) {
+				order <- priority
+				q.release()
+			}
+		}(priority)
+
+		// Wait for the layer to be queued.
+		for depth := q.Depth(); depth == q.Depth(); {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The queue is full.
+	assert.Equal(t, 3, q.Depth())
+	assert.Equal(t, ErrQueueFull, q.acquire(Interactive))
+
+	q.release()
+	assert.Equal(t, Interactive, <-order)
+	assert.Equal(t, Bulk, <-order)
+	assert.Equal(t, 0, q.Depth())
+}
+
+func TestParsePriority(t *testing.T) {
+	for _, priority := range []Priority{Interactive, Bulk} {
+		parsed, err := ParsePriority(priority.String())
+		assert.Nil(t, err)
+		assert.Equal(t, priority, parsed)
+	}
+
+	parsed, err := ParsePriority("")
+	assert.Nil(t, err)
+	assert.Equal(t, Interactive, parsed)
+
+	_, err = ParsePriority("urgent")
+	assert.Equal(t, ErrInvalidPriority, err)
+}
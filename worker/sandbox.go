@@ -0,0 +1,319 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/coreos/clair/utils"
+	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/worker/detectors"
+)
+
+// SandboxCommand is the argument with which the Clair binary serves a sandboxed analysis
+// (see ServeSandbox).
+const SandboxCommand = "sandbox"
+
+// maxSandboxStderr is the amount of the standard error of the sandboxed processes that is kept
+// to explain their failures.
+const maxSandboxStderr = 64 * 1024
+
+// maxSandboxResponse is the size of the largest response of a sandboxed process, which is mostly
+// made of the features of the layer and the files retained with its analysis.
+const maxSandboxResponse = 64 * 1024 * 1024
+
+var (
+	// sandbox is the Sandbox in which the layers are analyzed, nil to analyze them in-process.
+	sandbox *Sandbox
+
+	// sandboxErrors are the errors that keep their identity when returned by a sandboxed analysis,
+	// because callers compare them.
+	sandboxErrors = []error{
+		detectors.ErrCouldNotFindLayer,
+		utils.ErrCouldNotExtract,
+		utils.ErrExtractedFileTooBig,
+		utils.ErrExtractedArchiveTooBig,
+		utils.ErrInsecureArchive,
+		utils.ErrDigestMismatch,
+		utils.ErrInvalidDigest,
+	}
+
+	// sandboxEnv are the environment variables passed to the sandboxed processes; the others,
+	// e.g. database or registry credentials, are not.
+	sandboxEnv = []string{"PATH", "TMPDIR", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"}
+
+	// errSandboxTimeout is returned when a sandboxed analysis takes longer than the Sandbox's
+	// Timeout.
+	errSandboxTimeout = errors.New("worker: the sandboxed analysis timed out")
+
+	// errSandboxResponseTooBig is returned when a sandboxed process writes a response bigger than
+	// maxSandboxResponse.
+	errSandboxResponseTooBig = fmt.Errorf("worker: the sandboxed analysis returned more than %d bytes", maxSandboxResponse)
+
+	promSandboxFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_worker_sandbox_failures_total",
+		Help: "Number of sandboxed analyses that crashed, were killed or timed out.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(promSandboxFailuresTotal)
+}
+
+// Sandbox runs the download, the extraction and the detectors of every layer in a separate
+// process with restricted resources, so a malicious layer exploiting them can neither reach the
+// memory of Clair, e.g. its credentials, nor exhaust the resources of the host.
+type Sandbox struct {
+	// Command is the command serving the sandboxed analyses, typically the Clair binary itself
+	// followed by SandboxCommand.
+	Command []string
+
+	// Timeout is the time after which a sandboxed process is killed. Zero means no timeout.
+	Timeout time.Duration
+
+	// Namespaces runs the sandboxed processes in their own user, mount, PID, IPC and UTS
+	// namespaces. They keep the network namespace of Clair to download the layers.
+	Namespaces bool
+
+	// Seccomp makes the sandboxed processes install a seccomp filter denying them the system
+	// calls that only serve to escape or attack the host, before they read the layer.
+	Seccomp bool
+
+	Limits SandboxLimits
+}
+
+// SandboxLimits are the resource limits applied to a sandboxed process before it reads the
+// layer. Zero values leave the corresponding limit unchanged, except for MaxFileSize.
+type SandboxLimits struct {
+	// CPUTime is the CPU time after which the process is killed.
+	CPUTime time.Duration
+
+	// MaxFileSize is the size of the largest file the process, or the commands it executes such
+	// as rpm, may write. Zero means the size of the largest file extracted from a layer.
+	MaxFileSize int64
+
+	// MaxOpenFiles is the number of files the process may have open at the same time.
+	MaxOpenFiles uint64
+
+	// MaxMemory is the size of the memory the process, or the commands it executes, may allocate.
+	// The Go runtime crashes when it exceeds it.
+	MaxMemory int64
+}
+
+// UseSandbox makes the layers be analyzed in the given Sandbox, or in-process if it is nil.
+func UseSandbox(s *Sandbox) {
+	sandbox = s
+}
+
+// DefaultSandboxCommand returns the command re-executing the running binary as a sandbox.
+func DefaultSandboxCommand() []string {
+	return []string{selfExecutable(), SandboxCommand}
+}
+
+// sandboxRequest is what a sandboxed process reads on its standard input.
+type sandboxRequest struct {
+	Format  string
+	Path    string
+	Digest  string
+	Headers map[string]string
+	Limits  SandboxLimits
+	Seccomp bool
+	Budget  Budget
+
+	// Evidence is whether the evidence of the features is recorded.
+	Evidence bool
+
+	// Detectors is how the detectors are configured.
+	Detectors detectorsConfig
+
+	// Previous is the previous analysis of the layer, whose retained files are analyzed instead of
+	// downloading the layer, if any.
+	Previous *detection
+}
+
+// sandboxResponse is what a sandboxed process writes on its standard output.
+type sandboxResponse struct {
+	detection
+
+	Error      string
+	BadRequest bool
+}
+
+// detect analyzes a layer in a new sandboxed process.
+func (s *Sandbox) detect(format, path, digest string, headers map[string]string, previous *detection) (detection, error) {
+	if len(s.Command) == 0 {
+		return detection{}, errors.New("worker: the sandbox has no command")
+	}
+
+	limits := s.Limits
+	if limits.MaxFileSize == 0 {
+		limits.MaxFileSize = budget.maxFileSize()
+	}
+
+	// The process is killed once it exceeds either the Timeout of the sandbox or the one of the
+	// budget.
+	timeout, timeoutErr := s.Timeout, error(errSandboxTimeout)
+	if budget.Timeout > 0 && (timeout == 0 || budget.Timeout < timeout) {
+		timeout, timeoutErr = budget.Timeout, budget.exceeded(BudgetTime)
+	}
+
+	request, err := json.Marshal(sandboxRequest{Format: format, Path: path, Digest: digest, Headers: headers, Limits: limits, Seccomp: s.Seccomp, Budget: budget, Evidence: recordEvidence, Detectors: configuredDetectors, Previous: previous})
+	if err != nil {
+		return detection{}, err
+	}
+
+	stderr := &utils.LimitedBuffer{Max: maxSandboxStderr}
+
+	cmd := exec.Command(s.Command[0], s.Command[1:]...)
+	cmd.Env = filterEnv(os.Environ(), sandboxEnv)
+	cmd.Dir = os.TempDir()
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = sandboxSysProcAttr(s.Namespaces)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return detection{}, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		promSandboxFailuresTotal.Inc()
+		return detection{}, fmt.Errorf("worker: could not start the sandbox: %s", err)
+	}
+
+	timedOut := make(chan struct{})
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			close(timedOut)
+			killSandbox(cmd.Process)
+		})
+		defer timer.Stop()
+	}
+
+	// The response is read up to its maximum size, as the process may be under the control of
+	// a malicious layer; a process writing more is killed.
+	response, readErr := ioutil.ReadAll(io.LimitReader(stdout, maxSandboxResponse+1))
+	tooBig := len(response) > maxSandboxResponse
+	if tooBig {
+		killSandbox(cmd.Process)
+	}
+
+	err = cmd.Wait()
+	// Whatever happened, the commands the sandboxed process executed must not outlive it.
+	killSandbox(cmd.Process)
+
+	select {
+	case <-timedOut:
+		promSandboxFailuresTotal.Inc()
+		return detection{}, timeoutErr
+	default:
+	}
+	if tooBig {
+		promSandboxFailuresTotal.Inc()
+		return detection{}, errSandboxResponseTooBig
+	}
+
+	var decoded sandboxResponse
+	if decodeErr := json.Unmarshal(response, &decoded); decodeErr != nil {
+		promSandboxFailuresTotal.Inc()
+		if err == nil {
+			err = readErr
+		}
+		if err == nil {
+			err = decodeErr
+		}
+		return detection{}, fmt.Errorf("worker: the sandbox failed: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if decoded.Error != "" {
+		return detection{}, decoded.err()
+	}
+	return decoded.detection, nil
+}
+
+// err returns the error the sandboxed process failed with.
+func (r sandboxResponse) err() error {
+	for _, err := range sandboxErrors {
+		if err.Error() == r.Error {
+			return err
+		}
+	}
+	if r.BadRequest {
+		return cerrors.NewBadRequestError(r.Error)
+	}
+	return errors.New(r.Error)
+}
+
+// ServeSandbox analyzes, within the limits it specifies, the layer requested on r and writes
+// the result on w. It is run by the sandboxed processes, which must not have done anything else
+// beforehand.
+func ServeSandbox(r io.Reader, w io.Writer) error {
+	var request sandboxRequest
+	if err := json.NewDecoder(r).Decode(&request); err != nil {
+		return err
+	}
+
+	if err := setSandboxLimits(request.Limits); err != nil {
+		return err
+	}
+	if request.Seccomp {
+		if err := installSeccomp(); err != nil {
+			return fmt.Errorf("could not install the seccomp filter: %s", err)
+		}
+	}
+
+	// The sandboxed process is only configured by the request. Its Timeout is enforced by the
+	// parent process, which kills it.
+	recordEvidence = request.Evidence
+	budget = request.Budget
+	if err := detectors.Configure(request.Detectors.Disabled, request.Detectors.Options); err != nil {
+		return err
+	}
+
+	var response sandboxResponse
+	d, err := detect(request.Format, request.Path, request.Digest, request.Headers, request.Previous, nil)
+	if err != nil {
+		_, response.BadRequest = err.(*cerrors.ErrBadRequest)
+		response.Error = err.Error()
+	} else {
+		response.detection = d
+	}
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+// filterEnv returns the variables of env whose names are listed in names.
+func filterEnv(env, names []string) []string {
+	var filtered []string
+	for _, v := range env {
+		for _, name := range names {
+			if strings.HasPrefix(v, name+"=") {
+				filtered = append(filtered, v)
+				break
+			}
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,170 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// sandboxNamespaces are the namespaces the sandboxed processes are put in.
+	sandboxNamespaces = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+
+	// The constants of clone(2), prctl(2) and seccomp(2) missing from the syscall package.
+	cloneNewCgroup          = 0x02000000
+	prSetNoNewPrivs         = 38
+	seccompSetModeFilter    = 1
+	seccompFilterFlagTSync  = 1
+	seccompRetKillProcess   = 0x80000000
+	seccompRetErrno         = 0x00050000
+	seccompRetAllow         = 0x7fff0000
+	seccompDataArchOffset   = 4
+	seccompDataArgsOffset   = 16
+	seccompMaxSyscallNumber = 0x40000000
+)
+
+// selfExecutable returns the path of the running binary, even if it has been replaced or
+// removed since.
+func selfExecutable() string {
+	return "/proc/self/exe"
+}
+
+// sandboxSysProcAttr puts the sandboxed process in its own process group, so it can be killed
+// along with the commands it executes, and kills it if Clair dies. With namespaces, it is also
+// put in the sandboxNamespaces, keeping the user and group of Clair.
+func sandboxSysProcAttr(namespaces bool) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+	if namespaces {
+		attr.Cloneflags = sandboxNamespaces
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	}
+	return attr
+}
+
+// killSandbox kills the process group of a sandboxed process.
+func killSandbox(p *os.Process) {
+	syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
+
+// setSandboxLimits applies limits to the running process and the commands it will execute.
+func setSandboxLimits(limits SandboxLimits) error {
+	// Never dump the memory of a process that may hold the content of a malicious layer.
+	rlimits := map[int]uint64{syscall.RLIMIT_CORE: 0}
+	if limits.CPUTime > 0 {
+		// Round up, since a zero limit would kill the process immediately.
+		rlimits[syscall.RLIMIT_CPU] = uint64((limits.CPUTime + time.Second - 1) / time.Second)
+	}
+	if limits.MaxFileSize > 0 {
+		rlimits[syscall.RLIMIT_FSIZE] = uint64(limits.MaxFileSize)
+	}
+	if limits.MaxOpenFiles > 0 {
+		rlimits[syscall.RLIMIT_NOFILE] = limits.MaxOpenFiles
+	}
+	if limits.MaxMemory > 0 {
+		// RLIMIT_AS would count the address space the Go runtime reserves without using it, while
+		// RLIMIT_DATA only counts the memory it maps to use. The soft limit makes the garbage
+		// collector try to stay below it.
+		rlimits[syscall.RLIMIT_DATA] = uint64(limits.MaxMemory)
+		debug.SetMemoryLimit(limits.MaxMemory)
+	}
+
+	for resource, value := range rlimits {
+		if err := syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value}); err != nil {
+			return err
+		}
+	}
+
+	// Files too big for RLIMIT_FSIZE must fail to be written rather than kill the process.
+	signal.Ignore(syscall.SIGXFSZ)
+	return nil
+}
+
+// installSeccomp makes every thread of the running process, and the commands it will execute,
+// unable to gain privileges and to make the system calls denied by seccompFilter.
+func installSeccomp() error {
+	if seccompArch == 0 {
+		return errors.New("seccomp is not supported on " + runtime.GOARCH)
+	}
+
+	// Both calls must be made by the same thread: the filter can only be installed by a thread
+	// that can't gain privileges, and is then synchronized to the others.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return errno
+	}
+
+	filter := seccompFilter()
+	program := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	r, _, errno := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTSync, uintptr(unsafe.Pointer(&program)))
+	if errno != 0 {
+		return errno
+	}
+	if r != 0 {
+		return errors.New("a thread could not be synchronized")
+	}
+	return nil
+}
+
+// seccompFilter returns the BPF program of the seccomp filter. It kills the process if it makes
+// system calls of another architecture, e.g. 32-bit ones, and fails the seccompDenied system calls
+// and the x32 ones with EPERM. clone3 fails with ENOSYS, since its flags can't be inspected, so
+// that the callers fall back to clone, which fails with EPERM when asked to create namespaces.
+func seccompFilter() []syscall.SockFilter {
+	n := len(seccompDenied)
+	// The instructions are laid out as follows, with n denied system calls.
+	var (
+		checkFlags = 7 + n
+		kill       = 10 + n
+		eperm      = 11 + n
+		enosys     = 12 + n
+	)
+	// jump returns the offset of the target instruction from the one following the instruction i.
+	jump := func(i, target int) uint8 {
+		return uint8(target - i - 1)
+	}
+
+	filter := []syscall.SockFilter{
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: seccompDataArchOffset},
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, K: seccompArch, Jf: jump(1, kill)},
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: 0},
+		{Code: syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K, K: seccompMaxSyscallNumber, Jt: jump(3, eperm)},
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, K: sysClone3, Jt: jump(4, enosys)},
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, K: sysClone, Jt: jump(5, checkFlags)},
+	}
+	for i, nr := range seccompDenied {
+		filter = append(filter, syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, K: nr, Jt: jump(6+i, eperm)})
+	}
+	return append(filter,
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetAllow},
+		// The flags are the first argument of clone, whose lower half is first on little-endian
+		// architectures.
+		syscall.SockFilter{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: seccompDataArgsOffset},
+		syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JSET | syscall.BPF_K, K: sandboxNamespaces | syscall.CLONE_NEWNET | cloneNewCgroup, Jt: jump(checkFlags+1, eperm)},
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetAllow},
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetKillProcess},
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetErrno | uint32(syscall.EPERM)},
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetErrno | uint32(syscall.ENOSYS)},
+	)
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+// The seccomp filter only admits the system calls of the AUDIT_ARCH_AARCH64 architecture.
+const (
+	seccompArch = 0xc00000b7
+
+	sysClone   = 220
+	sysClone3  = 435
+	sysSeccomp = 277
+)
+
+// seccompDenied are the system calls denied by the seccomp filter, which only serve to escape or
+// attack the host.
+var seccompDenied = []uint32{
+	18,  // lookup_dcookie
+	39,  // umount2
+	40,  // mount
+	41,  // pivot_root
+	51,  // chroot
+	58,  // vhangup
+	60,  // quotactl
+	89,  // acct
+	97,  // unshare
+	104, // kexec_load
+	105, // init_module
+	106, // delete_module
+	112, // clock_settime
+	116, // syslog
+	117, // ptrace
+	142, // reboot
+	170, // settimeofday
+	171, // adjtimex
+	217, // add_key
+	218, // request_key
+	219, // keyctl
+	224, // swapon
+	225, // swapoff
+	241, // perf_event_open
+	262, // fanotify_init
+	264, // name_to_handle_at
+	265, // open_by_handle_at
+	266, // clock_adjtime
+	268, // setns
+	270, // process_vm_readv
+	271, // process_vm_writev
+	273, // finit_module
+	280, // bpf
+	282, // userfaultfd
+	294, // kexec_file_load
+	428, // open_tree
+	429, // move_mount
+	430, // fsopen
+	431, // fsconfig
+	432, // fsmount
+	433, // fspick
+	438, // pidfd_getfd
+	442, // mount_setattr
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSandboxIsolationHelper isn't a real test: it confines itself like a sandboxed process when
+// the test binary is executed by runIsolationHelper, then reports what it can still do.
+func TestSandboxIsolationHelper(t *testing.T) {
+	if len(os.Args) < 2 || os.Args[len(os.Args)-2] != "--" {
+		return
+	}
+	mode := os.Args[len(os.Args)-1]
+	if mode != "syscalls" && mode != "memory" {
+		return
+	}
+
+	if err := setSandboxLimits(SandboxLimits{MaxMemory: 256 << 20}); err != nil {
+		os.Exit(2)
+	}
+	if err := installSeccomp(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if mode == "memory" {
+		// Allocate and use twice the limit, keeping everything reachable.
+		var chunks [][]byte
+		for i := 0; i < 32; i++ {
+			chunk := make([]byte, 16<<20)
+			for j := range chunk {
+				chunk[j] = 1
+			}
+			chunks = append(chunks, chunk)
+		}
+		fmt.Println(len(chunks))
+		os.Exit(0)
+	}
+
+	result := map[string]string{"pid": fmt.Sprint(os.Getpid())}
+	errString := func(err error) string {
+		if err == nil {
+			return ""
+		}
+		return err.Error()
+	}
+	result["mount"] = errString(syscall.Mount("none", os.TempDir(), "tmpfs", 0, ""))
+	result["unshare"] = errString(syscall.Unshare(syscall.CLONE_NEWNS))
+	_, _, errno := syscall.RawSyscall(sysClone3, 0, 0, 0)
+	result["clone3"] = errString(errno)
+	result["exec"] = errString(exec.Command("true").Run())
+	nested := exec.Command("true")
+	nested.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWUSER}
+	result["exec in a namespace"] = errString(nested.Run())
+
+	json.NewEncoder(os.Stdout).Encode(result)
+	os.Exit(0)
+}
+
+// runIsolationHelper runs TestSandboxIsolationHelper in the given mode in a new process.
+func runIsolationHelper(mode string, namespaces bool) ([]byte, error) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSandboxIsolationHelper$", "--", mode)
+	cmd.SysProcAttr = sandboxSysProcAttr(namespaces)
+	return cmd.Output()
+}
+
+func TestSandboxIsolation(t *testing.T) {
+	if seccompArch == 0 {
+		t.Skip("seccomp is not supported on " + runtime.GOARCH)
+	}
+
+	out, err := runIsolationHelper("syscalls", true)
+	if err != nil {
+		t.Fatalf("the helper failed: %s", err)
+	}
+	var result map[string]string
+	if !assert.Nil(t, json.Unmarshal(out, &result)) {
+		return
+	}
+
+	// The process is the init of its own PID namespace.
+	assert.Equal(t, "1", result["pid"])
+
+	// It can't escape the sandbox, but can still execute commands, e.g. rpm.
+	eperm := syscall.EPERM.Error()
+	assert.Equal(t, eperm, result["mount"])
+	assert.Equal(t, eperm, result["unshare"])
+	assert.Equal(t, syscall.ENOSYS.Error(), result["clone3"])
+	assert.Equal(t, "", result["exec"])
+	assert.Contains(t, result["exec in a namespace"], eperm)
+
+	// It crashes once it exceeds its memory limit.
+	out, err = runIsolationHelper("memory", false)
+	assert.NotNil(t, err, "the helper allocated %s chunks", out)
+}
+
+func TestConfinedSandbox(t *testing.T) {
+	if seccompArch == 0 {
+		t.Skip("seccomp is not supported on " + runtime.GOARCH)
+	}
+
+	_, f, _, _ := runtime.Caller(0)
+	path := filepath.Join(filepath.Dir(f), "testdata", "DistUpgrade", "wheezy.tar.gz")
+	expected, err := detect("Docker", path, "", nil, nil, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// The layers are still analyzed in a confined sandbox.
+	sandbox := newTestSandbox()
+	sandbox.Namespaces = true
+	sandbox.Seccomp = true
+	sandbox.Limits.MaxMemory = 1 << 30
+	d, err := sandbox.detect("Docker", path, "", nil, nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, expected.Namespace, d.Namespace)
+		assert.Len(t, d.Features, len(expected.Features))
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package worker
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func selfExecutable() string {
+	return os.Args[0]
+}
+
+func sandboxSysProcAttr(namespaces bool) *syscall.SysProcAttr {
+	return nil
+}
+
+func killSandbox(p *os.Process) {
+	p.Kill()
+}
+
+func setSandboxLimits(limits SandboxLimits) error {
+	return errors.New("worker: the sandbox is only supported on Linux")
+}
+
+func installSeccomp() error {
+	return errors.New("seccomp is only supported on Linux")
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/clair/worker/detectors"
+)
+
+// TestSandboxHelper isn't a real test: it serves the sandbox when the test binary is executed
+// by newTestSandbox.
+func TestSandboxHelper(t *testing.T) {
+	if len(os.Args) < 2 || os.Args[len(os.Args)-2] != "--" || os.Args[len(os.Args)-1] != SandboxCommand {
+		return
+	}
+	if err := ServeSandbox(os.Stdin, os.Stdout); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func newTestSandbox() *Sandbox {
+	return &Sandbox{
+		Command: []string{os.Args[0], "-test.run=^TestSandboxHelper$", "--", SandboxCommand},
+		Timeout: time.Minute,
+		Limits:  SandboxLimits{CPUTime: time.Minute, MaxOpenFiles: 64},
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	_, f, _, _ := runtime.Caller(0)
+	path := filepath.Join(filepath.Dir(f), "testdata", "DistUpgrade", "wheezy.tar.gz")
+
+	// The sandboxed analysis finds what the in-process one does.
+	expected, err := detect("Docker", path, "", nil, nil, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	d, err := newTestSandbox().detect("Docker", path, "", nil, nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, expected.Namespace, d.Namespace)
+		if assert.Len(t, d.Features, len(expected.Features)) {
+			for _, fv := range expected.Features {
+				assert.Contains(t, d.Features, fv)
+			}
+		}
+		assert.Equal(t, expected.Stats.BytesRead, d.Stats.BytesRead)
+		assert.Equal(t, expected.Stats.FilesMatched, d.Stats.FilesMatched)
+		assert.Len(t, d.Stats.Detectors, len(expected.Stats.Detectors))
+	}
+
+	// The previous analyses are analyzed again in the sandbox without downloading the layer.
+	d, err = newTestSandbox().detect("Docker", path+".missing", "", nil, &expected)
+	if assert.Nil(t, err) {
+		assert.Equal(t, expected.Namespace, d.Namespace)
+		assert.Len(t, d.Features, len(expected.Features))
+	}
+
+	// The errors callers compare keep their identity.
+	_, err = newTestSandbox().detect("Docker", path+".missing", "", nil, nil)
+	assert.Equal(t, detectors.ErrCouldNotFindLayer, err)
+
+	// Processes running for too long are killed.
+	sandbox := &Sandbox{Command: []string{"sleep", "60"}, Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	_, err = sandbox.detect("Docker", path, "", nil, nil)
+	assert.Equal(t, errSandboxTimeout, err)
+	assert.True(t, time.Since(start) < 30*time.Second)
+
+	// So are the ones writing responses that are too big.
+	_, err = (&Sandbox{Command: []string{"yes"}, Timeout: time.Minute}).detect("Docker", path, "", nil, nil)
+	assert.Equal(t, errSandboxResponseTooBig, err)
+
+	// So are the ones exceeding the time budget, if it is shorter.
+	UseBudget(Budget{Timeout: 100 * time.Millisecond})
+	defer UseBudget(Budget{})
+	sandbox.Timeout = time.Minute
+	_, err = sandbox.detect("Docker", path, "", nil, nil)
+	assert.Equal(t, &ErrBudgetExceeded{Resource: BudgetTime, Limit: "100ms"}, err)
+
+	// Processes dying without a result fail the analysis.
+	sandbox = &Sandbox{Command: []string{"false"}}
+	_, err = sandbox.detect("Docker", path, "", nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestFilterEnv(t *testing.T) {
+	env := []string{"PATH=/bin", "CLAIR_BACKFILL_PASSWORD=secret", "PATHS=no", "TMPDIR=/tmp"}
+	assert.Equal(t, []string{"PATH=/bin", "TMPDIR=/tmp"}, filterEnv(env, sandboxEnv))
+}
@@ -17,9 +17,23 @@
 package worker
 
 import (
-	"github.com/coreos/pkg/capnslog"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
 
 	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/logging"
+	"github.com/coreos/clair/tracing"
 	"github.com/coreos/clair/utils"
 	cerrors "github.com/coreos/clair/utils/errors"
 	"github.com/coreos/clair/worker/detectors"
@@ -31,13 +45,26 @@ const (
 	Version = 3
 
 	// maxFileSize enforces a maximum size of a single file within a tarball that
-	// will be extracted. This protects against malicious layers that may contain
-	// extremely large package database files.
+	// will be extracted, unless the Budget sets another one. This protects against
+	// malicious layers that may contain extremely large package database files.
 	maxFileSize = 200 * 1024 * 1024 // 200 MiB
+
+	// maxArchiveSize enforces a maximum size of a decompressed tarball, unless the Budget sets
+	// another one. This protects against malicious layers that may be compressed bombs.
+	maxArchiveSize = 16 * 1024 * 1024 * 1024 // 16 GiB
+
+	// extractionVersion is increased each time the extraction of the files of the layers changes,
+	// which makes the files retained with the cached analyses unusable.
+	extractionVersion = 1
+
+	// maxRetainedDataSize is the size of the largest set of files extracted from a layer that is
+	// retained with its cached analysis, so that the detectors that change can be run again on
+	// them without downloading the layer.
+	maxRetainedDataSize = 4 * 1024 * 1024 // 4 MiB
 )
 
 var (
-	log = capnslog.NewPackageLogger("github.com/coreos/clair", "worker")
+	log = logging.New("worker")
 
 	// ErrUnsupported is the error that should be raised when an OS or package
 	// manager is not supported.
@@ -46,13 +73,97 @@ var (
 	// ErrParentUnknown is the error that should be raised when a parent layer
 	// has yet to be processed for the current layer.
 	ErrParentUnknown = cerrors.NewBadRequestError("worker: parent layer is unknown, it must be processed first")
+
+	// installedOnly is whether the features that aren't fully installed are dropped.
+	installedOnly bool
+
+	// recordEvidence is whether the executables and libraries of the features that are in the
+	// images are recorded.
+	recordEvidence bool
+
+	// configuredDetectors is how the detectors have been configured, which sandboxed processes
+	// configure theirs with.
+	configuredDetectors detectorsConfig
+
+	promLayerAnalysisCacheTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clair_worker_layer_analysis_cache_total",
+		Help: "Number of layers whose blob's analysis was looked up in the cache, per result (hit, partial or miss).",
+	}, []string{"result"})
+
+	promLayerAnalysisDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "clair_worker_layer_analysis_duration_seconds",
+		Help:    "Time it takes to run the detectors on the layers, whether they succeed or not, per cache result (partial or miss).",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"cache"})
 )
 
+func init() {
+	prometheus.MustRegister(promLayerAnalysisCacheTotal)
+	prometheus.MustRegister(promLayerAnalysisDurationSeconds)
+}
+
+// detection is the result of the analysis of a layer, regardless of its parent, which is cached by
+// the digest of its blob.
+type detection database.LayerAnalysisResult
+
+// detectorsConfig is the configuration of the detectors, their options being YAML-encoded.
+type detectorsConfig struct {
+	Disabled []string
+	Options  map[string][]byte
+}
+
+// IndexInstalledOnly makes the layers be indexed with only the packages that are fully installed,
+// rather than with every package along with its state, e.g. the removed dpkg packages whose
+// configuration files remain. Packages whose state is unknown are kept.
+func IndexInstalledOnly(enabled bool) {
+	installedOnly = enabled
+}
+
+// RecordEvidence makes the layers be indexed with, for every feature whose detector knows the
+// executables and libraries it installed, the ones that are in the image, i.e. that were neither
+// deleted by the layer nor by its parents, so that packages whose binaries were removed can be told
+// apart.
+func RecordEvidence(enabled bool) {
+	recordEvidence = enabled
+}
+
+// ConfigureDetectors removes the detectors with the given names and configures the others with
+// their parameters, by name, failing if a detector has no such options. It must be called before
+// any layer is processed.
+func ConfigureDetectors(disabled []string, params map[string]interface{}) error {
+	config := detectorsConfig{Disabled: disabled, Options: make(map[string][]byte, len(params))}
+	for name, param := range params {
+		options, err := yaml.Marshal(param)
+		if err != nil {
+			return err
+		}
+		config.Options[name] = options
+	}
+
+	if err := detectors.Configure(config.Disabled, config.Options); err != nil {
+		return err
+	}
+	configuredDetectors = config
+	return nil
+}
+
 // Process detects the Namespace of a layer, the features it adds/removes, and
 // then stores everything in the database.
+//
+// The digest of the blob of the layer, e.g. "sha256:…", is optional. When it is given, the blob is
+// verified against it and its analysis is cached, so that the layers having the same blob, e.g.
+// under another name or parent, aren't downloaded and analyzed again.
+//
+// The processing is traced as a child of the span of the given context, if any.
 // TODO(Quentin-M): We could have a goroutine that looks for layers that have been analyzed with an
 // older engine version and that processes them.
-func Process(datastore database.Datastore, imageFormat, name, parentName, path string, headers map[string]string) error {
+func Process(ctx context.Context, datastore database.Datastore, imageFormat, name, parentName, path, digest string, headers map[string]string) (err error) {
+	ctx, span := tracing.Start(ctx, "worker.Process", tracing.KindInternal)
+	span.SetAttribute("layer", name)
+	span.SetAttribute("format", imageFormat)
+	defer func() { span.End(err) }()
+	datastore = tracing.Datastore(ctx, datastore)
+
 	// Verify parameters.
 	if name == "" {
 		return cerrors.NewBadRequestError("could not process a layer which does not have a name")
@@ -66,8 +177,15 @@ func Process(datastore database.Datastore, imageFormat, name, parentName, path s
 		return cerrors.NewBadRequestError("could not process a layer which does not have a format")
 	}
 
-	log.Debugf("layer %s: processing (Location: %s, Engine version: %d, Parent: %s, Format: %s)",
-		name, utils.CleanURL(path), Version, parentName, imageFormat)
+	if digest != "" {
+		if err := utils.ValidateDigest(digest); err != nil {
+			return err
+		}
+	}
+
+	llog := log.With(logging.Fields{"layer": name})
+	llog.Debugf("processing (Location: %s, Engine version: %d, Parent: %s, Format: %s)",
+		utils.CleanURL(path), Version, parentName, imageFormat)
 
 	// Check to see if the layer is already in the database.
 	layer, err := datastore.FindLayer(name, false, false)
@@ -87,8 +205,7 @@ func Process(datastore database.Datastore, imageFormat, name, parentName, path s
 				return err
 			}
 			if err == cerrors.ErrNotFound {
-				log.Warningf("layer %s: the parent layer (%s) is unknown. it must be processed first", name,
-					parentName)
+				llog.Warningf("the parent layer (%s) is unknown. it must be processed first", parentName)
 				return ErrParentUnknown
 			}
 			layer.Parent = &parent
@@ -96,52 +213,389 @@ func Process(datastore database.Datastore, imageFormat, name, parentName, path s
 	} else {
 		// The layer is already in the database, check if we need to update it.
 		if layer.EngineVersion >= Version {
-			log.Debugf(`layer %s: layer content has already been processed in the past with engine %d.
-        Current engine is %d. skipping analysis`, name, layer.EngineVersion, Version)
+			llog.Debugf(`layer content has already been processed in the past with engine %d.
+        Current engine is %d. skipping analysis`, layer.EngineVersion, Version)
 			return nil
 		}
 
-		log.Debugf(`layer %s: layer content has been analyzed in the past with engine %d. Current
-      engine is %d. analyzing again`, name, layer.EngineVersion, Version)
+		llog.Debugf(`layer content has been analyzed in the past with engine %d. Current
+      engine is %d. analyzing again`, layer.EngineVersion, Version)
 	}
 
 	// Analyze the content.
-	layer.Namespace, layer.Features, err = detectContent(imageFormat, name, path, headers, layer.Parent)
+	d, err := detectContent(ctx, datastore, imageFormat, name, path, digest, headers, layer.Parent)
 	if err != nil {
 		return err
 	}
+	layer.Namespace, layer.Features, layer.Stats = d.Namespace, d.Features, d.Stats
 
 	return datastore.InsertLayer(layer)
 }
 
-// detectContent downloads a layer's archive and extracts its Namespace and Features.
-func detectContent(imageFormat, name, path string, headers map[string]string, parent *database.Layer) (namespace *database.Namespace, featureVersions []database.FeatureVersion, err error) {
-	data, err := detectors.DetectData(imageFormat, path, headers, append(detectors.GetRequiredFilesFeatures(), detectors.GetRequiredFilesNamespace()...), maxFileSize)
+// detectContent extracts the Namespace and Features of a layer, given its parent, along with the
+// statistics of the analysis of its blob.
+func detectContent(ctx context.Context, datastore database.Datastore, imageFormat, name, path, digest string, headers map[string]string, parent *database.Layer) (d detection, err error) {
+	d, err = analyze(ctx, datastore, imageFormat, name, path, digest, headers)
 	if err != nil {
-		log.Errorf("layer %s: failed to extract data from %s: %s", name, utils.CleanURL(path), err)
 		return
 	}
 
 	// Detect namespace.
-	namespace = detectNamespace(name, data, parent)
+	d.Namespace = detectNamespace(name, d.Namespace, parent)
 
 	// Detect features.
-	featureVersions, err = detectFeatureVersions(name, data, namespace, parent)
+	own := ownEvidence(d.Features)
+	d.Features, err = detectFeatureVersions(name, d.Features, d.Namespace, parent)
 	if err != nil {
 		return
 	}
-	if len(featureVersions) > 0 {
-		log.Debugf("layer %s: detected %d features", name, len(featureVersions))
+	if installedOnly {
+		d.Features = filterInstalled(d.Features)
 	}
+	if recordEvidence {
+		d.Features = inheritEvidence(d.Features, own, d.Deleted, parent)
+	}
+	llog := log.With(logging.Fields{"layer": name})
+	if len(d.Features) > 0 {
+		llog.Debugf("detected %d features", len(d.Features))
+	}
+	llog.Debugf("read %d bytes, inspected %d files and matched %d of them in %s",
+		d.Stats.BytesRead, d.Stats.FilesInspected, d.Stats.FilesMatched, d.Stats.Duration)
 
 	return
 }
 
-func detectNamespace(name string, data map[string][]byte, parent *database.Layer) (namespace *database.Namespace) {
-	// Use registered detectors to get the Namespace.
-	namespace = detectors.DetectNamespace(data)
+// analyze downloads the blob of a layer and runs the detectors on it, in the sandbox if one is
+// used. The analyses of the blobs whose digest is given are cached in the datastore, and reused as
+// long as the analysisVersion doesn't change. Otherwise, if the files extracted from the blob have
+// been retained, only the detectors whose fingerprint changed are run again on them.
+func analyze(ctx context.Context, datastore database.Datastore, imageFormat, name, path, digest string, headers map[string]string) (d detection, err error) {
+	ctx, span := tracing.Start(ctx, "worker.analyze", tracing.KindInternal)
+	defer func() { span.End(err) }()
+	datastore = tracing.Datastore(ctx, datastore)
+
+	llog := log.With(logging.Fields{"layer": name})
+	version, extraction := analysisVersion(imageFormat)
+	var previous *detection
+	cache := "miss"
+	if digest != "" {
+		analysis, err := datastore.FindLayerAnalysis(digest)
+		switch {
+		case err == nil && analysis.Version == version:
+			promLayerAnalysisCacheTotal.WithLabelValues("hit").Inc()
+			llog.Debugf("reusing the analysis of blob %s", digest)
+			span.SetAttribute("cache", "hit")
+			return detection(analysis.Result), nil
+		case err == nil && analysis.Result.Data != nil && analysis.Result.Extraction == extraction:
+			promLayerAnalysisCacheTotal.WithLabelValues("partial").Inc()
+			llog.Debugf("running the changed detectors on the files retained from blob %s", digest)
+			previous = (*detection)(&analysis.Result)
+			cache = "partial"
+		default:
+			if err != nil && err != cerrors.ErrNotFound {
+				llog.Warningf("could not look up the analysis of blob %s: %s", digest, err)
+			}
+			promLayerAnalysisCacheTotal.WithLabelValues("miss").Inc()
+		}
+	}
+
+	span.SetAttribute("cache", cache)
+
+	start := time.Now()
+	if sandbox != nil {
+		d, err = sandbox.detect(imageFormat, path, digest, headers, previous)
+	} else {
+		d, err = detectWithinBudget(imageFormat, path, digest, headers, previous)
+	}
+	promLayerAnalysisDurationSeconds.WithLabelValues(cache).Observe(time.Since(start).Seconds())
+	if err != nil {
+		err = budgetError(err)
+		llog.Errorf("failed to extract data from %s: %s", utils.CleanURL(path), err)
+		return d, err
+	}
+	d.Stats.Duration = time.Since(start)
+
+	if digest != "" {
+		analysis := database.LayerAnalysis{Digest: digest, Version: version, Result: database.LayerAnalysisResult(d)}
+		if err := datastore.InsertLayerAnalysis(analysis); err != nil {
+			llog.Warningf("could not cache the analysis of blob %s: %s", digest, err)
+		}
+	}
+	return d, nil
+}
+
+// analysisVersion identifies the detectors, by their fingerprints, and the extraction that the
+// cached analyses of the blobs of the given format must have been made with to be reused as is. It
+// also returns the fingerprint of the extraction, which the retained files must have been extracted
+// with to run the detectors again on them.
+func analysisVersion(imageFormat string) (version, extraction string) {
+	features, namespaces := detectors.Fingerprints(strconv.Itoa(Version))
+	extraction = extractionFingerprint(imageFormat, newExtractor("", nil, nil))
+
+	h := sha256.New()
+	json.NewEncoder(h).Encode(struct {
+		FeaturesDetectors  map[string]string
+		NamespaceDetectors map[string]string
+		Extraction         string
+	}{features, namespaces, extraction})
+	return fmt.Sprintf("%d-%x", Version, h.Sum(nil)[:8]), extraction
+}
+
+// extractionFingerprint identifies the files that the given Extractor extracts from the blobs of
+// the given format.
+func extractionFingerprint(imageFormat string, extractor utils.Extractor) string {
+	sorted := func(s []string) []string {
+		s = append([]string(nil), s...)
+		sort.Strings(s)
+		return s
+	}
+
+	h := sha256.New()
+	json.NewEncoder(h).Encode(struct {
+		Version                int
+		Format                 string
+		Files, Names, Optional []string
+		List                   bool
+		MaxFileSize            int64
+	}{extractionVersion, imageFormat, sorted(extractor.Files), sorted(extractor.Names), sorted(extractor.Optional), extractor.List, extractor.MaxFileSize})
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// newExtractor returns the Extractor of the files the registered detectors need, within the sizes
+// of the budget.
+func newExtractor(digest string, cancel <-chan struct{}, stats *utils.ExtractStats) utils.Extractor {
+	extractor := utils.Extractor{
+		Files:          append(detectors.GetRequiredFilesFeatures(), detectors.GetRequiredFilesNamespace()...),
+		Names:          detectors.GetRequiredNamesFeatures(),
+		Optional:       detectors.GetOptionalFilesFeatures(),
+		MaxFileSize:    budget.maxFileSize(),
+		MaxArchiveSize: budget.maxArchiveSize(),
+		Cancel:         cancel,
+		Stats:          stats,
+		Digest:         digest,
+	}
+	if recordEvidence {
+		extractor.Names = append(extractor.Names, detectors.GetEvidenceNamesFeatures()...)
+		extractor.List = true
+	}
+	return extractor
+}
+
+// detectWithinBudget runs detect in-process, canceling the analysis once it exceeds the Timeout of
+// the budget.
+func detectWithinBudget(imageFormat, path, digest string, headers map[string]string, previous *detection) (detection, error) {
+	if budget.Timeout <= 0 {
+		return detect(imageFormat, path, digest, headers, previous, nil)
+	}
+
+	cancel := make(chan struct{})
+	timer := time.AfterFunc(budget.Timeout, func() { close(cancel) })
+	d, err := detect(imageFormat, path, digest, headers, previous, cancel)
+	if !timer.Stop() {
+		return detection{}, budget.exceeded(BudgetTime)
+	}
+	return d, err
+}
+
+// detect downloads a layer's archive and runs the registered detectors on its content,
+// regardless of its parent, within the sizes of the budget. The extraction fails once cancel, if
+// not nil, is closed, or if the archive doesn't match the digest, if any. When evidence is
+// recorded, it also returns the paths of the files of the parents deleted by the layer.
+//
+// Given the previous analysis of the archive, whose files have been retained and extracted with the
+// same extractionFingerprint, it doesn't download the archive but runs the detectors whose
+// fingerprint changed, and the ones depending on them, on the retained files instead.
+func detect(imageFormat, path, digest string, headers map[string]string, previous *detection, cancel <-chan struct{}) (detection, error) {
+	var stats utils.ExtractStats
+	extractor := newExtractor(digest, cancel, &stats)
+
+	var d detection
+	d.FeaturesDetectors, d.NamespaceDetectors = detectors.Fingerprints(strconv.Itoa(Version))
+	d.Extraction = extractionFingerprint(imageFormat, extractor)
+
+	var data map[string][]byte
+	if previous != nil {
+		data = previous.Data
+		d.Stats = previous.Stats
+	} else {
+		var err error
+		data, err = detectors.DetectData(imageFormat, path, headers, extractor)
+		if err != nil {
+			return detection{}, err
+		}
+		d.Stats = database.LayerStats{
+			BytesRead:      stats.BytesRead,
+			FilesInspected: stats.Entries,
+			FilesMatched:   stats.Files,
+			BytesMatched:   stats.FileBytes,
+		}
+	}
+
+	// The namespace is detected first so the features detectors depending on it could make their
+	// own decision.
+	var reused map[string][]database.FeatureVersion
+	var namespaceChanged bool
+	if previous != nil && reflect.DeepEqual(d.NamespaceDetectors, previous.NamespaceDetectors) {
+		d.Namespace = previous.Namespace
+	} else {
+		d.Namespace = detectors.DetectNamespace(data)
+	}
+	if previous != nil {
+		reused = reusableFeatures(previous, d.FeaturesDetectors)
+		namespaceChanged = !reflect.DeepEqual(d.Namespace, previous.Namespace)
+	}
+
+	// TODO(Quentin-M): We need to pass the parent image to DetectFeatures because it's possible that
+	// some detectors would need it in order to produce the entire feature list (if they can only
+	// detect a diff).
+	featureVersions, durations, err := detectors.RedetectFeatures(data, d.Namespace, budget.MaxGoroutines, reused, namespaceChanged)
+	if err != nil {
+		return detection{}, err
+	}
+	d.Features = featureVersions
+	d.Stats.Detectors = make(map[string]time.Duration, len(d.FeaturesDetectors))
+	for name := range d.FeaturesDetectors {
+		if duration, ok := durations[name]; ok {
+			d.Stats.Detectors[name] = duration
+		} else if duration, ok := previous.Stats.Detectors[name]; ok {
+			d.Stats.Detectors[name] = duration
+		}
+	}
+
+	if recordEvidence {
+		d.Features = filterEvidence(d.Features, splitLines(data[utils.ListingPath]))
+		d.Deleted = splitLines(data[utils.DeletedPath])
+	}
+
+	var size int
+	for _, content := range data {
+		size += len(content)
+	}
+	if size <= maxRetainedDataSize {
+		d.Data = data
+	}
+
+	return d, nil
+}
+
+// reusableFeatures returns the FeatureVersions of the previous analysis, by the name of the
+// detector which detected them, for the detectors whose fingerprint didn't change.
+func reusableFeatures(previous *detection, fingerprints map[string]string) map[string][]database.FeatureVersion {
+	reused := make(map[string][]database.FeatureVersion)
+	for name, fingerprint := range fingerprints {
+		if previous.FeaturesDetectors[name] == fingerprint {
+			reused[name] = nil
+		}
+	}
+	for _, feature := range previous.Features {
+		if _, ok := reused[feature.DetectedBy]; ok {
+			reused[feature.DetectedBy] = append(reused[feature.DetectedBy], feature)
+		}
+	}
+	return reused
+}
+
+// filterEvidence keeps, in the evidence of the features, the files that are in the given listing of
+// the layer. The files of a package are assumed to be in the layer in which its package manager
+// listed them. Files listed in directories merged into /usr are found there.
+func filterEvidence(features []database.FeatureVersion, listing []string) []database.FeatureVersion {
+	files := make(map[string]struct{}, len(listing))
+	for _, file := range listing {
+		files[file] = struct{}{}
+	}
+
+	for i, feature := range features {
+		if feature.Evidence == nil {
+			continue
+		}
+		evidence := []string{}
+		for _, file := range feature.Evidence {
+			if _, ok := files[file]; ok {
+				evidence = append(evidence, file)
+			} else if _, ok := files["usr/"+file]; ok {
+				evidence = append(evidence, "usr/"+file)
+			}
+		}
+		features[i].Evidence = evidence
+	}
+	return features
+}
+
+// ownEvidence returns the evidence of the given features detected in a layer, by name:version.
+func ownEvidence(features []database.FeatureVersion) map[string][]string {
+	evidence := make(map[string][]string)
+	for _, feature := range features {
+		if feature.Evidence != nil {
+			evidence[feature.Feature.Name+":"+feature.Version] = feature.Evidence
+		}
+	}
+	return evidence
+}
+
+// inheritEvidence sets the evidence of the features of a layer to the one detected in the layer,
+// along with the one of the same features in its parent whose files the layer didn't delete.
+func inheritEvidence(features []database.FeatureVersion, own map[string][]string, deleted []string, parent *database.Layer) []database.FeatureVersion {
+	var parentEvidence map[string][]string
+	if parent != nil {
+		parentEvidence = ownEvidence(parent.Features)
+	}
+
+	// The features may be the ones of the parent, which must not be modified.
+	inherited := make([]database.FeatureVersion, len(features))
+	for i, feature := range features {
+		inherited[i] = feature
+		inherited[i].Evidence = nil
+
+		nv := feature.Feature.Name + ":" + feature.Version
+		evidence, detected := own[nv]
+		parentFiles, known := parentEvidence[nv]
+		if !detected && !known {
+			continue
+		}
+
+		files := make(map[string]struct{})
+		merged := []string{}
+		for _, file := range evidence {
+			files[file] = struct{}{}
+			merged = append(merged, file)
+		}
+		for _, file := range parentFiles {
+			if _, ok := files[file]; !ok && !isDeleted(file, deleted) {
+				merged = append(merged, file)
+			}
+		}
+		inherited[i].Evidence = merged
+	}
+	return inherited
+}
+
+// isDeleted returns whether the file at the given path is one of the deleted paths, or in one of
+// them.
+func isDeleted(file string, deleted []string) bool {
+	for _, d := range deleted {
+		if file == d || strings.HasPrefix(file, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// splitLines returns the non-empty lines of the given listing.
+func splitLines(d []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(d), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func detectNamespace(name string, detected *database.Namespace, parent *database.Layer) (namespace *database.Namespace) {
+	// Use the Namespace found by the registered detectors.
+	namespace = detected
 	if namespace != nil {
-		log.Debugf("layer %s: detected namespace %q", name, namespace.Name)
+		log.With(logging.Fields{"layer": name}).Debugf("detected namespace %q", namespace.Name)
 		return
 	}
 
@@ -149,7 +603,7 @@ func detectNamespace(name string, data map[string][]byte, parent *database.Layer
 	if parent != nil {
 		namespace = parent.Namespace
 		if namespace != nil {
-			log.Debugf("layer %s: detected namespace %q (from parent)", name, namespace.Name)
+			log.With(logging.Fields{"layer": name}).Debugf("detected namespace %q (from parent)", namespace.Name)
 			return
 		}
 	}
@@ -157,15 +611,19 @@ func detectNamespace(name string, data map[string][]byte, parent *database.Layer
 	return
 }
 
-func detectFeatureVersions(name string, data map[string][]byte, namespace *database.Namespace, parent *database.Layer) (features []database.FeatureVersion, err error) {
-	// TODO(Quentin-M): We need to pass the parent image to DetectFeatures because it's possible that
-	// some detectors would need it in order to produce the entire feature list (if they can only
-	// detect a diff). Also, we should probably pass the detected namespace so detectors could
-	// make their own decision.
-	features, err = detectors.DetectFeatures(data)
-	if err != nil {
-		return
+// filterInstalled removes the features whose state is known and isn't fully installed.
+func filterInstalled(features []database.FeatureVersion) []database.FeatureVersion {
+	filtered := make([]database.FeatureVersion, 0, len(features))
+	for _, feature := range features {
+		if feature.State == "" || feature.State == database.InstalledState {
+			filtered = append(filtered, feature)
+		}
 	}
+	return filtered
+}
+
+func detectFeatureVersions(name string, detected []database.FeatureVersion, namespace *database.Namespace, parent *database.Layer) (features []database.FeatureVersion, err error) {
+	features = detected
 
 	// If there are no FeatureVersions, use parent's FeatureVersions if possible.
 	// TODO(Quentin-M): We eventually want to give the choice to each detectors to use none/some of
@@ -203,7 +661,7 @@ func detectFeatureVersions(name string, data map[string][]byte, namespace *datab
 			continue
 		}
 
-		log.Warningf("layer %s: Layer's namespace is unknown but non-namespaced features have been detected", name)
+		log.With(logging.Fields{"layer": name}).Warningf("layer's namespace is unknown but non-namespaced features have been detected")
 		err = ErrUnsupported
 		return
 	}
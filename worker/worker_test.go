@@ -15,15 +15,21 @@
 package worker
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
 	"path/filepath"
 	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
 
 	"github.com/coreos/clair/database"
 	"github.com/coreos/clair/ext/versionfmt/dpkg"
+	"github.com/coreos/clair/utils"
 	cerrors "github.com/coreos/clair/utils/errors"
+	"github.com/coreos/clair/worker/detectors"
 
 	// Register the required detectors.
 	_ "github.com/coreos/clair/worker/detectors/data/docker"
@@ -78,9 +84,9 @@ func TestProcessWithDistUpgrade(t *testing.T) {
 	// wheezy.tar: FROM debian:wheezy
 	// jessie.tar: RUN sed -i "s/precise/trusty/" /etc/apt/sources.list && apt-get update &&
 	//             apt-get -y dist-upgrade
-	assert.Nil(t, Process(datastore, "Docker", "blank", "", testDataPath+"blank.tar.gz", nil))
-	assert.Nil(t, Process(datastore, "Docker", "wheezy", "blank", testDataPath+"wheezy.tar.gz", nil))
-	assert.Nil(t, Process(datastore, "Docker", "jessie", "wheezy", testDataPath+"jessie.tar.gz", nil))
+	assert.Nil(t, Process(context.Background(), datastore, "Docker", "blank", "", testDataPath+"blank.tar.gz", "", nil))
+	assert.Nil(t, Process(context.Background(), datastore, "Docker", "wheezy", "blank", testDataPath+"wheezy.tar.gz", "", nil))
+	assert.Nil(t, Process(context.Background(), datastore, "Docker", "jessie", "wheezy", testDataPath+"jessie.tar.gz", "", nil))
 
 	// Ensure that the 'wheezy' layer has the expected namespace and features.
 	wheezy, ok := datastore.layers["wheezy"]
@@ -91,6 +97,8 @@ func TestProcessWithDistUpgrade(t *testing.T) {
 		for _, nufv := range nonUpgradedFeatureVersions {
 			nufv.Feature.Namespace.Name = "debian:7"
 			nufv.Feature.Namespace.VersionFormat = dpkg.ParserName
+			nufv.DetectedBy = "dpkg"
+			nufv.State = database.InstalledState
 			assert.Contains(t, wheezy.Features, nufv)
 		}
 	}
@@ -104,12 +112,140 @@ func TestProcessWithDistUpgrade(t *testing.T) {
 		for _, nufv := range nonUpgradedFeatureVersions {
 			nufv.Feature.Namespace.Name = "debian:7"
 			nufv.Feature.Namespace.VersionFormat = dpkg.ParserName
+			nufv.DetectedBy = "dpkg"
+			nufv.State = database.InstalledState
 			assert.Contains(t, jessie.Features, nufv)
 		}
 		for _, nufv := range nonUpgradedFeatureVersions {
 			nufv.Feature.Namespace.Name = "debian:8"
 			nufv.Feature.Namespace.VersionFormat = dpkg.ParserName
+			nufv.DetectedBy = "dpkg"
+			nufv.State = database.InstalledState
 			assert.NotContains(t, jessie.Features, nufv)
 		}
 	}
 }
+
+func TestProcessWithCachedAnalysis(t *testing.T) {
+	_, f, _, _ := runtime.Caller(0)
+	path := filepath.Join(filepath.Dir(f), "testdata", "DistUpgrade", "wheezy.tar.gz")
+	blob, err := ioutil.ReadFile(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	sum := sha256.Sum256(blob)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	datastore := newMockDatastore()
+	datastore.FctInsertLayer = func(layer database.Layer) error {
+		datastore.layers[layer.Name] = layer
+		return nil
+	}
+	datastore.FctFindLayer = func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+		if layer, exists := datastore.layers[name]; exists {
+			return layer, nil
+		}
+		return database.Layer{}, cerrors.ErrNotFound
+	}
+	analyses := make(map[string]database.LayerAnalysis)
+	datastore.FctInsertLayerAnalysis = func(analysis database.LayerAnalysis) error {
+		analyses[analysis.Digest] = analysis
+		return nil
+	}
+	datastore.FctFindLayerAnalysis = func(digest string) (database.LayerAnalysis, error) {
+		if analysis, exists := analyses[digest]; exists {
+			return analysis, nil
+		}
+		return database.LayerAnalysis{}, cerrors.ErrNotFound
+	}
+
+	// Blobs that don't match their digest are neither indexed nor cached.
+	other := sha256.Sum256(nil)
+	assert.Equal(t, utils.ErrDigestMismatch, Process(context.Background(), datastore, "Docker", "wheezy", "", path, "sha256:"+hex.EncodeToString(other[:]), nil))
+	assert.Empty(t, analyses)
+	assert.Equal(t, utils.ErrInvalidDigest, Process(context.Background(), datastore, "Docker", "wheezy", "", path, "sha256:wheezy", nil))
+
+	assert.Nil(t, Process(context.Background(), datastore, "Docker", "wheezy", "", path, digest, nil))
+	if assert.Contains(t, analyses, digest) {
+		version, extraction := analysisVersion("Docker")
+		assert.Equal(t, version, analyses[digest].Version)
+		assert.Equal(t, extraction, analyses[digest].Result.Extraction)
+		assert.NotEmpty(t, analyses[digest].Result.Data)
+	}
+
+	// The layers having the same blob are indexed with its analysis, without downloading it.
+	assert.Nil(t, Process(context.Background(), datastore, "Docker", "wheezy-copy", "", path+".missing", digest, nil))
+	assert.Equal(t, datastore.layers["wheezy"].Namespace, datastore.layers["wheezy-copy"].Namespace)
+	assert.Equal(t, datastore.layers["wheezy"].Features, datastore.layers["wheezy-copy"].Features)
+
+	// The detectors that changed run again on the retained files, without downloading the blob,
+	// and the results of the others are reused.
+	analysis := analyses[digest]
+	analysis.Version = "outdated"
+	analysis.Result.FeaturesDetectors = map[string]string{"dpkg": "outdated"}
+	analyses[digest] = analysis
+	assert.Nil(t, Process(context.Background(), datastore, "Docker", "wheezy-partial", "", path+".missing", digest, nil))
+	assert.Equal(t, datastore.layers["wheezy"].Namespace, datastore.layers["wheezy-partial"].Namespace)
+	assert.Len(t, datastore.layers["wheezy-partial"].Features, len(datastore.layers["wheezy"].Features))
+	assert.Equal(t, analysis.Result.Stats.BytesRead, analyses[digest].Result.Stats.BytesRead)
+	assert.NotEqual(t, "outdated", analyses[digest].Result.FeaturesDetectors["dpkg"])
+
+	// The analyses whose files weren't retained, or were extracted otherwise, aren't reused.
+	analysis = analyses[digest]
+	analysis.Version = "outdated"
+	analysis.Result.Extraction = "outdated"
+	analyses[digest] = analysis
+	assert.Equal(t, detectors.ErrCouldNotFindLayer, Process(context.Background(), datastore, "Docker", "wheezy-outdated", "", path+".missing", digest, nil))
+	_, analysis.Result.Extraction = analysisVersion("Docker")
+	analysis.Result.Data = nil
+	analyses[digest] = analysis
+	assert.Equal(t, detectors.ErrCouldNotFindLayer, Process(context.Background(), datastore, "Docker", "wheezy-outdated", "", path+".missing", digest, nil))
+}
+
+func TestFilterInstalled(t *testing.T) {
+	features := []database.FeatureVersion{
+		{Feature: database.Feature{Name: "openssl"}, Version: "1.0", State: database.InstalledState},
+		{Feature: database.Feature{Name: "libssl"}, Version: "1.0", State: "config-files"},
+		{Feature: database.Feature{Name: "curl"}, Version: "7.0", State: "half-installed"},
+		{Feature: database.Feature{Name: "bash"}, Version: "4.3"},
+	}
+
+	// Packages whose state is unknown are kept.
+	filtered := filterInstalled(features)
+	if assert.Len(t, filtered, 2) {
+		assert.Equal(t, "openssl", filtered[0].Feature.Name)
+		assert.Equal(t, "bash", filtered[1].Feature.Name)
+	}
+}
+
+func TestEvidence(t *testing.T) {
+	curl := database.Feature{Name: "curl"}
+	openssl := database.Feature{Name: "openssl"}
+
+	// The files of the packages that the layer doesn't have are not evidence, and the ones of the
+	// merged directories are found in /usr.
+	base := filterEvidence([]database.FeatureVersion{
+		{Feature: curl, Version: "7.0", Evidence: []string{"usr/bin/curl", "usr/lib/libcurl.so.4"}},
+		{Feature: openssl, Version: "1.0", Evidence: []string{"bin/openssl", "usr/lib/libssl.so.1"}},
+		{Feature: database.Feature{Name: "tzdata"}, Version: "2016"},
+	}, []string{"usr/bin/curl", "usr/lib/libcurl.so.4", "usr/bin/openssl", "etc/os-release"})
+	assert.Equal(t, []string{"usr/bin/curl", "usr/lib/libcurl.so.4"}, base[0].Evidence)
+	assert.Equal(t, []string{"usr/bin/openssl"}, base[1].Evidence)
+	assert.Nil(t, base[2].Evidence)
+	base = inheritEvidence(base, ownEvidence(base), nil, nil)
+	parent := &database.Layer{Features: base}
+
+	// A layer deleting files of the packages of its parent only removes them from its evidence.
+	features := inheritEvidence(parent.Features, nil, []string{"usr/bin/curl", "usr/lib/ssl"}, parent)
+	assert.Equal(t, []string{"usr/lib/libcurl.so.4"}, features[0].Evidence)
+	assert.Equal(t, []string{"usr/bin/openssl"}, features[1].Evidence)
+	assert.Nil(t, features[2].Evidence)
+	assert.Equal(t, []string{"usr/bin/curl", "usr/lib/libcurl.so.4"}, parent.Features[0].Evidence)
+
+	// The files installed again by a layer are evidence again, and the ones of the deleted
+	// directories aren't.
+	own := map[string][]string{"curl:7.0": {"usr/bin/curl"}}
+	features = inheritEvidence(features, own, []string{"usr/lib", "usr/bin/openssl"}, &database.Layer{Features: features})
+	assert.Equal(t, []string{"usr/bin/curl"}, features[0].Evidence)
+	assert.Equal(t, []string{}, features[1].Evidence)
+}